@@ -0,0 +1,274 @@
+package alerting
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+)
+
+const (
+	defaultDebounce      = 5 * time.Minute
+	defaultCheckInterval = 30 * time.Second
+)
+
+// Config 告警配置
+type Config struct {
+	WebhookURL         string
+	Format             string        // json（默认）或 slack
+	MinHealthyChannels int           // 每种接口类型的最少健康渠道数，低于该值时告警（0 表示不检查）
+	NotifyCircuitOpen  bool          // 渠道熔断（所有密钥均熔断）时单独告警
+	Debounce           time.Duration // 同一告警的最小重复间隔
+	CheckInterval      time.Duration // 定期复查间隔（捕获按时间发生的熔断状态变化与配置变更）
+}
+
+// Source 一种接口类型的指标来源
+type Source struct {
+	APIType string // messages / responses / gemini
+	Metrics *metrics.MetricsManager
+}
+
+// Manager 渠道健康告警：订阅指标管理器的熔断状态变化，
+// 健康渠道数低于阈值或渠道熔断时向 Webhook 发送告警，恢复后发送恢复通知。
+// 同一告警在 Debounce 时间内只发送一次，抖动的渠道不会刷屏；被抑制的告警不会产生恢复通知。
+type Manager struct {
+	cfg        Config
+	cfgManager *config.ConfigManager
+	sources    []Source
+	notifier   *webhookNotifier
+
+	// 以下状态仅由 loop 协程访问
+	fired    map[string]bool      // 已发送（尚未恢复）的告警
+	lastSent map[string]time.Time // 告警最近一次发送时间（用于去抖）
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	loopWg   sync.WaitGroup
+}
+
+// channelHealth 渠道在一次检查中的健康状态
+type channelHealth struct {
+	index   int
+	name    string
+	healthy bool
+}
+
+// NewManager 创建渠道健康告警管理器
+func NewManager(cfg Config, cfgManager *config.ConfigManager, sources ...Source) *Manager {
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = defaultDebounce
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultCheckInterval
+	}
+	valid := make([]Source, 0, len(sources))
+	for _, src := range sources {
+		if src.Metrics != nil {
+			valid = append(valid, src)
+		}
+	}
+	return &Manager{
+		cfg:        cfg,
+		cfgManager: cfgManager,
+		sources:    valid,
+		notifier:   newWebhookNotifier(cfg.WebhookURL, cfg.Format),
+		fired:      make(map[string]bool),
+		lastSent:   make(map[string]time.Time),
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Start 启动后台告警循环
+func (m *Manager) Start() {
+	m.loopWg.Add(1)
+	go m.loop()
+}
+
+// Stop 停止告警循环，并等待已排队的 Webhook 发送完成（可重复调用）
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+	})
+	m.loopWg.Wait()
+	m.notifier.Close()
+}
+
+func (m *Manager) loop() {
+	defer m.loopWg.Done()
+
+	subscribe := func(src Source) (<-chan metrics.MetricsEvent, func()) {
+		return src.Metrics.Subscribe(metrics.DefaultSubscriberBuffer)
+	}
+	// 固定三路 select，缺失的来源使用 nil 通道（永不就绪）
+	var events [3]<-chan metrics.MetricsEvent
+	var unsubscribes [3]func()
+	for i, src := range m.sources {
+		if i >= len(events) {
+			break
+		}
+		events[i], unsubscribes[i] = subscribe(src)
+	}
+	defer func() {
+		for _, unsubscribe := range unsubscribes {
+			if unsubscribe != nil {
+				unsubscribe()
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(m.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	m.evaluate(time.Now())
+	for {
+		var (
+			idx int
+			ev  metrics.MetricsEvent
+			ok  bool
+		)
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			m.evaluate(time.Now())
+			continue
+		case ev, ok = <-events[0]:
+			idx = 0
+		case ev, ok = <-events[1]:
+			idx = 1
+		case ev, ok = <-events[2]:
+			idx = 2
+		}
+
+		if !ok {
+			// 消费过慢被指标管理器移除订阅：重新订阅并立即复查，避免遗漏状态变化
+			log.Printf("[Alert-Subscribe] 订阅已被移除，重新订阅: api=%s", m.sources[idx].APIType)
+			unsubscribes[idx]()
+			events[idx], unsubscribes[idx] = subscribe(m.sources[idx])
+			m.evaluate(time.Now())
+			continue
+		}
+		if ev.CircuitChanged {
+			m.evaluate(ev.Time)
+		}
+	}
+}
+
+// evaluate 检查所有接口类型的渠道健康状态，按状态变化发送告警或恢复通知
+func (m *Manager) evaluate(now time.Time) {
+	cfg := m.cfgManager.GetConfig()
+	seen := make(map[string]bool)
+	for _, src := range m.sources {
+		channels := channelHealthOf(src, upstreamsOf(cfg, src.APIType))
+
+		healthy := 0
+		for _, ch := range channels {
+			if ch.healthy {
+				healthy++
+			}
+			if !m.cfg.NotifyCircuitOpen {
+				continue
+			}
+			key := "circuit_open:" + src.APIType + ":" + strconv.Itoa(ch.index) + ":" + ch.name
+			seen[key] = true
+			m.transition(key, !ch.healthy, now, Alert{
+				APIType:      src.APIType,
+				ChannelIndex: ch.index,
+				ChannelName:  ch.name,
+			}, EventChannelCircuitOpen, EventChannelRecovered)
+		}
+
+		if m.cfg.MinHealthyChannels <= 0 || len(channels) == 0 {
+			continue
+		}
+		key := "healthy_low:" + src.APIType
+		seen[key] = true
+		m.transition(key, healthy < m.cfg.MinHealthyChannels, now, Alert{
+			APIType:         src.APIType,
+			ChannelIndex:    -1,
+			HealthyChannels: healthy,
+			TotalChannels:   len(channels),
+			Threshold:       m.cfg.MinHealthyChannels,
+		}, EventHealthyChannelsLow, EventHealthyChannelsRecovered)
+	}
+
+	// 清理已不存在的渠道告警状态（渠道被删除、停用或改名时不再发送恢复通知）
+	for key := range m.fired {
+		if !seen[key] {
+			delete(m.fired, key)
+		}
+	}
+	for key, last := range m.lastSent {
+		if !seen[key] && now.Sub(last) >= m.cfg.Debounce {
+			delete(m.lastSent, key)
+		}
+	}
+}
+
+// transition 根据告警条件更新告警状态：条件成立且未发送时发送告警（受去抖限制），条件解除且已发送时发送恢复通知
+func (m *Manager) transition(key string, firing bool, now time.Time, alert Alert, fireEvent, recoverEvent string) {
+	switch {
+	case firing && !m.fired[key]:
+		if last, ok := m.lastSent[key]; ok && now.Sub(last) < m.cfg.Debounce {
+			return // 去抖：窗口内不重复告警，窗口结束后若仍成立再发送
+		}
+		alert.Event = fireEvent
+		m.fired[key] = true
+		m.lastSent[key] = now
+		m.send(alert, now)
+	case !firing && m.fired[key]:
+		alert.Event = recoverEvent
+		delete(m.fired, key)
+		m.send(alert, now)
+	}
+}
+
+func (m *Manager) send(alert Alert, now time.Time) {
+	alert.Time = now
+	alert.Message = alert.describe()
+	log.Printf("[Alert-Webhook] %s", alert.Message)
+	m.notifier.Notify(alert)
+}
+
+// upstreamsOf 返回接口类型对应的渠道列表
+func upstreamsOf(cfg config.Config, apiType string) []config.UpstreamConfig {
+	switch apiType {
+	case "responses":
+		return cfg.ResponsesUpstream
+	case "gemini":
+		return cfg.GeminiUpstream
+	default:
+		return cfg.Upstream
+	}
+}
+
+// channelHealthOf 计算参与调度的渠道（active 且非影子渠道）的健康状态：
+// 任一 BaseURL 未处于熔断（并非所有密钥均熔断）即视为健康
+func channelHealthOf(src Source, upstreams []config.UpstreamConfig) []channelHealth {
+	result := make([]channelHealth, 0, len(upstreams))
+	for i := range upstreams {
+		upstream := &upstreams[i]
+		if config.GetChannelStatus(upstream) != "active" || upstream.Shadow {
+			continue
+		}
+		healthy := false
+		if len(upstream.APIKeys) > 0 {
+			for _, baseURL := range upstream.GetAllBaseURLs() {
+				if src.Metrics.GetChannelCircuitState(baseURL, upstream.APIKeys) != metrics.CircuitOpen {
+					healthy = true
+					break
+				}
+			}
+		}
+		name := upstream.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		result = append(result, channelHealth{index: i, name: name, healthy: healthy})
+	}
+	return result
+}
@@ -0,0 +1,202 @@
+package alerting
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+)
+
+// webhookRecorder 记录收到的 Webhook 请求体
+type webhookRecorder struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newWebhookServer(t *testing.T) (*httptest.Server, *webhookRecorder) {
+	t.Helper()
+	rec := &webhookRecorder{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		rec.bodies = append(rec.bodies, string(body))
+		rec.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, rec
+}
+
+func (r *webhookRecorder) alerts(t *testing.T) []Alert {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alerts := make([]Alert, 0, len(r.bodies))
+	for _, body := range r.bodies {
+		var alert Alert
+		if err := json.Unmarshal([]byte(body), &alert); err != nil {
+			t.Fatalf("invalid webhook body %q: %v", body, err)
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+func newAlertTestConfigManager(t *testing.T) *config.ConfigManager {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	initialConfig := `{
+		"upstream": [
+			{"name": "a", "baseUrl": "https://a.example.com", "apiKeys": ["ka"], "serviceType": "claude", "status": "active"},
+			{"name": "b", "baseUrl": "https://b.example.com", "apiKeys": ["kb"], "serviceType": "claude", "status": "active"},
+			{"name": "spare", "baseUrl": "https://c.example.com", "apiKeys": ["kc"], "serviceType": "claude", "status": "disabled"}
+		],
+		"loadBalance": "failover"
+	}`
+	if err := os.WriteFile(configPath, []byte(initialConfig), 0644); err != nil {
+		t.Fatalf("写入初始配置失败: %v", err)
+	}
+	cm, err := config.NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("初始化配置管理器失败: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+	return cm
+}
+
+func tripCircuit(m *metrics.MetricsManager, baseURL, apiKey string) {
+	for i := 0; i < 3; i++ {
+		m.RecordFailure(baseURL, apiKey)
+	}
+}
+
+func eventsOf(alerts []Alert) []string {
+	events := make([]string, len(alerts))
+	for i, alert := range alerts {
+		events[i] = alert.Event + ":" + alert.ChannelName
+	}
+	return events
+}
+
+func TestManager_ThresholdAndRecovery(t *testing.T) {
+	srv, rec := newWebhookServer(t)
+	cm := newAlertTestConfigManager(t)
+	mm := metrics.NewMetricsManagerWithConfig(3, 0.5)
+	defer mm.Stop()
+
+	m := NewManager(Config{WebhookURL: srv.URL, MinHealthyChannels: 2, NotifyCircuitOpen: true, Debounce: time.Minute}, cm,
+		Source{APIType: "messages", Metrics: mm})
+	now := time.Now()
+
+	m.evaluate(now)
+	tripCircuit(mm, "https://a.example.com", "ka")
+	m.evaluate(now.Add(time.Second))
+	m.evaluate(now.Add(2 * time.Second)) // 状态未变化不重复告警
+
+	mm.ResetKey("https://a.example.com", "ka")
+	m.evaluate(now.Add(3 * time.Second))
+	m.notifier.Close()
+
+	alerts := rec.alerts(t)
+	want := []string{
+		EventChannelCircuitOpen + ":a",
+		EventHealthyChannelsLow + ":",
+		EventChannelRecovered + ":a",
+		EventHealthyChannelsRecovered + ":",
+	}
+	if got := eventsOf(alerts); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("alerts = %v, want %v", got, want)
+	}
+	low := alerts[1]
+	if low.APIType != "messages" || low.HealthyChannels != 1 || low.TotalChannels != 2 || low.Threshold != 2 || low.ChannelIndex != -1 {
+		t.Fatalf("unexpected threshold alert: %+v", low)
+	}
+	if alerts[0].ChannelIndex != 0 || !strings.Contains(alerts[0].Message, "已熔断") {
+		t.Fatalf("unexpected circuit alert: %+v", alerts[0])
+	}
+}
+
+func TestManager_DebouncesFlappingChannel(t *testing.T) {
+	srv, rec := newWebhookServer(t)
+	cm := newAlertTestConfigManager(t)
+	mm := metrics.NewMetricsManagerWithConfig(3, 0.5)
+	defer mm.Stop()
+
+	m := NewManager(Config{WebhookURL: srv.URL, NotifyCircuitOpen: true, Debounce: time.Minute}, cm,
+		Source{APIType: "messages", Metrics: mm})
+	now := time.Now()
+
+	// 窗口内反复熔断/恢复：只发送首次告警与对应的恢复通知
+	for i := 0; i < 3; i++ {
+		tripCircuit(mm, "https://b.example.com", "kb")
+		m.evaluate(now.Add(time.Duration(2*i) * time.Second))
+		mm.ResetKey("https://b.example.com", "kb")
+		m.evaluate(now.Add(time.Duration(2*i+1) * time.Second))
+	}
+
+	// 窗口结束后再次熔断则重新告警
+	tripCircuit(mm, "https://b.example.com", "kb")
+	m.evaluate(now.Add(2 * time.Minute))
+	m.notifier.Close()
+
+	want := []string{
+		EventChannelCircuitOpen + ":b",
+		EventChannelRecovered + ":b",
+		EventChannelCircuitOpen + ":b",
+	}
+	if got := eventsOf(rec.alerts(t)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("alerts = %v, want %v", got, want)
+	}
+}
+
+func TestManager_SubscribesToCircuitChanges(t *testing.T) {
+	srv, rec := newWebhookServer(t)
+	cm := newAlertTestConfigManager(t)
+	mm := metrics.NewMetricsManagerWithConfig(3, 0.5)
+	defer mm.Stop()
+
+	m := NewManager(Config{WebhookURL: srv.URL, MinHealthyChannels: 1, Format: FormatSlack, CheckInterval: time.Hour}, cm,
+		Source{APIType: "messages", Metrics: mm})
+	m.Start()
+
+	// 等待订阅建立
+	deadline := time.Now().Add(2 * time.Second)
+	for mm.SubscriberCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	tripCircuit(mm, "https://a.example.com", "ka")
+	tripCircuit(mm, "https://b.example.com", "kb")
+
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		rec.mu.Lock()
+		n := len(rec.bodies)
+		rec.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	m.Stop()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.bodies) != 1 {
+		t.Fatalf("webhook calls = %d, want 1 (bodies: %v)", len(rec.bodies), rec.bodies)
+	}
+	var slack map[string]string
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &slack); err != nil {
+		t.Fatalf("invalid slack body: %v", err)
+	}
+	if !strings.Contains(slack["text"], EventHealthyChannelsLow) || !strings.Contains(slack["text"], "0/2") {
+		t.Fatalf("unexpected slack text: %q", slack["text"])
+	}
+}
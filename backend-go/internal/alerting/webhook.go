@@ -0,0 +1,149 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 告警事件类型
+const (
+	EventHealthyChannelsLow       = "healthy_channels_low"
+	EventHealthyChannelsRecovered = "healthy_channels_recovered"
+	EventChannelCircuitOpen       = "channel_circuit_open"
+	EventChannelRecovered         = "channel_recovered"
+)
+
+const (
+	// FormatSlack Slack Incoming Webhook 兼容格式（{"text": "..."}）
+	FormatSlack = "slack"
+
+	webhookTimeout    = 10 * time.Second
+	webhookQueueSize  = 64
+	webhookMaxRetries = 2
+)
+
+// Alert Webhook 告警内容（默认格式直接以 JSON 发送）
+type Alert struct {
+	Event           string    `json:"event"`
+	APIType         string    `json:"apiType"`
+	ChannelIndex    int       `json:"channelIndex"` // 渠道级告警的渠道索引，汇总告警为 -1
+	ChannelName     string    `json:"channelName,omitempty"`
+	HealthyChannels int       `json:"healthyChannels,omitempty"`
+	TotalChannels   int       `json:"totalChannels,omitempty"`
+	Threshold       int       `json:"threshold,omitempty"`
+	Message         string    `json:"message"`
+	Time            time.Time `json:"time"`
+}
+
+// describe 生成可读的告警描述
+func (a Alert) describe() string {
+	switch a.Event {
+	case EventHealthyChannelsLow:
+		return fmt.Sprintf("[%s] 健康渠道数 %d/%d 低于阈值 %d", a.APIType, a.HealthyChannels, a.TotalChannels, a.Threshold)
+	case EventHealthyChannelsRecovered:
+		return fmt.Sprintf("[%s] 健康渠道数已恢复: %d/%d（阈值 %d）", a.APIType, a.HealthyChannels, a.TotalChannels, a.Threshold)
+	case EventChannelCircuitOpen:
+		return fmt.Sprintf("[%s] 渠道 [%d] %s 已熔断（所有密钥均不可用）", a.APIType, a.ChannelIndex, a.ChannelName)
+	case EventChannelRecovered:
+		return fmt.Sprintf("[%s] 渠道 [%d] %s 已恢复", a.APIType, a.ChannelIndex, a.ChannelName)
+	default:
+		return fmt.Sprintf("[%s] %s", a.APIType, a.Event)
+	}
+}
+
+// webhookNotifier 异步发送告警：队列按顺序发送，队列写满时丢弃新告警，不阻塞告警循环
+type webhookNotifier struct {
+	url    string
+	format string
+	client *http.Client
+
+	queue     chan Alert
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newWebhookNotifier(url, format string) *webhookNotifier {
+	n := &webhookNotifier{
+		url:    url,
+		format: format,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan Alert, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Notify 将告警加入发送队列
+func (n *webhookNotifier) Notify(alert Alert) {
+	select {
+	case n.queue <- alert:
+	default:
+		log.Printf("[Alert-Webhook] 警告: 发送队列已满，丢弃告警: %s", alert.Message)
+	}
+}
+
+// Close 关闭队列并等待已排队的告警发送完成（可重复调用）
+func (n *webhookNotifier) Close() {
+	n.closeOnce.Do(func() {
+		close(n.queue)
+	})
+	<-n.done
+}
+
+func (n *webhookNotifier) run() {
+	defer close(n.done)
+	for alert := range n.queue {
+		if n.url == "" {
+			continue
+		}
+		body, err := n.encode(alert)
+		if err != nil {
+			log.Printf("[Alert-Webhook] 序列化告警失败: %v", err)
+			continue
+		}
+		for attempt := 0; ; attempt++ {
+			err = n.post(body)
+			if err == nil || attempt >= webhookMaxRetries {
+				break
+			}
+			time.Sleep(time.Duration(attempt+1) * time.Second)
+		}
+		if err != nil {
+			log.Printf("[Alert-Webhook] 发送告警失败: %v", err)
+		}
+	}
+}
+
+// encode 按配置的格式编码告警
+func (n *webhookNotifier) encode(alert Alert) ([]byte, error) {
+	if n.format != FormatSlack {
+		return json.Marshal(alert)
+	}
+	icon := ":red_circle:"
+	if alert.Event == EventHealthyChannelsRecovered || alert.Event == EventChannelRecovered {
+		icon = ":large_green_circle:"
+	}
+	return json.Marshal(map[string]string{
+		"text": fmt.Sprintf("%s *Claude Proxy* %s\n`%s` %s", icon, alert.Message, alert.Event, alert.Time.Format(time.RFC3339)),
+	})
+}
+
+func (n *webhookNotifier) post(body []byte) error {
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ type Handler struct {
 	pricingService *pricing.Service
 	usageStore     *usage.Store
 	preAuthCents   int64
+	ledger         *Ledger // 计费事件审计日志（可选）
 }
 
 // NewHandler 创建计费处理器
@@ -28,6 +29,43 @@ func NewHandler(client *Client, pricingService *pricing.Service, usageStore *usa
 	}
 }
 
+// SetLedger 设置计费事件审计日志（nil 表示不记录）
+// 注意：应在处理请求前调用
+func (h *Handler) SetLedger(ledger *Ledger) {
+	h.ledger = ledger
+}
+
+// Ledger 获取计费事件审计日志（未启用时返回 nil）
+func (h *Handler) Ledger() *Ledger {
+	return h.ledger
+}
+
+// recordEvent 写入计费事件，写入失败仅记录日志，不影响计费流程
+func (h *Handler) recordEvent(event Event) {
+	if h.ledger == nil {
+		return
+	}
+	if err := h.ledger.Append(event); err != nil {
+		log.Printf("[Billing-Ledger] 警告: 写入计费事件失败 (request: %s, type: %s): %v", event.RequestID, event.Type, err)
+	}
+}
+
+// newEvent 基于请求计费上下文构造计费事件，err 非空时结果为 failed
+func newEvent(ctx *RequestContext, eventType string, err error) Event {
+	event := Event{
+		RequestID:    ctx.RequestID,
+		APIKey:       ctx.APIKey,
+		Type:         eventType,
+		Outcome:      OutcomeSuccess,
+		PreAuthCents: ctx.PreAuthCents,
+	}
+	if err != nil {
+		event.Outcome = OutcomeFailed
+		event.Error = err.Error()
+	}
+	return event
+}
+
 // RequestContext 请求计费上下文
 type RequestContext struct {
 	RequestID    string
@@ -58,7 +96,9 @@ func (h *Handler) BeforeRequest(c *gin.Context) (*RequestContext, error) {
 		PreAuthCents: h.preAuthCents,
 	}
 
-	if err := h.client.PreAuthorize(apiKeyStr, requestID, h.preAuthCents); err != nil {
+	err := h.client.PreAuthorize(apiKeyStr, requestID, h.preAuthCents)
+	h.recordEvent(newEvent(ctx, EventPreAuthorize, err))
+	if err != nil {
 		return ctx, err
 	}
 
@@ -82,7 +122,16 @@ func (h *Handler) AfterRequest(ctx *RequestContext, model string, inputTokens, o
 
 	// 扣费
 	description := model + " API call"
-	if err := h.client.Charge(ctx.APIKey, ctx.RequestID, ctx.PreAuthCents, actualCents, description); err != nil {
+	err := h.client.Charge(ctx.APIKey, ctx.RequestID, ctx.PreAuthCents, actualCents, description)
+	event := newEvent(ctx, EventCharge, err)
+	event.Model = model
+	event.InputTokens = inputTokens
+	event.OutputTokens = outputTokens
+	event.CacheCreationTokens = cacheCreationTokens
+	event.CacheReadTokens = cacheReadTokens
+	event.CostCents = actualCents
+	h.recordEvent(event)
+	if err != nil {
 		log.Printf("[Billing-Error] 扣费失败: %v", err)
 		// 扣费失败时释放预授权
 		h.Release(ctx)
@@ -99,6 +148,9 @@ func (h *Handler) AfterRequest(ctx *RequestContext, model string, inputTokens, o
 		InputTokens:  inputTokens,
 		OutputTokens: outputTokens,
 		CostCents:    actualCents,
+
+		CacheCreationInputTokens: cacheCreationTokens,
+		CacheReadInputTokens:     cacheReadTokens,
 	})
 }
 
@@ -110,7 +162,9 @@ func (h *Handler) Release(ctx *RequestContext) {
 	if h.client == nil {
 		return
 	}
-	if err := h.client.Release(ctx.APIKey, ctx.RequestID, ctx.PreAuthCents); err != nil {
+	err := h.client.Release(ctx.APIKey, ctx.RequestID, ctx.PreAuthCents)
+	h.recordEvent(newEvent(ctx, EventRelease, err))
+	if err != nil {
 		log.Printf("[Billing-Error] 释放预授权失败: %v", err)
 	}
 	ctx.Released = true // 标记已释放，防止双重释放
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/BenedictKing/claude-proxy/internal/pricing"
 	"github.com/BenedictKing/claude-proxy/internal/usage"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -318,3 +320,58 @@ func TestHandler_AfterRequest_ChargeFailed(t *testing.T) {
 		t.Errorf("Should not add usage record when charge fails, got %d", len(records))
 	}
 }
+
+func TestHandler_RecordsLedgerEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/billing/charge" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	ledger, err := NewLedger(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+	defer ledger.Close()
+
+	handler := NewHandler(NewClient(server.URL), &pricing.Service{}, usage.NewStore(100), 500)
+	handler.SetLedger(ledger)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("billing_enabled", true)
+	c.Set("api_key", "test-key")
+	ctx, err := handler.BeforeRequest(c)
+	if err != nil {
+		t.Fatalf("BeforeRequest() error = %v", err)
+	}
+
+	// 扣费失败时应记录 charge 失败事件，并释放预授权
+	handler.AfterRequest(ctx, "claude-3-5-sonnet-20241022", 1000, 500, 10, 20)
+
+	events, total, err := ledger.Query(EventFilter{RequestID: ctx.RequestID})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("期望 3 条计费事件，实际 %d: %+v", total, events)
+	}
+	release, charge, preAuth := events[0], events[1], events[2]
+	if preAuth.Type != EventPreAuthorize || preAuth.Outcome != OutcomeSuccess || preAuth.PreAuthCents != 500 {
+		t.Errorf("pre_authorize 事件 = %+v", preAuth)
+	}
+	if charge.Type != EventCharge || charge.Outcome != OutcomeFailed || charge.Error == "" {
+		t.Errorf("charge 事件 = %+v", charge)
+	}
+	if charge.APIKey != utils.MaskAPIKey("test-key") || charge.APIKeyHash != hashAPIKey("test-key") || charge.Model != "claude-3-5-sonnet-20241022" ||
+		charge.InputTokens != 1000 || charge.OutputTokens != 500 || charge.CacheCreationTokens != 10 || charge.CacheReadTokens != 20 {
+		t.Errorf("charge 事件字段不完整: %+v", charge)
+	}
+	if release.Type != EventRelease || release.Outcome != OutcomeSuccess {
+		t.Errorf("release 事件 = %+v", release)
+	}
+}
@@ -0,0 +1,259 @@
+package billing
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/google/uuid"
+)
+
+// 计费事件类型
+const (
+	EventPreAuthorize = "pre_authorize"
+	EventCharge       = "charge"
+	EventRelease      = "release"
+)
+
+// 计费事件结果
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailed  = "failed"
+)
+
+// ledgerQueueSize 待写入事件队列容量，队列满时 Append 等待写入协程消费
+const ledgerQueueSize = 1024
+
+// Event 计费事件（写入后不可修改，用于对账审计）
+// API Key 不落盘明文：APIKey 为脱敏形式，APIKeyHash 为 SHA-256 摘要（用于按 Key 过滤）
+type Event struct {
+	ID                  string    `json:"id"`
+	RequestID           string    `json:"request_id"`
+	APIKey              string    `json:"api_key"`
+	APIKeyHash          string    `json:"api_key_hash,omitempty"`
+	Type                string    `json:"type"`
+	Outcome             string    `json:"outcome"`
+	Model               string    `json:"model,omitempty"`
+	InputTokens         int       `json:"input_tokens,omitempty"`
+	OutputTokens        int       `json:"output_tokens,omitempty"`
+	CacheCreationTokens int       `json:"cache_creation_tokens,omitempty"`
+	CacheReadTokens     int       `json:"cache_read_tokens,omitempty"`
+	PreAuthCents        int64     `json:"pre_auth_cents"`
+	CostCents           int64     `json:"cost_cents,omitempty"`
+	Error               string    `json:"error,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// EventFilter 计费事件查询条件（空字段不过滤；APIKey 为原始 Key，按摘要匹配）
+type EventFilter struct {
+	RequestID string
+	APIKey    string
+	Limit     int
+	Offset    int
+}
+
+// ledgerWrite 写入队列中的一项：待写入的事件行，或 flushed 非空的刷盘屏障
+type ledgerWrite struct {
+	line    []byte
+	flushed chan struct{}
+}
+
+// Ledger 只追加的计费事件日志（JSON Lines 文件，每行一个事件）
+// 事件经队列交由后台协程批量写入并刷盘，计费请求不等待磁盘；查询使用独立的只读句柄，不阻塞写入
+type Ledger struct {
+	path  string
+	file  *os.File
+	queue chan ledgerWrite
+	done  chan struct{}
+
+	mu     sync.RWMutex // 保护 closed 与 queue 的关闭
+	closed bool
+}
+
+// NewLedger 打开（不存在时创建）计费事件日志文件并启动后台写入
+func NewLedger(path string) (*Ledger, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建计费事件日志目录失败: %w", err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("打开计费事件日志失败: %w", err)
+	}
+	l := &Ledger{
+		path:  path,
+		file:  file,
+		queue: make(chan ledgerWrite, ledgerQueueSize),
+		done:  make(chan struct{}),
+	}
+	go l.writeLoop()
+	return l, nil
+}
+
+// Append 将计费事件加入写入队列（未设置 ID/CreatedAt 时自动填充，API Key 脱敏后写入）
+// 写入与刷盘在后台完成，失败时记录日志
+func (l *Ledger) Append(event Event) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	redactEventKey(&event)
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return fmt.Errorf("计费事件日志已关闭")
+	}
+	l.queue <- ledgerWrite{line: line}
+	return nil
+}
+
+// writeLoop 后台写入协程：取出队列中已有的全部事件后一次写入并刷盘
+func (l *Ledger) writeLoop() {
+	defer close(l.done)
+
+	var batch []byte
+	var barriers []chan struct{}
+	for item := range l.queue {
+		batch, barriers = batch[:0], barriers[:0]
+		collect := func(item ledgerWrite) {
+			batch = append(batch, item.line...)
+			if item.flushed != nil {
+				barriers = append(barriers, item.flushed)
+			}
+		}
+		collect(item)
+	drain:
+		for {
+			select {
+			case next, ok := <-l.queue:
+				if !ok {
+					break drain
+				}
+				collect(next)
+			default:
+				break drain
+			}
+		}
+
+		if len(batch) > 0 {
+			if _, err := l.file.Write(batch); err != nil {
+				log.Printf("[Billing-Ledger] 警告: 写入计费事件失败: %v", err)
+			} else if err := l.file.Sync(); err != nil {
+				log.Printf("[Billing-Ledger] 警告: 计费事件刷盘失败: %v", err)
+			}
+		}
+		for _, flushed := range barriers {
+			close(flushed)
+		}
+	}
+}
+
+// flush 等待此前加入队列的事件全部写入
+func (l *Ledger) flush() {
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	l.queue <- ledgerWrite{flushed: flushed}
+	l.mu.RUnlock()
+	<-flushed
+}
+
+// Query 查询计费事件（最新的在前），返回分页结果与匹配总数
+// 先等待已排队事件落盘，再用独立句柄扫描文件（不持有写入锁）
+func (l *Ledger) Query(filter EventFilter) ([]Event, int, error) {
+	l.flush()
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var keyHash string
+	if filter.APIKey != "" {
+		keyHash = hashAPIKey(filter.APIKey)
+	}
+
+	var matched []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue // 跳过损坏的行（如写入中断），不影响其余事件
+		}
+		redactEventKey(&event) // 兼容旧版本写入的明文 Key
+		if filter.RequestID != "" && event.RequestID != filter.RequestID {
+			continue
+		}
+		if keyHash != "" && event.APIKeyHash != keyHash {
+			continue
+		}
+		matched = append(matched, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total := len(matched)
+	// 倒序（最新的在前）后分页
+	for i, j := 0, total-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	start := min(max(filter.Offset, 0), total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+	return matched[start:end], total, nil
+}
+
+// Close 停止接收新事件，等待队列写完后关闭文件
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.done
+	return l.file.Close()
+}
+
+// redactEventKey 将事件中的明文 API Key 替换为脱敏形式，并补齐摘要（已有摘要的事件不再处理）
+func redactEventKey(event *Event) {
+	if event.APIKeyHash != "" || event.APIKey == "" {
+		return
+	}
+	event.APIKeyHash = hashAPIKey(event.APIKey)
+	event.APIKey = utils.MaskAPIKey(event.APIKey)
+}
+
+// hashAPIKey 计算 API Key 的 SHA-256 摘要（十六进制）
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,151 @@
+package billing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+func TestLedger_AppendAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "billing", "events.jsonl")
+	ledger, err := NewLedger(path)
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+
+	for _, event := range []Event{
+		{RequestID: "req-1", APIKey: "key1", Type: EventPreAuthorize, Outcome: OutcomeSuccess},
+		{RequestID: "req-1", APIKey: "key1", Type: EventCharge, Outcome: OutcomeSuccess, CostCents: 12},
+		{RequestID: "req-2", APIKey: "key2", Type: EventRelease, Outcome: OutcomeFailed, Error: "boom"},
+	} {
+		if err := ledger.Append(event); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	events, total, err := ledger.Query(EventFilter{RequestID: "req-1"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if total != 2 || len(events) != 2 {
+		t.Fatalf("Query(req-1) total=%d len=%d, want 2", total, len(events))
+	}
+	// 最新的在前
+	if events[0].Type != EventCharge || events[0].ID == "" || events[0].CreatedAt.IsZero() {
+		t.Errorf("events[0] = %+v", events[0])
+	}
+
+	events, total, _ = ledger.Query(EventFilter{Limit: 1, Offset: 1})
+	if total != 3 || len(events) != 1 || events[0].Type != EventCharge {
+		t.Errorf("分页查询结果不正确: total=%d events=%+v", total, events)
+	}
+
+	// 关闭后重新打开，历史事件仍然存在且继续追加
+	ledger.Close()
+	if err := ledger.Append(Event{RequestID: "req-3"}); err == nil {
+		t.Error("关闭后 Append() 应返回错误")
+	}
+	reopened, err := NewLedger(path)
+	if err != nil {
+		t.Fatalf("NewLedger() reopen error = %v", err)
+	}
+	defer reopened.Close()
+	reopened.Append(Event{RequestID: "req-3", APIKey: "key1", Type: EventPreAuthorize, Outcome: OutcomeSuccess})
+
+	events, total, _ = reopened.Query(EventFilter{APIKey: "key1"})
+	if total != 3 || events[0].RequestID != "req-3" {
+		t.Errorf("重新打开后查询结果不正确: total=%d events=%+v", total, events)
+	}
+}
+
+func TestLedger_DoesNotStorePlaintextKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	// 旧版本写入的明文 Key 在查询时同样脱敏
+	legacy := `{"id":"old","request_id":"req-0","api_key":"sk-legacy-secret-key","type":"charge","outcome":"success"}` + "\n"
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	ledger, err := NewLedger(path)
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+	if err := ledger.Append(Event{RequestID: "req-1", APIKey: "sk-tenant-secret-key", Type: EventCharge}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if err := ledger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "sk-tenant-secret-key") {
+		t.Fatalf("事件日志不应包含明文 Key: %s", data)
+	}
+
+	reopened, err := NewLedger(path)
+	if err != nil {
+		t.Fatalf("NewLedger() reopen error = %v", err)
+	}
+	defer reopened.Close()
+	for _, key := range []string{"sk-tenant-secret-key", "sk-legacy-secret-key"} {
+		events, total, _ := reopened.Query(EventFilter{APIKey: key})
+		if total != 1 || events[0].APIKey != utils.MaskAPIKey(key) || events[0].APIKeyHash == "" {
+			t.Fatalf("Query(%s) = %+v, total=%d", key, events, total)
+		}
+	}
+}
+
+func TestLedger_ConcurrentAppendAndQuery(t *testing.T) {
+	ledger, err := NewLedger(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+	defer ledger.Close()
+
+	const writers, perWriter = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := ledger.Append(Event{RequestID: fmt.Sprintf("req-%d-%d", w, i), Type: EventCharge}); err != nil {
+					t.Errorf("Append() error = %v", err)
+				}
+			}
+		}(w)
+	}
+	for i := 0; i < 10; i++ {
+		if _, _, err := ledger.Query(EventFilter{}); err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+	}
+	wg.Wait()
+
+	// 查询前已排队的事件必须全部可见
+	if _, total, _ := ledger.Query(EventFilter{}); total != writers*perWriter {
+		t.Fatalf("total = %d, want %d", total, writers*perWriter)
+	}
+}
+
+func TestLedger_SkipsCorruptedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, []byte("{not json\n"), 0600); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	ledger, err := NewLedger(path)
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+	defer ledger.Close()
+	ledger.Append(Event{RequestID: "req-1"})
+
+	events, total, err := ledger.Query(EventFilter{})
+	if err != nil || total != 1 || events[0].RequestID != "req-1" {
+		t.Errorf("Query() = %+v, %d, %v", events, total, err)
+	}
+}
@@ -0,0 +1,171 @@
+package budget
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// 预算周期
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+)
+
+// spendCacheTTL 累计成本缓存时长：避免每个请求都遍历内存历史/查询数据库（预算检查允许秒级滞后）
+const spendCacheTTL = 5 * time.Second
+
+// CostSource 累计成本来源（由 metrics.MetricsManager 实现）
+type CostSource interface {
+	GetCostCentsSince(since time.Time) (int64, error)
+}
+
+// PeriodStatus 单个预算周期的状态
+type PeriodStatus struct {
+	Period         string    `json:"period"` // daily | weekly
+	SpentCents     int64     `json:"spentCents"`
+	SoftCapCents   int64     `json:"softCapCents,omitempty"`
+	HardCapCents   int64     `json:"hardCapCents,omitempty"`
+	RemainingCents int64     `json:"remainingCents"` // 距硬上限（未配置时距软上限）的剩余额度，不小于 0
+	SoftExceeded   bool      `json:"softExceeded"`
+	HardExceeded   bool      `json:"hardExceeded"`
+	PeriodStart    time.Time `json:"periodStart"`
+	ResetAt        time.Time `json:"resetAt"`
+}
+
+// Status 单个接口类型的预算状态
+type Status struct {
+	APIType string         `json:"apiType"`
+	Enabled bool           `json:"enabled"`
+	Periods []PeriodStatus `json:"periods"`
+}
+
+// Decision 预算检查结果
+type Decision struct {
+	Allowed bool
+	// Blocked 超过硬上限的周期（Allowed 为 false 时有效）
+	Blocked *PeriodStatus
+	// Warnings 超过软上限（未超过硬上限）的周期
+	Warnings []PeriodStatus
+}
+
+type cachedSpend struct {
+	periodStart time.Time
+	cents       int64
+	fetchedAt   time.Time
+}
+
+// BudgetManager 日/周成本预算：累计成本来自指标（daily_stats + 今日内存记录），上限从配置文件读取（支持热重载）
+type BudgetManager struct {
+	cfgManager *config.ConfigManager
+	sources    map[string]CostSource
+
+	mu    sync.Mutex
+	cache map[string]cachedSpend // key: apiType + ":" + period
+
+	now func() time.Time // 便于测试
+}
+
+// NewBudgetManager 创建预算管理器，sources 按接口类型（messages / responses）提供累计成本
+func NewBudgetManager(cfgManager *config.ConfigManager, sources map[string]CostSource) *BudgetManager {
+	return &BudgetManager{
+		cfgManager: cfgManager,
+		sources:    sources,
+		cache:      make(map[string]cachedSpend),
+		now:        time.Now,
+	}
+}
+
+// Check 请求准入前检查预算；未配置预算或无成本来源时直接放行
+func (bm *BudgetManager) Check(apiType string) Decision {
+	status := bm.Status(apiType)
+	decision := Decision{Allowed: true}
+	for i := range status.Periods {
+		p := status.Periods[i]
+		switch {
+		case p.HardExceeded:
+			if decision.Blocked == nil {
+				decision.Allowed = false
+				decision.Blocked = &p
+			}
+		case p.SoftExceeded:
+			decision.Warnings = append(decision.Warnings, p)
+		}
+	}
+	return decision
+}
+
+// Status 获取指定接口类型当前的预算状态（仅包含配置了上限的周期）
+func (bm *BudgetManager) Status(apiType string) Status {
+	status := Status{APIType: apiType, Periods: []PeriodStatus{}}
+	budget, ok := bm.cfgManager.GetCostBudget(apiType)
+	source := bm.sources[apiType]
+	if !ok || source == nil {
+		return status
+	}
+	status.Enabled = true
+
+	now := bm.now()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if budget.DailySoftCents > 0 || budget.DailyHardCents > 0 {
+		spent := bm.spent(apiType, PeriodDaily, source, todayStart)
+		status.Periods = append(status.Periods, newPeriodStatus(PeriodDaily, spent, budget.DailySoftCents, budget.DailyHardCents, todayStart, todayStart.AddDate(0, 0, 1)))
+	}
+	if budget.WeeklySoftCents > 0 || budget.WeeklyHardCents > 0 {
+		weekStart := startOfWeek(todayStart)
+		spent := bm.spent(apiType, PeriodWeekly, source, weekStart)
+		status.Periods = append(status.Periods, newPeriodStatus(PeriodWeekly, spent, budget.WeeklySoftCents, budget.WeeklyHardCents, weekStart, weekStart.AddDate(0, 0, 7)))
+	}
+	return status
+}
+
+// spent 获取周期内累计成本（带短时缓存，周期起点变化即本地零点重置时立即失效）
+func (bm *BudgetManager) spent(apiType, period string, source CostSource, periodStart time.Time) int64 {
+	key := apiType + ":" + period
+	now := bm.now()
+
+	bm.mu.Lock()
+	if cached, ok := bm.cache[key]; ok && cached.periodStart.Equal(periodStart) && now.Sub(cached.fetchedAt) < spendCacheTTL {
+		bm.mu.Unlock()
+		return cached.cents
+	}
+	bm.mu.Unlock()
+
+	// 查询失败时使用已统计到的部分成本（可能偏低），不阻塞请求
+	cents, err := source.GetCostCentsSince(periodStart)
+	if err != nil {
+		log.Printf("[Budget] 警告: 获取 %s %s 累计成本失败: %v", apiType, period, err)
+	}
+
+	bm.mu.Lock()
+	bm.cache[key] = cachedSpend{periodStart: periodStart, cents: cents, fetchedAt: now}
+	bm.mu.Unlock()
+	return cents
+}
+
+func newPeriodStatus(period string, spent, softCap, hardCap int64, start, resetAt time.Time) PeriodStatus {
+	p := PeriodStatus{
+		Period:       period,
+		SpentCents:   spent,
+		SoftCapCents: softCap,
+		HardCapCents: hardCap,
+		SoftExceeded: softCap > 0 && spent >= softCap,
+		HardExceeded: hardCap > 0 && spent >= hardCap,
+		PeriodStart:  start,
+		ResetAt:      resetAt,
+	}
+	limit := hardCap
+	if limit == 0 {
+		limit = softCap
+	}
+	p.RemainingCents = max(limit-spent, 0)
+	return p
+}
+
+// startOfWeek 返回所在周周一零点（本地时间）
+func startOfWeek(dayStart time.Time) time.Time {
+	offset := (int(dayStart.Weekday()) + 6) % 7 // 周一为 0
+	return dayStart.AddDate(0, 0, -offset)
+}
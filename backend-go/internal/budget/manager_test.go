@@ -0,0 +1,139 @@
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+type fakeSource struct {
+	cents map[string]int64 // key: since 日期
+	calls int
+	err   error
+}
+
+func (s *fakeSource) GetCostCentsSince(since time.Time) (int64, error) {
+	s.calls++
+	return s.cents[since.Format("2006-01-02")], s.err
+}
+
+func newTestConfigManager(t *testing.T, cfg config.Config) *config.ConfigManager {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cm, err := config.NewConfigManager(configFile)
+	if err != nil {
+		t.Fatalf("NewConfigManager: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+	return cm
+}
+
+func TestBudgetManager_Check(t *testing.T) {
+	cm := newTestConfigManager(t, config.Config{
+		CostBudgets: map[string]config.CostBudget{
+			"messages":  {DailySoftCents: 100, DailyHardCents: 200, WeeklyHardCents: 1000},
+			"responses": {WeeklySoftCents: 50},
+		},
+	})
+	// 2026-10-14 为周三，所在周从 2026-10-12（周一）开始
+	now := time.Date(2026, 10, 14, 15, 0, 0, 0, time.Local)
+	messages := &fakeSource{cents: map[string]int64{"2026-10-14": 150, "2026-10-12": 400}}
+	responses := &fakeSource{cents: map[string]int64{"2026-10-12": 60}}
+	bm := NewBudgetManager(cm, map[string]CostSource{"messages": messages, "responses": responses})
+	bm.now = func() time.Time { return now }
+
+	d := bm.Check("messages")
+	if !d.Allowed || len(d.Warnings) != 1 || d.Warnings[0].Period != PeriodDaily {
+		t.Fatalf("messages decision = %+v, want allowed with daily warning", d)
+	}
+	status := bm.Status("messages")
+	if len(status.Periods) != 2 {
+		t.Fatalf("periods = %+v, want daily + weekly", status.Periods)
+	}
+	daily, weekly := status.Periods[0], status.Periods[1]
+	if daily.RemainingCents != 50 || !daily.ResetAt.Equal(time.Date(2026, 10, 15, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("daily = %+v", daily)
+	}
+	if weekly.RemainingCents != 600 || !weekly.PeriodStart.Equal(time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local)) ||
+		!weekly.ResetAt.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("weekly = %+v", weekly)
+	}
+
+	// 仅软上限：超限只告警，剩余额度按软上限计算
+	d = bm.Check("responses")
+	if !d.Allowed || len(d.Warnings) != 1 || d.Warnings[0].RemainingCents != 0 {
+		t.Fatalf("responses decision = %+v, want allowed with weekly warning", d)
+	}
+
+	// 未配置预算的接口类型直接放行
+	if d := bm.Check("gemini"); !d.Allowed || len(d.Warnings) != 0 {
+		t.Fatalf("gemini decision = %+v, want allowed", d)
+	}
+	if s := bm.Status("gemini"); s.Enabled || len(s.Periods) != 0 {
+		t.Fatalf("gemini status = %+v, want disabled", s)
+	}
+
+	// 超过硬上限：拒绝（缓存过期后重新读取）
+	messages.cents["2026-10-14"] = 250
+	now = now.Add(spendCacheTTL)
+	d = bm.Check("messages")
+	if d.Allowed || d.Blocked == nil || d.Blocked.Period != PeriodDaily || d.Blocked.RemainingCents != 0 {
+		t.Fatalf("messages decision = %+v, want blocked by daily hard cap", d)
+	}
+}
+
+func TestBudgetManager_CacheAndMidnightReset(t *testing.T) {
+	cm := newTestConfigManager(t, config.Config{
+		CostBudgets: map[string]config.CostBudget{"messages": {DailyHardCents: 100}},
+	})
+	now := time.Date(2026, 10, 14, 23, 59, 58, 0, time.Local)
+	source := &fakeSource{cents: map[string]int64{"2026-10-14": 100}}
+	bm := NewBudgetManager(cm, map[string]CostSource{"messages": source})
+	bm.now = func() time.Time { return now }
+
+	if d := bm.Check("messages"); d.Allowed {
+		t.Fatalf("decision = %+v, want blocked", d)
+	}
+	if d := bm.Check("messages"); d.Allowed || source.calls != 1 {
+		t.Fatalf("calls = %d, want cached spend within TTL", source.calls)
+	}
+
+	// 本地零点后进入新周期，即使缓存未过期也重新统计
+	now = now.Add(3 * time.Second)
+	if d := bm.Check("messages"); !d.Allowed || source.calls != 2 {
+		t.Fatalf("decision = %+v calls = %d, want reset after midnight", d, source.calls)
+	}
+}
+
+func TestBudgetManager_SourceErrorFailsOpen(t *testing.T) {
+	cm := newTestConfigManager(t, config.Config{
+		CostBudgets: map[string]config.CostBudget{"messages": {WeeklyHardCents: 100}},
+	})
+	source := &fakeSource{err: errors.New("db down")}
+	bm := NewBudgetManager(cm, map[string]CostSource{"messages": source})
+
+	if d := bm.Check("messages"); !d.Allowed {
+		t.Fatalf("decision = %+v, want allowed when spend is unknown", d)
+	}
+}
+
+func TestStartOfWeek(t *testing.T) {
+	for day := 12; day <= 18; day++ {
+		got := startOfWeek(time.Date(2026, 10, day, 0, 0, 0, 0, time.Local))
+		if want := time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local); !got.Equal(want) {
+			t.Fatalf("startOfWeek(10-%d) = %v, want %v", day, got, want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package capture 提供请求/响应完整抓包（调试用）：按采样率将客户端请求、上游请求与上游原始响应写入磁盘
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// filePrefix 抓包文件名前缀（轮转时只清理带此前缀的文件）
+	filePrefix = "capture-"
+	// queueSize 待写入队列长度，队列满时丢弃抓包而不阻塞请求
+	queueSize = 256
+)
+
+// Transcript 一次上游尝试的完整记录
+type Transcript struct {
+	Timestamp        time.Time    `json:"timestamp"`
+	API              string       `json:"api"` // messages / responses
+	Channel          string       `json:"channel"`
+	KeyMask          string       `json:"key"`
+	Attempt          int          `json:"attempt"` // 同一客户端请求内的第几次上游尝试
+	ClientRequest    *HTTPMessage `json:"clientRequest"`
+	UpstreamRequest  *HTTPMessage `json:"upstreamRequest"`
+	UpstreamResponse *HTTPMessage `json:"upstreamResponse,omitempty"`
+	Error            string       `json:"error,omitempty"` // 发送请求失败时的错误
+}
+
+// HTTPMessage 请求或响应的原始内容（敏感请求头已脱敏）
+type HTTPMessage struct {
+	Method    string            `json:"method,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Status    int               `json:"status,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body"`
+	Truncated bool              `json:"truncated,omitempty"` // 超过单条上限被截断
+}
+
+// captureFile 已写入的抓包文件
+type captureFile struct {
+	name string
+	size int64
+}
+
+// Recorder 抓包记录器：通过带缓冲的队列异步写盘，并按总大小上限轮转删除最旧的文件
+type Recorder struct {
+	dir        string
+	sampleRate float64
+	maxBytes   int64
+
+	mu     sync.RWMutex // 保护 queue 的关闭
+	closed bool
+	queue  chan *Transcript
+	done   chan struct{}
+
+	// 以下字段仅由写入 goroutine 访问
+	files      []captureFile
+	totalBytes int64
+}
+
+// NewRecorder 创建抓包记录器并启动写入 goroutine
+// sampleRate 为采样比例（0-1），maxBytes 为抓包目录总大小上限（含启动时已存在的抓包文件）
+func NewRecorder(dir string, sampleRate float64, maxBytes int64) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建抓包目录失败: %w", err)
+	}
+	r := &Recorder{
+		dir:        dir,
+		sampleRate: sampleRate,
+		maxBytes:   maxBytes,
+		queue:      make(chan *Transcript, queueSize),
+		done:       make(chan struct{}),
+	}
+	if err := r.loadExisting(); err != nil {
+		return nil, err
+	}
+	go r.run()
+	return r, nil
+}
+
+// Sample 按采样率决定是否抓取当前请求
+func (r *Recorder) Sample() bool {
+	if r == nil || r.sampleRate <= 0 {
+		return false
+	}
+	return r.sampleRate >= 1 || rand.Float64() < r.sampleRate
+}
+
+// Submit 提交一条记录（非阻塞，队列满或已关闭时丢弃）
+func (r *Recorder) Submit(t *Transcript) {
+	if r == nil || t == nil {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- t:
+	default:
+		log.Printf("[Capture] 警告: 写入队列已满，丢弃抓包 (%s %s)", t.API, t.Channel)
+	}
+}
+
+// Close 停止接收新记录，并等待队列中的记录写完
+func (r *Recorder) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+	<-r.done
+}
+
+// run 写入 goroutine
+func (r *Recorder) run() {
+	defer close(r.done)
+	for t := range r.queue {
+		if err := r.write(t); err != nil {
+			log.Printf("[Capture] 警告: 写入抓包失败: %v", err)
+		}
+	}
+}
+
+// write 将记录写入带时间戳的文件，并在超过总大小上限时删除最旧的文件
+func (r *Recorder) write(t *Transcript) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s%s-%s-%s-%s-%d.json", filePrefix,
+		t.Timestamp.Format("20060102T150405.000000000"), t.API, sanitizeFileName(t.Channel), sanitizeFileName(t.KeyMask), t.Attempt)
+	if err := os.WriteFile(filepath.Join(r.dir, name), data, 0600); err != nil {
+		return err
+	}
+
+	r.files = append(r.files, captureFile{name: name, size: int64(len(data))})
+	r.totalBytes += int64(len(data))
+	r.rotate()
+	return nil
+}
+
+// rotate 删除最旧的抓包文件直到总大小不超过上限（始终保留最新的一个）
+func (r *Recorder) rotate() {
+	for r.totalBytes > r.maxBytes && len(r.files) > 1 {
+		oldest := r.files[0]
+		if err := os.Remove(filepath.Join(r.dir, oldest.name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Capture] 警告: 删除旧抓包失败: %v", err)
+			return
+		}
+		r.files = r.files[1:]
+		r.totalBytes -= oldest.size
+	}
+}
+
+// loadExisting 统计目录中已有的抓包文件，使总大小上限跨重启生效
+func (r *Recorder) loadExisting() error {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("读取抓包目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), filePrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		r.files = append(r.files, captureFile{name: entry.Name(), size: info.Size()})
+		r.totalBytes += info.Size()
+	}
+	// 文件名以时间戳开头，按名称排序即按时间排序
+	sort.Slice(r.files, func(i, j int) bool { return r.files[i].name < r.files[j].name })
+	r.rotate()
+	return nil
+}
+
+// sanitizeFileName 将渠道名、密钥掩码等转换为安全的文件名片段
+func sanitizeFileName(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	var b strings.Builder
+	for _, ch := range s {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '.', ch == '_':
+			b.WriteRune(ch)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := b.String()
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
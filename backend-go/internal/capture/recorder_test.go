@@ -0,0 +1,130 @@
+package capture
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listCaptures(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取目录失败: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestRecorder_WritesTranscript(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRecorder(dir, 1, 1024*1024)
+	if err != nil {
+		t.Fatalf("NewRecorder 失败: %v", err)
+	}
+
+	r.Submit(&Transcript{
+		Timestamp:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		API:              "messages",
+		Channel:          "my channel/1",
+		KeyMask:          "sk-ant-a***12345",
+		Attempt:          1,
+		ClientRequest:    &HTTPMessage{Method: "POST", URL: "/v1/messages", Body: `{"model":"x"}`},
+		UpstreamResponse: &HTTPMessage{Status: 200, Body: "event: message_stop\n\n"},
+	})
+	r.Close()
+
+	names := listCaptures(t, dir)
+	if len(names) != 1 {
+		t.Fatalf("期望 1 个抓包文件，实际 %v", names)
+	}
+	name := names[0]
+	if !strings.HasPrefix(name, "capture-20240102T030405") || !strings.Contains(name, "-messages-my_channel_1-sk_ant_a___12345-1.json") {
+		t.Errorf("文件名不符合预期: %s", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("读取抓包失败: %v", err)
+	}
+	var got Transcript
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("抓包不是合法 JSON: %v", err)
+	}
+	if got.UpstreamResponse.Body != "event: message_stop\n\n" || got.ClientRequest.Body != `{"model":"x"}` {
+		t.Errorf("抓包内容不符合预期: %+v", got)
+	}
+}
+
+func TestRecorder_RotatesOldestFiles(t *testing.T) {
+	dir := t.TempDir()
+	// 已存在的旧抓包计入总大小，非抓包文件不受影响
+	if err := os.WriteFile(filepath.Join(dir, "capture-00000000T000000.000000000-old.json"), make([]byte, 600), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), make([]byte, 5000), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRecorder(dir, 1, 1000)
+	if err != nil {
+		t.Fatalf("NewRecorder 失败: %v", err)
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		r.Submit(&Transcript{
+			Timestamp:     base.Add(time.Duration(i) * time.Second),
+			API:           "responses",
+			Channel:       "c",
+			KeyMask:       "k",
+			Attempt:       1,
+			ClientRequest: &HTTPMessage{Body: strings.Repeat("x", 300)},
+		})
+	}
+	r.Close()
+
+	names := listCaptures(t, dir)
+	var total int64
+	var captures []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, filePrefix) {
+			continue
+		}
+		captures = append(captures, name)
+		info, _ := os.Stat(filepath.Join(dir, name))
+		total += info.Size()
+	}
+	if total > 1000 {
+		t.Errorf("抓包总大小 %d 超过上限", total)
+	}
+	if len(captures) == 0 || !strings.HasPrefix(captures[len(captures)-1], "capture-20240101T000002") {
+		t.Errorf("应保留最新的抓包，实际 %v", captures)
+	}
+	for _, name := range captures {
+		if strings.Contains(name, "old") {
+			t.Errorf("最旧的抓包应被删除: %v", captures)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("非抓包文件不应被删除: %v", err)
+	}
+}
+
+func TestRecorder_Sample(t *testing.T) {
+	var nilRecorder *Recorder
+	if nilRecorder.Sample() {
+		t.Error("nil Recorder 不应采样")
+	}
+	if (&Recorder{sampleRate: 0}).Sample() {
+		t.Error("采样率 0 不应采样")
+	}
+	if !(&Recorder{sampleRate: 1}).Sample() {
+		t.Error("采样率 1 应始终采样")
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+// EffectiveMaxRequestBodySize 渠道的请求体大小上限（字节）：渠道 maxRequestBodySize 优先，未配置时使用全局上限
+func (u *UpstreamConfig) EffectiveMaxRequestBodySize(defaultLimit int64) int64 {
+	if u.MaxRequestBodySize > 0 {
+		return u.MaxRequestBodySize
+	}
+	return defaultLimit
+}
+
+// AcceptsRequestBodySize 判断渠道是否接受指定大小的请求体
+func (u *UpstreamConfig) AcceptsRequestBodySize(size, defaultLimit int64) bool {
+	return size <= u.EffectiveMaxRequestBodySize(defaultLimit)
+}
+
+// GetRequestBodyReadLimit 读取请求体时的上限：全局上限与所有渠道 maxRequestBodySize 中的最大值
+// 超过全局上限的请求仍可被读取，由调度器路由到上限足够大的渠道
+func (cm *ConfigManager) GetRequestBodyReadLimit(defaultLimit int64) int64 {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	limit := defaultLimit
+	for _, upstreams := range [][]UpstreamConfig{cm.config.Upstream, cm.config.ResponsesUpstream, cm.config.GeminiUpstream} {
+		for i := range upstreams {
+			limit = max(limit, upstreams[i].MaxRequestBodySize)
+		}
+	}
+	return limit
+}
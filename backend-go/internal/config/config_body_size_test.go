@@ -0,0 +1,40 @@
+package config
+
+import "testing"
+
+func TestUpstreamConfig_AcceptsRequestBodySize(t *testing.T) {
+	const defaultLimit = 10 << 20
+
+	cheap := &UpstreamConfig{MaxRequestBodySize: 1 << 20}
+	if cheap.AcceptsRequestBodySize(2<<20, defaultLimit) {
+		t.Error("超过渠道上限的请求不应被接受")
+	}
+	if !cheap.AcceptsRequestBodySize(1<<20, defaultLimit) {
+		t.Error("等于渠道上限的请求应被接受")
+	}
+
+	unset := &UpstreamConfig{}
+	if got := unset.EffectiveMaxRequestBodySize(defaultLimit); got != defaultLimit {
+		t.Errorf("未配置时应使用全局上限, got %d", got)
+	}
+	if unset.AcceptsRequestBodySize(defaultLimit+1, defaultLimit) {
+		t.Error("未配置时超过全局上限的请求不应被接受")
+	}
+}
+
+func TestGetRequestBodyReadLimit(t *testing.T) {
+	const defaultLimit = 10 << 20
+
+	cm := newTestConfigManager()
+	if got := cm.GetRequestBodyReadLimit(defaultLimit); got != defaultLimit {
+		t.Errorf("无渠道配置时应为全局上限, got %d", got)
+	}
+
+	cm.config = Config{
+		Upstream:       []UpstreamConfig{{MaxRequestBodySize: 1 << 20}},
+		GeminiUpstream: []UpstreamConfig{{MaxRequestBodySize: 50 << 20}},
+	}
+	if got := cm.GetRequestBodyReadLimit(defaultLimit); got != 50<<20 {
+		t.Errorf("应取所有渠道上限与全局上限的最大值, got %d", got)
+	}
+}
@@ -0,0 +1,11 @@
+package config
+
+import "fmt"
+
+// normalizeCanaryPercent 校验渠道灰度流量比例（0-100，0 表示非灰度渠道）
+func normalizeCanaryPercent(percent float64) (float64, error) {
+	if percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("canaryPercent 超出范围: %g（需在 0-100 之间）", percent)
+	}
+	return percent, nil
+}
@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestUpdateUpstream_CanaryPercent(t *testing.T) {
+	cm := newKeySourceTestConfigManager(t)
+
+	for _, invalid := range []float64{-1, 100.5} {
+		percent := invalid
+		if _, err := cm.UpdateUpstream(0, UpstreamUpdate{CanaryPercent: &percent}); err == nil {
+			t.Fatalf("canaryPercent %g 应校验失败", invalid)
+		}
+	}
+
+	percent := 5.0
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{CanaryPercent: &percent}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0].CanaryPercent; got != 5 {
+		t.Fatalf("CanaryPercent = %g, want 5", got)
+	}
+
+	// 设为 0 退出灰度
+	zero := 0.0
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{CanaryPercent: &zero}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0].CanaryPercent; got != 0 {
+		t.Fatalf("CanaryPercent = %g, want 0", got)
+	}
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+// ============== 渠道批量导入/导出 ==============
+
+// ChannelExportVersion 导出格式版本
+const ChannelExportVersion = 1
+
+// 导入模式
+const (
+	ChannelImportReplace = "replace" // 用导入内容整体替换对应接口类型的渠道列表
+	ChannelImportMerge   = "merge"   // 按渠道名称合并：同名渠道原位覆盖，其余追加到末尾
+)
+
+// ChannelExport 渠道配置导出格式（字段名与配置文件一致，可直接拷贝到 config.json）
+// 导入时某个渠道列表字段缺失（null）表示不修改该接口类型的渠道；空数组在 replace 模式下表示清空
+type ChannelExport struct {
+	Version              int              `json:"version"`
+	ExportedAt           time.Time        `json:"exportedAt"`
+	KeysRedacted         bool             `json:"keysRedacted,omitempty"`
+	Upstream             []UpstreamConfig `json:"upstream"`
+	ResponsesUpstream    []UpstreamConfig `json:"responsesUpstream"`
+	GeminiUpstream       []UpstreamConfig `json:"geminiUpstream"`
+	LoadBalance          string           `json:"loadBalance,omitempty"`
+	ResponsesLoadBalance string           `json:"responsesLoadBalance,omitempty"`
+	GeminiLoadBalance    string           `json:"geminiLoadBalance,omitempty"`
+}
+
+// ChannelImportStats 单个接口类型的导入统计
+type ChannelImportStats struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+	Total   int `json:"total"` // 导入后的渠道总数
+}
+
+// ChannelImportResult 导入结果
+type ChannelImportResult struct {
+	Mode      string             `json:"mode"`
+	DryRun    bool               `json:"dryRun"`
+	Messages  ChannelImportStats `json:"messages"`
+	Responses ChannelImportStats `json:"responses"`
+	Gemini    ChannelImportStats `json:"gemini"`
+}
+
+// ExportChannels 导出全部渠道与负载均衡配置
+// 来自 env:/file: 引用的密钥导出为引用本身；redactKeys 为 true 时其余明文密钥脱敏（脱敏后的导出不能再导入）
+func (cm *ConfigManager) ExportChannels(redactKeys bool) ChannelExport {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	cfg := cm.persistableConfigLocked(cm.config)
+	export := ChannelExport{
+		Version:              ChannelExportVersion,
+		ExportedAt:           time.Now().UTC(),
+		KeysRedacted:         redactKeys,
+		Upstream:             cloneUpstreams(cfg.Upstream),
+		ResponsesUpstream:    cloneUpstreams(cfg.ResponsesUpstream),
+		GeminiUpstream:       cloneUpstreams(cfg.GeminiUpstream),
+		LoadBalance:          cfg.LoadBalance,
+		ResponsesLoadBalance: cfg.ResponsesLoadBalance,
+		GeminiLoadBalance:    cfg.GeminiLoadBalance,
+	}
+	if redactKeys {
+		for _, upstreams := range [][]UpstreamConfig{export.Upstream, export.ResponsesUpstream, export.GeminiUpstream} {
+			for i := range upstreams {
+				redactUpstreamKeys(&upstreams[i])
+			}
+		}
+	}
+	return export
+}
+
+// ImportChannels 校验并导入渠道配置，全部校验通过后一次性替换内存配置并保存；任一渠道校验失败时不做任何修改
+// dryRun 为 true 时只校验并返回导入统计，不修改配置
+func (cm *ConfigManager) ImportChannels(data ChannelExport, mode string, dryRun bool) (*ChannelImportResult, error) {
+	if mode == "" {
+		mode = ChannelImportMerge
+	}
+	if mode != ChannelImportReplace && mode != ChannelImportMerge {
+		return nil, fmt.Errorf("无效的导入模式: %q（可选 replace、merge）", mode)
+	}
+	if data.Version > ChannelExportVersion {
+		return nil, fmt.Errorf("不支持的导出格式版本: %d", data.Version)
+	}
+	if data.KeysRedacted {
+		return nil, fmt.Errorf("导入内容的密钥已脱敏，请使用 redactKeys=false 导出的配置")
+	}
+	if data.Upstream == nil && data.ResponsesUpstream == nil && data.GeminiUpstream == nil {
+		return nil, fmt.Errorf("导入内容不包含任何渠道列表")
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	newConfig := cm.config
+	result := &ChannelImportResult{Mode: mode, DryRun: dryRun}
+	groups := []struct {
+		kind     string
+		imported []UpstreamConfig
+		target   *[]UpstreamConfig
+		stats    *ChannelImportStats
+	}{
+		{"Messages", data.Upstream, &newConfig.Upstream, &result.Messages},
+		{"Responses", data.ResponsesUpstream, &newConfig.ResponsesUpstream, &result.Responses},
+		{"Gemini", data.GeminiUpstream, &newConfig.GeminiUpstream, &result.Gemini},
+	}
+	for _, group := range groups {
+		current := cloneUpstreams(*group.target)
+		if group.imported != nil {
+			imported, err := prepareImportedUpstreams(group.kind, group.imported, mode)
+			if err != nil {
+				return nil, err
+			}
+			current = mergeImportedUpstreams(current, imported, mode, group.stats)
+		}
+		*group.target = current
+		group.stats.Total = len(current)
+	}
+	if data.LoadBalance != "" {
+		newConfig.LoadBalance = data.LoadBalance
+	}
+	if data.ResponsesLoadBalance != "" {
+		newConfig.ResponsesLoadBalance = data.ResponsesLoadBalance
+	}
+	if data.GeminiLoadBalance != "" {
+		newConfig.GeminiLoadBalance = data.GeminiLoadBalance
+	}
+	if err := validateConfig(&newConfig); err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	// 自检：没有配置 key 的渠道自动暂停（与加载配置文件时一致）
+	cm.validateChannelKeys(&newConfig)
+	if err := cm.saveConfigLocked(newConfig); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Config-Import] 渠道配置已导入 (模式: %s): Messages %d 个渠道, Responses %d 个渠道, Gemini %d 个渠道",
+		mode, result.Messages.Total, result.Responses.Total, result.Gemini.Total)
+	return result, nil
+}
+
+// prepareImportedUpstreams 校验并规范化导入的渠道（去重密钥与 BaseURL，merge 模式下要求渠道名唯一）
+func prepareImportedUpstreams(kind string, upstreams []UpstreamConfig, mode string) ([]UpstreamConfig, error) {
+	out := cloneUpstreams(upstreams)
+	names := make(map[string]bool, len(out))
+	for i := range out {
+		up := &out[i]
+		for _, key := range up.APIKeys {
+			if strings.Contains(key, "***") {
+				return nil, fmt.Errorf("%s 渠道 [%d] %s: 密钥已脱敏，无法导入", kind, i, up.Name)
+			}
+		}
+		if strings.Contains(up.ProxyURL, ":***@") {
+			return nil, fmt.Errorf("%s 渠道 [%d] %s: 代理密码已脱敏，无法导入", kind, i, up.Name)
+		}
+		up.APIKeys = deduplicateStrings(up.APIKeys)
+		up.BaseURLs = deduplicateBaseURLs(up.BaseURLs)
+		if err := validateUpstreamConfig(up); err != nil {
+			return nil, fmt.Errorf("%s 渠道 [%d] %s: %w", kind, i, up.Name, err)
+		}
+		if mode == ChannelImportMerge && up.Name != "" {
+			if names[up.Name] {
+				return nil, fmt.Errorf("%s 渠道名称重复: %s（merge 模式按名称匹配，名称必须唯一）", kind, up.Name)
+			}
+			names[up.Name] = true
+		}
+	}
+	return out, nil
+}
+
+// mergeImportedUpstreams 按导入模式合并渠道列表，保留导入内容中的渠道顺序
+func mergeImportedUpstreams(current, imported []UpstreamConfig, mode string, stats *ChannelImportStats) []UpstreamConfig {
+	if mode == ChannelImportReplace {
+		stats.Removed = len(current)
+		stats.Added = len(imported)
+		return imported
+	}
+
+	byName := make(map[string]int, len(current))
+	for i := range current {
+		if name := current[i].Name; name != "" {
+			if _, exists := byName[name]; !exists {
+				byName[name] = i
+			}
+		}
+	}
+	for _, up := range imported {
+		if i, ok := byName[up.Name]; ok && up.Name != "" {
+			current[i] = up
+			stats.Updated++
+			continue
+		}
+		current = append(current, up)
+		stats.Added++
+	}
+	return current
+}
+
+// cloneUpstreams 深拷贝渠道列表
+func cloneUpstreams(upstreams []UpstreamConfig) []UpstreamConfig {
+	if upstreams == nil {
+		return []UpstreamConfig{}
+	}
+	out := make([]UpstreamConfig, len(upstreams))
+	for i := range upstreams {
+		out[i] = *upstreams[i].Clone()
+	}
+	return out
+}
+
+// redactUpstreamKeys 脱敏渠道中的明文密钥（env:/file: 引用保留）
+func redactUpstreamKeys(up *UpstreamConfig) {
+	mask := func(key string) string {
+		if IsAPIKeyRef(key) {
+			return key
+		}
+		return utils.MaskAPIKey(key)
+	}
+	for i, key := range up.APIKeys {
+		up.APIKeys[i] = mask(key)
+	}
+	up.ProxyURL = MaskProxyURL(up.ProxyURL)
+	for i, key := range up.CanonicalKeyOrder {
+		up.CanonicalKeyOrder[i] = mask(key)
+	}
+	if len(up.DrainingKeys) > 0 {
+		draining := make(map[string]time.Time, len(up.DrainingKeys))
+		for key, removeAt := range up.DrainingKeys {
+			draining[mask(key)] = removeAt
+		}
+		up.DrainingKeys = draining
+	}
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newChannelIOTestManager(t *testing.T, content string) *ConfigManager {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+	cm, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("初始化配置管理器失败: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+	return cm
+}
+
+func TestChannelExportImport_RoundTrip(t *testing.T) {
+	t.Setenv("CHANNEL_IO_TEST_KEY", "sk-from-env")
+	promotion := time.Now().Add(time.Hour).UTC().Truncate(time.Second).Format(time.RFC3339)
+	src := newChannelIOTestManager(t, `{
+		"upstream": [
+			{"name": "a", "baseUrl": "https://a.example.com", "apiKeys": ["sk-a1", "env:CHANNEL_IO_TEST_KEY"], "serviceType": "claude",
+			 "status": "active", "priority": 2, "promotionUntil": "`+promotion+`", "modelMapping": {"opus": ["claude-opus-4-1", "claude-opus-4"]}},
+			{"name": "b", "baseUrl": "https://b.example.com", "apiKeys": ["sk-b1"], "serviceType": "openai", "status": "disabled", "priority": 1}
+		],
+		"responsesUpstream": [{"name": "r", "baseUrl": "https://r.example.com", "apiKeys": ["sk-r"], "serviceType": "responses", "status": "suspended"}],
+		"loadBalance": "failover", "responsesLoadBalance": "failover", "geminiLoadBalance": "failover"
+	}`)
+
+	export := src.ExportChannels(false)
+	if got := export.Upstream[0].APIKeys; !reflect.DeepEqual(got, []string{"sk-a1", "env:CHANNEL_IO_TEST_KEY"}) {
+		t.Fatalf("导出应保留密钥引用, got %v", got)
+	}
+	if export.GeminiUpstream == nil {
+		t.Fatalf("空渠道列表应导出为空数组")
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("序列化导出失败: %v", err)
+	}
+	var decoded ChannelExport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("解析导出失败: %v", err)
+	}
+
+	dst := newChannelIOTestManager(t, `{"upstream": [{"name": "old", "baseUrl": "https://old.example.com", "apiKeys": ["k"]}], "loadBalance": "failover"}`)
+	result, err := dst.ImportChannels(decoded, ChannelImportReplace, false)
+	if err != nil {
+		t.Fatalf("ImportChannels() err = %v", err)
+	}
+	if result.Messages.Removed != 1 || result.Messages.Added != 2 || result.Responses.Total != 1 {
+		t.Fatalf("导入统计 = %+v", result)
+	}
+
+	want, got := src.GetConfig(), dst.GetConfig()
+	for _, pair := range [][2][]UpstreamConfig{{want.Upstream, got.Upstream}, {want.ResponsesUpstream, got.ResponsesUpstream}} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			t.Fatalf("往返导入后渠道不一致:\nwant %+v\ngot  %+v", pair[0], pair[1])
+		}
+	}
+	if got.Upstream[0].APIKeys[1] != "sk-from-env" || got.Upstream[0].ModelMappingChains["opus"][1] != "claude-opus-4" {
+		t.Fatalf("导入后应解析密钥引用并保留映射候选链: %+v", got.Upstream[0])
+	}
+	if got.Upstream[0].PromotionUntil == nil || got.Upstream[1].Status != "disabled" {
+		t.Fatalf("导入后应保留促销期与状态: %+v", got.Upstream)
+	}
+	if reexport := dst.ExportChannels(false); !reflect.DeepEqual(reexport.Upstream, export.Upstream) {
+		t.Fatalf("再次导出应与原导出一致")
+	}
+}
+
+func TestImportChannels_MergeByName(t *testing.T) {
+	cm := newChannelIOTestManager(t, `{
+		"upstream": [
+			{"name": "a", "baseUrl": "https://a.example.com", "apiKeys": ["k1"]},
+			{"name": "b", "baseUrl": "https://b.example.com", "apiKeys": ["k2"]}
+		],
+		"geminiUpstream": [{"name": "g", "baseUrl": "https://g.example.com", "apiKeys": ["kg"]}],
+		"loadBalance": "failover"
+	}`)
+
+	result, err := cm.ImportChannels(ChannelExport{
+		Upstream: []UpstreamConfig{
+			{Name: "c", BaseURL: "https://c.example.com", APIKeys: []string{"k3", "k3"}, Status: "active"},
+			{Name: "a", BaseURL: "https://a2.example.com", APIKeys: []string{"k9"}, Status: "suspended"},
+		},
+	}, ChannelImportMerge, false)
+	if err != nil {
+		t.Fatalf("ImportChannels() err = %v", err)
+	}
+	if result.Messages.Added != 1 || result.Messages.Updated != 1 || result.Messages.Total != 3 || result.Gemini.Total != 1 {
+		t.Fatalf("导入统计 = %+v", result)
+	}
+
+	cfg := cm.GetConfig()
+	names := []string{cfg.Upstream[0].Name, cfg.Upstream[1].Name, cfg.Upstream[2].Name}
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Fatalf("同名渠道应原位覆盖、新渠道追加, got %v", names)
+	}
+	if cfg.Upstream[0].BaseURL != "https://a2.example.com" || cfg.Upstream[0].Status != "suspended" {
+		t.Fatalf("同名渠道未被覆盖: %+v", cfg.Upstream[0])
+	}
+	if len(cfg.Upstream[2].APIKeys) != 1 {
+		t.Fatalf("导入的密钥应去重: %v", cfg.Upstream[2].APIKeys)
+	}
+	if len(cfg.GeminiUpstream) != 1 {
+		t.Fatalf("未包含在导入内容中的渠道列表不应修改")
+	}
+}
+
+func TestImportChannels_DryRunAndValidation(t *testing.T) {
+	cm := newChannelIOTestManager(t, `{"upstream": [{"name": "a", "baseUrl": "https://a.example.com", "apiKeys": ["k1"]}], "loadBalance": "failover"}`)
+
+	result, err := cm.ImportChannels(ChannelExport{
+		Upstream: []UpstreamConfig{{Name: "b", BaseURL: "https://b.example.com", APIKeys: []string{"k2"}}},
+	}, ChannelImportReplace, true)
+	if err != nil || !result.DryRun || result.Messages.Added != 1 {
+		t.Fatalf("dry-run result = %+v, err = %v", result, err)
+	}
+	if cfg := cm.GetConfig(); len(cfg.Upstream) != 1 || cfg.Upstream[0].Name != "a" {
+		t.Fatalf("dry-run 不应修改配置: %+v", cfg.Upstream)
+	}
+
+	for name, tc := range map[string]struct {
+		data ChannelExport
+		mode string
+		want string
+	}{
+		"invalid mode":    {ChannelExport{Upstream: []UpstreamConfig{}}, "append", "导入模式"},
+		"no channels":     {ChannelExport{}, ChannelImportMerge, "不包含任何渠道"},
+		"redacted export": {ChannelExport{KeysRedacted: true, Upstream: []UpstreamConfig{}}, ChannelImportMerge, "脱敏"},
+		"masked key": {ChannelExport{Upstream: []UpstreamConfig{
+			{Name: "m", BaseURL: "https://m.example.com", APIKeys: []string{"sk-ant-a***xyz12"}},
+		}}, ChannelImportMerge, "脱敏"},
+		"invalid baseUrl": {ChannelExport{Upstream: []UpstreamConfig{
+			{Name: "ok", BaseURL: "https://ok.example.com", APIKeys: []string{"k"}},
+			{Name: "bad", BaseURL: "bad.example.com", APIKeys: []string{"k"}},
+		}}, ChannelImportReplace, "baseUrl"},
+		"duplicate names in merge": {ChannelExport{Upstream: []UpstreamConfig{
+			{Name: "d", BaseURL: "https://d.example.com", APIKeys: []string{"k"}},
+			{Name: "d", BaseURL: "https://d2.example.com", APIKeys: []string{"k"}},
+		}}, ChannelImportMerge, "名称重复"},
+		"invalid load balance": {ChannelExport{Upstream: []UpstreamConfig{}, LoadBalance: "weighted"}, ChannelImportMerge, "loadBalance"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := cm.ImportChannels(tc.data, tc.mode, false); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want containing %q", err, tc.want)
+			}
+			if cfg := cm.GetConfig(); len(cfg.Upstream) != 1 || cfg.Upstream[0].Name != "a" || cfg.LoadBalance != "failover" {
+				t.Fatalf("校验失败后应保留旧配置: %+v", cfg.Upstream)
+			}
+		})
+	}
+}
+
+func TestExportChannels_RedactKeys(t *testing.T) {
+	t.Setenv("CHANNEL_IO_TEST_KEY", "sk-from-env")
+	cm := newChannelIOTestManager(t, `{"upstream": [{"name": "a", "baseUrl": "https://a.example.com",
+		"apiKeys": ["sk-ant-api03-secretvalue", "env:CHANNEL_IO_TEST_KEY"]}], "loadBalance": "failover"}`)
+
+	export := cm.ExportChannels(true)
+	keys := export.Upstream[0].APIKeys
+	if !export.KeysRedacted || strings.Contains(keys[0], "secretvalue") || !strings.Contains(keys[0], "***") || keys[1] != "env:CHANNEL_IO_TEST_KEY" {
+		t.Fatalf("脱敏导出 = %+v", export)
+	}
+	if cm.GetConfig().Upstream[0].APIKeys[0] != "sk-ant-api03-secretvalue" {
+		t.Fatalf("脱敏导出不应修改内存配置")
+	}
+}
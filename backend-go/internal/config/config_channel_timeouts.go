@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GetConnectTimeout 返回渠道配置的建立连接超时（未配置返回 0，使用全局默认）
+func (u *UpstreamConfig) GetConnectTimeout() time.Duration {
+	if u == nil {
+		return 0
+	}
+	return parseChannelTimeout(u.ConnectTimeout)
+}
+
+// GetResponseTimeout 返回渠道配置的读取响应超时（未配置返回 0，使用全局默认）
+func (u *UpstreamConfig) GetResponseTimeout() time.Duration {
+	if u == nil {
+		return 0
+	}
+	return parseChannelTimeout(u.ResponseTimeout)
+}
+
+func parseChannelTimeout(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// normalizeChannelTimeout 校验渠道超时配置（Go duration 字符串，如 "5s"、"2m"），nil 或空字符串表示使用全局默认
+func normalizeChannelTimeout(field string, value *string) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return "", nil
+	}
+	d, err := time.ParseDuration(trimmed)
+	if err != nil {
+		return "", fmt.Errorf("%s 配置无效: %q（示例: 5s、2m）", field, trimmed)
+	}
+	if d <= 0 || d > maxModelTimeout {
+		return "", fmt.Errorf("%s 超出范围: %s（需大于 0 且不超过 %s）", field, trimmed, maxModelTimeout)
+	}
+	return trimmed, nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeChannelTimeout(t *testing.T) {
+	valid := map[string]string{"": "", " 3s ": "3s", "2m": "2m"}
+	for in, want := range valid {
+		value := in
+		got, err := normalizeChannelTimeout("responseTimeout", &value)
+		if err != nil || got != want {
+			t.Fatalf("normalizeChannelTimeout(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if got, err := normalizeChannelTimeout("responseTimeout", nil); err != nil || got != "" {
+		t.Fatalf("nil 应返回空字符串，实际 %q, %v", got, err)
+	}
+	for _, in := range []string{"abc", "30", "0s", "-5s", "25h"} {
+		value := in
+		if _, err := normalizeChannelTimeout("responseTimeout", &value); err == nil {
+			t.Fatalf("超时 %q 应校验失败", in)
+		}
+	}
+}
+
+func TestUpdateUpstream_ChannelTimeouts(t *testing.T) {
+	cm := newKeySourceTestConfigManager(t)
+
+	invalid := "soon"
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{ConnectTimeout: &invalid}); err == nil {
+		t.Fatal("无效连接超时应返回错误")
+	}
+
+	connect, response := "3s", "2m"
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{ConnectTimeout: &connect, ResponseTimeout: &response}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	upstream := cm.GetConfig().Upstream[0]
+	if upstream.GetConnectTimeout() != 3*time.Second || upstream.GetResponseTimeout() != 2*time.Minute {
+		t.Fatalf("connect=%v response=%v", upstream.GetConnectTimeout(), upstream.GetResponseTimeout())
+	}
+
+	// 空字符串恢复全局默认，未提供的字段保持不变
+	empty := ""
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{ConnectTimeout: &empty}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	upstream = cm.GetConfig().Upstream[0]
+	if upstream.ConnectTimeout != "" || upstream.GetConnectTimeout() != 0 {
+		t.Fatalf("connectTimeout 应被清除，实际 %q", upstream.ConnectTimeout)
+	}
+	if upstream.ResponseTimeout != "2m" {
+		t.Fatalf("未提供 responseTimeout 时不应修改，实际 %q", upstream.ResponseTimeout)
+	}
+}
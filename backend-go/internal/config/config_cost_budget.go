@@ -0,0 +1,32 @@
+package config
+
+// CostBudget 单个接口类型的成本预算（美分，0 表示该上限不启用）
+// 日预算在本地零点重置，周预算在本地周一零点重置
+// 超过软上限仅告警（响应头 + 日志），超过硬上限拒绝新请求
+type CostBudget struct {
+	DailySoftCents  int64 `json:"dailySoftCents,omitempty"`
+	DailyHardCents  int64 `json:"dailyHardCents,omitempty"`
+	WeeklySoftCents int64 `json:"weeklySoftCents,omitempty"`
+	WeeklyHardCents int64 `json:"weeklyHardCents,omitempty"`
+}
+
+// IsEnabled 是否配置了任一上限
+func (b CostBudget) IsEnabled() bool {
+	return b.DailySoftCents > 0 || b.DailyHardCents > 0 || b.WeeklySoftCents > 0 || b.WeeklyHardCents > 0
+}
+
+// GetCostBudget 获取指定接口类型的成本预算，未配置任何上限时返回 false；负数上限按 0（不启用）处理
+func (cm *ConfigManager) GetCostBudget(apiType string) (CostBudget, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	b, ok := cm.config.CostBudgets[apiType]
+	if !ok {
+		return CostBudget{}, false
+	}
+	b.DailySoftCents = max(b.DailySoftCents, 0)
+	b.DailyHardCents = max(b.DailyHardCents, 0)
+	b.WeeklySoftCents = max(b.WeeklySoftCents, 0)
+	b.WeeklyHardCents = max(b.WeeklyHardCents, 0)
+	return b, b.IsEnabled()
+}
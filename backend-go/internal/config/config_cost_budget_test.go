@@ -0,0 +1,22 @@
+package config
+
+import "testing"
+
+func TestGetCostBudget(t *testing.T) {
+	cm := newTestConfigManager()
+	cm.config.CostBudgets = map[string]CostBudget{
+		"messages":  {DailySoftCents: 100, DailyHardCents: -1},
+		"responses": {DailyHardCents: -5},
+	}
+
+	b, ok := cm.GetCostBudget("messages")
+	if !ok || b.DailySoftCents != 100 || b.DailyHardCents != 0 {
+		t.Fatalf("GetCostBudget(messages) = %+v, %v", b, ok)
+	}
+	if _, ok := cm.GetCostBudget("responses"); ok {
+		t.Fatalf("GetCostBudget(responses) enabled with only negative caps")
+	}
+	if _, ok := cm.GetCostBudget("gemini"); ok {
+		t.Fatalf("GetCostBudget(gemini) enabled without config")
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+// protectedExtraHeaders 不允许通过 extraHeaders 设置的请求头（认证、逐跳与由 HTTP 客户端维护的头部）
+var protectedExtraHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"X-Api-Key":           true,
+	"X-Goog-Api-Key":      true,
+	"Cookie":              true,
+	"Host":                true,
+	"Content-Length":      true,
+	"Content-Type":        true,
+	"Transfer-Encoding":   true,
+	"Connection":          true,
+	"Upgrade":             true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Keep-Alive":          true,
+	"Accept-Encoding":     true,
+}
+
+// Extra header 值支持的模板变量
+const (
+	extraHeaderVarChannel = "{{channel}}" // 渠道名称
+	extraHeaderVarKeyMask = "{{keyMask}}" // 当前密钥的脱敏形式（utils.MaskAPIKey）
+)
+
+// normalizeExtraHeaders 校验渠道附加请求头：名称规范化（如 x-org-id -> X-Org-Id）、去除空白与空名称，
+// 拒绝非法名称与受保护的请求头；空表返回 nil（清除配置）
+func normalizeExtraHeaders(headers map[string]string) (map[string]string, error) {
+	cleaned := make(map[string]string, len(headers))
+	for name, value := range headers {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !isValidHeaderName(name) {
+			return nil, fmt.Errorf("附加请求头名称无效: %q", name)
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if protectedExtraHeaders[canonical] {
+			return nil, fmt.Errorf("附加请求头 %s 受保护，不允许覆盖", canonical)
+		}
+		value = strings.TrimSpace(value)
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("附加请求头 %s 的值不能包含换行", canonical)
+		}
+		cleaned[canonical] = value
+	}
+	if len(cleaned) == 0 {
+		return nil, nil
+	}
+	return cleaned, nil
+}
+
+// isValidHeaderName 请求头名称须为 RFC 7230 token
+func isValidHeaderName(name string) bool {
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", r) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// ApplyExtraHeaders 将渠道附加请求头写入上游请求头（覆盖客户端转发的同名头部）
+// 须在认证头与 User-Agent 等设置完成后调用；受保护的请求头即使出现在手工编辑的配置中也会被跳过
+func (u *UpstreamConfig) ApplyExtraHeaders(headers http.Header, apiKey string) {
+	if u == nil || len(u.ExtraHeaders) == 0 {
+		return
+	}
+	for name, value := range u.ExtraHeaders {
+		canonical := http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if canonical == "" || protectedExtraHeaders[canonical] || strings.ContainsAny(value, "\r\n") {
+			log.Printf("[Config-ExtraHeaders] 警告: 渠道 %s 的附加请求头 %q 受保护或无效，已跳过", u.Name, name)
+			continue
+		}
+		if strings.Contains(value, "{{") {
+			value = strings.ReplaceAll(value, extraHeaderVarChannel, u.Name)
+			value = strings.ReplaceAll(value, extraHeaderVarKeyMask, utils.MaskAPIKey(apiKey))
+		}
+		headers.Set(canonical, value)
+	}
+}
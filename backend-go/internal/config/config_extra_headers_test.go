@@ -0,0 +1,98 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeExtraHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{"nil", nil, nil, ""},
+		{"canonicalizes names and trims", map[string]string{" x-org-id ": " org-1 ", "http-referer": "https://a.example.com", "": "x"}, map[string]string{"X-Org-Id": "org-1", "Http-Referer": "https://a.example.com"}, ""},
+		{"rejects authorization", map[string]string{"authorization": "Bearer x"}, nil, "受保护"},
+		{"rejects api key", map[string]string{"X-API-KEY": "x"}, nil, "受保护"},
+		{"rejects host", map[string]string{"Host": "evil.example.com"}, nil, "受保护"},
+		{"rejects invalid name", map[string]string{"X Org": "1"}, nil, "名称无效"},
+		{"rejects header injection", map[string]string{"X-Org-Id": "1\r\nAuthorization: x"}, nil, "换行"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeExtraHeaders(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyExtraHeaders(t *testing.T) {
+	upstream := &UpstreamConfig{
+		Name: "org-channel",
+		ExtraHeaders: map[string]string{
+			"X-Org-Id":       "org-123",
+			"X-Channel":      "{{channel}}",
+			"X-Key":          "{{keyMask}}",
+			"x-goog-api-key": "hijacked",
+		},
+	}
+	headers := http.Header{}
+	headers.Set("X-Org-Id", "from-client")
+	headers.Set("X-Goog-Api-Key", "real-key")
+
+	upstream.ApplyExtraHeaders(headers, "sk-test-1234567890abcdef")
+
+	if got := headers.Values("X-Org-Id"); len(got) != 1 || got[0] != "org-123" {
+		t.Fatalf("X-Org-Id = %q", got)
+	}
+	if got := headers.Get("X-Channel"); got != "org-channel" {
+		t.Fatalf("X-Channel = %q", got)
+	}
+	if got := headers.Get("X-Key"); got == "" || strings.Contains(got, "1234567890abcdef") {
+		t.Fatalf("X-Key = %q, want 脱敏后的密钥", got)
+	}
+	if got := headers.Get("X-Goog-Api-Key"); got != "real-key" {
+		t.Fatalf("X-Goog-Api-Key = %q, 受保护的请求头不应被覆盖", got)
+	}
+}
+
+func TestUpdateUpstream_ExtraHeaders(t *testing.T) {
+	cm, _ := newDrainTestConfigManager(t)
+
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{ExtraHeaders: map[string]string{"Authorization": "x"}}); err == nil {
+		t.Fatalf("受保护请求头应被拒绝")
+	}
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{ExtraHeaders: map[string]string{"x-org-id": "org-1"}}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0].ExtraHeaders; got["X-Org-Id"] != "org-1" {
+		t.Fatalf("ExtraHeaders = %v", got)
+	}
+
+	// 空对象清除
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{ExtraHeaders: map[string]string{}}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0].ExtraHeaders; got != nil {
+		t.Fatalf("空对象应清除 ExtraHeaders, got %v", got)
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// FailoverOverride 返回渠道对指定状态码的故障转移覆盖规则
+// overridden 为 false 时使用默认判定；同一状态码同时出现在两个列表中时 noFailoverStatusCodes 优先（不转移）
+func (u *UpstreamConfig) FailoverOverride(statusCode int) (failover bool, overridden bool) {
+	if u == nil {
+		return false, false
+	}
+	if slices.Contains(u.NoFailoverStatusCodes, statusCode) {
+		return false, true
+	}
+	if slices.Contains(u.FailoverStatusCodes, statusCode) {
+		return true, true
+	}
+	return false, false
+}
+
+// normalizeStatusCodes 校验、去重并排序状态码列表（空列表返回 nil 表示清除）
+func normalizeStatusCodes(codes []int) ([]int, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	normalized := make([]int, 0, len(codes))
+	for _, code := range codes {
+		if code < 100 || code > 599 {
+			return nil, fmt.Errorf("无效的 HTTP 状态码: %d（范围 100-599）", code)
+		}
+		if !slices.Contains(normalized, code) {
+			normalized = append(normalized, code)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized, nil
+}
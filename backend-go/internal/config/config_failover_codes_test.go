@@ -0,0 +1,58 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFailoverOverride_Precedence(t *testing.T) {
+	u := &UpstreamConfig{
+		FailoverStatusCodes:   []int{400, 503},
+		NoFailoverStatusCodes: []int{503, 529},
+	}
+	tests := []struct {
+		code                 int
+		failover, overridden bool
+	}{
+		{code: 400, failover: true, overridden: true},
+		{code: 503, failover: false, overridden: true}, // 两个列表都包含时不转移优先
+		{code: 529, failover: false, overridden: true},
+		{code: 500, failover: false, overridden: false},
+	}
+	for _, tt := range tests {
+		failover, overridden := u.FailoverOverride(tt.code)
+		if failover != tt.failover || overridden != tt.overridden {
+			t.Fatalf("FailoverOverride(%d) = %v, %v; want %v, %v", tt.code, failover, overridden, tt.failover, tt.overridden)
+		}
+	}
+
+	var nilUpstream *UpstreamConfig
+	if _, overridden := nilUpstream.FailoverOverride(503); overridden {
+		t.Fatal("nil upstream should not override")
+	}
+}
+
+func TestUpdateUpstream_FailoverStatusCodes(t *testing.T) {
+	cm := newKeySourceTestConfigManager(t)
+
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{FailoverStatusCodes: []int{503, 400, 503}, NoFailoverStatusCodes: []int{404}}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	upstream := cm.GetConfig().Upstream[0]
+	if !slices.Equal(upstream.FailoverStatusCodes, []int{400, 503}) || !slices.Equal(upstream.NoFailoverStatusCodes, []int{404}) {
+		t.Fatalf("codes = %v / %v", upstream.FailoverStatusCodes, upstream.NoFailoverStatusCodes)
+	}
+
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{FailoverStatusCodes: []int{600}}); err == nil {
+		t.Fatal("expected error for invalid status code")
+	}
+
+	// 空数组清除，未传入的字段保持不变
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{FailoverStatusCodes: []int{}}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	upstream = cm.GetConfig().Upstream[0]
+	if upstream.FailoverStatusCodes != nil || !slices.Equal(upstream.NoFailoverStatusCodes, []int{404}) {
+		t.Fatalf("codes after clear = %v / %v", upstream.FailoverStatusCodes, upstream.NoFailoverStatusCodes)
+	}
+}
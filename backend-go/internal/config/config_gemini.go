@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"time"
 )
@@ -43,6 +44,36 @@ func (cm *ConfigManager) AddGeminiUpstream(upstream UpstreamConfig) error {
 
 	// 去重 API Keys 和 Base URLs
 	upstream.APIKeys = deduplicateStrings(upstream.APIKeys)
+	keySource, err := normalizeKeySource(upstream.KeySource)
+	if err != nil {
+		return err
+	}
+	upstream.KeySource = keySource
+	if upstream.FailoverStatusCodes, err = normalizeStatusCodes(upstream.FailoverStatusCodes); err != nil {
+		return err
+	}
+	if upstream.NoFailoverStatusCodes, err = normalizeStatusCodes(upstream.NoFailoverStatusCodes); err != nil {
+		return err
+	}
+	upstream.ResponseModelRewrite = normalizeResponseModelRewrite(upstream.ResponseModelRewrite)
+	if upstream.ModelTimeouts, err = normalizeModelTimeouts(upstream.ModelTimeouts); err != nil {
+		return err
+	}
+	if upstream.ExtraHeaders, err = normalizeExtraHeaders(upstream.ExtraHeaders); err != nil {
+		return err
+	}
+	if upstream.ConnectTimeout, err = normalizeChannelTimeout("connectTimeout", &upstream.ConnectTimeout); err != nil {
+		return err
+	}
+	if upstream.ResponseTimeout, err = normalizeChannelTimeout("responseTimeout", &upstream.ResponseTimeout); err != nil {
+		return err
+	}
+	if upstream.ProxyURL, err = normalizeProxyURL(&upstream.ProxyURL); err != nil {
+		return err
+	}
+	if upstream.LogSampleRate, err = normalizeLogSampleRate(upstream.LogSampleRate); err != nil {
+		return err
+	}
 	upstream.BaseURLs = deduplicateBaseURLs(upstream.BaseURLs)
 
 	cm.config.GeminiUpstream = append(cm.config.GeminiUpstream, upstream)
@@ -64,6 +95,45 @@ func (cm *ConfigManager) UpdateGeminiUpstream(index int, updates UpstreamUpdate)
 	if index < 0 || index >= len(cm.config.GeminiUpstream) {
 		return false, fmt.Errorf("无效的 Gemini 上游索引: %d", index)
 	}
+	if err := validateResponseSchemaUpdate(updates.ResponseSchema); err != nil {
+		return false, err
+	}
+	keySource, err := normalizeKeySource(updates.KeySource)
+	if err != nil {
+		return false, err
+	}
+	failoverCodes, err := normalizeStatusCodes(updates.FailoverStatusCodes)
+	if err != nil {
+		return false, err
+	}
+	noFailoverCodes, err := normalizeStatusCodes(updates.NoFailoverStatusCodes)
+	if err != nil {
+		return false, err
+	}
+	modelTimeouts, err := normalizeModelTimeouts(updates.ModelTimeouts)
+	if err != nil {
+		return false, err
+	}
+	extraHeaders, err := normalizeExtraHeaders(updates.ExtraHeaders)
+	if err != nil {
+		return false, err
+	}
+	connectTimeout, err := normalizeChannelTimeout("connectTimeout", updates.ConnectTimeout)
+	if err != nil {
+		return false, err
+	}
+	responseTimeout, err := normalizeChannelTimeout("responseTimeout", updates.ResponseTimeout)
+	if err != nil {
+		return false, err
+	}
+	proxyURL, err := normalizeProxyURL(updates.ProxyURL)
+	if err != nil {
+		return false, err
+	}
+	logSampleRate, err := normalizeLogSampleRate(updates.LogSampleRate)
+	if err != nil {
+		return false, err
+	}
 
 	upstream := &cm.config.GeminiUpstream[index]
 
@@ -100,10 +170,15 @@ func (cm *ConfigManager) UpdateGeminiUpstream(index int, updates UpstreamUpdate)
 				log.Printf("[Config-Upstream] Gemini 渠道 [%d] %s 已从暂停状态自动激活（单 key 更换）", index, upstream.Name)
 			}
 		}
-		upstream.APIKeys = deduplicateStrings(updates.APIKeys)
+		keys := deduplicateStrings(updates.APIKeys)
+		if !slices.Equal(keys, upstream.APIKeys) {
+			upstream.CanonicalKeyOrder = nil // 手动修改后的密钥列表即为新的规范顺序
+		}
+		upstream.APIKeys = keys
 	}
 	if updates.ModelMapping != nil {
 		upstream.ModelMapping = updates.ModelMapping
+		upstream.ModelMappingChains = updates.ModelMappingChains
 	}
 	if updates.InsecureSkipVerify != nil {
 		upstream.InsecureSkipVerify = *updates.InsecureSkipVerify
@@ -123,6 +198,66 @@ func (cm *ConfigManager) UpdateGeminiUpstream(index int, updates UpstreamUpdate)
 	if updates.LowQuality != nil {
 		upstream.LowQuality = *updates.LowQuality
 	}
+	if updates.ResponseSchema != nil {
+		upstream.ResponseSchema = normalizeResponseSchema(updates.ResponseSchema)
+	}
+	if updates.SupportedModels != nil {
+		upstream.SupportedModels = normalizeSupportedModels(updates.SupportedModels)
+	}
+	if updates.MaxOutputTokensClamp != nil {
+		upstream.MaxOutputTokensClamp = max(*updates.MaxOutputTokensClamp, 0)
+	}
+	if updates.KeySelection != nil {
+		upstream.KeySelection = *updates.KeySelection
+	}
+	if updates.MaxRequestBodySize != nil {
+		upstream.MaxRequestBodySize = max(*updates.MaxRequestBodySize, 0)
+	}
+	if updates.AllowedBetas != nil {
+		upstream.AllowedBetas = normalizeSupportedModels(updates.AllowedBetas)
+	}
+	if updates.KeySource != nil {
+		upstream.KeySource = keySource
+	}
+	if updates.FailoverStatusCodes != nil {
+		upstream.FailoverStatusCodes = failoverCodes
+	}
+	if updates.NoFailoverStatusCodes != nil {
+		upstream.NoFailoverStatusCodes = noFailoverCodes
+	}
+	if updates.ResponseModelRewrite != nil {
+		upstream.ResponseModelRewrite = normalizeResponseModelRewrite(updates.ResponseModelRewrite)
+	}
+	if updates.DisableKeyProbe != nil {
+		upstream.DisableKeyProbe = *updates.DisableKeyProbe
+	}
+	if updates.StripCacheControl != nil {
+		upstream.StripCacheControl = *updates.StripCacheControl
+	}
+	if updates.DailyRequestLimit != nil {
+		upstream.DailyRequestLimit = max(*updates.DailyRequestLimit, 0)
+	}
+	if updates.DailyTokenLimit != nil {
+		upstream.DailyTokenLimit = max(*updates.DailyTokenLimit, 0)
+	}
+	if updates.ModelTimeouts != nil {
+		upstream.ModelTimeouts = modelTimeouts
+	}
+	if updates.ExtraHeaders != nil {
+		upstream.ExtraHeaders = extraHeaders
+	}
+	if updates.ConnectTimeout != nil {
+		upstream.ConnectTimeout = connectTimeout
+	}
+	if updates.ResponseTimeout != nil {
+		upstream.ResponseTimeout = responseTimeout
+	}
+	if updates.ProxyURL != nil {
+		upstream.ProxyURL = proxyURL
+	}
+	if updates.LogSampleRate != nil {
+		upstream.LogSampleRate = logSampleRate
+	}
 
 	if err := cm.saveConfigLocked(cm.config); err != nil {
 		return false, err
@@ -160,6 +295,8 @@ func (cm *ConfigManager) AddGeminiAPIKey(index int, apiKey string) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	apiKey = cm.resolveKeyParamLocked(apiKey)
+
 	if index < 0 || index >= len(cm.config.GeminiUpstream) {
 		return fmt.Errorf("无效的上游索引: %d", index)
 	}
@@ -186,6 +323,8 @@ func (cm *ConfigManager) RemoveGeminiAPIKey(index int, apiKey string) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	apiKey = cm.resolveKeyParamLocked(apiKey)
+
 	if index < 0 || index >= len(cm.config.GeminiUpstream) {
 		return fmt.Errorf("无效的上游索引: %d", index)
 	}
@@ -223,6 +362,8 @@ func (cm *ConfigManager) MoveGeminiAPIKeyToTop(upstreamIndex int, apiKey string)
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	apiKey = cm.resolveKeyParamLocked(apiKey)
+
 	if upstreamIndex < 0 || upstreamIndex >= len(cm.config.GeminiUpstream) {
 		return fmt.Errorf("无效的上游索引: %d", upstreamIndex)
 	}
@@ -241,6 +382,7 @@ func (cm *ConfigManager) MoveGeminiAPIKeyToTop(upstreamIndex int, apiKey string)
 	}
 
 	upstream.APIKeys = append([]string{apiKey}, append(upstream.APIKeys[:index], upstream.APIKeys[index+1:]...)...)
+	upstream.CanonicalKeyOrder = nil // 手动调整后的顺序即为新的规范顺序
 	return cm.saveConfigLocked(cm.config)
 }
 
@@ -249,6 +391,8 @@ func (cm *ConfigManager) MoveGeminiAPIKeyToBottom(upstreamIndex int, apiKey stri
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	apiKey = cm.resolveKeyParamLocked(apiKey)
+
 	if upstreamIndex < 0 || upstreamIndex >= len(cm.config.GeminiUpstream) {
 		return fmt.Errorf("无效的上游索引: %d", upstreamIndex)
 	}
@@ -268,6 +412,7 @@ func (cm *ConfigManager) MoveGeminiAPIKeyToBottom(upstreamIndex int, apiKey stri
 
 	upstream.APIKeys = append(upstream.APIKeys[:index], upstream.APIKeys[index+1:]...)
 	upstream.APIKeys = append(upstream.APIKeys, apiKey)
+	upstream.CanonicalKeyOrder = nil // 手动调整后的顺序即为新的规范顺序
 	return cm.saveConfigLocked(cm.config)
 }
 
@@ -377,6 +522,13 @@ func (cm *ConfigManager) GetPromotedGeminiChannel() (int, bool) {
 	return -1, false
 }
 
+// GetGeminiLoadBalance 获取 Gemini 负载均衡策略
+func (cm *ConfigManager) GetGeminiLoadBalance() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.config.GeminiLoadBalance
+}
+
 // SetGeminiLoadBalance 设置 Gemini 负载均衡策略
 func (cm *ConfigManager) SetGeminiLoadBalance(strategy string) error {
 	cm.mu.Lock()
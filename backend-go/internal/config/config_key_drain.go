@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+// DefaultKeyDrainGracePeriod 密钥排空默认宽限期
+const DefaultKeyDrainGracePeriod = 5 * time.Minute
+
+// drainSweepInterval 排空密钥到期检查间隔
+const drainSweepInterval = 30 * time.Second
+
+// IsKeyDraining 判断密钥是否处于排空状态（新请求不再使用，到期后自动删除）
+func (u *UpstreamConfig) IsKeyDraining(apiKey string) bool {
+	if u == nil || u.DrainingKeys == nil {
+		return false
+	}
+	_, draining := u.DrainingKeys[apiKey]
+	return draining
+}
+
+// SetKeyDrainGracePeriod 设置密钥排空默认宽限期（<=0 时使用默认值）
+func (cm *ConfigManager) SetKeyDrainGracePeriod(grace time.Duration) {
+	if grace <= 0 {
+		grace = DefaultKeyDrainGracePeriod
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.keyDrainGrace = grace
+}
+
+// GetKeyDrainGracePeriod 获取密钥排空默认宽限期
+func (cm *ConfigManager) GetKeyDrainGracePeriod() time.Duration {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.keyDrainGrace
+}
+
+// DrainAPIKey 将 Messages 渠道的密钥标记为排空（grace<=0 时使用默认宽限期），返回删除时间
+func (cm *ConfigManager) DrainAPIKey(index int, apiKey string, grace time.Duration) (time.Time, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.drainAPIKeyLocked(cm.config.Upstream, "", index, apiKey, grace)
+}
+
+// DrainResponsesAPIKey 将 Responses 渠道的密钥标记为排空（grace<=0 时使用默认宽限期），返回删除时间
+func (cm *ConfigManager) DrainResponsesAPIKey(index int, apiKey string, grace time.Duration) (time.Time, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.drainAPIKeyLocked(cm.config.ResponsesUpstream, "Responses ", index, apiKey, grace)
+}
+
+// DrainGeminiAPIKey 将 Gemini 渠道的密钥标记为排空（grace<=0 时使用默认宽限期），返回删除时间
+func (cm *ConfigManager) DrainGeminiAPIKey(index int, apiKey string, grace time.Duration) (time.Time, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.drainAPIKeyLocked(cm.config.GeminiUpstream, "Gemini ", index, apiKey, grace)
+}
+
+// drainAPIKeyLocked 标记密钥排空并保存配置（调用方需持有写锁）
+// 已在排空中的密钥保持原删除时间不变
+func (cm *ConfigManager) drainAPIKeyLocked(upstreams []UpstreamConfig, kind string, index int, apiKey string, grace time.Duration) (time.Time, error) {
+	if index < 0 || index >= len(upstreams) {
+		return time.Time{}, fmt.Errorf("无效的上游索引: %d", index)
+	}
+
+	upstream := &upstreams[index]
+	apiKey = cm.resolveKeyParamLocked(apiKey)
+	found := false
+	for _, key := range upstream.APIKeys {
+		if key == apiKey {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return time.Time{}, fmt.Errorf("API密钥不存在")
+	}
+
+	if removeAt, draining := upstream.DrainingKeys[apiKey]; draining {
+		return removeAt, nil
+	}
+
+	if grace <= 0 {
+		grace = cm.keyDrainGrace
+	}
+	removeAt := time.Now().Add(grace)
+
+	// 写入新 map，避免修改并发请求持有的旧快照
+	drainingKeys := make(map[string]time.Time, len(upstream.DrainingKeys)+1)
+	for k, v := range upstream.DrainingKeys {
+		drainingKeys[k] = v
+	}
+	drainingKeys[apiKey] = removeAt
+	upstream.DrainingKeys = drainingKeys
+
+	if err := cm.saveConfigLocked(cm.config); err != nil {
+		return time.Time{}, err
+	}
+
+	log.Printf("[Config-KeyDrain] %s上游 [%d] %s 的密钥 %s 开始排空，将于 %s 后删除",
+		kind, index, upstream.Name, utils.MaskAPIKey(apiKey), grace)
+	return removeAt, nil
+}
+
+// RemoveExpiredDrainingKeys 删除已到期的排空密钥，返回删除数量
+// 同时清理已不在密钥列表中的排空记录（如密钥已被手动删除）
+func (cm *ConfigManager) RemoveExpiredDrainingKeys(now time.Time) (int, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	removed := 0
+	changed := false
+	for _, group := range []struct {
+		kind      string
+		upstreams []UpstreamConfig
+	}{
+		{"", cm.config.Upstream},
+		{"Responses ", cm.config.ResponsesUpstream},
+		{"Gemini ", cm.config.GeminiUpstream},
+	} {
+		for i := range group.upstreams {
+			upstream := &group.upstreams[i]
+			if len(upstream.DrainingKeys) == 0 {
+				continue
+			}
+
+			drainingKeys := make(map[string]time.Time, len(upstream.DrainingKeys))
+			keys := make([]string, 0, len(upstream.APIKeys))
+			for _, key := range upstream.APIKeys {
+				removeAt, draining := upstream.DrainingKeys[key]
+				if !draining {
+					keys = append(keys, key)
+					continue
+				}
+				if now.Before(removeAt) {
+					keys = append(keys, key)
+					drainingKeys[key] = removeAt
+					continue
+				}
+				removed++
+				log.Printf("[Config-KeyDrain] 排空宽限期结束，已从%s上游 [%d] %s 删除密钥 %s",
+					group.kind, i, upstream.Name, utils.MaskAPIKey(key))
+			}
+
+			if len(keys) != len(upstream.APIKeys) || len(drainingKeys) != len(upstream.DrainingKeys) {
+				upstream.APIKeys = keys
+				upstream.DrainingKeys = drainingKeys
+				if len(drainingKeys) == 0 {
+					upstream.DrainingKeys = nil
+				}
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return 0, nil
+	}
+	if err := cm.saveConfigLocked(cm.config); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// removeDrainedKeysLoop 定期删除到期的排空密钥
+func (cm *ConfigManager) removeDrainedKeysLoop() {
+	ticker := time.NewTicker(drainSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.stopChan:
+			return
+		case <-ticker.C:
+			if _, err := cm.RemoveExpiredDrainingKeys(time.Now()); err != nil {
+				log.Printf("[Config-KeyDrain] 警告: 删除到期排空密钥失败: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newDrainTestConfigManager(t *testing.T) (*ConfigManager, string) {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	initialConfig := `{
+		"upstream": [{"name": "m", "baseUrl": "https://m.example.com", "apiKeys": ["k1", "k2"], "serviceType": "claude"}],
+		"responsesUpstream": [{"name": "r", "baseUrl": "https://r.example.com", "apiKeys": ["r1", "r2"], "serviceType": "openai"}],
+		"geminiUpstream": [{"name": "g", "baseUrl": "https://g.example.com", "apiKeys": ["g1"], "serviceType": "gemini"}],
+		"loadBalance": "failover"
+	}`
+	if err := os.WriteFile(configPath, []byte(initialConfig), 0644); err != nil {
+		t.Fatalf("写入初始配置失败: %v", err)
+	}
+	cm, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("初始化配置管理器失败: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+	return cm, configPath
+}
+
+func TestDrainAPIKey_SkipsDrainingKeyForNewRequests(t *testing.T) {
+	cm, _ := newDrainTestConfigManager(t)
+
+	removeAt, err := cm.DrainAPIKey(0, "k1", time.Minute)
+	if err != nil {
+		t.Fatalf("DrainAPIKey() err = %v", err)
+	}
+	if d := time.Until(removeAt); d <= 0 || d > time.Minute {
+		t.Fatalf("removeAt = %v, want ~1m from now", removeAt)
+	}
+
+	// 重复排空保持原删除时间
+	again, err := cm.DrainAPIKey(0, "k1", time.Hour)
+	if err != nil || !again.Equal(removeAt) {
+		t.Fatalf("重复排空应保持原删除时间: got %v (err=%v), want %v", again, err, removeAt)
+	}
+
+	upstream := cm.GetConfig().Upstream[0]
+	if !upstream.IsKeyDraining("k1") || upstream.IsKeyDraining("k2") {
+		t.Fatalf("DrainingKeys = %v, want only k1", upstream.DrainingKeys)
+	}
+	// 排空期间密钥仍保留在列表中（指标面板不闪烁）
+	if len(upstream.APIKeys) != 2 {
+		t.Fatalf("排空期间密钥不应被删除: %v", upstream.APIKeys)
+	}
+	for i := 0; i < 4; i++ {
+		key, err := cm.GetNextAPIKey(&upstream, nil)
+		if err != nil {
+			t.Fatalf("GetNextAPIKey() err = %v", err)
+		}
+		if key != "k2" {
+			t.Fatalf("新请求不应使用排空中的密钥: got %s", key)
+		}
+	}
+
+	// 所有密钥都在排空时不再分配
+	if _, err := cm.DrainAPIKey(0, "k2", time.Minute); err != nil {
+		t.Fatalf("DrainAPIKey(k2) err = %v", err)
+	}
+	upstream = cm.GetConfig().Upstream[0]
+	if _, err := cm.GetNextAPIKey(&upstream, nil); err == nil {
+		t.Fatal("所有密钥都在排空时应返回错误")
+	}
+}
+
+func TestDrainAPIKey_Errors(t *testing.T) {
+	cm, _ := newDrainTestConfigManager(t)
+
+	if _, err := cm.DrainAPIKey(5, "k1", 0); err == nil {
+		t.Fatal("无效的上游索引应返回错误")
+	}
+	if _, err := cm.DrainResponsesAPIKey(0, "missing", 0); err == nil {
+		t.Fatal("不存在的密钥应返回错误")
+	}
+}
+
+func TestRemoveExpiredDrainingKeys(t *testing.T) {
+	cm, configPath := newDrainTestConfigManager(t)
+
+	if _, err := cm.DrainAPIKey(0, "k1", time.Minute); err != nil {
+		t.Fatalf("DrainAPIKey() err = %v", err)
+	}
+	if _, err := cm.DrainResponsesAPIKey(0, "r2", 10*time.Minute); err != nil {
+		t.Fatalf("DrainResponsesAPIKey() err = %v", err)
+	}
+	if _, err := cm.DrainGeminiAPIKey(0, "g1", 0); err != nil {
+		t.Fatalf("DrainGeminiAPIKey() err = %v", err)
+	}
+
+	// 宽限期内不删除
+	if removed, err := cm.RemoveExpiredDrainingKeys(time.Now()); err != nil || removed != 0 {
+		t.Fatalf("RemoveExpiredDrainingKeys(now) = %d, %v; want 0", removed, err)
+	}
+
+	// 2 分钟后：k1 到期删除，r2 仍在宽限期内，g1 使用默认宽限期（5 分钟）仍保留
+	removed, err := cm.RemoveExpiredDrainingKeys(time.Now().Add(2 * time.Minute))
+	if err != nil || removed != 1 {
+		t.Fatalf("RemoveExpiredDrainingKeys(+2m) = %d, %v; want 1", removed, err)
+	}
+
+	cfg := cm.GetConfig()
+	if got := cfg.Upstream[0].APIKeys; len(got) != 1 || got[0] != "k2" {
+		t.Fatalf("Upstream keys = %v, want [k2]", got)
+	}
+	if cfg.Upstream[0].DrainingKeys != nil {
+		t.Fatalf("Upstream DrainingKeys = %v, want nil", cfg.Upstream[0].DrainingKeys)
+	}
+	if !cfg.ResponsesUpstream[0].IsKeyDraining("r2") || len(cfg.ResponsesUpstream[0].APIKeys) != 2 {
+		t.Fatalf("Responses upstream = %+v, want r2 still draining", cfg.ResponsesUpstream[0])
+	}
+	if !cfg.GeminiUpstream[0].IsKeyDraining("g1") {
+		t.Fatalf("Gemini upstream = %+v, want g1 still draining", cfg.GeminiUpstream[0])
+	}
+
+	// 排空状态持久化到配置文件，重启后保持
+	cm.Close()
+	reloaded, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("重新加载配置失败: %v", err)
+	}
+	defer reloaded.Close()
+	if !reloaded.GetConfig().ResponsesUpstream[0].IsKeyDraining("r2") {
+		t.Fatal("重启后排空状态应保留")
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+// keyOrderSweepInterval 规范密钥顺序恢复检查间隔
+const keyOrderSweepInterval = time.Minute
+
+// SetKeyOrderResetInterval 设置规范密钥顺序恢复间隔（<=0 表示禁用）
+// 启用后，渠道在该时长内没有配额降级事件时，密钥顺序恢复为 canonicalKeyOrder
+func (cm *ConfigManager) SetKeyOrderResetInterval(interval time.Duration) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.keyOrderResetInterval = max(interval, 0)
+}
+
+// GetKeyOrderResetInterval 获取规范密钥顺序恢复间隔（0 表示禁用）
+func (cm *ConfigManager) GetKeyOrderResetInterval() time.Duration {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.keyOrderResetInterval
+}
+
+// recordDeprioritizationLocked 记录配额降级事件（调用方需持有写锁）
+// 渠道首次降级前自动记录当前密钥顺序作为规范顺序
+func (cm *ConfigManager) recordDeprioritizationLocked(upstream *UpstreamConfig, apiKey string, now time.Time) {
+	if len(upstream.CanonicalKeyOrder) == 0 {
+		upstream.CanonicalKeyOrder = slices.Clone(upstream.APIKeys)
+	}
+	if cm.keyDeprioritizedAt == nil {
+		cm.keyDeprioritizedAt = make(map[string]time.Time)
+	}
+	cm.keyDeprioritizedAt[apiKey] = now
+}
+
+// RestoreCanonicalKeyOrder 将近期无配额降级事件的渠道恢复为规范密钥顺序，返回恢复的渠道数
+// 规范顺序中已删除的密钥被忽略，不在规范顺序中的新密钥按当前顺序排在其后
+func (cm *ConfigManager) RestoreCanonicalKeyOrder(now time.Time) (int, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.keyOrderResetInterval <= 0 {
+		return 0, nil
+	}
+	quietSince := now.Add(-cm.keyOrderResetInterval)
+
+	restored := 0
+	for _, group := range []struct {
+		kind      string
+		upstreams []UpstreamConfig
+	}{
+		{"", cm.config.Upstream},
+		{"Responses ", cm.config.ResponsesUpstream},
+		{"Gemini ", cm.config.GeminiUpstream},
+	} {
+		for i := range group.upstreams {
+			upstream := &group.upstreams[i]
+			if len(upstream.CanonicalKeyOrder) == 0 || cm.recentlyDeprioritizedLocked(upstream, quietSince) {
+				continue
+			}
+
+			keys := canonicalKeyOrder(upstream.APIKeys, upstream.CanonicalKeyOrder)
+			if slices.Equal(keys, upstream.APIKeys) {
+				continue
+			}
+			upstream.APIKeys = keys
+			restored++
+			log.Printf("[Config-KeyOrder] %s上游 [%d] %s 已 %v 无配额降级，密钥顺序恢复为规范顺序 (首个密钥: %s)",
+				group.kind, i, upstream.Name, cm.keyOrderResetInterval, utils.MaskAPIKey(keys[0]))
+		}
+	}
+
+	// 清理已过静默期的降级记录
+	for key, at := range cm.keyDeprioritizedAt {
+		if at.Before(quietSince) {
+			delete(cm.keyDeprioritizedAt, key)
+		}
+	}
+
+	if restored == 0 {
+		return 0, nil
+	}
+	if err := cm.saveConfigLocked(cm.config); err != nil {
+		return 0, err
+	}
+	return restored, nil
+}
+
+// recentlyDeprioritizedLocked 判断渠道内是否有密钥在 quietSince 之后发生配额降级（调用方需持有锁）
+func (cm *ConfigManager) recentlyDeprioritizedLocked(upstream *UpstreamConfig, quietSince time.Time) bool {
+	for _, key := range upstream.APIKeys {
+		if at, ok := cm.keyDeprioritizedAt[key]; ok && at.After(quietSince) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalKeyOrder 按规范顺序排列当前密钥（规范顺序中的密钥在前，其余保持当前相对顺序）
+func canonicalKeyOrder(current, canonical []string) []string {
+	present := make(map[string]bool, len(current))
+	for _, key := range current {
+		present[key] = true
+	}
+
+	ordered := make([]string, 0, len(current))
+	placed := make(map[string]bool, len(current))
+	for _, key := range canonical {
+		if present[key] && !placed[key] {
+			ordered = append(ordered, key)
+			placed[key] = true
+		}
+	}
+	for _, key := range current {
+		if !placed[key] {
+			ordered = append(ordered, key)
+		}
+	}
+	return ordered
+}
+
+// restoreKeyOrderLoop 定期恢复规范密钥顺序
+func (cm *ConfigManager) restoreKeyOrderLoop() {
+	ticker := time.NewTicker(keyOrderSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.stopChan:
+			return
+		case <-ticker.C:
+			if _, err := cm.RestoreCanonicalKeyOrder(time.Now()); err != nil {
+				log.Printf("[Config-KeyOrder] 警告: 恢复规范密钥顺序失败: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newKeyOrderTestConfigManager(t *testing.T) *ConfigManager {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	initialConfig := `{
+		"upstream": [{"name": "m", "baseUrl": "https://m.example.com", "apiKeys": ["k1", "k2", "k3"], "serviceType": "claude", "status": "active"}],
+		"responsesUpstream": [{"name": "r", "baseUrl": "https://r.example.com", "apiKeys": ["r1", "r2"], "serviceType": "openai", "status": "active"}],
+		"loadBalance": "failover"
+	}`
+	if err := os.WriteFile(configPath, []byte(initialConfig), 0644); err != nil {
+		t.Fatalf("写入初始配置失败: %v", err)
+	}
+	cm, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("初始化配置管理器失败: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+	return cm
+}
+
+func TestRestoreCanonicalKeyOrder_AfterQuietInterval(t *testing.T) {
+	cm := newKeyOrderTestConfigManager(t)
+	cm.SetKeyOrderResetInterval(10 * time.Minute)
+
+	if err := cm.DeprioritizeAPIKey("k1"); err != nil {
+		t.Fatalf("DeprioritizeAPIKey() err = %v", err)
+	}
+	if err := cm.DeprioritizeAPIKey("r1"); err != nil {
+		t.Fatalf("DeprioritizeAPIKey() err = %v", err)
+	}
+	upstream := cm.GetConfig().Upstream[0]
+	if !slices.Equal(upstream.APIKeys, []string{"k2", "k3", "k1"}) || !slices.Equal(upstream.CanonicalKeyOrder, []string{"k1", "k2", "k3"}) {
+		t.Fatalf("降级后 APIKeys = %v, CanonicalKeyOrder = %v", upstream.APIKeys, upstream.CanonicalKeyOrder)
+	}
+
+	// 静默期内再次降级时保留首次记录的规范顺序
+	if err := cm.DeprioritizeAPIKey("k2"); err != nil {
+		t.Fatalf("DeprioritizeAPIKey() err = %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0].CanonicalKeyOrder; !slices.Equal(got, []string{"k1", "k2", "k3"}) {
+		t.Fatalf("CanonicalKeyOrder = %v, want [k1 k2 k3]", got)
+	}
+
+	// 静默期未结束，不恢复
+	if n, err := cm.RestoreCanonicalKeyOrder(time.Now().Add(5 * time.Minute)); err != nil || n != 0 {
+		t.Fatalf("静默期内 RestoreCanonicalKeyOrder() = %d, %v, want 0", n, err)
+	}
+	if got := cm.GetConfig().Upstream[0].APIKeys; !slices.Equal(got, []string{"k3", "k1", "k2"}) {
+		t.Fatalf("静默期内 APIKeys = %v, want [k3 k1 k2]", got)
+	}
+
+	// 超过恢复间隔且无新的配额事件，恢复为规范顺序（Messages 与 Responses 渠道均恢复）
+	n, err := cm.RestoreCanonicalKeyOrder(time.Now().Add(11 * time.Minute))
+	if err != nil || n != 2 {
+		t.Fatalf("RestoreCanonicalKeyOrder() = %d, %v, want 2", n, err)
+	}
+	cfg := cm.GetConfig()
+	if !slices.Equal(cfg.Upstream[0].APIKeys, []string{"k1", "k2", "k3"}) {
+		t.Fatalf("恢复后 APIKeys = %v, want [k1 k2 k3]", cfg.Upstream[0].APIKeys)
+	}
+	if !slices.Equal(cfg.ResponsesUpstream[0].APIKeys, []string{"r1", "r2"}) {
+		t.Fatalf("恢复后 Responses APIKeys = %v, want [r1 r2]", cfg.ResponsesUpstream[0].APIKeys)
+	}
+}
+
+func TestRestoreCanonicalKeyOrder_DisabledAndManualReorder(t *testing.T) {
+	cm := newKeyOrderTestConfigManager(t)
+
+	if err := cm.DeprioritizeAPIKey("k1"); err != nil {
+		t.Fatalf("DeprioritizeAPIKey() err = %v", err)
+	}
+	// 未设置恢复间隔时不恢复，降级永久生效
+	if n, err := cm.RestoreCanonicalKeyOrder(time.Now().Add(24 * time.Hour)); err != nil || n != 0 {
+		t.Fatalf("禁用时 RestoreCanonicalKeyOrder() = %d, %v, want 0", n, err)
+	}
+
+	// 手动调整顺序后清除规范顺序，不再被恢复
+	if err := cm.MoveAPIKeyToTop(0, "k3"); err != nil {
+		t.Fatalf("MoveAPIKeyToTop() err = %v", err)
+	}
+	cm.SetKeyOrderResetInterval(time.Minute)
+	if n, err := cm.RestoreCanonicalKeyOrder(time.Now().Add(time.Hour)); err != nil || n != 0 {
+		t.Fatalf("手动调整后 RestoreCanonicalKeyOrder() = %d, %v, want 0", n, err)
+	}
+	upstream := cm.GetConfig().Upstream[0]
+	if !slices.Equal(upstream.APIKeys, []string{"k3", "k2", "k1"}) || upstream.CanonicalKeyOrder != nil {
+		t.Fatalf("APIKeys = %v, CanonicalKeyOrder = %v, want [k3 k2 k1] nil", upstream.APIKeys, upstream.CanonicalKeyOrder)
+	}
+}
+
+func TestCanonicalKeyOrder_HandlesAddedAndRemovedKeys(t *testing.T) {
+	got := canonicalKeyOrder([]string{"k3", "k4", "k1"}, []string{"k1", "k2", "k3"})
+	if want := []string{"k1", "k3", "k4"}; !slices.Equal(got, want) {
+		t.Fatalf("canonicalKeyOrder() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"log"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+// KeyDailyUsage 密钥当日（本地日历日）用量
+type KeyDailyUsage struct {
+	Requests int64 // 请求数（含失败）
+	Tokens   int64 // 输入 + 输出 Token
+}
+
+// KeyUsageSource 密钥用量来源
+type KeyUsageSource interface {
+	// GetKeyDailyUsage 获取指定接口类型（messages/responses/gemini）下渠道密钥的当日用量
+	GetKeyDailyUsage(namespace string, upstream *UpstreamConfig, apiKey string) KeyDailyUsage
+}
+
+// SetKeyUsageSource 设置密钥每日配额的用量来源（需在开始服务前调用）
+func (cm *ConfigManager) SetKeyUsageSource(source KeyUsageSource) {
+	cm.keyUsageSource = source
+}
+
+// HasDailyKeyQuota 渠道是否配置了密钥每日配额
+func (u *UpstreamConfig) HasDailyKeyQuota() bool {
+	return u.DailyRequestLimit > 0 || u.DailyTokenLimit > 0
+}
+
+// IsDailyKeyQuotaExhausted 判断用量是否已达到渠道的密钥每日配额
+func (u *UpstreamConfig) IsDailyKeyQuotaExhausted(usage KeyDailyUsage) bool {
+	return (u.DailyRequestLimit > 0 && usage.Requests >= u.DailyRequestLimit) ||
+		(u.DailyTokenLimit > 0 && usage.Tokens >= u.DailyTokenLimit)
+}
+
+// isKeyQuotaExhausted 密钥是否已用尽当日配额（配额暂停，与熔断独立，本地零点后自动恢复）
+func (cm *ConfigManager) isKeyQuotaExhausted(namespace string, upstream *UpstreamConfig, apiKey string) bool {
+	if cm.keyUsageSource == nil || !upstream.HasDailyKeyQuota() {
+		return false
+	}
+	usage := cm.keyUsageSource.GetKeyDailyUsage(namespace, upstream, apiKey)
+	if !upstream.IsDailyKeyQuotaExhausted(usage) {
+		return false
+	}
+
+	today := time.Now().Format("2006-01-02")
+	notifyKey := namespace + ":" + apiKey
+	cm.keyQuotaMu.Lock()
+	if cm.keyQuotaNotified == nil {
+		cm.keyQuotaNotified = make(map[string]string)
+	}
+	first := cm.keyQuotaNotified[notifyKey] != today
+	cm.keyQuotaNotified[notifyKey] = today
+	cm.keyQuotaMu.Unlock()
+	if first {
+		log.Printf("[Config-KeyQuota] 渠道 %s 的密钥 %s 已达每日配额（请求 %d/%d，Token %d/%d），暂停使用至本地零点",
+			upstream.Name, utils.MaskAPIKey(apiKey), usage.Requests, upstream.DailyRequestLimit, usage.Tokens, upstream.DailyTokenLimit)
+	}
+	return true
+}
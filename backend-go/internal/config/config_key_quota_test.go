@@ -0,0 +1,71 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// fakeKeyUsageSource 测试用密钥用量来源
+type fakeKeyUsageSource map[string]KeyDailyUsage
+
+func (f fakeKeyUsageSource) GetKeyDailyUsage(namespace string, upstream *UpstreamConfig, apiKey string) KeyDailyUsage {
+	return f[apiKey]
+}
+
+func TestGetNextAPIKey_SkipsQuotaExhaustedKeys(t *testing.T) {
+	cm := newTestConfigManager()
+	usage := fakeKeyUsageSource{
+		"k1": {Requests: 100},
+		"k2": {Requests: 5, Tokens: 50000},
+		"k3": {Requests: 5, Tokens: 10},
+	}
+	cm.SetKeyUsageSource(usage)
+	upstream := &UpstreamConfig{
+		Name:              "quota",
+		APIKeys:           []string{"k1", "k2", "k3"},
+		DailyRequestLimit: 100,
+		DailyTokenLimit:   50000,
+	}
+
+	for i := 0; i < 6; i++ {
+		key, err := cm.GetNextAPIKey(upstream, nil)
+		if err != nil {
+			t.Fatalf("GetNextAPIKey 失败: %v", err)
+		}
+		if key != "k3" {
+			t.Fatalf("应跳过配额耗尽的密钥，got %s", key)
+		}
+	}
+
+	// 全部耗尽：不做恢复尝试（即使密钥处于失败冷却中），直接返回错误以便故障转移到其他渠道
+	usage["k3"] = KeyDailyUsage{Requests: 100}
+	cm.MarkKeyAsFailed("k3")
+	if _, err := cm.GetNextAPIKey(upstream, nil); err == nil || !strings.Contains(err.Error(), "暂时不可用") {
+		t.Fatalf("expected all keys unavailable error, got %v", err)
+	}
+
+	// 未配置配额的渠道不受影响
+	unlimited := &UpstreamConfig{Name: "unlimited", APIKeys: []string{"k1"}}
+	if key, err := cm.GetNextAPIKey(unlimited, nil); err != nil || key != "k1" {
+		t.Fatalf("GetNextAPIKey(unlimited) = %q, %v", key, err)
+	}
+}
+
+func TestIsDailyKeyQuotaExhausted(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream UpstreamConfig
+		usage    KeyDailyUsage
+		want     bool
+	}{
+		{"未配置", UpstreamConfig{}, KeyDailyUsage{Requests: 1 << 20, Tokens: 1 << 30}, false},
+		{"请求数未达上限", UpstreamConfig{DailyRequestLimit: 10}, KeyDailyUsage{Requests: 9}, false},
+		{"请求数达到上限", UpstreamConfig{DailyRequestLimit: 10}, KeyDailyUsage{Requests: 10}, true},
+		{"Token 达到上限", UpstreamConfig{DailyRequestLimit: 10, DailyTokenLimit: 100}, KeyDailyUsage{Requests: 1, Tokens: 100}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.upstream.IsDailyKeyQuotaExhausted(tt.usage); got != tt.want {
+			t.Fatalf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// ============== API 密钥引用（env:/file:） ==============
+//
+// apiKeys 中的条目可以是引用而非明文密钥：
+//   - env:OPENAI_KEY_1        读取环境变量
+//   - file:/run/secrets/key1  读取文件内容（去除首尾空白）
+//
+// 引用在加载/热重载/保存配置时解析：内存中的运行时配置使用解析后的密钥（请求、指标、日志脱敏均基于真实值），
+// 写入配置文件（及其备份）和管理 API 展示的始终是引用本身。
+// 解析失败的引用保留原样、不参与密钥选择（视为停用），并记录警告。
+
+const (
+	keyRefEnvPrefix  = "env:"
+	keyRefFilePrefix = "file:"
+)
+
+// IsAPIKeyRef 判断密钥条目是否为 env:/file: 引用
+func IsAPIKeyRef(key string) bool {
+	return strings.HasPrefix(key, keyRefEnvPrefix) || strings.HasPrefix(key, keyRefFilePrefix)
+}
+
+// resolveAPIKeyRef 解析单个密钥引用
+func resolveAPIKeyRef(ref string) (string, error) {
+	var value string
+	switch {
+	case strings.HasPrefix(ref, keyRefEnvPrefix):
+		name := strings.TrimPrefix(ref, keyRefEnvPrefix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("环境变量 %s 未设置", name)
+		}
+		value = v
+	case strings.HasPrefix(ref, keyRefFilePrefix):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, keyRefFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		value = string(data)
+	default:
+		return ref, nil
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("引用内容为空")
+	}
+	return value, nil
+}
+
+// resolveKeyRefsLocked 将配置中的密钥引用替换为解析后的值，并重建 解析值 -> 引用 映射（调用方需持有写锁）
+// 已解析的密钥（不再是引用形式）沿用旧映射，保证后续保存仍写回引用
+func (cm *ConfigManager) resolveKeyRefsLocked(cfg *Config) {
+	refs := make(map[string]string)
+	for _, upstreams := range [][]UpstreamConfig{cfg.Upstream, cfg.ResponsesUpstream, cfg.GeminiUpstream} {
+		for i := range upstreams {
+			cm.resolveUpstreamKeyRefsLocked(&upstreams[i], refs)
+		}
+	}
+	cm.keyRefs = refs
+}
+
+func (cm *ConfigManager) resolveUpstreamKeyRefsLocked(upstream *UpstreamConfig, refs map[string]string) {
+	resolve := func(key string) string {
+		if !IsAPIKeyRef(key) {
+			if ref, ok := cm.keyRefs[key]; ok {
+				refs[key] = ref
+			}
+			return key
+		}
+		value, err := resolveAPIKeyRef(key)
+		if err != nil {
+			log.Printf("[Config-KeyRef] 警告: 渠道 %s 的密钥引用 %s 解析失败，该密钥已停用: %v", upstream.Name, key, err)
+			return key
+		}
+		refs[value] = key
+		return value
+	}
+
+	if len(upstream.APIKeys) > 0 {
+		keys := make([]string, len(upstream.APIKeys))
+		for i, key := range upstream.APIKeys {
+			keys[i] = resolve(key)
+		}
+		upstream.APIKeys = keys
+	}
+	if len(upstream.CanonicalKeyOrder) > 0 {
+		order := make([]string, len(upstream.CanonicalKeyOrder))
+		for i, key := range upstream.CanonicalKeyOrder {
+			order[i] = resolve(key)
+		}
+		upstream.CanonicalKeyOrder = order
+	}
+	if len(upstream.DrainingKeys) > 0 {
+		draining := make(map[string]time.Time, len(upstream.DrainingKeys))
+		for key, removeAt := range upstream.DrainingKeys {
+			draining[resolve(key)] = removeAt
+		}
+		upstream.DrainingKeys = draining
+	}
+}
+
+// persistableConfigLocked 返回用于写入配置文件的副本：已解析的密钥替换回原始引用，
+// 外部来源（keySource）加载的密钥只保留在内存中，不写入文件（调用方需持有锁）
+func (cm *ConfigManager) persistableConfigLocked(cfg Config) Config {
+	if len(cm.keyRefs) == 0 && len(cm.sourceKeys) == 0 {
+		return cfg
+	}
+	toRefs := func(upstreams []UpstreamConfig) []UpstreamConfig {
+		if upstreams == nil {
+			return nil
+		}
+		out := make([]UpstreamConfig, len(upstreams))
+		for i := range upstreams {
+			up := *upstreams[i].Clone()
+			persistable := func(keys []string) []string {
+				if keys == nil {
+					return nil
+				}
+				kept := make([]string, 0, len(keys))
+				for _, key := range keys {
+					if !cm.isSourceKeyLocked(&up, key) {
+						kept = append(kept, key)
+					}
+				}
+				return cm.apiKeyRefsLocked(kept)
+			}
+			up.APIKeys = persistable(up.APIKeys)
+			up.CanonicalKeyOrder = persistable(up.CanonicalKeyOrder)
+			if up.DrainingKeys != nil {
+				draining := make(map[string]time.Time, len(up.DrainingKeys))
+				for key, removeAt := range up.DrainingKeys {
+					if !cm.isSourceKeyLocked(&up, key) {
+						draining[cm.apiKeyRefLocked(key)] = removeAt
+					}
+				}
+				up.DrainingKeys = draining
+			}
+			out[i] = up
+		}
+		return out
+	}
+	cfg.Upstream = toRefs(cfg.Upstream)
+	cfg.ResponsesUpstream = toRefs(cfg.ResponsesUpstream)
+	cfg.GeminiUpstream = toRefs(cfg.GeminiUpstream)
+	return cfg
+}
+
+func (cm *ConfigManager) apiKeyRefLocked(key string) string {
+	if ref, ok := cm.keyRefs[key]; ok {
+		return ref
+	}
+	return key
+}
+
+func (cm *ConfigManager) apiKeyRefsLocked(keys []string) []string {
+	if keys == nil {
+		return nil
+	}
+	out := make([]string, len(keys))
+	for i, key := range keys {
+		out[i] = cm.apiKeyRefLocked(key)
+	}
+	return out
+}
+
+// APIKeyRefs 将运行时密钥列表转换为展示用的形式：来自引用的密钥显示为引用本身，其余原样返回
+// 管理 API 展示渠道密钥时使用，避免引用解析出的明文密钥被返回给前端
+func (cm *ConfigManager) APIKeyRefs(keys []string) []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.apiKeyRefsLocked(keys)
+}
+
+// ResolveAPIKeyRef 将管理 API 传入的密钥引用映射为运行时使用的解析值（非引用或未解析时原样返回）
+func (cm *ConfigManager) ResolveAPIKeyRef(apiKey string) string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.resolveKeyParamLocked(apiKey)
+}
+
+func (cm *ConfigManager) resolveKeyParamLocked(apiKey string) string {
+	if !IsAPIKeyRef(apiKey) {
+		return apiKey
+	}
+	for value, ref := range cm.keyRefs {
+		if ref == apiKey {
+			return value
+		}
+	}
+	return apiKey
+}
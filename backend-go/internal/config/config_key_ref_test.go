@@ -0,0 +1,182 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+func newKeyRefTestConfigManager(t *testing.T, secretFile string) (*ConfigManager, string) {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	initialConfig := `{
+		"upstream": [{"name": "m", "baseUrl": "https://m.example.com", "apiKeys": ["env:TEST_KEYREF_M1", "inline-key", "env:TEST_KEYREF_MISSING"], "serviceType": "claude"}],
+		"responsesUpstream": [{"name": "r", "baseUrl": "https://r.example.com", "apiKeys": ["file:` + secretFile + `"], "serviceType": "openai"}],
+		"loadBalance": "failover"
+	}`
+	if err := os.WriteFile(configPath, []byte(initialConfig), 0644); err != nil {
+		t.Fatalf("写入初始配置失败: %v", err)
+	}
+	cm, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("初始化配置管理器失败: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+	return cm, configPath
+}
+
+func writeSecretFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key1")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("写入密钥文件失败: %v", err)
+	}
+	return path
+}
+
+func readPersistedConfig(t *testing.T, configPath string) Config {
+	t.Helper()
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("读取配置文件失败: %v", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("解析配置文件失败: %v", err)
+	}
+	return cfg
+}
+
+func TestKeyRefs_ResolvedAtLoad(t *testing.T) {
+	t.Setenv("TEST_KEYREF_M1", "sk-env-secret-1234567890")
+	secretFile := writeSecretFile(t, "sk-file-secret-0987654321\n")
+	cm, _ := newKeyRefTestConfigManager(t, secretFile)
+
+	cfg := cm.GetConfig()
+	wantMessages := []string{"sk-env-secret-1234567890", "inline-key", "env:TEST_KEYREF_MISSING"}
+	if !slices.Equal(cfg.Upstream[0].APIKeys, wantMessages) {
+		t.Fatalf("Messages APIKeys = %v, want %v", cfg.Upstream[0].APIKeys, wantMessages)
+	}
+	if got := cfg.ResponsesUpstream[0].APIKeys; !slices.Equal(got, []string{"sk-file-secret-0987654321"}) {
+		t.Fatalf("Responses APIKeys = %v, want 文件内容（去除换行）", got)
+	}
+
+	// 管理 API 展示引用而非明文
+	display := cm.APIKeyRefs(cfg.Upstream[0].APIKeys)
+	if !slices.Equal(display, []string{"env:TEST_KEYREF_M1", "inline-key", "env:TEST_KEYREF_MISSING"}) {
+		t.Fatalf("APIKeyRefs() = %v", display)
+	}
+	if got := cm.ResolveAPIKeyRef("env:TEST_KEYREF_M1"); got != "sk-env-secret-1234567890" {
+		t.Fatalf("ResolveAPIKeyRef() = %q", got)
+	}
+
+	// 脱敏基于解析后的值
+	if masked := utils.MaskAPIKey(cfg.Upstream[0].APIKeys[0]); strings.Contains(masked, "env:") {
+		t.Fatalf("MaskAPIKey 应对解析后的密钥脱敏, got %q", masked)
+	}
+}
+
+func TestKeyRefs_UnresolvedKeyIsInactive(t *testing.T) {
+	t.Setenv("TEST_KEYREF_M1", "sk-env-secret-1234567890")
+	cm, _ := newKeyRefTestConfigManager(t, filepath.Join(t.TempDir(), "missing"))
+
+	cfg := cm.GetConfig()
+	upstream := cfg.Upstream[0]
+	for i := 0; i < 6; i++ {
+		key, err := cm.GetNextAPIKey(&upstream, nil)
+		if err != nil {
+			t.Fatalf("GetNextAPIKey() err = %v", err)
+		}
+		if IsAPIKeyRef(key) {
+			t.Fatalf("未解析的引用不应被选中: %q", key)
+		}
+	}
+
+	// 渠道内全部引用均未解析：无可用密钥，但加载不报错
+	responses := cfg.ResponsesUpstream[0]
+	if _, err := cm.GetNextResponsesAPIKey(&responses, nil); err == nil {
+		t.Fatalf("全部引用未解析时应返回错误")
+	}
+}
+
+func TestKeyRefs_PersistReferencesNotSecrets(t *testing.T) {
+	t.Setenv("TEST_KEYREF_M1", "sk-env-secret-1234567890")
+	t.Setenv("TEST_KEYREF_M2", "sk-env-secret-added")
+	secretFile := writeSecretFile(t, "sk-file-secret-0987654321")
+	cm, configPath := newKeyRefTestConfigManager(t, secretFile)
+
+	// 通过引用添加、排空、调整顺序
+	if err := cm.AddAPIKey(0, "env:TEST_KEYREF_M2"); err != nil {
+		t.Fatalf("AddAPIKey() err = %v", err)
+	}
+	if err := cm.AddAPIKey(0, "env:TEST_KEYREF_M2"); err == nil {
+		t.Fatalf("重复添加同一引用应报错")
+	}
+	if err := cm.MoveAPIKeyToBottom(0, "env:TEST_KEYREF_M1"); err != nil {
+		t.Fatalf("MoveAPIKeyToBottom() err = %v", err)
+	}
+	if _, err := cm.DrainResponsesAPIKey(0, "file:"+secretFile, time.Hour); err != nil {
+		t.Fatalf("DrainResponsesAPIKey() err = %v", err)
+	}
+
+	cfg := cm.GetConfig()
+	wantRuntime := []string{"inline-key", "env:TEST_KEYREF_MISSING", "sk-env-secret-added", "sk-env-secret-1234567890"}
+	if !slices.Equal(cfg.Upstream[0].APIKeys, wantRuntime) {
+		t.Fatalf("runtime APIKeys = %v, want %v", cfg.Upstream[0].APIKeys, wantRuntime)
+	}
+	if !cfg.ResponsesUpstream[0].IsKeyDraining("sk-file-secret-0987654321") {
+		t.Fatalf("排空应作用于解析后的密钥: %v", cfg.ResponsesUpstream[0].DrainingKeys)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("读取配置文件失败: %v", err)
+	}
+	if strings.Contains(string(data), "sk-env-secret") || strings.Contains(string(data), "sk-file-secret") {
+		t.Fatalf("配置文件不应包含明文密钥:\n%s", data)
+	}
+	persisted := readPersistedConfig(t, configPath)
+	wantPersisted := []string{"inline-key", "env:TEST_KEYREF_MISSING", "env:TEST_KEYREF_M2", "env:TEST_KEYREF_M1"}
+	if !slices.Equal(persisted.Upstream[0].APIKeys, wantPersisted) {
+		t.Fatalf("persisted APIKeys = %v, want %v", persisted.Upstream[0].APIKeys, wantPersisted)
+	}
+	if _, ok := persisted.ResponsesUpstream[0].DrainingKeys["file:"+secretFile]; !ok {
+		t.Fatalf("persisted DrainingKeys = %v, want 引用作为键", persisted.ResponsesUpstream[0].DrainingKeys)
+	}
+
+	// 通过引用删除
+	if err := cm.RemoveAPIKey(0, "env:TEST_KEYREF_M2"); err != nil {
+		t.Fatalf("RemoveAPIKey() err = %v", err)
+	}
+	if slices.Contains(cm.GetConfig().Upstream[0].APIKeys, "sk-env-secret-added") {
+		t.Fatalf("通过引用删除后解析值仍在列表中")
+	}
+}
+
+func TestKeyRefs_ReResolvedOnReload(t *testing.T) {
+	t.Setenv("TEST_KEYREF_M1", "sk-env-secret-1234567890")
+	secretFile := writeSecretFile(t, "sk-file-secret-old")
+	cm, _ := newKeyRefTestConfigManager(t, secretFile)
+
+	if err := os.WriteFile(secretFile, []byte("sk-file-secret-rotated"), 0600); err != nil {
+		t.Fatalf("更新密钥文件失败: %v", err)
+	}
+	t.Setenv("TEST_KEYREF_MISSING", "sk-env-now-present")
+	if err := cm.loadConfig(); err != nil {
+		t.Fatalf("loadConfig() err = %v", err)
+	}
+
+	cfg := cm.GetConfig()
+	if got := cfg.ResponsesUpstream[0].APIKeys; !slices.Equal(got, []string{"sk-file-secret-rotated"}) {
+		t.Fatalf("重载后 Responses APIKeys = %v", got)
+	}
+	if got := cfg.Upstream[0].APIKeys[2]; got != "sk-env-now-present" {
+		t.Fatalf("重载后此前缺失的引用应被解析, got %q", got)
+	}
+}
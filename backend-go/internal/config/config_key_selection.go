@@ -0,0 +1,97 @@
+package config
+
+import (
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+// KeySelectionAdaptive 渠道内密钥自适应选择：按近期成功率与延迟加权随机
+const KeySelectionAdaptive = "adaptive"
+
+// minAdaptiveSuccessRate 成功率权重下限，保证近期失败较多（但未熔断）的密钥仍有少量流量用于恢复
+const minAdaptiveSuccessRate = 0.05
+
+// KeyStats 密钥近期表现（由调度器基于 KeyMetrics 提供）
+type KeyStats struct {
+	Suspended   bool          // 所有 BaseURL 上均处于熔断（Open）状态
+	SuccessRate float64       // 滑动窗口成功率（0~1，无数据时为 1）
+	AvgLatency  time.Duration // 平均响应延迟（0 表示无数据）
+}
+
+// KeyStatsSource 密钥指标来源
+type KeyStatsSource interface {
+	// GetKeyStats 获取指定接口类型（messages/responses/gemini）下渠道密钥的近期表现
+	GetKeyStats(namespace string, upstream *UpstreamConfig, apiKey string) KeyStats
+}
+
+// SetKeyStatsSource 设置 adaptive 密钥选择的指标来源（需在开始服务前调用）
+func (cm *ConfigManager) SetKeyStatsSource(source KeyStatsSource) {
+	cm.keyStatsSource = source
+}
+
+// selectAdaptiveKey 在可用密钥中按权重随机选择：权重 = 成功率 × (最低延迟 / 密钥延迟)
+// 熔断中的密钥不参与选择；尚无延迟数据的密钥按最低延迟对待，以便积累数据
+func (cm *ConfigManager) selectAdaptiveKey(namespace string, upstream *UpstreamConfig, usable []bool) (string, bool) {
+	if cm.keyStatsSource == nil {
+		return "", false
+	}
+
+	keys := upstream.APIKeys
+	stats := make([]KeyStats, len(keys))
+	var minLatency time.Duration
+	candidates := 0
+	for i, key := range keys {
+		if !usable[i] {
+			continue
+		}
+		stats[i] = cm.keyStatsSource.GetKeyStats(namespace, upstream, key)
+		if stats[i].Suspended {
+			continue
+		}
+		candidates++
+		if l := stats[i].AvgLatency; l > 0 && (minLatency == 0 || l < minLatency) {
+			minLatency = l
+		}
+	}
+	if candidates == 0 {
+		return "", false
+	}
+
+	weights := make([]float64, len(keys))
+	var total float64
+	for i := range keys {
+		if !usable[i] || stats[i].Suspended {
+			continue
+		}
+		weights[i] = adaptiveKeyWeight(stats[i], minLatency)
+		total += weights[i]
+	}
+
+	r := rand.Float64() * total
+	selected := -1
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		selected = i
+		if r < w {
+			break
+		}
+		r -= w
+	}
+
+	log.Printf("[Config-Key] 自适应选择密钥 %s (%d/%d, 权重 %.2f/%.2f)", utils.MaskAPIKey(keys[selected]), selected+1, len(keys), weights[selected], total)
+	return keys[selected], true
+}
+
+// adaptiveKeyWeight 计算单个密钥的选择权重
+func adaptiveKeyWeight(stats KeyStats, minLatency time.Duration) float64 {
+	weight := max(stats.SuccessRate, minAdaptiveSuccessRate)
+	if stats.AvgLatency > 0 && minLatency > 0 {
+		weight *= float64(minLatency) / float64(stats.AvgLatency)
+	}
+	return weight
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeKeyStatsSource 测试用密钥指标来源
+type fakeKeyStatsSource map[string]KeyStats
+
+func (f fakeKeyStatsSource) GetKeyStats(namespace string, upstream *UpstreamConfig, apiKey string) KeyStats {
+	if s, ok := f[apiKey]; ok {
+		return s
+	}
+	return KeyStats{SuccessRate: 1}
+}
+
+func countAdaptivePicks(t *testing.T, cm *ConfigManager, upstream *UpstreamConfig, failedKeys map[string]bool, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		key, err := cm.GetNextResponsesAPIKey(upstream, failedKeys)
+		if err != nil {
+			t.Fatalf("GetNextResponsesAPIKey 失败: %v", err)
+		}
+		counts[key]++
+	}
+	return counts
+}
+
+func TestGetNextAPIKey_AdaptiveWeightsBySuccessAndLatency(t *testing.T) {
+	cm := newTestConfigManager()
+	cm.SetKeyStatsSource(fakeKeyStatsSource{
+		"fast":   {SuccessRate: 1, AvgLatency: 200 * time.Millisecond},
+		"slow":   {SuccessRate: 1, AvgLatency: 2 * time.Second},
+		"flaky":  {SuccessRate: 0.1, AvgLatency: 200 * time.Millisecond},
+		"broken": {Suspended: true, SuccessRate: 1, AvgLatency: 100 * time.Millisecond},
+	})
+	upstream := &UpstreamConfig{
+		Name:         "adaptive",
+		APIKeys:      []string{"slow", "flaky", "broken", "fast"},
+		KeySelection: KeySelectionAdaptive,
+	}
+
+	counts := countAdaptivePicks(t, cm, upstream, nil, 2000)
+	if counts["broken"] != 0 {
+		t.Fatalf("熔断中的密钥不应被选择: %v", counts)
+	}
+	// 期望权重 fast:slow:flaky = 1:0.1:0.1
+	if counts["fast"] < 1400 || counts["slow"] == 0 || counts["flaky"] == 0 {
+		t.Fatalf("选择分布不符合权重: %v", counts)
+	}
+
+	// 单次请求内已失败的密钥不再被选择
+	counts = countAdaptivePicks(t, cm, upstream, map[string]bool{"fast": true}, 200)
+	if counts["fast"] != 0 || counts["broken"] != 0 {
+		t.Fatalf("应跳过 failedKeys 与熔断密钥: %v", counts)
+	}
+}
+
+func TestGetNextAPIKey_AdaptiveFallsBackToRoundRobin(t *testing.T) {
+	cm := newTestConfigManager()
+	upstream := &UpstreamConfig{
+		Name:         "adaptive",
+		APIKeys:      []string{"k1", "k2"},
+		KeySelection: KeySelectionAdaptive,
+	}
+
+	// 未设置指标来源时按轮询选择
+	got1, _ := cm.GetNextResponsesAPIKey(upstream, nil)
+	got2, _ := cm.GetNextResponsesAPIKey(upstream, nil)
+	if got1 != "k1" || got2 != "k2" {
+		t.Fatalf("无指标来源时应轮询: got=[%s %s]", got1, got2)
+	}
+
+	// 所有可用密钥均熔断时回退轮询，由处理器的熔断检查/强制探测处理
+	cm.SetKeyStatsSource(fakeKeyStatsSource{"k1": {Suspended: true}, "k2": {Suspended: true}})
+	if got, err := cm.GetNextResponsesAPIKey(upstream, nil); err != nil || got != "k1" {
+		t.Fatalf("全部熔断时应回退轮询: got=%s err=%v", got, err)
+	}
+
+	// 默认模式不受指标影响
+	cm.SetKeyStatsSource(fakeKeyStatsSource{"k1": {Suspended: true}})
+	upstream.KeySelection = ""
+	if got, _ := cm.GetNextResponsesAPIKey(upstream, nil); got != "k2" {
+		t.Fatalf("默认模式应保持轮询: got=%s, want=k2", got)
+	}
+}
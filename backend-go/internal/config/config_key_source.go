@@ -0,0 +1,397 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 外部密钥来源类型
+const (
+	KeySourceEnv  = "env"  // 环境变量（逗号或换行分隔）
+	KeySourceFile = "file" // 文件（每行一个，# 开头为注释，也支持逗号分隔）
+	KeySourceURL  = "url"  // HTTP GET（JSON 字符串数组、{"keys": [...]} 或纯文本）
+)
+
+const (
+	// DefaultKeySourceRefreshInterval 外部密钥来源默认刷新间隔
+	DefaultKeySourceRefreshInterval = 5 * time.Minute
+	// minKeySourceRefreshInterval 外部密钥来源最小刷新间隔
+	minKeySourceRefreshInterval = 30 * time.Second
+	// keySourceSweepInterval 外部密钥来源到期检查间隔
+	keySourceSweepInterval = 30 * time.Second
+	// keySourceFetchTimeout URL 来源拉取超时
+	keySourceFetchTimeout = 10 * time.Second
+	// maxKeySourceBodySize URL/文件来源内容大小上限
+	maxKeySourceBodySize = 1 << 20
+)
+
+// 外部密钥同步循环的时钟与触发源（便于测试替换，返回的停止函数在循环退出时调用）
+var (
+	keySourceNow    = time.Now
+	keySourceTicker = func(d time.Duration) (<-chan time.Time, func()) {
+		ticker := time.NewTicker(d)
+		return ticker.C, ticker.Stop
+	}
+)
+
+// KeySource 渠道密钥的外部来源：配置后渠道 apiKeys 由该来源定期同步（热更新），无需在管理界面手动维护
+type KeySource struct {
+	Type            string `json:"type"`                      // env | file | url
+	Source          string `json:"source"`                    // 环境变量名 / 文件路径 / URL
+	RefreshInterval int    `json:"refreshInterval,omitempty"` // 刷新间隔（秒，默认 300，最小 30）
+}
+
+// Validate 校验来源配置
+func (s *KeySource) Validate() error {
+	switch s.Type {
+	case KeySourceEnv, KeySourceFile, KeySourceURL:
+	default:
+		return fmt.Errorf("不支持的密钥来源类型: %q（可选 env、file、url）", s.Type)
+	}
+	if strings.TrimSpace(s.Source) == "" {
+		return fmt.Errorf("密钥来源 source 不能为空")
+	}
+	if s.Type == KeySourceURL && !strings.HasPrefix(s.Source, "http://") && !strings.HasPrefix(s.Source, "https://") {
+		return fmt.Errorf("密钥来源 URL 必须以 http:// 或 https:// 开头")
+	}
+	return nil
+}
+
+// Interval 返回有效刷新间隔
+func (s *KeySource) Interval() time.Duration {
+	if s.RefreshInterval <= 0 {
+		return DefaultKeySourceRefreshInterval
+	}
+	return max(time.Duration(s.RefreshInterval)*time.Second, minKeySourceRefreshInterval)
+}
+
+// normalizeKeySource 规范化渠道更新中的密钥来源（type 为空表示清除）
+func normalizeKeySource(source *KeySource) (*KeySource, error) {
+	if source == nil || strings.TrimSpace(source.Type) == "" {
+		return nil, nil
+	}
+	normalized := &KeySource{
+		Type:            strings.ToLower(strings.TrimSpace(source.Type)),
+		Source:          strings.TrimSpace(source.Source),
+		RefreshInterval: max(source.RefreshInterval, 0),
+	}
+	if err := normalized.Validate(); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// LoadKeys 从来源读取密钥（去重，保持来源中的顺序）
+func (s *KeySource) LoadKeys(ctx context.Context) ([]string, error) {
+	var content []byte
+	switch s.Type {
+	case KeySourceEnv:
+		value, ok := os.LookupEnv(s.Source)
+		if !ok {
+			return nil, fmt.Errorf("环境变量 %s 未设置", s.Source)
+		}
+		content = []byte(value)
+	case KeySourceFile:
+		f, err := os.Open(s.Source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if content, err = io.ReadAll(io.LimitReader(f, maxKeySourceBodySize)); err != nil {
+			return nil, err
+		}
+	case KeySourceURL:
+		var err error
+		if content, err = fetchKeySource(ctx, s.Source); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的密钥来源类型: %q", s.Type)
+	}
+	return parseKeySourceContent(content), nil
+}
+
+// fetchKeySource 通过 HTTP GET 拉取密钥列表
+func fetchKeySource(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, keySourceFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxKeySourceBodySize))
+}
+
+// parseKeySourceContent 解析密钥列表：JSON 字符串数组、{"keys": [...]}，或按换行/逗号分隔的纯文本（# 开头的行为注释）
+func parseKeySourceContent(content []byte) []string {
+	trimmed := strings.TrimSpace(string(content))
+
+	var keys []string
+	var wrapped struct {
+		Keys []string `json:"keys"`
+	}
+	switch {
+	case strings.HasPrefix(trimmed, "[") && json.Unmarshal([]byte(trimmed), &keys) == nil:
+	case strings.HasPrefix(trimmed, "{") && json.Unmarshal([]byte(trimmed), &wrapped) == nil:
+		keys = wrapped.Keys
+	default:
+		for _, line := range strings.Split(trimmed, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			keys = append(keys, strings.Split(line, ",")...)
+		}
+	}
+
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			result = append(result, key)
+		}
+	}
+	return deduplicateStrings(result)
+}
+
+// mergeSourceKeys 以来源密钥为准更新渠道密钥：保留现有密钥的当前顺序（不打乱轮询/降级顺序），新密钥追加在末尾
+func mergeSourceKeys(current, loaded []string) []string {
+	present := make(map[string]bool, len(loaded))
+	for _, key := range loaded {
+		present[key] = true
+	}
+	merged := make([]string, 0, len(loaded))
+	kept := make(map[string]bool, len(current))
+	for _, key := range current {
+		if present[key] && !kept[key] {
+			merged = append(merged, key)
+			kept[key] = true
+		}
+	}
+	for _, key := range loaded {
+		if !kept[key] {
+			merged = append(merged, key)
+		}
+	}
+	return merged
+}
+
+// keySourceTarget 待刷新的渠道快照（拉取期间不持有锁）
+type keySourceTarget struct {
+	kind   string
+	group  func(*Config) []UpstreamConfig
+	index  int
+	name   string
+	source KeySource
+}
+
+// RefreshKeySources 从外部来源同步渠道密钥，返回密钥发生变化的渠道数
+// force 为 false 时仅刷新已到刷新间隔的渠道；来源读取失败或为空时保留现有密钥
+func (cm *ConfigManager) RefreshKeySources(ctx context.Context, now time.Time, force bool) (int, error) {
+	groups := []struct {
+		kind  string
+		group func(*Config) []UpstreamConfig
+	}{
+		{"", func(c *Config) []UpstreamConfig { return c.Upstream }},
+		{"Responses ", func(c *Config) []UpstreamConfig { return c.ResponsesUpstream }},
+		{"Gemini ", func(c *Config) []UpstreamConfig { return c.GeminiUpstream }},
+	}
+
+	cm.mu.RLock()
+	var targets []keySourceTarget
+	for _, g := range groups {
+		for i, upstream := range g.group(&cm.config) {
+			if upstream.KeySource == nil {
+				continue
+			}
+			id := keySourceID(g.kind, upstream.Name, upstream.KeySource)
+			if !force && now.Sub(cm.keySourceRefreshedAt[id]) < upstream.KeySource.Interval() {
+				continue
+			}
+			targets = append(targets, keySourceTarget{kind: g.kind, group: g.group, index: i, name: upstream.Name, source: *upstream.KeySource})
+		}
+	}
+	cm.mu.RUnlock()
+
+	if len(targets) == 0 {
+		return 0, nil
+	}
+
+	loaded := make([][]string, len(targets))
+	for i, t := range targets {
+		keys, err := t.source.LoadKeys(ctx)
+		if err != nil {
+			log.Printf("[Config-KeySource] 警告: %s渠道 [%d] %s 从 %s 来源加载密钥失败，保留现有密钥: %v", t.kind, t.index, t.name, t.source.Type, err)
+			continue
+		}
+		if len(keys) == 0 {
+			log.Printf("[Config-KeySource] 警告: %s渠道 [%d] %s 的 %s 来源未返回任何密钥，保留现有密钥", t.kind, t.index, t.name, t.source.Type)
+			continue
+		}
+		loaded[i] = keys
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.keySourceRefreshedAt == nil {
+		cm.keySourceRefreshedAt = make(map[string]time.Time)
+	}
+	if cm.sourceKeys == nil {
+		cm.sourceKeys = make(map[string][]string)
+	}
+	updated := 0
+	for i, t := range targets {
+		cm.keySourceRefreshedAt[keySourceID(t.kind, t.name, &t.source)] = now
+		if loaded[i] == nil {
+			continue
+		}
+		// 拉取期间渠道可能被删除或修改，仅在渠道与来源均未变化时应用
+		upstreams := t.group(&cm.config)
+		if t.index >= len(upstreams) {
+			continue
+		}
+		upstream := &upstreams[t.index]
+		if upstream.Name != t.name || upstream.KeySource == nil || *upstream.KeySource != t.source {
+			continue
+		}
+
+		cm.sourceKeys[sourceKeyID(&t.source)] = loaded[i]
+		keys := mergeSourceKeys(upstream.APIKeys, loaded[i])
+		if slices.Equal(keys, upstream.APIKeys) {
+			continue
+		}
+		added, removed := diffKeyCounts(upstream.APIKeys, keys)
+		upstream.APIKeys = keys
+		updated++
+		log.Printf("[Config-KeySource] %s渠道 [%d] %s 已从 %s 来源同步密钥: 新增 %d，移除 %d，共 %d 个",
+			t.kind, t.index, t.name, t.source.Type, added, removed, len(keys))
+	}
+
+	// 来源密钥只保存在内存中，不写回配置文件（避免明文落盘，也不会触发文件监听重载）
+	return updated, nil
+}
+
+// sourceKeyID 外部密钥来源的标识（与渠道名无关，渠道改名后仍能识别来源密钥）
+func sourceKeyID(source *KeySource) string {
+	return source.Type + "|" + source.Source
+}
+
+// isSourceKeyLocked 判断密钥是否由渠道的外部来源加载（调用方需持有锁）
+func (cm *ConfigManager) isSourceKeyLocked(upstream *UpstreamConfig, key string) bool {
+	if upstream.KeySource == nil {
+		return false
+	}
+	return slices.Contains(cm.sourceKeys[sourceKeyID(upstream.KeySource)], key)
+}
+
+// restoreSourceKeysLocked 重载配置时恢复内存中的来源密钥（配置文件中不含这些密钥，调用方需持有写锁）
+func (cm *ConfigManager) restoreSourceKeysLocked(cfg *Config) {
+	if len(cm.sourceKeys) == 0 {
+		return
+	}
+	for _, upstreams := range [][]UpstreamConfig{cfg.Upstream, cfg.ResponsesUpstream, cfg.GeminiUpstream} {
+		for i := range upstreams {
+			upstream := &upstreams[i]
+			if upstream.KeySource == nil {
+				continue
+			}
+			if keys := cm.sourceKeys[sourceKeyID(upstream.KeySource)]; len(keys) > 0 {
+				upstream.APIKeys = mergeSourceKeys(upstream.APIKeys, keys)
+			}
+		}
+	}
+}
+
+// keySourceID 渠道密钥来源的刷新时间记录键
+func keySourceID(kind, name string, source *KeySource) string {
+	return kind + "|" + name + "|" + source.Type + "|" + source.Source
+}
+
+// diffKeyCounts 统计新增与移除的密钥数
+func diffKeyCounts(before, after []string) (added, removed int) {
+	for _, key := range after {
+		if !slices.Contains(before, key) {
+			added++
+		}
+	}
+	for _, key := range before {
+		if !slices.Contains(after, key) {
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// startKeySourceLoopLocked 存在配置了 keySource 的渠道时启动外部密钥同步循环（调用方需持有写锁）
+// 循环只启动一次，由 Close 停止；未配置 keySource 时不启动，避免无谓的后台刷新
+func (cm *ConfigManager) startKeySourceLoopLocked() {
+	if cm.keySourceLoopStarted || cm.stopChan == nil || !hasKeySource(&cm.config) {
+		return
+	}
+	cm.keySourceLoopStarted = true
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		cm.refreshKeySourcesLoop()
+	}()
+}
+
+// hasKeySource 判断配置中是否有渠道配置了外部密钥来源
+func hasKeySource(cfg *Config) bool {
+	for _, group := range [][]UpstreamConfig{cfg.Upstream, cfg.ResponsesUpstream, cfg.GeminiUpstream} {
+		for _, upstream := range group {
+			if upstream.KeySource != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// refreshKeySourcesLoop 定期从外部来源同步渠道密钥（启动时立即同步一次）
+func (cm *ConfigManager) refreshKeySourcesLoop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-cm.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	refresh := func() {
+		if _, err := cm.RefreshKeySources(ctx, keySourceNow(), false); err != nil {
+			log.Printf("[Config-KeySource] 警告: 同步外部密钥失败: %v", err)
+		}
+	}
+	refresh()
+
+	tick, stop := keySourceTicker(keySourceSweepInterval)
+	defer stop()
+	for {
+		select {
+		case <-cm.stopChan:
+			return
+		case <-tick:
+			refresh()
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newKeySourceTestConfigManager(t *testing.T) *ConfigManager {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	initialConfig := `{
+		"upstream": [{"name": "m", "baseUrl": "https://m.example.com", "apiKeys": ["manual"], "serviceType": "claude", "status": "active"}],
+		"loadBalance": "failover"
+	}`
+	if err := os.WriteFile(configPath, []byte(initialConfig), 0644); err != nil {
+		t.Fatalf("写入初始配置失败: %v", err)
+	}
+	cm, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("初始化配置管理器失败: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+	return cm
+}
+
+func TestParseKeySourceContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "lines with comments", content: "# pool A\nk1\n\nk2\n  k3  \n", want: []string{"k1", "k2", "k3"}},
+		{name: "comma separated", content: "k1, k2,k1,,k3", want: []string{"k1", "k2", "k3"}},
+		{name: "json array", content: `["k1","k2"," "]`, want: []string{"k1", "k2"}},
+		{name: "json object", content: `{"keys":["k1","k2"]}`, want: []string{"k1", "k2"}},
+		{name: "empty", content: "  \n# only comment\n", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseKeySourceContent([]byte(tt.content)); !slices.Equal(got, tt.want) {
+				t.Fatalf("parseKeySourceContent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeSourceKeys_PreservesCurrentOrder(t *testing.T) {
+	got := mergeSourceKeys([]string{"k3", "k1", "gone"}, []string{"k1", "k2", "k3"})
+	if want := []string{"k3", "k1", "k2"}; !slices.Equal(got, want) {
+		t.Fatalf("mergeSourceKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestRefreshKeySources_EnvHotReload(t *testing.T) {
+	t.Setenv("TEST_POOL_KEYS", "e1,e2")
+	cm := newKeySourceTestConfigManager(t)
+
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{KeySource: &KeySource{Type: "ENV", Source: "TEST_POOL_KEYS", RefreshInterval: 60}}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	now := time.Now()
+	if _, err := cm.RefreshKeySources(context.Background(), now, true); err != nil {
+		t.Fatalf("RefreshKeySources() err = %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0].APIKeys; !slices.Equal(got, []string{"e1", "e2"}) {
+		t.Fatalf("keys after load = %v, want [e1 e2]", got)
+	}
+
+	// 来源变化但未到刷新间隔：不更新
+	t.Setenv("TEST_POOL_KEYS", "e2\ne3")
+	if n, err := cm.RefreshKeySources(context.Background(), now.Add(10*time.Second), false); err != nil || n != 0 {
+		t.Fatalf("RefreshKeySources() before interval = %d, %v; want 0", n, err)
+	}
+
+	// 到达刷新间隔后热更新：移除 e1，追加 e3
+	if n, err := cm.RefreshKeySources(context.Background(), now.Add(2*time.Minute), false); err != nil || n != 1 {
+		t.Fatalf("RefreshKeySources() after interval = %d, %v; want 1", n, err)
+	}
+	if got := cm.GetConfig().Upstream[0].APIKeys; !slices.Equal(got, []string{"e2", "e3"}) {
+		t.Fatalf("keys after refresh = %v, want [e2 e3]", got)
+	}
+
+	// 来源为空：保留现有密钥
+	t.Setenv("TEST_POOL_KEYS", "")
+	if n, _ := cm.RefreshKeySources(context.Background(), now.Add(10*time.Minute), true); n != 0 {
+		t.Fatalf("empty source should not update keys, got %d", n)
+	}
+	if got := cm.GetConfig().Upstream[0].APIKeys; !slices.Equal(got, []string{"e2", "e3"}) {
+		t.Fatalf("keys after empty source = %v, want [e2 e3]", got)
+	}
+}
+
+func TestRefreshKeySources_KeysNotPersisted(t *testing.T) {
+	t.Setenv("TEST_SECRET_POOL", "secret-1,secret-2")
+	cm := newKeySourceTestConfigManager(t)
+	// 停止文件监听，避免保存触发的重载与显式 Reload 交错
+	cm.watcher.Remove(cm.configFile)
+
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{KeySource: &KeySource{Type: "env", Source: "TEST_SECRET_POOL"}}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	before, err := os.ReadFile(cm.configFile)
+	if err != nil {
+		t.Fatalf("读取配置文件失败: %v", err)
+	}
+	if n, err := cm.RefreshKeySources(context.Background(), time.Now(), true); err != nil || n != 1 {
+		t.Fatalf("RefreshKeySources() = %d, %v; want 1", n, err)
+	}
+
+	// 刷新只更新内存，不重写配置文件
+	after, err := os.ReadFile(cm.configFile)
+	if err != nil {
+		t.Fatalf("读取配置文件失败: %v", err)
+	}
+	if string(after) != string(before) {
+		t.Fatalf("RefreshKeySources() should not rewrite config file")
+	}
+
+	// 其他修改触发保存时，来源密钥同样不落盘（含备份），keySource 本身保留
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{Description: strPtr("pool")}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	files := []string{cm.configFile}
+	backups, _ := filepath.Glob(filepath.Join(filepath.Dir(cm.configFile), "backups", "*"))
+	for _, path := range append(files, backups...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", path, err)
+		}
+		if strings.Contains(string(data), "secret-1") || strings.Contains(string(data), "secret-2") {
+			t.Fatalf("%s contains source keys:\n%s", path, data)
+		}
+	}
+	if data, _ := os.ReadFile(cm.configFile); !strings.Contains(string(data), "TEST_SECRET_POOL") {
+		t.Fatalf("keySource should be persisted")
+	}
+
+	// 重载后内存中的来源密钥保持不变
+	if err := cm.Reload(); err != nil {
+		t.Fatalf("Reload() err = %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0].APIKeys; !slices.Equal(got, []string{"secret-1", "secret-2"}) {
+		t.Fatalf("keys after reload = %v, want [secret-1 secret-2]", got)
+	}
+}
+
+func TestRefreshKeySources_FileAndURL(t *testing.T) {
+	cm := newKeySourceTestConfigManager(t)
+
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(keyFile, []byte("# responses pool\nf1\nf2\n"), 0600); err != nil {
+		t.Fatalf("写入密钥文件失败: %v", err)
+	}
+	var fetches atomic.Int32
+	var body atomic.Value
+	body.Store(`{"keys":["u1"]}`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	defer srv.Close()
+
+	if err := cm.AddResponsesUpstream(UpstreamConfig{
+		Name: "r", BaseURL: "https://r.example.com", ServiceType: "openai",
+		KeySource: &KeySource{Type: KeySourceFile, Source: keyFile},
+	}); err != nil {
+		t.Fatalf("AddResponsesUpstream() err = %v", err)
+	}
+	if err := cm.AddGeminiUpstream(UpstreamConfig{
+		Name: "g", BaseURL: "https://g.example.com", ServiceType: "gemini",
+		KeySource: &KeySource{Type: KeySourceURL, Source: srv.URL},
+	}); err != nil {
+		t.Fatalf("AddGeminiUpstream() err = %v", err)
+	}
+
+	// 后台同步循环可能已先行同步，这里只校验结果
+	if _, err := cm.RefreshKeySources(context.Background(), time.Now(), true); err != nil {
+		t.Fatalf("RefreshKeySources() err = %v", err)
+	}
+	cfg := cm.GetConfig()
+	if got := cfg.ResponsesUpstream[0].APIKeys; !slices.Equal(got, []string{"f1", "f2"}) {
+		t.Fatalf("responses keys = %v, want [f1 f2]", got)
+	}
+	if got := cfg.GeminiUpstream[0].APIKeys; !slices.Equal(got, []string{"u1"}) {
+		t.Fatalf("gemini keys = %v, want [u1]", got)
+	}
+	// 密钥由来源同步的渠道不会因初始无密钥被自动暂停
+	if cfg.ResponsesUpstream[0].Status != "active" || cfg.GeminiUpstream[0].Status != "active" {
+		t.Fatalf("key source channels suspended: %q / %q", cfg.ResponsesUpstream[0].Status, cfg.GeminiUpstream[0].Status)
+	}
+	// 未配置来源的渠道不受影响
+	if got := cfg.Upstream[0].APIKeys; !slices.Equal(got, []string{"manual"}) {
+		t.Fatalf("manual channel keys = %v", got)
+	}
+
+	body.Store(`["u1","u2"]`)
+	if _, err := cm.RefreshKeySources(context.Background(), time.Now().Add(time.Hour), false); err != nil {
+		t.Fatalf("RefreshKeySources() err = %v", err)
+	}
+	if got := cm.GetConfig().GeminiUpstream[0].APIKeys; !slices.Equal(got, []string{"u1", "u2"}) {
+		t.Fatalf("gemini keys after refresh = %v, want [u1 u2]", got)
+	}
+	if fetches.Load() < 2 {
+		t.Fatalf("expected URL source fetched on refresh, got %d fetches", fetches.Load())
+	}
+}
+
+func TestKeySourceValidation(t *testing.T) {
+	cm := newKeySourceTestConfigManager(t)
+
+	for _, source := range []*KeySource{
+		{Type: "vault", Source: "x"},
+		{Type: KeySourceEnv, Source: " "},
+		{Type: KeySourceURL, Source: "ftp://keys"},
+	} {
+		if _, err := cm.UpdateUpstream(0, UpstreamUpdate{KeySource: source}); err == nil {
+			t.Fatalf("expected error for %+v", source)
+		}
+	}
+
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{KeySource: &KeySource{Type: KeySourceEnv, Source: "X"}}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	// type 为空表示清除
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{KeySource: &KeySource{}}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	if cm.GetConfig().Upstream[0].KeySource != nil {
+		t.Fatal("expected keySource cleared")
+	}
+
+	if got := (&KeySource{RefreshInterval: 5}).Interval(); got != minKeySourceRefreshInterval {
+		t.Fatalf("Interval() = %v, want min %v", got, minKeySourceRefreshInterval)
+	}
+}
+
+func TestRefreshKeySourcesLoop_StartsOnlyWithKeySource(t *testing.T) {
+	tick := make(chan time.Time)
+	var stopped atomic.Bool
+	var nowNanos atomic.Int64
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	nowNanos.Store(base.UnixNano())
+	origNow, origTicker := keySourceNow, keySourceTicker
+	keySourceNow = func() time.Time { return time.Unix(0, nowNanos.Load()) }
+	keySourceTicker = func(time.Duration) (<-chan time.Time, func()) { return tick, func() { stopped.Store(true) } }
+	defer func() { keySourceNow, keySourceTicker = origNow, origTicker }()
+
+	t.Setenv("TEST_LOOP_KEYS", "l1")
+	cm := newKeySourceTestConfigManager(t)
+	loopStarted := func() bool {
+		cm.mu.RLock()
+		defer cm.mu.RUnlock()
+		return cm.keySourceLoopStarted
+	}
+	if loopStarted() {
+		t.Fatalf("没有 keySource 渠道时不应启动同步循环")
+	}
+
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{KeySource: &KeySource{Type: "env", Source: "TEST_LOOP_KEYS", RefreshInterval: 60}}); err != nil {
+		t.Fatalf("UpdateUpstream() err = %v", err)
+	}
+	if !loopStarted() {
+		t.Fatalf("配置 keySource 后应启动同步循环")
+	}
+	waitKeys := func(want []string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !slices.Equal(cm.GetConfig().Upstream[0].APIKeys, want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("keys = %v, want %v", cm.GetConfig().Upstream[0].APIKeys, want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	// 启动时立即同步一次
+	waitKeys([]string{"l1"})
+
+	// 注入的触发源驱动后续刷新
+	t.Setenv("TEST_LOOP_KEYS", "l2")
+	nowNanos.Store(base.Add(2 * time.Minute).UnixNano())
+	tick <- time.Now()
+	waitKeys([]string{"l2"})
+
+	cm.Close()
+	if !stopped.Load() {
+		t.Fatalf("Close 后应停止触发源")
+	}
+}
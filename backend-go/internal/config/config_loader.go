@@ -25,6 +25,7 @@ func NewConfigManager(configFile string) (*ConfigManager, error) {
 		keyIndex:        make(map[string]int),
 		keyRecoveryTime: keyRecoveryTime,
 		maxFailureCount: maxFailureCount,
+		keyDrainGrace:   DefaultKeyDrainGracePeriod,
 		stopChan:        make(chan struct{}),
 	}
 
@@ -45,6 +46,20 @@ func NewConfigManager(configFile string) (*ConfigManager, error) {
 		cm.cleanupExpiredFailures()
 	}()
 
+	// 启动排空密钥清理
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		cm.removeDrainedKeysLoop()
+	}()
+
+	// 启动规范密钥顺序恢复（未设置恢复间隔时为空操作）
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		cm.restoreKeyOrderLoop()
+	}()
+
 	return cm, nil
 }
 
@@ -72,6 +87,18 @@ func (cm *ConfigManager) loadConfig() error {
 		return err
 	}
 
+	return cm.applyLoadedConfigLocked(newConfig, data)
+}
+
+// applyLoadedConfigLocked 对从文件读取的配置执行兼容迁移与自检，并一次性替换内存快照（调用方需持有写锁）
+// 失败时保留旧配置
+func (cm *ConfigManager) applyLoadedConfigLocked(newConfig Config, data []byte) error {
+	// 重新解析 env:/file: 密钥引用（环境变量或密钥文件可能已变化）
+	oldKeyRefs := cm.keyRefs
+	cm.keyRefs = nil
+	cm.resolveKeyRefsLocked(&newConfig)
+	cm.restoreSourceKeysLocked(&newConfig)
+
 	// 兼容旧配置：检查 FuzzyModeEnabled 字段是否存在
 	// 如果不存在，默认设为 true（新功能默认启用）
 	needSaveDefaults := cm.applyConfigDefaults(&newConfig, data)
@@ -84,6 +111,7 @@ func (cm *ConfigManager) loadConfig() error {
 	if needSaveDefaults || needMigration {
 		if err := cm.saveConfigLocked(newConfig); err != nil {
 			log.Printf("[Config-Migration] 警告: 保存迁移后的配置失败: %v", err)
+			cm.keyRefs = oldKeyRefs
 			return err
 		}
 		saved = true
@@ -97,6 +125,7 @@ func (cm *ConfigManager) loadConfig() error {
 	if cm.validateChannelKeys(&newConfig) {
 		if err := cm.saveConfigLocked(newConfig); err != nil {
 			log.Printf("[Config-Validate] 警告: 保存自检后的配置失败: %v", err)
+			cm.keyRefs = oldKeyRefs
 			return err
 		}
 		saved = true
@@ -107,6 +136,8 @@ func (cm *ConfigManager) loadConfig() error {
 	if !saved {
 		cm.config = newConfig
 	}
+	// 启动或重载后出现 keySource 渠道时按需启动外部密钥同步
+	cm.startKeySourceLoopLocked()
 
 	return nil
 }
@@ -231,8 +262,8 @@ func (cm *ConfigManager) validateChannelKeys(cfg *Config) bool {
 			status = "active"
 		}
 
-		// 如果是 active 状态但没有配置 key，自动设为 suspended
-		if status == "active" && len(upstream.APIKeys) == 0 {
+		// 如果是 active 状态但没有配置 key，自动设为 suspended（密钥由外部来源同步的渠道除外）
+		if status == "active" && len(upstream.APIKeys) == 0 && upstream.KeySource == nil {
 			upstream.Status = "suspended"
 			modified = true
 			log.Printf("[Config-Validate] 警告: Messages 渠道 [%d] %s 没有配置 API key，已自动暂停", i, upstream.Name)
@@ -247,8 +278,8 @@ func (cm *ConfigManager) validateChannelKeys(cfg *Config) bool {
 			status = "active"
 		}
 
-		// 如果是 active 状态但没有配置 key，自动设为 suspended
-		if status == "active" && len(upstream.APIKeys) == 0 {
+		// 如果是 active 状态但没有配置 key，自动设为 suspended（密钥由外部来源同步的渠道除外）
+		if status == "active" && len(upstream.APIKeys) == 0 && upstream.KeySource == nil {
 			upstream.Status = "suspended"
 			modified = true
 			log.Printf("[Config-Validate] 警告: Responses 渠道 [%d] %s 没有配置 API key，已自动暂停", i, upstream.Name)
@@ -263,8 +294,8 @@ func (cm *ConfigManager) validateChannelKeys(cfg *Config) bool {
 			status = "active"
 		}
 
-		// 如果是 active 状态但没有配置 key，自动设为 suspended
-		if status == "active" && len(upstream.APIKeys) == 0 {
+		// 如果是 active 状态但没有配置 key，自动设为 suspended（密钥由外部来源同步的渠道除外）
+		if status == "active" && len(upstream.APIKeys) == 0 && upstream.KeySource == nil {
 			upstream.Status = "suspended"
 			modified = true
 			log.Printf("[Config-Validate] 警告: Gemini 渠道 [%d] %s 没有配置 API key，已自动暂停", i, upstream.Name)
@@ -283,12 +314,17 @@ func (cm *ConfigManager) saveConfigLocked(config Config) error {
 	config.CurrentUpstream = 0
 	config.CurrentResponsesUpstream = 0
 
-	data, err := json.MarshalIndent(config, "", "  ")
+	// 内存中使用解析后的密钥，文件中写回 env:/file: 引用，避免明文密钥落盘
+	cm.resolveKeyRefsLocked(&config)
+
+	data, err := json.MarshalIndent(cm.persistableConfigLocked(config), "", "  ")
 	if err != nil {
 		return err
 	}
 
 	cm.config = config
+	// 新增或修改渠道配置了 keySource 时按需启动外部密钥同步
+	cm.startKeySourceLoopLocked()
 	return os.WriteFile(cm.configFile, data, 0644)
 }
 
@@ -374,8 +410,8 @@ func (cm *ConfigManager) startWatcher() error {
 				}
 				if event.Op&fsnotify.Write == fsnotify.Write {
 					log.Printf("[Config-Watcher] 检测到配置文件变化，重载配置...")
-					if err := cm.loadConfig(); err != nil {
-						log.Printf("[Config-Watcher] 警告: 配置重载失败: %v", err)
+					if err := cm.Reload(); err != nil {
+						log.Printf("[Config-Watcher] 警告: 配置重载失败，保留当前配置: %v", err)
 					} else {
 						log.Printf("[Config-Watcher] 配置已重载")
 					}
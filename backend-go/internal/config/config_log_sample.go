@@ -0,0 +1,26 @@
+package config
+
+import "fmt"
+
+// normalizeLogSampleRate 校验渠道请求/响应体日志采样率（0-1），nil 或 >=1 表示全部记录（返回 nil）
+func normalizeLogSampleRate(rate *float64) (*float64, error) {
+	if rate == nil {
+		return nil, nil
+	}
+	if *rate < 0 || *rate > 1 {
+		return nil, fmt.Errorf("logSampleRate 超出范围: %g（需在 0-1 之间）", *rate)
+	}
+	if *rate == 1 {
+		return nil, nil
+	}
+	v := *rate
+	return &v, nil
+}
+
+// GetLogSampleRate 获取渠道请求/响应体日志采样率（未配置时为 1，即全部记录）
+func (u *UpstreamConfig) GetLogSampleRate() float64 {
+	if u == nil || u.LogSampleRate == nil {
+		return 1
+	}
+	return *u.LogSampleRate
+}
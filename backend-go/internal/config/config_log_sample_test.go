@@ -0,0 +1,41 @@
+package config
+
+import "testing"
+
+func TestUpdateUpstream_LogSampleRate(t *testing.T) {
+	cm := newKeySourceTestConfigManager(t)
+
+	if got := cm.GetConfig().Upstream[0].GetLogSampleRate(); got != 1 {
+		t.Fatalf("default GetLogSampleRate = %g, want 1", got)
+	}
+
+	for _, invalid := range []float64{-0.1, 1.5} {
+		rate := invalid
+		if _, err := cm.UpdateUpstream(0, UpstreamUpdate{LogSampleRate: &rate}); err == nil {
+			t.Fatalf("logSampleRate %g 应校验失败", invalid)
+		}
+	}
+
+	rate := 0.1
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{LogSampleRate: &rate}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	upstream := cm.GetConfig().Upstream[0]
+	if got := upstream.GetLogSampleRate(); got != 0.1 {
+		t.Fatalf("GetLogSampleRate = %g, want 0.1", got)
+	}
+	cloned := upstream.Clone()
+	*cloned.LogSampleRate = 0.5
+	if got := upstream.GetLogSampleRate(); got != 0.1 {
+		t.Fatalf("Clone should deep copy LogSampleRate, got %g", got)
+	}
+
+	// 设为 1 恢复全部记录（不再保存该字段）
+	full := 1.0
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{LogSampleRate: &full}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0].LogSampleRate; got != nil {
+		t.Fatalf("LogSampleRate = %v, want nil", *got)
+	}
+}
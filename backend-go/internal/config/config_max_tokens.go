@@ -0,0 +1,31 @@
+package config
+
+// GetMaxOutputTokensLimit 获取渠道转发指定模型时的输出 token 上限（0 表示不限制）
+// 渠道 maxOutputTokensClamp 优先于全局默认值；modelMaxOutputTokens 中匹配原始或重定向后模型名的上限取较小值
+func (cm *ConfigManager) GetMaxOutputTokensLimit(upstream *UpstreamConfig, model string) int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	limit := cm.config.MaxOutputTokensClamp
+	if upstream != nil && upstream.MaxOutputTokensClamp > 0 {
+		limit = upstream.MaxOutputTokensClamp
+	}
+	limit = max(limit, 0)
+
+	if model == "" || len(cm.config.ModelMaxOutputTokens) == 0 {
+		return limit
+	}
+	redirected := model
+	if upstream != nil {
+		redirected = RedirectModel(model, upstream)
+	}
+	for pattern, modelCap := range cm.config.ModelMaxOutputTokens {
+		if modelCap <= 0 || !(matchModelPattern(pattern, model) || matchModelPattern(pattern, redirected)) {
+			continue
+		}
+		if limit == 0 || modelCap < limit {
+			limit = modelCap
+		}
+	}
+	return limit
+}
@@ -0,0 +1,43 @@
+package config
+
+import "testing"
+
+func TestGetCurrentUpstream_SkipsShadowChannel(t *testing.T) {
+	cm := newKeySourceTestConfigManager(t)
+
+	// 将唯一的渠道设为影子渠道后追加普通渠道：单渠道模式应选择普通渠道
+	shadow := true
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{Shadow: &shadow}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	if !cm.GetConfig().Upstream[0].Shadow {
+		t.Fatal("shadow 应已启用")
+	}
+	if err := cm.AddUpstream(UpstreamConfig{Name: "live", BaseURL: "https://live.example.com", APIKeys: []string{"k"}, ServiceType: "claude"}); err != nil {
+		t.Fatalf("AddUpstream: %v", err)
+	}
+
+	upstream, err := cm.GetCurrentUpstream()
+	if err != nil {
+		t.Fatalf("GetCurrentUpstream: %v", err)
+	}
+	if upstream.Name != "live" {
+		t.Fatalf("GetCurrentUpstream = %q, want live", upstream.Name)
+	}
+
+	// 未提供 shadow 时保持不变，显式 false 时关闭
+	name := "m2"
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{Name: &name}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	if !cm.GetConfig().Upstream[0].Shadow {
+		t.Fatal("未提供 shadow 时不应修改")
+	}
+	shadow = false
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{Shadow: &shadow}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	if upstream, _ := cm.GetCurrentUpstream(); upstream.Name != "m2" {
+		t.Fatalf("关闭影子模式后 GetCurrentUpstream = %q, want m2", upstream.Name)
+	}
+}
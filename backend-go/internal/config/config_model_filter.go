@@ -0,0 +1,42 @@
+package config
+
+// ============== 全局模型准入（allowedModels / blockedModels） ==============
+//
+// 在代理入口按客户端请求的模型名过滤，与具体由哪个渠道服务无关：
+//   - blockedModels 命中即拒绝（优先级最高）
+//   - 配置了 allowedModels 时，模型必须命中其中之一
+// 两者均支持 * 通配符，不区分大小写（与渠道 supportedModels 的匹配规则一致）。
+
+// IsModelAllowed 判断模型是否允许通过代理访问；未指定模型时不做限制（由上游校验）
+func (cm *ConfigManager) IsModelAllowed(model string) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return isModelAllowed(cm.config.AllowedModels, cm.config.BlockedModels, model)
+}
+
+// HasModelFilter 是否配置了全局模型准入规则
+func (cm *ConfigManager) HasModelFilter() bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return len(cm.config.AllowedModels) > 0 || len(cm.config.BlockedModels) > 0
+}
+
+func isModelAllowed(allowed, blocked []string, model string) bool {
+	if model == "" {
+		return true
+	}
+	for _, pattern := range blocked {
+		if matchModelPattern(pattern, model) {
+			return false
+		}
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, pattern := range allowed {
+		if matchModelPattern(pattern, model) {
+			return true
+		}
+	}
+	return false
+}
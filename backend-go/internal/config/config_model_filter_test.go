@@ -0,0 +1,40 @@
+package config
+
+import "testing"
+
+func TestIsModelAllowed(t *testing.T) {
+	cm := newTestConfigManager()
+	if cm.HasModelFilter() || !cm.IsModelAllowed("claude-opus-4") {
+		t.Fatalf("no filter should allow every model")
+	}
+
+	cm.config.AllowedModels = []string{"claude-*", "gpt-4o"}
+	cm.config.BlockedModels = []string{"*-opus-*"}
+	if !cm.HasModelFilter() {
+		t.Fatalf("HasModelFilter() = false, want true")
+	}
+
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"claude-sonnet-4", true},
+		{"Claude-Haiku", true},
+		{"claude-opus-4", false},
+		{"gpt-4o", true},
+		{"gpt-4o-mini", false},
+		{"gemini-2.5-pro", false},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if got := cm.IsModelAllowed(tt.model); got != tt.want {
+			t.Errorf("IsModelAllowed(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+
+	// 仅配置 blockedModels 时其余模型均放行
+	cm.config.AllowedModels = nil
+	if !cm.IsModelAllowed("gemini-2.5-pro") || cm.IsModelAllowed("claude-opus-4") {
+		t.Fatalf("blocked-only filter mismatch")
+	}
+}
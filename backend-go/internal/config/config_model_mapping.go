@@ -0,0 +1,181 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ============== 模型映射候选链 ==============
+//
+// modelMapping 的值既可以是字符串（单一目标，与以往一致），也可以是有序数组（候选链）：
+//
+//	"modelMapping": {"opus": ["claude-opus-4-1", "claude-opus-4"], "haiku": "claude-3-5-haiku"}
+//
+// 内存中 ModelMapping 始终保存首选目标（现有重定向逻辑无需感知候选链），
+// ModelMappingChains 保存值为数组时的完整有序列表，供处理器在上游返回“模型不存在”时依次尝试。
+
+// UnmarshalJSON 解析渠道配置，modelMapping 值兼容字符串与字符串数组
+func (u *UpstreamConfig) UnmarshalJSON(data []byte) error {
+	type upstreamAlias UpstreamConfig
+	aux := struct {
+		*upstreamAlias
+		ModelMapping map[string]json.RawMessage `json:"modelMapping,omitempty"`
+	}{upstreamAlias: (*upstreamAlias)(u)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	mapping, chains, err := decodeModelMapping(aux.ModelMapping)
+	if err != nil {
+		return err
+	}
+	u.ModelMapping, u.ModelMappingChains = mapping, chains
+	return nil
+}
+
+// MarshalJSON 序列化渠道配置，存在候选链的映射输出为数组
+func (u UpstreamConfig) MarshalJSON() ([]byte, error) {
+	type upstreamAlias UpstreamConfig
+	return json.Marshal(struct {
+		upstreamAlias
+		ModelMapping map[string]any `json:"modelMapping,omitempty"`
+	}{upstreamAlias: upstreamAlias(u), ModelMapping: encodeModelMapping(u.ModelMapping, u.ModelMappingChains)})
+}
+
+// UnmarshalJSON 解析渠道更新请求，modelMapping 值兼容字符串与字符串数组
+func (u *UpstreamUpdate) UnmarshalJSON(data []byte) error {
+	type updateAlias UpstreamUpdate
+	aux := struct {
+		*updateAlias
+		ModelMapping map[string]json.RawMessage `json:"modelMapping"`
+	}{updateAlias: (*updateAlias)(u)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	mapping, chains, err := decodeModelMapping(aux.ModelMapping)
+	if err != nil {
+		return err
+	}
+	u.ModelMapping, u.ModelMappingChains = mapping, chains
+	return nil
+}
+
+// ModelMappingJSON 返回用于 API 输出的模型映射（候选链以数组形式返回）
+func (u *UpstreamConfig) ModelMappingJSON() map[string]any {
+	return encodeModelMapping(u.ModelMapping, u.ModelMappingChains)
+}
+
+// ModelMappingTargets 返回模型命中的映射源与有序目标列表（匹配规则同 RedirectModel）
+// 未命中映射时返回空源与 nil；单一目标映射返回长度为 1 的列表
+func (u *UpstreamConfig) ModelMappingTargets(model string) (string, []string) {
+	if u == nil {
+		return "", nil
+	}
+	source, ok := matchModelMappingSource(model, u.ModelMapping)
+	if !ok {
+		return "", nil
+	}
+	if chain := u.ModelMappingChains[source]; len(chain) > 0 {
+		return source, chain
+	}
+	return source, []string{u.ModelMapping[source]}
+}
+
+// UseModelMappingTarget 将映射源的当前目标切换为候选链中的指定模型
+// 会修改 ModelMapping，只应在请求级的 Clone 副本上调用
+func (u *UpstreamConfig) UseModelMappingTarget(source, target string) {
+	if u == nil || source == "" || target == "" {
+		return
+	}
+	if u.ModelMapping == nil {
+		u.ModelMapping = make(map[string]string)
+	}
+	u.ModelMapping[source] = target
+}
+
+// matchModelMappingSource 查找模型命中的映射源：精确匹配优先，其次按源模型长度从长到短模糊匹配
+// 例如：同时配置 "codex" 和 "gpt-5.1-codex" 时，"gpt-5.1-codex" 应该先匹配
+func matchModelMappingSource(model string, mapping map[string]string) (string, bool) {
+	if len(mapping) == 0 {
+		return "", false
+	}
+	if _, ok := mapping[model]; ok {
+		return model, true
+	}
+
+	sources := make([]string, 0, len(mapping))
+	for source := range mapping {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if len(sources[i]) != len(sources[j]) {
+			return len(sources[i]) > len(sources[j])
+		}
+		return sources[i] < sources[j]
+	})
+	for _, source := range sources {
+		if strings.Contains(model, source) || strings.Contains(source, model) {
+			return source, true
+		}
+	}
+	return "", false
+}
+
+// decodeModelMapping 将 modelMapping 原始值拆分为首选目标与候选链
+// 数组去除空白与空项；数组只有一个目标时等同于字符串映射，不记录候选链
+func decodeModelMapping(raw map[string]json.RawMessage) (map[string]string, map[string][]string, error) {
+	if raw == nil {
+		return nil, nil, nil
+	}
+
+	mapping := make(map[string]string, len(raw))
+	var chains map[string][]string
+	for source, value := range raw {
+		var target string
+		if err := json.Unmarshal(value, &target); err == nil {
+			mapping[source] = target
+			continue
+		}
+
+		var targets []string
+		if err := json.Unmarshal(value, &targets); err != nil {
+			return nil, nil, fmt.Errorf("modelMapping[%q] 必须是字符串或字符串数组", source)
+		}
+		cleaned := make([]string, 0, len(targets))
+		for _, t := range targets {
+			if t = strings.TrimSpace(t); t != "" {
+				cleaned = append(cleaned, t)
+			}
+		}
+		if len(cleaned) == 0 {
+			return nil, nil, fmt.Errorf("modelMapping[%q] 候选列表不能为空", source)
+		}
+		mapping[source] = cleaned[0]
+		if len(cleaned) > 1 {
+			if chains == nil {
+				chains = make(map[string][]string)
+			}
+			chains[source] = cleaned
+		}
+	}
+	return mapping, chains, nil
+}
+
+// encodeModelMapping 合并首选目标与候选链为 JSON 输出格式
+func encodeModelMapping(mapping map[string]string, chains map[string][]string) map[string]any {
+	if mapping == nil {
+		return nil
+	}
+	out := make(map[string]any, len(mapping))
+	for source, target := range mapping {
+		if chain := chains[source]; len(chain) > 1 {
+			out[source] = chain
+			continue
+		}
+		out[source] = target
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamConfig_ModelMappingAcceptsStringAndList(t *testing.T) {
+	var up UpstreamConfig
+	data := `{"name":"u","serviceType":"claude","apiKeys":["k"],
+		"modelMapping":{"opus":["claude-opus-4-1"," claude-opus-4 ",""],"haiku":"claude-3-5-haiku","sonnet":["claude-sonnet-4"]}}`
+	if err := json.Unmarshal([]byte(data), &up); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	want := map[string]string{"opus": "claude-opus-4-1", "haiku": "claude-3-5-haiku", "sonnet": "claude-sonnet-4"}
+	if !reflect.DeepEqual(up.ModelMapping, want) {
+		t.Fatalf("ModelMapping = %v", up.ModelMapping)
+	}
+	if !reflect.DeepEqual(up.ModelMappingChains, map[string][]string{"opus": {"claude-opus-4-1", "claude-opus-4"}}) {
+		t.Fatalf("ModelMappingChains = %v", up.ModelMappingChains)
+	}
+	if up.Name != "u" || up.ServiceType != "claude" || len(up.APIKeys) != 1 {
+		t.Fatalf("other fields not decoded: %+v", up)
+	}
+	if got := RedirectModel("claude-opus-latest", &up); got != "claude-opus-4-1" {
+		t.Fatalf("RedirectModel = %q, want first target", got)
+	}
+
+	out, err := json.Marshal(up)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(out), `"opus":["claude-opus-4-1","claude-opus-4"]`) || !strings.Contains(string(out), `"haiku":"claude-3-5-haiku"`) {
+		t.Fatalf("marshal output = %s", out)
+	}
+
+	var roundTrip UpstreamConfig
+	if err := json.Unmarshal(out, &roundTrip); err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	if !reflect.DeepEqual(roundTrip.ModelMappingChains, up.ModelMappingChains) || !reflect.DeepEqual(roundTrip.ModelMapping, up.ModelMapping) {
+		t.Fatalf("round trip mismatch: %+v", roundTrip)
+	}
+}
+
+func TestUpstreamConfig_ModelMappingRejectsInvalidValues(t *testing.T) {
+	for _, data := range []string{
+		`{"modelMapping":{"opus":1}}`,
+		`{"modelMapping":{"opus":[]}}`,
+		`{"modelMapping":{"opus":[" "]}}`,
+	} {
+		var up UpstreamConfig
+		if err := json.Unmarshal([]byte(data), &up); err == nil {
+			t.Fatalf("%s: expected error", data)
+		}
+	}
+}
+
+func TestUpstreamUpdate_ModelMappingChains(t *testing.T) {
+	var update UpstreamUpdate
+	if err := json.Unmarshal([]byte(`{"name":"n","modelMapping":{"opus":["a","b"]}}`), &update); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if update.Name == nil || *update.Name != "n" {
+		t.Fatalf("name not decoded")
+	}
+	if update.ModelMapping["opus"] != "a" || !reflect.DeepEqual(update.ModelMappingChains["opus"], []string{"a", "b"}) {
+		t.Fatalf("update = %+v", update)
+	}
+
+	var empty UpstreamUpdate
+	if err := json.Unmarshal([]byte(`{"name":"n"}`), &empty); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if empty.ModelMapping != nil || empty.ModelMappingChains != nil {
+		t.Fatalf("absent modelMapping must stay nil: %+v", empty)
+	}
+}
+
+func TestUpstreamConfig_ModelMappingTargets(t *testing.T) {
+	up := &UpstreamConfig{
+		ModelMapping:       map[string]string{"opus": "a", "codex": "c", "gpt-5.1-codex": "g"},
+		ModelMappingChains: map[string][]string{"opus": {"a", "b"}},
+	}
+
+	if source, targets := up.ModelMappingTargets("claude-opus-4"); source != "opus" || !reflect.DeepEqual(targets, []string{"a", "b"}) {
+		t.Fatalf("opus targets = %q %v", source, targets)
+	}
+	if source, targets := up.ModelMappingTargets("gpt-5.1-codex-mini"); source != "gpt-5.1-codex" || !reflect.DeepEqual(targets, []string{"g"}) {
+		t.Fatalf("codex targets = %q %v", source, targets)
+	}
+	if source, targets := up.ModelMappingTargets("haiku"); source != "" || targets != nil {
+		t.Fatalf("unmapped model = %q %v", source, targets)
+	}
+
+	cloned := up.Clone()
+	cloned.UseModelMappingTarget("opus", "b")
+	if RedirectModel("claude-opus-4", cloned) != "b" || RedirectModel("claude-opus-4", up) != "a" {
+		t.Fatalf("UseModelMappingTarget must only affect the clone")
+	}
+	cloned.ModelMappingChains["opus"][0] = "x"
+	if up.ModelMappingChains["opus"][0] != "a" {
+		t.Fatalf("Clone must deep copy ModelMappingChains")
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxModelTimeout 单个模型超时的上限
+const maxModelTimeout = 24 * time.Hour
+
+// GetModelTimeout 返回渠道为指定模型配置的上游超时
+// 模型名支持 * 通配符：精确匹配优先，其次为最长（最具体）的通配模式；同时匹配原始模型名与重定向后的模型名
+func (u *UpstreamConfig) GetModelTimeout(model string) (time.Duration, bool) {
+	if u == nil || len(u.ModelTimeouts) == 0 || model == "" {
+		return 0, false
+	}
+	candidates := []string{model}
+	if redirected := RedirectModel(model, u); redirected != model {
+		candidates = append(candidates, redirected)
+	}
+
+	var best string
+	var timeout time.Duration
+	found := false
+	for pattern, value := range u.ModelTimeouts {
+		for _, candidate := range candidates {
+			if !matchModelPattern(pattern, candidate) {
+				continue
+			}
+			exact := !strings.Contains(pattern, "*")
+			if !found || moreSpecificModelPattern(pattern, exact, best) {
+				d, err := time.ParseDuration(value)
+				if err != nil || d <= 0 {
+					continue
+				}
+				best, timeout, found = pattern, d, true
+			}
+		}
+	}
+	return timeout, found
+}
+
+// moreSpecificModelPattern 判断 pattern 是否比 current 更具体（精确匹配 > 更长的通配模式，等长时按字典序保证结果稳定）
+func moreSpecificModelPattern(pattern string, exact bool, current string) bool {
+	currentExact := !strings.Contains(current, "*")
+	if exact != currentExact {
+		return exact
+	}
+	if len(pattern) != len(current) {
+		return len(pattern) > len(current)
+	}
+	return pattern < current
+}
+
+// normalizeModelTimeouts 校验模型超时表（值为 Go duration 字符串，如 "30s"、"10m"）：去除空白与空项，空表返回 nil（清除配置）
+func normalizeModelTimeouts(timeouts map[string]string) (map[string]string, error) {
+	cleaned := make(map[string]string, len(timeouts))
+	for model, value := range timeouts {
+		model, value = strings.TrimSpace(model), strings.TrimSpace(value)
+		if model == "" || value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("模型 %s 的超时配置无效: %q（示例: 30s、10m）", model, value)
+		}
+		if d <= 0 || d > maxModelTimeout {
+			return nil, fmt.Errorf("模型 %s 的超时超出范围: %s（需大于 0 且不超过 %s）", model, value, maxModelTimeout)
+		}
+		cleaned[model] = value
+	}
+	if len(cleaned) == 0 {
+		return nil, nil
+	}
+	return cleaned, nil
+}
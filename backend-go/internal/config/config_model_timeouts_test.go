@@ -0,0 +1,100 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetModelTimeout(t *testing.T) {
+	upstream := &UpstreamConfig{
+		ModelTimeouts: map[string]string{
+			"claude-opus-4": "10m",
+			"claude-*":      "2m",
+			"claude-opus-*": "5m",
+			"gpt-4o-mini":   "20s",
+			"o1-*":          "15m",
+		},
+		ModelMapping: map[string]string{"reasoner": "o1-preview"},
+	}
+
+	tests := []struct {
+		name  string
+		model string
+		want  time.Duration
+		found bool
+	}{
+		{name: "exact match wins over wildcard", model: "claude-opus-4", want: 10 * time.Minute, found: true},
+		{name: "longest wildcard wins", model: "claude-opus-4-1", want: 5 * time.Minute, found: true},
+		{name: "generic wildcard", model: "claude-sonnet-4", want: 2 * time.Minute, found: true},
+		{name: "exact only", model: "gpt-4o-mini", want: 20 * time.Second, found: true},
+		{name: "redirected model", model: "reasoner", want: 15 * time.Minute, found: true},
+		{name: "no match", model: "gemini-2.5-pro", found: false},
+		{name: "empty model", model: "", found: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := upstream.GetModelTimeout(tt.model)
+			if found != tt.found || got != tt.want {
+				t.Fatalf("GetModelTimeout(%q) = %v, %v; want %v, %v", tt.model, got, found, tt.want, tt.found)
+			}
+		})
+	}
+
+	var nilUpstream *UpstreamConfig
+	if _, found := nilUpstream.GetModelTimeout("claude-opus-4"); found {
+		t.Fatal("nil 渠道不应返回超时")
+	}
+}
+
+func TestNormalizeModelTimeouts(t *testing.T) {
+	got, err := normalizeModelTimeouts(map[string]string{" claude-* ": " 90s ", "": "1m", "gpt-4o": ""})
+	if err != nil {
+		t.Fatalf("normalizeModelTimeouts: %v", err)
+	}
+	if len(got) != 1 || got["claude-*"] != "90s" {
+		t.Fatalf("normalizeModelTimeouts = %v", got)
+	}
+
+	if got, err := normalizeModelTimeouts(map[string]string{}); err != nil || got != nil {
+		t.Fatalf("空表应返回 nil，实际 %v, %v", got, err)
+	}
+
+	for _, value := range []string{"abc", "30", "0s", "-1m", "25h"} {
+		if _, err := normalizeModelTimeouts(map[string]string{"m": value}); err == nil {
+			t.Fatalf("超时 %q 应校验失败", value)
+		}
+	}
+}
+
+func TestUpdateUpstream_ModelTimeouts(t *testing.T) {
+	cm := newKeySourceTestConfigManager(t)
+
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{ModelTimeouts: map[string]string{"claude-*": "forever"}}); err == nil {
+		t.Fatal("无效超时应返回错误")
+	}
+
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{ModelTimeouts: map[string]string{"claude-opus-*": "10m"}}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	upstream := cm.GetConfig().Upstream[0]
+	if d, ok := upstream.GetModelTimeout("claude-opus-4"); !ok || d != 10*time.Minute {
+		t.Fatalf("更新后 GetModelTimeout = %v, %v", d, ok)
+	}
+
+	// 未提供字段时保持不变
+	name := "renamed"
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{Name: &name}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	if len(cm.GetConfig().Upstream[0].ModelTimeouts) != 1 {
+		t.Fatal("未提供 modelTimeouts 时不应清除配置")
+	}
+
+	// 空对象清除配置
+	if _, err := cm.UpdateUpstream(0, UpstreamUpdate{ModelTimeouts: map[string]string{}}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0].ModelTimeouts; got != nil {
+		t.Fatalf("空对象应清除 modelTimeouts，实际 %v", got)
+	}
+}
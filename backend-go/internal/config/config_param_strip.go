@@ -0,0 +1,38 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// MatchParameterStripRules 返回错误响应体匹配到的待剥离参数路径（按规则键排序，去重）
+// 规则键为不区分大小写的子串，值为 gjson/sjson 路径（如 thinking、metadata.user_id）
+func (cm *ConfigManager) MatchParameterStripRules(errorBody []byte) []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if len(cm.config.ParameterStripRules) == 0 || len(errorBody) == 0 {
+		return nil
+	}
+
+	patterns := make([]string, 0, len(cm.config.ParameterStripRules))
+	for pattern := range cm.config.ParameterStripRules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	lowerBody := strings.ToLower(string(errorBody))
+	var params []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		param := strings.TrimSpace(cm.config.ParameterStripRules[pattern])
+		if strings.TrimSpace(pattern) == "" || param == "" || seen[param] {
+			continue
+		}
+		if strings.Contains(lowerBody, strings.ToLower(pattern)) {
+			seen[param] = true
+			params = append(params, param)
+		}
+	}
+	return params
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchParameterStripRules(t *testing.T) {
+	cm := newTestConfigManager()
+	cm.config.ParameterStripRules = map[string]string{
+		"Extra inputs are not permitted": "thinking",
+		"thinking":                       "thinking",
+		"top_k":                          "top_k",
+		"":                               "ignored",
+		"blank":                          " ",
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"不区分大小写且去重", `{"error":{"message":"THINKING: extra inputs are not permitted"}}`, []string{"thinking"}},
+		{"匹配多条规则", `{"error":{"message":"thinking and top_k unsupported"}}`, []string{"thinking", "top_k"}},
+		{"空参数规则忽略", `{"error":{"message":"blank"}}`, nil},
+		{"未匹配", `{"error":{"message":"invalid model"}}`, nil},
+		{"空响应体", ``, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cm.MatchParameterStripRules([]byte(tt.body)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("MatchParameterStripRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
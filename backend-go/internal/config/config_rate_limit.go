@@ -0,0 +1,65 @@
+package config
+
+// RateLimitConfig 代理入口限流配置（令牌桶，按分钟预算匀速恢复）
+type RateLimitConfig struct {
+	Enabled           bool `json:"enabled"`
+	RequestsPerMinute int  `json:"requestsPerMinute,omitempty"` // 默认每分钟请求数上限（0 表示不限制）
+	TokensPerMinute   int  `json:"tokensPerMinute,omitempty"`   // 默认每分钟 token 上限（0 表示不限制）
+	// Keys 按入站访问密钥覆盖默认限额；只有此处配置的密钥按密钥计数，其余请求按客户端 IP 区分，此处也可填 IP
+	Keys map[string]RateLimitRule `json:"keys,omitempty"`
+}
+
+// RateLimitRule 单个身份的限额（0 表示该维度不限制）
+type RateLimitRule struct {
+	RequestsPerMinute int `json:"requestsPerMinute"`
+	TokensPerMinute   int `json:"tokensPerMinute"`
+}
+
+// Clone 深拷贝限流配置
+func (r *RateLimitConfig) Clone() *RateLimitConfig {
+	if r == nil {
+		return nil
+	}
+	cloned := *r
+	if r.Keys != nil {
+		cloned.Keys = make(map[string]RateLimitRule, len(r.Keys))
+		for k, v := range r.Keys {
+			cloned.Keys[k] = v
+		}
+	}
+	return &cloned
+}
+
+// HasRateLimitKey 判断 identity 是否在 rateLimit.keys 中单独配置
+func (cm *ConfigManager) HasRateLimitKey(identity string) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if rl := cm.config.RateLimit; rl != nil {
+		_, ok := rl.Keys[identity]
+		return ok
+	}
+	return false
+}
+
+// GetRateLimitRule 获取指定身份的限额（优先使用 Keys 中的覆盖值）
+// 返回 false 表示未启用限流；负数限额按 0（不限制）处理
+func (cm *ConfigManager) GetRateLimitRule(identity string) (RateLimitRule, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	rl := cm.config.RateLimit
+	if rl == nil || !rl.Enabled {
+		return RateLimitRule{}, false
+	}
+	rule := RateLimitRule{
+		RequestsPerMinute: rl.RequestsPerMinute,
+		TokensPerMinute:   rl.TokensPerMinute,
+	}
+	if override, ok := rl.Keys[identity]; ok {
+		rule = override
+	}
+	rule.RequestsPerMinute = max(rule.RequestsPerMinute, 0)
+	rule.TokensPerMinute = max(rule.TokensPerMinute, 0)
+	return rule, true
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+)
+
+// Reload 重新读取并校验配置文件，校验通过后一次性替换内存配置；失败时保留旧配置并返回错误
+// 供 SIGHUP、POST /admin/config/reload 与文件监听使用。
+// 内存配置整体替换（GetConfig 返回深拷贝），进行中的请求继续使用各自持有的旧快照，不受影响
+func (cm *ConfigManager) Reload() error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	data, err := os.ReadFile(cm.configFile)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	var newConfig Config
+	if err := json.Unmarshal(data, &newConfig); err != nil {
+		return fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if err := validateConfig(&newConfig); err != nil {
+		return fmt.Errorf("配置校验失败: %w", err)
+	}
+
+	if err := cm.applyLoadedConfigLocked(newConfig, data); err != nil {
+		return err
+	}
+
+	log.Printf("[Config-Reload] 配置已重载: Messages %d 个渠道, Responses %d 个渠道, Gemini %d 个渠道",
+		len(cm.config.Upstream), len(cm.config.ResponsesUpstream), len(cm.config.GeminiUpstream))
+	return nil
+}
+
+// validateConfig 校验从文件读取的完整配置（与管理 API 新增/更新渠道时的校验规则一致）
+func validateConfig(cfg *Config) error {
+	for field, strategy := range map[string]string{
+		"loadBalance":          cfg.LoadBalance,
+		"responsesLoadBalance": cfg.ResponsesLoadBalance,
+		"geminiLoadBalance":    cfg.GeminiLoadBalance,
+	} {
+		if strategy == "" {
+			continue
+		}
+		if err := validateLoadBalanceStrategy(strategy); err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+	}
+
+	groups := []struct {
+		kind      string
+		upstreams []UpstreamConfig
+	}{
+		{"Messages", cfg.Upstream},
+		{"Responses", cfg.ResponsesUpstream},
+		{"Gemini", cfg.GeminiUpstream},
+	}
+	for _, group := range groups {
+		for i := range group.upstreams {
+			if err := validateUpstreamConfig(&group.upstreams[i]); err != nil {
+				return fmt.Errorf("%s 渠道 [%d] %s: %w", group.kind, i, group.upstreams[i].Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateUpstreamConfig 校验单个渠道配置
+func validateUpstreamConfig(upstream *UpstreamConfig) error {
+	baseURLs := upstream.GetAllBaseURLs()
+	if len(baseURLs) == 0 {
+		return fmt.Errorf("baseUrl 不能为空")
+	}
+	for _, baseURL := range baseURLs {
+		u, err := url.Parse(baseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("baseUrl 无效: %q", baseURL)
+		}
+	}
+
+	switch upstream.Status {
+	case "", "active", "suspended", "disabled":
+	default:
+		return fmt.Errorf("无效的状态: %s", upstream.Status)
+	}
+
+	if _, err := normalizeKeySource(upstream.KeySource); err != nil {
+		return err
+	}
+	if _, err := normalizeStatusCodes(upstream.FailoverStatusCodes); err != nil {
+		return err
+	}
+	if _, err := normalizeStatusCodes(upstream.NoFailoverStatusCodes); err != nil {
+		return err
+	}
+	if _, err := normalizeModelTimeouts(upstream.ModelTimeouts); err != nil {
+		return err
+	}
+	if _, err := normalizeExtraHeaders(upstream.ExtraHeaders); err != nil {
+		return err
+	}
+	if _, err := normalizeCanaryPercent(upstream.CanaryPercent); err != nil {
+		return err
+	}
+	if _, err := normalizeLogSampleRate(upstream.LogSampleRate); err != nil {
+		return err
+	}
+	if _, err := normalizeChannelTimeout("connectTimeout", &upstream.ConnectTimeout); err != nil {
+		return err
+	}
+	if _, err := normalizeChannelTimeout("responseTimeout", &upstream.ResponseTimeout); err != nil {
+		return err
+	}
+	if _, err := normalizeProxyURL(&upstream.ProxyURL); err != nil {
+		return err
+	}
+	return nil
+}
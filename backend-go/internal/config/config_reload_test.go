@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReload_SwapsValidConfigKeepsSnapshots(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("写入配置失败: %v", err)
+		}
+	}
+	write(`{"upstream": [{"name": "a", "baseUrl": "https://a.example.com", "apiKeys": ["k1"]}], "loadBalance": "failover"}`)
+	cm, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("初始化配置管理器失败: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+
+	// 进行中的请求持有的旧快照
+	snapshot := cm.GetConfig()
+
+	write(`{"upstream": [{"name": "b", "baseUrl": "https://b.example.com", "apiKeys": ["k2", "k3"]}], "loadBalance": "failover"}`)
+	if err := cm.Reload(); err != nil {
+		t.Fatalf("Reload() err = %v", err)
+	}
+	if got := cm.GetConfig().Upstream[0]; got.Name != "b" || len(got.APIKeys) != 2 {
+		t.Fatalf("重载后渠道 = %+v, want b", got)
+	}
+	if snapshot.Upstream[0].Name != "a" || snapshot.Upstream[0].APIKeys[0] != "k1" {
+		t.Fatalf("旧快照不应被修改: %+v", snapshot.Upstream[0])
+	}
+}
+
+func TestReload_InvalidConfigKeepsOld(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"upstream": [{"name": "a", "baseUrl": "https://a.example.com", "apiKeys": ["k1"]}], "loadBalance": "failover"}`), 0644); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+	cm, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("初始化配置管理器失败: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+	// 停止文件监听，避免监听触发的重载与显式 Reload 交错
+	if err := cm.watcher.Remove(configPath); err != nil {
+		t.Fatalf("停止文件监听失败: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"truncated json", `{"upstream": [{"name": "b"`, "解析配置文件失败"},
+		{"missing baseUrl", `{"upstream": [{"name": "b", "apiKeys": ["k"]}]}`, "baseUrl 不能为空"},
+		{"relative baseUrl", `{"responsesUpstream": [{"name": "r", "baseUrl": "/v1", "apiKeys": ["k"]}]}`, "Responses 渠道 [0] r"},
+		{"bad status", `{"geminiUpstream": [{"name": "g", "baseUrl": "https://g.example.com", "status": "paused"}]}`, "无效的状态"},
+		{"bad failover codes", `{"upstream": [{"name": "b", "baseUrl": "https://b.example.com", "failoverStatusCodes": [700]}]}`, "Messages 渠道 [0] b"},
+		{"bad load balance", `{"geminiLoadBalance": "weighted"}`, "geminiLoadBalance"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("写入配置失败: %v", err)
+			}
+			err := cm.Reload()
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Reload() err = %v, want containing %q", err, tc.wantErr)
+			}
+			if got := cm.GetConfig().Upstream; len(got) != 1 || got[0].Name != "a" {
+				t.Fatalf("校验失败后应保留旧配置, got %+v", got)
+			}
+		})
+	}
+}
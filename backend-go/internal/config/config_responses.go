@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"time"
 )
@@ -43,6 +44,39 @@ func (cm *ConfigManager) AddResponsesUpstream(upstream UpstreamConfig) error {
 
 	// 去重 API Keys 和 Base URLs
 	upstream.APIKeys = deduplicateStrings(upstream.APIKeys)
+	keySource, err := normalizeKeySource(upstream.KeySource)
+	if err != nil {
+		return err
+	}
+	upstream.KeySource = keySource
+	if upstream.FailoverStatusCodes, err = normalizeStatusCodes(upstream.FailoverStatusCodes); err != nil {
+		return err
+	}
+	if upstream.NoFailoverStatusCodes, err = normalizeStatusCodes(upstream.NoFailoverStatusCodes); err != nil {
+		return err
+	}
+	upstream.ResponseModelRewrite = normalizeResponseModelRewrite(upstream.ResponseModelRewrite)
+	if upstream.ModelTimeouts, err = normalizeModelTimeouts(upstream.ModelTimeouts); err != nil {
+		return err
+	}
+	if upstream.ExtraHeaders, err = normalizeExtraHeaders(upstream.ExtraHeaders); err != nil {
+		return err
+	}
+	if upstream.CanaryPercent, err = normalizeCanaryPercent(upstream.CanaryPercent); err != nil {
+		return err
+	}
+	if upstream.LogSampleRate, err = normalizeLogSampleRate(upstream.LogSampleRate); err != nil {
+		return err
+	}
+	if upstream.ConnectTimeout, err = normalizeChannelTimeout("connectTimeout", &upstream.ConnectTimeout); err != nil {
+		return err
+	}
+	if upstream.ResponseTimeout, err = normalizeChannelTimeout("responseTimeout", &upstream.ResponseTimeout); err != nil {
+		return err
+	}
+	if upstream.ProxyURL, err = normalizeProxyURL(&upstream.ProxyURL); err != nil {
+		return err
+	}
 	upstream.BaseURLs = deduplicateBaseURLs(upstream.BaseURLs)
 
 	cm.config.ResponsesUpstream = append(cm.config.ResponsesUpstream, upstream)
@@ -64,6 +98,50 @@ func (cm *ConfigManager) UpdateResponsesUpstream(index int, updates UpstreamUpda
 	if index < 0 || index >= len(cm.config.ResponsesUpstream) {
 		return false, fmt.Errorf("无效的 Responses 上游索引: %d", index)
 	}
+	if err := validateResponseSchemaUpdate(updates.ResponseSchema); err != nil {
+		return false, err
+	}
+	keySource, err := normalizeKeySource(updates.KeySource)
+	if err != nil {
+		return false, err
+	}
+	failoverCodes, err := normalizeStatusCodes(updates.FailoverStatusCodes)
+	if err != nil {
+		return false, err
+	}
+	noFailoverCodes, err := normalizeStatusCodes(updates.NoFailoverStatusCodes)
+	if err != nil {
+		return false, err
+	}
+	modelTimeouts, err := normalizeModelTimeouts(updates.ModelTimeouts)
+	if err != nil {
+		return false, err
+	}
+	extraHeaders, err := normalizeExtraHeaders(updates.ExtraHeaders)
+	if err != nil {
+		return false, err
+	}
+	if updates.CanaryPercent != nil {
+		if _, err := normalizeCanaryPercent(*updates.CanaryPercent); err != nil {
+			return false, err
+		}
+	}
+	logSampleRate, err := normalizeLogSampleRate(updates.LogSampleRate)
+	if err != nil {
+		return false, err
+	}
+	connectTimeout, err := normalizeChannelTimeout("connectTimeout", updates.ConnectTimeout)
+	if err != nil {
+		return false, err
+	}
+	responseTimeout, err := normalizeChannelTimeout("responseTimeout", updates.ResponseTimeout)
+	if err != nil {
+		return false, err
+	}
+	proxyURL, err := normalizeProxyURL(updates.ProxyURL)
+	if err != nil {
+		return false, err
+	}
 
 	upstream := &cm.config.ResponsesUpstream[index]
 
@@ -100,10 +178,15 @@ func (cm *ConfigManager) UpdateResponsesUpstream(index int, updates UpstreamUpda
 				log.Printf("[Config-Upstream] Responses 渠道 [%d] %s 已从暂停状态自动激活（单 key 更换）", index, upstream.Name)
 			}
 		}
-		upstream.APIKeys = deduplicateStrings(updates.APIKeys)
+		keys := deduplicateStrings(updates.APIKeys)
+		if !slices.Equal(keys, upstream.APIKeys) {
+			upstream.CanonicalKeyOrder = nil // 手动修改后的密钥列表即为新的规范顺序
+		}
+		upstream.APIKeys = keys
 	}
 	if updates.ModelMapping != nil {
 		upstream.ModelMapping = updates.ModelMapping
+		upstream.ModelMappingChains = updates.ModelMappingChains
 	}
 	if updates.InsecureSkipVerify != nil {
 		upstream.InsecureSkipVerify = *updates.InsecureSkipVerify
@@ -123,6 +206,69 @@ func (cm *ConfigManager) UpdateResponsesUpstream(index int, updates UpstreamUpda
 	if updates.LowQuality != nil {
 		upstream.LowQuality = *updates.LowQuality
 	}
+	if updates.ResponseSchema != nil {
+		upstream.ResponseSchema = normalizeResponseSchema(updates.ResponseSchema)
+	}
+	if updates.SupportedModels != nil {
+		upstream.SupportedModels = normalizeSupportedModels(updates.SupportedModels)
+	}
+	if updates.MaxOutputTokensClamp != nil {
+		upstream.MaxOutputTokensClamp = max(*updates.MaxOutputTokensClamp, 0)
+	}
+	if updates.KeySelection != nil {
+		upstream.KeySelection = *updates.KeySelection
+	}
+	if updates.MaxRequestBodySize != nil {
+		upstream.MaxRequestBodySize = max(*updates.MaxRequestBodySize, 0)
+	}
+	if updates.AllowedBetas != nil {
+		upstream.AllowedBetas = normalizeSupportedModels(updates.AllowedBetas)
+	}
+	if updates.KeySource != nil {
+		upstream.KeySource = keySource
+	}
+	if updates.FailoverStatusCodes != nil {
+		upstream.FailoverStatusCodes = failoverCodes
+	}
+	if updates.NoFailoverStatusCodes != nil {
+		upstream.NoFailoverStatusCodes = noFailoverCodes
+	}
+	if updates.ResponseModelRewrite != nil {
+		upstream.ResponseModelRewrite = normalizeResponseModelRewrite(updates.ResponseModelRewrite)
+	}
+	if updates.DisableKeyProbe != nil {
+		upstream.DisableKeyProbe = *updates.DisableKeyProbe
+	}
+	if updates.StripCacheControl != nil {
+		upstream.StripCacheControl = *updates.StripCacheControl
+	}
+	if updates.DailyRequestLimit != nil {
+		upstream.DailyRequestLimit = max(*updates.DailyRequestLimit, 0)
+	}
+	if updates.DailyTokenLimit != nil {
+		upstream.DailyTokenLimit = max(*updates.DailyTokenLimit, 0)
+	}
+	if updates.ModelTimeouts != nil {
+		upstream.ModelTimeouts = modelTimeouts
+	}
+	if updates.ExtraHeaders != nil {
+		upstream.ExtraHeaders = extraHeaders
+	}
+	if updates.CanaryPercent != nil {
+		upstream.CanaryPercent = *updates.CanaryPercent
+	}
+	if updates.LogSampleRate != nil {
+		upstream.LogSampleRate = logSampleRate
+	}
+	if updates.ConnectTimeout != nil {
+		upstream.ConnectTimeout = connectTimeout
+	}
+	if updates.ResponseTimeout != nil {
+		upstream.ResponseTimeout = responseTimeout
+	}
+	if updates.ProxyURL != nil {
+		upstream.ProxyURL = proxyURL
+	}
 
 	if err := cm.saveConfigLocked(cm.config); err != nil {
 		return false, err
@@ -160,6 +306,8 @@ func (cm *ConfigManager) AddResponsesAPIKey(index int, apiKey string) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	apiKey = cm.resolveKeyParamLocked(apiKey)
+
 	if index < 0 || index >= len(cm.config.ResponsesUpstream) {
 		return fmt.Errorf("无效的上游索引: %d", index)
 	}
@@ -186,6 +334,8 @@ func (cm *ConfigManager) RemoveResponsesAPIKey(index int, apiKey string) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	apiKey = cm.resolveKeyParamLocked(apiKey)
+
 	if index < 0 || index >= len(cm.config.ResponsesUpstream) {
 		return fmt.Errorf("无效的上游索引: %d", index)
 	}
@@ -218,6 +368,13 @@ func (cm *ConfigManager) GetNextResponsesAPIKey(upstream *UpstreamConfig, failed
 	return cm.getNextAPIKeyRoundRobin("responses", upstream, failedKeys)
 }
 
+// GetResponsesLoadBalance 获取 Responses 负载均衡策略
+func (cm *ConfigManager) GetResponsesLoadBalance() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.config.ResponsesLoadBalance
+}
+
 // SetResponsesLoadBalance 设置 Responses 负载均衡策略
 func (cm *ConfigManager) SetResponsesLoadBalance(strategy string) error {
 	cm.mu.Lock()
@@ -242,6 +399,8 @@ func (cm *ConfigManager) MoveResponsesAPIKeyToTop(upstreamIndex int, apiKey stri
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	apiKey = cm.resolveKeyParamLocked(apiKey)
+
 	if upstreamIndex < 0 || upstreamIndex >= len(cm.config.ResponsesUpstream) {
 		return fmt.Errorf("无效的上游索引: %d", upstreamIndex)
 	}
@@ -260,6 +419,7 @@ func (cm *ConfigManager) MoveResponsesAPIKeyToTop(upstreamIndex int, apiKey stri
 	}
 
 	upstream.APIKeys = append([]string{apiKey}, append(upstream.APIKeys[:index], upstream.APIKeys[index+1:]...)...)
+	upstream.CanonicalKeyOrder = nil // 手动调整后的顺序即为新的规范顺序
 	return cm.saveConfigLocked(cm.config)
 }
 
@@ -268,6 +428,8 @@ func (cm *ConfigManager) MoveResponsesAPIKeyToBottom(upstreamIndex int, apiKey s
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	apiKey = cm.resolveKeyParamLocked(apiKey)
+
 	if upstreamIndex < 0 || upstreamIndex >= len(cm.config.ResponsesUpstream) {
 		return fmt.Errorf("无效的上游索引: %d", upstreamIndex)
 	}
@@ -287,6 +449,7 @@ func (cm *ConfigManager) MoveResponsesAPIKeyToBottom(upstreamIndex int, apiKey s
 
 	upstream.APIKeys = append(upstream.APIKeys[:index], upstream.APIKeys[index+1:]...)
 	upstream.APIKeys = append(upstream.APIKeys, apiKey)
+	upstream.CanonicalKeyOrder = nil // 手动调整后的顺序即为新的规范顺序
 	return cm.saveConfigLocked(cm.config)
 }
 
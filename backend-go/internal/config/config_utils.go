@@ -1,9 +1,14 @@
 package config
 
 import (
-	"sort"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
 )
 
 // ============== 工具函数 ==============
@@ -41,11 +46,14 @@ func deduplicateBaseURLs(urls []string) []string {
 	return result
 }
 
+// LoadBalanceCheapest 成本优先策略：在支持请求模型的健康渠道中优先选择预估成本最低的渠道
+const LoadBalanceCheapest = "cheapest"
+
 // validateLoadBalanceStrategy 验证负载均衡策略
 func validateLoadBalanceStrategy(strategy string) error {
-	// 只接受 failover 策略（round-robin 和 random 已移除）
+	// 接受 failover 与 cheapest 策略（round-robin 和 random 已移除）
 	// 为兼容旧配置，仍允许旧值但静默忽略
-	if strategy != "failover" && strategy != "round-robin" && strategy != "random" {
+	if strategy != "failover" && strategy != LoadBalanceCheapest && strategy != "round-robin" && strategy != "random" {
 		return &ConfigError{Message: "无效的负载均衡策略: " + strategy}
 	}
 	return nil
@@ -64,38 +72,37 @@ func (e *ConfigError) Error() string {
 
 // RedirectModel 模型重定向
 func RedirectModel(model string, upstream *UpstreamConfig) string {
-	if upstream.ModelMapping == nil || len(upstream.ModelMapping) == 0 {
-		return model
-	}
-
-	// 直接匹配（精确匹配优先）
-	if mapped, ok := upstream.ModelMapping[model]; ok {
-		return mapped
+	// 精确匹配优先，其次按源模型长度从长到短模糊匹配
+	if source, ok := matchModelMappingSource(model, upstream.ModelMapping); ok {
+		return upstream.ModelMapping[source]
 	}
+	return model
+}
 
-	// 模糊匹配：按源模型长度从长到短排序，确保最长匹配优先
-	// 例如：同时配置 "codex" 和 "gpt-5.1-codex" 时，"gpt-5.1-codex" 应该先匹配
-	type mapping struct {
-		source string
-		target string
+// RewriteResponseModel 按渠道 ResponseModelRewrite 改写上游响应中的模型名（精确匹配，未命中时原样返回）
+func (u *UpstreamConfig) RewriteResponseModel(model string) (string, bool) {
+	if u == nil || model == "" {
+		return model, false
 	}
-	mappings := make([]mapping, 0, len(upstream.ModelMapping))
-	for source, target := range upstream.ModelMapping {
-		mappings = append(mappings, mapping{source, target})
+	if rewritten, ok := u.ResponseModelRewrite[model]; ok && rewritten != model {
+		return rewritten, true
 	}
-	// 按源模型长度降序排序
-	sort.Slice(mappings, func(i, j int) bool {
-		return len(mappings[i].source) > len(mappings[j].source)
-	})
+	return model, false
+}
 
-	// 按排序后的顺序进行模糊匹配
-	for _, m := range mappings {
-		if strings.Contains(model, m.source) || strings.Contains(m.source, model) {
-			return m.target
+// normalizeResponseModelRewrite 清理响应模型改写表：去除空白与空项，空表返回 nil（清除配置）
+func normalizeResponseModelRewrite(rewrite map[string]string) map[string]string {
+	cleaned := make(map[string]string, len(rewrite))
+	for from, to := range rewrite {
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if from != "" && to != "" {
+			cleaned[from] = to
 		}
 	}
-
-	return model
+	if len(cleaned) == 0 {
+		return nil
+	}
+	return cleaned
 }
 
 // ============== 渠道状态与优先级辅助函数 ==============
@@ -147,10 +154,69 @@ func (u *UpstreamConfig) Clone() *UpstreamConfig {
 			cloned.ModelMapping[k] = v
 		}
 	}
+	if u.ModelMappingChains != nil {
+		cloned.ModelMappingChains = make(map[string][]string, len(u.ModelMappingChains))
+		for k, v := range u.ModelMappingChains {
+			cloned.ModelMappingChains[k] = append([]string(nil), v...)
+		}
+	}
 	if u.PromotionUntil != nil {
 		t := *u.PromotionUntil
 		cloned.PromotionUntil = &t
 	}
+	if u.LogSampleRate != nil {
+		rate := *u.LogSampleRate
+		cloned.LogSampleRate = &rate
+	}
+	if u.ResponseSchema != nil {
+		cloned.ResponseSchema = append(json.RawMessage(nil), u.ResponseSchema...)
+	}
+	if u.SupportedModels != nil {
+		cloned.SupportedModels = make([]string, len(u.SupportedModels))
+		copy(cloned.SupportedModels, u.SupportedModels)
+	}
+	if u.AllowedBetas != nil {
+		cloned.AllowedBetas = make([]string, len(u.AllowedBetas))
+		copy(cloned.AllowedBetas, u.AllowedBetas)
+	}
+	if u.FailoverStatusCodes != nil {
+		cloned.FailoverStatusCodes = slices.Clone(u.FailoverStatusCodes)
+	}
+	if u.NoFailoverStatusCodes != nil {
+		cloned.NoFailoverStatusCodes = slices.Clone(u.NoFailoverStatusCodes)
+	}
+	if u.ResponseModelRewrite != nil {
+		cloned.ResponseModelRewrite = make(map[string]string, len(u.ResponseModelRewrite))
+		for k, v := range u.ResponseModelRewrite {
+			cloned.ResponseModelRewrite[k] = v
+		}
+	}
+	if u.ModelTimeouts != nil {
+		cloned.ModelTimeouts = make(map[string]string, len(u.ModelTimeouts))
+		for k, v := range u.ModelTimeouts {
+			cloned.ModelTimeouts[k] = v
+		}
+	}
+	if u.ExtraHeaders != nil {
+		cloned.ExtraHeaders = make(map[string]string, len(u.ExtraHeaders))
+		for k, v := range u.ExtraHeaders {
+			cloned.ExtraHeaders[k] = v
+		}
+	}
+	if u.KeySource != nil {
+		source := *u.KeySource
+		cloned.KeySource = &source
+	}
+	if u.CanonicalKeyOrder != nil {
+		cloned.CanonicalKeyOrder = make([]string, len(u.CanonicalKeyOrder))
+		copy(cloned.CanonicalKeyOrder, u.CanonicalKeyOrder)
+	}
+	if u.DrainingKeys != nil {
+		cloned.DrainingKeys = make(map[string]time.Time, len(u.DrainingKeys))
+		for k, v := range u.DrainingKeys {
+			cloned.DrainingKeys[k] = v
+		}
+	}
 
 	return &cloned
 }
@@ -181,3 +247,82 @@ func (u *UpstreamConfig) GetAllBaseURLs() []string {
 	}
 	return nil
 }
+
+// validateResponseSchemaUpdate 校验更新中的响应 JSON Schema（null 表示清除，无需校验）
+func validateResponseSchemaUpdate(raw json.RawMessage) error {
+	if raw == nil || isJSONNull(raw) {
+		return nil
+	}
+	if _, err := utils.ParseJSONSchema(raw); err != nil {
+		return fmt.Errorf("无效的 responseSchema: %w", err)
+	}
+	return nil
+}
+
+// normalizeResponseSchema 规范化响应 JSON Schema：null 转为 nil（清除配置）
+func normalizeResponseSchema(raw json.RawMessage) json.RawMessage {
+	if isJSONNull(raw) {
+		return nil
+	}
+	return append(json.RawMessage(nil), raw...)
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// normalizeSupportedModels 清理支持模型列表（也用于 allowedBetas）：去除空白项与重复项，空列表返回 nil（支持所有模型）
+func normalizeSupportedModels(models []string) []string {
+	cleaned := make([]string, 0, len(models))
+	for _, m := range models {
+		if m = strings.TrimSpace(m); m != "" {
+			cleaned = append(cleaned, m)
+		}
+	}
+	if len(cleaned) == 0 {
+		return nil
+	}
+	return deduplicateStrings(cleaned)
+}
+
+// SupportsModel 判断渠道是否支持指定模型
+// 未配置 SupportedModels 或未指定模型时视为支持；同时匹配原始模型名与重定向后的模型名
+func (u *UpstreamConfig) SupportsModel(model string) bool {
+	if len(u.SupportedModels) == 0 || model == "" {
+		return true
+	}
+	redirected := RedirectModel(model, u)
+	for _, pattern := range u.SupportedModels {
+		if matchModelPattern(pattern, model) || (redirected != model && matchModelPattern(pattern, redirected)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchModelPattern 模型名通配匹配（不区分大小写，* 匹配任意字符序列）
+func matchModelPattern(pattern, model string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	model = strings.ToLower(model)
+	if pattern == "*" {
+		return true
+	}
+	if !strings.Contains(pattern, "*") {
+		return pattern == model
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(model, parts[0]) {
+		return false
+	}
+	rest := model[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return strings.HasSuffix(rest, last)
+}
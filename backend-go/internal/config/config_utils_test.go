@@ -0,0 +1,65 @@
+package config
+
+import "testing"
+
+func TestUpstreamConfig_SupportsModel(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream UpstreamConfig
+		model    string
+		want     bool
+	}{
+		{"empty list is wildcard", UpstreamConfig{}, "claude-3-opus", true},
+		{"empty model always allowed", UpstreamConfig{SupportedModels: []string{"claude-3-haiku"}}, "", true},
+		{"exact match", UpstreamConfig{SupportedModels: []string{"claude-3-haiku"}}, "claude-3-haiku", true},
+		{"case insensitive", UpstreamConfig{SupportedModels: []string{"Claude-3-Haiku"}}, "claude-3-haiku", true},
+		{"no match", UpstreamConfig{SupportedModels: []string{"claude-3-haiku"}}, "claude-3-opus", false},
+		{"prefix glob", UpstreamConfig{SupportedModels: []string{"claude-*-opus*"}}, "claude-3-opus-20240229", true},
+		{"glob no match", UpstreamConfig{SupportedModels: []string{"*haiku"}}, "claude-3-opus", false},
+		{"star matches all", UpstreamConfig{SupportedModels: []string{"*"}}, "anything", true},
+		{
+			"redirected model",
+			UpstreamConfig{SupportedModels: []string{"gpt-4o"}, ModelMapping: map[string]string{"opus": "gpt-4o"}},
+			"claude-3-opus",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.upstream.SupportsModel(tt.model); got != tt.want {
+			t.Errorf("%s: SupportsModel(%q) = %v, want %v", tt.name, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSupportedModels(t *testing.T) {
+	if got := normalizeSupportedModels([]string{" ", ""}); got != nil {
+		t.Errorf("blank list should normalize to nil, got %v", got)
+	}
+	got := normalizeSupportedModels([]string{" a ", "b", "a"})
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("got %v, want [a b]", got)
+	}
+}
+
+func TestUpstreamConfig_RewriteResponseModel(t *testing.T) {
+	u := &UpstreamConfig{ResponseModelRewrite: normalizeResponseModelRewrite(map[string]string{
+		" internal-x ": " claude-3-5-sonnet ",
+		"empty":        "",
+		"same":         "same",
+	})}
+
+	if got, ok := u.RewriteResponseModel("internal-x"); !ok || got != "claude-3-5-sonnet" {
+		t.Fatalf("RewriteResponseModel(internal-x) = %q, %v", got, ok)
+	}
+	for _, model := range []string{"internal-x-2", "empty", "same", ""} {
+		if got, ok := u.RewriteResponseModel(model); ok || got != model {
+			t.Fatalf("RewriteResponseModel(%q) = %q, %v; want unchanged", model, got, ok)
+		}
+	}
+	if got, ok := (*UpstreamConfig)(nil).RewriteResponseModel("internal-x"); ok || got != "internal-x" {
+		t.Fatalf("nil upstream should not rewrite")
+	}
+	if normalizeResponseModelRewrite(map[string]string{"": "x"}) != nil {
+		t.Fatalf("empty rewrite table should normalize to nil")
+	}
+}
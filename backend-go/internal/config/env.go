@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 type EnvConfig struct {
@@ -15,32 +16,140 @@ type EnvConfig struct {
 	EnableResponseLogs bool
 	QuietPollingLogs   bool   // 静默轮询端点日志
 	RawLogOutput       bool   // 原始日志输出（不缩进、不截断、不重排序）
+	LogRedact          bool   // 日志内容脱敏：消息文本替换为 [REDACTED:<n chars>]，保留结构
+	LogRedactPII       bool   // 日志 PII 正则脱敏（邮箱、银行卡号），独立于 LogRedact
 	SSEDebugLevel      string // SSE 调试级别: off, summary, full
+	// 流式心跳间隔（秒），超过该时间未转发事件时发送 SSE 注释心跳；0 表示禁用
+	StreamHeartbeatInterval int
+	// 流式事件修复模式：补全缺失的 content_block_start/stop，保证 Anthropic 事件序列合法
+	StreamRepairMode bool
+	// 空流故障转移：Messages 流在出现内容之前结束时视为失败并切换到下一个密钥/渠道
+	EmptyStreamFailover bool
+	// 错误结构响应体故障转移：上游返回 2xx 但响应体（流式为首个事件）是 {"error":...} 且无内容时视为失败
+	ErrorBodyFailover bool
+	// count_tokens 估算标记：启用后 count_tokens 响应带 X-Proxy-Token-Count-Estimated: true，提示结果为本地估算
+	CountTokensEstimateHeader bool
+	// 流式刷新合并窗口（毫秒，STREAM_FLUSH_BATCH_MS），窗口内的多次 Flush 合并为一次，usage/终止事件仍立即刷新；0 表示每个事件都立即刷新
+	StreamFlushInterval int
+	// 流式刷新合并的最大待刷新事件数（STREAM_FLUSH_BATCH_EVENTS），达到后立即刷新；0 表示仅按时间窗口合并
+	StreamFlushMaxEvents int
+	// 关闭时等待进行中流式响应结束的最长时间（秒，SHUTDOWN_DRAIN_TIMEOUT），排空期间新请求返回 503；0 表示不等待
+	ShutdownDrainTimeout int
+	// Messages 请求体落盘阈值（字节，REQUEST_BODY_SPOOL_THRESHOLD_MB），超过时写入临时文件而非内存缓冲；0 表示禁用
+	RequestBodySpoolThreshold int64
 
 	RequestTimeout     int
 	MaxRequestBodySize int64 // 请求体最大大小 (字节)，由 MB 配置转换
 	EnableCORS         bool
 	CORSOrigin         string
+	// 请求防重放配置（客户端通过 X-Proxy-Nonce 提供唯一值，窗口内重复使用即拒绝）
+	RequireNonce    bool // 是否要求代理端点携带 nonce
+	NonceWindow     int  // nonce 防重放窗口（秒）
+	NonceMaxEntries int  // 窗口内记录的 nonce 数量上限，超出后淘汰最旧记录
 	// 指标配置
 	MetricsWindowSize       int     // 滑动窗口大小
 	MetricsFailureThreshold float64 // 失败率阈值
+	MetricsStaleKeyTTL      int     // 过期 Key 指标清理阈值（小时，0 表示禁用清理）
+	// 熔断退避配置
+	CircuitBackoffMaxMultiplier int     // OpenTimeout 指数退避最大倍数（1 表示不退避）
+	CircuitBackoffJitter        float64 // 退避抖动比例（0-1）
+	CircuitCycleResetCooldown   int     // Closed 持续多久后重置熔断周期计数（分钟）
+	// 新渠道流量爬坡配置
+	ChannelRampRequests    int     // 新渠道被视为已验证所需的成功请求数（0 表示禁用）
+	ChannelRampMinFraction float64 // 爬坡起点流量比例（0-1）
+	// 会话亲和抖动检测配置
+	AffinityThrashSwitches int // 窗口内亲和渠道切换多少次视为抖动（0 表示禁用）
+	AffinityThrashWindow   int // 抖动检测窗口（秒）
+	AffinityPinCooldown    int // 抖动会话固定到当前渠道的时长（秒）
+	// 缓存感知亲和配置
+	CacheAffinityStickiness float64 // 亲和粘性权重（0-1，0 表示禁用）
+	// 非故障转移错误率自动暂停配置
+	NonFailoverSuspendRate        float64 // 非故障转移错误占比达到该值时自动暂停渠道（0 表示禁用）
+	NonFailoverSuspendMinRequests int     // 统计窗口内的最小请求数
+	NonFailoverSuspendWindow      int     // 统计窗口（秒）
+	// 密钥排空配置
+	KeyDrainGracePeriod int // 排空密钥的默认宽限期（秒），到期后自动删除
+	// 规范密钥顺序恢复配置
+	KeyOrderResetInterval int // 渠道无配额降级事件超过该时长后恢复规范密钥顺序（秒，0 表示禁用）
+	// 全局重试预算配置
+	RetryBudgetPerSecond float64 // 每秒允许的故障转移重试次数（0 表示不限制）
+	// 全局故障转移并发配置
+	MaxConcurrentFailovers int // 全局同时在途的故障转移尝试上限（0 表示不限制）
+	FailoverSlotWait       int // 等待故障转移槽位的最长时间（秒）
+	// 渠道级故障转移退避配置
+	FailoverDelayMs    int // 渠道真实失败后、尝试下一个渠道前的基础等待时间（毫秒，0 表示不等待）
+	FailoverDelayMaxMs int // 指数退避的等待上限（毫秒）
+	// 影子渠道配置
+	ShadowMaxConcurrency int // 同时在途的影子请求上限（已满时丢弃新的影子请求）
+	// 响应重新压缩配置（仅非流式响应）
+	ResponseCompression        bool // 客户端支持 gzip 时重新压缩已解压的上游响应
+	ResponseCompressionMinSize int  // 触发压缩的最小响应体大小（字节）
+	// 详细健康检查配置（/api/health/detailed?probe=true）
+	HealthProbeTimeout     int // 单个渠道连通性探测超时（秒）
+	HealthProbeConcurrency int // 并发探测的最大渠道数
+	// 后台密钥健康探测配置（探测超时复用 HealthProbeTimeout）
+	KeyProbeInterval int // 探测间隔（秒，0 表示禁用）
+	// 推理强度映射配置（格式: minimal=1024,low=4096,medium=10240,high=32768，空表示使用默认值）
+	ReasoningEffortBudgets string
 	// 指标持久化配置
-	MetricsPersistenceEnabled bool // 是否启用 SQLite 持久化
-	MetricsRetentionDays      int  // 数据保留天数（3-30）
+	MetricsPersistenceEnabled bool   // 是否启用 SQLite 持久化
+	MetricsRetentionDays      int    // 数据保留天数（3-30）
+	MetricsVacuumInterval     int    // 增量 VACUUM 间隔（小时，默认 0 表示禁用）
+	MetricsVacuumHours        string // 空间回收允许执行的本地时段（如 2-5，空表示不限）
+	// daily_stats 每日聚合时间（本地小时）与随机抖动窗口（± 分钟，每个实例独立随机，避免多实例同时聚合）
+	MetricsAggregateHour          int
+	MetricsAggregateJitterMinutes int
+	// 各表保留时长（request_records 使用 MetricsRetentionDays）
+	MetricsRequestLogRetentionHours int // request_logs 保留小时数
+	MetricsDailyStatsRetentionDays  int // daily_stats 保留天数（0 表示永久保留）
+	// 指标镜像（将请求指标记录额外 POST 到外部分析服务，URL 为空表示禁用）
+	MetricsMirrorURL           string
+	MetricsMirrorToken         string // 可选，以 Authorization: Bearer 发送
+	MetricsMirrorBatchSize     int    // 单次 POST 的最大记录数
+	MetricsMirrorFlushInterval int    // 最长发送间隔（秒）
+	// 渠道健康告警（Webhook URL 为空表示禁用）
+	AlertWebhookURL         string
+	AlertWebhookFormat      string // json（默认）或 slack
+	AlertMinHealthyChannels int    // 每种接口类型的最少健康渠道数（0 表示不检查）
+	AlertOnCircuitOpen      bool   // 渠道熔断时单独告警
+	AlertDebounce           int    // 同一告警的最小重复间隔（秒）
+	// Trace 亲和性（持久化复用指标 SQLite 存储，重启后保留会话渠道绑定）
+	TraceAffinityPersistenceEnabled bool
+	TraceAffinityMaxAge             int // 会话亲和最大存活时间（秒，0 表示不限制），续期不延长
+	// 客户端 IP 亲和（无会话标识时按客户端 IP + 模型保持渠道粘性）
+	IPAffinityTTL  int      // IP 亲和过期时间（秒，0 表示禁用）
+	TrustedProxies []string // 可信代理 IP/CIDR 列表，仅信任来自这些地址的 X-Forwarded-For
 	// HTTP 客户端配置
-	ResponseHeaderTimeout int // 等待响应头超时时间（秒）
+	ResponseHeaderTimeout       int  // 等待响应头超时时间（秒）
+	UpstreamMaxIdleConns        int  // 上游连接池最大空闲连接数（0 使用默认值）
+	UpstreamMaxIdleConnsPerHost int  // 上游连接池每主机最大空闲连接数（0 使用默认值）
+	UpstreamIdleConnTimeout     int  // 上游空闲连接保留时间（秒，0 使用默认值）
+	UpstreamHTTP2               bool // 是否尝试与上游协商 HTTP/2
+	KeepWarmConnections         bool // 是否定期向空闲渠道发送保活请求
+	KeepWarmInterval            int  // 连接保活间隔（秒）
+	WarmupOnStartup             bool // 启动时并发预热所有渠道 URL
+	WarmupTimeout               int  // 启动预热整体超时（秒）
+	WarmupConcurrency           int  // 启动预热并发数
+	// 请求抓包配置（调试用，CaptureDir 为空表示禁用）
+	CaptureDir        string  // 抓包文件目录
+	CaptureSampleRate float64 // 采样比例（0-1）
+	CaptureMaxSizeMB  int     // 抓包目录总大小上限（MB），超出后删除最旧的文件
 	// 日志文件相关配置
 	LogDir        string
 	LogFile       string
-	LogMaxSize    int  // 单个日志文件最大大小 (MB)
-	LogMaxBackups int  // 保留的旧日志文件最大数量
-	LogMaxAge     int  // 保留的旧日志文件最大天数
-	LogCompress   bool // 是否压缩旧日志文件
-	LogToConsole  bool // 是否同时输出到控制台
+	LogFormat     string // 日志输出格式: text（默认）| json
+	LogMaxSize    int    // 单个日志文件最大大小 (MB)
+	LogMaxBackups int    // 保留的旧日志文件最大数量
+	LogMaxAge     int    // 保留的旧日志文件最大天数
+	LogCompress   bool   // 是否压缩旧日志文件
+	LogToConsole  bool   // 是否同时输出到控制台
 	// 计费配置
 	SweAgentBillingURL    string // swe-agent 计费服务 URL
 	PreAuthAmountCents    int64  // 预授权金额 (cents)
 	PricingUpdateInterval string // 价格表更新间隔
+	PricingURL            string // 远程价格表 URL（空表示 LiteLLM 价格表，none 表示不拉取）
+	PricingFile           string // 本地价格表文件（同一模型优先于远程价格表，变化时自动重载）
+	BillingLedgerFile     string // 计费事件审计日志文件路径（空表示不记录）
 }
 
 // NewEnvConfig 创建环境配置
@@ -61,20 +170,119 @@ func NewEnvConfig() *EnvConfig {
 		EnableResponseLogs: getEnv("ENABLE_RESPONSE_LOGS", "true") != "false",
 		QuietPollingLogs:   getEnv("QUIET_POLLING_LOGS", "true") != "false",
 		RawLogOutput:       getEnv("RAW_LOG_OUTPUT", "false") == "true",
+		LogRedact:          getEnv("LOG_REDACT", "false") == "true",
+		LogRedactPII:       getEnv("LOG_REDACT_PII", "false") == "true",
 		SSEDebugLevel:      getEnv("SSE_DEBUG_LEVEL", "off"),
+		// 流式心跳（默认禁用）
+		StreamHeartbeatInterval: clampInt(getEnvAsInt("STREAM_HEARTBEAT_INTERVAL", 0), 0, 300),
+		StreamRepairMode:        getEnv("STREAM_REPAIR_MODE", "false") == "true",
+		EmptyStreamFailover:     getEnv("EMPTY_STREAM_FAILOVER", "false") == "true",
+		ErrorBodyFailover:       getEnv("ERROR_BODY_FAILOVER", "false") == "true",
+		// count_tokens 估算标记（默认禁用）
+		CountTokensEstimateHeader: getEnv("COUNT_TOKENS_ESTIMATE_HEADER", "false") == "true",
+		// 流式刷新合并（默认禁用；STREAM_FLUSH_INTERVAL / STREAM_FLUSH_MAX_EVENTS 为兼容旧配置的别名）
+		StreamFlushInterval:  clampInt(getEnvAsInt("STREAM_FLUSH_BATCH_MS", getEnvAsInt("STREAM_FLUSH_INTERVAL", 0)), 0, 1000),
+		StreamFlushMaxEvents: clampInt(getEnvAsInt("STREAM_FLUSH_BATCH_EVENTS", getEnvAsInt("STREAM_FLUSH_MAX_EVENTS", 32)), 0, 1000),
+		// 关闭排空（默认最多等待 30 秒）
+		ShutdownDrainTimeout: clampInt(getEnvAsInt("SHUTDOWN_DRAIN_TIMEOUT", 30), 0, 3600),
+		// 大请求体落盘（默认禁用）
+		RequestBodySpoolThreshold: max(getEnvAsInt64("REQUEST_BODY_SPOOL_THRESHOLD_MB", 0), 0) * 1024 * 1024,
 
 		RequestTimeout:     getEnvAsInt("REQUEST_TIMEOUT", 300000),
 		MaxRequestBodySize: getEnvAsInt64("MAX_REQUEST_BODY_SIZE_MB", 50) * 1024 * 1024, // MB 转换为字节
 		EnableCORS:         getEnv("ENABLE_CORS", "true") != "false",
 		CORSOrigin:         getEnv("CORS_ORIGIN", "*"),
+		// 请求防重放（默认禁用）
+		RequireNonce:    getEnv("REQUIRE_NONCE", "false") == "true",
+		NonceWindow:     clampInt(getEnvAsInt("NONCE_WINDOW", 300), 1, 86400),
+		NonceMaxEntries: clampInt(getEnvAsInt("NONCE_MAX_ENTRIES", 100000), 1000, 10000000),
 		// 指标配置
 		MetricsWindowSize:       getEnvAsInt("METRICS_WINDOW_SIZE", 10),
 		MetricsFailureThreshold: getEnvAsFloat("METRICS_FAILURE_THRESHOLD", 0.5),
+		MetricsStaleKeyTTL:      clampInt(getEnvAsInt("METRICS_STALE_KEY_TTL", 48), 0, 8760),
+		// 熔断退避配置
+		CircuitBackoffMaxMultiplier: clampInt(getEnvAsInt("CIRCUIT_BACKOFF_MAX_MULTIPLIER", 1), 1, 64),
+		CircuitBackoffJitter:        getEnvAsFloat("CIRCUIT_BACKOFF_JITTER", 0.1),
+		CircuitCycleResetCooldown:   clampInt(getEnvAsInt("CIRCUIT_CYCLE_RESET_COOLDOWN", 30), 1, 1440),
+		// 新渠道流量爬坡配置（默认禁用）
+		ChannelRampRequests:    clampInt(getEnvAsInt("CHANNEL_RAMP_REQUESTS", 0), 0, 10000),
+		ChannelRampMinFraction: getEnvAsFloat("CHANNEL_RAMP_MIN_FRACTION", 0.1),
+		// 会话亲和抖动检测配置（默认禁用）
+		AffinityThrashSwitches: clampInt(getEnvAsInt("AFFINITY_THRASH_SWITCHES", 0), 0, 100),
+		AffinityThrashWindow:   clampInt(getEnvAsInt("AFFINITY_THRASH_WINDOW", 300), 10, 3600),
+		AffinityPinCooldown:    clampInt(getEnvAsInt("AFFINITY_PIN_COOLDOWN", 600), 10, 1800),
+		// 缓存感知亲和（默认禁用）
+		CacheAffinityStickiness: min(max(getEnvAsFloat("CACHE_AFFINITY_STICKINESS", 0), 0), 1),
+		// 非故障转移错误率自动暂停（默认禁用）
+		NonFailoverSuspendRate:        getEnvAsFloat("NON_FAILOVER_SUSPEND_RATE", 0),
+		NonFailoverSuspendMinRequests: clampInt(getEnvAsInt("NON_FAILOVER_SUSPEND_MIN_REQUESTS", 20), 1, 10000),
+		NonFailoverSuspendWindow:      clampInt(getEnvAsInt("NON_FAILOVER_SUSPEND_WINDOW", 600), 60, 86400),
+		// 密钥排空配置
+		KeyDrainGracePeriod: clampInt(getEnvAsInt("KEY_DRAIN_GRACE_PERIOD", 300), 10, 86400),
+		// 规范密钥顺序恢复（默认禁用，配额降级永久生效）
+		KeyOrderResetInterval: clampInt(getEnvAsInt("KEY_ORDER_RESET_INTERVAL", 0), 0, 604800),
+		// 全局重试预算配置（默认不限制）
+		RetryBudgetPerSecond: getEnvAsFloat("RETRY_BUDGET_PER_SECOND", 0),
+		// 全局故障转移并发配置（默认不限制）
+		MaxConcurrentFailovers: clampInt(getEnvAsInt("MAX_CONCURRENT_FAILOVERS", 0), 0, 10000),
+		FailoverSlotWait:       clampInt(getEnvAsInt("FAILOVER_SLOT_WAIT", 10), 1, 300),
+		// 渠道级故障转移退避（默认不等待）
+		FailoverDelayMs:    clampInt(getEnvAsInt("FAILOVER_DELAY_MS", 0), 0, 10000),
+		FailoverDelayMaxMs: clampInt(getEnvAsInt("FAILOVER_DELAY_MAX_MS", 2000), 0, 60000),
+		// 影子渠道配置
+		ShadowMaxConcurrency: clampInt(getEnvAsInt("SHADOW_MAX_CONCURRENCY", 8), 1, 1000),
+		// 响应重新压缩（默认禁用）
+		ResponseCompression:        getEnv("RESPONSE_COMPRESSION", "false") == "true",
+		ResponseCompressionMinSize: clampInt(getEnvAsInt("RESPONSE_COMPRESSION_MIN_SIZE", 1024), 0, 100*1024*1024),
+		// 详细健康检查配置
+		HealthProbeTimeout:     clampInt(getEnvAsInt("HEALTH_PROBE_TIMEOUT", 5), 1, 60),
+		HealthProbeConcurrency: clampInt(getEnvAsInt("HEALTH_PROBE_CONCURRENCY", 8), 1, 64),
+		// 后台密钥健康探测（默认禁用）
+		KeyProbeInterval: clampInt(getEnvAsInt("KEY_PROBE_INTERVAL", 0), 0, 86400),
+		// 推理强度映射配置
+		ReasoningEffortBudgets: getEnv("REASONING_EFFORT_BUDGETS", ""),
 		// 指标持久化配置
-		MetricsPersistenceEnabled: getEnv("METRICS_PERSISTENCE_ENABLED", "true") != "false",
-		MetricsRetentionDays:      clampInt(getEnvAsInt("METRICS_RETENTION_DAYS", 7), 3, 30),
+		MetricsPersistenceEnabled:       getEnv("METRICS_PERSISTENCE_ENABLED", "true") != "false",
+		MetricsRetentionDays:            clampInt(getEnvAsInt("METRICS_RETENTION_DAYS", 7), 3, 30),
+		MetricsVacuumInterval:           clampInt(getEnvAsInt("METRICS_VACUUM_INTERVAL", 0), 0, 720),
+		MetricsVacuumHours:              getEnv("METRICS_VACUUM_HOURS", ""),
+		MetricsAggregateHour:            clampInt(getEnvAsInt("METRICS_AGGREGATE_HOUR", 2), 0, 23),
+		MetricsAggregateJitterMinutes:   clampInt(getEnvAsInt("METRICS_AGGREGATE_JITTER_MINUTES", 0), 0, 180),
+		MetricsRequestLogRetentionHours: clampInt(getEnvAsInt("METRICS_REQUEST_LOG_RETENTION_HOURS", 24), 1, 720),
+		MetricsDailyStatsRetentionDays:  clampInt(getEnvAsInt("METRICS_DAILY_STATS_RETENTION_DAYS", 365), 0, 3650),
+		// 指标镜像（默认禁用）
+		MetricsMirrorURL:           getEnv("METRICS_MIRROR_URL", ""),
+		MetricsMirrorToken:         getEnv("METRICS_MIRROR_TOKEN", ""),
+		MetricsMirrorBatchSize:     clampInt(getEnvAsInt("METRICS_MIRROR_BATCH_SIZE", 100), 1, 1000),
+		MetricsMirrorFlushInterval: clampInt(getEnvAsInt("METRICS_MIRROR_FLUSH_INTERVAL", 5), 1, 300),
+		// 渠道健康告警（默认禁用）
+		AlertWebhookURL:         getEnv("ALERT_WEBHOOK_URL", ""),
+		AlertWebhookFormat:      getEnv("ALERT_WEBHOOK_FORMAT", "json"),
+		AlertMinHealthyChannels: clampInt(getEnvAsInt("ALERT_MIN_HEALTHY_CHANNELS", 1), 0, 1000),
+		AlertOnCircuitOpen:      getEnv("ALERT_ON_CIRCUIT_OPEN", "true") != "false",
+		AlertDebounce:           clampInt(getEnvAsInt("ALERT_DEBOUNCE", 300), 1, 86400),
+		// Trace 亲和性（默认不持久化、不限制最大存活时间）
+		TraceAffinityPersistenceEnabled: getEnv("TRACE_AFFINITY_PERSISTENCE_ENABLED", "false") == "true",
+		TraceAffinityMaxAge:             clampInt(getEnvAsInt("TRACE_AFFINITY_MAX_AGE", 0), 0, 86400),
+		// 客户端 IP 亲和（默认禁用，TTL 不超过会话亲和的 30 分钟）
+		IPAffinityTTL:  clampInt(getEnvAsInt("IP_AFFINITY_TTL", 0), 0, 1800),
+		TrustedProxies: getEnvAsList("TRUSTED_PROXIES"),
 		// HTTP 客户端配置
 		ResponseHeaderTimeout: clampInt(getEnvAsInt("RESPONSE_HEADER_TIMEOUT", 60), 30, 120), // 30-120 秒
+		// 上游连接池（0 表示使用内置默认值：标准客户端 100/10/90 秒，流式客户端 200/20/120 秒）
+		UpstreamMaxIdleConns:        clampInt(getEnvAsInt("UPSTREAM_MAX_IDLE_CONNS", 0), 0, 10000),
+		UpstreamMaxIdleConnsPerHost: clampInt(getEnvAsInt("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 0), 0, 1000),
+		UpstreamIdleConnTimeout:     clampInt(getEnvAsInt("UPSTREAM_IDLE_CONN_TIMEOUT", 0), 0, 3600),
+		UpstreamHTTP2:               getEnv("UPSTREAM_HTTP2", "true") != "false",
+		KeepWarmConnections:         getEnv("KEEP_WARM_CONNECTIONS", "false") == "true",
+		KeepWarmInterval:            clampInt(getEnvAsInt("KEEP_WARM_INTERVAL", 30), 5, 85), // 需小于连接池 90 秒空闲超时
+		WarmupOnStartup:             getEnv("WARMUP_ON_STARTUP", "false") == "true",
+		WarmupTimeout:               clampInt(getEnvAsInt("WARMUP_TIMEOUT", 10), 1, 120),
+		WarmupConcurrency:           clampInt(getEnvAsInt("WARMUP_CONCURRENCY", 8), 1, 64),
+		// 请求抓包配置（默认禁用）
+		CaptureDir:        getEnv("CAPTURE_DIR", ""),
+		CaptureSampleRate: min(max(getEnvAsFloat("CAPTURE_SAMPLE_RATE", 1.0), 0), 1),
+		CaptureMaxSizeMB:  clampInt(getEnvAsInt("CAPTURE_MAX_SIZE_MB", 100), 1, 102400),
 		// 日志文件配置
 		LogDir:        getEnv("LOG_DIR", "logs"),
 		LogFile:       getEnv("LOG_FILE", "app.log"),
@@ -83,10 +291,14 @@ func NewEnvConfig() *EnvConfig {
 		LogMaxAge:     getEnvAsInt("LOG_MAX_AGE", 30),     // 默认保留 30 天
 		LogCompress:   getEnv("LOG_COMPRESS", "true") != "false",
 		LogToConsole:  getEnv("LOG_TO_CONSOLE", "true") != "false",
+		LogFormat:     strings.ToLower(strings.TrimSpace(getEnv("LOG_FORMAT", "text"))),
 		// 计费配置
 		SweAgentBillingURL:    getEnv("SWE_AGENT_BILLING_URL", ""),
 		PreAuthAmountCents:    getEnvAsInt64("PRE_AUTH_AMOUNT_CENTS", 500), // 默认 $5.00
 		PricingUpdateInterval: getEnv("PRICING_UPDATE_INTERVAL", "24h"),
+		PricingURL:            strings.TrimSpace(getEnv("PRICING_URL", "")),
+		PricingFile:           strings.TrimSpace(getEnv("PRICING_FILE", "")),
+		BillingLedgerFile:     getEnv("BILLING_LEDGER_FILE", ""),
 	}
 }
 
@@ -165,6 +377,17 @@ func getEnvAsFloat(key string, defaultValue float64) float64 {
 	return defaultValue
 }
 
+// getEnvAsList 获取逗号分隔的环境变量列表（忽略空项）
+func getEnvAsList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 // clampInt 将整数限制在指定范围内
 func clampInt(value, minVal, maxVal int) int {
 	if value < minVal {
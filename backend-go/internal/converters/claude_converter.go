@@ -44,6 +44,13 @@ func (c *ClaudeConverter) ToProviderRequest(sess *session.Session, req *types.Re
 		claudeReq["stop_sequences"] = req.Stop // Claude 使用 stop_sequences
 	}
 
+	// reasoning.effort -> thinking.budget_tokens
+	if req.Reasoning != nil {
+		if thinking := ReasoningEffortToClaudeThinking(req.Reasoning.Effort, req.MaxTokens); thinking != nil {
+			claudeReq["thinking"] = thinking
+		}
+	}
+
 	return claudeReq, nil
 }
 
@@ -0,0 +1,213 @@
+package converters
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+// ============== Claude tool_use/tool_result ↔ Responses function_call/function_call_output ==============
+//
+// 供 Messages 渠道路由到 Responses 上游使用（providers.ClaudeResponsesProvider）：
+// 请求方向 Claude → Responses，响应方向 Responses → Claude。
+// 工具调用 ID 原样保留：tool_use.id ↔ function_call.call_id，tool_result.tool_use_id ↔ function_call_output.call_id。
+// 参数在 Claude 侧为 JSON 对象（input），在 Responses 侧为 JSON 字符串（arguments）。
+
+// ClaudeToolsToResponsesTools 将 Claude 工具定义转换为 Responses function 工具
+func ClaudeToolsToResponsesTools(tools []types.ClaudeTool) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		item := map[string]interface{}{
+			"type":       "function",
+			"name":       tool.Name,
+			"parameters": tool.InputSchema,
+		}
+		if tool.Description != "" {
+			item["description"] = tool.Description
+		}
+		if tool.InputSchema == nil {
+			item["parameters"] = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// ClaudeToolUseToFunctionCall 将 tool_use 内容块转换为 function_call 项
+func ClaudeToolUseToFunctionCall(block map[string]interface{}) map[string]interface{} {
+	id, _ := block["id"].(string)
+	name, _ := block["name"].(string)
+	return map[string]interface{}{
+		"type":      "function_call",
+		"call_id":   id,
+		"name":      name,
+		"arguments": toolInputToArguments(block["input"]),
+	}
+}
+
+// ClaudeToolResultToFunctionCallOutput 将 tool_result 内容块转换为 function_call_output 项
+// content 为内容块数组时拼接其中的文本；is_error 在 Responses 中无对应字段，以 "Error: " 前缀保留语义
+func ClaudeToolResultToFunctionCallOutput(block map[string]interface{}) map[string]interface{} {
+	callID, _ := block["tool_use_id"].(string)
+	output := toolContentText(block["content"])
+	if isError, _ := block["is_error"].(bool); isError && !strings.HasPrefix(output, "Error: ") {
+		output = "Error: " + output
+	}
+	return map[string]interface{}{
+		"type":    "function_call_output",
+		"call_id": callID,
+		"output":  output,
+	}
+}
+
+// FunctionCallToClaudeToolUse 将 function_call 项转换为 tool_use 内容块（call_id 作为 tool_use.id）
+func FunctionCallToClaudeToolUse(item map[string]interface{}) map[string]interface{} {
+	callID, _ := item["call_id"].(string)
+	if callID == "" {
+		callID, _ = item["id"].(string)
+	}
+	name, _ := item["name"].(string)
+	arguments, _ := item["arguments"].(string)
+	return map[string]interface{}{
+		"type":  "tool_use",
+		"id":    callID,
+		"name":  name,
+		"input": argumentsToToolInput(arguments),
+	}
+}
+
+// ClaudeMessagesToResponsesInput 将 Claude 消息列表转换为 Responses input 项列表
+// 同一消息内的文本与工具块按原顺序拆分：连续的文本块合并为一个 message 项，
+// tool_use 转换为 function_call，tool_result 转换为 function_call_output
+func ClaudeMessagesToResponsesInput(messages []types.ClaudeMessage) []map[string]interface{} {
+	var items []map[string]interface{}
+	for _, msg := range messages {
+		textType := "input_text"
+		if msg.Role == "assistant" {
+			textType = "output_text"
+		}
+
+		var texts []map[string]interface{}
+		flushText := func() {
+			if len(texts) == 0 {
+				return
+			}
+			items = append(items, map[string]interface{}{
+				"type":    "message",
+				"role":    msg.Role,
+				"content": texts,
+			})
+			texts = nil
+		}
+
+		if s, ok := msg.Content.(string); ok {
+			if s != "" {
+				texts = append(texts, map[string]interface{}{"type": textType, "text": s})
+			}
+			flushText()
+			continue
+		}
+
+		for _, block := range claudeContentBlocks(msg.Content) {
+			switch blockType, _ := block["type"].(string); blockType {
+			case "text":
+				if text, _ := block["text"].(string); text != "" {
+					texts = append(texts, map[string]interface{}{"type": textType, "text": text})
+				}
+			case "tool_use":
+				flushText()
+				items = append(items, ClaudeToolUseToFunctionCall(block))
+			case "tool_result":
+				flushText()
+				items = append(items, ClaudeToolResultToFunctionCallOutput(block))
+			}
+		}
+		flushText()
+	}
+	return items
+}
+
+// ResponsesOutputToClaudeContent 将 Responses output 项转换为 Claude 响应内容块，返回是否包含 tool_use
+func ResponsesOutputToClaudeContent(output []map[string]interface{}) ([]types.ClaudeContent, bool) {
+	content := []types.ClaudeContent{}
+	hasToolUse := false
+	for _, item := range output {
+		switch itemType, _ := item["type"].(string); itemType {
+		case "function_call":
+			block := FunctionCallToClaudeToolUse(item)
+			content = append(content, types.ClaudeContent{
+				Type:  "tool_use",
+				ID:    block["id"].(string),
+				Name:  block["name"].(string),
+				Input: block["input"],
+			})
+			hasToolUse = true
+		case "message":
+			if text := toolContentText(item["content"]); text != "" {
+				content = append(content, types.ClaudeContent{Type: "text", Text: text})
+			}
+		}
+	}
+	return content, hasToolUse
+}
+
+// claudeContentBlocks 将 Claude 消息 content（[]interface{} 或 []map）统一为内容块列表
+func claudeContentBlocks(content interface{}) []map[string]interface{} {
+	switch v := content.(type) {
+	case []map[string]interface{}:
+		return v
+	case []interface{}:
+		blocks := make([]map[string]interface{}, 0, len(v))
+		for _, raw := range v {
+			if block, ok := raw.(map[string]interface{}); ok {
+				blocks = append(blocks, block)
+			}
+		}
+		return blocks
+	default:
+		return nil
+	}
+}
+
+// toolContentText 提取 content 中的文本：string 直接返回，内容块数组拼接 text / input_text / output_text 块
+func toolContentText(content interface{}) string {
+	if s, ok := content.(string); ok {
+		return s
+	}
+	var texts []string
+	for _, block := range claudeContentBlocks(content) {
+		switch blockType, _ := block["type"].(string); blockType {
+		case "text", "input_text", "output_text":
+			if text, _ := block["text"].(string); text != "" {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// toolInputToArguments 将 tool_use.input 序列化为 arguments 字符串（缺失时为 "{}"）
+func toolInputToArguments(input interface{}) string {
+	if input == nil {
+		return "{}"
+	}
+	if s, ok := input.(string); ok && json.Valid([]byte(s)) {
+		return s
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// argumentsToToolInput 将 arguments 字符串解析为 tool_use.input 对象
+// 空字符串或非法 JSON（上游截断等）时返回空对象，保证 Claude 侧 input 始终为对象
+func argumentsToToolInput(arguments string) interface{} {
+	var input map[string]interface{}
+	if strings.TrimSpace(arguments) == "" || json.Unmarshal([]byte(arguments), &input) != nil || input == nil {
+		return map[string]interface{}{}
+	}
+	return input
+}
@@ -0,0 +1,271 @@
+package converters
+
+import (
+	"sort"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============== 流式：Responses SSE → Claude SSE ==============
+
+// responsesToolBlock Responses function_call 项对应的 Claude tool_use 块
+type responsesToolBlock struct {
+	claudeIndex int
+	started     bool // 已发送 content_block_start
+	hasDelta    bool // 已发送过参数增量
+	stopped     bool
+}
+
+// ResponsesToClaudeStreamConverter 将 Responses 流式事件转换为 Claude SSE 事件
+// output_text 增量映射为 text 块，function_call 项映射为 tool_use 块，
+// response.function_call_arguments.delta 映射为 input_json_delta（call_id 作为 tool_use.id）
+// 非并发安全，每个流使用独立实例
+type ResponsesToClaudeStreamConverter struct {
+	started      bool
+	finished     bool
+	textOpen     bool
+	textIndex    int
+	nextIndex    int
+	tools        map[string]*responsesToolBlock // item_id -> tool_use 块
+	hasToolUse   bool
+	stopReason   string
+	inputTokens  int64
+	outputTokens int64
+	cachedTokens int64
+}
+
+// NewResponsesToClaudeStreamConverter 创建 Responses → Claude 流式转换器
+func NewResponsesToClaudeStreamConverter() *ResponsesToClaudeStreamConverter {
+	return &ResponsesToClaudeStreamConverter{tools: make(map[string]*responsesToolBlock)}
+}
+
+// ProcessEvent 处理一个 Responses 流式事件（data 为事件 JSON），返回需要发送的 Claude SSE 事件
+// 收到 response.completed / response.incomplete / response.failed 时自动结束流
+func (sc *ResponsesToClaudeStreamConverter) ProcessEvent(data []byte) []string {
+	if sc.finished {
+		return nil
+	}
+	event := gjson.ParseBytes(data)
+	eventType := event.Get("type").String()
+
+	var events []string
+	if !sc.started {
+		events = append(events, sc.messageStartEvent(event.Get("response.model").String()))
+		sc.started = true
+	}
+
+	switch eventType {
+	case "response.output_text.delta":
+		if delta := event.Get("delta").String(); delta != "" {
+			events = append(events, sc.appendText(delta)...)
+		}
+
+	case "response.output_item.added":
+		item := event.Get("item")
+		if item.Get("type").String() == "function_call" {
+			block := sc.toolBlock(item.Get("id").String(), event.Get("output_index").String())
+			events = append(events, sc.startToolBlock(block, item)...)
+		}
+
+	case "response.function_call_arguments.delta":
+		block := sc.toolBlock(event.Get("item_id").String(), event.Get("output_index").String())
+		if delta := event.Get("delta").String(); delta != "" && block.started {
+			block.hasDelta = true
+			events = append(events, sc.inputJSONDelta(block.claudeIndex, delta))
+		}
+
+	case "response.function_call_arguments.done":
+		// 部分上游只在 done 事件中给出完整参数
+		block := sc.toolBlock(event.Get("item_id").String(), event.Get("output_index").String())
+		if args := event.Get("arguments").String(); args != "" && block.started && !block.hasDelta {
+			block.hasDelta = true
+			events = append(events, sc.inputJSONDelta(block.claudeIndex, args))
+		}
+
+	case "response.output_item.done":
+		item := event.Get("item")
+		switch item.Get("type").String() {
+		case "function_call":
+			block := sc.toolBlock(item.Get("id").String(), event.Get("output_index").String())
+			if !block.started {
+				events = append(events, sc.startToolBlock(block, item)...)
+			}
+			if args := item.Get("arguments").String(); args != "" && !block.hasDelta {
+				block.hasDelta = true
+				events = append(events, sc.inputJSONDelta(block.claudeIndex, args))
+			}
+			if !block.stopped {
+				block.stopped = true
+				events = append(events, claudeSSEEvent("content_block_stop", map[string]interface{}{
+					"type":  "content_block_stop",
+					"index": block.claudeIndex,
+				}))
+			}
+		case "message":
+			events = append(events, sc.closeText()...)
+		}
+
+	case "response.completed", "response.incomplete", "response.failed":
+		sc.recordUsage(event.Get("response.usage"))
+		if event.Get("response.incomplete_details.reason").String() == "max_output_tokens" {
+			sc.stopReason = "max_tokens"
+		}
+		events = append(events, sc.Finish()...)
+	}
+	return events
+}
+
+// Finish 结束流：关闭未关闭的内容块，发送 message_delta（stop_reason 与 usage）与 message_stop
+func (sc *ResponsesToClaudeStreamConverter) Finish() []string {
+	if sc.finished {
+		return nil
+	}
+	sc.finished = true
+
+	var events []string
+	if !sc.started {
+		events = append(events, sc.messageStartEvent(""))
+		sc.started = true
+	}
+	events = append(events, sc.closeText()...)
+	var open []*responsesToolBlock
+	for _, block := range sc.tools {
+		if block.started && !block.stopped {
+			open = append(open, block)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool { return open[i].claudeIndex < open[j].claudeIndex })
+	for _, block := range open {
+		block.stopped = true
+		events = append(events, claudeSSEEvent("content_block_stop", map[string]interface{}{
+			"type":  "content_block_stop",
+			"index": block.claudeIndex,
+		}))
+	}
+
+	stopReason := sc.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+		if sc.hasToolUse {
+			stopReason = "tool_use"
+		}
+	}
+	usage := map[string]interface{}{
+		"input_tokens":  sc.inputTokens,
+		"output_tokens": sc.outputTokens,
+	}
+	if sc.cachedTokens > 0 {
+		usage["cache_read_input_tokens"] = sc.cachedTokens
+	}
+	events = append(events, claudeSSEEvent("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": stopReason, "stop_sequence": nil},
+		"usage": usage,
+	}))
+	events = append(events, claudeSSEEvent("message_stop", map[string]interface{}{"type": "message_stop"}))
+	return events
+}
+
+// recordUsage 记录 Responses usage（input_tokens 包含缓存部分，Claude input_tokens 不包含）
+func (sc *ResponsesToClaudeStreamConverter) recordUsage(usage gjson.Result) {
+	if !usage.Exists() {
+		return
+	}
+	sc.cachedTokens = usage.Get("input_tokens_details.cached_tokens").Int()
+	sc.inputTokens = max(usage.Get("input_tokens").Int()-sc.cachedTokens, 0)
+	sc.outputTokens = usage.Get("output_tokens").Int()
+}
+
+func (sc *ResponsesToClaudeStreamConverter) messageStartEvent(model string) string {
+	return claudeSSEEvent("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            newClaudeMessageID(),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         map[string]interface{}{"input_tokens": 0, "output_tokens": 0},
+		},
+	})
+}
+
+// toolBlock 按 item_id（缺失时按 output_index）查找或登记 tool_use 块
+func (sc *ResponsesToClaudeStreamConverter) toolBlock(itemID, outputIndex string) *responsesToolBlock {
+	key := itemID
+	if key == "" {
+		key = "#" + outputIndex
+	}
+	block, ok := sc.tools[key]
+	if !ok {
+		block = &responsesToolBlock{}
+		sc.tools[key] = block
+	}
+	return block
+}
+
+func (sc *ResponsesToClaudeStreamConverter) startToolBlock(block *responsesToolBlock, item gjson.Result) []string {
+	if block.started {
+		return nil
+	}
+	events := sc.closeText()
+	block.started = true
+	block.claudeIndex = sc.nextIndex
+	sc.nextIndex++
+	sc.hasToolUse = true
+
+	callID := item.Get("call_id").String()
+	if callID == "" {
+		callID = item.Get("id").String()
+	}
+	return append(events, claudeSSEEvent("content_block_start", map[string]interface{}{
+		"type":  "content_block_start",
+		"index": block.claudeIndex,
+		"content_block": map[string]interface{}{
+			"type":  "tool_use",
+			"id":    callID,
+			"name":  item.Get("name").String(),
+			"input": map[string]interface{}{},
+		},
+	}))
+}
+
+func (sc *ResponsesToClaudeStreamConverter) inputJSONDelta(index int, partial string) string {
+	return claudeSSEEvent("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": partial},
+	})
+}
+
+func (sc *ResponsesToClaudeStreamConverter) appendText(text string) []string {
+	var events []string
+	if !sc.textOpen {
+		sc.textOpen = true
+		sc.textIndex = sc.nextIndex
+		sc.nextIndex++
+		events = append(events, claudeSSEEvent("content_block_start", map[string]interface{}{
+			"type":          "content_block_start",
+			"index":         sc.textIndex,
+			"content_block": map[string]interface{}{"type": "text", "text": ""},
+		}))
+	}
+	return append(events, claudeSSEEvent("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": sc.textIndex,
+		"delta": map[string]interface{}{"type": "text_delta", "text": text},
+	}))
+}
+
+func (sc *ResponsesToClaudeStreamConverter) closeText() []string {
+	if !sc.textOpen {
+		return nil
+	}
+	sc.textOpen = false
+	return []string{claudeSSEEvent("content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": sc.textIndex,
+	})}
+}
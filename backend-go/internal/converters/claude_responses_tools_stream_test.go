@@ -0,0 +1,137 @@
+package converters
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// claudeStreamResult 从 Claude SSE 事件重建的内容块
+type claudeStreamResult struct {
+	blocks     []map[string]interface{} // 按 index 排列，tool_use 的 input 为拼接后的 partial_json
+	stopReason string
+	usage      map[string]interface{}
+}
+
+// collectClaudeStream 将 Claude SSE 事件重建为最终内容块
+func collectClaudeStream(t *testing.T, events []string) ([]string, claudeStreamResult) {
+	t.Helper()
+	names, payloads := parseClaudeSSEEvents(t, events)
+	var result claudeStreamResult
+	partial := map[int]*strings.Builder{}
+	for _, p := range payloads {
+		switch p["type"] {
+		case "content_block_start":
+			index := int(p["index"].(float64))
+			if index != len(result.blocks) {
+				t.Fatalf("content_block_start index = %d, want %d", index, len(result.blocks))
+			}
+			block := p["content_block"].(map[string]interface{})
+			result.blocks = append(result.blocks, map[string]interface{}{"type": block["type"], "id": block["id"], "name": block["name"], "text": ""})
+			partial[index] = &strings.Builder{}
+		case "content_block_delta":
+			index := int(p["index"].(float64))
+			delta := p["delta"].(map[string]interface{})
+			switch delta["type"] {
+			case "text_delta":
+				result.blocks[index]["text"] = result.blocks[index]["text"].(string) + delta["text"].(string)
+			case "input_json_delta":
+				partial[index].WriteString(delta["partial_json"].(string))
+			}
+		case "content_block_stop":
+			index := int(p["index"].(float64))
+			result.blocks[index]["arguments"] = partial[index].String()
+		case "message_delta":
+			result.stopReason = p["delta"].(map[string]interface{})["stop_reason"].(string)
+			result.usage = p["usage"].(map[string]interface{})
+		}
+	}
+	return names, result
+}
+
+func responsesEvents(raw ...string) [][]byte {
+	out := make([][]byte, 0, len(raw))
+	for _, r := range raw {
+		out = append(out, []byte(r))
+	}
+	return out
+}
+
+func TestResponsesToClaudeStreamConverter(t *testing.T) {
+	tests := []struct {
+		name       string
+		events     [][]byte
+		wantBlocks []map[string]interface{}
+		wantStop   string
+	}{
+		{
+			name: "text then parallel tool calls with argument deltas",
+			events: responsesEvents(
+				`{"type":"response.created","response":{"id":"resp_1","model":"gpt-5"}}`,
+				`{"type":"response.output_item.added","output_index":0,"item":{"id":"msg_1","type":"message","role":"assistant"}}`,
+				`{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"delta":"Let me "}`,
+				`{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"delta":"check."}`,
+				`{"type":"response.output_item.done","output_index":0,"item":{"id":"msg_1","type":"message"}}`,
+				`{"type":"response.output_item.added","output_index":1,"item":{"id":"fc_1","type":"function_call","call_id":"call_a","name":"get_weather","arguments":""}}`,
+				`{"type":"response.output_item.added","output_index":2,"item":{"id":"fc_2","type":"function_call","call_id":"call_b","name":"get_time","arguments":""}}`,
+				`{"type":"response.function_call_arguments.delta","item_id":"fc_1","output_index":1,"delta":"{\"city\":"}`,
+				`{"type":"response.function_call_arguments.delta","item_id":"fc_2","output_index":2,"delta":"{\"tz\":\"CET\"}"}`,
+				`{"type":"response.function_call_arguments.delta","item_id":"fc_1","output_index":1,"delta":"\"Paris\"}"}`,
+				`{"type":"response.function_call_arguments.done","item_id":"fc_1","output_index":1,"arguments":"{\"city\":\"Paris\"}"}`,
+				`{"type":"response.output_item.done","output_index":1,"item":{"id":"fc_1","type":"function_call","call_id":"call_a","name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}`,
+				`{"type":"response.completed","response":{"usage":{"input_tokens":100,"output_tokens":20,"input_tokens_details":{"cached_tokens":40}}}}`,
+			),
+			wantBlocks: []map[string]interface{}{
+				{"type": "text", "id": nil, "name": nil, "text": "Let me check.", "arguments": ""},
+				{"type": "tool_use", "id": "call_a", "name": "get_weather", "text": "", "arguments": `{"city":"Paris"}`},
+				{"type": "tool_use", "id": "call_b", "name": "get_time", "text": "", "arguments": `{"tz":"CET"}`},
+			},
+			wantStop: "tool_use",
+		},
+		{
+			name: "arguments only in done event",
+			events: responsesEvents(
+				`{"type":"response.output_item.done","output_index":0,"item":{"id":"fc_1","type":"function_call","call_id":"call_a","name":"search","arguments":"{\"q\":\"go\"}"}}`,
+				`{"type":"response.output_text.delta","item_id":"msg_1","output_index":1,"delta":"done"}`,
+				`{"type":"response.incomplete","response":{"incomplete_details":{"reason":"max_output_tokens"}}}`,
+			),
+			wantBlocks: []map[string]interface{}{
+				{"type": "tool_use", "id": "call_a", "name": "search", "text": "", "arguments": `{"q":"go"}`},
+				{"type": "text", "id": nil, "name": nil, "text": "done", "arguments": ""},
+			},
+			wantStop: "max_tokens",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := NewResponsesToClaudeStreamConverter()
+			var events []string
+			for _, e := range tt.events {
+				events = append(events, sc.ProcessEvent(e)...)
+			}
+			if extra := sc.Finish(); extra != nil {
+				t.Fatalf("流已结束，Finish 不应再输出事件: %v", extra)
+			}
+			names, result := collectClaudeStream(t, events)
+			if names[0] != "message_start" || names[len(names)-1] != "message_stop" {
+				t.Fatalf("事件序列首尾不正确: %v", names)
+			}
+			if !reflect.DeepEqual(result.blocks, tt.wantBlocks) {
+				t.Fatalf("blocks = %+v\nwant %+v", result.blocks, tt.wantBlocks)
+			}
+			if result.stopReason != tt.wantStop {
+				t.Fatalf("stop_reason = %q, want %q", result.stopReason, tt.wantStop)
+			}
+		})
+	}
+}
+
+func TestResponsesToClaudeStreamConverter_Usage(t *testing.T) {
+	sc := NewResponsesToClaudeStreamConverter()
+	events := sc.ProcessEvent([]byte(`{"type":"response.completed","response":{"usage":{"input_tokens":100,"output_tokens":20,"input_tokens_details":{"cached_tokens":40}}}}`))
+	_, result := collectClaudeStream(t, events)
+	want := map[string]interface{}{"input_tokens": float64(60), "output_tokens": float64(20), "cache_read_input_tokens": float64(40)}
+	if !reflect.DeepEqual(result.usage, want) {
+		t.Fatalf("usage = %+v, want %+v", result.usage, want)
+	}
+}
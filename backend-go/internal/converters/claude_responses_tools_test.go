@@ -0,0 +1,169 @@
+package converters
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+// decodeClaudeMessages 以 JSON 解析 Claude 消息（与实际请求体解析方式一致）
+func decodeClaudeMessages(t *testing.T, raw string) []types.ClaudeMessage {
+	t.Helper()
+	var messages []types.ClaudeMessage
+	if err := json.Unmarshal([]byte(raw), &messages); err != nil {
+		t.Fatalf("解析消息失败: %v", err)
+	}
+	return messages
+}
+
+// normalizeJSON 经 JSON 编解码统一类型，便于比较
+func normalizeJSON(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("反序列化失败: %v", err)
+	}
+	return out
+}
+
+func TestClaudeMessagesToResponsesInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages string
+		want     string
+	}{
+		{
+			name:     "plain string content",
+			messages: `[{"role":"user","content":"hi"}]`,
+			want:     `[{"type":"message","role":"user","content":[{"type":"input_text","text":"hi"}]}]`,
+		},
+		{
+			name: "multi-tool turn",
+			messages: `[
+				{"role":"assistant","content":[
+					{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}},
+					{"type":"tool_use","id":"toolu_2","name":"get_time","input":{"tz":"CET","verbose":true}}]},
+				{"role":"user","content":[
+					{"type":"tool_result","tool_use_id":"toolu_1","content":"sunny"},
+					{"type":"tool_result","tool_use_id":"toolu_2","content":[{"type":"text","text":"12:00"}]}]}]`,
+			want: `[
+				{"type":"function_call","call_id":"toolu_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}"},
+				{"type":"function_call","call_id":"toolu_2","name":"get_time","arguments":"{\"tz\":\"CET\",\"verbose\":true}"},
+				{"type":"function_call_output","call_id":"toolu_1","output":"sunny"},
+				{"type":"function_call_output","call_id":"toolu_2","output":"12:00"}]`,
+		},
+		{
+			name: "interleaved text and tool blocks keep order",
+			messages: `[
+				{"role":"assistant","content":[
+					{"type":"text","text":"Let me check."},
+					{"type":"tool_use","id":"toolu_1","name":"search","input":{}},
+					{"type":"text","text":"And also"},
+					{"type":"text","text":"this."},
+					{"type":"tool_use","id":"toolu_2","name":"fetch","input":{"url":"https://x"}}]},
+				{"role":"user","content":[
+					{"type":"tool_result","tool_use_id":"toolu_1","content":"boom","is_error":true},
+					{"type":"text","text":"continue"}]}]`,
+			want: `[
+				{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Let me check."}]},
+				{"type":"function_call","call_id":"toolu_1","name":"search","arguments":"{}"},
+				{"type":"message","role":"assistant","content":[{"type":"output_text","text":"And also"},{"type":"output_text","text":"this."}]},
+				{"type":"function_call","call_id":"toolu_2","name":"fetch","arguments":"{\"url\":\"https://x\"}"},
+				{"type":"function_call_output","call_id":"toolu_1","output":"Error: boom"},
+				{"type":"message","role":"user","content":[{"type":"input_text","text":"continue"}]}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizeJSON(t, ClaudeMessagesToResponsesInput(decodeClaudeMessages(t, tt.messages)))
+			var want interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("解析期望值失败: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Fatalf("got  %s\nwant %s", gotJSON, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponsesOutputToClaudeContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		wantContent string
+		wantToolUse bool
+	}{
+		{
+			name:        "text only",
+			output:      `[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"hello"}]}]`,
+			wantContent: `[{"type":"text","text":"hello"}]`,
+		},
+		{
+			name: "text and parallel function calls",
+			output: `[
+				{"type":"reasoning","id":"rs_1","summary":[]},
+				{"type":"message","role":"assistant","content":[{"type":"output_text","text":"calling"}]},
+				{"type":"function_call","id":"fc_1","call_id":"call_1","name":"a","arguments":"{\"x\":1}"},
+				{"type":"function_call","id":"fc_2","call_id":"call_2","name":"b","arguments":""}]`,
+			wantContent: `[
+				{"type":"text","text":"calling"},
+				{"type":"tool_use","id":"call_1","name":"a","input":{"x":1}},
+				{"type":"tool_use","id":"call_2","name":"b","input":{}}]`,
+			wantToolUse: true,
+		},
+		{
+			name:        "invalid arguments fall back to empty object",
+			output:      `[{"type":"function_call","call_id":"call_1","name":"a","arguments":"{\"x\":"}]`,
+			wantContent: `[{"type":"tool_use","id":"call_1","name":"a","input":{}}]`,
+			wantToolUse: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output []map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.output), &output); err != nil {
+				t.Fatalf("解析 output 失败: %v", err)
+			}
+			content, hasToolUse := ResponsesOutputToClaudeContent(output)
+			if hasToolUse != tt.wantToolUse {
+				t.Fatalf("hasToolUse = %v, want %v", hasToolUse, tt.wantToolUse)
+			}
+			var want interface{}
+			_ = json.Unmarshal([]byte(tt.wantContent), &want)
+			if got := normalizeJSON(t, content); !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Fatalf("got  %s\nwant %s", gotJSON, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestClaudeToolsToResponsesTools(t *testing.T) {
+	tools := []types.ClaudeTool{
+		{Name: "get_weather", Description: "天气", InputSchema: map[string]interface{}{
+			"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}}, "required": []interface{}{"city"},
+		}},
+		{Name: "no_schema"},
+	}
+	converted := ClaudeToolsToResponsesTools(tools)
+	if converted[0]["type"] != "function" || converted[0]["name"] != "get_weather" || converted[0]["description"] != "天气" {
+		t.Fatalf("converted[0] = %+v", converted[0])
+	}
+	if _, ok := converted[1]["description"]; ok {
+		t.Fatalf("空描述不应输出: %+v", converted[1])
+	}
+	if !reflect.DeepEqual(converted[0]["parameters"], tools[0].InputSchema) {
+		t.Fatalf("parameters 应原样保留: %+v", converted[0]["parameters"])
+	}
+	if schema, _ := converted[1]["parameters"].(map[string]interface{}); schema["type"] != "object" {
+		t.Fatalf("缺失的 schema 应补全为空对象 schema: %+v", converted[1]["parameters"])
+	}
+}
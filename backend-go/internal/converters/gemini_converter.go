@@ -55,6 +55,13 @@ func GeminiToClaudeRequest(geminiReq *types.GeminiRequest, model string) (map[st
 		if len(cfg.StopSequences) > 0 {
 			claudeReq["stop_sequences"] = cfg.StopSequences
 		}
+		// thinkingConfig -> thinking
+		if cfg.ThinkingConfig != nil {
+			effort := GeminiThinkingToReasoningEffort(cfg.ThinkingConfig.ThinkingBudget, cfg.ThinkingConfig.ThinkingLevel)
+			if thinking := ReasoningEffortToClaudeThinking(effort, cfg.MaxOutputTokens); thinking != nil {
+				claudeReq["thinking"] = thinking
+			}
+		}
 	}
 
 	// 4. 转换 tools -> tools
@@ -134,6 +141,13 @@ func GeminiToOpenAIRequest(geminiReq *types.GeminiRequest, model string) (map[st
 		if len(cfg.StopSequences) > 0 {
 			openaiReq["stop"] = cfg.StopSequences
 		}
+		// thinkingConfig -> reasoning_effort
+		if cfg.ThinkingConfig != nil {
+			effort := GeminiThinkingToReasoningEffort(cfg.ThinkingConfig.ThinkingBudget, cfg.ThinkingConfig.ThinkingLevel)
+			if openaiEffort := ReasoningEffortToOpenAI(effort); openaiEffort != "" {
+				openaiReq["reasoning_effort"] = openaiEffort
+			}
+		}
 	}
 
 	// 4. 转换 tools -> tools
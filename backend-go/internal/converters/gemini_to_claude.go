@@ -0,0 +1,312 @@
+package converters
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/google/uuid"
+)
+
+// ============== Gemini → Claude 响应转换 ==============
+// 用于 Messages 渠道以 Gemini 作为上游时，将 generateContent / streamGenerateContent 响应
+// 转换为 Anthropic Messages 格式（thought 部分 → thinking 块，functionCall → tool_use 块）
+
+// GeminiResponseToClaude 将 Gemini 非流式响应转换为 Claude 响应
+func GeminiResponseToClaude(geminiResp *types.GeminiResponse) *types.ClaudeResponse {
+	claudeResp := &types.ClaudeResponse{
+		ID:      newClaudeMessageID(),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   geminiResp.ModelVersion,
+		Content: []types.ClaudeContent{},
+	}
+
+	finishReason := ""
+	if len(geminiResp.Candidates) > 0 {
+		candidate := geminiResp.Candidates[0]
+		finishReason = candidate.FinishReason
+		if candidate.Content != nil {
+			for _, part := range candidate.Content.Parts {
+				switch {
+				case part.FunctionCall != nil:
+					claudeResp.Content = append(claudeResp.Content, types.ClaudeContent{
+						Type:  "tool_use",
+						ID:    newClaudeToolUseID(),
+						Name:  part.FunctionCall.Name,
+						Input: geminiFunctionArgs(part.FunctionCall),
+					})
+				case part.Thought:
+					if part.Text != "" {
+						claudeResp.Content = append(claudeResp.Content, types.ClaudeContent{
+							Type:     "thinking",
+							Thinking: part.Text,
+						})
+					}
+				case part.Text != "":
+					claudeResp.Content = append(claudeResp.Content, types.ClaudeContent{
+						Type: "text",
+						Text: part.Text,
+					})
+				}
+			}
+		}
+	}
+
+	hasToolUse := false
+	for _, c := range claudeResp.Content {
+		if c.Type == "tool_use" {
+			hasToolUse = true
+			break
+		}
+	}
+	claudeResp.StopReason = geminiStopReasonToClaude(finishReason, hasToolUse)
+	claudeResp.Usage = GeminiUsageToClaude(geminiResp.UsageMetadata)
+
+	return claudeResp
+}
+
+// GeminiUsageToClaude 将 Gemini usageMetadata 转换为 Claude usage
+// Gemini 的 promptTokenCount 包含缓存命中部分，需扣除后作为 input_tokens；
+// thoughtsTokenCount 不计入 candidatesTokenCount，需合并到 output_tokens
+func GeminiUsageToClaude(usage *types.GeminiUsageMetadata) *types.Usage {
+	if usage == nil {
+		return nil
+	}
+	return &types.Usage{
+		InputTokens:          max(usage.PromptTokenCount-usage.CachedContentTokenCount, 0),
+		OutputTokens:         usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+		CacheReadInputTokens: usage.CachedContentTokenCount,
+		ThinkingTokens:       usage.ThoughtsTokenCount,
+	}
+}
+
+// geminiStopReasonToClaude 将 Gemini finishReason 转换为 Claude stop_reason
+// 正常结束且包含函数调用时为 tool_use；安全拦截类原因映射为 refusal
+func geminiStopReasonToClaude(finishReason string, hasToolUse bool) string {
+	switch finishReason {
+	case "", "STOP", "FINISH_REASON_UNSPECIFIED":
+		if hasToolUse {
+			return "tool_use"
+		}
+		return "end_turn"
+	case "MAX_TOKENS":
+		return "max_tokens"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "refusal"
+	default:
+		return geminiFinishReasonToClaude(finishReason)
+	}
+}
+
+// geminiFunctionArgs 返回函数调用参数（Claude 要求 input 为对象，nil 时返回空对象）
+func geminiFunctionArgs(fc *types.GeminiFunctionCall) map[string]interface{} {
+	if fc.Args == nil {
+		return map[string]interface{}{}
+	}
+	return fc.Args
+}
+
+func newClaudeMessageID() string {
+	return "msg_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// newClaudeToolUseID 生成唯一的 tool_use ID（Gemini 函数调用本身没有 ID）
+func newClaudeToolUseID() string {
+	return "toolu_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// GeminiToClaudeStreamConverter 将 Gemini 流式响应块转换为 Claude SSE 事件
+// 非并发安全，每个流使用独立实例
+type GeminiToClaudeStreamConverter struct {
+	started      bool
+	blockType    string // 当前打开的内容块类型：text / thinking，空表示无
+	blockIndex   int    // 当前打开的内容块索引
+	nextIndex    int    // 下一个内容块索引
+	hasToolUse   bool
+	finishReason string
+	usage        *types.GeminiUsageMetadata
+}
+
+// NewGeminiToClaudeStreamConverter 创建 Gemini → Claude 流式转换器
+func NewGeminiToClaudeStreamConverter() *GeminiToClaudeStreamConverter {
+	return &GeminiToClaudeStreamConverter{}
+}
+
+// ProcessChunk 处理一个 Gemini 流式响应块，返回需要发送的 Claude SSE 事件
+func (sc *GeminiToClaudeStreamConverter) ProcessChunk(chunk *types.GeminiStreamChunk) []string {
+	var events []string
+
+	// Gemini 每个块的 usageMetadata 为累计值，保留最新一份
+	if chunk.UsageMetadata != nil {
+		sc.usage = chunk.UsageMetadata
+	}
+
+	if !sc.started {
+		events = append(events, sc.messageStartEvent(chunk.ModelVersion))
+		sc.started = true
+	}
+
+	if len(chunk.Candidates) == 0 {
+		return events
+	}
+	candidate := chunk.Candidates[0]
+
+	if candidate.Content != nil {
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				events = append(events, sc.closeBlock()...)
+				events = append(events, sc.toolUseEvents(part.FunctionCall)...)
+			case part.Thought:
+				if part.Text != "" {
+					events = append(events, sc.appendDelta("thinking", part.Text)...)
+				}
+			case part.Text != "":
+				events = append(events, sc.appendDelta("text", part.Text)...)
+			}
+		}
+	}
+
+	if candidate.FinishReason != "" {
+		sc.finishReason = candidate.FinishReason
+	}
+
+	return events
+}
+
+// Finish 结束流：关闭未关闭的内容块，发送带 stop_reason 与 usage 的 message_delta 以及 message_stop
+// finishReason 与最终 usage 可能出现在不同块中，因此统一在流结束时发送
+func (sc *GeminiToClaudeStreamConverter) Finish() []string {
+	var events []string
+	if !sc.started {
+		events = append(events, sc.messageStartEvent(""))
+		sc.started = true
+	}
+	events = append(events, sc.closeBlock()...)
+
+	delta := map[string]interface{}{
+		"type": "message_delta",
+		"delta": map[string]interface{}{
+			"stop_reason":   geminiStopReasonToClaude(sc.finishReason, sc.hasToolUse),
+			"stop_sequence": nil,
+		},
+	}
+	// 上游无 usage 时发送零值，由下游按估算值修补
+	if usage := GeminiUsageToClaude(sc.usage); usage != nil {
+		delta["usage"] = usage
+	} else {
+		delta["usage"] = map[string]interface{}{"input_tokens": 0, "output_tokens": 0}
+	}
+	events = append(events, claudeSSEEvent("message_delta", delta))
+	events = append(events, claudeSSEEvent("message_stop", map[string]interface{}{"type": "message_stop"}))
+	return events
+}
+
+// messageStartEvent 构建 message_start 事件（input_tokens 取首块的 usage，缺失时由下游补全）
+func (sc *GeminiToClaudeStreamConverter) messageStartEvent(model string) string {
+	usage := map[string]interface{}{"input_tokens": 0, "output_tokens": 0}
+	if u := GeminiUsageToClaude(sc.usage); u != nil {
+		usage["input_tokens"] = u.InputTokens
+		if u.CacheReadInputTokens > 0 {
+			usage["cache_read_input_tokens"] = u.CacheReadInputTokens
+		}
+	}
+	return claudeSSEEvent("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            newClaudeMessageID(),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         usage,
+		},
+	})
+}
+
+// appendDelta 向 text / thinking 块追加增量，类型切换时先关闭上一个块
+func (sc *GeminiToClaudeStreamConverter) appendDelta(blockType, text string) []string {
+	var events []string
+	if sc.blockType != blockType {
+		events = append(events, sc.closeBlock()...)
+		sc.blockType = blockType
+		sc.blockIndex = sc.nextIndex
+		sc.nextIndex++
+
+		contentBlock := map[string]interface{}{"type": "text", "text": ""}
+		if blockType == "thinking" {
+			contentBlock = map[string]interface{}{"type": "thinking", "thinking": ""}
+		}
+		events = append(events, claudeSSEEvent("content_block_start", map[string]interface{}{
+			"type":          "content_block_start",
+			"index":         sc.blockIndex,
+			"content_block": contentBlock,
+		}))
+	}
+
+	delta := map[string]interface{}{"type": "text_delta", "text": text}
+	if blockType == "thinking" {
+		delta = map[string]interface{}{"type": "thinking_delta", "thinking": text}
+	}
+	events = append(events, claudeSSEEvent("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": sc.blockIndex,
+		"delta": delta,
+	}))
+	return events
+}
+
+// toolUseEvents 构建完整的 tool_use 块事件（Gemini 函数调用参数一次性返回）
+func (sc *GeminiToClaudeStreamConverter) toolUseEvents(fc *types.GeminiFunctionCall) []string {
+	index := sc.nextIndex
+	sc.nextIndex++
+	sc.hasToolUse = true
+
+	argsJSON, _ := json.Marshal(geminiFunctionArgs(fc))
+	return []string{
+		claudeSSEEvent("content_block_start", map[string]interface{}{
+			"type":  "content_block_start",
+			"index": index,
+			"content_block": map[string]interface{}{
+				"type":  "tool_use",
+				"id":    newClaudeToolUseID(),
+				"name":  fc.Name,
+				"input": map[string]interface{}{},
+			},
+		}),
+		claudeSSEEvent("content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": index,
+			"delta": map[string]interface{}{
+				"type":         "input_json_delta",
+				"partial_json": string(argsJSON),
+			},
+		}),
+		claudeSSEEvent("content_block_stop", map[string]interface{}{
+			"type":  "content_block_stop",
+			"index": index,
+		}),
+	}
+}
+
+// closeBlock 关闭当前打开的 text / thinking 块
+func (sc *GeminiToClaudeStreamConverter) closeBlock() []string {
+	if sc.blockType == "" {
+		return nil
+	}
+	sc.blockType = ""
+	return []string{claudeSSEEvent("content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": sc.blockIndex,
+	})}
+}
+
+// claudeSSEEvent 格式化 Claude SSE 事件
+func claudeSSEEvent(eventType string, data interface{}) string {
+	dataJSON, _ := json.Marshal(data)
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, dataJSON)
+}
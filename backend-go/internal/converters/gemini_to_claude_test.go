@@ -0,0 +1,213 @@
+package converters
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+func TestGeminiResponseToClaude(t *testing.T) {
+	resp := &types.GeminiResponse{
+		ModelVersion: "gemini-2.5-pro",
+		Candidates: []types.GeminiCandidate{{
+			Content: &types.GeminiContent{
+				Role: "model",
+				Parts: []types.GeminiPart{
+					{Text: "先想一想", Thought: true},
+					{Text: "我来查询天气"},
+					{FunctionCall: &types.GeminiFunctionCall{Name: "get_weather", Args: map[string]interface{}{"city": "北京"}}},
+					{FunctionCall: &types.GeminiFunctionCall{Name: "get_time"}},
+				},
+			},
+			FinishReason: "STOP",
+		}},
+		UsageMetadata: &types.GeminiUsageMetadata{
+			PromptTokenCount:        100,
+			CandidatesTokenCount:    20,
+			CachedContentTokenCount: 60,
+			ThoughtsTokenCount:      5,
+		},
+	}
+
+	claudeResp := GeminiResponseToClaude(resp)
+
+	if claudeResp.Model != "gemini-2.5-pro" {
+		t.Errorf("Model = %q, want gemini-2.5-pro", claudeResp.Model)
+	}
+	if len(claudeResp.Content) != 4 {
+		t.Fatalf("len(Content) = %d, want 4", len(claudeResp.Content))
+	}
+	wantTypes := []string{"thinking", "text", "tool_use", "tool_use"}
+	for i, want := range wantTypes {
+		if claudeResp.Content[i].Type != want {
+			t.Errorf("Content[%d].Type = %q, want %q", i, claudeResp.Content[i].Type, want)
+		}
+	}
+	if claudeResp.Content[0].Thinking != "先想一想" {
+		t.Errorf("thinking = %v", claudeResp.Content[0].Thinking)
+	}
+	if claudeResp.Content[2].ID == claudeResp.Content[3].ID {
+		t.Errorf("tool_use ID 应唯一，实际均为 %q", claudeResp.Content[2].ID)
+	}
+	if input, ok := claudeResp.Content[3].Input.(map[string]interface{}); !ok || len(input) != 0 {
+		t.Errorf("无参数函数调用 input 应为空对象，实际 %#v", claudeResp.Content[3].Input)
+	}
+	if claudeResp.StopReason != "tool_use" {
+		t.Errorf("StopReason = %q, want tool_use", claudeResp.StopReason)
+	}
+
+	usage := claudeResp.Usage
+	if usage == nil {
+		t.Fatal("Usage 不应为 nil")
+	}
+	if usage.InputTokens != 40 || usage.CacheReadInputTokens != 60 || usage.OutputTokens != 25 {
+		t.Errorf("Usage = %+v, want input=40 cache_read=60 output=25", *usage)
+	}
+}
+
+func TestGeminiStopReasonToClaude(t *testing.T) {
+	tests := []struct {
+		reason     string
+		hasToolUse bool
+		want       string
+	}{
+		{"STOP", false, "end_turn"},
+		{"STOP", true, "tool_use"},
+		{"", false, "end_turn"},
+		{"MAX_TOKENS", true, "max_tokens"},
+		{"SAFETY", false, "refusal"},
+		{"OTHER", false, "end_turn"},
+	}
+	for _, tt := range tests {
+		if got := geminiStopReasonToClaude(tt.reason, tt.hasToolUse); got != tt.want {
+			t.Errorf("geminiStopReasonToClaude(%q, %v) = %q, want %q", tt.reason, tt.hasToolUse, got, tt.want)
+		}
+	}
+}
+
+// parseClaudeSSEEvents 解析 SSE 事件为 (事件名, 数据) 列表
+func parseClaudeSSEEvents(t *testing.T, events []string) ([]string, []map[string]interface{}) {
+	t.Helper()
+	var names []string
+	var payloads []map[string]interface{}
+	for _, event := range events {
+		var name string
+		var data map[string]interface{}
+		for _, line := range strings.Split(event, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data); err != nil {
+					t.Fatalf("无效的事件数据: %v", err)
+				}
+			}
+		}
+		if data["type"] != name {
+			t.Fatalf("事件名 %q 与 data.type %v 不一致", name, data["type"])
+		}
+		names = append(names, name)
+		payloads = append(payloads, data)
+	}
+	return names, payloads
+}
+
+func TestGeminiToClaudeStreamConverter(t *testing.T) {
+	sc := NewGeminiToClaudeStreamConverter()
+	chunks := []*types.GeminiStreamChunk{
+		{
+			ModelVersion: "gemini-2.5-flash",
+			Candidates: []types.GeminiCandidate{{Content: &types.GeminiContent{Parts: []types.GeminiPart{
+				{Text: "思考中", Thought: true},
+			}}}},
+			UsageMetadata: &types.GeminiUsageMetadata{PromptTokenCount: 50},
+		},
+		{
+			Candidates: []types.GeminiCandidate{{Content: &types.GeminiContent{Parts: []types.GeminiPart{
+				{Text: "你好"},
+				{Text: "，世界"},
+			}}}},
+		},
+		{
+			Candidates: []types.GeminiCandidate{{
+				Content: &types.GeminiContent{Parts: []types.GeminiPart{
+					{FunctionCall: &types.GeminiFunctionCall{Name: "search", Args: map[string]interface{}{"q": "go"}}},
+				}},
+				FinishReason: "STOP",
+			}},
+			UsageMetadata: &types.GeminiUsageMetadata{PromptTokenCount: 50, CandidatesTokenCount: 12, ThoughtsTokenCount: 3},
+		},
+	}
+
+	var events []string
+	for _, chunk := range chunks {
+		events = append(events, sc.ProcessChunk(chunk)...)
+	}
+	events = append(events, sc.Finish()...)
+
+	names, payloads := parseClaudeSSEEvents(t, events)
+	wantNames := []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop", // thinking [0]
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop", // text [1]
+		"content_block_start", "content_block_delta", "content_block_stop", // tool_use [2]
+		"message_delta",
+		"message_stop",
+	}
+	if strings.Join(names, ",") != strings.Join(wantNames, ",") {
+		t.Fatalf("事件序列不符:\n got: %v\nwant: %v", names, wantNames)
+	}
+
+	message := payloads[0]["message"].(map[string]interface{})
+	if message["model"] != "gemini-2.5-flash" {
+		t.Errorf("message_start model = %v", message["model"])
+	}
+	if usage := message["usage"].(map[string]interface{}); usage["input_tokens"] != float64(50) {
+		t.Errorf("message_start input_tokens = %v, want 50", usage["input_tokens"])
+	}
+
+	if block := payloads[1]["content_block"].(map[string]interface{}); block["type"] != "thinking" {
+		t.Errorf("第一个内容块类型 = %v, want thinking", block["type"])
+	}
+	if delta := payloads[2]["delta"].(map[string]interface{}); delta["type"] != "thinking_delta" || delta["thinking"] != "思考中" {
+		t.Errorf("thinking delta = %v", delta)
+	}
+
+	// 内容块索引连续且互不重叠
+	wantIndexes := []float64{0, 0, 0, 1, 1, 1, 1, 2, 2, 2}
+	for i, want := range wantIndexes {
+		if got := payloads[i+1]["index"]; got != want {
+			t.Errorf("事件 %d (%s) index = %v, want %v", i+1, names[i+1], got, want)
+		}
+	}
+
+	toolBlock := payloads[8]["content_block"].(map[string]interface{})
+	if toolBlock["type"] != "tool_use" || toolBlock["name"] != "search" || !strings.HasPrefix(toolBlock["id"].(string), "toolu_") {
+		t.Errorf("tool_use content_block = %v", toolBlock)
+	}
+	if delta := payloads[9]["delta"].(map[string]interface{}); delta["type"] != "input_json_delta" || delta["partial_json"] != `{"q":"go"}` {
+		t.Errorf("tool_use delta = %v", delta)
+	}
+
+	messageDelta := payloads[11]
+	if stopReason := messageDelta["delta"].(map[string]interface{})["stop_reason"]; stopReason != "tool_use" {
+		t.Errorf("stop_reason = %v, want tool_use", stopReason)
+	}
+	usage := messageDelta["usage"].(map[string]interface{})
+	if usage["input_tokens"] != float64(50) || usage["output_tokens"] != float64(15) {
+		t.Errorf("message_delta usage = %v, want input=50 output=15", usage)
+	}
+}
+
+func TestGeminiToClaudeStreamConverter_EmptyStream(t *testing.T) {
+	names, payloads := parseClaudeSSEEvents(t, NewGeminiToClaudeStreamConverter().Finish())
+	if strings.Join(names, ",") != "message_start,message_delta,message_stop" {
+		t.Fatalf("空流事件序列 = %v", names)
+	}
+	usage, ok := payloads[1]["usage"].(map[string]interface{})
+	if !ok || usage["output_tokens"] != float64(0) {
+		t.Errorf("上游无 usage 时 message_delta 应携带零值 usage 供下游修补，实际 %v", payloads[1]["usage"])
+	}
+}
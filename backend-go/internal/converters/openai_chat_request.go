@@ -0,0 +1,237 @@
+package converters
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============== OpenAI Chat Completions -> Claude Messages 请求转换 ==============
+
+// DefaultChatCompletionsMaxTokens Chat Completions 请求未指定 max_tokens 时使用的默认值（Claude 要求必填）
+const DefaultChatCompletionsMaxTokens = 4096
+
+// OpenAIChatRequestToClaude 将 OpenAI Chat Completions 请求转换为 Claude Messages 请求
+// system/developer 消息合并为 system，tool_calls 转换为 tool_use 块，tool 消息转换为 tool_result 块，
+// 连续的同角色消息合并为一条（Claude 要求 tool_result 紧跟在对应 tool_use 之后的 user 消息中）
+func OpenAIChatRequestToClaude(body []byte) (map[string]interface{}, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("请求体不是合法的 JSON")
+	}
+	req := gjson.ParseBytes(body)
+	model := req.Get("model").String()
+	if model == "" {
+		return nil, fmt.Errorf("缺少 model 参数")
+	}
+	if !req.Get("messages").IsArray() || len(req.Get("messages").Array()) == 0 {
+		return nil, fmt.Errorf("messages 不能为空")
+	}
+
+	var systemParts []string
+	var messages []map[string]interface{}
+	appendBlocks := func(role string, blocks []map[string]interface{}) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] = append(messages[n-1]["content"].([]map[string]interface{}), blocks...)
+			return
+		}
+		messages = append(messages, map[string]interface{}{"role": role, "content": blocks})
+	}
+
+	for _, msg := range req.Get("messages").Array() {
+		switch role := msg.Get("role").String(); role {
+		case "system", "developer":
+			if text := chatContentText(msg.Get("content")); text != "" {
+				systemParts = append(systemParts, text)
+			}
+		case "user":
+			appendBlocks("user", chatContentToClaudeBlocks(msg.Get("content")))
+		case "assistant":
+			blocks := chatContentToClaudeBlocks(msg.Get("content"))
+			for _, call := range msg.Get("tool_calls").Array() {
+				blocks = append(blocks, map[string]interface{}{
+					"type":  "tool_use",
+					"id":    call.Get("id").String(),
+					"name":  call.Get("function.name").String(),
+					"input": argumentsToToolInput(call.Get("function.arguments").String()),
+				})
+			}
+			appendBlocks("assistant", blocks)
+		case "tool":
+			appendBlocks("user", []map[string]interface{}{{
+				"type":        "tool_result",
+				"tool_use_id": msg.Get("tool_call_id").String(),
+				"content":     chatContentText(msg.Get("content")),
+			}})
+		}
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("messages 中没有可转换的 user/assistant 消息")
+	}
+
+	maxTokens := int(req.Get("max_completion_tokens").Int())
+	if maxTokens <= 0 {
+		maxTokens = int(req.Get("max_tokens").Int())
+	}
+	if maxTokens <= 0 {
+		maxTokens = DefaultChatCompletionsMaxTokens
+	}
+
+	claudeReq := map[string]interface{}{
+		"model":      model,
+		"messages":   messages,
+		"max_tokens": maxTokens,
+	}
+	if len(systemParts) > 0 {
+		claudeReq["system"] = strings.Join(systemParts, "\n\n")
+	}
+	if req.Get("stream").Bool() {
+		claudeReq["stream"] = true
+	}
+	if v := req.Get("temperature"); v.Exists() && v.Type == gjson.Number {
+		claudeReq["temperature"] = v.Float()
+	}
+	if v := req.Get("top_p"); v.Exists() && v.Type == gjson.Number {
+		claudeReq["top_p"] = v.Float()
+	}
+	if stop := req.Get("stop"); stop.IsArray() {
+		var sequences []string
+		for _, s := range stop.Array() {
+			if s.String() != "" {
+				sequences = append(sequences, s.String())
+			}
+		}
+		if len(sequences) > 0 {
+			claudeReq["stop_sequences"] = sequences
+		}
+	} else if stop.String() != "" {
+		claudeReq["stop_sequences"] = []string{stop.String()}
+	}
+	if user := req.Get("user").String(); user != "" {
+		claudeReq["metadata"] = map[string]interface{}{"user_id": user}
+	}
+	if effort := NormalizeReasoningEffort(req.Get("reasoning_effort").String()); effort != "" {
+		if thinking := ReasoningEffortToClaudeThinking(effort, maxTokens); thinking != nil {
+			claudeReq["thinking"] = thinking
+		}
+	}
+
+	var tools []map[string]interface{}
+	for _, tool := range req.Get("tools").Array() {
+		if tool.Get("type").String() != "function" {
+			continue
+		}
+		fn := tool.Get("function")
+		claudeTool := map[string]interface{}{"name": fn.Get("name").String()}
+		if desc := fn.Get("description").String(); desc != "" {
+			claudeTool["description"] = desc
+		}
+		if params := fn.Get("parameters"); params.IsObject() {
+			claudeTool["input_schema"] = params.Value()
+		} else {
+			// Claude 需要 input_schema，提供空 schema
+			claudeTool["input_schema"] = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		tools = append(tools, claudeTool)
+	}
+	if len(tools) > 0 {
+		claudeReq["tools"] = tools
+		if toolChoice := chatToolChoiceToClaude(req.Get("tool_choice"), req.Get("parallel_tool_calls")); toolChoice != nil {
+			claudeReq["tool_choice"] = toolChoice
+		}
+	}
+	return claudeReq, nil
+}
+
+// chatToolChoiceToClaude 转换 tool_choice："required" -> any，指定函数 -> tool；parallel_tool_calls=false 时禁用并行工具调用
+func chatToolChoiceToClaude(choice, parallel gjson.Result) map[string]interface{} {
+	var out map[string]interface{}
+	switch {
+	case choice.IsObject():
+		if name := choice.Get("function.name").String(); name != "" {
+			out = map[string]interface{}{"type": "tool", "name": name}
+		}
+	case choice.String() == "none":
+		out = map[string]interface{}{"type": "none"}
+	case choice.String() == "required":
+		out = map[string]interface{}{"type": "any"}
+	case choice.String() == "auto":
+		out = map[string]interface{}{"type": "auto"}
+	}
+	if parallel.Exists() && !parallel.Bool() {
+		if out == nil {
+			out = map[string]interface{}{"type": "auto"}
+		}
+		if out["type"] != "none" {
+			out["disable_parallel_tool_use"] = true
+		}
+	}
+	return out
+}
+
+// chatContentToClaudeBlocks 将 Chat 消息 content（字符串或 content part 数组）转换为 Claude 内容块
+// image_url 支持 data URL（转为 base64 图片）与普通 URL（转为 url 图片）
+func chatContentToClaudeBlocks(content gjson.Result) []map[string]interface{} {
+	if !content.IsArray() {
+		if text := content.String(); text != "" {
+			return []map[string]interface{}{{"type": "text", "text": text}}
+		}
+		return nil
+	}
+
+	var blocks []map[string]interface{}
+	for _, part := range content.Array() {
+		switch part.Get("type").String() {
+		case "text":
+			if text := part.Get("text").String(); text != "" {
+				blocks = append(blocks, map[string]interface{}{"type": "text", "text": text})
+			}
+		case "refusal":
+			if text := part.Get("refusal").String(); text != "" {
+				blocks = append(blocks, map[string]interface{}{"type": "text", "text": text})
+			}
+		case "image_url":
+			url := part.Get("image_url.url").String()
+			if raw := part.Get("image_url"); raw.Type == gjson.String {
+				url = raw.String()
+			}
+			if source := chatImageSource(url); source != nil {
+				blocks = append(blocks, map[string]interface{}{"type": "image", "source": source})
+			}
+		}
+	}
+	return blocks
+}
+
+// chatImageSource 将图片 URL 转换为 Claude 图片 source
+func chatImageSource(url string) map[string]interface{} {
+	if url == "" {
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		meta, data, found := strings.Cut(rest, ",")
+		mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+		if !found || !isBase64 {
+			return nil
+		}
+		return map[string]interface{}{"type": "base64", "media_type": mediaType, "data": data}
+	}
+	return map[string]interface{}{"type": "url", "url": url}
+}
+
+// chatContentText 提取 Chat 消息 content 中的文本（content part 数组按换行拼接）
+func chatContentText(content gjson.Result) string {
+	if !content.IsArray() {
+		return content.String()
+	}
+	var texts []string
+	for _, part := range content.Array() {
+		if part.Get("type").String() == "text" {
+			texts = append(texts, part.Get("text").String())
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,114 @@
+package converters
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestOpenAIChatRequestToClaude(t *testing.T) {
+	body := []byte(`{
+		"model": "gpt-4o",
+		"max_completion_tokens": 2048,
+		"temperature": 0.2,
+		"stop": "END",
+		"user": "u-1",
+		"reasoning_effort": "low",
+		"parallel_tool_calls": false,
+		"messages": [
+			{"role": "system", "content": "You are helpful."},
+			{"role": "developer", "content": [{"type": "text", "text": "Answer in French."}]},
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is in this image?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}},
+				{"type": "image_url", "image_url": {"url": "https://example.com/cat.jpg"}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}},
+				{"id": "call_2", "type": "function", "function": {"name": "lookup", "arguments": "not json"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"},
+			{"role": "tool", "tool_call_id": "call_2", "content": [{"type": "text", "text": "unknown"}]},
+			{"role": "user", "content": "thanks"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup", "description": "search", "parameters": {"type": "object", "properties": {"q": {"type": "string"}}}}}],
+		"tool_choice": {"type": "function", "function": {"name": "lookup"}}
+	}`)
+
+	claudeReq, err := OpenAIChatRequestToClaude(body)
+	if err != nil {
+		t.Fatalf("OpenAIChatRequestToClaude() err = %v", err)
+	}
+	data, _ := json.Marshal(claudeReq)
+	got := gjson.ParseBytes(data)
+
+	if got.Get("system").String() != "You are helpful.\n\nAnswer in French." {
+		t.Fatalf("system = %q", got.Get("system").String())
+	}
+	if got.Get("max_tokens").Int() != 2048 || got.Get("temperature").Float() != 0.2 || got.Get("stop_sequences.0").String() != "END" {
+		t.Fatalf("params = %s", data)
+	}
+	if got.Get("metadata.user_id").String() != "u-1" || got.Get("thinking.type").String() != "enabled" {
+		t.Fatalf("metadata/thinking = %s", data)
+	}
+
+	messages := got.Get("messages").Array()
+	// 工具结果与随后的 user 消息合并为同一轮（Claude 要求 user/assistant 交替）
+	if len(messages) != 3 {
+		t.Fatalf("messages = %d, want 3: %s", len(messages), got.Get("messages").Raw)
+	}
+	user := messages[0].Get("content")
+	if user.Get("1.source.type").String() != "base64" || user.Get("1.source.media_type").String() != "image/png" ||
+		user.Get("2.source.type").String() != "url" {
+		t.Fatalf("user content = %s", user.Raw)
+	}
+	assistant := messages[1]
+	if assistant.Get("role").String() != "assistant" || assistant.Get("content.0.type").String() != "tool_use" ||
+		assistant.Get("content.0.input.q").String() != "cat" || !assistant.Get("content.1.input").IsObject() {
+		t.Fatalf("assistant = %s", assistant.Raw)
+	}
+	results := messages[2].Get("content")
+	if messages[2].Get("role").String() != "user" || results.Get("#").Int() != 3 ||
+		results.Get("0.tool_use_id").String() != "call_1" || results.Get("1.content").String() != "unknown" {
+		t.Fatalf("tool results = %s", messages[2].Raw)
+	}
+	if results.Get("2.text").String() != "thanks" {
+		t.Fatalf("last user = %s", messages[2].Raw)
+	}
+
+	if got.Get("tools.0.input_schema.properties.q.type").String() != "string" || got.Get("tools.0.description").String() != "search" {
+		t.Fatalf("tools = %s", got.Get("tools").Raw)
+	}
+	if got.Get("tool_choice.type").String() != "tool" || got.Get("tool_choice.name").String() != "lookup" ||
+		!got.Get("tool_choice.disable_parallel_tool_use").Bool() {
+		t.Fatalf("tool_choice = %s", got.Get("tool_choice").Raw)
+	}
+}
+
+func TestOpenAIChatRequestToClaude_DefaultsAndErrors(t *testing.T) {
+	claudeReq, err := OpenAIChatRequestToClaude([]byte(`{"model":"m","stream":true,"stop":["a","b"],"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if claudeReq["max_tokens"] != DefaultChatCompletionsMaxTokens || claudeReq["stream"] != true {
+		t.Fatalf("claudeReq = %+v", claudeReq)
+	}
+	if seqs, _ := claudeReq["stop_sequences"].([]string); len(seqs) != 2 {
+		t.Fatalf("stop_sequences = %v", claudeReq["stop_sequences"])
+	}
+	if _, ok := claudeReq["tool_choice"]; ok {
+		t.Fatalf("tool_choice should be omitted without tools")
+	}
+
+	for name, body := range map[string]string{
+		"invalid json":  `{`,
+		"missing model": `{"messages":[{"role":"user","content":"hi"}]}`,
+		"no messages":   `{"model":"m","messages":[]}`,
+		"system only":   `{"model":"m","messages":[{"role":"system","content":"x"}]}`,
+	} {
+		if _, err := OpenAIChatRequestToClaude([]byte(body)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
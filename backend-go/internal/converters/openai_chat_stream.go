@@ -0,0 +1,214 @@
+package converters
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+)
+
+// ClaudeToOpenAIChatStreamConverter 将 Claude SSE 事件转换为 OpenAI Chat Completions 流式块（chat.completion.chunk）
+// text 块映射为 delta.content，thinking 块映射为 delta.reasoning_content，tool_use 块映射为 delta.tool_calls，
+// includeUsage 为 true（stream_options.include_usage）时在结束前发送 choices 为空、携带 usage 的块
+// 非并发安全，每个流使用独立实例
+type ClaudeToOpenAIChatStreamConverter struct {
+	id           string
+	model        string
+	created      int64
+	includeUsage bool
+	started      bool
+	finished     bool
+	toolIndexes  map[int]int // Claude 块 index -> tool_calls index
+	nextTool     int
+	stopReason   string
+	inputTokens  int64
+	outputTokens int64
+	cacheCreate  int64
+	cacheRead    int64
+}
+
+// NewClaudeToOpenAIChatStreamConverter 创建 Claude → Chat Completions 流式转换器
+func NewClaudeToOpenAIChatStreamConverter(includeUsage bool) *ClaudeToOpenAIChatStreamConverter {
+	return &ClaudeToOpenAIChatStreamConverter{
+		id:           "chatcmpl-" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		created:      time.Now().Unix(),
+		includeUsage: includeUsage,
+		toolIndexes:  make(map[int]int),
+	}
+}
+
+// ProcessEvent 处理一个 Claude 流式事件（eventType 为 SSE event 名，data 为事件 JSON），返回需要发送的 SSE 数据
+// ping 转换为 SSE 注释保持连接，error 事件转换为 OpenAI 错误对象
+func (sc *ClaudeToOpenAIChatStreamConverter) ProcessEvent(eventType string, data []byte) []string {
+	if sc.finished {
+		return nil
+	}
+	event := gjson.ParseBytes(data)
+	if eventType == "" {
+		eventType = event.Get("type").String()
+	}
+
+	var chunks []string
+	switch eventType {
+	case "ping":
+		chunks = append(chunks, ": ping\n\n")
+
+	case "error":
+		sc.finished = true
+		chunks = append(chunks, chatSSEData(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": event.Get("error.message").String(),
+				"type":    event.Get("error.type").String(),
+			},
+		}))
+
+	case "message_start":
+		if id := event.Get("message.id").String(); id != "" {
+			sc.id = id
+		}
+		sc.model = event.Get("message.model").String()
+		sc.recordUsage(event.Get("message.usage"))
+		chunks = append(chunks, sc.ensureStarted()...)
+
+	case "content_block_start":
+		chunks = append(chunks, sc.ensureStarted()...)
+		block := event.Get("content_block")
+		switch block.Get("type").String() {
+		case "text":
+			if text := block.Get("text").String(); text != "" {
+				chunks = append(chunks, sc.chunk(map[string]interface{}{"content": text}, nil))
+			}
+		case "thinking":
+			if text := block.Get("thinking").String(); text != "" {
+				chunks = append(chunks, sc.chunk(map[string]interface{}{"reasoning_content": text}, nil))
+			}
+		case "tool_use":
+			toolIndex := sc.nextTool
+			sc.nextTool++
+			sc.toolIndexes[int(event.Get("index").Int())] = toolIndex
+			chunks = append(chunks, sc.chunk(map[string]interface{}{
+				"tool_calls": []map[string]interface{}{{
+					"index": toolIndex,
+					"id":    block.Get("id").String(),
+					"type":  "function",
+					"function": map[string]interface{}{
+						"name":      block.Get("name").String(),
+						"arguments": "",
+					},
+				}},
+			}, nil))
+		}
+
+	case "content_block_delta":
+		delta := event.Get("delta")
+		switch delta.Get("type").String() {
+		case "text_delta":
+			if text := delta.Get("text").String(); text != "" {
+				chunks = append(chunks, sc.chunk(map[string]interface{}{"content": text}, nil))
+			}
+		case "thinking_delta":
+			if text := delta.Get("thinking").String(); text != "" {
+				chunks = append(chunks, sc.chunk(map[string]interface{}{"reasoning_content": text}, nil))
+			}
+		case "input_json_delta":
+			toolIndex, ok := sc.toolIndexes[int(event.Get("index").Int())]
+			if partial := delta.Get("partial_json").String(); ok && partial != "" {
+				chunks = append(chunks, sc.chunk(map[string]interface{}{
+					"tool_calls": []map[string]interface{}{{
+						"index":    toolIndex,
+						"function": map[string]interface{}{"arguments": partial},
+					}},
+				}, nil))
+			}
+		}
+
+	case "message_delta":
+		if reason := event.Get("delta.stop_reason").String(); reason != "" {
+			sc.stopReason = reason
+		}
+		sc.recordUsage(event.Get("usage"))
+
+	case "message_stop":
+		chunks = append(chunks, sc.Finish()...)
+	}
+	return chunks
+}
+
+// Finish 结束流：发送带 finish_reason 的块、可选的 usage 块与 [DONE]
+func (sc *ClaudeToOpenAIChatStreamConverter) Finish() []string {
+	if sc.finished {
+		return nil
+	}
+	chunks := sc.ensureStarted()
+	sc.finished = true
+
+	finishReason := AnthropicStopReasonToOpenAI(sc.stopReason)
+	if sc.nextTool > 0 {
+		finishReason = "tool_calls"
+	}
+	chunks = append(chunks, sc.chunk(map[string]interface{}{}, finishReason))
+
+	if sc.includeUsage {
+		// OpenAI prompt_tokens 包含缓存部分，Claude input_tokens 不包含
+		promptTokens := sc.inputTokens + sc.cacheCreate + sc.cacheRead
+		usage := map[string]interface{}{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": sc.outputTokens,
+			"total_tokens":      promptTokens + sc.outputTokens,
+		}
+		if sc.cacheRead > 0 {
+			usage["prompt_tokens_details"] = map[string]interface{}{"cached_tokens": sc.cacheRead}
+		}
+		payload := sc.chunkObject()
+		payload["choices"] = []interface{}{}
+		payload["usage"] = usage
+		chunks = append(chunks, chatSSEData(payload))
+	}
+	return append(chunks, "data: [DONE]\n\n")
+}
+
+func (sc *ClaudeToOpenAIChatStreamConverter) ensureStarted() []string {
+	if sc.started {
+		return nil
+	}
+	sc.started = true
+	return []string{sc.chunk(map[string]interface{}{"role": "assistant", "content": ""}, nil)}
+}
+
+// recordUsage 记录 Claude usage（message_start 与 message_delta 中的值取较大者）
+func (sc *ClaudeToOpenAIChatStreamConverter) recordUsage(usage gjson.Result) {
+	if !usage.Exists() {
+		return
+	}
+	sc.inputTokens = max(sc.inputTokens, usage.Get("input_tokens").Int())
+	sc.outputTokens = max(sc.outputTokens, usage.Get("output_tokens").Int())
+	sc.cacheCreate = max(sc.cacheCreate, usage.Get("cache_creation_input_tokens").Int())
+	sc.cacheRead = max(sc.cacheRead, usage.Get("cache_read_input_tokens").Int())
+}
+
+func (sc *ClaudeToOpenAIChatStreamConverter) chunkObject() map[string]interface{} {
+	return map[string]interface{}{
+		"id":      sc.id,
+		"object":  "chat.completion.chunk",
+		"created": sc.created,
+		"model":   sc.model,
+	}
+}
+
+// chunk 构建单个 choice 的 chat.completion.chunk（finishReason 为 nil 时输出 null）
+func (sc *ClaudeToOpenAIChatStreamConverter) chunk(delta map[string]interface{}, finishReason interface{}) string {
+	payload := sc.chunkObject()
+	payload["choices"] = []map[string]interface{}{{
+		"index":         0,
+		"delta":         delta,
+		"finish_reason": finishReason,
+	}}
+	return chatSSEData(payload)
+}
+
+func chatSSEData(payload map[string]interface{}) string {
+	data, _ := JSONMarshal(payload)
+	return fmt.Sprintf("data: %s\n\n", data)
+}
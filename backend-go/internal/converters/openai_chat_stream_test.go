@@ -0,0 +1,107 @@
+package converters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func chatChunks(t *testing.T, out []string) []gjson.Result {
+	t.Helper()
+	var chunks []gjson.Result
+	for _, s := range out {
+		data, ok := strings.CutPrefix(s, "data: ")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			continue
+		}
+		chunks = append(chunks, gjson.Parse(data))
+	}
+	return chunks
+}
+
+func TestClaudeToOpenAIChatStreamConverter_ToolCalls(t *testing.T) {
+	sc := NewClaudeToOpenAIChatStreamConverter(true)
+	var out []string
+	for _, e := range []struct{ typ, data string }{
+		{"message_start", `{"type":"message_start","message":{"id":"msg_1","model":"claude-3","usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":1}}}`},
+		{"ping", `{"type":"ping"}`},
+		{"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`},
+		{"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`},
+		{"content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup","input":{}}}`},
+		{"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`},
+		{"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"cat\"}"}}`},
+		{"content_block_stop", `{"type":"content_block_stop","index":1}`},
+		{"message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`},
+		{"message_stop", `{"type":"message_stop"}`},
+	} {
+		out = append(out, sc.ProcessEvent(e.typ, []byte(e.data))...)
+	}
+
+	if out[len(out)-1] != "data: [DONE]\n\n" {
+		t.Fatalf("last output = %q", out[len(out)-1])
+	}
+	if !strings.Contains(strings.Join(out, ""), ": ping\n\n") {
+		t.Fatalf("ping should be kept as SSE comment")
+	}
+
+	chunks := chatChunks(t, out)
+	if chunks[0].Get("id").String() != "msg_1" || chunks[0].Get("choices.0.delta.role").String() != "assistant" {
+		t.Fatalf("first chunk = %s", chunks[0].Raw)
+	}
+	var reasoning, args string
+	var finish string
+	for _, c := range chunks {
+		reasoning += c.Get("choices.0.delta.reasoning_content").String()
+		if call := c.Get("choices.0.delta.tool_calls.0"); call.Exists() {
+			if call.Get("index").Int() != 0 {
+				t.Fatalf("tool call index = %s", call.Raw)
+			}
+			if id := call.Get("id").String(); id != "" && (id != "toolu_1" || call.Get("function.name").String() != "lookup") {
+				t.Fatalf("tool call header = %s", call.Raw)
+			}
+			args += call.Get("function.arguments").String()
+		}
+		if fr := c.Get("choices.0.finish_reason").String(); fr != "" {
+			finish = fr
+		}
+	}
+	if reasoning != "hmm" || args != `{"q":"cat"}` || finish != "tool_calls" {
+		t.Fatalf("reasoning=%q args=%q finish=%q", reasoning, args, finish)
+	}
+
+	usage := chunks[len(chunks)-1]
+	if usage.Get("choices.#").Int() != 0 || usage.Get("usage.prompt_tokens").Int() != 15 ||
+		usage.Get("usage.completion_tokens").Int() != 9 || usage.Get("usage.prompt_tokens_details.cached_tokens").Int() != 5 {
+		t.Fatalf("usage chunk = %s", usage.Raw)
+	}
+
+	if extra := sc.ProcessEvent("message_stop", []byte(`{"type":"message_stop"}`)); extra != nil {
+		t.Fatalf("events after finish = %v", extra)
+	}
+}
+
+func TestClaudeToOpenAIChatStreamConverter_ErrorAndNoUsage(t *testing.T) {
+	sc := NewClaudeToOpenAIChatStreamConverter(false)
+	out := sc.ProcessEvent("message_start", []byte(`{"type":"message_start","message":{"id":"msg_2","model":"m"}}`))
+	out = append(out, sc.ProcessEvent("error", []byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))...)
+	chunks := chatChunks(t, out)
+	if last := chunks[len(chunks)-1]; last.Get("error.type").String() != "overloaded_error" || last.Get("error.message").String() != "Overloaded" {
+		t.Fatalf("error chunk = %s", last.Raw)
+	}
+
+	sc = NewClaudeToOpenAIChatStreamConverter(false)
+	out = sc.ProcessEvent("", []byte(`{"type":"message_stop"}`))
+	for _, c := range chatChunks(t, out) {
+		if c.Get("usage").Exists() {
+			t.Fatalf("usage chunk sent without include_usage: %s", c.Raw)
+		}
+	}
+	if chatChunks(t, out)[1].Get("choices.0.finish_reason").String() != "stop" {
+		t.Fatalf("out = %v", out)
+	}
+}
@@ -50,6 +50,11 @@ func (c *OpenAIChatConverter) ToProviderRequest(sess *session.Session, req *type
 	if req.StreamOptions != nil {
 		openaiReq["stream_options"] = req.StreamOptions
 	}
+	if req.Reasoning != nil {
+		if effort := ReasoningEffortToOpenAI(req.Reasoning.Effort); effort != "" {
+			openaiReq["reasoning_effort"] = effort
+		}
+	}
 
 	return openaiReq, nil
 }
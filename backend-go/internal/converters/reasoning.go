@@ -0,0 +1,256 @@
+package converters
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ============== 推理强度（reasoning effort）归一化 ==============
+//
+// 不同协议表达推理强度的方式不同：
+//   - OpenAI Chat / Responses: reasoning_effort / reasoning.effort（minimal/low/medium/high）
+//   - Claude Messages: thinking.budget_tokens（token 预算）
+//   - Gemini: generationConfig.thinkingConfig.thinkingBudget / thinkingLevel
+//
+// 转换时先将来源协议的参数归一化为通用强度等级，再映射为目标协议的等价参数，
+// 保证跨协议路由时客户端的推理意图不丢失。
+
+// 通用推理强度等级
+const (
+	ReasoningEffortNone    = "none"
+	ReasoningEffortMinimal = "minimal"
+	ReasoningEffortLow     = "low"
+	ReasoningEffortMedium  = "medium"
+	ReasoningEffortHigh    = "high"
+)
+
+// claudeMinThinkingBudget Claude extended thinking 允许的最小 budget_tokens
+const claudeMinThinkingBudget = 1024
+
+// reasoningEffortLevels 按强度从低到高排列的等级（不含 none）
+var reasoningEffortLevels = []string{
+	ReasoningEffortMinimal,
+	ReasoningEffortLow,
+	ReasoningEffortMedium,
+	ReasoningEffortHigh,
+}
+
+// defaultReasoningEffortBudgets 各强度等级对应的默认 token 预算
+var defaultReasoningEffortBudgets = map[string]int{
+	ReasoningEffortMinimal: 1024,
+	ReasoningEffortLow:     4096,
+	ReasoningEffortMedium:  10240,
+	ReasoningEffortHigh:    32768,
+}
+
+var (
+	reasoningBudgetsMu sync.RWMutex
+	reasoningBudgets   = copyReasoningBudgets(defaultReasoningEffortBudgets)
+)
+
+// NormalizeReasoningEffort 将客户端传入的推理强度归一化为通用等级
+// 无法识别的值返回空字符串
+func NormalizeReasoningEffort(effort string) string {
+	switch strings.ToLower(strings.TrimSpace(effort)) {
+	case "none", "off", "disabled":
+		return ReasoningEffortNone
+	case "minimal", "min":
+		return ReasoningEffortMinimal
+	case "low":
+		return ReasoningEffortLow
+	case "medium", "med":
+		return ReasoningEffortMedium
+	case "high", "max", "xhigh":
+		return ReasoningEffortHigh
+	default:
+		return ""
+	}
+}
+
+// ParseReasoningEffortBudgets 解析推理强度预算配置
+// 格式: "minimal=1024,low=4096,medium=10240,high=32768"，未出现的等级使用默认值
+func ParseReasoningEffortBudgets(spec string) (map[string]int, error) {
+	budgets := copyReasoningBudgets(defaultReasoningEffortBudgets)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("无效的推理预算配置项: %q", part)
+		}
+		level := NormalizeReasoningEffort(name)
+		if level == "" || level == ReasoningEffortNone {
+			return nil, fmt.Errorf("未知的推理强度等级: %q", name)
+		}
+		budget, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || budget <= 0 {
+			return nil, fmt.Errorf("无效的推理预算: %q", part)
+		}
+		budgets[level] = budget
+	}
+
+	// 预算必须随强度单调递增，否则反向映射会产生歧义
+	for i := 1; i < len(reasoningEffortLevels); i++ {
+		prev, cur := reasoningEffortLevels[i-1], reasoningEffortLevels[i]
+		if budgets[cur] < budgets[prev] {
+			return nil, fmt.Errorf("推理预算必须随强度递增: %s=%d < %s=%d", cur, budgets[cur], prev, budgets[prev])
+		}
+	}
+	return budgets, nil
+}
+
+// SetReasoningEffortBudgets 设置各强度等级的 token 预算（nil 恢复默认值）
+func SetReasoningEffortBudgets(budgets map[string]int) {
+	reasoningBudgetsMu.Lock()
+	defer reasoningBudgetsMu.Unlock()
+	if budgets == nil {
+		reasoningBudgets = copyReasoningBudgets(defaultReasoningEffortBudgets)
+		return
+	}
+	reasoningBudgets = copyReasoningBudgets(budgets)
+}
+
+// ReasoningEffortToBudget 获取推理强度对应的 token 预算（none 或未知等级返回 0）
+func ReasoningEffortToBudget(effort string) int {
+	reasoningBudgetsMu.RLock()
+	defer reasoningBudgetsMu.RUnlock()
+	return reasoningBudgets[NormalizeReasoningEffort(effort)]
+}
+
+// ReasoningBudgetToEffort 将 token 预算映射为最接近的推理强度等级
+// 选择预算不小于给定值的最低等级，超过最高等级预算时返回 high；budget<=0 返回 none
+func ReasoningBudgetToEffort(budget int) string {
+	if budget <= 0 {
+		return ReasoningEffortNone
+	}
+
+	reasoningBudgetsMu.RLock()
+	defer reasoningBudgetsMu.RUnlock()
+	for _, level := range reasoningEffortLevels {
+		if budget <= reasoningBudgets[level] {
+			return level
+		}
+	}
+	return ReasoningEffortHigh
+}
+
+// ClaudeThinkingToReasoningEffort 从 Claude thinking 参数中提取推理强度
+// 未设置 thinking 时返回空字符串（保持上游默认行为）
+func ClaudeThinkingToReasoningEffort(thinking interface{}) string {
+	m, ok := thinking.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch m["type"] {
+	case "disabled":
+		return ReasoningEffortNone
+	case "enabled":
+		budget, _ := toInt(m["budget_tokens"])
+		if budget <= 0 {
+			return ReasoningEffortMedium
+		}
+		return ReasoningBudgetToEffort(budget)
+	default:
+		return ""
+	}
+}
+
+// ReasoningEffortToClaudeThinking 将推理强度映射为 Claude thinking 参数
+// Claude 要求 budget_tokens >= 1024 且小于 max_tokens，无法满足时返回 nil（不启用 thinking）
+func ReasoningEffortToClaudeThinking(effort string, maxTokens int) map[string]interface{} {
+	budget := ReasoningEffortToBudget(effort)
+	if budget <= 0 {
+		return nil
+	}
+	if budget < claudeMinThinkingBudget {
+		budget = claudeMinThinkingBudget
+	}
+	if maxTokens > 0 && budget >= maxTokens {
+		budget = maxTokens - 1
+	}
+	if budget < claudeMinThinkingBudget {
+		return nil
+	}
+	return map[string]interface{}{
+		"type":          "enabled",
+		"budget_tokens": budget,
+	}
+}
+
+// GeminiThinkingToReasoningEffort 从 Gemini thinkingConfig 中提取推理强度
+// thinkingBudget 为 -1 表示动态预算，按 medium 处理
+func GeminiThinkingToReasoningEffort(budget *int32, level string) string {
+	if level != "" {
+		if effort := NormalizeReasoningEffort(level); effort != "" {
+			return effort
+		}
+	}
+	if budget == nil {
+		return ""
+	}
+	if *budget < 0 {
+		return ReasoningEffortMedium
+	}
+	return ReasoningBudgetToEffort(int(*budget))
+}
+
+// ReasoningEffortToGeminiThinkingConfig 将推理强度映射为 Gemini thinkingConfig
+// none 映射为 thinkingBudget=0（关闭推理），未知等级返回 nil
+func ReasoningEffortToGeminiThinkingConfig(effort string) map[string]interface{} {
+	normalized := NormalizeReasoningEffort(effort)
+	if normalized == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"thinkingBudget": ReasoningEffortToBudget(normalized),
+	}
+}
+
+// ReasoningEffortToOpenAI 将推理强度映射为 OpenAI reasoning_effort
+// none 与未知等级返回空字符串（不传该参数，使用上游默认值）
+func ReasoningEffortToOpenAI(effort string) string {
+	normalized := NormalizeReasoningEffort(effort)
+	if normalized == ReasoningEffortNone {
+		return ""
+	}
+	return normalized
+}
+
+// ReasoningEffortBudgetsString 返回当前生效的强度预算（按强度排序，用于日志展示）
+func ReasoningEffortBudgetsString() string {
+	reasoningBudgetsMu.RLock()
+	defer reasoningBudgetsMu.RUnlock()
+	parts := make([]string, 0, len(reasoningEffortLevels))
+	for _, level := range reasoningEffortLevels {
+		parts = append(parts, fmt.Sprintf("%s=%d", level, reasoningBudgets[level]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func copyReasoningBudgets(src map[string]int) map[string]int {
+	dst := make(map[string]int, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// toInt 将 JSON 数字（float64/int 等）转换为 int
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	default:
+		return 0, false
+	}
+}
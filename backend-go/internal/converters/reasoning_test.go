@@ -0,0 +1,192 @@
+package converters
+
+import (
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/session"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+// ============== 推理强度归一化测试 ==============
+
+func TestNormalizeReasoningEffort(t *testing.T) {
+	tests := map[string]string{
+		"low":      ReasoningEffortLow,
+		" HIGH ":   ReasoningEffortHigh,
+		"med":      ReasoningEffortMedium,
+		"minimal":  ReasoningEffortMinimal,
+		"disabled": ReasoningEffortNone,
+		"xhigh":    ReasoningEffortHigh,
+		"bogus":    "",
+	}
+	for in, want := range tests {
+		if got := NormalizeReasoningEffort(in); got != want {
+			t.Errorf("NormalizeReasoningEffort(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestReasoningBudgetToEffort(t *testing.T) {
+	tests := []struct {
+		budget int
+		want   string
+	}{
+		{0, ReasoningEffortNone},
+		{512, ReasoningEffortMinimal},
+		{1024, ReasoningEffortMinimal},
+		{4096, ReasoningEffortLow},
+		{8000, ReasoningEffortMedium},
+		{20000, ReasoningEffortHigh},
+		{100000, ReasoningEffortHigh},
+	}
+	for _, tt := range tests {
+		if got := ReasoningBudgetToEffort(tt.budget); got != tt.want {
+			t.Errorf("ReasoningBudgetToEffort(%d) = %q, want %q", tt.budget, got, tt.want)
+		}
+	}
+}
+
+func TestReasoningEffortToClaudeThinking_ClampsToMaxTokens(t *testing.T) {
+	thinking := ReasoningEffortToClaudeThinking("high", 8000)
+	if thinking == nil {
+		t.Fatal("期望生成 thinking 参数")
+	}
+	if thinking["budget_tokens"] != 7999 {
+		t.Errorf("budget_tokens = %v, want 7999", thinking["budget_tokens"])
+	}
+
+	// max_tokens 过小无法满足 Claude 最小预算时不启用 thinking
+	if got := ReasoningEffortToClaudeThinking("high", 1000); got != nil {
+		t.Errorf("max_tokens 过小时不应生成 thinking: %v", got)
+	}
+	if got := ReasoningEffortToClaudeThinking("none", 0); got != nil {
+		t.Errorf("none 不应生成 thinking: %v", got)
+	}
+}
+
+func TestParseReasoningEffortBudgets(t *testing.T) {
+	budgets, err := ParseReasoningEffortBudgets("low=2048, high=64000")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if budgets[ReasoningEffortLow] != 2048 || budgets[ReasoningEffortHigh] != 64000 {
+		t.Errorf("budgets = %v", budgets)
+	}
+	if budgets[ReasoningEffortMedium] != defaultReasoningEffortBudgets[ReasoningEffortMedium] {
+		t.Errorf("未配置的等级应保留默认值: %v", budgets)
+	}
+
+	for _, spec := range []string{"low", "ultra=1", "low=abc", "low=20000"} {
+		if _, err := ParseReasoningEffortBudgets(spec); err == nil {
+			t.Errorf("期望 %q 解析失败", spec)
+		}
+	}
+}
+
+func TestSetReasoningEffortBudgets(t *testing.T) {
+	defer SetReasoningEffortBudgets(nil)
+
+	budgets, err := ParseReasoningEffortBudgets("medium=20000")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	SetReasoningEffortBudgets(budgets)
+
+	if got := ReasoningEffortToBudget("medium"); got != 20000 {
+		t.Errorf("medium budget = %d, want 20000", got)
+	}
+	if got := ReasoningBudgetToEffort(15000); got != ReasoningEffortMedium {
+		t.Errorf("ReasoningBudgetToEffort(15000) = %q, want medium", got)
+	}
+}
+
+// ============== 跨协议映射测试 ==============
+
+func TestResponsesReasoningEffort_MapsPerProvider(t *testing.T) {
+	sess := &session.Session{ID: "sess_test", Messages: []types.ResponsesItem{}}
+	newReq := func() *types.ResponsesRequest {
+		return &types.ResponsesRequest{
+			Model:     "test-model",
+			Input:     "Hello!",
+			MaxTokens: 16000,
+			Reasoning: &types.ResponsesReasoning{Effort: "medium"},
+		}
+	}
+
+	claudeResult, err := (&ClaudeConverter{}).ToProviderRequest(sess, newReq())
+	if err != nil {
+		t.Fatalf("Claude 转换失败: %v", err)
+	}
+	thinking, ok := claudeResult.(map[string]interface{})["thinking"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Claude 请求缺少 thinking 参数")
+	}
+	if thinking["type"] != "enabled" || thinking["budget_tokens"] != 10240 {
+		t.Errorf("thinking = %v", thinking)
+	}
+
+	openaiResult, err := (&OpenAIChatConverter{}).ToProviderRequest(sess, newReq())
+	if err != nil {
+		t.Fatalf("OpenAI 转换失败: %v", err)
+	}
+	if got := openaiResult.(map[string]interface{})["reasoning_effort"]; got != "medium" {
+		t.Errorf("reasoning_effort = %v, want medium", got)
+	}
+}
+
+func TestGeminiThinkingConfig_MapsPerProvider(t *testing.T) {
+	budget := int32(3000)
+	geminiReq := &types.GeminiRequest{
+		Contents: []types.GeminiContent{{Role: "user", Parts: []types.GeminiPart{{Text: "hi"}}}},
+		GenerationConfig: &types.GeminiGenerationConfig{
+			MaxOutputTokens: 20000,
+			ThinkingConfig:  &types.GeminiThinkingConfig{ThinkingBudget: &budget},
+		},
+	}
+
+	claudeReq, err := GeminiToClaudeRequest(geminiReq, "claude-test")
+	if err != nil {
+		t.Fatalf("转换失败: %v", err)
+	}
+	thinking, ok := claudeReq["thinking"].(map[string]interface{})
+	if !ok || thinking["budget_tokens"] != 4096 {
+		t.Errorf("thinking = %v, want low 档位预算 4096", claudeReq["thinking"])
+	}
+
+	openaiReq, err := GeminiToOpenAIRequest(geminiReq, "gpt-test")
+	if err != nil {
+		t.Fatalf("转换失败: %v", err)
+	}
+	if openaiReq["reasoning_effort"] != "low" {
+		t.Errorf("reasoning_effort = %v, want low", openaiReq["reasoning_effort"])
+	}
+
+	// thinkingLevel 优先于 thinkingBudget
+	geminiReq.GenerationConfig.ThinkingConfig.ThinkingLevel = "high"
+	openaiReq, _ = GeminiToOpenAIRequest(geminiReq, "gpt-test")
+	if openaiReq["reasoning_effort"] != "high" {
+		t.Errorf("reasoning_effort = %v, want high", openaiReq["reasoning_effort"])
+	}
+}
+
+func TestClaudeThinkingToReasoningEffort(t *testing.T) {
+	tests := []struct {
+		thinking interface{}
+		want     string
+	}{
+		{nil, ""},
+		{map[string]interface{}{"type": "disabled"}, ReasoningEffortNone},
+		{map[string]interface{}{"type": "enabled", "budget_tokens": float64(2000)}, ReasoningEffortLow},
+		{map[string]interface{}{"type": "enabled"}, ReasoningEffortMedium},
+	}
+	for _, tt := range tests {
+		if got := ClaudeThinkingToReasoningEffort(tt.thinking); got != tt.want {
+			t.Errorf("ClaudeThinkingToReasoningEffort(%v) = %q, want %q", tt.thinking, got, tt.want)
+		}
+	}
+
+	config := ReasoningEffortToGeminiThinkingConfig(ReasoningEffortNone)
+	if config["thinkingBudget"] != 0 {
+		t.Errorf("none 应映射为 thinkingBudget=0: %v", config)
+	}
+}
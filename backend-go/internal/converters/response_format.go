@@ -0,0 +1,145 @@
+package converters
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+// ============== 客户端响应格式协商（Accept 头） ==============
+
+// ClaudeResponseToOpenAIChat 将 Claude Messages 非流式响应转换为 OpenAI Chat Completions 响应
+// thinking 块转换为 reasoning_content，tool_use 块转换为 tool_calls
+func ClaudeResponseToOpenAIChat(resp *types.ClaudeResponse) map[string]interface{} {
+	var texts, reasoning []string
+	toolCalls := []map[string]interface{}{}
+
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			if block.Text != "" {
+				texts = append(texts, block.Text)
+			}
+		case "thinking":
+			if s, ok := block.Thinking.(string); ok && s != "" {
+				reasoning = append(reasoning, s)
+			}
+		case "tool_use":
+			args := "{}"
+			if block.Input != nil {
+				if data, err := json.Marshal(block.Input); err == nil {
+					args = string(data)
+				}
+			}
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":   block.ID,
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      block.Name,
+					"arguments": args,
+				},
+			})
+		}
+	}
+
+	message := map[string]interface{}{
+		"role":    "assistant",
+		"content": nil,
+	}
+	if len(texts) > 0 {
+		message["content"] = strings.Join(texts, "")
+	}
+	if len(reasoning) > 0 {
+		message["reasoning_content"] = strings.Join(reasoning, "")
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+
+	finishReason := AnthropicStopReasonToOpenAI(resp.StopReason)
+	if len(toolCalls) > 0 {
+		finishReason = "tool_calls"
+	}
+
+	out := map[string]interface{}{
+		"id":      resp.ID,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   resp.Model,
+		"choices": []map[string]interface{}{
+			{
+				"index":         0,
+				"message":       message,
+				"finish_reason": finishReason,
+			},
+		},
+	}
+
+	if resp.Usage != nil {
+		// OpenAI prompt_tokens 包含缓存部分，Claude input_tokens 不包含
+		promptTokens := resp.Usage.InputTokens + resp.Usage.CacheCreationInputTokens + resp.Usage.CacheReadInputTokens
+		usage := map[string]interface{}{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": resp.Usage.OutputTokens,
+			"total_tokens":      promptTokens + resp.Usage.OutputTokens,
+		}
+		if resp.Usage.CacheReadInputTokens > 0 {
+			usage["prompt_tokens_details"] = map[string]interface{}{
+				"cached_tokens": resp.Usage.CacheReadInputTokens,
+			}
+		}
+		out["usage"] = usage
+	}
+	return out
+}
+
+// ResponsesResponseToClaude 将 Responses 非流式响应转换为 Claude Messages 响应
+// message/text 项转换为 text 块，携带 tool_use 的项转换为 tool_use 块
+func ResponsesResponseToClaude(resp *types.ResponsesResponse) *types.ClaudeResponse {
+	out := &types.ClaudeResponse{
+		ID:      resp.ID,
+		Type:    "message",
+		Role:    "assistant",
+		Model:   resp.Model,
+		Content: []types.ClaudeContent{},
+	}
+
+	hasToolUse := false
+	for _, item := range resp.Output {
+		if item.ToolUse != nil {
+			out.Content = append(out.Content, types.ClaudeContent{
+				Type:  "tool_use",
+				ID:    item.ToolUse.ID,
+				Name:  item.ToolUse.Name,
+				Input: item.ToolUse.Input,
+			})
+			hasToolUse = true
+			continue
+		}
+		if item.Type != "message" && item.Type != "text" {
+			continue
+		}
+		if text := extractTextFromContent(item.Content); text != "" {
+			out.Content = append(out.Content, types.ClaudeContent{Type: "text", Text: text})
+		}
+	}
+
+	switch {
+	case hasToolUse:
+		out.StopReason = "tool_use"
+	case resp.Status == "incomplete":
+		out.StopReason = "max_tokens"
+	default:
+		out.StopReason = "end_turn"
+	}
+
+	out.Usage = &types.Usage{
+		InputTokens:              resp.Usage.InputTokens,
+		OutputTokens:             resp.Usage.OutputTokens,
+		CacheCreationInputTokens: resp.Usage.CacheCreationInputTokens,
+		CacheReadInputTokens:     resp.Usage.CacheReadInputTokens,
+	}
+	return out
+}
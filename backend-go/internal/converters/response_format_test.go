@@ -0,0 +1,123 @@
+package converters
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+func TestClaudeResponseToOpenAIChat(t *testing.T) {
+	resp := &types.ClaudeResponse{
+		ID:    "msg_1",
+		Model: "claude-x",
+		Content: []types.ClaudeContent{
+			{Type: "thinking", Thinking: "let me think"},
+			{Type: "text", Text: "hello "},
+			{Type: "text", Text: "world"},
+			{Type: "tool_use", ID: "toolu_1", Name: "get_weather", Input: map[string]interface{}{"city": "Paris"}},
+		},
+		StopReason: "tool_use",
+		Usage:      &types.Usage{InputTokens: 10, OutputTokens: 5, CacheReadInputTokens: 4},
+	}
+
+	data, _ := json.Marshal(ClaudeResponseToOpenAIChat(resp))
+	var out struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Role             string `json:"role"`
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				ToolCalls        []struct {
+					ID       string `json:"id"`
+					Type     string `json:"type"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens        int `json:"prompt_tokens"`
+			CompletionTokens    int `json:"completion_tokens"`
+			TotalTokens         int `json:"total_tokens"`
+			PromptTokensDetails struct {
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"prompt_tokens_details"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if out.ID != "msg_1" || out.Object != "chat.completion" || out.Model != "claude-x" || len(out.Choices) != 1 {
+		t.Fatalf("unexpected envelope: %s", data)
+	}
+	msg := out.Choices[0].Message
+	if msg.Role != "assistant" || msg.Content != "hello world" || msg.ReasoningContent != "let me think" {
+		t.Fatalf("unexpected message: %s", data)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].ID != "toolu_1" || msg.ToolCalls[0].Type != "function" ||
+		msg.ToolCalls[0].Function.Name != "get_weather" || msg.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("unexpected tool_calls: %s", data)
+	}
+	if out.Choices[0].FinishReason != "tool_calls" {
+		t.Fatalf("finish_reason = %q, want tool_calls", out.Choices[0].FinishReason)
+	}
+	if out.Usage.PromptTokens != 14 || out.Usage.CompletionTokens != 5 || out.Usage.TotalTokens != 19 || out.Usage.PromptTokensDetails.CachedTokens != 4 {
+		t.Fatalf("unexpected usage: %s", data)
+	}
+}
+
+func TestClaudeResponseToOpenAIChat_TextOnly(t *testing.T) {
+	out := ClaudeResponseToOpenAIChat(&types.ClaudeResponse{
+		ID:         "msg_2",
+		Content:    []types.ClaudeContent{{Type: "text", Text: "hi"}},
+		StopReason: "max_tokens",
+	})
+	choice := out["choices"].([]map[string]interface{})[0]
+	if choice["finish_reason"] != "length" {
+		t.Fatalf("finish_reason = %v, want length", choice["finish_reason"])
+	}
+	message := choice["message"].(map[string]interface{})
+	if _, ok := message["tool_calls"]; ok {
+		t.Fatalf("tool_calls should be omitted: %v", message)
+	}
+	if _, ok := out["usage"]; ok {
+		t.Fatalf("usage should be omitted without upstream usage")
+	}
+}
+
+func TestResponsesResponseToClaude(t *testing.T) {
+	resp := &types.ResponsesResponse{
+		ID:    "resp_1",
+		Model: "gpt-x",
+		Output: []types.ResponsesItem{
+			{Type: "message", Role: "assistant", Content: []interface{}{map[string]interface{}{"type": "output_text", "text": "hello"}}},
+			{Type: "text", Content: "world"},
+		},
+		Status: "incomplete",
+		Usage:  types.ResponsesUsage{InputTokens: 3, OutputTokens: 2},
+	}
+
+	out := ResponsesResponseToClaude(resp)
+	if out.ID != "resp_1" || out.Type != "message" || out.Role != "assistant" || out.Model != "gpt-x" {
+		t.Fatalf("unexpected envelope: %+v", out)
+	}
+	if len(out.Content) != 2 || out.Content[0].Text != "hello" || out.Content[1].Text != "world" {
+		t.Fatalf("unexpected content: %+v", out.Content)
+	}
+	if out.StopReason != "max_tokens" || out.Usage.InputTokens != 3 || out.Usage.OutputTokens != 2 {
+		t.Fatalf("unexpected stop/usage: %+v", out)
+	}
+
+	resp.Output = append(resp.Output, types.ResponsesItem{Type: "tool_call", ToolUse: &types.ToolUse{ID: "call_1", Name: "f", Input: map[string]interface{}{}}})
+	if out := ResponsesResponseToClaude(resp); out.StopReason != "tool_use" || out.Content[2].Type != "tool_use" || out.Content[2].ID != "call_1" {
+		t.Fatalf("unexpected tool_use conversion: %+v", out)
+	}
+}
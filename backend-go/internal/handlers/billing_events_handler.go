@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/BenedictKing/claude-proxy/internal/billing"
+	"github.com/gin-gonic/gin"
+)
+
+// BillingEventsHandler 处理计费事件审计日志 API
+type BillingEventsHandler struct {
+	ledger *billing.Ledger
+}
+
+// NewBillingEventsHandler 创建 handler
+func NewBillingEventsHandler(ledger *billing.Ledger) *BillingEventsHandler {
+	return &BillingEventsHandler{ledger: ledger}
+}
+
+// BillingEventsResponse 计费事件查询响应
+type BillingEventsResponse struct {
+	Events []billing.Event `json:"events"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+// GetEvents 查询计费事件（用于对账）
+// GET /api/billing/events?requestId=&apiKey=&limit=50&offset=0
+func (h *BillingEventsHandler) GetEvents(c *gin.Context) {
+	if h == nil || h.ledger == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "计费事件日志未启用"})
+		return
+	}
+
+	limit := parseLimit(c.Query("limit"))
+	offset := parseOffset(c.Query("offset"))
+
+	events, total, err := h.ledger.Query(billing.EventFilter{
+		RequestID: c.Query("requestId"),
+		APIKey:    c.Query("apiKey"),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询计费事件失败"})
+		return
+	}
+	if events == nil {
+		events = []billing.Event{}
+	}
+
+	c.JSON(http.StatusOK, BillingEventsResponse{
+		Events: events,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
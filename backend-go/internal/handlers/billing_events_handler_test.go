@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/billing"
+	"github.com/BenedictKing/claude-proxy/internal/pricing"
+	"github.com/BenedictKing/claude-proxy/internal/usage"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func TestBillingEventsHandler_NilLedger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/billing/events", nil)
+
+	NewBillingEventsHandler(nil).GetEvents(c)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestBillingEventsHandler_GetEvents_AfterRequestCompletion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ledger, err := billing.NewLedger(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatalf("NewLedger: %v", err)
+	}
+	t.Cleanup(func() { _ = ledger.Close() })
+
+	billingHandler := billing.NewHandler(billing.NewClient(server.URL), &pricing.Service{}, usage.NewStore(100), 500)
+	billingHandler.SetLedger(ledger)
+
+	// 模拟一次完整的计费请求：预授权 -> 请求完成扣费
+	bc, _ := gin.CreateTestContext(httptest.NewRecorder())
+	bc.Set("billing_enabled", true)
+	bc.Set("api_key", "tenant-key")
+	reqCtx, err := billingHandler.BeforeRequest(bc)
+	if err != nil {
+		t.Fatalf("BeforeRequest: %v", err)
+	}
+	billingHandler.AfterRequest(reqCtx, "claude-3-5-sonnet-20241022", 100, 50, 0, 0)
+
+	r := gin.New()
+	r.GET("/api/billing/events", NewBillingEventsHandler(ledger).GetEvents)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/billing/events?requestId="+reqCtx.RequestID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	var resp BillingEventsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Total != 2 || len(resp.Events) != 2 {
+		t.Fatalf("resp=%+v", resp)
+	}
+	charge := resp.Events[0]
+	if charge.Type != billing.EventCharge || charge.Outcome != billing.OutcomeSuccess ||
+		charge.APIKey != utils.MaskAPIKey("tenant-key") || charge.InputTokens != 100 || charge.OutputTokens != 50 {
+		t.Fatalf("charge event=%+v", charge)
+	}
+
+	// 按 API Key 过滤
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, "/api/billing/events?apiKey=other-key", nil))
+	var empty BillingEventsResponse
+	if err := json.Unmarshal(w2.Body.Bytes(), &empty); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if empty.Total != 0 || empty.Events == nil {
+		t.Fatalf("resp=%+v body=%s", empty, w2.Body.String())
+	}
+}
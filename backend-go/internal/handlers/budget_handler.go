@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/BenedictKing/claude-proxy/internal/budget"
+	"github.com/gin-gonic/gin"
+)
+
+// budgetAPITypes 支持成本预算的接口类型
+var budgetAPITypes = []string{"messages", "responses"}
+
+// GetBudgetStatus 获取各接口类型的成本预算状态（已用/上限/剩余额度/重置时间）
+// GET /api/budget
+func GetBudgetStatus(bm *budget.BudgetManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		statuses := make(map[string]budget.Status, len(budgetAPITypes))
+		for _, apiType := range budgetAPITypes {
+			statuses[apiType] = bm.Status(apiType)
+		}
+		c.JSON(http.StatusOK, statuses)
+	}
+}
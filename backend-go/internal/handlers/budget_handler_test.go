@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/budget"
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetBudgetStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cm, _ := newTestConfigManager(t, config.Config{
+		CostBudgets: map[string]config.CostBudget{"messages": {DailyHardCents: 500}},
+	})
+	messagesMetrics := metrics.NewMetricsManager()
+	defer messagesMetrics.Stop()
+	messagesMetrics.RecordSuccessWithUsage("https://a", "sk-test", nil, "m1", 120)
+
+	bm := budget.NewBudgetManager(cm, map[string]budget.CostSource{"messages": messagesMetrics})
+	r := gin.New()
+	r.GET("/api/budget", GetBudgetStatus(bm))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/budget", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp map[string]budget.Status
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+
+	msg := resp["messages"]
+	if !msg.Enabled || len(msg.Periods) != 1 {
+		t.Fatalf("messages = %+v, want daily budget", msg)
+	}
+	if p := msg.Periods[0]; p.SpentCents != 120 || p.RemainingCents != 380 || p.HardExceeded {
+		t.Fatalf("daily = %+v, want spent 120 remaining 380", p)
+	}
+	if rsp, ok := resp["responses"]; !ok || rsp.Enabled {
+		t.Fatalf("responses = %+v, want present and disabled", rsp)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportChannels 导出全部渠道、密钥与负载均衡配置
+// GET /api/channels/export?redactKeys=true（脱敏明文密钥，用于分享/审阅；脱敏后的导出不能再导入）
+func ExportChannels(cfgManager *config.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		redactKeys, _ := strconv.ParseBool(c.Query("redactKeys"))
+		export := cfgManager.ExportChannels(redactKeys)
+
+		filename := fmt.Sprintf("channels-%s.json", export.ExportedAt.Format("20060102-150405"))
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.JSON(http.StatusOK, export)
+	}
+}
+
+// ImportChannels 校验并导入渠道配置（请求体为 ExportChannels 的导出格式）
+// POST /api/channels/import?mode=replace|merge&dryRun=true
+//   - replace：导入内容中出现的渠道列表整体替换对应接口类型的渠道
+//   - merge（默认）：同名渠道原位覆盖，其余追加到末尾
+//   - dryRun：只校验并返回导入统计，不修改配置
+//
+// 任一渠道校验失败时整个导入被拒绝，配置保持不变
+func ImportChannels(cfgManager *config.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mode := c.DefaultQuery("mode", config.ChannelImportMerge)
+		if mode != config.ChannelImportReplace && mode != config.ChannelImportMerge {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "mode must be replace or merge"})
+			return
+		}
+
+		var data config.ChannelExport
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+		result, err := cfgManager.ImportChannels(data, mode, dryRun)
+		if err != nil {
+			log.Printf("[Config-Import] 警告: 渠道配置导入失败，保留当前配置: %v", err)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+
+		message := "渠道配置已导入"
+		if dryRun {
+			message = "校验通过（dry-run，未修改配置）"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": message,
+			"result":  result,
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestChannelExportImportHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	src, _ := newTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "a", BaseURL: "https://a.example.com", APIKeys: []string{"sk-a-1234567890"}, ServiceType: "claude", Status: "active"},
+			{Name: "b", BaseURL: "https://b.example.com", APIKeys: []string{"sk-b-1234567890"}, ServiceType: "claude", Status: "disabled"},
+		},
+		LoadBalance: "failover",
+	})
+	dst, _ := newTestConfigManager(t, config.Config{
+		Upstream:    []config.UpstreamConfig{{Name: "b", BaseURL: "https://old-b.example.com", APIKeys: []string{"k"}, ServiceType: "claude"}},
+		LoadBalance: "failover",
+	})
+
+	r := gin.New()
+	r.GET("/api/channels/export", ExportChannels(src))
+	r.POST("/api/channels/import", ImportChannels(dst))
+	do := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodGet, "/api/channels/export", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("export status=%d headers=%v", w.Code, w.Header())
+	}
+	exported := w.Body.Bytes()
+
+	redacted := do(http.MethodGet, "/api/channels/export?redactKeys=true", nil)
+	if strings.Contains(redacted.Body.String(), "sk-a-1234567890") {
+		t.Fatalf("redacted export leaked key: %s", redacted.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/channels/import", redacted.Body.Bytes()); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("redacted import status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodPost, "/api/channels/import?mode=overwrite", exported); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid mode status=%d", w.Code)
+	}
+	if w := do(http.MethodPost, "/api/channels/import", []byte("{")); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid body status=%d", w.Code)
+	}
+
+	w = do(http.MethodPost, "/api/channels/import?dryRun=true", exported)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"dryRun":true`) {
+		t.Fatalf("dry-run status=%d body=%s", w.Code, w.Body.String())
+	}
+	if cfg := dst.GetConfig(); len(cfg.Upstream) != 1 || cfg.Upstream[0].BaseURL != "https://old-b.example.com" {
+		t.Fatalf("dry-run modified config: %+v", cfg.Upstream)
+	}
+
+	w = do(http.MethodPost, "/api/channels/import", exported)
+	var resp struct {
+		Success bool                       `json:"success"`
+		Result  config.ChannelImportResult `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || !resp.Success {
+		t.Fatalf("merge import status=%d body=%s", w.Code, w.Body.String())
+	}
+	if resp.Result.Mode != config.ChannelImportMerge || resp.Result.Messages.Updated != 1 || resp.Result.Messages.Added != 1 {
+		t.Fatalf("merge result = %+v", resp.Result)
+	}
+	cfg := dst.GetConfig()
+	if len(cfg.Upstream) != 2 || cfg.Upstream[0].Name != "b" || cfg.Upstream[0].Status != "disabled" || cfg.Upstream[1].Name != "a" {
+		t.Fatalf("merged channels = %+v", cfg.Upstream)
+	}
+}
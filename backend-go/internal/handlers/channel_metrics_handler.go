@@ -1,19 +1,25 @@
 package handlers
 
 import (
+	"errors"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
 	"github.com/BenedictKing/claude-proxy/internal/metrics"
 	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
 // GetChannelMetricsWithConfig 获取渠道指标（需要配置管理器来获取 baseURL 和 keys）
+// ?breakdown=url 时附带按 BaseURL 拆分的 urlMetrics
 func GetChannelMetricsWithConfig(metricsManager *metrics.MetricsManager, cfgManager *config.ConfigManager, isResponses bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		breakdownByURL := urlBreakdownRequested(c)
 		cfg := cfgManager.GetConfig()
 		var upstreams []config.UpstreamConfig
 		if isResponses {
@@ -50,6 +56,9 @@ func GetChannelMetricsWithConfig(metricsManager *metrics.MetricsManager, cfgMana
 			if resp.CircuitBrokenAt != nil {
 				item["circuitBrokenAt"] = *resp.CircuitBrokenAt
 			}
+			if breakdownByURL {
+				item["urlMetrics"] = metricsManager.GetURLMetrics(upstream.GetAllBaseURLs(), upstream.APIKeys)
+			}
 
 			result = append(result, item)
 		}
@@ -58,6 +67,106 @@ func GetChannelMetricsWithConfig(metricsManager *metrics.MetricsManager, cfgMana
 	}
 }
 
+// urlBreakdownRequested 是否请求按 BaseURL 拆分渠道指标（?breakdown=url）
+func urlBreakdownRequested(c *gin.Context) bool {
+	return strings.EqualFold(c.Query("breakdown"), "url")
+}
+
+// GetStreamCancellationStats 获取各渠道流式请求的客户端取消率与浪费的输出 token 数
+func GetStreamCancellationStats(metricsManager *metrics.MetricsManager, cfgManager *config.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := cfgManager.GetConfig()
+
+		result := make([]gin.H, 0, len(cfg.Upstream))
+		var total metrics.StreamCancelStats
+		for i, upstream := range cfg.Upstream {
+			stats := metricsManager.GetStreamCancelStats(upstream.GetAllBaseURLs(), upstream.APIKeys)
+			total.StreamCount += stats.StreamCount
+			total.CanceledCount += stats.CanceledCount
+			total.OutputTokensAtCancel += stats.OutputTokensAtCancel
+			total.WastedOutputTokens += stats.WastedOutputTokens
+
+			result = append(result, gin.H{
+				"channelIndex": i,
+				"channelName":  upstream.Name,
+				"stats":        stats,
+			})
+		}
+		if total.StreamCount > 0 {
+			total.CancellationRate = float64(total.CanceledCount) / float64(total.StreamCount) * 100
+		}
+
+		c.JSON(200, gin.H{
+			"channels": result,
+			"total":    total,
+		})
+	}
+}
+
+// GetCircuitRecoveryStats 获取各渠道 Key 从熔断打开到恢复的耗时统计（均值/分位数）
+// GET /api/{messages|responses|gemini}/channels/circuit-recovery
+func GetCircuitRecoveryStats(metricsManager *metrics.MetricsManager, cfgManager *config.ConfigManager, apiType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := cfgManager.GetConfig()
+		upstreams := cfg.Upstream
+		switch apiType {
+		case "responses":
+			upstreams = cfg.ResponsesUpstream
+		case "gemini":
+			upstreams = cfg.GeminiUpstream
+		}
+
+		result := make([]gin.H, 0, len(upstreams))
+		var allBaseURLs, allAPIKeys []string
+		for i, upstream := range upstreams {
+			allBaseURLs = append(allBaseURLs, upstream.GetAllBaseURLs()...)
+			allAPIKeys = append(allAPIKeys, upstream.APIKeys...)
+
+			keys, stats := metricsManager.GetCircuitRecoveryStats(upstream.GetAllBaseURLs(), upstream.APIKeys)
+			if keys == nil {
+				keys = []metrics.KeyCircuitRecoveryStats{}
+			}
+			result = append(result, gin.H{
+				"channelIndex": i,
+				"channelName":  upstream.Name,
+				"stats":        stats,
+				"keys":         keys,
+			})
+		}
+
+		// 汇总所有渠道的恢复样本（去重后每个 BaseURL × Key 只统计一次）
+		_, total := metricsManager.GetCircuitRecoveryStats(uniqueStrings(allBaseURLs), uniqueStrings(allAPIKeys))
+
+		c.JSON(200, gin.H{
+			"channels": result,
+			"total":    total,
+		})
+	}
+}
+
+// GetFailoverCostReport 获取故障转移到其他渠道相对主渠道的成本差报告（节省/多花费）
+// GET /api/{messages|responses|gemini}/channels/failover-cost
+func GetFailoverCostReport(sch *scheduler.ChannelScheduler, apiType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, sch.GetFailoverCostReport(apiType))
+	}
+}
+
+// GetShadowReport 获取影子渠道结果报告（与生产渠道指标分开统计）
+// GET /api/messages/channels/shadow
+func GetShadowReport(sch *scheduler.ChannelScheduler, apiType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, sch.GetShadowReport(apiType))
+	}
+}
+
+// uniqueStrings 去重（不保留顺序）
+func uniqueStrings(items []string) []string {
+	sorted := slices.Clone(items)
+	slices.Sort(sorted)
+	return slices.Compact(sorted)
+}
+
 // GetAllKeyMetrics 获取所有 Key 的原始指标
 func GetAllKeyMetrics(metricsManager *metrics.MetricsManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -175,6 +284,43 @@ func ResumeChannel(sch *scheduler.ChannelScheduler, isResponses bool) gin.Handle
 	}
 }
 
+// ResetChannelKeyMetrics 仅重置渠道中单个 Key 的指标（apiType: messages/responses/gemini）
+// 用于上游修复单个 Key 的配额后解除其熔断，不影响同渠道其他 Key 的历史
+func ResetChannelKeyMetrics(sch *scheduler.ChannelScheduler, apiType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid channel ID"})
+			return
+		}
+		apiKey := c.Param("apiKey")
+		if apiKey == "" {
+			c.JSON(400, gin.H{"error": "API key is required"})
+			return
+		}
+
+		results, err := sch.ResetChannelKeyMetrics(apiType, id, apiKey)
+		if err != nil {
+			switch {
+			case errors.Is(err, scheduler.ErrChannelNotFound):
+				c.JSON(404, gin.H{"error": "Channel not found"})
+			case errors.Is(err, scheduler.ErrKeyNotInChannel):
+				c.JSON(404, gin.H{"error": "API key not found"})
+			default:
+				c.JSON(500, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"success": true,
+			"message": "Key 指标已重置",
+			"keyMask": utils.MaskAPIKey(apiKey),
+			"reset":   results,
+		})
+	}
+}
+
 // GetSchedulerStats 获取调度器统计信息
 func GetSchedulerStats(sch *scheduler.ChannelScheduler) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -183,8 +329,10 @@ func GetSchedulerStats(sch *scheduler.ChannelScheduler) gin.HandlerFunc {
 
 		// 根据类型选择对应的指标管理器
 		var metricsManager *metrics.MetricsManager
+		namespace := "messages"
 		if isResponses {
 			metricsManager = sch.GetResponsesMetricsManager()
+			namespace = "responses"
 		} else {
 			metricsManager = sch.GetMessagesMetricsManager()
 		}
@@ -194,15 +342,82 @@ func GetSchedulerStats(sch *scheduler.ChannelScheduler) gin.HandlerFunc {
 			"activeChannelCount":  sch.GetActiveChannelCount(isResponses),
 			"traceAffinityCount":  sch.GetTraceAffinityManager().Size(),
 			"traceAffinityTTL":    sch.GetTraceAffinityManager().GetTTL().String(),
+			"pinnedAffinityCount": sch.GetPinnedAffinityCount(),
+			"cacheAffinity": gin.H{
+				"stickiness":       sch.GetCacheAffinityStickiness(),
+				"pendingSnapBacks": sch.GetCacheAffinityHomeCount(),
+			},
 			"failureThreshold":    metricsManager.GetFailureThreshold() * 100,
 			"windowSize":          metricsManager.GetWindowSize(),
 			"circuitRecoveryTime": metricsManager.GetCircuitRecoveryTime().String(),
+			"retryBudget":         sch.GetRetryBudgetStats(),
+			"failoverConcurrency": sch.GetFailoverConcurrencyStats(),
+			"canary":              sch.GetCanaryStats(namespace),
 		}
 
 		c.JSON(200, stats)
 	}
 }
 
+// GetSelectionPreview 预览渠道选择结果（dry-run，不发送请求）
+// 查询参数: model（请求模型）、conversationId（Trace 亲和用户标识）、
+// failedChannels（逗号分隔的渠道索引，模拟故障转移）、type=responses（Responses 渠道）、
+// inputTokens/outputTokens（cheapest 策略下用于成本排序的预估 token 数）
+func GetSelectionPreview(cfgManager *config.ConfigManager, sch *scheduler.ChannelScheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isResponses := strings.ToLower(c.Query("type")) == "responses"
+
+		failedChannels := make(map[int]bool)
+		for _, part := range strings.Split(c.Query("failedChannels"), ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 {
+				c.JSON(400, gin.H{"error": "无效的 failedChannels 参数: " + part})
+				return
+			}
+			failedChannels[index] = true
+		}
+
+		inputTokens, ok := parseTokenCountQuery(c, "inputTokens")
+		if !ok {
+			return
+		}
+		outputTokens, ok := parseTokenCountQuery(c, "outputTokens")
+		if !ok {
+			return
+		}
+
+		ctx := common.BuildSelectionContext(c, cfgManager, c.Query("model"))
+		if inputTokens > 0 || outputTokens > 0 {
+			ctx = scheduler.WithTokenEstimator(ctx, func() (int, int) { return inputTokens, outputTokens })
+		}
+		preview, err := sch.PreviewChannelSelection(ctx, c.Query("conversationId"), failedChannels, isResponses)
+		if err != nil {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, preview)
+	}
+}
+
+// parseTokenCountQuery 解析非负整数 token 数查询参数（缺省为 0），无效时写入 400 响应并返回 false
+func parseTokenCountQuery(c *gin.Context, name string) (int, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		c.JSON(400, gin.H{"error": "无效的 " + name + " 参数: " + raw})
+		return 0, false
+	}
+	return n, true
+}
+
 // SetChannelPromotion 设置渠道促销期
 // 促销期内的渠道会被优先选择，忽略 trace 亲和性
 func SetChannelPromotion(cfgManager ConfigManager) gin.HandlerFunc {
@@ -528,22 +743,25 @@ func truncateKeyMask(keyMask string, maxLen int) string {
 }
 
 // GetChannelDashboard 获取渠道仪表盘数据（合并 channels + metrics + stats）
-// GET /api/channels/dashboard?type=messages|responses
+// GET /api/channels/dashboard?type=messages|responses（?breakdown=url 时 metrics 附带按 BaseURL 拆分的 urlMetrics）
 // 将原本需要 3 个请求的数据合并为 1 个请求，减少网络开销
 func GetChannelDashboard(cfgManager *config.ConfigManager, sch *scheduler.ChannelScheduler) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 获取 type 参数，默认为 messages
 		isResponses := strings.ToLower(c.Query("type")) == "responses"
+		breakdownByURL := urlBreakdownRequested(c)
 
 		cfg := cfgManager.GetConfig()
 		var upstreams []config.UpstreamConfig
 		var loadBalance string
 		var metricsManager *metrics.MetricsManager
+		namespace := "messages"
 
 		if isResponses {
 			upstreams = cfg.ResponsesUpstream
 			loadBalance = cfg.ResponsesLoadBalance
 			metricsManager = sch.GetResponsesMetricsManager()
+			namespace = "responses"
 		} else {
 			upstreams = cfg.Upstream
 			loadBalance = cfg.LoadBalance
@@ -562,11 +780,11 @@ func GetChannelDashboard(cfgManager *config.ConfigManager, sch *scheduler.Channe
 				"serviceType":        up.ServiceType,
 				"baseUrl":            up.BaseURL,
 				"baseUrls":           up.BaseURLs,
-				"apiKeys":            up.APIKeys,
+				"apiKeys":            cfgManager.APIKeyRefs(up.APIKeys),
 				"description":        up.Description,
 				"website":            up.Website,
 				"insecureSkipVerify": up.InsecureSkipVerify,
-				"modelMapping":       up.ModelMapping,
+				"modelMapping":       up.ModelMappingJSON(),
 				"latency":            nil,
 				"status":             status,
 				"priority":           priority,
@@ -575,7 +793,8 @@ func GetChannelDashboard(cfgManager *config.ConfigManager, sch *scheduler.Channe
 			}
 		}
 
-		// 2. 构建 metrics 数据
+		// 2. 构建 metrics 数据（含后台密钥探测的最近结果）
+		keyProbeResults := sch.GetKeyProbeResults(namespace, upstreams)
 		metricsResult := make([]gin.H, 0, len(upstreams))
 		for i, upstream := range upstreams {
 			resp := metricsManager.ToResponseMultiURL(i, upstream.GetAllBaseURLs(), upstream.APIKeys, 0)
@@ -603,6 +822,20 @@ func GetChannelDashboard(cfgManager *config.ConfigManager, sch *scheduler.Channe
 			if resp.CircuitBrokenAt != nil {
 				item["circuitBrokenAt"] = *resp.CircuitBrokenAt
 			}
+			if probe, ok := keyProbeResults[i]; ok {
+				item["lastKeyProbe"] = probe
+			}
+			// 密钥每日配额剩余量（仅配置了 dailyRequestLimit/dailyTokenLimit 的渠道返回）
+			if quotas := sch.GetKeyQuotaStatus(namespace, &upstream); quotas != nil {
+				item["keyQuotas"] = quotas
+			}
+			// 近 1 小时提示缓存命中率（Token 口径），无输入 token 时不返回
+			if hitRate, ok := metricsManager.GetChannelCacheHitRate(upstream.GetAllBaseURLs(), upstream.APIKeys, time.Hour); ok {
+				item["cacheHitRate"] = hitRate
+			}
+			if breakdownByURL {
+				item["urlMetrics"] = metricsManager.GetURLMetrics(upstream.GetAllBaseURLs(), upstream.APIKeys)
+			}
 
 			metricsResult = append(metricsResult, item)
 		}
@@ -613,9 +846,16 @@ func GetChannelDashboard(cfgManager *config.ConfigManager, sch *scheduler.Channe
 			"activeChannelCount":  sch.GetActiveChannelCount(isResponses),
 			"traceAffinityCount":  sch.GetTraceAffinityManager().Size(),
 			"traceAffinityTTL":    sch.GetTraceAffinityManager().GetTTL().String(),
+			"pinnedAffinityCount": sch.GetPinnedAffinityCount(),
+			"cacheAffinity": gin.H{
+				"stickiness":       sch.GetCacheAffinityStickiness(),
+				"pendingSnapBacks": sch.GetCacheAffinityHomeCount(),
+			},
 			"failureThreshold":    metricsManager.GetFailureThreshold() * 100,
 			"windowSize":          metricsManager.GetWindowSize(),
 			"circuitRecoveryTime": metricsManager.GetCircuitRecoveryTime().String(),
+			"retryBudget":         sch.GetRetryBudgetStats(),
+			"failoverConcurrency": sch.GetFailoverConcurrencyStats(),
 		}
 
 		// 返回合并数据
@@ -800,9 +1040,10 @@ func GetGeminiChannelKeyMetricsHistory(metricsManager *metrics.MetricsManager, c
 	}
 }
 
-// GetGeminiChannelMetrics 获取 Gemini 渠道指标
+// GetGeminiChannelMetrics 获取 Gemini 渠道指标（?breakdown=url 时附带按 BaseURL 拆分的 urlMetrics）
 func GetGeminiChannelMetrics(metricsManager *metrics.MetricsManager, cfgManager *config.ConfigManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		breakdownByURL := urlBreakdownRequested(c)
 		cfg := cfgManager.GetConfig()
 		upstreams := cfg.GeminiUpstream
 
@@ -834,6 +1075,9 @@ func GetGeminiChannelMetrics(metricsManager *metrics.MetricsManager, cfgManager
 			if resp.CircuitBrokenAt != nil {
 				item["circuitBrokenAt"] = *resp.CircuitBrokenAt
 			}
+			if breakdownByURL {
+				item["urlMetrics"] = metricsManager.GetURLMetrics(upstream.GetAllBaseURLs(), upstream.APIKeys)
+			}
 
 			result = append(result, item)
 		}
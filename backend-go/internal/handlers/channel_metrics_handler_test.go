@@ -9,6 +9,9 @@ import (
 	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/BenedictKing/claude-proxy/internal/types"
 	"github.com/gin-gonic/gin"
 )
 
@@ -178,6 +181,14 @@ func TestChannelMetricsHandlers_CoreEndpoints(t *testing.T) {
 		if w.Code != http.StatusOK {
 			t.Fatalf("stats status=%d body=%s", w.Code, w.Body.String())
 		}
+		var statsResp map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &statsResp); err != nil {
+			t.Fatalf("unmarshal stats: %v", err)
+		}
+		budget, ok := statsResp["retryBudget"].(map[string]any)
+		if !ok || budget["enabled"] != false {
+			t.Fatalf("retryBudget=%v", statsResp["retryBudget"])
+		}
 		w2 := httptest.NewRecorder()
 		req2 := httptest.NewRequest(http.MethodGet, "/stats?type=responses", nil)
 		r.ServeHTTP(w2, req2)
@@ -454,6 +465,117 @@ func TestChannelMetricsHandlers_CoreEndpoints(t *testing.T) {
 	}
 }
 
+func TestGetSelectionPreview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "m0", ServiceType: "claude", BaseURL: "https://m0.example.com", APIKeys: []string{"mkey0", "mkey1"}, Status: "active"},
+			{Name: "m1", ServiceType: "claude", BaseURL: "https://m1.example.com", APIKeys: []string{"mkey2"}, Status: "active"},
+		},
+	}
+
+	cm, _ := newTestConfigManager(t, cfg)
+	sch, cleanupSch := newTestScheduler(t, cm)
+	t.Cleanup(cleanupSch)
+
+	mm := sch.GetMessagesMetricsManager()
+	mm.RecordSuccess("https://m0.example.com", "mkey0")
+	mm.RecordFailure("https://m0.example.com", "mkey0")
+	mm.RecordFailure("https://m0.example.com", "mkey0")
+	mm.RecordFailure("https://m0.example.com", "mkey0") // trip circuit (window=3, threshold=0.5)
+
+	r := gin.New()
+	r.GET("/preview", GetSelectionPreview(cm, sch))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/preview?conversationId=user-1", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("preview status=%d body=%s", w.Code, w.Body.String())
+	}
+	var preview scheduler.SelectionPreview
+	if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("unmarshal preview: %v", err)
+	}
+	if len(preview.Candidates) != 2 || preview.ChosenIndex != 1 {
+		t.Fatalf("preview=%+v", preview)
+	}
+	if preview.Candidates[0].Healthy || preview.Candidates[0].SkipReason != scheduler.SkipReasonUnhealthy || preview.Candidates[0].CircuitState != "half_open" {
+		t.Fatalf("m0 score=%+v", preview.Candidates[0])
+	}
+
+	// failedChannels 模拟故障转移：健康渠道失败后降级到失败率最低的渠道
+	w2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest(http.MethodGet, "/preview?failedChannels=1", nil)
+	r.ServeHTTP(w2, req2)
+	var failover scheduler.SelectionPreview
+	if err := json.Unmarshal(w2.Body.Bytes(), &failover); err != nil {
+		t.Fatalf("unmarshal preview: %v", err)
+	}
+	if failover.ChosenIndex != 0 || failover.Reason != "fallback" || failover.Candidates[1].SkipReason != scheduler.SkipReasonFailed {
+		t.Fatalf("failover preview=%+v", failover)
+	}
+
+	w3 := httptest.NewRecorder()
+	req3 := httptest.NewRequest(http.MethodGet, "/preview?failedChannels=abc", nil)
+	r.ServeHTTP(w3, req3)
+	if w3.Code != http.StatusBadRequest {
+		t.Fatalf("invalid failedChannels status=%d", w3.Code)
+	}
+}
+
+func TestGetStreamCancellationStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cm, _ := newTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "m0", ServiceType: "claude", BaseURL: "https://m0.example.com", APIKeys: []string{"mkey0", "mkey1"}, Status: "active"},
+			{Name: "m1", ServiceType: "claude", BaseURL: "https://m1.example.com", APIKeys: []string{"mkey2"}, Status: "active"},
+		},
+	})
+	sch, cleanupSch := newTestScheduler(t, cm)
+	t.Cleanup(cleanupSch)
+
+	mm := sch.GetMessagesMetricsManager()
+	mm.RecordStreamCompletion("https://m0.example.com", "mkey0", false, 0, 200)
+	mm.RecordStreamCompletion("https://m0.example.com", "mkey1", true, 30, 120)
+	mm.RecordStreamCompletion("https://m0.example.com", "mkey1", true, 50, 40) // 断开后无新增输出
+	mm.RecordStreamCompletion("https://m1.example.com", "mkey2", false, 0, 10)
+
+	r := gin.New()
+	r.GET("/cancellations", GetStreamCancellationStats(mm, cm))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cancellations", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Channels []struct {
+			ChannelName string                    `json:"channelName"`
+			Stats       metrics.StreamCancelStats `json:"stats"`
+		} `json:"channels"`
+		Total metrics.StreamCancelStats `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Channels) != 2 {
+		t.Fatalf("channels = %d, want 2", len(resp.Channels))
+	}
+	m0 := resp.Channels[0].Stats
+	if m0.StreamCount != 3 || m0.CanceledCount != 2 || m0.OutputTokensAtCancel != 80 || m0.WastedOutputTokens != 90 {
+		t.Fatalf("m0 stats = %+v", m0)
+	}
+	if resp.Channels[1].Stats.CancellationRate != 0 {
+		t.Fatalf("m1 stats = %+v", resp.Channels[1].Stats)
+	}
+	if resp.Total.StreamCount != 4 || resp.Total.CancellationRate != 50 {
+		t.Fatalf("total = %+v", resp.Total)
+	}
+}
+
 func TestChannelPromotionHandlers(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -710,3 +832,313 @@ func TestGeminiChannelKeyMetricsHistory_TodayDurationClamp(t *testing.T) {
 		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
 	}
 }
+
+func TestGetChannelDashboard_IncludesLastKeyProbe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "idle", ServiceType: "openai", BaseURL: upstream.URL, APIKeys: []string{"sk-idle-dead"}, Status: "active"},
+		},
+		LoadBalance: "failover",
+	}
+	cm, _ := newTestConfigManager(t, cfg)
+	sch, cleanupSch := newTestScheduler(t, cm)
+	t.Cleanup(cleanupSch)
+
+	sch.StartKeyProber(20*time.Millisecond, time.Second)
+	t.Cleanup(sch.StopKeyProber)
+
+	r := gin.New()
+	r.GET("/dash", GetChannelDashboard(cm, sch))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dash", nil))
+		var resp struct {
+			Metrics []struct {
+				LastKeyProbe *scheduler.KeyProbeResult `json:"lastKeyProbe"`
+			} `json:"metrics"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if len(resp.Metrics) == 1 && resp.Metrics[0].LastKeyProbe != nil {
+			probe := resp.Metrics[0].LastKeyProbe
+			if probe.Success || probe.StatusCode != http.StatusUnauthorized || probe.ChannelName != "idle" {
+				t.Fatalf("unexpected probe result: %+v", probe)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dashboard did not surface key probe result: %s", w.Body.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGetChannelDashboard_IncludesCacheHitRate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "cached", ServiceType: "claude", BaseURL: "https://cached.example.com", APIKeys: []string{"sk-cached"}, Status: "active"},
+			{Name: "idle", ServiceType: "claude", BaseURL: "https://idle.example.com", APIKeys: []string{"sk-idle"}, Status: "active"},
+		},
+	}
+	cm, _ := newTestConfigManager(t, cfg)
+	sch, cleanupSch := newTestScheduler(t, cm)
+	t.Cleanup(cleanupSch)
+	sch.SetCacheAffinity(0.5)
+
+	sch.RecordSuccessWithUsage("https://cached.example.com", "sk-cached",
+		&types.Usage{InputTokens: 250, CacheReadInputTokens: 750}, false, "claude", 0)
+
+	r := gin.New()
+	r.GET("/dash", GetChannelDashboard(cm, sch))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dash", nil))
+
+	var resp struct {
+		Metrics []struct {
+			CacheHitRate *float64 `json:"cacheHitRate"`
+		} `json:"metrics"`
+		Stats struct {
+			CacheAffinity struct {
+				Stickiness float64 `json:"stickiness"`
+			} `json:"cacheAffinity"`
+		} `json:"stats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Metrics) != 2 || resp.Metrics[0].CacheHitRate == nil || *resp.Metrics[0].CacheHitRate != 75 {
+		t.Fatalf("expected cached channel hit rate 75: %s", w.Body.String())
+	}
+	if resp.Metrics[1].CacheHitRate != nil {
+		t.Fatalf("expected no hit rate for idle channel, got %v", *resp.Metrics[1].CacheHitRate)
+	}
+	if resp.Stats.CacheAffinity.Stickiness != 0.5 {
+		t.Fatalf("expected stickiness 0.5, got %v", resp.Stats.CacheAffinity.Stickiness)
+	}
+}
+
+func TestGetCircuitRecoveryStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{
+		GeminiUpstream: []config.UpstreamConfig{
+			{Name: "g0", ServiceType: "gemini", BaseURL: "https://g0.example.com", APIKeys: []string{"gkey0"}, Status: "active"},
+			{Name: "g1", ServiceType: "gemini", BaseURL: "https://g1.example.com", APIKeys: []string{"gkey1"}, Status: "active"},
+		},
+	}
+	cm, _ := newTestConfigManager(t, cfg)
+	gm := metrics.NewMetricsManagerWithConfig(3, 0.5)
+	t.Cleanup(gm.Stop)
+
+	// g0 的 Key 熔断后立即通过强制探测恢复，g1 从未熔断
+	for i := 0; i < 3; i++ {
+		gm.RecordFailure("https://g0.example.com", "gkey0")
+	}
+	for i := 0; i < 3; i++ {
+		gm.RecordSuccess("https://g0.example.com", "gkey0")
+	}
+	gm.RecordSuccess("https://g1.example.com", "gkey1")
+
+	r := gin.New()
+	r.GET("/g/recovery", GetCircuitRecoveryStats(gm, cm, "gemini"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/g/recovery", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Channels []struct {
+			ChannelName string                            `json:"channelName"`
+			Stats       metrics.CircuitRecoveryStats      `json:"stats"`
+			Keys        []metrics.KeyCircuitRecoveryStats `json:"keys"`
+		} `json:"channels"`
+		Total metrics.CircuitRecoveryStats `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Channels) != 2 || resp.Channels[0].ChannelName != "g0" {
+		t.Fatalf("unexpected channels: %s", w.Body.String())
+	}
+	if resp.Channels[0].Stats.Recoveries != 1 || len(resp.Channels[0].Keys) != 1 || resp.Channels[0].Keys[0].KeyMask == "" {
+		t.Fatalf("unexpected g0 stats: %s", w.Body.String())
+	}
+	if resp.Channels[1].Stats.Recoveries != 0 || resp.Channels[1].Keys == nil || len(resp.Channels[1].Keys) != 0 {
+		t.Fatalf("unexpected g1 stats: %s", w.Body.String())
+	}
+	if resp.Total.Recoveries != 1 {
+		t.Fatalf("unexpected total: %s", w.Body.String())
+	}
+}
+
+func TestGetChannelMetricsWithConfig_URLBreakdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "multi", ServiceType: "claude", BaseURL: "https://a.example.com",
+				BaseURLs: []string{"https://a.example.com", "https://b.example.com"}, APIKeys: []string{"sk-1"}, Status: "active"},
+		},
+	}
+	cm, _ := newTestConfigManager(t, cfg)
+	mm := metrics.NewMetricsManager()
+	t.Cleanup(mm.Stop)
+
+	mm.RecordSuccess("https://a.example.com", "sk-1")
+	mm.RecordFailure("https://b.example.com", "sk-1")
+	mm.RecordFailure("https://b.example.com", "sk-1")
+
+	r := gin.New()
+	r.GET("/metrics", GetChannelMetricsWithConfig(mm, cm, false))
+
+	type urlMetric struct {
+		BaseURL      string  `json:"baseUrl"`
+		RequestCount int64   `json:"requestCount"`
+		SuccessRate  float64 `json:"successRate"`
+		CircuitState string  `json:"circuitState"`
+	}
+	type channelMetric struct {
+		RequestCount int64        `json:"requestCount"`
+		URLMetrics   []*urlMetric `json:"urlMetrics"`
+	}
+	get := func(query string) []channelMetric {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+		}
+		var resp []channelMetric
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if len(resp) != 1 {
+			t.Fatalf("expected 1 channel: %s", w.Body.String())
+		}
+		return resp
+	}
+
+	if resp := get(""); resp[0].URLMetrics != nil || resp[0].RequestCount != 3 {
+		t.Fatalf("expected aggregated metrics without urlMetrics by default: %+v", resp[0])
+	}
+
+	resp := get("?breakdown=url")
+	if len(resp[0].URLMetrics) != 2 {
+		t.Fatalf("expected 2 url metrics, got %d", len(resp[0].URLMetrics))
+	}
+	a, b := resp[0].URLMetrics[0], resp[0].URLMetrics[1]
+	if a.BaseURL != "https://a.example.com" || a.RequestCount != 1 || a.SuccessRate != 100 {
+		t.Fatalf("unexpected metrics for a: %+v", a)
+	}
+	if b.BaseURL != "https://b.example.com" || b.RequestCount != 2 || b.SuccessRate != 0 || b.CircuitState != "closed" {
+		t.Fatalf("unexpected metrics for b: %+v", b)
+	}
+}
+
+func TestResetChannelKeyMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cm, _ := newTestConfigManager(t, config.Config{
+		ResponsesUpstream: []config.UpstreamConfig{
+			{Name: "r0", ServiceType: "responses", BaseURL: "https://r0.example.com", APIKeys: []string{"rkey0", "rkey1"}, Status: "active"},
+		},
+	})
+	sch, cleanupSch := newTestScheduler(t, cm)
+	t.Cleanup(cleanupSch)
+
+	rm := sch.GetResponsesMetricsManager()
+	rm.RecordFailure("https://r0.example.com", "rkey0")
+	rm.RecordFailure("https://r0.example.com", "rkey1")
+
+	r := gin.New()
+	r.POST("/responses/channels/:id/keys/:apiKey/reset", ResetChannelKeyMetrics(sch, "responses"))
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"invalid id", "/responses/channels/x/keys/rkey0/reset", http.StatusBadRequest},
+		{"channel not found", "/responses/channels/3/keys/rkey0/reset", http.StatusNotFound},
+		{"key not found", "/responses/channels/0/keys/nope/reset", http.StatusNotFound},
+		{"reset", "/responses/channels/0/keys/rkey0/reset", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status=%d body=%s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Success bool                        `json:"success"`
+				Reset   []scheduler.KeyMetricsReset `json:"reset"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !resp.Success || len(resp.Reset) != 1 || !resp.Reset[0].Reset || resp.Reset[0].BaseURL != "https://r0.example.com" {
+				t.Fatalf("resp = %+v", resp)
+			}
+		})
+	}
+
+	if km := rm.GetKeyMetrics("https://r0.example.com", "rkey0"); km.FailureCount != 0 {
+		t.Fatalf("rkey0 未被重置: %+v", km)
+	}
+	if km := rm.GetKeyMetrics("https://r0.example.com", "rkey1"); km.FailureCount != 1 {
+		t.Fatalf("rkey1 不应被重置: %+v", km)
+	}
+}
+
+func TestGetChannelDashboard_IncludesKeyQuotas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "capped", ServiceType: "claude", BaseURL: "https://capped.example.com", APIKeys: []string{"sk-capped-1"}, Status: "active", DailyRequestLimit: 2},
+			{Name: "open", ServiceType: "claude", BaseURL: "https://open.example.com", APIKeys: []string{"sk-open"}, Status: "active"},
+		},
+	}
+	cm, _ := newTestConfigManager(t, cfg)
+	sch, cleanupSch := newTestScheduler(t, cm)
+	t.Cleanup(cleanupSch)
+
+	sch.RecordSuccessWithUsage("https://capped.example.com", "sk-capped-1", &types.Usage{InputTokens: 10, OutputTokens: 5}, false, "claude", 0)
+
+	r := gin.New()
+	r.GET("/dash", GetChannelDashboard(cm, sch))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dash", nil))
+
+	var resp struct {
+		Metrics []struct {
+			KeyQuotas []scheduler.KeyQuotaStatus `json:"keyQuotas"`
+		} `json:"metrics"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Metrics) != 2 || len(resp.Metrics[0].KeyQuotas) != 1 || resp.Metrics[1].KeyQuotas != nil {
+		t.Fatalf("unexpected keyQuotas: %s", w.Body.String())
+	}
+	quota := resp.Metrics[0].KeyQuotas[0]
+	if quota.Requests != 1 || quota.RemainingRequests == nil || *quota.RemainingRequests != 1 || quota.RemainingTokens != nil || quota.Exhausted {
+		t.Fatalf("unexpected quota: %+v", quota)
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultReorderWindow      = time.Hour
+	maxReorderWindow          = 24 * time.Hour
+	defaultReorderMinRequests = 5
+	// 延迟扣分：每秒平均延迟扣 2 分，最多扣 20 分（成功率为主，延迟用于区分成功率接近的渠道）
+	reorderLatencyPenaltyPerSecond = 2.0
+	reorderMaxLatencyPenalty       = 20.0
+)
+
+// 重排后渠道所在的分组（按此顺序排列）
+const (
+	reorderGroupPromotion    = "promotion"         // 促销期渠道，保持在最前
+	reorderGroupHealth       = "health"            // 按健康分排序的活跃渠道
+	reorderGroupInsufficient = "insufficient_data" // 窗口内请求数不足，保持原有相对顺序
+	reorderGroupInactive     = "inactive"          // 未参与调度的渠道（suspended/disabled/影子渠道）
+)
+
+// channelReorderItem 单个渠道的重排结果
+type channelReorderItem struct {
+	Index            int      `json:"index"`
+	Name             string   `json:"name"`
+	Status           string   `json:"status"`
+	Group            string   `json:"group"`
+	Score            *float64 `json:"score,omitempty"`
+	RequestCount     int64    `json:"requestCount"`
+	SuccessRate      float64  `json:"successRate"`
+	AvgLatencyMs     float64  `json:"avgLatencyMs"`
+	PreviousPriority int      `json:"previousPriority"`
+	NewPriority      int      `json:"newPriority"`
+}
+
+// ReorderChannelsByHealth 按近期成功率与延迟自动重排 Messages 渠道优先级
+// 查询参数: window（统计窗口，默认 1h，最长 24h）、minRequests（参与评分的最少请求数，默认 5）、dryRun=true（只返回建议顺序，不写入配置）
+// 健康分 = 成功率(0-100) - min(平均延迟秒数 × 2, 20)；促销期渠道保持在最前，请求数不足与未参与调度的渠道按原顺序排在其后
+func ReorderChannelsByHealth(cfgManager *config.ConfigManager, sch *scheduler.ChannelScheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		window := defaultReorderWindow
+		if raw := c.Query("window"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 || d > maxReorderWindow {
+				c.JSON(400, gin.H{"error": "无效的 window 参数（如 15m、1h，最长 24h）: " + raw})
+				return
+			}
+			window = d
+		}
+		minRequests := defaultReorderMinRequests
+		if raw := c.Query("minRequests"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				c.JSON(400, gin.H{"error": "无效的 minRequests 参数: " + raw})
+				return
+			}
+			minRequests = n
+		}
+		dryRun := c.Query("dryRun") == "true"
+
+		cfg := cfgManager.GetConfig()
+		if len(cfg.Upstream) == 0 {
+			c.JSON(400, gin.H{"error": "未配置任何渠道"})
+			return
+		}
+		items := rankChannelsByHealth(cfg.Upstream, sch.GetMessagesMetricsManager(), window, int64(minRequests))
+
+		order := make([]int, len(items))
+		changed := false
+		for i := range items {
+			order[i] = items[i].Index
+			items[i].NewPriority = i + 1
+			if items[i].NewPriority != items[i].PreviousPriority {
+				changed = true
+			}
+		}
+
+		if !dryRun && changed {
+			if err := cfgManager.ReorderUpstreams(order); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("[Channel-Reorder] 已按健康度重排 Messages 渠道 (窗口 %s): %v", window, order)
+		}
+
+		c.JSON(200, gin.H{
+			"dryRun":      dryRun,
+			"applied":     !dryRun && changed,
+			"changed":     changed,
+			"window":      window.String(),
+			"minRequests": minRequests,
+			"order":       order,
+			"channels":    items,
+		})
+	}
+}
+
+// rankChannelsByHealth 计算各渠道的健康分并返回重排后的顺序（组内按健康分降序，同分与不评分的组保持原优先级顺序）
+func rankChannelsByHealth(upstreams []config.UpstreamConfig, metricsManager *metrics.MetricsManager, window time.Duration, minRequests int64) []channelReorderItem {
+	items := make([]channelReorderItem, 0, len(upstreams))
+	for i := range upstreams {
+		upstream := &upstreams[i]
+		item := channelReorderItem{
+			Index:            i,
+			Name:             upstream.Name,
+			Status:           config.GetChannelStatus(upstream),
+			PreviousPriority: config.GetChannelPriority(upstream, i),
+		}
+		stats := metricsManager.GetChannelHealthStats(upstream.GetAllBaseURLs(), upstream.APIKeys, window)
+		item.RequestCount = stats.RequestCount
+		item.SuccessRate = stats.SuccessRate
+		item.AvgLatencyMs = stats.AvgLatencyMs
+
+		switch {
+		case item.Status != "active" || upstream.Shadow:
+			item.Group = reorderGroupInactive
+		case config.IsChannelInPromotion(upstream):
+			item.Group = reorderGroupPromotion
+		case stats.RequestCount < max(minRequests, 1):
+			item.Group = reorderGroupInsufficient
+		default:
+			item.Group = reorderGroupHealth
+			penalty := math.Min(stats.AvgLatencyMs/1000*reorderLatencyPenaltyPerSecond, reorderMaxLatencyPenalty)
+			score := math.Round((stats.SuccessRate-penalty)*100) / 100
+			item.Score = &score
+		}
+		items = append(items, item)
+	}
+
+	groupRank := map[string]int{
+		reorderGroupPromotion:    0,
+		reorderGroupHealth:       1,
+		reorderGroupInsufficient: 2,
+		reorderGroupInactive:     3,
+	}
+	slices.SortStableFunc(items, func(a, b channelReorderItem) int {
+		if ga, gb := groupRank[a.Group], groupRank[b.Group]; ga != gb {
+			return ga - gb
+		}
+		if a.Score != nil && b.Score != nil && *a.Score != *b.Score {
+			if *a.Score > *b.Score {
+				return -1
+			}
+			return 1
+		}
+		if a.PreviousPriority != b.PreviousPriority {
+			return a.PreviousPriority - b.PreviousPriority
+		}
+		return a.Index - b.Index
+	})
+	return items
+}
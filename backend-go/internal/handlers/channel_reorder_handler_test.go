@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReorderChannelsByHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	promotionUntil := time.Now().Add(time.Hour)
+	cm, _ := newTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "flaky", BaseURL: "https://flaky.example.com", APIKeys: []string{"k0"}, Status: "active", Priority: 1},
+			{Name: "slow", BaseURL: "https://slow.example.com", APIKeys: []string{"k1"}, Status: "active", Priority: 2},
+			{Name: "fast", BaseURL: "https://fast.example.com", APIKeys: []string{"k2"}, Status: "active", Priority: 3},
+			{Name: "new", BaseURL: "https://new.example.com", APIKeys: []string{"k3"}, Status: "active", Priority: 4},
+			{Name: "off", BaseURL: "https://off.example.com", APIKeys: []string{"k4"}, Status: "disabled", Priority: 5},
+			{Name: "promo", BaseURL: "https://promo.example.com", APIKeys: []string{"k5"}, Status: "active", Priority: 6, PromotionUntil: &promotionUntil},
+		},
+		LoadBalance: "failover",
+	})
+	sch, cleanup := newTestScheduler(t, cm)
+	defer cleanup()
+
+	mm := sch.GetMessagesMetricsManager()
+	for i := 0; i < 10; i++ {
+		if i < 5 {
+			mm.RecordFailure("https://flaky.example.com", "k0")
+		} else {
+			mm.RecordSuccess("https://flaky.example.com", "k0")
+		}
+		mm.RecordSuccess("https://slow.example.com", "k1")
+		mm.RecordSuccess("https://fast.example.com", "k2")
+	}
+	mm.RecordKeyLatency("https://slow.example.com", "k1", 4*time.Second)
+	mm.RecordKeyLatency("https://fast.example.com", "k2", 200*time.Millisecond)
+	mm.RecordSuccess("https://new.example.com", "k3")
+
+	r := gin.New()
+	r.POST("/api/messages/channels/reorder-by-health", ReorderChannelsByHealth(cm, sch))
+	call := func(query string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/messages/channels/reorder-by-health"+query, nil))
+		var body map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+	orderOf := func(body map[string]any) []int {
+		var order []int
+		for _, v := range body["order"].([]any) {
+			order = append(order, int(v.(float64)))
+		}
+		return order
+	}
+	want := []int{5, 2, 1, 0, 3, 4} // promo, fast, slow, flaky, new（数据不足）, off（停用）
+
+	code, body := call("?dryRun=true")
+	if code != http.StatusOK || body["applied"] != false || body["changed"] != true {
+		t.Fatalf("dry run: code=%d body=%v", code, body)
+	}
+	if got := orderOf(body); !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+	if cm.GetConfig().Upstream[5].Priority != 6 {
+		t.Fatalf("dry run must not change priorities")
+	}
+	groups := map[string]string{}
+	for _, item := range body["channels"].([]any) {
+		m := item.(map[string]any)
+		groups[m["name"].(string)] = m["group"].(string)
+	}
+	if groups["promo"] != "promotion" || groups["new"] != "insufficient_data" || groups["off"] != "inactive" || groups["fast"] != "health" {
+		t.Fatalf("unexpected groups: %v", groups)
+	}
+
+	code, body = call("")
+	if code != http.StatusOK || body["applied"] != true {
+		t.Fatalf("apply: code=%d body=%v", code, body)
+	}
+	upstreams := cm.GetConfig().Upstream
+	for rank, index := range want {
+		if upstreams[index].Priority != rank+1 {
+			t.Fatalf("channel %s priority = %d, want %d", upstreams[index].Name, upstreams[index].Priority, rank+1)
+		}
+	}
+
+	// 已是目标顺序时不再写入配置
+	if _, body = call(""); body["changed"] != false || body["applied"] != false {
+		t.Fatalf("second apply should be a no-op: %v", body)
+	}
+
+	if code, _ = call("?window=48h"); code != http.StatusBadRequest {
+		t.Fatalf("invalid window code = %d", code)
+	}
+}
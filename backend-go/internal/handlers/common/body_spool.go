@@ -0,0 +1,212 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// spoolScalarLimit 扫描顶层字段时单个值的缓冲上限（超出的值不会被识别，如超长的 model）
+const spoolScalarLimit = 256
+
+// SpooledBody 落盘的请求体：内存中只保留扫描出的顶层 model/stream 字段，
+// 每次发送时重新打开临时文件，因此在密钥/BaseURL 重试时可以重放
+type SpooledBody struct {
+	path   string
+	Size   int64
+	Model  string
+	Stream bool
+}
+
+// ShouldSpoolRequestBody 请求体声明的大小（Content-Length）超过阈值时返回 true（阈值 <= 0 表示禁用）
+// 分块传输（未声明 Content-Length）的请求始终按常规方式读入内存
+func ShouldSpoolRequestBody(c *gin.Context, threshold int64) bool {
+	return threshold > 0 && c.Request.ContentLength > threshold
+}
+
+// SpoolRequestBody 将请求体写入临时文件，同时流式扫描顶层 model/stream 字段
+// 超过 maxBodySize 时与 ReadRequestBody 一样返回 413 并排空剩余数据；成功后调用方负责 Close 删除临时文件
+func SpoolRequestBody(c *gin.Context, maxBodySize int64, metricsManager *metrics.MetricsManager) (*SpooledBody, error) {
+	f, err := os.CreateTemp("", "claude-proxy-body-*.json")
+	if err != nil {
+		log.Printf("[Request-Spool] 创建临时文件失败: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to spool request body"})
+		return nil, err
+	}
+	body := &SpooledBody{path: f.Name()}
+
+	scanner := &topLevelFieldScanner{}
+	size, err := io.Copy(f, io.TeeReader(io.LimitReader(c.Request.Body, maxBodySize+1), scanner))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		body.Close()
+		c.JSON(400, gin.H{"error": "Failed to read request body"})
+		return nil, err
+	}
+	if size > maxBodySize {
+		body.Close()
+		return nil, rejectOversizedBody(c, size, maxBodySize, metricsManager)
+	}
+	if metricsManager != nil {
+		metricsManager.RecordRequestBodySize(size)
+	}
+
+	body.Size = size
+	body.Model = scanner.model
+	body.Stream = scanner.stream
+	c.Request.Body = http.NoBody
+	return body, nil
+}
+
+// Open 重新打开落盘的请求体
+func (b *SpooledBody) Open() (io.ReadCloser, error) {
+	return os.Open(b.path)
+}
+
+// ReadAll 将落盘的请求体读回内存（需要改写请求体时回退到常规处理）
+func (b *SpooledBody) ReadAll() ([]byte, error) {
+	return os.ReadFile(b.path)
+}
+
+// AttachTo 将落盘的请求体设置为上游请求的 Body（GetBody 重新打开文件，供传输层重试时使用）
+func (b *SpooledBody) AttachTo(req *http.Request) error {
+	body, err := b.Open()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	req.ContentLength = b.Size
+	req.GetBody = b.Open
+	return nil
+}
+
+// Close 删除临时文件（可重复调用）
+func (b *SpooledBody) Close() {
+	if b.path == "" {
+		return
+	}
+	if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Request-Spool] 警告: 删除临时文件失败: %v", err)
+	}
+	b.path = ""
+}
+
+// topLevelFieldScanner 流式扫描 JSON 顶层的 model 与 stream 字段，内存占用与请求体大小无关
+// 只跟踪嵌套深度与字符串状态，不校验 JSON 合法性（非法请求体交由上游返回错误）
+type topLevelFieldScanner struct {
+	depth       int
+	inString    bool
+	escaped     bool
+	overflow    bool   // 当前值超过 spoolScalarLimit
+	buf         []byte // 顶层当前字符串或标量值
+	key         string // 最近一个顶层键
+	expectValue bool   // 已读到顶层 ':'，等待值
+
+	model  string
+	stream bool
+}
+
+func (s *topLevelFieldScanner) Write(p []byte) (int, error) {
+	for _, b := range p {
+		s.scan(b)
+	}
+	return len(p), nil
+}
+
+func (s *topLevelFieldScanner) scan(b byte) {
+	if s.inString {
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case b == '\\':
+			s.escaped = true
+		case b == '"':
+			s.inString = false
+			if s.depth == 1 {
+				s.finishString()
+			}
+			return
+		}
+		if s.depth == 1 {
+			s.appendByte(b)
+		}
+		return
+	}
+
+	switch b {
+	case '"':
+		s.inString = true
+		s.resetValue()
+	case '{', '[':
+		if s.depth == 1 {
+			s.expectValue = false
+		}
+		s.depth++
+	case '}', ']':
+		if s.depth == 1 {
+			s.finishScalar()
+		}
+		s.depth--
+	case ':':
+		if s.depth == 1 {
+			s.expectValue = true
+			s.resetValue()
+		}
+	case ',', ' ', '\t', '\r', '\n':
+		if s.depth == 1 {
+			s.finishScalar()
+		}
+	default:
+		if s.depth == 1 && s.expectValue {
+			s.appendByte(b)
+		}
+	}
+}
+
+func (s *topLevelFieldScanner) appendByte(b byte) {
+	if len(s.buf) >= spoolScalarLimit {
+		s.overflow = true
+		return
+	}
+	s.buf = append(s.buf, b)
+}
+
+func (s *topLevelFieldScanner) resetValue() {
+	s.buf = s.buf[:0]
+	s.overflow = false
+}
+
+// finishString 顶层字符串结束：等待值时为字段值，否则为下一个键
+func (s *topLevelFieldScanner) finishString() {
+	if !s.expectValue {
+		s.key = string(s.buf)
+		return
+	}
+	s.expectValue = false
+	if s.key != "model" || s.overflow {
+		return
+	}
+	var model string
+	if err := json.Unmarshal([]byte(`"`+string(s.buf)+`"`), &model); err == nil {
+		s.model = model
+	}
+}
+
+// finishScalar 顶层标量值（true/false/数字/null）结束
+func (s *topLevelFieldScanner) finishScalar() {
+	if !s.expectValue || len(s.buf) == 0 {
+		return
+	}
+	s.expectValue = false
+	if s.key == "stream" && !s.overflow {
+		s.stream = string(s.buf) == "true"
+	}
+	s.resetValue()
+}
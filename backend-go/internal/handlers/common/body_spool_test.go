@@ -0,0 +1,92 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTopLevelFieldScanner(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		model  string
+		stream bool
+	}{
+		{"模型在前", `{"model":"claude-3","stream":true,"messages":[]}`, "claude-3", true},
+		{"模型在大字段之后", `{"messages":[{"role":"user","content":"` + strings.Repeat("x", 4096) + `"}], "stream" : false ,"model" : "claude-opus"}`, "claude-opus", false},
+		{"忽略嵌套同名字段", `{"metadata":{"model":"nested","stream":true},"model":"top"}`, "top", false},
+		{"字符串中的括号与转义", `{"system":"a \"}{[ \\","model":"m\u002d1","stream":true}`, "m-1", true},
+		{"stream 位于末尾", "{\"model\":\"m\",\n\"stream\":true}", "m", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &topLevelFieldScanner{}
+			// 逐字节写入，覆盖跨 Write 边界的状态
+			for i := 0; i < len(tt.body); i++ {
+				_, _ = s.Write([]byte{tt.body[i]})
+			}
+			if s.model != tt.model || s.stream != tt.stream {
+				t.Fatalf("model=%q stream=%v, want %q %v", s.model, s.stream, tt.model, tt.stream)
+			}
+		})
+	}
+}
+
+func TestSpoolRequestBody_ReplayableAndCleanedUp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	payload := `{"model":"claude-3","stream":true,"messages":[{"role":"user","content":"` + strings.Repeat("a", 1024) + `"}]}`
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(payload))
+
+	if !ShouldSpoolRequestBody(c, 512) || ShouldSpoolRequestBody(c, 0) || ShouldSpoolRequestBody(c, int64(len(payload))) {
+		t.Fatalf("unexpected ShouldSpoolRequestBody result for Content-Length %d", c.Request.ContentLength)
+	}
+
+	spooled, err := SpoolRequestBody(c, 1<<20, nil)
+	if err != nil {
+		t.Fatalf("SpoolRequestBody: %v", err)
+	}
+	if spooled.Size != int64(len(payload)) || spooled.Model != "claude-3" || !spooled.Stream {
+		t.Fatalf("unexpected spooled body: %+v", spooled)
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "http://upstream/v1/messages", nil)
+		if err := spooled.AttachTo(req); err != nil {
+			t.Fatalf("AttachTo: %v", err)
+		}
+		data, _ := io.ReadAll(req.Body)
+		req.Body.Close()
+		if string(data) != payload || req.ContentLength != int64(len(payload)) {
+			t.Fatalf("attempt %d: replayed body mismatch (len=%d, contentLength=%d)", i, len(data), req.ContentLength)
+		}
+	}
+
+	path := spooled.path
+	spooled.Close()
+	spooled.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("temp file not removed: %v", err)
+	}
+}
+
+func TestSpoolRequestBody_TooLargeReturns413(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(strings.Repeat("x", 64)))
+
+	if _, err := SpoolRequestBody(c, 16, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "64 bytes") {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
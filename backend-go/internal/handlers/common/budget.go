@@ -0,0 +1,75 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/budget"
+	"github.com/gin-gonic/gin"
+)
+
+// BudgetWarningHeader 超过软上限时返回的响应头，值为超限的周期及已用/上限（美分）
+const BudgetWarningHeader = "X-Proxy-Budget-Warning"
+
+// budgetManager 全局成本预算管理器（nil 表示不检查预算）
+var budgetManager *budget.BudgetManager
+
+// SetBudgetManager 设置成本预算管理器（需在开始服务前调用）
+func SetBudgetManager(bm *budget.BudgetManager) {
+	budgetManager = bm
+}
+
+// CheckCostBudget 请求准入前检查成本预算，返回 false 表示已超过硬上限且已写入 429 响应
+// 超过软上限时仅添加 X-Proxy-Budget-Warning 响应头并记录日志
+func CheckCostBudget(c *gin.Context, apiType string) bool {
+	if budgetManager == nil {
+		return true
+	}
+	decision := budgetManager.Check(apiType)
+
+	if len(decision.Warnings) > 0 {
+		parts := make([]string, 0, len(decision.Warnings))
+		for _, p := range decision.Warnings {
+			parts = append(parts, fmt.Sprintf("%s %d/%d", p.Period, p.SpentCents, p.SoftCapCents))
+		}
+		warning := strings.Join(parts, ", ")
+		c.Header(BudgetWarningHeader, warning)
+		log.Printf("[Budget] 警告: %s 成本超过软上限 (%s 美分)", apiType, warning)
+	}
+
+	if decision.Allowed {
+		return true
+	}
+
+	p := decision.Blocked
+	seconds := max(int(math.Ceil(time.Until(p.ResetAt).Seconds())), 1)
+	log.Printf("[Budget] %s 成本超过%s硬上限 (%d/%d 美分)，拒绝请求，%s 重置", apiType, periodLabel(p.Period), p.SpentCents, p.HardCapCents, p.ResetAt.Format(time.RFC3339))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "rate_limit_error",
+			"message": fmt.Sprintf("%s cost budget exceeded for %s API (spent %d of %d cents). Budget resets at %s.", periodTitle(p.Period), apiType, p.SpentCents, p.HardCapCents, p.ResetAt.Format(time.RFC3339)),
+		},
+	})
+	return false
+}
+
+func periodLabel(period string) string {
+	if period == budget.PeriodWeekly {
+		return "周"
+	}
+	return "日"
+}
+
+func periodTitle(period string) string {
+	if period == budget.PeriodWeekly {
+		return "Weekly"
+	}
+	return "Daily"
+}
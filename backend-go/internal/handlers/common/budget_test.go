@@ -0,0 +1,72 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/budget"
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+type fixedCostSource int64
+
+func (s fixedCostSource) GetCostCentsSince(time.Time) (int64, error) { return int64(s), nil }
+
+func TestCheckCostBudget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cm := newMaxTokensTestConfigManager(t, config.Config{
+		CostBudgets: map[string]config.CostBudget{
+			"messages":  {DailySoftCents: 100, DailyHardCents: 500},
+			"responses": {DailyHardCents: 200},
+		},
+	})
+	SetBudgetManager(budget.NewBudgetManager(cm, map[string]budget.CostSource{
+		"messages":  fixedCostSource(300),
+		"responses": fixedCostSource(300),
+	}))
+	defer SetBudgetManager(nil)
+
+	// 软上限：放行并添加告警响应头
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	if !CheckCostBudget(c, "messages") {
+		t.Fatalf("CheckCostBudget(messages) = false, want true")
+	}
+	if got := w.Header().Get(BudgetWarningHeader); got != "daily 300/100" {
+		t.Fatalf("%s = %q, want %q", BudgetWarningHeader, got, "daily 300/100")
+	}
+
+	// 硬上限：429 + Retry-After
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	if CheckCostBudget(c, "responses") {
+		t.Fatalf("CheckCostBudget(responses) = true, want false")
+	}
+	if w.Code != http.StatusTooManyRequests || !c.IsAborted() {
+		t.Fatalf("status = %d aborted = %v, want 429 aborted", w.Code, c.IsAborted())
+	}
+	if seconds, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || seconds < 1 || seconds > 86400 {
+		t.Fatalf("Retry-After = %q, want seconds until midnight", w.Header().Get("Retry-After"))
+	}
+	var body struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Type != "rate_limit_error" {
+		t.Fatalf("body = %s, want rate_limit_error", w.Body.String())
+	}
+
+	// 未设置预算管理器时直接放行
+	SetBudgetManager(nil)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	if !CheckCostBudget(c, "responses") {
+		t.Fatalf("CheckCostBudget without manager = false, want true")
+	}
+}
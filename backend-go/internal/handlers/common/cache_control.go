@@ -0,0 +1,71 @@
+package common
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// StripCacheControl 渠道配置 stripCacheControl 时移除 Messages 请求体中的 cache_control 字段，
+// 避免不支持 prompt caching 的上游以 400 拒绝整个请求（故障转移无济于事）
+// 仅处理 Anthropic 请求中可携带 cache_control 的位置：system 块、tools、messages 内容块及 tool_result 的嵌套内容块，
+// 不会误删工具 input_schema 等用户数据中的同名字段；未配置或无需改写时原样返回
+func StripCacheControl(upstream *config.UpstreamConfig, model string, bodyBytes []byte) []byte {
+	if upstream == nil || !upstream.StripCacheControl {
+		return bodyBytes
+	}
+
+	paths := cacheControlPaths(bodyBytes)
+	if len(paths) == 0 {
+		return bodyBytes
+	}
+
+	stripped := bodyBytes
+	for _, path := range paths {
+		updated, err := sjson.DeleteBytes(stripped, path)
+		if err != nil {
+			log.Printf("[Messages-CacheControl] 警告: 删除 %s 失败: %v", path, err)
+			return bodyBytes
+		}
+		stripped = updated
+	}
+	log.Printf("[Messages-CacheControl] 渠道 %s 不支持 prompt caching，模型 %s: 已移除 %d 处 cache_control", upstream.Name, model, len(paths))
+	return stripped
+}
+
+// cacheControlPaths 返回请求体中所有 cache_control 字段的 sjson 路径
+func cacheControlPaths(bodyBytes []byte) []string {
+	var paths []string
+	collect := func(prefix string, blocks gjson.Result) {
+		if !blocks.IsArray() {
+			return
+		}
+		blocks.ForEach(func(idx, block gjson.Result) bool {
+			blockPath := prefix + "." + strconv.Itoa(int(idx.Int()))
+			if block.Get("cache_control").Exists() {
+				paths = append(paths, blockPath+".cache_control")
+			}
+			// tool_result 的 content 可以是内容块数组
+			if block.Get("type").String() == "tool_result" {
+				block.Get("content").ForEach(func(nestedIdx, nested gjson.Result) bool {
+					if nested.Get("cache_control").Exists() {
+						paths = append(paths, blockPath+".content."+strconv.Itoa(int(nestedIdx.Int()))+".cache_control")
+					}
+					return true
+				})
+			}
+			return true
+		})
+	}
+
+	collect("system", gjson.GetBytes(bodyBytes, "system"))
+	collect("tools", gjson.GetBytes(bodyBytes, "tools"))
+	gjson.GetBytes(bodyBytes, "messages").ForEach(func(idx, message gjson.Result) bool {
+		collect("messages."+strconv.Itoa(int(idx.Int()))+".content", message.Get("content"))
+		return true
+	})
+	return paths
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+const cacheControlRequest = `{"model":"claude-3","max_tokens":16,
+"system":[{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}],
+"tools":[{"name":"t","input_schema":{"type":"object","properties":{"cache_control":{"type":"string"}}},"cache_control":{"type":"ephemeral"}}],
+"messages":[
+ {"role":"user","content":"plain"},
+ {"role":"user","content":[{"type":"text","text":"a","cache_control":{"type":"ephemeral","ttl":"1h"}},{"type":"text","text":"b"}]},
+ {"role":"user","content":[{"type":"tool_result","tool_use_id":"x","content":[{"type":"text","text":"r","cache_control":{"type":"ephemeral"}}],"cache_control":{"type":"ephemeral"}}]}
+]}`
+
+func TestStripCacheControl(t *testing.T) {
+	body := []byte(cacheControlRequest)
+
+	// 未启用时原样返回（支持缓存的上游收到完整的 cache_control）
+	if got := StripCacheControl(&config.UpstreamConfig{Name: "caching"}, "claude-3", body); string(got) != string(body) {
+		t.Fatalf("未启用 stripCacheControl 时不应改写请求体")
+	}
+
+	got := StripCacheControl(&config.UpstreamConfig{Name: "no-cache", StripCacheControl: true}, "claude-3", body)
+	for _, path := range []string{
+		"system.0.cache_control",
+		"tools.0.cache_control",
+		"messages.1.content.0.cache_control",
+		"messages.2.content.0.cache_control",
+		"messages.2.content.0.content.0.cache_control",
+	} {
+		if gjson.GetBytes(got, path).Exists() {
+			t.Fatalf("%s 应被移除: %s", path, got)
+		}
+	}
+	// 工具 schema 中的同名属性与其他内容保持不变
+	if !gjson.GetBytes(got, "tools.0.input_schema.properties.cache_control").Exists() {
+		t.Fatalf("input_schema 中的 cache_control 属性不应被移除: %s", got)
+	}
+	if gjson.GetBytes(got, "messages.1.content.1.text").String() != "b" || gjson.GetBytes(got, "messages.0.content").String() != "plain" {
+		t.Fatalf("其他内容不应改变: %s", got)
+	}
+	if !gjson.ValidBytes(got) {
+		t.Fatalf("改写后的请求体不是有效 JSON: %s", got)
+	}
+
+	// 不含 cache_control 的请求原样返回
+	plain := []byte(`{"model":"claude-3","messages":[{"role":"user","content":"hi"}]}`)
+	if got := StripCacheControl(&config.UpstreamConfig{StripCacheControl: true}, "claude-3", plain); string(got) != string(plain) {
+		t.Fatalf("无 cache_control 时不应改写: %s", got)
+	}
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/capture"
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxCaptureBodySize 单个响应体抓取上限，超出部分不写入抓包（不影响转发）
+const maxCaptureBodySize = 8 * 1024 * 1024
+
+const captureStateKey = "capture_state"
+
+// captureRecorder 全局抓包记录器（未配置 CAPTURE_DIR 时为 nil）
+var captureRecorder *capture.Recorder
+
+// SetCaptureRecorder 设置抓包记录器（需在开始服务前调用）
+func SetCaptureRecorder(r *capture.Recorder) {
+	captureRecorder = r
+}
+
+// captureState 单个客户端请求的抓包状态：采样结果在首次尝试时确定，同一请求的所有尝试一起抓取
+type captureState struct {
+	sampled  bool
+	attempts int
+}
+
+// CaptureUpstreamExchange 抓取一次上游尝试（resp 与 err 为 SendRequest 的返回值）
+// 命中采样时返回包装了响应体的 resp：响应体（含完整 SSE 流）在被读取的同时被记录，关闭时异步写盘
+func CaptureUpstreamExchange(c *gin.Context, apiType string, upstream *config.UpstreamConfig, apiKey string, clientBody []byte, req *http.Request, resp *http.Response, err error) *http.Response {
+	if captureRecorder == nil {
+		return resp
+	}
+	state := getCaptureState(c)
+	if !state.sampled {
+		return resp
+	}
+	state.attempts++
+
+	keyMask := utils.MaskAPIKey(apiKey)
+	t := &capture.Transcript{
+		Timestamp: time.Now(),
+		API:       apiType,
+		Channel:   upstream.Name,
+		KeyMask:   keyMask,
+		Attempt:   state.attempts,
+		ClientRequest: &capture.HTTPMessage{
+			Method:  c.Request.Method,
+			URL:     c.Request.URL.RequestURI(),
+			Headers: captureHeaders(c.Request.Header),
+			Body:    string(clientBody),
+		},
+		UpstreamRequest: captureUpstreamRequest(req, apiKey, keyMask),
+	}
+
+	if err != nil {
+		t.Error = err.Error()
+		captureRecorder.Submit(t)
+		return resp
+	}
+	if resp == nil {
+		captureRecorder.Submit(t)
+		return resp
+	}
+
+	t.UpstreamResponse = &capture.HTTPMessage{
+		Status:  resp.StatusCode,
+		Headers: captureHeaders(resp.Header),
+	}
+	resp.Body = &captureBody{ReadCloser: resp.Body, transcript: t}
+	return resp
+}
+
+// getCaptureState 获取（首次调用时创建并采样）当前请求的抓包状态
+func getCaptureState(c *gin.Context) *captureState {
+	if v, ok := c.Get(captureStateKey); ok {
+		if state, ok := v.(*captureState); ok {
+			return state
+		}
+	}
+	state := &captureState{sampled: captureRecorder.Sample()}
+	c.Set(captureStateKey, state)
+	return state
+}
+
+// captureUpstreamRequest 记录发往上游的请求，URL 与请求头中的密钥均替换为掩码
+func captureUpstreamRequest(req *http.Request, apiKey, keyMask string) *capture.HTTPMessage {
+	if req == nil {
+		return nil
+	}
+	msg := &capture.HTTPMessage{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: captureHeaders(req.Header),
+	}
+	if apiKey != "" {
+		msg.URL = strings.ReplaceAll(msg.URL, apiKey, keyMask)
+	}
+	// 请求已发送，原始 Body 已被消费，通过 GetBody 重新获取
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			msg.Body = string(data)
+		}
+	}
+	return msg
+}
+
+// captureHeaders 取每个请求头的首个值并脱敏
+func captureHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for key, values := range header {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+	return utils.MaskSensitiveHeaders(headers)
+}
+
+// captureBody 包装上游响应体：边读边记录，关闭时提交抓包
+type captureBody struct {
+	io.ReadCloser
+	transcript *capture.Transcript
+	buf        bytes.Buffer
+	truncated  bool
+	once       sync.Once
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.truncated {
+		if remaining := maxCaptureBodySize - b.buf.Len(); n > remaining {
+			b.buf.Write(p[:remaining])
+			b.truncated = true
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+func (b *captureBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.transcript.UpstreamResponse.Body = b.buf.String()
+		b.transcript.UpstreamResponse.Truncated = b.truncated
+		captureRecorder.Submit(b.transcript)
+	})
+	return err
+}
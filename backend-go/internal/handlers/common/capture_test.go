@@ -0,0 +1,166 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/capture"
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// withCaptureRecorder 启用临时抓包记录器，返回抓包目录与等待写盘完成的函数
+func withCaptureRecorder(t *testing.T, sampleRate float64) (string, func()) {
+	t.Helper()
+	dir := t.TempDir()
+	r, err := capture.NewRecorder(dir, sampleRate, 1024*1024)
+	if err != nil {
+		t.Fatalf("NewRecorder 失败: %v", err)
+	}
+	SetCaptureRecorder(r)
+	t.Cleanup(func() { SetCaptureRecorder(nil) })
+	return dir, r.Close
+}
+
+func readCaptures(t *testing.T, dir string) []capture.Transcript {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var transcripts []capture.Transcript
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tr capture.Transcript
+		if err := json.Unmarshal(data, &tr); err != nil {
+			t.Fatalf("抓包不是合法 JSON: %v", err)
+		}
+		transcripts = append(transcripts, tr)
+	}
+	return transcripts
+}
+
+func newCaptureTestContext() *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	c.Request.Header.Set("x-api-key", "proxy-access-key-1234567890")
+	return c
+}
+
+func TestCaptureUpstreamExchange_RecordsRedactedTranscript(t *testing.T) {
+	dir, wait := withCaptureRecorder(t, 1)
+	c := newCaptureTestContext()
+	upstream := &config.UpstreamConfig{Name: "primary"}
+	apiKey := "sk-upstream-secret-key-abcdef"
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/v1/messages?key="+apiKey, bytes.NewReader([]byte(`{"upstream":true}`)))
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader("event: message_stop\ndata: {}\n\n")),
+	}
+
+	resp = CaptureUpstreamExchange(c, "messages", upstream, apiKey, []byte(`{"client":true}`), req, resp, nil)
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "event: message_stop\ndata: {}\n\n" {
+		t.Fatalf("抓包不应改变转发内容: %q", body)
+	}
+	resp.Body.Close()
+	wait()
+
+	transcripts := readCaptures(t, dir)
+	if len(transcripts) != 1 {
+		t.Fatalf("期望 1 个抓包，实际 %d", len(transcripts))
+	}
+	tr := transcripts[0]
+	if tr.Channel != "primary" || tr.Attempt != 1 || tr.API != "messages" {
+		t.Errorf("元信息不符合预期: %+v", tr)
+	}
+	if tr.ClientRequest.Body != `{"client":true}` || tr.UpstreamRequest.Body != `{"upstream":true}` {
+		t.Errorf("请求体不符合预期: client=%q upstream=%q", tr.ClientRequest.Body, tr.UpstreamRequest.Body)
+	}
+	if tr.UpstreamResponse.Status != 200 || tr.UpstreamResponse.Body != string(body) {
+		t.Errorf("响应不符合预期: %+v", tr.UpstreamResponse)
+	}
+
+	data, _ := json.Marshal(tr)
+	for _, secret := range []string{apiKey, "proxy-access-key-1234567890"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("抓包中不应包含明文密钥 %q: %s", secret, data)
+		}
+	}
+}
+
+func TestCaptureUpstreamExchange_RecordsSendErrorAndAttempts(t *testing.T) {
+	dir, wait := withCaptureRecorder(t, 1)
+	c := newCaptureTestContext()
+	upstream := &config.UpstreamConfig{Name: "primary"}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/v1/messages", bytes.NewReader([]byte(`{}`)))
+	if got := CaptureUpstreamExchange(c, "messages", upstream, "sk-first-key-0000000000", nil, req, nil, errors.New("dial tcp: timeout")); got != nil {
+		t.Fatalf("发送失败时应返回 nil resp")
+	}
+	resp := &http.Response{StatusCode: 500, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"error":"boom"}`))}
+	resp = CaptureUpstreamExchange(c, "messages", upstream, "sk-second-key-111111111", nil, req, resp, nil)
+	resp.Body.Close() // 未读取即关闭也应提交抓包
+	wait()
+
+	transcripts := readCaptures(t, dir)
+	if len(transcripts) != 2 {
+		t.Fatalf("期望 2 个抓包，实际 %d", len(transcripts))
+	}
+	attempts := map[int]capture.Transcript{}
+	for _, tr := range transcripts {
+		attempts[tr.Attempt] = tr
+	}
+	if attempts[1].Error != "dial tcp: timeout" || attempts[1].UpstreamResponse != nil {
+		t.Errorf("第 1 次尝试应记录发送错误: %+v", attempts[1])
+	}
+	if attempts[2].UpstreamResponse == nil || attempts[2].UpstreamResponse.Status != 500 {
+		t.Errorf("第 2 次尝试应记录响应状态: %+v", attempts[2])
+	}
+}
+
+func TestCaptureUpstreamExchange_NotSampled(t *testing.T) {
+	dir, wait := withCaptureRecorder(t, 0)
+	c := newCaptureTestContext()
+	original := &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("ok"))}
+
+	resp := CaptureUpstreamExchange(c, "responses", &config.UpstreamConfig{Name: "x"}, "k", nil, nil, original, nil)
+	if resp != original || resp.Body != original.Body {
+		t.Fatal("未命中采样时不应包装响应")
+	}
+	resp.Body.Close()
+	wait()
+	if n := len(readCaptures(t, dir)); n != 0 {
+		t.Errorf("未命中采样不应写入抓包，实际 %d", n)
+	}
+}
+
+func TestCaptureBody_TruncatesLargeResponse(t *testing.T) {
+	tr := &capture.Transcript{UpstreamResponse: &capture.HTTPMessage{}}
+	payload := bytes.Repeat([]byte("a"), maxCaptureBodySize+100)
+	b := &captureBody{ReadCloser: io.NopCloser(bytes.NewReader(payload)), transcript: tr}
+
+	n, _ := io.Copy(io.Discard, b)
+	if n != int64(len(payload)) {
+		t.Fatalf("转发内容不应被截断: %d", n)
+	}
+	b.Close()
+	if !tr.UpstreamResponse.Truncated || len(tr.UpstreamResponse.Body) != maxCaptureBodySize {
+		t.Errorf("抓包应截断到上限: truncated=%v len=%d", tr.UpstreamResponse.Truncated, len(tr.UpstreamResponse.Body))
+	}
+}
@@ -0,0 +1,193 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/logger"
+	"github.com/BenedictKing/claude-proxy/internal/middleware"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// DebugHeader 请求级诊断开关（true 启用，仅受信请求生效）
+const DebugHeader = "X-Proxy-Debug"
+
+// DiagnosticsTrailer 诊断信息通过该 HTTP Trailer 返回，不污染响应体
+const DiagnosticsTrailer = "X-Proxy-Diagnostics"
+
+// Token 来源
+const (
+	TokenSourceUpstream  = "upstream"  // 上游返回的 usage
+	TokenSourceEstimated = "estimated" // 上游缺失或虚假值，使用本地估算（含部分修补）
+)
+
+const diagnosticsKey = "request_diagnostics"
+
+const upstreamAttemptsKey = "upstream_attempts"
+
+// RequestDiagnostics 单个请求的诊断信息（上游尝试、最终渠道、耗时、token 来源）
+// 所有方法对 nil 安全，未启用诊断时调用方无需判空
+type RequestDiagnostics struct {
+	mu          sync.Mutex
+	start       time.Time
+	attempts    []DiagnosticAttempt
+	tokenSource string
+}
+
+// DiagnosticAttempt 一次上游尝试
+type DiagnosticAttempt struct {
+	ChannelIndex int    `json:"channelIndex"`
+	ChannelName  string `json:"channelName"`
+	Key          string `json:"key"` // 脱敏
+	Status       int    `json:"status,omitempty"`
+	Error        string `json:"error,omitempty"`
+	DurationMs   int64  `json:"durationMs"` // 发送请求到收到响应头的耗时
+}
+
+// DiagnosticsReport 诊断 Trailer 内容
+type DiagnosticsReport struct {
+	Attempts    int                 `json:"attempts"`
+	Channel     *DiagnosticChannel  `json:"channel,omitempty"` // 最后一次尝试的渠道（成功时即为服务渠道）
+	TotalMs     int64               `json:"totalMs"`
+	UpstreamMs  int64               `json:"upstreamMs"` // 所有尝试的上游耗时之和
+	TokenSource string              `json:"tokenSource,omitempty"`
+	AttemptLog  []DiagnosticAttempt `json:"attemptLog"`
+}
+
+// DiagnosticChannel 诊断报告中的渠道信息
+type DiagnosticChannel struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+}
+
+// StartDiagnostics 受信请求携带 X-Proxy-Debug: true 时启用诊断
+// 必须在写入响应头之前调用：需要预先声明 Trailer 并避免响应使用 Content-Length
+func StartDiagnostics(c *gin.Context) *RequestDiagnostics {
+	enabled, err := strconv.ParseBool(c.GetHeader(DebugHeader))
+	if err != nil || !enabled || !IsTrustedRequest(c) {
+		return nil
+	}
+	d := &RequestDiagnostics{start: time.Now()}
+	c.Set(diagnosticsKey, d)
+	c.Writer.Header().Add("Trailer", DiagnosticsTrailer)
+	return d
+}
+
+// GetDiagnostics 获取当前请求的诊断信息（未启用时返回 nil）
+func GetDiagnostics(c *gin.Context) *RequestDiagnostics {
+	d, _ := c.Get(diagnosticsKey)
+	diag, _ := d.(*RequestDiagnostics)
+	return diag
+}
+
+// RecordUpstreamAttempt 记录一次上游尝试（resp 与 err 为 SendRequest 的返回值）
+// 每次尝试都以请求 ID + 尝试序号输出日志，便于将客户端错误与具体的故障转移尝试关联
+func RecordUpstreamAttempt(c *gin.Context, channelIndex int, channelName, apiKey string, resp *http.Response, err error, duration time.Duration) {
+	c.Set(upstreamAttemptStartKey, time.Now().Add(-duration))
+
+	fields := []logger.Field{
+		logger.F("request_id", middleware.GetRequestID(c)),
+		logger.F("attempt", nextUpstreamAttempt(c)),
+		logger.F("channel", channelName),
+		logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+		logger.F("latency_ms", duration.Milliseconds()),
+	}
+	if err != nil {
+		logger.Warn("Upstream-Attempt", "上游请求失败", append(fields, logger.F("error", err.Error()))...)
+	} else if resp != nil {
+		logger.Info("Upstream-Attempt", "上游已响应", append(fields, logger.F("status", resp.StatusCode))...)
+	}
+
+	d := GetDiagnostics(c)
+	if d == nil {
+		return
+	}
+	attempt := DiagnosticAttempt{
+		ChannelIndex: channelIndex,
+		ChannelName:  channelName,
+		Key:          utils.MaskAPIKey(apiKey),
+		DurationMs:   duration.Milliseconds(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	} else if resp != nil {
+		attempt.Status = resp.StatusCode
+	}
+
+	d.mu.Lock()
+	d.attempts = append(d.attempts, attempt)
+	d.mu.Unlock()
+}
+
+// nextUpstreamAttempt 返回当前请求的下一个上游尝试序号（从 1 开始，跨渠道累计）
+func nextUpstreamAttempt(c *gin.Context) int64 {
+	if v, ok := c.Get(upstreamAttemptsKey); ok {
+		if counter, ok := v.(*atomic.Int64); ok {
+			return counter.Add(1)
+		}
+	}
+	counter := &atomic.Int64{}
+	c.Set(upstreamAttemptsKey, counter)
+	return counter.Add(1)
+}
+
+// UpstreamAttemptCount 当前请求已发出的上游请求数（跨渠道累计）
+func UpstreamAttemptCount(c *gin.Context) int64 {
+	if v, ok := c.Get(upstreamAttemptsKey); ok {
+		if counter, ok := v.(*atomic.Int64); ok {
+			return counter.Load()
+		}
+	}
+	return 0
+}
+
+// SetTokenSource 记录 token 来源；一旦标记为估算不再被覆盖为上游
+func (d *RequestDiagnostics) SetTokenSource(source string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tokenSource != TokenSourceEstimated {
+		d.tokenSource = source
+	}
+}
+
+// Report 生成诊断报告
+func (d *RequestDiagnostics) Report() DiagnosticsReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	report := DiagnosticsReport{
+		Attempts:    len(d.attempts),
+		TotalMs:     time.Since(d.start).Milliseconds(),
+		TokenSource: d.tokenSource,
+		AttemptLog:  append([]DiagnosticAttempt{}, d.attempts...),
+	}
+	for _, a := range d.attempts {
+		report.UpstreamMs += a.DurationMs
+	}
+	if n := len(d.attempts); n > 0 {
+		last := d.attempts[n-1]
+		report.Channel = &DiagnosticChannel{Index: last.ChannelIndex, Name: last.ChannelName}
+	}
+	return report
+}
+
+// WriteDiagnosticsTrailer 将诊断报告写入 Trailer（在处理函数返回前调用）
+func WriteDiagnosticsTrailer(c *gin.Context) {
+	d := GetDiagnostics(c)
+	if d == nil {
+		return
+	}
+	data, err := json.Marshal(d.Report())
+	if err != nil {
+		return
+	}
+	c.Writer.Header().Set(DiagnosticsTrailer, string(data))
+}
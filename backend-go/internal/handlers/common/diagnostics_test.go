@@ -0,0 +1,96 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newDiagnosticsTestContext(debugHeader string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	if debugHeader != "" {
+		c.Request.Header.Set(DebugHeader, debugHeader)
+	}
+	return c, w
+}
+
+func TestStartDiagnostics_Gating(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		billing bool
+		want    bool
+	}{
+		{"未设置头部", "", false, false},
+		{"无效值", "yes-please", false, false},
+		{"显式关闭", "false", false, false},
+		{"受信请求启用", "true", false, true},
+		{"计费用户请求忽略", "true", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newDiagnosticsTestContext(tt.header)
+			if tt.billing {
+				c.Set("billing_enabled", true)
+			}
+			got := StartDiagnostics(c) != nil
+			if got != tt.want {
+				t.Fatalf("StartDiagnostics enabled = %v, want %v", got, tt.want)
+			}
+			if got != (GetDiagnostics(c) != nil) {
+				t.Fatal("GetDiagnostics 应与 StartDiagnostics 结果一致")
+			}
+			if declared := c.Writer.Header().Get("Trailer") == DiagnosticsTrailer; declared != tt.want {
+				t.Fatalf("Trailer 声明 = %v, want %v", declared, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestDiagnostics_ReportAndTrailer(t *testing.T) {
+	c, w := newDiagnosticsTestContext("1")
+	d := StartDiagnostics(c)
+
+	RecordUpstreamAttempt(c, 0, "a", "sk-aaaaaaaaaaaa", nil, errors.New("dial tcp: timeout"), 30*time.Millisecond)
+	RecordUpstreamAttempt(c, 2, "b", "sk-bbbbbbbbbbbb", &http.Response{StatusCode: 200}, nil, 20*time.Millisecond)
+	d.SetTokenSource(TokenSourceEstimated)
+	d.SetTokenSource(TokenSourceUpstream) // 估算标记不被覆盖
+
+	report := d.Report()
+	if report.Attempts != 2 || report.UpstreamMs != 50 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.AttemptLog[0].Error == "" || report.AttemptLog[0].Status != 0 {
+		t.Fatalf("网络错误尝试应记录 error: %+v", report.AttemptLog[0])
+	}
+	if report.Channel == nil || report.Channel.Index != 2 || report.Channel.Name != "b" {
+		t.Fatalf("channel = %+v, want [2] b", report.Channel)
+	}
+	if report.TokenSource != TokenSourceEstimated {
+		t.Fatalf("tokenSource = %q, want estimated", report.TokenSource)
+	}
+
+	c.String(http.StatusOK, "ok")
+	WriteDiagnosticsTrailer(c)
+	if trailer := w.Result().Trailer.Get(DiagnosticsTrailer); trailer == "" {
+		t.Fatal("期望写入诊断 Trailer")
+	}
+}
+
+func TestRequestDiagnostics_DisabledIsNoop(t *testing.T) {
+	c, w := newDiagnosticsTestContext("")
+	RecordUpstreamAttempt(c, 0, "a", "k", nil, nil, time.Millisecond)
+	GetDiagnostics(c).SetTokenSource(TokenSourceUpstream)
+	c.String(http.StatusOK, "ok")
+	WriteDiagnosticsTrailer(c)
+	if len(w.Result().Trailer) != 0 || w.Header().Get(DiagnosticsTrailer) != "" {
+		t.Fatal("未启用诊断时不应写入 Trailer")
+	}
+}
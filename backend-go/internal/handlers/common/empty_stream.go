@@ -0,0 +1,76 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrEmptyStream 上游返回 200 流式响应，但在出现任何内容块或输出之前就结束（或出错）——静默失败
+var ErrEmptyStream = errors.New("上游流式响应为空（无内容块、无输出）")
+
+// prefetchStreamEvents 空流检测（EMPTY_STREAM_FAILOVER）：在向客户端写入响应头之前预读上游事件，
+// 直到出现 content_block 事件或 message_delta 中的输出 token。预读的事件暂存在 ctx.PrefetchedEvents，
+// 由 ProcessStreamEvents 先行转发。流在出现内容之前结束或出错时返回 ErrEmptyStream——此时客户端尚未收到任何字节，
+// 调用方可以安全地故障转移到下一个密钥/渠道
+func prefetchStreamEvents(c *gin.Context, eventChan <-chan string, errChan <-chan error, ctx *StreamContext) error {
+	clientDone := c.Request.Context().Done()
+	for {
+		select {
+		case <-clientDone:
+			// 客户端已断开：交由常规流程继续接收上游数据并统计
+			return nil
+
+		case event, ok := <-eventChan:
+			if !ok {
+				return ErrEmptyStream
+			}
+			ctx.PrefetchedEvents = append(ctx.PrefetchedEvents, event)
+			if streamEventHasContent(event) {
+				ctx.FirstTokenAt = time.Now()
+				return nil
+			}
+
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrEmptyStream, err)
+			}
+		}
+	}
+}
+
+// streamEventHasContent 判断事件是否表明上游已开始输出内容
+// message_start 中的 output_tokens 通常只是占位值，仅 message_delta 的输出 token 计为内容
+func streamEventHasContent(event string) bool {
+	eventType, _, _ := extractSSEEventInfo(event)
+	switch eventType {
+	case "content_block_start", "content_block_delta":
+		return true
+	}
+	if IsMessageDeltaEvent(event) {
+		if _, _, usage := CheckEventUsageStatus(event, false); usage.OutputTokens > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEmptyStreamFailoverError 构造空流的故障转移错误（所有渠道均返回空流时返回给客户端）
+func NewEmptyStreamFailoverError() *FailoverError {
+	body, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    "empty_stream",
+			"message": "Upstream returned an empty stream with no content",
+		},
+	})
+	return &FailoverError{Status: http.StatusBadGateway, Body: body}
+}
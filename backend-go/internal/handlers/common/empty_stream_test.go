@@ -0,0 +1,100 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func runEmptyStreamCheck(t *testing.T, enabled bool, provider *fakeStreamProvider) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(""))}
+	upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://example.com", APIKeys: []string{"k1"}}
+	envCfg := &config.EnvConfig{Env: "production", EmptyStreamFailover: enabled}
+	_, _, err := HandleStreamResponse(c, resp, provider, envCfg, time.Now(), upstream,
+		[]byte(`{"model":"claude-3","messages":[]}`), sch, "k1", nil, nil, "claude-3", "claude-3")
+	return rec, err
+}
+
+var emptyStreamEvents = []string{
+	sseEvent("message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-3","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`),
+	sseEvent("ping", `{"type":"ping"}`),
+	sseEvent("message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":0}}`),
+	sseEvent("message_stop", `{"type":"message_stop"}`),
+}
+
+func TestHandleStreamResponse_EmptyStreamFailover(t *testing.T) {
+	rec, err := runEmptyStreamCheck(t, true, &fakeStreamProvider{events: emptyStreamEvents})
+	if !errors.Is(err, ErrEmptyStream) {
+		t.Fatalf("err = %v, want ErrEmptyStream", err)
+	}
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+		t.Fatalf("空流时不应向客户端写入任何数据: headers=%v body=%q", rec.Header(), rec.Body.String())
+	}
+
+	// 在出现内容之前出错同样视为空流
+	_, err = runEmptyStreamCheck(t, true, &fakeStreamProvider{events: emptyStreamEvents[:1], err: errors.New("unexpected EOF")})
+	if !errors.Is(err, ErrEmptyStream) {
+		t.Fatalf("err = %v, want ErrEmptyStream", err)
+	}
+}
+
+func TestHandleStreamResponse_EmptyStreamFailoverDisabled(t *testing.T) {
+	rec, err := runEmptyStreamCheck(t, false, &fakeStreamProvider{events: emptyStreamEvents})
+	if err != nil {
+		t.Fatalf("未启用时空流应按原样转发, err = %v", err)
+	}
+	if !strings.Contains(rec.Body.String(), "message_stop") {
+		t.Fatalf("body = %q", rec.Body.String())
+	}
+}
+
+func TestHandleStreamResponse_EmptyStreamFailoverForwardsPrefetchedEvents(t *testing.T) {
+	rec, err := runEmptyStreamCheck(t, true, &fakeStreamProvider{events: cancelTestEvents})
+	if err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"event: message_start", "event: content_block_start", cancelTestText, "event: message_stop"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("body 缺少 %q:\n%s", want, body)
+		}
+	}
+	if strings.Index(body, "message_start") > strings.Index(body, "content_block_start") {
+		t.Fatalf("预读事件应按原顺序转发:\n%s", body)
+	}
+}
+
+func TestStreamEventHasContent(t *testing.T) {
+	tests := []struct {
+		event string
+		want  bool
+	}{
+		{emptyStreamEvents[0], false}, // message_start 的 output_tokens 是占位值
+		{emptyStreamEvents[1], false},
+		{emptyStreamEvents[2], false},
+		{cancelTestEvents[1], true},
+		{cancelTestEvents[2], true},
+		{cancelTestEvents[4], true},
+	}
+	for i, tt := range tests {
+		if got := streamEventHasContent(tt.event); got != tt.want {
+			t.Errorf("[%d] streamEventHasContent() = %v, want %v", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/tidwall/gjson"
+)
+
+// ErrErrorShapedBody 上游返回 2xx，但响应体实际是错误结构（如 {"error":{...}}）——静默失败
+var ErrErrorShapedBody = errors.New("上游返回成功状态码但响应体为错误结构")
+
+// maxStreamErrorPeekBytes 流式响应检测首个事件时最多预读的字节数
+const maxStreamErrorPeekBytes = 64 * 1024
+
+// errorBodyContentFields 任一字段存在且非空即视为正常响应（即使同时带有 error 字段）
+var errorBodyContentFields = []string{"choices", "content", "candidates", "output", "delta", "message", "completion", "data"}
+
+// IsErrorShapedBody 判断 JSON 响应体是否为错误结构：顶层 error 字段非空，且不包含任何内容字段
+// 只检查顶层字段，模型输出内容中出现的 "error" 不会被误判
+func IsErrorShapedBody(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !gjson.ValidBytes(trimmed) {
+		return false
+	}
+	root := gjson.ParseBytes(trimmed)
+	errField := root.Get("error")
+	if !errField.Exists() {
+		return false
+	}
+	switch errField.Type {
+	case gjson.Null, gjson.False:
+		return false
+	case gjson.String:
+		if strings.TrimSpace(errField.String()) == "" {
+			return false
+		}
+	case gjson.JSON:
+		if errField.IsObject() && len(errField.Map()) == 0 {
+			return false
+		}
+	}
+	for _, field := range errorBodyContentFields {
+		value := root.Get(field)
+		if !value.Exists() || value.Type == gjson.Null {
+			continue
+		}
+		if value.IsArray() && len(value.Array()) == 0 {
+			continue
+		}
+		if value.Type == gjson.String && value.String() == "" {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// errorBodyMessage 提取错误结构中的错误描述（用于日志与返回给客户端的错误）
+func errorBodyMessage(body []byte) string {
+	root := gjson.ParseBytes(bytes.TrimSpace(body))
+	for _, path := range []string{"error.message", "error.msg", "error", "message"} {
+		if v := root.Get(path); v.Exists() && v.Type == gjson.String && v.String() != "" {
+			return v.String()
+		}
+	}
+	return truncateForLog(root.Get("error").Raw, 200)
+}
+
+// DetectErrorShapedResponse 检测 2xx 响应体是否为错误结构（ERROR_BODY_FAILOVER）
+// 非流式响应读取完整响应体；流式响应只预读到首个 data 事件（或非 SSE 的 JSON 响应体）。
+// 读取的内容会重新放回 resp.Body，检测通过时后续处理不受影响；检测到错误结构时返回包装 ErrErrorShapedBody 的错误
+func DetectErrorShapedResponse(resp *http.Response, isStream bool) error {
+	var payload []byte
+	if isStream {
+		payload = peekFirstStreamPayload(resp)
+	} else {
+		rawBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(rawBody))
+		if err != nil {
+			return nil // 读取失败交由后续流程按原有方式处理
+		}
+		payload = utils.DecompressGzipIfNeeded(resp, rawBody)
+	}
+
+	if !IsErrorShapedBody(payload) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrErrorShapedBody, errorBodyMessage(payload))
+}
+
+// peekFirstStreamPayload 预读流式响应直到首个 data 事件，返回其 JSON 负载；
+// 上游以 2xx 返回非 SSE 的 JSON 响应体时返回整个响应体。已读取的字节通过 MultiReader 放回 resp.Body
+func peekFirstStreamPayload(resp *http.Response) []byte {
+	original := resp.Body
+	reader := bufio.NewReader(original)
+	var consumed bytes.Buffer
+	var payload []byte
+
+	for consumed.Len() < maxStreamErrorPeekBytes {
+		line, err := reader.ReadString('\n')
+		consumed.WriteString(line)
+		trimmed := strings.TrimSpace(line)
+		if data, ok := strings.CutPrefix(trimmed, "data:"); ok {
+			payload = []byte(strings.TrimSpace(data))
+			break
+		}
+		if strings.HasPrefix(trimmed, "{") {
+			// 非 SSE 响应体：读取剩余内容（有上限）后整体检测
+			rest, _ := io.ReadAll(io.LimitReader(reader, maxStreamErrorPeekBytes))
+			consumed.Write(rest)
+			payload = bytes.TrimSpace(consumed.Bytes())
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(consumed.Bytes()), reader), original}
+	return payload
+}
+
+// NewErrorBodyFailoverError 构造错误结构响应体的故障转移错误（所有渠道均失败时返回给客户端）
+func NewErrorBodyFailoverError(err error) *FailoverError {
+	message := strings.TrimPrefix(strings.TrimPrefix(err.Error(), ErrErrorShapedBody.Error()), ": ")
+	body, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    "upstream_error",
+			"message": "Upstream returned an error body with a success status: " + message,
+		},
+	})
+	return &FailoverError{Status: http.StatusBadGateway, Body: body}
+}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIsErrorShapedBody(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"openai error object", `{"error":{"message":"rate limited","type":"requests"}}`, true},
+		{"string error", `{"error":"upstream exploded","code":500}`, true},
+		{"anthropic error event", `{"type":"error","error":{"type":"overloaded_error","message":"busy"}}`, true},
+		{"null error with choices", `{"error":null,"choices":[{"message":{"content":"hi"}}]}`, false},
+		{"error alongside content", `{"error":{"message":"partial"},"content":[{"type":"text","text":"ok"}]}`, false},
+		{"error inside content", `{"content":[{"type":"text","text":"{\"error\":\"x\"}"}],"type":"message"}`, false},
+		{"tool result mentioning error", `{"choices":[{"message":{"content":"","tool_calls":[{"function":{"arguments":"{\"error\":true}"}}]}}]}`, false},
+		{"empty error object", `{"error":{},"id":"x"}`, false},
+		{"false error", `{"error":false,"id":"x"}`, false},
+		{"empty choices with error", `{"error":{"message":"bad"},"choices":[]}`, true},
+		{"not json", `error: nope`, false},
+		{"array", `[{"error":"x"}]`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsErrorShapedBody([]byte(tc.body)); got != tc.want {
+				t.Fatalf("IsErrorShapedBody(%s) = %v, want %v", tc.body, got, tc.want)
+			}
+		})
+	}
+}
+
+func newBodyResponse(body string) *http.Response {
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestDetectErrorShapedResponse(t *testing.T) {
+	t.Run("non-stream error", func(t *testing.T) {
+		resp := newBodyResponse(`{"error":{"message":"quota exhausted"}}`)
+		err := DetectErrorShapedResponse(resp, false)
+		if !errors.Is(err, ErrErrorShapedBody) || !strings.Contains(err.Error(), "quota exhausted") {
+			t.Fatalf("err = %v", err)
+		}
+		if fe := NewErrorBodyFailoverError(err); fe.Status != http.StatusBadGateway || !strings.Contains(string(fe.Body), "quota exhausted") {
+			t.Fatalf("failover error = %d %s", fe.Status, fe.Body)
+		}
+	})
+
+	t.Run("stream keeps body intact", func(t *testing.T) {
+		stream := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"m\"}}\n\nevent: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+		resp := newBodyResponse(stream)
+		if err := DetectErrorShapedResponse(resp, true); err != nil {
+			t.Fatalf("err = %v", err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		if string(got) != stream {
+			t.Fatalf("body after peek = %q", got)
+		}
+	})
+
+	t.Run("stream first event error", func(t *testing.T) {
+		resp := newBodyResponse(": keepalive\n\ndata: {\"error\":{\"message\":\"no quota\"}}\n\n")
+		if err := DetectErrorShapedResponse(resp, true); !errors.Is(err, ErrErrorShapedBody) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("stream request answered with plain JSON error", func(t *testing.T) {
+		body := "{\n  \"error\": {\"message\": \"invalid key\"}\n}\n"
+		resp := newBodyResponse(body)
+		if err := DetectErrorShapedResponse(resp, true); !errors.Is(err, ErrErrorShapedBody) {
+			t.Fatalf("err = %v", err)
+		}
+		if got, _ := io.ReadAll(resp.Body); string(got) != body {
+			t.Fatalf("body after peek = %q", got)
+		}
+	})
+}
@@ -3,16 +3,79 @@ package common
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
 // FailoverError 封装故障转移错误信息
 type FailoverError struct {
-	Status int
-	Body   []byte
+	Status    int
+	Body      []byte
+	RequestID string // 上游请求 ID（响应头或错误体中提取，可能为空）
+}
+
+// FuzzyModeHeader 请求级 Fuzzy 模式覆盖（true/false，仅受信请求生效）
+const FuzzyModeHeader = "X-Proxy-Fuzzy"
+
+// IsTrustedRequest 判断请求是否受信（使用代理访问密钥认证，而非计费模式的用户 API Key）
+// 受信请求可通过 X-Proxy-* 头部调整本次请求的 failover 行为
+func IsTrustedRequest(c *gin.Context) bool {
+	return !c.GetBool("billing_enabled")
+}
+
+// EffectiveFuzzyMode 获取当前请求生效的 Fuzzy 模式（用于 failover 错误分类）
+// 优先级: X-Proxy-Fuzzy Header（仅受信请求）> 全局配置 fuzzyModeEnabled
+func EffectiveFuzzyMode(c *gin.Context, cfgManager *config.ConfigManager) bool {
+	if raw := c.GetHeader(FuzzyModeHeader); raw != "" {
+		if !IsTrustedRequest(c) {
+			log.Printf("[Failover-Fuzzy] 忽略非受信请求的 %s 头部", FuzzyModeHeader)
+		} else if fuzzy, err := strconv.ParseBool(raw); err == nil {
+			return fuzzy
+		} else {
+			log.Printf("[Failover-Fuzzy] 忽略无效的 %s 值: %q", FuzzyModeHeader, raw)
+		}
+	}
+	if cfgManager == nil {
+		return false
+	}
+	return cfgManager.GetFuzzyModeEnabled()
+}
+
+const (
+	upstreamAttemptedKey  = "upstream_attempted"
+	failoverSlotDeniedKey = "failover_slot_denied"
+)
+
+// AcquireFailoverSlot 在发送上游请求前获取全局故障转移槽位
+// 请求的首次上游尝试不受限制；之后的每次尝试（跨 Key/BaseURL/渠道）都需要槽位。
+// 获取失败后，本请求后续的尝试直接拒绝，避免在每个渠道上重复排队等待。
+// ok 为 true 时，调用方须在本次尝试结束（上游返回响应或请求失败）后调用 release
+func AcquireFailoverSlot(c *gin.Context, channelScheduler *scheduler.ChannelScheduler) (release func(), ok bool) {
+	if !c.GetBool(upstreamAttemptedKey) {
+		c.Set(upstreamAttemptedKey, true)
+		return func() {}, true
+	}
+	if c.GetBool(failoverSlotDeniedKey) {
+		return nil, false
+	}
+	if !channelScheduler.AcquireFailoverSlot(c.Request.Context()) {
+		c.Set(failoverSlotDeniedKey, true)
+		return nil, false
+	}
+	return channelScheduler.ReleaseFailoverSlot, true
+}
+
+// FailoverSlotDenied 判断本请求是否已因全局故障转移并发上限被拒绝（用于提前结束渠道级故障转移）
+func FailoverSlotDenied(c *gin.Context) bool {
+	return c.GetBool(failoverSlotDeniedKey)
 }
 
 // ShouldRetryWithNextKey 判断是否应该使用下一个密钥重试
@@ -37,6 +100,23 @@ func ShouldRetryWithNextKey(statusCode int, bodyBytes []byte, fuzzyMode bool) (b
 	return shouldRetryWithNextKeyNormal(statusCode, bodyBytes)
 }
 
+// ShouldRetryWithNextKeyForChannel 在默认判定基础上应用渠道的状态码覆盖规则
+// noFailoverStatusCodes 优先于 failoverStatusCodes；强制转移时保留默认判定的配额相关标记
+func ShouldRetryWithNextKeyForChannel(upstream *config.UpstreamConfig, statusCode int, bodyBytes []byte, fuzzyMode bool) (bool, bool) {
+	shouldFailover, isQuotaRelated := ShouldRetryWithNextKey(statusCode, bodyBytes, fuzzyMode)
+	failover, overridden := upstream.FailoverOverride(statusCode)
+	if !overridden {
+		return shouldFailover, isQuotaRelated
+	}
+	if failover != shouldFailover {
+		log.Printf("[Failover-Override] 渠道 %s 状态码 %d 按渠道配置覆盖默认判定: shouldFailover=%v", upstream.Name, statusCode, failover)
+	}
+	if !failover {
+		return false, false
+	}
+	return true, isQuotaRelated
+}
+
 // shouldRetryWithNextKeyFuzzy Fuzzy 模式：所有非 2xx 错误都尝试 failover
 // 同时检查消息体中的配额相关关键词，确保 403 + "预扣费额度" 等情况能正确识别
 // 但对于内容审核等不可重试错误，即使在 Fuzzy 模式下也不应重试
@@ -94,7 +174,7 @@ func shouldRetryWithNextKeyNormal(statusCode int, bodyBytes []byte) (bool, bool)
 		}
 		// 否则，仍检查消息体是否包含 quota 相关关键词
 		// 这样 403 + "预扣费额度" 消息 → isQuotaRelated=true
-		log.Printf("[Failover-Debug] 调用 classifyByErrorMessage, body=%s", string(bodyBytes))
+		log.Printf("[Failover-Debug] 调用 classifyByErrorMessage, body=%s", utils.RedactBodyForLog(bodyBytes))
 		_, msgQuota := classifyByErrorMessage(bodyBytes)
 		log.Printf("[Failover-Debug] classifyByErrorMessage 返回: msgQuota=%v", msgQuota)
 		if msgQuota {
@@ -302,6 +382,16 @@ func classifyErrorType(errType string) (bool, bool) {
 // lastError: 最后一个错误
 // apiType: API 类型（用于错误消息）
 func HandleAllChannelsFailed(c *gin.Context, fuzzyMode bool, lastFailoverError *FailoverError, lastError error, apiType string) {
+	// 没有渠道支持请求模型属于请求问题而非上游故障，不受 Fuzzy 模式影响
+	if noModelErr, ok := scheduler.AsNoChannelForModelError(lastError); ok {
+		RespondNoChannelForModel(c, noModelErr)
+		return
+	}
+	if tooLargeErr, ok := scheduler.AsRequestTooLargeError(lastError); ok {
+		RespondRequestTooLarge(c, tooLargeErr)
+		return
+	}
+
 	// Fuzzy 模式下返回通用错误，不透传上游详情
 	if fuzzyMode {
 		c.JSON(503, gin.H{
@@ -316,6 +406,7 @@ func HandleAllChannelsFailed(c *gin.Context, fuzzyMode bool, lastFailoverError *
 
 	// 非 Fuzzy 模式：透传最后一个错误的详情
 	if lastFailoverError != nil {
+		SetUpstreamRequestIDHeader(c, lastFailoverError.RequestID)
 		status := lastFailoverError.Status
 		if status == 0 {
 			status = 503
@@ -338,6 +429,30 @@ func HandleAllChannelsFailed(c *gin.Context, fuzzyMode bool, lastFailoverError *
 	}
 }
 
+// RespondNoChannelForModel 返回模型无可用渠道错误（404，错误码 NO_CHANNEL_FOR_MODEL）
+func RespondNoChannelForModel(c *gin.Context, err *scheduler.NoChannelForModelError) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "not_found_error",
+			"code":    scheduler.ErrCodeNoChannelForModel,
+			"message": fmt.Sprintf("No channel is configured to serve model %q", err.Model),
+		},
+	})
+}
+
+// RespondRequestTooLarge 返回请求体超过渠道上限错误（413，错误码 REQUEST_TOO_LARGE）
+func RespondRequestTooLarge(c *gin.Context, err *scheduler.RequestTooLargeError) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "request_too_large",
+			"code":    scheduler.ErrCodeRequestTooLarge,
+			"message": fmt.Sprintf("Request body of %d bytes exceeds the maximum size accepted by any channel (%d bytes)", err.Size, err.MaxLimit),
+		},
+	})
+}
+
 // HandleAllKeysFailed 处理所有密钥都失败的情况（单渠道模式）
 func HandleAllKeysFailed(c *gin.Context, fuzzyMode bool, lastFailoverError *FailoverError, lastError error, apiType string) {
 	// Fuzzy 模式下返回通用错误
@@ -354,6 +469,7 @@ func HandleAllKeysFailed(c *gin.Context, fuzzyMode bool, lastFailoverError *Fail
 
 	// 非 Fuzzy 模式：透传最后一个错误的详情
 	if lastFailoverError != nil {
+		SetUpstreamRequestIDHeader(c, lastFailoverError.RequestID)
 		status := lastFailoverError.Status
 		if status == 0 {
 			status = 500
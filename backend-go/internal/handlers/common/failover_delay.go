@@ -0,0 +1,74 @@
+package common
+
+import (
+	"log"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// ChannelFailoverDelay 渠道级故障转移的退避等待（FAILOVER_DELAY_MS）
+// 只有实际向上游发出过请求的渠道失败才计为真实失败；被跳过的渠道（无可用 Key、全部熔断等）不触发等待
+type ChannelFailoverDelay struct {
+	c        *gin.Context
+	base     time.Duration
+	maxDelay time.Duration
+	logTag   string
+
+	failures       int   // 已真实失败的渠道数
+	pending        bool  // 上一个渠道真实失败，尝试下一个渠道前需要等待
+	attemptsBefore int64 // 当前渠道开始前的上游尝试数
+}
+
+// NewChannelFailoverDelay 创建渠道故障转移退避（logTag 如 "Messages"）
+func NewChannelFailoverDelay(c *gin.Context, envCfg *config.EnvConfig, logTag string) *ChannelFailoverDelay {
+	return &ChannelFailoverDelay{
+		c:        c,
+		base:     time.Duration(envCfg.FailoverDelayMs) * time.Millisecond,
+		maxDelay: time.Duration(envCfg.FailoverDelayMaxMs) * time.Millisecond,
+		logTag:   logTag,
+	}
+}
+
+// FailoverDelayFor 第 failures 个渠道真实失败后的等待时间：base × 2^(failures-1)，不超过 maxDelay（maxDelay 小于 base 时取 base）
+func FailoverDelayFor(base, maxDelay time.Duration, failures int) time.Duration {
+	if base <= 0 || failures <= 0 {
+		return 0
+	}
+	maxDelay = max(maxDelay, base)
+	delay := base
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// BeginChannel 开始尝试一个渠道前调用：先等待上一个渠道失败后的退避时间
+// 返回 false 表示等待期间客户端已断开，调用方应停止故障转移
+func (d *ChannelFailoverDelay) BeginChannel() bool {
+	if d.pending {
+		d.pending = false
+		if delay := FailoverDelayFor(d.base, d.maxDelay, d.failures); delay > 0 {
+			log.Printf("[%s-Failover] 渠道故障转移退避: 等待 %s 后尝试下一个渠道 (已失败 %d 个渠道)", d.logTag, delay, d.failures)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-d.c.Request.Context().Done():
+				timer.Stop()
+				log.Printf("[%s-Failover] 客户端在故障转移退避期间断开，停止尝试后续渠道", d.logTag)
+				return false
+			}
+		}
+	}
+	d.attemptsBefore = UpstreamAttemptCount(d.c)
+	return true
+}
+
+// ChannelFailed 渠道失败后调用：本渠道实际发出过上游请求时计为真实失败
+func (d *ChannelFailoverDelay) ChannelFailed() {
+	if UpstreamAttemptCount(d.c) > d.attemptsBefore {
+		d.failures++
+		d.pending = true
+	}
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func newFailoverDelayContext(ctx context.Context) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil).WithContext(ctx)
+	return c
+}
+
+func TestFailoverDelayFor(t *testing.T) {
+	ms := time.Millisecond
+	cases := []struct {
+		base, max time.Duration
+		failures  int
+		want      time.Duration
+	}{
+		{0, 2000 * ms, 3, 0},
+		{100 * ms, 2000 * ms, 0, 0},
+		{100 * ms, 2000 * ms, 1, 100 * ms},
+		{100 * ms, 2000 * ms, 2, 200 * ms},
+		{100 * ms, 2000 * ms, 3, 400 * ms},
+		{100 * ms, 300 * ms, 4, 300 * ms},
+		{500 * ms, 0, 3, 500 * ms}, // 上限小于基础延迟时按固定延迟
+	}
+	for _, tc := range cases {
+		if got := FailoverDelayFor(tc.base, tc.max, tc.failures); got != tc.want {
+			t.Errorf("FailoverDelayFor(%s, %s, %d) = %s, want %s", tc.base, tc.max, tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestChannelFailoverDelay_OnlyAfterUpstreamAttempt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := newFailoverDelayContext(context.Background())
+	d := NewChannelFailoverDelay(c, &config.EnvConfig{FailoverDelayMs: 50, FailoverDelayMaxMs: 1000}, "Test")
+
+	// 渠道被跳过（未发出上游请求）：不计为真实失败，下一个渠道无需等待
+	if !d.BeginChannel() {
+		t.Fatal("BeginChannel() = false")
+	}
+	d.ChannelFailed()
+	start := time.Now()
+	if !d.BeginChannel() || time.Since(start) > 30*time.Millisecond {
+		t.Fatalf("skipped channel should not delay failover, waited %s", time.Since(start))
+	}
+
+	// 渠道实际发出上游请求后失败：下一个渠道前等待基础延迟
+	nextUpstreamAttempt(c)
+	d.ChannelFailed()
+	start = time.Now()
+	if !d.BeginChannel() {
+		t.Fatal("BeginChannel() = false")
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Fatalf("waited %s, want >= 50ms", waited)
+	}
+}
+
+func TestChannelFailoverDelay_ClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newFailoverDelayContext(ctx)
+	d := NewChannelFailoverDelay(c, &config.EnvConfig{FailoverDelayMs: 5000, FailoverDelayMaxMs: 5000}, "Test")
+
+	d.BeginChannel()
+	nextUpstreamAttempt(c)
+	d.ChannelFailed()
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if d.BeginChannel() {
+		t.Fatal("BeginChannel() = true, want false after client disconnect")
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Fatalf("disconnect should abort the delay promptly, waited %s", waited)
+	}
+}
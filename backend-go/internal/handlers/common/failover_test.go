@@ -2,7 +2,14 @@ package common
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
 )
 
 // TestClassifyByStatusCode 测试基于状态码的分类
@@ -736,3 +743,111 @@ func TestShouldRetryWithNextKey_SensitiveWordsDetected(t *testing.T) {
 		})
 	}
 }
+
+// newFuzzyConfigManager 创建指定全局 Fuzzy 模式的配置管理器
+func newFuzzyConfigManager(t *testing.T, fuzzy bool) *config.ConfigManager {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{"upstream": []interface{}{}, "fuzzyModeEnabled": fuzzy})
+	if err != nil {
+		t.Fatalf("序列化配置失败: %v", err)
+	}
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	cfgManager, err := config.NewConfigManager(configFile)
+	if err != nil {
+		t.Fatalf("创建配置管理器失败: %v", err)
+	}
+	t.Cleanup(func() { cfgManager.Close() })
+	return cfgManager
+}
+
+// TestEffectiveFuzzyMode_HeaderOverride 测试 X-Proxy-Fuzzy 头部覆盖本次请求的 failover 分类
+func TestEffectiveFuzzyMode_HeaderOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := []byte(`{"error":{"message":"bad request"}}`)
+	managers := map[bool]*config.ConfigManager{
+		true:  newFuzzyConfigManager(t, true),
+		false: newFuzzyConfigManager(t, false),
+	}
+
+	tests := []struct {
+		name         string
+		globalFuzzy  bool
+		header       string
+		billingUser  bool
+		wantFuzzy    bool
+		wantFailover bool
+	}{
+		{"无头部使用全局配置（关闭）", false, "", false, false, false},
+		{"无头部使用全局配置（开启）", true, "", false, true, true},
+		{"受信请求启用 fuzzy", false, "true", false, true, true},
+		{"受信请求关闭 fuzzy", true, "false", false, false, false},
+		{"无效值回退全局配置", true, "maybe", false, true, true},
+		{"计费用户请求忽略头部", false, "true", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+			if tt.header != "" {
+				c.Request.Header.Set(FuzzyModeHeader, tt.header)
+			}
+			if tt.billingUser {
+				c.Set("billing_enabled", true)
+			}
+
+			fuzzy := EffectiveFuzzyMode(c, managers[tt.globalFuzzy])
+			if fuzzy != tt.wantFuzzy {
+				t.Fatalf("EffectiveFuzzyMode() = %v, want %v", fuzzy, tt.wantFuzzy)
+			}
+			// 400 在精确模式下不 failover，在 fuzzy 模式下 failover
+			if gotFailover, _ := ShouldRetryWithNextKey(400, body, fuzzy); gotFailover != tt.wantFailover {
+				t.Errorf("ShouldRetryWithNextKey(400) failover = %v, want %v", gotFailover, tt.wantFailover)
+			}
+		})
+	}
+}
+
+func TestShouldRetryWithNextKeyForChannel_Overrides(t *testing.T) {
+	upstream := &config.UpstreamConfig{
+		Name:                  "override",
+		FailoverStatusCodes:   []int{400, 503},
+		NoFailoverStatusCodes: []int{503, 429},
+	}
+	overloaded := []byte(`{"error":{"type":"overloaded_error","message":"model not found"}}`)
+	badRequest := []byte(`{"error":{"type":"invalid_request_error","message":"bad"}}`)
+	quota := []byte(`{"error":{"type":"rate_limit_error","message":"quota exceeded"}}`)
+
+	tests := []struct {
+		name         string
+		upstream     *config.UpstreamConfig
+		status       int
+		body         []byte
+		wantFailover bool
+		wantQuota    bool
+	}{
+		{name: "no overrides uses default", upstream: &config.UpstreamConfig{}, status: 503, body: overloaded, wantFailover: true},
+		{name: "nil upstream uses default", upstream: nil, status: 400, body: badRequest, wantFailover: false},
+		{name: "forced failover", upstream: upstream, status: 400, body: badRequest, wantFailover: true},
+		{name: "no-failover wins over failover", upstream: upstream, status: 503, body: overloaded, wantFailover: false},
+		{name: "no-failover clears quota flag", upstream: upstream, status: 429, body: quota, wantFailover: false, wantQuota: false},
+		{name: "unlisted code uses default", upstream: upstream, status: 500, body: overloaded, wantFailover: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failover, quotaRelated := ShouldRetryWithNextKeyForChannel(tt.upstream, tt.status, tt.body, false)
+			if failover != tt.wantFailover || quotaRelated != tt.wantQuota {
+				t.Fatalf("got (%v, %v), want (%v, %v)", failover, quotaRelated, tt.wantFailover, tt.wantQuota)
+			}
+		})
+	}
+
+	// 强制转移时保留默认判定的配额标记
+	forced := &config.UpstreamConfig{FailoverStatusCodes: []int{429}}
+	if failover, quotaRelated := ShouldRetryWithNextKeyForChannel(forced, 429, quota, false); !failover || !quotaRelated {
+		t.Fatalf("forced 429 = (%v, %v), want (true, true)", failover, quotaRelated)
+	}
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStreamIdleTimeout 流式响应相邻数据块之间的空闲时间超过渠道 responseTimeout
+var ErrStreamIdleTimeout = errors.New("upstream stream idle timeout")
+
+// idleTimeoutBody 为流式响应体加上空闲超时：每次读到数据后重新计时，
+// 超时后取消请求上下文使阻塞中的 Read 立即返回，并以 ErrStreamIdleTimeout 结束读取
+type idleTimeoutBody struct {
+	body     io.ReadCloser
+	timeout  time.Duration
+	timer    *time.Timer
+	cancel   context.CancelFunc
+	timedOut atomic.Bool
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{body: body, timeout: timeout, cancel: cancel}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.timedOut.Store(true)
+		cancel()
+	})
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if b.timedOut.Load() {
+		return n, fmt.Errorf("%w: %s 内未收到数据", ErrStreamIdleTimeout, b.timeout)
+	}
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	b.cancel()
+	return b.body.Close()
+}
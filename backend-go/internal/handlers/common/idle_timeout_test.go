@@ -0,0 +1,85 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// newChunkedServer 按间隔依次发送数据块的流式上游
+func newChunkedServer(t *testing.T, gaps ...time.Duration) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for _, gap := range gaps {
+			select {
+			case <-time.After(gap):
+			case <-r.Context().Done():
+				return
+			}
+			_, _ = w.Write([]byte("data: {}\n\n"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func sendStream(t *testing.T, server *httptest.Server, responseTimeout string) ([]byte, error) {
+	t.Helper()
+	upstream := &config.UpstreamConfig{BaseURL: server.URL, ResponseTimeout: responseTimeout}
+	req := httptest.NewRequest(http.MethodPost, server.URL, nil)
+	req.RequestURI = ""
+	resp, err := SendRequestForModel(req, upstream, &config.EnvConfig{}, true, "")
+	if err != nil {
+		t.Fatalf("SendRequestForModel: %v", err)
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// TestSendRequestForModel_StreamIdleTimeout 测试流式响应空闲超过渠道 responseTimeout 时中断读取
+func TestSendRequestForModel_StreamIdleTimeout(t *testing.T) {
+	server := newChunkedServer(t, 10*time.Millisecond, 500*time.Millisecond)
+
+	start := time.Now()
+	body, err := sendStream(t, server, "100ms")
+	if !errors.Is(err, ErrStreamIdleTimeout) {
+		t.Fatalf("err = %v, want ErrStreamIdleTimeout", err)
+	}
+	if string(body) != "data: {}\n\n" {
+		t.Fatalf("超时前的数据块应正常读取，实际 %q", body)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Fatalf("应在空闲超时后立即中断，实际耗时 %v", elapsed)
+	}
+}
+
+// TestSendRequestForModel_StreamIdleTimeoutPerChunk 测试空闲超时按数据块计时，整体耗时可超过该值
+func TestSendRequestForModel_StreamIdleTimeoutPerChunk(t *testing.T) {
+	server := newChunkedServer(t, 60*time.Millisecond, 60*time.Millisecond, 60*time.Millisecond, 60*time.Millisecond)
+
+	body, err := sendStream(t, server, "150ms")
+	if err != nil {
+		t.Fatalf("持续有数据的流不应超时: %v", err)
+	}
+	if len(body) != 4*len("data: {}\n\n") {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+// TestSendRequestForModel_StreamWithoutResponseTimeout 测试未配置 responseTimeout 时不限制空闲时间
+func TestSendRequestForModel_StreamWithoutResponseTimeout(t *testing.T) {
+	server := newChunkedServer(t, 200*time.Millisecond)
+
+	if _, err := sendStream(t, server, ""); err != nil {
+		t.Fatalf("未配置 responseTimeout 时不应超时: %v", err)
+	}
+}
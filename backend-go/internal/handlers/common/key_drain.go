@@ -0,0 +1,57 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DrainAPIKeyFunc 标记密钥排空的配置方法（如 ConfigManager.DrainAPIKey）
+type DrainAPIKeyFunc func(index int, apiKey string, grace time.Duration) (time.Time, error)
+
+// HandleDrainAPIKey 处理密钥排空请求（路径参数 id、apiKey）
+// 排空中的密钥不再分配给新请求，进行中的请求正常完成，宽限期结束后自动删除；
+// 可选查询参数 grace 指定宽限期（秒），未指定时使用默认宽限期
+func HandleDrainAPIKey(c *gin.Context, drain DrainAPIKeyFunc) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid upstream ID"})
+		return
+	}
+
+	apiKey := c.Param("apiKey")
+	if apiKey == "" {
+		c.JSON(400, gin.H{"error": "API key is required"})
+		return
+	}
+
+	var grace time.Duration
+	if raw := c.Query("grace"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 {
+			c.JSON(400, gin.H{"error": "Invalid grace period"})
+			return
+		}
+		grace = time.Duration(seconds) * time.Second
+	}
+
+	removeAt, err := drain(id, apiKey, grace)
+	if err != nil {
+		if strings.Contains(err.Error(), "无效的上游索引") {
+			c.JSON(404, gin.H{"error": "Upstream not found"})
+		} else if strings.Contains(err.Error(), "API密钥不存在") {
+			c.JSON(404, gin.H{"error": "API key not found"})
+		} else {
+			c.JSON(500, gin.H{"error": "Failed to save config"})
+		}
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":  "API密钥排空中，宽限期结束后自动删除",
+		"status":   "draining",
+		"removeAt": removeAt,
+	})
+}
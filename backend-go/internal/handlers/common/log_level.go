@@ -0,0 +1,45 @@
+package common
+
+import (
+	"log"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// LogLevelHeader 请求级日志级别覆盖（debug/info/warn/error，仅受信请求生效）
+const LogLevelHeader = "X-Proxy-Log-Level"
+
+// RequestEnvConfig 获取当前请求生效的环境配置
+// 受信请求携带 X-Proxy-Log-Level 时返回覆盖了日志字段的副本，只影响本次请求；
+// debug 级别额外开启请求/响应体与 SSE 事件详情（等同开发环境 + SSE_DEBUG_LEVEL=full）。
+// 必须在认证之后调用，否则无法区分计费用户
+func RequestEnvConfig(c *gin.Context, envCfg *config.EnvConfig) *config.EnvConfig {
+	raw := c.GetHeader(LogLevelHeader)
+	if raw == "" || envCfg == nil {
+		return envCfg
+	}
+	if !IsTrustedRequest(c) {
+		log.Printf("[Request-LogLevel] 忽略非受信请求的 %s 头部", LogLevelHeader)
+		return envCfg
+	}
+
+	level := strings.ToLower(strings.TrimSpace(raw))
+	switch level {
+	case "debug", "info", "warn", "error":
+	default:
+		log.Printf("[Request-LogLevel] 忽略无效的 %s 值: %q", LogLevelHeader, raw)
+		return envCfg
+	}
+
+	scoped := *envCfg
+	scoped.LogLevel = level
+	if level == "debug" {
+		scoped.Env = "development"
+		scoped.EnableRequestLogs = true
+		scoped.EnableResponseLogs = true
+		scoped.SSEDebugLevel = "full"
+	}
+	return &scoped
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestEnvConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	base := &config.EnvConfig{Env: "production", LogLevel: "warn", SSEDebugLevel: "off"}
+
+	newCtx := func(header string, billing bool) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+		if header != "" {
+			c.Request.Header.Set(LogLevelHeader, header)
+		}
+		if billing {
+			c.Set("billing_enabled", true)
+		}
+		return c
+	}
+
+	if got := RequestEnvConfig(newCtx("", false), base); got != base {
+		t.Fatalf("no header should return the global config")
+	}
+	if got := RequestEnvConfig(newCtx("debug", true), base); got != base {
+		t.Fatalf("untrusted request should be ignored")
+	}
+	if got := RequestEnvConfig(newCtx("verbose", false), base); got != base {
+		t.Fatalf("invalid level should be ignored")
+	}
+
+	got := RequestEnvConfig(newCtx(" DEBUG ", false), base)
+	if got == base {
+		t.Fatalf("expected a request-scoped copy")
+	}
+	if got.LogLevel != "debug" || !got.IsDevelopment() || !got.EnableRequestLogs || !got.EnableResponseLogs || got.SSEDebugLevel != "full" {
+		t.Fatalf("debug override = %+v", got)
+	}
+	if base.LogLevel != "warn" || base.Env != "production" || base.SSEDebugLevel != "off" {
+		t.Fatalf("global config mutated: %+v", base)
+	}
+
+	got = RequestEnvConfig(newCtx("error", false), base)
+	if got.LogLevel != "error" || got.IsDevelopment() || got.EnableResponseLogs {
+		t.Fatalf("error override = %+v", got)
+	}
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"log"
+	"math/rand/v2"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// logSampleDecisionsKey 本次请求各渠道的日志采样结果（渠道名 -> 是否记录）
+	logSampleDecisionsKey = "logSampleDecisions"
+	// pendingOriginalRequestKey 等待输出的原始请求体（首个被采样的渠道尝试时输出）
+	pendingOriginalRequestKey = "pendingOriginalRequest"
+)
+
+// logSampleRand 采样随机源（测试中替换）
+var logSampleRand = rand.Float64
+
+// ChannelEnvConfig 获取渠道尝试期间生效的环境配置
+// 渠道配置了 logSampleRate 时，每个请求在该渠道上按比例随机决定是否记录请求/响应体（同一请求内结果固定）；
+// 未命中采样时返回关闭 EnableRequestLogs/EnableResponseLogs 的副本，命中时保持全局（或请求级）设置，即两者取与。
+// 命中采样时输出延迟的原始请求体（见 LogOriginalRequest）
+func ChannelEnvConfig(c *gin.Context, envCfg *config.EnvConfig, upstream *config.UpstreamConfig) *config.EnvConfig {
+	if envCfg == nil || (!envCfg.EnableRequestLogs && !envCfg.EnableResponseLogs) {
+		return envCfg
+	}
+	if !channelLogSampled(c, upstream) {
+		scoped := *envCfg
+		scoped.EnableRequestLogs = false
+		scoped.EnableResponseLogs = false
+		return &scoped
+	}
+	if body, ok := c.Get(pendingOriginalRequestKey); ok {
+		c.Set(pendingOriginalRequestKey, nil)
+		if bodyBytes, _ := body.([]byte); bodyBytes != nil && envCfg.EnableRequestLogs {
+			logOriginalRequestDetails(c, bodyBytes, envCfg)
+		}
+	}
+	return envCfg
+}
+
+// channelLogSampled 判断本次请求是否记录该渠道的请求/响应体
+func channelLogSampled(c *gin.Context, upstream *config.UpstreamConfig) bool {
+	rate := upstream.GetLogSampleRate()
+	if rate >= 1 {
+		return true
+	}
+
+	decisions, _ := c.Get(logSampleDecisionsKey)
+	sampled, _ := decisions.(map[string]bool)
+	if sampled == nil {
+		sampled = make(map[string]bool)
+		c.Set(logSampleDecisionsKey, sampled)
+	}
+	if hit, ok := sampled[upstream.Name]; ok {
+		return hit
+	}
+	hit := rate > 0 && logSampleRand() < rate
+	sampled[upstream.Name] = hit
+	if !hit {
+		log.Printf("[Request-LogSample] 渠道 %s 未命中日志采样 (rate=%g)，本次请求不记录请求/响应体", upstream.Name, rate)
+	}
+	return hit
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestChannelEnvConfig_Sampling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	base := &config.EnvConfig{Env: "development", EnableRequestLogs: true, EnableResponseLogs: true}
+	rate := func(v float64) *float64 { return &v }
+
+	origRand := logSampleRand
+	defer func() { logSampleRand = origRand }()
+	draws := 0
+	logSampleRand = func() float64 { draws++; return 0.5 }
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+
+	if got := ChannelEnvConfig(c, base, &config.UpstreamConfig{Name: "full"}); got != base {
+		t.Fatalf("channel without logSampleRate should use the global config")
+	}
+
+	missed := &config.UpstreamConfig{Name: "missed", LogSampleRate: rate(0.1)}
+	got := ChannelEnvConfig(c, base, missed)
+	if got == base || got.EnableRequestLogs || got.EnableResponseLogs {
+		t.Fatalf("sample miss should disable body logs, got %+v", got)
+	}
+	if !base.EnableRequestLogs || !base.EnableResponseLogs {
+		t.Fatalf("global config must not be modified")
+	}
+
+	hit := &config.UpstreamConfig{Name: "hit", LogSampleRate: rate(0.9)}
+	if got := ChannelEnvConfig(c, base, hit); got != base {
+		t.Fatalf("sample hit should keep the global config")
+	}
+
+	// 同一请求内同一渠道的结果固定
+	logSampleRand = func() float64 { draws++; return 0 }
+	if got := ChannelEnvConfig(c, base, missed); got.EnableResponseLogs {
+		t.Fatalf("decision should be stable within a request")
+	}
+	if draws != 2 {
+		t.Fatalf("draws = %d, want 2", draws)
+	}
+
+	// rate=0 永不记录；全局关闭时采样命中也不记录
+	if got := ChannelEnvConfig(c, base, &config.UpstreamConfig{Name: "off", LogSampleRate: rate(0)}); got.EnableRequestLogs {
+		t.Fatalf("rate 0 should never log")
+	}
+	disabled := &config.EnvConfig{}
+	if got := ChannelEnvConfig(c, disabled, hit); got.EnableRequestLogs || got.EnableResponseLogs {
+		t.Fatalf("global flag off should win")
+	}
+}
+
+func TestChannelEnvConfig_DefersOriginalRequestBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	envCfg := &config.EnvConfig{Env: "development", EnableRequestLogs: true}
+	rate := 0.5
+
+	origRand := logSampleRand
+	defer func() { logSampleRand = origRand }()
+	logSampleRand = func() float64 { return 0.9 }
+
+	var logs bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(origOutput)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	LogOriginalRequest(c, []byte(`{"marker":"sampled-body"}`), envCfg, "Messages")
+	if strings.Contains(logs.String(), "sampled-body") {
+		t.Fatalf("original body should be deferred until a channel is sampled")
+	}
+
+	ChannelEnvConfig(c, envCfg, &config.UpstreamConfig{Name: "suspect", LogSampleRate: &rate})
+	if strings.Contains(logs.String(), "sampled-body") {
+		t.Fatalf("sample miss should not log the original body")
+	}
+
+	ChannelEnvConfig(c, envCfg, &config.UpstreamConfig{Name: "normal"})
+	ChannelEnvConfig(c, envCfg, &config.UpstreamConfig{Name: "another"})
+	if got := strings.Count(logs.String(), "sampled-body"); got != 1 {
+		t.Fatalf("original body should be logged once on the first sampled channel, got %d\n%s", got, logs.String())
+	}
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultMaintenanceRetryAfter 维护模式默认的 Retry-After（秒）
+	DefaultMaintenanceRetryAfter = 60
+	// MaxMaintenanceRetryAfter Retry-After 上限（秒）
+	MaxMaintenanceRetryAfter = 86400
+
+	defaultMaintenanceMessage = "Service is temporarily under maintenance, please retry later."
+)
+
+// MaintenanceStatus 维护模式状态
+type MaintenanceStatus struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message,omitempty"`
+	RetryAfter int        `json:"retryAfter,omitempty"` // 秒
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+// 维护模式仅保存在内存中，重启后自动解除
+var (
+	maintenanceMu     sync.RWMutex
+	maintenanceStatus MaintenanceStatus
+)
+
+// EnableMaintenance 开启维护模式（已开启时更新提示信息与 Retry-After，保留开始时间）
+// message 为空使用默认提示，retryAfter <= 0 使用默认值
+func EnableMaintenance(message string, retryAfter int) MaintenanceStatus {
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	if retryAfter <= 0 {
+		retryAfter = DefaultMaintenanceRetryAfter
+	} else if retryAfter > MaxMaintenanceRetryAfter {
+		retryAfter = MaxMaintenanceRetryAfter
+	}
+
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	since := time.Now()
+	if maintenanceStatus.Enabled && maintenanceStatus.Since != nil {
+		since = *maintenanceStatus.Since
+	}
+	maintenanceStatus = MaintenanceStatus{Enabled: true, Message: message, RetryAfter: retryAfter, Since: &since}
+	log.Printf("[Maintenance] 维护模式已开启 (Retry-After: %ds): %s", retryAfter, message)
+	return maintenanceStatus
+}
+
+// DisableMaintenance 解除维护模式（未开启时无操作）
+func DisableMaintenance() {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	if maintenanceStatus.Enabled {
+		log.Printf("[Maintenance] 维护模式已解除（持续 %v）", time.Since(*maintenanceStatus.Since).Round(time.Second))
+	}
+	maintenanceStatus = MaintenanceStatus{}
+}
+
+// GetMaintenance 获取当前维护模式状态
+func GetMaintenance() MaintenanceStatus {
+	maintenanceMu.RLock()
+	defer maintenanceMu.RUnlock()
+	return maintenanceStatus
+}
+
+// CheckMaintenance 维护模式下拒绝代理请求，返回 false 表示已写入 503 响应
+func CheckMaintenance(c *gin.Context) bool {
+	status := GetMaintenance()
+	if !status.Enabled {
+		return true
+	}
+	c.Header("Retry-After", strconv.Itoa(status.RetryAfter))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "overloaded_error",
+			"message": status.Message,
+		},
+	})
+	return false
+}
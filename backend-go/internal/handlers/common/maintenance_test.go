@@ -0,0 +1,78 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckMaintenance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer DisableMaintenance()
+
+	// 未开启：放行
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	if !CheckMaintenance(c) {
+		t.Fatalf("CheckMaintenance() = false, want true")
+	}
+
+	// 开启：503 + Retry-After + Anthropic 风格错误体
+	EnableMaintenance("Upstream incident, back soon", 120)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	if CheckMaintenance(c) {
+		t.Fatalf("CheckMaintenance() = true, want false")
+	}
+	if w.Code != http.StatusServiceUnavailable || !c.IsAborted() {
+		t.Fatalf("status = %d aborted = %v, want 503 aborted", w.Code, c.IsAborted())
+	}
+	if got := w.Header().Get("Retry-After"); got != "120" {
+		t.Fatalf("Retry-After = %q, want 120", got)
+	}
+	var body struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if body.Type != "error" || body.Error.Type != "overloaded_error" || body.Error.Message != "Upstream incident, back soon" {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+
+	// 解除：再次放行
+	DisableMaintenance()
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	if !CheckMaintenance(c) {
+		t.Fatalf("CheckMaintenance() after disable = false, want true")
+	}
+}
+
+func TestEnableMaintenance_DefaultsAndSince(t *testing.T) {
+	defer DisableMaintenance()
+
+	status := EnableMaintenance("", 0)
+	if !status.Enabled || status.Message != defaultMaintenanceMessage || status.RetryAfter != DefaultMaintenanceRetryAfter || status.Since == nil {
+		t.Fatalf("unexpected default status: %+v", status)
+	}
+	since := *status.Since
+
+	// 维护期间更新提示信息：保留开始时间
+	updated := EnableMaintenance("extended", MaxMaintenanceRetryAfter+1)
+	if updated.Message != "extended" || updated.RetryAfter != MaxMaintenanceRetryAfter || !updated.Since.Equal(since) {
+		t.Fatalf("unexpected updated status: %+v", updated)
+	}
+
+	DisableMaintenance()
+	if got := GetMaintenance(); got.Enabled || got.Since != nil {
+		t.Fatalf("status after disable = %+v", got)
+	}
+}
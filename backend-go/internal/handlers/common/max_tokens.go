@@ -0,0 +1,53 @@
+package common
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// MaxTokensClampedHeader 请求的输出 token 上限被下调时返回的响应头（值为下调后的上限）
+const MaxTokensClampedHeader = "X-Proxy-Max-Tokens-Clamped"
+
+// ClampMaxOutputTokens 按渠道/模型的输出 token 上限下调请求体中的 fields 字段（如 max_tokens）
+// 仅下调客户端显式请求且超过上限的字段，不会补充缺失字段（count_tokens 等请求不受影响）
+// 返回用于转发的请求体；下调时设置 X-Proxy-Max-Tokens-Clamped 响应头，否则清除该头（故障转移到其他渠道时）
+func ClampMaxOutputTokens(
+	c *gin.Context,
+	cfgManager *config.ConfigManager,
+	upstream *config.UpstreamConfig,
+	model string,
+	bodyBytes []byte,
+	fields ...string,
+) []byte {
+	c.Writer.Header().Del(MaxTokensClampedHeader)
+
+	limit := cfgManager.GetMaxOutputTokensLimit(upstream, model)
+	if limit <= 0 {
+		return bodyBytes
+	}
+
+	clamped, changed := bodyBytes, false
+	for _, field := range fields {
+		value := gjson.GetBytes(clamped, field)
+		if value.Type != gjson.Number || value.Int() <= int64(limit) {
+			continue
+		}
+		updated, err := sjson.SetBytes(clamped, field, limit)
+		if err != nil {
+			log.Printf("[MaxTokens-Clamp] 警告: 改写 %s 失败: %v", field, err)
+			return bodyBytes
+		}
+		log.Printf("[MaxTokens-Clamp] 渠道 %s 模型 %s: %s %d 超过上限，已下调为 %d", upstream.Name, model, field, value.Int(), limit)
+		clamped, changed = updated, true
+	}
+
+	if changed {
+		c.Header(MaxTokensClampedHeader, strconv.Itoa(limit))
+	}
+	return clamped
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func newMaxTokensTestConfigManager(t *testing.T, cfg config.Config) *config.ConfigManager {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cm, err := config.NewConfigManager(configFile)
+	if err != nil {
+		t.Fatalf("NewConfigManager: %v", err)
+	}
+	t.Cleanup(func() { cm.Close() })
+	return cm
+}
+
+func TestClampMaxOutputTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cm := newMaxTokensTestConfigManager(t, config.Config{
+		MaxOutputTokensClamp: 8000,
+		ModelMaxOutputTokens: map[string]int{"haiku*": 4096},
+	})
+	defaultCh := &config.UpstreamConfig{Name: "default"}
+	customCh := &config.UpstreamConfig{Name: "custom", MaxOutputTokensClamp: 2000}
+	mappedCh := &config.UpstreamConfig{Name: "mapped", ModelMapping: map[string]string{"claude-x": "haiku-3"}}
+
+	tests := []struct {
+		name       string
+		upstream   *config.UpstreamConfig
+		model      string
+		body       string
+		fields     []string
+		wantValues map[string]int64
+		wantHeader string
+	}{
+		{"全局上限", defaultCh, "claude-x", `{"model":"claude-x","max_tokens":32000}`, []string{"max_tokens"}, map[string]int64{"max_tokens": 8000}, "8000"},
+		{"未超限不改写", defaultCh, "claude-x", `{"model":"claude-x","max_tokens":1024}`, []string{"max_tokens"}, map[string]int64{"max_tokens": 1024}, ""},
+		{"渠道上限优先", customCh, "claude-x", `{"model":"claude-x","max_tokens":32000}`, []string{"max_tokens"}, map[string]int64{"max_tokens": 2000}, "2000"},
+		{"重定向模型上限更小", mappedCh, "claude-x", `{"model":"claude-x","max_tokens":32000}`, []string{"max_tokens"}, map[string]int64{"max_tokens": 4096}, "4096"},
+		{"Responses 字段", defaultCh, "gpt-x", `{"model":"gpt-x","max_output_tokens":9000}`, []string{"max_output_tokens", "max_tokens"}, map[string]int64{"max_output_tokens": 8000}, "8000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+			got := ClampMaxOutputTokens(c, cm, tt.upstream, tt.model, []byte(tt.body), tt.fields...)
+			for field, want := range tt.wantValues {
+				if v := gjson.GetBytes(got, field).Int(); v != want {
+					t.Fatalf("%s = %d, want %d (body=%s)", field, v, want, got)
+				}
+			}
+			if gjson.GetBytes(got, "model").String() != tt.model {
+				t.Fatalf("其他字段应保持不变: %s", got)
+			}
+			if h := w.Header().Get(MaxTokensClampedHeader); h != tt.wantHeader {
+				t.Fatalf("%s = %q, want %q", MaxTokensClampedHeader, h, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestClampMaxOutputTokens_NoFieldOrNoLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", nil)
+
+	cm := newMaxTokensTestConfigManager(t, config.Config{MaxOutputTokensClamp: 100})
+	upstream := &config.UpstreamConfig{Name: "a"}
+
+	// 缺少 max_tokens（如 count_tokens 请求）时不补充字段
+	body := []byte(`{"model":"m","messages":[]}`)
+	if got := ClampMaxOutputTokens(c, cm, upstream, "m", body, "max_tokens"); string(got) != string(body) {
+		t.Fatalf("请求体不应改变: %s", got)
+	}
+
+	// 故障转移到不限制的渠道时清除之前设置的响应头
+	c.Header(MaxTokensClampedHeader, "100")
+	unlimited := newMaxTokensTestConfigManager(t, config.Config{})
+	body = []byte(`{"model":"m","max_tokens":5000}`)
+	if got := ClampMaxOutputTokens(c, unlimited, upstream, "m", body, "max_tokens"); string(got) != string(body) {
+		t.Fatalf("未配置上限时请求体不应改变: %s", got)
+	}
+	if h := w.Header().Get(MaxTokensClampedHeader); h != "" {
+		t.Fatalf("未下调时应清除响应头，实际 %q", h)
+	}
+}
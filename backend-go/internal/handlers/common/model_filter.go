@@ -0,0 +1,27 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckModelAllowed 按全局 allowedModels / blockedModels 检查请求模型，
+// 返回 false 表示模型被拒绝且已写入 403 响应（此时尚未联系任何上游）
+func CheckModelAllowed(c *gin.Context, cfgManager *config.ConfigManager, apiType, model string) bool {
+	if cfgManager == nil || cfgManager.IsModelAllowed(model) {
+		return true
+	}
+	log.Printf("[ModelFilter] %s 请求模型 %s 未被代理策略允许，拒绝请求", apiType, model)
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "permission_error",
+			"message": fmt.Sprintf("Model %s is not allowed by proxy policy", model),
+		},
+	})
+	return false
+}
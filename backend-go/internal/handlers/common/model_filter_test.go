@@ -0,0 +1,56 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckModelAllowed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cm := newMaxTokensTestConfigManager(t, config.Config{
+		BlockedModels: []string{"claude-opus-*"},
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	if !CheckModelAllowed(c, cm, "Messages", "claude-sonnet-4") {
+		t.Fatalf("CheckModelAllowed(claude-sonnet-4) = false, want true")
+	}
+	if c.IsAborted() {
+		t.Fatalf("allowed model should not abort")
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	if CheckModelAllowed(c, cm, "Messages", "claude-opus-4") {
+		t.Fatalf("CheckModelAllowed(claude-opus-4) = true, want false")
+	}
+	if w.Code != http.StatusForbidden || !c.IsAborted() {
+		t.Fatalf("status = %d aborted = %v, want 403 aborted", w.Code, c.IsAborted())
+	}
+	var body struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if body.Type != "error" || body.Error.Type != "permission_error" || body.Error.Message != "Model claude-opus-4 is not allowed by proxy policy" {
+		t.Fatalf("body = %s", w.Body.String())
+	}
+
+	// 未配置 cfgManager 时不做限制
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	if !CheckModelAllowed(c, nil, "Messages", "claude-opus-4") {
+		t.Fatalf("CheckModelAllowed(nil manager) = false, want true")
+	}
+}
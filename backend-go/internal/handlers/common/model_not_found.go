@@ -0,0 +1,56 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// modelNotFoundPhrases 上游“模型不存在/不可用”错误消息中的常见片段（需同时包含 "model"）
+var modelNotFoundPhrases = []string{
+	"not found",
+	"not_found",
+	"does not exist",
+	"not exist",
+	"not supported",
+	"unsupported",
+	"not available",
+	"unknown model",
+	"invalid model",
+	"no such model",
+}
+
+// IsModelNotFoundError 判断上游错误是否表示请求的模型在该渠道不存在或不可用
+// 仅识别 400/404：命中时处理器切换到模型映射候选链中的下一个模型，而不是故障转移整个渠道
+func IsModelNotFoundError(statusCode int, body []byte) bool {
+	if statusCode != http.StatusBadRequest && statusCode != http.StatusNotFound {
+		return false
+	}
+
+	if code := gjson.GetBytes(body, "error.code").String(); strings.EqualFold(code, "model_not_found") {
+		return true
+	}
+
+	message := gjson.GetBytes(body, "error.message").String()
+	if message == "" {
+		message = gjson.GetBytes(body, "message").String()
+	}
+	if message == "" {
+		message = gjson.GetBytes(body, "error").String()
+	}
+	message = strings.ToLower(message)
+	if !strings.Contains(message, "model") {
+		return false
+	}
+	// Anthropic 格式：{"type":"not_found_error","message":"model: xxx"}
+	if gjson.GetBytes(body, "error.type").String() == "not_found_error" {
+		return true
+	}
+	for _, phrase := range modelNotFoundPhrases {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+	return false
+}
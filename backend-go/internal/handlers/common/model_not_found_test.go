@@ -0,0 +1,30 @@
+package common
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIsModelNotFoundError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   bool
+	}{
+		{"anthropic not_found", http.StatusNotFound, `{"type":"error","error":{"type":"not_found_error","message":"model: claude-x"}}`, true},
+		{"openai code", http.StatusNotFound, `{"error":{"code":"model_not_found","message":"The model does not exist"}}`, true},
+		{"invalid model 400", http.StatusBadRequest, `{"error":{"type":"invalid_request_error","message":"Invalid model name: foo"}}`, true},
+		{"top-level message", http.StatusBadRequest, `{"message":"Model foo is not supported"}`, true},
+		{"string error", http.StatusBadRequest, `{"error":"unknown model 'foo'"}`, true},
+		{"other 400", http.StatusBadRequest, `{"error":{"message":"max_tokens: must be positive"}}`, false},
+		{"model word without phrase", http.StatusBadRequest, `{"error":{"message":"model overloaded"}}`, false},
+		{"5xx ignored", http.StatusServiceUnavailable, `{"error":{"message":"model not found"}}`, false},
+		{"non-json", http.StatusBadRequest, `bad request`, false},
+	}
+	for _, tt := range tests {
+		if got := IsModelNotFoundError(tt.status, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
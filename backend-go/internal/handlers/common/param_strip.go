@@ -0,0 +1,42 @@
+package common
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// StripRejectedParameters 上游以 400 拒绝请求参数时（如向不支持思考的模型发送 thinking），故障转移无济于事
+// 按 parameterStripRules 匹配错误响应，删除请求体中对应的参数；返回改写后的请求体与被删除的参数路径
+// 未匹配规则、请求体不含对应参数或改写失败时返回原请求体与 nil
+func StripRejectedParameters(cfgManager *config.ConfigManager, statusCode int, respBody, requestBody []byte) ([]byte, []string) {
+	if statusCode != http.StatusBadRequest || cfgManager == nil {
+		return requestBody, nil
+	}
+	params := cfgManager.MatchParameterStripRules(respBody)
+	if len(params) == 0 {
+		return requestBody, nil
+	}
+
+	stripped := requestBody
+	var removed []string
+	for _, param := range params {
+		if !gjson.GetBytes(stripped, param).Exists() {
+			continue
+		}
+		updated, err := sjson.DeleteBytes(stripped, param)
+		if err != nil {
+			log.Printf("[ParamStrip] 警告: 删除参数 %s 失败: %v", param, err)
+			return requestBody, nil
+		}
+		stripped = updated
+		removed = append(removed, param)
+	}
+	if len(removed) == 0 {
+		return requestBody, nil
+	}
+	return stripped, removed
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+func TestStripRejectedParameters(t *testing.T) {
+	cm := newMaxTokensTestConfigManager(t, config.Config{
+		ParameterStripRules: map[string]string{
+			"thinking":     "thinking",
+			"metadata.foo": "metadata.foo",
+		},
+	})
+	body := []byte(`{"model":"m","thinking":{"type":"enabled"},"metadata":{"foo":1,"user_id":"u"}}`)
+	errBody := []byte(`{"error":{"message":"thinking / metadata.foo not supported"}}`)
+
+	stripped, params := StripRejectedParameters(cm, http.StatusBadRequest, errBody, body)
+	if !reflect.DeepEqual(params, []string{"metadata.foo", "thinking"}) {
+		t.Fatalf("params = %v", params)
+	}
+	if gjson.GetBytes(stripped, "thinking").Exists() || gjson.GetBytes(stripped, "metadata.foo").Exists() {
+		t.Fatalf("parameters not stripped: %s", stripped)
+	}
+	if gjson.GetBytes(stripped, "metadata.user_id").String() != "u" {
+		t.Fatalf("unrelated field removed: %s", stripped)
+	}
+
+	// 非 400、请求体不含参数时不改写
+	if out, params := StripRejectedParameters(cm, http.StatusInternalServerError, errBody, body); params != nil || string(out) != string(body) {
+		t.Fatalf("non-400 should not strip, got %v", params)
+	}
+	if out, params := StripRejectedParameters(cm, http.StatusBadRequest, errBody, []byte(`{"model":"m"}`)); params != nil || string(out) != `{"model":"m"}` {
+		t.Fatalf("missing parameter should not strip, got %v", params)
+	}
+}
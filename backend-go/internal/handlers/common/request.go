@@ -3,24 +3,28 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
 	"github.com/BenedictKing/claude-proxy/internal/httpclient"
 	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
 	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
 // ReadRequestBody 读取并验证请求体大小
 // 返回: (bodyBytes, error)
-// 如果请求体过大，会自动返回 413 错误并排空剩余数据
-func ReadRequestBody(c *gin.Context, maxBodySize int64) ([]byte, error) {
+// 如果请求体过大，会自动返回 413 错误（Anthropic 错误格式，含实际大小）并排空剩余数据
+// metricsManager 非 nil 时记录请求体大小直方图与超限拒绝次数
+func ReadRequestBody(c *gin.Context, maxBodySize int64, metricsManager *metrics.MetricsManager) ([]byte, error) {
 	limitedReader := io.LimitReader(c.Request.Body, maxBodySize+1)
 	bodyBytes, err := io.ReadAll(limitedReader)
 	if err != nil {
@@ -29,10 +33,10 @@ func ReadRequestBody(c *gin.Context, maxBodySize int64) ([]byte, error) {
 	}
 
 	if int64(len(bodyBytes)) > maxBodySize {
-		// 排空剩余请求体，避免 keep-alive 连接污染
-		io.Copy(io.Discard, c.Request.Body)
-		c.JSON(413, gin.H{"error": fmt.Sprintf("Request body too large, maximum size is %d MB", maxBodySize/1024/1024)})
-		return nil, fmt.Errorf("request body too large")
+		return nil, rejectOversizedBody(c, int64(len(bodyBytes)), maxBodySize, metricsManager)
+	}
+	if metricsManager != nil {
+		metricsManager.RecordRequestBodySize(int64(len(bodyBytes)))
 	}
 
 	// 恢复请求体供后续使用
@@ -40,6 +44,26 @@ func ReadRequestBody(c *gin.Context, maxBodySize int64) ([]byte, error) {
 	return bodyBytes, nil
 }
 
+// rejectOversizedBody 排空剩余请求体并返回 413（read 为已读取的字节数）
+func rejectOversizedBody(c *gin.Context, read, maxBodySize int64, metricsManager *metrics.MetricsManager) error {
+	// 排空剩余请求体，避免 keep-alive 连接污染（同时得到实际大小）
+	drained, _ := io.Copy(io.Discard, c.Request.Body)
+	size := read + drained
+	log.Printf("[Request-BodySize] 警告: 请求体过大被拒绝: %d 字节 (上限 %d 字节), client=%s, path=%s",
+		size, maxBodySize, c.ClientIP(), c.Request.URL.Path)
+	if metricsManager != nil {
+		metricsManager.RecordOversizedRequest(c.ClientIP(), c.Request.URL.Path, size, maxBodySize)
+	}
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "request_too_large",
+			"message": fmt.Sprintf("Request body of %d bytes exceeds the maximum size of %d bytes (%d MB)", size, maxBodySize, maxBodySize/1024/1024),
+		},
+	})
+	return fmt.Errorf("request body too large: %d bytes exceeds limit of %d bytes", size, maxBodySize)
+}
+
 // RestoreRequestBody 恢复请求体供后续使用
 func RestoreRequestBody(c *gin.Context, bodyBytes []byte) {
 	c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -48,19 +72,23 @@ func RestoreRequestBody(c *gin.Context, bodyBytes []byte) {
 // SendRequest 发送 HTTP 请求到上游
 // isStream: 是否为流式请求（流式请求使用无超时客户端）
 func SendRequest(req *http.Request, upstream *config.UpstreamConfig, envCfg *config.EnvConfig, isStream bool) (*http.Response, error) {
-	clientManager := httpclient.GetManager()
+	return SendRequestForModel(req, upstream, envCfg, isStream, "")
+}
 
-	var client *http.Client
-	if isStream {
-		client = clientManager.GetStreamClient(upstream.InsecureSkipVerify)
-	} else {
-		timeout := time.Duration(envCfg.RequestTimeout) * time.Millisecond
-		client = clientManager.GetStandardClient(timeout, upstream.InsecureSkipVerify)
-	}
+// SendRequestForModel 发送 HTTP 请求到上游，按渠道与模型配置覆盖超时：
+//   - 渠道 connectTimeout 作为建立连接超时；
+//   - 模型 modelTimeouts（优先）或渠道 responseTimeout 替代 REQUEST_TIMEOUT / RESPONSE_HEADER_TIMEOUT：
+//     非流式请求为整体超时，流式请求为等待响应头的超时；
+//   - 流式请求配置了渠道 responseTimeout 时，相邻数据块之间的空闲时间超过该值即中断响应（ErrStreamIdleTimeout）。
+func SendRequestForModel(req *http.Request, upstream *config.UpstreamConfig, envCfg *config.EnvConfig, isStream bool, model string) (*http.Response, error) {
+	client := upstreamClient(upstream, envCfg, isStream, model)
 
 	if upstream.InsecureSkipVerify && envCfg.EnableRequestLogs {
 		log.Printf("[Request-TLS] 警告: 正在跳过对 %s 的TLS证书验证", req.URL.String())
 	}
+	if upstream.ProxyURL != "" && envCfg.EnableRequestLogs {
+		log.Printf("[Request-Proxy] 通过代理 %s 发送请求", config.MaskProxyURL(upstream.ProxyURL))
+	}
 
 	if envCfg.EnableRequestLogs {
 		log.Printf("[Request-URL] 实际请求URL: %s", req.URL.String())
@@ -70,7 +98,48 @@ func SendRequest(req *http.Request, upstream *config.UpstreamConfig, envCfg *con
 		}
 	}
 
-	return client.Do(req)
+	idleTimeout := upstream.GetResponseTimeout()
+	if !isStream || idleTimeout <= 0 {
+		return client.Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = newIdleTimeoutBody(resp.Body, idleTimeout, cancel)
+	return resp, nil
+}
+
+// upstreamClient 按请求类型与渠道/模型超时选择上游 HTTP 客户端
+func upstreamClient(upstream *config.UpstreamConfig, envCfg *config.EnvConfig, isStream bool, model string) *http.Client {
+	clientManager := httpclient.GetManager()
+	connectTimeout := upstream.GetConnectTimeout()
+	responseTimeout, hasModelTimeout := upstream.GetModelTimeout(model)
+	if !hasModelTimeout {
+		responseTimeout = upstream.GetResponseTimeout()
+	}
+
+	if isStream {
+		if responseTimeout > 0 || connectTimeout > 0 {
+			if responseTimeout <= 0 {
+				responseTimeout = time.Duration(envCfg.ResponseHeaderTimeout) * time.Second
+			}
+			return clientManager.GetStreamClientWithTimeouts(responseTimeout, connectTimeout, upstream.InsecureSkipVerify, upstream.ProxyURL)
+		}
+		return clientManager.GetStreamClient(upstream.InsecureSkipVerify, upstream.ProxyURL)
+	}
+	if responseTimeout > 0 {
+		// 非流式响应通常在生成完成后才返回响应头，响应头超时需与整体超时一致，否则慢请求仍会被提前中断
+		return clientManager.GetStandardClientWithTimeouts(responseTimeout, responseTimeout, connectTimeout, upstream.InsecureSkipVerify, upstream.ProxyURL)
+	}
+	requestTimeout := time.Duration(envCfg.RequestTimeout) * time.Millisecond
+	if connectTimeout > 0 {
+		return clientManager.GetStandardClientWithTimeouts(requestTimeout, time.Duration(envCfg.ResponseHeaderTimeout)*time.Second, connectTimeout, upstream.InsecureSkipVerify, upstream.ProxyURL)
+	}
+	return clientManager.GetStandardClient(requestTimeout, upstream.InsecureSkipVerify, upstream.ProxyURL)
 }
 
 // logRequestDetails 记录请求详情（仅开发模式）
@@ -107,6 +176,8 @@ func logRequestDetails(req *http.Request, envCfg *config.EnvConfig) {
 }
 
 // LogOriginalRequest 记录原始请求信息
+// 原始请求体与请求头延迟到首个命中日志采样的渠道尝试时输出（见 ChannelEnvConfig），
+// 使渠道 logSampleRate 同样作用于原始请求体
 func LogOriginalRequest(c *gin.Context, bodyBytes []byte, envCfg *config.EnvConfig, apiType string) {
 	if !envCfg.EnableRequestLogs {
 		return
@@ -114,6 +185,13 @@ func LogOriginalRequest(c *gin.Context, bodyBytes []byte, envCfg *config.EnvConf
 
 	log.Printf("[Request-Receive] 收到%s请求: %s %s", apiType, c.Request.Method, c.Request.URL.Path)
 
+	if envCfg.IsDevelopment() {
+		c.Set(pendingOriginalRequestKey, bodyBytes)
+	}
+}
+
+// logOriginalRequestDetails 输出原始请求体与脱敏后的请求头（仅开发环境）
+func logOriginalRequestDetails(c *gin.Context, bodyBytes []byte, envCfg *config.EnvConfig) {
 	if envCfg.IsDevelopment() {
 		var formattedBody string
 		if envCfg.RawLogOutput {
@@ -155,6 +233,43 @@ func AreAllKeysSuspended(metricsManager *metrics.MetricsManager, baseURL string,
 	return true
 }
 
+// ExcludeLowQualityHeader 请求级低质量渠道排除开关（true/false，覆盖全局默认值）
+const ExcludeLowQualityHeader = "X-Proxy-Exclude-Low-Quality"
+
+// ShouldExcludeLowQuality 判断当前请求是否排除低质量渠道
+// 优先级: X-Proxy-Exclude-Low-Quality Header > 全局配置 excludeLowQualityChannels
+func ShouldExcludeLowQuality(c *gin.Context, cfgManager *config.ConfigManager) bool {
+	if raw := c.GetHeader(ExcludeLowQualityHeader); raw != "" {
+		if exclude, err := strconv.ParseBool(raw); err == nil {
+			return exclude
+		}
+		log.Printf("[Request-LowQuality] 忽略无效的 %s 值: %q", ExcludeLowQualityHeader, raw)
+	}
+	if cfgManager == nil {
+		return false
+	}
+	return cfgManager.GetExcludeLowQualityChannels()
+}
+
+// BuildSelectionContext 基于请求上下文构建渠道调度上下文（携带请求级调度选项）
+// model 为请求的模型名，用于过滤不支持该模型的渠道（为空时不过滤）
+// 客户端 IP 由 gin 解析（仅信任 TRUSTED_PROXIES 中代理的 X-Forwarded-For），用于无会话标识时的 IP 亲和
+func BuildSelectionContext(c *gin.Context, cfgManager *config.ConfigManager, model string) context.Context {
+	ctx := scheduler.WithExcludeLowQuality(c.Request.Context(), ShouldExcludeLowQuality(c, cfgManager))
+	ctx = scheduler.WithClientIP(ctx, c.ClientIP())
+	return scheduler.WithRequestModel(ctx, model)
+}
+
+// CheckChannelRequestBodySize 单渠道模式下校验请求体是否超过当前渠道的 maxRequestBodySize
+// 读取请求体时使用的是所有渠道中的最大上限，单渠道模式不经过调度器过滤，需在此单独校验
+func CheckChannelRequestBodySize(upstream *config.UpstreamConfig, bodyBytes []byte, defaultLimit int64) *scheduler.RequestTooLargeError {
+	size := int64(len(bodyBytes))
+	if upstream.AcceptsRequestBodySize(size, defaultLimit) {
+		return nil
+	}
+	return &scheduler.RequestTooLargeError{Size: size, MaxLimit: upstream.EffectiveMaxRequestBodySize(defaultLimit)}
+}
+
 // ExtractUserID 从请求体中提取 user_id（用于 Messages API）
 func ExtractUserID(bodyBytes []byte) string {
 	var req struct {
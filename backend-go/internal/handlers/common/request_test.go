@@ -5,11 +5,14 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
 	"github.com/BenedictKing/claude-proxy/internal/metrics"
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
 )
 
 func TestReadRequestBody_SuccessRestoresBody(t *testing.T) {
@@ -18,7 +21,7 @@ func TestReadRequestBody_SuccessRestoresBody(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodPost, "/x", bytes.NewBufferString("hello"))
 
-	body, err := ReadRequestBody(c, 10)
+	body, err := ReadRequestBody(c, 10, nil)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -38,7 +41,7 @@ func TestReadRequestBody_TooLargeReturns413(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodPost, "/x", bytes.NewBufferString("123456"))
 
-	_, err := ReadRequestBody(c, 5)
+	_, err := ReadRequestBody(c, 5, nil)
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -47,6 +50,45 @@ func TestReadRequestBody_TooLargeReturns413(t *testing.T) {
 	}
 }
 
+func TestReadRequestBody_RecordsSizeMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := metrics.NewMetricsManager()
+	defer m.Stop()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString("hello"))
+	if _, err := ReadRequestBody(c, 10, m); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(strings.Repeat("x", 25)))
+	c.Request.RemoteAddr = "10.0.0.7:1234"
+	if _, err := ReadRequestBody(c, 10, m); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// 错误响应为 Anthropic 格式并包含实际大小
+	if got := gjson.Get(w.Body.String(), "error.type").String(); got != "request_too_large" {
+		t.Fatalf("error.type = %q, body = %s", got, w.Body.String())
+	}
+	if msg := gjson.Get(w.Body.String(), "error.message").String(); !strings.Contains(msg, "25 bytes") || !strings.Contains(msg, "10 bytes") {
+		t.Fatalf("error.message = %q", msg)
+	}
+
+	stats := m.GetRequestBodySizeStats()
+	if stats.TotalRequests != 2 || stats.TotalBytes != 30 || stats.MaxBytes != 25 || stats.Buckets[0].Count != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.OversizedRejections != 1 || stats.OversizedByClient["10.0.0.7"] != 1 {
+		t.Fatalf("oversized = %d, byClient = %v", stats.OversizedRejections, stats.OversizedByClient)
+	}
+	if len(stats.RecentOversized) != 1 || stats.RecentOversized[0].SizeBytes != 25 || stats.RecentOversized[0].Path != "/v1/messages" {
+		t.Fatalf("recentOversized = %+v", stats.RecentOversized)
+	}
+}
+
 func TestRestoreRequestBody(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
@@ -196,3 +238,183 @@ func TestExtractUserIDAndConversationID(t *testing.T) {
 		t.Fatalf("metadata.user_id = %q", got)
 	}
 }
+
+func TestShouldExcludeLowQuality_Header(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"true", true},
+		{"1", true},
+		{"false", false},
+		{"invalid", false},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/x", nil)
+		if tt.header != "" {
+			c.Request.Header.Set(ExcludeLowQualityHeader, tt.header)
+		}
+
+		if got := ShouldExcludeLowQuality(c, nil); got != tt.want {
+			t.Errorf("header=%q: got %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+// TestSendRequestForModel_AppliesModelTimeout 测试上游超时按请求模型取自渠道 modelTimeouts 配置
+func TestSendRequestForModel_AppliesModelTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	upstream := &config.UpstreamConfig{
+		BaseURL: server.URL,
+		ModelTimeouts: map[string]string{
+			"fast-model": "50ms",
+			"slow-*":     "5s",
+		},
+	}
+	// 全局 REQUEST_TIMEOUT 100ms，短于上游响应耗时
+	envCfg := &config.EnvConfig{RequestTimeout: 100}
+
+	tests := []struct {
+		name     string
+		model    string
+		isStream bool
+		wantErr  bool
+	}{
+		{name: "model timeout shorter than upstream", model: "fast-model", wantErr: true},
+		{name: "model timeout longer than global", model: "slow-reasoner", wantErr: false},
+		{name: "unconfigured model uses global timeout", model: "other-model", wantErr: true},
+		{name: "stream header timeout from model", model: "fast-model", isStream: true, wantErr: true},
+		{name: "stream without model timeout", model: "slow-reasoner", isStream: true, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, server.URL, nil)
+			req.RequestURI = ""
+			resp, err := SendRequestForModel(req, upstream, envCfg, tt.isStream, tt.model)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendRequestForModel(%q) err = %v, wantErr %v", tt.model, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpstreamClient_TimeoutByModel(t *testing.T) {
+	upstream := &config.UpstreamConfig{ModelTimeouts: map[string]string{"claude-opus-*": "10m"}}
+	envCfg := &config.EnvConfig{RequestTimeout: 300000}
+
+	if got := upstreamClient(upstream, envCfg, false, "claude-opus-4").Timeout; got != 10*time.Minute {
+		t.Fatalf("claude-opus-4 超时 = %v, want 10m", got)
+	}
+	if got := upstreamClient(upstream, envCfg, false, "claude-sonnet-4").Timeout; got != 5*time.Minute {
+		t.Fatalf("claude-sonnet-4 超时 = %v, want 5m", got)
+	}
+	if got := upstreamClient(upstream, envCfg, true, "claude-opus-4").Timeout; got != 0 {
+		t.Fatalf("流式请求不应设置整体超时，实际 %v", got)
+	}
+}
+
+// TestSendRequestForModel_ChannelResponseTimeout 测试渠道 responseTimeout 覆盖全局超时，模型超时优先于渠道超时
+func TestSendRequestForModel_ChannelResponseTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	envCfg := &config.EnvConfig{RequestTimeout: 100}
+	tests := []struct {
+		name     string
+		upstream *config.UpstreamConfig
+		model    string
+		wantErr  bool
+	}{
+		{name: "fast relay fails quickly", upstream: &config.UpstreamConfig{ResponseTimeout: "50ms"}, wantErr: true},
+		{name: "slow provider gets longer timeout", upstream: &config.UpstreamConfig{ResponseTimeout: "5s"}, wantErr: false},
+		{name: "no override uses global timeout", upstream: &config.UpstreamConfig{}, wantErr: true},
+		{name: "model timeout wins over channel", model: "slow-model",
+			upstream: &config.UpstreamConfig{ResponseTimeout: "50ms", ModelTimeouts: map[string]string{"slow-*": "5s"}}, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, server.URL, nil)
+			req.RequestURI = ""
+			resp, err := SendRequestForModel(req, tt.upstream, envCfg, false, tt.model)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestSendRequest_ChannelProxy 测试配置 proxyUrl 的渠道经由出站代理访问上游（流式与非流式）
+func TestSendRequest_ChannelProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// HTTP 代理收到的是绝对 URL 形式的请求
+		proxied = append(proxied, r.URL.String()+" "+r.Header.Get("Proxy-Authorization"))
+		_, _ = w.Write([]byte("via-proxy"))
+	}))
+	defer proxy.Close()
+
+	envCfg := &config.EnvConfig{RequestTimeout: 5000, ResponseHeaderTimeout: 5}
+	proxyURL := strings.Replace(proxy.URL, "http://", "http://egress:secret@", 1)
+	// 上游主机不可解析，只有经由代理才能成功
+	upstream := &config.UpstreamConfig{BaseURL: "http://upstream.invalid", ProxyURL: proxyURL}
+
+	for _, isStream := range []bool{false, true} {
+		req, err := http.NewRequest(http.MethodPost, "http://upstream.invalid/v1/messages", bytes.NewBufferString(`{}`))
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		resp, err := SendRequest(req, upstream, envCfg, isStream)
+		if err != nil {
+			t.Fatalf("SendRequest(stream=%v): %v", isStream, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "via-proxy" {
+			t.Fatalf("stream=%v body = %q", isStream, body)
+		}
+	}
+
+	if len(proxied) != 2 {
+		t.Fatalf("代理收到 %d 个请求，want 2", len(proxied))
+	}
+	for _, got := range proxied {
+		if !strings.HasPrefix(got, "http://upstream.invalid/v1/messages Basic ") {
+			t.Fatalf("代理收到的请求 = %q", got)
+		}
+	}
+
+	// 未配置代理的渠道直连，不经过代理
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("direct"))
+	}))
+	defer direct.Close()
+	req, _ := http.NewRequest(http.MethodGet, direct.URL, nil)
+	resp, err := SendRequest(req, &config.UpstreamConfig{BaseURL: direct.URL}, envCfg, false)
+	if err != nil {
+		t.Fatalf("SendRequest: %v", err)
+	}
+	resp.Body.Close()
+	if len(proxied) != 2 {
+		t.Fatalf("直连渠道不应经过代理")
+	}
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// gzipMagic gzip 数据的文件头，用于识别已压缩的响应体，避免二次压缩
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// WriteJSONResponse 序列化并写出非流式 JSON 响应，满足条件时按客户端 Accept-Encoding 重新压缩（见 WriteResponseBody）
+func WriteJSONResponse(c *gin.Context, envCfg *config.EnvConfig, status int, obj interface{}) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		c.JSON(status, obj)
+		return
+	}
+	WriteResponseBody(c, envCfg, status, "application/json; charset=utf-8", body)
+}
+
+// WriteResponseBody 写出非流式响应体。上游响应在代理侧已被解压，启用 RESPONSE_COMPRESSION 后，
+// 客户端声明支持 gzip 且响应体不小于 RESPONSE_COMPRESSION_MIN_SIZE 时重新以 gzip 压缩并设置 Content-Encoding；
+// 响应头已带 Content-Encoding 或响应体本身已是 gzip 数据（上游原样透传）时不再压缩。流式响应不经过此函数
+func WriteResponseBody(c *gin.Context, envCfg *config.EnvConfig, status int, contentType string, body []byte) {
+	if !shouldCompressResponse(c, envCfg, body) {
+		c.Data(status, contentType, body)
+		return
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		log.Printf("[Response-Compression] 警告: gzip 压缩失败，返回未压缩响应: %v", err)
+		c.Data(status, contentType, body)
+		return
+	}
+	if err := gz.Close(); err != nil {
+		log.Printf("[Response-Compression] 警告: gzip 压缩失败，返回未压缩响应: %v", err)
+		c.Data(status, contentType, body)
+		return
+	}
+
+	c.Header("Content-Encoding", "gzip")
+	c.Writer.Header().Add("Vary", "Accept-Encoding")
+	c.Data(status, contentType, buf.Bytes())
+}
+
+func shouldCompressResponse(c *gin.Context, envCfg *config.EnvConfig, body []byte) bool {
+	if envCfg == nil || !envCfg.ResponseCompression || len(body) < envCfg.ResponseCompressionMinSize {
+		return false
+	}
+	if c.Writer.Header().Get("Content-Encoding") != "" || bytes.HasPrefix(body, gzipMagic) {
+		return false
+	}
+	return acceptsGzip(c.GetHeader("Accept-Encoding"))
+}
+
+// acceptsGzip 解析 Accept-Encoding，判断客户端是否接受 gzip（支持 q 值与通配符 *，q=0 表示拒绝）
+func acceptsGzip(header string) bool {
+	gzipQ, wildcardQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			wildcardQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return wildcardQ > 0
+}
@@ -0,0 +1,116 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                     false,
+		"gzip":                 true,
+		"GZIP, deflate, br":    true,
+		"br":                   false,
+		"gzip;q=0":             false,
+		"gzip; q=0.5, br":      true,
+		"*":                    true,
+		"*;q=0":                false,
+		"gzip;q=0, *":          false,
+		"identity, *;q=0.1":    true,
+		"deflate, x-gzip;q=1":  true,
+		"br;q=1.0, gzip;q=0.0": false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func newCompressionTestContext(acceptEncoding string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	if acceptEncoding != "" {
+		c.Request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	return c, w
+}
+
+func TestWriteResponseBody_Compression(t *testing.T) {
+	enabled := &config.EnvConfig{ResponseCompression: true, ResponseCompressionMinSize: 64}
+	large := []byte(`{"content":"` + strings.Repeat("hello ", 100) + `"}`)
+
+	t.Run("压缩大响应", func(t *testing.T) {
+		c, w := newCompressionTestContext("gzip, br")
+		WriteResponseBody(c, enabled, 200, "application/json", large)
+		if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("headers = %v", w.Header())
+		}
+		reader, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %v", err)
+		}
+		decoded, _ := io.ReadAll(reader)
+		if !bytes.Equal(decoded, large) {
+			t.Fatalf("解压后内容不一致")
+		}
+	})
+
+	skipCases := []struct {
+		name   string
+		envCfg *config.EnvConfig
+		accept string
+		body   []byte
+		preset string
+	}{
+		{"未启用", &config.EnvConfig{ResponseCompressionMinSize: 64}, "gzip", large, ""},
+		{"客户端不支持", enabled, "br", large, ""},
+		{"低于阈值", enabled, "gzip", []byte(`{"ok":true}`), ""},
+		{"已设置 Content-Encoding", enabled, "gzip", large, "identity"},
+		{"响应体已是 gzip", enabled, "gzip", append([]byte{0x1f, 0x8b}, large...), ""},
+	}
+	for _, tt := range skipCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newCompressionTestContext(tt.accept)
+			if tt.preset != "" {
+				c.Header("Content-Encoding", tt.preset)
+			}
+			WriteResponseBody(c, tt.envCfg, 200, "application/json", tt.body)
+			if got := w.Header().Get("Content-Encoding"); got != tt.preset {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.preset)
+			}
+			if !bytes.Equal(w.Body.Bytes(), tt.body) {
+				t.Fatalf("响应体不应被修改")
+			}
+		})
+	}
+}
+
+func TestWriteJSONResponse_Compression(t *testing.T) {
+	c, w := newCompressionTestContext("gzip")
+	envCfg := &config.EnvConfig{ResponseCompression: true}
+	WriteJSONResponse(c, envCfg, 200, gin.H{"id": "msg_1"})
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("阈值为 0 时应压缩")
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	decoded, _ := io.ReadAll(reader)
+	if string(decoded) != `{"id":"msg_1"}` {
+		t.Fatalf("body = %s", decoded)
+	}
+}
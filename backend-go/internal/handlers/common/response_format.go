@@ -0,0 +1,30 @@
+package common
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 客户端可通过 Accept 头要求以另一种协议格式返回非流式响应（与上游协议无关）
+const (
+	ResponseFormatOpenAI = "openai" // Accept: application/vnd.openai+json → OpenAI Chat Completions
+	ResponseFormatClaude = "claude" // Accept: application/vnd.anthropic+json → Claude Messages
+
+	// ResponseFormatHeader 响应经过格式转换时返回的响应头，值为转换后的格式
+	ResponseFormatHeader = "X-Proxy-Response-Format"
+)
+
+// RequestedResponseFormat 解析 Accept 头中请求的响应格式，未指定时返回空字符串（使用接口原生格式）
+func RequestedResponseFormat(c *gin.Context) string {
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/vnd.openai+json":
+			return ResponseFormatOpenAI
+		case "application/vnd.anthropic+json":
+			return ResponseFormatClaude
+		}
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package common
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestedResponseFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"application/json", ""},
+		{"application/vnd.openai+json", ResponseFormatOpenAI},
+		{"text/event-stream, Application/VND.OpenAI+JSON; q=0.9", ResponseFormatOpenAI},
+		{"application/vnd.anthropic+json", ResponseFormatClaude},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+		c.Request.Header.Set("Accept", tt.accept)
+		if got := RequestedResponseFormat(c); got != tt.want {
+			t.Errorf("RequestedResponseFormat(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"log"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// RewriteEventModel 按渠道 responseModelRewrite 改写 SSE 事件 data 行中 path 处的模型名
+// Messages 为 message_start 的 message.model，Responses 为 response.* 事件的 response.model；
+// 只改写转发给客户端的事件，usage 解析与日志合成仍使用上游原始事件
+func RewriteEventModel(event, path string, upstream *config.UpstreamConfig, enableLog bool) string {
+	if upstream == nil || len(upstream.ResponseModelRewrite) == 0 || !strings.Contains(event, `"model"`) {
+		return event
+	}
+
+	lines := strings.Split(event, "\n")
+	changed := false
+	for i, line := range lines {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		model := gjson.Get(data, path)
+		if model.Type != gjson.String {
+			continue
+		}
+		rewritten, ok := upstream.RewriteResponseModel(model.String())
+		if !ok {
+			continue
+		}
+		updated, err := sjson.Set(data, path, rewritten)
+		if err != nil {
+			continue
+		}
+		lines[i] = "data: " + updated
+		changed = true
+		if enableLog {
+			log.Printf("[Response-Model] 渠道 %s 改写 %s: %s -> %s", upstream.Name, path, model.String(), rewritten)
+		}
+	}
+
+	if !changed {
+		return event
+	}
+	return strings.Join(lines, "\n")
+}
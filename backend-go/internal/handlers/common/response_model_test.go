@@ -0,0 +1,54 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+func TestRewriteEventModel(t *testing.T) {
+	upstream := &config.UpstreamConfig{
+		Name:                 "u",
+		ResponseModelRewrite: map[string]string{"internal-x": "claude-3-5-sonnet"},
+	}
+
+	t.Run("message_start", func(t *testing.T) {
+		event := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"model\":\"internal-x\",\"usage\":{\"input_tokens\":7,\"output_tokens\":1}}}\n\n"
+		got := RewriteEventModel(event, "message.model", upstream, false)
+		if !strings.Contains(got, `"model":"claude-3-5-sonnet"`) || strings.Contains(got, "internal-x") {
+			t.Fatalf("model not rewritten: %q", got)
+		}
+		if !strings.HasPrefix(got, "event: message_start\n") || !strings.HasSuffix(got, "\n\n") {
+			t.Fatalf("SSE framing changed: %q", got)
+		}
+		_, _, usage := CheckEventUsageStatus(got, false)
+		if usage.InputTokens != 7 {
+			t.Fatalf("usage broken after rewrite: %+v", usage)
+		}
+	})
+
+	t.Run("responses event", func(t *testing.T) {
+		event := "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\",\"model\":\"internal-x\"}}\n"
+		got := RewriteEventModel(event, "response.model", upstream, false)
+		if !strings.Contains(got, `"model":"claude-3-5-sonnet"`) {
+			t.Fatalf("model not rewritten: %q", got)
+		}
+	})
+
+	unchanged := []struct {
+		name     string
+		event    string
+		upstream *config.UpstreamConfig
+	}{
+		{"unmapped model", "data: {\"message\":{\"model\":\"other\"}}\n", upstream},
+		{"no model field", "data: {\"type\":\"ping\"}\n", upstream},
+		{"nil upstream", "data: {\"message\":{\"model\":\"internal-x\"}}\n", nil},
+		{"no rewrite configured", "data: {\"message\":{\"model\":\"internal-x\"}}\n", &config.UpstreamConfig{}},
+	}
+	for _, tt := range unchanged {
+		if got := RewriteEventModel(tt.event, "message.model", tt.upstream, false); got != tt.event {
+			t.Fatalf("%s: event changed: %q", tt.name, got)
+		}
+	}
+}
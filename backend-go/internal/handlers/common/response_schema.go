@@ -0,0 +1,107 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/tidwall/gjson"
+)
+
+// ValidateResponseSchema 校验非流式响应内容是否符合渠道配置的 JSON Schema
+// 未配置 responseSchema 时直接返回 nil；响应体读取后会重新放回 resp.Body，供后续处理使用
+func ValidateResponseSchema(resp *http.Response, upstream *config.UpstreamConfig) error {
+	if upstream == nil || len(upstream.ResponseSchema) == 0 {
+		return nil
+	}
+
+	schema, err := utils.ParseJSONSchema(upstream.ResponseSchema)
+	if err != nil {
+		// Schema 本身无效属于配置问题，不应让所有请求失败
+		log.Printf("[Schema-Validate] 警告: 渠道 %s 的 responseSchema 无效，跳过校验: %v", upstream.Name, err)
+		return nil
+	}
+
+	rawBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(rawBody))
+	if err != nil {
+		return fmt.Errorf("读取响应体失败: %w", err)
+	}
+
+	content := ExtractResponseContent(upstream.ServiceType, utils.DecompressGzipIfNeeded(resp, rawBody))
+	if content == "" {
+		return fmt.Errorf("响应中没有可校验的文本内容")
+	}
+
+	var instance interface{}
+	if err := json.Unmarshal([]byte(stripJSONCodeFence(content)), &instance); err != nil {
+		return fmt.Errorf("响应内容不是有效的 JSON: %w", err)
+	}
+	return utils.ValidateJSONSchema(schema, instance)
+}
+
+// ExtractResponseContent 按上游服务类型提取非流式响应中的模型输出文本
+func ExtractResponseContent(serviceType string, body []byte) string {
+	var sb strings.Builder
+	switch serviceType {
+	case "claude":
+		for _, block := range gjson.GetBytes(body, "content").Array() {
+			if block.Get("type").String() == "text" {
+				sb.WriteString(block.Get("text").String())
+			}
+		}
+	case "gemini":
+		for _, part := range gjson.GetBytes(body, "candidates.0.content.parts").Array() {
+			if !part.Get("thought").Bool() {
+				sb.WriteString(part.Get("text").String())
+			}
+		}
+	case "responses":
+		for _, item := range gjson.GetBytes(body, "output").Array() {
+			if item.Get("type").String() != "message" {
+				continue
+			}
+			for _, part := range item.Get("content").Array() {
+				if part.Get("type").String() == "output_text" {
+					sb.WriteString(part.Get("text").String())
+				}
+			}
+		}
+	default:
+		// openai 及兼容格式
+		sb.WriteString(gjson.GetBytes(body, "choices.0.message.content").String())
+	}
+	return sb.String()
+}
+
+// stripJSONCodeFence 去除模型常见的 ```json 代码块包裹
+func stripJSONCodeFence(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if !strings.HasPrefix(trimmed, "```") {
+		return trimmed
+	}
+	trimmed = strings.TrimPrefix(trimmed, "```")
+	if idx := strings.IndexByte(trimmed, '\n'); idx >= 0 {
+		trimmed = trimmed[idx+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(trimmed), "```"))
+}
+
+// NewSchemaFailoverError 构造响应 Schema 校验失败的故障转移错误（所有渠道失败时返回给客户端）
+func NewSchemaFailoverError(err error) *FailoverError {
+	body, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    "response_schema_violation",
+			"message": "Upstream response does not match the configured schema: " + err.Error(),
+		},
+	})
+	return &FailoverError{Status: http.StatusBadGateway, Body: body}
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+func TestExtractResponseContent(t *testing.T) {
+	tests := []struct {
+		serviceType string
+		body        string
+		want        string
+	}{
+		{"claude", `{"content":[{"type":"thinking","thinking":"hmm"},{"type":"text","text":"{\"a\":1}"}]}`, `{"a":1}`},
+		{"openai", `{"choices":[{"message":{"content":"{\"a\":1}"}}]}`, `{"a":1}`},
+		{"gemini", `{"candidates":[{"content":{"parts":[{"text":"skip","thought":true},{"text":"{\"a\":1}"}]}}]}`, `{"a":1}`},
+		{"responses", `{"output":[{"type":"reasoning"},{"type":"message","content":[{"type":"output_text","text":"{\"a\":1}"}]}]}`, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		if got := ExtractResponseContent(tt.serviceType, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.serviceType, got, tt.want)
+		}
+	}
+}
+
+func TestValidateResponseSchema(t *testing.T) {
+	upstream := &config.UpstreamConfig{
+		Name:           "schema",
+		ServiceType:    "openai",
+		ResponseSchema: []byte(`{"type":"object","required":["answer"]}`),
+	}
+	newResp := func(content string) *http.Response {
+		body := `{"choices":[{"message":{"content":` + content + `}}]}`
+		return &http.Response{Header: http.Header{}, Body: io.NopCloser(bytes.NewBufferString(body))}
+	}
+
+	// 符合 Schema（允许 ```json 代码块包裹），且响应体可被再次读取
+	resp := newResp(`"` + "```json\\n{\\\"answer\\\":42}\\n```" + `"`)
+	if err := ValidateResponseSchema(resp, upstream); err != nil {
+		t.Fatalf("expected conforming response, got %v", err)
+	}
+	if body, _ := io.ReadAll(resp.Body); !bytes.Contains(body, []byte("answer")) {
+		t.Fatalf("response body should be restored, got %s", body)
+	}
+
+	if err := ValidateResponseSchema(newResp(`"{\"other\":1}"`), upstream); err == nil {
+		t.Fatal("expected schema violation for missing field")
+	}
+	if err := ValidateResponseSchema(newResp(`"plain text"`), upstream); err == nil {
+		t.Fatal("expected error for non-JSON content")
+	}
+
+	// 未配置 Schema 时不校验
+	if err := ValidateResponseSchema(newResp(`"plain text"`), &config.UpstreamConfig{ServiceType: "openai"}); err != nil {
+		t.Fatalf("no schema configured should pass, got %v", err)
+	}
+}
@@ -29,6 +29,7 @@ type StreamContext struct {
 	ClientGone       bool
 	HasUsage         bool
 	NeedTokenPatch   bool
+	UsageEstimated   bool // usage 是否使用了本地估算（注入或修补）
 	// 累积的 token 统计
 	CollectedUsage CollectedUsageData
 	// 用于日志的"续写前缀"（不参与真实转发，只影响 Stream-Synth 输出可读性）
@@ -40,6 +41,22 @@ type StreamContext struct {
 	// 低质量渠道处理
 	RequestModel string // 请求中的 model（用于一致性检查）
 	LowQuality   bool   // 是否为低质量渠道
+	// 流式事件修复（STREAM_REPAIR_MODE）
+	RepairMode  bool
+	OpenBlocks  map[int]bool // 已开始但尚未结束的 content block
+	RepairCount int          // 合成或丢弃的事件数
+	ChannelName string       // 修复告警日志中的渠道名
+	APIKey      string       // 修复告警日志中的密钥（输出时脱敏）
+	// 响应模型名改写（渠道 responseModelRewrite）
+	Upstream *config.UpstreamConfig
+	// 客户端取消统计
+	OutputTokensAtDisconnect int // 客户端断开时已生成的输出 token 数
+	// 空流检测（EMPTY_STREAM_FAILOVER）期间预读、尚未转发的事件
+	PrefetchedEvents []string
+	// 收到首个内容事件的时间（首 token 延迟统计）
+	FirstTokenAt time.Time
+	// 扩展思考（thinking_delta）文本，用于估算 thinking token
+	ThinkingTextBuffer bytes.Buffer
 }
 
 // CollectedUsageData 从流事件中收集的 usage 数据
@@ -59,6 +76,8 @@ func NewStreamContext(envCfg *config.EnvConfig) *StreamContext {
 	ctx := &StreamContext{
 		LoggingEnabled:    envCfg.IsDevelopment() && envCfg.EnableResponseLogs,
 		ContentBlockTypes: make(map[int]string),
+		RepairMode:        envCfg.StreamRepairMode,
+		OpenBlocks:        make(map[int]bool),
 	}
 	if ctx.LoggingEnabled {
 		ctx.Synthesizer = utils.NewStreamSynthesizer("claude")
@@ -66,6 +85,31 @@ func NewStreamContext(envCfg *config.EnvConfig) *StreamContext {
 	return ctx
 }
 
+// markClientGone 标记客户端已断开，并记录此时已生成的输出 token 数（用于取消统计）
+func (ctx *StreamContext) markClientGone() {
+	if ctx.ClientGone {
+		return
+	}
+	ctx.ClientGone = true
+	ctx.OutputTokensAtDisconnect = ctx.outputTokens()
+}
+
+// outputTokens 当前已生成的输出 token 数：取上游 usage 与已接收文本估算的较大值
+// （message_start 中的 output_tokens 通常只是占位值，不能代表已生成的内容）
+func (ctx *StreamContext) outputTokens() int {
+	return max(ctx.CollectedUsage.OutputTokens, ctx.estimatedOutputTokens())
+}
+
+// estimatedOutputTokens 按已接收文本估算的输出 token 数（thinking 同样按输出计费）
+func (ctx *StreamContext) estimatedOutputTokens() int {
+	return utils.EstimateTokens(ctx.OutputTextBuffer.String()) + utils.EstimateTokens(ctx.ThinkingTextBuffer.String())
+}
+
+// thinkingTokens 本次响应的 thinking token 数（Claude 流式 usage 不单独返回，按 thinking 文本估算）
+func (ctx *StreamContext) thinkingTokens() int {
+	return ClampThinkingTokens(utils.EstimateTokens(ctx.ThinkingTextBuffer.String()), ctx.CollectedUsage.OutputTokens)
+}
+
 // seedSynthesizerFromRequest 将请求里预置的 assistant 文本拼接进合成器（仅用于日志可读性）
 //
 // Claude Code 的部分内部调用会在 messages 里预置一条 assistant 内容（例如 "{"），让模型只输出“续写”部分。
@@ -119,8 +163,27 @@ func SetupStreamHeaders(c *gin.Context, resp *http.Response) {
 	c.Status(200)
 }
 
+// heartbeatEvent SSE 注释行心跳，客户端会忽略该行，仅用于保持连接活跃
+const heartbeatEvent = ": ping\n\n"
+
+// resetHeartbeatTimer 重置心跳计时器（先停止并排空已触发的信号，避免重复心跳）
+func resetHeartbeatTimer(timer *time.Timer, interval time.Duration) {
+	if timer == nil {
+		return
+	}
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(interval)
+}
+
 // ProcessStreamEvents 处理流事件循环
 // 返回值: error 表示流处理过程中是否发生错误（用于调用方决定是否记录失败指标）
+// 配置 STREAM_HEARTBEAT_INTERVAL 后，若超过该间隔未向客户端转发任何事件，会发送 SSE 注释心跳保持连接
+// 配置 STREAM_FLUSH_INTERVAL 后，窗口内的多次 Flush 会被合并，usage/终止事件仍立即刷新
 func ProcessStreamEvents(
 	c *gin.Context,
 	w gin.ResponseWriter,
@@ -149,14 +212,78 @@ func ProcessStreamEvents(
 		if !ctx.ClientGone {
 			errorEvent := BuildStreamErrorEvent(err)
 			w.Write([]byte(errorEvent))
-			flusher.Flush()
+			flushStreamEvent(flusher, errorEvent)
 		}
 
 		return err
 	}
 
+	// 刷新合并：延迟刷新计时器同样在事件循环中处理，避免并发 Flush
+	var coalescer *FlushCoalescer
+	var flushTimer *time.Timer
+	var flushC <-chan time.Time
+	if envCfg.StreamFlushInterval > 0 {
+		coalescer = NewFlushCoalescer(flusher, time.Duration(envCfg.StreamFlushInterval)*time.Millisecond, envCfg.StreamFlushMaxEvents)
+		flusher = coalescer
+		flushTimer = time.NewTimer(time.Hour)
+		flushTimer.Stop()
+		defer flushTimer.Stop()
+		// 流结束时刷新剩余事件
+		defer coalescer.FlushPending()
+	}
+
+	// 心跳计时器：与事件转发在同一循环中处理，避免并发写入 ResponseWriter
+	heartbeatInterval := time.Duration(envCfg.StreamHeartbeatInterval) * time.Second
+	var heartbeatTimer *time.Timer
+	var heartbeatC <-chan time.Time
+	if heartbeatInterval > 0 {
+		heartbeatTimer = time.NewTimer(heartbeatInterval)
+		defer heartbeatTimer.Stop()
+		heartbeatC = heartbeatTimer.C
+	}
+
+	// 客户端取消请求（连接关闭）时请求上下文结束，无需等到下一次写入失败
+	clientDone := c.Request.Context().Done()
+
+	// 先转发空流检测期间预读的事件
+	for _, event := range ctx.PrefetchedEvents {
+		ProcessStreamEvent(c, w, flusher, event, ctx, envCfg, requestBody)
+	}
+	ctx.PrefetchedEvents = nil
+
 	for {
 		select {
+		case <-clientDone:
+			ctx.markClientGone()
+			clientDone = nil
+			if envCfg.ShouldLog("info") {
+				log.Printf("[Messages-Stream] 客户端取消请求，继续接收上游数据...")
+			}
+
+		case <-heartbeatC:
+			if ctx.ClientGone {
+				// 客户端已断开：停止心跳，仅继续接收上游数据
+				heartbeatC = nil
+				continue
+			}
+			if _, err := w.Write([]byte(heartbeatEvent)); err != nil {
+				ctx.markClientGone()
+				heartbeatC = nil
+				if !IsClientDisconnectError(err) {
+					log.Printf("[Messages-Stream] 警告: 心跳写入错误: %v", err)
+				}
+				continue
+			}
+			flusher.Flush()
+			if envCfg.ShouldLog("debug") {
+				log.Printf("[Messages-Stream-Heartbeat] 上游 %v 无事件，已发送心跳", heartbeatInterval)
+			}
+			heartbeatTimer.Reset(heartbeatInterval)
+
+		case <-flushC:
+			flushC = nil
+			coalescer.FlushPending()
+
 		case event, ok := <-eventChan:
 			if !ok {
 				// eventChan 已关闭，但 errChan 可能仍有缓冲错误；这里做一次非阻塞 drain，避免吞掉错误。
@@ -176,7 +303,17 @@ func ProcessStreamEvents(
 					}
 				}
 			}
+			if ctx.FirstTokenAt.IsZero() && streamEventHasContent(event) {
+				ctx.FirstTokenAt = time.Now()
+			}
 			ProcessStreamEvent(c, w, flusher, event, ctx, envCfg, requestBody)
+			if coalescer != nil && coalescer.Pending() && flushC == nil {
+				flushTimer.Reset(coalescer.NextFlushIn())
+				flushC = flushTimer.C
+			}
+			if heartbeatC != nil {
+				resetHeartbeatTimer(heartbeatTimer, heartbeatInterval)
+			}
 
 		case err, ok := <-errChan:
 			if !ok {
@@ -199,6 +336,17 @@ func ProcessStreamEvent(
 	envCfg *config.EnvConfig,
 	requestBody []byte,
 ) {
+	// 修复模式：在转发前补全缺失的 content_block_start/stop，丢弃无法修复的事件
+	if ctx.RepairMode {
+		synthesized, keep := repairEventSequence(ctx, event)
+		for _, e := range synthesized {
+			writeRepairEvent(w, flusher, ctx, e)
+		}
+		if !keep {
+			return
+		}
+	}
+
 	// SSE 事件调试日志
 	ctx.EventCount++
 	if envCfg.SSEDebugLevel == "full" || envCfg.SSEDebugLevel == "summary" {
@@ -221,6 +369,7 @@ func ProcessStreamEvent(
 
 	// 提取文本用于估算 token
 	ExtractTextFromEvent(event, &ctx.OutputTextBuffer)
+	ExtractThinkingFromEvent(event, &ctx.ThinkingTextBuffer)
 
 	// 检测并收集 usage
 	hasUsage, needPatch, usageData := CheckEventUsageStatus(event, envCfg.EnableResponseLogs && envCfg.ShouldLog("debug"))
@@ -248,21 +397,30 @@ func ProcessStreamEvent(
 
 	// 在 message_stop 前注入 usage（上游完全没有 usage 的情况）
 	if !ctx.HasUsage && !ctx.ClientGone && IsMessageStopEvent(event) {
-		usageEvent := BuildUsageEvent(requestBody, ctx.OutputTextBuffer.String())
+		usageEvent := BuildUsageEvent(requestBody, ctx.OutputTextBuffer.String()+ctx.ThinkingTextBuffer.String())
 		if envCfg.EnableResponseLogs && envCfg.ShouldLog("debug") {
 			log.Printf("[Messages-Stream-Token] 上游无usage, 注入本地估算事件")
 		}
 		w.Write([]byte(usageEvent))
-		flusher.Flush()
+		flushStreamEvent(flusher, usageEvent)
 		ctx.HasUsage = true
+		ctx.UsageEstimated = true
 	}
 
 	// 修补 token
 	eventToSend := event
 
-	// 处理 message_start 事件：补全空 id 和检查 model 一致性
-	if IsMessageStartEvent(event) && ctx.RequestModel != "" {
-		eventToSend = PatchMessageStartEvent(eventToSend, ctx.RequestModel, envCfg.EnableResponseLogs && envCfg.ShouldLog("debug"))
+	// 处理 message_start 事件：按渠道改写模型名，补全空 id 和检查 model 一致性
+	if IsMessageStartEvent(event) {
+		rewritten := RewriteEventModel(eventToSend, "message.model", ctx.Upstream, envCfg.EnableResponseLogs && envCfg.ShouldLog("debug"))
+		if ctx.RequestModel != "" {
+			expectedModel := ctx.RequestModel
+			if rewritten != eventToSend {
+				expectedModel = "" // 渠道显式改写优先，跳过 model 一致性检查（仍补全空 id）
+			}
+			rewritten = PatchMessageStartEvent(rewritten, expectedModel, envCfg.EnableResponseLogs && envCfg.ShouldLog("debug"))
+		}
+		eventToSend = rewritten
 	}
 
 	if ctx.NeedTokenPatch && HasEventWithUsage(event) {
@@ -273,25 +431,26 @@ func ProcessStreamEvent(
 			}
 			outputTokens := ctx.CollectedUsage.OutputTokens
 			if outputTokens == 0 {
-				outputTokens = utils.EstimateTokens(ctx.OutputTextBuffer.String())
+				outputTokens = ctx.estimatedOutputTokens()
 			}
 			hasCacheTokens := ctx.CollectedUsage.CacheCreationInputTokens > 0 || ctx.CollectedUsage.CacheReadInputTokens > 0
 			eventToSend = PatchTokensInEvent(eventToSend, inputTokens, outputTokens, hasCacheTokens, envCfg.EnableResponseLogs && envCfg.ShouldLog("debug"), ctx.LowQuality)
 			ctx.NeedTokenPatch = false
+			ctx.UsageEstimated = true
 		}
 	}
 
 	// 转发给客户端
 	if !ctx.ClientGone {
 		if _, err := w.Write([]byte(eventToSend)); err != nil {
-			ctx.ClientGone = true
+			ctx.markClientGone()
 			if !IsClientDisconnectError(err) {
 				log.Printf("[Messages-Stream] 警告: 写入错误: %v", err)
 			} else if envCfg.ShouldLog("info") {
 				log.Printf("[Messages-Stream] 客户端中断连接 (正常行为)，继续接收上游数据...")
 			}
 		} else {
-			flusher.Flush()
+			flushStreamEvent(flusher, eventToSend)
 		}
 	}
 }
@@ -358,6 +517,7 @@ func logStreamCompletion(ctx *StreamContext, envCfg *config.EnvConfig, startTime
 			CacheCreation5mInputTokens: ctx.CollectedUsage.CacheCreation5mInputTokens,
 			CacheCreation1hInputTokens: ctx.CollectedUsage.CacheCreation1hInputTokens,
 			CacheTTL:                   ctx.CollectedUsage.CacheTTL,
+			ThinkingTokens:             ctx.thinkingTokens(),
 		}
 	}
 
@@ -403,7 +563,7 @@ func logSynthesizedContent(ctx *StreamContext) {
 		}
 	}
 	if ctx.LogBuffer.Len() > 0 {
-		log.Printf("[Messages-Stream] 上游流式响应原始内容:\n%s", ctx.LogBuffer.String())
+		log.Printf("[Messages-Stream] 上游流式响应原始内容:\n%s", utils.RedactSSEForLog(ctx.LogBuffer.String()))
 	}
 }
 
@@ -430,6 +590,7 @@ func HandleStreamResponse(
 	requestModel string,
 ) (*types.Usage, int64, error) {
 	defer resp.Body.Close()
+	defer TrackStream("messages")()
 
 	eventChan, errChan, err := provider.HandleStreamResponse(resp.Body)
 	if err != nil {
@@ -437,6 +598,14 @@ func HandleStreamResponse(
 		return nil, 0, err
 	}
 
+	ctx := NewStreamContext(envCfg)
+	if envCfg.EmptyStreamFailover {
+		// 尚未写入响应头：空流时直接返回，由调用方故障转移
+		if err := prefetchStreamEvents(c, eventChan, errChan, ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	SetupStreamHeaders(c, resp)
 
 	w := c.Writer
@@ -447,11 +616,28 @@ func HandleStreamResponse(
 	}
 	flusher.Flush()
 
-	ctx := NewStreamContext(envCfg)
 	ctx.RequestModel = requestModel
 	ctx.LowQuality = upstream.LowQuality
+	ctx.ChannelName = upstream.Name
+	ctx.APIKey = apiKey
+	ctx.Upstream = upstream
 	seedSynthesizerFromRequest(ctx, requestBody)
 	streamErr := ProcessStreamEvents(c, w, flusher, eventChan, errChan, ctx, envCfg, startTime, requestBody, channelScheduler, upstream, apiKey, billingHandler, billingCtx, model)
+	if ctx.RepairCount > 0 {
+		channelScheduler.RecordStreamRepairs(upstream.BaseURL, apiKey, ctx.RepairCount, false)
+	}
+	channelScheduler.RecordStreamCompletion(upstream.BaseURL, apiKey, ctx.ClientGone, ctx.OutputTokensAtDisconnect, ctx.outputTokens(), false)
+	if streamErr == nil {
+		if timing, ok := NewStreamTiming(UpstreamAttemptStart(c, startTime), ctx.FirstTokenAt); ok {
+			channelScheduler.RecordStreamTiming(upstream.BaseURL, apiKey, timing.FirstToken, timing.Duration, ctx.outputTokens(), false)
+		}
+	}
+
+	if ctx.UsageEstimated {
+		GetDiagnostics(c).SetTokenSource(TokenSourceEstimated)
+	} else if ctx.HasUsage {
+		GetDiagnostics(c).SetTokenSource(TokenSourceUpstream)
+	}
 
 	var usage *types.Usage
 	hasUsageData := ctx.CollectedUsage.InputTokens > 0 ||
@@ -469,6 +655,7 @@ func HandleStreamResponse(
 			CacheCreation5mInputTokens: ctx.CollectedUsage.CacheCreation5mInputTokens,
 			CacheCreation1hInputTokens: ctx.CollectedUsage.CacheCreation1hInputTokens,
 			CacheTTL:                   ctx.CollectedUsage.CacheTTL,
+			ThinkingTokens:             ctx.thinkingTokens(),
 		}
 	}
 
@@ -963,6 +1150,7 @@ func ExtractTextFromEvent(event string, buf *bytes.Buffer) {
 }
 
 // extractSSEEventInfo 从 SSE 事件中提取事件类型、block 索引和 block 类型
+// content_block_delta 事件没有 content_block 字段，此时返回 delta 类型（如 text_delta）
 func extractSSEEventInfo(event string) (eventType string, blockIndex int, blockType string) {
 	for _, line := range strings.Split(event, "\n") {
 		if !strings.HasPrefix(line, "data: ") {
@@ -983,6 +1171,8 @@ func extractSSEEventInfo(event string) (eventType string, blockIndex int, blockT
 		// 从 content_block 中提取类型
 		if cb, ok := data["content_block"].(map[string]interface{}); ok {
 			blockType, _ = cb["type"].(string)
+		} else if delta, ok := data["delta"].(map[string]interface{}); ok && eventType == "content_block_delta" {
+			blockType, _ = delta["type"].(string)
 		}
 
 		return
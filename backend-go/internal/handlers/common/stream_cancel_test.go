@@ -0,0 +1,139 @@
+package common
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/providers"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// disconnectingRecorder 模拟客户端在第 failAt 次写入时断开连接（0 表示不断开）
+type disconnectingRecorder struct {
+	*httptest.ResponseRecorder
+	writes int
+	failAt int
+}
+
+func (r *disconnectingRecorder) Write(p []byte) (int, error) {
+	r.writes++
+	if r.failAt > 0 && r.writes >= r.failAt {
+		return 0, syscall.EPIPE
+	}
+	return r.ResponseRecorder.Write(p)
+}
+
+// chanStreamProvider 由测试逐个推送事件的流式 provider
+type chanStreamProvider struct {
+	fakeStreamProvider
+	events chan string
+}
+
+func (p *chanStreamProvider) HandleStreamResponse(io.ReadCloser) (<-chan string, <-chan error, error) {
+	errChan := make(chan error)
+	close(errChan)
+	return p.events, errChan, nil
+}
+
+const cancelTestText = "The quick brown fox jumps over the lazy dog"
+
+var cancelTestEvents = []string{
+	sseEvent("message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-3","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`),
+	sseEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`),
+	sseEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"`+cancelTestText+`"}}`),
+	sseEvent("content_block_stop", `{"type":"content_block_stop","index":0}`),
+	sseEvent("message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"input_tokens":10,"output_tokens":100}}`),
+	sseEvent("message_stop", `{"type":"message_stop"}`),
+}
+
+// runCancelStream 转发测试事件并返回渠道的流式取消统计
+func runCancelStream(t *testing.T, c *gin.Context, provider providers.Provider) metrics.StreamCancelStats {
+	t.Helper()
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(""))}
+	upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://example.com", APIKeys: []string{"k1"}}
+	if _, _, err := HandleStreamResponse(c, resp, provider, &config.EnvConfig{Env: "production"}, time.Now(), upstream,
+		[]byte(`{"model":"claude-3","messages":[]}`), sch, "k1", nil, nil, "claude-3", "claude-3"); err != nil {
+		t.Fatalf("HandleStreamResponse: %v", err)
+	}
+	return sch.GetMessagesMetricsManager().GetStreamCancelStats(upstream.GetAllBaseURLs(), upstream.APIKeys)
+}
+
+func TestHandleStreamResponse_RecordsClientDisconnectOnWriteError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	textTokens := int64(utils.EstimateTokens(cancelTestText))
+
+	tests := []struct {
+		name         string
+		failAt       int // 第几次写入失败（SetupStreamHeaders 后的首次 Flush 不计入写入）
+		wantCanceled int64
+		wantAtCancel int64
+		wantWasted   int64 // 最终输出 100 - 断开时 token
+	}{
+		{"正常完成", 0, 0, 0, 0},
+		{"message_start 时断开", 1, 1, 1, 99},
+		{"文本输出后断开", 4, 1, textTokens, 100 - textTokens},
+		{"message_stop 时断开", 6, 1, 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &disconnectingRecorder{ResponseRecorder: httptest.NewRecorder(), failAt: tt.failAt}
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+			stats := runCancelStream(t, c, &fakeStreamProvider{events: cancelTestEvents})
+			if stats.StreamCount != 1 || stats.CanceledCount != tt.wantCanceled {
+				t.Fatalf("streams=%d canceled=%d, want 1/%d", stats.StreamCount, stats.CanceledCount, tt.wantCanceled)
+			}
+			if stats.OutputTokensAtCancel != tt.wantAtCancel || stats.WastedOutputTokens != tt.wantWasted {
+				t.Fatalf("atCancel=%d wasted=%d, want %d/%d", stats.OutputTokensAtCancel, stats.WastedOutputTokens, tt.wantAtCancel, tt.wantWasted)
+			}
+			if tt.wantCanceled == 1 && stats.CancellationRate != 100 {
+				t.Fatalf("cancellationRate = %.1f, want 100", stats.CancellationRate)
+			}
+		})
+	}
+}
+
+func TestHandleStreamResponse_RecordsClientDisconnectOnContextCancel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	reqCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil).WithContext(reqCtx)
+
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		for i, e := range cancelTestEvents {
+			if i == 3 {
+				// 文本输出后客户端取消请求；留出时间让处理循环先观察到取消
+				cancel()
+				time.Sleep(50 * time.Millisecond)
+			}
+			events <- e
+		}
+	}()
+
+	stats := runCancelStream(t, c, &chanStreamProvider{events: events})
+	textTokens := int64(utils.EstimateTokens(cancelTestText))
+	if stats.CanceledCount != 1 || stats.OutputTokensAtCancel != textTokens || stats.WastedOutputTokens != 100-textTokens {
+		t.Fatalf("stats = %+v, want canceled=1 atCancel=%d wasted=%d", stats, textTokens, 100-textTokens)
+	}
+	// 取消后不再向客户端写入后续事件
+	if strings.Contains(rec.Body.String(), "message_stop") {
+		t.Fatalf("客户端取消后不应继续写入: %s", rec.Body.String())
+	}
+}
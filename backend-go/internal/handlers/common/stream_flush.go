@@ -0,0 +1,157 @@
+package common
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// FlushCoalescer 合并短时间窗口内的多次 Flush，降低高事件速率下的系统调用开销
+// 窗口空闲后的首个事件立即刷新（保持首字节延迟），窗口内的后续事件延迟到窗口结束或累计达到 maxEvents 时统一刷新。
+// 非并发安全：仅应在流事件循环所在的 goroutine 中使用。
+type FlushCoalescer struct {
+	flusher   http.Flusher
+	interval  time.Duration
+	maxEvents int
+	pending   int
+	lastFlush time.Time
+	now       func() time.Time
+}
+
+// NewFlushCoalescer 创建刷新合并器；maxEvents <= 0 时仅按时间窗口合并
+func NewFlushCoalescer(flusher http.Flusher, interval time.Duration, maxEvents int) *FlushCoalescer {
+	return &FlushCoalescer{
+		flusher:   flusher,
+		interval:  interval,
+		maxEvents: maxEvents,
+		now:       time.Now,
+	}
+}
+
+// Flush 实现 http.Flusher：距上次刷新超过窗口或待刷新事件达到上限时立即刷新，否则仅记录待刷新
+func (f *FlushCoalescer) Flush() {
+	f.pending++
+	if f.now().Sub(f.lastFlush) >= f.interval || (f.maxEvents > 0 && f.pending >= f.maxEvents) {
+		f.FlushNow()
+	}
+}
+
+// FlushNow 立即刷新（用于 usage/终止事件等必须及时送达的事件）
+func (f *FlushCoalescer) FlushNow() {
+	f.flusher.Flush()
+	f.pending = 0
+	f.lastFlush = f.now()
+}
+
+// FlushPending 存在待刷新事件时立即刷新
+func (f *FlushCoalescer) FlushPending() {
+	if f.pending > 0 {
+		f.FlushNow()
+	}
+}
+
+// Pending 是否存在尚未刷新的事件
+func (f *FlushCoalescer) Pending() bool {
+	return f.pending > 0
+}
+
+// NextFlushIn 距当前窗口结束的剩余时间（用于调度延迟刷新）
+func (f *FlushCoalescer) NextFlushIn() time.Duration {
+	remaining := f.interval - f.now().Sub(f.lastFlush)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// flushStreamEvent 写入事件后刷新：启用合并时 usage/终止/错误事件绕过合并立即刷新
+func flushStreamEvent(flusher http.Flusher, event string) {
+	if coalescer, ok := flusher.(*FlushCoalescer); ok && isImmediateFlushEvent(event) {
+		coalescer.FlushNow()
+		return
+	}
+	flusher.Flush()
+}
+
+// isImmediateFlushEvent 判断事件是否必须立即刷新（message_delta 携带 usage，message_stop/error 与
+// Responses 的 response.completed/incomplete/failed 为终止事件）
+// 仅读取 event 行与 data.type，避免对每个 delta 事件完整解析 JSON
+func isImmediateFlushEvent(event string) bool {
+	for _, line := range strings.Split(event, "\n") {
+		var eventType string
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			eventType = gjson.Get(strings.TrimPrefix(line, "data: "), "type").String()
+		}
+		switch eventType {
+		case "message_delta", "message_stop", "error",
+			"response.completed", "response.incomplete", "response.failed":
+			return true
+		}
+	}
+	return false
+}
+
+// TimedFlushCoalescer 供同步读取循环（无 select 事件循环，如 Responses 流）使用的刷新合并器：
+// 窗口结束时由计时器 goroutine 刷新待刷新事件，写入与刷新通过互斥锁串行化
+type TimedFlushCoalescer struct {
+	mu        sync.Mutex
+	w         io.Writer
+	coalescer *FlushCoalescer
+	timer     *time.Timer
+	armed     bool
+	closed    bool
+}
+
+// NewTimedFlushCoalescer 创建带延迟刷新计时器的合并器（参数含义同 NewFlushCoalescer）
+func NewTimedFlushCoalescer(w io.Writer, flusher http.Flusher, interval time.Duration, maxEvents int) *TimedFlushCoalescer {
+	return &TimedFlushCoalescer{w: w, coalescer: NewFlushCoalescer(flusher, interval, maxEvents)}
+}
+
+// WriteEvent 写入事件并按合并规则刷新；终止事件立即刷新，存在待刷新事件时安排窗口结束后的刷新
+func (t *TimedFlushCoalescer) WriteEvent(event string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.w.Write([]byte(event)); err != nil {
+		return err
+	}
+	flushStreamEvent(t.coalescer, event)
+	if t.coalescer.Pending() && !t.armed && !t.closed {
+		t.armed = true
+		if t.timer == nil {
+			t.timer = time.AfterFunc(t.coalescer.NextFlushIn(), t.flushPending)
+		} else {
+			t.timer.Reset(t.coalescer.NextFlushIn())
+		}
+	}
+	return nil
+}
+
+func (t *TimedFlushCoalescer) flushPending() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.armed = false
+	if !t.closed {
+		t.coalescer.FlushPending()
+	}
+}
+
+// Close 停止计时器并刷新剩余事件；之后计时器不再访问 ResponseWriter，须在处理函数返回前调用
+func (t *TimedFlushCoalescer) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.coalescer.FlushPending()
+}
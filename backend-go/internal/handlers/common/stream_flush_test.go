@@ -0,0 +1,372 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// countingFlusher 统计 Flush 次数，并在每次刷新时回调
+type countingFlusher struct {
+	flushes int
+	onFlush func()
+}
+
+func (f *countingFlusher) Flush() {
+	f.flushes++
+	if f.onFlush != nil {
+		f.onFlush()
+	}
+}
+
+func TestFlushCoalescer_CoalescesWithinWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	inner := &countingFlusher{}
+	fc := NewFlushCoalescer(inner, 5*time.Millisecond, 3)
+	fc.now = func() time.Time { return now }
+
+	// 窗口空闲后的首个事件立即刷新
+	fc.Flush()
+	if inner.flushes != 1 || fc.Pending() {
+		t.Fatalf("first flush: flushes=%d pending=%v", inner.flushes, fc.Pending())
+	}
+
+	// 窗口内的事件被合并
+	now = now.Add(time.Millisecond)
+	fc.Flush()
+	if inner.flushes != 1 || !fc.Pending() {
+		t.Fatalf("coalesced flush: flushes=%d pending=%v", inner.flushes, fc.Pending())
+	}
+	if got := fc.NextFlushIn(); got != 4*time.Millisecond {
+		t.Fatalf("NextFlushIn=%v, want 4ms", got)
+	}
+
+	// 累计达到 maxEvents 时立即刷新
+	fc.Flush()
+	fc.Flush()
+	if inner.flushes != 2 || fc.Pending() {
+		t.Fatalf("max events flush: flushes=%d pending=%v", inner.flushes, fc.Pending())
+	}
+
+	// 窗口结束后再次立即刷新
+	now = now.Add(5 * time.Millisecond)
+	fc.Flush()
+	if inner.flushes != 3 {
+		t.Fatalf("after window: flushes=%d, want 3", inner.flushes)
+	}
+
+	fc.FlushPending()
+	if inner.flushes != 3 {
+		t.Fatalf("FlushPending without pending events should be a no-op, flushes=%d", inner.flushes)
+	}
+}
+
+func TestIsImmediateFlushEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+		want  bool
+	}{
+		{"message_delta", "event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":3}}\n\n", true},
+		{"message_stop", "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n", true},
+		{"error", "event: error\ndata: {\"type\":\"error\"}\n\n", true},
+		{"data only stop", "data: {\"type\":\"message_stop\"}\n\n", true},
+		{"content delta", "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"message_stop\"}}\n\n", false},
+		{"responses completed", "event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{}}\n\n", true},
+		{"responses incomplete data only", "data: {\"type\":\"response.incomplete\",\"response\":{}}\n\n", true},
+		{"responses text delta", "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"x\"}\n\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isImmediateFlushEvent(tt.event); got != tt.want {
+				t.Fatalf("isImmediateFlushEvent=%v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessStreamEvents_FlushCoalescingTerminalEventFlushesImmediately(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	// 合并窗口远大于测试等待时间：若终止事件被合并，将无法及时观察到刷新
+	envCfg := &config.EnvConfig{StreamFlushInterval: 1000, StreamFlushMaxEvents: 100}
+	upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://example.com"}
+
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	flushed := make(chan string, 16)
+	flusher := &countingFlusher{onFlush: func() { flushed <- rec.Body.String() }}
+
+	eventChan := make(chan string)
+	errChan := make(chan error)
+	done := make(chan error, 1)
+	ctx := NewStreamContext(envCfg)
+	go func() {
+		done <- ProcessStreamEvents(c, c.Writer, flusher, eventChan, errChan, ctx, envCfg, time.Now(), nil, sch, upstream, "k1", nil, nil, "claude-3")
+	}()
+
+	eventChan <- "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"a\"}}\n\n"
+	eventChan <- "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"b\"}}\n\n"
+	eventChan <- "event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"input_tokens\":5,\"output_tokens\":2}}\n\n"
+	eventChan <- "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+
+	// 上游连接保持打开：终止事件必须在合并窗口结束前就被刷新
+	deadline := time.After(500 * time.Millisecond)
+	for {
+		select {
+		case body := <-flushed:
+			if strings.Contains(body, "event: message_stop") {
+				close(eventChan)
+				close(errChan)
+				if err := <-done; err != nil {
+					t.Fatalf("ProcessStreamEvents: %v", err)
+				}
+				// 首个事件 + message_delta + message_stop，第二个 delta 被合并进 message_delta 的刷新
+				if flusher.flushes > 3 {
+					t.Fatalf("expected coalesced flushes, got %d", flusher.flushes)
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatalf("message_stop was not flushed promptly")
+		}
+	}
+}
+
+func TestProcessStreamEvents_FlushCoalescingFlushesPendingAfterWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	envCfg := &config.EnvConfig{StreamFlushInterval: 20, StreamFlushMaxEvents: 100}
+	upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://example.com"}
+
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	flushed := make(chan string, 16)
+	flusher := &countingFlusher{onFlush: func() { flushed <- rec.Body.String() }}
+
+	eventChan := make(chan string)
+	errChan := make(chan error)
+	done := make(chan error, 1)
+	ctx := NewStreamContext(envCfg)
+	go func() {
+		done <- ProcessStreamEvents(c, c.Writer, flusher, eventChan, errChan, ctx, envCfg, time.Now(), nil, sch, upstream, "k1", nil, nil, "claude-3")
+	}()
+	defer func() {
+		close(eventChan)
+		close(errChan)
+		<-done
+	}()
+
+	eventChan <- "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"first\"}}\n\n"
+	eventChan <- "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"second\"}}\n\n"
+
+	// 上游空闲时，窗口内被合并的事件在窗口结束后由计时器刷新
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case body := <-flushed:
+			if strings.Contains(body, "second") {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("pending event was not flushed after the coalescing window")
+		}
+	}
+}
+
+// BenchmarkProcessStreamEvents_FlushCoalescing 对比逐事件刷新与合并刷新的 Flush 次数（flushes/op）
+func BenchmarkProcessStreamEvents_FlushCoalescing(b *testing.B) {
+	const deltaEvents = 200
+	events := make([]string, 0, deltaEvents+2)
+	for i := 0; i < deltaEvents; i++ {
+		events = append(events, fmt.Sprintf("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"t%d\"}}\n\n", i))
+	}
+	events = append(events,
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"input_tokens\":5,\"output_tokens\":200}}\n\n",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+	)
+
+	for _, interval := range []int{0, 5} {
+		b.Run(fmt.Sprintf("interval=%dms", interval), func(b *testing.B) {
+			gin.SetMode(gin.TestMode)
+			envCfg := &config.EnvConfig{StreamFlushInterval: interval, StreamFlushMaxEvents: 32}
+			upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://example.com"}
+			sch, cleanup := createTestSchedulerForStream(b)
+			defer cleanup()
+
+			flusher := &countingFlusher{}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rec := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(rec)
+				c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+				eventChan := make(chan string, len(events))
+				errChan := make(chan error)
+				for _, e := range events {
+					eventChan <- e
+				}
+				close(eventChan)
+				close(errChan)
+
+				ctx := NewStreamContext(envCfg)
+				if err := ProcessStreamEvents(c, c.Writer, flusher, eventChan, errChan, ctx, envCfg, time.Now(), nil, sch, upstream, "k1", nil, nil, "claude-3"); err != nil {
+					b.Fatalf("ProcessStreamEvents: %v", err)
+				}
+			}
+			b.ReportMetric(float64(flusher.flushes)/float64(b.N), "flushes/op")
+		})
+	}
+}
+
+// lockedBuffer 并发安全的写入缓冲（计时器 goroutine 与测试 goroutine 同时访问）
+type lockedBuffer struct {
+	mu      sync.Mutex
+	buf     strings.Builder
+	flushed string
+	flushes int
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushed = b.buf.String()
+	b.flushes++
+}
+
+func (b *lockedBuffer) snapshot() (string, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushed, b.flushes
+}
+
+func TestTimedFlushCoalescer(t *testing.T) {
+	out := &lockedBuffer{}
+	tc := NewTimedFlushCoalescer(out, out, 20*time.Millisecond, 0)
+
+	// 首个事件立即刷新，不增加首字节延迟
+	if err := tc.WriteEvent("data: {\"type\":\"response.output_text.delta\",\"delta\":\"a\"}\n\n"); err != nil {
+		t.Fatalf("WriteEvent: %v", err)
+	}
+	if flushed, n := out.snapshot(); n != 1 || !strings.Contains(flushed, `"a"`) {
+		t.Fatalf("first event not flushed immediately: flushes=%d", n)
+	}
+
+	// 窗口内事件被合并，窗口结束后由计时器刷新
+	_ = tc.WriteEvent("data: {\"type\":\"response.output_text.delta\",\"delta\":\"b\"}\n\n")
+	if _, n := out.snapshot(); n != 1 {
+		t.Fatalf("event inside window should be coalesced, flushes=%d", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if flushed, _ := out.snapshot(); strings.Contains(flushed, `"b"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending event was not flushed after the window")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 终止事件绕过合并立即刷新
+	_ = tc.WriteEvent("data: {\"type\":\"response.output_text.delta\",\"delta\":\"c\"}\n\n")
+	_ = tc.WriteEvent("event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{}}\n\n")
+	if flushed, _ := out.snapshot(); !strings.Contains(flushed, "response.completed") {
+		t.Fatalf("response.completed was not flushed immediately")
+	}
+
+	tc.Close()
+	_, before := out.snapshot()
+	_ = tc.WriteEvent("data: {\"type\":\"response.output_text.delta\",\"delta\":\"d\"}\n\n")
+	tc.Close()
+	time.Sleep(30 * time.Millisecond)
+	if _, after := out.snapshot(); after > before+1 {
+		t.Fatalf("timer should not flush after Close, flushes %d -> %d", before, after)
+	}
+}
+
+// pipeFlusher 每次 Flush 将缓冲写入管道（一次 write 系统调用），模拟真实连接的刷新开销
+type pipeFlusher struct {
+	*bufio.Writer
+}
+
+func (f pipeFlusher) Flush() { _ = f.Writer.Flush() }
+
+// BenchmarkStreamFlushThroughput 在真实管道上对比逐事件刷新与批量刷新的吞吐（events/s、syscalls/op）
+// 每次迭代写入 200 个约 120 字节的 delta 事件 + 终止事件
+func BenchmarkStreamFlushThroughput(b *testing.B) {
+	const deltaEvents = 200
+	events := make([]string, 0, deltaEvents+1)
+	for i := 0; i < deltaEvents; i++ {
+		events = append(events, fmt.Sprintf("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"token-%03d\"}}\n\n", i))
+	}
+	events = append(events, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+
+	for _, tc := range []struct {
+		name      string
+		interval  time.Duration
+		maxEvents int
+	}{
+		{"per-event", 0, 0},
+		{"batch=5ms/32", 5 * time.Millisecond, 32},
+		{"batch=20ms/0", 20 * time.Millisecond, 0},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				b.Fatalf("os.Pipe: %v", err)
+			}
+			defer r.Close()
+			go io.Copy(io.Discard, r)
+
+			bw := bufio.NewWriterSize(w, 64*1024)
+			var flusher http.Flusher = pipeFlusher{bw}
+			flushes := &countingFlusher{onFlush: flusher.Flush}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var f http.Flusher = flushes
+				var coalescer *FlushCoalescer
+				if tc.interval > 0 {
+					coalescer = NewFlushCoalescer(flushes, tc.interval, tc.maxEvents)
+					f = coalescer
+				}
+				for _, e := range events {
+					bw.WriteString(e)
+					flushStreamEvent(f, e)
+				}
+				if coalescer != nil {
+					coalescer.FlushPending()
+				}
+			}
+			b.StopTimer()
+			w.Close()
+			b.ReportMetric(float64(flushes.flushes)/float64(b.N), "syscalls/op")
+			b.ReportMetric(float64(len(events)*b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
@@ -24,7 +24,7 @@ func TestReadRequestBody_ReadErrorReturns400(t *testing.T) {
 	c.Request = httptest.NewRequest(http.MethodPost, "/x", nil)
 	c.Request.Body = io.NopCloser(failingReader{})
 
-	_, err := ReadRequestBody(c, 10)
+	_, err := ReadRequestBody(c, 10, nil)
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -52,7 +52,7 @@ func (p *fakeStreamProvider) HandleStreamResponse(body io.ReadCloser) (<-chan st
 	return eventChan, errChan, nil
 }
 
-func createTestSchedulerForStream(t *testing.T) (*scheduler.ChannelScheduler, func()) {
+func createTestSchedulerForStream(t testing.TB) (*scheduler.ChannelScheduler, func()) {
 	t.Helper()
 
 	messagesMetrics := metrics.NewMetricsManagerWithConfig(3, 0.5)
@@ -314,3 +314,78 @@ func TestSeedSynthesizerFromRequest_CoversBranches(t *testing.T) {
 		t.Fatalf("abs(1) unexpected")
 	}
 }
+
+func TestProcessStreamEvents_HeartbeatWhileUpstreamIdle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	envCfg := &config.EnvConfig{StreamHeartbeatInterval: 1}
+	requestBody := []byte(`{"model":"claude-3","messages":[{"role":"user","content":"hi"}]}`)
+	upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://example.com"}
+
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	eventChan := make(chan string)
+	errChan := make(chan error)
+	go func() {
+		// 上游首个事件延迟超过心跳间隔
+		time.Sleep(1300 * time.Millisecond)
+		eventChan <- "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+		close(eventChan)
+		close(errChan)
+	}()
+
+	ctx := NewStreamContext(envCfg)
+	err := ProcessStreamEvents(c, c.Writer, c.Writer, eventChan, errChan, ctx, envCfg, time.Now(), requestBody, sch, upstream, "k1", nil, nil, "claude-3")
+	if err != nil {
+		t.Fatalf("ProcessStreamEvents: %v", err)
+	}
+
+	out := rec.Body.String()
+	pingIdx := strings.Index(out, ": ping\n\n")
+	if pingIdx < 0 {
+		t.Fatalf("expected heartbeat comment, got: %s", out)
+	}
+	// 心跳不影响 usage 注入与 message_stop 转发
+	usageIdx := strings.Index(out, "event: message_delta")
+	stopIdx := strings.Index(out, "event: message_stop")
+	if usageIdx < 0 || stopIdx < 0 || !(pingIdx < usageIdx && usageIdx < stopIdx) {
+		t.Fatalf("unexpected event order, got: %s", out)
+	}
+	if !ctx.HasUsage {
+		t.Fatalf("expected usage to be injected")
+	}
+}
+
+func TestProcessStreamEvents_HeartbeatStopsWhenClientGone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	envCfg := &config.EnvConfig{StreamHeartbeatInterval: 1}
+	upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://example.com"}
+
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	eventChan := make(chan string)
+	errChan := make(chan error)
+	go func() {
+		time.Sleep(1300 * time.Millisecond)
+		close(eventChan)
+		close(errChan)
+	}()
+
+	ctx := NewStreamContext(envCfg)
+	ctx.ClientGone = true
+	if err := ProcessStreamEvents(c, c.Writer, c.Writer, eventChan, errChan, ctx, envCfg, time.Now(), nil, sch, upstream, "k1", nil, nil, "claude-3"); err != nil {
+		t.Fatalf("ProcessStreamEvents: %v", err)
+	}
+	if strings.Contains(rec.Body.String(), ": ping") {
+		t.Fatalf("expected no heartbeat after client disconnect, got: %s", rec.Body.String())
+	}
+}
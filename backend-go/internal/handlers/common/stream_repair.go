@@ -0,0 +1,124 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// repairEventSequence 跟踪 content block 生命周期并修复非法的 Anthropic 事件序列（STREAM_REPAIR_MODE）
+// 返回需在当前事件之前发送的合成事件，以及当前事件是否继续转发：
+//   - content_block_delta 之前缺少 content_block_start：按 delta 类型合成 start
+//   - message_delta/message_stop 时仍有未结束的 block：合成 content_block_stop
+//   - 未开始的 block 收到 content_block_stop：丢弃该事件
+func repairEventSequence(ctx *StreamContext, event string) ([]string, bool) {
+	eventType, blockIndex, blockType := extractSSEEventInfo(event)
+
+	switch eventType {
+	case "content_block_start":
+		ctx.OpenBlocks[blockIndex] = true
+
+	case "content_block_delta":
+		if ctx.OpenBlocks[blockIndex] {
+			return nil, true
+		}
+		ctx.OpenBlocks[blockIndex] = true
+		logStreamRepair(ctx, "block %d 缺少 content_block_start（delta 类型 %s），已补全", blockIndex, blockType)
+		return []string{buildContentBlockStartEvent(blockIndex, blockType)}, true
+
+	case "content_block_stop":
+		if !ctx.OpenBlocks[blockIndex] {
+			logStreamRepair(ctx, "block %d 未开始即收到 content_block_stop，已丢弃", blockIndex)
+			return nil, false
+		}
+		delete(ctx.OpenBlocks, blockIndex)
+
+	case "message_delta", "message_stop":
+		if len(ctx.OpenBlocks) == 0 {
+			return nil, true
+		}
+		indices := make([]int, 0, len(ctx.OpenBlocks))
+		for idx := range ctx.OpenBlocks {
+			indices = append(indices, idx)
+		}
+		sort.Ints(indices)
+
+		synthesized := make([]string, 0, len(indices))
+		for _, idx := range indices {
+			delete(ctx.OpenBlocks, idx)
+			logStreamRepair(ctx, "%s 前 block %d 缺少 content_block_stop，已补全", eventType, idx)
+			synthesized = append(synthesized, buildContentBlockStopEvent(idx))
+		}
+		return synthesized, true
+	}
+
+	return nil, true
+}
+
+// logStreamRepair 记录一次修复并输出带渠道/密钥的告警
+func logStreamRepair(ctx *StreamContext, format string, args ...interface{}) {
+	ctx.RepairCount++
+	log.Printf("[Messages-Stream-Repair] 警告: 渠道 %s (Key %s) 事件序列异常: %s",
+		ctx.ChannelName, utils.MaskAPIKey(ctx.APIKey), fmt.Sprintf(format, args...))
+}
+
+// writeRepairEvent 向客户端发送合成事件，并写入日志缓存
+func writeRepairEvent(w gin.ResponseWriter, flusher http.Flusher, ctx *StreamContext, event string) {
+	if ctx.LoggingEnabled {
+		ctx.LogBuffer.WriteString(event)
+		if ctx.Synthesizer != nil {
+			for _, line := range strings.Split(event, "\n") {
+				ctx.Synthesizer.ProcessLine(line)
+			}
+		}
+	}
+	if ctx.ClientGone {
+		return
+	}
+	if _, err := w.Write([]byte(event)); err != nil {
+		ctx.markClientGone()
+		return
+	}
+	flusher.Flush()
+}
+
+// buildContentBlockStartEvent 根据 delta 类型合成 content_block_start 事件
+func buildContentBlockStartEvent(index int, deltaType string) string {
+	var block map[string]interface{}
+	switch deltaType {
+	case "thinking_delta", "signature_delta":
+		block = map[string]interface{}{"type": "thinking", "thinking": ""}
+	case "input_json_delta":
+		block = map[string]interface{}{
+			"type":  "tool_use",
+			"id":    "toolu_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+			"name":  "",
+			"input": map[string]interface{}{},
+		}
+	default:
+		block = map[string]interface{}{"type": "text", "text": ""}
+	}
+
+	eventJSON, _ := json.Marshal(map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         index,
+		"content_block": block,
+	})
+	return fmt.Sprintf("event: content_block_start\ndata: %s\n\n", eventJSON)
+}
+
+// buildContentBlockStopEvent 合成 content_block_stop 事件
+func buildContentBlockStopEvent(index int) string {
+	eventJSON, _ := json.Marshal(map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": index,
+	})
+	return fmt.Sprintf("event: content_block_stop\ndata: %s\n\n", eventJSON)
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func sseEvent(eventType, data string) string {
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, data)
+}
+
+// runRepairStream 通过 HandleStreamResponse 转发事件，返回客户端收到的事件类型序列
+func runRepairStream(t *testing.T, repairMode bool, events []string) ([]string, string, int64) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(""))}
+	upstream := &config.UpstreamConfig{Name: "bad-upstream", BaseURL: "https://bad.example.com"}
+	envCfg := &config.EnvConfig{Env: "production", StreamRepairMode: repairMode}
+
+	_, _, err := HandleStreamResponse(c, resp, &fakeStreamProvider{events: events}, envCfg, time.Now(), upstream,
+		[]byte(`{"model":"claude-3","messages":[]}`), sch, "k1", nil, nil, "claude-3", "claude-3")
+	if err != nil {
+		t.Fatalf("HandleStreamResponse: %v", err)
+	}
+
+	var types []string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			types = append(types, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	var repairs int64
+	if km := sch.GetMessagesMetricsManager().GetKeyMetrics("https://bad.example.com", "k1"); km != nil {
+		repairs = km.StreamRepairs
+	}
+	return types, rec.Body.String(), repairs
+}
+
+var malformedStream = []string{
+	sseEvent("message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-3","content":[],"usage":{"input_tokens":5,"output_tokens":1}}}`),
+	sseEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`),
+	sseEvent("content_block_stop", `{"type":"content_block_stop","index":0}`),
+	sseEvent("content_block_stop", `{"type":"content_block_stop","index":0}`),
+	sseEvent("content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{}"}}`),
+	sseEvent("message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"input_tokens":5,"output_tokens":3}}`),
+	sseEvent("message_stop", `{"type":"message_stop"}`),
+}
+
+func TestStreamRepairMode_SynthesizesMissingBlockEvents(t *testing.T) {
+	types, body, repairs := runRepairStream(t, true, malformedStream)
+
+	want := []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("事件序列 = %v, want %v", types, want)
+	}
+	if !strings.Contains(body, `"content_block":{"text":"","type":"text"}`) || !strings.Contains(body, `"type":"tool_use"`) {
+		t.Fatalf("应按 delta 类型合成 content_block_start: %s", body)
+	}
+	// 补全 2 个 start、1 个 stop，丢弃 1 个多余的 stop
+	if repairs != 4 {
+		t.Fatalf("修复计数 = %d, want 4", repairs)
+	}
+}
+
+func TestStreamRepairMode_DisabledPassesThrough(t *testing.T) {
+	types, _, repairs := runRepairStream(t, false, malformedStream)
+	if len(types) != len(malformedStream) || types[1] != "content_block_delta" || repairs != 0 {
+		t.Fatalf("未启用修复模式时应原样转发: %v (repairs=%d)", types, repairs)
+	}
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/gin-gonic/gin"
+)
+
+const upstreamAttemptStartKey = "upstream_attempt_start"
+
+const streamTimingKey = "stream_timing"
+
+// StreamTiming 流式请求的时延（均从发起本次上游尝试开始计时）
+type StreamTiming struct {
+	FirstToken time.Duration // 收到首个内容事件
+	Duration   time.Duration // 流结束
+}
+
+// UpstreamAttemptStart 最近一次上游尝试的开始时间（由 RecordUpstreamAttempt 记录），未记录时返回 fallback
+// 以单次尝试而非整个请求计时，避免故障转移前其他渠道的耗时计入当前渠道
+func UpstreamAttemptStart(c *gin.Context, fallback time.Time) time.Time {
+	if v, ok := c.Get(upstreamAttemptStartKey); ok {
+		if t, ok := v.(time.Time); ok {
+			return t
+		}
+	}
+	return fallback
+}
+
+// NewStreamTiming 根据尝试开始时间与首 token 时间构造流式时延；未收到内容（firstTokenAt 为零值）时返回 false
+func NewStreamTiming(attemptStart, firstTokenAt time.Time) (StreamTiming, bool) {
+	if firstTokenAt.IsZero() {
+		return StreamTiming{}, false
+	}
+	return StreamTiming{
+		FirstToken: firstTokenAt.Sub(attemptStart),
+		Duration:   time.Since(attemptStart),
+	}, true
+}
+
+// SetStreamTiming 暂存本次流式响应的时延，供记录成功指标的调用方取用（见 RecordStreamTiming）
+func SetStreamTiming(c *gin.Context, timing StreamTiming) {
+	c.Set(streamTimingKey, timing)
+}
+
+// RecordStreamTiming 将 SetStreamTiming 暂存的流式时延写入渠道指标并清除（非流式或未收到内容时不记录）
+func RecordStreamTiming(c *gin.Context, channelScheduler *scheduler.ChannelScheduler, baseURL, apiKey string, usage *types.Usage, isResponses bool) {
+	v, ok := c.Get(streamTimingKey)
+	if !ok {
+		return
+	}
+	c.Set(streamTimingKey, nil)
+	timing, ok := v.(StreamTiming)
+	if !ok {
+		return
+	}
+	var outputTokens int
+	if usage != nil {
+		outputTokens = usage.OutputTokens
+	}
+	channelScheduler.RecordStreamTiming(baseURL, apiKey, timing.FirstToken, timing.Duration, outputTokens, isResponses)
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/providers"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpstreamAttemptStart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	fallback := time.Now().Add(-time.Minute)
+	if got := UpstreamAttemptStart(c, fallback); !got.Equal(fallback) {
+		t.Fatalf("UpstreamAttemptStart() = %v, want fallback", got)
+	}
+
+	before := time.Now()
+	RecordUpstreamAttempt(c, 0, "ch", "sk-test", &http.Response{StatusCode: 200}, nil, 300*time.Millisecond)
+	got := UpstreamAttemptStart(c, fallback)
+	if got.Before(before.Add(-300*time.Millisecond)) || got.After(time.Now().Add(-300*time.Millisecond)) {
+		t.Fatalf("UpstreamAttemptStart() = %v, want about 300ms before %v", got, before)
+	}
+}
+
+func TestRecordStreamTiming_ConsumesTiming(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	if _, ok := NewStreamTiming(time.Now(), time.Time{}); ok {
+		t.Fatalf("NewStreamTiming() without first token ok = true")
+	}
+	attemptStart := time.Now().Add(-2 * time.Second)
+	timing, ok := NewStreamTiming(attemptStart, attemptStart.Add(500*time.Millisecond))
+	if !ok || timing.FirstToken != 500*time.Millisecond || timing.Duration < 2*time.Second {
+		t.Fatalf("NewStreamTiming() = %+v, %v", timing, ok)
+	}
+
+	SetStreamTiming(c, timing)
+	RecordStreamTiming(c, sch, "https://r", "k", &types.Usage{OutputTokens: 30}, true)
+	// 已被取用，重复调用不会再次记录
+	RecordStreamTiming(c, sch, "https://r", "k", &types.Usage{OutputTokens: 30}, true)
+
+	stats := sch.GetResponsesMetricsManager().GetTimeWindowStatsForKey("https://r", "k", time.Hour)
+	if stats.StreamCount != 1 || stats.FirstTokenP50Ms != 500 || stats.TokensPerSecond <= 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestHandleStreamResponse_RecordsFirstTokenLatency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	sse := strings.Join([]string{
+		"event: message_start",
+		"data: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"claude-3\",\"content\":[],\"usage\":{\"input_tokens\":5,\"output_tokens\":1}}}",
+		"",
+		"event: content_block_delta",
+		"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"hello\"}}",
+		"",
+		"event: message_delta",
+		"data: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"input_tokens\":5,\"output_tokens\":12}}",
+		"",
+	}, "\n")
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(sse))}
+	upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://example.com"}
+
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	// 上游尝试在 200ms 前发起
+	RecordUpstreamAttempt(c, 0, "u", "k1", &http.Response{StatusCode: 200}, nil, 200*time.Millisecond)
+	if _, _, err := HandleStreamResponse(c, resp, &providers.ClaudeProvider{}, &config.EnvConfig{}, time.Now().Add(-time.Hour), upstream, nil, sch, "k1", nil, nil, "claude-3", "claude-3"); err != nil {
+		t.Fatalf("HandleStreamResponse: %v", err)
+	}
+
+	stats := sch.GetMessagesMetricsManager().GetTimeWindowStatsForKey(upstream.BaseURL, "k1", time.Hour)
+	if stats.StreamCount != 1 {
+		t.Fatalf("StreamCount = %d, want 1", stats.StreamCount)
+	}
+	// 以本次尝试开始计时，而非请求开始（1 小时前）
+	if stats.FirstTokenP50Ms < 200 || stats.FirstTokenP50Ms > 5000 {
+		t.Fatalf("FirstTokenP50Ms = %d, want measured from attempt start", stats.FirstTokenP50Ms)
+	}
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// activeStreams 进行中的流式响应（用于泄漏诊断：客户端断开后仍未结束的流会持续计入）
+var activeStreams = &streamTracker{streams: make(map[uint64]trackedStream)}
+
+// streamTracker 进行中流式响应登记表
+type streamTracker struct {
+	mu      sync.Mutex
+	nextID  uint64
+	streams map[uint64]trackedStream
+}
+
+// trackedStream 单个进行中的流
+type trackedStream struct {
+	apiType   string
+	startedAt time.Time
+}
+
+// ActiveStreamStats 进行中流式响应统计
+type ActiveStreamStats struct {
+	Count            int            `json:"count"`
+	ByAPI            map[string]int `json:"byApi"`
+	OldestStartedAt  *time.Time     `json:"oldestStartedAt,omitempty"`
+	OldestAgeSeconds float64        `json:"oldestAgeSeconds"` // 最早开始的流已持续的时间，长期增长通常意味着流 goroutine 泄漏
+}
+
+// TrackStream 登记一个进行中的流式响应，返回流结束时调用的注销函数（可重复调用）
+func TrackStream(apiType string) func() {
+	activeStreams.mu.Lock()
+	activeStreams.nextID++
+	id := activeStreams.nextID
+	activeStreams.streams[id] = trackedStream{apiType: apiType, startedAt: time.Now()}
+	activeStreams.mu.Unlock()
+
+	return func() {
+		activeStreams.mu.Lock()
+		delete(activeStreams.streams, id)
+		activeStreams.mu.Unlock()
+	}
+}
+
+// activeStreamPollInterval 等待进行中流式响应结束时的检查间隔
+const activeStreamPollInterval = 100 * time.Millisecond
+
+// WaitForActiveStreams 等待所有进行中的流式响应结束（用于关闭前排空）
+// ctx 到期时立即返回，返回值为仍未结束的流数量（0 表示已全部结束）
+func WaitForActiveStreams(ctx context.Context) int {
+	ticker := time.NewTicker(activeStreamPollInterval)
+	defer ticker.Stop()
+
+	for {
+		activeStreams.mu.Lock()
+		remaining := len(activeStreams.streams)
+		activeStreams.mu.Unlock()
+		if remaining == 0 {
+			return 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return remaining
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetActiveStreamStats 获取进行中流式响应的数量与最长持续时间
+func GetActiveStreamStats() ActiveStreamStats {
+	activeStreams.mu.Lock()
+	defer activeStreams.mu.Unlock()
+
+	stats := ActiveStreamStats{
+		Count: len(activeStreams.streams),
+		ByAPI: make(map[string]int),
+	}
+	var oldest time.Time
+	for _, s := range activeStreams.streams {
+		stats.ByAPI[s.apiType]++
+		if oldest.IsZero() || s.startedAt.Before(oldest) {
+			oldest = s.startedAt
+		}
+	}
+	if !oldest.IsZero() {
+		stats.OldestStartedAt = &oldest
+		stats.OldestAgeSeconds = time.Since(oldest).Seconds()
+	}
+	return stats
+}
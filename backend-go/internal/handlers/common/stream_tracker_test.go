@@ -0,0 +1,107 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// waitForActiveStreams 等待进行中的 messages 流数量达到 want
+func waitForActiveStreams(t *testing.T, want int) ActiveStreamStats {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := GetActiveStreamStats()
+		if stats.ByAPI["messages"] == want {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("进行中的 messages 流 = %d, want %d", stats.ByAPI["messages"], want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHandleStreamResponse_TracksActiveStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	baseline := GetActiveStreamStats().ByAPI["messages"]
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	events := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runCancelStream(t, c, &chanStreamProvider{events: events})
+	}()
+
+	events <- cancelTestEvents[0]
+	stats := waitForActiveStreams(t, baseline+1)
+	if stats.OldestStartedAt == nil || stats.OldestAgeSeconds < 0 {
+		t.Fatalf("进行中的流应报告最早开始时间: %+v", stats)
+	}
+
+	for _, e := range cancelTestEvents[1:] {
+		events <- e
+	}
+	close(events)
+	<-done
+
+	waitForActiveStreams(t, baseline)
+}
+
+func TestTrackStream_OldestAge(t *testing.T) {
+	baseline := GetActiveStreamStats().Count
+
+	doneFirst := TrackStream("responses")
+	time.Sleep(20 * time.Millisecond)
+	doneSecond := TrackStream("gemini")
+
+	stats := GetActiveStreamStats()
+	if stats.Count != baseline+2 || stats.ByAPI["responses"] < 1 || stats.ByAPI["gemini"] < 1 {
+		t.Fatalf("stats = %+v, want 2 more streams", stats)
+	}
+	if stats.OldestAgeSeconds < 0.02 {
+		t.Fatalf("oldestAgeSeconds = %.3f, want >= 0.02", stats.OldestAgeSeconds)
+	}
+
+	doneFirst()
+	doneFirst() // 重复注销不影响计数
+	doneSecond()
+	if got := GetActiveStreamStats().Count; got != baseline {
+		t.Fatalf("注销后 count = %d, want %d", got, baseline)
+	}
+}
+
+func TestWaitForActiveStreams(t *testing.T) {
+	if n := GetActiveStreamStats().Count; n != 0 {
+		t.Skipf("其他测试遗留 %d 个进行中的流", n)
+	}
+
+	done := TrackStream("drain-test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if remaining := WaitForActiveStreams(ctx); remaining != 1 {
+		t.Fatalf("超时后 remaining = %d, want 1", remaining)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		done()
+	}()
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel2()
+	start := time.Now()
+	if remaining := WaitForActiveStreams(ctx2); remaining != 0 {
+		t.Fatalf("流结束后 remaining = %d, want 0", remaining)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("流结束后应尽快返回，实际等待 %v", time.Since(start))
+	}
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+// ExtractThinkingFromEvent 从 Claude SSE 事件中提取扩展思考（thinking）文本
+// 包括 thinking_delta 增量与 content_block_start 中的初始 thinking 内容；redacted_thinking 为加密内容，不参与估算
+func ExtractThinkingFromEvent(event string, buf *bytes.Buffer) {
+	if !strings.Contains(event, "thinking") {
+		return
+	}
+	for _, line := range strings.Split(event, "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var data struct {
+			Delta *struct {
+				Type     string `json:"type"`
+				Thinking string `json:"thinking"`
+			} `json:"delta"`
+			ContentBlock *struct {
+				Type     string `json:"type"`
+				Thinking string `json:"thinking"`
+			} `json:"content_block"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data); err != nil {
+			continue
+		}
+		if data.Delta != nil && data.Delta.Type == "thinking_delta" {
+			buf.WriteString(data.Delta.Thinking)
+		}
+		if data.ContentBlock != nil && data.ContentBlock.Type == "thinking" {
+			buf.WriteString(data.ContentBlock.Thinking)
+		}
+	}
+}
+
+// EstimateThinkingTokens 估算非流式响应中 thinking 内容块的 token 数
+func EstimateThinkingTokens(content []types.ClaudeContent) int {
+	total := 0
+	for _, block := range content {
+		if block.Type != "thinking" {
+			continue
+		}
+		switch v := block.Thinking.(type) {
+		case string:
+			total += utils.EstimateTokens(v)
+		case nil:
+		default:
+			data, _ := json.Marshal(v)
+			total += utils.EstimateTokens(string(data))
+		}
+	}
+	return total
+}
+
+// ClampThinkingTokens thinking token 计入 output_tokens（按输出价格计费），上游 output_tokens 有效时不超过该值
+func ClampThinkingTokens(thinkingTokens, outputTokens int) int {
+	if outputTokens > 0 {
+		return min(thinkingTokens, outputTokens)
+	}
+	return thinkingTokens
+}
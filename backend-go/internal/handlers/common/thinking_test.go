@@ -0,0 +1,87 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func TestExtractThinkingFromEvent(t *testing.T) {
+	var buf bytes.Buffer
+	ExtractThinkingFromEvent(sseEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"Let me "}}`), &buf)
+	ExtractThinkingFromEvent(sseEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"think."}}`), &buf)
+	ExtractThinkingFromEvent(sseEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`), &buf)
+	ExtractThinkingFromEvent(sseEvent("content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"answer"}}`), &buf)
+	if buf.String() != "Let me think." {
+		t.Fatalf("thinking text = %q", buf.String())
+	}
+}
+
+func TestEstimateThinkingTokens(t *testing.T) {
+	thinking := strings.Repeat("reasoning step ", 40)
+	content := []types.ClaudeContent{
+		{Type: "thinking", Thinking: thinking, Signature: "sig"},
+		{Type: "redacted_thinking"},
+		{Type: "text", Text: "final answer"},
+	}
+	want := utils.EstimateTokens(thinking)
+	if got := EstimateThinkingTokens(content); got != want || want == 0 {
+		t.Fatalf("EstimateThinkingTokens() = %d, want %d", got, want)
+	}
+
+	if got := ClampThinkingTokens(500, 120); got != 120 {
+		t.Fatalf("ClampThinkingTokens(500, 120) = %d, want 120", got)
+	}
+	if got := ClampThinkingTokens(80, 0); got != 80 {
+		t.Fatalf("ClampThinkingTokens(80, 0) = %d, want 80", got)
+	}
+}
+
+func TestHandleStreamResponse_CollectsThinkingTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sch, cleanup := createTestSchedulerForStream(t)
+	defer cleanup()
+
+	thinking := strings.Repeat("step by step ", 30)
+	events := []string{
+		sseEvent("message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-3","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`),
+		sseEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`),
+		sseEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"`+thinking+`"}}`),
+		sseEvent("content_block_stop", `{"type":"content_block_stop","index":0}`),
+		sseEvent("content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`),
+		sseEvent("content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"done"}}`),
+		sseEvent("content_block_stop", `{"type":"content_block_stop","index":1}`),
+		sseEvent("message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":400}}`),
+		sseEvent("message_stop", `{"type":"message_stop"}`),
+	}
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(""))}
+	upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://example.com", APIKeys: []string{"k1"}}
+
+	usage, _, err := HandleStreamResponse(c, resp, &fakeStreamProvider{events: events}, &config.EnvConfig{Env: "production"}, time.Now(), upstream,
+		[]byte(`{"model":"claude-3","messages":[]}`), sch, "k1", nil, nil, "claude-3", "claude-3")
+	if err != nil {
+		t.Fatalf("HandleStreamResponse() err = %v", err)
+	}
+	if usage == nil || usage.OutputTokens != 400 {
+		t.Fatalf("usage = %+v, want output_tokens 400", usage)
+	}
+	if want := utils.EstimateTokens(thinking); usage.ThinkingTokens != want || want == 0 {
+		t.Fatalf("ThinkingTokens = %d, want %d", usage.ThinkingTokens, want)
+	}
+	if strings.Contains(rec.Body.String(), "ThinkingTokens") || strings.Contains(rec.Body.String(), "thinking_tokens") {
+		t.Fatalf("thinking token 统计不应出现在客户端响应中")
+	}
+}
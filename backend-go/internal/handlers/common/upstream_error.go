@@ -0,0 +1,55 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// UpstreamRequestIDHeader 返回给客户端的上游请求 ID（便于用户向服务商提交工单时引用）
+const UpstreamRequestIDHeader = "X-Upstream-Request-Id"
+
+// upstreamRequestIDHeaders 服务商返回请求 ID 的响应头（按优先级；Claude 为 request-id，OpenAI 为 x-request-id）
+var upstreamRequestIDHeaders = []string{"request-id", "x-request-id"}
+
+// upstreamRequestIDFields 错误响应体中可能携带请求 ID 的字段（gjson 路径，按优先级）
+var upstreamRequestIDFields = []string{"request_id", "error.request_id", "requestId", "error.requestId"}
+
+// ExtractUpstreamRequestID 从上游响应头或错误响应体中提取请求 ID（都没有时返回空字符串）
+func ExtractUpstreamRequestID(header http.Header, body []byte) string {
+	for _, name := range upstreamRequestIDHeaders {
+		if id := strings.TrimSpace(header.Get(name)); id != "" {
+			return id
+		}
+	}
+	if !gjson.ValidBytes(body) {
+		return ""
+	}
+	for _, path := range upstreamRequestIDFields {
+		if v := gjson.GetBytes(body, path); v.Type == gjson.String && v.Str != "" {
+			return v.Str
+		}
+	}
+	return ""
+}
+
+// SetUpstreamRequestIDHeader 设置 X-Upstream-Request-Id 响应头（id 为空时不设置）
+func SetUpstreamRequestIDHeader(c *gin.Context, id string) {
+	if id != "" {
+		c.Header(UpstreamRequestIDHeader, id)
+	}
+}
+
+// WriteUpstreamError 透传上游错误响应（非故障转移错误）
+// 原样保留上游的请求 ID 响应头，并通过 X-Upstream-Request-Id 统一暴露（响应头缺失时取错误体中的 request_id）
+func WriteUpstreamError(c *gin.Context, resp *http.Response, body []byte) {
+	for _, name := range upstreamRequestIDHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			c.Header(name, v)
+		}
+	}
+	SetUpstreamRequestIDHeader(c, ExtractUpstreamRequestID(resp.Header, body))
+	c.Data(resp.StatusCode, "application/json", body)
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExtractUpstreamRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   string
+	}{
+		{"Claude request-id 头", http.Header{"Request-Id": {"req_claude"}}, `{"request_id":"req_body"}`, "req_claude"},
+		{"OpenAI x-request-id 头", http.Header{"X-Request-Id": {"req_openai"}}, `{}`, "req_openai"},
+		{"错误体顶层 request_id", http.Header{}, `{"type":"error","request_id":"req_top"}`, "req_top"},
+		{"错误体嵌套 request_id", http.Header{}, `{"error":{"message":"x","request_id":"req_nested"}}`, "req_nested"},
+		{"非 JSON 错误体", http.Header{}, `upstream exploded`, ""},
+		{"无请求 ID", http.Header{}, `{"error":{"message":"x"}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractUpstreamRequestID(tt.header, []byte(tt.body)); got != tt.want {
+				t.Fatalf("ExtractUpstreamRequestID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteUpstreamError_PreservesRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	resp := &http.Response{StatusCode: http.StatusBadRequest, Header: http.Header{}}
+	resp.Header.Set("x-request-id", "req_123")
+	body := []byte(`{"error":{"message":"bad request"}}`)
+	WriteUpstreamError(c, resp, body)
+
+	if w.Code != http.StatusBadRequest || w.Body.String() != string(body) {
+		t.Fatalf("status=%d body=%s, want 400 原样透传", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("x-request-id"); got != "req_123" {
+		t.Fatalf("x-request-id = %q, want req_123", got)
+	}
+	if got := w.Header().Get(UpstreamRequestIDHeader); got != "req_123" {
+		t.Fatalf("%s = %q, want req_123", UpstreamRequestIDHeader, got)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// ReloadConfig 重新读取并校验配置文件，校验通过后原子替换内存配置；校验失败时保留旧配置并返回错误
+// POST /admin/config/reload（适用于由 Ansible 等外部工具写入配置文件后主动触发重载，与 SIGHUP 等效）
+func ReloadConfig(cfgManager *config.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := cfgManager.Reload(); err != nil {
+			log.Printf("[Config-Reload] 警告: 配置重载失败，保留当前配置: %v", err)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		cfg := cfgManager.GetConfig()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "配置已重载",
+			"channels": gin.H{
+				"messages":  len(cfg.Upstream),
+				"responses": len(cfg.ResponsesUpstream),
+				"gemini":    len(cfg.GeminiUpstream),
+			},
+		})
+	}
+}
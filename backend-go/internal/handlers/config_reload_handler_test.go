@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReloadConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cm, path := newTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "m1", BaseURL: "https://m1.example.com", APIKeys: []string{"k1"}, ServiceType: "claude"},
+		},
+		LoadBalance:          "failover",
+		ResponsesLoadBalance: "failover",
+		GeminiLoadBalance:    "failover",
+	})
+
+	r := gin.New()
+	r.POST("/admin/config/reload", ReloadConfig(cm))
+	reload := func() (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/config/reload", nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("unmarshal: %v (body=%s)", err, w.Body.String())
+		}
+		return w.Code, body
+	}
+	writeConfig := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	t.Run("valid config is swapped in", func(t *testing.T) {
+		writeConfig(`{
+			"upstream": [
+				{"name": "m1", "baseUrl": "https://m1.example.com", "apiKeys": ["k1"], "serviceType": "claude"},
+				{"name": "m2", "baseUrl": "https://m2.example.com", "apiKeys": ["k2"], "serviceType": "claude"}
+			],
+			"loadBalance": "failover"
+		}`)
+		code, body := reload()
+		if code != http.StatusOK || body["success"] != true {
+			t.Fatalf("status=%d body=%v", code, body)
+		}
+		if got := body["channels"].(map[string]interface{})["messages"]; got != float64(2) {
+			t.Fatalf("channels.messages = %v, want 2", got)
+		}
+		if got := len(cm.GetConfig().Upstream); got != 2 {
+			t.Fatalf("len(Upstream) = %d, want 2", got)
+		}
+	})
+
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{"invalid json", `{"upstream": [`},
+		{"invalid baseUrl", `{"upstream": [{"name": "bad", "baseUrl": "m3.example.com", "apiKeys": ["k3"]}]}`},
+		{"invalid load balance", `{"upstream": [], "loadBalance": "weighted"}`},
+		{"invalid timeout", `{"upstream": [{"name": "bad", "baseUrl": "https://m3.example.com", "apiKeys": ["k3"], "responseTimeout": "soon"}]}`},
+	} {
+		t.Run(tc.name+" keeps old config", func(t *testing.T) {
+			writeConfig(tc.content)
+			code, body := reload()
+			if code != http.StatusUnprocessableEntity || body["success"] != false || body["error"] == "" {
+				t.Fatalf("status=%d body=%v", code, body)
+			}
+			cfg := cm.GetConfig()
+			if len(cfg.Upstream) != 2 || cfg.Upstream[1].Name != "m2" {
+				t.Fatalf("校验失败后应保留旧配置, got %+v", cfg.Upstream)
+			}
+		})
+	}
+}
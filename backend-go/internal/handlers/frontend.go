@@ -3,6 +3,7 @@ package handlers
 import (
 	"embed"
 	"io/fs"
+	"log"
 	"net/http"
 	"strings"
 
@@ -13,11 +14,13 @@ import (
 func ServeFrontend(r *gin.Engine, frontendFS embed.FS) {
 	// 从嵌入的文件系统中提取 frontend/dist 子目录
 	distFS, err := fs.Sub(frontendFS, "frontend/dist")
+	if err == nil {
+		// 未嵌入前端构建产物时 fs.Sub 仍会成功，需检查 index.html 是否存在
+		_, err = fs.Stat(distFS, "index.html")
+	}
 	if err != nil {
-		// 如果提取失败，返回错误页面
-		r.GET("/", func(c *gin.Context) {
-			c.Data(503, "text/html; charset=utf-8", []byte(getErrorPage()))
-		})
+		log.Printf("[Frontend] 警告: 未找到嵌入的前端资源 (frontend/dist/index.html)，Web 管理界面不可用，API 端点不受影响: %v", err)
+		serveFrontendFallback(r)
 		return
 	}
 
@@ -40,11 +43,7 @@ func ServeFrontend(r *gin.Engine, frontendFS embed.FS) {
 
 		// API 路由优先处理 - 返回 JSON 格式的 404
 		if isAPIPath(path) {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error":   "API endpoint not found",
-				"path":    path,
-				"message": "请求的API端点不存在",
-			})
+			apiNotFound(c, path)
 			return
 		}
 
@@ -72,6 +71,30 @@ func ServeFrontend(r *gin.Engine, frontendFS embed.FS) {
 	})
 }
 
+// serveFrontendFallback 前端资源缺失时的降级处理：
+// 非 API 路径返回说明页面（503），API 路径保持 JSON 404，已注册的 API 路由不受影响
+func serveFrontendFallback(r *gin.Engine) {
+	r.GET("/", func(c *gin.Context) {
+		c.Data(http.StatusServiceUnavailable, "text/html; charset=utf-8", []byte(getErrorPage()))
+	})
+	r.NoRoute(func(c *gin.Context) {
+		if path := c.Request.URL.Path; isAPIPath(path) {
+			apiNotFound(c, path)
+			return
+		}
+		c.Data(http.StatusServiceUnavailable, "text/html; charset=utf-8", []byte(getErrorPage()))
+	})
+}
+
+// apiNotFound 返回 JSON 格式的 API 404
+func apiNotFound(c *gin.Context, path string) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error":   "API endpoint not found",
+		"path":    path,
+		"message": "请求的API端点不存在",
+	})
+}
+
 // isAPIPath 检查路径是否为 API 端点
 func isAPIPath(path string) bool {
 	// API 路由前缀列表
@@ -162,6 +185,7 @@ func getErrorPage() string {
     <h3>方案2: 禁用Web界面</h3>
     <p>在 <code>.env</code> 文件中设置: <code>ENABLE_WEB_UI=false</code></p>
     <p>然后只使用API端点: <code>/v1/messages</code></p>
+    <p>当前仅 Web 管理界面不可用，代理端点（<code>/v1/*</code>）与管理 API（<code>/api/*</code>）仍可正常使用。</p>
   </div>
 </body>
 </html>`
@@ -175,3 +175,44 @@ func TestGetContentType_AllKnownExtensions(t *testing.T) {
 		}
 	}
 }
+
+func TestServeFrontend_EmptyFSFallbackKeepsAPIWorking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var empty embed.FS
+	r := gin.New()
+	r.GET("/api/ping", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	r.POST("/v1/messages", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"proxied": true}) })
+	ServeFrontend(r, empty)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// 非 API 路径（根路径、SPA 路由、静态资源）返回说明页面
+	for _, path := range []string{"/", "/dashboard/channels", "/assets/app.js"} {
+		w := serve(http.MethodGet, path)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("%s: status=%d body=%s", path, w.Code, w.Body.String())
+		}
+		if body := w.Body.String(); !strings.Contains(body, "前端资源未找到") || !strings.Contains(body, "/api/*") {
+			t.Fatalf("%s: unexpected fallback page: %s", path, body)
+		}
+	}
+
+	// 已注册的 API 正常工作
+	if w := serve(http.MethodGet, "/api/ping"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ok":true`) {
+		t.Fatalf("api ping status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodPost, "/v1/messages"); w.Code != http.StatusOK {
+		t.Fatalf("proxy status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	// 未知 API 仍返回 JSON 404 而非 HTML
+	w := serve(http.MethodGet, "/api/unknown")
+	if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("unknown api status=%d content-type=%q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
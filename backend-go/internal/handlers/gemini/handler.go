@@ -21,7 +21,6 @@ import (
 	"github.com/BenedictKing/claude-proxy/internal/types"
 	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type requestLogContext struct {
@@ -112,8 +111,21 @@ func (h *Handler) Handle(c *gin.Context) {
 		}
 	}
 
+	// 请求级日志级别（X-Proxy-Log-Level），仅影响本次请求
+	envCfg = common.RequestEnvConfig(c, envCfg)
+
+	// 维护模式：直接返回 503，不进入渠道故障转移
+	if !common.CheckMaintenance(c) {
+		return
+	}
+
 	startTime := time.Now()
-	requestID := uuid.New().String()
+	requestID := middleware.GetRequestID(c)
+
+	// 请求诊断（X-Proxy-Debug），通过 Trailer 返回
+	if common.StartDiagnostics(c) != nil {
+		defer common.WriteDiagnosticsTrailer(c)
+	}
 
 	reqCtx := &requestLogContext{
 		requestID:          requestID,
@@ -126,6 +138,9 @@ func (h *Handler) Handle(c *gin.Context) {
 		defer h.liveRequestManager.EndRequest(requestID)
 	}
 
+	// 请求结束后上报 usage，供限流中间件计入 token 预算
+	defer func() { middleware.ReportUsage(c, reqCtx.usage) }()
+
 	defer func() {
 		if h.sqliteStore == nil {
 			return
@@ -175,8 +190,8 @@ func (h *Handler) Handle(c *gin.Context) {
 	}()
 
 	// 读取原始请求体
-	maxBodySize := envCfg.MaxRequestBodySize
-	bodyBytes, err := common.ReadRequestBody(c, maxBodySize)
+	maxBodySize := cfgManager.GetRequestBodyReadLimit(envCfg.MaxRequestBodySize)
+	bodyBytes, err := common.ReadRequestBody(c, maxBodySize, channelScheduler.GetGeminiMetricsManager())
 	if err != nil {
 		reqCtx.success = false
 		reqCtx.errorMsg = truncateErrorMessage(err.Error())
@@ -284,13 +299,42 @@ func handleMultiChannel(
 	reqCtx *requestLogContext,
 ) {
 	failedChannels := make(map[int]bool)
+	// 主渠道：本次请求首个选中的渠道，故障转移后成功时与其比较成本
+	primaryIndex := -1
+	var primaryUpstream *config.UpstreamConfig
 	var lastError error
 	var lastFailoverError *common.FailoverError
+	failoverDelay := common.NewChannelFailoverDelay(c, envCfg, "Gemini")
 
 	maxChannelAttempts := channelScheduler.GetActiveGeminiChannelCount()
 
+	selectionCtx := common.BuildSelectionContext(c, cfgManager, model)
+	selectionCtx = scheduler.WithRequestBodySize(selectionCtx, int64(len(bodyBytes)), envCfg.MaxRequestBodySize)
+	selectionCtx = scheduler.WithTokenEstimator(selectionCtx, func() (int, int) {
+		maxOutputTokens := 0
+		if geminiReq.GenerationConfig != nil {
+			maxOutputTokens = geminiReq.GenerationConfig.MaxOutputTokens
+		}
+		return utils.EstimateTokens(string(bodyBytes)), maxOutputTokens
+	})
 	for channelAttempt := 0; channelAttempt < maxChannelAttempts; channelAttempt++ {
-		selection, err := channelScheduler.SelectGeminiChannel(c.Request.Context(), userID, failedChannels)
+		// 渠道级故障转移同样消耗全局重试预算，预算耗尽时直接返回最后一次失败
+		if channelAttempt > 0 && !channelScheduler.AllowRetry() {
+			log.Printf("[Gemini-RetryBudget] 警告: 全局重试预算已耗尽，停止渠道故障转移 (已尝试 %d 个渠道)", channelAttempt)
+			if lastError == nil {
+				lastError = fmt.Errorf("retry budget exhausted")
+			}
+			break
+		}
+		if common.FailoverSlotDenied(c) {
+			log.Printf("[Gemini-FailoverLimit] 警告: 全局故障转移并发已满，停止渠道故障转移 (已尝试 %d 个渠道)", channelAttempt)
+			break
+		}
+		if !failoverDelay.BeginChannel() {
+			lastError = fmt.Errorf("client disconnected during failover delay")
+			break
+		}
+		selection, err := channelScheduler.SelectGeminiChannel(selectionCtx, userID, failedChannels)
 		if err != nil {
 			lastError = err
 			break
@@ -298,6 +342,9 @@ func handleMultiChannel(
 
 		upstream := selection.Upstream
 		channelIndex := selection.ChannelIndex
+		if primaryUpstream == nil {
+			primaryIndex, primaryUpstream = channelIndex, upstream
+		}
 		if reqCtx != nil {
 			reqCtx.channelIndex = channelIndex
 			reqCtx.channelName = upstream.Name
@@ -331,10 +378,12 @@ func handleMultiChannel(
 				reqCtx.errorMsg = ""
 			}
 			channelScheduler.SetTraceAffinity(userID, channelIndex)
+			channelScheduler.RecordFailoverCost("gemini", primaryIndex, primaryUpstream, channelIndex, upstream, model, usage)
 			return
 		}
 
 		failedChannels[channelIndex] = true
+		failoverDelay.ChannelFailed()
 
 		if failoverErr != nil {
 			lastFailoverError = failoverErr
@@ -374,6 +423,8 @@ func tryChannelWithAllKeys(
 	if len(upstream.APIKeys) == 0 {
 		return false, "", 0, nil, nil
 	}
+	// 渠道日志采样：未命中时本次请求在该渠道上不记录请求/响应体
+	envCfg = common.ChannelEnvConfig(c, envCfg, upstream)
 
 	metricsManager := channelScheduler.GetGeminiMetricsManager()
 	baseURLs := upstream.GetAllBaseURLs()
@@ -382,6 +433,7 @@ func tryChannelWithAllKeys(
 	sortedURLResults := channelScheduler.GetSortedURLsForChannel(channelIndex, baseURLs)
 
 	var lastFailoverError *common.FailoverError
+	sentAttempts := 0
 	deprioritizeCandidates := make(map[string]bool)
 
 	// 强制探测模式
@@ -430,7 +482,23 @@ func tryChannelWithAllKeys(
 				continue
 			}
 
-			resp, err := common.SendRequest(providerReq, upstream, envCfg, isStream)
+			// 同一渠道内的 Key/BaseURL 重试受全局重试预算限制
+			if sentAttempts > 0 && !channelScheduler.AllowRetry() {
+				log.Printf("[Gemini-RetryBudget] 警告: 全局重试预算已耗尽，停止渠道 %s 内的重试", upstream.Name)
+				return false, "", 0, lastFailoverError, nil
+			}
+			// 故障转移尝试受全局并发上限限制，避免上游大面积故障时的惊群
+			releaseSlot, ok := common.AcquireFailoverSlot(c, channelScheduler)
+			if !ok {
+				log.Printf("[Gemini-FailoverLimit] 警告: 全局故障转移并发已满，停止渠道 %s 内的重试", upstream.Name)
+				return false, "", 0, lastFailoverError, nil
+			}
+			sentAttempts++
+
+			attemptStart := time.Now()
+			resp, err := common.SendRequestForModel(providerReq, upstream, envCfg, isStream, model)
+			releaseSlot()
+			common.RecordUpstreamAttempt(c, channelIndex, upstream.Name, apiKey, resp, err, time.Since(attemptStart))
 			if err != nil {
 				failedKeys[apiKey] = true
 				cfgManager.MarkKeyAsFailed(apiKey)
@@ -445,7 +513,7 @@ func tryChannelWithAllKeys(
 				resp.Body.Close()
 				respBodyBytes = utils.DecompressGzipIfNeeded(resp, respBodyBytes)
 
-				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKey(resp.StatusCode, respBodyBytes, cfgManager.GetFuzzyModeEnabled())
+				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKeyForChannel(upstream, resp.StatusCode, respBodyBytes, common.EffectiveFuzzyMode(c, cfgManager))
 				if shouldFailover {
 					failedKeys[apiKey] = true
 					cfgManager.MarkKeyAsFailed(apiKey)
@@ -454,8 +522,9 @@ func tryChannelWithAllKeys(
 					log.Printf("[Gemini-Key] 警告: API密钥失败 (状态: %d)，尝试下一个密钥", resp.StatusCode)
 
 					lastFailoverError = &common.FailoverError{
-						Status: resp.StatusCode,
-						Body:   respBodyBytes,
+						Status:    resp.StatusCode,
+						Body:      respBodyBytes,
+						RequestID: common.ExtractUpstreamRequestID(resp.Header, respBodyBytes),
 					}
 
 					if isQuotaRelated {
@@ -466,14 +535,43 @@ func tryChannelWithAllKeys(
 
 				// 非 failover 错误
 				channelScheduler.RecordGeminiFailure(currentBaseURL, apiKey)
+				channelScheduler.RecordChannelResult("gemini", channelIndex, upstream, true)
 				if reqCtx != nil {
 					reqCtx.success = false
 					reqCtx.errorMsg = truncateErrorMessage(string(respBodyBytes))
 				}
-				c.Data(resp.StatusCode, "application/json", respBodyBytes)
+				common.WriteUpstreamError(c, resp, respBodyBytes)
 				return true, "", 0, nil, nil
 			}
 
+			// 捕获账号/组织标识（仅首次成功响应），并记录响应延迟（用于 adaptive 密钥选择）
+			channelScheduler.RecordGeminiAccountHint(currentBaseURL, apiKey, resp.Header)
+			channelScheduler.RecordGeminiKeyLatency(currentBaseURL, apiKey, time.Since(attemptStart))
+
+			// 非流式响应按渠道配置的 JSON Schema 校验，不符合时视为失败（尚未向客户端写入任何数据，可安全故障转移）
+			if !isStream {
+				if err := common.ValidateResponseSchema(resp, upstream); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordGeminiFailure(currentBaseURL, apiKey)
+					log.Printf("[Gemini-Schema] 警告: 响应未通过 JSON Schema 校验: %v，尝试下一个密钥", err)
+					lastFailoverError = common.NewSchemaFailoverError(err)
+					continue
+				}
+			}
+
+			// 上游以 2xx 返回错误结构响应体（如 {"error":{...}}）时视为失败（ERROR_BODY_FAILOVER，流式只检测首个事件）
+			if envCfg.ErrorBodyFailover {
+				if err := common.DetectErrorShapedResponse(resp, isStream); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordGeminiFailure(currentBaseURL, apiKey)
+					log.Printf("[Gemini-ErrorBody] 警告: 渠道 %s 密钥 %s 返回错误结构响应体: %v，尝试下一个密钥", upstream.Name, utils.MaskAPIKey(apiKey), err)
+					lastFailoverError = common.NewErrorBodyFailoverError(err)
+					continue
+				}
+			}
+
 			if len(deprioritizeCandidates) > 0 {
 				for key := range deprioritizeCandidates {
 					_ = cfgManager.DeprioritizeAPIKey(key)
@@ -481,6 +579,7 @@ func tryChannelWithAllKeys(
 			}
 
 			channelScheduler.MarkURLSuccess(channelIndex, currentBaseURL)
+			channelScheduler.RecordChannelResult("gemini", channelIndex, upstream, false)
 
 			usage := handleSuccess(c, resp, upstream.ServiceType, envCfg, startTime, geminiReq, model, isStream)
 			if reqCtx != nil {
@@ -528,6 +627,15 @@ func handleSingleChannel(
 		return
 	}
 
+	if tooLargeErr := common.CheckChannelRequestBodySize(upstream, bodyBytes, envCfg.MaxRequestBodySize); tooLargeErr != nil {
+		if reqCtx != nil {
+			reqCtx.success = false
+			reqCtx.errorMsg = truncateErrorMessage(tooLargeErr.Error())
+		}
+		respondGeminiRequestTooLarge(c, tooLargeErr)
+		return
+	}
+
 	if len(upstream.APIKeys) == 0 {
 		if reqCtx != nil {
 			reqCtx.channelIndex = 0
@@ -554,6 +662,8 @@ func handleSingleChannel(
 		reqCtx.channelName = upstream.Name
 		reqCtx.updateLive()
 	}
+	// 渠道日志采样：未命中时本次请求在该渠道上不记录请求/响应体
+	envCfg = common.ChannelEnvConfig(c, envCfg, upstream)
 
 	var lastError error
 	var lastFailoverError *common.FailoverError
@@ -601,7 +711,9 @@ func handleSingleChannel(
 				continue
 			}
 
-			resp, err := common.SendRequest(providerReq, upstream, envCfg, isStream)
+			attemptStart := time.Now()
+			resp, err := common.SendRequestForModel(providerReq, upstream, envCfg, isStream, model)
+			common.RecordUpstreamAttempt(c, 0, upstream.Name, apiKey, resp, err, time.Since(attemptStart))
 			if err != nil {
 				lastError = err
 				failedKeys[apiKey] = true
@@ -616,7 +728,7 @@ func handleSingleChannel(
 				resp.Body.Close()
 				respBodyBytes = utils.DecompressGzipIfNeeded(resp, respBodyBytes)
 
-				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKey(resp.StatusCode, respBodyBytes, cfgManager.GetFuzzyModeEnabled())
+				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKeyForChannel(upstream, resp.StatusCode, respBodyBytes, common.EffectiveFuzzyMode(c, cfgManager))
 				if shouldFailover {
 					lastError = fmt.Errorf("上游错误: %d", resp.StatusCode)
 					failedKeys[apiKey] = true
@@ -625,8 +737,9 @@ func handleSingleChannel(
 					log.Printf("[Gemini-Key] 警告: API密钥失败 (状态: %d)，尝试下一个密钥", resp.StatusCode)
 
 					lastFailoverError = &common.FailoverError{
-						Status: resp.StatusCode,
-						Body:   respBodyBytes,
+						Status:    resp.StatusCode,
+						Body:      respBodyBytes,
+						RequestID: common.ExtractUpstreamRequestID(resp.Header, respBodyBytes),
 					}
 
 					if isQuotaRelated {
@@ -640,10 +753,38 @@ func handleSingleChannel(
 					reqCtx.success = false
 					reqCtx.errorMsg = truncateErrorMessage(string(respBodyBytes))
 				}
-				c.Data(resp.StatusCode, "application/json", respBodyBytes)
+				common.WriteUpstreamError(c, resp, respBodyBytes)
 				return
 			}
 
+			// 捕获账号/组织标识（仅首次成功响应），并记录响应延迟（用于 adaptive 密钥选择）
+			channelScheduler.RecordGeminiAccountHint(currentBaseURL, apiKey, resp.Header)
+			channelScheduler.RecordGeminiKeyLatency(currentBaseURL, apiKey, time.Since(attemptStart))
+
+			// 非流式响应按渠道配置的 JSON Schema 校验，不符合时视为失败（尚未向客户端写入任何数据，可安全故障转移）
+			if !isStream {
+				if err := common.ValidateResponseSchema(resp, upstream); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordGeminiFailure(currentBaseURL, apiKey)
+					log.Printf("[Gemini-Schema] 警告: 响应未通过 JSON Schema 校验: %v，尝试下一个密钥", err)
+					lastFailoverError = common.NewSchemaFailoverError(err)
+					continue
+				}
+			}
+
+			// 上游以 2xx 返回错误结构响应体（如 {"error":{...}}）时视为失败（ERROR_BODY_FAILOVER，流式只检测首个事件）
+			if envCfg.ErrorBodyFailover {
+				if err := common.DetectErrorShapedResponse(resp, isStream); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordGeminiFailure(currentBaseURL, apiKey)
+					log.Printf("[Gemini-ErrorBody] 警告: 渠道 %s 密钥 %s 返回错误结构响应体: %v，尝试下一个密钥", upstream.Name, utils.MaskAPIKey(apiKey), err)
+					lastFailoverError = common.NewErrorBodyFailoverError(err)
+					continue
+				}
+			}
+
 			if len(deprioritizeCandidates) > 0 {
 				for key := range deprioritizeCandidates {
 					_ = cfgManager.DeprioritizeAPIKey(key)
@@ -773,6 +914,7 @@ func buildProviderRequest(
 	default:
 		utils.SetGeminiAuthenticationHeader(req.Header, apiKey)
 	}
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
 
 	return req, nil
 }
@@ -791,7 +933,7 @@ func handleSuccess(
 	defer resp.Body.Close()
 
 	if isStream {
-		return handleStreamSuccess(c, resp, upstreamType, envCfg, startTime, model)
+		return handleStreamSuccess(c, resp, upstreamType, envCfg, startTime, geminiReq, model)
 	}
 
 	// 非流式响应处理
@@ -862,23 +1004,31 @@ func handleSuccess(
 		return nil
 	}
 
-	c.Data(resp.StatusCode, "application/json", respBytes)
+	common.WriteResponseBody(c, envCfg, resp.StatusCode, "application/json", respBytes)
 
-	// 提取 usage 统计
-	var usage *types.Usage
-	if geminiResp.UsageMetadata != nil {
-		usage = &types.Usage{
-			InputTokens:  geminiResp.UsageMetadata.PromptTokenCount - geminiResp.UsageMetadata.CachedContentTokenCount,
-			OutputTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
-		}
-	}
-
-	return usage
+	// 提取 usage 统计（与 Claude usage 口径一致：扣除缓存命中、推理 tokens 计入输出）
+	return converters.GeminiUsageToClaude(geminiResp.UsageMetadata)
 }
 
 // handleAllChannelsFailed 处理所有渠道失败的情况
 func handleAllChannelsFailed(c *gin.Context, failoverErr *common.FailoverError, lastError error) {
+	if _, ok := scheduler.AsNoChannelForModelError(lastError); ok {
+		c.JSON(http.StatusNotFound, types.GeminiError{
+			Error: types.GeminiErrorDetail{
+				Code:    http.StatusNotFound,
+				Message: lastError.Error(),
+				Status:  "NOT_FOUND",
+			},
+		})
+		return
+	}
+	if tooLargeErr, ok := scheduler.AsRequestTooLargeError(lastError); ok {
+		respondGeminiRequestTooLarge(c, tooLargeErr)
+		return
+	}
+
 	if failoverErr != nil {
+		common.SetUpstreamRequestIDHeader(c, failoverErr.RequestID)
 		c.Data(failoverErr.Status, "application/json", failoverErr.Body)
 		return
 	}
@@ -897,9 +1047,21 @@ func handleAllChannelsFailed(c *gin.Context, failoverErr *common.FailoverError,
 	})
 }
 
+// respondGeminiRequestTooLarge 返回请求体超过渠道上限错误（Gemini 错误格式）
+func respondGeminiRequestTooLarge(c *gin.Context, err *scheduler.RequestTooLargeError) {
+	c.JSON(http.StatusRequestEntityTooLarge, types.GeminiError{
+		Error: types.GeminiErrorDetail{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: err.Error(),
+			Status:  "INVALID_ARGUMENT",
+		},
+	})
+}
+
 // handleAllKeysFailed 处理所有 Key 失败的情况
 func handleAllKeysFailed(c *gin.Context, failoverErr *common.FailoverError, lastError error) {
 	if failoverErr != nil {
+		common.SetUpstreamRequestIDHeader(c, failoverErr.RequestID)
 		c.Data(failoverErr.Status, "application/json", failoverErr.Body)
 		return
 	}
@@ -331,7 +331,7 @@ func TestStreamConversionHelpers(t *testing.T) {
 		"",
 	}, "\n")
 	respClaude := &http.Response{Body: io.NopCloser(strings.NewReader(claudeBody)), Header: make(http.Header), StatusCode: http.StatusOK}
-	usageClaude := handleStreamSuccess(ctx, respClaude, "claude", envCfg, time.Now(), "gemini-pro")
+	usageClaude := handleStreamSuccess(ctx, respClaude, "claude", envCfg, time.Now(), nil, "gemini-pro")
 	if usageClaude == nil || usageClaude.InputTokens != 2 || usageClaude.OutputTokens != 3 {
 		t.Fatalf("unexpected usage: %+v", usageClaude)
 	}
@@ -347,7 +347,7 @@ func TestStreamConversionHelpers(t *testing.T) {
 	ctx2, _ := gin.CreateTestContext(httptest.NewRecorder())
 	ctx2.Request = httptest.NewRequest(http.MethodPost, "/v1beta/models/x:streamGenerateContent", nil)
 	respOpenAI := &http.Response{Body: io.NopCloser(strings.NewReader(openaiBody)), Header: make(http.Header), StatusCode: http.StatusOK}
-	usageOpenAI := handleStreamSuccess(ctx2, respOpenAI, "openai", envCfg, time.Now(), "gemini-pro")
+	usageOpenAI := handleStreamSuccess(ctx2, respOpenAI, "openai", envCfg, time.Now(), nil, "gemini-pro")
 	if usageOpenAI == nil || usageOpenAI.InputTokens != 2 || usageOpenAI.OutputTokens != 3 {
 		t.Fatalf("unexpected usage: %+v", usageOpenAI)
 	}
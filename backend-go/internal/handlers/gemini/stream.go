@@ -10,7 +10,10 @@ import (
 	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/converters"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
 	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,8 +24,11 @@ func handleStreamSuccess(
 	upstreamType string,
 	envCfg *config.EnvConfig,
 	startTime time.Time,
+	geminiReq *types.GeminiRequest,
 	model string,
 ) *types.Usage {
+	defer common.TrackStream("gemini")()
+
 	// 设置 SSE 响应头
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
@@ -38,14 +44,14 @@ func handleStreamSuccess(
 
 	switch upstreamType {
 	case "gemini":
-		totalUsage = streamGeminiToGemini(c, resp, flusher, envCfg)
+		totalUsage = streamGeminiToGemini(c, resp, flusher, envCfg, geminiReq)
 	case "claude":
 		totalUsage = streamClaudeToGemini(c, resp, flusher, envCfg, model)
 	case "openai":
 		totalUsage = streamOpenAIToGemini(c, resp, flusher, envCfg, model)
 	default:
 		// 默认透传
-		totalUsage = streamGeminiToGemini(c, resp, flusher, envCfg)
+		totalUsage = streamGeminiToGemini(c, resp, flusher, envCfg, geminiReq)
 	}
 
 	if envCfg.EnableResponseLogs {
@@ -57,31 +63,48 @@ func handleStreamSuccess(
 }
 
 // streamGeminiToGemini Gemini 上游直接透传
+// 透传的同时解析 usageMetadata（与 Claude usage 口径一致），并累积文本与 functionCall 参数，
+// 供上游缺失 usage 时估算 token 及开发模式下合成日志
 func streamGeminiToGemini(
 	c *gin.Context,
 	resp *http.Response,
 	flusher http.Flusher,
 	envCfg *config.EnvConfig,
+	geminiReq *types.GeminiRequest,
 ) *types.Usage {
 	scanner := bufio.NewScanner(resp.Body)
 	scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // 1MB buffer
 
 	var totalUsage *types.Usage
+	var outputText strings.Builder
+	const maxOutputTextSize = 1024 * 1024 // 1MB 上限，防止内存溢出
+
+	var synthesizer *utils.StreamSynthesizer
+	if envCfg.IsDevelopment() && envCfg.EnableResponseLogs {
+		synthesizer = utils.NewStreamSynthesizer("gemini")
+	}
 
 	for scanner.Scan() {
 		line := scanner.Text()
+		if synthesizer != nil {
+			synthesizer.ProcessLine(line)
+		}
 
 		// 直接转发 SSE 数据
 		if strings.HasPrefix(line, "data: ") {
 			jsonData := strings.TrimPrefix(line, "data: ")
 
-			// 尝试解析 usage
+			// 尝试解析 usage 与输出内容（usageMetadata 为累计值，取最后一次）
 			var chunk types.GeminiStreamChunk
 			if err := json.Unmarshal([]byte(jsonData), &chunk); err == nil {
 				if chunk.UsageMetadata != nil {
-					totalUsage = &types.Usage{
-						InputTokens:  chunk.UsageMetadata.PromptTokenCount - chunk.UsageMetadata.CachedContentTokenCount,
-						OutputTokens: chunk.UsageMetadata.CandidatesTokenCount,
+					totalUsage = converters.GeminiUsageToClaude(chunk.UsageMetadata)
+				}
+				if outputText.Len() < maxOutputTextSize {
+					for _, candidate := range chunk.Candidates {
+						if candidate.Content != nil {
+							outputText.WriteString(utils.GeminiPartsText(candidate.Content.Parts))
+						}
 					}
 				}
 			}
@@ -98,7 +121,37 @@ func streamGeminiToGemini(
 		}
 	}
 
-	return totalUsage
+	if synthesizer != nil {
+		if content := synthesizer.GetSynthesizedContent(); content != "" && !synthesizer.IsParseFailed() {
+			log.Printf("[Gemini-Stream] 上游流式响应合成内容:\n%s", strings.TrimSpace(content))
+		}
+	}
+
+	return patchGeminiStreamUsage(totalUsage, geminiReq, outputText.String(), envCfg)
+}
+
+// patchGeminiStreamUsage 上游未返回 usageMetadata 或计数为 0 时，按请求与输出内容（含 functionCall 参数）本地估算
+// 流中既无 usage 也无输出内容时返回 nil
+func patchGeminiStreamUsage(usage *types.Usage, geminiReq *types.GeminiRequest, outputText string, envCfg *config.EnvConfig) *types.Usage {
+	if usage == nil {
+		if outputText == "" {
+			return nil
+		}
+		usage = &types.Usage{}
+	}
+	patched := false
+	if usage.InputTokens == 0 && usage.CacheReadInputTokens == 0 && geminiReq != nil {
+		usage.InputTokens = utils.EstimateGeminiRequestTokens(geminiReq)
+		patched = true
+	}
+	if usage.OutputTokens == 0 && outputText != "" {
+		usage.OutputTokens = utils.EstimateTokens(outputText)
+		patched = true
+	}
+	if patched && envCfg.EnableResponseLogs && envCfg.ShouldLog("debug") {
+		log.Printf("[Gemini-Stream-Token] 上游 usageMetadata 缺失或为 0, 使用本地估算: input=%d, output=%d", usage.InputTokens, usage.OutputTokens)
+	}
+	return usage
 }
 
 // streamClaudeToGemini Claude 流式响应转换为 Gemini 格式
@@ -29,7 +29,7 @@ func TestHandleStreamSuccess_DefaultUpstreamTypeFallsBackToGemini(t *testing.T)
 		}, "\n"))),
 	}
 
-	usage := handleStreamSuccess(c, resp, "unknown", envCfg, time.Now(), "gemini-pro")
+	usage := handleStreamSuccess(c, resp, "unknown", envCfg, time.Now(), nil, "gemini-pro")
 	if usage == nil || usage.InputTokens == 0 || usage.OutputTokens == 0 {
 		t.Fatalf("unexpected usage=%+v", usage)
 	}
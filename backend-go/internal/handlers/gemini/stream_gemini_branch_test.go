@@ -4,10 +4,13 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,7 +28,7 @@ func TestStreamGeminiToGemini_ForwardsNonDataLinesAndInvalidJSON(t *testing.T) {
 		}, "\n"))),
 	}
 
-	usage := streamGeminiToGemini(c, resp, nil, &config.EnvConfig{})
+	usage := streamGeminiToGemini(c, resp, nil, &config.EnvConfig{}, nil)
 	if usage != nil {
 		t.Fatalf("usage=%+v, want nil", usage)
 	}
@@ -34,3 +37,82 @@ func TestStreamGeminiToGemini_ForwardsNonDataLinesAndInvalidJSON(t *testing.T) {
 	}
 }
 
+// recordedGeminiToolStream 录制的 Gemini streamGenerateContent（alt=sse）工具调用流：
+// 文本 + 两个并行 functionCall，最后一个块携带 usageMetadata（含缓存命中与推理 tokens）
+var recordedGeminiToolStream = []string{
+	`data: {"candidates":[{"content":{"parts":[{"text":"I'll check the weather and the time."}],"role":"model"},"index":0}],"usageMetadata":{"promptTokenCount":120,"totalTokenCount":120},"modelVersion":"gemini-2.5-flash"}`,
+	"",
+	`data: {"candidates":[{"content":{"parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris","unit":"celsius"}}},{"functionCall":{"name":"get_time","args":{"timezone":"Europe/Paris"}}}],"role":"model"},"index":0}],"usageMetadata":{"promptTokenCount":120,"totalTokenCount":120},"modelVersion":"gemini-2.5-flash"}`,
+	"",
+	`data: {"candidates":[{"content":{"parts":[{"text":""}],"role":"model"},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":120,"candidatesTokenCount":38,"totalTokenCount":188,"cachedContentTokenCount":80,"thoughtsTokenCount":30},"modelVersion":"gemini-2.5-flash"}`,
+	"",
+}
+
+func geminiToolRequest() *types.GeminiRequest {
+	return &types.GeminiRequest{
+		Contents: []types.GeminiContent{{Role: "user", Parts: []types.GeminiPart{{Text: "What's the weather and local time in Paris?"}}}},
+		Tools: []types.GeminiTool{{FunctionDeclarations: []types.GeminiFunctionDeclaration{
+			{Name: "get_weather", Description: "Get the weather for a city", Parameters: map[string]interface{}{"type": "object"}},
+			{Name: "get_time", Description: "Get the local time for a timezone", Parameters: map[string]interface{}{"type": "object"}},
+		}}},
+	}
+}
+
+func TestStreamGeminiToGemini_ToolCallingStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	withoutUsage := make([]string, 0, len(recordedGeminiToolStream))
+	for _, line := range recordedGeminiToolStream {
+		withoutUsage = append(withoutUsage, regexp.MustCompile(`,"usageMetadata":\{[^}]*\}`).ReplaceAllString(line, ""))
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		check func(t *testing.T, usage *types.Usage)
+	}{
+		{
+			name:  "usageMetadata parsed like Claude usage",
+			lines: recordedGeminiToolStream,
+			check: func(t *testing.T, usage *types.Usage) {
+				want := types.Usage{InputTokens: 40, OutputTokens: 68, CacheReadInputTokens: 80, ThinkingTokens: 30}
+				if usage == nil || *usage != want {
+					t.Fatalf("usage=%+v, want %+v", usage, want)
+				}
+			},
+		},
+		{
+			name:  "missing usageMetadata estimated from text and functionCall args",
+			lines: withoutUsage,
+			check: func(t *testing.T, usage *types.Usage) {
+				if usage == nil {
+					t.Fatalf("usage=nil, want estimated usage")
+				}
+				textOnly := utils.EstimateTokens("I'll check the weather and the time.")
+				if usage.OutputTokens <= textOnly {
+					t.Fatalf("output tokens=%d should include functionCall args (text only=%d)", usage.OutputTokens, textOnly)
+				}
+				if want := utils.EstimateGeminiRequestTokens(geminiToolRequest()); usage.InputTokens != want {
+					t.Fatalf("input tokens=%d, want %d", usage.InputTokens, want)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			resp := &http.Response{Body: io.NopCloser(strings.NewReader(strings.Join(tt.lines, "\n")))}
+
+			envCfg := &config.EnvConfig{Env: "development", EnableResponseLogs: true, LogLevel: "debug"}
+			usage := streamGeminiToGemini(c, resp, nil, envCfg, geminiToolRequest())
+			tt.check(t, usage)
+
+			// 透传内容保持不变
+			if got, want := rec.Body.String(), strings.Join(tt.lines, "\n"); got != want {
+				t.Fatalf("forwarded body mismatch:\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
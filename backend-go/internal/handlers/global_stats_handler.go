@@ -76,3 +76,11 @@ func GetGlobalStatsHistory(metricsManager *metrics.MetricsManager) gin.HandlerFu
 		c.JSON(200, result)
 	}
 }
+
+// GetRequestBodySizeStats 获取请求体大小直方图与超限（MaxRequestBodySize）拒绝统计，用于调整请求体大小上限
+// GET /api/{messages|responses|gemini}/global/request-body-sizes
+func GetRequestBodySizeStats(metricsManager *metrics.MetricsManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, metricsManager.GetRequestBodySizeStats())
+	}
+}
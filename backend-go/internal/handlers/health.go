@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
 	"github.com/gin-gonic/gin"
 )
 
@@ -12,12 +13,20 @@ func HealthCheck(envCfg *config.EnvConfig, cfgManager *config.ConfigManager) gin
 	return func(c *gin.Context) {
 		config := cfgManager.GetConfig()
 
+		// 维护模式下仍返回 200（进程本身健康，避免被容器编排重启），通过 status 与 maintenance 字段体现
+		status := "healthy"
+		maintenance := common.GetMaintenance()
+		if maintenance.Enabled {
+			status = "maintenance"
+		}
+
 		healthData := gin.H{
-			"status":    "healthy",
-			"timestamp": time.Now().Format(time.RFC3339),
-			"uptime":    time.Since(startTime).Seconds(),
-			"mode":      envCfg.Env,
-			"version":   getVersion(),
+			"status":      status,
+			"maintenance": maintenance,
+			"timestamp":   time.Now().Format(time.RFC3339),
+			"uptime":      time.Since(startTime).Seconds(),
+			"mode":        envCfg.Env,
+			"version":     getVersion(),
 			"config": gin.H{
 				"upstreamCount":        len(config.Upstream),
 				"loadBalance":          config.LoadBalance,
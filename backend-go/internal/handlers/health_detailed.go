@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/messages"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// 整体健康状态
+const (
+	HealthStatusHealthy  = "healthy"  // 所有启用渠道可用
+	HealthStatusDegraded = "degraded" // 部分启用渠道可用
+	HealthStatusDown     = "down"     // 没有可用渠道（返回 503，便于负载均衡摘除）
+)
+
+// ChannelHealth 单个渠道的健康状态
+type ChannelHealth struct {
+	Index         int           `json:"index"`
+	Name          string        `json:"name"`
+	Status        string        `json:"status"`        // 渠道配置状态（仅 active 计入整体状态）
+	Healthy       bool          `json:"healthy"`       // 至少一个密钥未熔断，且探测成功（若探测）
+	AvailableKeys int           `json:"availableKeys"` // 未熔断且未排空的密钥数
+	TotalKeys     int           `json:"totalKeys"`
+	LastSuccessAt *time.Time    `json:"lastSuccessAt,omitempty"`
+	Probe         *ChannelProbe `json:"probe,omitempty"`
+}
+
+// ChannelProbe 渠道连通性实时探测结果
+type ChannelProbe struct {
+	Success   bool   `json:"success"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// APIHealth 单类接口（messages/responses/gemini）的健康状态
+type APIHealth struct {
+	Status   string          `json:"status"`
+	Channels []ChannelHealth `json:"channels"`
+}
+
+// DetailedHealthCheck 详细健康检查（GET /api/health/detailed）
+// 默认只读取缓存的指标状态；?probe=true 时以有界并发实时探测各启用渠道的 BaseURL
+func DetailedHealthCheck(envCfg *config.EnvConfig, cfgManager *config.ConfigManager, sch *scheduler.ChannelScheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		probe, _ := strconv.ParseBool(c.Query("probe"))
+		cfg := cfgManager.GetConfig()
+
+		apis := map[string]*APIHealth{
+			"messages":  buildAPIHealth(cfg.Upstream, sch.GetMessagesMetricsManager()),
+			"responses": buildAPIHealth(cfg.ResponsesUpstream, sch.GetResponsesMetricsManager()),
+			"gemini":    buildAPIHealth(cfg.GeminiUpstream, sch.GetGeminiMetricsManager()),
+		}
+
+		if probe {
+			timeout := time.Duration(envCfg.HealthProbeTimeout) * time.Second
+			probeChannels(apis["messages"], cfg.Upstream, timeout, envCfg.HealthProbeConcurrency)
+			probeChannels(apis["responses"], cfg.ResponsesUpstream, timeout, envCfg.HealthProbeConcurrency)
+			probeChannels(apis["gemini"], cfg.GeminiUpstream, timeout, envCfg.HealthProbeConcurrency)
+		}
+
+		var all []ChannelHealth
+		for _, api := range apis {
+			api.Status = aggregateHealthStatus(api.Channels)
+			all = append(all, api.Channels...)
+		}
+		status := aggregateHealthStatus(all)
+
+		httpStatus := http.StatusOK
+		if status == HealthStatusDown {
+			httpStatus = http.StatusServiceUnavailable
+		}
+		c.JSON(httpStatus, gin.H{
+			"status":      status,
+			"timestamp":   time.Now().Format(time.RFC3339),
+			"probed":      probe,
+			"maintenance": common.GetMaintenance(),
+			"messages":    apis["messages"],
+			"responses":   apis["responses"],
+			"gemini":      apis["gemini"],
+		})
+	}
+}
+
+// buildAPIHealth 根据缓存的熔断与成功记录生成各渠道健康状态
+func buildAPIHealth(upstreams []config.UpstreamConfig, metricsManager *metrics.MetricsManager) *APIHealth {
+	api := &APIHealth{Channels: make([]ChannelHealth, 0, len(upstreams))}
+	for i := range upstreams {
+		upstream := &upstreams[i]
+		ch := ChannelHealth{
+			Index:     i,
+			Name:      upstream.Name,
+			Status:    config.GetChannelStatus(upstream),
+			TotalKeys: len(upstream.APIKeys),
+		}
+
+		baseURLs := upstream.GetAllBaseURLs()
+		for _, apiKey := range upstream.APIKeys {
+			keyAvailable := false
+			for _, baseURL := range baseURLs {
+				if metricsManager.GetChannelCircuitState(baseURL, []string{apiKey}) != metrics.CircuitOpen {
+					keyAvailable = true
+				}
+				if km := metricsManager.GetKeyMetrics(baseURL, apiKey); km != nil && km.LastSuccessAt != nil {
+					if ch.LastSuccessAt == nil || km.LastSuccessAt.After(*ch.LastSuccessAt) {
+						t := *km.LastSuccessAt
+						ch.LastSuccessAt = &t
+					}
+				}
+			}
+			if keyAvailable && !upstream.IsKeyDraining(apiKey) {
+				ch.AvailableKeys++
+			}
+		}
+		ch.Healthy = ch.AvailableKeys > 0
+
+		api.Channels = append(api.Channels, ch)
+	}
+	return api
+}
+
+// probeChannels 以有界并发（worker pool）探测启用渠道的连通性，探测失败的渠道标记为不健康
+func probeChannels(api *APIHealth, upstreams []config.UpstreamConfig, timeout time.Duration, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := messages.PingChannelURLs(&upstreams[i], timeout)
+				p := &ChannelProbe{}
+				p.Success, _ = result["success"].(bool)
+				p.LatencyMs, _ = result["latency"].(int64)
+				p.Error, _ = result["error"].(string)
+
+				// 每个 worker 只写入自己领取的渠道，无需加锁
+				api.Channels[i].Probe = p
+				if !p.Success {
+					api.Channels[i].Healthy = false
+				}
+			}
+		}()
+	}
+
+	for i := range api.Channels {
+		if api.Channels[i].Status == "active" {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// aggregateHealthStatus 汇总启用渠道的健康状态（没有启用渠道视为 down）
+func aggregateHealthStatus(channels []ChannelHealth) string {
+	active, healthy := 0, 0
+	for _, ch := range channels {
+		if ch.Status != "active" {
+			continue
+		}
+		active++
+		if ch.Healthy {
+			healthy++
+		}
+	}
+	switch {
+	case healthy == 0:
+		return HealthStatusDown
+	case healthy < active:
+		return HealthStatusDegraded
+	default:
+		return HealthStatusHealthy
+	}
+}
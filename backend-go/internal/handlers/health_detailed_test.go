@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+type detailedHealthResponse struct {
+	Status   string    `json:"status"`
+	Probed   bool      `json:"probed"`
+	Messages APIHealth `json:"messages"`
+	Gemini   APIHealth `json:"gemini"`
+}
+
+func getDetailedHealth(t *testing.T, r *gin.Engine, query string) (int, detailedHealthResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/health/detailed"+query, nil))
+	var resp detailedHealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v body=%s", err, w.Body.String())
+	}
+	return w.Code, resp
+}
+
+func TestDetailedHealthCheck_CachedState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cm, _ := newTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "ok", ServiceType: "claude", BaseURL: "https://ok.example.com", APIKeys: []string{"k-ok"}, Status: "active"},
+			{Name: "broken", ServiceType: "claude", BaseURL: "https://broken.example.com", APIKeys: []string{"k-broken"}, Status: "active"},
+			{Name: "off", ServiceType: "claude", BaseURL: "https://off.example.com", APIKeys: []string{"k-off"}, Status: "disabled"},
+		},
+	})
+	sch, cleanup := newTestScheduler(t, cm)
+	defer cleanup()
+
+	mm := sch.GetMessagesMetricsManager()
+	mm.RecordSuccess("https://ok.example.com", "k-ok")
+	for i := 0; i < 3; i++ {
+		mm.RecordFailure("https://broken.example.com", "k-broken")
+	}
+	if mm.GetChannelCircuitState("https://broken.example.com", []string{"k-broken"}) != metrics.CircuitOpen {
+		t.Fatal("前置条件：broken 渠道密钥应已熔断")
+	}
+
+	r := gin.New()
+	r.GET("/api/health/detailed", DetailedHealthCheck(&config.EnvConfig{HealthProbeTimeout: 1, HealthProbeConcurrency: 2}, cm, sch))
+
+	code, resp := getDetailedHealth(t, r, "")
+	if code != http.StatusOK || resp.Status != HealthStatusDegraded || resp.Probed {
+		t.Fatalf("code=%d status=%s probed=%v, want 200 degraded false", code, resp.Status, resp.Probed)
+	}
+	chs := resp.Messages.Channels
+	if len(chs) != 3 {
+		t.Fatalf("channels = %d, want 3", len(chs))
+	}
+	if !chs[0].Healthy || chs[0].AvailableKeys != 1 || chs[0].LastSuccessAt == nil || chs[0].Probe != nil {
+		t.Fatalf("ok 渠道状态不符: %+v", chs[0])
+	}
+	if chs[1].Healthy || chs[1].AvailableKeys != 0 || chs[1].TotalKeys != 1 {
+		t.Fatalf("broken 渠道应不可用: %+v", chs[1])
+	}
+	if chs[2].Status != "disabled" {
+		t.Fatalf("off 渠道状态 = %s, want disabled", chs[2].Status)
+	}
+	if resp.Gemini.Status != HealthStatusDown || len(resp.Gemini.Channels) != 0 {
+		t.Fatalf("未配置的 Gemini 应为 down: %+v", resp.Gemini)
+	}
+}
+
+func TestDetailedHealthCheck_ProbeAndDown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	cm, _ := newTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "reachable", ServiceType: "claude", BaseURL: upstream.URL, APIKeys: []string{"k1"}, Status: "active"},
+			{Name: "unreachable", ServiceType: "claude", BaseURL: "http://127.0.0.1:1", APIKeys: []string{"k2"}, Status: "active"},
+		},
+	})
+	sch, cleanup := newTestScheduler(t, cm)
+	defer cleanup()
+
+	r := gin.New()
+	r.GET("/api/health/detailed", DetailedHealthCheck(&config.EnvConfig{HealthProbeTimeout: 2, HealthProbeConcurrency: 1}, cm, sch))
+
+	// 未探测时仅依据指标，两个渠道均可用
+	if code, resp := getDetailedHealth(t, r, ""); code != http.StatusOK || resp.Status != HealthStatusHealthy {
+		t.Fatalf("code=%d status=%s, want 200 healthy", code, resp.Status)
+	}
+
+	code, resp := getDetailedHealth(t, r, "?probe=true")
+	if code != http.StatusOK || resp.Status != HealthStatusDegraded || !resp.Probed {
+		t.Fatalf("code=%d status=%s probed=%v, want 200 degraded true", code, resp.Status, resp.Probed)
+	}
+	chs := resp.Messages.Channels
+	if chs[0].Probe == nil || !chs[0].Probe.Success || !chs[0].Healthy {
+		t.Fatalf("reachable 探测应成功: %+v", chs[0])
+	}
+	if chs[1].Probe == nil || chs[1].Probe.Success || chs[1].Probe.Error == "" || chs[1].Healthy {
+		t.Fatalf("unreachable 探测应失败: %+v", chs[1])
+	}
+
+	// 所有渠道不可达时整体 down，返回 503
+	upstream.Close()
+	if code, resp := getDetailedHealth(t, r, "?probe=true"); code != http.StatusServiceUnavailable || resp.Status != HealthStatusDown {
+		t.Fatalf("code=%d status=%s, want 503 down", code, resp.Status)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/gin-gonic/gin"
+)
+
+// GetMaintenance 获取维护模式状态
+// GET /api/maintenance
+func GetMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, common.GetMaintenance())
+	}
+}
+
+// SetMaintenance 开启或解除维护模式（仅保存在内存中，重启后解除）
+// POST /api/maintenance {"message": "...", "retryAfter": 120}，请求体可省略；{"enabled": false} 解除
+func SetMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Enabled    *bool  `json:"enabled"`
+			Message    string `json:"message"`
+			RetryAfter int    `json:"retryAfter"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+				return
+			}
+		}
+		if req.RetryAfter < 0 || req.RetryAfter > common.MaxMaintenanceRetryAfter {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "retryAfter 必须在 0-86400 秒之间"})
+			return
+		}
+
+		if req.Enabled != nil && !*req.Enabled {
+			common.DisableMaintenance()
+		} else {
+			common.EnableMaintenance(req.Message, req.RetryAfter)
+		}
+		c.JSON(http.StatusOK, common.GetMaintenance())
+	}
+}
+
+// ClearMaintenance 解除维护模式
+// DELETE /api/maintenance
+func ClearMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		common.DisableMaintenance()
+		c.JSON(http.StatusOK, common.GetMaintenance())
+	}
+}
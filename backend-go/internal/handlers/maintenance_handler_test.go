@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMaintenanceHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer common.DisableMaintenance()
+
+	cm, _ := newTestConfigManager(t, config.Config{})
+	r := gin.New()
+	r.GET("/health", HealthCheck(&config.EnvConfig{}, cm))
+	r.GET("/api/maintenance", GetMaintenance())
+	r.POST("/api/maintenance", SetMaintenance())
+	r.DELETE("/api/maintenance", ClearMaintenance())
+
+	do := func(method, path, body string) (*httptest.ResponseRecorder, map[string]any) {
+		t.Helper()
+		var reader *bytes.Reader
+		if body == "" {
+			reader = bytes.NewReader(nil)
+		} else {
+			reader = bytes.NewReader([]byte(body))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, reader))
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	// 请求体可省略：使用默认提示与 Retry-After
+	w, resp := do(http.MethodPost, "/api/maintenance", "")
+	if w.Code != http.StatusOK || resp["enabled"] != true || resp["retryAfter"] != float64(common.DefaultMaintenanceRetryAfter) {
+		t.Fatalf("POST empty: status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	w, resp = do(http.MethodPost, "/api/maintenance", `{"message":"provider outage","retryAfter":300}`)
+	if w.Code != http.StatusOK || resp["message"] != "provider outage" || resp["retryAfter"] != float64(300) {
+		t.Fatalf("POST: status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// 健康检查反映维护状态（仍返回 200）
+	w, resp = do(http.MethodGet, "/health", "")
+	if w.Code != http.StatusOK || resp["status"] != "maintenance" {
+		t.Fatalf("health: status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	if w, _ = do(http.MethodPost, "/api/maintenance", `{"retryAfter":-1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid retryAfter: status = %d, want 400", w.Code)
+	}
+	if w, _ = do(http.MethodPost, "/api/maintenance", `{bad`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid body: status = %d, want 400", w.Code)
+	}
+
+	w, resp = do(http.MethodDelete, "/api/maintenance", "")
+	if w.Code != http.StatusOK || resp["enabled"] != false {
+		t.Fatalf("DELETE: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if _, resp = do(http.MethodGet, "/health", ""); resp["status"] != "healthy" {
+		t.Fatalf("health after clear: %v", resp["status"])
+	}
+
+	// {"enabled": false} 同样解除
+	do(http.MethodPost, "/api/maintenance", `{"message":"x"}`)
+	if _, resp = do(http.MethodPost, "/api/maintenance", `{"enabled":false}`); resp["enabled"] != false {
+		t.Fatalf("POST enabled=false: %v", resp)
+	}
+	if _, resp = do(http.MethodGet, "/api/maintenance", ""); resp["enabled"] != false {
+		t.Fatalf("GET after disable: %v", resp)
+	}
+}
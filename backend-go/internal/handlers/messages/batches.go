@@ -0,0 +1,465 @@
+package messages
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/middleware"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// batchBindingTTL 批处理与渠道绑定的保留时间（Anthropic 批处理结果保留 29 天）
+	batchBindingTTL = 30 * 24 * time.Hour
+	// maxBatchBindings 绑定记录上限，超出时淘汰最早创建的记录
+	maxBatchBindings = 10000
+)
+
+// batchIDPattern Anthropic 批处理 ID 格式；绑定缺失时仅对符合格式的 ID 探测上游
+var batchIDPattern = regexp.MustCompile(`^msgbatch_[A-Za-z0-9]+$`)
+
+// BatchBinding 记录批处理由哪个渠道、哪个 key 创建
+type BatchBinding struct {
+	ChannelName string
+	BaseURL     string
+	APIKey      string
+	KeyHash     string // 从持久化恢复的绑定只有 key 摘要，使用时按摘要匹配渠道当前 key
+	CreatedAt   time.Time
+}
+
+// BatchBindingPersister 批处理绑定持久化后端（由 metrics.SQLiteStore 实现）
+type BatchBindingPersister interface {
+	LoadBatchBindings(since time.Time) ([]metrics.BatchBindingRecord, error)
+	SaveBatchBinding(record metrics.BatchBindingRecord) error
+	CleanupBatchBindings(before time.Time) (int64, error)
+}
+
+// BatchStore 保存 batch id 与创建渠道的映射（内存，可选持久化）
+// 批处理只能在创建它的上游查询/取消/下载结果，不能切换到其他渠道重试
+type BatchStore struct {
+	mu        sync.Mutex
+	bindings  map[string]BatchBinding
+	ttl       time.Duration
+	maxSize   int
+	persister BatchBindingPersister
+}
+
+// NewBatchStore 创建批处理绑定存储
+func NewBatchStore() *BatchStore {
+	return &BatchStore{
+		bindings: make(map[string]BatchBinding),
+		ttl:      batchBindingTTL,
+		maxSize:  maxBatchBindings,
+	}
+}
+
+// NewBatchStoreWithPersistence 创建带持久化的批处理绑定存储，启动时恢复未过期的绑定
+// 服务重启后无需逐渠道探测即可定位批处理所属渠道
+func NewBatchStoreWithPersistence(persister BatchBindingPersister) *BatchStore {
+	s := NewBatchStore()
+	s.persister = persister
+
+	cutoff := time.Now().Add(-s.ttl)
+	if _, err := persister.CleanupBatchBindings(cutoff); err != nil {
+		log.Printf("[Messages-Batch] 警告: 清理过期批处理绑定失败: %v", err)
+	}
+	records, err := persister.LoadBatchBindings(cutoff)
+	if err != nil {
+		log.Printf("[Messages-Batch] 警告: 加载批处理绑定失败: %v", err)
+		return s
+	}
+	for _, r := range records {
+		s.bindings[r.BatchID] = BatchBinding{ChannelName: r.ChannelName, BaseURL: r.BaseURL, KeyHash: r.KeyHash, CreatedAt: r.CreatedAt}
+	}
+	s.pruneLocked(time.Now())
+	return s
+}
+
+// Put 记录 batch id 的渠道绑定（启用持久化时同步写入，仅保存 key 摘要）
+func (s *BatchStore) Put(id string, binding BatchBinding) {
+	if s == nil || id == "" {
+		return
+	}
+	if binding.CreatedAt.IsZero() {
+		binding.CreatedAt = time.Now()
+	}
+	if binding.KeyHash == "" && binding.APIKey != "" {
+		binding.KeyHash = batchKeyHash(binding.APIKey)
+	}
+
+	s.mu.Lock()
+	s.bindings[id] = binding
+	s.pruneLocked(time.Now())
+	s.mu.Unlock()
+
+	if s.persister != nil {
+		if err := s.persister.SaveBatchBinding(metrics.BatchBindingRecord{
+			BatchID:     id,
+			ChannelName: binding.ChannelName,
+			BaseURL:     binding.BaseURL,
+			KeyHash:     binding.KeyHash,
+			CreatedAt:   binding.CreatedAt,
+		}); err != nil {
+			log.Printf("[Messages-Batch] 警告: 持久化批处理绑定失败: id=%s, error=%v", id, err)
+		}
+	}
+}
+
+// batchKeyHash 计算持久化使用的 API key 摘要
+func batchKeyHash(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get 返回 batch id 的渠道绑定，过期记录视为不存在
+func (s *BatchStore) Get(id string) (BatchBinding, bool) {
+	if s == nil {
+		return BatchBinding{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	binding, ok := s.bindings[id]
+	if !ok {
+		return BatchBinding{}, false
+	}
+	if s.ttl > 0 && time.Since(binding.CreatedAt) > s.ttl {
+		delete(s.bindings, id)
+		return BatchBinding{}, false
+	}
+	return binding, true
+}
+
+// Len 返回当前绑定数量
+func (s *BatchStore) Len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bindings)
+}
+
+func (s *BatchStore) pruneLocked(now time.Time) {
+	if s.ttl > 0 {
+		for id, binding := range s.bindings {
+			if now.Sub(binding.CreatedAt) > s.ttl {
+				delete(s.bindings, id)
+			}
+		}
+	}
+	for s.maxSize > 0 && len(s.bindings) > s.maxSize {
+		oldestID := ""
+		var oldest time.Time
+		for id, binding := range s.bindings {
+			if oldestID == "" || binding.CreatedAt.Before(oldest) {
+				oldestID, oldest = id, binding.CreatedAt
+			}
+		}
+		delete(s.bindings, oldestID)
+	}
+}
+
+// BatchCreateHandler 处理 POST /v1/messages/batches
+// 通过调度器选择 Claude 渠道创建批处理（创建前可安全故障转移），成功后记录 batch → 渠道绑定
+func BatchCreateHandler(envCfg *config.EnvConfig, cfgManager *config.ConfigManager, channelScheduler *scheduler.ChannelScheduler, store *BatchStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		middleware.ProxyAuthMiddleware(envCfg)(c)
+		if c.IsAborted() || !common.CheckMaintenance(c) {
+			return
+		}
+		envCfg := common.RequestEnvConfig(c, envCfg)
+
+		var metricsManager *metrics.MetricsManager
+		if channelScheduler != nil {
+			metricsManager = channelScheduler.GetMessagesMetricsManager()
+		}
+		bodyBytes, err := common.ReadRequestBody(c, envCfg.MaxRequestBodySize, metricsManager)
+		if err != nil {
+			return
+		}
+		if !gjson.ValidBytes(bodyBytes) {
+			c.JSON(http.StatusBadRequest, batchError("invalid_request_error", "Invalid JSON"))
+			return
+		}
+
+		// 批内每个请求的模型都需要通过全局模型策略
+		for _, model := range gjson.GetBytes(bodyBytes, "requests.#.params.model").Array() {
+			if !common.CheckModelAllowed(c, cfgManager, "Messages-Batch", model.String()) {
+				return
+			}
+		}
+
+		failedChannels := make(map[int]bool)
+		selectionCtx := common.BuildSelectionContext(c, cfgManager, "")
+		var lastStatus int
+		var lastBody []byte
+		var lastHeaders http.Header
+
+		for attempt := 0; attempt < 10; attempt++ {
+			selection, err := channelScheduler.SelectChannel(selectionCtx, "", failedChannels, false)
+			if err != nil {
+				break
+			}
+			failedChannels[selection.ChannelIndex] = true
+
+			upstream := selection.Upstream
+			if upstream.ServiceType != "claude" {
+				continue
+			}
+			requestBody := redirectBatchModels(bodyBytes, upstream)
+			baseURL := upstream.GetEffectiveBaseURL()
+
+			var failedKeys map[string]bool
+			for {
+				apiKey, err := cfgManager.GetNextAPIKey(upstream, failedKeys)
+				if err != nil {
+					break
+				}
+				if failedKeys == nil {
+					failedKeys = make(map[string]bool)
+				}
+				failedKeys[apiKey] = true
+
+				resp, err := sendBatchRequest(c, envCfg, upstream, baseURL, apiKey, http.MethodPost, "", requestBody)
+				if err != nil {
+					log.Printf("[Messages-Batch] 创建批处理请求失败: channel=%s, key=%s, error=%v",
+						upstream.Name, utils.MaskAPIKey(apiKey), err)
+					channelScheduler.RecordFailure(baseURL, apiKey, false)
+					continue
+				}
+				respBody, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					channelScheduler.RecordFailure(baseURL, apiKey, false)
+					continue
+				}
+				respBody = utils.DecompressGzipIfNeeded(resp, respBody)
+
+				if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+					batchID := gjson.GetBytes(respBody, "id").String()
+					store.Put(batchID, BatchBinding{ChannelName: upstream.Name, BaseURL: baseURL, APIKey: apiKey})
+					channelScheduler.RecordSuccessWithUsage(baseURL, apiKey, nil, false, "", 0)
+					log.Printf("[Messages-Batch] 批处理已创建: id=%s, channel=%s, key=%s, reason=%s",
+						batchID, upstream.Name, utils.MaskAPIKey(apiKey), selection.Reason)
+					writeBatchResponse(c, envCfg, resp.StatusCode, resp.Header, respBody)
+					return
+				}
+
+				lastStatus, lastBody, lastHeaders = resp.StatusCode, respBody, resp.Header
+				shouldFailover, _ := common.ShouldRetryWithNextKeyForChannel(upstream, resp.StatusCode, respBody, common.EffectiveFuzzyMode(c, cfgManager))
+				if !shouldFailover {
+					// 非可重试错误（如请求体格式错误）直接返回给客户端
+					writeBatchResponse(c, envCfg, resp.StatusCode, resp.Header, respBody)
+					return
+				}
+				channelScheduler.RecordFailure(baseURL, apiKey, false)
+				log.Printf("[Messages-Batch] 创建批处理失败，尝试下一个 key: channel=%s, key=%s, status=%d",
+					upstream.Name, utils.MaskAPIKey(apiKey), resp.StatusCode)
+			}
+		}
+
+		if lastStatus != 0 {
+			writeBatchResponse(c, envCfg, lastStatus, lastHeaders, lastBody)
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, batchError("overloaded_error", "No available Claude channel for message batches"))
+	}
+}
+
+// BatchPassthroughHandler 处理 GET /v1/messages/batches/:id、/:id/results 与 POST /:id/cancel
+// 请求固定转发到创建该批处理的渠道与 key，不做跨渠道重试
+func BatchPassthroughHandler(envCfg *config.EnvConfig, cfgManager *config.ConfigManager, store *BatchStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		middleware.ProxyAuthMiddleware(envCfg)(c)
+		if c.IsAborted() {
+			return
+		}
+		envCfg := common.RequestEnvConfig(c, envCfg)
+
+		batchID := c.Param("id")
+		suffix := strings.TrimPrefix(c.Request.URL.Path, "/v1/messages/batches")
+
+		binding, upstream, ok := resolveBatchBinding(c, envCfg, cfgManager, store, batchID)
+		if !ok {
+			c.JSON(http.StatusNotFound, batchError("not_found_error", fmt.Sprintf("Batch %s not found on any channel", batchID)))
+			return
+		}
+
+		var body []byte
+		if c.Request.Method != http.MethodGet {
+			body, _ = io.ReadAll(c.Request.Body)
+		}
+		resp, err := sendBatchRequest(c, envCfg, upstream, binding.BaseURL, binding.APIKey, c.Request.Method, suffix, body)
+		if err != nil {
+			log.Printf("[Messages-Batch] 批处理请求失败: id=%s, channel=%s, error=%v", batchID, binding.ChannelName, err)
+			c.JSON(http.StatusBadGateway, batchError("api_error", "Upstream request failed"))
+			return
+		}
+		defer resp.Body.Close()
+
+		if envCfg.EnableRequestLogs {
+			log.Printf("[Messages-Batch] %s %s -> channel=%s, status=%d", c.Request.Method, suffix, binding.ChannelName, resp.StatusCode)
+		}
+
+		// results 为 JSONL，可能较大，直接流式转发
+		utils.ForwardResponseHeaders(resp.Header, c.Writer)
+		c.Status(resp.StatusCode)
+		if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+			log.Printf("[Messages-Batch] 转发批处理响应失败: id=%s, error=%v", batchID, err)
+		}
+	}
+}
+
+// resolveBatchBinding 查找批处理的渠道绑定；绑定缺失（如未启用持久化时服务重启）时逐个探测 Claude 渠道并补记绑定
+// 仅探测符合 msgbatch_ 格式的 ID，且跳过未解析的密钥引用
+func resolveBatchBinding(c *gin.Context, envCfg *config.EnvConfig, cfgManager *config.ConfigManager, store *BatchStore, batchID string) (BatchBinding, *config.UpstreamConfig, bool) {
+	cfg := cfgManager.GetConfig()
+
+	if binding, ok := store.Get(batchID); ok {
+		for i := range cfg.Upstream {
+			if cfg.Upstream[i].Name != binding.ChannelName {
+				continue
+			}
+			if binding.APIKey == "" {
+				for _, apiKey := range cfg.Upstream[i].APIKeys {
+					if batchKeyHash(apiKey) == binding.KeyHash {
+						binding.APIKey = apiKey
+						break
+					}
+				}
+				if binding.APIKey == "" {
+					log.Printf("[Messages-Batch] 批处理绑定的密钥已不在渠道中: id=%s, channel=%s", batchID, binding.ChannelName)
+					return BatchBinding{}, nil, false
+				}
+			}
+			return binding, &cfg.Upstream[i], true
+		}
+		log.Printf("[Messages-Batch] 批处理绑定的渠道已不存在: id=%s, channel=%s", batchID, binding.ChannelName)
+		return BatchBinding{}, nil, false
+	}
+
+	if !batchIDPattern.MatchString(batchID) {
+		return BatchBinding{}, nil, false
+	}
+	probePath := "/" + batchID
+	for i := range cfg.Upstream {
+		upstream := &cfg.Upstream[i]
+		if upstream.ServiceType != "claude" || config.GetChannelStatus(upstream) == "disabled" {
+			continue
+		}
+		baseURL := upstream.GetEffectiveBaseURL()
+		for _, apiKey := range upstream.APIKeys {
+			if config.IsAPIKeyRef(apiKey) {
+				continue
+			}
+			resp, err := sendBatchRequest(c, envCfg, upstream, baseURL, apiKey, http.MethodGet, probePath, nil)
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				binding := BatchBinding{ChannelName: upstream.Name, BaseURL: baseURL, APIKey: apiKey}
+				store.Put(batchID, binding)
+				log.Printf("[Messages-Batch] 探测到批处理所属渠道: id=%s, channel=%s, key=%s",
+					batchID, upstream.Name, utils.MaskAPIKey(apiKey))
+				return binding, upstream, true
+			}
+		}
+	}
+	return BatchBinding{}, nil, false
+}
+
+// sendBatchRequest 构建并发送批处理请求，suffix 为 /messages/batches 之后的路径
+func sendBatchRequest(c *gin.Context, envCfg *config.EnvConfig, upstream *config.UpstreamConfig, baseURL, apiKey, method, suffix string, body []byte) (*http.Response, error) {
+	targetURL := buildBatchesURL(baseURL) + suffix
+	if c.Request.URL.RawQuery != "" {
+		targetURL += "?" + c.Request.URL.RawQuery
+	}
+
+	var reader io.Reader
+	if len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(c.Request.Context(), method, targetURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = utils.PrepareUpstreamHeaders(c, req.URL.Host)
+	if len(body) == 0 {
+		req.Header.Del("Content-Type")
+	}
+	utils.SetAuthenticationHeader(req.Header, apiKey)
+	utils.EnsureCompatibleUserAgent(req.Header, "claude")
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
+
+	return common.SendRequest(req, upstream, envCfg, false)
+}
+
+// buildBatchesURL 构建 messages/batches 端点的 URL（与 models 端点相同的版本号拼接规则）
+func buildBatchesURL(baseURL string) string {
+	skipVersionPrefix := strings.HasSuffix(baseURL, "#")
+	if skipVersionPrefix {
+		baseURL = strings.TrimSuffix(baseURL, "#")
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	versionPattern := regexp.MustCompile(`/v\d+[a-z]*$`)
+	endpoint := "/messages/batches"
+	if !versionPattern.MatchString(baseURL) && !skipVersionPrefix {
+		endpoint = "/v1" + endpoint
+	}
+	return baseURL + endpoint
+}
+
+// redirectBatchModels 对批内每个请求的 params.model 应用渠道模型重定向
+func redirectBatchModels(body []byte, upstream *config.UpstreamConfig) []byte {
+	if len(upstream.ModelMapping) == 0 {
+		return body
+	}
+	out := body
+	for i, item := range gjson.GetBytes(body, "requests").Array() {
+		model := item.Get("params.model").String()
+		if model == "" {
+			continue
+		}
+		redirected := config.RedirectModel(model, upstream)
+		if redirected == model {
+			continue
+		}
+		if updated, err := sjson.SetBytes(out, fmt.Sprintf("requests.%d.params.model", i), redirected); err == nil {
+			out = updated
+		}
+	}
+	return out
+}
+
+func writeBatchResponse(c *gin.Context, envCfg *config.EnvConfig, status int, headers http.Header, body []byte) {
+	utils.ForwardResponseHeaders(headers, c.Writer)
+	contentType := headers.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	common.WriteResponseBody(c, envCfg, status, contentType, body)
+}
+
+func batchError(errType, message string) gin.H {
+	return gin.H{"type": "error", "error": gin.H{"type": errType, "message": message}}
+}
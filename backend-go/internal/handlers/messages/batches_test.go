@@ -0,0 +1,335 @@
+package messages
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+type batchUpstreamCall struct {
+	method string
+	path   string
+	key    string
+	body   string
+}
+
+func newBatchUpstream(t *testing.T, name string, createStatus int) (*httptest.Server, func() []batchUpstreamCall) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var calls []batchUpstreamCall
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := new(bytes.Buffer)
+		_, _ = buf.ReadFrom(r.Body)
+		mu.Lock()
+		calls = append(calls, batchUpstreamCall{method: r.Method, path: r.URL.Path, key: strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), body: buf.String()})
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/messages/batches":
+			w.WriteHeader(createStatus)
+			if createStatus == http.StatusOK {
+				_, _ = fmt.Fprintf(w, `{"id":"msgbatch_%s","type":"message_batch","processing_status":"in_progress"}`, name)
+			} else {
+				_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"busy"}}`))
+			}
+		case r.URL.Path == "/v1/messages/batches/msgbatch_"+name+"/results":
+			w.Header().Set("Content-Type", "application/x-jsonl")
+			_, _ = w.Write([]byte(`{"custom_id":"a","result":{"type":"succeeded"}}` + "\n"))
+		case strings.HasPrefix(r.URL.Path, "/v1/messages/batches/msgbatch_"+name):
+			_, _ = fmt.Fprintf(w, `{"id":"msgbatch_%s","type":"message_batch","processing_status":"ended"}`, name)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"not_found_error","message":"not found"}}`))
+		}
+	}))
+	return srv, func() []batchUpstreamCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]batchUpstreamCall(nil), calls...)
+	}
+}
+
+func newBatchRouter(envCfg *config.EnvConfig, cfgManager *config.ConfigManager, store *BatchStore, create gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.POST("/v1/messages/batches", create)
+	r.GET("/v1/messages/batches/:id", BatchPassthroughHandler(envCfg, cfgManager, store))
+	r.GET("/v1/messages/batches/:id/results", BatchPassthroughHandler(envCfg, cfgManager, store))
+	r.POST("/v1/messages/batches/:id/cancel", BatchPassthroughHandler(envCfg, cfgManager, store))
+	return r
+}
+
+func TestBatchHandlers_PinToCreatingChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	busy, busyCalls := newBatchUpstream(t, "busy", http.StatusServiceUnavailable)
+	defer busy.Close()
+	good, goodCalls := newBatchUpstream(t, "good", http.StatusOK)
+	defer good.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "busy", BaseURL: busy.URL, APIKeys: []string{"k-busy"}, ServiceType: "claude", Status: "active", Priority: 1},
+			{Name: "good", BaseURL: good.URL, APIKeys: []string{"k-good"}, ServiceType: "claude", Status: "active", Priority: 2,
+				ModelMapping: map[string]string{"sonnet": "claude-sonnet-4-upstream"}},
+		},
+		LoadBalance: "failover",
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	store := NewBatchStore()
+	r := newBatchRouter(envCfg, cfgManager, store, BatchCreateHandler(envCfg, cfgManager, sch, store))
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/v1/messages/batches",
+		`{"requests":[{"custom_id":"a","params":{"model":"sonnet","max_tokens":8,"messages":[{"role":"user","content":"hi"}]}}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "msgbatch_good") {
+		t.Fatalf("unexpected create body: %s", w.Body.String())
+	}
+	if len(busyCalls()) != 1 {
+		t.Fatalf("busy upstream calls = %d, want 1 (failover before creation)", len(busyCalls()))
+	}
+	if created := goodCalls(); len(created) != 1 || !strings.Contains(created[0].body, "claude-sonnet-4-upstream") {
+		t.Fatalf("expected model redirect in batch body, calls = %+v", created)
+	}
+
+	binding, ok := store.Get("msgbatch_good")
+	if !ok || binding.ChannelName != "good" || binding.APIKey != "k-good" {
+		t.Fatalf("binding = %+v, ok = %v", binding, ok)
+	}
+
+	if w := send(http.MethodGet, "/v1/messages/batches/msgbatch_good", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ended") {
+		t.Fatalf("retrieve status = %d, body = %s", w.Code, w.Body.String())
+	}
+	w = send(http.MethodGet, "/v1/messages/batches/msgbatch_good/results", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"custom_id":"a"`) {
+		t.Fatalf("results status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-jsonl" {
+		t.Fatalf("results content-type = %q", ct)
+	}
+	if w := send(http.MethodPost, "/v1/messages/batches/msgbatch_good/cancel", ""); w.Code != http.StatusOK {
+		t.Fatalf("cancel status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	if len(busyCalls()) != 1 {
+		t.Fatalf("pinned requests must not reach other channels, busy calls = %d", len(busyCalls()))
+	}
+	calls := goodCalls()
+	if len(calls) != 4 {
+		t.Fatalf("good upstream calls = %d, want 4", len(calls))
+	}
+	for _, call := range calls[1:] {
+		if call.key != "k-good" {
+			t.Fatalf("pinned request used key %q", call.key)
+		}
+	}
+	if calls[3].method != http.MethodPost || calls[3].path != "/v1/messages/batches/msgbatch_good/cancel" {
+		t.Fatalf("unexpected cancel call: %+v", calls[3])
+	}
+}
+
+func TestBatchPassthroughHandler_ProbesUnknownBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	other, _ := newBatchUpstream(t, "other", http.StatusOK)
+	defer other.Close()
+	owner, ownerCalls := newBatchUpstream(t, "owner", http.StatusOK)
+	defer owner.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "other", BaseURL: other.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active"},
+			{Name: "openai", BaseURL: other.URL, APIKeys: []string{"k2"}, ServiceType: "openai", Status: "active"},
+			{Name: "owner", BaseURL: owner.URL + "/v1", APIKeys: []string{"k3", "k4"}, ServiceType: "claude", Status: "active"},
+		},
+	})
+	defer cleanupCfg()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	store := NewBatchStore()
+	r := newBatchRouter(envCfg, cfgManager, store, func(c *gin.Context) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/messages/batches/msgbatch_owner", nil)
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if binding, ok := store.Get("msgbatch_owner"); !ok || binding.ChannelName != "owner" || binding.APIKey != "k3" {
+		t.Fatalf("probe should record binding, got %+v ok=%v", binding, ok)
+	}
+	if calls := ownerCalls(); len(calls) != 2 {
+		t.Fatalf("owner calls = %d, want probe + request", len(calls))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/messages/batches/msgbatch_missing", nil)
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "not_found_error") {
+		t.Fatalf("unknown batch: status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBatchStore_ExpiresAndCaps(t *testing.T) {
+	store := NewBatchStore()
+	store.ttl = time.Hour
+	store.maxSize = 2
+
+	store.Put("old", BatchBinding{ChannelName: "a", CreatedAt: time.Now().Add(-2 * time.Hour)})
+	if _, ok := store.Get("old"); ok {
+		t.Fatalf("expired binding should not be returned")
+	}
+
+	store.Put("b1", BatchBinding{ChannelName: "a", CreatedAt: time.Now().Add(-3 * time.Minute)})
+	store.Put("b2", BatchBinding{ChannelName: "a", CreatedAt: time.Now().Add(-2 * time.Minute)})
+	store.Put("b3", BatchBinding{ChannelName: "a"})
+	if store.Len() != 2 {
+		t.Fatalf("len = %d, want 2", store.Len())
+	}
+	if _, ok := store.Get("b1"); ok {
+		t.Fatalf("oldest binding should be evicted")
+	}
+	if _, ok := store.Get("b3"); !ok {
+		t.Fatalf("newest binding should be kept")
+	}
+}
+
+func TestBatchPassthroughHandler_ProbeRejectsInvalidIDAndSkipsKeyRefs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owner, ownerCalls := newBatchUpstream(t, "owner", http.StatusOK)
+	defer owner.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "owner", BaseURL: owner.URL, APIKeys: []string{"env:BATCH_TEST_UNSET_KEY", "k1"}, ServiceType: "claude", Status: "active"},
+		},
+	})
+	defer cleanupCfg()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := newBatchRouter(envCfg, cfgManager, NewBatchStore(), func(c *gin.Context) {})
+
+	for _, id := range []string{"not-a-batch", "msgbatch_..", "msgbatch_"} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/messages/batches/"+id, nil)
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("id %q: status = %d, body = %s", id, w.Code, w.Body.String())
+		}
+	}
+	if calls := ownerCalls(); len(calls) != 0 {
+		t.Fatalf("invalid ids should not be probed, got %+v", calls)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/messages/batches/msgbatch_owner", nil)
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	for _, call := range ownerCalls() {
+		if call.key != "k1" {
+			t.Fatalf("key refs should be skipped, got key %q", call.key)
+		}
+	}
+}
+
+type memoryBatchPersister struct {
+	records map[string]metrics.BatchBindingRecord
+}
+
+func (p *memoryBatchPersister) LoadBatchBindings(since time.Time) ([]metrics.BatchBindingRecord, error) {
+	var out []metrics.BatchBindingRecord
+	for _, r := range p.records {
+		if !r.CreatedAt.Before(since) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (p *memoryBatchPersister) SaveBatchBinding(r metrics.BatchBindingRecord) error {
+	p.records[r.BatchID] = r
+	return nil
+}
+
+func (p *memoryBatchPersister) CleanupBatchBindings(before time.Time) (int64, error) {
+	var n int64
+	for id, r := range p.records {
+		if r.CreatedAt.Before(before) {
+			delete(p.records, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestBatchStore_PersistedBindingSurvivesRestart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owner, ownerCalls := newBatchUpstream(t, "owner", http.StatusOK)
+	defer owner.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "owner", BaseURL: owner.URL, APIKeys: []string{"k1", "k2"}, ServiceType: "claude", Status: "active"},
+		},
+	})
+	defer cleanupCfg()
+
+	persister := &memoryBatchPersister{records: map[string]metrics.BatchBindingRecord{
+		"msgbatch_expired": {BatchID: "msgbatch_expired", ChannelName: "owner", CreatedAt: time.Now().Add(-batchBindingTTL - time.Hour)},
+	}}
+	NewBatchStoreWithPersistence(persister).Put("msgbatch_owner", BatchBinding{ChannelName: "owner", BaseURL: owner.URL, APIKey: "k2"})
+	if r := persister.records["msgbatch_owner"]; r.KeyHash == "" || strings.Contains(r.KeyHash, "k2") {
+		t.Fatalf("persisted record should only hold key hash, got %+v", r)
+	}
+
+	// 模拟重启：新的存储从持久化恢复绑定
+	store := NewBatchStoreWithPersistence(persister)
+	if _, ok := persister.records["msgbatch_expired"]; ok || store.Len() != 1 {
+		t.Fatalf("expired binding should be cleaned, len = %d", store.Len())
+	}
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := newBatchRouter(envCfg, cfgManager, store, func(c *gin.Context) {})
+	req := httptest.NewRequest(http.MethodGet, "/v1/messages/batches/msgbatch_owner", nil)
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if calls := ownerCalls(); len(calls) != 1 || calls[0].key != "k2" {
+		t.Fatalf("restored binding should hit creating key without probing, got %+v", calls)
+	}
+}
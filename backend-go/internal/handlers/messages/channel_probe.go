@@ -0,0 +1,192 @@
+package messages
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/BenedictKing/claude-proxy/internal/providers"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultProbeModel 渠道测试默认使用的模型（可通过 ?model= 指定，仍会应用渠道 modelMapping）
+const defaultProbeModel = "claude-3-5-haiku-20241022"
+
+// ChannelProbeResult 渠道真实补全测试结果
+type ChannelProbeResult struct {
+	Success         bool         `json:"success"`
+	ChannelIndex    int          `json:"channelIndex"`
+	ChannelName     string       `json:"channelName"`
+	KeyIndex        int          `json:"keyIndex"`
+	Key             string       `json:"key"` // 脱敏
+	BaseURL         string       `json:"baseUrl"`
+	Model           string       `json:"model"`
+	Status          int          `json:"status,omitempty"`
+	Latency         int64        `json:"latency"` // 毫秒，发送请求到读取完响应体
+	Usage           *types.Usage `json:"usage,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	ErrorBody       interface{}  `json:"errorBody,omitempty"` // 上游错误响应体（JSON 解析失败时为原始字符串）
+	MetricsRecorded bool         `json:"metricsRecorded"`     // 是否计入渠道/密钥指标（探测请求本身的错误不计入）
+
+	keyFailure    bool // 与生产一致判定为密钥/渠道故障（网络错误或会触发故障转移的错误响应）
+	modelNotFound bool // 上游返回“模型不存在”类错误
+}
+
+// TestChannel 绕过调度器，通过指定渠道与密钥发送一个真实的最小补全请求（"ping"，max_tokens=1）
+// 与生产请求使用相同的 provider 转换与 SendRequest，用于验证新添加的密钥是否可用于补全
+// 查询参数: keyIndex（默认 0）、model（默认 defaultProbeModel）、recordMetrics（默认 true，false 时不影响路由指标）
+func TestChannel(envCfg *config.EnvConfig, cfgManager *config.ConfigManager, sch *scheduler.ChannelScheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel ID"})
+			return
+		}
+
+		cfg := cfgManager.GetConfig()
+		if id < 0 || id >= len(cfg.Upstream) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+			return
+		}
+		upstream := cfg.Upstream[id].Clone()
+
+		keyIndex := 0
+		if raw := c.Query("keyIndex"); raw != "" {
+			if keyIndex, err = strconv.Atoi(raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid keyIndex"})
+				return
+			}
+		}
+		if keyIndex < 0 || keyIndex >= len(upstream.APIKeys) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("keyIndex out of range (channel has %d keys)", len(upstream.APIKeys))})
+			return
+		}
+
+		recordMetrics := true
+		if raw := c.Query("recordMetrics"); raw != "" {
+			if recordMetrics, err = strconv.ParseBool(raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recordMetrics"})
+				return
+			}
+		}
+
+		provider := providers.GetProvider(upstream.ServiceType)
+		if provider == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported service type: " + upstream.ServiceType})
+			return
+		}
+
+		model := c.DefaultQuery("model", defaultProbeModel)
+		apiKey := upstream.APIKeys[keyIndex]
+		upstream.BaseURL = upstream.GetEffectiveBaseURL()
+
+		result := probeChannel(c, envCfg, provider, upstream, apiKey, model, cfgManager.GetFuzzyModeEnabled())
+		result.ChannelIndex = id
+		result.KeyIndex = keyIndex
+
+		if recordMetrics && sch != nil {
+			if result.Success {
+				sch.RecordSuccessWithUsage(upstream.BaseURL, apiKey, result.Usage, false, model, 0)
+				result.MetricsRecorded = true
+			} else if result.keyFailure {
+				sch.RecordFailure(upstream.BaseURL, apiKey, false)
+				result.MetricsRecorded = true
+			}
+		}
+
+		outcome := "失败"
+		if result.Success {
+			outcome = "成功"
+		}
+		log.Printf("[Messages-Test] 渠道 [%d] %s 密钥 %s 测试%s: status=%d latency=%dms",
+			id, upstream.Name, result.Key, outcome, result.Status, result.Latency)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// probeChannel 构造最小补全请求并发送到渠道
+func probeChannel(c *gin.Context, envCfg *config.EnvConfig, provider providers.Provider, upstream *config.UpstreamConfig, apiKey, model string, fuzzyMode bool) *ChannelProbeResult {
+	result := &ChannelProbeResult{
+		ChannelName: upstream.Name,
+		Key:         utils.MaskAPIKey(apiKey),
+		BaseURL:     upstream.BaseURL,
+		Model:       config.RedirectModel(model, upstream),
+	}
+
+	probeBody, _ := json.Marshal(map[string]interface{}{
+		"model":      model,
+		"max_tokens": 1,
+		"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+	})
+	// 使用独立的请求构造 provider 请求，避免管理请求的请求头（访问密钥等）被转发给上游
+	probeReq, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, "/v1/messages", bytes.NewReader(probeBody))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	probeReq.Header.Set("Content-Type", "application/json")
+	probeReq.Header.Set("anthropic-version", "2023-06-01")
+	probeCtx := c.Copy()
+	probeCtx.Request = probeReq
+
+	providerReq, _, err := provider.ConvertToProviderRequest(probeCtx, upstream, apiKey)
+	if err != nil {
+		result.Error = "构建请求失败: " + err.Error()
+		return result
+	}
+
+	start := time.Now()
+	resp, err := common.SendRequest(providerReq, upstream, envCfg, false)
+	if err != nil {
+		result.Latency = time.Since(start).Milliseconds()
+		result.Error = err.Error()
+		result.keyFailure = true
+		return result
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	result.Latency = time.Since(start).Milliseconds()
+	result.Status = resp.StatusCode
+	if err != nil {
+		result.Error = "读取响应失败: " + err.Error()
+		return result
+	}
+	respBody = utils.DecompressGzipIfNeeded(resp, respBody)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Error = fmt.Sprintf("上游返回 HTTP %d", resp.StatusCode)
+		result.keyFailure, _ = common.ShouldRetryWithNextKeyForChannel(upstream, resp.StatusCode, respBody, fuzzyMode)
+		result.modelNotFound = common.IsModelNotFoundError(resp.StatusCode, respBody)
+		var parsed interface{}
+		if json.Unmarshal(respBody, &parsed) == nil {
+			result.ErrorBody = parsed
+		} else {
+			result.ErrorBody = string(respBody)
+		}
+		return result
+	}
+
+	claudeResp, err := provider.ConvertToClaudeResponse(&types.ProviderResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
+		Body:       respBody,
+	})
+	if err != nil {
+		result.Error = "解析响应失败: " + err.Error()
+		result.ErrorBody = string(respBody)
+		return result
+	}
+	result.Success = true
+	result.Usage = claudeResp.Usage
+	return result
+}
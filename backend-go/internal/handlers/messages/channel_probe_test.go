@@ -0,0 +1,102 @@
+package messages
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTestChannel_SendsRealProbe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var gotKey, gotModel string
+	var gotMaxTokens int
+	upstreamSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("x-api-key")
+		var body struct {
+			Model     string `json:"model"`
+			MaxTokens int    `json:"max_tokens"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+		gotModel, gotMaxTokens = body.Model, body.MaxTokens
+
+		w.Header().Set("Content-Type", "application/json")
+		if gotKey == "sk-ant-bad-key-0000000000" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"p"}],"usage":{"input_tokens":8,"output_tokens":1}}`))
+	}))
+	defer upstreamSrv.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name:         "claude",
+			BaseURL:      upstreamSrv.URL,
+			APIKeys:      []string{"sk-ant-good-key-111111111", "sk-ant-bad-key-0000000000"},
+			ServiceType:  "claude",
+			ModelMapping: map[string]string{"probe": "claude-3-haiku"},
+		}},
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	r := gin.New()
+	r.POST("/api/messages/channels/:id/test", TestChannel(&config.EnvConfig{RequestTimeout: 5000}, cfgManager, sch))
+	probe := func(query string) (int, ChannelProbeResult) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/messages/channels/0/test"+query, nil))
+		var result ChannelProbeResult
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+	requestCount := func(key string) int64 {
+		m := sch.GetMessagesMetricsManager().GetKeyMetrics(upstreamSrv.URL, key)
+		if m == nil {
+			return 0
+		}
+		return m.RequestCount
+	}
+
+	code, result := probe("?model=probe")
+	if code != http.StatusOK || !result.Success || result.Status != 200 {
+		t.Fatalf("code=%d result=%+v", code, result)
+	}
+	if gotKey != "sk-ant-good-key-111111111" || gotModel != "claude-3-haiku" || gotMaxTokens != 1 {
+		t.Fatalf("上游收到 key=%q model=%q max_tokens=%d", gotKey, gotModel, gotMaxTokens)
+	}
+	if result.Usage == nil || result.Usage.InputTokens != 8 || result.Usage.OutputTokens != 1 {
+		t.Fatalf("usage = %+v", result.Usage)
+	}
+	if !result.MetricsRecorded || requestCount("sk-ant-good-key-111111111") != 1 {
+		t.Fatalf("默认应计入指标: recorded=%v count=%d", result.MetricsRecorded, requestCount("sk-ant-good-key-111111111"))
+	}
+
+	// 指定密钥索引 + 不计入指标
+	code, result = probe("?keyIndex=1&recordMetrics=false")
+	if code != http.StatusOK || result.Success || result.Status != http.StatusUnauthorized || result.KeyIndex != 1 {
+		t.Fatalf("code=%d result=%+v", code, result)
+	}
+	if gotKey != "sk-ant-bad-key-0000000000" {
+		t.Fatalf("应使用指定索引的密钥, got %q", gotKey)
+	}
+	if body, ok := result.ErrorBody.(map[string]interface{}); !ok || body["type"] != "error" {
+		t.Fatalf("应返回上游错误响应体: %#v", result.ErrorBody)
+	}
+	if result.MetricsRecorded || requestCount("sk-ant-bad-key-0000000000") != 0 {
+		t.Fatalf("recordMetrics=false 时不应计入指标: recorded=%v count=%d", result.MetricsRecorded, requestCount("sk-ant-bad-key-0000000000"))
+	}
+
+	if code, _ := probe("?keyIndex=5"); code != http.StatusBadRequest {
+		t.Fatalf("越界 keyIndex 应返回 400, got %d", code)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
 	"github.com/BenedictKing/claude-proxy/internal/httpclient"
 	"github.com/BenedictKing/claude-proxy/internal/scheduler"
 	"github.com/gin-gonic/gin"
@@ -30,11 +31,11 @@ func GetUpstreams(cfgManager *config.ConfigManager) gin.HandlerFunc {
 				"serviceType":        up.ServiceType,
 				"baseUrl":            up.BaseURL,
 				"baseUrls":           up.BaseURLs,
-				"apiKeys":            up.APIKeys,
+				"apiKeys":            cfgManager.APIKeyRefs(up.APIKeys),
 				"description":        up.Description,
 				"website":            up.Website,
 				"insecureSkipVerify": up.InsecureSkipVerify,
-				"modelMapping":       up.ModelMapping,
+				"modelMapping":       up.ModelMappingJSON(),
 				"latency":            nil,
 				"status":             status,
 				"priority":           priority,
@@ -172,9 +173,22 @@ func AddApiKey(cfgManager *config.ConfigManager) gin.HandlerFunc {
 	}
 }
 
-// DeleteApiKey 删除 API 密钥
+// DrainApiKey 排空 API 密钥：新请求不再使用该密钥，宽限期结束后自动删除
+func DrainApiKey(cfgManager *config.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		common.HandleDrainAPIKey(c, cfgManager.DrainAPIKey)
+	}
+}
+
+// DeleteApiKey 删除 API 密钥（?drain=true 时改为排空，可选 grace 指定宽限期秒数）
 func DeleteApiKey(cfgManager *config.ConfigManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// drain=true 时改为排空密钥：进行中的请求正常完成，宽限期结束后自动删除
+		if c.Query("drain") == "true" {
+			common.HandleDrainAPIKey(c, cfgManager.DrainAPIKey)
+			return
+		}
+
 		idStr := c.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
@@ -392,8 +406,16 @@ func PingChannel(cfgManager *config.ConfigManager) gin.HandlerFunc {
 	}
 }
 
+// defaultPingTimeout 渠道连通性测试默认超时
+const defaultPingTimeout = 5 * time.Second
+
 // pingChannelURLs 测试渠道的所有 BaseURL，返回最快的延迟
 func pingChannelURLs(ch *config.UpstreamConfig) gin.H {
+	return PingChannelURLs(ch, defaultPingTimeout)
+}
+
+// PingChannelURLs 以指定超时测试渠道的所有 BaseURL（HEAD 请求，覆盖 TCP/TLS 建连），返回最快的延迟
+func PingChannelURLs(ch *config.UpstreamConfig, timeout time.Duration) gin.H {
 	urls := ch.GetAllBaseURLs()
 	if len(urls) == 0 {
 		return gin.H{"success": false, "latency": 0, "status": "error", "error": "no_base_url"}
@@ -401,7 +423,7 @@ func pingChannelURLs(ch *config.UpstreamConfig) gin.H {
 
 	// 单个 URL 直接测试
 	if len(urls) == 1 {
-		return pingURL(urls[0], ch.InsecureSkipVerify)
+		return pingURLWithTimeout(urls[0], ch.InsecureSkipVerify, ch.ProxyURL, timeout)
 	}
 
 	// 多个 URL 并发测试，返回最快的
@@ -417,7 +439,7 @@ func pingChannelURLs(ch *config.UpstreamConfig) gin.H {
 		go func(testURL string) {
 			startTime := time.Now()
 			testURL = strings.TrimSuffix(testURL, "/")
-			client := httpclient.GetManager().GetStandardClient(5*time.Second, ch.InsecureSkipVerify)
+			client := httpclient.GetManager().GetStandardClient(timeout, ch.InsecureSkipVerify, ch.ProxyURL)
 			req, err := http.NewRequest("HEAD", testURL, nil)
 			if err != nil {
 				results <- pingResult{url: testURL, latency: 0, success: false, err: "req_creation_failed"}
@@ -461,9 +483,14 @@ func pingChannelURLs(ch *config.UpstreamConfig) gin.H {
 
 // pingURL 测试单个 URL
 func pingURL(testURL string, insecureSkipVerify bool) gin.H {
+	return pingURLWithTimeout(testURL, insecureSkipVerify, "", defaultPingTimeout)
+}
+
+// pingURLWithTimeout 以指定超时测试单个 URL（proxyURL 为空表示直连）
+func pingURLWithTimeout(testURL string, insecureSkipVerify bool, proxyURL string, timeout time.Duration) gin.H {
 	startTime := time.Now()
 	testURL = strings.TrimSuffix(testURL, "/")
-	client := httpclient.GetManager().GetStandardClient(5*time.Second, insecureSkipVerify)
+	client := httpclient.GetManager().GetStandardClient(timeout, insecureSkipVerify, proxyURL)
 	req, err := http.NewRequest("HEAD", testURL, nil)
 	if err != nil {
 		return gin.H{"success": false, "latency": 0, "status": "error", "error": "req_creation_failed"}
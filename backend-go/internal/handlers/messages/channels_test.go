@@ -223,3 +223,71 @@ func TestChannelsHandlers_CRUDAndPing(t *testing.T) {
 		}
 	})
 }
+
+func TestDrainApiKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "ch0", BaseURL: "https://ch0.example.com", APIKeys: []string{"k1", "k2", "k3"}, ServiceType: "claude", Status: "active"},
+		},
+	})
+	defer cleanupCfg()
+
+	r := gin.New()
+	r.DELETE("/channels/:id/keys/:apiKey", DeleteApiKey(cfgManager))
+	r.POST("/channels/:id/keys/:apiKey/drain", DrainApiKey(cfgManager))
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := do(http.MethodPost, "/channels/0/keys/k1/drain?grace=120")
+	if w.Code != http.StatusOK {
+		t.Fatalf("drain status = %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Status   string    `json:"status"`
+		RemoveAt time.Time `json:"removeAt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Status != "draining" || time.Until(resp.RemoveAt) > 2*time.Minute || time.Until(resp.RemoveAt) <= 0 {
+		t.Fatalf("resp = %+v, want draining with removeAt ~2m", resp)
+	}
+
+	// DELETE ?drain=true 同样排空而非立即删除
+	if w := do(http.MethodDelete, "/channels/0/keys/k2?drain=true"); w.Code != http.StatusOK {
+		t.Fatalf("delete drain status = %d, body=%s", w.Code, w.Body.String())
+	}
+
+	upstream := cfgManager.GetConfig().Upstream[0]
+	if len(upstream.APIKeys) != 3 || !upstream.IsKeyDraining("k1") || !upstream.IsKeyDraining("k2") || upstream.IsKeyDraining("k3") {
+		t.Fatalf("upstream = %+v, want k1/k2 draining and all keys kept", upstream)
+	}
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/channels/x/keys/k3/drain", http.StatusBadRequest},
+		{"/channels/0/keys/k3/drain?grace=-1", http.StatusBadRequest},
+		{"/channels/9/keys/k3/drain", http.StatusNotFound},
+		{"/channels/0/keys/missing/drain", http.StatusNotFound},
+	} {
+		if w := do(http.MethodPost, tc.path); w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.path, w.Code, tc.want)
+		}
+	}
+
+	// 不带 drain 参数时仍立即删除
+	if w := do(http.MethodDelete, "/channels/0/keys/k3"); w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", w.Code)
+	}
+	if keys := cfgManager.GetConfig().Upstream[0].APIKeys; len(keys) != 2 {
+		t.Fatalf("keys = %v, want k3 removed immediately", keys)
+	}
+}
@@ -0,0 +1,219 @@
+package messages
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/billing"
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/converters"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/monitor"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// NewChatCompletionsHandler 创建 OpenAI Chat Completions 入口处理器（POST /v1/chat/completions）
+// 请求转换为 Claude Messages 后复用 Messages 处理流程（Messages 渠道调度、故障转移、指标、计费），
+// 因此可路由到 providers.GetProvider 支持的所有 Messages 渠道类型（claude/openai/gemini/responses）
+func NewChatCompletionsHandler(
+	envCfg *config.EnvConfig,
+	cfgManager *config.ConfigManager,
+	channelScheduler *scheduler.ChannelScheduler,
+	billingClient *billing.Client,
+	billingHandler *billing.Handler,
+	liveRequestManager *monitor.LiveRequestManager,
+	sqliteStore *metrics.SQLiteStore,
+) gin.HandlerFunc {
+	h := &Handler{
+		envCfg:             envCfg,
+		cfgManager:         cfgManager,
+		channelScheduler:   channelScheduler,
+		billingClient:      billingClient,
+		billingHandler:     billingHandler,
+		liveRequestManager: liveRequestManager,
+		sqliteStore:        sqliteStore,
+	}
+	return h.HandleChatCompletions
+}
+
+// HandleChatCompletions Chat Completions 代理处理器
+// 非流式响应复用 Accept 头响应格式协商输出 chat.completion；流式响应由 chatCompletionsWriter
+// 将 Claude SSE 转换为 chat.completion.chunk（stream_options.include_usage 为 true 时附带 usage 块）；
+// 处理流程写入的非 2xx 响应（认证失败、维护模式、模型拒绝、渠道全部失败等）统一转换为 OpenAI 错误格式
+func (h *Handler) HandleChatCompletions(c *gin.Context) {
+	w := &chatCompletionsWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	defer w.flushError()
+
+	if !h.authenticate(c) {
+		return
+	}
+
+	body, err := common.ReadRequestBody(c, h.cfgManager.GetRequestBodyReadLimit(h.envCfg.MaxRequestBodySize), h.channelScheduler.GetMessagesMetricsManager())
+	if err != nil {
+		return
+	}
+	claudeReq, err := converters.OpenAIChatRequestToClaude(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, chatCompletionsError("invalid_request_error", err.Error()))
+		return
+	}
+	claudeBody, err := json.Marshal(claudeReq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, chatCompletionsError("api_error", err.Error()))
+		return
+	}
+	common.RestoreRequestBody(c, claudeBody)
+	c.Request.ContentLength = int64(len(claudeBody))
+	c.Request.Header.Set("Accept", "application/vnd.openai+json")
+
+	if gjson.GetBytes(body, "stream").Bool() {
+		w.converter = converters.NewClaudeToOpenAIChatStreamConverter(gjson.GetBytes(body, "stream_options.include_usage").Bool())
+	}
+	h.serve(c, claudeBody)
+}
+
+// chatCompletionsError 构建 OpenAI 格式错误响应
+func chatCompletionsError(errType, message string) gin.H {
+	return gin.H{"error": gin.H{"type": errType, "message": message, "param": nil, "code": nil}}
+}
+
+// chatOpenAIErrorType 按 HTTP 状态码推断 OpenAI 错误类型（原始错误未携带类型时使用）
+func chatOpenAIErrorType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusNotFound:
+		return "not_found_error"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status < http.StatusInternalServerError:
+		return "invalid_request_error"
+	default:
+		return "api_error"
+	}
+}
+
+// convertErrorToOpenAIChat 将任意错误响应体转换为 OpenAI 错误格式 {"error":{"message","type","param","code"}}
+// 兼容 Claude 格式 {"type":"error","error":{...}}、代理内部格式 {"error":"...","code":"..."} 及非 JSON 文本
+func convertErrorToOpenAIChat(status int, body []byte) gin.H {
+	message := strings.TrimSpace(string(body))
+	errType := chatOpenAIErrorType(status)
+	var param, code any
+
+	if parsed := gjson.ParseBytes(body); gjson.ValidBytes(body) && parsed.IsObject() {
+		if v := parsed.Get("code"); v.Exists() {
+			code = v.Value()
+		}
+		errField := parsed.Get("error")
+		switch {
+		case errField.IsObject():
+			if v := errField.Get("message"); v.Exists() {
+				message = v.String()
+			}
+			if v := errField.Get("type"); v.String() != "" {
+				errType = v.String()
+			}
+			if v := errField.Get("param"); v.Exists() {
+				param = v.Value()
+			}
+			if v := errField.Get("code"); v.Exists() {
+				code = v.Value()
+			}
+		case errField.Type == gjson.String:
+			message = errField.String()
+		case parsed.Get("message").Exists():
+			message = parsed.Get("message").String()
+		}
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return gin.H{"error": gin.H{"type": errType, "message": message, "param": param, "code": code}}
+}
+
+// chatCompletionsWriter 将 Messages 处理流程的输出转换为 Chat Completions 格式后写入客户端
+// - 非 2xx 响应体先缓冲，处理结束后由 flushError 统一转换为 OpenAI 错误格式
+// - 流式请求（converter 非空）的 text/event-stream 响应按事件转换为 chat.completion.chunk，
+// 事件按空行分隔，跨多次写入的事件会先缓冲
+// - 其余响应（非流式 chat.completion）原样透传
+type chatCompletionsWriter struct {
+	gin.ResponseWriter
+	converter *converters.ClaudeToOpenAIChatStreamConverter
+	pending   bytes.Buffer
+	errBody   bytes.Buffer
+}
+
+func (w *chatCompletionsWriter) Write(data []byte) (int, error) {
+	if status := w.Status(); status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return w.errBody.Write(data)
+	}
+	if w.converter == nil || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.pending.Write(data)
+	for {
+		buffered := w.pending.Bytes()
+		end := bytes.Index(buffered, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		event := string(buffered[:end+2])
+		w.pending.Next(end + 2)
+		for _, out := range w.convertEvent(event) {
+			if _, err := w.ResponseWriter.Write([]byte(out)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(data), nil
+}
+
+func (w *chatCompletionsWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written 缓冲中的错误响应视为已写入，避免处理流程重复写入错误
+func (w *chatCompletionsWriter) Written() bool {
+	return w.errBody.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// flushError 将缓冲的非 2xx 响应体转换为 OpenAI 错误格式后写入客户端
+func (w *chatCompletionsWriter) flushError() {
+	if w.errBody.Len() == 0 {
+		return
+	}
+	converted, err := json.Marshal(convertErrorToOpenAIChat(w.Status(), w.errBody.Bytes()))
+	if err != nil {
+		converted = w.errBody.Bytes()
+	}
+	w.errBody.Reset()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Del("Content-Length")
+	_, _ = w.ResponseWriter.Write(converted)
+}
+
+// convertEvent 转换单个 SSE 事件；没有 data 行的事件（如心跳注释）原样透传
+func (w *chatCompletionsWriter) convertEvent(event string) []string {
+	var eventType string
+	var data []string
+	for _, line := range strings.Split(event, "\n") {
+		if v, ok := strings.CutPrefix(line, "event:"); ok {
+			eventType = strings.TrimSpace(v)
+		} else if v, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimSpace(v))
+		}
+	}
+	if len(data) == 0 {
+		return []string{event}
+	}
+	return w.converter.ProcessEvent(eventType, []byte(strings.Join(data, "\n")))
+}
@@ -0,0 +1,308 @@
+package messages
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func newChatCompletionsTestRouter(t *testing.T, upstreamURL string) (*gin.Engine, *config.EnvConfig) {
+	t.Helper()
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "claude", BaseURL: upstreamURL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active",
+		}},
+	})
+	t.Cleanup(cleanupCfg)
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	t.Cleanup(cleanupSch)
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/chat/completions", NewChatCompletionsHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+	return r, envCfg
+}
+
+func TestChatCompletions_NonStreamToolCall(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var gotBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3","stop_reason":"tool_use",
+			"content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],
+			"usage":{"input_tokens":20,"output_tokens":7}}`))
+	}))
+	defer upstream.Close()
+
+	r, envCfg := newChatCompletionsTestRouter(t, upstream.URL)
+	reqBody := `{"model":"claude-3","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"weather?"}],
+		"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}],
+		"tool_choice":"required"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(reqBody))
+	req.Header.Set("Authorization", "Bearer "+envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	upstreamReq := gjson.ParseBytes(gotBody)
+	if upstreamReq.Get("system").String() != "be brief" || upstreamReq.Get("tool_choice.type").String() != "any" ||
+		upstreamReq.Get("tools.0.input_schema.properties.city.type").String() != "string" || upstreamReq.Get("max_tokens").Int() == 0 {
+		t.Fatalf("upstream request = %s", gotBody)
+	}
+
+	resp := gjson.Parse(w.Body.String())
+	if resp.Get("object").String() != "chat.completion" || resp.Get("choices.0.finish_reason").String() != "tool_calls" {
+		t.Fatalf("response = %s", w.Body.String())
+	}
+	call := resp.Get("choices.0.message.tool_calls.0")
+	if call.Get("id").String() != "toolu_1" || call.Get("function.name").String() != "get_weather" ||
+		gjson.Get(call.Get("function.arguments").String(), "city").String() != "Paris" {
+		t.Fatalf("tool call = %s", call.Raw)
+	}
+	if resp.Get("usage.prompt_tokens").Int() != 20 || resp.Get("usage.completion_tokens").Int() != 7 {
+		t.Fatalf("usage = %s", resp.Get("usage").Raw)
+	}
+}
+
+func TestChatCompletions_RoutesToResponsesChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var gotPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","status":"completed","output":[` +
+			`{"type":"message","role":"assistant","content":[{"type":"output_text","text":"hello"}]}],` +
+			`"usage":{"input_tokens":5,"output_tokens":2}}`))
+	}))
+	defer upstream.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "resp", BaseURL: upstream.URL, APIKeys: []string{"k1"}, ServiceType: "responses", Status: "active",
+		}},
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/chat/completions", NewChatCompletionsHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(`{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer "+envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || gotPath != "/v1/responses" {
+		t.Fatalf("status = %d, path = %s, body = %s", w.Code, gotPath, w.Body.String())
+	}
+	if got := gjson.Get(w.Body.String(), "choices.0.message.content").String(); got != "hello" {
+		t.Fatalf("content = %q, response = %s", got, w.Body.String())
+	}
+}
+
+func TestChatCompletions_StreamWithUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range []string{
+			"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_s\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"claude-3\",\"content\":[],\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n",
+			"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}\n\n",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"lo\"}}\n\n",
+			"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n",
+			"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":5}}\n\n",
+			"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+		} {
+			_, _ = w.Write([]byte(e))
+		}
+	}))
+	defer upstream.Close()
+
+	r, envCfg := newChatCompletionsTestRouter(t, upstream.URL)
+	reqBody := `{"model":"claude-3","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(reqBody))
+	req.Header.Set("Authorization", "Bearer "+envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var content strings.Builder
+	var finishReason string
+	var usage gjson.Result
+	var sawDone bool
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			if strings.HasPrefix(line, "event:") {
+				t.Fatalf("Claude event leaked into chat stream: %q", line)
+			}
+			continue
+		}
+		if data == "[DONE]" {
+			sawDone = true
+			continue
+		}
+		chunk := gjson.Parse(data)
+		if chunk.Get("object").String() != "chat.completion.chunk" {
+			t.Fatalf("unexpected chunk: %s", data)
+		}
+		content.WriteString(chunk.Get("choices.0.delta.content").String())
+		if fr := chunk.Get("choices.0.finish_reason").String(); fr != "" {
+			finishReason = fr
+		}
+		if chunk.Get("usage").Exists() {
+			usage = chunk.Get("usage")
+		}
+	}
+	if content.String() != "Hello" || finishReason != "stop" || !sawDone {
+		t.Fatalf("content=%q finish=%q done=%v body=%s", content.String(), finishReason, sawDone, w.Body.String())
+	}
+	if usage.Get("prompt_tokens").Int() != 12 || usage.Get("completion_tokens").Int() != 5 {
+		t.Fatalf("usage = %s", usage.Raw)
+	}
+}
+
+func TestChatCompletions_InvalidRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r, envCfg := newChatCompletionsTestRouter(t, "http://127.0.0.1:1")
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(`{"model":"claude-3","messages":[]}`))
+	req.Header.Set("Authorization", "Bearer "+envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if w.Code != http.StatusBadRequest || json.Unmarshal(w.Body.Bytes(), &resp) != nil || resp.Error.Type != "invalid_request_error" {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestChatCompletions_ModelNotAllowedUsesOpenAIError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "claude", BaseURL: "http://127.0.0.1:1", APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active",
+		}},
+		AllowedModels: []string{"claude-sonnet-*"},
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/chat/completions", NewChatCompletionsHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer "+envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	resp := gjson.Parse(w.Body.String())
+	if w.Code != http.StatusForbidden || resp.Get("type").Exists() ||
+		resp.Get("error.type").String() != "permission_error" || !strings.Contains(resp.Get("error.message").String(), "gpt-4o") ||
+		!resp.Get("error.param").Exists() || !resp.Get("error.code").Exists() {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestChatCompletions_MaintenanceUsesOpenAIError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r, envCfg := newChatCompletionsTestRouter(t, "http://127.0.0.1:1")
+	common.EnableMaintenance("upgrading", 30)
+	defer common.DisableMaintenance()
+
+	for _, stream := range []bool{false, true} {
+		reqBody := `{"model":"claude-3","stream":` + strconv.FormatBool(stream) + `,"messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(reqBody))
+		req.Header.Set("Authorization", "Bearer "+envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		resp := gjson.Parse(w.Body.String())
+		if w.Code != http.StatusServiceUnavailable || resp.Get("type").Exists() ||
+			resp.Get("error.type").String() != "overloaded_error" || resp.Get("error.message").String() != "upgrading" {
+			t.Fatalf("stream=%v status = %d, body = %s", stream, w.Code, w.Body.String())
+		}
+		if w.Header().Get("Retry-After") != "30" {
+			t.Fatalf("stream=%v Retry-After = %q", stream, w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestChatCompletions_AllChannelsFailedUsesOpenAIError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"upstream overloaded"}}`))
+	}))
+	defer upstream.Close()
+
+	r, envCfg := newChatCompletionsTestRouter(t, upstream.URL)
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"claude-3","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer "+envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	resp := gjson.Parse(w.Body.String())
+	if w.Code < http.StatusBadRequest || resp.Get("type").Exists() || !resp.Get("error").IsObject() ||
+		resp.Get("error.type").String() == "" || resp.Get("error.message").String() == "" {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestConvertErrorToOpenAIChat(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantType string
+		wantMsg  string
+		wantCode string
+	}{
+		{"claude", 403, `{"type":"error","error":{"type":"permission_error","message":"denied"}}`, "permission_error", "denied", ""},
+		{"proxy", 503, `{"error":"no channel","code":"NO_CHANNEL_FOR_MODEL"}`, "api_error", "no channel", "NO_CHANNEL_FOR_MODEL"},
+		{"openai", 400, `{"error":{"type":"invalid_request_error","message":"bad","code":"x"}}`, "invalid_request_error", "bad", "x"},
+		{"text", 401, `Unauthorized`, "authentication_error", "Unauthorized", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _ := json.Marshal(convertErrorToOpenAIChat(tt.status, []byte(tt.body)))
+			resp := gjson.ParseBytes(out)
+			if resp.Get("error.type").String() != tt.wantType || resp.Get("error.message").String() != tt.wantMsg ||
+				resp.Get("error.code").String() != tt.wantCode {
+				t.Fatalf("converted = %s", out)
+			}
+		})
+	}
+}
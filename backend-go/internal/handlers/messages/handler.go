@@ -12,7 +12,9 @@ import (
 
 	"github.com/BenedictKing/claude-proxy/internal/billing"
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/converters"
 	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/BenedictKing/claude-proxy/internal/logger"
 	"github.com/BenedictKing/claude-proxy/internal/metrics"
 	"github.com/BenedictKing/claude-proxy/internal/middleware"
 	"github.com/BenedictKing/claude-proxy/internal/monitor"
@@ -21,7 +23,6 @@ import (
 	"github.com/BenedictKing/claude-proxy/internal/types"
 	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type requestLogContext struct {
@@ -61,6 +62,14 @@ func (r *requestLogContext) updateLive() {
 	})
 }
 
+// logRequestID 返回结构化日志使用的请求 ID（reqCtx 可能为 nil）
+func (r *requestLogContext) logRequestID() string {
+	if r == nil {
+		return ""
+	}
+	return r.requestID
+}
+
 func truncateErrorMessage(msg string) string {
 	const maxLen = 1024
 	if len(msg) <= maxLen {
@@ -135,24 +144,50 @@ func NewHandler(
 // Handle Messages API 代理处理器
 // 支持多渠道调度：当配置多个渠道时自动启用
 func (h *Handler) Handle(c *gin.Context) {
+	if !h.authenticate(c) {
+		return
+	}
+	h.serve(c, nil)
+}
+
+// authenticate 认证：计费模式使用 BillingAuthMiddleware，否则使用 ProxyAuthMiddleware
+func (h *Handler) authenticate(c *gin.Context) bool {
+	if h.envCfg.IsBillingEnabled() && h.billingClient != nil {
+		middleware.BillingAuthMiddleware(h.envCfg, h.billingClient)(c)
+	} else {
+		middleware.ProxyAuthMiddleware(h.envCfg)(c)
+	}
+	return !c.IsAborted()
+}
+
+// serve 处理已认证的 Messages 请求
+// bodyBytes 非 nil 时使用调用方已读取的请求体（如 Chat Completions 转换后的请求），不再读取或落盘
+func (h *Handler) serve(c *gin.Context, bodyBytes []byte) {
 	envCfg := h.envCfg
 	cfgManager := h.cfgManager
 	channelScheduler := h.channelScheduler
-	billingClient := h.billingClient
 	billingHandler := h.billingHandler
 
-	// 认证：计费模式使用 BillingAuthMiddleware，否则使用 ProxyAuthMiddleware
-	if envCfg.IsBillingEnabled() && billingClient != nil {
-		middleware.BillingAuthMiddleware(envCfg, billingClient)(c)
-	} else {
-		middleware.ProxyAuthMiddleware(envCfg)(c)
+	// 请求级日志级别（X-Proxy-Log-Level），仅影响本次请求
+	envCfg = common.RequestEnvConfig(c, envCfg)
+
+	// 维护模式：直接返回 503，不进入渠道故障转移
+	if !common.CheckMaintenance(c) {
+		return
 	}
-	if c.IsAborted() {
+
+	// 成本预算：超过硬上限直接拒绝，超过软上限仅告警
+	if !common.CheckCostBudget(c, "messages") {
 		return
 	}
 
 	startTime := time.Now()
-	requestID := uuid.New().String()
+	requestID := middleware.GetRequestID(c)
+
+	// 请求诊断（X-Proxy-Debug），通过 Trailer 返回
+	if common.StartDiagnostics(c) != nil {
+		defer common.WriteDiagnosticsTrailer(c)
+	}
 
 	reqCtx := &requestLogContext{
 		requestID:          requestID,
@@ -166,6 +201,9 @@ func (h *Handler) Handle(c *gin.Context) {
 		defer h.liveRequestManager.EndRequest(requestID)
 	}
 
+	// 请求结束后上报 usage，供限流中间件计入 token 预算
+	defer func() { middleware.ReportUsage(c, reqCtx.usage) }()
+
 	defer func() {
 		if h.sqliteStore == nil {
 			return
@@ -233,12 +271,24 @@ func (h *Handler) Handle(c *gin.Context) {
 		}
 	}()
 
-	// 读取请求体
-	bodyBytes, err := common.ReadRequestBody(c, envCfg.MaxRequestBodySize)
-	if err != nil {
-		reqCtx.success = false
-		reqCtx.errorMsg = truncateErrorMessage(err.Error())
-		return
+	// 大请求体落盘透传（REQUEST_BODY_SPOOL_THRESHOLD_MB）：满足条件时不在内存中缓冲整个请求体
+	if bodyBytes == nil {
+		var handled bool
+		bodyBytes, handled = trySpooledRequest(c, envCfg, cfgManager, channelScheduler, startTime, billingHandler, billingCtx, reqCtx)
+		if handled {
+			return
+		}
+	}
+
+	// 读取请求体（上限取全局与各渠道 maxRequestBodySize 的最大值，超出全局上限的请求由调度器路由）
+	if bodyBytes == nil {
+		var err error
+		bodyBytes, err = common.ReadRequestBody(c, cfgManager.GetRequestBodyReadLimit(envCfg.MaxRequestBodySize), channelScheduler.GetMessagesMetricsManager())
+		if err != nil {
+			reqCtx.success = false
+			reqCtx.errorMsg = truncateErrorMessage(err.Error())
+			return
+		}
 	}
 
 	// 解析请求
@@ -250,12 +300,22 @@ func (h *Handler) Handle(c *gin.Context) {
 	reqCtx.isStreaming = claudeReq.Stream
 	reqCtx.updateLive()
 
+	// 全局模型准入：被拒绝的模型直接返回 403，不联系上游
+	if !common.CheckModelAllowed(c, cfgManager, "Messages", claudeReq.Model) {
+		reqCtx.success = false
+		reqCtx.errorMsg = "model not allowed"
+		return
+	}
+
 	// 提取 user_id 用于 Trace 亲和性
 	userID := common.ExtractUserID(bodyBytes)
 
 	// 记录原始请求信息（仅在入口处记录一次）
 	common.LogOriginalRequest(c, bodyBytes, envCfg, "Messages")
 
+	// 异步复制请求到影子渠道（不影响主请求）
+	dispatchShadowRequests(c, envCfg, cfgManager, channelScheduler, bodyBytes, claudeReq)
+
 	// 检查是否为多渠道模式
 	isMultiChannel := channelScheduler.IsMultiChannelMode(false)
 
@@ -281,13 +341,38 @@ func handleMultiChannel(
 	reqCtx *requestLogContext,
 ) {
 	failedChannels := make(map[int]bool)
+	// 主渠道：本次请求首个选中的渠道，故障转移后成功时与其比较成本
+	primaryIndex := -1
+	var primaryUpstream *config.UpstreamConfig
 	var lastError error
 	var lastFailoverError *common.FailoverError
+	failoverDelay := common.NewChannelFailoverDelay(c, envCfg, "Messages")
 
 	maxChannelAttempts := channelScheduler.GetActiveChannelCount(false)
 
+	selectionCtx := common.BuildSelectionContext(c, cfgManager, claudeReq.Model)
+	selectionCtx = scheduler.WithRequestBodySize(selectionCtx, int64(len(bodyBytes)), envCfg.MaxRequestBodySize)
+	selectionCtx = scheduler.WithTokenEstimator(selectionCtx, func() (int, int) {
+		return utils.EstimateRequestTokens(bodyBytes), claudeReq.MaxTokens
+	})
 	for channelAttempt := 0; channelAttempt < maxChannelAttempts; channelAttempt++ {
-		selection, err := channelScheduler.SelectChannel(c.Request.Context(), userID, failedChannels, false)
+		// 渠道级故障转移同样消耗全局重试预算，预算耗尽时直接返回最后一次失败
+		if channelAttempt > 0 && !channelScheduler.AllowRetry() {
+			log.Printf("[Messages-RetryBudget] 警告: 全局重试预算已耗尽，停止渠道故障转移 (已尝试 %d 个渠道)", channelAttempt)
+			if lastError == nil {
+				lastError = fmt.Errorf("retry budget exhausted")
+			}
+			break
+		}
+		if common.FailoverSlotDenied(c) {
+			log.Printf("[Messages-FailoverLimit] 警告: 全局故障转移并发已满，停止渠道故障转移 (已尝试 %d 个渠道)", channelAttempt)
+			break
+		}
+		if !failoverDelay.BeginChannel() {
+			lastError = fmt.Errorf("client disconnected during failover delay")
+			break
+		}
+		selection, err := channelScheduler.SelectChannel(selectionCtx, userID, failedChannels, false)
 		if err != nil {
 			lastError = err
 			break
@@ -295,6 +380,9 @@ func handleMultiChannel(
 
 		upstream := selection.Upstream
 		channelIndex := selection.ChannelIndex
+		if primaryUpstream == nil {
+			primaryIndex, primaryUpstream = channelIndex, upstream
+		}
 		if reqCtx != nil {
 			reqCtx.channelIndex = channelIndex
 			reqCtx.channelName = upstream.Name
@@ -312,10 +400,16 @@ func handleMultiChannel(
 			if selection.Reason == "trace_affinity" {
 				channelScheduler.UpdateTraceAffinity(userID)
 			}
+			channelScheduler.RecordIPAffinity(selectionCtx, userID, channelIndex)
+			channelScheduler.RecordCacheAffinity(userID, channelIndex)
+			if reqCtx != nil {
+				channelScheduler.RecordFailoverCost("messages", primaryIndex, primaryUpstream, channelIndex, upstream, claudeReq.Model, reqCtx.usage)
+			}
 			return
 		}
 
 		failedChannels[channelIndex] = true
+		failoverDelay.ChannelFailed()
 
 		if failoverErr != nil {
 			lastFailoverError = failoverErr
@@ -353,23 +447,54 @@ func tryChannelWithAllKeys(
 	billingCtx *billing.RequestContext,
 	reqCtx *requestLogContext,
 ) (bool, string, int, *common.FailoverError) {
+	success, apiKey, baseURLIdx, failoverErr, _ := tryChannelKeys(c, envCfg, cfgManager, channelScheduler, upstream, channelIndex, newUpstreamBody(bodyBytes), claudeReq, startTime, billingHandler, billingCtx, reqCtx)
+	return success, apiKey, baseURLIdx, failoverErr
+}
+
+// tryChannelKeys 渠道内的密钥/BaseURL 故障转移循环（多渠道、单渠道与落盘透传共用）
+// body 为内存请求体或落盘请求体；返回: success, successKey, successBaseURLIdx, failoverError, lastError（最后一次非上游响应类错误）
+func tryChannelKeys(
+	c *gin.Context,
+	envCfg *config.EnvConfig,
+	cfgManager *config.ConfigManager,
+	channelScheduler *scheduler.ChannelScheduler,
+	upstream *config.UpstreamConfig,
+	channelIndex int,
+	body *upstreamBody,
+	claudeReq types.ClaudeRequest,
+	startTime time.Time,
+	billingHandler *billing.Handler,
+	billingCtx *billing.RequestContext,
+	reqCtx *requestLogContext,
+) (bool, string, int, *common.FailoverError, error) {
 	if len(upstream.APIKeys) == 0 {
-		return false, "", 0, nil
+		return false, "", 0, nil, nil
 	}
 
 	provider := providers.GetProvider(upstream.ServiceType)
 	if provider == nil {
-		return false, "", 0, nil
+		return false, "", 0, nil, nil
 	}
+	// 渠道日志采样：未命中时本次请求在该渠道上不记录请求/响应体
+	envCfg = common.ChannelEnvConfig(c, envCfg, upstream)
 
 	metricsManager := channelScheduler.GetMessagesMetricsManager()
 	baseURLs := upstream.GetAllBaseURLs()
+	bodyBytes := body.original
+	body.prepare(c, cfgManager, upstream, claudeReq.Model)
 
 	// 获取动态排序后的 URL 列表（非阻塞，立即返回）
 	sortedURLResults := channelScheduler.GetSortedURLsForChannel(channelIndex, baseURLs)
 
+	var lastError error
 	var lastFailoverError *common.FailoverError
+	sentAttempts := 0
 	deprioritizeCandidates := make(map[string]bool)
+	paramStripped := false // 每个渠道最多剥离一次参数并重试
+	paramRetryKey := ""
+	// 模型映射候选链：上游返回“模型不存在”时在同一渠道内依次尝试下一个映射目标
+	mappingSource, mappingTargets := upstream.ModelMappingTargets(claudeReq.Model)
+	mappingIdx := 0
 
 	// 强制探测模式
 	forceProbeMode := common.AreAllKeysSuspended(metricsManager, upstream.BaseURL, upstream.APIKeys)
@@ -385,11 +510,15 @@ func tryChannelWithAllKeys(
 		maxRetries := len(upstream.APIKeys)
 
 		for attempt := 0; attempt < maxRetries; attempt++ {
-			common.RestoreRequestBody(c, bodyBytes)
-
-			// 按优先级顺序选择下一个可用 Key
-			apiKey, err := cfgManager.GetNextAPIKey(upstream, failedKeys)
-			if err != nil {
+			body.restore(c)
+
+			// 参数剥离后在同一 Key 上重试，否则按优先级顺序选择下一个可用 Key
+			var apiKey string
+			var err error
+			if paramRetryKey != "" {
+				apiKey, paramRetryKey = paramRetryKey, ""
+			} else if apiKey, err = cfgManager.GetNextAPIKey(upstream, failedKeys); err != nil {
+				lastError = err
 				break // 当前 BaseURL 没有可用 Key，尝试下一个 BaseURL
 			}
 			if reqCtx != nil {
@@ -407,14 +536,23 @@ func tryChannelWithAllKeys(
 			}
 
 			if envCfg.ShouldLog("info") {
-				log.Printf("[Messages-Key] 使用API密钥: %s (BaseURL %d/%d, 尝试 %d/%d)", utils.MaskAPIKey(apiKey), sortedIdx+1, len(sortedURLResults), attempt+1, maxRetries)
+				logger.Info("Messages-Key", "使用API密钥",
+					logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+					logger.F("base_url", fmt.Sprintf("%d/%d", sortedIdx+1, len(sortedURLResults))),
+					logger.F("attempt", fmt.Sprintf("%d/%d", attempt+1, maxRetries)), logger.F("request_id", reqCtx.logRequestID()))
 			}
 
 			// 使用深拷贝避免并发修改问题
 			upstreamCopy := upstream.Clone()
 			upstreamCopy.BaseURL = currentBaseURL
+			if mappingIdx > 0 {
+				upstreamCopy.UseModelMappingTarget(mappingSource, mappingTargets[mappingIdx])
+			}
 
 			providerReq, _, err := provider.ConvertToProviderRequest(c, upstreamCopy, apiKey)
+			if err == nil {
+				err = body.attach(providerReq)
+			}
 
 			if err != nil {
 				if asClientError(err) != nil {
@@ -423,7 +561,7 @@ func tryChannelWithAllKeys(
 						reqCtx.errorMsg = truncateErrorMessage(err.Error())
 					}
 					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-					return true, "", 0, nil
+					return true, "", 0, nil, nil
 				}
 
 				log.Printf("[Messages-Convert] ConvertToProviderRequest 失败: %v", err)
@@ -432,17 +570,38 @@ func tryChannelWithAllKeys(
 					reqCtx.errorMsg = truncateErrorMessage(err.Error())
 				}
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert request"})
-				return true, "", 0, nil
+				return true, "", 0, nil, nil
 			}
 
-			resp, err := common.SendRequest(providerReq, upstream, envCfg, claudeReq.Stream)
+			// 同一渠道内的 Key/BaseURL 重试受全局重试预算限制
+			if sentAttempts > 0 && !channelScheduler.AllowRetry() {
+				log.Printf("[Messages-RetryBudget] 警告: 全局重试预算已耗尽，停止渠道 %s 内的重试", upstream.Name)
+				return false, "", 0, lastFailoverError, lastError
+			}
+			// 故障转移尝试受全局并发上限限制，避免上游大面积故障时的惊群
+			releaseSlot, ok := common.AcquireFailoverSlot(c, channelScheduler)
+			if !ok {
+				log.Printf("[Messages-FailoverLimit] 警告: 全局故障转移并发已满，停止渠道 %s 内的重试", upstream.Name)
+				return false, "", 0, lastFailoverError, lastError
+			}
+			sentAttempts++
+
+			attemptStart := time.Now()
+			resp, err := common.SendRequestForModel(providerReq, upstream, envCfg, claudeReq.Stream, claudeReq.Model)
+			releaseSlot()
+			common.RecordUpstreamAttempt(c, channelIndex, upstream.Name, apiKey, resp, err, time.Since(attemptStart))
+			resp = common.CaptureUpstreamExchange(c, "messages", upstream, apiKey, bodyBytes, providerReq, resp, err)
 			if err != nil {
+				lastError = err
 				failedKeys[apiKey] = true
 				cfgManager.MarkKeyAsFailed(apiKey)
 				channelScheduler.RecordFailure(currentBaseURL, apiKey, false)
 				// 网络错误（超时等）触发 URL 动态降级
 				channelScheduler.MarkURLFailure(channelIndex, currentBaseURL)
-				log.Printf("[Messages-Key] 警告: API密钥失败: %v", err)
+				logger.Warn("Messages-Key", "API密钥失败",
+					logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+					logger.F("latency_ms", time.Since(attemptStart).Milliseconds()), logger.F("error", err.Error()),
+					logger.F("request_id", reqCtx.logRequestID()))
 				continue
 			}
 
@@ -451,15 +610,52 @@ func tryChannelWithAllKeys(
 				resp.Body.Close()
 				respBodyBytes = utils.DecompressGzipIfNeeded(resp, respBodyBytes)
 
-				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKey(resp.StatusCode, respBodyBytes, cfgManager.GetFuzzyModeEnabled())
-				log.Printf("[Messages-Failover] ShouldRetryWithNextKey: statusCode=%d, shouldFailover=%v, isQuotaRelated=%v", resp.StatusCode, shouldFailover, isQuotaRelated)
+				// 参数类 400 错误：删除被拒绝的参数后在同一 Key 上重试一次（故障转移到其他 Key 同样会被拒绝）
+				if !paramStripped {
+					if params := body.stripRejectedParameters(cfgManager, resp.StatusCode, respBodyBytes); len(params) > 0 {
+						log.Printf("[Messages-ParamStrip] 渠道 %s 上游拒绝参数 %v，已删除并使用同一密钥 %s 重试", upstream.Name, params, utils.MaskAPIKey(apiKey))
+						paramStripped = true
+						paramRetryKey = apiKey
+						attempt--
+						continue
+					}
+				}
+
+				// 映射目标模型在该渠道不存在：改写为候选链中的下一个模型，在同一 Key 上重试
+				if mappingIdx+1 < len(mappingTargets) && common.IsModelNotFoundError(resp.StatusCode, respBodyBytes) {
+					log.Printf("[Messages-ModelMapping] 渠道 %s 不支持映射模型 %s，改用候选模型 %s 重试", upstream.Name, mappingTargets[mappingIdx], mappingTargets[mappingIdx+1])
+					mappingIdx++
+					paramRetryKey = apiKey
+					attempt--
+					continue
+				}
+
+				// 候选链已全部尝试：模型在该渠道不可用，放弃该渠道（不标记 Key 失败）
+				if len(mappingTargets) > 1 && common.IsModelNotFoundError(resp.StatusCode, respBodyBytes) {
+					log.Printf("[Messages-ModelMapping] 渠道 %s 的模型映射候选 %v 均不可用，切换到下一个渠道", upstream.Name, mappingTargets)
+					return false, "", 0, &common.FailoverError{
+						Status:    resp.StatusCode,
+						Body:      respBodyBytes,
+						RequestID: common.ExtractUpstreamRequestID(resp.Header, respBodyBytes),
+					}, nil
+				}
+
+				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKeyForChannel(upstream, resp.StatusCode, respBodyBytes, common.EffectiveFuzzyMode(c, cfgManager))
+				logger.Info("Messages-Failover", "ShouldRetryWithNextKey",
+					logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+					logger.F("status", resp.StatusCode), logger.F("latency_ms", time.Since(attemptStart).Milliseconds()),
+					logger.F("should_failover", shouldFailover), logger.F("quota_related", isQuotaRelated),
+					logger.F("request_id", reqCtx.logRequestID()))
 				if shouldFailover {
+					lastError = fmt.Errorf("上游错误: %d", resp.StatusCode)
 					failedKeys[apiKey] = true
 					cfgManager.MarkKeyAsFailed(apiKey)
 					channelScheduler.RecordFailure(currentBaseURL, apiKey, false)
 					// HTTP 5xx 等错误也触发 URL 动态降级
 					channelScheduler.MarkURLFailure(channelIndex, currentBaseURL)
-					log.Printf("[Messages-Key] 警告: API密钥失败 (状态: %d)，尝试下一个密钥", resp.StatusCode)
+					logger.Warn("Messages-Key", "API密钥失败，尝试下一个密钥",
+						logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+						logger.F("status", resp.StatusCode), logger.F("request_id", reqCtx.logRequestID()))
 
 					if envCfg.EnableResponseLogs && envCfg.IsDevelopment() {
 						var formattedBody string
@@ -470,12 +666,13 @@ func tryChannelWithAllKeys(
 						}
 						log.Printf("[Messages-Error] 失败原因:\n%s", formattedBody)
 					} else if envCfg.EnableResponseLogs {
-						log.Printf("[Messages-Error] 失败原因: %s", string(respBodyBytes))
+						log.Printf("[Messages-Error] 失败原因: %s", utils.RedactBodyForLog(respBodyBytes))
 					}
 
 					lastFailoverError = &common.FailoverError{
-						Status: resp.StatusCode,
-						Body:   respBodyBytes,
+						Status:    resp.StatusCode,
+						Body:      respBodyBytes,
+						RequestID: common.ExtractUpstreamRequestID(resp.Header, respBodyBytes),
 					}
 
 					if isQuotaRelated {
@@ -487,12 +684,41 @@ func tryChannelWithAllKeys(
 
 				// 非 failover 错误，记录失败指标后直接返回
 				channelScheduler.RecordFailure(currentBaseURL, apiKey, false)
+				channelScheduler.RecordChannelResult("messages", channelIndex, upstream, true)
 				if reqCtx != nil {
 					reqCtx.success = false
 					reqCtx.errorMsg = truncateErrorMessage(string(respBodyBytes))
 				}
-				c.Data(resp.StatusCode, "application/json", respBodyBytes)
-				return true, "", 0, nil
+				common.WriteUpstreamError(c, resp, respBodyBytes)
+				return true, "", 0, nil, nil
+			}
+
+			// 捕获账号/组织标识（仅首次成功响应），并记录响应延迟（用于 adaptive 密钥选择）
+			channelScheduler.RecordAccountHint(currentBaseURL, apiKey, resp.Header, false)
+			channelScheduler.RecordKeyLatency(currentBaseURL, apiKey, time.Since(attemptStart), false)
+
+			// 非流式响应按渠道配置的 JSON Schema 校验，不符合时视为失败（尚未向客户端写入任何数据，可安全故障转移）
+			if !claudeReq.Stream {
+				if err := common.ValidateResponseSchema(resp, upstreamCopy); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordFailure(currentBaseURL, apiKey, false)
+					log.Printf("[Messages-Schema] 警告: 响应未通过 JSON Schema 校验: %v，尝试下一个密钥", err)
+					lastFailoverError = common.NewSchemaFailoverError(err)
+					continue
+				}
+			}
+
+			// 上游以 2xx 返回错误结构响应体（如 {"error":{...}}）时视为失败（ERROR_BODY_FAILOVER，流式只检测首个事件）
+			if envCfg.ErrorBodyFailover {
+				if err := common.DetectErrorShapedResponse(resp, claudeReq.Stream); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordFailure(currentBaseURL, apiKey, false)
+					log.Printf("[Messages-ErrorBody] 警告: 渠道 %s 密钥 %s 返回错误结构响应体: %v，尝试下一个密钥", upstream.Name, utils.MaskAPIKey(apiKey), err)
+					lastFailoverError = common.NewErrorBodyFailoverError(err)
+					continue
+				}
 			}
 
 			// 处理成功响应
@@ -506,9 +732,19 @@ func tryChannelWithAllKeys(
 
 			// 标记 URL 成功，触发动态排序优化
 			channelScheduler.MarkURLSuccess(channelIndex, currentBaseURL)
+			channelScheduler.RecordChannelResult("messages", channelIndex, upstream, false)
 
 			if claudeReq.Stream {
 				usage, costCents, streamErr := common.HandleStreamResponse(c, resp, provider, envCfg, startTime, upstreamCopy, bodyBytes, channelScheduler, apiKey, billingHandler, billingCtx, claudeReq.Model, claudeReq.Model)
+				if errors.Is(streamErr, common.ErrEmptyStream) {
+					// 空流：客户端尚未收到任何数据，记录失败后尝试下一个密钥
+					failedKeys[apiKey] = true
+					channelScheduler.RecordFailure(currentBaseURL, apiKey, false)
+					channelScheduler.MarkURLFailure(channelIndex, currentBaseURL)
+					log.Printf("[Messages-Stream] 警告: 渠道 %s 密钥 %s 返回空流（%v），尝试下一个密钥", upstream.Name, utils.MaskAPIKey(apiKey), streamErr)
+					lastFailoverError = common.NewEmptyStreamFailoverError()
+					continue
+				}
 				if reqCtx != nil {
 					reqCtx.usage = usage
 					reqCtx.costCents = costCents
@@ -520,7 +756,7 @@ func tryChannelWithAllKeys(
 			} else {
 				handleNormalResponse(c, resp, provider, envCfg, startTime, bodyBytes, channelScheduler, upstreamCopy, apiKey, billingHandler, billingCtx, claudeReq.Model, reqCtx)
 			}
-			return true, apiKey, originalIdx, nil
+			return true, apiKey, originalIdx, nil, nil
 		}
 		// 当前 BaseURL 的所有 Key 都失败，记录并尝试下一个 BaseURL
 		if sortedIdx < len(sortedURLResults)-1 {
@@ -528,7 +764,7 @@ func tryChannelWithAllKeys(
 		}
 	}
 
-	return false, "", 0, lastFailoverError
+	return false, "", 0, lastFailoverError, lastError
 }
 
 // handleSingleChannel 处理单渠道代理请求
@@ -557,6 +793,15 @@ func handleSingleChannel(
 		return
 	}
 
+	if tooLargeErr := common.CheckChannelRequestBodySize(upstream, bodyBytes, envCfg.MaxRequestBodySize); tooLargeErr != nil {
+		if reqCtx != nil {
+			reqCtx.success = false
+			reqCtx.errorMsg = truncateErrorMessage(tooLargeErr.Error())
+		}
+		common.RespondRequestTooLarge(c, tooLargeErr)
+		return
+	}
+
 	if len(upstream.APIKeys) == 0 {
 		if reqCtx != nil {
 			reqCtx.channelIndex = 0
@@ -591,182 +836,26 @@ func handleSingleChannel(
 		reqCtx.updateLive()
 	}
 
-	metricsManager := channelScheduler.GetMessagesMetricsManager()
-	baseURLs := upstream.GetAllBaseURLs()
-
-	var lastError error
-	var lastFailoverError *common.FailoverError
-	deprioritizeCandidates := make(map[string]bool)
-
-	// 强制探测模式：检查首个 BaseURL 的所有 Key 是否都被熔断
-	forceProbeMode := common.AreAllKeysSuspended(metricsManager, baseURLs[0], upstream.APIKeys)
-	if forceProbeMode {
-		log.Printf("[Messages-ForceProbe] 渠道 %s 所有 Key 都被熔断，启用强制探测模式", upstream.Name)
-	}
-
-	// 纯 failover：遍历所有 BaseURL，每个 BaseURL 尝试所有 Key
-	for baseURLIdx, currentBaseURL := range baseURLs {
-		failedKeys := make(map[string]bool) // 每个 BaseURL 重置失败 Key 列表
-		maxRetries := len(upstream.APIKeys)
-
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			common.RestoreRequestBody(c, bodyBytes)
-
-			apiKey, err := cfgManager.GetNextAPIKey(upstream, failedKeys)
-			if err != nil {
-				lastError = err
-				break // 当前 BaseURL 没有可用 Key，尝试下一个 BaseURL
-			}
-			if reqCtx != nil {
-				reqCtx.apiKey = apiKey
-				reqCtx.updateLive()
-			}
-
-			// 检查熔断状态
-			if !forceProbeMode && metricsManager.ShouldSuspendKey(currentBaseURL, apiKey) {
-				failedKeys[apiKey] = true
-				log.Printf("[Messages-Circuit] 跳过熔断中的 Key: %s", utils.MaskAPIKey(apiKey))
-				continue
-			}
-
-			if envCfg.ShouldLog("info") {
-				log.Printf("[Messages-Upstream] 使用上游: %s - %s (BaseURL %d/%d, 尝试 %d/%d)", upstream.Name, currentBaseURL, baseURLIdx+1, len(baseURLs), attempt+1, maxRetries)
-				log.Printf("[Messages-Key] 使用API密钥: %s", utils.MaskAPIKey(apiKey))
-			}
-
-			// 使用深拷贝避免并发修改问题
-			upstreamCopy := upstream.Clone()
-			upstreamCopy.BaseURL = currentBaseURL
-
-			providerReq, _, err := provider.ConvertToProviderRequest(c, upstreamCopy, apiKey)
-
-			if err != nil {
-				if asClientError(err) != nil {
-					if reqCtx != nil {
-						reqCtx.success = false
-						reqCtx.errorMsg = truncateErrorMessage(err.Error())
-					}
-					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-					return
-				}
-
-				log.Printf("[Messages-Convert] ConvertToProviderRequest 失败: %v", err)
-				if reqCtx != nil {
-					reqCtx.success = false
-					reqCtx.errorMsg = truncateErrorMessage(err.Error())
-				}
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert request"})
-				return
-			}
-
-			resp, err := common.SendRequest(providerReq, upstream, envCfg, claudeReq.Stream)
-			if err != nil {
-				lastError = err
-				failedKeys[apiKey] = true
-				cfgManager.MarkKeyAsFailed(apiKey)
-				channelScheduler.RecordFailure(currentBaseURL, apiKey, false)
-				log.Printf("[Messages-Key] 警告: API密钥失败: %v", err)
-				continue
-			}
-
-			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-				respBodyBytes, _ := io.ReadAll(resp.Body)
-				resp.Body.Close()
-				respBodyBytes = utils.DecompressGzipIfNeeded(resp, respBodyBytes)
-
-				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKey(resp.StatusCode, respBodyBytes, cfgManager.GetFuzzyModeEnabled())
-				log.Printf("[Messages-Failover] ShouldRetryWithNextKey(SingleChannel): statusCode=%d, shouldFailover=%v, isQuotaRelated=%v", resp.StatusCode, shouldFailover, isQuotaRelated)
-				if shouldFailover {
-					lastError = fmt.Errorf("上游错误: %d", resp.StatusCode)
-					failedKeys[apiKey] = true
-					cfgManager.MarkKeyAsFailed(apiKey)
-					channelScheduler.RecordFailure(currentBaseURL, apiKey, false)
-
-					log.Printf("[Messages-Key] 警告: API密钥失败 (状态: %d)，尝试下一个密钥", resp.StatusCode)
-					if envCfg.EnableResponseLogs && envCfg.IsDevelopment() {
-						var formattedBody string
-						if envCfg.RawLogOutput {
-							formattedBody = utils.FormatJSONBytesRaw(respBodyBytes)
-						} else {
-							formattedBody = utils.FormatJSONBytesForLog(respBodyBytes, 500)
-						}
-						log.Printf("[Messages-Error] 失败原因:\n%s", formattedBody)
-					} else if envCfg.EnableResponseLogs {
-						log.Printf("[Messages-Error] 失败原因: %s", string(respBodyBytes))
-					}
-
-					lastFailoverError = &common.FailoverError{
-						Status: resp.StatusCode,
-						Body:   respBodyBytes,
-					}
-
-					if isQuotaRelated {
-						deprioritizeCandidates[apiKey] = true
-						log.Printf("[Messages-Key] 标记密钥为配额相关失败，待降级: %s", utils.MaskAPIKey(apiKey))
-					}
-					continue
-				}
-
-				// 非 failover 错误，记录失败指标后返回
-				if envCfg.EnableResponseLogs {
-					log.Printf("[Messages-Response] 警告: 上游返回错误: %d", resp.StatusCode)
-					if envCfg.IsDevelopment() {
-						var formattedBody string
-						if envCfg.RawLogOutput {
-							formattedBody = utils.FormatJSONBytesRaw(respBodyBytes)
-						} else {
-							formattedBody = utils.FormatJSONBytesForLog(respBodyBytes, 500)
-						}
-						log.Printf("[Messages-Response] 错误响应体:\n%s", formattedBody)
-
-						respHeaders := make(map[string]string)
-						for key, values := range resp.Header {
-							if len(values) > 0 {
-								respHeaders[key] = values[0]
-							}
-						}
-						var respHeadersJSON []byte
-						if envCfg.RawLogOutput {
-							respHeadersJSON, _ = json.Marshal(respHeaders)
-						} else {
-							respHeadersJSON, _ = json.MarshalIndent(respHeaders, "", "  ")
-						}
-						log.Printf("[Messages-Response] 错误响应头:\n%s", string(respHeadersJSON))
-					}
-				}
-				channelScheduler.RecordFailure(currentBaseURL, apiKey, false)
-				if reqCtx != nil {
-					reqCtx.success = false
-					reqCtx.errorMsg = truncateErrorMessage(string(respBodyBytes))
-				}
-				c.Data(resp.StatusCode, "application/json", respBodyBytes)
-				return
-			}
-
-			// 处理成功响应
-			if len(deprioritizeCandidates) > 0 {
-				for key := range deprioritizeCandidates {
-					if err := cfgManager.DeprioritizeAPIKey(key); err != nil {
-						log.Printf("[Messages-Key] 警告: 密钥降级失败: %v", err)
-					}
-				}
-			}
+	serveSingleChannel(c, envCfg, cfgManager, channelScheduler, upstream, newUpstreamBody(bodyBytes), claudeReq, startTime, billingHandler, billingCtx, reqCtx)
+}
 
-			if claudeReq.Stream {
-				usage, costCents, streamErr := common.HandleStreamResponse(c, resp, provider, envCfg, startTime, upstreamCopy, bodyBytes, channelScheduler, apiKey, billingHandler, billingCtx, claudeReq.Model, claudeReq.Model)
-				if reqCtx != nil {
-					reqCtx.usage = usage
-					reqCtx.costCents = costCents
-					reqCtx.success = streamErr == nil
-					if streamErr != nil {
-						reqCtx.errorMsg = truncateErrorMessage(streamErr.Error())
-					}
-				}
-			} else {
-				handleNormalResponse(c, resp, provider, envCfg, startTime, bodyBytes, channelScheduler, upstreamCopy, apiKey, billingHandler, billingCtx, claudeReq.Model, reqCtx)
-			}
-			return
-		}
+// serveSingleChannel 单渠道模式：使用渠道的所有密钥/BaseURL 尝试请求，全部失败时返回最后一个错误
+func serveSingleChannel(
+	c *gin.Context,
+	envCfg *config.EnvConfig,
+	cfgManager *config.ConfigManager,
+	channelScheduler *scheduler.ChannelScheduler,
+	upstream *config.UpstreamConfig,
+	body *upstreamBody,
+	claudeReq types.ClaudeRequest,
+	startTime time.Time,
+	billingHandler *billing.Handler,
+	billingCtx *billing.RequestContext,
+	reqCtx *requestLogContext,
+) {
+	success, _, _, lastFailoverError, lastError := tryChannelKeys(c, envCfg, cfgManager, channelScheduler, upstream, 0, body, claudeReq, startTime, billingHandler, billingCtx, reqCtx)
+	if success {
+		return
 	}
 
 	log.Printf("[Messages-Error] 所有API密钥都失败了")
@@ -807,7 +896,9 @@ func handleNormalResponse(
 
 	if envCfg.EnableResponseLogs {
 		responseTime := time.Since(startTime).Milliseconds()
-		log.Printf("[Messages-Timing] 响应完成: %dms, 状态: %d", responseTime, resp.StatusCode)
+		logger.Info("Messages-Timing", "响应完成",
+			logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+			logger.F("status", resp.StatusCode), logger.F("latency_ms", responseTime), logger.F("request_id", reqCtx.logRequestID()))
 		if envCfg.IsDevelopment() {
 			respHeaders := make(map[string]string)
 			for key, values := range resp.Header {
@@ -857,6 +948,7 @@ func handleNormalResponse(
 		if envCfg.EnableResponseLogs {
 			log.Printf("[Messages-Token] 上游无Usage, 本地估算: input=%d, output=%d", estimatedInput, estimatedOutput)
 		}
+		common.GetDiagnostics(c).SetTokenSource(common.TokenSourceEstimated)
 	} else {
 		originalInput := claudeResp.Usage.InputTokens
 		originalOutput := claudeResp.Usage.OutputTokens
@@ -872,6 +964,11 @@ func handleNormalResponse(
 			claudeResp.Usage.OutputTokens = utils.EstimateResponseTokens(claudeResp.Content)
 			patched = true
 		}
+		if patched {
+			common.GetDiagnostics(c).SetTokenSource(common.TokenSourceEstimated)
+		} else {
+			common.GetDiagnostics(c).SetTokenSource(common.TokenSourceUpstream)
+		}
 		if envCfg.EnableResponseLogs {
 			if patched {
 				log.Printf("[Messages-Token] 虚假值补全: InputTokens=%d->%d, OutputTokens=%d->%d",
@@ -884,23 +981,56 @@ func handleNormalResponse(
 				claudeResp.Usage.CacheTTL)
 		}
 	}
+	// thinking token 单独统计（Gemini 等上游已在 usage 中返回时保留）
+	if claudeResp.Usage.ThinkingTokens == 0 {
+		claudeResp.Usage.ThinkingTokens = common.ClampThinkingTokens(common.EstimateThinkingTokens(claudeResp.Content), claudeResp.Usage.OutputTokens)
+	}
+
+	// 按渠道改写返回给客户端的模型名（usage 与计费仍按请求模型）
+	if rewritten, ok := upstream.RewriteResponseModel(claudeResp.Model); ok {
+		if envCfg.EnableResponseLogs && envCfg.ShouldLog("debug") {
+			log.Printf("[Response-Model] 渠道 %s 改写 model: %s -> %s", upstream.Name, claudeResp.Model, rewritten)
+		}
+		claudeResp.Model = rewritten
+	}
 
-	// 监听客户端断开连接
+	// 监听客户端断开连接：处理器返回后 gin 会复用 Context，goroutine 不能再访问 c，
+	// 改用 responded 判断响应是否已写出（正常结束时 responded 先于请求上下文取消关闭）
 	ctx := c.Request.Context()
+	responded := make(chan struct{})
+	defer close(responded)
 	go func() {
-		<-ctx.Done()
-		if !c.Writer.Written() {
-			if envCfg.EnableResponseLogs {
-				responseTime := time.Since(startTime).Milliseconds()
-				log.Printf("[Messages-Timing] 响应中断: %dms, 状态: %d", responseTime, resp.StatusCode)
-			}
+		select {
+		case <-responded:
+			return
+		case <-ctx.Done():
+		}
+		select {
+		case <-responded:
+			return
+		default:
+		}
+		if envCfg.EnableResponseLogs {
+			responseTime := time.Since(startTime).Milliseconds()
+			logger.Info("Messages-Timing", "响应中断",
+				logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+				logger.F("status", resp.StatusCode), logger.F("latency_ms", responseTime), logger.F("request_id", reqCtx.logRequestID()))
 		}
 	}()
 
 	// 转发上游响应头
 	utils.ForwardResponseHeaders(resp.Header, c.Writer)
 
-	c.JSON(200, claudeResp)
+	// 客户端通过 Accept 头要求 OpenAI 格式时转换响应结构（计费与指标仍使用 Claude usage）
+	if common.RequestedResponseFormat(c) == common.ResponseFormatOpenAI {
+		if claudeResp.Model == "" {
+			claudeResp.Model = model
+		}
+		c.Header(common.ResponseFormatHeader, common.ResponseFormatOpenAI)
+		common.WriteJSONResponse(c, envCfg, 200, converters.ClaudeResponseToOpenAIChat(claudeResp))
+	} else {
+		common.WriteJSONResponse(c, envCfg, 200, claudeResp)
+	}
 
 	// 计算成本
 	var costCents int64
@@ -924,20 +1054,31 @@ func handleNormalResponse(
 
 	if envCfg.EnableResponseLogs {
 		responseTime := time.Since(startTime).Milliseconds()
-		log.Printf("[Messages-Timing] 响应发送完成: %dms, 状态: %d", responseTime, resp.StatusCode)
+		logger.Info("Messages-Timing", "响应发送完成",
+			logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+			logger.F("status", resp.StatusCode), logger.F("latency_ms", responseTime), logger.F("request_id", reqCtx.logRequestID()))
 	}
 }
 
+// TokenCountEstimatedHeader count_tokens 结果为本地估算（而非上游精确计数）时返回的响应头
+const TokenCountEstimatedHeader = "X-Proxy-Token-Count-Estimated"
+
 // CountTokensHandler 处理 /v1/messages/count_tokens 请求
+// 始终在本地估算，不依赖上游渠道；启用 COUNT_TOKENS_ESTIMATE_HEADER 时响应带 X-Proxy-Token-Count-Estimated: true
 func CountTokensHandler(envCfg *config.EnvConfig, cfgManager *config.ConfigManager, channelScheduler *scheduler.ChannelScheduler) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		middleware.ProxyAuthMiddleware(envCfg)(c)
-		if c.IsAborted() {
+		if c.IsAborted() || !common.CheckMaintenance(c) {
 			return
 		}
+		envCfg := common.RequestEnvConfig(c, envCfg)
 
 		// 使用统一的请求体读取函数，应用大小限制
-		bodyBytes, err := common.ReadRequestBody(c, envCfg.MaxRequestBodySize)
+		var metricsManager *metrics.MetricsManager
+		if channelScheduler != nil {
+			metricsManager = channelScheduler.GetMessagesMetricsManager()
+		}
+		bodyBytes, err := common.ReadRequestBody(c, envCfg.MaxRequestBodySize, metricsManager)
 		if err != nil {
 			// ReadRequestBody 已经返回了错误响应
 			return
@@ -956,6 +1097,9 @@ func CountTokensHandler(envCfg *config.EnvConfig, cfgManager *config.ConfigManag
 
 		inputTokens := utils.EstimateRequestTokens(bodyBytes)
 
+		if envCfg.CountTokensEstimateHeader {
+			c.Header(TokenCountEstimatedHeader, "true")
+		}
 		c.JSON(200, gin.H{
 			"input_tokens": inputTokens,
 		})
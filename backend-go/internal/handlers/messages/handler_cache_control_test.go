@@ -0,0 +1,78 @@
+package messages
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// TestMessagesHandler_StripCacheControlPerChannel 测试 stripCacheControl 渠道转发前移除 cache_control，其他渠道原样透传
+func TestMessagesHandler_StripCacheControlPerChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	bodies := make(map[string][]byte)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")+r.Header.Get("x-api-key")] = body
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	reqBody := `{"model":"claude-3","max_tokens":16,"system":[{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}],` +
+		`"messages":[{"role":"user","content":[{"type":"text","text":"hi","cache_control":{"type":"ephemeral"}}]}]}`
+
+	for _, tc := range []struct {
+		name  string
+		key   string
+		strip bool
+	}{{"不支持缓存的渠道", "k-nocache", true}, {"支持缓存的渠道", "k-cache", false}} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+				Upstream: []config.UpstreamConfig{{
+					Name: tc.name, BaseURL: upstream.URL, APIKeys: []string{tc.key},
+					ServiceType: "claude", Status: "active", StripCacheControl: tc.strip,
+				}},
+				LoadBalance: "failover",
+			})
+			defer cleanupCfg()
+			sch, cleanupSch := createTestScheduler(t, cfgManager)
+			defer cleanupSch()
+
+			envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+			r := gin.New()
+			r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+			req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			mu.Lock()
+			body := bodies[tc.key]
+			mu.Unlock()
+			for _, path := range []string{"system.0.cache_control", "messages.0.content.0.cache_control"} {
+				if got := gjson.GetBytes(body, path).Exists(); got == tc.strip {
+					t.Fatalf("%s exists = %v, strip = %v, body = %s", path, got, tc.strip, body)
+				}
+			}
+			if gjson.GetBytes(body, "messages.0.content.0.text").String() != "hi" {
+				t.Fatalf("message content lost: %s", body)
+			}
+		})
+	}
+}
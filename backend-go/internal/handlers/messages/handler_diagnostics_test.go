@@ -0,0 +1,167 @@
+package messages
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/gin-gonic/gin"
+)
+
+// newDiagnosticsTestProxy 启动代理（真实 HTTP 服务器，以便校验 Trailer 传输）：
+// 渠道 bad 固定返回 500，渠道 good 返回 goodHandler 的响应
+func newDiagnosticsTestProxy(t *testing.T, goodHandler http.HandlerFunc) (*httptest.Server, func()) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	upstreamBad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":{"message":"boom"}}`))
+	}))
+	upstreamGood := httptest.NewServer(goodHandler)
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "bad", BaseURL: upstreamBad.URL, APIKeys: []string{"k-bad-0001"}, ServiceType: "claude", Status: "active", Priority: 1},
+			{Name: "good", BaseURL: upstreamGood.URL, APIKeys: []string{"k-good-0002"}, ServiceType: "claude", Status: "active", Priority: 2},
+		},
+		LoadBalance:      "failover",
+		FuzzyModeEnabled: true,
+	}
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+
+	envCfg := &config.EnvConfig{
+		ProxyAccessKey:     "secret",
+		MaxRequestBodySize: 1024 * 1024,
+	}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+	proxy := httptest.NewServer(r)
+
+	return proxy, func() {
+		proxy.Close()
+		cleanupSch()
+		cleanupCfg()
+		upstreamGood.Close()
+		upstreamBad.Close()
+	}
+}
+
+// postWithDiagnostics 发送请求并读完响应体，返回响应体与诊断 Trailer
+func postWithDiagnostics(t *testing.T, proxyURL, body string, debug bool) (string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, proxyURL+"/v1/messages", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", "secret")
+	if debug {
+		req.Header.Set(common.DebugHeader, "true")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body) // Trailer 在读完响应体后才可用
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, respBody)
+	}
+	return string(respBody), resp.Trailer.Get(common.DiagnosticsTrailer)
+}
+
+func decodeDiagnostics(t *testing.T, trailer string) common.DiagnosticsReport {
+	t.Helper()
+	if trailer == "" {
+		t.Fatal("期望返回诊断 Trailer")
+	}
+	var report common.DiagnosticsReport
+	if err := json.Unmarshal([]byte(trailer), &report); err != nil {
+		t.Fatalf("诊断 Trailer 不是合法 JSON: %v (%s)", err, trailer)
+	}
+	return report
+}
+
+func TestMessagesHandler_Diagnostics_NonStream(t *testing.T) {
+	proxy, cleanup := newDiagnosticsTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_ok","type":"message","role":"assistant","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":12,"output_tokens":7}}`))
+	})
+	defer cleanup()
+
+	reqBody := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}],"max_tokens":16}`
+
+	body, trailer := postWithDiagnostics(t, proxy.URL, reqBody, true)
+	if strings.Contains(body, "attemptLog") {
+		t.Fatalf("诊断信息不应写入响应体: %s", body)
+	}
+	report := decodeDiagnostics(t, trailer)
+	if report.Attempts != 2 || len(report.AttemptLog) != 2 {
+		t.Fatalf("attempts = %d (log %d), want 2: %s", report.Attempts, len(report.AttemptLog), trailer)
+	}
+	if report.AttemptLog[0].ChannelName != "bad" || report.AttemptLog[0].Status != http.StatusInternalServerError {
+		t.Fatalf("第一次尝试应为 bad/500: %+v", report.AttemptLog[0])
+	}
+	if report.AttemptLog[1].ChannelName != "good" || report.AttemptLog[1].Status != http.StatusOK {
+		t.Fatalf("第二次尝试应为 good/200: %+v", report.AttemptLog[1])
+	}
+	if strings.Contains(trailer, "k-good-0002") || strings.Contains(trailer, "k-bad-0001") {
+		t.Fatalf("诊断信息中的密钥应脱敏: %s", trailer)
+	}
+	if report.Channel == nil || report.Channel.Index != 1 || report.Channel.Name != "good" {
+		t.Fatalf("channel = %+v, want [1] good", report.Channel)
+	}
+	if report.TokenSource != common.TokenSourceUpstream {
+		t.Fatalf("tokenSource = %q, want upstream", report.TokenSource)
+	}
+	if report.TotalMs < report.UpstreamMs {
+		t.Fatalf("totalMs(%d) 不应小于 upstreamMs(%d)", report.TotalMs, report.UpstreamMs)
+	}
+
+	if _, trailer := postWithDiagnostics(t, proxy.URL, reqBody, false); trailer != "" {
+		t.Fatalf("未设置 %s 时不应返回诊断 Trailer: %s", common.DebugHeader, trailer)
+	}
+}
+
+func TestMessagesHandler_Diagnostics_StreamEstimatedTokens(t *testing.T) {
+	proxy, cleanup := newDiagnosticsTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		// 上游完全不返回 usage，代理本地估算
+		_, _ = w.Write([]byte(strings.Join([]string{
+			"event: content_block_delta",
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hello"}}`,
+			"",
+			"event: message_stop",
+			`data: {"type":"message_stop"}`,
+			"",
+		}, "\n")))
+	})
+	defer cleanup()
+
+	reqBody := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}],"stream":true}`
+
+	body, trailer := postWithDiagnostics(t, proxy.URL, reqBody, true)
+	if !strings.Contains(body, "hello") {
+		t.Fatalf("unexpected stream body: %s", body)
+	}
+	report := decodeDiagnostics(t, trailer)
+	if report.Attempts != 2 || report.Channel == nil || report.Channel.Name != "good" {
+		t.Fatalf("unexpected report: %s", trailer)
+	}
+	if report.TokenSource != common.TokenSourceEstimated {
+		t.Fatalf("tokenSource = %q, want estimated", report.TokenSource)
+	}
+
+	if _, trailer := postWithDiagnostics(t, proxy.URL, reqBody, false); trailer != "" {
+		t.Fatalf("未设置 %s 时不应返回诊断 Trailer: %s", common.DebugHeader, trailer)
+	}
+}
@@ -0,0 +1,86 @@
+package messages
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMessagesHandler_ErrorBodyFailover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range []struct {
+		name      string
+		stream    bool
+		badBody   string
+		goodBody  string
+		wantInRes string
+	}{
+		{
+			name:      "non-stream",
+			badBody:   `{"error":{"message":"quota exhausted","type":"insufficient_quota"}}`,
+			goodBody:  `{"id":"msg_1","type":"message","role":"assistant","model":"claude-x","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`,
+			wantInRes: `"text":"ok"`,
+		},
+		{
+			name:      "stream first event",
+			stream:    true,
+			badBody:   "data: {\"error\":{\"message\":\"quota exhausted\"}}\n\n",
+			goodBody:  "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"claude-x\",\"content\":[],\"usage\":{\"input_tokens\":1,\"output_tokens\":0}}}\n\nevent: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\nevent: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"streamed\"}}\n\nevent: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+			wantInRes: "streamed",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var badCalls, goodCalls atomic.Int32
+			bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				badCalls.Add(1)
+				_, _ = w.Write([]byte(tc.badBody))
+			}))
+			defer bad.Close()
+			good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				goodCalls.Add(1)
+				_, _ = w.Write([]byte(tc.goodBody))
+			}))
+			defer good.Close()
+
+			cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+				Upstream: []config.UpstreamConfig{
+					{Name: "bad", BaseURL: bad.URL, APIKeys: []string{"k-bad"}, ServiceType: "claude", Status: "active", Priority: 1},
+					{Name: "good", BaseURL: good.URL, APIKeys: []string{"k-good"}, ServiceType: "claude", Status: "active", Priority: 2},
+				},
+				LoadBalance: "failover",
+			})
+			defer cleanupCfg()
+			sch, cleanupSch := createTestScheduler(t, cfgManager)
+			defer cleanupSch()
+
+			send := func(envCfg *config.EnvConfig) *httptest.ResponseRecorder {
+				r := gin.New()
+				r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+				body := `{"model":"claude-x","max_tokens":16,"stream":` + map[bool]string{true: "true", false: "false"}[tc.stream] + `,"messages":[{"role":"user","content":"hi"}]}`
+				req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(body))
+				req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				return w
+			}
+
+			w := send(&config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024, ErrorBodyFailover: true})
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tc.wantInRes) {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if badCalls.Load() != 1 || goodCalls.Load() != 1 {
+				t.Fatalf("calls bad=%d good=%d, want failover to good channel", badCalls.Load(), goodCalls.Load())
+			}
+			if m := sch.GetMessagesMetricsManager().GetKeyMetrics(bad.URL, "k-bad"); m == nil || m.FailureCount != 1 || m.SuccessCount != 0 {
+				t.Fatalf("error body should be recorded as failure, metrics = %+v", m)
+			}
+		})
+	}
+}
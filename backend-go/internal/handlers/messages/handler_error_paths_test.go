@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
 	"github.com/gin-gonic/gin"
 )
 
@@ -248,3 +249,88 @@ func TestMessagesHandler_MultiChannel_AllChannelsFail_ReturnsLastError(t *testin
 		t.Fatalf("unexpected body=%s", w.Body.String())
 	}
 }
+
+func TestMessagesHandler_UpstreamError_ForwardsRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		status        int
+		header        string
+		body          string
+		wantStatus    int
+		wantRequestID string
+		wantRawHeader string
+	}{
+		{
+			name:          "非故障转移错误透传 request-id 响应头",
+			status:        http.StatusBadRequest,
+			header:        "req_header_123",
+			body:          `{"type":"error","error":{"type":"invalid_request_error","message":"bad request"}}`,
+			wantStatus:    http.StatusBadRequest,
+			wantRequestID: "req_header_123",
+			wantRawHeader: "req_header_123",
+		},
+		{
+			name:          "故障转移耗尽后取错误体中的 request_id",
+			status:        http.StatusTooManyRequests,
+			body:          `{"type":"error","error":{"type":"rate_limit_error","message":"quota exceeded"},"request_id":"req_body_456"}`,
+			wantStatus:    http.StatusTooManyRequests,
+			wantRequestID: "req_body_456",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("request-id", tt.header)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer upstream.Close()
+
+			cfg := config.Config{
+				Upstream: []config.UpstreamConfig{
+					{Name: "c0", BaseURL: upstream.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1},
+				},
+				LoadBalance:          "failover",
+				ResponsesLoadBalance: "failover",
+				GeminiLoadBalance:    "failover",
+				FuzzyModeEnabled:     false,
+			}
+
+			cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+			defer cleanupCfg()
+
+			sch, cleanupSch := createTestSchedulerWithMetricsConfig(t, cfgManager)
+			defer cleanupSch()
+
+			envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+			r := gin.New()
+			r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+			reqBody := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}],"max_tokens":16}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get(common.UpstreamRequestIDHeader); got != tt.wantRequestID {
+				t.Fatalf("%s = %q, want %q", common.UpstreamRequestIDHeader, got, tt.wantRequestID)
+			}
+			if got := w.Header().Get("request-id"); got != tt.wantRawHeader {
+				t.Fatalf("request-id = %q, want %q", got, tt.wantRawHeader)
+			}
+			if tt.wantRawHeader == "" && !strings.Contains(w.Body.String(), tt.wantRequestID) {
+				t.Fatalf("错误体应保留 request_id: %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package messages
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMessagesHandler_ChannelFailoverStatusCodeOverrides(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		status        int
+		failoverCodes []int
+		noFailover    []int
+		wantCode      int
+		wantSecondHit bool
+	}{
+		{name: "503 default fails over", status: 503, wantCode: http.StatusOK, wantSecondHit: true},
+		{name: "503 no-failover returns upstream error", status: 503, noFailover: []int{503}, wantCode: http.StatusServiceUnavailable},
+		{name: "400 default does not fail over", status: 400, wantCode: http.StatusBadRequest},
+		{name: "400 forced failover", status: 400, failoverCodes: []int{400}, wantCode: http.StatusOK, wantSecondHit: true},
+		{name: "both lists prefer no-failover", status: 503, failoverCodes: []int{503}, noFailover: []int{503}, wantCode: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"error":{"type":"api_error","message":"model not found"}}`))
+			}))
+			defer first.Close()
+			var secondHits atomic.Int32
+			second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				secondHits.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3",
+  "content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+			}))
+			defer second.Close()
+
+			cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+				Upstream: []config.UpstreamConfig{
+					{Name: "first", BaseURL: first.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1,
+						FailoverStatusCodes: tt.failoverCodes, NoFailoverStatusCodes: tt.noFailover},
+					{Name: "second", BaseURL: second.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Priority: 2},
+				},
+				LoadBalance: "failover",
+			})
+			defer cleanupCfg()
+			if err := cfgManager.SetFuzzyModeEnabled(false); err != nil {
+				t.Fatalf("SetFuzzyModeEnabled: %v", err)
+			}
+			sch, cleanupSch := createTestScheduler(t, cfgManager)
+			defer cleanupSch()
+
+			envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+			r := gin.New()
+			r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+				bytes.NewBufferString(`{"model":"claude-3","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if hit := secondHits.Load() > 0; hit != tt.wantSecondHit {
+				t.Fatalf("second channel hit = %v, want %v", hit, tt.wantSecondHit)
+			}
+		})
+	}
+}
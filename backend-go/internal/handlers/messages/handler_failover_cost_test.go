@@ -0,0 +1,95 @@
+package messages
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/pricing"
+	"github.com/gin-gonic/gin"
+)
+
+type failoverCostPricing map[string]*pricing.ModelPricing
+
+func (f failoverCostPricing) GetPricing(model string) *pricing.ModelPricing {
+	return f[model]
+}
+
+func TestMessagesHandler_FailoverRecordsCostDelta(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	prices := failoverCostPricing{
+		"opus":  {InputCostPerToken: 15e-6, OutputCostPerToken: 75e-6},
+		"haiku": {InputCostPerToken: 1e-6, OutputCostPerToken: 5e-6},
+	}
+	// usage: 1000 输入 + 100 输出
+	opusCost := 1000*15e-6 + 100*75e-6
+	haikuCost := 1000*1e-6 + 100*5e-6
+
+	tests := []struct {
+		name         string
+		primaryModel string
+		backupModel  string
+		wantDelta    float64
+	}{
+		{name: "failover to cheaper channel saves", primaryModel: "opus", backupModel: "haiku", wantDelta: haikuCost - opusCost},
+		{name: "failover to pricier channel overspends", primaryModel: "haiku", backupModel: "opus", wantDelta: opusCost - haikuCost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(`{"error":{"type":"api_error","message":"overloaded"}}`))
+			}))
+			defer primary.Close()
+			backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"m",
+  "content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1000,"output_tokens":100}}`))
+			}))
+			defer backup.Close()
+
+			cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+				Upstream: []config.UpstreamConfig{
+					{Name: "primary", BaseURL: primary.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1,
+						ModelMapping: map[string]string{"claude-x": tt.primaryModel}},
+					{Name: "backup", BaseURL: backup.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Priority: 2,
+						ModelMapping: map[string]string{"claude-x": tt.backupModel}},
+				},
+				LoadBalance: "failover",
+			})
+			defer cleanupCfg()
+			sch, cleanupSch := createTestScheduler(t, cfgManager)
+			defer cleanupSch()
+			sch.SetPricingSource(prices)
+
+			envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+			r := gin.New()
+			r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+				bytes.NewBufferString(`{"model":"claude-x","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			report := sch.GetFailoverCostReport("messages")
+			if report.FailoverRequests != 1 || len(report.Pairs) != 1 {
+				t.Fatalf("report = %+v, want 1 failover request", report)
+			}
+			pair := report.Pairs[0]
+			if pair.PrimaryName != "primary" || pair.ServingName != "backup" {
+				t.Fatalf("pair = %+v", pair)
+			}
+			if math.Abs(pair.CostDeltaUSD-tt.wantDelta) > 1e-12 || math.Abs(report.NetDeltaUSD-tt.wantDelta) > 1e-12 {
+				t.Fatalf("costDelta = %v, net = %v, want %v", pair.CostDeltaUSD, report.NetDeltaUSD, tt.wantDelta)
+			}
+		})
+	}
+}
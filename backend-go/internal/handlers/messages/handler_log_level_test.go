@@ -0,0 +1,95 @@
+package messages
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMessagesHandler_LogLevelHeaderIsRequestScoped(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3",
+  "content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "u", BaseURL: upstream.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1},
+		},
+		LoadBalance: "failover",
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{
+		Env:                "production",
+		LogLevel:           "info",
+		ProxyAccessKey:     "secret",
+		MaxRequestBodySize: 1024 * 1024,
+	}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	send := func(marker, level string) int {
+		body := `{"model":"claude-3","max_tokens":16,"messages":[{"role":"user","content":"` + marker + `"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(body))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		if level != "" {
+			req.Header.Set(common.LogLevelHeader, level)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	const rounds = 5
+	var wg sync.WaitGroup
+	for i := 0; i < rounds; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if code := send("verbose-marker", "debug"); code != http.StatusOK {
+				t.Errorf("verbose request status = %d", code)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if code := send("quiet-marker", ""); code != http.StatusOK {
+				t.Errorf("quiet request status = %d", code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	out := logs.String()
+	if got := strings.Count(out, "[Request-OriginalBody]"); got != rounds {
+		t.Fatalf("expected %d verbose request body logs, got %d\n%s", rounds, got, out)
+	}
+	if !strings.Contains(out, "verbose-marker") {
+		t.Fatalf("expected verbose request body in logs:\n%s", out)
+	}
+	if strings.Contains(out, "quiet-marker") {
+		t.Fatalf("request without header must not log its body:\n%s", out)
+	}
+	if envCfg.EnableRequestLogs || envCfg.IsDevelopment() || envCfg.LogLevel != "info" {
+		t.Fatalf("global env config mutated: %+v", envCfg)
+	}
+}
@@ -0,0 +1,63 @@
+package messages
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/gin-gonic/gin"
+)
+
+// TestMessagesHandler_MaintenanceMode 测试维护模式下请求直接返回 503，不转发到上游
+func TestMessagesHandler_MaintenanceMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "main", BaseURL: upstream.URL, APIKeys: []string{"k1"},
+			ServiceType: "claude", Status: "active",
+		}},
+		LoadBalance: "failover",
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(`{"model":"claude-3","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	common.EnableMaintenance("provider outage", 90)
+	defer common.DisableMaintenance()
+	w := send()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "90" {
+		t.Fatalf("status = %d, Retry-After = %q, body = %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("provider outage")) || hits.Load() != 0 {
+		t.Fatalf("body = %s, upstream hits = %d", w.Body.String(), hits.Load())
+	}
+
+	common.DisableMaintenance()
+	if w := send(); w.Code != http.StatusOK || hits.Load() != 1 {
+		t.Fatalf("after disable: status = %d, upstream hits = %d", w.Code, hits.Load())
+	}
+}
@@ -0,0 +1,115 @@
+package messages
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/cache"
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMessagesHandler_BlockedModelReturns403WithoutUpstream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var upstreamCalls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4",
+  "content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "u", BaseURL: upstream.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1,
+		}},
+		LoadBalance:   "failover",
+		AllowedModels: []string{"claude-*"},
+		BlockedModels: []string{"claude-opus-*"},
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	send := func(model string) *httptest.ResponseRecorder {
+		body := `{"model":"` + model + `","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(body))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, model := range []string{"claude-opus-4", "gpt-4o"} {
+		w := send(model)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("%s: status = %d, want 403, body = %s", model, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), "permission_error") || !strings.Contains(w.Body.String(), model) {
+			t.Fatalf("%s: unexpected body: %s", model, w.Body.String())
+		}
+	}
+	if got := atomic.LoadInt32(&upstreamCalls); got != 0 {
+		t.Fatalf("upstream calls = %d, want 0", got)
+	}
+
+	if w := send("claude-sonnet-4"); w.Code != http.StatusOK {
+		t.Fatalf("allowed model: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := atomic.LoadInt32(&upstreamCalls); got != 1 {
+		t.Fatalf("upstream calls = %d, want 1", got)
+	}
+}
+
+func TestModelsHandler_AppliesModelFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		BlockedModels: []string{"*-opus-*"},
+	})
+	defer cleanupCfg()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret"}
+	respCache := cache.NewHTTPResponseCache(10, time.Minute, &metrics.CacheMetrics{})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	respCache.Set(modelsCacheKey(req), cache.HTTPResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{modelsCacheContentType}},
+		Body:       []byte(`{"object":"list","data":[{"id":"claude-opus-4","object":"model","created":1,"owned_by":"x"},{"id":"claude-sonnet-4","object":"model","created":1,"owned_by":"x"}]}`),
+	})
+
+	r := gin.New()
+	r.GET("/v1/models", ModelsHandler(envCfg, cfgManager, nil, respCache))
+	r.GET("/v1/models/:model", ModelsDetailHandler(envCfg, cfgManager, nil))
+
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "claude-opus-4") || !strings.Contains(w.Body.String(), "claude-sonnet-4") {
+		t.Fatalf("models not filtered: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/models/claude-opus-4", nil)
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("detail status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package messages
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// newModelChainUpstream 仅接受 available 中的模型，其余返回 Anthropic 格式的 404 not_found_error
+func newModelChainUpstream(t *testing.T, available string) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var models []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		model := gjson.GetBytes(body, "model").String()
+		mu.Lock()
+		models = append(models, model)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if model != available {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"not_found_error","message":"model: ` + model + `"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"` + model + `",
+  "content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), models...)
+	}
+}
+
+func sendModelChainRequest(t *testing.T, cfg config.Config) *httptest.ResponseRecorder {
+	t.Helper()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	body := `{"model":"claude-opus-latest","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(body))
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMessagesHandler_ModelMappingChain_SingleChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream, models := newModelChainUpstream(t, "claude-opus-4")
+	defer upstream.Close()
+
+	w := sendModelChainRequest(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "u", BaseURL: upstream.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active",
+			ModelMapping:       map[string]string{"opus": "claude-opus-5"},
+			ModelMappingChains: map[string][]string{"opus": {"claude-opus-5", "claude-opus-4-1", "claude-opus-4"}},
+		}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := models(); !reflect.DeepEqual(got, []string{"claude-opus-5", "claude-opus-4-1", "claude-opus-4"}) {
+		t.Fatalf("upstream models = %v", got)
+	}
+}
+
+func TestMessagesHandler_ModelMappingChain_ExhaustedFailsOverChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	primary, primaryModels := newModelChainUpstream(t, "none")
+	defer primary.Close()
+	backup, backupModels := newModelChainUpstream(t, "claude-opus-latest")
+	defer backup.Close()
+
+	w := sendModelChainRequest(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{
+				Name: "primary", BaseURL: primary.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1,
+				ModelMapping:       map[string]string{"opus": "a"},
+				ModelMappingChains: map[string][]string{"opus": {"a", "b"}},
+			},
+			{Name: "backup", BaseURL: backup.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Priority: 2},
+		},
+		LoadBalance: "failover",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := primaryModels(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("primary models = %v, want whole chain before failover", got)
+	}
+	if got := backupModels(); !reflect.DeepEqual(got, []string{"claude-opus-latest"}) {
+		t.Fatalf("backup models = %v", got)
+	}
+}
+
+func TestMessagesHandler_SingleModelMappingUnchanged(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream, models := newModelChainUpstream(t, "none")
+	defer upstream.Close()
+
+	w := sendModelChainRequest(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "u", BaseURL: upstream.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active",
+			ModelMapping: map[string]string{"opus": "claude-opus-4"},
+		}},
+	})
+	if w.Code == http.StatusOK {
+		t.Fatalf("expected upstream error to be returned")
+	}
+	if got := models(); !reflect.DeepEqual(got, []string{"claude-opus-4"}) {
+		t.Fatalf("upstream models = %v, want single attempt", got)
+	}
+}
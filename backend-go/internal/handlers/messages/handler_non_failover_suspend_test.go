@@ -0,0 +1,73 @@
+package messages
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMessagesHandler_RepeatedNonFailoverErrorsSuspendChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"unsupported parameter"}}`))
+	}))
+	defer broken.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3",
+  "content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer healthy.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "broken", BaseURL: broken.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1},
+			{Name: "healthy", BaseURL: healthy.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Priority: 2},
+		},
+		LoadBalance: "failover",
+	})
+	defer cleanupCfg()
+	if err := cfgManager.SetFuzzyModeEnabled(false); err != nil {
+		t.Fatalf("SetFuzzyModeEnabled: %v", err)
+	}
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+	const threshold = 3
+	sch.SetNonFailoverSuspension(0.8, threshold, time.Minute)
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+			bytes.NewBufferString(`{"model":"claude-3","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < threshold; i++ {
+		if got := cfgManager.GetConfig().Upstream[0].Status; got != "active" {
+			t.Fatalf("request %d: channel suspended too early (status %q)", i+1, got)
+		}
+		if code := send(); code != http.StatusBadRequest {
+			t.Fatalf("request %d: status = %d, want 400 passed through", i+1, code)
+		}
+	}
+
+	if got := cfgManager.GetConfig().Upstream[0].Status; got != "suspended" {
+		t.Fatalf("channel status after %d non-failover errors = %q, want suspended", threshold, got)
+	}
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("request after suspension: status = %d, want 200 from healthy channel", code)
+	}
+}
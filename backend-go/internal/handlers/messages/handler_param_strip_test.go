@@ -0,0 +1,150 @@
+package messages
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// paramRejectingUpstream 模拟不支持 thinking 参数的上游：携带 thinking 时返回 400，否则返回正常响应
+type paramRejectingUpstream struct {
+	mu    sync.Mutex
+	auths []string
+	calls []bool // 每次请求是否携带 thinking
+}
+
+func (u *paramRejectingUpstream) handler(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	hasThinking := gjson.GetBytes(body, "thinking").Exists()
+
+	u.mu.Lock()
+	u.auths = append(u.auths, r.Header.Get("Authorization"))
+	u.calls = append(u.calls, hasThinking)
+	u.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if hasThinking {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"thinking: Extra inputs are not permitted"}}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+}
+
+func TestMessagesHandler_StripsRejectedParameterAndRetriesSameKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		channels int
+	}{
+		{"单渠道", 1},
+		{"多渠道", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &paramRejectingUpstream{}
+			upstream := httptest.NewServer(http.HandlerFunc(mock.handler))
+			defer upstream.Close()
+
+			cfg := config.Config{
+				LoadBalance:         "failover",
+				FuzzyModeEnabled:    true, // 即使 Fuzzy 模式会对 400 故障转移，也应先剥离参数重试
+				ParameterStripRules: map[string]string{"thinking: extra inputs": "thinking"},
+			}
+			for i := 0; i < tt.channels; i++ {
+				cfg.Upstream = append(cfg.Upstream, config.UpstreamConfig{
+					Name: "c" + strconv.Itoa(i), BaseURL: upstream.URL, APIKeys: []string{"k-a", "k-b"},
+					ServiceType: "claude", Status: "active", Priority: i + 1,
+				})
+			}
+
+			cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+			defer cleanupCfg()
+			sch, cleanupSch := createTestScheduler(t, cfgManager)
+			defer cleanupSch()
+
+			envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+			r := gin.New()
+			r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+			reqBody := `{"model":"claude-3","max_tokens":16,"thinking":{"type":"enabled","budget_tokens":1024},"messages":[{"role":"user","content":"hi"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+			req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200, body=%s", w.Code, w.Body.String())
+			}
+			mock.mu.Lock()
+			defer mock.mu.Unlock()
+			if len(mock.calls) != 2 || !mock.calls[0] || mock.calls[1] {
+				t.Fatalf("upstream calls (hasThinking) = %v, want [true false]", mock.calls)
+			}
+			if mock.auths[0] != mock.auths[1] {
+				t.Fatalf("retry used a different key: %q then %q", mock.auths[0], mock.auths[1])
+			}
+		})
+	}
+}
+
+func TestMessagesHandler_ParameterStripRetriesOnlyOnce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var bodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"top_k: unsupported parameter"}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "c0", BaseURL: upstream.URL, APIKeys: []string{"k-a"}, ServiceType: "claude", Status: "active", Priority: 1},
+		},
+		LoadBalance:         "failover",
+		ParameterStripRules: map[string]string{"unsupported parameter": "top_k"},
+	}
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	reqBody := `{"model":"claude-3","max_tokens":16,"top_k":5,"messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 {
+		t.Fatalf("upstream calls = %d, want 2", len(bodies))
+	}
+	if !strings.Contains(bodies[0], `"top_k"`) || strings.Contains(bodies[1], `"top_k"`) {
+		t.Fatalf("unexpected upstream bodies: %v", bodies)
+	}
+}
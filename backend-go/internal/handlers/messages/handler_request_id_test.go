@@ -0,0 +1,109 @@
+package messages
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// syncBuffer 并发安全的日志缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMessagesHandler_RequestIDPropagatesAcrossFailover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":{"type":"api_error","message":"boom"}}`))
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3",
+  "content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer healthy.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "bad", BaseURL: failing.URL, APIKeys: []string{"k-bad"}, ServiceType: "claude", Status: "active", Priority: 1},
+			{Name: "good", BaseURL: healthy.URL, APIKeys: []string{"k-good"}, ServiceType: "claude", Status: "active", Priority: 2},
+		},
+		LoadBalance: "failover",
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	store, err := metrics.NewSQLiteStore(&metrics.SQLiteStoreConfig{DBPath: t.TempDir() + "/metrics.db", RetentionDays: 7})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() err = %v", err)
+	}
+	defer store.Close()
+
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.Use(middleware.RequestIDMiddleware())
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, store))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		bytes.NewBufferString(`{"model":"claude-3","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	req.Header.Set(middleware.RequestIDHeader, "client-req-42")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(middleware.RequestIDHeader); got != "client-req-42" {
+		t.Fatalf("%s = %q, want client-req-42", middleware.RequestIDHeader, got)
+	}
+
+	out := logs.String()
+	for _, want := range []string{
+		"request_id=client-req-42 attempt=1 channel=bad",
+		"request_id=client-req-42 attempt=2 channel=good",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing attempt log %q in:\n%s", want, out)
+		}
+	}
+
+	records, _, err := store.QueryRequestLogs("messages", 10, 0)
+	if err != nil {
+		t.Fatalf("QueryRequestLogs() err = %v", err)
+	}
+	if len(records) != 1 || records[0].RequestID != "client-req-42" || records[0].ChannelName != "good" {
+		t.Fatalf("unexpected request logs: %+v", records)
+	}
+}
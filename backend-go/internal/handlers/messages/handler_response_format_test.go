@@ -0,0 +1,96 @@
+package messages
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMessagesHandler_AcceptOpenAIConvertsResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3",
+  "content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn",
+  "usage":{"input_tokens":12,"output_tokens":3}}`))
+	}))
+	defer upstream.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "c0", BaseURL: upstream.URL, APIKeys: []string{"k0"}, ServiceType: "claude", Status: "active", Priority: 1},
+		},
+		LoadBalance: "failover",
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	send := func(accept string) *httptest.ResponseRecorder {
+		reqBody := `{"model":"claude-3","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	w := send("application/vnd.openai+json")
+	if got := w.Header().Get(common.ResponseFormatHeader); got != common.ResponseFormatOpenAI {
+		t.Fatalf("%s = %q, want %q", common.ResponseFormatHeader, got, common.ResponseFormatOpenAI)
+	}
+	var openaiResp struct {
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &openaiResp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if openaiResp.Object != "chat.completion" || openaiResp.Model != "claude-3" || len(openaiResp.Choices) != 1 {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+	if c := openaiResp.Choices[0]; c.Message.Role != "assistant" || c.Message.Content != "hello" || c.FinishReason != "stop" {
+		t.Fatalf("unexpected choice: %s", w.Body.String())
+	}
+	if openaiResp.Usage.PromptTokens != 12 || openaiResp.Usage.CompletionTokens != 3 {
+		t.Fatalf("unexpected usage: %s", w.Body.String())
+	}
+
+	// 未指定 Accept 时保持 Claude 格式
+	w = send("")
+	if w.Header().Get(common.ResponseFormatHeader) != "" {
+		t.Fatalf("unexpected %s header without Accept negotiation", common.ResponseFormatHeader)
+	}
+	var claudeResp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &claudeResp); err != nil || claudeResp["type"] != "message" {
+		t.Fatalf("unexpected claude body: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,172 @@
+package messages
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// newResponsesUpstreamHandler 构造仅包含一个 responses 渠道的 Messages 处理器
+func newResponsesUpstreamHandler(t *testing.T, upstreamURL string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "resp", BaseURL: upstreamURL, APIKeys: []string{"k1"}, ServiceType: "responses", Status: "active", Priority: 1},
+		},
+		LoadBalance:          "failover",
+		ResponsesLoadBalance: "failover",
+		GeminiLoadBalance:    "failover",
+		FuzzyModeEnabled:     true,
+	}
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	t.Cleanup(cleanupCfg)
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	t.Cleanup(cleanupSch)
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+	return r
+}
+
+const responsesToolRequest = `{"model":"gpt-5","max_tokens":256,"system":"be brief",%s"tools":[{"name":"get_weather","description":"weather","input_schema":{"type":"object","properties":{"city":{"type":"string"}}}}],"messages":[` +
+	`{"role":"user","content":"weather in Paris?"},` +
+	`{"role":"assistant","content":[{"type":"tool_use","id":"call_1","name":"get_weather","input":{"city":"Paris"}}]},` +
+	`{"role":"user","content":[{"type":"tool_result","tool_use_id":"call_1","content":"sunny"}]}]}`
+
+func postMessages(r *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", "secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// assertResponsesToolRequest 校验上游收到的 Responses 请求包含转换后的工具与历史调用
+func assertResponsesToolRequest(t *testing.T, r *http.Request, body []byte) {
+	t.Helper()
+	if r.URL.Path != "/v1/responses" {
+		t.Errorf("path = %s, want /v1/responses", r.URL.Path)
+	}
+	if got := r.Header.Get("Authorization"); got != "Bearer k1" {
+		t.Errorf("Authorization = %q", got)
+	}
+	req := gjson.ParseBytes(body)
+	if req.Get("instructions").String() != "be brief" || req.Get("max_output_tokens").Int() != 256 {
+		t.Errorf("unexpected request fields: %s", body)
+	}
+	if req.Get("tools.0.type").String() != "function" || req.Get("tools.0.name").String() != "get_weather" {
+		t.Errorf("tools not converted: %s", req.Get("tools").Raw)
+	}
+	input := req.Get("input").Array()
+	if len(input) != 3 ||
+		input[1].Get("type").String() != "function_call" || input[1].Get("call_id").String() != "call_1" ||
+		input[2].Get("type").String() != "function_call_output" || input[2].Get("output").String() != "sunny" {
+		t.Errorf("input not converted: %s", req.Get("input").Raw)
+	}
+}
+
+func TestMessagesHandler_ResponsesUpstream_NonStreamToolUse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assertResponsesToolRequest(t, r, body)
+		if gjson.GetBytes(body, "stream").Bool() {
+			t.Errorf("stream should be false")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","object":"response","status":"completed","model":"gpt-5","output":[` +
+			`{"type":"message","role":"assistant","content":[{"type":"output_text","text":"checking"}]},` +
+			`{"type":"function_call","id":"fc_2","call_id":"call_2","name":"get_weather","arguments":"{\"city\":\"Lyon\"}"}],` +
+			`"usage":{"input_tokens":30,"output_tokens":7,"input_tokens_details":{"cached_tokens":10}}}`))
+	}))
+	defer upstream.Close()
+
+	w := postMessages(newResponsesUpstreamHandler(t, upstream.URL), strings.Replace(responsesToolRequest, "%s", "", 1))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		StopReason string `json:"stop_reason"`
+		Content    []struct {
+			Type  string                 `json:"type"`
+			Text  string                 `json:"text"`
+			ID    string                 `json:"id"`
+			Name  string                 `json:"name"`
+			Input map[string]interface{} `json:"input"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens          int `json:"input_tokens"`
+			OutputTokens         int `json:"output_tokens"`
+			CacheReadInputTokens int `json:"cache_read_input_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v body=%s", err, w.Body.String())
+	}
+	if resp.StopReason != "tool_use" {
+		t.Errorf("stop_reason = %q, want tool_use", resp.StopReason)
+	}
+	if len(resp.Content) != 2 || resp.Content[0].Text != "checking" ||
+		resp.Content[1].Type != "tool_use" || resp.Content[1].ID != "call_2" || resp.Content[1].Input["city"] != "Lyon" {
+		t.Errorf("unexpected content: %s", w.Body.String())
+	}
+	if resp.Usage.InputTokens != 20 || resp.Usage.OutputTokens != 7 || resp.Usage.CacheReadInputTokens != 10 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestMessagesHandler_ResponsesUpstream_StreamToolUse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assertResponsesToolRequest(t, r, body)
+		if !gjson.GetBytes(body, "stream").Bool() {
+			t.Errorf("stream should be true")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"response.created","response":{"id":"resp_1","model":"gpt-5"}}`,
+			`{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"delta":"checking"}`,
+			`{"type":"response.output_item.done","output_index":0,"item":{"type":"message","id":"msg_1"}}`,
+			`{"type":"response.output_item.added","output_index":1,"item":{"type":"function_call","id":"fc_2","call_id":"call_2","name":"get_weather","arguments":""}}`,
+			`{"type":"response.function_call_arguments.delta","item_id":"fc_2","output_index":1,"delta":"{\"city\":"}`,
+			`{"type":"response.function_call_arguments.delta","item_id":"fc_2","output_index":1,"delta":"\"Lyon\"}"}`,
+			`{"type":"response.output_item.done","output_index":1,"item":{"type":"function_call","id":"fc_2","call_id":"call_2","name":"get_weather","arguments":"{\"city\":\"Lyon\"}"}}`,
+			`{"type":"response.completed","response":{"id":"resp_1","usage":{"input_tokens":30,"output_tokens":7}}}`,
+		}
+		for _, ev := range events {
+			_, _ = w.Write([]byte("event: " + gjson.Get(ev, "type").String() + "\ndata: " + ev + "\n\n"))
+		}
+	}))
+	defer upstream.Close()
+
+	w := postMessages(newResponsesUpstreamHandler(t, upstream.URL), strings.Replace(responsesToolRequest, "%s", `"stream":true,`, 1))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	out := w.Body.String()
+	for _, want := range []string{
+		"event: message_start",
+		`"text":"checking"`,
+		`"id":"call_2","input":{},"name":"get_weather","type":"tool_use"`,
+		`"partial_json":"{\"city\":"`,
+		`"stop_reason":"tool_use"`,
+		"event: message_stop",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("stream missing %q:\n%s", want, out)
+		}
+	}
+}
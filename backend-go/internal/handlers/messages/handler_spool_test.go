@@ -0,0 +1,169 @@
+package messages
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// TestMessagesHandler_SpoolLargeBodyReplaysOnKeyFailover 测试大请求体落盘透传：首次尝试失败后使用落盘文件重放完整请求体
+func TestMessagesHandler_SpoolLargeBodyReplaysOnKeyFailover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var bodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		first := len(bodies) == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"busy"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":9,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "single", BaseURL: upstream.URL, APIKeys: []string{"k1", "k2"},
+			ServiceType: "claude", Status: "active",
+		}},
+		LoadBalance: "failover",
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024, RequestBodySpoolThreshold: 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	reqBody := `{"messages":[{"role":"user","content":"` + strings.Repeat("x", 4096) + `"}],"max_tokens":16,"model":"claude-3"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 {
+		t.Fatalf("upstream attempts = %d, want 2", len(bodies))
+	}
+	for i, body := range bodies {
+		if body != reqBody {
+			t.Fatalf("attempt %d body mismatch (len=%d, want %d)", i, len(body), len(reqBody))
+		}
+	}
+}
+
+// TestMessagesHandler_SpoolRejectsOversizedBody 测试落盘透传同样按渠道上限返回 413
+func TestMessagesHandler_SpoolRejectsOversizedBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("oversized request should not reach upstream")
+	}))
+	defer upstream.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "single", BaseURL: upstream.URL, APIKeys: []string{"k"},
+			ServiceType: "claude", Status: "active",
+		}},
+		LoadBalance: "failover",
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 2048, RequestBodySpoolThreshold: 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(`{"model":"claude-3","messages":"`+strings.Repeat("x", 4096)+`"}`))
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+// TestMessagesHandler_SpoolParamStripRetry 测试落盘透传同样支持参数剥离重试：匹配规则时读回内存删除参数后在同一密钥上重试
+func TestMessagesHandler_SpoolParamStripRetry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var bodies []string
+	var keys []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		keys = append(keys, r.Header.Get("Authorization"))
+		mu.Unlock()
+		if strings.Contains(string(body), `"thinking"`) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"thinking is not supported"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":9,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name: "single", BaseURL: upstream.URL, APIKeys: []string{"k1", "k2"},
+			ServiceType: "claude", Status: "active",
+		}},
+		LoadBalance:         "failover",
+		ParameterStripRules: map[string]string{"thinking": "thinking"},
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024, RequestBodySpoolThreshold: 1024}
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	reqBody := `{"model":"claude-3","thinking":{"type":"enabled","budget_tokens":1024},"messages":[{"role":"user","content":"` + strings.Repeat("x", 4096) + `"}],"max_tokens":16}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 {
+		t.Fatalf("upstream attempts = %d, want 2", len(bodies))
+	}
+	if bodies[0] != reqBody {
+		t.Fatalf("first attempt should send the spooled body unchanged")
+	}
+	if strings.Contains(bodies[1], `"thinking"`) || !strings.Contains(bodies[1], strings.Repeat("x", 4096)) {
+		t.Fatalf("retry body should drop thinking and keep messages, got len=%d", len(bodies[1]))
+	}
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("param strip retry should reuse the same key, got %v", keys)
+	}
+}
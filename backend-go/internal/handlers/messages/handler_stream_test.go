@@ -107,3 +107,83 @@ func TestMessagesHandler_MultiChannel_Stream_FailoverToNextChannel(t *testing.T)
 		t.Fatalf("expected wrong-model removed, got: %s", w.Body.String())
 	}
 }
+
+func TestMessagesHandler_MultiChannel_Stream_EmptyStreamFailover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	streamServer := func(calls *atomic.Int64, withContent bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			lines := []string{
+				"event: message_start",
+				"data: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"claude-3\",\"content\":[],\"usage\":{\"input_tokens\":5,\"output_tokens\":1}}}",
+				"",
+			}
+			if withContent {
+				lines = append(lines,
+					"event: content_block_start",
+					"data: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}",
+					"",
+					"event: content_block_delta",
+					"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"hello from good\"}}",
+					"",
+				)
+			}
+			lines = append(lines,
+				"event: message_stop",
+				"data: {\"type\":\"message_stop\"}",
+				"",
+			)
+			_, _ = w.Write([]byte(strings.Join(lines, "\n")))
+		}))
+	}
+
+	var callsEmpty, callsGood atomic.Int64
+	upstreamEmpty := streamServer(&callsEmpty, false)
+	defer upstreamEmpty.Close()
+	upstreamGood := streamServer(&callsGood, true)
+	defer upstreamGood.Close()
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "empty", BaseURL: upstreamEmpty.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1},
+			{Name: "good", BaseURL: upstreamGood.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Priority: 2},
+		},
+		LoadBalance: "failover",
+	}
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{
+		ProxyAccessKey:      "secret",
+		MaxRequestBodySize:  1024 * 1024,
+		Env:                 "production",
+		EmptyStreamFailover: true,
+	}
+	h := NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil)
+	r := gin.New()
+	r.POST("/v1/messages", h)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(`{"model":"claude-3","messages":[{"role":"user","content":"hi"}],"stream":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	if callsEmpty.Load() != 1 || callsGood.Load() != 1 {
+		t.Fatalf("calls empty=%d good=%d, want 1/1", callsEmpty.Load(), callsGood.Load())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "hello from good") || strings.Count(body, "event: message_start") != 1 {
+		t.Fatalf("客户端应只收到备用渠道的完整流, got: %s", body)
+	}
+	if sch.GetMessagesMetricsManager().GetChannelAggregatedMetrics(0, upstreamEmpty.URL, []string{"k1"}).FailureCount == 0 {
+		t.Fatalf("空流应计入失败指标")
+	}
+}
@@ -6,13 +6,16 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/billing"
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
 	"github.com/BenedictKing/claude-proxy/internal/metrics"
 	"github.com/BenedictKing/claude-proxy/internal/scheduler"
 	"github.com/BenedictKing/claude-proxy/internal/session"
@@ -82,6 +85,43 @@ func TestCountTokensHandler_ReturnsTokens(t *testing.T) {
 		if resp.InputTokens <= 0 {
 			t.Fatalf("input_tokens = %d, want > 0", resp.InputTokens)
 		}
+		if got := w.Header().Get(TokenCountEstimatedHeader); got != "" {
+			t.Fatalf("%s = %q, want empty when disabled", TokenCountEstimatedHeader, got)
+		}
+	})
+
+	t.Run("estimate header is opt-in", func(t *testing.T) {
+		estimateEnv := *envCfg
+		estimateEnv.CountTokensEstimateHeader = true
+		er := gin.New()
+		er.POST("/v1/messages/count_tokens", CountTokensHandler(&estimateEnv, nil, nil))
+
+		body := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", bytes.NewBufferString(body))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+
+		er.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get(TokenCountEstimatedHeader) != "true" {
+			t.Fatalf("status = %d, header = %q, body = %s", w.Code, w.Header().Get(TokenCountEstimatedHeader), w.Body.String())
+		}
+	})
+
+	t.Run("maintenance mode returns 503", func(t *testing.T) {
+		common.EnableMaintenance("provider outage", 60)
+		defer common.DisableMaintenance()
+
+		body := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", bytes.NewBufferString(body))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Fatalf("status = %d, Retry-After = %q, body = %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+		}
 	})
 }
 
@@ -283,3 +323,428 @@ func TestTruncateErrorMessage_TruncatesToMaxLen(t *testing.T) {
 		t.Fatalf("expected suffix \"...\"")
 	}
 }
+
+func TestMessagesHandler_CapturesAccountHintFromFirstSuccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// 首次请求返回 org-first，之后返回 org-second（不应覆盖首次捕获的值）
+		if calls.Add(1) == 1 {
+			w.Header().Set("anthropic-organization-id", "org-first")
+		} else {
+			w.Header().Set("anthropic-organization-id", "org-second")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+  "id":"msg_org",
+  "type":"message",
+  "role":"assistant",
+  "content":[{"type":"text","text":"ok"}],
+  "usage":{"input_tokens":1,"output_tokens":1}
+}`))
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{
+				Name:        "c0",
+				BaseURL:     upstream.URL,
+				APIKeys:     []string{"k-org"},
+				ServiceType: "claude",
+				Status:      "active",
+				Priority:    1,
+			},
+		},
+		LoadBalance:          "failover",
+		ResponsesLoadBalance: "failover",
+		GeminiLoadBalance:    "failover",
+	}
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	defer cleanupCfg()
+
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{
+		ProxyAccessKey:     "secret",
+		MaxRequestBodySize: 1024 * 1024,
+	}
+
+	r := gin.New()
+	r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+	for i := 0; i < 2; i++ {
+		reqBody := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}],"max_tokens":16}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d body=%s", i, w.Code, w.Body.String())
+		}
+	}
+
+	mm := sch.GetMessagesMetricsManager()
+	km := mm.GetKeyMetrics(upstream.URL, "k-org")
+	if km == nil {
+		t.Fatalf("expected key metrics to exist")
+	}
+	if km.AccountHint != "org-first" {
+		t.Fatalf("AccountHint = %q, want %q", km.AccountHint, "org-first")
+	}
+
+	resp := mm.ToResponseMultiURL(0, []string{upstream.URL}, []string{"k-org"}, 0)
+	if len(resp.KeyMetrics) != 1 || resp.KeyMetrics[0].AccountHint != "org-first" {
+		t.Fatalf("unexpected key metrics response: %+v", resp.KeyMetrics)
+	}
+}
+
+func TestMessagesHandler_MultiChannel_RetryBudgetStopsFailover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":{"message":"boom"}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "c0", BaseURL: upstream.URL, APIKeys: []string{"k0"}, ServiceType: "claude", Status: "active", Priority: 1},
+			{Name: "c1", BaseURL: upstream.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 2},
+			{Name: "c2", BaseURL: upstream.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Priority: 3},
+		},
+		LoadBalance:      "failover",
+		FuzzyModeEnabled: true,
+	}
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	defer cleanupCfg()
+
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+	// 容量 1：首次尝试免费，仅允许一次故障转移
+	sch.SetRetryBudget(1)
+
+	envCfg := &config.EnvConfig{
+		ProxyAccessKey:     "secret",
+		MaxRequestBodySize: 1024 * 1024,
+	}
+	h := NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.POST("/v1/messages", h)
+
+	reqBody := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}],"max_tokens":16}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code == http.StatusOK {
+		t.Fatalf("status = %d, want failure", w.Code)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("upstream calls = %d, want %d", calls.Load(), 2)
+	}
+	if stats := sch.GetRetryBudgetStats(); stats.Rejected != 1 {
+		t.Fatalf("rejected = %d, want 1", stats.Rejected)
+	}
+}
+
+func TestMessagesHandler_MultiChannel_FailoverDelayBetweenChannels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var callTimes []time.Time
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		callTimes = append(callTimes, time.Now())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":{"message":"boom"}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "c0", BaseURL: upstream.URL, APIKeys: []string{"k0"}, ServiceType: "claude", Status: "active", Priority: 1},
+			{Name: "c1", BaseURL: upstream.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 2},
+			{Name: "c2", BaseURL: upstream.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Priority: 3},
+		},
+		LoadBalance:      "failover",
+		FuzzyModeEnabled: true,
+	}
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	defer cleanupCfg()
+
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{
+		ProxyAccessKey:     "secret",
+		MaxRequestBodySize: 1024 * 1024,
+		FailoverDelayMs:    40,
+		FailoverDelayMaxMs: 1000,
+	}
+	h := NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.POST("/v1/messages", h)
+
+	reqBody := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}],"max_tokens":16}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code == http.StatusOK {
+		t.Fatalf("status = %d, want failure", w.Code)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(callTimes) != 3 {
+		t.Fatalf("upstream calls = %d, want 3", len(callTimes))
+	}
+	// 指数退避：第一个渠道失败后等待 40ms，第二个渠道失败后等待 80ms
+	if gap := callTimes[1].Sub(callTimes[0]); gap < 40*time.Millisecond {
+		t.Fatalf("gap between channel 0 and 1 = %s, want >= 40ms", gap)
+	}
+	if gap := callTimes[2].Sub(callTimes[1]); gap < 80*time.Millisecond {
+		t.Fatalf("gap between channel 1 and 2 = %s, want >= 80ms", gap)
+	}
+}
+
+// TestMessagesHandler_MultiChannel_FailoverConcurrencyCap 模拟全部上游故障时大量并发请求同时故障转移，
+// 断言上游观察到的在途重试数不超过全局上限（首次尝试不计入）
+func TestMessagesHandler_MultiChannel_FailoverConcurrencyCap(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		maxConcurrent = 2
+		numRequests   = 20
+	)
+
+	var seen sync.Map
+	var retryInFlight, retryPeak, retries atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, retried := seen.LoadOrStore(r.Header.Get("X-Test-Request-Id"), true); retried {
+			retries.Add(1)
+			n := retryInFlight.Add(1)
+			for {
+				p := retryPeak.Load()
+				if n <= p || retryPeak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			defer retryInFlight.Add(-1)
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":{"message":"outage"}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "c0", BaseURL: upstream.URL, APIKeys: []string{"k0a", "k0b"}, ServiceType: "claude", Status: "active", Priority: 1},
+			{Name: "c1", BaseURL: upstream.URL, APIKeys: []string{"k1a", "k1b"}, ServiceType: "claude", Status: "active", Priority: 2},
+			{Name: "c2", BaseURL: upstream.URL, APIKeys: []string{"k2a", "k2b"}, ServiceType: "claude", Status: "active", Priority: 3},
+		},
+		LoadBalance:      "failover",
+		FuzzyModeEnabled: true,
+	}
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	defer cleanupCfg()
+
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+	sch.SetFailoverConcurrency(maxConcurrent, 5*time.Second)
+
+	envCfg := &config.EnvConfig{
+		ProxyAccessKey:     "secret",
+		MaxRequestBodySize: 1024 * 1024,
+	}
+	h := NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.POST("/v1/messages", h)
+
+	reqBody := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}],"max_tokens":16}`
+	var wg sync.WaitGroup
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+			req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+			req.Header.Set("X-Test-Request-Id", strconv.Itoa(i))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code == http.StatusOK {
+				t.Errorf("request %d: status = %d, want failure", i, w.Code)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if retries.Load() == 0 {
+		t.Fatal("期望发生故障转移重试")
+	}
+	if got := retryPeak.Load(); got > maxConcurrent {
+		t.Fatalf("上游观察到的在途重试峰值 = %d，超过上限 %d", got, maxConcurrent)
+	}
+	stats := sch.GetFailoverConcurrencyStats()
+	if !stats.Enabled || stats.Peak > maxConcurrent || stats.InFlight != 0 {
+		t.Fatalf("failover concurrency stats = %+v", stats)
+	}
+	if stats.Acquired != retries.Load() {
+		t.Fatalf("acquired = %d, want %d (每次重试都应占用槽位)", stats.Acquired, retries.Load())
+	}
+}
+
+func TestMessagesHandler_MultiChannel_ResponseSchemaFailover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newUpstream := func(text string, calls *atomic.Int64) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			body := map[string]any{
+				"id":      "msg_" + text,
+				"type":    "message",
+				"role":    "assistant",
+				"content": []map[string]any{{"type": "text", "text": text}},
+				"usage":   map[string]any{"input_tokens": 1, "output_tokens": 1},
+			}
+			_ = json.NewEncoder(w).Encode(body)
+		}))
+	}
+
+	schema := json.RawMessage(`{"type":"object","required":["answer"],"properties":{"answer":{"type":"integer"}}}`)
+
+	tests := []struct {
+		name       string
+		firstText  string
+		wantFirst  int64
+		wantSecond int64
+	}{
+		{name: "conforming", firstText: `{"answer":1}`, wantFirst: 1, wantSecond: 0},
+		{name: "non-conforming", firstText: `{"answer":"one"}`, wantFirst: 1, wantSecond: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls1, calls2 atomic.Int64
+			upstream1 := newUpstream(tt.firstText, &calls1)
+			defer upstream1.Close()
+			upstream2 := newUpstream(`{"answer":2}`, &calls2)
+			defer upstream2.Close()
+
+			cfg := config.Config{
+				Upstream: []config.UpstreamConfig{
+					{Name: "first", BaseURL: upstream1.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1, ResponseSchema: schema},
+					{Name: "second", BaseURL: upstream2.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Priority: 2, ResponseSchema: schema},
+				},
+				LoadBalance: "failover",
+			}
+
+			cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+			defer cleanupCfg()
+
+			sch, cleanupSch := createTestScheduler(t, cfgManager)
+			defer cleanupSch()
+
+			envCfg := &config.EnvConfig{
+				ProxyAccessKey:     "secret",
+				MaxRequestBodySize: 1024 * 1024,
+			}
+			h := NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil)
+
+			r := gin.New()
+			r.POST("/v1/messages", h)
+
+			reqBody := `{"model":"claude-3","messages":[{"role":"user","content":"hi"}],"max_tokens":16}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+			req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if calls1.Load() != tt.wantFirst || calls2.Load() != tt.wantSecond {
+				t.Fatalf("calls = (%d, %d), want (%d, %d)", calls1.Load(), calls2.Load(), tt.wantFirst, tt.wantSecond)
+			}
+		})
+	}
+}
+
+func TestMessagesHandler_MultiChannel_NoChannelForModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "opus", BaseURL: upstream.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active", Priority: 1, SupportedModels: []string{"claude-3-opus*"}},
+			{Name: "sonnet", BaseURL: upstream.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Priority: 2, SupportedModels: []string{"claude-3-sonnet*"}},
+		},
+		LoadBalance:      "failover",
+		FuzzyModeEnabled: true,
+	}
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, cfg)
+	defer cleanupCfg()
+
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{
+		ProxyAccessKey:     "secret",
+		MaxRequestBodySize: 1024 * 1024,
+	}
+	h := NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.POST("/v1/messages", h)
+
+	reqBody := `{"model":"claude-3-haiku","messages":[{"role":"user","content":"hi"}],"max_tokens":16}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(reqBody))
+	req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d, body = %s", w.Code, http.StatusNotFound, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "NO_CHANNEL_FOR_MODEL") {
+		t.Fatalf("body should contain error code, got %s", w.Body.String())
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("upstream should not be called, calls = %d", calls.Load())
+	}
+}
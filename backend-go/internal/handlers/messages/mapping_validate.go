@@ -0,0 +1,213 @@
+package messages
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/providers"
+	"github.com/gin-gonic/gin"
+)
+
+// maxMappingValidationProbes 单次校验最多发送的探测请求数（探测为真实补全请求，会产生少量费用）
+const maxMappingValidationProbes = 20
+
+// 映射目标的校验方式
+const (
+	mappingCheckModels = "models" // 目标出现在渠道 /v1/models 列表中
+	mappingCheckProbe  = "probe"  // 向渠道发送最小补全请求
+)
+
+// MappingTargetValidation 单个映射目标的校验结果
+type MappingTargetValidation struct {
+	Model        string `json:"model"`
+	Valid        bool   `json:"valid"`
+	CheckedBy    string `json:"checkedBy"`              // models / probe
+	Inconclusive bool   `json:"inconclusive,omitempty"` // 探测因非模型原因失败（密钥无效、上游 5xx 等），无法判断目标是否可用
+	Status       int    `json:"status,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// MappingValidation 单条映射（源 → 目标/候选链）的校验结果
+type MappingValidation struct {
+	Source  string                    `json:"source"`
+	Valid   bool                      `json:"valid"` // 所有目标均可用
+	Targets []MappingTargetValidation `json:"targets"`
+}
+
+// MappingValidationResult 模型映射校验结果
+type MappingValidationResult struct {
+	ChannelIndex        int                 `json:"channelIndex"`
+	ChannelName         string              `json:"channelName"`
+	Method              string              `json:"method"`
+	ModelsListAvailable bool                `json:"modelsListAvailable"`
+	Valid               bool                `json:"valid"`
+	Mappings            []MappingValidation `json:"mappings"`
+}
+
+// ValidateModelMapping 保存前校验模型映射：逐个检查映射目标能否由该渠道提供服务
+// 请求体: {"modelMapping": {...}}（格式同渠道配置，支持候选链数组；省略时校验渠道当前映射）
+// 查询参数: method（auto 默认：先查 /v1/models 列表，列表不可用或目标未列出时再探测；models 仅查列表；probe 全部探测）、keyIndex（默认 0）
+// 校验不修改渠道配置，探测请求不计入路由指标
+func ValidateModelMapping(envCfg *config.EnvConfig, cfgManager *config.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel ID"})
+			return
+		}
+
+		cfg := cfgManager.GetConfig()
+		if id < 0 || id >= len(cfg.Upstream) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+			return
+		}
+		upstream := cfg.Upstream[id].Clone()
+
+		method := c.DefaultQuery("method", "auto")
+		if method != "auto" && method != mappingCheckModels && method != mappingCheckProbe {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid method (auto, models, probe)"})
+			return
+		}
+
+		keyIndex := 0
+		if raw := c.Query("keyIndex"); raw != "" {
+			if keyIndex, err = strconv.Atoi(raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid keyIndex"})
+				return
+			}
+		}
+		if keyIndex < 0 || keyIndex >= len(upstream.APIKeys) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("keyIndex out of range (channel has %d keys)", len(upstream.APIKeys))})
+			return
+		}
+
+		var proposed config.UpstreamUpdate
+		if body, _ := io.ReadAll(c.Request.Body); len(body) > 0 {
+			if err := json.Unmarshal(body, &proposed); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		mapping, chains := proposed.ModelMapping, proposed.ModelMappingChains
+		if mapping == nil {
+			mapping, chains = upstream.ModelMapping, upstream.ModelMappingChains
+		}
+		if len(mapping) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "modelMapping is empty"})
+			return
+		}
+
+		provider := providers.GetProvider(upstream.ServiceType)
+		if provider == nil && method != mappingCheckModels {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported service type: " + upstream.ServiceType})
+			return
+		}
+
+		apiKey := upstream.APIKeys[keyIndex]
+		upstream.BaseURL = upstream.GetEffectiveBaseURL()
+		// 探测时直接请求目标模型，不再经过渠道已保存的映射
+		upstream.ModelMapping, upstream.ModelMappingChains = nil, nil
+
+		result := &MappingValidationResult{ChannelIndex: id, ChannelName: upstream.Name, Method: method, Valid: true}
+		var listed map[string]bool
+		if method != mappingCheckProbe {
+			listed = fetchChannelModelIDs(c, upstream, apiKey)
+			result.ModelsListAvailable = listed != nil
+		}
+
+		sources := make([]string, 0, len(mapping))
+		for source := range mapping {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		checked := make(map[string]MappingTargetValidation)
+		probes := 0
+		check := func(target string) MappingTargetValidation {
+			if v, ok := checked[target]; ok {
+				return v
+			}
+			v := MappingTargetValidation{Model: target}
+			switch {
+			case listed[target]:
+				v.Valid, v.CheckedBy = true, mappingCheckModels
+			case method == mappingCheckModels:
+				v.CheckedBy = mappingCheckModels
+				if listed == nil {
+					v.Inconclusive = true
+					v.Error = "渠道模型列表不可用"
+				} else {
+					v.Error = "目标模型不在渠道模型列表中"
+				}
+			case probes >= maxMappingValidationProbes:
+				v.CheckedBy, v.Inconclusive = mappingCheckProbe, true
+				v.Error = fmt.Sprintf("超出单次校验探测上限 (%d)", maxMappingValidationProbes)
+			default:
+				probes++
+				probe := probeChannel(c, envCfg, provider, upstream, apiKey, target, cfgManager.GetFuzzyModeEnabled())
+				v.CheckedBy, v.Status = mappingCheckProbe, probe.Status
+				switch {
+				case probe.Success:
+					v.Valid = true
+				case probe.modelNotFound:
+					v.Error = "上游返回模型不存在: " + probe.Error
+				default:
+					v.Inconclusive = true
+					v.Error = probe.Error
+				}
+			}
+			checked[target] = v
+			return v
+		}
+
+		for _, source := range sources {
+			targets := chains[source]
+			if len(targets) == 0 {
+				targets = []string{mapping[source]}
+			}
+			mv := MappingValidation{Source: source, Valid: true, Targets: make([]MappingTargetValidation, 0, len(targets))}
+			for _, target := range targets {
+				v := check(target)
+				mv.Targets = append(mv.Targets, v)
+				mv.Valid = mv.Valid && v.Valid
+			}
+			result.Valid = result.Valid && mv.Valid
+			result.Mappings = append(result.Mappings, mv)
+		}
+
+		log.Printf("[Messages-ValidateMapping] 渠道 [%d] %s 校验 %d 条模型映射: valid=%v, method=%s, 探测 %d 次",
+			id, upstream.Name, len(sources), result.Valid, method, probes)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// fetchChannelModelIDs 获取指定渠道的模型 ID 列表，列表不可用（请求失败、非 200、格式无法解析）时返回 nil
+func fetchChannelModelIDs(c *gin.Context, upstream *config.UpstreamConfig, apiKey string) map[string]bool {
+	resp, err := sendModelsRequest(c, upstream, apiKey, http.MethodGet, buildModelsURL(upstream.BaseURL))
+	if err != nil {
+		log.Printf("[Messages-ValidateMapping] 渠道 %s 获取模型列表失败: %v", upstream.Name, err)
+		return nil
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		log.Printf("[Messages-ValidateMapping] 渠道 %s 模型列表不可用: status=%d", upstream.Name, resp.StatusCode)
+		return nil
+	}
+
+	var models ModelsResponse
+	if err := json.Unmarshal(body, &models); err != nil || len(models.Data) == 0 {
+		return nil
+	}
+	ids := make(map[string]bool, len(models.Data))
+	for _, m := range models.Data {
+		ids[m.ID] = true
+	}
+	return ids
+}
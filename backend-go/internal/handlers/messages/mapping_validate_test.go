@@ -0,0 +1,119 @@
+package messages
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateModelMapping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var probed []string
+	modelsAvailable := true
+	upstreamSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/models" {
+			if !modelsAvailable {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"claude-sonnet-4"},{"id":"claude-3-5-haiku"}]}`))
+			return
+		}
+		var body struct {
+			Model string `json:"model"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+		mu.Lock()
+		probed = append(probed, body.Model)
+		mu.Unlock()
+		switch body.Model {
+		case "claude-opus-4-1":
+			_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"p"}],"usage":{"input_tokens":8,"output_tokens":1}}`))
+		case "claude-overloaded":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"not_found_error","message":"model: ` + body.Model + `"}}`))
+		}
+	}))
+	defer upstreamSrv.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{{
+			Name:         "claude",
+			BaseURL:      upstreamSrv.URL,
+			APIKeys:      []string{"sk-ant-key-1111111111111"},
+			ServiceType:  "claude",
+			ModelMapping: map[string]string{"sonnet": "claude-sonnet-4"},
+		}},
+	})
+	defer cleanupCfg()
+
+	r := gin.New()
+	r.POST("/api/messages/channels/:id/validate-mapping", ValidateModelMapping(&config.EnvConfig{RequestTimeout: 5000}, cfgManager))
+	validate := func(query, body string) (int, MappingValidationResult) {
+		t.Helper()
+		mu.Lock()
+		probed = nil
+		mu.Unlock()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/messages/channels/0/validate-mapping"+query, bytes.NewBufferString(body)))
+		var result MappingValidationResult
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	// 候选链：列表中的目标直接通过；未列出的目标再探测确认
+	code, result := validate("", `{"modelMapping":{"haiku":"claude-3-5-haiku","opus":["claude-opus-4-1","claude-opuss-4"]}}`)
+	if code != http.StatusOK || !result.ModelsListAvailable || result.Valid || len(result.Mappings) != 2 {
+		t.Fatalf("code=%d result=%+v", code, result)
+	}
+	haiku, opus := result.Mappings[0], result.Mappings[1]
+	if haiku.Source != "haiku" || !haiku.Valid || haiku.Targets[0].CheckedBy != mappingCheckModels {
+		t.Fatalf("haiku = %+v", haiku)
+	}
+	if opus.Valid || len(opus.Targets) != 2 || !opus.Targets[0].Valid || opus.Targets[0].CheckedBy != mappingCheckProbe {
+		t.Fatalf("opus = %+v", opus)
+	}
+	if typo := opus.Targets[1]; typo.Valid || typo.Inconclusive || typo.Status != http.StatusNotFound {
+		t.Fatalf("typo target = %+v", typo)
+	}
+	if len(probed) != 2 {
+		t.Fatalf("probed = %v, want only unlisted targets", probed)
+	}
+
+	// 省略请求体时校验渠道当前映射；method=models 不发送探测
+	code, result = validate("?method=models", "")
+	if code != http.StatusOK || !result.Valid || len(result.Mappings) != 1 || result.Mappings[0].Source != "sonnet" || len(probed) != 0 {
+		t.Fatalf("code=%d result=%+v probed=%v", code, result, probed)
+	}
+
+	// 列表不可用时回退到探测；非模型原因的失败标记为无法判断
+	modelsAvailable = false
+	code, result = validate("", `{"modelMapping":{"busy":"claude-overloaded"}}`)
+	if code != http.StatusOK || result.ModelsListAvailable || result.Valid {
+		t.Fatalf("code=%d result=%+v", code, result)
+	}
+	if v := result.Mappings[0].Targets[0]; !v.Inconclusive || v.Status != http.StatusServiceUnavailable {
+		t.Fatalf("overloaded target = %+v", v)
+	}
+
+	if code, _ := validate("?method=bogus", `{"modelMapping":{"a":"b"}}`); code != http.StatusBadRequest {
+		t.Fatalf("invalid method code = %d", code)
+	}
+	if code, _ := validate("", `{"modelMapping":{"a":[]}}`); code != http.StatusBadRequest {
+		t.Fatalf("empty chain code = %d", code)
+	}
+}
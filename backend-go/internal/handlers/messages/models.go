@@ -14,6 +14,7 @@ import (
 
 	"github.com/BenedictKing/claude-proxy/internal/cache"
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
 	"github.com/BenedictKing/claude-proxy/internal/httpclient"
 	"github.com/BenedictKing/claude-proxy/internal/middleware"
 	"github.com/BenedictKing/claude-proxy/internal/scheduler"
@@ -74,6 +75,8 @@ func ModelsHandler(envCfg *config.EnvConfig, cfgManager *config.ConfigManager, c
 
 		cacheKey := modelsCacheKey(c.Request)
 		if cached, ok := respCache.Get(cacheKey); ok {
+			// 缓存保存未过滤的列表，模型准入规则在返回时应用（支持配置热重载）
+			cached.Body = filterModelsBody(cfgManager, cached.Body)
 			writeCachedHTTPResponse(c, cached)
 			return
 		}
@@ -114,10 +117,40 @@ func ModelsHandler(envCfg *config.EnvConfig, cfgManager *config.ConfigManager, c
 			Header:     http.Header{"Content-Type": []string{modelsCacheContentType}},
 			Body:       body,
 		})
-		c.Data(http.StatusOK, modelsCacheContentType, body)
+		c.Data(http.StatusOK, modelsCacheContentType, filterModelsBody(cfgManager, body))
 	}
 }
 
+// filterModelsBody 按全局 allowedModels / blockedModels 过滤模型列表响应体；
+// 未配置准入规则或响应体无法解析时原样返回
+func filterModelsBody(cfgManager *config.ConfigManager, body []byte) []byte {
+	if cfgManager == nil || !cfgManager.HasModelFilter() {
+		return body
+	}
+
+	var resp ModelsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return body
+	}
+
+	filtered := make([]ModelEntry, 0, len(resp.Data))
+	for _, m := range resp.Data {
+		if cfgManager.IsModelAllowed(m.ID) {
+			filtered = append(filtered, m)
+		}
+	}
+	if len(filtered) == len(resp.Data) {
+		return body
+	}
+	resp.Data = filtered
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
 // ModelsDetailHandler 处理 /v1/models/:model 请求，转发到上游
 func ModelsDetailHandler(envCfg *config.EnvConfig, cfgManager *config.ConfigManager, channelScheduler *scheduler.ChannelScheduler) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -137,6 +170,17 @@ func ModelsDetailHandler(envCfg *config.EnvConfig, cfgManager *config.ConfigMana
 			return
 		}
 
+		// 被代理策略拒绝的模型视为不存在
+		if cfgManager != nil && !cfgManager.IsModelAllowed(modelID) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{
+					"message": "model not found",
+					"type":    "not_found_error",
+				},
+			})
+			return
+		}
+
 		// 先尝试 Messages 渠道
 		if body, ok := tryModelsRequest(c, cfgManager, channelScheduler, "GET", "/"+modelID, false); ok {
 			c.Data(http.StatusOK, "application/json", body)
@@ -212,9 +256,10 @@ func tryModelsRequest(c *gin.Context, cfgManager *config.ConfigManager, channelS
 		channelType = "Responses"
 	}
 
+	selectionCtx := common.BuildSelectionContext(c, cfgManager, "")
 	for attempt := 0; attempt < maxChannelRetries; attempt++ {
 		// 使用调度器选择渠道
-		selection, err := channelScheduler.SelectChannel(c.Request.Context(), "", failedChannels, isResponses)
+		selection, err := channelScheduler.SelectChannel(selectionCtx, "", failedChannels, isResponses)
 		if err != nil {
 			log.Printf("[Models] %s 渠道无可用: %v", channelType, err)
 			break
@@ -229,7 +274,6 @@ func tryModelsRequest(c *gin.Context, cfgManager *config.ConfigManager, channelS
 		}
 
 		url := buildModelsURL(upstream.BaseURL) + suffix
-		client := httpclient.GetManager().GetStandardClient(modelsRequestTimeout, upstream.InsecureSkipVerify)
 
 		// 获取第一个可用的 key
 		apiKey, err := cfgManager.GetNextAPIKey(upstream, nil)
@@ -239,16 +283,7 @@ func tryModelsRequest(c *gin.Context, cfgManager *config.ConfigManager, channelS
 			continue
 		}
 
-		req, err := http.NewRequestWithContext(c.Request.Context(), method, url, nil)
-		if err != nil {
-			log.Printf("[Models] %s 创建请求失败: channel=%s, url=%s, error=%v", channelType, upstream.Name, url, err)
-			failedChannels[selection.ChannelIndex] = true
-			continue
-		}
-		req.Header.Set("Authorization", "Bearer "+apiKey)
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := client.Do(req)
+		resp, err := sendModelsRequest(c, upstream, apiKey, method, url)
 		if err != nil {
 			log.Printf("[Models] %s 请求失败: channel=%s, key=%s, url=%s, error=%v",
 				channelType, upstream.Name, utils.MaskAPIKey(apiKey), url, err)
@@ -279,6 +314,20 @@ func tryModelsRequest(c *gin.Context, cfgManager *config.ConfigManager, channelS
 	return nil, false
 }
 
+// sendModelsRequest 使用指定渠道与密钥请求 models 端点
+func sendModelsRequest(c *gin.Context, upstream *config.UpstreamConfig, apiKey, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
+
+	client := httpclient.GetManager().GetStandardClient(modelsRequestTimeout, upstream.InsecureSkipVerify, upstream.ProxyURL)
+	return client.Do(req)
+}
+
 // buildModelsURL 构建 models 端点的 URL
 func buildModelsURL(baseURL string) string {
 	skipVersionPrefix := strings.HasSuffix(baseURL, "#")
@@ -0,0 +1,161 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/BenedictKing/claude-proxy/internal/providers"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// dispatchShadowRequests 将请求异步复制到所有 active 影子渠道（响应丢弃，仅记录结果）
+// 上游请求在当前 goroutine 中构建（需要读取 gin.Context），发送与读取响应在独立 goroutine 中进行，
+// 使用与客户端请求无关的 context，客户端断开或主请求结束不会中断影子请求
+func dispatchShadowRequests(
+	c *gin.Context,
+	envCfg *config.EnvConfig,
+	cfgManager *config.ConfigManager,
+	channelScheduler *scheduler.ChannelScheduler,
+	bodyBytes []byte,
+	claudeReq types.ClaudeRequest,
+) {
+	shadows := channelScheduler.GetShadowChannels()
+	if len(shadows) == 0 {
+		return
+	}
+	defer common.RestoreRequestBody(c, bodyBytes)
+
+	for _, shadow := range shadows {
+		upstream := shadow.Upstream
+		provider := providers.GetProvider(upstream.ServiceType)
+		if provider == nil {
+			continue
+		}
+		apiKey, err := cfgManager.GetNextAPIKey(upstream, nil)
+		if err != nil {
+			continue
+		}
+
+		common.RestoreRequestBody(c, bodyBytes)
+		providerReq, _, err := provider.ConvertToProviderRequest(c, upstream, apiKey)
+		if err != nil {
+			channelScheduler.RecordShadowResult("messages", shadow.Index, upstream, claudeReq.Model, scheduler.ShadowResult{
+				Error: truncateErrorMessage(err.Error()),
+			})
+			continue
+		}
+
+		release, ok := channelScheduler.TryAcquireShadowSlot("messages")
+		if !ok {
+			if envCfg.ShouldLog("debug") {
+				log.Printf("[Messages-Shadow] 影子请求并发已满，丢弃发往渠道 %s 的影子请求", upstream.Name)
+			}
+			continue
+		}
+
+		go func(index int, upstream *config.UpstreamConfig, provider providers.Provider, req *http.Request) {
+			defer release()
+			ctx, cancel := shadowContext(envCfg)
+			defer cancel()
+
+			result := sendShadowRequest(req.WithContext(ctx), provider, upstream, envCfg, claudeReq)
+			channelScheduler.RecordShadowResult("messages", index, upstream, claudeReq.Model, result)
+			if envCfg.ShouldLog("debug") {
+				log.Printf("[Messages-Shadow] 渠道 %s 影子请求完成: success=%v, 耗时=%dms, key=%s",
+					upstream.Name, result.Success, result.Latency.Milliseconds(), utils.MaskAPIKey(apiKey))
+			}
+		}(shadow.Index, upstream, provider, providerReq)
+	}
+}
+
+// shadowContext 影子请求的独立 context，整体超时取 REQUEST_TIMEOUT（流式请求也不会无限占用槽位）
+func shadowContext(envCfg *config.EnvConfig) (context.Context, context.CancelFunc) {
+	if envCfg.RequestTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(envCfg.RequestTimeout)*time.Millisecond)
+}
+
+// sendShadowRequest 发送影子请求并读取完整响应，仅提取 usage
+func sendShadowRequest(
+	req *http.Request,
+	provider providers.Provider,
+	upstream *config.UpstreamConfig,
+	envCfg *config.EnvConfig,
+	claudeReq types.ClaudeRequest,
+) scheduler.ShadowResult {
+	start := time.Now()
+	resp, err := common.SendRequestForModel(req, upstream, envCfg, claudeReq.Stream, claudeReq.Model)
+	if err != nil {
+		return scheduler.ShadowResult{Latency: time.Since(start), Error: truncateErrorMessage(err.Error())}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		respBody = utils.DecompressGzipIfNeeded(resp, respBody)
+		return scheduler.ShadowResult{
+			Latency: time.Since(start),
+			Error:   truncateErrorMessage(fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(respBody))),
+		}
+	}
+
+	if claudeReq.Stream {
+		return readShadowStream(resp, provider, start)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return scheduler.ShadowResult{Latency: time.Since(start), Error: truncateErrorMessage(err.Error())}
+	}
+	claudeResp, err := provider.ConvertToClaudeResponse(&types.ProviderResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
+		Body:       respBody,
+	})
+	if err != nil {
+		return scheduler.ShadowResult{Latency: time.Since(start), Error: truncateErrorMessage(err.Error())}
+	}
+	return scheduler.ShadowResult{Success: true, Latency: time.Since(start), Usage: claudeResp.Usage}
+}
+
+// readShadowStream 读取完整的流式响应并汇总各事件中的 usage，延迟按流结束计算
+func readShadowStream(resp *http.Response, provider providers.Provider, start time.Time) scheduler.ShadowResult {
+	eventChan, errChan, err := provider.HandleStreamResponse(resp.Body)
+	if err != nil {
+		return scheduler.ShadowResult{Latency: time.Since(start), Error: truncateErrorMessage(err.Error())}
+	}
+
+	var usage *types.Usage
+	for event := range eventChan {
+		hasUsage, _, data := common.CheckEventUsageStatus(event, false)
+		if !hasUsage {
+			continue
+		}
+		if usage == nil {
+			usage = &types.Usage{}
+		}
+		usage.InputTokens = max(usage.InputTokens, data.InputTokens)
+		usage.OutputTokens = max(usage.OutputTokens, data.OutputTokens)
+		usage.CacheCreationInputTokens = max(usage.CacheCreationInputTokens, data.CacheCreationInputTokens)
+		usage.CacheReadInputTokens = max(usage.CacheReadInputTokens, data.CacheReadInputTokens)
+	}
+
+	select {
+	case streamErr := <-errChan:
+		if streamErr != nil {
+			return scheduler.ShadowResult{Latency: time.Since(start), Error: truncateErrorMessage(streamErr.Error())}
+		}
+	default:
+	}
+	return scheduler.ShadowResult{Success: true, Latency: time.Since(start), Usage: usage}
+}
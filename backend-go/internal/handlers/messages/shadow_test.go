@@ -0,0 +1,134 @@
+package messages
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// waitShadowReport 等待异步影子请求记录完成
+func waitShadowReport(t *testing.T, sch *scheduler.ChannelScheduler, requests int64) scheduler.ShadowReport {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		report := sch.GetShadowReport("messages")
+		if len(report.Channels) == 1 && report.Channels[0].Requests >= requests && report.InFlight == 0 {
+			return report
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("等待影子请求结果超时: %+v", report)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMessagesHandler_ShadowChannelMirrorsRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		stream      bool
+		shadowFails bool
+	}{
+		{name: "non-stream shadow success"},
+		{name: "stream shadow success", stream: true},
+		{name: "shadow failure does not affect client", shadowFails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var primaryHits, shadowHits atomic.Int32
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				primaryHits.Add(1)
+				if tt.stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+					_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"usage\":{\"input_tokens\":10,\"output_tokens\":1}}}\n\n" +
+						"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"m",
+  "content":[{"type":"text","text":"primary"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":2}}`))
+			}))
+			defer primary.Close()
+			shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				shadowHits.Add(1)
+				if tt.shadowFails {
+					w.WriteHeader(http.StatusInternalServerError)
+					_, _ = w.Write([]byte(`{"error":{"type":"api_error","message":"boom"}}`))
+					return
+				}
+				if tt.stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+					_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_2\",\"usage\":{\"input_tokens\":1000,\"output_tokens\":1}}}\n\n" +
+						"event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":100}}\n\n" +
+						"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id":"msg_2","type":"message","role":"assistant","model":"m",
+  "content":[{"type":"text","text":"shadow"}],"stop_reason":"end_turn","usage":{"input_tokens":1000,"output_tokens":100}}`))
+			}))
+			defer shadow.Close()
+
+			cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+				Upstream: []config.UpstreamConfig{
+					{Name: "primary", BaseURL: primary.URL, APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active"},
+					{Name: "shadow", BaseURL: shadow.URL, APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active", Shadow: true},
+				},
+				LoadBalance: "failover",
+			})
+			defer cleanupCfg()
+			sch, cleanupSch := createTestScheduler(t, cfgManager)
+			defer cleanupSch()
+
+			envCfg := &config.EnvConfig{ProxyAccessKey: "secret", MaxRequestBodySize: 1024 * 1024}
+			r := gin.New()
+			r.POST("/v1/messages", NewHandler(envCfg, cfgManager, sch, nil, nil, nil, nil))
+
+			body := `{"model":"claude-x","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+			if tt.stream {
+				body = `{"model":"claude-x","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(body))
+			req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if bytes.Contains(w.Body.Bytes(), []byte("shadow")) || bytes.Contains(w.Body.Bytes(), []byte("msg_2")) {
+				t.Fatalf("客户端不应收到影子渠道的响应: %s", w.Body.String())
+			}
+
+			report := waitShadowReport(t, sch, 1)
+			if primaryHits.Load() != 1 || shadowHits.Load() != 1 {
+				t.Fatalf("hits primary=%d shadow=%d, want 1/1", primaryHits.Load(), shadowHits.Load())
+			}
+			stats := report.Channels[0]
+			if stats.ChannelIndex != 1 || stats.ChannelName != "shadow" || stats.Requests != 1 {
+				t.Fatalf("stats = %+v", stats)
+			}
+			if tt.shadowFails {
+				if stats.Failures != 1 || stats.LastError == "" {
+					t.Fatalf("stats = %+v, want 1 failure", stats)
+				}
+			} else if stats.Successes != 1 || stats.InputTokens != 1000 || stats.OutputTokens != 100 {
+				t.Fatalf("stats = %+v, want usage 1000/100", stats)
+			}
+
+			// 影子渠道不写入生产指标
+			shadowMetrics := sch.GetMessagesMetricsManager().ToResponse(1, shadow.URL, []string{"k2"}, 0)
+			if shadowMetrics.RequestCount != 0 {
+				t.Fatalf("影子渠道生产指标 requestCount = %d, want 0", shadowMetrics.RequestCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package messages
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/billing"
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/gin-gonic/gin"
+)
+
+// spoolPassthroughUpstream 判断请求是否走落盘透传，满足条件时返回当前渠道：
+// 请求体超过 REQUEST_BODY_SPOOL_THRESHOLD_MB，单渠道模式且无影子渠道，渠道为 claude 类型且无需改写请求体（无模型映射、未启用 stripCacheControl）
+func spoolPassthroughUpstream(c *gin.Context, envCfg *config.EnvConfig, cfgManager *config.ConfigManager, channelScheduler *scheduler.ChannelScheduler) *config.UpstreamConfig {
+	if !common.ShouldSpoolRequestBody(c, envCfg.RequestBodySpoolThreshold) {
+		return nil
+	}
+	if channelScheduler.IsMultiChannelMode(false) || len(channelScheduler.GetShadowChannels()) > 0 {
+		return nil
+	}
+	upstream, err := cfgManager.GetCurrentUpstream()
+	if err != nil || upstream.ServiceType != "claude" || len(upstream.APIKeys) == 0 {
+		return nil
+	}
+	if len(upstream.ModelMapping) > 0 || upstream.StripCacheControl {
+		return nil
+	}
+	return upstream
+}
+
+// trySpooledRequest 大请求体落盘透传：请求体写入临时文件，每次尝试重新打开文件发送，内存中不保留完整请求体
+// 返回 handled=true 表示请求已处理完毕；需要改写请求体（max_tokens 上限）时读回内存返回 fallbackBody，由常规流程继续处理
+// 不满足落盘条件时返回 (nil, false)
+func trySpooledRequest(
+	c *gin.Context,
+	envCfg *config.EnvConfig,
+	cfgManager *config.ConfigManager,
+	channelScheduler *scheduler.ChannelScheduler,
+	startTime time.Time,
+	billingHandler *billing.Handler,
+	billingCtx *billing.RequestContext,
+	reqCtx *requestLogContext,
+) (fallbackBody []byte, handled bool) {
+	upstream := spoolPassthroughUpstream(c, envCfg, cfgManager, channelScheduler)
+	if upstream == nil {
+		return nil, false
+	}
+	// 渠道日志采样：未命中时本次请求在该渠道上不记录请求/响应体
+	envCfg = common.ChannelEnvConfig(c, envCfg, upstream)
+
+	spooled, err := common.SpoolRequestBody(c, upstream.EffectiveMaxRequestBodySize(envCfg.MaxRequestBodySize), channelScheduler.GetMessagesMetricsManager())
+	if err != nil {
+		reqCtx.success = false
+		reqCtx.errorMsg = truncateErrorMessage(err.Error())
+		return nil, true
+	}
+	defer spooled.Close()
+
+	reqCtx.model = spooled.Model
+	reqCtx.isStreaming = spooled.Stream
+	reqCtx.channelIndex = 0
+	reqCtx.channelName = upstream.Name
+	reqCtx.updateLive()
+
+	if cfgManager.GetMaxOutputTokensLimit(upstream, spooled.Model) > 0 {
+		bodyBytes, err := spooled.ReadAll()
+		if err != nil {
+			log.Printf("[Messages-Spool] 读取落盘请求体失败: %v", err)
+			reqCtx.success = false
+			reqCtx.errorMsg = truncateErrorMessage(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read request body"})
+			return nil, true
+		}
+		log.Printf("[Messages-Spool] 模型 %s 配置了输出 token 上限，需改写请求体，回退为内存缓冲 (%d 字节)", spooled.Model, spooled.Size)
+		return bodyBytes, false
+	}
+
+	if !common.CheckModelAllowed(c, cfgManager, "Messages", spooled.Model) {
+		reqCtx.success = false
+		reqCtx.errorMsg = "model not allowed"
+		return nil, true
+	}
+
+	if envCfg.EnableRequestLogs {
+		log.Printf("[Messages-Spool] 请求体 %d 字节已落盘，透传到渠道 %s (model=%s, stream=%v)", spooled.Size, upstream.Name, spooled.Model, spooled.Stream)
+	}
+	serveSingleChannel(c, envCfg, cfgManager, channelScheduler, upstream, newSpooledUpstreamBody(spooled), types.ClaudeRequest{Model: spooled.Model, Stream: spooled.Stream}, startTime, billingHandler, billingCtx, reqCtx)
+	return nil, true
+}
+
+// upstreamBody 渠道尝试发送的请求体：内存请求体，或落盘请求体（每次尝试重新打开临时文件，可在密钥/BaseURL 重试时重放）
+type upstreamBody struct {
+	original []byte              // 客户端原始请求体（用于抓包与 token 估算，落盘时为 nil）
+	data     []byte              // 实际发送的内存请求体（按渠道改写后）
+	spooled  *common.SpooledBody // 落盘请求体（非 nil 时原样发送，不做渠道改写）
+}
+
+// newUpstreamBody 内存请求体
+func newUpstreamBody(bodyBytes []byte) *upstreamBody {
+	return &upstreamBody{original: bodyBytes, data: bodyBytes}
+}
+
+// newSpooledUpstreamBody 落盘请求体（调用方负责 Close）
+func newSpooledUpstreamBody(spooled *common.SpooledBody) *upstreamBody {
+	return &upstreamBody{spooled: spooled}
+}
+
+// prepare 按渠道改写内存请求体：输出 token 上限（仅下调超限的字段）与移除 cache_control（不支持 prompt caching 的渠道）
+// 落盘请求体仅在无需改写时使用（见 spoolPassthroughUpstream），原样发送
+func (b *upstreamBody) prepare(c *gin.Context, cfgManager *config.ConfigManager, upstream *config.UpstreamConfig, model string) {
+	if b.spooled != nil {
+		return
+	}
+	b.data = common.ClampMaxOutputTokens(c, cfgManager, upstream, model, b.original, "max_tokens")
+	b.data = common.StripCacheControl(upstream, model, b.data)
+}
+
+// restore 为下一次尝试重置 c.Request.Body；落盘请求体以空请求体构建上游请求（URL 与请求头），再由 attach 挂载临时文件
+func (b *upstreamBody) restore(c *gin.Context) {
+	if b.spooled != nil {
+		c.Request.Body = http.NoBody
+		return
+	}
+	common.RestoreRequestBody(c, b.data)
+}
+
+// attach 将落盘请求体挂载到上游请求（内存请求体已由 provider 写入）
+func (b *upstreamBody) attach(req *http.Request) error {
+	if b.spooled == nil {
+		return nil
+	}
+	return b.spooled.AttachTo(req)
+}
+
+// stripRejectedParameters 删除上游以 400 拒绝的参数，返回被删除的参数路径
+// 落盘请求体仅在错误响应匹配剥离规则时读回内存改写，改写后按内存请求体发送
+func (b *upstreamBody) stripRejectedParameters(cfgManager *config.ConfigManager, statusCode int, respBody []byte) []string {
+	data := b.data
+	if b.spooled != nil {
+		if statusCode != http.StatusBadRequest || cfgManager == nil || len(cfgManager.MatchParameterStripRules(respBody)) == 0 {
+			return nil
+		}
+		var err error
+		if data, err = b.spooled.ReadAll(); err != nil {
+			log.Printf("[Messages-Spool] 读取落盘请求体失败，跳过参数剥离: %v", err)
+			return nil
+		}
+	}
+	stripped, params := common.StripRejectedParameters(cfgManager, statusCode, respBody, data)
+	if len(params) > 0 {
+		b.data, b.spooled = stripped, nil
+	}
+	return params
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// GetMetricsStorage 获取指标数据库的存储占用（文件大小、各表行数、保留与回收设置）
+// GET /api/metrics/storage
+func GetMetricsStorage(store *metrics.SQLiteStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if store == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "指标持久化未启用"})
+			return
+		}
+		stats, err := store.GetStorageStats()
+		if err != nil {
+			log.Printf("[Metrics-Storage] 获取存储统计失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取存储统计失败"})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetMetricsStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store, err := metrics.NewSQLiteStore(&metrics.SQLiteStoreConfig{
+		DBPath:        t.TempDir() + "/metrics.db",
+		RetentionDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() err = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	if err := store.AddRequestLog(metrics.RequestLogRecord{RequestID: "req-1", APIType: "messages"}); err != nil {
+		t.Fatalf("AddRequestLog() err = %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/metrics/storage", GetMetricsStorage(store))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/metrics/storage", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp metrics.StorageStats
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.RowCounts["request_logs"] != 1 || resp.FileSizeBytes <= 0 || resp.RequestLogRetentionHours != 24 {
+		t.Fatalf("unexpected stats: %+v", resp)
+	}
+
+	// 未启用持久化
+	r = gin.New()
+	r.GET("/api/metrics/storage", GetMetricsStorage(nil))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/metrics/storage", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMetricsStreamInterval = 3 * time.Second
+	maxMetricsStreamInterval     = 60 * time.Second
+)
+
+// metricsStreamSource 一个接口类型的指标来源
+type metricsStreamSource struct {
+	apiType string
+	manager *metrics.MetricsManager
+	events  <-chan metrics.MetricsEvent
+}
+
+// metricsStreamChannel 渠道在推送周期内的请求增量
+type metricsStreamChannel struct {
+	apiType      string
+	channelIndex int
+	requests     int64
+	successes    int64
+	failures     int64
+}
+
+// GetMetricsStream 以 SSE 推送渠道实时指标，替代前端高频轮询 /channels/metrics
+// GET /api/metrics/stream?interval=3（推送周期秒数，1-60）
+//
+// 事件：
+//   - snapshot：连接建立时各渠道的当前指标
+//   - metrics：推送周期内有请求的渠道的增量（requests/successes/failures）与当前成功率、熔断状态
+//   - circuit：Key 熔断状态变化（立即推送）
+//
+// 连接消费过慢时订阅会被指标管理器移除，服务端随即结束响应，客户端（EventSource）会自动重连
+func GetMetricsStream(cfgManager *config.ConfigManager, messagesMetrics, responsesMetrics, geminiMetrics *metrics.MetricsManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		interval := defaultMetricsStreamInterval
+		if raw := c.Query("interval"); raw != "" {
+			seconds, err := strconv.Atoi(raw)
+			if err != nil || seconds < 1 || time.Duration(seconds)*time.Second > maxMetricsStreamInterval {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be an integer between 1 and 60 (seconds)"})
+				return
+			}
+			interval = time.Duration(seconds) * time.Second
+		}
+
+		sources := make([]*metricsStreamSource, 0, 3)
+		for _, src := range []struct {
+			apiType string
+			manager *metrics.MetricsManager
+		}{{"messages", messagesMetrics}, {"responses", responsesMetrics}, {"gemini", geminiMetrics}} {
+			if src.manager == nil {
+				continue
+			}
+			events, unsubscribe := src.manager.Subscribe(metrics.DefaultSubscriberBuffer)
+			defer unsubscribe()
+			sources = append(sources, &metricsStreamSource{apiType: src.apiType, manager: src.manager, events: events})
+		}
+		// 固定三路 select，缺失的来源使用 nil 通道（永不就绪）
+		var events [3]<-chan metrics.MetricsEvent
+		for i, src := range sources {
+			events[i] = src.events
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		cfg := cfgManager.GetConfig()
+		keyIndex := buildMetricsStreamKeyIndex(cfg)
+		snapshot := make([]gin.H, 0)
+		for _, src := range sources {
+			for i, upstream := range metricsStreamUpstreams(cfg, src.apiType) {
+				snapshot = append(snapshot, metricsStreamChannelState(src, i, &upstream))
+			}
+		}
+		if err := writeMetricsStreamEvent(c, "snapshot", gin.H{"time": time.Now(), "channels": snapshot}); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		deltas := make(map[string]*metricsStreamChannel)
+
+		handle := func(src *metricsStreamSource, ev metrics.MetricsEvent) error {
+			channelIndex, ok := keyIndex[src.apiType][ev.MetricsKey]
+			if !ok {
+				return nil // 配置中已不存在的 Key/BaseURL
+			}
+			id := src.apiType + ":" + strconv.Itoa(channelIndex)
+			delta := deltas[id]
+			if delta == nil {
+				delta = &metricsStreamChannel{apiType: src.apiType, channelIndex: channelIndex}
+				deltas[id] = delta
+			}
+			delta.requests++
+			if ev.Success {
+				delta.successes++
+			} else {
+				delta.failures++
+			}
+
+			if !ev.CircuitChanged {
+				return nil
+			}
+			channelName := ""
+			if upstreams := metricsStreamUpstreams(cfg, src.apiType); channelIndex < len(upstreams) {
+				channelName = upstreams[channelIndex].Name
+			}
+			return writeMetricsStreamEvent(c, "circuit", gin.H{
+				"time":         ev.Time,
+				"api":          src.apiType,
+				"channelIndex": channelIndex,
+				"channelName":  channelName,
+				"baseUrl":      ev.BaseURL,
+				"keyMask":      ev.KeyMask,
+				"state":        ev.CircuitState.String(),
+			})
+		}
+
+		for {
+			var (
+				src *metricsStreamSource
+				ev  metrics.MetricsEvent
+				ok  bool
+			)
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case ev, ok = <-events[0]:
+				src = sources[0]
+			case ev, ok = <-events[1]:
+				src = sources[1]
+			case ev, ok = <-events[2]:
+				src = sources[2]
+			case <-ticker.C:
+				if len(deltas) == 0 {
+					if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+						return
+					}
+					c.Writer.Flush()
+				} else {
+					if err := writeMetricsStreamEvent(c, "metrics", gin.H{"time": time.Now(), "channels": metricsStreamDeltas(cfg, sources, deltas)}); err != nil {
+						return
+					}
+					deltas = make(map[string]*metricsStreamChannel)
+				}
+				// 配置可能已变更，刷新 Key → 渠道映射
+				cfg = cfgManager.GetConfig()
+				keyIndex = buildMetricsStreamKeyIndex(cfg)
+				continue
+			}
+
+			if !ok {
+				log.Printf("[Metrics-Stream] 订阅者消费过慢已被移除，结束推送: api=%s", src.apiType)
+				return
+			}
+			if err := handle(src, ev); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// metricsStreamUpstreams 返回接口类型对应的渠道列表
+func metricsStreamUpstreams(cfg config.Config, apiType string) []config.UpstreamConfig {
+	switch apiType {
+	case "responses":
+		return cfg.ResponsesUpstream
+	case "gemini":
+		return cfg.GeminiUpstream
+	default:
+		return cfg.Upstream
+	}
+}
+
+// buildMetricsStreamKeyIndex 构建 接口类型 → 指标键 → 渠道索引 的映射
+func buildMetricsStreamKeyIndex(cfg config.Config) map[string]map[string]int {
+	index := make(map[string]map[string]int, 3)
+	for _, apiType := range []string{"messages", "responses", "gemini"} {
+		keys := make(map[string]int)
+		for i, upstream := range metricsStreamUpstreams(cfg, apiType) {
+			for _, baseURL := range upstream.GetAllBaseURLs() {
+				for _, apiKey := range upstream.APIKeys {
+					keys[metrics.KeyID(baseURL, apiKey)] = i
+				}
+			}
+		}
+		index[apiType] = keys
+	}
+	return index
+}
+
+// metricsStreamChannelState 渠道当前的累计指标、成功率与聚合熔断状态
+func metricsStreamChannelState(src *metricsStreamSource, channelIndex int, upstream *config.UpstreamConfig) gin.H {
+	baseURLs := upstream.GetAllBaseURLs()
+	resp := src.manager.ToResponseMultiURL(channelIndex, baseURLs, upstream.APIKeys, 0)
+
+	// 多 BaseURL 取最严重的状态：open > half_open > closed
+	state := metrics.CircuitClosed
+	for _, baseURL := range baseURLs {
+		switch s := src.manager.GetChannelCircuitState(baseURL, upstream.APIKeys); {
+		case s == metrics.CircuitOpen:
+			state = s
+		case s == metrics.CircuitHalfOpen && state == metrics.CircuitClosed:
+			state = s
+		}
+	}
+
+	return gin.H{
+		"api":          src.apiType,
+		"channelIndex": channelIndex,
+		"channelName":  upstream.Name,
+		"requestCount": resp.RequestCount,
+		"successCount": resp.SuccessCount,
+		"failureCount": resp.FailureCount,
+		"successRate":  resp.SuccessRate,
+		"circuitState": state.String(),
+	}
+}
+
+// metricsStreamDeltas 汇总推送周期内的渠道增量（按接口类型、渠道索引排序）
+func metricsStreamDeltas(cfg config.Config, sources []*metricsStreamSource, deltas map[string]*metricsStreamChannel) []gin.H {
+	ordered := make([]*metricsStreamChannel, 0, len(deltas))
+	for _, delta := range deltas {
+		ordered = append(ordered, delta)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].apiType != ordered[j].apiType {
+			return ordered[i].apiType < ordered[j].apiType
+		}
+		return ordered[i].channelIndex < ordered[j].channelIndex
+	})
+
+	result := make([]gin.H, 0, len(ordered))
+	for _, delta := range ordered {
+		upstreams := metricsStreamUpstreams(cfg, delta.apiType)
+		if delta.channelIndex >= len(upstreams) {
+			continue
+		}
+		var src *metricsStreamSource
+		for _, s := range sources {
+			if s.apiType == delta.apiType {
+				src = s
+			}
+		}
+		item := metricsStreamChannelState(src, delta.channelIndex, &upstreams[delta.channelIndex])
+		item["requests"] = delta.requests
+		item["successes"] = delta.successes
+		item["failures"] = delta.failures
+		result = append(result, item)
+	}
+	return result
+}
+
+// writeMetricsStreamEvent 写出一个 SSE 事件并立即刷新
+func writeMetricsStreamEvent(c *gin.Context, event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
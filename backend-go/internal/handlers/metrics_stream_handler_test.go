@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+func readSSEEvent(t *testing.T, scanner *bufio.Scanner) sseEvent {
+	t.Helper()
+
+	var ev sseEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if ev.name != "" {
+				return ev
+			}
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("stream ended before event: %v", scanner.Err())
+	return ev
+}
+
+func TestGetMetricsStream_PushesDeltasAndCircuitChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfgManager, _ := newTestConfigManager(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "a", BaseURL: "https://a.example", APIKeys: []string{"k1"}, ServiceType: "claude", Status: "active"},
+			{Name: "b", BaseURL: "https://b.example", APIKeys: []string{"k2"}, ServiceType: "claude", Status: "active"},
+		},
+	})
+	messagesMetrics := metrics.NewMetricsManagerWithConfig(3, 0.5)
+	defer messagesMetrics.Stop()
+	responsesMetrics := metrics.NewMetricsManager()
+	defer responsesMetrics.Stop()
+
+	r := gin.New()
+	r.GET("/api/metrics/stream", GetMetricsStream(cfgManager, messagesMetrics, responsesMetrics, nil))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/metrics/stream?interval=1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type = %q", ct)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+
+	snapshot := readSSEEvent(t, scanner)
+	if snapshot.name != "snapshot" || gjson.Get(snapshot.data, "channels.#").Int() != 2 {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+	if messagesMetrics.SubscriberCount() != 1 || responsesMetrics.SubscriberCount() != 1 {
+		t.Fatalf("stream should subscribe to every metrics manager")
+	}
+
+	messagesMetrics.RecordSuccess("https://a.example", "k1")
+	for i := 0; i < 3; i++ {
+		messagesMetrics.RecordFailure("https://b.example", "k2")
+	}
+	messagesMetrics.RecordSuccess("https://unknown.example", "k9") // 不属于任何渠道，忽略
+
+	circuit := readSSEEvent(t, scanner)
+	if circuit.name != "circuit" || gjson.Get(circuit.data, "channelName").String() != "b" || gjson.Get(circuit.data, "state").String() != "open" {
+		t.Fatalf("unexpected circuit event: %+v", circuit)
+	}
+
+	delta := readSSEEvent(t, scanner)
+	if delta.name != "metrics" {
+		t.Fatalf("unexpected event: %+v", delta)
+	}
+	channels := gjson.Get(delta.data, "channels").Array()
+	if len(channels) != 2 {
+		t.Fatalf("delta channels = %s", delta.data)
+	}
+	if channels[0].Get("channelName").String() != "a" || channels[0].Get("requests").Int() != 1 || channels[0].Get("successes").Int() != 1 {
+		t.Fatalf("channel a delta = %s", channels[0].Raw)
+	}
+	if channels[1].Get("failures").Int() != 3 || channels[1].Get("circuitState").String() != "open" {
+		t.Fatalf("channel b delta = %s", channels[1].Raw)
+	}
+
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for messagesMetrics.SubscriberCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if messagesMetrics.SubscriberCount() != 0 {
+		t.Fatalf("subscription should be released after client disconnects")
+	}
+}
+
+func TestGetMetricsStream_InvalidInterval(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfgManager, _ := newTestConfigManager(t, config.Config{})
+	r := gin.New()
+	r.GET("/api/metrics/stream", GetMetricsStream(cfgManager, nil, nil, nil))
+
+	for _, interval := range []string{"0", "61", "abc"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/metrics/stream?interval="+interval, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("interval=%s: status = %d", interval, w.Code)
+		}
+	}
+}
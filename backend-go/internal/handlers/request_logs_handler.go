@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -21,6 +22,7 @@ func NewRequestLogsHandler(store *metrics.SQLiteStore) *RequestLogsHandler {
 
 // GetLogs 获取请求日志
 // GET /api/{messages|responses|gemini}/logs?limit=50&offset=0
+// GET /api/logs?api=messages&channel=2&success=false&statusMin=400&statusMax=599&keyMask=sk-***&limit=50&offset=0
 func (h *RequestLogsHandler) GetLogs(c *gin.Context) {
 	if h == nil || h.store == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "请求日志未启用"})
@@ -31,15 +33,24 @@ func (h *RequestLogsHandler) GetLogs(c *gin.Context) {
 	if apiType == "" {
 		apiType = apiTypeFromAdminLogsPath(c.Request.URL.Path)
 	}
+	if apiType == "" {
+		apiType = normalizeLogsAPIType(c.Query("api"))
+	}
 	if apiType == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 apiType"})
 		return
 	}
 
+	filter, err := parseRequestLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	limit := parseLimit(c.Query("limit"))
 	offset := parseOffset(c.Query("offset"))
 
-	logs, total, err := h.store.QueryRequestLogs(apiType, limit, offset)
+	logs, total, err := h.store.QueryRequestLogsFiltered(apiType, filter, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询请求日志失败"})
 		return
@@ -89,7 +100,11 @@ func apiTypeFromAdminLogsPath(path string) string {
 		return ""
 	}
 
-	apiType := parts[1]
+	return normalizeLogsAPIType(parts[1])
+}
+
+// normalizeLogsAPIType 校验接口类型（messages | responses | gemini），无效时返回空字符串
+func normalizeLogsAPIType(apiType string) string {
 	switch apiType {
 	case "messages", "responses", "gemini":
 		return apiType
@@ -97,3 +112,44 @@ func apiTypeFromAdminLogsPath(path string) string {
 		return ""
 	}
 }
+
+// parseRequestLogFilter 解析请求日志过滤参数（channel、success、statusMin、statusMax、keyMask）
+func parseRequestLogFilter(c *gin.Context) (metrics.RequestLogFilter, error) {
+	var filter metrics.RequestLogFilter
+	if raw := c.Query("channel"); raw != "" {
+		channel, err := strconv.Atoi(raw)
+		if err != nil || channel < 0 {
+			return filter, fmt.Errorf("无效的 channel: %s", raw)
+		}
+		filter.ChannelIndex = &channel
+	}
+	if raw := c.Query("success"); raw != "" {
+		success, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, fmt.Errorf("无效的 success: %s", raw)
+		}
+		filter.Success = &success
+	}
+	for _, p := range []struct {
+		name   string
+		target *int
+	}{
+		{"statusMin", &filter.StatusMin},
+		{"statusMax", &filter.StatusMax},
+	} {
+		raw := c.Query(p.name)
+		if raw == "" {
+			continue
+		}
+		status, err := strconv.Atoi(raw)
+		if err != nil || status < 100 || status > 599 {
+			return filter, fmt.Errorf("无效的 %s: %s（范围 100-599）", p.name, raw)
+		}
+		*p.target = status
+	}
+	if filter.StatusMin > 0 && filter.StatusMax > 0 && filter.StatusMin > filter.StatusMax {
+		return filter, fmt.Errorf("statusMin 不能大于 statusMax")
+	}
+	filter.KeyMask = strings.TrimSpace(c.Query("keyMask"))
+	return filter, nil
+}
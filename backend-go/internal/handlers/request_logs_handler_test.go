@@ -159,3 +159,78 @@ func TestRequestLogsHandler_ParseHelpers(t *testing.T) {
 		t.Fatalf("apiTypeFromAdminLogsPath invalid suffix")
 	}
 }
+
+func TestRequestLogsHandler_UnifiedEndpointWithFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store, err := metrics.NewSQLiteStore(&metrics.SQLiteStoreConfig{DBPath: filepath.Join(t.TempDir(), "metrics.db"), RetentionDays: 3})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	now := time.Now()
+	for i, rec := range []metrics.RequestLogRecord{
+		{RequestID: "ok", ChannelIndex: 2, KeyMask: "sk-a", StatusCode: 200, Success: true, APIType: "messages"},
+		{RequestID: "fail-429", ChannelIndex: 2, KeyMask: "sk-a", StatusCode: 429, APIType: "messages"},
+		{RequestID: "fail-502", ChannelIndex: 2, KeyMask: "sk-b", StatusCode: 502, APIType: "messages"},
+		{RequestID: "fail-other-channel", ChannelIndex: 1, KeyMask: "sk-a", StatusCode: 502, APIType: "messages"},
+		{RequestID: "fail-responses", ChannelIndex: 2, KeyMask: "sk-a", StatusCode: 502, APIType: "responses"},
+	} {
+		rec.ChannelName = "c"
+		rec.Timestamp = now.Add(time.Duration(i) * time.Second)
+		if err := store.AddRequestLog(rec); err != nil {
+			t.Fatalf("AddRequestLog: %v", err)
+		}
+	}
+
+	h := NewRequestLogsHandler(store)
+	r := gin.New()
+	r.GET("/api/logs", h.GetLogs)
+	r.GET("/api/messages/logs", h.GetLogs)
+
+	query := func(url string) (int, metrics.RequestLogsResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		var resp metrics.RequestLogsResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	code, resp := query("/api/logs?api=messages&channel=2&success=false&limit=50&offset=0")
+	if code != http.StatusOK || resp.Total != 2 || len(resp.Logs) != 2 || resp.Logs[0].RequestID != "fail-502" || resp.Logs[1].RequestID != "fail-429" {
+		t.Fatalf("code=%d resp=%+v", code, resp)
+	}
+
+	code, resp = query("/api/logs?api=messages&statusMin=500&statusMax=599&keyMask=sk-a")
+	if code != http.StatusOK || resp.Total != 1 || resp.Logs[0].RequestID != "fail-other-channel" {
+		t.Fatalf("code=%d resp=%+v", code, resp)
+	}
+
+	// 原有按接口路径的端点同样支持过滤
+	code, resp = query("/api/messages/logs?success=true")
+	if code != http.StatusOK || resp.Total != 1 || resp.Logs[0].RequestID != "ok" {
+		t.Fatalf("code=%d resp=%+v", code, resp)
+	}
+
+	if code, resp = query("/api/logs?api=messages&limit=1000"); code != http.StatusOK || resp.Limit != 200 {
+		t.Fatalf("limit not clamped: code=%d limit=%d", code, resp.Limit)
+	}
+
+	for _, url := range []string{
+		"/api/logs",
+		"/api/logs?api=chat",
+		"/api/logs?api=messages&channel=x",
+		"/api/logs?api=messages&success=maybe",
+		"/api/logs?api=messages&statusMin=99",
+		"/api/logs?api=messages&statusMin=500&statusMax=400",
+	} {
+		if code, _ := query(url); code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d, want 400", url, code)
+		}
+	}
+}
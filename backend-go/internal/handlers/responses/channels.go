@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
 	"github.com/BenedictKing/claude-proxy/internal/scheduler"
 	"github.com/gin-gonic/gin"
 )
@@ -26,11 +27,11 @@ func GetUpstreams(cfgManager *config.ConfigManager) gin.HandlerFunc {
 				"serviceType":        up.ServiceType,
 				"baseUrl":            up.BaseURL,
 				"baseUrls":           up.BaseURLs,
-				"apiKeys":            up.APIKeys,
+				"apiKeys":            cfgManager.APIKeyRefs(up.APIKeys),
 				"description":        up.Description,
 				"website":            up.Website,
 				"insecureSkipVerify": up.InsecureSkipVerify,
-				"modelMapping":       up.ModelMapping,
+				"modelMapping":       up.ModelMappingJSON(),
 				"latency":            nil,
 				"status":             status,
 				"priority":           priority,
@@ -150,9 +151,22 @@ func AddApiKey(cfgManager *config.ConfigManager) gin.HandlerFunc {
 	}
 }
 
-// DeleteApiKey 删除 Responses 渠道 API 密钥
+// DrainApiKey 排空 Responses 渠道 API 密钥：新请求不再使用该密钥，宽限期结束后自动删除
+func DrainApiKey(cfgManager *config.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		common.HandleDrainAPIKey(c, cfgManager.DrainResponsesAPIKey)
+	}
+}
+
+// DeleteApiKey 删除 Responses 渠道 API 密钥（?drain=true 时改为排空，可选 grace 指定宽限期秒数）
 func DeleteApiKey(cfgManager *config.ConfigManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// drain=true 时改为排空密钥：进行中的请求正常完成，宽限期结束后自动删除
+		if c.Query("drain") == "true" {
+			common.HandleDrainAPIKey(c, cfgManager.DrainResponsesAPIKey)
+			return
+		}
+
 		idStr := c.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
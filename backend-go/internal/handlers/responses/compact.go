@@ -16,6 +16,7 @@ import (
 	"github.com/BenedictKing/claude-proxy/internal/session"
 	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
 )
 
 // compactError 封装 compact 请求错误
@@ -23,6 +24,7 @@ type compactError struct {
 	status         int
 	body           []byte
 	shouldFailover bool
+	requestID      string // 上游请求 ID（透传给客户端）
 }
 
 // CompactHandler Responses API compact 端点处理器
@@ -39,14 +41,20 @@ func CompactHandler(
 		if c.IsAborted() {
 			return
 		}
+		envCfg := common.RequestEnvConfig(c, envCfg)
 
 		// 读取请求体
 		maxBodySize := envCfg.MaxRequestBodySize
-		bodyBytes, err := common.ReadRequestBody(c, maxBodySize)
+		bodyBytes, err := common.ReadRequestBody(c, maxBodySize, channelScheduler.GetResponsesMetricsManager())
 		if err != nil {
 			return
 		}
 
+		// 全局模型准入
+		if !common.CheckModelAllowed(c, cfgManager, "Responses-Compact", gjson.GetBytes(bodyBytes, "model").String()) {
+			return
+		}
+
 		// 提取对话标识用于 Trace 亲和性
 		userID := common.ExtractConversationID(c, bodyBytes)
 
@@ -102,6 +110,7 @@ func handleSingleChannelCompact(
 				continue
 			}
 			// 非故障转移错误，直接返回
+			common.SetUpstreamRequestIDHeader(c, compactErr.requestID)
 			c.Data(compactErr.status, "application/json", compactErr.body)
 			return
 		}
@@ -120,6 +129,7 @@ func handleSingleChannelCompact(
 	}
 
 	if lastErr != nil {
+		common.SetUpstreamRequestIDHeader(c, lastErr.requestID)
 		c.Data(lastErr.status, "application/json", lastErr.body)
 	} else {
 		c.JSON(503, gin.H{"error": "所有 API 密钥都不可用"})
@@ -139,9 +149,14 @@ func handleMultiChannelCompact(
 	maxAttempts := channelScheduler.GetActiveChannelCount(true)
 	var lastErr *compactError
 
+	selectionCtx := common.BuildSelectionContext(c, cfgManager, gjson.GetBytes(bodyBytes, "model").String())
 	for attempt := 0; attempt < maxAttempts; attempt++ {
-		selection, err := channelScheduler.SelectChannel(c.Request.Context(), userID, failedChannels, true)
+		selection, err := channelScheduler.SelectChannel(selectionCtx, userID, failedChannels, true)
 		if err != nil {
+			if noModelErr, ok := scheduler.AsNoChannelForModelError(err); ok {
+				common.RespondNoChannelForModel(c, noModelErr)
+				return
+			}
 			break
 		}
 
@@ -157,6 +172,7 @@ func handleMultiChannelCompact(
 				channelScheduler.RecordSuccessWithUsage(upstream.BaseURL, successKey, nil, false, "", 0)
 			}
 			channelScheduler.SetTraceAffinity(userID, channelIndex)
+			channelScheduler.RecordIPAffinity(selectionCtx, userID, channelIndex)
 			return
 		}
 
@@ -179,6 +195,7 @@ func handleMultiChannelCompact(
 	}
 
 	if lastErr != nil {
+		common.SetUpstreamRequestIDHeader(c, lastErr.requestID)
 		c.Data(lastErr.status, "application/json", lastErr.body)
 	} else {
 		c.JSON(503, gin.H{"error": "所有 Responses 渠道都不可用"})
@@ -236,6 +253,7 @@ func tryCompactChannelWithAllKeys(
 				continue
 			}
 			// 非故障转移错误，返回但标记渠道成功（请求已处理）
+			common.SetUpstreamRequestIDHeader(c, compactErr.requestID)
 			c.Data(compactErr.status, "application/json", compactErr.body)
 			return true, "", nil
 		}
@@ -253,6 +271,8 @@ func tryCompactWithKey(
 	envCfg *config.EnvConfig,
 	cfgManager *config.ConfigManager,
 ) (bool, *compactError) {
+	// 渠道日志采样：未命中时本次请求在该渠道上不记录请求/响应体
+	envCfg = common.ChannelEnvConfig(c, envCfg, upstream)
 	targetURL := buildCompactURL(upstream)
 	req, err := http.NewRequestWithContext(c.Request.Context(), "POST", targetURL, bytes.NewReader(bodyBytes))
 	if err != nil {
@@ -264,8 +284,9 @@ func tryCompactWithKey(
 	req.Header.Del("x-api-key")
 	utils.SetAuthenticationHeader(req.Header, apiKey)
 	req.Header.Set("Content-Type", "application/json")
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
 
-	resp, err := common.SendRequest(req, upstream, envCfg, false)
+	resp, err := common.SendRequestForModel(req, upstream, envCfg, false, gjson.GetBytes(bodyBytes, "model").String())
 	if err != nil {
 		return false, &compactError{status: 502, body: []byte(`{"error":"上游请求失败"}`), shouldFailover: true}
 	}
@@ -276,13 +297,18 @@ func tryCompactWithKey(
 
 	// 判断是否需要故障转移
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		shouldFailover, _ := common.ShouldRetryWithNextKey(resp.StatusCode, respBody, cfgManager.GetFuzzyModeEnabled())
-		return false, &compactError{status: resp.StatusCode, body: respBody, shouldFailover: shouldFailover}
+		shouldFailover, _ := common.ShouldRetryWithNextKeyForChannel(upstream, resp.StatusCode, respBody, common.EffectiveFuzzyMode(c, cfgManager))
+		return false, &compactError{
+			status:         resp.StatusCode,
+			body:           respBody,
+			shouldFailover: shouldFailover,
+			requestID:      common.ExtractUpstreamRequestID(resp.Header, respBody),
+		}
 	}
 
 	// 成功
 	utils.ForwardResponseHeaders(resp.Header, c.Writer)
-	c.Data(resp.StatusCode, "application/json", respBody)
+	common.WriteResponseBody(c, envCfg, resp.StatusCode, "application/json", respBody)
 	return true, nil
 }
 
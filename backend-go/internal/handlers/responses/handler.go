@@ -17,6 +17,7 @@ import (
 	"github.com/BenedictKing/claude-proxy/internal/config"
 	"github.com/BenedictKing/claude-proxy/internal/converters"
 	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/BenedictKing/claude-proxy/internal/logger"
 	"github.com/BenedictKing/claude-proxy/internal/metrics"
 	"github.com/BenedictKing/claude-proxy/internal/middleware"
 	"github.com/BenedictKing/claude-proxy/internal/monitor"
@@ -26,7 +27,6 @@ import (
 	"github.com/BenedictKing/claude-proxy/internal/types"
 	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type requestLogContext struct {
@@ -66,6 +66,14 @@ func (r *requestLogContext) updateLive() {
 	})
 }
 
+// logRequestID 返回结构化日志使用的请求 ID（reqCtx 可能为 nil）
+func (r *requestLogContext) logRequestID() string {
+	if r == nil {
+		return ""
+	}
+	return r.requestID
+}
+
 func truncateErrorMessage(msg string) string {
 	const maxLen = 1024
 	if len(msg) <= maxLen {
@@ -173,8 +181,26 @@ func (h *Handler) Handle(c *gin.Context) {
 		return
 	}
 
+	// 请求级日志级别（X-Proxy-Log-Level），仅影响本次请求
+	envCfg = common.RequestEnvConfig(c, envCfg)
+
+	// 维护模式：直接返回 503，不进入渠道故障转移
+	if !common.CheckMaintenance(c) {
+		return
+	}
+
+	// 成本预算：超过硬上限直接拒绝，超过软上限仅告警
+	if !common.CheckCostBudget(c, "responses") {
+		return
+	}
+
 	startTime := time.Now()
-	requestID := uuid.New().String()
+	requestID := middleware.GetRequestID(c)
+
+	// 请求诊断（X-Proxy-Debug），通过 Trailer 返回
+	if common.StartDiagnostics(c) != nil {
+		defer common.WriteDiagnosticsTrailer(c)
+	}
 
 	reqCtx := &requestLogContext{
 		requestID:          requestID,
@@ -188,6 +214,9 @@ func (h *Handler) Handle(c *gin.Context) {
 		defer h.liveRequestManager.EndRequest(requestID)
 	}
 
+	// 请求结束后上报 usage，供限流中间件计入 token 预算
+	defer func() { middleware.ReportUsage(c, reqCtx.usage) }()
+
 	defer func() {
 		if h.sqliteStore == nil {
 			return
@@ -256,8 +285,8 @@ func (h *Handler) Handle(c *gin.Context) {
 	}()
 
 	// 读取原始请求体
-	maxBodySize := envCfg.MaxRequestBodySize
-	bodyBytes, err := common.ReadRequestBody(c, maxBodySize)
+	maxBodySize := cfgManager.GetRequestBodyReadLimit(envCfg.MaxRequestBodySize)
+	bodyBytes, err := common.ReadRequestBody(c, maxBodySize, channelScheduler.GetResponsesMetricsManager())
 	if err != nil {
 		reqCtx.success = false
 		reqCtx.errorMsg = truncateErrorMessage(err.Error())
@@ -273,6 +302,13 @@ func (h *Handler) Handle(c *gin.Context) {
 	reqCtx.isStreaming = responsesReq.Stream
 	reqCtx.updateLive()
 
+	// 全局模型准入：被拒绝的模型直接返回 403，不联系上游
+	if !common.CheckModelAllowed(c, cfgManager, "Responses", responsesReq.Model) {
+		reqCtx.success = false
+		reqCtx.errorMsg = "model not allowed"
+		return
+	}
+
 	// 提取对话标识用于 Trace 亲和性
 	userID := common.ExtractConversationID(c, bodyBytes)
 
@@ -305,13 +341,38 @@ func handleMultiChannel(
 	reqCtx *requestLogContext,
 ) {
 	failedChannels := make(map[int]bool)
+	// 主渠道：本次请求首个选中的渠道，故障转移后成功时与其比较成本
+	primaryIndex := -1
+	var primaryUpstream *config.UpstreamConfig
 	var lastError error
 	var lastFailoverError *common.FailoverError
+	failoverDelay := common.NewChannelFailoverDelay(c, envCfg, "Responses")
 
 	maxChannelAttempts := channelScheduler.GetActiveChannelCount(true) // true = isResponses
 
+	selectionCtx := common.BuildSelectionContext(c, cfgManager, responsesReq.Model)
+	selectionCtx = scheduler.WithRequestBodySize(selectionCtx, int64(len(bodyBytes)), envCfg.MaxRequestBodySize)
+	selectionCtx = scheduler.WithTokenEstimator(selectionCtx, func() (int, int) {
+		return utils.EstimateResponsesRequestTokens(bodyBytes), responsesReq.MaxTokens
+	})
 	for channelAttempt := 0; channelAttempt < maxChannelAttempts; channelAttempt++ {
-		selection, err := channelScheduler.SelectChannel(c.Request.Context(), userID, failedChannels, true)
+		// 渠道级故障转移同样消耗全局重试预算，预算耗尽时直接返回最后一次失败
+		if channelAttempt > 0 && !channelScheduler.AllowRetry() {
+			log.Printf("[Responses-RetryBudget] 警告: 全局重试预算已耗尽，停止渠道故障转移 (已尝试 %d 个渠道)", channelAttempt)
+			if lastError == nil {
+				lastError = fmt.Errorf("retry budget exhausted")
+			}
+			break
+		}
+		if common.FailoverSlotDenied(c) {
+			log.Printf("[Responses-FailoverLimit] 警告: 全局故障转移并发已满，停止渠道故障转移 (已尝试 %d 个渠道)", channelAttempt)
+			break
+		}
+		if !failoverDelay.BeginChannel() {
+			lastError = fmt.Errorf("client disconnected during failover delay")
+			break
+		}
+		selection, err := channelScheduler.SelectChannel(selectionCtx, userID, failedChannels, true)
 		if err != nil {
 			lastError = err
 			break
@@ -319,6 +380,9 @@ func handleMultiChannel(
 
 		upstream := selection.Upstream
 		channelIndex := selection.ChannelIndex
+		if primaryUpstream == nil {
+			primaryIndex, primaryUpstream = channelIndex, upstream
+		}
 		if reqCtx != nil {
 			reqCtx.channelIndex = channelIndex
 			reqCtx.channelName = upstream.Name
@@ -347,6 +411,7 @@ func handleMultiChannel(
 					reqCtx.updateLive()
 				}
 				channelScheduler.RecordSuccessWithUsage(upstream.GetAllBaseURLs()[successBaseURLIdx], successKey, usage, true, responsesReq.Model, costCents)
+				common.RecordStreamTiming(c, channelScheduler, upstream.GetAllBaseURLs()[successBaseURLIdx], successKey, usage, true)
 			}
 			if reqCtx != nil && successKey == "" {
 				reqCtx.success = true
@@ -355,10 +420,14 @@ func handleMultiChannel(
 			if selection.Reason == "trace_affinity" {
 				channelScheduler.UpdateTraceAffinity(userID)
 			}
+			channelScheduler.RecordIPAffinity(selectionCtx, userID, channelIndex)
+			channelScheduler.RecordCacheAffinity(userID, channelIndex)
+			channelScheduler.RecordFailoverCost("responses", primaryIndex, primaryUpstream, channelIndex, upstream, responsesReq.Model, usage)
 			return
 		}
 
 		failedChannels[channelIndex] = true
+		failoverDelay.ChannelFailed()
 
 		if failoverErr != nil {
 			lastFailoverError = failoverErr
@@ -402,13 +471,18 @@ func tryChannelWithAllKeys(
 	}
 
 	provider := &providers.ResponsesProvider{SessionManager: sessionManager}
+	// 渠道日志采样：未命中时本次请求在该渠道上不记录请求/响应体
+	envCfg = common.ChannelEnvConfig(c, envCfg, upstream)
 	metricsManager := channelScheduler.GetResponsesMetricsManager()
 	baseURLs := upstream.GetAllBaseURLs()
+	// 按渠道/模型的输出 token 上限改写请求体（仅下调超限的字段）
+	requestBody := common.ClampMaxOutputTokens(c, cfgManager, upstream, responsesReq.Model, bodyBytes, "max_output_tokens", "max_tokens")
 
 	// 获取动态排序后的 URL 列表（非阻塞，立即返回）
 	sortedURLResults := channelScheduler.GetSortedURLsForChannel(channelIndex, baseURLs)
 
 	var lastFailoverError *common.FailoverError
+	sentAttempts := 0
 	deprioritizeCandidates := make(map[string]bool)
 
 	// 强制探测模式
@@ -425,7 +499,7 @@ func tryChannelWithAllKeys(
 		maxRetries := len(upstream.APIKeys)
 
 		for attempt := 0; attempt < maxRetries; attempt++ {
-			common.RestoreRequestBody(c, bodyBytes)
+			common.RestoreRequestBody(c, requestBody)
 
 			// 按优先级顺序选择下一个可用 Key
 			apiKey, err := cfgManager.GetNextResponsesAPIKey(upstream, failedKeys)
@@ -447,7 +521,10 @@ func tryChannelWithAllKeys(
 			}
 
 			if envCfg.ShouldLog("info") {
-				log.Printf("[Responses-Key] 使用API密钥: %s (BaseURL %d/%d, 尝试 %d/%d)", utils.MaskAPIKey(apiKey), sortedIdx+1, len(sortedURLResults), attempt+1, maxRetries)
+				logger.Info("Responses-Key", "使用API密钥",
+					logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+					logger.F("base_url", fmt.Sprintf("%d/%d", sortedIdx+1, len(sortedURLResults))),
+					logger.F("attempt", fmt.Sprintf("%d/%d", attempt+1, maxRetries)), logger.F("request_id", reqCtx.logRequestID()))
 			}
 
 			// 使用深拷贝避免并发修改问题
@@ -475,14 +552,34 @@ func tryChannelWithAllKeys(
 				return true, "", 0, nil, nil
 			}
 
-			resp, err := common.SendRequest(providerReq, upstream, envCfg, responsesReq.Stream)
+			// 同一渠道内的 Key/BaseURL 重试受全局重试预算限制
+			if sentAttempts > 0 && !channelScheduler.AllowRetry() {
+				log.Printf("[Responses-RetryBudget] 警告: 全局重试预算已耗尽，停止渠道 %s 内的重试", upstream.Name)
+				return false, "", 0, lastFailoverError, nil
+			}
+			// 故障转移尝试受全局并发上限限制，避免上游大面积故障时的惊群
+			releaseSlot, ok := common.AcquireFailoverSlot(c, channelScheduler)
+			if !ok {
+				log.Printf("[Responses-FailoverLimit] 警告: 全局故障转移并发已满，停止渠道 %s 内的重试", upstream.Name)
+				return false, "", 0, lastFailoverError, nil
+			}
+			sentAttempts++
+
+			attemptStart := time.Now()
+			resp, err := common.SendRequestForModel(providerReq, upstream, envCfg, responsesReq.Stream, responsesReq.Model)
+			releaseSlot()
+			common.RecordUpstreamAttempt(c, channelIndex, upstream.Name, apiKey, resp, err, time.Since(attemptStart))
+			resp = common.CaptureUpstreamExchange(c, "responses", upstream, apiKey, bodyBytes, providerReq, resp, err)
 			if err != nil {
 				failedKeys[apiKey] = true
 				cfgManager.MarkKeyAsFailed(apiKey)
 				channelScheduler.RecordFailure(currentBaseURL, apiKey, true)
 				// 网络错误（超时等）触发 URL 动态降级
 				channelScheduler.MarkURLFailure(channelIndex, currentBaseURL)
-				log.Printf("[Responses-Key] 警告: API密钥失败: %v", err)
+				logger.Warn("Responses-Key", "API密钥失败",
+					logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+					logger.F("latency_ms", time.Since(attemptStart).Milliseconds()), logger.F("error", err.Error()),
+					logger.F("request_id", reqCtx.logRequestID()))
 				continue
 			}
 
@@ -491,18 +588,22 @@ func tryChannelWithAllKeys(
 				resp.Body.Close()
 				respBodyBytes = utils.DecompressGzipIfNeeded(resp, respBodyBytes)
 
-				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKey(resp.StatusCode, respBodyBytes, cfgManager.GetFuzzyModeEnabled())
+				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKeyForChannel(upstream, resp.StatusCode, respBodyBytes, common.EffectiveFuzzyMode(c, cfgManager))
 				if shouldFailover {
 					failedKeys[apiKey] = true
 					cfgManager.MarkKeyAsFailed(apiKey)
 					channelScheduler.RecordFailure(currentBaseURL, apiKey, true)
 					// HTTP 5xx 等错误也触发 URL 动态降级
 					channelScheduler.MarkURLFailure(channelIndex, currentBaseURL)
-					log.Printf("[Responses-Key] 警告: API密钥失败 (状态: %d)，尝试下一个密钥", resp.StatusCode)
+					logger.Warn("Responses-Key", "API密钥失败，尝试下一个密钥",
+						logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+						logger.F("status", resp.StatusCode), logger.F("latency_ms", time.Since(attemptStart).Milliseconds()),
+						logger.F("request_id", reqCtx.logRequestID()))
 
 					lastFailoverError = &common.FailoverError{
-						Status: resp.StatusCode,
-						Body:   respBodyBytes,
+						Status:    resp.StatusCode,
+						Body:      respBodyBytes,
+						RequestID: common.ExtractUpstreamRequestID(resp.Header, respBodyBytes),
 					}
 
 					if isQuotaRelated {
@@ -513,14 +614,43 @@ func tryChannelWithAllKeys(
 
 				// 非 failover 错误，记录失败指标后返回
 				channelScheduler.RecordFailure(currentBaseURL, apiKey, true)
+				channelScheduler.RecordChannelResult("responses", channelIndex, upstream, true)
 				if reqCtx != nil {
 					reqCtx.success = false
 					reqCtx.errorMsg = truncateErrorMessage(string(respBodyBytes))
 				}
-				c.Data(resp.StatusCode, "application/json", respBodyBytes)
+				common.WriteUpstreamError(c, resp, respBodyBytes)
 				return true, "", 0, nil, nil
 			}
 
+			// 捕获账号/组织标识（仅首次成功响应），并记录响应延迟（用于 adaptive 密钥选择）
+			channelScheduler.RecordAccountHint(currentBaseURL, apiKey, resp.Header, true)
+			channelScheduler.RecordKeyLatency(currentBaseURL, apiKey, time.Since(attemptStart), true)
+
+			// 非流式响应按渠道配置的 JSON Schema 校验，不符合时视为失败（尚未向客户端写入任何数据，可安全故障转移）
+			if !responsesReq.Stream {
+				if err := common.ValidateResponseSchema(resp, upstreamCopy); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordFailure(currentBaseURL, apiKey, true)
+					log.Printf("[Responses-Schema] 警告: 响应未通过 JSON Schema 校验: %v，尝试下一个密钥", err)
+					lastFailoverError = common.NewSchemaFailoverError(err)
+					continue
+				}
+			}
+
+			// 上游以 2xx 返回错误结构响应体（如 {"error":{...}}）时视为失败（ERROR_BODY_FAILOVER，流式只检测首个事件）
+			if envCfg.ErrorBodyFailover {
+				if err := common.DetectErrorShapedResponse(resp, responsesReq.Stream); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordFailure(currentBaseURL, apiKey, true)
+					log.Printf("[Responses-ErrorBody] 警告: 渠道 %s 密钥 %s 返回错误结构响应体: %v，尝试下一个密钥", upstream.Name, utils.MaskAPIKey(apiKey), err)
+					lastFailoverError = common.NewErrorBodyFailoverError(err)
+					continue
+				}
+			}
+
 			if len(deprioritizeCandidates) > 0 {
 				for key := range deprioritizeCandidates {
 					_ = cfgManager.DeprioritizeAPIKey(key)
@@ -529,8 +659,9 @@ func tryChannelWithAllKeys(
 
 			// 标记 URL 成功，触发动态排序优化
 			channelScheduler.MarkURLSuccess(channelIndex, currentBaseURL)
+			channelScheduler.RecordChannelResult("responses", channelIndex, upstream, false)
 
-			usage := handleSuccess(c, resp, provider, upstream.ServiceType, envCfg, sessionManager, startTime, &responsesReq, bodyBytes)
+			usage := handleSuccess(c, resp, provider, upstream, envCfg, sessionManager, startTime, &responsesReq, bodyBytes)
 			// 计费扣费
 			if billingHandler != nil && billingCtx != nil && usage != nil {
 				billingHandler.AfterRequest(billingCtx, responsesReq.Model, usage.InputTokens, usage.OutputTokens, usage.CacheCreationInputTokens, usage.CacheReadInputTokens)
@@ -578,6 +709,15 @@ func handleSingleChannel(
 		return
 	}
 
+	if tooLargeErr := common.CheckChannelRequestBodySize(upstream, bodyBytes, envCfg.MaxRequestBodySize); tooLargeErr != nil {
+		if reqCtx != nil {
+			reqCtx.success = false
+			reqCtx.errorMsg = truncateErrorMessage(tooLargeErr.Error())
+		}
+		common.RespondRequestTooLarge(c, tooLargeErr)
+		return
+	}
+
 	if len(upstream.APIKeys) == 0 {
 		if reqCtx != nil {
 			reqCtx.channelIndex = 0
@@ -600,9 +740,13 @@ func handleSingleChannel(
 		reqCtx.channelName = upstream.Name
 		reqCtx.updateLive()
 	}
+	// 渠道日志采样：未命中时本次请求在该渠道上不记录请求/响应体
+	envCfg = common.ChannelEnvConfig(c, envCfg, upstream)
 
 	metricsManager := channelScheduler.GetResponsesMetricsManager()
 	baseURLs := upstream.GetAllBaseURLs()
+	// 按渠道/模型的输出 token 上限改写请求体（仅下调超限的字段）
+	requestBody := common.ClampMaxOutputTokens(c, cfgManager, upstream, responsesReq.Model, bodyBytes, "max_output_tokens", "max_tokens")
 
 	var lastError error
 	var lastFailoverError *common.FailoverError
@@ -620,7 +764,7 @@ func handleSingleChannel(
 		maxRetries := len(upstream.APIKeys)
 
 		for attempt := 0; attempt < maxRetries; attempt++ {
-			common.RestoreRequestBody(c, bodyBytes)
+			common.RestoreRequestBody(c, requestBody)
 
 			apiKey, err := cfgManager.GetNextResponsesAPIKey(upstream, failedKeys)
 			if err != nil {
@@ -641,7 +785,8 @@ func handleSingleChannel(
 
 			if envCfg.ShouldLog("info") {
 				log.Printf("[Responses-Upstream] 使用 Responses 上游: %s - %s (BaseURL %d/%d, 尝试 %d/%d)", upstream.Name, currentBaseURL, baseURLIdx+1, len(baseURLs), attempt+1, maxRetries)
-				log.Printf("[Responses-Key] 使用API密钥: %s", utils.MaskAPIKey(apiKey))
+				logger.Info("Responses-Key", "使用API密钥",
+					logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)), logger.F("request_id", reqCtx.logRequestID()))
 			}
 
 			// 使用深拷贝避免并发修改问题
@@ -669,13 +814,19 @@ func handleSingleChannel(
 				return
 			}
 
-			resp, err := common.SendRequest(providerReq, upstream, envCfg, responsesReq.Stream)
+			attemptStart := time.Now()
+			resp, err := common.SendRequestForModel(providerReq, upstream, envCfg, responsesReq.Stream, responsesReq.Model)
+			common.RecordUpstreamAttempt(c, 0, upstream.Name, apiKey, resp, err, time.Since(attemptStart))
+			resp = common.CaptureUpstreamExchange(c, "responses", upstream, apiKey, bodyBytes, providerReq, resp, err)
 			if err != nil {
 				lastError = err
 				failedKeys[apiKey] = true
 				cfgManager.MarkKeyAsFailed(apiKey)
 				channelScheduler.RecordFailure(currentBaseURL, apiKey, true)
-				log.Printf("[Responses-Key] 警告: API密钥失败: %v", err)
+				logger.Warn("Responses-Key", "API密钥失败",
+					logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+					logger.F("latency_ms", time.Since(attemptStart).Milliseconds()), logger.F("error", err.Error()),
+					logger.F("request_id", reqCtx.logRequestID()))
 				continue
 			}
 
@@ -684,14 +835,17 @@ func handleSingleChannel(
 				resp.Body.Close()
 				respBodyBytes = utils.DecompressGzipIfNeeded(resp, respBodyBytes)
 
-				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKey(resp.StatusCode, respBodyBytes, cfgManager.GetFuzzyModeEnabled())
+				shouldFailover, isQuotaRelated := common.ShouldRetryWithNextKeyForChannel(upstream, resp.StatusCode, respBodyBytes, common.EffectiveFuzzyMode(c, cfgManager))
 				if shouldFailover {
 					lastError = fmt.Errorf("上游错误: %d", resp.StatusCode)
 					failedKeys[apiKey] = true
 					cfgManager.MarkKeyAsFailed(apiKey)
 					channelScheduler.RecordFailure(currentBaseURL, apiKey, true)
 
-					log.Printf("[Responses-Key] 警告: Responses API密钥失败 (状态: %d)，尝试下一个密钥", resp.StatusCode)
+					logger.Warn("Responses-Key", "API密钥失败，尝试下一个密钥",
+						logger.F("channel", upstream.Name), logger.F("key_mask", utils.MaskAPIKey(apiKey)),
+						logger.F("status", resp.StatusCode), logger.F("latency_ms", time.Since(attemptStart).Milliseconds()),
+						logger.F("request_id", reqCtx.logRequestID()))
 					if envCfg.EnableResponseLogs && envCfg.IsDevelopment() {
 						var formattedBody string
 						if envCfg.RawLogOutput {
@@ -701,12 +855,13 @@ func handleSingleChannel(
 						}
 						log.Printf("[Responses-Error] 失败原因:\n%s", formattedBody)
 					} else if envCfg.EnableResponseLogs {
-						log.Printf("[Responses-Error] 失败原因: %s", string(respBodyBytes))
+						log.Printf("[Responses-Error] 失败原因: %s", utils.RedactBodyForLog(respBodyBytes))
 					}
 
 					lastFailoverError = &common.FailoverError{
-						Status: resp.StatusCode,
-						Body:   respBodyBytes,
+						Status:    resp.StatusCode,
+						Body:      respBodyBytes,
+						RequestID: common.ExtractUpstreamRequestID(resp.Header, respBodyBytes),
 					}
 
 					if isQuotaRelated {
@@ -747,10 +902,38 @@ func handleSingleChannel(
 					reqCtx.success = false
 					reqCtx.errorMsg = truncateErrorMessage(string(respBodyBytes))
 				}
-				c.Data(resp.StatusCode, "application/json", respBodyBytes)
+				common.WriteUpstreamError(c, resp, respBodyBytes)
 				return
 			}
 
+			// 捕获账号/组织标识（仅首次成功响应），并记录响应延迟（用于 adaptive 密钥选择）
+			channelScheduler.RecordAccountHint(currentBaseURL, apiKey, resp.Header, true)
+			channelScheduler.RecordKeyLatency(currentBaseURL, apiKey, time.Since(attemptStart), true)
+
+			// 非流式响应按渠道配置的 JSON Schema 校验，不符合时视为失败（尚未向客户端写入任何数据，可安全故障转移）
+			if !responsesReq.Stream {
+				if err := common.ValidateResponseSchema(resp, upstreamCopy); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordFailure(currentBaseURL, apiKey, true)
+					log.Printf("[Responses-Schema] 警告: 响应未通过 JSON Schema 校验: %v，尝试下一个密钥", err)
+					lastFailoverError = common.NewSchemaFailoverError(err)
+					continue
+				}
+			}
+
+			// 上游以 2xx 返回错误结构响应体（如 {"error":{...}}）时视为失败（ERROR_BODY_FAILOVER，流式只检测首个事件）
+			if envCfg.ErrorBodyFailover {
+				if err := common.DetectErrorShapedResponse(resp, responsesReq.Stream); err != nil {
+					resp.Body.Close()
+					failedKeys[apiKey] = true
+					channelScheduler.RecordFailure(currentBaseURL, apiKey, true)
+					log.Printf("[Responses-ErrorBody] 警告: 渠道 %s 密钥 %s 返回错误结构响应体: %v，尝试下一个密钥", upstream.Name, utils.MaskAPIKey(apiKey), err)
+					lastFailoverError = common.NewErrorBodyFailoverError(err)
+					continue
+				}
+			}
+
 			if len(deprioritizeCandidates) > 0 {
 				for key := range deprioritizeCandidates {
 					if err := cfgManager.DeprioritizeAPIKey(key); err != nil {
@@ -759,12 +942,13 @@ func handleSingleChannel(
 				}
 			}
 
-			usage := handleSuccess(c, resp, provider, upstream.ServiceType, envCfg, sessionManager, startTime, &responsesReq, bodyBytes)
+			usage := handleSuccess(c, resp, provider, upstream, envCfg, sessionManager, startTime, &responsesReq, bodyBytes)
 			var costCents int64
 			if billingHandler != nil && usage != nil {
 				costCents = billingHandler.CalculateCost(responsesReq.Model, usage.InputTokens, usage.OutputTokens, usage.CacheCreationInputTokens, usage.CacheReadInputTokens)
 			}
 			channelScheduler.RecordSuccessWithUsage(currentBaseURL, apiKey, usage, true, responsesReq.Model, costCents)
+			common.RecordStreamTiming(c, channelScheduler, currentBaseURL, apiKey, usage, true)
 			if reqCtx != nil {
 				reqCtx.usage = usage
 				reqCtx.costCents = costCents
@@ -796,7 +980,7 @@ func handleSuccess(
 	c *gin.Context,
 	resp *http.Response,
 	provider *providers.ResponsesProvider,
-	upstreamType string,
+	upstream *config.UpstreamConfig,
 	envCfg *config.EnvConfig,
 	sessionManager *session.SessionManager,
 	startTime time.Time,
@@ -808,7 +992,7 @@ func handleSuccess(
 	isStream := originalReq != nil && originalReq.Stream
 
 	if isStream {
-		return handleStreamSuccess(c, resp, upstreamType, envCfg, startTime, originalReq, originalRequestJSON)
+		return handleStreamSuccess(c, resp, upstream, envCfg, startTime, originalReq, originalRequestJSON)
 	}
 
 	// 非流式响应处理
@@ -853,7 +1037,7 @@ func handleSuccess(
 		Stream:     false,
 	}
 
-	responsesResp, err := provider.ConvertToResponsesResponse(providerResp, upstreamType, "")
+	responsesResp, err := provider.ConvertToResponsesResponse(providerResp, upstream.ServiceType, "")
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to convert response"})
 		return nil
@@ -862,6 +1046,14 @@ func handleSuccess(
 	// Token 补全逻辑
 	patchResponsesUsage(responsesResp, originalRequestJSON, envCfg)
 
+	// 按渠道改写返回给客户端的模型名
+	if rewritten, ok := upstream.RewriteResponseModel(responsesResp.Model); ok {
+		if envCfg.EnableResponseLogs && envCfg.ShouldLog("debug") {
+			log.Printf("[Response-Model] 渠道 %s 改写 model: %s -> %s", upstream.Name, responsesResp.Model, rewritten)
+		}
+		responsesResp.Model = rewritten
+	}
+
 	// 更新会话
 	if originalReq.Store == nil || *originalReq.Store {
 		sess, err := sessionManager.GetOrCreateSession(originalReq.PreviousResponseID)
@@ -885,7 +1077,13 @@ func handleSuccess(
 	}
 
 	utils.ForwardResponseHeaders(resp.Header, c.Writer)
-	c.JSON(200, responsesResp)
+	// 客户端通过 Accept 头要求 Claude 格式时转换响应结构（会话记录仍使用 Responses 格式）
+	if common.RequestedResponseFormat(c) == common.ResponseFormatClaude {
+		c.Header(common.ResponseFormatHeader, common.ResponseFormatClaude)
+		common.WriteJSONResponse(c, envCfg, 200, converters.ResponsesResponseToClaude(responsesResp))
+	} else {
+		common.WriteJSONResponse(c, envCfg, 200, responsesResp)
+	}
 
 	// 返回 usage 数据用于指标记录
 	return &types.Usage{
@@ -896,9 +1094,18 @@ func handleSuccess(
 		CacheCreation5mInputTokens: responsesResp.Usage.CacheCreation5mInputTokens,
 		CacheCreation1hInputTokens: responsesResp.Usage.CacheCreation1hInputTokens,
 		CacheTTL:                   responsesResp.Usage.CacheTTL,
+		ThinkingTokens:             responsesReasoningTokens(&responsesResp.Usage),
 	}
 }
 
+// responsesReasoningTokens 读取 output_tokens_details.reasoning_tokens（推理 token 已包含在 output_tokens 中）
+func responsesReasoningTokens(usage *types.ResponsesUsage) int {
+	if usage.OutputTokensDetails == nil {
+		return 0
+	}
+	return common.ClampThinkingTokens(usage.OutputTokensDetails.ReasoningTokens, usage.OutputTokens)
+}
+
 // patchResponsesUsage 补全 Responses 响应的 Token 统计
 func patchResponsesUsage(resp *types.ResponsesResponse, requestBody []byte, envCfg *config.EnvConfig) {
 	// 检查是否有 Claude 原生缓存 token（有时才跳过 input_tokens 修补）
@@ -1021,12 +1228,14 @@ func estimateResponsesOutputFromItems(output []types.ResponsesItem) int {
 func handleStreamSuccess(
 	c *gin.Context,
 	resp *http.Response,
-	upstreamType string,
+	upstream *config.UpstreamConfig,
 	envCfg *config.EnvConfig,
 	startTime time.Time,
 	originalReq *types.ResponsesRequest,
 	originalRequestJSON []byte,
 ) *types.Usage {
+	defer common.TrackStream("responses")()
+
 	if envCfg.EnableResponseLogs {
 		responseTime := time.Since(startTime).Milliseconds()
 		log.Printf("[Responses-Stream] Responses 流式响应开始: %dms, 状态: %d", responseTime, resp.StatusCode)
@@ -1043,6 +1252,7 @@ func handleStreamSuccess(
 	var logBuffer bytes.Buffer
 	streamLoggingEnabled := envCfg.IsDevelopment() && envCfg.EnableResponseLogs
 
+	upstreamType := upstream.ServiceType
 	if streamLoggingEnabled {
 		synthesizer = utils.NewStreamSynthesizer(upstreamType)
 	}
@@ -1053,6 +1263,13 @@ func handleStreamSuccess(
 	c.Status(resp.StatusCode)
 	flusher, _ := c.Writer.(http.Flusher)
 
+	// 刷新合并：扫描循环为同步读取，窗口结束的延迟刷新由计时器完成（写入与刷新加锁串行化）
+	var flushCoalescer *common.TimedFlushCoalescer
+	if flusher != nil && envCfg.StreamFlushInterval > 0 {
+		flushCoalescer = common.NewTimedFlushCoalescer(c.Writer, flusher, time.Duration(envCfg.StreamFlushInterval)*time.Millisecond, envCfg.StreamFlushMaxEvents)
+		defer flushCoalescer.Close()
+	}
+
 	scanner := bufio.NewScanner(resp.Body)
 	const maxCapacity = 1024 * 1024
 	buf := make([]byte, 0, 64*1024)
@@ -1060,11 +1277,13 @@ func handleStreamSuccess(
 
 	// Token 统计状态
 	var outputTextBuffer bytes.Buffer
+	var reasoningTextBuffer bytes.Buffer    // 推理摘要文本（上游未返回 reasoning_tokens 时用于估算）
 	const maxOutputBufferSize = 1024 * 1024 // 1MB 上限，防止内存溢出
 	var collectedUsage responsesStreamUsage
 	hasUsage := false
 	needTokenPatch := false
 	clientGone := false
+	var firstTokenAt time.Time
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -1098,6 +1317,12 @@ func handleStreamSuccess(
 			if outputTextBuffer.Len() < maxOutputBufferSize {
 				extractResponsesTextFromEvent(event, &outputTextBuffer)
 			}
+			if reasoningTextBuffer.Len() < maxOutputBufferSize {
+				extractResponsesReasoningFromEvent(event, &reasoningTextBuffer)
+			}
+			if firstTokenAt.IsZero() && outputTextBuffer.Len() > 0 {
+				firstTokenAt = time.Now()
+			}
 
 			// 检测并收集 usage
 			detected, needPatch, usageData := checkResponsesEventUsage(event, envCfg.EnableResponseLogs && envCfg.ShouldLog("debug"))
@@ -1131,10 +1356,16 @@ func handleStreamSuccess(
 					eventToSend = patchResponsesCompletedEventUsage(event, originalRequestJSON, outputTextBuffer.String(), &collectedUsage, envCfg)
 				}
 			}
+			eventToSend = common.RewriteEventModel(eventToSend, "response.model", upstream, envCfg.EnableResponseLogs && envCfg.ShouldLog("debug"))
 
 			// 转发给客户端
 			if !clientGone {
-				_, err := c.Writer.Write([]byte(eventToSend))
+				var err error
+				if flushCoalescer != nil {
+					err = flushCoalescer.WriteEvent(eventToSend)
+				} else {
+					_, err = c.Writer.Write([]byte(eventToSend))
+				}
 				if err != nil {
 					clientGone = true
 					if !isClientDisconnectError(err) {
@@ -1142,7 +1373,7 @@ func handleStreamSuccess(
 					} else if envCfg.ShouldLog("info") {
 						log.Printf("[Responses-Stream] 客户端中断连接 (正常行为)，继续接收上游数据...")
 					}
-				} else if flusher != nil {
+				} else if flusher != nil && flushCoalescer == nil {
 					flusher.Flush()
 				}
 			}
@@ -1153,6 +1384,11 @@ func handleStreamSuccess(
 		log.Printf("[Responses-Stream] 警告: 流式响应读取错误: %v", err)
 	}
 
+	// 首 token 延迟与生成速度，由记录成功指标的调用方写入渠道指标
+	if timing, ok := common.NewStreamTiming(common.UpstreamAttemptStart(c, startTime), firstTokenAt); ok {
+		common.SetStreamTiming(c, timing)
+	}
+
 	if envCfg.EnableResponseLogs {
 		responseTime := time.Since(startTime).Milliseconds()
 		log.Printf("[Responses-Stream] Responses 流式响应完成: %dms", responseTime)
@@ -1173,10 +1409,10 @@ func handleStreamSuccess(
 				if synthesizedContent != "" && !parseFailed {
 					log.Printf("[Responses-Stream] 上游流式响应合成内容:\n%s", strings.TrimSpace(synthesizedContent))
 				} else if logBuffer.Len() > 0 {
-					log.Printf("[Responses-Stream] 上游流式响应原始内容:\n%s", logBuffer.String())
+					log.Printf("[Responses-Stream] 上游流式响应原始内容:\n%s", utils.RedactSSEForLog(logBuffer.String()))
 				}
 			} else if logBuffer.Len() > 0 {
-				log.Printf("[Responses-Stream] 上游流式响应原始内容:\n%s", logBuffer.String())
+				log.Printf("[Responses-Stream] 上游流式响应原始内容:\n%s", utils.RedactSSEForLog(logBuffer.String()))
 			}
 		}
 	}
@@ -1190,6 +1426,7 @@ func handleStreamSuccess(
 		CacheCreation5mInputTokens: collectedUsage.CacheCreation5mInputTokens,
 		CacheCreation1hInputTokens: collectedUsage.CacheCreation1hInputTokens,
 		CacheTTL:                   collectedUsage.CacheTTL,
+		ThinkingTokens:             collectedUsage.thinkingTokens(reasoningTextBuffer.String()),
 	}
 }
 
@@ -1204,6 +1441,41 @@ type responsesStreamUsage struct {
 	CacheCreation1hInputTokens int
 	CacheTTL                   string
 	HasClaudeCache             bool // 是否检测到 Claude 原生缓存字段（区别于 OpenAI cached_tokens）
+	ReasoningTokens            int  // output_tokens_details.reasoning_tokens
+}
+
+// thinkingTokens 推理 token 数：优先使用上游 reasoning_tokens，缺失时按推理摘要文本估算
+func (u *responsesStreamUsage) thinkingTokens(reasoningText string) int {
+	tokens := u.ReasoningTokens
+	if tokens == 0 {
+		tokens = utils.EstimateTokens(reasoningText)
+	}
+	return common.ClampThinkingTokens(tokens, u.OutputTokens)
+}
+
+// extractResponsesReasoningFromEvent 从 Responses SSE 事件中提取推理摘要文本
+func extractResponsesReasoningFromEvent(event string, buf *bytes.Buffer) {
+	if !strings.Contains(event, "response.reasoning_summary_text.delta") {
+		return
+	}
+	for _, line := range strings.Split(event, "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var data struct {
+			Type  string `json:"type"`
+			Delta string `json:"delta"`
+			Text  string `json:"text"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data); err != nil || data.Type != "response.reasoning_summary_text.delta" {
+			continue
+		}
+		if data.Delta != "" {
+			buf.WriteString(data.Delta)
+		} else {
+			buf.WriteString(data.Text)
+		}
+	}
 }
 
 // extractResponsesTextFromEvent 从 Responses SSE 事件中提取文本内容
@@ -1367,6 +1639,11 @@ func extractResponsesUsageFromMap(usage map[string]interface{}) responsesStreamU
 			// 注意：不设置 HasClaudeCache，因为这是 OpenAI 格式
 		}
 	}
+	if details, ok := usage["output_tokens_details"].(map[string]interface{}); ok {
+		if v, ok := details["reasoning_tokens"].(float64); ok {
+			data.ReasoningTokens = int(v)
+		}
+	}
 
 	// 设置 CacheTTL
 	var has5m, has1h bool
@@ -1417,6 +1694,9 @@ func updateResponsesStreamUsage(collected *responsesStreamUsage, usageData respo
 	if usageData.HasClaudeCache {
 		collected.HasClaudeCache = true
 	}
+	if usageData.ReasoningTokens > collected.ReasoningTokens {
+		collected.ReasoningTokens = usageData.ReasoningTokens
+	}
 }
 
 // isResponsesCompletedEvent 检测是否为 response.completed 事件
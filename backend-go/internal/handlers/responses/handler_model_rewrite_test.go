@@ -0,0 +1,80 @@
+package responses
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/session"
+	"github.com/gin-gonic/gin"
+)
+
+func TestResponsesHandler_ResponseModelRewrite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(bytes.Buffer)
+		_, _ = body.ReadFrom(r.Body)
+		if strings.Contains(body.String(), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_s\",\"model\":\"internal-x\",\"status\":\"in_progress\"}}\n"))
+			_, _ = w.Write([]byte("data: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}\n"))
+			_, _ = w.Write([]byte("data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_s\",\"model\":\"internal-x\",\"status\":\"completed\",\"usage\":{\"input_tokens\":12,\"output_tokens\":34,\"total_tokens\":46}}}\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","model":"internal-x","status":"completed",
+  "output":[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"hi"}]}],
+  "usage":{"input_tokens":12,"output_tokens":34,"total_tokens":46}}`))
+	}))
+	defer upstream.Close()
+
+	cfgManager, cleanupCfg := createTestConfigManager(t, config.Config{
+		ResponsesUpstream: []config.UpstreamConfig{{
+			Name: "r0", BaseURL: upstream.URL, APIKeys: []string{"rk1"}, ServiceType: "responses", Status: "active", Priority: 1,
+			ResponseModelRewrite: map[string]string{"internal-x": "gpt-pinned"},
+		}},
+		LoadBalance:          "failover",
+		ResponsesLoadBalance: "failover",
+		GeminiLoadBalance:    "failover",
+	})
+	defer cleanupCfg()
+	sch, cleanupSch := createTestScheduler(t, cfgManager)
+	defer cleanupSch()
+
+	envCfg := &config.EnvConfig{
+		ProxyAccessKey:     "secret",
+		MaxRequestBodySize: 1024 * 1024,
+		Env:                "development",
+		EnableResponseLogs: true,
+		LogLevel:           "debug",
+	}
+	sessionManager := session.NewSessionManager(time.Hour, 100, 100000)
+	r := gin.New()
+	r.POST("/v1/responses", NewHandler(envCfg, cfgManager, sessionManager, sch, nil, nil, nil, nil))
+
+	for _, body := range []string{
+		`{"model":"gpt-4o","input":"hello"}`,
+		`{"model":"gpt-4o","input":"hello","stream":true}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewBufferString(body))
+		req.Header.Set("x-api-key", envCfg.ProxyAccessKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", body, w.Code, w.Body.String())
+		}
+		out := w.Body.String()
+		if !strings.Contains(out, `"model":"gpt-pinned"`) || strings.Contains(out, "internal-x") {
+			t.Fatalf("%s: model not rewritten: %s", body, out)
+		}
+		if !strings.Contains(out, `"output_tokens":34`) {
+			t.Fatalf("%s: usage lost: %s", body, out)
+		}
+	}
+}
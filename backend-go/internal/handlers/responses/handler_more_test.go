@@ -1,6 +1,7 @@
 package responses
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"strings"
@@ -83,6 +84,34 @@ func TestUpdateResponsesStreamUsage(t *testing.T) {
 	}
 }
 
+func TestResponsesStreamUsage_ReasoningTokens(t *testing.T) {
+	u := extractResponsesUsageFromMap(map[string]interface{}{
+		"output_tokens": float64(500),
+		"output_tokens_details": map[string]interface{}{
+			"reasoning_tokens": float64(320),
+		},
+	})
+	if u.ReasoningTokens != 320 || u.thinkingTokens("ignored") != 320 {
+		t.Fatalf("unexpected reasoning tokens: %+v", u)
+	}
+
+	// 上游未返回 reasoning_tokens 时按推理摘要文本估算，且不超过 output_tokens
+	var buf bytes.Buffer
+	extractResponsesReasoningFromEvent("data: {\"type\":\"response.reasoning_summary_text.delta\",\"delta\":\""+strings.Repeat("plan ", 50)+"\"}\n\n", &buf)
+	extractResponsesReasoningFromEvent("data: {\"type\":\"response.output_text.delta\",\"delta\":\"answer\"}\n\n", &buf)
+	if strings.Contains(buf.String(), "answer") || buf.Len() == 0 {
+		t.Fatalf("reasoning text = %q", buf.String())
+	}
+	estimated := &responsesStreamUsage{OutputTokens: 1000}
+	if got := estimated.thinkingTokens(buf.String()); got == 0 || got >= 1000 {
+		t.Fatalf("estimated thinking tokens = %d", got)
+	}
+	capped := &responsesStreamUsage{OutputTokens: 3}
+	if got := capped.thinkingTokens(buf.String()); got != 3 {
+		t.Fatalf("capped thinking tokens = %d, want 3", got)
+	}
+}
+
 func TestIsClientDisconnectError(t *testing.T) {
 	if !isClientDisconnectError(errors.New("broken pipe")) {
 		t.Fatalf("expected true")
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/BenedictKing/claude-proxy/internal/scheduler"
+	"github.com/BenedictKing/claude-proxy/internal/session"
+	"github.com/gin-gonic/gin"
+)
+
+// RuntimeMemoryStats 运行时内存统计
+type RuntimeMemoryStats struct {
+	HeapAllocBytes uint64 `json:"heapAllocBytes"`
+	HeapInuseBytes uint64 `json:"heapInuseBytes"`
+	HeapObjects    uint64 `json:"heapObjects"`
+	SysBytes       uint64 `json:"sysBytes"`
+	NumGC          uint32 `json:"numGC"`
+}
+
+// RuntimeMapSizes 常驻内存的会话/亲和表大小（持续增长且不回落通常意味着清理失效）
+type RuntimeMapSizes struct {
+	Sessions         int `json:"sessions"`
+	ResponseMappings int `json:"responseMappings"`
+	TraceAffinity    int `json:"traceAffinity"`
+	IPAffinity       int `json:"ipAffinity"`
+	PinnedAffinity   int `json:"pinnedAffinity"`
+}
+
+// RuntimeDiagnosticsResponse 泄漏诊断信息
+type RuntimeDiagnosticsResponse struct {
+	Timestamp     time.Time                `json:"timestamp"`
+	Uptime        float64                  `json:"uptime"` // 秒
+	Goroutines    int                      `json:"goroutines"`
+	Memory        RuntimeMemoryStats       `json:"memory"`
+	ActiveStreams common.ActiveStreamStats `json:"activeStreams"`
+	Maps          RuntimeMapSizes          `json:"maps"`
+}
+
+// GetRuntimeDiagnostics 获取 goroutine/内存/进行中流式响应与会话亲和表大小，用于排查长期运行实例的泄漏
+// （如客户端断开后仍未退出的流 goroutine：activeStreams.count 不回落、oldestAgeSeconds 持续增长）
+func GetRuntimeDiagnostics(sch *scheduler.ChannelScheduler, sessionManager *session.SessionManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		resp := RuntimeDiagnosticsResponse{
+			Timestamp:  time.Now(),
+			Uptime:     time.Since(startTime).Seconds(),
+			Goroutines: runtime.NumGoroutine(),
+			Memory: RuntimeMemoryStats{
+				HeapAllocBytes: mem.HeapAlloc,
+				HeapInuseBytes: mem.HeapInuse,
+				HeapObjects:    mem.HeapObjects,
+				SysBytes:       mem.Sys,
+				NumGC:          mem.NumGC,
+			},
+			ActiveStreams: common.GetActiveStreamStats(),
+		}
+
+		if sessionManager != nil {
+			sessions, mappings := sessionManager.Size()
+			resp.Maps.Sessions = sessions
+			resp.Maps.ResponseMappings = mappings
+		}
+		if sch != nil {
+			if affinity := sch.GetTraceAffinityManager(); affinity != nil {
+				resp.Maps.TraceAffinity = affinity.Size()
+				resp.Maps.IPAffinity = affinity.IPAffinitySize()
+			}
+			resp.Maps.PinnedAffinity = sch.GetPinnedAffinityCount()
+		}
+
+		c.JSON(200, resp)
+	}
+}
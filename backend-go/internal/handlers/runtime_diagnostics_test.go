@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetRuntimeDiagnostics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/diagnostics/runtime", GetRuntimeDiagnostics(nil, nil))
+
+	get := func() RuntimeDiagnosticsResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diagnostics/runtime", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+		}
+		var resp RuntimeDiagnosticsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		return resp
+	}
+
+	before := get()
+	if before.Goroutines <= 0 || before.Memory.HeapAllocBytes == 0 {
+		t.Fatalf("应返回 goroutine 与内存统计: %+v", before)
+	}
+
+	done := common.TrackStream("messages")
+	during := get()
+	done()
+	if during.ActiveStreams.Count != before.ActiveStreams.Count+1 || during.ActiveStreams.ByAPI["messages"] != before.ActiveStreams.ByAPI["messages"]+1 {
+		t.Fatalf("activeStreams = %+v, want one more messages stream than %+v", during.ActiveStreams, before.ActiveStreams)
+	}
+	if after := get(); after.ActiveStreams.Count != before.ActiveStreams.Count {
+		t.Fatalf("流结束后 activeStreams.count = %d, want %d", after.ActiveStreams.Count, before.ActiveStreams.Count)
+	}
+}
@@ -37,3 +37,35 @@ func SetFuzzyMode(cfgManager *config.ConfigManager) gin.HandlerFunc {
 		})
 	}
 }
+
+// GetExcludeLowQuality 获取默认排除低质量渠道状态
+func GetExcludeLowQuality(cfgManager *config.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"excludeLowQualityChannels": cfgManager.GetExcludeLowQualityChannels(),
+		})
+	}
+}
+
+// SetExcludeLowQuality 设置默认排除低质量渠道状态
+func SetExcludeLowQuality(cfgManager *config.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		if err := cfgManager.SetExcludeLowQualityChannels(req.Enabled); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to save config"})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"success":                   true,
+			"excludeLowQualityChannels": req.Enabled,
+		})
+	}
+}
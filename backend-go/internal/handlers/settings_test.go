@@ -112,3 +112,66 @@ func TestSetFuzzyMode_SaveFailReturns500(t *testing.T) {
 		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
 	}
 }
+
+func TestExcludeLowQualityHandlers_GetAndSet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cm, _ := newTestConfigManager(t, config.Config{
+		LoadBalance:          "failover",
+		ResponsesLoadBalance: "failover",
+		GeminiLoadBalance:    "failover",
+	})
+
+	r := gin.New()
+	r.GET("/api/settings/exclude-low-quality", GetExcludeLowQuality(cm))
+	r.PUT("/api/settings/exclude-low-quality", SetExcludeLowQuality(cm))
+
+	getEnabled := func() bool {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/settings/exclude-low-quality", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET status=%d", w.Code)
+		}
+		var resp struct {
+			Enabled bool `json:"excludeLowQualityChannels"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return resp.Enabled
+	}
+
+	if getEnabled() {
+		t.Fatalf("expected excludeLowQualityChannels=false")
+	}
+
+	// PUT invalid body
+	{
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/api/settings/exclude-low-quality", bytes.NewBufferString("{"))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("PUT invalid status=%d", w.Code)
+		}
+	}
+
+	// PUT enable
+	{
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/api/settings/exclude-low-quality", bytes.NewBufferString(`{"enabled":true}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("PUT status=%d body=%s", w.Code, w.Body.String())
+		}
+	}
+
+	if !getEnabled() {
+		t.Fatalf("expected excludeLowQualityChannels=true")
+	}
+	if !cm.GetExcludeLowQualityChannels() {
+		t.Fatalf("expected config manager to persist excludeLowQualityChannels=true")
+	}
+}
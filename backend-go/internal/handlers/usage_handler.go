@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/usage"
+	"github.com/gin-gonic/gin"
+)
+
+// usageUnattributedGroup SQLite 请求记录不含调用方 API Key，按 key 分组时回退数据归入该分组
+const usageUnattributedGroup = "(unattributed)"
+
+// usageSQLiteBucket SQLite 回退查询的分桶粒度（15 分钟，保证按本地日期分组时兼容非整点时区）
+const usageSQLiteBucket = 15 * time.Minute
+
+// usageAPITypes SQLite 回退查询覆盖的接口类型
+var usageAPITypes = []string{"messages", "responses", "gemini"}
+
+// UsageHandler 处理使用量查询 API（多用户计费模式下的对账与内部结算）
+type UsageHandler struct {
+	store        *usage.Store
+	metricsStore *metrics.SQLiteStore
+}
+
+// NewUsageHandler 创建 handler（store 仅在计费模式下存在，metricsStore 仅在启用指标持久化时存在）
+func NewUsageHandler(store *usage.Store, metricsStore *metrics.SQLiteStore) *UsageHandler {
+	return &UsageHandler{store: store, metricsStore: metricsStore}
+}
+
+// UsageGroup 单个分组的使用量汇总
+type UsageGroup struct {
+	Group string `json:"group"`
+	usage.Totals
+}
+
+// UsageSource 数据来源及其覆盖的时间范围
+type UsageSource struct {
+	Source string    `json:"source"` // memory: 计费使用量记录; sqlite: 持久化请求记录
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+}
+
+// UsageResponse 使用量查询响应
+type UsageResponse struct {
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+	GroupBy usage.GroupBy `json:"groupBy"`
+	Groups  []UsageGroup  `json:"groups"`
+	Total   usage.Totals  `json:"total"`
+	Sources []UsageSource `json:"sources"`
+	// Incomplete 为 true 表示部分时间范围早于内存记录且无 SQLite 数据可回退，结果不完整
+	Incomplete bool `json:"incomplete"`
+}
+
+// GetUsage 按调用方 API Key / 模型 / 日期聚合使用量
+// GET /api/usage?from=2026-10-01&to=2026-10-31&groupBy=key|model|day
+// from/to 支持 RFC3339 或本地日期（YYYY-MM-DD，to 为日期时包含当天），默认最近 24 小时。
+// 内存使用量记录有容量上限，早于其覆盖范围的部分从 SQLite 请求记录补齐（不含调用方 API Key）
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	if h == nil || (h.store == nil && h.metricsStore == nil) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "使用量统计未启用（需启用计费或指标持久化）"})
+		return
+	}
+
+	groupBy, ok := usage.ParseGroupBy(c.Query("groupBy"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 groupBy（可选 key、model、day）"})
+		return
+	}
+	now := time.Now()
+	to, err := parseUsageTime(c.Query("to"), now, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseUsageTime(c.Query("from"), to.Add(-24*time.Hour), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from 必须早于 to"})
+		return
+	}
+
+	resp := UsageResponse{From: from, To: to, GroupBy: groupBy, Sources: []UsageSource{}}
+	groups := make(map[string]*usage.Totals)
+	merge := func(group string, totals usage.Totals) {
+		existing, ok := groups[group]
+		if !ok {
+			existing = &usage.Totals{}
+			groups[group] = existing
+		}
+		existing.Merge(totals)
+	}
+
+	// 内存记录覆盖 [coveredSince, now]，更早的部分回退到 SQLite
+	fallbackEnd := to
+	if h.store != nil {
+		coveredSince := h.store.CoveredSince()
+		if memFrom := maxTime(from, coveredSince); memFrom.Before(to) {
+			for group, totals := range h.store.Query(memFrom, to, groupBy) {
+				merge(group, *totals)
+			}
+			resp.Sources = append(resp.Sources, UsageSource{Source: "memory", From: memFrom, To: to})
+		}
+		fallbackEnd = minTime(to, coveredSince)
+	}
+
+	if from.Before(fallbackEnd) {
+		if h.metricsStore == nil {
+			resp.Incomplete = true
+		} else {
+			for _, apiType := range usageAPITypes {
+				buckets, err := h.metricsStore.QueryUsageBuckets(apiType, from, fallbackEnd, usageSQLiteBucket)
+				if err != nil {
+					log.Printf("[Usage-Query] 查询 SQLite 使用量失败 (%s): %v", apiType, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "查询使用量失败"})
+					return
+				}
+				for _, b := range buckets {
+					merge(usageSQLiteGroup(b, groupBy), usage.Totals{
+						Requests:                 b.RequestCount,
+						InputTokens:              b.InputTokens,
+						OutputTokens:             b.OutputTokens,
+						CacheCreationInputTokens: b.CacheCreationTokens,
+						CacheReadInputTokens:     b.CacheReadTokens,
+						CostCents:                b.CostCents,
+					})
+				}
+			}
+			resp.Sources = append(resp.Sources, UsageSource{Source: "sqlite", From: from, To: fallbackEnd})
+		}
+	}
+
+	resp.Groups = make([]UsageGroup, 0, len(groups))
+	for group, totals := range groups {
+		resp.Groups = append(resp.Groups, UsageGroup{Group: group, Totals: *totals})
+		resp.Total.Merge(*totals)
+	}
+	sort.Slice(resp.Groups, func(i, j int) bool {
+		a, b := resp.Groups[i], resp.Groups[j]
+		if groupBy != usage.GroupByDay && a.CostCents != b.CostCents {
+			return a.CostCents > b.CostCents
+		}
+		return a.Group < b.Group
+	})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func usageSQLiteGroup(b metrics.UsageBucket, groupBy usage.GroupBy) string {
+	switch groupBy {
+	case usage.GroupByModel:
+		return b.Model
+	case usage.GroupByDay:
+		return b.Start.Local().Format("2006-01-02")
+	default:
+		return usageUnattributedGroup
+	}
+}
+
+// parseUsageTime 解析 RFC3339 或本地日期；endOfDay 为 true 时日期取次日零点（包含当天）
+func parseUsageTime(raw string, fallback time.Time, endOfDay bool) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无效的时间: %s（支持 RFC3339 或 YYYY-MM-DD）", raw)
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/usage"
+	"github.com/gin-gonic/gin"
+)
+
+func performUsageRequest(t *testing.T, h *UsageHandler, query string) (*httptest.ResponseRecorder, UsageResponse) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/usage", h.GetUsage)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/usage"+query, nil))
+	var resp UsageResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Unmarshal: %v body=%s", err, w.Body.String())
+		}
+	}
+	return w, resp
+}
+
+func TestUsageHandler_Disabled(t *testing.T) {
+	w, _ := performUsageRequest(t, NewUsageHandler(nil, nil), "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestUsageHandler_InvalidParams(t *testing.T) {
+	h := NewUsageHandler(usage.NewStore(10), nil)
+	for _, query := range []string{"?groupBy=user", "?from=yesterday", "?from=2026-10-02&to=2026-10-01"} {
+		if w, _ := performUsageRequest(t, h, query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestUsageHandler_GroupByKeyFromMemory(t *testing.T) {
+	store := usage.NewStore(10)
+	now := time.Now()
+	store.Add(usage.Record{APIKey: "team-a", Model: "m1", InputTokens: 100, OutputTokens: 10, CacheReadInputTokens: 40, CostCents: 2, CreatedAt: now})
+	store.Add(usage.Record{APIKey: "team-a", Model: "m2", InputTokens: 50, OutputTokens: 5, CostCents: 1, CreatedAt: now})
+	store.Add(usage.Record{APIKey: "team-b", Model: "m1", InputTokens: 500, OutputTokens: 50, CostCents: 9, CreatedAt: now})
+
+	w, resp := performUsageRequest(t, NewUsageHandler(store, nil), "?groupBy=key&from="+now.Add(-time.Minute).Format(time.RFC3339))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	if len(resp.Groups) != 2 || resp.Groups[0].Group != "team-b" {
+		t.Fatalf("groups = %+v, want 按成本降序", resp.Groups)
+	}
+	if a := resp.Groups[1]; a.Requests != 2 || a.InputTokens != 150 || a.CacheReadInputTokens != 40 || a.CostCents != 3 {
+		t.Fatalf("team-a = %+v", a)
+	}
+	if resp.Total.Requests != 3 || resp.Total.CostCents != 12 {
+		t.Fatalf("total = %+v", resp.Total)
+	}
+	// 查询范围早于存储创建时间且未启用 SQLite：结果标记为不完整
+	if len(resp.Sources) != 1 || resp.Sources[0].Source != "memory" || !resp.Incomplete {
+		t.Fatalf("sources = %+v incomplete=%v", resp.Sources, resp.Incomplete)
+	}
+}
+
+func TestUsageHandler_FallsBackToSQLiteForOlderRange(t *testing.T) {
+	metricsStore, err := metrics.NewSQLiteStore(&metrics.SQLiteStoreConfig{DBPath: filepath.Join(t.TempDir(), "metrics.db"), RetentionDays: 3})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { _ = metricsStore.Close() })
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, r := range []metrics.PersistentRecord{
+		{MetricsKey: "k1", BaseURL: "https://a", KeyMask: "***", Timestamp: old, Success: true, InputTokens: 1000, OutputTokens: 100, Model: "m1", CostCents: 20, APIType: "messages"},
+		{MetricsKey: "k2", BaseURL: "https://b", KeyMask: "***", Timestamp: old, Success: true, InputTokens: 2000, OutputTokens: 200, Model: "m2", CostCents: 30, APIType: "responses"},
+		{MetricsKey: "k1", BaseURL: "https://a", KeyMask: "***", Timestamp: old, Success: false, Model: "m1", APIType: "messages"},
+	} {
+		metricsStore.AddRecord(r)
+	}
+	metricsStore.FlushNow()
+
+	store := usage.NewStore(10)
+	store.Add(usage.Record{APIKey: "team-a", Model: "m1", InputTokens: 10, OutputTokens: 1, CostCents: 1})
+
+	from := "?from=" + old.Add(-time.Hour).Format(time.RFC3339)
+	w, resp := performUsageRequest(t, NewUsageHandler(store, metricsStore), from+"&groupBy=model")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	byModel := map[string]UsageGroup{}
+	for _, g := range resp.Groups {
+		byModel[g.Group] = g
+	}
+	if m1 := byModel["m1"]; m1.Requests != 2 || m1.InputTokens != 1010 || m1.CostCents != 21 {
+		t.Fatalf("m1 = %+v（失败请求不计入）", m1)
+	}
+	if m2 := byModel["m2"]; m2.Requests != 1 || m2.InputTokens != 2000 {
+		t.Fatalf("m2 = %+v", m2)
+	}
+	if len(resp.Sources) != 2 || resp.Incomplete {
+		t.Fatalf("sources = %+v incomplete=%v", resp.Sources, resp.Incomplete)
+	}
+
+	// 按 key 分组时，SQLite 数据不含调用方 API Key
+	_, resp = performUsageRequest(t, NewUsageHandler(store, metricsStore), from+"&groupBy=key")
+	groups := map[string]int64{}
+	for _, g := range resp.Groups {
+		groups[g.Group] = g.Requests
+	}
+	if groups["team-a"] != 1 || groups[usageUnattributedGroup] != 2 {
+		t.Fatalf("groups = %v", groups)
+	}
+
+	// 无 SQLite 时标记结果不完整
+	_, resp = performUsageRequest(t, NewUsageHandler(store, nil), from)
+	if !resp.Incomplete || resp.Total.Requests != 1 {
+		t.Fatalf("incomplete=%v total=%+v", resp.Incomplete, resp.Total)
+	}
+}
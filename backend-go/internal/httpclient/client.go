@@ -3,21 +3,47 @@ package httpclient
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
 )
 
+// PoolConfig 上游连接池配置，零值字段使用内置默认值（标准/流式客户端默认值不同）
+type PoolConfig struct {
+	MaxIdleConns        int           // 所有主机的最大空闲连接数
+	MaxIdleConnsPerHost int           // 每个主机的最大空闲连接数
+	IdleConnTimeout     time.Duration // 空闲连接关闭前的保留时间
+	DisableHTTP2        bool          // 禁用 HTTP/2，仅使用 HTTP/1.1
+}
+
+const (
+	defaultStandardMaxIdleConns        = 100
+	defaultStandardMaxIdleConnsPerHost = 10
+	defaultStandardIdleConnTimeout     = 90 * time.Second
+	defaultStreamMaxIdleConns          = 200 // 流式连接池更大
+	defaultStreamMaxIdleConnsPerHost   = 20
+	defaultStreamIdleConnTimeout       = 120 * time.Second
+)
+
 // ClientManager HTTP 客户端管理器
+// 客户端（及其 Transport 连接池）按 TLS 校验、出站代理与超时配置缓存，配置相同的渠道共享同一连接池，
+// 发往同一上游主机的请求复用已建立的连接
 type ClientManager struct {
 	mu      sync.RWMutex
 	clients map[string]*http.Client
+	pool    PoolConfig
+
+	activityMu sync.RWMutex
+	lastUsed   map[string]time.Time // key: scheme://host，最近一次请求时间（用于连接保活判断空闲）
 }
 
 var globalManager = &ClientManager{
-	clients: make(map[string]*http.Client),
+	clients:  make(map[string]*http.Client),
+	lastUsed: make(map[string]time.Time),
 }
 
 // GetManager 获取全局客户端管理器
@@ -25,14 +51,71 @@ func GetManager() *ClientManager {
 	return globalManager
 }
 
+// SetPoolConfig 设置连接池配置（应在处理请求前调用）
+// 已创建的客户端会被丢弃并关闭其空闲连接，后续请求按新配置创建
+func (cm *ClientManager) SetPoolConfig(pool PoolConfig) {
+	cm.mu.Lock()
+	old := cm.clients
+	cm.pool = pool
+	cm.clients = make(map[string]*http.Client)
+	cm.mu.Unlock()
+
+	for _, client := range old {
+		client.CloseIdleConnections()
+	}
+}
+
+// PoolConfig 返回当前连接池配置
+func (cm *ClientManager) PoolConfig() PoolConfig {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.pool
+}
+
+// newTransport 按连接池配置创建 Transport，零值字段使用对应客户端类型的默认值（调用方需持有 cm.mu）
+func (cm *ClientManager) newTransport(stream bool) *http.Transport {
+	maxIdle, maxIdlePerHost, idleTimeout := defaultStandardMaxIdleConns, defaultStandardMaxIdleConnsPerHost, defaultStandardIdleConnTimeout
+	if stream {
+		maxIdle, maxIdlePerHost, idleTimeout = defaultStreamMaxIdleConns, defaultStreamMaxIdleConnsPerHost, defaultStreamIdleConnTimeout
+	}
+	if cm.pool.MaxIdleConns > 0 {
+		maxIdle = cm.pool.MaxIdleConns
+	}
+	if cm.pool.MaxIdleConnsPerHost > 0 {
+		maxIdlePerHost = cm.pool.MaxIdleConnsPerHost
+	}
+	if cm.pool.IdleConnTimeout > 0 {
+		idleTimeout = cm.pool.IdleConnTimeout
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:          maxIdle,
+		MaxIdleConnsPerHost:   maxIdlePerHost,
+		IdleConnTimeout:       idleTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     !cm.pool.DisableHTTP2,
+	}
+	if cm.pool.DisableHTTP2 {
+		// 非 nil 的空 TLSNextProto 阻止 ALPN 协商到 h2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport
+}
+
 // GetStandardClient 获取标准客户端（有超时，用于普通请求）
 // 注意：启用自动压缩让Go处理gzip，配合请求头清理确保正确解压
-func (cm *ClientManager) GetStandardClient(timeout time.Duration, insecure bool) *http.Client {
+// proxyURL 为渠道出站代理（http/https/socks5），为空表示直连
+func (cm *ClientManager) GetStandardClient(timeout time.Duration, insecure bool, proxyURL string) *http.Client {
 	// 从配置获取响应头超时时间
 	envConfig := config.NewEnvConfig()
-	responseHeaderTimeout := time.Duration(envConfig.ResponseHeaderTimeout) * time.Second
+	return cm.GetStandardClientWithTimeouts(timeout, time.Duration(envConfig.ResponseHeaderTimeout)*time.Second, 0, insecure, proxyURL)
+}
 
-	key := fmt.Sprintf("standard-%d-%t-%d", timeout, insecure, envConfig.ResponseHeaderTimeout)
+// GetStandardClientWithTimeouts 获取指定响应头超时与建立连接超时的标准客户端（用于按渠道/模型覆盖超时）
+// connectTimeout 为 0 时使用系统默认的连接超时
+func (cm *ClientManager) GetStandardClientWithTimeouts(timeout, responseHeaderTimeout, connectTimeout time.Duration, insecure bool, proxyURL string) *http.Client {
+	key := fmt.Sprintf("standard-%d-%t-%d-%d-%s", timeout, insecure, responseHeaderTimeout, connectTimeout, proxyURL)
 
 	cm.mu.RLock()
 	if client, ok := cm.clients[key]; ok {
@@ -49,23 +132,20 @@ func (cm *ClientManager) GetStandardClient(timeout time.Duration, insecure bool)
 		return client
 	}
 
-	transport := &http.Transport{
-		MaxIdleConns:          100,
-		MaxIdleConnsPerHost:   10,
-		IdleConnTimeout:       90 * time.Second,
-		DisableCompression:    false, // 启用自动压缩，让Go处理gzip
-		TLSHandshakeTimeout:   10 * time.Second,
-		ResponseHeaderTimeout: responseHeaderTimeout,
-		ExpectContinueTimeout: 1 * time.Second,
-		ForceAttemptHTTP2:     true,
-	}
+	transport := cm.newTransport(false)
+	transport.DisableCompression = false // 启用自动压缩，让Go处理gzip
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
 
 	if insecure {
 		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	if connectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	setTransportProxy(transport, proxyURL)
 
 	client := &http.Client{
-		Transport: transport,
+		Transport: &activityTransport{base: transport, manager: cm},
 		Timeout:   timeout,
 	}
 
@@ -74,12 +154,16 @@ func (cm *ClientManager) GetStandardClient(timeout time.Duration, insecure bool)
 }
 
 // GetStreamClient 获取流式客户端（无超时，用于 SSE 流式响应）
-func (cm *ClientManager) GetStreamClient(insecure bool) *http.Client {
+func (cm *ClientManager) GetStreamClient(insecure bool, proxyURL string) *http.Client {
 	// 从配置获取响应头超时时间
 	envConfig := config.NewEnvConfig()
-	responseHeaderTimeout := time.Duration(envConfig.ResponseHeaderTimeout) * time.Second
+	return cm.GetStreamClientWithTimeouts(time.Duration(envConfig.ResponseHeaderTimeout)*time.Second, 0, insecure, proxyURL)
+}
 
-	key := fmt.Sprintf("stream-%t-%d", insecure, envConfig.ResponseHeaderTimeout)
+// GetStreamClientWithTimeouts 获取指定响应头超时与建立连接超时的流式客户端（用于按渠道/模型覆盖超时）
+// connectTimeout 为 0 时使用系统默认的连接超时
+func (cm *ClientManager) GetStreamClientWithTimeouts(responseHeaderTimeout, connectTimeout time.Duration, insecure bool, proxyURL string) *http.Client {
+	key := fmt.Sprintf("stream-%t-%d-%d-%s", insecure, responseHeaderTimeout, connectTimeout, proxyURL)
 
 	cm.mu.RLock()
 	if client, ok := cm.clients[key]; ok {
@@ -96,26 +180,71 @@ func (cm *ClientManager) GetStreamClient(insecure bool) *http.Client {
 		return client
 	}
 
-	transport := &http.Transport{
-		MaxIdleConns:          200, // 流式连接池更大
-		MaxIdleConnsPerHost:   20,
-		IdleConnTimeout:       120 * time.Second,
-		DisableCompression:    true, // 流式响应禁用压缩
-		TLSHandshakeTimeout:   10 * time.Second,
-		ResponseHeaderTimeout: responseHeaderTimeout,
-		ExpectContinueTimeout: 1 * time.Second,
-		ForceAttemptHTTP2:     true,
-	}
+	transport := cm.newTransport(true)
+	transport.DisableCompression = true // 流式响应禁用压缩
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
 
 	if insecure {
 		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	if connectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	setTransportProxy(transport, proxyURL)
 
 	client := &http.Client{
-		Transport: transport,
+		Transport: &activityTransport{base: transport, manager: cm},
 		Timeout:   0, // 流式请求无超时
 	}
 
 	cm.clients[key] = client
 	return client
 }
+
+// setTransportProxy 为 Transport 设置出站代理（http/https/socks5 由 net/http 原生支持）
+// 代理地址在配置加载时已校验，解析失败时保持直连
+func setTransportProxy(transport *http.Transport, proxyURL string) {
+	if proxyURL == "" {
+		return
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return
+	}
+	transport.Proxy = http.ProxyURL(u)
+}
+
+// LastUsed 获取指定上游主机最近一次请求的时间（未请求过返回零值）
+// host 格式为 scheme://host[:port]，与 HostKey 返回值一致
+func (cm *ClientManager) LastUsed(host string) time.Time {
+	cm.activityMu.RLock()
+	defer cm.activityMu.RUnlock()
+	return cm.lastUsed[host]
+}
+
+func (cm *ClientManager) markUsed(host string, now time.Time) {
+	cm.activityMu.Lock()
+	cm.lastUsed[host] = now
+	cm.activityMu.Unlock()
+}
+
+// HostKey 返回 URL 对应的连接池主机标识（scheme://host[:port]）
+func HostKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// activityTransport 记录每个上游主机的最近请求时间，供连接保活判断空闲渠道
+type activityTransport struct {
+	base    *http.Transport
+	manager *ClientManager
+}
+
+func (t *activityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.manager.markUsed(HostKey(req.URL), time.Now())
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections 透传给底层 Transport（http.Client.CloseIdleConnections 依赖该方法）
+func (t *activityTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
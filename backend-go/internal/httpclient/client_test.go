@@ -0,0 +1,255 @@
+package httpclient
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func transportOf(t *testing.T, client *http.Client) *http.Transport {
+	t.Helper()
+	at, ok := client.Transport.(*activityTransport)
+	if !ok {
+		t.Fatalf("unexpected transport type %T", client.Transport)
+	}
+	return at.base
+}
+
+func TestGetClientWithTimeouts(t *testing.T) {
+	cm := &ClientManager{clients: make(map[string]*http.Client), lastUsed: make(map[string]time.Time)}
+
+	standard := cm.GetStandardClientWithTimeouts(2*time.Minute, time.Minute, 3*time.Second, false, "")
+	if standard.Timeout != 2*time.Minute {
+		t.Fatalf("Timeout = %v, want 2m", standard.Timeout)
+	}
+	transport := transportOf(t, standard)
+	if transport.ResponseHeaderTimeout != time.Minute || transport.DialContext == nil {
+		t.Fatalf("ResponseHeaderTimeout = %v, DialContext set = %v", transport.ResponseHeaderTimeout, transport.DialContext != nil)
+	}
+	if cm.GetStandardClientWithTimeouts(2*time.Minute, time.Minute, 3*time.Second, false, "") != standard {
+		t.Fatal("相同超时配置应复用客户端")
+	}
+	if cm.GetStandardClientWithTimeouts(2*time.Minute, time.Minute, 0, false, "") == standard {
+		t.Fatal("不同连接超时应使用不同客户端")
+	}
+
+	stream := cm.GetStreamClientWithTimeouts(30*time.Second, 0, false, "")
+	if stream.Timeout != 0 {
+		t.Fatalf("流式客户端不应设置整体超时，实际 %v", stream.Timeout)
+	}
+	if transport := transportOf(t, stream); transport.ResponseHeaderTimeout != 30*time.Second || transport.DialContext != nil {
+		t.Fatalf("未配置连接超时时应使用默认拨号")
+	}
+}
+
+func TestSetPoolConfig(t *testing.T) {
+	cm := &ClientManager{clients: make(map[string]*http.Client), lastUsed: make(map[string]time.Time)}
+
+	before := cm.GetStandardClientWithTimeouts(time.Minute, time.Minute, 0, false, "")
+	if transport := transportOf(t, before); transport.MaxIdleConnsPerHost != defaultStandardMaxIdleConnsPerHost || !transport.ForceAttemptHTTP2 {
+		t.Fatalf("默认配置不符: perHost=%d http2=%v", transport.MaxIdleConnsPerHost, transport.ForceAttemptHTTP2)
+	}
+	if transport := transportOf(t, cm.GetStreamClientWithTimeouts(time.Minute, 0, false, "")); transport.IdleConnTimeout != defaultStreamIdleConnTimeout {
+		t.Fatalf("流式客户端默认空闲超时 = %v", transport.IdleConnTimeout)
+	}
+
+	cm.SetPoolConfig(PoolConfig{MaxIdleConnsPerHost: 64, IdleConnTimeout: 30 * time.Second, DisableHTTP2: true})
+	after := cm.GetStandardClientWithTimeouts(time.Minute, time.Minute, 0, false, "")
+	if after == before {
+		t.Fatal("修改连接池配置后应创建新客户端")
+	}
+	transport := transportOf(t, after)
+	if transport.MaxIdleConnsPerHost != 64 || transport.IdleConnTimeout != 30*time.Second {
+		t.Fatalf("perHost=%d idle=%v", transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	if transport.MaxIdleConns != defaultStandardMaxIdleConns {
+		t.Fatalf("未配置的字段应使用默认值，MaxIdleConns = %d", transport.MaxIdleConns)
+	}
+	if transport.ForceAttemptHTTP2 || transport.TLSNextProto == nil {
+		t.Fatal("禁用 HTTP/2 时不应协商 h2")
+	}
+}
+
+// startSOCKS5Proxy 启动仅支持无认证 CONNECT 的最小 SOCKS5 代理，所有目标都转发到 backend，返回代理地址与收到的目标列表
+func startSOCKS5Proxy(t *testing.T, backend string) (string, func() []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	targets := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				// 协商：VER NMETHODS METHODS -> VER 0x00（无认证）
+				head := make([]byte, 2)
+				if _, err := io.ReadFull(conn, head); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, make([]byte, head[1])); err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte{5, 0})
+
+				// 请求：VER CMD RSV ATYP DST.ADDR DST.PORT
+				req := make([]byte, 4)
+				if _, err := io.ReadFull(conn, req); err != nil {
+					return
+				}
+				var host string
+				switch req[3] {
+				case 1:
+					addr := make([]byte, 4)
+					_, _ = io.ReadFull(conn, addr)
+					host = net.IP(addr).String()
+				case 3:
+					n := make([]byte, 1)
+					_, _ = io.ReadFull(conn, n)
+					name := make([]byte, n[0])
+					_, _ = io.ReadFull(conn, name)
+					host = string(name)
+				default:
+					return
+				}
+				port := make([]byte, 2)
+				_, _ = io.ReadFull(conn, port)
+				targets <- net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+
+				upstream, err := net.Dial("tcp", backend)
+				if err != nil {
+					_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go func() { _, _ = io.Copy(upstream, conn) }()
+				_, _ = io.Copy(conn, upstream)
+			}(conn)
+		}
+	}()
+
+	return "socks5://" + ln.Addr().String(), func() []string {
+		var got []string
+		for {
+			select {
+			case target := <-targets:
+				got = append(got, target)
+			default:
+				return got
+			}
+		}
+	}
+}
+
+func TestClientWithSOCKS5Proxy(t *testing.T) {
+	backend, _ := newConnCountingServer(t, false)
+	defer backend.Close()
+	proxyURL, targets := startSOCKS5Proxy(t, backend.Listener.Addr().String())
+
+	cm := &ClientManager{clients: make(map[string]*http.Client), lastUsed: make(map[string]time.Time)}
+	client := cm.GetStandardClientWithTimeouts(5*time.Second, 5*time.Second, 0, false, proxyURL)
+	if client == cm.GetStandardClientWithTimeouts(5*time.Second, 5*time.Second, 0, false, "") {
+		t.Fatal("不同代理配置应使用不同客户端")
+	}
+	if transportOf(t, client).Proxy == nil {
+		t.Fatal("配置代理后 Transport.Proxy 不应为空")
+	}
+
+	// 目标主机不可解析，只有经由代理（由代理解析域名）才能成功
+	for i := 0; i < 3; i++ {
+		doRequest(t, client, "http://upstream.invalid:8080/v1/messages")
+	}
+	got := targets()
+	if len(got) != 1 || got[0] != "upstream.invalid:8080" {
+		t.Fatalf("SOCKS5 代理收到的目标 = %v，want 复用同一条隧道", got)
+	}
+}
+
+// newConnCountingServer 返回统计新建 TCP 连接数的测试上游
+func newConnCountingServer(t testing.TB, useTLS bool) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var conns atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	if useTLS {
+		srv.StartTLS()
+	} else {
+		srv.Start()
+	}
+	return srv, &conns
+}
+
+func doRequest(tb testing.TB, client *http.Client, url string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		tb.Fatalf("request failed: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func TestStandardClientReusesConnections(t *testing.T) {
+	srv, conns := newConnCountingServer(t, false)
+	defer srv.Close()
+
+	cm := &ClientManager{clients: make(map[string]*http.Client), lastUsed: make(map[string]time.Time)}
+	for i := 0; i < 20; i++ {
+		doRequest(t, cm.GetStandardClientWithTimeouts(time.Minute, time.Minute, 0, false, ""), srv.URL)
+	}
+	if n := conns.Load(); n != 1 {
+		t.Fatalf("顺序请求同一上游应复用连接，新建连接数 = %d", n)
+	}
+}
+
+// BenchmarkUpstreamClient 对比复用连接池与每次请求新建 Transport 的开销
+//
+//	go test ./internal/httpclient -bench UpstreamClient -benchtime 2000x
+func BenchmarkUpstreamClient(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		tls  bool
+	}{{"http", false}, {"https", true}} {
+		b.Run(tc.name+"/pooled", func(b *testing.B) {
+			srv, conns := newConnCountingServer(b, tc.tls)
+			defer srv.Close()
+			cm := &ClientManager{clients: make(map[string]*http.Client), lastUsed: make(map[string]time.Time)}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				doRequest(b, cm.GetStandardClientWithTimeouts(time.Minute, time.Minute, 0, true, ""), srv.URL)
+			}
+			b.ReportMetric(float64(conns.Load()), "conns")
+		})
+
+		b.Run(tc.name+"/per-request", func(b *testing.B) {
+			srv, conns := newConnCountingServer(b, tc.tls)
+			defer srv.Close()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cm := &ClientManager{clients: make(map[string]*http.Client), lastUsed: make(map[string]time.Time)}
+				client := cm.GetStandardClientWithTimeouts(time.Minute, time.Minute, 0, true, "")
+				doRequest(b, client, srv.URL)
+				client.CloseIdleConnections()
+			}
+			b.ReportMetric(float64(conns.Load()), "conns")
+		})
+	}
+}
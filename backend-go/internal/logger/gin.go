@@ -0,0 +1,37 @@
+package logger
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GinJSONFormatter Gin 访问日志的 JSON 格式化函数（LOG_FORMAT=json 时使用）
+func GinJSONFormatter(params gin.LogFormatterParams) string {
+	entry := map[string]any{
+		"time":       params.TimeStamp.Format(time.RFC3339Nano),
+		"level":      "info",
+		"tag":        "GIN",
+		"msg":        params.Method + " " + params.Path,
+		"method":     params.Method,
+		"path":       params.Path,
+		"status":     params.StatusCode,
+		"latency_ms": params.Latency.Milliseconds(),
+		"client_ip":  params.ClientIP,
+	}
+	if params.StatusCode >= 500 {
+		entry["level"] = "error"
+	} else if params.StatusCode >= 400 {
+		entry["level"] = "warn"
+	}
+	// 键名与 middleware.RequestIDContextKey 一致（logger 不能依赖 middleware 包）
+	if id, ok := params.Keys["requestID"].(string); ok && id != "" {
+		entry["request_id"] = id
+	}
+	if params.ErrorMessage != "" {
+		entry["error"] = params.ErrorMessage
+	}
+	data, _ := json.Marshal(entry)
+	return string(data) + "\n"
+}
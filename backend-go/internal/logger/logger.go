@@ -26,6 +26,10 @@ type Config struct {
 	Compress bool
 	// 是否同时输出到控制台
 	Console bool
+	// 输出格式: text（默认）| json
+	Format string
+	// 结构化日志最低级别: error | warn | info | debug
+	Level string
 }
 
 // DefaultConfig 返回默认配置
@@ -38,6 +42,8 @@ func DefaultConfig() *Config {
 		MaxAge:     30, // 30 days
 		Compress:   true,
 		Console:    true,
+		Format:     FormatText,
+		Level:      "info",
 	}
 }
 
@@ -73,13 +79,20 @@ func Setup(cfg *Config) error {
 		writer = lumberLogger
 	}
 
-	// 设置标准库 log 的输出
-	log.SetOutput(writer)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+	// 设置标准库 log 的输出（JSON 模式下旧式文本日志同样转换为 JSON）
+	configureFormat(cfg.Format, writer)
+	SetLevel(cfg.Level)
 
-	log.Printf("[Logger-Init] 日志系统已初始化")
+	log.Printf("[Logger-Init] 日志系统已初始化 (格式: %s)", logFormatName(cfg.Format))
 	log.Printf("[Logger-Init] 日志文件: %s", logPath)
 	log.Printf("[Logger-Init] 轮转配置: 最大 %dMB, 保留 %d 个备份, %d 天", cfg.MaxSize, cfg.MaxBackups, cfg.MaxAge)
 
 	return nil
 }
+
+func logFormatName(format string) string {
+	if IsJSONFormat(format) {
+		return FormatJSON
+	}
+	return FormatText
+}
@@ -0,0 +1,187 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 日志输出格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// 日志级别（与 LOG_LEVEL 一致）
+const (
+	levelError = iota
+	levelWarn
+	levelInfo
+	levelDebug
+)
+
+var levelNames = map[string]int32{
+	"error": levelError,
+	"warn":  levelWarn,
+	"info":  levelInfo,
+	"debug": levelDebug,
+}
+
+var (
+	jsonMode atomic.Bool
+	minLevel atomic.Int32
+)
+
+func init() {
+	minLevel.Store(levelInfo)
+}
+
+// Field 结构化日志字段
+type Field struct {
+	Key   string
+	Value any
+}
+
+// F 创建结构化日志字段
+func F(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// SetLevel 设置结构化日志的最低级别（error | warn | info | debug，无效值按 info 处理）
+func SetLevel(level string) {
+	if l, ok := levelNames[strings.ToLower(level)]; ok {
+		minLevel.Store(l)
+		return
+	}
+	minLevel.Store(levelInfo)
+}
+
+// IsJSON 是否使用 JSON 格式输出日志
+func IsJSON() bool {
+	return jsonMode.Load()
+}
+
+// Debug 记录 debug 级别结构化日志
+func Debug(tag, msg string, fields ...Field) { write(levelDebug, "debug", tag, msg, fields) }
+
+// Info 记录 info 级别结构化日志
+func Info(tag, msg string, fields ...Field) { write(levelInfo, "info", tag, msg, fields) }
+
+// Warn 记录 warn 级别结构化日志
+func Warn(tag, msg string, fields ...Field) { write(levelWarn, "warn", tag, msg, fields) }
+
+// Error 记录 error 级别结构化日志
+func Error(tag, msg string, fields ...Field) { write(levelError, "error", tag, msg, fields) }
+
+// write 文本模式输出 "[Tag] msg key=value ..."；JSON 模式输出单行 JSON（字段与 level/tag/msg 同级）
+func write(level int32, levelName, tag, msg string, fields []Field) {
+	if level > minLevel.Load() {
+		return
+	}
+	if !jsonMode.Load() {
+		var b strings.Builder
+		b.WriteString("[")
+		b.WriteString(tag)
+		b.WriteString("] ")
+		b.WriteString(msg)
+		for _, f := range fields {
+			fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+		}
+		log.Print(b.String())
+		return
+	}
+
+	entry := make(map[string]any, len(fields)+4)
+	for _, f := range fields {
+		entry[f.Key] = f.Value
+	}
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = levelName
+	entry["tag"] = tag
+	entry["msg"] = msg
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]any{"time": entry["time"], "level": levelName, "tag": tag, "msg": msg, "error": err.Error()})
+	}
+	log.Print(string(line))
+}
+
+// jsonLineWriter 将标准库 log 输出的旧式文本行（"[Tag] 内容"）转换为 JSON 日志
+// 已是 JSON 的行（结构化日志）原样输出，保证两种调用方式的输出格式一致
+type jsonLineWriter struct {
+	out io.Writer
+}
+
+func (w *jsonLineWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	if strings.HasPrefix(line, "{") {
+		if _, err := io.WriteString(w.out, line+"\n"); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	tag, msg := splitTag(line)
+	entry := map[string]any{
+		"time":  time.Now().Format(time.RFC3339Nano),
+		"level": inferLevel(msg),
+		"msg":   msg,
+	}
+	if tag != "" {
+		entry["tag"] = tag
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.out.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// splitTag 拆分 "[Tag] 内容" 形式的日志行
+func splitTag(line string) (string, string) {
+	if !strings.HasPrefix(line, "[") {
+		return "", line
+	}
+	end := strings.Index(line, "]")
+	if end <= 1 {
+		return "", line
+	}
+	return line[1:end], strings.TrimSpace(line[end+1:])
+}
+
+// inferLevel 根据旧式日志内容推断级别（旧代码以 "警告:" / "错误:" 前缀区分）
+func inferLevel(msg string) string {
+	switch {
+	case strings.HasPrefix(msg, "错误") || strings.HasPrefix(msg, "Error"):
+		return "error"
+	case strings.HasPrefix(msg, "警告") || strings.HasPrefix(msg, "Warning"):
+		return "warn"
+	default:
+		return "info"
+	}
+}
+
+// configureFormat 按格式设置标准库 log 的输出（JSON 模式下时间戳由 JSON 字段提供）
+func configureFormat(format string, writer io.Writer) {
+	if IsJSONFormat(format) {
+		jsonMode.Store(true)
+		log.SetFlags(0)
+		log.SetOutput(&jsonLineWriter{out: writer})
+		return
+	}
+	jsonMode.Store(false)
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+	log.SetOutput(writer)
+}
+
+// IsJSONFormat 判断格式配置是否为 JSON（不区分大小写）
+func IsJSONFormat(format string) bool {
+	return strings.EqualFold(strings.TrimSpace(format), FormatJSON)
+}
@@ -0,0 +1,143 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withFormat 将标准库 log 重定向到缓冲区并设置格式，测试结束后恢复
+func withFormat(t *testing.T, format, level string) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	configureFormat(format, buf)
+	SetLevel(level)
+	t.Cleanup(func() {
+		configureFormat(FormatText, os.Stderr)
+		SetLevel("info")
+	})
+	return buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line is not JSON: %q (%v)", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestStructuredJSONOutput(t *testing.T) {
+	buf := withFormat(t, "JSON", "info")
+
+	Info("Messages-Key", "使用API密钥", F("channel", "primary"), F("key_mask", "sk-***abcd"), F("status", 200), F("latency_ms", int64(42)))
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d: %s", len(entries), buf.String())
+	}
+	e := entries[0]
+	if e["level"] != "info" || e["tag"] != "Messages-Key" || e["msg"] != "使用API密钥" {
+		t.Fatalf("unexpected entry: %v", e)
+	}
+	if e["channel"] != "primary" || e["key_mask"] != "sk-***abcd" || e["status"] != float64(200) || e["latency_ms"] != float64(42) {
+		t.Fatalf("fields missing: %v", e)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, e["time"].(string)); err != nil {
+		t.Fatalf("invalid time: %v", e["time"])
+	}
+}
+
+func TestStructuredFieldsCannotOverrideReservedKeys(t *testing.T) {
+	buf := withFormat(t, FormatJSON, "info")
+
+	Warn("Test", "real", F("msg", "fake"), F("level", "debug"))
+
+	e := decodeLines(t, buf)[0]
+	if e["msg"] != "real" || e["level"] != "warn" {
+		t.Fatalf("reserved keys overridden: %v", e)
+	}
+}
+
+func TestLegacyLinesConvertedToJSON(t *testing.T) {
+	buf := withFormat(t, FormatJSON, "info")
+
+	log.Printf("[Messages-Failover] 警告: 渠道 [%d] %s 所有密钥都失败", 0, "primary")
+	log.Printf("[Config] 错误: 保存失败")
+	log.Printf("无标签日志")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[0]["tag"] != "Messages-Failover" || entries[0]["level"] != "warn" || entries[0]["msg"] != "警告: 渠道 [0] primary 所有密钥都失败" {
+		t.Fatalf("unexpected legacy warn entry: %v", entries[0])
+	}
+	if entries[1]["level"] != "error" {
+		t.Fatalf("expected error level, got %v", entries[1])
+	}
+	if _, ok := entries[2]["tag"]; ok || entries[2]["msg"] != "无标签日志" {
+		t.Fatalf("unexpected untagged entry: %v", entries[2])
+	}
+}
+
+func TestStructuredLevelFiltering(t *testing.T) {
+	buf := withFormat(t, FormatJSON, "warn")
+
+	Debug("Test", "debug")
+	Info("Test", "info")
+	Warn("Test", "warn")
+	Error("Test", "error")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 || entries[0]["msg"] != "warn" || entries[1]["msg"] != "error" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+}
+
+func TestStructuredTextModeIsDefault(t *testing.T) {
+	buf := withFormat(t, "", "info")
+	log.SetFlags(0)
+
+	if IsJSON() {
+		t.Fatal("empty format should fall back to text")
+	}
+	Info("Messages-Key", "使用API密钥", F("channel", "primary"), F("status", 200))
+
+	if got := strings.TrimSpace(buf.String()); got != "[Messages-Key] 使用API密钥 channel=primary status=200" {
+		t.Fatalf("unexpected text output: %q", got)
+	}
+}
+
+func TestGinJSONFormatter(t *testing.T) {
+	line := GinJSONFormatter(gin.LogFormatterParams{
+		TimeStamp:  time.Now(),
+		StatusCode: 502,
+		Latency:    1500 * time.Millisecond,
+		ClientIP:   "10.0.0.1",
+		Method:     "POST",
+		Path:       "/v1/messages",
+	})
+
+	var e map[string]any
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		t.Fatalf("not JSON: %q", line)
+	}
+	if e["level"] != "error" || e["status"] != float64(502) || e["latency_ms"] != float64(1500) || e["path"] != "/v1/messages" || e["tag"] != "GIN" {
+		t.Fatalf("unexpected entry: %v", e)
+	}
+}
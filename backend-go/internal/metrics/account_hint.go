@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// accountHintHeaders 上游响应中可用于识别账号/组织的响应头（按优先级）
+var accountHintHeaders = []string{
+	"anthropic-organization-id",
+	"anthropic-organization",
+	"openai-organization",
+	"x-organization-id",
+}
+
+// maxAccountHintLength 账号标识最大长度，避免异常响应头撑大指标数据
+const maxAccountHintLength = 128
+
+// ExtractAccountHint 从上游响应头中提取账号/组织标识
+// 未找到时返回空字符串
+func ExtractAccountHint(header http.Header) string {
+	if header == nil {
+		return ""
+	}
+	for _, name := range accountHintHeaders {
+		if value := strings.TrimSpace(header.Get(name)); value != "" {
+			if len(value) > maxAccountHintLength {
+				value = value[:maxAccountHintLength]
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// RecordAccountHint 记录 Key 对应的账号/组织标识
+// 仅在首次成功响应时捕获，已有标识时不会覆盖
+func (m *MetricsManager) RecordAccountHint(baseURL, apiKey string, header http.Header) {
+	hint := ExtractAccountHint(header)
+	if hint == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metrics := m.getOrCreateKey(baseURL, apiKey)
+	if metrics.AccountHint != "" {
+		return
+	}
+	metrics.AccountHint = hint
+	log.Printf("[Metrics-Account] Key [%s] (%s) 关联账号: %s", metrics.KeyMask, metrics.BaseURL, hint)
+}
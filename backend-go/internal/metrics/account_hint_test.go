@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExtractAccountHint(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{name: "nil header", header: nil, want: ""},
+		{name: "no account header", header: http.Header{"Content-Type": []string{"application/json"}}, want: ""},
+		{name: "anthropic organization", header: http.Header{"Anthropic-Organization-Id": []string{" org-123 "}}, want: "org-123"},
+		{name: "openai organization", header: http.Header{"Openai-Organization": []string{"user-abc"}}, want: "user-abc"},
+		{
+			name: "anthropic takes precedence",
+			header: http.Header{
+				"Openai-Organization":       []string{"user-abc"},
+				"Anthropic-Organization-Id": []string{"org-123"},
+			},
+			want: "org-123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractAccountHint(tt.header); got != tt.want {
+				t.Errorf("ExtractAccountHint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractAccountHint_TruncatesLongValue(t *testing.T) {
+	header := http.Header{}
+	header.Set("anthropic-organization-id", strings.Repeat("x", maxAccountHintLength+10))
+	if got := ExtractAccountHint(header); len(got) != maxAccountHintLength {
+		t.Fatalf("len = %d, want %d", len(got), maxAccountHintLength)
+	}
+}
+
+func TestRecordAccountHint_KeepsFirstValue(t *testing.T) {
+	m := NewMetricsManager()
+	defer m.Stop()
+
+	baseURL := "https://api.example.com"
+	m.RecordAccountHint(baseURL, "k1", http.Header{})
+	if km := m.GetKeyMetrics(baseURL, "k1"); km != nil {
+		t.Fatalf("expected no metrics to be created without account header")
+	}
+
+	first := http.Header{}
+	first.Set("anthropic-organization-id", "org-a")
+	m.RecordAccountHint(baseURL, "k1", first)
+
+	second := http.Header{}
+	second.Set("anthropic-organization-id", "org-b")
+	m.RecordAccountHint(baseURL, "k1", second)
+
+	km := m.GetKeyMetrics(baseURL, "k1")
+	if km == nil || km.AccountHint != "org-a" {
+		t.Fatalf("AccountHint = %+v, want org-a", km)
+	}
+
+	resp := m.ToResponse(0, baseURL, []string{"k1"}, 0)
+	if len(resp.KeyMetrics) != 1 || resp.KeyMetrics[0].AccountHint != "org-a" {
+		t.Fatalf("unexpected response key metrics: %+v", resp.KeyMetrics)
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import "time"
+
+// BatchBindingRecord 批处理与创建渠道的持久化绑定
+// 出于安全考虑不保存 API key 明文，仅保存其 SHA-256 摘要，恢复时按摘要匹配渠道当前 key
+type BatchBindingRecord struct {
+	BatchID     string
+	ChannelName string
+	BaseURL     string
+	KeyHash     string
+	CreatedAt   time.Time
+}
+
+// LoadBatchBindings 加载创建时间不早于 since 的批处理绑定
+func (s *SQLiteStore) LoadBatchBindings(since time.Time) ([]BatchBindingRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT batch_id, channel_name, base_url, key_hash, created_at
+		FROM batch_bindings
+		WHERE created_at >= ?
+	`, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []BatchBindingRecord
+	for rows.Next() {
+		var r BatchBindingRecord
+		var createdAt int64
+		if err := rows.Scan(&r.BatchID, &r.ChannelName, &r.BaseURL, &r.KeyHash, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.UnixMilli(createdAt)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// SaveBatchBinding 写入批处理绑定（同一 batch_id 覆盖旧值）
+func (s *SQLiteStore) SaveBatchBinding(r BatchBindingRecord) error {
+	_, err := s.db.Exec(`
+		INSERT INTO batch_bindings (batch_id, channel_name, base_url, key_hash, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(batch_id) DO UPDATE SET
+			channel_name = excluded.channel_name,
+			base_url = excluded.base_url,
+			key_hash = excluded.key_hash,
+			created_at = excluded.created_at
+	`, r.BatchID, r.ChannelName, r.BaseURL, r.KeyHash, r.CreatedAt.UnixMilli())
+	return err
+}
+
+// CleanupBatchBindings 清理创建时间早于 before 的批处理绑定
+func (s *SQLiteStore) CleanupBatchBindings(before time.Time) (int64, error) {
+	result, err := s.db.Exec("DELETE FROM batch_bindings WHERE created_at < ?", before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSQLiteStore_BatchBindings(t *testing.T) {
+	dbPath := t.TempDir() + "/metrics.db"
+	store := newTraceAffinityTestStore(t, dbPath)
+
+	now := time.Now()
+	for _, r := range []BatchBindingRecord{
+		{BatchID: "msgbatch_a", ChannelName: "old", BaseURL: "https://a", KeyHash: "h0", CreatedAt: now.Add(-time.Minute)},
+		{BatchID: "msgbatch_b", ChannelName: "b", BaseURL: "https://b", KeyHash: "h2", CreatedAt: now.Add(-48 * time.Hour)},
+		// 重复写入同一 batch_id 应覆盖
+		{BatchID: "msgbatch_a", ChannelName: "a", BaseURL: "https://a", KeyHash: "h1", CreatedAt: now},
+	} {
+		if err := store.SaveBatchBinding(r); err != nil {
+			t.Fatalf("SaveBatchBinding(%s) err = %v", r.BatchID, err)
+		}
+	}
+	_ = store.Close()
+
+	// 重启后仍可恢复
+	store = newTraceAffinityTestStore(t, dbPath)
+	t.Cleanup(func() { _ = store.Close() })
+
+	records, err := store.LoadBatchBindings(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("LoadBatchBindings() err = %v", err)
+	}
+	if len(records) != 1 || records[0].BatchID != "msgbatch_a" || records[0].ChannelName != "a" || records[0].KeyHash != "h1" ||
+		records[0].CreatedAt.UnixMilli() != now.UnixMilli() {
+		t.Fatalf("records = %+v, want only msgbatch_a -> a", records)
+	}
+
+	cleaned, err := store.CleanupBatchBindings(now.Add(-24 * time.Hour))
+	if err != nil || cleaned != 1 {
+		t.Fatalf("CleanupBatchBindings() = %d, %v, want 1", cleaned, err)
+	}
+}
@@ -22,6 +22,7 @@ type RequestRecord struct {
 	OutputTokens             int64
 	CacheCreationInputTokens int64
 	CacheReadInputTokens     int64
+	ThinkingTokens           int64  // 扩展思考/推理 Token（已包含在 OutputTokens 中）
 	Model                    string // 模型名称
 	CostCents                int64  // 成本（美分）
 }
@@ -38,11 +39,20 @@ type KeyMetrics struct {
 	LastSuccessAt       *time.Time `json:"lastSuccessAt,omitempty"`
 	LastFailureAt       *time.Time `json:"lastFailureAt,omitempty"`
 	CircuitBrokenAt     *time.Time `json:"circuitBrokenAt,omitempty"` // 熔断开始时间
+	AccountHint         string     `json:"accountHint,omitempty"`     // 账号/组织标识（来自首次成功响应头）
+	AvgLatencyMs        float64    `json:"avgLatencyMs,omitempty"`    // 成功响应头延迟的指数移动平均（毫秒）
+	StreamRepairs       int64      `json:"streamRepairs,omitempty"`   // 流式事件序列修复次数（STREAM_REPAIR_MODE）
 	circuitBreaker      *CircuitBreaker
 	// 滑动窗口记录（最近 N 次请求的结果）
 	recentResults []bool // true=success, false=failure
 	// 带时间戳的请求记录（用于分时段统计，保留24小时）
 	requestHistory []RequestRecord
+	// 流式请求客户端取消统计
+	streamCancel StreamCancelStats
+	// 最近的熔断恢复耗时（从熔断打开到重新关闭）
+	recoveryDurations []time.Duration
+	// 流式请求的首 token 延迟与耗时记录（保留24小时）
+	streamTimings []streamTimingRecord
 }
 
 // ChannelMetrics 渠道聚合指标（用于 API 返回，兼容旧结构）
@@ -72,9 +82,16 @@ type TimeWindowStats struct {
 	OutputTokens        int64 `json:"outputTokens,omitempty"`
 	CacheCreationTokens int64 `json:"cacheCreationTokens,omitempty"`
 	CacheReadTokens     int64 `json:"cacheReadTokens,omitempty"`
+	// ThinkingTokens 扩展思考/推理 Token，已包含在 OutputTokens 中（按输出价格计费），单独列出便于核算
+	ThinkingTokens int64 `json:"thinkingTokens,omitempty"`
 	// CacheHitRate 缓存命中率（Token口径），范围 0-100
 	// 定义：cacheReadTokens / (cacheReadTokens + inputTokens) * 100
 	CacheHitRate float64 `json:"cacheHitRate,omitempty"`
+	// 流式时延统计（仅统计收到内容的成功流式请求）
+	StreamCount     int64   `json:"streamCount,omitempty"`
+	FirstTokenP50Ms int64   `json:"firstTokenP50Ms,omitempty"` // 首 token 延迟 p50（毫秒）
+	FirstTokenP95Ms int64   `json:"firstTokenP95Ms,omitempty"` // 首 token 延迟 p95（毫秒）
+	TokensPerSecond float64 `json:"tokensPerSecond,omitempty"` // 首 token 之后的平均生成速度
 }
 
 // MetricsManager 指标管理器
@@ -88,11 +105,31 @@ type MetricsManager struct {
 	recoveryThreshold   float64                // HalfOpen 恢复阈值（成功率）
 	stopCh              chan struct{}          // 用于停止清理 goroutine
 
+	// 熔断状态推进使用的时钟（nil 表示 time.Now，测试中可替换）
+	now func() time.Time
+
+	// 熔断退避配置（默认 maxBackoffMultiplier=1，即固定 OpenTimeout）
+	maxBackoffMultiplier int
+	backoffJitter        float64
+	cycleResetCooldown   time.Duration
+
+	// 过期 Key 指标清理阈值（超过该时长无活动的 Key 指标被清理，0 表示禁用清理）
+	staleKeyTTL time.Duration
+
 	// 持久化存储（可选）
 	store   PersistenceStore
 	apiType string // "messages" 或 "responses"
+
+	// 请求体大小直方图与超限拒绝统计（独立锁，零值可用）
+	requestBodySizes requestBodySizeTracker
+
+	// 实时指标订阅者（独立锁，零值可用）
+	subscribers metricsSubscribers
 }
 
+// DefaultStaleKeyTTL 默认过期 Key 指标清理阈值
+const DefaultStaleKeyTTL = 48 * time.Hour
+
 // NewMetricsManager 创建指标管理器
 func NewMetricsManager() *MetricsManager {
 	minReq := max(3, 10/2)
@@ -103,6 +140,7 @@ func NewMetricsManager() *MetricsManager {
 		circuitRecoveryTime: 15 * time.Minute, // 默认 OpenTimeout 15 分钟
 		minRequestThreshold: minReq,
 		recoveryThreshold:   0.8,
+		staleKeyTTL:         DefaultStaleKeyTTL,
 		stopCh:              make(chan struct{}),
 	}
 	// 启动后台熔断恢复任务
@@ -126,6 +164,7 @@ func NewMetricsManagerWithConfig(windowSize int, failureThreshold float64) *Metr
 		circuitRecoveryTime: 15 * time.Minute,
 		minRequestThreshold: minReq,
 		recoveryThreshold:   0.8,
+		staleKeyTTL:         DefaultStaleKeyTTL,
 		stopCh:              make(chan struct{}),
 	}
 	// 启动后台熔断恢复任务
@@ -149,6 +188,7 @@ func NewMetricsManagerWithPersistence(windowSize int, failureThreshold float64,
 		circuitRecoveryTime: 15 * time.Minute,
 		minRequestThreshold: minReq,
 		recoveryThreshold:   0.8,
+		staleKeyTTL:         DefaultStaleKeyTTL,
 		stopCh:              make(chan struct{}),
 		store:               store,
 		apiType:             apiType,
@@ -199,6 +239,7 @@ func (m *MetricsManager) loadFromStore() error {
 			OutputTokens:             r.OutputTokens,
 			CacheCreationInputTokens: r.CacheCreationTokens,
 			CacheReadInputTokens:     r.CacheReadTokens,
+			ThinkingTokens:           r.ThinkingTokens,
 			Model:                    r.Model,
 			CostCents:                r.CostCents,
 		})
@@ -250,14 +291,57 @@ func (m *MetricsManager) loadFromStore() error {
 
 func (m *MetricsManager) newCircuitBreaker() *CircuitBreaker {
 	cfg := CircuitBreakerConfig{
-		FailureThreshold:    m.failureThreshold,
-		MinRequestThreshold: m.minRequestThreshold,
-		OpenTimeout:         m.circuitRecoveryTime,
-		RecoveryThreshold:   m.recoveryThreshold,
+		FailureThreshold:     m.failureThreshold,
+		MinRequestThreshold:  m.minRequestThreshold,
+		OpenTimeout:          m.circuitRecoveryTime,
+		RecoveryThreshold:    m.recoveryThreshold,
+		MaxBackoffMultiplier: m.maxBackoffMultiplier,
+		BackoffJitter:        m.backoffJitter,
+		CycleResetCooldown:   m.cycleResetCooldown,
 	}
 	return NewCircuitBreaker(cfg)
 }
 
+// SetCircuitBackoff 设置熔断 OpenTimeout 的指数退避参数
+// maxMultiplier<=1 时保持固定 OpenTimeout；jitter 为退避抖动比例（0~1）；
+// cycleResetCooldown 为 Closed 持续多久后重置连续熔断周期计数（<=0 时默认等于 OpenTimeout）
+func (m *MetricsManager) SetCircuitBackoff(maxMultiplier int, jitter float64, cycleResetCooldown time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maxBackoffMultiplier = maxMultiplier
+	m.backoffJitter = jitter
+	m.cycleResetCooldown = cycleResetCooldown
+
+	// 同步到已存在的熔断器（保留当前状态与周期计数）
+	for _, metrics := range m.keyMetrics {
+		if metrics.circuitBreaker == nil {
+			continue
+		}
+		fresh := m.newCircuitBreaker()
+		metrics.circuitBreaker.cfg = fresh.cfg
+	}
+}
+
+// SetStaleKeyTTL 设置过期 Key 指标清理阈值
+// ttl=0 禁用清理（已删除密钥的指标将常驻内存直至重启）；负值视为无效配置，保持原值
+func (m *MetricsManager) SetStaleKeyTTL(ttl time.Duration) {
+	if ttl < 0 {
+		log.Printf("[Metrics-Cleanup] 警告: 过期 Key 指标清理阈值不能为负数 (%v)，保持 %v", ttl, m.GetStaleKeyTTL())
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.staleKeyTTL = ttl
+}
+
+// GetStaleKeyTTL 获取过期 Key 指标清理阈值（0 表示禁用清理）
+func (m *MetricsManager) GetStaleKeyTTL() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.staleKeyTTL
+}
+
 // getOrCreateKeyLocked 获取或创建 Key 指标（用于加载时，已知 metricsKey 和 keyMask）
 func (m *MetricsManager) getOrCreateKeyLocked(baseURL, metricsKey, keyMask string) *KeyMetrics {
 	if metrics, exists := m.keyMetrics[metricsKey]; exists {
@@ -274,6 +358,23 @@ func (m *MetricsManager) getOrCreateKeyLocked(baseURL, metricsKey, keyMask strin
 	return metrics
 }
 
+// nextProbeAt 返回熔断中 Key 的下一次探测时间（未熔断时返回 nil）
+func (k *KeyMetrics) nextProbeAt() *time.Time {
+	if k.circuitBreaker == nil {
+		return nil
+	}
+	return k.circuitBreaker.NextProbeAt()
+}
+
+// formatTimePtr 将时间格式化为 RFC3339 字符串指针（nil 时返回 nil）
+func formatTimePtr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
+
 // generateMetricsKey 生成指标键 hash(baseURL + apiKey)
 func generateMetricsKey(baseURL, apiKey string) string {
 	h := sha256.New()
@@ -303,6 +404,37 @@ func (m *MetricsManager) RecordSuccess(baseURL, apiKey string) {
 	m.RecordSuccessWithUsage(baseURL, apiKey, nil, "", 0)
 }
 
+// RecordStreamRepairs 记录 Key 的流式事件序列修复次数（用于识别输出畸形事件流的上游）
+func (m *MetricsManager) RecordStreamRepairs(baseURL, apiKey string, count int) {
+	if count <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.getOrCreateKey(baseURL, apiKey).StreamRepairs += int64(count)
+}
+
+// latencyEWMAAlpha 延迟指数移动平均的平滑系数
+const latencyEWMAAlpha = 0.2
+
+// RecordKeyLatency 记录 Key 收到成功响应头的延迟（指数移动平均，用于 adaptive 密钥选择）
+func (m *MetricsManager) RecordKeyLatency(baseURL, apiKey string, latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metrics := m.getOrCreateKey(baseURL, apiKey)
+	ms := float64(latency) / float64(time.Millisecond)
+	if metrics.AvgLatencyMs <= 0 {
+		metrics.AvgLatencyMs = ms
+		return
+	}
+	metrics.AvgLatencyMs += latencyEWMAAlpha * (ms - metrics.AvgLatencyMs)
+}
+
 // RecordSuccessWithUsage 记录成功请求（带 Usage 数据）
 func (m *MetricsManager) RecordSuccessWithUsage(baseURL, apiKey string, usage *types.Usage, model string, costCents int64) {
 	m.mu.Lock()
@@ -313,19 +445,23 @@ func (m *MetricsManager) RecordSuccessWithUsage(baseURL, apiKey string, usage *t
 	metrics.SuccessCount++
 	metrics.ConsecutiveFailures = 0
 
-	now := time.Now()
+	now := m.currentTime()
 	metrics.LastSuccessAt = &now
 
 	if metrics.circuitBreaker == nil {
 		metrics.circuitBreaker = m.newCircuitBreaker()
 	}
 	prevState := metrics.circuitBreaker.State()
+	trippedAt := metrics.circuitBreaker.TrippedAt()
 	metrics.circuitBreaker.RecordSuccess(now)
 	stateAfterRecord := metrics.circuitBreaker.State()
 
 	if prevState != CircuitClosed && stateAfterRecord == CircuitClosed {
 		// 熔断器从 HalfOpen/Open 恢复到 Closed：给滑动窗口一个干净起点，避免立刻反复开关。
 		metrics.recentResults = make([]bool, 0, m.windowSize)
+		if trippedAt != nil {
+			recordCircuitRecovery(metrics, now.Sub(*trippedAt))
+		}
 		log.Printf("[Metrics-Circuit] Key [%s] (%s) 退出熔断状态", metrics.KeyMask, metrics.BaseURL)
 	}
 
@@ -350,10 +486,11 @@ func (m *MetricsManager) RecordSuccessWithUsage(baseURL, apiKey string, usage *t
 	}
 
 	// 提取 Token 数据（如果有）
-	var inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens int64
+	var inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens, thinkingTokens int64
 	if usage != nil {
 		inputTokens = int64(usage.InputTokens)
 		outputTokens = int64(usage.OutputTokens)
+		thinkingTokens = int64(usage.ThinkingTokens)
 		// cache_creation_input_tokens 有时不会返回（只返回 5m/1h 细分字段），这里做兜底汇总。
 		cacheCreationTokens = int64(usage.CacheCreationInputTokens)
 		if cacheCreationTokens <= 0 {
@@ -363,7 +500,8 @@ func (m *MetricsManager) RecordSuccessWithUsage(baseURL, apiKey string, usage *t
 	}
 
 	// 记录带时间戳的请求
-	m.appendToHistoryKeyWithUsage(metrics, now, true, inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens, model, costCents)
+	m.appendToHistoryKeyWithUsage(metrics, now, true, inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens, thinkingTokens, model, costCents)
+	m.publishEvent(metrics, true, prevState, now)
 
 	// 写入持久化存储（异步，不阻塞）
 	if m.store != nil {
@@ -377,6 +515,7 @@ func (m *MetricsManager) RecordSuccessWithUsage(baseURL, apiKey string, usage *t
 			OutputTokens:        outputTokens,
 			CacheCreationTokens: cacheCreationTokens,
 			CacheReadTokens:     cacheReadTokens,
+			ThinkingTokens:      thinkingTokens,
 			Model:               model,
 			CostCents:           costCents,
 			APIType:             m.apiType,
@@ -394,7 +533,7 @@ func (m *MetricsManager) RecordFailure(baseURL, apiKey string) {
 	metrics.FailureCount++
 	metrics.ConsecutiveFailures++
 
-	now := time.Now()
+	now := m.currentTime()
 	metrics.LastFailureAt = &now
 
 	// 更新滑动窗口
@@ -421,6 +560,7 @@ func (m *MetricsManager) RecordFailure(baseURL, apiKey string) {
 
 	// 记录带时间戳的请求
 	m.appendToHistoryKey(metrics, now, false)
+	m.publishEvent(metrics, false, prevState, now)
 
 	// 写入持久化存储（异步，不阻塞）
 	if m.store != nil {
@@ -464,11 +604,11 @@ func (m *MetricsManager) appendToWindowKey(metrics *KeyMetrics, success bool) {
 
 // appendToHistoryKey 向 Key 历史记录添加请求（保留24小时）
 func (m *MetricsManager) appendToHistoryKey(metrics *KeyMetrics, timestamp time.Time, success bool) {
-	m.appendToHistoryKeyWithUsage(metrics, timestamp, success, 0, 0, 0, 0, "", 0)
+	m.appendToHistoryKeyWithUsage(metrics, timestamp, success, 0, 0, 0, 0, 0, "", 0)
 }
 
 // appendToHistoryKeyWithUsage 向 Key 历史记录添加请求（带 Usage 数据）
-func (m *MetricsManager) appendToHistoryKeyWithUsage(metrics *KeyMetrics, timestamp time.Time, success bool, inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens int64, model string, costCents int64) {
+func (m *MetricsManager) appendToHistoryKeyWithUsage(metrics *KeyMetrics, timestamp time.Time, success bool, inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens, thinkingTokens int64, model string, costCents int64) {
 	metrics.requestHistory = append(metrics.requestHistory, RequestRecord{
 		Timestamp:                timestamp,
 		Success:                  success,
@@ -476,6 +616,7 @@ func (m *MetricsManager) appendToHistoryKeyWithUsage(metrics *KeyMetrics, timest
 		OutputTokens:             outputTokens,
 		CacheCreationInputTokens: cacheCreationTokens,
 		CacheReadInputTokens:     cacheReadTokens,
+		ThinkingTokens:           thinkingTokens,
 		Model:                    model,
 		CostCents:                costCents,
 	})
@@ -597,6 +738,22 @@ func (m *MetricsManager) CalculateKeyFailureRate(baseURL, apiKey string) float64
 	return m.calculateKeyFailureRateInternal(metrics)
 }
 
+// GetChannelSuccessCount 获取渠道所有 BaseURL × Key 的累计成功请求数
+func (m *MetricsManager) GetChannelSuccessCount(baseURLs []string, activeKeys []string) int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total int64
+	for _, baseURL := range baseURLs {
+		for _, apiKey := range activeKeys {
+			if metrics, exists := m.keyMetrics[generateMetricsKey(baseURL, apiKey)]; exists {
+				total += metrics.SuccessCount
+			}
+		}
+	}
+	return total
+}
+
 // CalculateChannelFailureRate 计算渠道聚合失败率
 func (m *MetricsManager) CalculateChannelFailureRate(baseURL string, activeKeys []string) float64 {
 	if len(activeKeys) == 0 {
@@ -647,6 +804,9 @@ func (m *MetricsManager) GetKeyMetrics(baseURL, apiKey string) *KeyMetrics {
 			LastSuccessAt:       metrics.LastSuccessAt,
 			LastFailureAt:       metrics.LastFailureAt,
 			CircuitBrokenAt:     metrics.CircuitBrokenAt,
+			AccountHint:         metrics.AccountHint,
+			AvgLatencyMs:        metrics.AvgLatencyMs,
+			StreamRepairs:       metrics.StreamRepairs,
 		}
 	}
 	return nil
@@ -888,6 +1048,7 @@ func (m *MetricsManager) GetAllKeyMetrics() []*KeyMetrics {
 			LastSuccessAt:       metrics.LastSuccessAt,
 			LastFailureAt:       metrics.LastFailureAt,
 			CircuitBrokenAt:     metrics.CircuitBrokenAt,
+			AccountHint:         metrics.AccountHint,
 		})
 	}
 	return result
@@ -923,12 +1084,36 @@ func (m *MetricsManager) GetTimeWindowStatsForKey(baseURL, apiKey string, durati
 		successRate = float64(successCount) / float64(requestCount) * 100
 	}
 
-	return TimeWindowStats{
+	stats := TimeWindowStats{
 		RequestCount: requestCount,
 		SuccessCount: successCount,
 		FailureCount: failureCount,
 		SuccessRate:  successRate,
 	}
+	var latency streamLatencyAccumulator
+	latency.add(metrics.streamTimings, cutoff)
+	latency.apply(&stats)
+	return stats
+}
+
+// GetKeyUsageSince 获取 Key 自指定时间以来的请求数（含失败）与 Token 用量（输入 + 输出），用于每日配额
+// 基于最近 24 小时的请求历史统计
+func (m *MetricsManager) GetKeyUsageSince(baseURL, apiKey string, since time.Time) (requests, tokens int64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	metrics, exists := m.keyMetrics[generateMetricsKey(baseURL, apiKey)]
+	if !exists {
+		return 0, 0
+	}
+	for _, record := range metrics.requestHistory {
+		if record.Timestamp.Before(since) {
+			continue
+		}
+		requests++
+		tokens += record.InputTokens + record.OutputTokens
+	}
+	return requests, tokens
 }
 
 // GetAllTimeWindowStatsForKey 获取单个 Key 所有时间窗口的统计
@@ -941,12 +1126,12 @@ func (m *MetricsManager) GetAllTimeWindowStatsForKey(baseURL, apiKey string) map
 	}
 }
 
-// ResetKey 重置单个 Key 的指标
-func (m *MetricsManager) ResetKey(baseURL, apiKey string) {
+// ResetKey 重置单个 Key 的指标，返回指标键以及该键是否存在并被重置
+func (m *MetricsManager) ResetKey(baseURL, apiKey string) (metricsKey string, reset bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	metricsKey := generateMetricsKey(baseURL, apiKey)
+	metricsKey = generateMetricsKey(baseURL, apiKey)
 	if metrics, exists := m.keyMetrics[metricsKey]; exists {
 		// 完全重置所有字段
 		metrics.RequestCount = 0
@@ -959,8 +1144,11 @@ func (m *MetricsManager) ResetKey(baseURL, apiKey string) {
 		metrics.circuitBreaker = m.newCircuitBreaker()
 		metrics.recentResults = make([]bool, 0, m.windowSize)
 		metrics.requestHistory = nil
+		metrics.streamTimings = nil
 		log.Printf("[Metrics-Reset] Key [%s] (%s) 指标已完全重置", metrics.KeyMask, metrics.BaseURL)
+		reset = true
 	}
+	return metricsKey, reset
 }
 
 // ResetAll 重置所有指标
@@ -974,6 +1162,7 @@ func (m *MetricsManager) ResetAll() {
 // Stop 停止后台清理任务
 func (m *MetricsManager) Stop() {
 	close(m.stopCh)
+	m.subscribers.closeAll()
 }
 
 // cleanupCircuitBreakers 后台任务：定期推进熔断状态（Open->HalfOpen），清理过期指标
@@ -1002,13 +1191,14 @@ func (m *MetricsManager) recoverExpiredCircuitBreakers() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	now := time.Now()
+	now := m.currentTime()
 	for _, metrics := range m.keyMetrics {
 		// 兼容旧状态：历史上可能仅设置了 CircuitBrokenAt。
 		if metrics.circuitBreaker == nil && metrics.CircuitBrokenAt != nil {
 			metrics.circuitBreaker = m.newCircuitBreaker()
 			metrics.circuitBreaker.state = CircuitOpen
 			metrics.circuitBreaker.openedAt = metrics.CircuitBrokenAt
+			metrics.circuitBreaker.trippedAt = metrics.CircuitBrokenAt
 		}
 		if metrics.circuitBreaker == nil {
 			continue
@@ -1023,13 +1213,16 @@ func (m *MetricsManager) recoverExpiredCircuitBreakers() {
 	}
 }
 
-// cleanupStaleKeys 清理过期的 Key 指标（超过 48 小时无活动）
+// cleanupStaleKeys 清理过期的 Key 指标（超过 staleKeyTTL 无活动，默认 48 小时；staleKeyTTL=0 时不清理）
 func (m *MetricsManager) cleanupStaleKeys() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	now := time.Now()
-	staleThreshold := 48 * time.Hour
+	staleThreshold := m.staleKeyTTL
+	if staleThreshold <= 0 {
+		return
+	}
+	now := m.currentTime()
 	var removed []string
 
 	for key, metrics := range m.keyMetrics {
@@ -1097,6 +1290,9 @@ type KeyMetricsResponse struct {
 	SuccessRate         float64 `json:"successRate"`
 	ConsecutiveFailures int64   `json:"consecutiveFailures"`
 	CircuitBroken       bool    `json:"circuitBroken"`
+	AccountHint         string  `json:"accountHint,omitempty"`   // 账号/组织标识
+	NextProbeAt         *string `json:"nextProbeAt,omitempty"`   // 熔断中：下一次探测时间
+	StreamRepairs       int64   `json:"streamRepairs,omitempty"` // 流式事件序列修复次数
 }
 
 // ToResponseMultiURL 转换为 API 响应格式（支持多 BaseURL 聚合）
@@ -1134,6 +1330,9 @@ func (m *MetricsManager) ToResponseMultiURL(channelIndex int, baseURLs []string,
 		failureCount        int64
 		consecutiveFailures int64
 		circuitBroken       bool
+		accountHint         string
+		nextProbeAt         *time.Time
+		streamRepairs       int64
 	}
 	keyAggMap := make(map[string]*keyAggregation) // key: apiKey
 
@@ -1170,12 +1369,19 @@ func (m *MetricsManager) ToResponseMultiURL(channelIndex int, baseURLs []string,
 					agg.requestCount += metrics.RequestCount
 					agg.successCount += metrics.SuccessCount
 					agg.failureCount += metrics.FailureCount
+					agg.streamRepairs += metrics.StreamRepairs
 					if metrics.ConsecutiveFailures > agg.consecutiveFailures {
 						agg.consecutiveFailures = metrics.ConsecutiveFailures
 					}
 					if metrics.CircuitBrokenAt != nil {
 						agg.circuitBroken = true
 					}
+					if agg.accountHint == "" {
+						agg.accountHint = metrics.AccountHint
+					}
+					if probeAt := metrics.nextProbeAt(); probeAt != nil && (agg.nextProbeAt == nil || probeAt.Before(*agg.nextProbeAt)) {
+						agg.nextProbeAt = probeAt
+					}
 				} else {
 					keyAggMap[apiKey] = &keyAggregation{
 						keyMask:             metrics.KeyMask,
@@ -1184,6 +1390,9 @@ func (m *MetricsManager) ToResponseMultiURL(channelIndex int, baseURLs []string,
 						failureCount:        metrics.FailureCount,
 						consecutiveFailures: metrics.ConsecutiveFailures,
 						circuitBroken:       metrics.CircuitBrokenAt != nil,
+						accountHint:         metrics.AccountHint,
+						nextProbeAt:         metrics.nextProbeAt(),
+						streamRepairs:       metrics.StreamRepairs,
 					}
 				}
 			}
@@ -1206,6 +1415,9 @@ func (m *MetricsManager) ToResponseMultiURL(channelIndex int, baseURLs []string,
 				SuccessRate:         keySuccessRate,
 				ConsecutiveFailures: agg.consecutiveFailures,
 				CircuitBroken:       agg.circuitBroken,
+				AccountHint:         agg.accountHint,
+				NextProbeAt:         formatTimePtr(agg.nextProbeAt),
+				StreamRepairs:       agg.streamRepairs,
 			})
 		}
 	}
@@ -1305,6 +1517,8 @@ func (m *MetricsManager) ToResponse(channelIndex int, baseURL string, activeKeys
 				SuccessRate:         keySuccessRate,
 				ConsecutiveFailures: metrics.ConsecutiveFailures,
 				CircuitBroken:       metrics.CircuitBrokenAt != nil,
+				AccountHint:         metrics.AccountHint,
+				NextProbeAt:         formatTimePtr(metrics.nextProbeAt()),
 			})
 		}
 	}
@@ -1363,7 +1577,9 @@ func (m *MetricsManager) calculateAggregatedTimeWindowsInternal(baseURL string,
 	for label, duration := range windows {
 		cutoff := now.Add(-duration)
 		var requestCount, successCount, failureCount int64
-		var inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens int64
+		var inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens, thinkingTokens int64
+
+		var latency streamLatencyAccumulator
 
 		for _, apiKey := range activeKeys {
 			metricsKey := generateMetricsKey(baseURL, apiKey)
@@ -1380,8 +1596,10 @@ func (m *MetricsManager) calculateAggregatedTimeWindowsInternal(baseURL string,
 						outputTokens += record.OutputTokens
 						cacheCreationTokens += record.CacheCreationInputTokens
 						cacheReadTokens += record.CacheReadInputTokens
+						thinkingTokens += record.ThinkingTokens
 					}
 				}
+				latency.add(metrics.streamTimings, cutoff)
 			}
 		}
 
@@ -1396,7 +1614,7 @@ func (m *MetricsManager) calculateAggregatedTimeWindowsInternal(baseURL string,
 			cacheHitRate = float64(cacheReadTokens) / float64(denom) * 100
 		}
 
-		result[label] = TimeWindowStats{
+		stats := TimeWindowStats{
 			RequestCount:        requestCount,
 			SuccessCount:        successCount,
 			FailureCount:        failureCount,
@@ -1405,8 +1623,11 @@ func (m *MetricsManager) calculateAggregatedTimeWindowsInternal(baseURL string,
 			OutputTokens:        outputTokens,
 			CacheCreationTokens: cacheCreationTokens,
 			CacheReadTokens:     cacheReadTokens,
+			ThinkingTokens:      thinkingTokens,
 			CacheHitRate:        cacheHitRate,
 		}
+		latency.apply(&stats)
+		result[label] = stats
 	}
 
 	return result
@@ -1427,7 +1648,9 @@ func (m *MetricsManager) calculateAggregatedTimeWindowsMultiURL(baseURLs []strin
 	for label, duration := range windows {
 		cutoff := now.Add(-duration)
 		var requestCount, successCount, failureCount int64
-		var inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens int64
+		var inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens, thinkingTokens int64
+
+		var latency streamLatencyAccumulator
 
 		// 遍历所有 BaseURL 和 Key 的组合
 		for _, baseURL := range baseURLs {
@@ -1446,8 +1669,10 @@ func (m *MetricsManager) calculateAggregatedTimeWindowsMultiURL(baseURLs []strin
 							outputTokens += record.OutputTokens
 							cacheCreationTokens += record.CacheCreationInputTokens
 							cacheReadTokens += record.CacheReadInputTokens
+							thinkingTokens += record.ThinkingTokens
 						}
 					}
+					latency.add(metrics.streamTimings, cutoff)
 				}
 			}
 		}
@@ -1463,7 +1688,7 @@ func (m *MetricsManager) calculateAggregatedTimeWindowsMultiURL(baseURLs []strin
 			cacheHitRate = float64(cacheReadTokens) / float64(denom) * 100
 		}
 
-		result[label] = TimeWindowStats{
+		stats := TimeWindowStats{
 			RequestCount:        requestCount,
 			SuccessCount:        successCount,
 			FailureCount:        failureCount,
@@ -1472,13 +1697,95 @@ func (m *MetricsManager) calculateAggregatedTimeWindowsMultiURL(baseURLs []strin
 			OutputTokens:        outputTokens,
 			CacheCreationTokens: cacheCreationTokens,
 			CacheReadTokens:     cacheReadTokens,
+			ThinkingTokens:      thinkingTokens,
 			CacheHitRate:        cacheHitRate,
 		}
+		latency.apply(&stats)
+		result[label] = stats
 	}
 
 	return result
 }
 
+// GetChannelCacheHitRate 获取渠道最近 window 内的提示缓存命中率（Token 口径，0-100）
+// ok=false 表示窗口内没有输入 token，无法判断命中率
+func (m *MetricsManager) GetChannelCacheHitRate(baseURLs []string, activeKeys []string, window time.Duration) (hitRate float64, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cutoff := time.Now().Add(-window)
+	var inputTokens, cacheReadTokens int64
+	for _, baseURL := range baseURLs {
+		for _, apiKey := range activeKeys {
+			metrics, exists := m.keyMetrics[generateMetricsKey(baseURL, apiKey)]
+			if !exists {
+				continue
+			}
+			for _, record := range metrics.requestHistory {
+				if record.Timestamp.After(cutoff) {
+					inputTokens += record.InputTokens
+					cacheReadTokens += record.CacheReadInputTokens
+				}
+			}
+		}
+	}
+
+	denom := cacheReadTokens + inputTokens
+	if denom <= 0 {
+		return 0, false
+	}
+	return float64(cacheReadTokens) / float64(denom) * 100, true
+}
+
+// ChannelHealthStats 渠道在时间窗口内的健康统计（用于按健康度排序渠道）
+type ChannelHealthStats struct {
+	RequestCount int64   `json:"requestCount"`
+	SuccessRate  float64 `json:"successRate"`  // 0-100，窗口内无请求时为 100
+	AvgLatencyMs float64 `json:"avgLatencyMs"` // 各 Key 成功响应头延迟（EWMA）按窗口内请求数加权平均，无数据时为 0
+}
+
+// GetChannelHealthStats 获取渠道最近 window 内的请求数、成功率与平均延迟（覆盖所有 BaseURL 与 Key）
+func (m *MetricsManager) GetChannelHealthStats(baseURLs []string, activeKeys []string, window time.Duration) ChannelHealthStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cutoff := time.Now().Add(-window)
+	var requestCount, successCount int64
+	var latencySum float64
+	var latencyWeight int64
+	for _, baseURL := range baseURLs {
+		for _, apiKey := range activeKeys {
+			metrics, exists := m.keyMetrics[generateMetricsKey(baseURL, apiKey)]
+			if !exists {
+				continue
+			}
+			var keyRequests int64
+			for _, record := range metrics.requestHistory {
+				if record.Timestamp.After(cutoff) {
+					keyRequests++
+					if record.Success {
+						successCount++
+					}
+				}
+			}
+			requestCount += keyRequests
+			if metrics.AvgLatencyMs > 0 && keyRequests > 0 {
+				latencySum += metrics.AvgLatencyMs * float64(keyRequests)
+				latencyWeight += keyRequests
+			}
+		}
+	}
+
+	stats := ChannelHealthStats{RequestCount: requestCount, SuccessRate: 100}
+	if requestCount > 0 {
+		stats.SuccessRate = float64(successCount) / float64(requestCount) * 100
+	}
+	if latencyWeight > 0 {
+		stats.AvgLatencyMs = latencySum / float64(latencyWeight)
+	}
+	return stats
+}
+
 // ============ 废弃的旧方法（保留签名以便编译，但标记为废弃）============
 
 // Deprecated: 使用 IsChannelHealthyWithKeys 代替
@@ -1549,7 +1856,7 @@ func (m *MetricsManager) ShouldSuspendKey(baseURL, apiKey string) bool {
 		metrics.circuitBreaker = m.newCircuitBreaker()
 	}
 
-	now := time.Now()
+	now := m.currentTime()
 	allowed := metrics.circuitBreaker.ShouldAllow(now)
 
 	if metrics.circuitBreaker.State() == CircuitClosed {
@@ -1561,6 +1868,43 @@ func (m *MetricsManager) ShouldSuspendKey(baseURL, apiKey string) bool {
 	return !allowed
 }
 
+// GetChannelCircuitState 获取渠道在指定 Key 集合上的聚合熔断状态（只读，不推进状态机）
+// 所有 Key 均为 Open 时返回 Open；部分 Key 熔断或处于 HalfOpen 时返回 HalfOpen；否则返回 Closed
+func (m *MetricsManager) GetChannelCircuitState(baseURL string, activeKeys []string) CircuitState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state, _ := m.channelCircuitStateLocked(baseURL, activeKeys)
+	return state
+}
+
+// channelCircuitStateLocked 计算聚合熔断状态与熔断中（Open/HalfOpen）的 Key 数，调用方需持有 m.mu
+func (m *MetricsManager) channelCircuitStateLocked(baseURL string, activeKeys []string) (CircuitState, int) {
+	openCount, brokenCount := 0, 0
+	for _, apiKey := range activeKeys {
+		metrics, exists := m.keyMetrics[generateMetricsKey(baseURL, apiKey)]
+		if !exists || metrics.circuitBreaker == nil {
+			continue
+		}
+		switch metrics.circuitBreaker.State() {
+		case CircuitOpen:
+			openCount++
+			brokenCount++
+		case CircuitHalfOpen:
+			brokenCount++
+		}
+	}
+
+	switch {
+	case len(activeKeys) > 0 && openCount == len(activeKeys):
+		return CircuitOpen, brokenCount
+	case brokenCount > 0:
+		return CircuitHalfOpen, brokenCount
+	default:
+		return CircuitClosed, brokenCount
+	}
+}
+
 // ============ 历史数据查询方法（用于图表可视化）============
 
 // HistoryDataPoint 历史数据点（用于时间序列图表）
@@ -1747,7 +2091,7 @@ func (m *MetricsManager) GetHistoricalStatsMultiURLWithWarning(baseURLs []string
 		return m.GetHistoricalStatsMultiURL(baseURLs, activeKeys, duration, interval), ""
 	}
 
-	store, ok := m.store.(*SQLiteStore)
+	store, ok := asSQLiteStore(m.store)
 	if !ok || store == nil {
 		return m.GetHistoricalStatsMultiURL(baseURLs, activeKeys, 24*time.Hour, interval), "指标持久化未启用，已降级为最近 24h 数据"
 	}
@@ -1900,7 +2244,7 @@ func (m *MetricsManager) GetHistoricalStatsWithWarning(baseURL string, activeKey
 		return m.GetHistoricalStats(baseURL, activeKeys, duration, interval), ""
 	}
 
-	store, ok := m.store.(*SQLiteStore)
+	store, ok := asSQLiteStore(m.store)
 	if !ok || store == nil {
 		return m.GetHistoricalStats(baseURL, activeKeys, 24*time.Hour, interval), "指标持久化未启用，已降级为最近 24h 数据"
 	}
@@ -2307,7 +2651,7 @@ func (m *MetricsManager) GetKeyHistoricalStatsMultiURLWithWarning(baseURLs []str
 		return m.GetKeyHistoricalStatsMultiURL(baseURLs, apiKey, duration, interval), ""
 	}
 
-	store, ok := m.store.(*SQLiteStore)
+	store, ok := asSQLiteStore(m.store)
 	if !ok || store == nil {
 		return m.GetKeyHistoricalStatsMultiURL(baseURLs, apiKey, 24*time.Hour, interval), "指标持久化未启用，已降级为最近 24h 数据"
 	}
@@ -2522,7 +2866,7 @@ func (m *MetricsManager) GetGlobalHistoricalStatsWithTokens(duration, interval t
 		return m.getGlobalHistoricalStatsWithTokensInMemory(duration, interval)
 	}
 
-	store, ok := m.store.(*SQLiteStore)
+	store, ok := asSQLiteStore(m.store)
 	if !ok || store == nil {
 		resp := m.getGlobalHistoricalStatsWithTokensInMemory(24*time.Hour, interval)
 		resp.Warning = "指标持久化未启用，已降级为最近 24h 数据"
@@ -3,6 +3,7 @@ package metrics
 import (
 	"math"
 	"testing"
+	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/types"
 )
@@ -79,3 +80,21 @@ func TestRecordSuccessWithUsage_CacheCreationFallbackFromTTLBreakdown(t *testing
 		t.Fatalf("expected cacheReadTokens=50, got %d", stats.CacheReadTokens)
 	}
 }
+
+func TestGetChannelCacheHitRate(t *testing.T) {
+	m := NewMetricsManagerWithConfig(10, 0.5)
+	t.Cleanup(m.Stop)
+
+	baseURLs := []string{"https://a.example.com", "https://b.example.com"}
+	if _, ok := m.GetChannelCacheHitRate(baseURLs, []string{"k1"}, time.Hour); ok {
+		t.Fatalf("expected no hit rate without usage")
+	}
+
+	m.RecordSuccessWithUsage(baseURLs[0], "k1", &types.Usage{InputTokens: 100, CacheReadInputTokens: 300}, "test-model", 0)
+	m.RecordSuccessWithUsage(baseURLs[1], "k1", &types.Usage{InputTokens: 100}, "test-model", 0)
+
+	hitRate, ok := m.GetChannelCacheHitRate(baseURLs, []string{"k1"}, time.Hour)
+	if !ok || math.Abs(hitRate-60) > 1e-9 {
+		t.Fatalf("expected hit rate 60, got %v (ok=%v)", hitRate, ok)
+	}
+}
@@ -1,6 +1,9 @@
 package metrics
 
-import "time"
+import (
+	"math/rand/v2"
+	"time"
+)
 
 // CircuitState 熔断器状态
 type CircuitState int
@@ -11,6 +14,18 @@ const (
 	CircuitHalfOpen
 )
 
+// String 返回熔断器状态名（用于 API 展示）
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
 // CircuitBreakerConfig 熔断器配置
 type CircuitBreakerConfig struct {
 	// FailureThreshold 失败率阈值（0~1），达到后从 Closed -> Open
@@ -21,6 +36,12 @@ type CircuitBreakerConfig struct {
 	OpenTimeout time.Duration
 	// RecoveryThreshold HalfOpen 状态下的成功率阈值（0~1），达到后从 HalfOpen -> Closed
 	RecoveryThreshold float64
+	// MaxBackoffMultiplier 连续熔断周期的 OpenTimeout 最大倍数（1x, 2x, 4x...），<=1 时保持固定 OpenTimeout
+	MaxBackoffMultiplier int
+	// BackoffJitter 退避抖动比例（0~1），仅在启用退避时生效，避免多个 Key 同时探测
+	BackoffJitter float64
+	// CycleResetCooldown Closed 状态持续该时间后重置连续熔断周期计数
+	CycleResetCooldown time.Duration
 }
 
 // CircuitBreaker 三态熔断器（Closed/Open/HalfOpen）
@@ -34,6 +55,14 @@ type CircuitBreaker struct {
 	state CircuitState
 
 	openedAt *time.Time
+	closedAt *time.Time
+	// trippedAt 本次熔断序列首次从 Closed 进入 Open 的时间（HalfOpen 重新打开不刷新），用于统计恢复耗时
+	trippedAt *time.Time
+
+	// openCycles 连续熔断周期数（Closed 稳定超过 CycleResetCooldown 后清零）
+	openCycles int
+	// openTimeout 当前熔断周期的实际 OpenTimeout（含退避与抖动）
+	openTimeout time.Duration
 
 	halfOpenRequests  int
 	halfOpenSuccesses int
@@ -52,10 +81,20 @@ func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
 	if cfg.RecoveryThreshold <= 0 || cfg.RecoveryThreshold > 1 {
 		cfg.RecoveryThreshold = 0.8
 	}
+	if cfg.MaxBackoffMultiplier < 1 {
+		cfg.MaxBackoffMultiplier = 1
+	}
+	if cfg.BackoffJitter < 0 || cfg.BackoffJitter > 1 {
+		cfg.BackoffJitter = 0
+	}
+	if cfg.CycleResetCooldown <= 0 {
+		cfg.CycleResetCooldown = cfg.OpenTimeout
+	}
 
 	return &CircuitBreaker{
-		cfg:   cfg,
-		state: CircuitClosed,
+		cfg:         cfg,
+		state:       CircuitClosed,
+		openTimeout: cfg.OpenTimeout,
 	}
 }
 
@@ -67,6 +106,33 @@ func (c *CircuitBreaker) OpenedAt() *time.Time {
 	return c.openedAt
 }
 
+// TrippedAt 返回本次熔断序列首次打开的时间；Closed 状态返回 nil
+func (c *CircuitBreaker) TrippedAt() *time.Time {
+	return c.trippedAt
+}
+
+// OpenCycles 返回连续熔断周期数
+func (c *CircuitBreaker) OpenCycles() int {
+	return c.openCycles
+}
+
+// EffectiveOpenTimeout 返回当前熔断周期实际使用的 OpenTimeout（含指数退避与抖动）
+func (c *CircuitBreaker) EffectiveOpenTimeout() time.Duration {
+	if c.openTimeout <= 0 {
+		return c.cfg.OpenTimeout
+	}
+	return c.openTimeout
+}
+
+// NextProbeAt 返回 Open 状态下下一次允许探测（进入 HalfOpen）的时间；非 Open 状态返回 nil
+func (c *CircuitBreaker) NextProbeAt() *time.Time {
+	if c.state != CircuitOpen || c.openedAt == nil {
+		return nil
+	}
+	t := c.openedAt.Add(c.EffectiveOpenTimeout())
+	return &t
+}
+
 // ShouldAllow 判断是否允许请求通过。必要时执行状态推进（Open->HalfOpen）。
 func (c *CircuitBreaker) ShouldAllow(now time.Time) bool {
 	switch c.state {
@@ -79,7 +145,7 @@ func (c *CircuitBreaker) ShouldAllow(now time.Time) bool {
 			t := now
 			c.openedAt = &t
 		}
-		if now.Sub(*c.openedAt) >= c.cfg.OpenTimeout {
+		if now.Sub(*c.openedAt) >= c.EffectiveOpenTimeout() {
 			c.toHalfOpen()
 			return true
 		}
@@ -110,22 +176,57 @@ func (c *CircuitBreaker) RecordFailure(now time.Time, failureRate float64, sampl
 	switch c.state {
 	case CircuitClosed:
 		if sampleCount >= c.cfg.MinRequestThreshold && failureRate >= c.cfg.FailureThreshold {
-			c.toOpen(now)
+			// Closed 稳定超过冷却期：视为新的熔断序列，重置周期计数
+			if c.closedAt != nil && now.Sub(*c.closedAt) >= c.cfg.CycleResetCooldown {
+				c.openCycles = 0
+			}
+			t := now
+			c.trippedAt = &t
+			c.startOpenCycle(now)
 		}
 		return
 	case CircuitOpen:
-		// 保持 Open，并刷新 openedAt，避免频繁探测导致抖动。
+		// 保持 Open，并刷新 openedAt，避免频繁探测导致抖动（不计入新的熔断周期）。
 		c.toOpen(now)
 		return
 	case CircuitHalfOpen:
-		// HalfOpen 一旦失败，直接重新打开。
-		c.toOpen(now)
+		// HalfOpen 一旦失败，直接重新打开，并进入下一个退避周期。
+		c.startOpenCycle(now)
 		return
 	default:
 		return
 	}
 }
 
+// startOpenCycle 开始新的熔断周期：周期计数 +1，并按指数退避重新计算 OpenTimeout
+func (c *CircuitBreaker) startOpenCycle(now time.Time) {
+	c.openCycles++
+	c.openTimeout = c.backoffTimeout(c.openCycles)
+	c.toOpen(now)
+}
+
+// backoffTimeout 计算第 cycle 个熔断周期的 OpenTimeout：OpenTimeout * min(2^(cycle-1), MaxBackoffMultiplier) + 抖动
+func (c *CircuitBreaker) backoffTimeout(cycle int) time.Duration {
+	base := c.cfg.OpenTimeout
+	if c.cfg.MaxBackoffMultiplier <= 1 {
+		return base
+	}
+
+	multiplier := 1
+	for i := 1; i < cycle && multiplier < c.cfg.MaxBackoffMultiplier; i++ {
+		multiplier *= 2
+	}
+	if multiplier > c.cfg.MaxBackoffMultiplier {
+		multiplier = c.cfg.MaxBackoffMultiplier
+	}
+
+	timeout := base * time.Duration(multiplier)
+	if c.cfg.BackoffJitter > 0 {
+		timeout += time.Duration(float64(timeout) * c.cfg.BackoffJitter * rand.Float64())
+	}
+	return timeout
+}
+
 func (c *CircuitBreaker) toOpen(now time.Time) {
 	t := now
 	c.openedAt = &t
@@ -140,9 +241,12 @@ func (c *CircuitBreaker) toHalfOpen() {
 	c.halfOpenSuccesses = 0
 }
 
-func (c *CircuitBreaker) toClosed() {
+func (c *CircuitBreaker) toClosed(now time.Time) {
+	t := now
+	c.closedAt = &t
 	c.state = CircuitClosed
 	c.openedAt = nil
+	c.trippedAt = nil
 	c.halfOpenRequests = 0
 	c.halfOpenSuccesses = 0
 }
@@ -153,8 +257,8 @@ func (c *CircuitBreaker) maybeCloseOrReopen(now time.Time) {
 	}
 	successRate := float64(c.halfOpenSuccesses) / float64(c.halfOpenRequests)
 	if successRate >= c.cfg.RecoveryThreshold {
-		c.toClosed()
+		c.toClosed(now)
 		return
 	}
-	c.toOpen(now)
+	c.startOpenCycle(now)
 }
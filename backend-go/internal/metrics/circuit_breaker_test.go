@@ -20,10 +20,12 @@ func TestNewCircuitBreaker_NormalizesConfig(t *testing.T) {
 				RecoveryThreshold:   2,
 			},
 			want: CircuitBreakerConfig{
-				FailureThreshold:    0.5,
-				MinRequestThreshold: 1,
-				OpenTimeout:         15 * time.Minute,
-				RecoveryThreshold:   0.8,
+				FailureThreshold:     0.5,
+				MinRequestThreshold:  1,
+				OpenTimeout:          15 * time.Minute,
+				RecoveryThreshold:    0.8,
+				MaxBackoffMultiplier: 1,
+				CycleResetCooldown:   15 * time.Minute,
 			},
 		},
 		{
@@ -35,10 +37,12 @@ func TestNewCircuitBreaker_NormalizesConfig(t *testing.T) {
 				RecoveryThreshold:   0.9,
 			},
 			want: CircuitBreakerConfig{
-				FailureThreshold:    0.25,
-				MinRequestThreshold: 7,
-				OpenTimeout:         3 * time.Second,
-				RecoveryThreshold:   0.9,
+				FailureThreshold:     0.25,
+				MinRequestThreshold:  7,
+				OpenTimeout:          3 * time.Second,
+				RecoveryThreshold:    0.9,
+				MaxBackoffMultiplier: 1,
+				CycleResetCooldown:   3 * time.Second,
 			},
 		},
 	}
@@ -268,3 +272,147 @@ func TestCircuitBreaker_RecordSuccess_WhileOpenForcesHalfOpen(t *testing.T) {
 		t.Fatalf("state=%v, want=%v", cb.State(), CircuitClosed)
 	}
 }
+
+func TestCircuitBreaker_DefaultMultiplierKeepsFixedTimeout(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold:    0.5,
+		MinRequestThreshold: 1,
+		OpenTimeout:         10 * time.Second,
+		RecoveryThreshold:   1,
+		BackoffJitter:       0.5,
+	})
+
+	now := time.Unix(1000, 0)
+	cb.RecordFailure(now, 1, 1)
+	for cycle := 1; cycle <= 4; cycle++ {
+		if got := cb.EffectiveOpenTimeout(); got != 10*time.Second {
+			t.Fatalf("cycle %d: timeout=%v, want 10s", cycle, got)
+		}
+		now = now.Add(10 * time.Second)
+		if !cb.ShouldAllow(now) {
+			t.Fatalf("cycle %d: expected HalfOpen after fixed timeout", cycle)
+		}
+		cb.RecordFailure(now, 1, 1)
+	}
+}
+
+func TestCircuitBreaker_ExponentialBackoffCapped(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold:     0.5,
+		MinRequestThreshold:  1,
+		OpenTimeout:          10 * time.Second,
+		RecoveryThreshold:    1,
+		MaxBackoffMultiplier: 4,
+	})
+
+	now := time.Unix(1000, 0)
+	cb.RecordFailure(now, 1, 1)
+
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 40 * time.Second}
+	for i, timeout := range want {
+		if cb.OpenCycles() != i+1 {
+			t.Fatalf("cycles=%d, want %d", cb.OpenCycles(), i+1)
+		}
+		if got := cb.EffectiveOpenTimeout(); got != timeout {
+			t.Fatalf("cycle %d: timeout=%v, want %v", i+1, got, timeout)
+		}
+		probeAt := cb.NextProbeAt()
+		if probeAt == nil || !probeAt.Equal(now.Add(timeout)) {
+			t.Fatalf("cycle %d: nextProbeAt=%v, want %v", i+1, probeAt, now.Add(timeout))
+		}
+		if cb.ShouldAllow(now.Add(timeout - time.Second)) {
+			t.Fatalf("cycle %d: should still be open before timeout", i+1)
+		}
+		now = now.Add(timeout)
+		if !cb.ShouldAllow(now) || cb.State() != CircuitHalfOpen {
+			t.Fatalf("cycle %d: expected HalfOpen after timeout", i+1)
+		}
+		// HalfOpen 探测失败：进入下一个退避周期
+		cb.RecordFailure(now, 1, 1)
+	}
+}
+
+func TestCircuitBreaker_BackoffJitterWithinBounds(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		cb := NewCircuitBreaker(CircuitBreakerConfig{
+			FailureThreshold:     0.5,
+			MinRequestThreshold:  1,
+			OpenTimeout:          10 * time.Second,
+			MaxBackoffMultiplier: 2,
+			BackoffJitter:        0.2,
+		})
+		cb.RecordFailure(time.Unix(1000, 0), 1, 1)
+		got := cb.EffectiveOpenTimeout()
+		if got < 10*time.Second || got > 12*time.Second {
+			t.Fatalf("timeout=%v, want within [10s, 12s]", got)
+		}
+	}
+}
+
+func TestCircuitBreaker_CycleResetAfterCooldown(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold:     0.5,
+		MinRequestThreshold:  1,
+		OpenTimeout:          10 * time.Second,
+		RecoveryThreshold:    1,
+		MaxBackoffMultiplier: 8,
+		CycleResetCooldown:   time.Minute,
+	})
+
+	now := time.Unix(1000, 0)
+	cb.RecordFailure(now, 1, 1) // cycle 1
+	now = now.Add(10 * time.Second)
+	cb.ShouldAllow(now)
+	cb.RecordFailure(now, 1, 1) // cycle 2 (20s)
+	now = now.Add(20 * time.Second)
+	cb.ShouldAllow(now)
+	cb.RecordSuccess(now) // 恢复到 Closed
+	if cb.State() != CircuitClosed {
+		t.Fatalf("state=%v, want Closed", cb.State())
+	}
+
+	// 冷却期内再次熔断：周期计数延续
+	now = now.Add(30 * time.Second)
+	cb.RecordFailure(now, 1, 1)
+	if cb.OpenCycles() != 3 || cb.EffectiveOpenTimeout() != 40*time.Second {
+		t.Fatalf("cycles=%d timeout=%v, want 3/40s", cb.OpenCycles(), cb.EffectiveOpenTimeout())
+	}
+
+	now = now.Add(40 * time.Second)
+	cb.ShouldAllow(now)
+	cb.RecordSuccess(now)
+
+	// Closed 持续超过冷却期后再次熔断：周期计数重置
+	now = now.Add(2 * time.Minute)
+	cb.RecordFailure(now, 1, 1)
+	if cb.OpenCycles() != 1 || cb.EffectiveOpenTimeout() != 10*time.Second {
+		t.Fatalf("cycles=%d timeout=%v, want 1/10s", cb.OpenCycles(), cb.EffectiveOpenTimeout())
+	}
+}
+
+func TestMetricsManager_SetCircuitBackoffExposesNextProbeAt(t *testing.T) {
+	m := NewMetricsManagerWithConfig(3, 0.5)
+	defer m.Stop()
+	m.SetCircuitBackoff(4, 0, time.Hour)
+
+	baseURL := "https://api.example.com"
+	for i := 0; i < 3; i++ {
+		m.RecordFailure(baseURL, "k1")
+	}
+
+	resp := m.ToResponseMultiURL(0, []string{baseURL}, []string{"k1"}, 0)
+	if len(resp.KeyMetrics) != 1 {
+		t.Fatalf("key metrics len=%d, want 1", len(resp.KeyMetrics))
+	}
+	km := resp.KeyMetrics[0]
+	if !km.CircuitBroken || km.NextProbeAt == nil {
+		t.Fatalf("expected circuit broken with nextProbeAt, got %+v", km)
+	}
+
+	m.mu.RLock()
+	cb := m.keyMetrics[generateMetricsKey(baseURL, "k1")].circuitBreaker
+	m.mu.RUnlock()
+	if cb.cfg.MaxBackoffMultiplier != 4 || cb.cfg.CycleResetCooldown != time.Hour {
+		t.Fatalf("unexpected breaker cfg: %+v", cb.cfg)
+	}
+}
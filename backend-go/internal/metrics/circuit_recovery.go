@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// maxRecoverySamples 每个 Key 保留的最近熔断恢复耗时样本数
+const maxRecoverySamples = 100
+
+// CircuitRecoveryStats 熔断恢复耗时统计（从 Key 熔断打开到重新关闭的时长，用于评估上游可靠性）
+type CircuitRecoveryStats struct {
+	Recoveries int     `json:"recoveries"` // 统计的恢复次数
+	MeanMs     float64 `json:"meanMs"`
+	P50Ms      int64   `json:"p50Ms"`
+	P90Ms      int64   `json:"p90Ms"`
+	P99Ms      int64   `json:"p99Ms"`
+	MaxMs      int64   `json:"maxMs"`
+}
+
+// KeyCircuitRecoveryStats 单个 Key 的熔断恢复耗时统计
+type KeyCircuitRecoveryStats struct {
+	BaseURL  string `json:"baseUrl"`
+	KeyMask  string `json:"keyMask"`
+	Open     bool   `json:"open"`               // 当前是否处于熔断中（Open/HalfOpen）
+	OpenedMs int64  `json:"openedMs,omitempty"` // 当前熔断已持续的时长
+	CircuitRecoveryStats
+}
+
+// recordCircuitRecovery 记录一次熔断恢复耗时（调用方需持有写锁）
+func recordCircuitRecovery(metrics *KeyMetrics, d time.Duration) {
+	metrics.recoveryDurations = append(metrics.recoveryDurations, d)
+	if len(metrics.recoveryDurations) > maxRecoverySamples {
+		metrics.recoveryDurations = metrics.recoveryDurations[len(metrics.recoveryDurations)-maxRecoverySamples:]
+	}
+}
+
+// GetCircuitRecoveryStats 获取渠道各 BaseURL × Key 的熔断恢复耗时统计，以及渠道汇总
+// 未发生过熔断的 Key 不出现在列表中
+func (m *MetricsManager) GetCircuitRecoveryStats(baseURLs []string, activeKeys []string) ([]KeyCircuitRecoveryStats, CircuitRecoveryStats) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := m.currentTime()
+	var keys []KeyCircuitRecoveryStats
+	var all []time.Duration
+	for _, baseURL := range baseURLs {
+		for _, apiKey := range activeKeys {
+			metrics, exists := m.keyMetrics[generateMetricsKey(baseURL, apiKey)]
+			if !exists {
+				continue
+			}
+			var trippedAt *time.Time
+			if metrics.circuitBreaker != nil {
+				trippedAt = metrics.circuitBreaker.TrippedAt()
+			}
+			if len(metrics.recoveryDurations) == 0 && trippedAt == nil {
+				continue
+			}
+
+			item := KeyCircuitRecoveryStats{
+				BaseURL:              metrics.BaseURL,
+				KeyMask:              metrics.KeyMask,
+				CircuitRecoveryStats: summarizeRecoveryDurations(metrics.recoveryDurations),
+			}
+			if trippedAt != nil {
+				item.Open = true
+				item.OpenedMs = now.Sub(*trippedAt).Milliseconds()
+			}
+			keys = append(keys, item)
+			all = append(all, metrics.recoveryDurations...)
+		}
+	}
+	return keys, summarizeRecoveryDurations(all)
+}
+
+// summarizeRecoveryDurations 计算恢复耗时的均值与分位数（nearest-rank）
+func summarizeRecoveryDurations(durations []time.Duration) CircuitRecoveryStats {
+	stats := CircuitRecoveryStats{Recoveries: len(durations)}
+	if len(durations) == 0 {
+		return stats
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	stats.MeanMs = float64(sum) / float64(len(sorted)) / float64(time.Millisecond)
+	stats.P50Ms = recoveryPercentile(sorted, 50).Milliseconds()
+	stats.P90Ms = recoveryPercentile(sorted, 90).Milliseconds()
+	stats.P99Ms = recoveryPercentile(sorted, 99).Milliseconds()
+	stats.MaxMs = sorted[len(sorted)-1].Milliseconds()
+	return stats
+}
+
+// recoveryPercentile 有序样本的 nearest-rank 分位数
+func recoveryPercentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// currentTime 熔断状态推进使用的当前时间
+func (m *MetricsManager) currentTime() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
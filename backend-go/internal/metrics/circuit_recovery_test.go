@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+// newRecoveryTestManager 创建使用假时钟的指标管理器（窗口 3，失败率阈值 50%，OpenTimeout 15 分钟）
+func newRecoveryTestManager(t *testing.T) (*MetricsManager, *time.Time) {
+	t.Helper()
+	m := NewMetricsManagerWithConfig(3, 0.5)
+	t.Cleanup(m.Stop)
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	return m, &clock
+}
+
+// tripCircuit 连续失败使 Key 熔断
+func tripCircuit(t *testing.T, m *MetricsManager, baseURL, apiKey string) {
+	t.Helper()
+	for i := 0; i < 3; i++ {
+		m.RecordFailure(baseURL, apiKey)
+	}
+	if !m.ShouldSuspendKey(baseURL, apiKey) {
+		t.Fatalf("expected %s to be circuit-open", apiKey)
+	}
+}
+
+// recoverCircuit 推进到 HalfOpen 并以成功请求关闭熔断
+func recoverCircuit(t *testing.T, m *MetricsManager, baseURL, apiKey string) {
+	t.Helper()
+	if m.ShouldSuspendKey(baseURL, apiKey) {
+		t.Fatalf("expected %s to allow a half-open probe", apiKey)
+	}
+	for i := 0; i < 3; i++ {
+		m.RecordSuccess(baseURL, apiKey)
+	}
+	if m.GetChannelCircuitState(baseURL, []string{apiKey}) != CircuitClosed {
+		t.Fatalf("expected %s circuit to be closed", apiKey)
+	}
+}
+
+func TestCircuitRecovery_RecordsDurationFromTripToClose(t *testing.T) {
+	m, clock := newRecoveryTestManager(t)
+	const baseURL = "https://api.example.com"
+
+	tripCircuit(t, m, baseURL, "key-a")
+	*clock = clock.Add(20 * time.Minute)
+	recoverCircuit(t, m, baseURL, "key-a")
+
+	keys, total := m.GetCircuitRecoveryStats([]string{baseURL}, []string{"key-a", "key-never-tripped"})
+	if len(keys) != 1 {
+		t.Fatalf("expected only the tripped key to be listed, got %+v", keys)
+	}
+	want := (20 * time.Minute).Milliseconds()
+	if keys[0].Open || keys[0].Recoveries != 1 || keys[0].MaxMs != want || keys[0].P50Ms != want {
+		t.Fatalf("unexpected key stats: %+v", keys[0])
+	}
+	if total.Recoveries != 1 || total.MeanMs != float64(want) {
+		t.Fatalf("unexpected total stats: %+v", total)
+	}
+}
+
+func TestCircuitRecovery_HalfOpenReopenCountsFromFirstTrip(t *testing.T) {
+	m, clock := newRecoveryTestManager(t)
+	const baseURL = "https://api.example.com"
+
+	tripCircuit(t, m, baseURL, "key-a")
+
+	// 第一次半开探测失败，重新打开（不应刷新本次熔断序列的起点）
+	*clock = clock.Add(16 * time.Minute)
+	if m.ShouldSuspendKey(baseURL, "key-a") {
+		t.Fatalf("expected half-open probe to be allowed")
+	}
+	m.RecordFailure(baseURL, "key-a")
+	if !m.ShouldSuspendKey(baseURL, "key-a") {
+		t.Fatalf("expected circuit to reopen after half-open failure")
+	}
+
+	*clock = clock.Add(16 * time.Minute)
+	recoverCircuit(t, m, baseURL, "key-a")
+
+	keys, _ := m.GetCircuitRecoveryStats([]string{baseURL}, []string{"key-a"})
+	if want := (32 * time.Minute).Milliseconds(); len(keys) != 1 || keys[0].MaxMs != want {
+		t.Fatalf("expected recovery of %dms measured from the first trip, got %+v", want, keys)
+	}
+}
+
+func TestCircuitRecovery_AggregatesPercentilesAndOpenKeys(t *testing.T) {
+	m, clock := newRecoveryTestManager(t)
+	const baseURL = "https://api.example.com"
+
+	// key-a 恢复两次（16m、30m），key-b 恢复一次（60m）
+	for _, openFor := range []time.Duration{16 * time.Minute, 30 * time.Minute} {
+		tripCircuit(t, m, baseURL, "key-a")
+		*clock = clock.Add(openFor)
+		recoverCircuit(t, m, baseURL, "key-a")
+	}
+	tripCircuit(t, m, baseURL, "key-b")
+	*clock = clock.Add(60 * time.Minute)
+	recoverCircuit(t, m, baseURL, "key-b")
+
+	// key-c 当前仍处于熔断中
+	tripCircuit(t, m, baseURL, "key-c")
+	*clock = clock.Add(5 * time.Minute)
+
+	keys, total := m.GetCircuitRecoveryStats([]string{baseURL}, []string{"key-a", "key-b", "key-c"})
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 keys, got %+v", keys)
+	}
+	if keys[0].Recoveries != 2 || keys[0].MeanMs != float64((23*time.Minute).Milliseconds()) {
+		t.Fatalf("unexpected key-a stats: %+v", keys[0])
+	}
+	if !keys[2].Open || keys[2].Recoveries != 0 || keys[2].OpenedMs != (5*time.Minute).Milliseconds() {
+		t.Fatalf("unexpected key-c stats: %+v", keys[2])
+	}
+
+	if total.Recoveries != 3 {
+		t.Fatalf("expected 3 recoveries in total, got %+v", total)
+	}
+	if total.P50Ms != (30*time.Minute).Milliseconds() || total.P90Ms != (60*time.Minute).Milliseconds() ||
+		total.P99Ms != (60*time.Minute).Milliseconds() || total.MaxMs != (60*time.Minute).Milliseconds() {
+		t.Fatalf("unexpected percentiles: %+v", total)
+	}
+	if want := float64((106 * time.Minute).Milliseconds()) / 3; total.MeanMs != want {
+		t.Fatalf("MeanMs=%v, want %v", total.MeanMs, want)
+	}
+}
+
+func TestCircuitRecovery_KeepsRecentSamplesOnly(t *testing.T) {
+	km := &KeyMetrics{}
+	for i := 1; i <= maxRecoverySamples+5; i++ {
+		recordCircuitRecovery(km, time.Duration(i)*time.Second)
+	}
+	if len(km.recoveryDurations) != maxRecoverySamples {
+		t.Fatalf("expected %d samples, got %d", maxRecoverySamples, len(km.recoveryDurations))
+	}
+	if km.recoveryDurations[0] != 6*time.Second {
+		t.Fatalf("expected oldest samples to be dropped, first=%v", km.recoveryDurations[0])
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// GetCostCentsSince 获取自 since 所在本地日零点起至今的累计成本（美分），用于日/周成本预算
+// 今日部分使用内存请求历史（包含尚未落盘的记录）；更早的整日从 daily_stats 读取，
+// 缺少汇总的日期（如凌晨聚合任务执行前的昨日）回退为 request_records 原始明细
+// 未启用持久化时只能统计今日，返回今日成本与错误
+func (m *MetricsManager) GetCostCentsSince(since time.Time) (int64, error) {
+	now := time.Now()
+	loc := now.Location()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	since = since.In(loc)
+	sinceDayStart := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, loc)
+
+	total := m.sumCostCentsInMemory(todayStart)
+	if !sinceDayStart.Before(todayStart) {
+		return total, nil
+	}
+
+	store, ok := asSQLiteStore(m.store)
+	if !ok || store == nil {
+		return total, fmt.Errorf("指标持久化未启用，仅统计今日成本")
+	}
+
+	yesterdayStart := todayStart.AddDate(0, 0, -1)
+	dailyTotals, err := store.QueryDailyTotals(m.apiType, sinceDayStart.Format("2006-01-02"), yesterdayStart.Format("2006-01-02"), nil)
+	if err != nil {
+		return total, err
+	}
+	for dayStart := sinceDayStart; dayStart.Before(todayStart); dayStart = dayStart.AddDate(0, 0, 1) {
+		if agg, ok := dailyTotals[dayStart.Format("2006-01-02")]; ok {
+			total += agg.CostCents
+			continue
+		}
+		agg, err := store.QueryRequestRecordTotals(m.apiType, dayStart, dayStart.AddDate(0, 0, 1), nil)
+		if err != nil {
+			return total, err
+		}
+		total += agg.CostCents
+	}
+	return total, nil
+}
+
+// sumCostCentsInMemory 汇总内存请求历史中 since 之后（含）的成本
+func (m *MetricsManager) sumCostCentsInMemory(since time.Time) int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total int64
+	for _, metrics := range m.keyMetrics {
+		for _, record := range metrics.requestHistory {
+			if !record.Timestamp.Before(since) {
+				total += record.CostCents
+			}
+		}
+	}
+	return total
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+func TestGetCostCentsSince(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	m := NewMetricsManagerWithPersistence(10, 0.5, store, "messages")
+	defer m.Stop()
+
+	now := time.Now()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	addRecord := func(ts time.Time, cost int64, apiType string) {
+		store.AddRecord(PersistentRecord{MetricsKey: "mk", BaseURL: "https://a", KeyMask: "sk-***", Timestamp: ts, Success: true, CostCents: cost, APIType: apiType})
+	}
+
+	// 前天：已聚合到 daily_stats
+	twoDaysAgo := todayStart.AddDate(0, 0, -2)
+	addRecord(twoDaysAgo.Add(time.Hour), 10, "messages")
+	addRecord(twoDaysAgo.Add(2*time.Hour), 99, "responses") // 其他接口类型不计入
+	// 昨天：尚未聚合，回退为原始明细
+	addRecord(todayStart.AddDate(0, 0, -1).Add(time.Hour), 20, "messages")
+	// 三天前：不在统计范围内
+	addRecord(todayStart.AddDate(0, 0, -3).Add(time.Hour), 1000, "messages")
+	store.FlushNow()
+	if err := store.AggregateDailyStats(twoDaysAgo); err != nil {
+		t.Fatalf("AggregateDailyStats() err = %v", err)
+	}
+
+	// 今日：内存记录
+	m.RecordSuccessWithUsage("https://a", "sk-test", &types.Usage{InputTokens: 1}, "m1", 5)
+
+	if got, err := m.GetCostCentsSince(todayStart); err != nil || got != 5 {
+		t.Fatalf("GetCostCentsSince(today) = %d, %v; want 5", got, err)
+	}
+	if got, err := m.GetCostCentsSince(twoDaysAgo.Add(3 * time.Hour)); err != nil || got != 35 {
+		t.Fatalf("GetCostCentsSince(2 days ago) = %d, %v; want 35", got, err)
+	}
+}
+
+func TestGetCostCentsSince_WithoutPersistence(t *testing.T) {
+	m := NewMetricsManager()
+	defer m.Stop()
+	m.RecordSuccessWithUsage("https://a", "sk-test", &types.Usage{InputTokens: 1}, "m1", 7)
+
+	now := time.Now()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	got, err := m.GetCostCentsSince(todayStart.AddDate(0, 0, -1))
+	if err == nil {
+		t.Fatalf("GetCostCentsSince() err = nil, want error without persistence")
+	}
+	if got != 7 {
+		t.Fatalf("GetCostCentsSince() = %d, want today's 7", got)
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// DailyStatsSchedule daily_stats 每日聚合的触发时间：本地 Hour 点前后 ±Jitter 内随机触发，
+// 随机源按实例（主机名 + 进程号 + 启动时间）独立播种，多实例共享存储时不会在同一时刻集中聚合
+type DailyStatsSchedule struct {
+	Hour   int
+	Jitter time.Duration
+
+	rng  *rand.Rand
+	last time.Time // 上一次计划的基准时间（整点）
+}
+
+// NewDailyStatsSchedule 创建每日聚合计划（hour 超出 0-23 时使用 2，jitter < 0 视为 0）
+func NewDailyStatsSchedule(hour int, jitter time.Duration) *DailyStatsSchedule {
+	if hour < 0 || hour > 23 {
+		hour = 2
+	}
+	return &DailyStatsSchedule{
+		Hour:   hour,
+		Jitter: max(jitter, 0),
+		rng:    rand.New(rand.NewSource(instanceSeed())),
+	}
+}
+
+// Next 返回下一次聚合的基准时间与实际触发时间
+// 基准时间为 now 之后（且晚于上一次基准时间）的本地 Hour 点，聚合的是基准时间前一日；
+// 触发时间加入随机抖动，但不早于基准时间当日零点，保证前一日数据已完整
+func (s *DailyStatsSchedule) Next(now time.Time) (base, runAt time.Time) {
+	from := now
+	if from.Before(s.last) {
+		// 提前触发（负抖动）后不重复调度同一天
+		from = s.last
+	}
+	base = nextLocalTime(from, s.Hour, 0)
+	s.last = base
+
+	runAt = base
+	if s.Jitter > 0 {
+		runAt = base.Add(time.Duration(s.rng.Int63n(int64(2*s.Jitter)+1)) - s.Jitter)
+	}
+	dayStart := time.Date(base.Year(), base.Month(), base.Day(), 0, 0, 0, 0, base.Location())
+	if runAt.Before(dayStart) {
+		runAt = dayStart
+	}
+	return base, runAt
+}
+
+// nextLocalTime 返回 now 之后的下一个本地 hour:minute
+func nextLocalTime(now time.Time, hour, minute int) time.Time {
+	loc := now.Location()
+	if loc == nil {
+		loc = time.Local
+	}
+
+	target := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, loc)
+	if !now.Before(target) {
+		target = target.AddDate(0, 0, 1)
+	}
+	return target
+}
+
+// instanceSeed 每个实例独立的随机种子
+func instanceSeed() int64 {
+	h := fnv.New64a()
+	hostname, _ := os.Hostname()
+	_, _ = h.Write([]byte(hostname))
+	return int64(h.Sum64()) ^ int64(os.Getpid())<<32 ^ time.Now().UnixNano()
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDailyStatsSchedule_NoJitter(t *testing.T) {
+	s := NewDailyStatsSchedule(3, 0)
+	now := time.Date(2026, 5, 10, 4, 0, 0, 0, time.Local)
+
+	base, runAt := s.Next(now)
+	want := time.Date(2026, 5, 11, 3, 0, 0, 0, time.Local)
+	if !base.Equal(want) || !runAt.Equal(want) {
+		t.Fatalf("Next = %v / %v, want %v", base, runAt, want)
+	}
+}
+
+func TestDailyStatsSchedule_JitterWithinWindow(t *testing.T) {
+	s := NewDailyStatsSchedule(2, 30*time.Minute)
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.Local)
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 50; i++ {
+		base, runAt := s.Next(now)
+		if base.Hour() != 2 || base.Minute() != 0 {
+			t.Fatalf("base = %v, want 02:00", base)
+		}
+		offset := runAt.Sub(base)
+		if offset < -30*time.Minute || offset > 30*time.Minute {
+			t.Fatalf("offset %v outside ±30m", offset)
+		}
+		seen[offset] = true
+		// 每次调度都推进到下一天，不会重复同一个基准时间
+		if i > 0 && !base.After(now) {
+			t.Fatalf("base %v did not advance past %v", base, now)
+		}
+		now = runAt
+	}
+	if len(seen) < 2 {
+		t.Fatalf("jitter produced a single offset: %v", seen)
+	}
+}
+
+func TestDailyStatsSchedule_EarlyRunDoesNotRepeatDay(t *testing.T) {
+	s := NewDailyStatsSchedule(2, time.Hour)
+	base, _ := s.Next(time.Date(2026, 5, 10, 12, 0, 0, 0, time.Local))
+
+	// 负抖动提前触发后（基准时间之前）再次调度，应推进到下一天
+	next, _ := s.Next(base.Add(-40 * time.Minute))
+	if !next.Equal(base.AddDate(0, 0, 1)) {
+		t.Fatalf("next base = %v, want %v", next, base.AddDate(0, 0, 1))
+	}
+}
+
+func TestDailyStatsSchedule_NeverBeforeMidnight(t *testing.T) {
+	s := NewDailyStatsSchedule(0, 3*time.Hour)
+	for i := 0; i < 50; i++ {
+		s.last = time.Time{}
+		base, runAt := s.Next(time.Date(2026, 5, 10, 12, 0, 0, 0, time.Local))
+		if runAt.Before(base) {
+			t.Fatalf("runAt %v before base day start %v", runAt, base)
+		}
+	}
+}
+
+func TestNewDailyStatsSchedule_InvalidHour(t *testing.T) {
+	if s := NewDailyStatsSchedule(24, -time.Minute); s.Hour != 2 || s.Jitter != 0 {
+		t.Fatalf("unexpected schedule: hour=%d jitter=%v", s.Hour, s.Jitter)
+	}
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// RecordSink 指标记录的旁路接收端（如分析库镜像）
+// AddRecord 必须是非阻塞的尽力而为写入，不得影响主存储
+type RecordSink interface {
+	AddRecord(record PersistentRecord)
+	Close() error
+}
+
+// FanoutStore 将指标记录同时写入主存储与若干旁路接收端
+// 读取与清理只作用于主存储；旁路接收端的异常（包括 panic）只记录日志，不影响主存储写入
+type FanoutStore struct {
+	primary PersistenceStore
+	sinks   []RecordSink
+}
+
+// NewFanoutStore 创建扇出存储，primary 可以为 nil（仅镜像、不做本地持久化）
+func NewFanoutStore(primary PersistenceStore, sinks ...RecordSink) *FanoutStore {
+	filtered := make([]RecordSink, 0, len(sinks))
+	for _, sink := range sinks {
+		if sink != nil {
+			filtered = append(filtered, sink)
+		}
+	}
+	return &FanoutStore{primary: primary, sinks: filtered}
+}
+
+// Primary 返回主存储
+func (f *FanoutStore) Primary() PersistenceStore {
+	return f.primary
+}
+
+// AddRecord 写入主存储后转发到各旁路接收端
+func (f *FanoutStore) AddRecord(record PersistentRecord) {
+	if f.primary != nil {
+		f.primary.AddRecord(record)
+	}
+	for _, sink := range f.sinks {
+		forwardToSink(sink, record)
+	}
+}
+
+// forwardToSink 隔离旁路接收端的 panic，保证主路径不受影响
+func forwardToSink(sink RecordSink, record PersistentRecord) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Metrics-Mirror] 警告: 旁路接收端写入异常: %v", r)
+		}
+	}()
+	sink.AddRecord(record)
+}
+
+// LoadRecords 从主存储加载记录
+func (f *FanoutStore) LoadRecords(since time.Time, apiType string) ([]PersistentRecord, error) {
+	if f.primary == nil {
+		return nil, nil
+	}
+	return f.primary.LoadRecords(since, apiType)
+}
+
+// CleanupOldRecords 清理主存储中的过期记录
+func (f *FanoutStore) CleanupOldRecords(before time.Time) (int64, error) {
+	if f.primary == nil {
+		return 0, nil
+	}
+	return f.primary.CleanupOldRecords(before)
+}
+
+// Close 先关闭旁路接收端（刷新待发送记录），再关闭主存储
+func (f *FanoutStore) Close() error {
+	var errs []error
+	for _, sink := range f.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if f.primary != nil {
+		if err := f.primary.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// asSQLiteStore 取出（可能被扇出存储包装的）SQLite 主存储
+func asSQLiteStore(store PersistenceStore) (*SQLiteStore, bool) {
+	if fanout, ok := store.(*FanoutStore); ok {
+		store = fanout.primary
+	}
+	sqlite, ok := store.(*SQLiteStore)
+	return sqlite, ok && sqlite != nil
+}
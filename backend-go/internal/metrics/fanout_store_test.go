@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryRecordStore struct {
+	mu      sync.Mutex
+	records []PersistentRecord
+	closed  bool
+}
+
+func (s *memoryRecordStore) AddRecord(record PersistentRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+}
+
+func (s *memoryRecordStore) LoadRecords(since time.Time, apiType string) ([]PersistentRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PersistentRecord(nil), s.records...), nil
+}
+
+func (s *memoryRecordStore) CleanupOldRecords(before time.Time) (int64, error) { return 0, nil }
+
+func (s *memoryRecordStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+type panicSink struct{ closed bool }
+
+func (s *panicSink) AddRecord(PersistentRecord) { panic("sink exploded") }
+
+func (s *panicSink) Close() error {
+	s.closed = true
+	return errors.New("close failed")
+}
+
+func TestFanoutStore_PrimaryUnaffectedBySink(t *testing.T) {
+	primary := &memoryRecordStore{}
+	bad := &panicSink{}
+	good := &memoryRecordStore{}
+	store := NewFanoutStore(primary, bad, nil, good)
+
+	store.AddRecord(PersistentRecord{MetricsKey: "k1", Success: true})
+	store.AddRecord(PersistentRecord{MetricsKey: "k2"})
+
+	loaded, err := store.LoadRecords(time.Time{}, "messages")
+	if err != nil || len(loaded) != 2 {
+		t.Fatalf("primary records = %d, err = %v", len(loaded), err)
+	}
+	if len(good.records) != 2 {
+		t.Fatalf("healthy sink records = %d, want 2", len(good.records))
+	}
+
+	if err := store.Close(); err == nil {
+		t.Fatalf("expected sink close error to be reported")
+	}
+	if !primary.closed || !bad.closed || !good.closed {
+		t.Fatalf("all stores should be closed: primary=%v bad=%v good=%v", primary.closed, bad.closed, good.closed)
+	}
+}
+
+func TestFanoutStore_NilPrimary(t *testing.T) {
+	sink := &memoryRecordStore{}
+	store := NewFanoutStore(nil, sink)
+
+	store.AddRecord(PersistentRecord{MetricsKey: "k"})
+	if records, err := store.LoadRecords(time.Time{}, "messages"); err != nil || records != nil {
+		t.Fatalf("nil primary LoadRecords = %v, %v", records, err)
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("sink records = %d, want 1", len(sink.records))
+	}
+
+	m := NewMetricsManagerWithPersistence(3, 0.5, store, "messages")
+	defer m.Stop()
+	m.RecordSuccess("https://api.example.com", "sk-test")
+	if len(sink.records) != 2 {
+		t.Fatalf("metrics manager should mirror records, sink records = %d", len(sink.records))
+	}
+}
+
+func TestAsSQLiteStore_UnwrapsFanout(t *testing.T) {
+	sqlite := &SQLiteStore{}
+	if got, ok := asSQLiteStore(NewFanoutStore(sqlite)); !ok || got != sqlite {
+		t.Fatalf("expected wrapped SQLite store to be unwrapped")
+	}
+	if _, ok := asSQLiteStore(NewFanoutStore(nil)); ok {
+		t.Fatalf("fanout without primary should not yield a SQLite store")
+	}
+	if _, ok := asSQLiteStore(nil); ok {
+		t.Fatalf("nil store should not yield a SQLite store")
+	}
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHTTPSinkBatchSize     = 100
+	defaultHTTPSinkFlushInterval = 5 * time.Second
+	defaultHTTPSinkTimeout       = 10 * time.Second
+	httpSinkBufferMultiplier     = 20 // 缓冲区容量 = 批量大小 × 倍数
+)
+
+// HTTPSinkConfig HTTP 镜像接收端配置
+type HTTPSinkConfig struct {
+	URL           string        // 接收端地址（POST JSON）
+	AuthToken     string        // 可选，以 Authorization: Bearer 发送
+	BatchSize     int           // 单次 POST 的最大记录数
+	FlushInterval time.Duration // 未攒满一批时的最长发送间隔
+	Timeout       time.Duration // 单次 POST 超时
+}
+
+// HTTPSinkStats 镜像发送统计
+type HTTPSinkStats struct {
+	Sent    int64 // 已成功发送的记录数
+	Dropped int64 // 缓冲区已满被丢弃的记录数
+	Failed  int64 // 发送失败被丢弃的记录数
+}
+
+// HTTPSink 将指标记录批量 POST 到外部分析服务（尽力而为）
+// AddRecord 只向有界缓冲区投递，缓冲区满或发送失败时直接丢弃，不重试、不回压请求路径
+type HTTPSink struct {
+	url           string
+	authToken     string
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+
+	records   chan PersistentRecord
+	stopCh    chan struct{}
+	done      chan struct{}
+	closed    atomic.Bool
+	closeOnce sync.Once
+
+	sent    atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// httpSinkRecord 镜像发送的记录格式
+type httpSinkRecord struct {
+	MetricsKey          string    `json:"metricsKey"`
+	BaseURL             string    `json:"baseUrl"`
+	KeyMask             string    `json:"keyMask"`
+	Timestamp           time.Time `json:"timestamp"`
+	Success             bool      `json:"success"`
+	InputTokens         int64     `json:"inputTokens"`
+	OutputTokens        int64     `json:"outputTokens"`
+	CacheCreationTokens int64     `json:"cacheCreationTokens"`
+	CacheReadTokens     int64     `json:"cacheReadTokens"`
+	ThinkingTokens      int64     `json:"thinkingTokens"`
+	Model               string    `json:"model"`
+	CostCents           int64     `json:"costCents"`
+	APIType             string    `json:"apiType"`
+}
+
+// NewHTTPSink 创建 HTTP 镜像接收端并启动后台发送协程
+func NewHTTPSink(cfg HTTPSinkConfig) *HTTPSink {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultHTTPSinkBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultHTTPSinkFlushInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultHTTPSinkTimeout
+	}
+
+	s := &HTTPSink{
+		url:           cfg.URL,
+		authToken:     cfg.AuthToken,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		client:        &http.Client{Timeout: cfg.Timeout},
+		records:       make(chan PersistentRecord, cfg.BatchSize*httpSinkBufferMultiplier),
+		stopCh:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// AddRecord 投递记录到发送缓冲区（非阻塞，缓冲区满时丢弃）
+func (s *HTTPSink) AddRecord(record PersistentRecord) {
+	if s.closed.Load() {
+		return
+	}
+	select {
+	case s.records <- record:
+	default:
+		if s.dropped.Add(1)%1000 == 1 {
+			log.Printf("[Metrics-Mirror] 警告: 镜像缓冲区已满，丢弃记录（累计 %d 条）", s.dropped.Load())
+		}
+	}
+}
+
+// Stats 返回发送统计
+func (s *HTTPSink) Stats() HTTPSinkStats {
+	return HTTPSinkStats{Sent: s.sent.Load(), Dropped: s.dropped.Load(), Failed: s.failed.Load()}
+}
+
+// Close 停止接收新记录，发送缓冲区中剩余的记录后返回
+func (s *HTTPSink) Close() error {
+	s.closeOnce.Do(func() {
+		s.closed.Store(true)
+		close(s.stopCh)
+	})
+	<-s.done
+	return nil
+}
+
+// run 后台发送循环：攒满一批或到达刷新间隔时发送
+func (s *HTTPSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]PersistentRecord, 0, s.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		s.send(batch)
+		batch = make([]PersistentRecord, 0, s.batchSize)
+	}
+
+	for {
+		select {
+		case record := <-s.records:
+			batch = append(batch, record)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.stopCh:
+			for {
+				select {
+				case record := <-s.records:
+					batch = append(batch, record)
+					if len(batch) >= s.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send POST 一批记录，失败只记录日志并计数
+func (s *HTTPSink) send(batch []PersistentRecord) {
+	if err := s.post(batch); err != nil {
+		s.failed.Add(int64(len(batch)))
+		log.Printf("[Metrics-Mirror] 警告: 发送 %d 条指标记录失败: %v", len(batch), err)
+		return
+	}
+	s.sent.Add(int64(len(batch)))
+}
+
+func (s *HTTPSink) post(batch []PersistentRecord) error {
+	records := make([]httpSinkRecord, len(batch))
+	for i, r := range batch {
+		records[i] = httpSinkRecord(r)
+	}
+	body, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.authToken)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSink_BatchesAndFlushesOnClose(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]map[string]any
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Records []map[string]any `json:"records"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		batches = append(batches, payload.Records)
+		auth = r.Header.Get("Authorization")
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(HTTPSinkConfig{URL: srv.URL, AuthToken: "tok", BatchSize: 2, FlushInterval: time.Hour})
+	for i := 0; i < 5; i++ {
+		sink.AddRecord(PersistentRecord{MetricsKey: "k", Model: "claude", InputTokens: int64(i), APIType: "messages"})
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	sink.AddRecord(PersistentRecord{MetricsKey: "late"}) // 关闭后忽略
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[2]) != 1 {
+		t.Fatalf("unexpected batches: %v", batches)
+	}
+	if batches[0][0]["model"] != "claude" || batches[0][0]["apiType"] != "messages" {
+		t.Fatalf("unexpected record payload: %v", batches[0][0])
+	}
+	if auth != "Bearer tok" {
+		t.Fatalf("authorization = %q", auth)
+	}
+	if stats := sink.Stats(); stats.Sent != 5 || stats.Dropped != 0 || stats.Failed != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestHTTPSink_FlushInterval(t *testing.T) {
+	received := make(chan int, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Records []json.RawMessage `json:"records"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		received <- len(payload.Records)
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(HTTPSinkConfig{URL: srv.URL, BatchSize: 100, FlushInterval: 20 * time.Millisecond})
+	defer sink.Close()
+	sink.AddRecord(PersistentRecord{MetricsKey: "k"})
+
+	select {
+	case n := <-received:
+		if n != 1 {
+			t.Fatalf("records = %d, want 1", n)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("partial batch was not flushed on interval")
+	}
+}
+
+func TestHTTPSink_NeverBlocksOnSlowOrFailingEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(HTTPSinkConfig{URL: srv.URL, BatchSize: 1, FlushInterval: time.Hour, Timeout: 5 * time.Second})
+
+	start := time.Now()
+	total := 1 + httpSinkBufferMultiplier + 50 // 一条在途 + 缓冲区容量 + 溢出
+	for i := 0; i < total; i++ {
+		sink.AddRecord(PersistentRecord{MetricsKey: "k"})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("AddRecord blocked for %v", elapsed)
+	}
+	if sink.Stats().Dropped == 0 {
+		t.Fatalf("expected records to be dropped when buffer is full")
+	}
+
+	close(release)
+	_ = sink.Close()
+	stats := sink.Stats()
+	if stats.Sent != 0 || stats.Failed+stats.Dropped != int64(total) {
+		t.Fatalf("stats = %+v, total = %d", stats, total)
+	}
+}
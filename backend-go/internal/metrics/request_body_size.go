@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// requestBodySizeBuckets 请求体大小直方图的桶上界（字节，含上界），超出最后一个上界的计入 +Inf
+var requestBodySizeBuckets = [...]struct {
+	label string
+	upper int64
+}{
+	{"1KB", 1 << 10},
+	{"10KB", 10 << 10},
+	{"100KB", 100 << 10},
+	{"1MB", 1 << 20},
+	{"5MB", 5 << 20},
+	{"10MB", 10 << 20},
+	{"50MB", 50 << 20},
+}
+
+const (
+	maxOversizedClients = 100 // 按客户端统计超限拒绝的最大客户端数，超出后计入 "other"
+	maxRecentOversized  = 20  // 保留的最近超限请求数
+)
+
+// RequestBodySizeBucket 请求体大小直方图的一个桶（Count 为落入该区间的请求数，非累计）
+type RequestBodySizeBucket struct {
+	Le         string `json:"le"`         // 桶上界（含），最后一个桶为 +Inf
+	UpperBytes int64  `json:"upperBytes"` // 桶上界字节数（+Inf 为 0）
+	Count      int64  `json:"count"`
+}
+
+// OversizedRequest 一次因请求体过大被拒绝的请求
+type OversizedRequest struct {
+	Time       time.Time `json:"time"`
+	ClientIP   string    `json:"clientIp"`
+	Path       string    `json:"path"`
+	SizeBytes  int64     `json:"sizeBytes"`
+	LimitBytes int64     `json:"limitBytes"`
+}
+
+// RequestBodySizeStats 请求体大小分布与超限拒绝统计（进程内累计，重启后清零）
+type RequestBodySizeStats struct {
+	Since               *time.Time              `json:"since,omitempty"` // 首次记录时间
+	TotalRequests       int64                   `json:"totalRequests"`
+	TotalBytes          int64                   `json:"totalBytes"`
+	MaxBytes            int64                   `json:"maxBytes"`
+	Buckets             []RequestBodySizeBucket `json:"buckets"`
+	OversizedRejections int64                   `json:"oversizedRejections"`
+	OversizedByClient   map[string]int64        `json:"oversizedByClient"`
+	RecentOversized     []OversizedRequest      `json:"recentOversized"` // 按时间倒序
+}
+
+// requestBodySizeTracker 请求体大小统计（独立锁，零值可用）
+type requestBodySizeTracker struct {
+	mu                sync.Mutex
+	since             time.Time
+	totalRequests     int64
+	totalBytes        int64
+	maxBytes          int64
+	counts            [len(requestBodySizeBuckets) + 1]int64
+	oversized         int64
+	oversizedByClient map[string]int64
+	recentOversized   []OversizedRequest
+}
+
+func (t *requestBodySizeTracker) recordSizeLocked(size int64) {
+	if t.since.IsZero() {
+		t.since = time.Now()
+	}
+	t.totalRequests++
+	t.totalBytes += size
+	if size > t.maxBytes {
+		t.maxBytes = size
+	}
+	bucket := len(requestBodySizeBuckets)
+	for i, b := range requestBodySizeBuckets {
+		if size <= b.upper {
+			bucket = i
+			break
+		}
+	}
+	t.counts[bucket]++
+}
+
+// RecordRequestBodySize 记录一次已接受的请求体大小
+func (m *MetricsManager) RecordRequestBodySize(size int64) {
+	t := &m.requestBodySizes
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recordSizeLocked(size)
+}
+
+// RecordOversizedRequest 记录一次因请求体过大被拒绝的请求（同时计入大小直方图）
+func (m *MetricsManager) RecordOversizedRequest(clientIP, path string, size, limit int64) {
+	t := &m.requestBodySizes
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.recordSizeLocked(size)
+	t.oversized++
+	if t.oversizedByClient == nil {
+		t.oversizedByClient = make(map[string]int64)
+	}
+	if _, ok := t.oversizedByClient[clientIP]; !ok && len(t.oversizedByClient) >= maxOversizedClients {
+		clientIP = "other"
+	}
+	t.oversizedByClient[clientIP]++
+
+	t.recentOversized = append(t.recentOversized, OversizedRequest{
+		Time:       time.Now(),
+		ClientIP:   clientIP,
+		Path:       path,
+		SizeBytes:  size,
+		LimitBytes: limit,
+	})
+	if len(t.recentOversized) > maxRecentOversized {
+		t.recentOversized = t.recentOversized[len(t.recentOversized)-maxRecentOversized:]
+	}
+}
+
+// GetRequestBodySizeStats 获取请求体大小直方图与超限拒绝统计
+func (m *MetricsManager) GetRequestBodySizeStats() RequestBodySizeStats {
+	t := &m.requestBodySizes
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := RequestBodySizeStats{
+		TotalRequests:       t.totalRequests,
+		TotalBytes:          t.totalBytes,
+		MaxBytes:            t.maxBytes,
+		Buckets:             make([]RequestBodySizeBucket, 0, len(t.counts)),
+		OversizedRejections: t.oversized,
+		OversizedByClient:   make(map[string]int64, len(t.oversizedByClient)),
+		RecentOversized:     make([]OversizedRequest, 0, len(t.recentOversized)),
+	}
+	for i, b := range requestBodySizeBuckets {
+		stats.Buckets = append(stats.Buckets, RequestBodySizeBucket{Le: b.label, UpperBytes: b.upper, Count: t.counts[i]})
+	}
+	stats.Buckets = append(stats.Buckets, RequestBodySizeBucket{Le: "+Inf", Count: t.counts[len(requestBodySizeBuckets)]})
+	for client, n := range t.oversizedByClient {
+		stats.OversizedByClient[client] = n
+	}
+	stats.RecentOversized = append(stats.RecentOversized, t.recentOversized...)
+	slices.Reverse(stats.RecentOversized)
+	if !t.since.IsZero() {
+		since := t.since
+		stats.Since = &since
+	}
+	return stats
+}
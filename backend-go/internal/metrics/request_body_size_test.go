@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRequestBodySizeStats_Buckets(t *testing.T) {
+	m := NewMetricsManager()
+	defer m.Stop()
+
+	if stats := m.GetRequestBodySizeStats(); stats.Since != nil || stats.TotalRequests != 0 || len(stats.Buckets) != 8 {
+		t.Fatalf("空统计 = %+v", stats)
+	}
+
+	// 桶上界含边界值
+	for _, size := range []int64{0, 1 << 10, 1<<10 + 1, 2 << 20, 50 << 20, 50<<20 + 1} {
+		m.RecordRequestBodySize(size)
+	}
+	stats := m.GetRequestBodySizeStats()
+	want := map[string]int64{"1KB": 2, "10KB": 1, "5MB": 1, "50MB": 1, "+Inf": 1}
+	for _, b := range stats.Buckets {
+		if b.Count != want[b.Le] {
+			t.Fatalf("bucket %s = %d, want %d (buckets %+v)", b.Le, b.Count, want[b.Le], stats.Buckets)
+		}
+	}
+	if stats.Since == nil || stats.TotalRequests != 6 || stats.MaxBytes != 50<<20+1 || stats.OversizedRejections != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestRecordOversizedRequest_BoundedPerClientAndRecent(t *testing.T) {
+	m := NewMetricsManager()
+	defer m.Stop()
+
+	for i := 0; i < maxOversizedClients+5; i++ {
+		m.RecordOversizedRequest(fmt.Sprintf("10.0.0.%d", i), "/v1/messages", int64(100+i), 10)
+	}
+	m.RecordOversizedRequest("10.0.0.0", "/v1/responses", 999, 10)
+
+	stats := m.GetRequestBodySizeStats()
+	if stats.OversizedRejections != maxOversizedClients+6 || stats.TotalRequests != maxOversizedClients+6 {
+		t.Fatalf("oversized = %d, total = %d", stats.OversizedRejections, stats.TotalRequests)
+	}
+	if len(stats.OversizedByClient) != maxOversizedClients+1 || stats.OversizedByClient["other"] != 5 || stats.OversizedByClient["10.0.0.0"] != 2 {
+		t.Fatalf("byClient size = %d, other = %d, first = %d", len(stats.OversizedByClient), stats.OversizedByClient["other"], stats.OversizedByClient["10.0.0.0"])
+	}
+	if len(stats.RecentOversized) != maxRecentOversized {
+		t.Fatalf("recent = %d, want %d", len(stats.RecentOversized), maxRecentOversized)
+	}
+	if latest := stats.RecentOversized[0]; latest.Path != "/v1/responses" || latest.SizeBytes != 999 || latest.LimitBytes != 10 {
+		t.Fatalf("latest = %+v", latest)
+	}
+}
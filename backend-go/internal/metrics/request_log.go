@@ -23,6 +23,15 @@ type RequestLogRecord struct {
 	APIType             string    `json:"apiType"` // messages, responses, gemini
 }
 
+// RequestLogFilter 请求日志过滤条件（零值字段表示不过滤）
+type RequestLogFilter struct {
+	ChannelIndex *int   // 渠道索引
+	Success      *bool  // 是否成功
+	StatusMin    int    // 状态码下限（含）
+	StatusMax    int    // 状态码上限（含）
+	KeyMask      string // 脱敏密钥（精确匹配）
+}
+
 // RequestLogsResponse API 响应
 type RequestLogsResponse struct {
 	Logs   []RequestLogRecord `json:"logs"`
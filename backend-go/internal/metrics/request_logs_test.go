@@ -139,3 +139,59 @@ func TestSQLiteStore_AddRequestLog_Validation(t *testing.T) {
 		t.Fatalf("AddRequestLog(empty api_type) err = nil, want error")
 	}
 }
+
+func TestSQLiteStore_QueryRequestLogsFiltered(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	base := time.Now().Add(-time.Hour)
+	for i, rec := range []RequestLogRecord{
+		{RequestID: "ok-0", ChannelIndex: 0, KeyMask: "sk-a", StatusCode: 200, Success: true},
+		{RequestID: "fail-0", ChannelIndex: 0, KeyMask: "sk-a", StatusCode: 429},
+		{RequestID: "fail-2a", ChannelIndex: 2, KeyMask: "sk-b", StatusCode: 502},
+		{RequestID: "fail-2b", ChannelIndex: 2, KeyMask: "sk-c", StatusCode: 500},
+		{RequestID: "other-api", ChannelIndex: 2, KeyMask: "sk-b", StatusCode: 500, APIType: "responses"},
+	} {
+		rec.ChannelName = "ch"
+		rec.Timestamp = base.Add(time.Duration(i) * time.Minute)
+		if rec.APIType == "" {
+			rec.APIType = "messages"
+		}
+		if err := store.AddRequestLog(rec); err != nil {
+			t.Fatalf("AddRequestLog(%s) err = %v", rec.RequestID, err)
+		}
+	}
+
+	channel2, failed := 2, false
+	tests := []struct {
+		name   string
+		filter RequestLogFilter
+		want   []string
+	}{
+		{name: "no filter", filter: RequestLogFilter{}, want: []string{"fail-2b", "fail-2a", "fail-0", "ok-0"}},
+		{name: "channel and failed", filter: RequestLogFilter{ChannelIndex: &channel2, Success: &failed}, want: []string{"fail-2b", "fail-2a"}},
+		{name: "status range", filter: RequestLogFilter{StatusMin: 400, StatusMax: 499}, want: []string{"fail-0"}},
+		{name: "server errors", filter: RequestLogFilter{StatusMin: 500}, want: []string{"fail-2b", "fail-2a"}},
+		{name: "key mask", filter: RequestLogFilter{KeyMask: "sk-b"}, want: []string{"fail-2a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, total, err := store.QueryRequestLogsFiltered("messages", tt.filter, 50, 0)
+			if err != nil {
+				t.Fatalf("QueryRequestLogsFiltered() err = %v", err)
+			}
+			if total != int64(len(tt.want)) || len(logs) != len(tt.want) {
+				t.Fatalf("total=%d len=%d, want %d", total, len(logs), len(tt.want))
+			}
+			for i, id := range tt.want {
+				if logs[i].RequestID != id {
+					t.Fatalf("logs[%d] = %s, want %s", i, logs[i].RequestID, id)
+				}
+			}
+		})
+	}
+
+	// total 为满足条件的总数，不受分页影响
+	logs, total, err := store.QueryRequestLogsFiltered("messages", RequestLogFilter{Success: &failed}, 1, 1)
+	if err != nil || total != 3 || len(logs) != 1 || logs[0].RequestID != "fail-2a" {
+		t.Fatalf("paged = %+v total=%d err=%v", logs, total, err)
+	}
+}
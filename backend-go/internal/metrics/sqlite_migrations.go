@@ -0,0 +1,251 @@
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// schemaMigration 一次版本化的 schema 变更
+// 每个迁移都必须幂等：在部分已迁移（如引入版本表之前按旧方式建的库）或重复执行时都应成功
+type schemaMigration struct {
+	Version     int
+	Description string
+	Apply       func(tx *sql.Tx) error
+}
+
+// schemaMigrations 按版本升序排列的迁移列表；新增列或表时在末尾追加新版本，不要修改已发布的迁移
+var schemaMigrations = []schemaMigration{
+	{Version: 1, Description: "基础表结构（request_records/daily_stats/request_logs/trace_affinity）", Apply: migrateBaseSchema},
+	{Version: 2, Description: "批处理渠道绑定表（batch_bindings）", Apply: migrateBatchBindings},
+}
+
+// migrateSchema 打开数据库时执行尚未应用的迁移，每个迁移在独立事务中执行并记录到 schema_version
+func migrateSchema(db *sql.DB) error {
+	return runSchemaMigrations(db, schemaMigrations)
+}
+
+// runSchemaMigrations 按版本顺序执行 migrations 中高于当前版本的迁移
+func runSchemaMigrations(db *sql.DB, migrations []schemaMigration) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL DEFAULT '',
+			applied_at INTEGER NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 schema_version 表失败: %w", err)
+	}
+
+	current, err := currentSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].Version; current > latest {
+		// 数据库由更新版本的程序创建：已知的表结构仍然兼容（迁移只追加），继续运行
+		log.Printf("[SQLite-Migrate] 警告: 数据库 schema 版本 %d 高于当前程序支持的版本 %d", current, latest)
+		return nil
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := applySchemaMigration(db, m); err != nil {
+			return fmt.Errorf("schema 迁移 v%d（%s）失败: %w", m.Version, m.Description, err)
+		}
+		log.Printf("[SQLite-Migrate] 已应用 schema 迁移 v%d: %s", m.Version, m.Description)
+	}
+	return nil
+}
+
+// applySchemaMigration 在事务中执行单个迁移并记录版本
+func applySchemaMigration(db *sql.DB, m schemaMigration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := m.Apply(tx); err != nil {
+		return err
+	}
+	// 多个实例同时打开同一数据库时可能重复执行同一迁移（迁移本身幂等），记录版本时覆盖即可
+	if _, err := tx.Exec(
+		"INSERT OR REPLACE INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Description, time.Now().Unix(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// currentSchemaVersion 读取已应用的最高 schema 版本（未应用任何迁移时为 0）
+func currentSchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("读取 schema 版本失败: %w", err)
+	}
+	return version, nil
+}
+
+// ensureColumn 列不存在时添加（用于让迁移在旧库上保持幂等）
+func ensureColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// baseSchemaSQL v1 基础表结构
+const baseSchemaSQL = `
+	-- 请求记录表
+	CREATE TABLE IF NOT EXISTS request_records (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		metrics_key TEXT NOT NULL,
+		base_url TEXT NOT NULL,
+		key_mask TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		success INTEGER NOT NULL,
+		input_tokens INTEGER DEFAULT 0,
+		output_tokens INTEGER DEFAULT 0,
+		cache_creation_tokens INTEGER DEFAULT 0,
+		cache_read_tokens INTEGER DEFAULT 0,
+		model TEXT DEFAULT '',
+		cost_cents INTEGER DEFAULT 0,
+		api_type TEXT NOT NULL DEFAULT 'messages',
+		thinking_tokens INTEGER DEFAULT 0
+	);
+
+	-- 索引：按 api_type 和时间查询
+	CREATE INDEX IF NOT EXISTS idx_records_api_type_timestamp
+		ON request_records(api_type, timestamp);
+
+	-- 索引：按 metrics_key 查询
+	CREATE INDEX IF NOT EXISTS idx_records_metrics_key
+		ON request_records(metrics_key);
+
+	-- 每日预聚合统计表（用于周/月查询加速）
+	CREATE TABLE IF NOT EXISTS daily_stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		date TEXT NOT NULL,                    -- YYYY-MM-DD (本地日历日)
+		api_type TEXT NOT NULL,                -- messages/responses
+		metrics_key TEXT NOT NULL,             -- hash(baseURL + apiKey)
+		base_url TEXT NOT NULL,
+		key_mask TEXT NOT NULL,
+		total_requests INTEGER DEFAULT 0,
+		success_count INTEGER DEFAULT 0,
+		failure_count INTEGER DEFAULT 0,
+		input_tokens INTEGER DEFAULT 0,
+		output_tokens INTEGER DEFAULT 0,
+		cache_creation_tokens INTEGER DEFAULT 0,
+		cache_read_tokens INTEGER DEFAULT 0,
+		cost_cents INTEGER DEFAULT 0,
+		thinking_tokens INTEGER DEFAULT 0,
+		UNIQUE(date, api_type, metrics_key)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_daily_stats_date_api
+		ON daily_stats(date, api_type);
+
+	-- 请求日志表（仅保留 24 小时，用于排障/审计）
+	CREATE TABLE IF NOT EXISTS request_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_id TEXT NOT NULL,
+		channel_index INTEGER NOT NULL,
+		channel_name TEXT NOT NULL,
+		key_mask TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		status_code INTEGER NOT NULL,
+		success INTEGER NOT NULL,
+		model TEXT DEFAULT '',
+		input_tokens INTEGER DEFAULT 0,
+		output_tokens INTEGER DEFAULT 0,
+		cache_creation_tokens INTEGER DEFAULT 0,
+		cache_read_tokens INTEGER DEFAULT 0,
+		cost_cents INTEGER DEFAULT 0,
+		error_message TEXT DEFAULT '',
+		api_type TEXT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_request_logs_api_type_timestamp
+		ON request_logs(api_type, timestamp DESC);
+
+	CREATE INDEX IF NOT EXISTS idx_request_logs_request_id
+		ON request_logs(request_id);
+
+	-- Trace 亲和记录表（可选持久化，跨重启保持会话与渠道的绑定）
+	CREATE TABLE IF NOT EXISTS trace_affinity (
+		user_id TEXT PRIMARY KEY,
+		channel_index INTEGER NOT NULL,
+		last_used_at INTEGER NOT NULL,
+		created_at INTEGER DEFAULT 0
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_trace_affinity_last_used
+		ON trace_affinity(last_used_at);
+`
+
+// migrateBaseSchema v1：建表建索引，并为引入版本表之前按旧方式创建的数据库补齐后来新增的列
+func migrateBaseSchema(tx *sql.Tx) error {
+	if _, err := tx.Exec(baseSchemaSQL); err != nil {
+		return err
+	}
+	for _, col := range []struct{ table, column, definition string }{
+		{"request_records", "model", "TEXT DEFAULT ''"},
+		{"request_records", "cost_cents", "INTEGER DEFAULT 0"},
+		{"request_records", "thinking_tokens", "INTEGER DEFAULT 0"},
+		{"daily_stats", "cost_cents", "INTEGER DEFAULT 0"},
+		{"daily_stats", "thinking_tokens", "INTEGER DEFAULT 0"},
+		{"trace_affinity", "created_at", "INTEGER DEFAULT 0"},
+	} {
+		if err := ensureColumn(tx, col.table, col.column, col.definition); err != nil {
+			return fmt.Errorf("补齐 %s.%s 失败: %w", col.table, col.column, err)
+		}
+	}
+	return nil
+}
+
+// migrateBatchBindings v2：批处理与创建渠道的绑定表（跨重启保持 batch → 渠道映射，避免逐渠道探测）
+func migrateBatchBindings(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS batch_bindings (
+			batch_id TEXT PRIMARY KEY,
+			channel_name TEXT NOT NULL,
+			base_url TEXT NOT NULL DEFAULT '',
+			key_hash TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_batch_bindings_created_at
+			ON batch_bindings(created_at);
+	`)
+	return err
+}
@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func tableColumns(t *testing.T, db *sql.DB, table string) map[string]bool {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatalf("table_info(%s): %v", table, err)
+	}
+	defer rows.Close()
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("scan column: %v", err)
+		}
+		cols[name] = true
+	}
+	return cols
+}
+
+func TestSQLiteStore_MigratesFreshDatabase(t *testing.T) {
+	dbPath := t.TempDir() + "/metrics.db"
+	store, err := NewSQLiteStore(&SQLiteStoreConfig{DBPath: dbPath, RetentionDays: 7})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() err = %v", err)
+	}
+	version, err := currentSchemaVersion(store.db)
+	if err != nil || version != schemaMigrations[len(schemaMigrations)-1].Version {
+		t.Fatalf("schema version = %d, err = %v", version, err)
+	}
+	var appliedAt int64
+	if err := store.db.QueryRow("SELECT applied_at FROM schema_version WHERE version = 1").Scan(&appliedAt); err != nil {
+		t.Fatalf("query schema_version: %v", err)
+	}
+	_ = store.Close()
+
+	// 重新打开不会重复执行已应用的迁移
+	store, err = NewSQLiteStore(&SQLiteStoreConfig{DBPath: dbPath, RetentionDays: 7})
+	if err != nil {
+		t.Fatalf("reopen err = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	var count int
+	var reopenedAt int64
+	if err := store.db.QueryRow("SELECT COUNT(*), MAX(applied_at) FROM schema_version").Scan(&count, &reopenedAt); err != nil {
+		t.Fatalf("query schema_version: %v", err)
+	}
+	if count != len(schemaMigrations) || reopenedAt != appliedAt {
+		t.Fatalf("schema_version rows = %d (applied_at %d -> %d), want unchanged", count, appliedAt, reopenedAt)
+	}
+
+	stats, err := store.GetStorageStats()
+	if err != nil || stats.SchemaVersion != version {
+		t.Fatalf("GetStorageStats() schemaVersion = %d, err = %v", stats.SchemaVersion, err)
+	}
+}
+
+func TestSQLiteStore_UpgradesLegacyDatabase(t *testing.T) {
+	dbPath := t.TempDir() + "/metrics.db"
+	ts := time.Now().Add(-time.Hour).Unix()
+
+	// 最早版本的表结构：没有 model/cost_cents/thinking_tokens 列，也没有 schema_version 表
+	legacy, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open legacy db: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE request_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			metrics_key TEXT NOT NULL,
+			base_url TEXT NOT NULL,
+			key_mask TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			success INTEGER NOT NULL,
+			input_tokens INTEGER DEFAULT 0,
+			output_tokens INTEGER DEFAULT 0,
+			cache_creation_tokens INTEGER DEFAULT 0,
+			cache_read_tokens INTEGER DEFAULT 0,
+			api_type TEXT NOT NULL DEFAULT 'messages'
+		)`,
+		`CREATE TABLE daily_stats (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			date TEXT NOT NULL,
+			api_type TEXT NOT NULL,
+			metrics_key TEXT NOT NULL,
+			base_url TEXT NOT NULL,
+			key_mask TEXT NOT NULL,
+			total_requests INTEGER DEFAULT 0,
+			success_count INTEGER DEFAULT 0,
+			failure_count INTEGER DEFAULT 0,
+			input_tokens INTEGER DEFAULT 0,
+			output_tokens INTEGER DEFAULT 0,
+			cache_creation_tokens INTEGER DEFAULT 0,
+			cache_read_tokens INTEGER DEFAULT 0,
+			UNIQUE(date, api_type, metrics_key)
+		)`,
+		`CREATE TABLE trace_affinity (
+			user_id TEXT PRIMARY KEY,
+			channel_index INTEGER NOT NULL,
+			last_used_at INTEGER NOT NULL
+		)`,
+	} {
+		if _, err = legacy.Exec(stmt); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		_, err = legacy.Exec(`INSERT INTO request_records (metrics_key, base_url, key_mask, timestamp, success, input_tokens, output_tokens)
+			VALUES ('mk', 'https://example.com', 'sk-***', ?, 1, 12, 34)`, ts)
+	}
+	_ = legacy.Close()
+	if err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	store, err := NewSQLiteStore(&SQLiteStoreConfig{DBPath: dbPath, RetentionDays: 7})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() on legacy db err = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	for table, want := range map[string][]string{
+		"request_records": {"model", "cost_cents", "thinking_tokens"},
+		"daily_stats":     {"cost_cents", "thinking_tokens"},
+		"trace_affinity":  {"created_at"},
+	} {
+		cols := tableColumns(t, store.db, table)
+		for _, col := range want {
+			if !cols[col] {
+				t.Fatalf("%s missing column %s after upgrade: %v", table, col, cols)
+			}
+		}
+	}
+	if cols := tableColumns(t, store.db, "request_logs"); !cols["request_id"] {
+		t.Fatalf("request_logs not created: %v", cols)
+	}
+	if version, _ := currentSchemaVersion(store.db); version != schemaMigrations[len(schemaMigrations)-1].Version {
+		t.Fatalf("schema version = %d, want %d", version, schemaMigrations[len(schemaMigrations)-1].Version)
+	}
+
+	records, err := store.LoadRecords(time.Unix(ts, 0).Add(-time.Minute), "messages")
+	if err != nil {
+		t.Fatalf("LoadRecords() err = %v", err)
+	}
+	if len(records) != 1 || records[0].InputTokens != 12 || records[0].OutputTokens != 34 || records[0].Model != "" || records[0].CostCents != 0 {
+		t.Fatalf("legacy records = %+v", records)
+	}
+}
+
+func TestRunSchemaMigrations_OrderingAndRollback(t *testing.T) {
+	db, err := sql.Open("sqlite", t.TempDir()+"/migrate.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var calls []int
+	migrations := []schemaMigration{
+		{Version: 1, Description: "create", Apply: func(tx *sql.Tx) error {
+			calls = append(calls, 1)
+			_, err := tx.Exec("CREATE TABLE IF NOT EXISTS t (id INTEGER PRIMARY KEY)")
+			return err
+		}},
+		{Version: 2, Description: "add column", Apply: func(tx *sql.Tx) error {
+			calls = append(calls, 2)
+			return ensureColumn(tx, "t", "name", "TEXT DEFAULT ''")
+		}},
+	}
+	if err := runSchemaMigrations(db, migrations); err != nil {
+		t.Fatalf("runSchemaMigrations() err = %v", err)
+	}
+	if err := runSchemaMigrations(db, migrations); err != nil {
+		t.Fatalf("second run err = %v", err)
+	}
+	if len(calls) != 2 || calls[0] != 1 || calls[1] != 2 {
+		t.Fatalf("migration calls = %v, want [1 2] exactly once", calls)
+	}
+
+	// 失败的迁移整体回滚，不记录版本，下次打开时重试
+	failing := append(migrations, schemaMigration{Version: 3, Description: "broken", Apply: func(tx *sql.Tx) error {
+		if _, err := tx.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	}})
+	if err := runSchemaMigrations(db, failing); err == nil {
+		t.Fatalf("expected error from failing migration")
+	}
+	if version, _ := currentSchemaVersion(db); version != 2 {
+		t.Fatalf("schema version = %d after failed migration, want 2", version)
+	}
+	if cols := tableColumns(t, db, "half_done"); len(cols) != 0 {
+		t.Fatalf("failed migration was not rolled back: %v", cols)
+	}
+
+	// 数据库版本高于程序已知版本时不报错（迁移只追加，旧程序仍可读写已知的表）
+	if err := runSchemaMigrations(db, migrations[:1]); err != nil {
+		t.Fatalf("newer database version should be tolerated, err = %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HourWindow 本地时间的小时时段 [Start, End)，支持跨零点（如 22-6）
+type HourWindow struct {
+	Start int
+	End   int
+}
+
+// ParseHourWindow 解析 "2-5" 格式的时段，空字符串返回 nil（表示不限时段）
+func ParseHourWindow(s string) (*HourWindow, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	startStr, endStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("时段格式应为 起始小时-结束小时（如 2-5）: %q", s)
+	}
+	start, err1 := strconv.Atoi(strings.TrimSpace(startStr))
+	end, err2 := strconv.Atoi(strings.TrimSpace(endStr))
+	if err1 != nil || err2 != nil || start < 0 || start > 23 || end < 0 || end > 24 || start == end {
+		return nil, fmt.Errorf("无效的时段 %q: 小时范围为 0-24 且起止不能相同", s)
+	}
+	return &HourWindow{Start: start, End: end % 24}, nil
+}
+
+// Contains 判断时间是否落在时段内（nil 表示不限时段）
+func (w *HourWindow) Contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	h := t.Hour()
+	if w.Start < w.End {
+		return h >= w.Start && h < w.End
+	}
+	return h >= w.Start || h < w.End
+}
+
+// String 返回 "2-5" 格式，nil 返回空字符串
+func (w *HourWindow) String() string {
+	if w == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", w.Start, w.End)
+}
+
+// storageStatsTables 存储统计中统计行数的表
+var storageStatsTables = []string{"request_records", "request_logs", "daily_stats", "trace_affinity", "batch_bindings"}
+
+// StorageStats 指标数据库的存储占用与维护状态（用于监控数据库增长）
+type StorageStats struct {
+	DBPath        string           `json:"dbPath"`
+	FileSizeBytes int64            `json:"fileSizeBytes"` // 主库文件大小
+	WALSizeBytes  int64            `json:"walSizeBytes"`  // WAL 文件大小
+	PageSize      int64            `json:"pageSize"`
+	PageCount     int64            `json:"pageCount"`
+	FreelistCount int64            `json:"freelistCount"` // 可回收的空闲页数
+	RowCounts     map[string]int64 `json:"rowCounts"`
+	SchemaVersion int              `json:"schemaVersion"` // 已应用的 schema 迁移版本
+
+	RetentionDays            int     `json:"retentionDays"`
+	RequestLogRetentionHours float64 `json:"requestLogRetentionHours"`
+	DailyStatsRetentionDays  int     `json:"dailyStatsRetentionDays"` // 0 表示永久保留
+	VacuumIntervalHours      float64 `json:"vacuumIntervalHours"`     // 0 表示禁用空间回收
+	VacuumWindow             string  `json:"vacuumWindow,omitempty"`
+
+	LastCleanup *time.Time `json:"lastCleanup,omitempty"`
+	LastVacuum  *time.Time `json:"lastVacuum,omitempty"`
+}
+
+// GetStorageStats 获取数据库文件大小、页统计与各表行数
+func (s *SQLiteStore) GetStorageStats() (StorageStats, error) {
+	stats := StorageStats{
+		DBPath:                   s.dbPath,
+		FileSizeBytes:            statSize(s.dbPath),
+		WALSizeBytes:             statSize(s.dbPath + "-wal"),
+		RowCounts:                make(map[string]int64, len(storageStatsTables)),
+		RetentionDays:            s.retentionDays,
+		RequestLogRetentionHours: s.requestLogRetention.Hours(),
+		DailyStatsRetentionDays:  s.dailyStatsRetentionDays,
+		VacuumIntervalHours:      s.vacuumInterval.Hours(),
+		VacuumWindow:             s.vacuumWindow.String(),
+	}
+
+	for pragma, dest := range map[string]*int64{
+		"page_size":      &stats.PageSize,
+		"page_count":     &stats.PageCount,
+		"freelist_count": &stats.FreelistCount,
+	} {
+		if err := s.db.QueryRow("PRAGMA " + pragma).Scan(dest); err != nil {
+			return stats, fmt.Errorf("读取 %s 失败: %w", pragma, err)
+		}
+	}
+	for _, table := range storageStatsTables {
+		var count int64
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			return stats, fmt.Errorf("统计 %s 行数失败: %w", table, err)
+		}
+		stats.RowCounts[table] = count
+	}
+	version, err := currentSchemaVersion(s.db)
+	if err != nil {
+		return stats, err
+	}
+	stats.SchemaVersion = version
+
+	s.maintMu.Lock()
+	if !s.lastCleanup.IsZero() {
+		t := s.lastCleanup
+		stats.LastCleanup = &t
+	}
+	if !s.lastReclaim.IsZero() {
+		t := s.lastReclaim
+		stats.LastVacuum = &t
+	}
+	s.maintMu.Unlock()
+
+	return stats, nil
+}
@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHourWindow(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "2-5", want: "2-5"},
+		{in: " 22 - 6 ", want: "22-6"},
+		{in: "0-24", want: "0-0"},
+		{in: "3", wantErr: true},
+		{in: "5-5", wantErr: true},
+		{in: "25-3", wantErr: true},
+		{in: "a-b", wantErr: true},
+	}
+	for _, tt := range tests {
+		w, err := ParseHourWindow(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseHourWindow(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if err == nil && w.String() != tt.want {
+			t.Fatalf("ParseHourWindow(%q) = %q, want %q", tt.in, w.String(), tt.want)
+		}
+	}
+}
+
+func TestHourWindow_Contains(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2026, 1, 1, h, 30, 0, 0, time.Local) }
+
+	night, _ := ParseHourWindow("2-5")
+	if !night.Contains(at(2)) || !night.Contains(at(4)) || night.Contains(at(5)) || night.Contains(at(1)) {
+		t.Fatalf("window 2-5 boundaries wrong")
+	}
+	wrap, _ := ParseHourWindow("22-3")
+	if !wrap.Contains(at(23)) || !wrap.Contains(at(0)) || wrap.Contains(at(3)) || wrap.Contains(at(12)) {
+		t.Fatalf("window 22-3 boundaries wrong")
+	}
+	allDay, _ := ParseHourWindow("0-24")
+	if !allDay.Contains(at(0)) || !allDay.Contains(at(23)) {
+		t.Fatalf("window 0-24 should contain every hour")
+	}
+	var none *HourWindow
+	if !none.Contains(at(12)) {
+		t.Fatalf("nil window should contain every hour")
+	}
+}
+
+func insertDailyStat(t *testing.T, store *SQLiteStore, date string) {
+	t.Helper()
+	if _, err := store.db.Exec(`
+		INSERT INTO daily_stats (date, api_type, metrics_key, base_url, key_mask, total_requests)
+		VALUES (?, 'messages', 'k1', 'https://api.example.com', 'sk-***', 1)
+	`, date); err != nil {
+		t.Fatalf("insert daily_stats err = %v", err)
+	}
+}
+
+func insertRequestLog(t *testing.T, store *SQLiteStore, requestID string, ts time.Time) {
+	t.Helper()
+	if _, err := store.db.Exec(`
+		INSERT INTO request_logs (
+			request_id, channel_index, channel_name, key_mask,
+			timestamp, duration_ms, status_code, success, api_type
+		) VALUES (?, 0, 'c', 'sk-***', ?, 1, 200, 1, 'messages')
+	`, requestID, ts.Unix()); err != nil {
+		t.Fatalf("insert request_logs err = %v", err)
+	}
+}
+
+func TestSQLiteStore_PerTableRetention(t *testing.T) {
+	store, err := NewSQLiteStore(&SQLiteStoreConfig{
+		DBPath:                  t.TempDir() + "/metrics.db",
+		RetentionDays:           7,
+		RequestLogRetention:     72 * time.Hour,
+		DailyStatsRetentionDays: 30,
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() err = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	now := time.Now()
+	insertRequestLog(t, store, "recent", now.Add(-25*time.Hour))
+	insertRequestLog(t, store, "expired", now.Add(-80*time.Hour))
+	insertDailyStat(t, store, now.AddDate(0, 0, -10).Format("2006-01-02"))
+	insertDailyStat(t, store, now.AddDate(0, 0, -40).Format("2006-01-02"))
+	if err := store.batchInsertRecords([]PersistentRecord{
+		{MetricsKey: "k1", BaseURL: "https://api.example.com", KeyMask: "sk-***", Timestamp: now.AddDate(0, 0, -2), Success: true, APIType: "messages"},
+		{MetricsKey: "k1", BaseURL: "https://api.example.com", KeyMask: "sk-***", Timestamp: now.AddDate(0, 0, -8), Success: true, APIType: "messages"},
+	}); err != nil {
+		t.Fatalf("batchInsertRecords() err = %v", err)
+	}
+
+	store.doCleanup()
+
+	stats, err := store.GetStorageStats()
+	if err != nil {
+		t.Fatalf("GetStorageStats() err = %v", err)
+	}
+	for table, want := range map[string]int64{"request_records": 1, "request_logs": 1, "daily_stats": 1, "trace_affinity": 0} {
+		if got := stats.RowCounts[table]; got != want {
+			t.Fatalf("%s rows = %d, want %d", table, got, want)
+		}
+	}
+	if stats.RequestLogRetentionHours != 72 || stats.DailyStatsRetentionDays != 30 || stats.RetentionDays != 7 {
+		t.Fatalf("unexpected retention settings: %+v", stats)
+	}
+	if stats.FileSizeBytes <= 0 || stats.PageCount <= 0 || stats.PageSize <= 0 {
+		t.Fatalf("unexpected size stats: %+v", stats)
+	}
+	if stats.LastCleanup == nil || stats.LastVacuum != nil {
+		t.Fatalf("lastCleanup = %v, lastVacuum = %v", stats.LastCleanup, stats.LastVacuum)
+	}
+}
+
+func TestSQLiteStore_RetentionDefaults(t *testing.T) {
+	store, err := NewSQLiteStore(&SQLiteStoreConfig{
+		DBPath:                  t.TempDir() + "/metrics.db",
+		RetentionDays:           14,
+		DailyStatsRetentionDays: 5, // 短于明细保留天数时提升到 RetentionDays
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() err = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	if store.requestLogRetention != defaultRequestLogRetention {
+		t.Fatalf("requestLogRetention = %v, want %v", store.requestLogRetention, defaultRequestLogRetention)
+	}
+	if store.dailyStatsRetentionDays != 14 {
+		t.Fatalf("dailyStatsRetentionDays = %d, want 14", store.dailyStatsRetentionDays)
+	}
+
+	// 0 表示永久保留每日汇总
+	forever := newTestSQLiteStore(t)
+	insertDailyStat(t, forever, "2000-01-01")
+	forever.doCleanup()
+	if stats, _ := forever.GetStorageStats(); stats.RowCounts["daily_stats"] != 1 {
+		t.Fatalf("daily_stats rows = %d, want 1 (keep forever)", stats.RowCounts["daily_stats"])
+	}
+}
+
+func TestSQLiteStore_VacuumWaitsForWindow(t *testing.T) {
+	now := time.Now()
+	outside := &HourWindow{Start: (now.Hour() + 1) % 24, End: (now.Hour() + 2) % 24}
+	store, err := NewSQLiteStore(&SQLiteStoreConfig{
+		DBPath:         t.TempDir() + "/metrics.db",
+		RetentionDays:  7,
+		VacuumInterval: time.Hour,
+		VacuumWindow:   outside,
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() err = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	fillAndDeleteRecords(t, store, 5000)
+	full := store.fileSize()
+
+	// 回收已到期但不在时段内：不执行，保持到期状态
+	store.lastVacuum = now.Add(-2 * time.Hour)
+	store.doCleanup()
+	if _, err := store.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatalf("checkpoint err = %v", err)
+	}
+	if size := store.fileSize(); size < full {
+		t.Fatalf("file shrank outside vacuum window: %d -> %d", full, size)
+	}
+	if !store.lastReclaim.IsZero() {
+		t.Fatalf("vacuum ran outside window")
+	}
+
+	// 进入时段后执行回收
+	store.vacuumWindow = &HourWindow{Start: now.Hour(), End: (now.Hour() + 1) % 24}
+	store.doCleanup()
+	if size := store.fileSize(); size >= full/2 {
+		t.Fatalf("expected file to shrink inside window: before=%d after=%d", full, size)
+	}
+	if stats, _ := store.GetStorageStats(); stats.LastVacuum == nil || stats.VacuumWindow == "" {
+		t.Fatalf("unexpected vacuum stats: %+v", stats)
+	}
+}
@@ -28,6 +28,17 @@ type SQLiteStore struct {
 	batchSize     int           // 批量写入阈值（记录数）
 	flushInterval time.Duration // 定时刷新间隔
 	retentionDays int           // 数据保留天数
+	// 请求日志保留时长与每日汇总保留天数（0 表示永久保留）
+	requestLogRetention     time.Duration
+	dailyStatsRetentionDays int
+	// 空间回收（0 表示禁用）；vacuumWindow 为空表示任意时段均可执行
+	vacuumInterval time.Duration
+	vacuumWindow   *HourWindow
+	// 维护状态（清理流程写入，存储统计读取）
+	maintMu     sync.Mutex
+	lastCleanup time.Time
+	lastVacuum  time.Time // 上次回收时间（初始为启动时间，用于计算间隔）
+	lastReclaim time.Time // 实际执行回收的时间（未执行过为零值）
 
 	// 控制
 	stopCh  chan struct{}
@@ -40,6 +51,14 @@ type SQLiteStore struct {
 type SQLiteStoreConfig struct {
 	DBPath        string // 数据库文件路径
 	RetentionDays int    // 数据保留天数（3-30）
+	// 增量 VACUUM 间隔（0 表示禁用）：清理删除的页面在到期后的清理流程中归还给文件系统
+	VacuumInterval time.Duration
+	// 空间回收允许执行的本地时段（nil 表示任意时段），到期但不在时段内时顺延到时段内的清理流程
+	VacuumWindow *HourWindow
+	// 请求日志（request_logs）保留时长（0 使用默认 24 小时）
+	RequestLogRetention time.Duration
+	// 每日汇总（daily_stats）保留天数（0 表示永久保留，不少于 RetentionDays）
+	DailyStatsRetentionDays int
 }
 
 // 硬编码的内部配置
@@ -48,6 +67,8 @@ const (
 	defaultFlushInterval = 30 * time.Second // 定时刷新间隔
 	maxBufferMultiplier  = 50               // 写入缓冲区上限倍数（相对 batchSize）
 	maxFlushRetries      = 3                // flush 写入失败最大重试次数
+
+	defaultRequestLogRetention = 24 * time.Hour // 请求日志默认保留时长
 )
 
 // NewSQLiteStore 创建 SQLite 存储
@@ -65,6 +86,15 @@ func NewSQLiteStore(cfg *SQLiteStoreConfig) (*SQLiteStore, error) {
 	} else if cfg.RetentionDays > 30 {
 		cfg.RetentionDays = 30
 	}
+	if cfg.RequestLogRetention <= 0 {
+		cfg.RequestLogRetention = defaultRequestLogRetention
+	}
+	// 每日汇总用于长期趋势，保留时间不应短于明细记录
+	if cfg.DailyStatsRetentionDays < 0 {
+		cfg.DailyStatsRetentionDays = 0
+	} else if cfg.DailyStatsRetentionDays > 0 && cfg.DailyStatsRetentionDays < cfg.RetentionDays {
+		cfg.DailyStatsRetentionDays = cfg.RetentionDays
+	}
 
 	// 确保目录存在
 	dir := filepath.Dir(cfg.DBPath)
@@ -74,7 +104,8 @@ func NewSQLiteStore(cfg *SQLiteStoreConfig) (*SQLiteStore, error) {
 
 	// 打开数据库连接（WAL 模式 + NORMAL 同步）
 	// modernc.org/sqlite 使用 _pragma= 语法设置 PRAGMA
-	dsn := cfg.DBPath + "?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)"
+	// auto_vacuum 仅对新建数据库生效，已有数据库在首次空间回收时转换
+	dsn := cfg.DBPath + "?_pragma=auto_vacuum(INCREMENTAL)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)"
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("打开数据库失败: %w", err)
@@ -85,8 +116,8 @@ func NewSQLiteStore(cfg *SQLiteStoreConfig) (*SQLiteStore, error) {
 	db.SetMaxIdleConns(1)
 	db.SetConnMaxLifetime(0) // 不限制连接生命周期
 
-	// 初始化表结构
-	if err := initSchema(db); err != nil {
+	// 按版本执行 schema 迁移（新库与旧库走同一路径）
+	if err := migrateSchema(db); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("初始化数据库 schema 失败: %w", err)
 	}
@@ -99,6 +130,13 @@ func NewSQLiteStore(cfg *SQLiteStoreConfig) (*SQLiteStore, error) {
 		flushInterval: defaultFlushInterval,
 		retentionDays: cfg.RetentionDays,
 		stopCh:        make(chan struct{}),
+
+		requestLogRetention:     cfg.RequestLogRetention,
+		dailyStatsRetentionDays: cfg.DailyStatsRetentionDays,
+
+		vacuumInterval: cfg.VacuumInterval,
+		vacuumWindow:   cfg.VacuumWindow,
+		lastVacuum:     time.Now(), // 首次回收在一个间隔后执行，避免拖慢启动
 	}
 
 	// 启动前先同步清理一次，避免后台 goroutine 的调度不确定性影响调用方（尤其是测试）。
@@ -113,103 +151,6 @@ func NewSQLiteStore(cfg *SQLiteStoreConfig) (*SQLiteStore, error) {
 	return store, nil
 }
 
-// initSchema 初始化数据库表结构
-func initSchema(db *sql.DB) error {
-	schema := `
-		-- 请求记录表
-		CREATE TABLE IF NOT EXISTS request_records (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			metrics_key TEXT NOT NULL,
-			base_url TEXT NOT NULL,
-			key_mask TEXT NOT NULL,
-			timestamp INTEGER NOT NULL,
-			success INTEGER NOT NULL,
-			input_tokens INTEGER DEFAULT 0,
-			output_tokens INTEGER DEFAULT 0,
-			cache_creation_tokens INTEGER DEFAULT 0,
-			cache_read_tokens INTEGER DEFAULT 0,
-			model TEXT DEFAULT '',
-			cost_cents INTEGER DEFAULT 0,
-			api_type TEXT NOT NULL DEFAULT 'messages'
-		);
-
-		-- 索引：按 api_type 和时间查询
-		CREATE INDEX IF NOT EXISTS idx_records_api_type_timestamp
-			ON request_records(api_type, timestamp);
-
-		-- 索引：按 metrics_key 查询
-		CREATE INDEX IF NOT EXISTS idx_records_metrics_key
-			ON request_records(metrics_key);
-
-		-- 每日预聚合统计表（用于周/月查询加速）
-		CREATE TABLE IF NOT EXISTS daily_stats (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			date TEXT NOT NULL,                    -- YYYY-MM-DD (本地日历日)
-			api_type TEXT NOT NULL,                -- messages/responses
-			metrics_key TEXT NOT NULL,             -- hash(baseURL + apiKey)
-			base_url TEXT NOT NULL,
-			key_mask TEXT NOT NULL,
-			total_requests INTEGER DEFAULT 0,
-			success_count INTEGER DEFAULT 0,
-			failure_count INTEGER DEFAULT 0,
-			input_tokens INTEGER DEFAULT 0,
-			output_tokens INTEGER DEFAULT 0,
-			cache_creation_tokens INTEGER DEFAULT 0,
-			cache_read_tokens INTEGER DEFAULT 0,
-			cost_cents INTEGER DEFAULT 0,
-			UNIQUE(date, api_type, metrics_key)
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_daily_stats_date_api
-			ON daily_stats(date, api_type);
-
-		-- 请求日志表（仅保留 24 小时，用于排障/审计）
-		CREATE TABLE IF NOT EXISTS request_logs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			request_id TEXT NOT NULL,
-			channel_index INTEGER NOT NULL,
-			channel_name TEXT NOT NULL,
-			key_mask TEXT NOT NULL,
-			timestamp INTEGER NOT NULL,
-			duration_ms INTEGER NOT NULL,
-			status_code INTEGER NOT NULL,
-			success INTEGER NOT NULL,
-			model TEXT DEFAULT '',
-			input_tokens INTEGER DEFAULT 0,
-			output_tokens INTEGER DEFAULT 0,
-			cache_creation_tokens INTEGER DEFAULT 0,
-			cache_read_tokens INTEGER DEFAULT 0,
-			cost_cents INTEGER DEFAULT 0,
-			error_message TEXT DEFAULT '',
-			api_type TEXT NOT NULL
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_request_logs_api_type_timestamp
-			ON request_logs(api_type, timestamp DESC);
-
-		CREATE INDEX IF NOT EXISTS idx_request_logs_request_id
-			ON request_logs(request_id);
-	`
-
-	_, err := db.Exec(schema)
-	if err != nil {
-		return err
-	}
-
-	// 迁移：为旧表添加新列（如果不存在）
-	migrations := []string{
-		"ALTER TABLE request_records ADD COLUMN model TEXT DEFAULT ''",
-		"ALTER TABLE request_records ADD COLUMN cost_cents INTEGER DEFAULT 0",
-		"ALTER TABLE daily_stats ADD COLUMN cost_cents INTEGER DEFAULT 0",
-	}
-	for _, m := range migrations {
-		// 忽略 "duplicate column" 错误
-		db.Exec(m)
-	}
-
-	return nil
-}
-
 // AggregateDailyStats 聚合指定日期（本地日历日）的请求记录到 daily_stats（幂等，可重复执行）
 // 注意：仅聚合完整自然日（建议用于 yesterday / 历史日），不要用于正在写入的"今天"。
 func (s *SQLiteStore) AggregateDailyStats(day time.Time) error {
@@ -226,7 +167,7 @@ func (s *SQLiteStore) AggregateDailyStats(day time.Time) error {
 		INSERT INTO daily_stats (
 			date, api_type, metrics_key, base_url, key_mask,
 			total_requests, success_count, failure_count,
-			input_tokens, output_tokens, cache_creation_tokens, cache_read_tokens, cost_cents
+			input_tokens, output_tokens, cache_creation_tokens, cache_read_tokens, cost_cents, thinking_tokens
 		)
 		SELECT
 			?, api_type, metrics_key, base_url, key_mask,
@@ -237,7 +178,8 @@ func (s *SQLiteStore) AggregateDailyStats(day time.Time) error {
 			COALESCE(SUM(output_tokens), 0) AS output_tokens,
 			COALESCE(SUM(cache_creation_tokens), 0) AS cache_creation_tokens,
 			COALESCE(SUM(cache_read_tokens), 0) AS cache_read_tokens,
-			COALESCE(SUM(cost_cents), 0) AS cost_cents
+			COALESCE(SUM(cost_cents), 0) AS cost_cents,
+			COALESCE(SUM(thinking_tokens), 0) AS thinking_tokens
 		FROM request_records
 		WHERE timestamp >= ? AND timestamp < ?
 		GROUP BY api_type, metrics_key, base_url, key_mask
@@ -251,7 +193,8 @@ func (s *SQLiteStore) AggregateDailyStats(day time.Time) error {
 			output_tokens = excluded.output_tokens,
 			cache_creation_tokens = excluded.cache_creation_tokens,
 			cache_read_tokens = excluded.cache_read_tokens,
-			cost_cents = excluded.cost_cents
+			cost_cents = excluded.cost_cents,
+			thinking_tokens = excluded.thinking_tokens
 	`, dateStr, start.Unix(), end.Unix())
 	if err != nil {
 		return fmt.Errorf("聚合 daily_stats 失败 (%s): %w", dateStr, err)
@@ -376,8 +319,8 @@ func (s *SQLiteStore) batchInsertRecords(records []PersistentRecord) error {
 	stmt, err := tx.Prepare(`
 		INSERT INTO request_records
 		(metrics_key, base_url, key_mask, timestamp, success,
-		 input_tokens, output_tokens, cache_creation_tokens, cache_read_tokens, model, cost_cents, api_type)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 input_tokens, output_tokens, cache_creation_tokens, cache_read_tokens, model, cost_cents, api_type, thinking_tokens)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return err
@@ -391,7 +334,7 @@ func (s *SQLiteStore) batchInsertRecords(records []PersistentRecord) error {
 		}
 		_, err := stmt.Exec(
 			r.MetricsKey, r.BaseURL, r.KeyMask, r.Timestamp.Unix(), success,
-			r.InputTokens, r.OutputTokens, r.CacheCreationTokens, r.CacheReadTokens, r.Model, r.CostCents, r.APIType,
+			r.InputTokens, r.OutputTokens, r.CacheCreationTokens, r.CacheReadTokens, r.Model, r.CostCents, r.APIType, r.ThinkingTokens,
 		)
 		if err != nil {
 			return err
@@ -406,7 +349,8 @@ func (s *SQLiteStore) LoadRecords(since time.Time, apiType string) ([]Persistent
 	rows, err := s.db.Query(`
 		SELECT metrics_key, base_url, key_mask, timestamp, success,
 		       input_tokens, output_tokens, cache_creation_tokens, cache_read_tokens,
-		       COALESCE(model, '') AS model, COALESCE(cost_cents, 0) AS cost_cents
+		       COALESCE(model, '') AS model, COALESCE(cost_cents, 0) AS cost_cents,
+		       COALESCE(thinking_tokens, 0) AS thinking_tokens
 		FROM request_records
 		WHERE timestamp >= ? AND api_type = ?
 		ORDER BY timestamp ASC
@@ -425,7 +369,7 @@ func (s *SQLiteStore) LoadRecords(since time.Time, apiType string) ([]Persistent
 		err := rows.Scan(
 			&r.MetricsKey, &r.BaseURL, &r.KeyMask, &ts, &success,
 			&r.InputTokens, &r.OutputTokens, &r.CacheCreationTokens, &r.CacheReadTokens,
-			&r.Model, &r.CostCents,
+			&r.Model, &r.CostCents, &r.ThinkingTokens,
 		)
 		if err != nil {
 			return nil, err
@@ -452,6 +396,18 @@ func (s *SQLiteStore) CleanupOldRecords(before time.Time) (int64, error) {
 	return result.RowsAffected()
 }
 
+// CleanupOldDailyStats 清理指定日期（本地日历日）之前的每日汇总
+func (s *SQLiteStore) CleanupOldDailyStats(before time.Time) (int64, error) {
+	result, err := s.db.Exec(
+		"DELETE FROM daily_stats WHERE date < ?",
+		before.Format("2006-01-02"),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // flushLoop 定时刷新循环
 func (s *SQLiteStore) flushLoop() {
 	defer s.wg.Done()
@@ -500,7 +456,30 @@ func (s *SQLiteStore) doCleanup() {
 	if logErr != nil {
 		log.Printf("[SQLite-Cleanup] 警告: 清理过期请求日志失败: %v", logErr)
 	} else if logDeleted > 0 {
-		log.Printf("[SQLite-Cleanup] 已清理 %d 条过期请求日志（超过 24 小时）", logDeleted)
+		log.Printf("[SQLite-Cleanup] 已清理 %d 条过期请求日志（超过 %v）", logDeleted, s.requestLogRetention)
+	}
+
+	if s.dailyStatsRetentionDays > 0 {
+		statsDeleted, statsErr := s.CleanupOldDailyStats(time.Now().AddDate(0, 0, -s.dailyStatsRetentionDays))
+		if statsErr != nil {
+			log.Printf("[SQLite-Cleanup] 警告: 清理过期每日汇总失败: %v", statsErr)
+		} else if statsDeleted > 0 {
+			log.Printf("[SQLite-Cleanup] 已清理 %d 条过期每日汇总（超过 %d 天）", statsDeleted, s.dailyStatsRetentionDays)
+		}
+	}
+
+	now := time.Now()
+	s.maintMu.Lock()
+	s.lastCleanup = now
+	vacuumDue := s.vacuumInterval > 0 && now.Sub(s.lastVacuum) >= s.vacuumInterval && s.vacuumWindow.Contains(now)
+	if vacuumDue {
+		s.lastVacuum = now
+		s.lastReclaim = now
+	}
+	s.maintMu.Unlock()
+
+	if vacuumDue {
+		s.reclaimSpace()
 	}
 }
 
@@ -682,6 +661,66 @@ func (s *SQLiteStore) QueryRequestRecordBucketStats(apiType string, start, end t
 	return result, nil
 }
 
+// UsageBucket 按时间分桶与模型聚合的成功请求使用量
+type UsageBucket struct {
+	Start time.Time
+	Model string
+	AggregatedStats
+}
+
+// QueryUsageBuckets 按时间分桶与模型聚合 [start, end) 内成功请求的使用量（用于使用量报表回退查询）
+func (s *SQLiteStore) QueryUsageBuckets(apiType string, start, end time.Time, interval time.Duration) ([]UsageBucket, error) {
+	intervalSeconds := int64(interval / time.Second)
+	if intervalSeconds <= 0 {
+		return nil, fmt.Errorf("interval 过小: %s", interval)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT
+			CAST(timestamp / ? AS INTEGER) AS bucket,
+			COALESCE(model, '') AS model,
+			COUNT(*) AS total_requests,
+			COALESCE(SUM(input_tokens), 0) AS input_tokens,
+			COALESCE(SUM(output_tokens), 0) AS output_tokens,
+			COALESCE(SUM(cache_creation_tokens), 0) AS cache_creation_tokens,
+			COALESCE(SUM(cache_read_tokens), 0) AS cache_read_tokens,
+			COALESCE(SUM(cost_cents), 0) AS cost_cents
+		FROM request_records
+		WHERE api_type = ? AND timestamp >= ? AND timestamp < ? AND success = 1
+		GROUP BY bucket, model
+		ORDER BY bucket ASC
+	`, intervalSeconds, apiType, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []UsageBucket
+	for rows.Next() {
+		var bucket int64
+		var b UsageBucket
+		if err := rows.Scan(
+			&bucket,
+			&b.Model,
+			&b.RequestCount,
+			&b.InputTokens,
+			&b.OutputTokens,
+			&b.CacheCreationTokens,
+			&b.CacheReadTokens,
+			&b.CostCents,
+		); err != nil {
+			return nil, err
+		}
+		b.SuccessCount = b.RequestCount
+		b.Start = time.Unix(bucket*intervalSeconds, 0)
+		result = append(result, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (s *SQLiteStore) QueryDailyTotals(apiType, startDate, endDate string, metricsKeys []string) (map[string]AggregatedStats, error) {
 	args := []any{apiType, startDate, endDate}
 
@@ -801,7 +840,13 @@ func (s *SQLiteStore) AddRequestLog(logRecord RequestLogRecord) error {
 	return nil
 }
 
+// QueryRequestLogs 分页查询请求日志（按时间倒序）
 func (s *SQLiteStore) QueryRequestLogs(apiType string, limit, offset int) ([]RequestLogRecord, int64, error) {
+	return s.QueryRequestLogsFiltered(apiType, RequestLogFilter{}, limit, offset)
+}
+
+// QueryRequestLogsFiltered 按过滤条件分页查询请求日志（按时间倒序），total 为满足条件的总数
+func (s *SQLiteStore) QueryRequestLogsFiltered(apiType string, filter RequestLogFilter, limit, offset int) ([]RequestLogRecord, int64, error) {
 	if apiType == "" {
 		return nil, 0, fmt.Errorf("api_type 不能为空")
 	}
@@ -815,8 +860,35 @@ func (s *SQLiteStore) QueryRequestLogs(apiType string, limit, offset int) ([]Req
 		offset = 0
 	}
 
+	where := "api_type = ?"
+	args := []any{apiType}
+	if filter.ChannelIndex != nil {
+		where += " AND channel_index = ?"
+		args = append(args, *filter.ChannelIndex)
+	}
+	if filter.Success != nil {
+		success := 0
+		if *filter.Success {
+			success = 1
+		}
+		where += " AND success = ?"
+		args = append(args, success)
+	}
+	if filter.StatusMin > 0 {
+		where += " AND status_code >= ?"
+		args = append(args, filter.StatusMin)
+	}
+	if filter.StatusMax > 0 {
+		where += " AND status_code <= ?"
+		args = append(args, filter.StatusMax)
+	}
+	if filter.KeyMask != "" {
+		where += " AND key_mask = ?"
+		args = append(args, filter.KeyMask)
+	}
+
 	var total int64
-	if err := s.db.QueryRow(`SELECT COUNT(*) FROM request_logs WHERE api_type = ?`, apiType).Scan(&total); err != nil {
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM request_logs WHERE `+where, args...).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
@@ -832,10 +904,10 @@ func (s *SQLiteStore) QueryRequestLogs(apiType string, limit, offset int) ([]Req
 			COALESCE(cost_cents, 0) AS cost_cents,
 			COALESCE(error_message, '') AS error_message
 		FROM request_logs
-		WHERE api_type = ?
+		WHERE `+where+`
 		ORDER BY timestamp DESC, id DESC
 		LIMIT ? OFFSET ?
-	`, apiType, limit, offset)
+	`, append(args, limit, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -880,8 +952,13 @@ func (s *SQLiteStore) QueryRequestLogs(apiType string, limit, offset int) ([]Req
 	return logs, total, nil
 }
 
+// CleanupOldRequestLogs 清理超过保留时长的请求日志
 func (s *SQLiteStore) CleanupOldRequestLogs() (int64, error) {
-	cutoff := time.Now().Add(-24 * time.Hour).Unix()
+	retention := s.requestLogRetention
+	if retention <= 0 {
+		retention = defaultRequestLogRetention
+	}
+	cutoff := time.Now().Add(-retention).Unix()
 	result, err := s.db.Exec("DELETE FROM request_logs WHERE timestamp < ?", cutoff)
 	if err != nil {
 		return 0, err
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	// vacuumPagesPerStep 每轮增量 VACUUM 释放的页数（默认页大小 4KB，约 4MB）
+	// 分批执行使写入可在批次之间获得连接，避免长时间阻塞
+	vacuumPagesPerStep = 1000
+	// vacuumStepPause 批次之间的停顿
+	vacuumStepPause = 10 * time.Millisecond
+)
+
+// reclaimSpace 将已删除记录占用的空闲页归还给文件系统
+// 已有数据库（auto_vacuum=NONE）首次执行一次完整 VACUUM 转换为增量模式，此后按批执行 incremental_vacuum
+func (s *SQLiteStore) reclaimSpace() {
+	start := time.Now()
+	before := s.fileSize()
+
+	var mode int
+	if err := s.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		log.Printf("[SQLite-Vacuum] 警告: 读取 auto_vacuum 模式失败: %v", err)
+		return
+	}
+
+	// 2 = INCREMENTAL
+	if mode != 2 {
+		log.Printf("[SQLite-Vacuum] 数据库未启用增量 VACUUM，执行一次完整 VACUUM 进行转换（期间写入将等待）")
+		if _, err := s.db.Exec("PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+			log.Printf("[SQLite-Vacuum] 警告: 设置 auto_vacuum 失败: %v", err)
+			return
+		}
+		if _, err := s.db.Exec("VACUUM"); err != nil {
+			log.Printf("[SQLite-Vacuum] 警告: 完整 VACUUM 失败: %v", err)
+			return
+		}
+	} else {
+		lastFree := int64(-1)
+		for {
+			var free int64
+			if err := s.db.QueryRow("PRAGMA freelist_count").Scan(&free); err != nil {
+				log.Printf("[SQLite-Vacuum] 警告: 读取空闲页数失败: %v", err)
+				return
+			}
+			// 空闲页数不再减少时停止，避免异常情况下死循环
+			if free == 0 || free == lastFree {
+				break
+			}
+			lastFree = free
+			if err := s.incrementalVacuumStep(); err != nil {
+				log.Printf("[SQLite-Vacuum] 警告: 增量 VACUUM 失败: %v", err)
+				return
+			}
+			select {
+			case <-s.stopCh:
+				return
+			case <-time.After(vacuumStepPause):
+			}
+		}
+	}
+
+	// WAL 模式下主库文件在 checkpoint 后才会截断
+	if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		log.Printf("[SQLite-Vacuum] 警告: WAL checkpoint 失败: %v", err)
+	}
+
+	after := s.fileSize()
+	if before > after {
+		log.Printf("[SQLite-Vacuum] 已回收 %.1f MB 磁盘空间 (%.1f MB -> %.1f MB, 耗时 %v)",
+			float64(before-after)/1024/1024, float64(before)/1024/1024, float64(after)/1024/1024, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// incrementalVacuumStep 执行一批增量 VACUUM
+// incremental_vacuum 每释放一页返回一行，必须读完结果集才会执行完整批次（Exec 只执行一步）
+func (s *SQLiteStore) incrementalVacuumStep() error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA incremental_vacuum(%d)", vacuumPagesPerStep))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// fileSize 返回数据库文件与 WAL 文件的总大小
+func (s *SQLiteStore) fileSize() int64 {
+	return statSize(s.dbPath) + statSize(s.dbPath+"-wal")
+}
+
+// statSize 返回文件大小，文件不存在时返回 0
+func statSize(path string) int64 {
+	if info, err := os.Stat(path); err == nil {
+		return info.Size()
+	}
+	return 0
+}
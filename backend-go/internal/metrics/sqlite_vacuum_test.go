@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fillAndDeleteRecords(t *testing.T, store *SQLiteStore, n int) {
+	t.Helper()
+	old := time.Now().AddDate(0, 0, -60)
+	padding := strings.Repeat("x", 200)
+	records := make([]PersistentRecord, 0, 1000)
+	for i := 0; i < n; i++ {
+		records = append(records, PersistentRecord{
+			MetricsKey: fmt.Sprintf("key-%d", i%50),
+			BaseURL:    "https://api.example.com/" + padding,
+			KeyMask:    "sk-***abcd",
+			Timestamp:  old.Add(time.Duration(i) * time.Second),
+			Success:    true,
+			Model:      "claude-" + padding,
+			APIType:    "messages",
+		})
+		if len(records) == cap(records) {
+			if err := store.batchInsertRecords(records); err != nil {
+				t.Fatalf("batchInsertRecords() err = %v", err)
+			}
+			records = records[:0]
+		}
+	}
+	if len(records) > 0 {
+		if err := store.batchInsertRecords(records); err != nil {
+			t.Fatalf("batchInsertRecords() err = %v", err)
+		}
+	}
+	if _, err := store.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatalf("checkpoint err = %v", err)
+	}
+}
+
+func TestSQLiteStore_VacuumReclaimsSpaceAfterCleanup(t *testing.T) {
+	store, err := NewSQLiteStore(&SQLiteStoreConfig{
+		DBPath:         t.TempDir() + "/metrics.db",
+		RetentionDays:  7,
+		VacuumInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() err = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	fillAndDeleteRecords(t, store, 20000)
+	full := store.fileSize()
+
+	// 未到回收间隔：清理只删除记录，文件大小不变
+	store.doCleanup()
+	if _, err := store.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatalf("checkpoint err = %v", err)
+	}
+	if count, _ := store.GetRecordCount(); count != 0 {
+		t.Fatalf("expected expired records deleted, got %d", count)
+	}
+	if size := store.fileSize(); size < full {
+		t.Fatalf("file shrank before vacuum was due: %d -> %d", full, size)
+	}
+
+	// 到达回收间隔后清理流程执行增量 VACUUM
+	store.lastVacuum = time.Now().Add(-2 * time.Hour)
+	store.doCleanup()
+	if size := store.fileSize(); size >= full/2 {
+		t.Fatalf("expected file to shrink after vacuum: before=%d after=%d", full, size)
+	}
+	var free int64
+	if err := store.db.QueryRow("PRAGMA freelist_count").Scan(&free); err != nil || free != 0 {
+		t.Fatalf("freelist_count = %d, err = %v", free, err)
+	}
+}
+
+func TestSQLiteStore_VacuumConvertsLegacyDatabase(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	// 模拟 auto_vacuum=NONE 的旧数据库
+	if _, err := store.db.Exec("PRAGMA auto_vacuum = NONE"); err != nil {
+		t.Fatalf("set auto_vacuum err = %v", err)
+	}
+	if _, err := store.db.Exec("VACUUM"); err != nil {
+		t.Fatalf("VACUUM err = %v", err)
+	}
+
+	fillAndDeleteRecords(t, store, 10000)
+	full := store.fileSize()
+	if _, err := store.CleanupOldRecords(time.Now()); err != nil {
+		t.Fatalf("CleanupOldRecords() err = %v", err)
+	}
+
+	store.reclaimSpace()
+
+	var mode int
+	if err := store.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil || mode != 2 {
+		t.Fatalf("auto_vacuum = %d, err = %v; want 2 (INCREMENTAL)", mode, err)
+	}
+	if size := store.fileSize(); size >= full/2 {
+		t.Fatalf("expected file to shrink after conversion: before=%d after=%d", full, size)
+	}
+}
+
+func TestSQLiteStore_VacuumDisabledByDefault(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	fillAndDeleteRecords(t, store, 5000)
+	full := store.fileSize()
+
+	store.lastVacuum = time.Time{}
+	store.doCleanup()
+	if _, err := store.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatalf("checkpoint err = %v", err)
+	}
+	if size := store.fileSize(); size < full {
+		t.Fatalf("file shrank with vacuum disabled: %d -> %d", full, size)
+	}
+}
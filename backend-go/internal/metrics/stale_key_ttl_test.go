@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanupStaleKeys_UsesConfiguredTTL(t *testing.T) {
+	m, clock := newRecoveryTestManager(t)
+	const baseURL = "https://api.example.com"
+
+	if got := m.GetStaleKeyTTL(); got != DefaultStaleKeyTTL {
+		t.Fatalf("expected default ttl %v, got %v", DefaultStaleKeyTTL, got)
+	}
+
+	m.SetStaleKeyTTL(2 * time.Hour)
+	m.RecordSuccess(baseURL, "key-old")
+	*clock = clock.Add(90 * time.Minute)
+	m.RecordSuccess(baseURL, "key-new")
+	*clock = clock.Add(time.Hour)
+
+	m.cleanupStaleKeys()
+
+	if m.GetKeyMetrics(baseURL, "key-old") != nil {
+		t.Fatalf("expected key-old to be removed after ttl")
+	}
+	if m.GetKeyMetrics(baseURL, "key-new") == nil {
+		t.Fatalf("expected key-new to be kept within ttl")
+	}
+}
+
+func TestCleanupStaleKeys_ZeroTTLDisablesCleanup(t *testing.T) {
+	m, clock := newRecoveryTestManager(t)
+	const baseURL = "https://api.example.com"
+
+	m.SetStaleKeyTTL(0)
+	m.RecordSuccess(baseURL, "key-a")
+	*clock = clock.Add(30 * 24 * time.Hour)
+
+	m.cleanupStaleKeys()
+
+	if m.GetKeyMetrics(baseURL, "key-a") == nil {
+		t.Fatalf("expected key-a to be kept when cleanup is disabled")
+	}
+}
+
+func TestSetStaleKeyTTL_IgnoresNegative(t *testing.T) {
+	m, _ := newRecoveryTestManager(t)
+
+	m.SetStaleKeyTTL(-time.Hour)
+
+	if got := m.GetStaleKeyTTL(); got != DefaultStaleKeyTTL {
+		t.Fatalf("expected negative ttl to be ignored, got %v", got)
+	}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+// StreamCancelStats 流式请求的客户端取消统计（用于评估客户端中途断开造成的上游浪费）
+type StreamCancelStats struct {
+	StreamCount          int64   `json:"streamCount"`          // 已结束的流式请求数
+	CanceledCount        int64   `json:"canceledCount"`        // 客户端在流结束前断开的请求数
+	CancellationRate     float64 `json:"cancellationRate"`     // 取消率（百分比）
+	OutputTokensAtCancel int64   `json:"outputTokensAtCancel"` // 断开时已生成的输出 token 数（累计）
+	WastedOutputTokens   int64   `json:"wastedOutputTokens"`   // 断开后上游继续生成、客户端未收到的输出 token 数（累计）
+}
+
+// RecordStreamCompletion 记录一次流式请求结束
+// canceled 表示客户端在流结束前断开；tokensAtCancel 为断开时已生成的输出 token 数，totalOutputTokens 为上游最终输出 token 数
+func (m *MetricsManager) RecordStreamCompletion(baseURL, apiKey string, canceled bool, tokensAtCancel, totalOutputTokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := &m.getOrCreateKey(baseURL, apiKey).streamCancel
+	stats.StreamCount++
+	if !canceled {
+		return
+	}
+	stats.CanceledCount++
+	stats.OutputTokensAtCancel += int64(tokensAtCancel)
+	if wasted := totalOutputTokens - tokensAtCancel; wasted > 0 {
+		stats.WastedOutputTokens += int64(wasted)
+	}
+}
+
+// GetStreamCancelStats 获取渠道所有 BaseURL × Key 的流式取消统计
+func (m *MetricsManager) GetStreamCancelStats(baseURLs []string, activeKeys []string) StreamCancelStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total StreamCancelStats
+	for _, baseURL := range baseURLs {
+		for _, apiKey := range activeKeys {
+			metrics, exists := m.keyMetrics[generateMetricsKey(baseURL, apiKey)]
+			if !exists {
+				continue
+			}
+			total.StreamCount += metrics.streamCancel.StreamCount
+			total.CanceledCount += metrics.streamCancel.CanceledCount
+			total.OutputTokensAtCancel += metrics.streamCancel.OutputTokensAtCancel
+			total.WastedOutputTokens += metrics.streamCancel.WastedOutputTokens
+		}
+	}
+	if total.StreamCount > 0 {
+		total.CancellationRate = float64(total.CanceledCount) / float64(total.StreamCount) * 100
+	}
+	return total
+}
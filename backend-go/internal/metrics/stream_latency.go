@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// streamTimingRecord 单次流式请求的时延记录（用于首 token 延迟分位数与生成速度统计，保留24小时）
+type streamTimingRecord struct {
+	Timestamp    time.Time
+	FirstToken   time.Duration // 从发起上游请求到收到首个内容事件
+	Duration     time.Duration // 从发起上游请求到流结束
+	OutputTokens int64
+}
+
+// RecordStreamTiming 记录一次成功流式请求的首 token 延迟与总耗时（均从发起上游请求开始计时）
+// 未收到任何内容事件（firstToken <= 0）的流不计入
+func (m *MetricsManager) RecordStreamTiming(baseURL, apiKey string, firstToken, duration time.Duration, outputTokens int) {
+	if firstToken <= 0 || duration < firstToken {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metrics := m.getOrCreateKey(baseURL, apiKey)
+	now := m.currentTime()
+	metrics.streamTimings = append(metrics.streamTimings, streamTimingRecord{
+		Timestamp:    now,
+		FirstToken:   firstToken,
+		Duration:     duration,
+		OutputTokens: int64(max(outputTokens, 0)),
+	})
+
+	// 清理超过24小时的记录，并限制最大记录数
+	cutoff := now.Add(-24 * time.Hour)
+	start := 0
+	for start < len(metrics.streamTimings) && !metrics.streamTimings[start].Timestamp.After(cutoff) {
+		start++
+	}
+	start = max(start, len(metrics.streamTimings)-maxHistoryRecords)
+	if start > 0 {
+		metrics.streamTimings = append([]streamTimingRecord(nil), metrics.streamTimings[start:]...)
+	}
+}
+
+// streamLatencyAccumulator 聚合时间窗口内的流式时延记录
+type streamLatencyAccumulator struct {
+	firstTokens  []time.Duration
+	outputTokens int64
+	generation   time.Duration // 首 token 之后的生成耗时之和
+}
+
+// add 累加 cutoff 之后的记录
+func (a *streamLatencyAccumulator) add(records []streamTimingRecord, cutoff time.Time) {
+	for _, r := range records {
+		if !r.Timestamp.After(cutoff) {
+			continue
+		}
+		a.firstTokens = append(a.firstTokens, r.FirstToken)
+		if gen := r.Duration - r.FirstToken; gen > 0 && r.OutputTokens > 0 {
+			a.outputTokens += r.OutputTokens
+			a.generation += gen
+		}
+	}
+}
+
+// apply 将首 token 延迟 p50/p95 与平均生成速度写入时间窗口统计
+// 生成速度按 token 加权：窗口内输出 token 总数 / 首 token 之后的生成耗时总和
+func (a *streamLatencyAccumulator) apply(stats *TimeWindowStats) {
+	if len(a.firstTokens) == 0 {
+		return
+	}
+	sorted := append([]time.Duration(nil), a.firstTokens...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	stats.StreamCount = int64(len(sorted))
+	stats.FirstTokenP50Ms = recoveryPercentile(sorted, 50).Milliseconds()
+	stats.FirstTokenP95Ms = recoveryPercentile(sorted, 95).Milliseconds()
+	if a.generation > 0 {
+		stats.TokensPerSecond = float64(a.outputTokens) / a.generation.Seconds()
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordStreamTiming_TimeWindowStats(t *testing.T) {
+	m := NewMetricsManager()
+	defer m.Stop()
+
+	baseURL, key := "https://api.example.com", "sk-test"
+	// 首 token 延迟 100ms..1000ms；每次首 token 后生成 1s、输出 50 token
+	for i := 1; i <= 10; i++ {
+		firstToken := time.Duration(i*100) * time.Millisecond
+		m.RecordStreamTiming(baseURL, key, firstToken, firstToken+time.Second, 50)
+	}
+	// 未收到内容、或耗时不合法的记录不计入
+	m.RecordStreamTiming(baseURL, key, 0, time.Second, 10)
+	m.RecordStreamTiming(baseURL, key, 2*time.Second, time.Second, 10)
+
+	stats := m.GetTimeWindowStatsForKey(baseURL, key, time.Hour)
+	if stats.StreamCount != 10 {
+		t.Fatalf("StreamCount = %d, want 10", stats.StreamCount)
+	}
+	if stats.FirstTokenP50Ms != 500 || stats.FirstTokenP95Ms != 1000 {
+		t.Fatalf("p50/p95 = %d/%d, want 500/1000", stats.FirstTokenP50Ms, stats.FirstTokenP95Ms)
+	}
+	if stats.TokensPerSecond != 50 {
+		t.Fatalf("TokensPerSecond = %v, want 50", stats.TokensPerSecond)
+	}
+
+	// 渠道级聚合（多 BaseURL 版本）
+	resp := m.ToResponseMultiURL(0, []string{baseURL, "https://backup.example.com"}, []string{key}, 0)
+	if w := resp.TimeWindows["15m"]; w.FirstTokenP50Ms != 500 || w.FirstTokenP95Ms != 1000 || w.TokensPerSecond != 50 {
+		t.Fatalf("channel 15m window = %+v", w)
+	}
+
+	if _, reset := m.ResetKey(baseURL, key); !reset {
+		t.Fatalf("ResetKey() reset = false")
+	}
+	if stats := m.GetTimeWindowStatsForKey(baseURL, key, time.Hour); stats.StreamCount != 0 || stats.FirstTokenP50Ms != 0 {
+		t.Fatalf("stats after reset = %+v", stats)
+	}
+}
+
+func TestRecordStreamTiming_PrunesOldRecords(t *testing.T) {
+	m := NewMetricsManager()
+	defer m.Stop()
+
+	now := time.Now()
+	m.now = func() time.Time { return now.Add(-25 * time.Hour) }
+	m.RecordStreamTiming("https://a", "k", time.Second, 2*time.Second, 10)
+	m.now = func() time.Time { return now }
+	m.RecordStreamTiming("https://a", "k", 200*time.Millisecond, time.Second, 10)
+
+	m.mu.RLock()
+	n := len(m.keyMetrics[generateMetricsKey("https://a", "k")].streamTimings)
+	m.mu.RUnlock()
+	if n != 1 {
+		t.Fatalf("streamTimings = %d, want 1 (24h 之前的记录应被清理)", n)
+	}
+}
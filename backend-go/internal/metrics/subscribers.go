@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSubscriberBuffer 实时指标订阅者的默认事件缓冲大小
+const DefaultSubscriberBuffer = 256
+
+// MetricsEvent 一次请求结果记录产生的指标事件（推送给实时订阅者，如 /api/metrics/stream）
+type MetricsEvent struct {
+	MetricsKey     string       // hash(baseURL + apiKey)，可用 KeyID 计算后与渠道配置对应
+	BaseURL        string       // 请求的 BaseURL
+	KeyMask        string       // 脱敏后的 API Key
+	Success        bool         // 本次请求是否成功
+	CircuitState   CircuitState // 记录后的 Key 熔断状态
+	CircuitChanged bool         // 本次记录是否导致熔断状态变化
+	Time           time.Time
+}
+
+// metricsSubscribers 实时指标订阅者注册表（独立锁，零值可用）
+// 发布为非阻塞：订阅者缓冲区已满时直接移除并关闭其通道，慢消费者不会拖慢记录热路径
+type metricsSubscribers struct {
+	mu     sync.Mutex
+	subs   map[uint64]chan MetricsEvent
+	nextID uint64
+	count  atomic.Int32 // 订阅者数量（无订阅者时发布无需加锁）
+}
+
+// KeyID 返回 baseURL + apiKey 对应的指标键（与 MetricsEvent.MetricsKey 一致）
+func KeyID(baseURL, apiKey string) string {
+	return generateMetricsKey(baseURL, apiKey)
+}
+
+// Subscribe 订阅实时指标事件，返回事件通道与取消订阅函数（可重复调用）
+// 消费速度跟不上导致缓冲区写满时订阅会被移除，通道随之关闭，调用方应视为需要重新订阅
+func (m *MetricsManager) Subscribe(buffer int) (<-chan MetricsEvent, func()) {
+	if buffer <= 0 {
+		buffer = DefaultSubscriberBuffer
+	}
+	s := &m.subscribers
+	ch := make(chan MetricsEvent, buffer)
+
+	s.mu.Lock()
+	if s.subs == nil {
+		s.subs = make(map[uint64]chan MetricsEvent)
+	}
+	id := s.nextID
+	s.nextID++
+	s.subs[id] = ch
+	s.count.Store(int32(len(s.subs)))
+	s.mu.Unlock()
+
+	return ch, func() { s.remove(id) }
+}
+
+// SubscriberCount 返回当前实时指标订阅者数量
+func (m *MetricsManager) SubscriberCount() int {
+	return int(m.subscribers.count.Load())
+}
+
+// publishEvent 向所有订阅者推送指标事件（调用方通常持有 m.mu，这里不得阻塞）
+func (m *MetricsManager) publishEvent(metrics *KeyMetrics, success bool, prevState CircuitState, now time.Time) {
+	if m.subscribers.count.Load() == 0 {
+		return
+	}
+	state := CircuitClosed
+	if metrics.circuitBreaker != nil {
+		state = metrics.circuitBreaker.State()
+	}
+	m.subscribers.publish(MetricsEvent{
+		MetricsKey:     metrics.MetricsKey,
+		BaseURL:        metrics.BaseURL,
+		KeyMask:        metrics.KeyMask,
+		Success:        success,
+		CircuitState:   state,
+		CircuitChanged: state != prevState,
+		Time:           now,
+	})
+}
+
+func (s *metricsSubscribers) publish(event MetricsEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, ch := range s.subs {
+		select {
+		case ch <- event:
+		default:
+			// 慢消费者：移除订阅而不是阻塞
+			delete(s.subs, id)
+			close(ch)
+		}
+	}
+	s.count.Store(int32(len(s.subs)))
+}
+
+func (s *metricsSubscribers) remove(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch, ok := s.subs[id]; ok {
+		delete(s.subs, id)
+		close(ch)
+	}
+	s.count.Store(int32(len(s.subs)))
+}
+
+// closeAll 关闭所有订阅（MetricsManager 停止时调用）
+func (s *metricsSubscribers) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, ch := range s.subs {
+		delete(s.subs, id)
+		close(ch)
+	}
+	s.count.Store(0)
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribe_ReceivesRecordEvents(t *testing.T) {
+	m := NewMetricsManagerWithConfig(3, 0.5)
+	defer m.Stop()
+
+	events, unsubscribe := m.Subscribe(16)
+	defer unsubscribe()
+	if m.SubscriberCount() != 1 {
+		t.Fatalf("SubscriberCount = %d, want 1", m.SubscriberCount())
+	}
+
+	m.RecordSuccess("https://a", "k1")
+	ev := <-events
+	if !ev.Success || ev.MetricsKey != KeyID("https://a", "k1") || ev.BaseURL != "https://a" || ev.CircuitChanged {
+		t.Fatalf("unexpected success event: %+v", ev)
+	}
+
+	// 连续失败触发熔断：恰有一次记录带有进入 Open 的状态变化
+	changes := 0
+	for i := 0; i < 3; i++ {
+		m.RecordFailure("https://a", "k1")
+		ev := <-events
+		if ev.Success {
+			t.Fatalf("failure recorded as success: %+v", ev)
+		}
+		if ev.CircuitChanged {
+			changes++
+			if ev.CircuitState != CircuitOpen {
+				t.Fatalf("expected circuit open event, got %+v", ev)
+			}
+		}
+	}
+	if changes != 1 {
+		t.Fatalf("circuit change events = %d, want 1", changes)
+	}
+
+	unsubscribe()
+	unsubscribe() // 可重复调用
+	if _, ok := <-events; ok {
+		t.Fatalf("channel should be closed after unsubscribe")
+	}
+	if m.SubscriberCount() != 0 {
+		t.Fatalf("SubscriberCount = %d, want 0", m.SubscriberCount())
+	}
+}
+
+func TestSubscribe_DropsSlowConsumer(t *testing.T) {
+	m := NewMetricsManagerWithConfig(10, 0.5)
+	defer m.Stop()
+
+	slow, unsubscribeSlow := m.Subscribe(1)
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := m.Subscribe(8)
+	defer unsubscribeFast()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			m.RecordSuccess("https://a", "k1")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("recording blocked on a slow subscriber")
+	}
+
+	if m.SubscriberCount() != 1 {
+		t.Fatalf("SubscriberCount = %d, want slow consumer dropped", m.SubscriberCount())
+	}
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != 1 {
+		t.Fatalf("slow consumer received %d events before drop, want 1", received)
+	}
+	if len(fast) != 3 {
+		t.Fatalf("fast consumer buffered %d events, want 3", len(fast))
+	}
+}
+
+func TestStop_ClosesSubscribers(t *testing.T) {
+	m := NewMetricsManager()
+	events, _ := m.Subscribe(0)
+	m.Stop()
+	if _, ok := <-events; ok {
+		t.Fatalf("Stop should close subscriber channels")
+	}
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+func TestMetricsManager_ThinkingTokensInTimeWindows(t *testing.T) {
+	m := NewMetricsManager()
+	defer m.Stop()
+
+	baseURL := "https://example.com"
+	m.RecordSuccessWithUsage(baseURL, "k1", &types.Usage{InputTokens: 10, OutputTokens: 300, ThinkingTokens: 200}, "claude-3", 5)
+	m.RecordSuccessWithUsage(baseURL, "k1", &types.Usage{InputTokens: 10, OutputTokens: 50}, "claude-3", 1)
+
+	resp := m.ToResponse(0, baseURL, []string{"k1"}, 0)
+	w := resp.TimeWindows["1h"]
+	if w.OutputTokens != 350 || w.ThinkingTokens != 200 {
+		t.Fatalf("1h window = output %d / thinking %d, want 350 / 200", w.OutputTokens, w.ThinkingTokens)
+	}
+
+	multi := m.ToResponseMultiURL(0, []string{baseURL}, []string{"k1"}, 0)
+	if got := multi.TimeWindows["24h"].ThinkingTokens; got != 200 {
+		t.Fatalf("multi-url 24h thinking = %d, want 200", got)
+	}
+}
+
+func TestSQLiteStore_ThinkingTokensMigrationAndRoundTrip(t *testing.T) {
+	dbPath := t.TempDir() + "/metrics.db"
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.Local)
+
+	// 旧版本表结构（无 thinking_tokens 列）
+	legacy, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open legacy db: %v", err)
+	}
+	_, err = legacy.Exec(`
+		CREATE TABLE request_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			metrics_key TEXT NOT NULL,
+			base_url TEXT NOT NULL,
+			key_mask TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			success INTEGER NOT NULL,
+			input_tokens INTEGER DEFAULT 0,
+			output_tokens INTEGER DEFAULT 0,
+			cache_creation_tokens INTEGER DEFAULT 0,
+			cache_read_tokens INTEGER DEFAULT 0,
+			model TEXT DEFAULT '',
+			cost_cents INTEGER DEFAULT 0,
+			api_type TEXT NOT NULL DEFAULT 'messages'
+		)
+	`)
+	if err == nil {
+		_, err = legacy.Exec(`
+			INSERT INTO request_records (metrics_key, base_url, key_mask, timestamp, success, output_tokens, api_type)
+			VALUES ('mk', 'https://example.com', 'sk-***', ?, 1, 40, 'messages')
+		`, day.Add(time.Second).Unix())
+	}
+	_ = legacy.Close()
+	if err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	store, err := NewSQLiteStore(&SQLiteStoreConfig{DBPath: dbPath, RetentionDays: 7})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() err = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ts := day.Add(time.Minute)
+	if err := store.batchInsertRecords([]PersistentRecord{{
+		MetricsKey: "mk", BaseURL: "https://example.com", KeyMask: "sk-***", Timestamp: ts, Success: true,
+		OutputTokens: 500, ThinkingTokens: 320, Model: "claude-3", APIType: "messages",
+	}}); err != nil {
+		t.Fatalf("batchInsertRecords() err = %v", err)
+	}
+
+	records, err := store.LoadRecords(day, "messages")
+	if err != nil {
+		t.Fatalf("LoadRecords() err = %v", err)
+	}
+	if len(records) != 2 || records[0].ThinkingTokens != 0 || records[1].ThinkingTokens != 320 {
+		t.Fatalf("LoadRecords() = %+v, want legacy row 0 and new row 320 thinking tokens", records)
+	}
+
+	if err := store.AggregateDailyStats(ts); err != nil {
+		t.Fatalf("AggregateDailyStats() err = %v", err)
+	}
+	var thinking int64
+	if err := store.db.QueryRow(`SELECT thinking_tokens FROM daily_stats WHERE metrics_key = 'mk'`).Scan(&thinking); err != nil {
+		t.Fatalf("query daily_stats: %v", err)
+	}
+	if thinking != 320 {
+		t.Fatalf("daily_stats thinking_tokens = %d, want 320", thinking)
+	}
+}
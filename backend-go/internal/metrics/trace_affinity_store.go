@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/session"
+)
+
+// 确保 SQLiteStore 实现 session.TraceAffinityStore
+var _ session.TraceAffinityStore = (*SQLiteStore)(nil)
+
+// LoadTraceAffinities 加载最后使用时间不早于 since 的亲和记录
+func (s *SQLiteStore) LoadTraceAffinities(since time.Time) ([]session.TraceAffinityRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT user_id, channel_index, last_used_at, COALESCE(created_at, 0)
+		FROM trace_affinity
+		WHERE last_used_at >= ?
+	`, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []session.TraceAffinityRecord
+	for rows.Next() {
+		var r session.TraceAffinityRecord
+		var lastUsed, createdAt int64
+		if err := rows.Scan(&r.UserID, &r.ChannelIndex, &lastUsed, &createdAt); err != nil {
+			return nil, err
+		}
+		r.LastUsedAt = time.UnixMilli(lastUsed)
+		if createdAt > 0 {
+			r.CreatedAt = time.UnixMilli(createdAt)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// SaveTraceAffinities 批量写入亲和记录（同一 user_id 覆盖旧值）
+func (s *SQLiteStore) SaveTraceAffinities(records []session.TraceAffinityRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO trace_affinity (user_id, channel_index, last_used_at, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			channel_index = excluded.channel_index,
+			last_used_at = excluded.last_used_at,
+			created_at = excluded.created_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range records {
+		var createdAt int64
+		if !r.CreatedAt.IsZero() {
+			createdAt = r.CreatedAt.UnixMilli()
+		}
+		if _, err := stmt.Exec(r.UserID, r.ChannelIndex, r.LastUsedAt.UnixMilli(), createdAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteTraceAffinities 批量删除亲和记录
+func (s *SQLiteStore) DeleteTraceAffinities(userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare("DELETE FROM trace_affinity WHERE user_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, userID := range userIDs {
+		if _, err := stmt.Exec(userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CleanupTraceAffinities 清理最后使用时间早于 before 的亲和记录
+func (s *SQLiteStore) CleanupTraceAffinities(before time.Time) (int64, error) {
+	result, err := s.db.Exec("DELETE FROM trace_affinity WHERE last_used_at < ?", before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
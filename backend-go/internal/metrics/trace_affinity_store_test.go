@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/session"
+)
+
+func newTraceAffinityTestStore(t *testing.T, dbPath string) *SQLiteStore {
+	t.Helper()
+	store, err := NewSQLiteStore(&SQLiteStoreConfig{
+		DBPath:        dbPath,
+		RetentionDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() err = %v", err)
+	}
+	return store
+}
+
+func TestSQLiteStore_TraceAffinities(t *testing.T) {
+	store := newTraceAffinityTestStore(t, t.TempDir()+"/metrics.db")
+	t.Cleanup(func() { _ = store.Close() })
+
+	now := time.Now()
+	if err := store.SaveTraceAffinities([]session.TraceAffinityRecord{
+		{UserID: "conv-a", ChannelIndex: 1, LastUsedAt: now.Add(-time.Minute)},
+		{UserID: "conv-b", ChannelIndex: 2, LastUsedAt: now.Add(-2 * time.Hour)},
+	}); err != nil {
+		t.Fatalf("SaveTraceAffinities() err = %v", err)
+	}
+	// 重复写入同一 user_id 应覆盖
+	if err := store.SaveTraceAffinities([]session.TraceAffinityRecord{
+		{UserID: "conv-a", ChannelIndex: 3, LastUsedAt: now},
+	}); err != nil {
+		t.Fatalf("SaveTraceAffinities(upsert) err = %v", err)
+	}
+
+	records, err := store.LoadTraceAffinities(now.Add(-30 * time.Minute))
+	if err != nil {
+		t.Fatalf("LoadTraceAffinities() err = %v", err)
+	}
+	if len(records) != 1 || records[0].UserID != "conv-a" || records[0].ChannelIndex != 3 {
+		t.Fatalf("records = %+v, want only conv-a -> 3", records)
+	}
+
+	cleaned, err := store.CleanupTraceAffinities(now.Add(-30 * time.Minute))
+	if err != nil {
+		t.Fatalf("CleanupTraceAffinities() err = %v", err)
+	}
+	if cleaned != 1 {
+		t.Fatalf("cleaned = %d, want 1", cleaned)
+	}
+
+	if err := store.DeleteTraceAffinities([]string{"conv-a"}); err != nil {
+		t.Fatalf("DeleteTraceAffinities() err = %v", err)
+	}
+	records, err = store.LoadTraceAffinities(time.Time{})
+	if err != nil {
+		t.Fatalf("LoadTraceAffinities() err = %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("records = %+v, want empty", records)
+	}
+}
+
+// TestTraceAffinityManager_SurvivesRestart 测试亲和记录在重启后恢复，过期记录在加载时被清理
+func TestTraceAffinityManager_SurvivesRestart(t *testing.T) {
+	dbPath := t.TempDir() + "/metrics.db"
+
+	store := newTraceAffinityTestStore(t, dbPath)
+	mgr := session.NewTraceAffinityManagerWithStore(30*time.Minute, store)
+	mgr.SetPreferredChannel("conv-keep", 2)
+	mgr.SetPreferredChannel("conv-removed", 4)
+	mgr.Remove("conv-removed")
+	if err := store.SaveTraceAffinities([]session.TraceAffinityRecord{
+		{UserID: "conv-expired", ChannelIndex: 1, LastUsedAt: time.Now().Add(-time.Hour)},
+	}); err != nil {
+		t.Fatalf("SaveTraceAffinities() err = %v", err)
+	}
+	mgr.Stop() // 停止时写入剩余变更
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+
+	store = newTraceAffinityTestStore(t, dbPath)
+	t.Cleanup(func() { _ = store.Close() })
+	mgr = session.NewTraceAffinityManagerWithStore(30*time.Minute, store)
+	defer mgr.Stop()
+
+	if channel, ok := mgr.GetPreferredChannel("conv-keep"); !ok || channel != 2 {
+		t.Fatalf("conv-keep = (%d, %v), want (2, true)", channel, ok)
+	}
+	if _, ok := mgr.GetPreferredChannel("conv-removed"); ok {
+		t.Fatal("已移除的亲和记录不应在重启后恢复")
+	}
+	if _, ok := mgr.GetPreferredChannel("conv-expired"); ok {
+		t.Fatal("过期的亲和记录不应在重启后恢复")
+	}
+	records, err := store.LoadTraceAffinities(time.Time{})
+	if err != nil {
+		t.Fatalf("LoadTraceAffinities() err = %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("records = %+v, want only conv-keep (expired pruned on load)", records)
+	}
+}
+
+// TestTraceAffinityManager_MaxAgeSurvivesRestart 测试绑定时间随记录持久化，重启后不会重置最大存活时间
+func TestTraceAffinityManager_MaxAgeSurvivesRestart(t *testing.T) {
+	store := newTraceAffinityTestStore(t, t.TempDir()+"/metrics.db")
+	t.Cleanup(func() { _ = store.Close() })
+
+	now := time.Now()
+	if err := store.SaveTraceAffinities([]session.TraceAffinityRecord{
+		{UserID: "conv-old", ChannelIndex: 1, LastUsedAt: now, CreatedAt: now.Add(-2 * time.Hour)},
+		{UserID: "conv-new", ChannelIndex: 2, LastUsedAt: now, CreatedAt: now.Add(-time.Minute)},
+		{UserID: "conv-legacy", ChannelIndex: 3, LastUsedAt: now}, // 旧记录没有绑定时间
+	}); err != nil {
+		t.Fatalf("SaveTraceAffinities() err = %v", err)
+	}
+
+	mgr := session.NewTraceAffinityManagerWithStore(30*time.Minute, store)
+	defer mgr.Stop()
+	mgr.SetMaxAffinityAge(time.Hour)
+
+	if _, ok := mgr.GetPreferredChannel("conv-old"); ok {
+		t.Fatal("超过最大存活时间的亲和记录在重启后不应生效")
+	}
+	if channel, ok := mgr.GetPreferredChannel("conv-new"); !ok || channel != 2 {
+		t.Fatalf("conv-new = (%d, %v), want (2, true)", channel, ok)
+	}
+	if channel, ok := mgr.GetPreferredChannel("conv-legacy"); !ok || channel != 3 {
+		t.Fatalf("conv-legacy = (%d, %v), want (3, true)", channel, ok)
+	}
+}
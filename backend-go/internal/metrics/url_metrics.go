@@ -0,0 +1,69 @@
+package metrics
+
+import "time"
+
+// URLMetricsResponse 多 BaseURL 渠道中单个 BaseURL 的指标（聚合该 URL 下所有 Key）
+type URLMetricsResponse struct {
+	BaseURL             string  `json:"baseUrl"`
+	RequestCount        int64   `json:"requestCount"`
+	SuccessCount        int64   `json:"successCount"`
+	FailureCount        int64   `json:"failureCount"`
+	SuccessRate         float64 `json:"successRate"` // 基于滑动窗口内的近期结果，与渠道 successRate 口径一致
+	ConsecutiveFailures int64   `json:"consecutiveFailures"`
+	CircuitState        string  `json:"circuitState"`      // closed / half_open / open（所有 Key 均熔断时为 open）
+	CircuitBrokenKeys   int     `json:"circuitBrokenKeys"` // 处于 Open/HalfOpen 的 Key 数
+	LastSuccessAt       *string `json:"lastSuccessAt,omitempty"`
+	LastFailureAt       *string `json:"lastFailureAt,omitempty"`
+}
+
+// GetURLMetrics 按 BaseURL 分组获取渠道指标（保持 baseURLs 顺序），用于定位多端点渠道中持续失败的端点
+// 数据与 ToResponseMultiURL 相同（keyMetrics 按 hash(baseURL+apiKey) 记录），只是按 URL 而非按 Key 聚合
+func (m *MetricsManager) GetURLMetrics(baseURLs []string, activeKeys []string) []*URLMetricsResponse {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]*URLMetricsResponse, 0, len(baseURLs))
+	seen := make(map[string]bool, len(baseURLs))
+	for _, baseURL := range baseURLs {
+		if seen[baseURL] {
+			continue
+		}
+		seen[baseURL] = true
+
+		resp := &URLMetricsResponse{BaseURL: baseURL, SuccessRate: 100}
+		var latestSuccess, latestFailure *time.Time
+		recentTotal, recentFailures := 0, 0
+		for _, apiKey := range activeKeys {
+			metrics, exists := m.keyMetrics[generateMetricsKey(baseURL, apiKey)]
+			if !exists {
+				continue
+			}
+			resp.RequestCount += metrics.RequestCount
+			resp.SuccessCount += metrics.SuccessCount
+			resp.FailureCount += metrics.FailureCount
+			resp.ConsecutiveFailures = max(resp.ConsecutiveFailures, metrics.ConsecutiveFailures)
+			for _, success := range metrics.recentResults {
+				recentTotal++
+				if !success {
+					recentFailures++
+				}
+			}
+			if metrics.LastSuccessAt != nil && (latestSuccess == nil || metrics.LastSuccessAt.After(*latestSuccess)) {
+				latestSuccess = metrics.LastSuccessAt
+			}
+			if metrics.LastFailureAt != nil && (latestFailure == nil || metrics.LastFailureAt.After(*latestFailure)) {
+				latestFailure = metrics.LastFailureAt
+			}
+		}
+		if recentTotal > 0 {
+			resp.SuccessRate = float64(recentTotal-recentFailures) / float64(recentTotal) * 100
+		}
+		state, brokenKeys := m.channelCircuitStateLocked(baseURL, activeKeys)
+		resp.CircuitState = state.String()
+		resp.CircuitBrokenKeys = brokenKeys
+		resp.LastSuccessAt = formatTimePtr(latestSuccess)
+		resp.LastFailureAt = formatTimePtr(latestFailure)
+		result = append(result, resp)
+	}
+	return result
+}
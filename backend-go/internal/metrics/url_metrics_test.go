@@ -0,0 +1,43 @@
+package metrics
+
+import "testing"
+
+func TestGetURLMetrics_GroupsByBaseURL(t *testing.T) {
+	m, _ := newRecoveryTestManager(t)
+	const good, bad = "https://good.example.com", "https://bad.example.com"
+	keys := []string{"key-a", "key-b"}
+
+	m.RecordSuccess(good, "key-a")
+	m.RecordSuccess(good, "key-b")
+	m.RecordFailure(good, "key-b")
+	tripCircuit(t, m, bad, "key-a")
+	tripCircuit(t, m, bad, "key-b")
+
+	got := m.GetURLMetrics([]string{good, bad, good}, keys)
+	if len(got) != 2 {
+		t.Fatalf("expected one entry per distinct base URL, got %d", len(got))
+	}
+
+	if got[0].BaseURL != good || got[0].RequestCount != 3 || got[0].SuccessCount != 2 || got[0].FailureCount != 1 {
+		t.Fatalf("unexpected good URL metrics: %+v", got[0])
+	}
+	if got[0].CircuitState != "closed" || got[0].CircuitBrokenKeys != 0 || got[0].LastSuccessAt == nil {
+		t.Fatalf("expected good URL to be healthy: %+v", got[0])
+	}
+
+	if got[1].BaseURL != bad || got[1].FailureCount != 6 || got[1].SuccessRate != 0 || got[1].ConsecutiveFailures != 3 {
+		t.Fatalf("unexpected bad URL metrics: %+v", got[1])
+	}
+	if got[1].CircuitState != "open" || got[1].CircuitBrokenKeys != 2 || got[1].LastSuccessAt != nil {
+		t.Fatalf("expected bad URL circuit open on all keys: %+v", got[1])
+	}
+}
+
+func TestGetURLMetrics_NoTraffic(t *testing.T) {
+	m, _ := newRecoveryTestManager(t)
+
+	got := m.GetURLMetrics([]string{"https://idle.example.com"}, []string{"key-a"})
+	if len(got) != 1 || got[0].RequestCount != 0 || got[0].SuccessRate != 100 || got[0].CircuitState != "closed" {
+		t.Fatalf("unexpected idle URL metrics: %+v", got)
+	}
+}
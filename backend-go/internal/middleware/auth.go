@@ -34,8 +34,8 @@ func WebAuthMiddleware(envCfg *config.EnvConfig, cfgManager *config.ConfigManage
 			return
 		}
 
-		// 如果禁用了 Web UI，返回 404
-		if !envCfg.EnableWebUI {
+		// 如果禁用了 Web UI，返回 404（配置重载端点除外，纯 API 模式下仍需鉴权后可用）
+		if !envCfg.EnableWebUI && path != "/admin/config/reload" {
 			c.JSON(404, gin.H{
 				"error":   "Web界面已禁用",
 				"message": "此服务器运行在纯API模式下，请通过API端点访问服务",
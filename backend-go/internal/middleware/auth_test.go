@@ -24,6 +24,9 @@ func setupRouterWithAuth(envCfg *config.EnvConfig) *gin.Engine {
 	r.POST("/admin/config/save", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	})
+	r.POST("/admin/config/reload", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
 
 	// SPA routes should pass through without access key
 	r.GET("/", func(c *gin.Context) {
@@ -126,3 +129,37 @@ func TestWebAuthMiddleware_AdminRequiresKey(t *testing.T) {
 		}
 	})
 }
+
+func TestWebAuthMiddleware_ConfigReloadAvailableInAPIOnlyMode(t *testing.T) {
+	envCfg := &config.EnvConfig{
+		ProxyAccessKey: "secret-key",
+		EnableWebUI:    false,
+	}
+	router := setupRouterWithAuth(envCfg)
+
+	cases := []struct {
+		name string
+		path string
+		key  string
+		want int
+	}{
+		{"reload without key returns 401", "/admin/config/reload", "", http.StatusUnauthorized},
+		{"reload with key allows access", "/admin/config/reload", envCfg.ProxyAccessKey, http.StatusOK},
+		{"other admin endpoints stay disabled", "/admin/config/save", envCfg.ProxyAccessKey, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			if tc.key != "" {
+				req.Header.Set("x-api-key", tc.key)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
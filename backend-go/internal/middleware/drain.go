@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShutdownDrain 关闭前的排空状态：开始排空后拒绝新请求，已在处理中的请求（含流式响应）不受影响
+type ShutdownDrain struct {
+	draining atomic.Bool
+}
+
+// NewShutdownDrain 创建排空状态
+func NewShutdownDrain() *ShutdownDrain {
+	return &ShutdownDrain{}
+}
+
+// Begin 开始排空（可重复调用）
+func (d *ShutdownDrain) Begin() {
+	d.draining.Store(true)
+}
+
+// IsDraining 是否处于排空阶段
+func (d *ShutdownDrain) IsDraining() bool {
+	return d.draining.Load()
+}
+
+// Middleware 排空期间对新请求返回 503（包括 /health，便于负载均衡器摘除实例），并要求客户端关闭连接
+func (d *ShutdownDrain) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !d.IsDraining() {
+			c.Next()
+			return
+		}
+
+		c.Header("Connection", "close")
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"type": "error",
+			"error": gin.H{
+				"type":    "overloaded_error",
+				"message": "Server is shutting down, please retry",
+			},
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestShutdownDrain_RejectsNewRequestsWhileDraining(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	drain := NewShutdownDrain()
+	r := gin.New()
+	r.Use(drain.Middleware())
+	r.GET("/health", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.POST("/v1/messages", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("before drain: status = %d", w.Code)
+	}
+
+	drain.Begin()
+	drain.Begin()
+	if !drain.IsDraining() {
+		t.Fatal("IsDraining should be true after Begin")
+	}
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/v1/messages", nil),
+		httptest.NewRequest(http.MethodGet, "/health", nil),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("%s: status = %d, want 503", req.URL.Path, w.Code)
+		}
+		if w.Header().Get("Connection") != "close" || w.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s: missing drain headers: %v", req.URL.Path, w.Header())
+		}
+		if !strings.Contains(w.Body.String(), "overloaded_error") {
+			t.Fatalf("%s: body = %s", req.URL.Path, w.Body.String())
+		}
+	}
+}
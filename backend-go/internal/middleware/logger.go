@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/logger"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,9 +23,15 @@ var defaultSkipPrefixes = []string{
 // 仅对 GET 请求且匹配 skipPrefixes 前缀的路径跳过日志输出
 // POST/PUT/DELETE 等管理操作始终记录日志以保留审计跟踪
 func FilteredLogger(envCfg *config.EnvConfig, skipPrefixes ...string) gin.HandlerFunc {
+	// LOG_FORMAT=json 时访问日志同样输出为 JSON
+	var formatter gin.LogFormatter
+	if logger.IsJSONFormat(envCfg.LogFormat) {
+		formatter = logger.GinJSONFormatter
+	}
+
 	// 如果 QuietPollingLogs 为 false，使用标准 Logger
 	if !envCfg.QuietPollingLogs {
-		return gin.Logger()
+		return gin.LoggerWithConfig(gin.LoggerConfig{Formatter: formatter})
 	}
 
 	if len(skipPrefixes) == 0 {
@@ -32,6 +39,7 @@ func FilteredLogger(envCfg *config.EnvConfig, skipPrefixes ...string) gin.Handle
 	}
 
 	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Formatter: formatter,
 		Skip: func(c *gin.Context) bool {
 			// 只跳过 GET 请求，保留其他方法的审计日志
 			if c.Request.Method != http.MethodGet {
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestFilteredLoggerJSONKeepsQuietPolling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := &bytes.Buffer{}
+	orig := gin.DefaultWriter
+	gin.DefaultWriter = buf
+	defer func() { gin.DefaultWriter = orig }()
+
+	r := gin.New()
+	r.Use(FilteredLogger(&config.EnvConfig{QuietPollingLogs: true, LogFormat: "json"}))
+	r.GET("/api/messages/channels", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/v1/messages", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/messages/channels", nil),
+		httptest.NewRequest(http.MethodPost, "/v1/messages", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected only the POST to be logged, got %q", buf.String())
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("access log is not JSON: %q", lines[0])
+	}
+	if entry["path"] != "/v1/messages" || entry["method"] != http.MethodPost {
+		t.Fatalf("unexpected entry: %v", entry)
+	}
+}
+
+func TestFilteredLoggerTextByDefault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := &bytes.Buffer{}
+	orig := gin.DefaultWriter
+	gin.DefaultWriter = buf
+	defer func() { gin.DefaultWriter = orig }()
+
+	r := gin.New()
+	r.Use(FilteredLogger(&config.EnvConfig{}))
+	r.GET("/api/messages/channels", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/messages/channels", nil))
+
+	out := buf.String()
+	if !strings.Contains(out, "[GIN]") || strings.HasPrefix(strings.TrimSpace(out), "{") {
+		t.Fatalf("expected default text access log, got %q", out)
+	}
+}
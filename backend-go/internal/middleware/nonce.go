@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"container/list"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// NonceHeader 客户端提供请求唯一标识的请求头
+const NonceHeader = "X-Proxy-Nonce"
+
+// maxNonceLength nonce 最大长度（限制单条记录的内存占用）
+const maxNonceLength = 256
+
+// nonceEntry 已使用的 nonce 记录
+type nonceEntry struct {
+	key    string
+	seenAt time.Time
+}
+
+// NonceGuard 请求防重放校验（按入站访问密钥隔离，单密钥部署时按客户端 IP）
+// 与幂等不同：窗口内重复使用 nonce 直接拒绝，而不是返回缓存的响应。
+// 已使用的 nonce 按时间顺序记录，校验时顺带淘汰过期记录；数量达到上限时淘汰最旧记录，
+// 因此上限应不小于窗口内的预期请求量，否则被淘汰的 nonce 可在窗口内被重放。
+type NonceGuard struct {
+	envCfg     *config.EnvConfig
+	window     time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	seen  map[string]*list.Element
+	order *list.List // 按 seenAt 升序
+
+	now func() time.Time // 便于测试
+}
+
+// NewNonceGuard 创建防重放校验器
+func NewNonceGuard(envCfg *config.EnvConfig) *NonceGuard {
+	return &NonceGuard{
+		envCfg:     envCfg,
+		window:     time.Duration(envCfg.NonceWindow) * time.Second,
+		maxEntries: envCfg.NonceMaxEntries,
+		seen:       make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Middleware 返回防重放中间件（RequireNonce 未启用时直接放行）
+func (g *NonceGuard) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !g.envCfg.RequireNonce {
+			c.Next()
+			return
+		}
+
+		nonce := c.GetHeader(NonceHeader)
+		if nonce == "" || len(nonce) > maxNonceLength {
+			abortNonce(c, http.StatusBadRequest, "Missing or invalid "+NonceHeader+" header")
+			return
+		}
+
+		identity, scope := clientIdentity(c, g.envCfg.ProxyAccessKey)
+		if !g.check(scope + "\x00" + nonce) {
+			if g.envCfg.ShouldLog("warn") {
+				log.Printf("[Nonce] 拒绝重放请求 - 身份: %s, nonce: %s", maskIdentity(scope, identity), nonce)
+			}
+			abortNonce(c, http.StatusConflict, "Nonce has already been used")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// check 记录 nonce，窗口内已出现过时返回 false
+func (g *NonceGuard) check(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.evictExpiredLocked(now)
+	if _, ok := g.seen[key]; ok {
+		return false
+	}
+
+	for g.order.Len() >= g.maxEntries {
+		g.removeLocked(g.order.Front())
+	}
+	g.seen[key] = g.order.PushBack(&nonceEntry{key: key, seenAt: now})
+	return true
+}
+
+// evictExpiredLocked 淘汰超出窗口的记录，调用方需持有 g.mu
+func (g *NonceGuard) evictExpiredLocked(now time.Time) {
+	cutoff := now.Add(-g.window)
+	for e := g.order.Front(); e != nil; e = g.order.Front() {
+		if e.Value.(*nonceEntry).seenAt.After(cutoff) {
+			return
+		}
+		g.removeLocked(e)
+	}
+}
+
+func (g *NonceGuard) removeLocked(e *list.Element) {
+	delete(g.seen, e.Value.(*nonceEntry).key)
+	g.order.Remove(e)
+}
+
+func abortNonce(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "invalid_request_error",
+			"message": message,
+		},
+	})
+}
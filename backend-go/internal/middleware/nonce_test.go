@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// newNonceTestRouter 构建带防重放中间件的路由（窗口 60 秒）
+func newNonceTestRouter(t *testing.T, maxEntries int) (*gin.Engine, *time.Time) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	guard := NewNonceGuard(&config.EnvConfig{
+		ProxyAccessKey:  "shared",
+		LogLevel:        "error",
+		RequireNonce:    true,
+		NonceWindow:     60,
+		NonceMaxEntries: maxEntries,
+	})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	guard.now = func() time.Time { return now }
+
+	r := gin.New()
+	r.POST("/v1/messages", guard.Middleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return r, &now
+}
+
+func doNonceRequest(r *gin.Engine, apiKey, nonce string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("x-api-key", apiKey)
+	if nonce != "" {
+		req.Header.Set(NonceHeader, nonce)
+	}
+	req.RemoteAddr = "10.0.0.1:12345"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestNonceGuard_FreshNoncePassesReusedRejected(t *testing.T) {
+	r, _ := newNonceTestRouter(t, 1000)
+
+	if w := doNonceRequest(r, "alice", "n-1"); w.Code != http.StatusOK {
+		t.Fatalf("新 nonce 应通过，实际 %d", w.Code)
+	}
+	if w := doNonceRequest(r, "alice", "n-2"); w.Code != http.StatusOK {
+		t.Fatalf("另一个新 nonce 应通过，实际 %d", w.Code)
+	}
+	if w := doNonceRequest(r, "alice", "n-1"); w.Code != http.StatusConflict {
+		t.Fatalf("窗口内重复 nonce 应返回 409，实际 %d", w.Code)
+	}
+}
+
+func TestNonceGuard_MissingNonceRejected(t *testing.T) {
+	r, _ := newNonceTestRouter(t, 1000)
+
+	if w := doNonceRequest(r, "alice", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("缺少 nonce 应返回 400，实际 %d", w.Code)
+	}
+}
+
+func TestNonceGuard_ReuseAllowedAfterWindow(t *testing.T) {
+	r, now := newNonceTestRouter(t, 1000)
+
+	if w := doNonceRequest(r, "alice", "n-1"); w.Code != http.StatusOK {
+		t.Fatalf("新 nonce 应通过，实际 %d", w.Code)
+	}
+	*now = now.Add(61 * time.Second)
+	if w := doNonceRequest(r, "alice", "n-1"); w.Code != http.StatusOK {
+		t.Fatalf("窗口过期后 nonce 应可再次使用，实际 %d", w.Code)
+	}
+}
+
+func TestNonceGuard_ScopedPerIdentity(t *testing.T) {
+	r, _ := newNonceTestRouter(t, 1000)
+
+	if w := doNonceRequest(r, "alice", "n-1"); w.Code != http.StatusOK {
+		t.Fatalf("alice 的 nonce 应通过，实际 %d", w.Code)
+	}
+	if w := doNonceRequest(r, "bob", "n-1"); w.Code != http.StatusOK {
+		t.Fatalf("不同身份的相同 nonce 应互不影响，实际 %d", w.Code)
+	}
+}
+
+func TestNonceGuard_BoundedSeenSet(t *testing.T) {
+	r, _ := newNonceTestRouter(t, 2)
+
+	for _, nonce := range []string{"n-1", "n-2", "n-3"} {
+		if w := doNonceRequest(r, "alice", nonce); w.Code != http.StatusOK {
+			t.Fatalf("%s 应通过，实际 %d", nonce, w.Code)
+		}
+	}
+	// 达到上限时淘汰最旧记录
+	if w := doNonceRequest(r, "alice", "n-3"); w.Code != http.StatusConflict {
+		t.Fatalf("仍在记录中的 nonce 应被拒绝，实际 %d", w.Code)
+	}
+	if w := doNonceRequest(r, "alice", "n-1"); w.Code != http.StatusOK {
+		t.Fatalf("已淘汰的 nonce 应通过，实际 %d", w.Code)
+	}
+}
+
+func TestNonceGuard_DisabledPassesThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	guard := NewNonceGuard(&config.EnvConfig{NonceWindow: 60, NonceMaxEntries: 1000})
+	r := gin.New()
+	r.POST("/v1/messages", guard.Middleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	for i := 0; i < 2; i++ {
+		if w := doNonceRequest(r, "alice", "n-1"); w.Code != http.StatusOK {
+			t.Fatalf("未启用时应直接放行，实际 %d", w.Code)
+		}
+	}
+}
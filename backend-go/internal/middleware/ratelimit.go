@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// requestUsageKey 处理函数上报 usage 的 gin context 键
+const requestUsageKey = "request_usage"
+
+// rateLimitCleanupInterval 过期令牌桶清理间隔
+const rateLimitCleanupInterval = time.Minute
+
+// rateLimitIdleTTL 令牌桶空闲超过该时长即被清理（此时桶早已回满，清理不影响限流结果）
+const rateLimitIdleTTL = 10 * time.Minute
+
+// ReportUsage 处理函数在请求结束时上报 usage，限流中间件据此扣减 token 预算
+// 流式请求在流结束后才调用，因此计入的是最终输出 token
+func ReportUsage(c *gin.Context, usage *types.Usage) {
+	if usage != nil {
+		c.Set(requestUsageKey, usage)
+	}
+}
+
+// rateLimitBucket 单个身份的令牌桶（请求数与 token 两个维度）
+type rateLimitBucket struct {
+	requests float64
+	tokens   float64
+	updated  time.Time
+}
+
+// RateLimiter 代理入口限流（按入站访问密钥，单密钥部署时按客户端 IP）
+// 请求数与 token 各一个令牌桶：容量为每分钟限额，按限额/60 每秒匀速恢复
+// token 桶在请求准入时只要求余额为正，请求结束后按实际 usage 扣减（允许透支，最多透支一分钟额度）
+type RateLimiter struct {
+	envCfg     *config.EnvConfig
+	cfgManager *config.ConfigManager
+
+	mu      sync.Mutex
+	buckets map[string]*rateLimitBucket
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	now      func() time.Time // 便于测试
+}
+
+// NewRateLimiter 创建限流器并启动后台清理（限额从配置文件读取，支持热重载）
+func NewRateLimiter(envCfg *config.EnvConfig, cfgManager *config.ConfigManager) *RateLimiter {
+	rl := &RateLimiter{
+		envCfg:     envCfg,
+		cfgManager: cfgManager,
+		buckets:    make(map[string]*rateLimitBucket),
+		stopCh:     make(chan struct{}),
+		now:        time.Now,
+	}
+	go rl.cleanupLoop()
+	return rl
+}
+
+// Stop 停止后台清理
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() { close(rl.stopCh) })
+}
+
+// Middleware 返回限流中间件（需注册在代理端点处理函数之前）
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, bucketKey := rl.identify(c)
+		rule, enabled := rl.cfgManager.GetRateLimitRule(identity)
+		if !enabled || (rule.RequestsPerMinute == 0 && rule.TokensPerMinute == 0) {
+			c.Next()
+			return
+		}
+
+		if retryAfter, reason, ok := rl.allow(bucketKey, rule); !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			if rl.envCfg.ShouldLog("warn") {
+				log.Printf("[RateLimit] 请求被限流 - 身份: %s, 原因: %s, Retry-After: %ds", maskIdentity(bucketKey, identity), reason, seconds)
+			}
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"type":    "rate_limit_error",
+					"message": fmt.Sprintf("Rate limit exceeded: %s. Please retry after %d seconds.", reason, seconds),
+				},
+			})
+			return
+		}
+
+		c.Next()
+
+		if rule.TokensPerMinute == 0 {
+			return
+		}
+		if v, ok := c.Get(requestUsageKey); ok {
+			if usage, _ := v.(*types.Usage); usage != nil {
+				rl.charge(bucketKey, rule, usageTokens(usage))
+			}
+		}
+	}
+}
+
+// identify 返回限额查找身份与令牌桶键
+// 使用共享的 PROXY_ACCESS_KEY（或未携带密钥）时无法区分用户，按客户端 IP 限流；
+// 限流先于认证执行，仅 rateLimit.keys 中配置的密钥按密钥计数，其余密钥按客户端 IP，避免轮换伪造密钥绕过限额
+func (rl *RateLimiter) identify(c *gin.Context) (identity, bucketKey string) {
+	identity, bucketKey = clientIdentity(c, rl.envCfg.ProxyAccessKey)
+	if bucketKey == "key:"+identity && !rl.cfgManager.HasRateLimitKey(identity) {
+		ip := c.ClientIP()
+		return ip, "ip:" + ip
+	}
+	return identity, bucketKey
+}
+
+// clientIdentity 按入站访问密钥识别客户端，共享密钥或未携带密钥时按客户端 IP
+func clientIdentity(c *gin.Context, proxyAccessKey string) (identity, bucketKey string) {
+	key := getAPIKey(c)
+	if key == "" {
+		// Gemini 原生认证方式
+		if key = c.GetHeader("x-goog-api-key"); key == "" {
+			key = c.Query("key")
+		}
+	}
+	if key == "" || key == proxyAccessKey {
+		ip := c.ClientIP()
+		return ip, "ip:" + ip
+	}
+	return key, "key:" + key
+}
+
+// allow 准入检查：请求桶至少 1 个令牌且 token 桶余额为正，通过时扣减 1 个请求令牌
+func (rl *RateLimiter) allow(bucketKey string, rule config.RateLimitRule) (time.Duration, string, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b := rl.refillLocked(bucketKey, rule)
+
+	if rule.RequestsPerMinute > 0 && b.requests < 1 {
+		wait := secondsToDuration((1 - b.requests) / perSecond(rule.RequestsPerMinute))
+		return wait, fmt.Sprintf("%d requests per minute", rule.RequestsPerMinute), false
+	}
+	if rule.TokensPerMinute > 0 && b.tokens <= 0 {
+		// 恢复到正余额所需时间（至少 1 个 token）
+		wait := secondsToDuration((1 - b.tokens) / perSecond(rule.TokensPerMinute))
+		return wait, fmt.Sprintf("%d tokens per minute", rule.TokensPerMinute), false
+	}
+
+	if rule.RequestsPerMinute > 0 {
+		b.requests--
+	}
+	return 0, "", true
+}
+
+// charge 请求结束后按实际 usage 扣减 token 预算
+func (rl *RateLimiter) charge(bucketKey string, rule config.RateLimitRule, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b := rl.refillLocked(bucketKey, rule)
+	capacity := float64(rule.TokensPerMinute)
+	b.tokens = math.Max(b.tokens-float64(tokens), -capacity)
+}
+
+// refillLocked 获取（不存在则创建满桶）并按流逝时间恢复令牌，调用方需持有 rl.mu
+func (rl *RateLimiter) refillLocked(bucketKey string, rule config.RateLimitRule) *rateLimitBucket {
+	now := rl.now()
+	b, ok := rl.buckets[bucketKey]
+	if !ok {
+		b = &rateLimitBucket{
+			requests: float64(rule.RequestsPerMinute),
+			tokens:   float64(rule.TokensPerMinute),
+			updated:  now,
+		}
+		rl.buckets[bucketKey] = b
+		return b
+	}
+
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.requests = math.Min(b.requests+elapsed*perSecond(rule.RequestsPerMinute), float64(rule.RequestsPerMinute))
+		b.tokens = math.Min(b.tokens+elapsed*perSecond(rule.TokensPerMinute), float64(rule.TokensPerMinute))
+		b.updated = now
+	}
+	return b
+}
+
+// cleanupLoop 定期清理空闲令牌桶
+func (rl *RateLimiter) cleanupLoop() {
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rl.cleanup()
+		case <-rl.stopCh:
+			return
+		}
+	}
+}
+
+// cleanup 删除空闲超过 rateLimitIdleTTL 的令牌桶
+func (rl *RateLimiter) cleanup() {
+	cutoff := rl.now().Add(-rateLimitIdleTTL)
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for key, b := range rl.buckets {
+		if b.updated.Before(cutoff) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// usageTokens 计入 token 预算的用量：输入 + 缓存创建 + 输出（缓存读取不计入）
+func usageTokens(usage *types.Usage) int {
+	return usage.InputTokens + usage.CacheCreationInputTokens + usage.OutputTokens
+}
+
+func perSecond(perMinute int) float64 {
+	return float64(perMinute) / 60
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// maskIdentity 日志中脱敏密钥身份，IP 原样输出
+func maskIdentity(bucketKey, identity string) string {
+	if bucketKey == "ip:"+identity {
+		return bucketKey
+	}
+	return "key:" + utils.MaskAPIKey(identity)
+}
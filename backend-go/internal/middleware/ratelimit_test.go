@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/gin-gonic/gin"
+)
+
+// newRateLimitTestRouter 构建带限流中间件的路由，处理函数按 outputTokens 上报 usage
+func newRateLimitTestRouter(t *testing.T, rl *config.RateLimitConfig, outputTokens int) (*gin.Engine, *RateLimiter, *time.Time) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	data, err := json.Marshal(config.Config{RateLimit: rl})
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfgManager, err := config.NewConfigManager(configFile)
+	if err != nil {
+		t.Fatalf("NewConfigManager: %v", err)
+	}
+	t.Cleanup(func() { cfgManager.Close() })
+
+	limiter := NewRateLimiter(&config.EnvConfig{ProxyAccessKey: "shared", LogLevel: "error"}, cfgManager)
+	t.Cleanup(limiter.Stop)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	r := gin.New()
+	r.POST("/v1/messages", limiter.Middleware(), func(c *gin.Context) {
+		ReportUsage(c, &types.Usage{InputTokens: 10, OutputTokens: outputTokens})
+		c.String(http.StatusOK, "ok")
+	})
+	return r, limiter, &now
+}
+
+func doRateLimitRequest(r *gin.Engine, apiKey, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	if apiKey != "" {
+		req.Header.Set("x-api-key", apiKey)
+	}
+	req.RemoteAddr = ip + ":12345"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimiter_RequestsPerMinutePerKey(t *testing.T) {
+	r, _, now := newRateLimitTestRouter(t, &config.RateLimitConfig{
+		Enabled:           true,
+		RequestsPerMinute: 2,
+		Keys: map[string]config.RateLimitRule{
+			"alice": {RequestsPerMinute: 2},
+			"bob":   {RequestsPerMinute: 2},
+			"vip":   {RequestsPerMinute: 5},
+		},
+	}, 0)
+
+	for i := 0; i < 2; i++ {
+		if w := doRateLimitRequest(r, "alice", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("第 %d 个请求应通过，实际 %d", i+1, w.Code)
+		}
+	}
+
+	w := doRateLimitRequest(r, "alice", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("超出 RPM 应返回 429，实际 %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "30" {
+		t.Fatalf("Retry-After = %q, want 30", w.Header().Get("Retry-After"))
+	}
+	var body struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Type != "error" || body.Error.Type != "rate_limit_error" {
+		t.Fatalf("应返回 Anthropic 风格错误体，实际 %s", w.Body.String())
+	}
+
+	// 其他密钥互不影响；Keys 中的覆盖限额生效
+	if w := doRateLimitRequest(r, "bob", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("不同密钥应独立计数，实际 %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := doRateLimitRequest(r, "vip", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("vip 第 %d 个请求应通过，实际 %d", i+1, w.Code)
+		}
+	}
+
+	// 令牌匀速恢复：30 秒恢复 1 个请求
+	*now = now.Add(30 * time.Second)
+	if w := doRateLimitRequest(r, "alice", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("恢复后应通过，实际 %d", w.Code)
+	}
+}
+
+func TestRateLimiter_SharedKeyFallsBackToClientIP(t *testing.T) {
+	r, _, _ := newRateLimitTestRouter(t, &config.RateLimitConfig{Enabled: true, RequestsPerMinute: 1}, 0)
+
+	if w := doRateLimitRequest(r, "shared", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("首个请求应通过，实际 %d", w.Code)
+	}
+	if w := doRateLimitRequest(r, "shared", "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("同一 IP 超限应返回 429，实际 %d", w.Code)
+	}
+	if w := doRateLimitRequest(r, "shared", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Fatalf("共享密钥下不同 IP 应独立计数，实际 %d", w.Code)
+	}
+}
+
+func TestRateLimiter_UnknownKeysFallBackToClientIP(t *testing.T) {
+	r, _, _ := newRateLimitTestRouter(t, &config.RateLimitConfig{
+		Enabled:           true,
+		RequestsPerMinute: 1,
+		Keys:              map[string]config.RateLimitRule{"vip": {RequestsPerMinute: 1}},
+	}, 0)
+
+	// 限流先于认证，未配置的密钥可能是伪造的：轮换密钥不能绕过同一 IP 的限额
+	if w := doRateLimitRequest(r, "forged-1", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("首个请求应通过，实际 %d", w.Code)
+	}
+	if w := doRateLimitRequest(r, "forged-2", "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("轮换未配置的密钥应按 IP 计数并返回 429，实际 %d", w.Code)
+	}
+	if w := doRateLimitRequest(r, "vip", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("已配置的密钥应独立计数，实际 %d", w.Code)
+	}
+}
+
+func TestRateLimiter_TokensChargedAfterCompletion(t *testing.T) {
+	r, _, now := newRateLimitTestRouter(t, &config.RateLimitConfig{Enabled: true, TokensPerMinute: 600}, 590)
+
+	// 准入时预算为正即放行，结束后按 10 输入 + 590 输出扣减
+	if w := doRateLimitRequest(r, "alice", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("首个请求应通过，实际 %d", w.Code)
+	}
+	w := doRateLimitRequest(r, "alice", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("token 预算耗尽应返回 429，实际 %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+	}
+
+	*now = now.Add(time.Second)
+	if w := doRateLimitRequest(r, "alice", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("预算恢复后应通过，实际 %d", w.Code)
+	}
+}
+
+func TestRateLimiter_DisabledAndCleanup(t *testing.T) {
+	r, limiter, now := newRateLimitTestRouter(t, &config.RateLimitConfig{Enabled: false, RequestsPerMinute: 1}, 0)
+	for i := 0; i < 3; i++ {
+		if w := doRateLimitRequest(r, "alice", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("未启用限流时应始终通过，实际 %d", w.Code)
+		}
+	}
+	if len(limiter.buckets) != 0 {
+		t.Fatalf("未启用限流时不应创建令牌桶，实际 %d", len(limiter.buckets))
+	}
+
+	limiter.allow("key:alice", config.RateLimitRule{RequestsPerMinute: 1})
+	*now = now.Add(rateLimitIdleTTL + time.Second)
+	limiter.cleanup()
+	if len(limiter.buckets) != 0 {
+		t.Fatalf("空闲令牌桶应被清理，剩余 %d", len(limiter.buckets))
+	}
+}
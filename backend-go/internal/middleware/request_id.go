@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader 请求 ID 请求头/响应头
+const RequestIDHeader = "X-Request-Id"
+
+// RequestIDContextKey 请求 ID 在 gin.Context 中的键
+const RequestIDContextKey = "requestID"
+
+// maxRequestIDLength 客户端传入请求 ID 的最大长度
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware 为每个请求分配唯一 ID
+// 客户端携带合法的 X-Request-Id 时沿用（便于与调用方日志关联），否则生成 UUID；ID 写入响应头并存入上下文
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !isValidRequestID(id) {
+			id = uuid.New().String()
+		}
+		c.Set(RequestIDContextKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// GetRequestID 获取当前请求的 ID；未经过 RequestIDMiddleware 时生成并记录一个新 ID
+func GetRequestID(c *gin.Context) string {
+	if id := c.GetString(RequestIDContextKey); id != "" {
+		return id
+	}
+	id := uuid.New().String()
+	c.Set(RequestIDContextKey, id)
+	c.Header(RequestIDHeader, id)
+	return id
+}
+
+// isValidRequestID 仅接受长度受限的字母、数字与 -_.: 字符，避免日志注入
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.' || r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestIDMiddleware())
+	var seen string
+	r.GET("/", func(c *gin.Context) {
+		seen = GetRequestID(c)
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "generated", incoming: "", keep: false},
+		{name: "honor incoming", incoming: "req_abc-123:1.2", keep: true},
+		{name: "reject injection", incoming: "abc\" level=error", keep: false},
+		{name: "reject too long", incoming: strings.Repeat("a", maxRequestIDLength+1), keep: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			got := w.Header().Get(RequestIDHeader)
+			if got == "" || got != seen {
+				t.Fatalf("header = %q, context = %q", got, seen)
+			}
+			if tt.keep != (got == tt.incoming) {
+				t.Fatalf("incoming %q, got %q, keep = %v", tt.incoming, got, tt.keep)
+			}
+		})
+	}
+}
+
+func TestGetRequestIDWithoutMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	id := GetRequestID(c)
+	if id == "" || GetRequestID(c) != id {
+		t.Fatalf("expected stable generated id, got %q", id)
+	}
+	if w.Header().Get(RequestIDHeader) != id {
+		t.Fatalf("expected response header to be set")
+	}
+}
@@ -1,16 +1,31 @@
-// Package pricing 提供 LiteLLM 价格表服务
+// Package pricing 提供模型价格表服务（LiteLLM 价格表、自定义 URL 或本地文件）
 package pricing
 
 import (
-	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 const LiteLLMPricingURL = "https://raw.githubusercontent.com/BerriAI/litellm/main/model_prices_and_context_window.json"
 
+// RemoteDisabled 作为 Options.URL 时不拉取远程价格表（仅使用本地文件与内置默认价格）
+const RemoteDisabled = "none"
+
+// Options 价格表来源配置
+type Options struct {
+	// URL 远程价格表地址（空表示 LiteLLM 价格表，RemoteDisabled 表示不拉取）
+	URL string
+	// File 本地价格表文件（空表示不使用），同一模型优先于远程价格表，文件变化时自动重载
+	File string
+	// UpdateInterval 远程价格表更新间隔（默认 24h）
+	UpdateInterval time.Duration
+}
+
 // ModelPricing LiteLLM 模型价格信息
 type ModelPricing struct {
 	InputCostPerToken           float64 `json:"input_cost_per_token"`
@@ -26,49 +41,77 @@ type ModelPricing struct {
 
 // Service 价格表服务
 type Service struct {
-	models         map[string]*ModelPricing
+	models         map[string]*ModelPricing // 合并后的价格表（本地文件覆盖远程）
+	remoteModels   map[string]*ModelPricing
+	fileModels     map[string]*ModelPricing
 	mu             sync.RWMutex
 	lastUpdated    time.Time
+	url            string
+	file           string
 	updateInterval time.Duration
+	watcher        *fsnotify.Watcher
 	stopCh         chan struct{}
 }
 
-// NewService 创建价格表服务
+// NewService 创建价格表服务（从 LiteLLM 拉取价格表）
 func NewService(updateInterval time.Duration) *Service {
-	if updateInterval == 0 {
-		updateInterval = 24 * time.Hour
+	return NewServiceWithOptions(Options{UpdateInterval: updateInterval})
+}
+
+// NewServiceWithOptions 按指定来源创建价格表服务
+func NewServiceWithOptions(opts Options) *Service {
+	if opts.UpdateInterval == 0 {
+		opts.UpdateInterval = 24 * time.Hour
+	}
+	if opts.URL == "" {
+		opts.URL = LiteLLMPricingURL
 	}
 	svc := &Service{
 		models:         make(map[string]*ModelPricing),
-		updateInterval: updateInterval,
+		url:            opts.URL,
+		file:           opts.File,
+		updateInterval: opts.UpdateInterval,
 		stopCh:         make(chan struct{}),
 	}
 	// 启动时加载
-	if err := svc.loadPricing(); err != nil {
-		log.Printf("[Pricing] 警告: 初始加载失败: %v", err)
+	if svc.file != "" {
+		if err := svc.loadFile(); err != nil {
+			log.Printf("[Pricing] 警告: 本地价格表加载失败: %v", err)
+		}
+		if err := svc.startWatcher(); err != nil {
+			log.Printf("[Pricing] 警告: 本地价格表监听失败: %v", err)
+		}
+	}
+	if svc.url != RemoteDisabled {
+		if err := svc.loadPricing(); err != nil {
+			log.Printf("[Pricing] 警告: 初始加载失败: %v", err)
+		}
+		// 后台更新
+		go svc.autoUpdate()
 	}
-	// 后台更新
-	go svc.autoUpdate()
 	return svc
 }
 
-// loadPricing 从 LiteLLM 加载价格表
+// loadPricing 从远程 URL 加载价格表
 func (s *Service) loadPricing() error {
 	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(LiteLLMPricingURL)
+	resp, err := client.Get(s.url)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("价格表请求失败: HTTP %d", resp.StatusCode)
+	}
 
-	var models map[string]*ModelPricing
-	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+	models, err := decodePriceTable(resp.Body)
+	if err != nil {
 		return err
 	}
 
 	s.mu.Lock()
-	s.models = models
-	s.lastUpdated = time.Now()
+	s.remoteModels = models
+	s.rebuildLocked()
 	s.mu.Unlock()
 
 	log.Printf("[Pricing] 加载 %d 个模型价格", len(models))
@@ -94,6 +137,9 @@ func (s *Service) autoUpdate() {
 // Stop 停止后台更新
 func (s *Service) Stop() {
 	close(s.stopCh)
+	if s.watcher != nil {
+		s.watcher.Close()
+	}
 }
 
 // Calculate 计算成本 (返回 cents)
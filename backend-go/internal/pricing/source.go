@@ -0,0 +1,152 @@
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// priceEntry 价格表条目：兼容 LiteLLM 格式（美元/token）与自定义格式（美元/百万 token）
+//
+//	{"claude-sonnet-4": {"inputPer1M": 3, "outputPer1M": 15, "cacheWritePer1M": 3.75, "cacheReadPer1M": 0.3}}
+//
+// 任一 *Per1M 字段存在时按自定义格式解析，未填写的字段视为免费
+type priceEntry struct {
+	ModelPricing
+	InputPer1M      *float64 `json:"inputPer1M"`
+	OutputPer1M     *float64 `json:"outputPer1M"`
+	CacheWritePer1M *float64 `json:"cacheWritePer1M"`
+	CacheReadPer1M  *float64 `json:"cacheReadPer1M"`
+}
+
+func (e *priceEntry) isCustom() bool {
+	return e.InputPer1M != nil || e.OutputPer1M != nil || e.CacheWritePer1M != nil || e.CacheReadPer1M != nil
+}
+
+// toModelPricing 转换为按 token 计价的 ModelPricing
+func (e *priceEntry) toModelPricing() (*ModelPricing, error) {
+	p := e.ModelPricing
+	if e.isCustom() {
+		perToken := func(v *float64) float64 {
+			if v == nil {
+				return 0
+			}
+			return *v / 1_000_000
+		}
+		p.InputCostPerToken = perToken(e.InputPer1M)
+		p.OutputCostPerToken = perToken(e.OutputPer1M)
+		p.CacheCreationInputTokenCost = perToken(e.CacheWritePer1M)
+		p.CacheReadInputTokenCost = perToken(e.CacheReadPer1M)
+	}
+	if p.InputCostPerToken < 0 || p.OutputCostPerToken < 0 || p.CacheCreationInputTokenCost < 0 || p.CacheReadInputTokenCost < 0 {
+		return nil, fmt.Errorf("价格不能为负数")
+	}
+	return &p, nil
+}
+
+// decodePriceTable 解析价格表（模型名 → 价格）
+// LiteLLM 价格表中的非模型条目（如 sample_spec 说明）无法解析为价格时跳过；自定义格式的非法价格视为整个价格表无效
+func decodePriceTable(r io.Reader) (map[string]*ModelPricing, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	models := make(map[string]*ModelPricing, len(raw))
+	for model, data := range raw {
+		var entry priceEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+		p, err := entry.toModelPricing()
+		if err != nil {
+			if entry.isCustom() {
+				return nil, fmt.Errorf("模型 %s: %w", model, err)
+			}
+			continue
+		}
+		models[model] = p
+	}
+	return models, nil
+}
+
+// loadFile 从本地文件加载价格表；解析失败时保留上一次成功加载的价格
+func (s *Service) loadFile() error {
+	f, err := os.Open(s.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	models, err := decodePriceTable(f)
+	if err != nil {
+		return fmt.Errorf("解析 %s 失败: %w", s.file, err)
+	}
+
+	s.mu.Lock()
+	s.fileModels = models
+	s.rebuildLocked()
+	s.mu.Unlock()
+
+	log.Printf("[Pricing] 从本地文件 %s 加载 %d 个模型价格", s.file, len(models))
+	return nil
+}
+
+// rebuildLocked 合并远程与本地价格表（同一模型以本地文件为准），调用方需持有写锁
+func (s *Service) rebuildLocked() {
+	models := make(map[string]*ModelPricing, len(s.remoteModels)+len(s.fileModels))
+	for k, v := range s.remoteModels {
+		models[k] = v
+	}
+	for k, v := range s.fileModels {
+		models[k] = v
+	}
+	s.models = models
+	s.lastUpdated = time.Now()
+}
+
+// startWatcher 监听本地价格表文件变化并自动重载
+// 监听所在目录而非文件本身，以兼容编辑器"写临时文件再重命名"的保存方式
+func (s *Service) startWatcher() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(s.file)); err != nil {
+		watcher.Close()
+		return err
+	}
+	s.watcher = watcher
+
+	target := filepath.Clean(s.file)
+	go func() {
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != target || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := s.loadFile(); err != nil {
+					log.Printf("[Pricing] 警告: 本地价格表重载失败: %v", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("[Pricing] 警告: 本地价格表监听错误: %v", err)
+			}
+		}
+	}()
+	return nil
+}
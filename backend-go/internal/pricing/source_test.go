@@ -0,0 +1,104 @@
+package pricing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodePriceTable(t *testing.T) {
+	models, err := decodePriceTable(strings.NewReader(`{
+		"custom-model": {"inputPer1M": 3, "outputPer1M": 15, "cacheWritePer1M": 3.75, "cacheReadPer1M": 0.3},
+		"litellm-model": {"input_cost_per_token": 0.000001, "output_cost_per_token": 0.000002, "litellm_provider": "openai"},
+		"sample_spec": {"max_tokens": "LEGACY parameter"}
+	}`))
+	if err != nil {
+		t.Fatalf("decodePriceTable: %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("models = %d, want 2 (非模型条目应跳过)", len(models))
+	}
+	p := models["custom-model"]
+	if p.InputCostPerToken != 0.000003 || p.OutputCostPerToken != 0.000015 || p.CacheCreationInputTokenCost != 0.00000375 || p.CacheReadInputTokenCost != 0.0000003 {
+		t.Fatalf("custom-model = %+v", p)
+	}
+	if p := models["litellm-model"]; p.InputCostPerToken != 0.000001 || p.LiteLLMProvider != "openai" {
+		t.Fatalf("litellm-model = %+v", p)
+	}
+
+	if _, err := decodePriceTable(strings.NewReader(`{"m": {"inputPer1M": -1}}`)); err == nil {
+		t.Fatalf("negative custom price: err = nil")
+	}
+}
+
+func TestNewServiceWithOptions_FileOverridesRemote(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"claude-sonnet-4": {"input_cost_per_token": 0.000003, "output_cost_per_token": 0.000015},
+			"gpt-4o": {"input_cost_per_token": 0.0000025, "output_cost_per_token": 0.00001}
+		}`))
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(file, []byte(`{"claude-sonnet-4": {"inputPer1M": 2, "outputPer1M": 10}}`), 0644); err != nil {
+		t.Fatalf("write pricing file: %v", err)
+	}
+
+	svc := NewServiceWithOptions(Options{URL: server.URL, File: file})
+	defer svc.Stop()
+
+	if svc.ModelCount() != 2 {
+		t.Fatalf("ModelCount() = %d, want 2", svc.ModelCount())
+	}
+	// 本地文件优先：1M input + 1M output = $2 + $10
+	if got := svc.Calculate("claude-sonnet-4", 1_000_000, 1_000_000, 0, 0); got != 1200 {
+		t.Fatalf("Calculate(claude-sonnet-4) = %d, want 1200", got)
+	}
+	// 文件中没有的模型使用远程价格表
+	if got := svc.Calculate("gpt-4o", 1_000_000, 0, 0, 0); got != 250 {
+		t.Fatalf("Calculate(gpt-4o) = %d, want 250", got)
+	}
+	// 未知模型使用内置默认价格
+	if got := svc.Calculate("unknown", 1_000_000, 0, 0, 0); got != 300 {
+		t.Fatalf("Calculate(unknown) = %d, want 300", got)
+	}
+}
+
+func TestNewServiceWithOptions_WatchesFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(file, []byte(`{"m": {"inputPer1M": 1}}`), 0644); err != nil {
+		t.Fatalf("write pricing file: %v", err)
+	}
+
+	svc := NewServiceWithOptions(Options{URL: RemoteDisabled, File: file})
+	defer svc.Stop()
+
+	if got := svc.Calculate("m", 1_000_000, 0, 0, 0); got != 100 {
+		t.Fatalf("Calculate(m) = %d, want 100", got)
+	}
+
+	// 非法内容不覆盖已加载的价格
+	if err := os.WriteFile(file, []byte(`{"m": {"inputPer1M": -5}}`), 0644); err != nil {
+		t.Fatalf("write pricing file: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := svc.Calculate("m", 1_000_000, 0, 0, 0); got != 100 {
+		t.Fatalf("Calculate(m) after invalid update = %d, want 100", got)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"m": {"inputPer1M": 5}}`), 0644); err != nil {
+		t.Fatalf("write pricing file: %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for svc.Calculate("m", 1_000_000, 0, 0, 0) != 500 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pricing file change not reloaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// anthropicBetaHeader Anthropic beta 特性请求头（多个特性以逗号分隔）
+const anthropicBetaHeader = "Anthropic-Beta"
+
+// debugLogging 是否输出调试日志（LOG_LEVEL=debug）
+var debugLogging atomic.Bool
+
+// SetDebugLogging 设置是否输出 provider 调试日志（需在开始服务前调用）
+func SetDebugLogging(enabled bool) {
+	debugLogging.Store(enabled)
+}
+
+// filterAnthropicBeta 按渠道 allowedBetas 过滤 anthropic-beta 请求头，仅保留交集
+// 渠道未配置 allowedBetas 时原样透传；过滤后为空则删除该请求头
+func filterAnthropicBeta(headers http.Header, upstream *config.UpstreamConfig) {
+	if len(upstream.AllowedBetas) == 0 {
+		return
+	}
+	values := headers.Values(anthropicBetaHeader)
+	if len(values) == 0 {
+		return
+	}
+
+	allowed := make(map[string]bool, len(upstream.AllowedBetas))
+	for _, beta := range upstream.AllowedBetas {
+		allowed[strings.ToLower(beta)] = true
+	}
+
+	var kept, stripped []string
+	for _, value := range values {
+		for _, beta := range strings.Split(value, ",") {
+			beta = strings.TrimSpace(beta)
+			if beta == "" {
+				continue
+			}
+			if allowed[strings.ToLower(beta)] {
+				kept = append(kept, beta)
+			} else {
+				stripped = append(stripped, beta)
+			}
+		}
+	}
+
+	if len(stripped) > 0 && debugLogging.Load() {
+		log.Printf("[Messages-Beta] 渠道 %s 不支持的 anthropic-beta 已剔除: %s", upstream.Name, strings.Join(stripped, ","))
+	}
+	if len(kept) == 0 {
+		headers.Del(anthropicBetaHeader)
+		return
+	}
+	headers.Set(anthropicBetaHeader, strings.Join(kept, ","))
+}
@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func convertWithBetas(t *testing.T, upstream *config.UpstreamConfig, betas ...string) http.Header {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader([]byte(`{"model":"claude-3"}`)))
+	for _, beta := range betas {
+		c.Request.Header.Add("anthropic-beta", beta)
+	}
+
+	req, _, err := (&ClaudeProvider{}).ConvertToProviderRequest(c, upstream, "sk-ant-test")
+	if err != nil {
+		t.Fatalf("ConvertToProviderRequest: %v", err)
+	}
+	return req.Header
+}
+
+func TestClaudeProvider_FiltersAnthropicBetaByAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		betas   []string
+		want    []string // nil 表示请求头被删除
+	}{
+		{"未配置时原样透传", nil, []string{"prompt-caching-2024-07-31,unknown-beta"}, []string{"prompt-caching-2024-07-31,unknown-beta"}},
+		{"仅保留交集", []string{"prompt-caching-2024-07-31"}, []string{"prompt-caching-2024-07-31, unknown-beta"}, []string{"prompt-caching-2024-07-31"}},
+		{"多个请求头值合并", []string{"a", "C"}, []string{"a,b", "c"}, []string{"a,c"}},
+		{"全部剔除时删除请求头", []string{"a"}, []string{"b,c"}, nil},
+		{"未携带请求头", []string{"a"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &config.UpstreamConfig{Name: "u", BaseURL: "https://api.example.com", AllowedBetas: tt.allowed}
+			got := convertWithBetas(t, upstream, tt.betas...).Values("Anthropic-Beta")
+			if len(got) != len(tt.want) {
+				t.Fatalf("anthropic-beta = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("anthropic-beta = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
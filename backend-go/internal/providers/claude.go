@@ -99,8 +99,10 @@ func (p *ClaudeProvider) ConvertToProviderRequest(c *gin.Context, upstream *conf
 
 	// 使用统一的头部处理逻辑
 	req.Header = utils.PrepareUpstreamHeaders(c, req.URL.Host)
+	filterAnthropicBeta(req.Header, upstream)
 	utils.SetAuthenticationHeader(req.Header, apiKey)
 	utils.EnsureCompatibleUserAgent(req.Header, "claude")
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
 
 	return req, bodyBytes, nil
 }
@@ -0,0 +1,177 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/converters"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// ClaudeResponsesProvider Messages 渠道的 Responses 上游提供商
+// 请求方向 Claude → Responses，响应方向 Responses → Claude（含 tool_use / function_call 互转）
+type ClaudeResponsesProvider struct{}
+
+// ConvertToProviderRequest 转换为 Responses 请求
+func (p *ClaudeResponsesProvider) ConvertToProviderRequest(c *gin.Context, upstream *config.UpstreamConfig, apiKey string) (*http.Request, []byte, error) {
+	originalBodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取请求体失败: %w", err)
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(originalBodyBytes))
+
+	var claudeReq types.ClaudeRequest
+	if err := json.Unmarshal(originalBodyBytes, &claudeReq); err != nil {
+		return nil, originalBodyBytes, fmt.Errorf("解析Claude请求体失败: %w", err)
+	}
+
+	responsesReq := map[string]interface{}{
+		"model":  config.RedirectModel(claudeReq.Model, upstream),
+		"input":  converters.ClaudeMessagesToResponsesInput(claudeReq.Messages),
+		"stream": claudeReq.Stream,
+		"store":  false,
+	}
+	if claudeReq.System != nil {
+		if systemText := extractSystemText(claudeReq.System); systemText != "" {
+			responsesReq["instructions"] = systemText
+		}
+	}
+	if claudeReq.MaxTokens > 0 {
+		responsesReq["max_output_tokens"] = claudeReq.MaxTokens
+	}
+	if claudeReq.Temperature != nil {
+		responsesReq["temperature"] = *claudeReq.Temperature
+	}
+	if claudeReq.TopP != nil {
+		responsesReq["top_p"] = *claudeReq.TopP
+	}
+	if len(claudeReq.Tools) > 0 {
+		responsesReq["tools"] = converters.ClaudeToolsToResponsesTools(claudeReq.Tools)
+	}
+
+	// thinking.budget_tokens -> reasoning.effort
+	if effort := converters.ReasoningEffortToOpenAI(converters.ClaudeThinkingToReasoningEffort(claudeReq.Thinking)); effort != "" {
+		responsesReq["reasoning"] = map[string]interface{}{"effort": effort}
+	}
+
+	reqBodyBytes, err := json.Marshal(responsesReq)
+	if err != nil {
+		return nil, originalBodyBytes, fmt.Errorf("序列化Responses请求体失败: %w", err)
+	}
+
+	// 与 Responses 渠道一致：baseURL 以 # 结尾或已含版本号时不再追加 /v1
+	url := (&ResponsesProvider{}).buildTargetURL(upstream)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(reqBodyBytes))
+	if err != nil {
+		return nil, originalBodyBytes, fmt.Errorf("创建Responses请求失败: %w", err)
+	}
+
+	req.Header = utils.PrepareUpstreamHeaders(c, req.URL.Host)
+	utils.SetAuthenticationHeader(req.Header, apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
+
+	return req, originalBodyBytes, nil
+}
+
+// ConvertToClaudeResponse 将 Responses 响应转换为 Claude 响应
+func (p *ClaudeResponsesProvider) ConvertToClaudeResponse(providerResp *types.ProviderResponse) (*types.ClaudeResponse, error) {
+	var responsesResp struct {
+		Output            []map[string]interface{} `json:"output"`
+		IncompleteDetails *struct {
+			Reason string `json:"reason"`
+		} `json:"incomplete_details"`
+		Usage *struct {
+			InputTokens        int `json:"input_tokens"`
+			OutputTokens       int `json:"output_tokens"`
+			InputTokensDetails struct {
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"input_tokens_details"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(providerResp.Body, &responsesResp); err != nil {
+		return nil, err
+	}
+
+	content, hasToolUse := converters.ResponsesOutputToClaudeContent(responsesResp.Output)
+	claudeResp := &types.ClaudeResponse{
+		ID:         generateID(),
+		Type:       "message",
+		Role:       "assistant",
+		Content:    content,
+		StopReason: "end_turn",
+	}
+	if hasToolUse {
+		claudeResp.StopReason = "tool_use"
+	} else if responsesResp.IncompleteDetails != nil && responsesResp.IncompleteDetails.Reason == "max_output_tokens" {
+		claudeResp.StopReason = "max_tokens"
+	}
+
+	// Responses 的 input_tokens 含缓存命中部分，Claude 语义下需拆分到 cache_read_input_tokens
+	if u := responsesResp.Usage; u != nil {
+		cached := u.InputTokensDetails.CachedTokens
+		claudeResp.Usage = &types.Usage{
+			InputTokens:          u.InputTokens - cached,
+			OutputTokens:         u.OutputTokens,
+			CacheReadInputTokens: cached,
+		}
+	}
+
+	return claudeResp, nil
+}
+
+// HandleStreamResponse 将 Responses SSE 流转换为 Claude SSE 流
+func (p *ClaudeResponsesProvider) HandleStreamResponse(body io.ReadCloser) (<-chan string, <-chan error, error) {
+	eventChan := make(chan string, 100)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(eventChan)
+		defer body.Close()
+
+		scanner := bufio.NewScanner(body)
+		const maxScannerBufferSize = 1024 * 1024 // 1MB
+		scanner.Buffer(make([]byte, 0, 64*1024), maxScannerBufferSize)
+
+		converter := converters.NewResponsesToClaudeStreamConverter()
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "" || data == "[DONE]" || !gjson.Valid(data) {
+				continue
+			}
+
+			event := gjson.Parse(data)
+			if event.Get("type").String() == "error" {
+				errChan <- fmt.Errorf("upstream error: %s", event.Get("message").String())
+				return
+			}
+			for _, ev := range converter.ProcessEvent([]byte(data)) {
+				eventChan <- ev
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			errChan <- err
+			return
+		}
+		// 上游未发送 response.completed 时补齐结束事件
+		for _, ev := range converter.Finish() {
+			eventChan <- ev
+		}
+	}()
+
+	return eventChan, errChan, nil
+}
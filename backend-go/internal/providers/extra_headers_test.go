@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestProviders_ApplyExtraHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const body = `{"model":"claude-3","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+
+	tests := []struct {
+		name     string
+		provider Provider
+		authName string
+	}{
+		{"claude", &ClaudeProvider{}, "Authorization"},
+		{"openai", &OpenAIProvider{}, "Authorization"},
+		{"gemini", &GeminiProvider{}, "X-Goog-Api-Key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader([]byte(body)))
+			c.Request.Header.Set("X-Title", "client-title")
+
+			upstream := &config.UpstreamConfig{
+				Name:        "openrouter",
+				BaseURL:     "https://api.example.com",
+				ServiceType: tt.name,
+				ExtraHeaders: map[string]string{
+					"X-Org-Id":      "org-123",
+					"HTTP-Referer":  "https://app.example.com",
+					"X-Title":       "{{channel}}",
+					"Authorization": "Bearer hijacked", // 受保护：手工编辑的配置中出现也不生效
+				},
+			}
+			req, _, err := tt.provider.ConvertToProviderRequest(c, upstream, "test-key-1234567890")
+			if err != nil {
+				t.Fatalf("ConvertToProviderRequest: %v", err)
+			}
+
+			if got := req.Header.Get("X-Org-Id"); got != "org-123" {
+				t.Fatalf("X-Org-Id = %q", got)
+			}
+			if got := req.Header.Get("Http-Referer"); got != "https://app.example.com" {
+				t.Fatalf("HTTP-Referer = %q", got)
+			}
+			if got := req.Header.Values("X-Title"); len(got) != 1 || got[0] != "openrouter" {
+				t.Fatalf("X-Title = %q, want 渠道附加头覆盖客户端头部", got)
+			}
+			if got := req.Header.Get(tt.authName); got == "" || got == "Bearer hijacked" {
+				t.Fatalf("%s = %q, 认证头不应被附加头覆盖", tt.authName, got)
+			}
+		})
+	}
+}
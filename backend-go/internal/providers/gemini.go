@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/converters"
 	"github.com/BenedictKing/claude-proxy/internal/types"
 	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
@@ -59,6 +60,7 @@ func (p *GeminiProvider) ConvertToProviderRequest(c *gin.Context, upstream *conf
 	// 保留客户端的大部分 headers，只移除/替换必要的认证和代理相关 headers
 	req.Header = utils.PrepareUpstreamHeaders(c, req.URL.Host)
 	utils.SetGeminiAuthenticationHeader(req.Header, apiKey)
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
 
 	return req, originalBodyBytes, nil
 }
@@ -92,6 +94,13 @@ func (p *GeminiProvider) convertToGeminiRequest(claudeReq *types.ClaudeRequest,
 		genConfig["temperature"] = *claudeReq.Temperature
 	}
 
+	// thinking.budget_tokens -> thinkingConfig
+	if effort := converters.ClaudeThinkingToReasoningEffort(claudeReq.Thinking); effort != "" {
+		if thinkingConfig := converters.ReasoningEffortToGeminiThinkingConfig(effort); thinkingConfig != nil {
+			genConfig["thinkingConfig"] = thinkingConfig
+		}
+	}
+
 	if len(genConfig) > 0 {
 		req["generationConfig"] = genConfig
 	}
@@ -111,9 +120,10 @@ func (p *GeminiProvider) convertToGeminiRequest(claudeReq *types.ClaudeRequest,
 // convertMessages 转换消息
 func (p *GeminiProvider) convertMessages(claudeMessages []types.ClaudeMessage) []map[string]interface{} {
 	messages := []map[string]interface{}{}
+	toolNames := collectToolUseNames(claudeMessages)
 
 	for _, msg := range claudeMessages {
-		geminiMsg := p.convertMessage(msg)
+		geminiMsg := p.convertMessage(msg, toolNames)
 		if geminiMsg != nil {
 			messages = append(messages, geminiMsg)
 		}
@@ -122,8 +132,32 @@ func (p *GeminiProvider) convertMessages(claudeMessages []types.ClaudeMessage) [
 	return messages
 }
 
+// collectToolUseNames 收集 tool_use ID 到函数名的映射
+// Gemini functionResponse 需要函数名而非调用 ID
+func collectToolUseNames(claudeMessages []types.ClaudeMessage) map[string]string {
+	toolNames := make(map[string]string)
+	for _, msg := range claudeMessages {
+		contents, ok := msg.Content.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, c := range contents {
+			content, ok := c.(map[string]interface{})
+			if !ok || content["type"] != "tool_use" {
+				continue
+			}
+			id, _ := content["id"].(string)
+			name, _ := content["name"].(string)
+			if id != "" && name != "" {
+				toolNames[id] = name
+			}
+		}
+	}
+	return toolNames
+}
+
 // convertMessage 转换单个消息
-func (p *GeminiProvider) convertMessage(msg types.ClaudeMessage) map[string]interface{} {
+func (p *GeminiProvider) convertMessage(msg types.ClaudeMessage, toolNames map[string]string) map[string]interface{} {
 	role := msg.Role
 	if role == "assistant" {
 		role = "model"
@@ -178,6 +212,10 @@ func (p *GeminiProvider) convertMessage(msg types.ClaudeMessage) map[string]inte
 		case "tool_result":
 			toolUseID, _ := content["tool_use_id"].(string)
 			resultContent := content["content"]
+			name := toolUseID
+			if toolName, ok := toolNames[toolUseID]; ok {
+				name = toolName
+			}
 
 			var response interface{}
 			if str, ok := resultContent.(string); ok {
@@ -188,7 +226,7 @@ func (p *GeminiProvider) convertMessage(msg types.ClaudeMessage) map[string]inte
 
 			parts = append(parts, map[string]interface{}{
 				"functionResponse": map[string]interface{}{
-					"name":     toolUseID,
+					"name":     name,
 					"response": response,
 				},
 			})
@@ -222,101 +260,11 @@ func (p *GeminiProvider) convertTools(claudeTools []types.ClaudeTool) []map[stri
 
 // ConvertToClaudeResponse 转换为 Claude 响应
 func (p *GeminiProvider) ConvertToClaudeResponse(providerResp *types.ProviderResponse) (*types.ClaudeResponse, error) {
-	var geminiResp map[string]interface{}
+	var geminiResp types.GeminiResponse
 	if err := json.Unmarshal(providerResp.Body, &geminiResp); err != nil {
 		return nil, err
 	}
-
-	claudeResp := &types.ClaudeResponse{
-		ID:      generateID(),
-		Type:    "message",
-		Role:    "assistant",
-		Content: []types.ClaudeContent{},
-	}
-
-	candidates, ok := geminiResp["candidates"].([]interface{})
-	if !ok || len(candidates) == 0 {
-		return claudeResp, nil
-	}
-
-	candidate, ok := candidates[0].(map[string]interface{})
-	if !ok {
-		return claudeResp, nil
-	}
-
-	content, ok := candidate["content"].(map[string]interface{})
-	if !ok {
-		return claudeResp, nil
-	}
-
-	parts, ok := content["parts"].([]interface{})
-	if !ok {
-		return claudeResp, nil
-	}
-
-	// 处理各个部分
-	for _, p := range parts {
-		part, ok := p.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// 文本内容
-		if text, ok := part["text"].(string); ok {
-			claudeResp.Content = append(claudeResp.Content, types.ClaudeContent{
-				Type: "text",
-				Text: text,
-			})
-		}
-
-		// 函数调用
-		if fc, ok := part["functionCall"].(map[string]interface{}); ok {
-			name, _ := fc["name"].(string)
-			args := fc["args"]
-
-			claudeResp.Content = append(claudeResp.Content, types.ClaudeContent{
-				Type:  "tool_use",
-				ID:    fmt.Sprintf("toolu_%d", len(claudeResp.Content)),
-				Name:  name,
-				Input: args,
-			})
-		}
-	}
-
-	// 设置停止原因
-	finishReason, _ := candidate["finishReason"].(string)
-	if strings.Contains(strings.ToLower(finishReason), "stop") {
-		// 检查是否有工具调用
-		hasToolCall := false
-		for _, c := range claudeResp.Content {
-			if c.Type == "tool_use" {
-				hasToolCall = true
-				break
-			}
-		}
-
-		if hasToolCall {
-			claudeResp.StopReason = "tool_use"
-		} else {
-			claudeResp.StopReason = "end_turn"
-		}
-	} else if strings.Contains(strings.ToLower(finishReason), "length") {
-		claudeResp.StopReason = "max_tokens"
-	}
-
-	// 使用统计
-	if usageMetadata, ok := geminiResp["usageMetadata"].(map[string]interface{}); ok {
-		usage := &types.Usage{}
-		if promptTokens, ok := usageMetadata["promptTokenCount"].(float64); ok {
-			usage.InputTokens = int(promptTokens)
-		}
-		if candidatesTokens, ok := usageMetadata["candidatesTokenCount"].(float64); ok {
-			usage.OutputTokens = int(candidatesTokens)
-		}
-		claudeResp.Usage = usage
-	}
-
-	return claudeResp, nil
+	return converters.GeminiResponseToClaude(&geminiResp), nil
 }
 
 // HandleStreamResponse 处理流式响应
@@ -334,15 +282,10 @@ func (p *GeminiProvider) HandleStreamResponse(body io.ReadCloser) (<-chan string
 		const maxScannerBufferSize = 1024 * 1024 // 1MB
 		scanner.Buffer(make([]byte, 0, 64*1024), maxScannerBufferSize)
 
-		toolUseBlockIndex := 0
-
-		// 文本块状态跟踪
-		textBlockStarted := false
-		textBlockIndex := 0
+		converter := converters.NewGeminiToClaudeStreamConverter()
 
 		for scanner.Scan() {
-			line := scanner.Text()
-			line = strings.TrimSpace(line)
+			line := strings.TrimSpace(scanner.Text())
 
 			if line == "" || line == "data: [DONE]" {
 				continue
@@ -352,133 +295,24 @@ func (p *GeminiProvider) HandleStreamResponse(body io.ReadCloser) (<-chan string
 				continue
 			}
 
-			jsonStr := strings.TrimPrefix(line, "data: ")
-
-			var chunk map[string]interface{}
-			if err := json.Unmarshal([]byte(jsonStr), &chunk); err != nil {
-				continue
-			}
-
-			candidates, ok := chunk["candidates"].([]interface{})
-			if !ok || len(candidates) == 0 {
-				continue
-			}
-
-			candidate, ok := candidates[0].(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			content, ok := candidate["content"].(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			parts, ok := content["parts"].([]interface{})
-			if !ok {
+			var chunk types.GeminiStreamChunk
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
 				continue
 			}
 
-			for _, p := range parts {
-				part, ok := p.(map[string]interface{})
-				if !ok {
-					continue
-				}
-
-				// 处理文本
-				if text, ok := part["text"].(string); ok {
-					// 如果是第一个文本块,发送 content_block_start
-					if !textBlockStarted {
-						startEvent := map[string]interface{}{
-							"type":  "content_block_start",
-							"index": textBlockIndex,
-							"content_block": map[string]string{
-								"type": "text",
-								"text": "",
-							},
-						}
-						startJSON, _ := json.Marshal(startEvent)
-						eventChan <- fmt.Sprintf("event: content_block_start\ndata: %s\n\n", startJSON)
-						textBlockStarted = true
-					}
-
-					// 发送 content_block_delta
-					deltaEvent := map[string]interface{}{
-						"type":  "content_block_delta",
-						"index": textBlockIndex,
-						"delta": map[string]string{
-							"type": "text_delta",
-							"text": text,
-						},
-					}
-					deltaJSON, _ := json.Marshal(deltaEvent)
-					eventChan <- fmt.Sprintf("event: content_block_delta\ndata: %s\n\n", deltaJSON)
-				}
-
-				// 处理函数调用
-				if fc, ok := part["functionCall"].(map[string]interface{}); ok {
-					// 如果有文本块正在进行,先关闭它
-					if textBlockStarted {
-						stopEvent := map[string]interface{}{
-							"type":  "content_block_stop",
-							"index": textBlockIndex,
-						}
-						stopJSON, _ := json.Marshal(stopEvent)
-						eventChan <- fmt.Sprintf("event: content_block_stop\ndata: %s\n\n", stopJSON)
-						textBlockStarted = false
-						textBlockIndex++
-					}
-
-					name, _ := fc["name"].(string)
-					args := fc["args"]
-					id := fmt.Sprintf("toolu_%d", toolUseBlockIndex)
-
-					events := processToolUsePart(id, name, args, toolUseBlockIndex)
-					for _, event := range events {
-						eventChan <- event
-					}
-					toolUseBlockIndex++
-				}
-			}
-
-			// 处理结束原因
-			if finishReason, ok := candidate["finishReason"].(string); ok {
-				// 如果有未关闭的文本块,先关闭它
-				if textBlockStarted {
-					stopEvent := map[string]interface{}{
-						"type":  "content_block_stop",
-						"index": textBlockIndex,
-					}
-					stopJSON, _ := json.Marshal(stopEvent)
-					eventChan <- fmt.Sprintf("event: content_block_stop\ndata: %s\n\n", stopJSON)
-					textBlockStarted = false
-				}
-
-				if strings.Contains(strings.ToLower(finishReason), "stop") {
-					event := map[string]interface{}{
-						"type": "message_delta",
-						"delta": map[string]string{
-							"stop_reason": "end_turn",
-						},
-					}
-					eventJSON, _ := json.Marshal(event)
-					eventChan <- fmt.Sprintf("event: message_delta\ndata: %s\n\n", eventJSON)
-				}
+			for _, event := range converter.ProcessChunk(&chunk) {
+				eventChan <- event
 			}
 		}
 
-		// 确保流结束时关闭任何未关闭的文本块
-		if textBlockStarted {
-			stopEvent := map[string]interface{}{
-				"type":  "content_block_stop",
-				"index": textBlockIndex,
-			}
-			stopJSON, _ := json.Marshal(stopEvent)
-			eventChan <- fmt.Sprintf("event: content_block_stop\ndata: %s\n\n", stopJSON)
-		}
-
 		if err := scanner.Err(); err != nil {
 			errChan <- err
+			return
+		}
+
+		// 流正常结束：关闭内容块并发送 message_delta / message_stop
+		for _, event := range converter.Finish() {
+			eventChan <- event
 		}
 	}()
 
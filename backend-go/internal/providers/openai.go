@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/converters"
 	"github.com/BenedictKing/claude-proxy/internal/types"
 	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/gin-gonic/gin"
@@ -56,6 +57,9 @@ func (p *OpenAIProvider) ConvertToProviderRequest(c *gin.Context, upstream *conf
 		openaiReq.Tools = p.convertTools(claudeReq.Tools)
 		openaiReq.ToolChoice = "auto"
 	}
+
+	// thinking.budget_tokens -> reasoning_effort
+	openaiReq.ReasoningEffort = converters.ReasoningEffortToOpenAI(converters.ClaudeThinkingToReasoningEffort(claudeReq.Thinking))
 	// --- 转换逻辑结束 ---
 
 	reqBodyBytes, err := json.Marshal(openaiReq)
@@ -94,6 +98,7 @@ func (p *OpenAIProvider) ConvertToProviderRequest(c *gin.Context, upstream *conf
 	// 保留客户端的大部分 headers，只移除/替换必要的认证和代理相关 headers
 	req.Header = utils.PrepareUpstreamHeaders(c, req.URL.Host)
 	utils.SetAuthenticationHeader(req.Header, apiKey)
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
 
 	return req, originalBodyBytes, nil
 }
@@ -30,6 +30,8 @@ func GetProvider(serviceType string) Provider {
 		return &GeminiProvider{}
 	case "claude":
 		return &ClaudeProvider{}
+	case "responses":
+		return &ClaudeResponsesProvider{}
 	default:
 		return nil
 	}
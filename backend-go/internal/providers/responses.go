@@ -112,6 +112,7 @@ func (p *ResponsesProvider) ConvertToProviderRequest(
 
 	// 确保 Content-Type 正确
 	req.Header.Set("Content-Type", "application/json")
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
 
 	return req, bodyBytes, nil
 }
@@ -122,7 +123,7 @@ func (p *ResponsesProvider) ConvertToProviderRequest(
 // 2. 如果 baseURL 已包含版本号后缀（如 /v1, /v2, /v8, /v1beta），直接拼接端点路径
 // 3. 如果 baseURL 不包含版本号后缀，自动添加 /v1 再拼接端点路径
 func (p *ResponsesProvider) buildTargetURL(upstream *config.UpstreamConfig) string {
-	baseURL := upstream.BaseURL
+	baseURL := upstream.GetEffectiveBaseURL()
 	skipVersionPrefix := strings.HasSuffix(baseURL, "#")
 	if skipVersionPrefix {
 		baseURL = strings.TrimSuffix(baseURL, "#")
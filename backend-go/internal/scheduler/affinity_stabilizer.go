@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// affinityPin 会话渠道固定记录
+type affinityPin struct {
+	channelIndex int
+	until        time.Time
+}
+
+// affinityStabilizer 会话亲和抖动检测
+// 两个渠道都处于临界健康状态时，亲和会在两者之间来回切换，导致上游缓存频繁失效。
+// 同一会话在 window 内切换亲和渠道达到 maxSwitches 次时，将其固定在最近成功的渠道上 cooldown 时长，
+// 固定期间即使该渠道优先级略低也继续使用（仍要求渠道健康）。
+type affinityStabilizer struct {
+	mu          sync.Mutex
+	maxSwitches int
+	window      time.Duration
+	cooldown    time.Duration
+
+	switches  map[string][]time.Time // key: user_id，窗口内的切换时间
+	pins      map[string]affinityPin // key: user_id
+	lastPrune time.Time
+}
+
+func newAffinityStabilizer(maxSwitches int, window, cooldown time.Duration) *affinityStabilizer {
+	return &affinityStabilizer{
+		maxSwitches: maxSwitches,
+		window:      window,
+		cooldown:    cooldown,
+		switches:    make(map[string][]time.Time),
+		pins:        make(map[string]affinityPin),
+	}
+}
+
+// recordSwitch 记录一次亲和渠道切换，达到抖动阈值时固定到 toChannel
+// 返回是否触发了固定
+func (st *affinityStabilizer) recordSwitch(userID string, toChannel int, now time.Time) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.pruneLocked(now)
+
+	// 固定渠道已不可用而切换时，解除固定并重新计数
+	delete(st.pins, userID)
+
+	history := recentSwitches(st.switches[userID], now.Add(-st.window))
+	history = append(history, now)
+	if len(history) < st.maxSwitches {
+		st.switches[userID] = history
+		return false
+	}
+
+	delete(st.switches, userID)
+	st.pins[userID] = affinityPin{channelIndex: toChannel, until: now.Add(st.cooldown)}
+	return true
+}
+
+// isPinned 判断会话当前是否固定在指定渠道上
+func (st *affinityStabilizer) isPinned(userID string, channelIndex int, now time.Time) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	pin, ok := st.pins[userID]
+	return ok && pin.channelIndex == channelIndex && now.Before(pin.until)
+}
+
+// pinnedCount 返回当前处于固定期的会话数
+func (st *affinityStabilizer) pinnedCount(now time.Time) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	count := 0
+	for _, pin := range st.pins {
+		if now.Before(pin.until) {
+			count++
+		}
+	}
+	return count
+}
+
+// pruneLocked 定期清理过期的切换记录与固定记录（调用方需持有锁）
+func (st *affinityStabilizer) pruneLocked(now time.Time) {
+	if now.Sub(st.lastPrune) < st.window {
+		return
+	}
+	st.lastPrune = now
+
+	cutoff := now.Add(-st.window)
+	for userID, history := range st.switches {
+		if history = recentSwitches(history, cutoff); len(history) == 0 {
+			delete(st.switches, userID)
+		} else {
+			st.switches[userID] = history
+		}
+	}
+	for userID, pin := range st.pins {
+		if !now.Before(pin.until) {
+			delete(st.pins, userID)
+		}
+	}
+}
+
+// recentSwitches 过滤出 cutoff 之后的切换时间（输入按时间升序）
+func recentSwitches(history []time.Time, cutoff time.Time) []time.Time {
+	for i, t := range history {
+		if t.After(cutoff) {
+			return history[i:]
+		}
+	}
+	return history[:0]
+}
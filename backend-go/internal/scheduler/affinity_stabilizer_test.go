@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// simulateAffinityChurn 模拟两个临界健康渠道下的亲和抖动：
+// 高优先级渠道 p1 间歇性失败（奇数轮），每轮请求成功后按实际渠道更新亲和，返回每轮选中的渠道
+func simulateAffinityChurn(t *testing.T, scheduler *ChannelScheduler, rounds int) []int {
+	t.Helper()
+	selected := make([]int, 0, rounds)
+	for round := 0; round < rounds; round++ {
+		failed := make(map[int]bool)
+		if round%2 == 1 {
+			failed[0] = true // p1 本轮请求失败，故障转移到 p2
+		}
+		result, err := scheduler.SelectChannel(context.Background(), "conv-churn", failed, false)
+		if err != nil {
+			t.Fatalf("round %d: 选择渠道失败: %v", round, err)
+		}
+		scheduler.SetTraceAffinity("conv-churn", result.ChannelIndex)
+		selected = append(selected, result.ChannelIndex)
+	}
+	return selected
+}
+
+func countSwitches(selected []int) int {
+	switches := 0
+	for i := 1; i < len(selected); i++ {
+		if selected[i] != selected[i-1] {
+			switches++
+		}
+	}
+	return switches
+}
+
+func churnTestConfig() config.Config {
+	return config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "p1", BaseURL: "https://p1.example.com", APIKeys: []string{"k1"}, Status: "active", Priority: 1},
+			{Name: "p2", BaseURL: "https://p2.example.com", APIKeys: []string{"k2"}, Status: "active", Priority: 2},
+		},
+	}
+}
+
+// TestAffinityChurn_WithoutStabilizationKeepsBouncing 测试未启用抖动检测时会话在两个渠道间来回切换
+func TestAffinityChurn_WithoutStabilizationKeepsBouncing(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, churnTestConfig())
+	defer cleanup()
+
+	selected := simulateAffinityChurn(t, scheduler, 12)
+	if got := countSwitches(selected); got != 11 {
+		t.Fatalf("期望每轮都切换渠道（11 次），实际 %d 次: %v", got, selected)
+	}
+}
+
+// TestAffinityChurn_StabilizesOnOneChannel 测试启用抖动检测后会话稳定在一个渠道上
+func TestAffinityChurn_StabilizesOnOneChannel(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, churnTestConfig())
+	defer cleanup()
+	scheduler.SetAffinityStabilization(3, 5*time.Minute, 10*time.Minute)
+
+	selected := simulateAffinityChurn(t, scheduler, 12)
+	if got := countSwitches(selected); got != 3 {
+		t.Fatalf("期望切换 3 次后固定，实际切换 %d 次: %v", got, selected)
+	}
+	tail := selected[4:]
+	for i, idx := range tail {
+		if idx != 1 {
+			t.Fatalf("固定后应稳定在渠道 [1]，第 %d 轮选择了 [%d]: %v", i+4, idx, selected)
+		}
+	}
+	if got := scheduler.GetPinnedAffinityCount(); got != 1 {
+		t.Fatalf("GetPinnedAffinityCount() = %d, want 1", got)
+	}
+
+	// 固定渠道本次失败时仍允许故障转移，并解除固定
+	result, err := scheduler.SelectChannel(context.Background(), "conv-churn", map[int]bool{1: true}, false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 0 {
+		t.Fatalf("固定渠道失败时应故障转移到 [0]，实际 [%d]", result.ChannelIndex)
+	}
+	scheduler.SetTraceAffinity("conv-churn", result.ChannelIndex)
+	if scheduler.isAffinityPinned("conv-churn", 1) {
+		t.Fatal("切换到其他渠道后应解除固定")
+	}
+}
+
+// TestAffinityStabilizer_WindowAndCooldown 测试窗口外的切换不计数、固定在冷却期后失效
+func TestAffinityStabilizer_WindowAndCooldown(t *testing.T) {
+	st := newAffinityStabilizer(3, time.Minute, 5*time.Minute)
+	base := time.Now()
+
+	// 切换间隔超过窗口，不触发固定
+	for i := 0; i < 5; i++ {
+		if st.recordSwitch("u", i%2, base.Add(time.Duration(i)*2*time.Minute)) {
+			t.Fatalf("第 %d 次切换不应触发固定（间隔大于窗口）", i+1)
+		}
+	}
+
+	now := base.Add(time.Hour)
+	st.recordSwitch("u", 0, now)
+	st.recordSwitch("u", 1, now.Add(10*time.Second))
+	if !st.recordSwitch("u", 0, now.Add(20*time.Second)) {
+		t.Fatal("窗口内第 3 次切换应触发固定")
+	}
+	if !st.isPinned("u", 0, now.Add(time.Minute)) {
+		t.Fatal("冷却期内应固定在渠道 0")
+	}
+	if st.isPinned("u", 1, now.Add(time.Minute)) {
+		t.Fatal("不应固定在渠道 1")
+	}
+	if st.isPinned("u", 0, now.Add(6*time.Minute)) {
+		t.Fatal("冷却期结束后应解除固定")
+	}
+}
@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// ErrCodeRequestTooLarge 请求体超过所有渠道上限时的错误码
+const ErrCodeRequestTooLarge = "REQUEST_TOO_LARGE"
+
+// RequestTooLargeError 所有活跃渠道的请求体上限均小于请求体大小
+type RequestTooLargeError struct {
+	Size     int64 // 请求体大小（字节）
+	MaxLimit int64 // 候选渠道中最大的请求体上限（字节）
+}
+
+func (e *RequestTooLargeError) Error() string {
+	return fmt.Sprintf("%s: 请求体 %d 字节超过所有渠道的上限（最大 %d 字节）", ErrCodeRequestTooLarge, e.Size, e.MaxLimit)
+}
+
+// AsRequestTooLargeError 判断错误是否为请求体过大无可用渠道错误
+func AsRequestTooLargeError(err error) (*RequestTooLargeError, bool) {
+	var target *RequestTooLargeError
+	if errors.As(err, &target) {
+		return target, true
+	}
+	return nil, false
+}
+
+// filterChannelsByBodySize 过滤掉请求体上限小于请求体大小的渠道（未配置 maxRequestBodySize 的渠道使用全局上限）
+// 返回过滤后的渠道，以及被过滤渠道中最大的上限（用于错误提示）
+func filterChannelsByBodySize(
+	channels []ChannelInfo,
+	limits requestBodyLimits,
+	getUpstream func(index int) *config.UpstreamConfig,
+) ([]ChannelInfo, int64) {
+	filtered := make([]ChannelInfo, 0, len(channels))
+	var maxLimit int64
+	for _, ch := range channels {
+		upstream := getUpstream(ch.Index)
+		if upstream == nil {
+			continue
+		}
+		if !upstream.AcceptsRequestBodySize(limits.size, limits.defaultLimit) {
+			maxLimit = max(maxLimit, upstream.EffectiveMaxRequestBodySize(limits.defaultLimit))
+			continue
+		}
+		filtered = append(filtered, ch)
+	}
+	return filtered, maxLimit
+}
@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+const testDefaultBodyLimit = 10 * 1024 * 1024
+
+// TestSelectChannel_SkipsChannelsBelowBodySize 测试大请求跳过上限较小的渠道，路由到上限足够大的渠道
+func TestSelectChannel_SkipsChannelsBelowBodySize(t *testing.T) {
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "cheap", BaseURL: "https://a.example.com", APIKeys: []string{"sk-a"}, Status: "active", Priority: 1, MaxRequestBodySize: 1024 * 1024},
+			{Name: "default", BaseURL: "https://b.example.com", APIKeys: []string{"sk-b"}, Status: "active", Priority: 2},
+			{Name: "large-context", BaseURL: "https://c.example.com", APIKeys: []string{"sk-c"}, Status: "active", Priority: 3, MaxRequestBodySize: 50 * 1024 * 1024},
+		},
+	}
+
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+
+	// 小请求按优先级选择最便宜的渠道
+	small := WithRequestBodySize(context.Background(), 512*1024, testDefaultBodyLimit)
+	result, err := scheduler.SelectChannel(small, "", make(map[int]bool), false)
+	if err != nil || result.ChannelIndex != 0 {
+		t.Fatalf("小请求应选择 index=0: result=%v err=%v", result, err)
+	}
+
+	// 超过 cheap 上限但未超过全局上限：跳过 cheap，使用全局上限的渠道
+	medium := WithRequestBodySize(context.Background(), 5*1024*1024, testDefaultBodyLimit)
+	result, err = scheduler.SelectChannel(medium, "", make(map[int]bool), false)
+	if err != nil || result.ChannelIndex != 1 {
+		t.Fatalf("5MB 请求应跳过 1MB 上限渠道并选择 index=1: result=%v err=%v", result, err)
+	}
+
+	// 超过全局上限：只能路由到大上限渠道
+	large := WithRequestBodySize(context.Background(), 20*1024*1024, testDefaultBodyLimit)
+	result, err = scheduler.SelectChannel(large, "", make(map[int]bool), false)
+	if err != nil || result.ChannelIndex != 2 {
+		t.Fatalf("20MB 请求应路由到 50MB 上限渠道 index=2: result=%v err=%v", result, err)
+	}
+
+	// 大上限渠道失败后不应回退到上限不足的渠道
+	if _, err := scheduler.SelectChannel(large, "", map[int]bool{2: true}, false); err == nil {
+		t.Fatal("唯一可接受的渠道失败后应返回错误")
+	} else if _, ok := AsRequestTooLargeError(err); ok {
+		t.Fatalf("存在可接受的渠道时不应返回 RequestTooLargeError: %v", err)
+	}
+}
+
+// TestSelectChannel_RequestTooLargeForAllChannels 测试请求体超过所有渠道上限时返回 RequestTooLargeError
+func TestSelectChannel_RequestTooLargeForAllChannels(t *testing.T) {
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "cheap", BaseURL: "https://a.example.com", APIKeys: []string{"sk-a"}, Status: "active", Priority: 1, MaxRequestBodySize: 1024 * 1024},
+			{Name: "large-context", BaseURL: "https://c.example.com", APIKeys: []string{"sk-c"}, Status: "active", Priority: 2, MaxRequestBodySize: 50 * 1024 * 1024},
+		},
+	}
+
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+
+	ctx := WithRequestBodySize(context.Background(), 60*1024*1024, testDefaultBodyLimit)
+	_, err := scheduler.SelectChannel(ctx, "", make(map[int]bool), false)
+	tooLarge, ok := AsRequestTooLargeError(err)
+	if !ok {
+		t.Fatalf("期望 RequestTooLargeError，实际 %v", err)
+	}
+	if tooLarge.Size != 60*1024*1024 || tooLarge.MaxLimit != 50*1024*1024 {
+		t.Errorf("错误信息不符合预期: %+v", tooLarge)
+	}
+}
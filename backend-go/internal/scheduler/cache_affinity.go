@@ -0,0 +1,235 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+)
+
+// cacheAffinityHitRateWindow 评估渠道提示缓存命中率的统计窗口
+const cacheAffinityHitRateWindow = time.Hour
+
+// cacheHome 会话因健康原因被迫离开的渠道（缓存所在渠道）
+type cacheHome struct {
+	channelIndex int
+	leftAt       time.Time
+}
+
+// cacheAffinity 提示缓存感知的会话亲和
+// 会话在渠道间切换会使上游提示缓存失效，因此：
+//  1. 亲和渠道仅因优先级不匹配被跳过时，若其近期缓存命中率 >= (1 - stickiness)*100% 仍继续使用（stickiness=1 时总是保持）；
+//  2. 亲和渠道因熔断/不健康/本次请求失败被跳过时，记住该渠道为会话的“缓存归属渠道”，
+//     其恢复健康后优先切回，而不是按常规策略重新选择。
+type cacheAffinity struct {
+	stickiness float64
+	homeTTL    time.Duration // 归属渠道记录的保留时长（与 Trace 亲和 TTL 一致）
+
+	mu        sync.Mutex
+	homes     map[string]cacheHome // key: user_id
+	lastPrune time.Time
+}
+
+func newCacheAffinity(stickiness float64, homeTTL time.Duration) *cacheAffinity {
+	return &cacheAffinity{
+		stickiness: stickiness,
+		homeTTL:    homeTTL,
+		homes:      make(map[string]cacheHome),
+	}
+}
+
+// sticky 亲和渠道优先级不匹配时，是否按缓存命中率保持亲和
+func (ca *cacheAffinity) sticky(hitRate float64) bool {
+	return ca.stickiness > 0 && hitRate/100 >= 1-ca.stickiness
+}
+
+// rememberHome 记录会话的缓存归属渠道（已有未过期记录时保留最初的归属渠道）
+func (ca *cacheAffinity) rememberHome(userID string, channelIndex int, now time.Time) bool {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	ca.pruneLocked(now)
+	if _, exists := ca.homes[userID]; exists {
+		return false
+	}
+	ca.homes[userID] = cacheHome{channelIndex: channelIndex, leftAt: now}
+	return true
+}
+
+// home 获取会话未过期的缓存归属渠道
+func (ca *cacheAffinity) home(userID string, now time.Time) (int, bool) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	h, exists := ca.homes[userID]
+	if !exists || now.Sub(h.leftAt) > ca.homeTTL {
+		return -1, false
+	}
+	return h.channelIndex, true
+}
+
+// forget 会话已回到归属渠道（或归属渠道不再可用）时清除记录
+func (ca *cacheAffinity) forget(userID string) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	delete(ca.homes, userID)
+}
+
+// returned 会话在 channelIndex 上请求成功：若为归属渠道则清除记录
+func (ca *cacheAffinity) returned(userID string, channelIndex int) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if h, exists := ca.homes[userID]; exists && h.channelIndex == channelIndex {
+		delete(ca.homes, userID)
+	}
+}
+
+// homeCount 等待切回归属渠道的会话数
+func (ca *cacheAffinity) homeCount(now time.Time) int {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.pruneLocked(now)
+	return len(ca.homes)
+}
+
+// pruneLocked 清理过期记录（最多每分钟一次），调用方需持有 ca.mu
+func (ca *cacheAffinity) pruneLocked(now time.Time) {
+	if now.Sub(ca.lastPrune) < time.Minute {
+		return
+	}
+	ca.lastPrune = now
+	for userID, h := range ca.homes {
+		if now.Sub(h.leftAt) > ca.homeTTL {
+			delete(ca.homes, userID)
+		}
+	}
+}
+
+// SetCacheAffinity 设置提示缓存感知的会话亲和（stickiness<=0 表示禁用）
+// stickiness 取值 0~1：亲和渠道近期缓存命中率 >= (1-stickiness)*100% 时忽略优先级不匹配继续使用；
+// 启用后亲和渠道因健康原因被跳过时会记住该渠道，恢复后优先切回
+func (s *ChannelScheduler) SetCacheAffinity(stickiness float64) {
+	if stickiness <= 0 {
+		s.cacheAffinity = nil
+		return
+	}
+	homeTTL := s.schedulerConfig.Affinity.TTL
+	if s.traceAffinity != nil {
+		homeTTL = s.traceAffinity.GetTTL()
+	}
+	s.cacheAffinity = newCacheAffinity(min(stickiness, 1), homeTTL)
+}
+
+// RecordCacheAffinity 请求成功后记录会话的亲和渠道（仅启用缓存感知亲和时生效）
+// 回到缓存归属渠道时清除归属记录
+func (s *ChannelScheduler) RecordCacheAffinity(userID string, channelIndex int) {
+	if s.cacheAffinity == nil || userID == "" || s.traceAffinity == nil {
+		return
+	}
+	s.cacheAffinity.returned(userID, channelIndex)
+	s.SetTraceAffinity(userID, channelIndex)
+}
+
+// GetCacheAffinityHomeCount 获取等待切回缓存归属渠道的会话数
+func (s *ChannelScheduler) GetCacheAffinityHomeCount() int {
+	if s.cacheAffinity == nil {
+		return 0
+	}
+	return s.cacheAffinity.homeCount(time.Now())
+}
+
+// GetCacheAffinityStickiness 获取缓存亲和粘性权重（0 表示禁用）
+func (s *ChannelScheduler) GetCacheAffinityStickiness() float64 {
+	if s.cacheAffinity == nil {
+		return 0
+	}
+	return s.cacheAffinity.stickiness
+}
+
+// isStickyByCacheHitRate 亲和渠道优先级不匹配时，按近期缓存命中率判断是否保持亲和
+func (s *ChannelScheduler) isStickyByCacheHitRate(upstream *config.UpstreamConfig, metricsManager *metrics.MetricsManager) (float64, bool) {
+	if s.cacheAffinity == nil || upstream == nil {
+		return 0, false
+	}
+	hitRate, _ := metricsManager.GetChannelCacheHitRate(upstream.GetAllBaseURLs(), upstream.APIKeys, cacheAffinityHitRateWindow)
+	return hitRate, s.cacheAffinity.sticky(hitRate)
+}
+
+// noteAffinityHealthSkip 亲和渠道因健康原因（本次请求失败、无可用密钥或熔断）被跳过时记录为缓存归属渠道
+func (s *ChannelScheduler) noteAffinityHealthSkip(
+	userID string,
+	preferredIdx int,
+	activeChannels []ChannelInfo,
+	failedChannels map[int]bool,
+	isResponses bool,
+	metricsManager *metrics.MetricsManager,
+	logf func(format string, args ...interface{}),
+) {
+	if s.cacheAffinity == nil {
+		return
+	}
+	ch := findChannelInfo(activeChannels, preferredIdx)
+	if ch == nil || ch.Status != "active" {
+		return
+	}
+	if !failedChannels[preferredIdx] {
+		upstream := s.getUpstreamByIndex(preferredIdx, isResponses)
+		if upstream == nil || (len(upstream.APIKeys) > 0 && metricsManager.IsChannelHealthyWithKeys(upstream.BaseURL, upstream.APIKeys)) {
+			return
+		}
+	}
+	if s.cacheAffinity.rememberHome(userID, preferredIdx, time.Now()) {
+		logf("[Scheduler-CacheAffinity] 亲和渠道 [%d] %s 暂不可用，恢复后切回 (user: %s)", preferredIdx, ch.Name, maskUserID(userID))
+	}
+}
+
+// trySnapBackToCacheHome 会话的缓存归属渠道恢复健康后切回（不要求优先级匹配）
+func (s *ChannelScheduler) trySnapBackToCacheHome(
+	userID string,
+	activeChannels []ChannelInfo,
+	failedChannels map[int]bool,
+	isResponses bool,
+	metricsManager *metrics.MetricsManager,
+	excludeLowQuality bool,
+	logf func(format string, args ...interface{}),
+) *SelectionResult {
+	if s.cacheAffinity == nil {
+		return nil
+	}
+	homeIdx, ok := s.cacheAffinity.home(userID, time.Now())
+	if !ok || failedChannels[homeIdx] {
+		return nil
+	}
+
+	upstream := s.getUpstreamByIndex(homeIdx, isResponses)
+	if upstream == nil || config.GetChannelStatus(upstream) != "active" {
+		// 归属渠道已被删除或停用，不再等待切回
+		s.cacheAffinity.forget(userID)
+		return nil
+	}
+	// 归属渠道不支持本次请求（模型/请求体大小过滤）或被排除时本次不切回
+	ch := findChannelInfo(activeChannels, homeIdx)
+	if ch == nil || (excludeLowQuality && ch.LowQuality) {
+		return nil
+	}
+	if len(upstream.APIKeys) == 0 || !metricsManager.IsChannelHealthyWithKeys(upstream.BaseURL, upstream.APIKeys) {
+		return nil
+	}
+
+	logf("[Scheduler-CacheAffinity] 缓存归属渠道已恢复，切回: [%d] %s (user: %s)", homeIdx, upstream.Name, maskUserID(userID))
+	return &SelectionResult{
+		Upstream:     upstream,
+		ChannelIndex: homeIdx,
+		Reason:       "cache_affinity",
+	}
+}
+
+func findChannelInfo(channels []ChannelInfo, index int) *ChannelInfo {
+	for i := range channels {
+		if channels[i].Index == index {
+			return &channels[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+func cacheAffinityTestConfig(p2Priority int) config.Config {
+	return config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "p1", BaseURL: "https://p1.example.com", APIKeys: []string{"k1"}, Status: "active", Priority: 1},
+			{Name: "p2", BaseURL: "https://p2.example.com", APIKeys: []string{"k2"}, Status: "active", Priority: p2Priority},
+		},
+	}
+}
+
+// tripChannel 连续失败使渠道 p1 不健康
+func tripChannel(scheduler *ChannelScheduler) {
+	for i := 0; i < 10; i++ {
+		scheduler.RecordFailure("https://p1.example.com", "k1", false)
+	}
+}
+
+// failoverAndRecover 会话在 p1 上建立缓存 → p1 熔断故障转移到 p2 → p1 恢复，返回恢复后选中的渠道
+func failoverAndRecover(t *testing.T, scheduler *ChannelScheduler) *SelectionResult {
+	t.Helper()
+	ctx := context.Background()
+
+	scheduler.SetTraceAffinity("conv-1", 0)
+	tripChannel(scheduler)
+	result, err := scheduler.SelectChannel(ctx, "conv-1", map[int]bool{}, false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 1 {
+		t.Fatalf("p1 熔断时应故障转移到 [1]，实际 [%d]", result.ChannelIndex)
+	}
+	scheduler.SetTraceAffinity("conv-1", 1)
+	scheduler.RecordCacheAffinity("conv-1", 1)
+
+	scheduler.ResetKeyMetrics("https://p1.example.com", "k1", false)
+	result, err = scheduler.SelectChannel(ctx, "conv-1", map[int]bool{}, false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	return result
+}
+
+// TestCacheAffinity_SnapsBackAfterRecovery 测试亲和渠道熔断恢复后切回，而不是留在故障转移渠道上
+func TestCacheAffinity_SnapsBackAfterRecovery(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, cacheAffinityTestConfig(1))
+	defer cleanup()
+	scheduler.SetCacheAffinity(0.5)
+
+	result := failoverAndRecover(t, scheduler)
+	if result.ChannelIndex != 0 || result.Reason != "cache_affinity" {
+		t.Fatalf("p1 恢复后应切回 [0] (cache_affinity)，实际 [%d] (%s)", result.ChannelIndex, result.Reason)
+	}
+	if got := scheduler.GetCacheAffinityHomeCount(); got != 1 {
+		t.Fatalf("切回成功前应保留归属记录，GetCacheAffinityHomeCount() = %d", got)
+	}
+
+	scheduler.RecordCacheAffinity("conv-1", 0)
+	if got := scheduler.GetCacheAffinityHomeCount(); got != 0 {
+		t.Fatalf("切回成功后应清除归属记录，GetCacheAffinityHomeCount() = %d", got)
+	}
+	if idx, _ := scheduler.GetTraceAffinityManager().GetPreferredChannel("conv-1"); idx != 0 {
+		t.Fatalf("切回后亲和渠道应为 [0]，实际 [%d]", idx)
+	}
+}
+
+// TestCacheAffinity_DisabledStaysOnFailoverChannel 测试未启用时同优先级会话留在故障转移渠道上
+func TestCacheAffinity_DisabledStaysOnFailoverChannel(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, cacheAffinityTestConfig(1))
+	defer cleanup()
+
+	result := failoverAndRecover(t, scheduler)
+	if result.ChannelIndex != 1 || result.Reason != "trace_affinity" {
+		t.Fatalf("未启用缓存感知亲和时应保持 [1] (trace_affinity)，实际 [%d] (%s)", result.ChannelIndex, result.Reason)
+	}
+}
+
+// TestCacheAffinity_ForgetsRemovedHomeChannel 测试归属渠道被停用后不再等待切回
+func TestCacheAffinity_ForgetsRemovedHomeChannel(t *testing.T) {
+	cfg := cacheAffinityTestConfig(1)
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	scheduler.SetCacheAffinity(0.5)
+
+	scheduler.SetTraceAffinity("conv-1", 0)
+	tripChannel(scheduler)
+	if _, err := scheduler.SelectChannel(context.Background(), "conv-1", map[int]bool{}, false); err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if got := scheduler.GetCacheAffinityHomeCount(); got != 1 {
+		t.Fatalf("亲和渠道熔断后应记录归属渠道，GetCacheAffinityHomeCount() = %d", got)
+	}
+
+	status := "disabled"
+	if _, err := scheduler.configManager.UpdateUpstream(0, config.UpstreamUpdate{Status: &status}); err != nil {
+		t.Fatalf("UpdateUpstream: %v", err)
+	}
+	if _, err := scheduler.SelectChannel(context.Background(), "conv-1", map[int]bool{}, false); err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if got := scheduler.GetCacheAffinityHomeCount(); got != 0 {
+		t.Fatalf("归属渠道停用后应清除记录，GetCacheAffinityHomeCount() = %d", got)
+	}
+}
+
+// TestCacheAffinity_StickinessOverridesPriorityByHitRate 测试亲和渠道缓存命中率足够高时忽略优先级差异
+func TestCacheAffinity_StickinessOverridesPriorityByHitRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		stickiness float64
+		want       int
+	}{
+		{name: "disabled", stickiness: 0, want: 0},
+		{name: "hit rate above threshold", stickiness: 0.5, want: 1},
+		{name: "hit rate below threshold", stickiness: 0.05, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler, cleanup := createTestScheduler(t, cacheAffinityTestConfig(2))
+			defer cleanup()
+			scheduler.SetCacheAffinity(tt.stickiness)
+
+			// p2 近期缓存命中率 90%
+			scheduler.RecordSuccessWithUsage("https://p2.example.com", "k2",
+				&types.Usage{InputTokens: 100, CacheReadInputTokens: 900}, false, "claude", 0)
+			scheduler.SetTraceAffinity("conv-1", 1)
+
+			result, err := scheduler.SelectChannel(context.Background(), "conv-1", map[int]bool{}, false)
+			if err != nil {
+				t.Fatalf("选择渠道失败: %v", err)
+			}
+			if result.ChannelIndex != tt.want {
+				t.Fatalf("期望选择 [%d]，实际 [%d] (%s)", tt.want, result.ChannelIndex, result.Reason)
+			}
+		})
+	}
+}
+
+// TestCacheAffinity_HomeExpires 测试归属渠道记录超过 TTL 后失效
+func TestCacheAffinity_HomeExpires(t *testing.T) {
+	ca := newCacheAffinity(0.5, time.Minute)
+	now := time.Now()
+
+	if !ca.rememberHome("u", 0, now) {
+		t.Fatal("首次记录应成功")
+	}
+	if ca.rememberHome("u", 1, now) {
+		t.Fatal("已有归属渠道时不应覆盖")
+	}
+	if idx, ok := ca.home("u", now.Add(30*time.Second)); !ok || idx != 0 {
+		t.Fatalf("TTL 内应返回归属渠道 0，实际 %d, %v", idx, ok)
+	}
+	if _, ok := ca.home("u", now.Add(2*time.Minute)); ok {
+		t.Fatal("超过 TTL 后不应返回归属渠道")
+	}
+	if got := ca.homeCount(now.Add(2 * time.Minute)); got != 0 {
+		t.Fatalf("过期记录应被清理，homeCount() = %d", got)
+	}
+}
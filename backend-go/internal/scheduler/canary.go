@@ -0,0 +1,224 @@
+package scheduler
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+)
+
+// canaryBuckets 灰度分桶数（比例精度 0.01%）
+const canaryBuckets = 10000
+
+// canaryBucket 计算会话在指定灰度渠道下的分桶（渠道名参与哈希，不同灰度渠道的分桶相互独立）
+// 同一会话的分桶固定：提高灰度比例时已命中的会话保持命中，仅新增会话被纳入
+func canaryBucket(channelName, routingKey string) int {
+	h := fnv.New64a()
+	h.Write([]byte(channelName))
+	h.Write([]byte{0})
+	h.Write([]byte(routingKey))
+	return int(h.Sum64() % canaryBuckets)
+}
+
+// inCanary 判断分桶是否落在灰度比例内
+func inCanary(bucket int, percent float64) bool {
+	return float64(bucket) < percent*canaryBuckets/100
+}
+
+// CanaryChannelStats 单个灰度渠道的路由统计
+type CanaryChannelStats struct {
+	ChannelIndex  int     `json:"channelIndex"`
+	ChannelName   string  `json:"channelName"`
+	CanaryPercent float64 `json:"canaryPercent"` // 配置的灰度比例
+	Routed        int64   `json:"routed"`        // 路由到灰度渠道的请求数
+	Fallbacks     int64   `json:"fallbacks"`     // 命中灰度但渠道不健康/已失败而回退到常规选择的次数
+	ActualPercent float64 `json:"actualPercent"` // 实际路由比例（Routed / Requests）
+}
+
+// CanaryStats 灰度路由统计（进程内累计，重启后清零）
+type CanaryStats struct {
+	Since    time.Time            `json:"since"`
+	Requests int64                `json:"requests"` // 存在灰度渠道时参与灰度判定的请求数（不含故障转移重试）
+	Channels []CanaryChannelStats `json:"channels"`
+}
+
+type canaryNamespaceState struct {
+	requests int64
+	channels map[shadowChannelKey]*CanaryChannelStats
+}
+
+// canaryTracker 按接口类型汇总的灰度路由统计
+type canaryTracker struct {
+	mu      sync.Mutex
+	since   time.Time
+	reports map[string]*canaryNamespaceState
+}
+
+func newCanaryTracker() *canaryTracker {
+	return &canaryTracker{since: time.Now(), reports: make(map[string]*canaryNamespaceState)}
+}
+
+func (t *canaryTracker) stateLocked(namespace string) *canaryNamespaceState {
+	state, ok := t.reports[namespace]
+	if !ok {
+		state = &canaryNamespaceState{channels: make(map[shadowChannelKey]*CanaryChannelStats)}
+		t.reports[namespace] = state
+	}
+	return state
+}
+
+func (t *canaryTracker) channelLocked(namespace string, ch ChannelInfo) *CanaryChannelStats {
+	state := t.stateLocked(namespace)
+	key := shadowChannelKey{index: ch.Index, name: ch.Name}
+	stats, ok := state.channels[key]
+	if !ok {
+		stats = &CanaryChannelStats{ChannelIndex: ch.Index, ChannelName: ch.Name}
+		state.channels[key] = stats
+	}
+	stats.CanaryPercent = ch.CanaryPercent
+	return stats
+}
+
+func (t *canaryTracker) recordRequest(namespace string, canaries []ChannelInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stateLocked(namespace).requests++
+	for _, ch := range canaries {
+		t.channelLocked(namespace, ch)
+	}
+}
+
+func (t *canaryTracker) recordRouted(namespace string, ch ChannelInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channelLocked(namespace, ch).Routed++
+}
+
+func (t *canaryTracker) recordFallback(namespace string, ch ChannelInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channelLocked(namespace, ch).Fallbacks++
+}
+
+func (t *canaryTracker) report(namespace string) CanaryStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := CanaryStats{Since: t.since, Channels: []CanaryChannelStats{}}
+	state, ok := t.reports[namespace]
+	if !ok {
+		return report
+	}
+	report.Requests = state.requests
+	for _, ch := range state.channels {
+		stats := *ch
+		if state.requests > 0 {
+			stats.ActualPercent = float64(stats.Routed) / float64(state.requests) * 100
+		}
+		report.Channels = append(report.Channels, stats)
+	}
+	sort.Slice(report.Channels, func(i, j int) bool {
+		return report.Channels[i].ChannelIndex < report.Channels[j].ChannelIndex
+	})
+	return report
+}
+
+// applyCanaryRouting 灰度路由：按会话标识（无会话时为客户端 IP）哈希分桶，命中灰度比例的请求直接路由到灰度渠道；
+// 灰度渠道已失败、不健康或被排除时回退到常规选择。返回的渠道列表已排除灰度渠道（仅剩灰度渠道时保持原样），
+// 使未命中灰度的流量不会经由亲和、促销或常规排序落到灰度渠道上
+func (s *ChannelScheduler) applyCanaryRouting(
+	ctx context.Context,
+	userID string,
+	channels []ChannelInfo,
+	failedChannels map[int]bool,
+	isResponses bool,
+	metricsManager *metrics.MetricsManager,
+	excludeLowQuality bool,
+) (*SelectionResult, []ChannelInfo) {
+	var canaries, regular []ChannelInfo
+	for _, ch := range channels {
+		if ch.CanaryPercent > 0 {
+			canaries = append(canaries, ch)
+		} else {
+			regular = append(regular, ch)
+		}
+	}
+	if len(canaries) == 0 {
+		return nil, channels
+	}
+
+	logf := selectionLogf(ctx)
+	dryRun := dryRunFromContext(ctx)
+	namespace := "messages"
+	if isResponses {
+		namespace = "responses"
+	}
+	routingKey, keyDesc := userID, "user: "+maskUserID(userID)
+	if routingKey == "" {
+		if clientIP := clientIPFromContext(ctx); clientIP != "" {
+			routingKey, keyDesc = clientIP, "ip: "+maskClientIP(clientIP)
+		}
+	}
+	firstAttempt := len(failedChannels) == 0
+	if !dryRun && firstAttempt {
+		s.canary.recordRequest(namespace, canaries)
+	}
+
+	for _, ch := range canaries {
+		var hit bool
+		if routingKey != "" {
+			hit = inCanary(canaryBucket(ch.Name, routingKey), ch.CanaryPercent)
+		} else if !dryRun {
+			// 无会话标识也无客户端 IP：按比例随机，保证整体流量比例
+			hit = rand.Float64()*100 < ch.CanaryPercent
+		}
+		if !hit {
+			continue
+		}
+
+		upstream := s.getUpstreamByIndex(ch.Index, isResponses)
+		if upstream == nil {
+			continue
+		}
+		skipReason := ""
+		switch {
+		case failedChannels[ch.Index]:
+			skipReason = "已在本次请求中失败"
+		case excludeLowQuality && ch.LowQuality:
+			skipReason = "当前请求排除低质量渠道"
+		case len(upstream.APIKeys) == 0 || !metricsManager.IsChannelHealthyWithKeys(upstream.BaseURL, upstream.APIKeys):
+			skipReason = "不健康"
+		}
+		if skipReason != "" {
+			logf("[Scheduler-Canary] 灰度渠道 [%d] %s %s，回退到常规选择 (%s)", ch.Index, ch.Name, skipReason, keyDesc)
+			if !dryRun {
+				s.canary.recordFallback(namespace, ch)
+			}
+			continue
+		}
+
+		logf("[Scheduler-Canary] 灰度路由到渠道: [%d] %s (灰度比例: %.2f%%, %s)", ch.Index, upstream.Name, ch.CanaryPercent, keyDesc)
+		if !dryRun && firstAttempt {
+			s.canary.recordRouted(namespace, ch)
+		}
+		return &SelectionResult{
+			Upstream:     upstream,
+			ChannelIndex: ch.Index,
+			Reason:       "canary",
+		}, channels
+	}
+
+	if len(regular) == 0 {
+		return nil, channels
+	}
+	return nil, regular
+}
+
+// GetCanaryStats 获取灰度路由统计（namespace: messages/responses）
+func (s *ChannelScheduler) GetCanaryStats(namespace string) CanaryStats {
+	return s.canary.report(namespace)
+}
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+func newCanaryTestConfig(percent float64) config.Config {
+	return config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "primary", BaseURL: "https://primary.example.com", APIKeys: []string{"k0"}, Status: "active", Priority: 1},
+			{Name: "canary", BaseURL: "https://canary.example.com", APIKeys: []string{"k1"}, Status: "active", Priority: 2, CanaryPercent: percent},
+		},
+	}
+}
+
+// TestCanaryBucket_StableAndMonotonic 测试分桶稳定，且提高比例时已命中的会话保持命中
+func TestCanaryBucket_StableAndMonotonic(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("conv-%d", i)
+		bucket := canaryBucket("canary", key)
+		if bucket != canaryBucket("canary", key) {
+			t.Fatalf("分桶不稳定: %s", key)
+		}
+		if inCanary(bucket, 5) && !inCanary(bucket, 20) {
+			t.Fatalf("提高比例后会话 %s 不应移出灰度", key)
+		}
+	}
+	if inCanary(0, 0) || !inCanary(canaryBuckets-1, 100) {
+		t.Fatalf("0%% 不应命中任何分桶，100%% 应命中全部分桶")
+	}
+}
+
+// TestSelectChannel_CanaryRoutesStableFraction 测试灰度渠道按会话获得约定比例的流量，且同一会话结果一致
+func TestSelectChannel_CanaryRoutesStableFraction(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, newCanaryTestConfig(5))
+	defer cleanup()
+	scheduler.schedulerConfig.Affinity.Enabled = false
+
+	const conversations = 4000
+	canaryHits := 0
+	for i := 0; i < conversations; i++ {
+		userID := fmt.Sprintf("conv-%d", i)
+		first, err := scheduler.SelectChannel(context.Background(), userID, map[int]bool{}, false)
+		if err != nil {
+			t.Fatalf("SelectChannel 失败: %v", err)
+		}
+		again, _ := scheduler.SelectChannel(context.Background(), userID, map[int]bool{}, false)
+		if again.ChannelIndex != first.ChannelIndex {
+			t.Fatalf("会话 %s 的路由不稳定: %d -> %d", userID, first.ChannelIndex, again.ChannelIndex)
+		}
+		if first.ChannelIndex == 1 {
+			if first.Reason != "canary" {
+				t.Fatalf("Reason = %q, want canary", first.Reason)
+			}
+			canaryHits++
+		}
+	}
+	if share := float64(canaryHits) / conversations * 100; math.Abs(share-5) > 1.5 {
+		t.Fatalf("灰度比例 = %.2f%%, want ~5%%", share)
+	}
+
+	stats := scheduler.GetCanaryStats("messages")
+	if stats.Requests != conversations*2 || len(stats.Channels) != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if ch := stats.Channels[0]; ch.ChannelIndex != 1 || ch.CanaryPercent != 5 || ch.Routed != int64(canaryHits*2) || ch.Fallbacks != 0 {
+		t.Fatalf("canary stats = %+v, want routed=%d", ch, canaryHits*2)
+	}
+}
+
+// TestSelectChannel_CanaryExcludedFromRegularRanking 测试未命中灰度的流量不会经常规排序落到灰度渠道（即使灰度渠道优先级更高）
+func TestSelectChannel_CanaryExcludedFromRegularRanking(t *testing.T) {
+	cfg := newCanaryTestConfig(1)
+	cfg.Upstream[1].Priority = 0 // 灰度渠道优先级最高
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	scheduler.schedulerConfig.Affinity.Enabled = false
+
+	for i := 0; i < 500; i++ {
+		userID := fmt.Sprintf("conv-%d", i)
+		result, err := scheduler.SelectChannel(context.Background(), userID, map[int]bool{}, false)
+		if err != nil {
+			t.Fatalf("SelectChannel 失败: %v", err)
+		}
+		hit := inCanary(canaryBucket("canary", userID), 1)
+		if hit != (result.ChannelIndex == 1) {
+			t.Fatalf("会话 %s: 命中灰度=%v, 选择渠道=%d", userID, hit, result.ChannelIndex)
+		}
+	}
+}
+
+// TestSelectChannel_CanaryFallsBackToPrimary 测试灰度渠道不健康或已失败时灰度流量回退到主渠道
+func TestSelectChannel_CanaryFallsBackToPrimary(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, newCanaryTestConfig(100))
+	defer cleanup()
+	scheduler.schedulerConfig.Affinity.Enabled = false
+
+	result, err := scheduler.SelectChannel(context.Background(), "conv-1", map[int]bool{}, false)
+	if err != nil || result.ChannelIndex != 1 {
+		t.Fatalf("100%% 灰度时应选择灰度渠道: %+v (err=%v)", result, err)
+	}
+
+	// 本次请求中灰度渠道已失败：故障转移到主渠道
+	result, err = scheduler.SelectChannel(context.Background(), "conv-1", map[int]bool{1: true}, false)
+	if err != nil || result.ChannelIndex != 0 {
+		t.Fatalf("灰度渠道失败后应回退到主渠道: %+v (err=%v)", result, err)
+	}
+
+	// 灰度渠道不健康
+	for i := 0; i < 10; i++ {
+		scheduler.messagesMetricsManager.RecordFailure("https://canary.example.com", "k1")
+	}
+	result, err = scheduler.SelectChannel(context.Background(), "conv-2", map[int]bool{}, false)
+	if err != nil || result.ChannelIndex != 0 {
+		t.Fatalf("灰度渠道不健康时应回退到主渠道: %+v (err=%v)", result, err)
+	}
+
+	stats := scheduler.GetCanaryStats("messages")
+	if ch := stats.Channels[0]; ch.Routed != 1 || ch.Fallbacks != 2 {
+		t.Fatalf("canary stats = %+v, want routed=1 fallbacks=2", ch)
+	}
+	if stats.Requests != 2 {
+		t.Fatalf("Requests = %d, want 2（故障转移重试不计入）", stats.Requests)
+	}
+}
+
+// TestSelectChannel_CanaryDryRunDoesNotRecord 测试 dry-run 预览可看到灰度路由但不计入统计
+func TestSelectChannel_CanaryDryRunDoesNotRecord(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, newCanaryTestConfig(100))
+	defer cleanup()
+
+	preview, err := scheduler.PreviewChannelSelection(context.Background(), "conv-1", map[int]bool{}, false)
+	if err != nil {
+		t.Fatalf("PreviewChannelSelection 失败: %v", err)
+	}
+	if preview.ChosenIndex != 1 || preview.Reason != "canary" {
+		t.Fatalf("preview = %+v, want canary channel", preview)
+	}
+	if stats := scheduler.GetCanaryStats("messages"); stats.Requests != 0 || len(stats.Channels) != 0 {
+		t.Fatalf("dry-run 不应计入统计: %+v", stats)
+	}
+}
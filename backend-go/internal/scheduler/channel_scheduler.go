@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"log"
 	"math/rand/v2"
+	"net/http"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/BenedictKing/claude-proxy/internal/config"
 	"github.com/BenedictKing/claude-proxy/internal/metrics"
@@ -32,6 +35,17 @@ type ChannelScheduler struct {
 	urlManager              *warmup.URLManager // URL 管理器（非阻塞，动态排序）
 
 	schedulerConfig SchedulerConfig
+	retryBudget     *RetryBudget         // 全局重试预算（默认不限制）
+	failoverLimiter *FailoverLimiter     // 全局故障转移并发上限（默认不限制）
+	failoverCosts   *failoverCostTracker // 故障转移相对主渠道的成本差汇总
+	shadow          *shadowTracker       // 影子渠道请求并发控制与结果汇总
+	canary          *canaryTracker       // 灰度渠道路由统计
+
+	affinityStabilizer *affinityStabilizer // 会话亲和抖动检测（nil 表示禁用）
+	nonFailoverGuard   *nonFailoverGuard   // 非故障转移错误率自动暂停（nil 表示禁用）
+	keyProber          *keyProber          // 后台密钥健康探测（nil 表示禁用）
+	cacheAffinity      *cacheAffinity      // 提示缓存感知的会话亲和（nil 表示禁用）
+	pricingSource      PricingSource       // cheapest 策略的定价数据来源（nil 表示无定价）
 
 	rrLastMessages  atomic.Int64
 	rrLastResponses atomic.Int64
@@ -55,6 +69,11 @@ func NewChannelScheduler(
 		traceAffinity:           traceAffinity,
 		urlManager:              urlMgr,
 		schedulerConfig:         DefaultSchedulerConfig(),
+		retryBudget:             NewRetryBudget(0),
+		failoverLimiter:         NewFailoverLimiter(0, 0),
+		failoverCosts:           newFailoverCostTracker(),
+		shadow:                  newShadowTracker(DefaultShadowMaxConcurrency),
+		canary:                  newCanaryTracker(),
 	}
 	scheduler.rrLastMessages.Store(-1)
 	scheduler.rrLastResponses.Store(-1)
@@ -78,7 +97,7 @@ type SelectionResult struct {
 }
 
 // SelectChannel 选择最佳渠道
-// 优先级: 促销期渠道 > Trace 亲和（可配置） > 同优先级组内策略选择
+// 优先级: 促销期渠道 > 缓存归属渠道切回（可配置） > Trace 亲和（可配置） > 同优先级组内策略选择
 func (s *ChannelScheduler) SelectChannel(
 	ctx context.Context,
 	userID string,
@@ -87,6 +106,19 @@ func (s *ChannelScheduler) SelectChannel(
 ) (*SelectionResult, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.selectChannelLocked(ctx, userID, failedChannels, isResponses)
+}
+
+// selectChannelLocked SelectChannel 的实际选择逻辑（调用方需持有读锁）
+// dry-run 上下文下不输出日志、不推进轮询状态、不执行随机爬坡过滤
+func (s *ChannelScheduler) selectChannelLocked(
+	ctx context.Context,
+	userID string,
+	failedChannels map[int]bool,
+	isResponses bool,
+) (*SelectionResult, error) {
+	logf := selectionLogf(ctx)
+	dryRun := dryRunFromContext(ctx)
 
 	// 获取活跃渠道列表
 	activeChannels := s.getActiveChannels(isResponses)
@@ -94,14 +126,48 @@ func (s *ChannelScheduler) SelectChannel(
 		return nil, fmt.Errorf("没有可用的活跃渠道")
 	}
 
+	// 按请求模型过滤渠道（在所有排序策略之前，避免把故障转移浪费在不支持该模型的渠道上）
+	if model := requestModelFromContext(ctx); model != "" {
+		activeChannels = filterChannelsByModel(activeChannels, model, func(index int) *config.UpstreamConfig {
+			return s.getUpstreamByIndex(index, isResponses)
+		})
+		if len(activeChannels) == 0 {
+			logf("[Scheduler-Model] 警告: 没有渠道支持模型 %s", model)
+			return nil, &NoChannelForModelError{Model: model}
+		}
+	}
+
+	// 按请求体大小过滤渠道（超过渠道 maxRequestBodySize 的请求只路由到上限足够大的渠道）
+	if limits, ok := requestBodyLimitsFromContext(ctx); ok {
+		var maxLimit int64
+		activeChannels, maxLimit = filterChannelsByBodySize(activeChannels, limits, func(index int) *config.UpstreamConfig {
+			return s.getUpstreamByIndex(index, isResponses)
+		})
+		if len(activeChannels) == 0 {
+			logf("[Scheduler-BodySize] 警告: 请求体 %d 字节超过所有渠道的上限", limits.size)
+			return nil, &RequestTooLargeError{Size: limits.size, MaxLimit: maxLimit}
+		}
+	}
+
 	// 获取对应类型的指标管理器
 	metricsManager := s.getMetricsManager(isResponses)
 	cfg := s.schedulerConfig
 	ValidateSchedulerConfig(&cfg)
+	excludeLowQuality := excludeLowQualityFromContext(ctx)
+
+	// 灰度渠道：命中分桶的会话直接路由到灰度渠道；其余流量（及灰度渠道不可用时）排除灰度渠道后继续常规选择
+	canaryResult, activeChannels := s.applyCanaryRouting(ctx, userID, activeChannels, failedChannels, isResponses, metricsManager, excludeLowQuality)
+	if canaryResult != nil {
+		return canaryResult, nil
+	}
 
 	// 0. 检查促销期渠道（最高优先级，绕过健康检查）
 	if cfg.Promotion.Enabled {
-		promotedChannel := s.findPromotedChannel(activeChannels, isResponses)
+		promotedChannel := s.findPromotedChannel(activeChannels, isResponses, logf)
+		if promotedChannel != nil && excludeLowQuality && promotedChannel.LowQuality {
+			logf("[Scheduler-Promotion] 跳过低质量促销渠道: [%d] %s (当前请求排除低质量渠道)", promotedChannel.Index, promotedChannel.Name)
+			promotedChannel = nil
+		}
 		if promotedChannel != nil && !failedChannels[promotedChannel.Index] {
 			upstream := s.getUpstreamByIndex(promotedChannel.Index, isResponses)
 			if upstream != nil && len(upstream.APIKeys) > 0 {
@@ -111,7 +177,7 @@ func (s *ChannelScheduler) SelectChannel(
 
 				if cfg.Promotion.BypassHealthCheck {
 					if failureRate <= maxFailureRate {
-						log.Printf("[Scheduler-Promotion] 促销期优先选择渠道: [%d] %s (失败率: %.1f%%, maxFailureRate: %.1f%%, 绕过健康检查)",
+						logf("[Scheduler-Promotion] 促销期优先选择渠道: [%d] %s (失败率: %.1f%%, maxFailureRate: %.1f%%, 绕过健康检查)",
 							promotedChannel.Index, upstream.Name, failureRate*100, maxFailureRate*100)
 						return &SelectionResult{
 							Upstream:     upstream,
@@ -119,11 +185,11 @@ func (s *ChannelScheduler) SelectChannel(
 							Reason:       "promotion_priority",
 						}, nil
 					}
-					log.Printf("[Scheduler-Promotion] 警告: 促销渠道 [%d] %s 失败率过高，跳过 (失败率: %.1f%%, maxFailureRate: %.1f%%)",
+					logf("[Scheduler-Promotion] 警告: 促销渠道 [%d] %s 失败率过高，跳过 (失败率: %.1f%%, maxFailureRate: %.1f%%)",
 						promotedChannel.Index, upstream.Name, failureRate*100, maxFailureRate*100)
 				} else {
 					if metricsManager.IsChannelHealthyWithKeys(upstream.BaseURL, upstream.APIKeys) {
-						log.Printf("[Scheduler-Promotion] 促销期优先选择渠道: [%d] %s (失败率: %.1f%%)",
+						logf("[Scheduler-Promotion] 促销期优先选择渠道: [%d] %s (失败率: %.1f%%)",
 							promotedChannel.Index, upstream.Name, failureRate*100)
 						return &SelectionResult{
 							Upstream:     upstream,
@@ -131,53 +197,40 @@ func (s *ChannelScheduler) SelectChannel(
 							Reason:       "promotion_priority",
 						}, nil
 					}
-					log.Printf("[Scheduler-Promotion] 警告: 促销渠道 [%d] %s 不健康，跳过 (失败率: %.1f%%)",
+					logf("[Scheduler-Promotion] 警告: 促销渠道 [%d] %s 不健康，跳过 (失败率: %.1f%%)",
 						promotedChannel.Index, upstream.Name, failureRate*100)
 				}
 			} else if upstream != nil {
-				log.Printf("[Scheduler-Promotion] 警告: 促销渠道 [%d] %s 无可用密钥，跳过", promotedChannel.Index, upstream.Name)
+				logf("[Scheduler-Promotion] 警告: 促销渠道 [%d] %s 无可用密钥，跳过", promotedChannel.Index, upstream.Name)
 			}
 		} else if promotedChannel != nil {
-			log.Printf("[Scheduler-Promotion] 警告: 促销渠道 [%d] %s 已在本次请求中失败，跳过", promotedChannel.Index, promotedChannel.Name)
+			logf("[Scheduler-Promotion] 警告: 促销渠道 [%d] %s 已在本次请求中失败，跳过", promotedChannel.Index, promotedChannel.Name)
 		}
 	}
 
 	// 1. 检查 Trace 亲和性（促销渠道失败时或无促销渠道时）
-	if cfg.Affinity.Enabled && userID != "" && s.traceAffinity != nil {
-		if preferredIdx, ok := s.traceAffinity.GetPreferredChannel(userID); ok && !failedChannels[preferredIdx] {
-			var preferredCh *ChannelInfo
-			for i := range activeChannels {
-				if activeChannels[i].Index == preferredIdx {
-					preferredCh = &activeChannels[i]
-					break
+	//    无会话标识时以客户端 IP + 模型亲和兜底（需启用 IP 亲和）
+	if cfg.Affinity.Enabled && s.traceAffinity != nil {
+		if userID != "" {
+			// 缓存归属渠道恢复后优先切回（需启用缓存感知亲和）
+			if result := s.trySnapBackToCacheHome(userID, activeChannels, failedChannels, isResponses, metricsManager, excludeLowQuality, logf); result != nil {
+				return result, nil
+			}
+			if preferredIdx, ok := s.traceAffinity.GetPreferredChannel(userID); ok {
+				pinned := s.isAffinityPinned(userID, preferredIdx)
+				if result := s.tryAffinityChannel(preferredIdx, activeChannels, failedChannels, isResponses, metricsManager, cfg, excludeLowQuality, pinned,
+					"trace_affinity", "user: "+maskUserID(userID), logf); result != nil {
+					return result, nil
+				}
+				if !dryRun {
+					s.noteAffinityHealthSkip(userID, preferredIdx, activeChannels, failedChannels, isResponses, metricsManager, logf)
 				}
 			}
-
-			if preferredCh != nil {
-				if preferredCh.Status != "active" {
-					log.Printf("[Scheduler-Affinity] 跳过亲和渠道 [%d] %s: 状态为 %s (user: %s)", preferredIdx, preferredCh.Name, preferredCh.Status, maskUserID(userID))
-				} else {
-					allowAffinity := true
-					if cfg.Affinity.OnlyWithinSamePriority {
-						bestHealthyPriority, hasHealthy := s.getBestHealthyPriority(activeChannels, failedChannels, isResponses, metricsManager)
-						if hasHealthy && preferredCh.Priority != bestHealthyPriority {
-							log.Printf("[Scheduler-Affinity] 跳过亲和渠道 [%d] %s: 优先级不匹配 (preferred=%d, best=%d, user: %s)",
-								preferredIdx, preferredCh.Name, preferredCh.Priority, bestHealthyPriority, maskUserID(userID))
-							allowAffinity = false
-						}
-					}
-
-					if allowAffinity {
-						upstream := s.getUpstreamByIndex(preferredIdx, isResponses)
-						if upstream != nil && len(upstream.APIKeys) > 0 && metricsManager.IsChannelHealthyWithKeys(upstream.BaseURL, upstream.APIKeys) {
-							log.Printf("[Scheduler-Affinity] Trace亲和选择渠道: [%d] %s (user: %s)", preferredIdx, upstream.Name, maskUserID(userID))
-							return &SelectionResult{
-								Upstream:     upstream,
-								ChannelIndex: preferredIdx,
-								Reason:       "trace_affinity",
-							}, nil
-						}
-					}
+		} else if clientIP := clientIPFromContext(ctx); clientIP != "" {
+			if preferredIdx, ok := s.traceAffinity.GetPreferredChannelByIP(clientIP, requestModelFromContext(ctx)); ok {
+				if result := s.tryAffinityChannel(preferredIdx, activeChannels, failedChannels, isResponses, metricsManager, cfg, excludeLowQuality, false,
+					"ip_affinity", "ip: "+maskClientIP(clientIP), logf); result != nil {
+					return result, nil
 				}
 			}
 		}
@@ -185,25 +238,36 @@ func (s *ChannelScheduler) SelectChannel(
 
 	// 2. 选择健康渠道：先筛出“最高优先级组”，再按策略选择
 	healthyCandidates := make([]ChannelInfo, 0, len(activeChannels))
-	for _, ch := range activeChannels {
-		if failedChannels[ch.Index] {
-			continue
-		}
-		if ch.Status != "active" {
-			continue
+	for _, score := range s.scoreChannels(activeChannels, failedChannels, isResponses, metricsManager) {
+		if score.SkipReason == SkipReasonUnhealthy {
+			logf("[Scheduler-Channel] 警告: 跳过不健康渠道: [%d] %s (失败率: %.1f%%)", score.Index, score.Name, score.FailureRate*100)
 		}
-
-		upstream := s.getUpstreamByIndex(ch.Index, isResponses)
-		if upstream == nil || len(upstream.APIKeys) == 0 {
-			continue
+		if score.Eligible {
+			healthyCandidates = append(healthyCandidates, score.channel)
 		}
+	}
+	if excludeLowQuality {
+		healthyCandidates = preferNormalQuality(healthyCandidates, "Scheduler-Channel", logf)
+	}
+	if cfg.Ramp.Enabled && !dryRun {
+		healthyCandidates = applyNewChannelRamp(healthyCandidates, cfg.Ramp, metricsManager, func(index int) *config.UpstreamConfig {
+			return s.getUpstreamByIndex(index, isResponses)
+		}, "Scheduler-Ramp")
+	}
 
-		if !metricsManager.IsChannelHealthyWithKeys(upstream.BaseURL, upstream.APIKeys) {
-			failureRate := metricsManager.CalculateChannelFailureRate(upstream.BaseURL, upstream.APIKeys)
-			log.Printf("[Scheduler-Channel] 警告: 跳过不健康渠道: [%d] %s (失败率: %.1f%%)", ch.Index, ch.Name, failureRate*100)
-			continue
+	if len(healthyCandidates) > 0 && s.cheapestEnabled(isResponses) {
+		// cheapest 策略：在所有健康候选中选择预估成本最低的渠道（不限于最高优先级组）
+		ranked, costs := s.rankByCost(ctx, healthyCandidates, func(index int) *config.UpstreamConfig {
+			return s.getUpstreamByIndex(index, isResponses)
+		})
+		if upstream := s.getUpstreamByIndex(ranked[0].Index, isResponses); upstream != nil {
+			logf("[Scheduler-Channel] 选择渠道: [%d] %s (优先级: %d, 策略: cheapest, 预估成本: $%.6f)", ranked[0].Index, upstream.Name, ranked[0].Priority, costs[0].EstimatedCostUSD)
+			return &SelectionResult{
+				Upstream:     upstream,
+				ChannelIndex: ranked[0].Index,
+				Reason:       string(LoadBalanceCheapest),
+			}, nil
 		}
-		healthyCandidates = append(healthyCandidates, ch)
 	}
 
 	if len(healthyCandidates) > 0 {
@@ -216,10 +280,10 @@ func (s *ChannelScheduler) SelectChannel(
 			topCandidates = append(topCandidates, ch)
 		}
 
-		selected, reason := s.pickFromTopCandidates(topCandidates, isResponses)
+		selected, reason := s.pickFromTopCandidates(topCandidates, isResponses, dryRun)
 		upstream := s.getUpstreamByIndex(selected.Index, isResponses)
 		if upstream != nil {
-			log.Printf("[Scheduler-Channel] 选择渠道: [%d] %s (优先级: %d, 策略: %s)", selected.Index, upstream.Name, selected.Priority, reason)
+			logf("[Scheduler-Channel] 选择渠道: [%d] %s (优先级: %d, 策略: %s)", selected.Index, upstream.Name, selected.Priority, reason)
 			return &SelectionResult{
 				Upstream:     upstream,
 				ChannelIndex: selected.Index,
@@ -229,7 +293,79 @@ func (s *ChannelScheduler) SelectChannel(
 	}
 
 	// 3. 所有健康渠道都失败，选择失败率最低的作为降级
-	return s.selectFallbackChannel(activeChannels, failedChannels, isResponses)
+	return s.selectFallbackChannel(activeChannels, failedChannels, isResponses, excludeLowQuality, logf)
+}
+
+// tryAffinityChannel 尝试使用亲和渠道（会话亲和或客户端 IP 亲和）
+// 亲和渠道不可用（已失败、非 active、被排除、优先级不匹配或不健康）时返回 nil，继续常规选择
+// pinned 为 true（会话因抖动被固定）时跳过优先级匹配检查，仅要求渠道健康
+func (s *ChannelScheduler) tryAffinityChannel(
+	preferredIdx int,
+	activeChannels []ChannelInfo,
+	failedChannels map[int]bool,
+	isResponses bool,
+	metricsManager *metrics.MetricsManager,
+	cfg SchedulerConfig,
+	excludeLowQuality bool,
+	pinned bool,
+	reason string,
+	subject string,
+	logf func(format string, args ...interface{}),
+) *SelectionResult {
+	if failedChannels[preferredIdx] {
+		return nil
+	}
+
+	var preferredCh *ChannelInfo
+	for i := range activeChannels {
+		if activeChannels[i].Index == preferredIdx {
+			preferredCh = &activeChannels[i]
+			break
+		}
+	}
+	if preferredCh == nil {
+		return nil
+	}
+
+	if preferredCh.Status != "active" {
+		logf("[Scheduler-Affinity] 跳过亲和渠道 [%d] %s: 状态为 %s (%s)", preferredIdx, preferredCh.Name, preferredCh.Status, subject)
+		return nil
+	}
+	if excludeLowQuality && preferredCh.LowQuality {
+		logf("[Scheduler-Affinity] 跳过亲和渠道 [%d] %s: 低质量渠道已被排除 (%s)", preferredIdx, preferredCh.Name, subject)
+		return nil
+	}
+	if cfg.Affinity.OnlyWithinSamePriority && !pinned {
+		bestHealthyPriority, hasHealthy := s.getBestHealthyPriority(activeChannels, failedChannels, isResponses, metricsManager)
+		if hasHealthy && preferredCh.Priority != bestHealthyPriority {
+			// 缓存感知亲和：亲和渠道近期缓存命中率足够高时忽略优先级差异，避免切换渠道导致提示缓存失效
+			if hitRate, sticky := s.isStickyByCacheHitRate(s.getUpstreamByIndex(preferredIdx, isResponses), metricsManager); sticky {
+				logf("[Scheduler-CacheAffinity] 保持亲和渠道 [%d] %s: 缓存命中率 %.0f%% (preferred=%d, best=%d, %s)",
+					preferredIdx, preferredCh.Name, hitRate, preferredCh.Priority, bestHealthyPriority, subject)
+			} else {
+				logf("[Scheduler-Affinity] 跳过亲和渠道 [%d] %s: 优先级不匹配 (preferred=%d, best=%d, %s)",
+					preferredIdx, preferredCh.Name, preferredCh.Priority, bestHealthyPriority, subject)
+				return nil
+			}
+		}
+	}
+
+	upstream := s.getUpstreamByIndex(preferredIdx, isResponses)
+	if upstream == nil || len(upstream.APIKeys) == 0 || !metricsManager.IsChannelHealthyWithKeys(upstream.BaseURL, upstream.APIKeys) {
+		return nil
+	}
+	if reason == "ip_affinity" {
+		logf("[Scheduler-Affinity] IP亲和选择渠道: [%d] %s (%s)", preferredIdx, upstream.Name, subject)
+	} else if pinned {
+		logf("[Scheduler-Affinity] Trace亲和选择渠道（抖动固定期）: [%d] %s (%s)", preferredIdx, upstream.Name, subject)
+	} else {
+		logf("[Scheduler-Affinity] Trace亲和选择渠道: [%d] %s (%s)", preferredIdx, upstream.Name, subject)
+	}
+	return &SelectionResult{
+		Upstream:     upstream,
+		ChannelIndex: preferredIdx,
+		Reason:       reason,
+	}
 }
 
 func (s *ChannelScheduler) getBestHealthyPriority(
@@ -265,7 +401,7 @@ func (s *ChannelScheduler) getBestHealthyPriority(
 	return bestPriority, hasBest
 }
 
-func (s *ChannelScheduler) pickFromTopCandidates(candidates []ChannelInfo, isResponses bool) (ChannelInfo, string) {
+func (s *ChannelScheduler) pickFromTopCandidates(candidates []ChannelInfo, isResponses bool, dryRun bool) (ChannelInfo, string) {
 	if len(candidates) == 0 {
 		return ChannelInfo{}, "no_candidates"
 	}
@@ -274,10 +410,17 @@ func (s *ChannelScheduler) pickFromTopCandidates(candidates []ChannelInfo, isRes
 	case LoadBalanceWeightedRandom:
 		return pickWeightedRandom(candidates), "weighted_random"
 	case LoadBalanceRoundRobin:
+		lastPicked := &s.rrLastMessages
 		if isResponses {
-			return pickRoundRobin(candidates, &s.rrLastResponses), "round_robin"
+			lastPicked = &s.rrLastResponses
+		}
+		if dryRun {
+			// 预览时在副本上轮询，不推进真实的轮询位置
+			var peek atomic.Int64
+			peek.Store(lastPicked.Load())
+			lastPicked = &peek
 		}
-		return pickRoundRobin(candidates, &s.rrLastMessages), "round_robin"
+		return pickRoundRobin(candidates, lastPicked), "round_robin"
 	default:
 		return candidates[0], "priority_order"
 	}
@@ -364,8 +507,152 @@ func pickRoundRobin(candidates []ChannelInfo, lastPicked *atomic.Int64) ChannelI
 	return selected
 }
 
+// preferNormalQuality 排除低质量渠道：存在常规渠道时只保留常规渠道，
+// 否则原样返回（低质量渠道作为最后手段）。保持输入顺序不变。
+func preferNormalQuality(candidates []ChannelInfo, logTag string, logf func(format string, args ...interface{})) []ChannelInfo {
+	normal := make([]ChannelInfo, 0, len(candidates))
+	for _, ch := range candidates {
+		if !ch.LowQuality {
+			normal = append(normal, ch)
+		}
+	}
+	if len(normal) > 0 {
+		return normal
+	}
+	if len(candidates) > 0 {
+		logf("[%s] 警告: 无健康的常规渠道，使用低质量渠道作为最后手段", logTag)
+	}
+	return candidates
+}
+
+// newChannelTrafficFraction 计算新渠道在爬坡期应接收的流量比例（已验证渠道返回 1）
+func newChannelTrafficFraction(successCount int64, ramp RampConfig) float64 {
+	if successCount >= int64(ramp.ProvingRequests) {
+		return 1
+	}
+	progress := float64(successCount) / float64(ramp.ProvingRequests)
+	return ramp.MinTrafficFraction + (1-ramp.MinTrafficFraction)*progress
+}
+
+// applyNewChannelRamp 新渠道流量爬坡：未验证的渠道按流量比例随机参与本次调度，
+// 未被抽中时从候选中移除。仅当存在已验证的健康渠道时生效，避免全新部署时无渠道可用。保持输入顺序不变。
+func applyNewChannelRamp(
+	candidates []ChannelInfo,
+	ramp RampConfig,
+	metricsManager *metrics.MetricsManager,
+	getUpstream func(index int) *config.UpstreamConfig,
+	logTag string,
+) []ChannelInfo {
+	if len(candidates) < 2 {
+		return candidates
+	}
+
+	fractions := make(map[int]float64, len(candidates))
+	hasProven := false
+	for _, ch := range candidates {
+		upstream := getUpstream(ch.Index)
+		if upstream == nil {
+			continue
+		}
+		fraction := newChannelTrafficFraction(metricsManager.GetChannelSuccessCount(upstream.GetAllBaseURLs(), upstream.APIKeys), ramp)
+		if fraction >= 1 {
+			hasProven = true
+			continue
+		}
+		fractions[ch.Index] = fraction
+	}
+	if !hasProven || len(fractions) == 0 {
+		return candidates
+	}
+
+	filtered := make([]ChannelInfo, 0, len(candidates))
+	for _, ch := range candidates {
+		if fraction, ramping := fractions[ch.Index]; ramping && rand.Float64() >= fraction {
+			log.Printf("[%s] 新渠道爬坡中，本次跳过: [%d] %s (流量比例: %.0f%%)", logTag, ch.Index, ch.Name, fraction*100)
+			continue
+		}
+		filtered = append(filtered, ch)
+	}
+	return filtered
+}
+
+// SetRetryBudget 设置全局重试预算（每秒允许的故障转移尝试数，<=0 表示不限制）
+func (s *ChannelScheduler) SetRetryBudget(ratePerSecond float64) {
+	s.retryBudget = NewRetryBudget(ratePerSecond)
+}
+
+// AllowRetry 尝试消耗一次全局重试预算（跨渠道或跨 Key 的故障转移前调用）
+// 预算耗尽时返回 false，调用方应停止故障转移并返回最后的错误
+func (s *ChannelScheduler) AllowRetry() bool {
+	return s.retryBudget.TryAcquire()
+}
+
+// GetRetryBudgetStats 获取全局重试预算统计
+func (s *ChannelScheduler) GetRetryBudgetStats() RetryBudgetStats {
+	return s.retryBudget.Stats()
+}
+
+// SetFailoverConcurrency 设置全局故障转移并发上限（<=0 表示不限制）
+// maxWait 为等待槽位的最长时间（<=0 时使用默认值）
+func (s *ChannelScheduler) SetFailoverConcurrency(maxConcurrent int, maxWait time.Duration) {
+	s.failoverLimiter = NewFailoverLimiter(maxConcurrent, maxWait)
+}
+
+// AcquireFailoverSlot 获取一个全局故障转移槽位（每次故障转移尝试发送前调用）
+// 返回 false 表示等待超时或请求已取消，调用方应停止故障转移；返回 true 时须调用 ReleaseFailoverSlot
+func (s *ChannelScheduler) AcquireFailoverSlot(ctx context.Context) bool {
+	return s.failoverLimiter.Acquire(ctx)
+}
+
+// ReleaseFailoverSlot 释放全局故障转移槽位
+func (s *ChannelScheduler) ReleaseFailoverSlot() {
+	s.failoverLimiter.Release()
+}
+
+// GetFailoverConcurrencyStats 获取全局故障转移并发统计
+func (s *ChannelScheduler) GetFailoverConcurrencyStats() FailoverLimiterStats {
+	return s.failoverLimiter.Stats()
+}
+
+// SetNewChannelRamp 设置新渠道流量爬坡策略（provingRequests<=0 表示禁用）
+func (s *ChannelScheduler) SetNewChannelRamp(provingRequests int, minTrafficFraction float64) {
+	s.schedulerConfig.Ramp = RampConfig{
+		Enabled:            provingRequests > 0,
+		ProvingRequests:    provingRequests,
+		MinTrafficFraction: minTrafficFraction,
+	}
+}
+
+// SetAffinityStabilization 设置会话亲和抖动检测（maxSwitches<=0 表示禁用）
+// 同一会话在 window 内切换亲和渠道达到 maxSwitches 次时，固定到最近成功的渠道 cooldown 时长
+func (s *ChannelScheduler) SetAffinityStabilization(maxSwitches int, window, cooldown time.Duration) {
+	s.schedulerConfig.Affinity.ThrashSwitches = maxSwitches
+	s.schedulerConfig.Affinity.ThrashWindow = window
+	s.schedulerConfig.Affinity.PinCooldown = cooldown
+	ValidateSchedulerConfig(&s.schedulerConfig)
+
+	if maxSwitches <= 0 {
+		s.affinityStabilizer = nil
+		return
+	}
+	s.affinityStabilizer = newAffinityStabilizer(maxSwitches, s.schedulerConfig.Affinity.ThrashWindow, s.schedulerConfig.Affinity.PinCooldown)
+}
+
+// isAffinityPinned 判断会话是否因亲和抖动被固定在指定渠道上
+func (s *ChannelScheduler) isAffinityPinned(userID string, channelIndex int) bool {
+	return s.affinityStabilizer != nil && userID != "" && s.affinityStabilizer.isPinned(userID, channelIndex, time.Now())
+}
+
+// GetPinnedAffinityCount 获取当前因亲和抖动被固定的会话数
+func (s *ChannelScheduler) GetPinnedAffinityCount() int {
+	if s.affinityStabilizer == nil {
+		return 0
+	}
+	return s.affinityStabilizer.pinnedCount(time.Now())
+}
+
 // findPromotedChannel 查找处于促销期的渠道
-func (s *ChannelScheduler) findPromotedChannel(activeChannels []ChannelInfo, isResponses bool) *ChannelInfo {
+func (s *ChannelScheduler) findPromotedChannel(activeChannels []ChannelInfo, isResponses bool, logf func(format string, args ...interface{})) *ChannelInfo {
 	for i := range activeChannels {
 		ch := &activeChannels[i]
 		if ch.Status != "active" {
@@ -374,7 +661,7 @@ func (s *ChannelScheduler) findPromotedChannel(activeChannels []ChannelInfo, isR
 		upstream := s.getUpstreamByIndex(ch.Index, isResponses)
 		if upstream != nil {
 			if config.IsChannelInPromotion(upstream) {
-				log.Printf("[Scheduler-Promotion] 找到促销渠道: [%d] %s (promotionUntil: %v)", ch.Index, upstream.Name, upstream.PromotionUntil)
+				logf("[Scheduler-Promotion] 找到促销渠道: [%d] %s (promotionUntil: %v)", ch.Index, upstream.Name, upstream.PromotionUntil)
 				return ch
 			}
 		}
@@ -387,6 +674,8 @@ func (s *ChannelScheduler) selectFallbackChannel(
 	activeChannels []ChannelInfo,
 	failedChannels map[int]bool,
 	isResponses bool,
+	excludeLowQuality bool,
+	logf func(format string, args ...interface{}),
 ) (*SelectionResult, error) {
 	metricsManager := s.getMetricsManager(isResponses)
 	cfg := s.schedulerConfig.Fallback
@@ -426,6 +715,10 @@ func (s *ChannelScheduler) selectFallbackChannel(
 	}
 
 	sort.Slice(candidates, func(i, j int) bool {
+		// 排除低质量渠道时，低质量渠道始终排在常规渠道之后（仅作为最后手段）
+		if excludeLowQuality && candidates[i].ch.LowQuality != candidates[j].ch.LowQuality {
+			return !candidates[i].ch.LowQuality
+		}
 		if cfg.PriorityFirst {
 			if candidates[i].ch.Priority != candidates[j].ch.Priority {
 				return candidates[i].ch.Priority < candidates[j].ch.Priority
@@ -447,7 +740,7 @@ func (s *ChannelScheduler) selectFallbackChannel(
 
 	best := candidates[0]
 	if best.upstream != nil {
-		log.Printf("[Scheduler-Fallback] 警告: 降级选择渠道: [%d] %s (状态: %s, 优先级: %d, 失败率: %.1f%%)",
+		logf("[Scheduler-Fallback] 警告: 降级选择渠道: [%d] %s (状态: %s, 优先级: %d, 失败率: %.1f%%)",
 			best.ch.Index, best.upstream.Name, best.ch.Status, best.ch.Priority, best.failureRate*100)
 		return &SelectionResult{
 			Upstream:     best.upstream,
@@ -461,11 +754,13 @@ func (s *ChannelScheduler) selectFallbackChannel(
 
 // ChannelInfo 渠道信息（用于排序）
 type ChannelInfo struct {
-	Index    int
-	Name     string
-	Priority int
-	Weight   int
-	Status   string
+	Index         int
+	Name          string
+	Priority      int
+	Weight        int
+	Status        string
+	LowQuality    bool
+	CanaryPercent float64 // 灰度流量比例（0 表示非灰度渠道）
 }
 
 // getActiveChannels 获取可调度渠道列表（仅 active；空 status 视为 active）
@@ -491,6 +786,10 @@ func (s *ChannelScheduler) getActiveChannels(isResponses bool) []ChannelInfo {
 		if status != "active" {
 			continue
 		}
+		// 影子渠道仅接收异步复制的请求，不参与调度
+		if !isResponses && upstream.Shadow {
+			continue
+		}
 
 		priority := upstream.Priority
 		if priority == 0 {
@@ -498,11 +797,13 @@ func (s *ChannelScheduler) getActiveChannels(isResponses bool) []ChannelInfo {
 		}
 
 		activeChannels = append(activeChannels, ChannelInfo{
-			Index:    i,
-			Name:     upstream.Name,
-			Priority: priority,
-			Weight:   upstream.Weight,
-			Status:   status,
+			Index:         i,
+			Name:          upstream.Name,
+			Priority:      priority,
+			Weight:        upstream.Weight,
+			Status:        status,
+			LowQuality:    upstream.LowQuality,
+			CanaryPercent: upstream.CanaryPercent,
 		})
 	}
 
@@ -547,15 +848,51 @@ func (s *ChannelScheduler) RecordSuccessWithUsage(baseURL, apiKey string, usage
 	s.getMetricsManager(isResponses).RecordSuccessWithUsage(baseURL, apiKey, usage, model, costCents)
 }
 
+// RecordAccountHint 记录 Key 对应的账号/组织标识（来自成功响应头）
+func (s *ChannelScheduler) RecordAccountHint(baseURL, apiKey string, header http.Header, isResponses bool) {
+	s.getMetricsManager(isResponses).RecordAccountHint(baseURL, apiKey, header)
+}
+
+// RecordStreamRepairs 记录 Key 的流式事件序列修复次数
+func (s *ChannelScheduler) RecordStreamRepairs(baseURL, apiKey string, count int, isResponses bool) {
+	s.getMetricsManager(isResponses).RecordStreamRepairs(baseURL, apiKey, count)
+}
+
+// RecordStreamCompletion 记录流式请求结束及客户端取消情况
+func (s *ChannelScheduler) RecordStreamCompletion(baseURL, apiKey string, canceled bool, tokensAtCancel, totalOutputTokens int, isResponses bool) {
+	s.getMetricsManager(isResponses).RecordStreamCompletion(baseURL, apiKey, canceled, tokensAtCancel, totalOutputTokens)
+}
+
 // RecordFailure 记录渠道失败（使用 baseURL + apiKey）
 func (s *ChannelScheduler) RecordFailure(baseURL, apiKey string, isResponses bool) {
 	s.getMetricsManager(isResponses).RecordFailure(baseURL, apiKey)
 }
 
 // SetTraceAffinity 设置 Trace 亲和
+// 启用抖动检测时，亲和渠道发生切换会被计数，频繁切换的会话将被固定到本次成功的渠道
 func (s *ChannelScheduler) SetTraceAffinity(userID string, channelIndex int) {
-	if userID != "" {
-		s.traceAffinity.SetPreferredChannel(userID, channelIndex)
+	if userID == "" {
+		return
+	}
+	if s.affinityStabilizer != nil {
+		if prevIdx, ok := s.traceAffinity.GetPreferredChannel(userID); ok && prevIdx != channelIndex {
+			if s.affinityStabilizer.recordSwitch(userID, channelIndex, time.Now()) {
+				log.Printf("[Scheduler-Affinity] 检测到会话亲和抖动，固定到渠道 [%d] %v (user: %s, 上一渠道: [%d])",
+					channelIndex, s.schedulerConfig.Affinity.PinCooldown, maskUserID(userID), prevIdx)
+			}
+		}
+	}
+	s.traceAffinity.SetPreferredChannel(userID, channelIndex)
+}
+
+// RecordIPAffinity 请求成功后记录客户端 IP 亲和
+// 仅在没有会话标识且启用 IP 亲和时生效（有会话标识的请求由 Trace 亲和负责），ctx 需为调度时使用的上下文
+func (s *ChannelScheduler) RecordIPAffinity(ctx context.Context, userID string, channelIndex int) {
+	if userID != "" || s.traceAffinity == nil {
+		return
+	}
+	if clientIP := clientIPFromContext(ctx); clientIP != "" {
+		s.traceAffinity.SetPreferredChannelByIP(clientIP, requestModelFromContext(ctx), channelIndex)
 	}
 }
 
@@ -617,6 +954,14 @@ func maskUserID(userID string) string {
 	return userID[:8] + "***" + userID[len(userID)-4:]
 }
 
+// maskClientIP 掩码客户端 IP（保留网段，隐藏主机位）
+func maskClientIP(clientIP string) string {
+	if idx := strings.LastIndexAny(clientIP, ".:"); idx > 0 {
+		return clientIP[:idx+1] + "***"
+	}
+	return "***"
+}
+
 // GetSortedURLsForChannel 获取渠道排序后的 URL 列表（非阻塞，立即返回）
 // 返回按动态排序的 URL 结果列表，包含原始索引用于指标记录
 func (s *ChannelScheduler) GetSortedURLsForChannel(
@@ -685,14 +1030,38 @@ func (s *ChannelScheduler) SelectGeminiChannel(
 		return nil, fmt.Errorf("没有可用的活跃 Gemini 渠道")
 	}
 
+	// 按请求模型过滤渠道
+	if model := requestModelFromContext(ctx); model != "" {
+		activeChannels = filterChannelsByModel(activeChannels, model, s.getGeminiUpstreamByIndex)
+		if len(activeChannels) == 0 {
+			log.Printf("[Scheduler-Model] 警告: 没有 Gemini 渠道支持模型 %s", model)
+			return nil, &NoChannelForModelError{Model: model}
+		}
+	}
+
+	// 按请求体大小过滤渠道
+	if limits, ok := requestBodyLimitsFromContext(ctx); ok {
+		var maxLimit int64
+		activeChannels, maxLimit = filterChannelsByBodySize(activeChannels, limits, s.getGeminiUpstreamByIndex)
+		if len(activeChannels) == 0 {
+			log.Printf("[Scheduler-BodySize] 警告: 请求体 %d 字节超过所有 Gemini 渠道的上限", limits.size)
+			return nil, &RequestTooLargeError{Size: limits.size, MaxLimit: maxLimit}
+		}
+	}
+
 	// 获取指标管理器
 	metricsManager := s.geminiMetricsManager
 	cfg := s.schedulerConfig
 	ValidateSchedulerConfig(&cfg)
+	excludeLowQuality := excludeLowQualityFromContext(ctx)
 
 	// 0. 检查促销期渠道（最高优先级，绕过健康检查）
 	if cfg.Promotion.Enabled {
 		promotedChannel := s.findPromotedGeminiChannel(activeChannels)
+		if promotedChannel != nil && excludeLowQuality && promotedChannel.LowQuality {
+			log.Printf("[Scheduler-Gemini-Promotion] 跳过低质量促销渠道: [%d] %s (当前请求排除低质量渠道)", promotedChannel.Index, promotedChannel.Name)
+			promotedChannel = nil
+		}
 		if promotedChannel != nil && !failedChannels[promotedChannel.Index] {
 			upstream := s.getGeminiUpstreamByIndex(promotedChannel.Index)
 			if upstream != nil && len(upstream.APIKeys) > 0 {
@@ -747,9 +1116,11 @@ func (s *ChannelScheduler) SelectGeminiChannel(
 			if preferredCh != nil {
 				if preferredCh.Status != "active" {
 					log.Printf("[Scheduler-Gemini-Affinity] 跳过亲和渠道 [%d] %s: 状态为 %s (user: %s)", preferredIdx, preferredCh.Name, preferredCh.Status, maskUserID(userID))
+				} else if excludeLowQuality && preferredCh.LowQuality {
+					log.Printf("[Scheduler-Gemini-Affinity] 跳过亲和渠道 [%d] %s: 低质量渠道已被排除 (user: %s)", preferredIdx, preferredCh.Name, maskUserID(userID))
 				} else {
 					allowAffinity := true
-					if cfg.Affinity.OnlyWithinSamePriority {
+					if cfg.Affinity.OnlyWithinSamePriority && !s.isAffinityPinned(userID, preferredIdx) {
 						bestHealthyPriority, hasHealthy := s.getBestHealthyGeminiPriority(activeChannels, failedChannels, metricsManager)
 						if hasHealthy && preferredCh.Priority != bestHealthyPriority {
 							log.Printf("[Scheduler-Gemini-Affinity] 跳过亲和渠道 [%d] %s: 优先级不匹配 (preferred=%d, best=%d, user: %s)",
@@ -796,6 +1167,25 @@ func (s *ChannelScheduler) SelectGeminiChannel(
 		}
 		healthyCandidates = append(healthyCandidates, ch)
 	}
+	if excludeLowQuality {
+		healthyCandidates = preferNormalQuality(healthyCandidates, "Scheduler-Gemini-Channel", log.Printf)
+	}
+	if cfg.Ramp.Enabled {
+		healthyCandidates = applyNewChannelRamp(healthyCandidates, cfg.Ramp, metricsManager, s.getGeminiUpstreamByIndex, "Scheduler-Gemini-Ramp")
+	}
+
+	if len(healthyCandidates) > 0 && isCheapestLoadBalance(s.configManager.GetGeminiLoadBalance()) {
+		// cheapest 策略：在所有健康候选中选择预估成本最低的渠道（不限于最高优先级组）
+		ranked, costs := s.rankByCost(ctx, healthyCandidates, s.getGeminiUpstreamByIndex)
+		if upstream := s.getGeminiUpstreamByIndex(ranked[0].Index); upstream != nil {
+			log.Printf("[Scheduler-Gemini-Channel] 选择渠道: [%d] %s (优先级: %d, 策略: cheapest, 预估成本: $%.6f)", ranked[0].Index, upstream.Name, ranked[0].Priority, costs[0].EstimatedCostUSD)
+			return &SelectionResult{
+				Upstream:     upstream,
+				ChannelIndex: ranked[0].Index,
+				Reason:       string(LoadBalanceCheapest),
+			}, nil
+		}
+	}
 
 	if len(healthyCandidates) > 0 {
 		topPriority := healthyCandidates[0].Priority
@@ -820,7 +1210,7 @@ func (s *ChannelScheduler) SelectGeminiChannel(
 	}
 
 	// 3. 所有健康渠道都失败，选择失败率最低的作为降级
-	return s.selectFallbackGeminiChannel(activeChannels, failedChannels)
+	return s.selectFallbackGeminiChannel(activeChannels, failedChannels, excludeLowQuality)
 }
 
 func (s *ChannelScheduler) getBestHealthyGeminiPriority(
@@ -892,6 +1282,7 @@ func (s *ChannelScheduler) findPromotedGeminiChannel(activeChannels []ChannelInf
 func (s *ChannelScheduler) selectFallbackGeminiChannel(
 	activeChannels []ChannelInfo,
 	failedChannels map[int]bool,
+	excludeLowQuality bool,
 ) (*SelectionResult, error) {
 	metricsManager := s.geminiMetricsManager
 	cfg := s.schedulerConfig.Fallback
@@ -931,6 +1322,10 @@ func (s *ChannelScheduler) selectFallbackGeminiChannel(
 	}
 
 	sort.Slice(candidates, func(i, j int) bool {
+		// 排除低质量渠道时，低质量渠道始终排在常规渠道之后（仅作为最后手段）
+		if excludeLowQuality && candidates[i].ch.LowQuality != candidates[j].ch.LowQuality {
+			return !candidates[i].ch.LowQuality
+		}
 		if cfg.PriorityFirst {
 			if candidates[i].ch.Priority != candidates[j].ch.Priority {
 				return candidates[i].ch.Priority < candidates[j].ch.Priority
@@ -987,11 +1382,12 @@ func (s *ChannelScheduler) getActiveGeminiChannels() []ChannelInfo {
 		}
 
 		activeChannels = append(activeChannels, ChannelInfo{
-			Index:    i,
-			Name:     upstream.Name,
-			Priority: priority,
-			Weight:   upstream.Weight,
-			Status:   status,
+			Index:      i,
+			Name:       upstream.Name,
+			Priority:   priority,
+			Weight:     upstream.Weight,
+			Status:     status,
+			LowQuality: upstream.LowQuality,
 		})
 	}
 
@@ -1027,6 +1423,11 @@ func (s *ChannelScheduler) RecordGeminiSuccessWithUsage(baseURL, apiKey string,
 	s.geminiMetricsManager.RecordSuccessWithUsage(baseURL, apiKey, usage, model, costCents)
 }
 
+// RecordGeminiAccountHint 记录 Gemini Key 对应的账号/组织标识
+func (s *ChannelScheduler) RecordGeminiAccountHint(baseURL, apiKey string, header http.Header) {
+	s.geminiMetricsManager.RecordAccountHint(baseURL, apiKey, header)
+}
+
 // RecordGeminiFailure 记录 Gemini 渠道失败
 func (s *ChannelScheduler) RecordGeminiFailure(baseURL, apiKey string) {
 	s.geminiMetricsManager.RecordFailure(baseURL, apiKey)
@@ -3,6 +3,7 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"os"
 	"path/filepath"
 	"testing"
@@ -395,6 +396,87 @@ func TestTraceAffinityOnlyWithinSamePriority_AllowsSamePriority(t *testing.T) {
 	}
 }
 
+// TestIPAffinity_FallbackWithoutConversationID 测试无会话标识时按客户端 IP + 模型保持渠道粘性
+func TestIPAffinity_FallbackWithoutConversationID(t *testing.T) {
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "a", BaseURL: "https://a.example.com", APIKeys: []string{"k1"}, Status: "active", Priority: 1},
+			{Name: "b", BaseURL: "https://b.example.com", APIKeys: []string{"k2"}, Status: "active", Priority: 1},
+		},
+	}
+
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+
+	newCtx := func(clientIP, model string) context.Context {
+		return WithRequestModel(WithClientIP(context.Background(), clientIP), model)
+	}
+	ctx := newCtx("203.0.113.7", "claude-sonnet")
+
+	// 未启用 IP 亲和时不记录
+	scheduler.RecordIPAffinity(ctx, "", 1)
+	if result, _ := scheduler.SelectChannel(ctx, "", make(map[int]bool), false); result.Reason == "ip_affinity" {
+		t.Fatal("未启用 IP 亲和时不应按 IP 选择渠道")
+	}
+
+	scheduler.GetTraceAffinityManager().SetIPAffinityTTL(5 * time.Minute)
+	scheduler.RecordIPAffinity(ctx, "", 1)
+
+	result, err := scheduler.SelectChannel(ctx, "", make(map[int]bool), false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 1 || result.Reason != "ip_affinity" {
+		t.Fatalf("期望 IP 亲和选择 index=1，实际 index=%d reason=%s", result.ChannelIndex, result.Reason)
+	}
+
+	// 亲和渠道本次已失败时回退常规选择
+	if result, _ := scheduler.SelectChannel(ctx, "", map[int]bool{1: true}, false); result.ChannelIndex != 0 {
+		t.Errorf("亲和渠道已失败时应选择 index=0，实际 index=%d", result.ChannelIndex)
+	}
+
+	// 不同 IP、不同模型、或携带会话标识时不使用 IP 亲和
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		userID string
+	}{
+		{"other ip", newCtx("198.51.100.1", "claude-sonnet"), ""},
+		{"other model", newCtx("203.0.113.7", "claude-opus"), ""},
+		{"with conversation id", ctx, "conversation-1"},
+	}
+	for _, tc := range cases {
+		result, err := scheduler.SelectChannel(tc.ctx, tc.userID, make(map[int]bool), false)
+		if err != nil {
+			t.Fatalf("%s: 选择渠道失败: %v", tc.name, err)
+		}
+		if result.Reason == "ip_affinity" {
+			t.Errorf("%s: 不应使用 IP 亲和", tc.name)
+		}
+	}
+
+	// 有会话标识时不记录 IP 亲和
+	scheduler.RecordIPAffinity(newCtx("192.0.2.9", "claude-sonnet"), "conversation-1", 1)
+	if _, ok := scheduler.GetTraceAffinityManager().GetPreferredChannelByIP("192.0.2.9", "claude-sonnet"); ok {
+		t.Error("有会话标识的请求不应记录 IP 亲和")
+	}
+}
+
+// TestIPAffinity_TTLCappedByTraceAffinityTTL 测试 IP 亲和 TTL 不超过会话亲和 TTL
+func TestIPAffinity_TTLCappedByTraceAffinityTTL(t *testing.T) {
+	mgr := session.NewTraceAffinityManagerWithTTL(10 * time.Minute)
+	defer mgr.Stop()
+
+	mgr.SetIPAffinityTTL(time.Hour)
+	if got := mgr.GetIPAffinityTTL(); got != 10*time.Minute {
+		t.Fatalf("IP 亲和 TTL = %v, want 10m", got)
+	}
+	mgr.SetIPAffinityTTL(0)
+	if mgr.IPAffinityEnabled() {
+		t.Fatal("TTL 为 0 时应禁用 IP 亲和")
+	}
+}
+
 func TestChannelScheduler_SelectChannel_WeightedRandomStrategy(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -716,3 +798,417 @@ func TestChannelScheduler_SelectGeminiChannel_SkipsDisabledWhenAllActiveFailed(t
 		t.Fatalf("期望 result=nil，但得到了 result=%+v (err=%v)", result, err)
 	}
 }
+
+// lowQualityTestConfig 低质量渠道排在最高优先级，常规渠道排在其后
+func lowQualityTestConfig() config.Config {
+	return config.Config{
+		Upstream: []config.UpstreamConfig{
+			{
+				Name:       "low-quality-channel",
+				BaseURL:    "https://lq.example.com",
+				APIKeys:    []string{"sk-lq-key"},
+				Status:     "active",
+				Priority:   1,
+				LowQuality: true,
+			},
+			{
+				Name:     "normal-channel",
+				BaseURL:  "https://normal.example.com",
+				APIKeys:  []string{"sk-normal-key"},
+				Status:   "active",
+				Priority: 2,
+			},
+		},
+		GeminiUpstream: []config.UpstreamConfig{
+			{
+				Name:       "gemini-low-quality",
+				BaseURL:    "https://gemini-lq.example.com",
+				APIKeys:    []string{"sk-gemini-lq"},
+				Status:     "active",
+				Priority:   1,
+				LowQuality: true,
+			},
+			{
+				Name:     "gemini-normal",
+				BaseURL:  "https://gemini-normal.example.com",
+				APIKeys:  []string{"sk-gemini-normal"},
+				Status:   "active",
+				Priority: 2,
+			},
+		},
+	}
+}
+
+// TestSelectChannel_ExcludeLowQuality_PrefersNormalChannel 测试排除低质量渠道时优先选择常规渠道
+func TestSelectChannel_ExcludeLowQuality_PrefersNormalChannel(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, lowQualityTestConfig())
+	defer cleanup()
+
+	// 未启用排除：按优先级选择低质量渠道
+	result, err := scheduler.SelectChannel(context.Background(), "", make(map[int]bool), false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 0 {
+		t.Errorf("未排除低质量渠道时期望选择 index=0，实际选择了 index=%d", result.ChannelIndex)
+	}
+
+	// 启用排除：跳过低质量渠道，选择常规渠道
+	ctx := WithExcludeLowQuality(context.Background(), true)
+	result, err = scheduler.SelectChannel(ctx, "", make(map[int]bool), false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 1 {
+		t.Errorf("排除低质量渠道时期望选择常规渠道 index=1，实际选择了 index=%d", result.ChannelIndex)
+	}
+}
+
+// TestSelectChannel_ExcludeLowQuality_LastResortWhenNormalUnhealthy 测试常规渠道不健康时低质量渠道作为最后手段
+func TestSelectChannel_ExcludeLowQuality_LastResortWhenNormalUnhealthy(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, lowQualityTestConfig())
+	defer cleanup()
+
+	metricsManager := scheduler.messagesMetricsManager
+	for i := 0; i < 10; i++ {
+		metricsManager.RecordFailure("https://normal.example.com", "sk-normal-key")
+	}
+
+	ctx := WithExcludeLowQuality(context.Background(), true)
+	result, err := scheduler.SelectChannel(ctx, "", make(map[int]bool), false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 0 {
+		t.Errorf("常规渠道不健康时期望回退到低质量渠道 index=0，实际选择了 index=%d", result.ChannelIndex)
+	}
+
+	// 常规渠道已失败：同样只能使用低质量渠道
+	scheduler2, cleanup2 := createTestScheduler(t, lowQualityTestConfig())
+	defer cleanup2()
+	result, err = scheduler2.SelectChannel(ctx, "", map[int]bool{1: true}, false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 0 {
+		t.Errorf("常规渠道已失败时期望选择低质量渠道 index=0，实际选择了 index=%d", result.ChannelIndex)
+	}
+}
+
+// TestSelectChannel_ExcludeLowQuality_FallbackOrdersNormalFirst 测试所有渠道都不健康时降级选择仍优先常规渠道
+func TestSelectChannel_ExcludeLowQuality_FallbackOrdersNormalFirst(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, lowQualityTestConfig())
+	defer cleanup()
+
+	metricsManager := scheduler.messagesMetricsManager
+	for i := 0; i < 10; i++ {
+		metricsManager.RecordFailure("https://lq.example.com", "sk-lq-key")
+		metricsManager.RecordFailure("https://normal.example.com", "sk-normal-key")
+	}
+
+	ctx := WithExcludeLowQuality(context.Background(), true)
+	result, err := scheduler.SelectChannel(ctx, "", make(map[int]bool), false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 1 {
+		t.Errorf("降级选择时期望常规渠道 index=1 排在低质量渠道之前，实际选择了 index=%d", result.ChannelIndex)
+	}
+}
+
+// TestSelectGeminiChannel_ExcludeLowQuality 测试 Gemini 渠道排除低质量渠道
+func TestSelectGeminiChannel_ExcludeLowQuality(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, lowQualityTestConfig())
+	defer cleanup()
+
+	ctx := WithExcludeLowQuality(context.Background(), true)
+	result, err := scheduler.SelectGeminiChannel(ctx, "", make(map[int]bool))
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 1 {
+		t.Errorf("期望选择 Gemini 常规渠道 index=1，实际选择了 index=%d", result.ChannelIndex)
+	}
+
+	result, err = scheduler.SelectGeminiChannel(ctx, "", map[int]bool{1: true})
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 0 {
+		t.Errorf("常规渠道已失败时期望选择低质量渠道 index=0，实际选择了 index=%d", result.ChannelIndex)
+	}
+}
+
+// TestSelectChannel_NewChannelRamp_LimitsTrafficUntilProven 测试新渠道在爬坡期只接收部分流量，验证后接收全部流量
+func TestSelectChannel_NewChannelRamp_LimitsTrafficUntilProven(t *testing.T) {
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{
+				Name:     "new-channel",
+				BaseURL:  "https://new.example.com",
+				APIKeys:  []string{"sk-new"},
+				Status:   "active",
+				Priority: 1,
+			},
+			{
+				Name:     "established-channel",
+				BaseURL:  "https://established.example.com",
+				APIKeys:  []string{"sk-established"},
+				Status:   "active",
+				Priority: 2,
+			},
+		},
+	}
+
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	scheduler.SetNewChannelRamp(10, 0.1)
+
+	metricsManager := scheduler.messagesMetricsManager
+	for i := 0; i < 10; i++ {
+		metricsManager.RecordSuccess("https://established.example.com", "sk-established")
+	}
+
+	countNew := func(rounds int) int {
+		count := 0
+		for i := 0; i < rounds; i++ {
+			result, err := scheduler.SelectChannel(context.Background(), "", make(map[int]bool), false)
+			if err != nil {
+				t.Fatalf("选择渠道失败: %v", err)
+			}
+			if result.ChannelIndex == 0 {
+				count++
+			}
+		}
+		return count
+	}
+
+	// 爬坡起点：新渠道约 10% 流量
+	if got := countNew(1000); got < 40 || got > 200 {
+		t.Errorf("爬坡期新渠道期望约 10%% 流量，实际 %d/1000", got)
+	}
+
+	// 部分验证：流量比例随成功次数增长（5/10 → 约 55%）
+	for i := 0; i < 5; i++ {
+		metricsManager.RecordSuccess("https://new.example.com", "sk-new")
+	}
+	if got := countNew(1000); got < 400 || got > 700 {
+		t.Errorf("爬坡中期新渠道期望约 55%% 流量，实际 %d/1000", got)
+	}
+
+	// 验证完成：新渠道按优先级接收全部流量
+	for i := 0; i < 5; i++ {
+		metricsManager.RecordSuccess("https://new.example.com", "sk-new")
+	}
+	if got := countNew(100); got != 100 {
+		t.Errorf("验证完成后新渠道期望接收全部流量，实际 %d/100", got)
+	}
+}
+
+// TestSelectChannel_NewChannelRamp_NoProvenChannels 测试没有已验证渠道时爬坡不生效
+func TestSelectChannel_NewChannelRamp_NoProvenChannels(t *testing.T) {
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "a", BaseURL: "https://a.example.com", APIKeys: []string{"sk-a"}, Status: "active", Priority: 1},
+			{Name: "b", BaseURL: "https://b.example.com", APIKeys: []string{"sk-b"}, Status: "active", Priority: 2},
+		},
+	}
+
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	scheduler.SetNewChannelRamp(10, 0.1)
+
+	for i := 0; i < 50; i++ {
+		result, err := scheduler.SelectChannel(context.Background(), "", make(map[int]bool), false)
+		if err != nil {
+			t.Fatalf("选择渠道失败: %v", err)
+		}
+		if result.ChannelIndex != 0 {
+			t.Fatalf("全新部署时期望按优先级选择 index=0，实际选择了 index=%d", result.ChannelIndex)
+		}
+	}
+}
+
+// TestNewChannelTrafficFraction 测试爬坡流量比例计算
+func TestNewChannelTrafficFraction(t *testing.T) {
+	ramp := RampConfig{Enabled: true, ProvingRequests: 10, MinTrafficFraction: 0.2}
+	tests := []struct {
+		successes int64
+		want      float64
+	}{
+		{0, 0.2},
+		{5, 0.6},
+		{10, 1},
+		{20, 1},
+	}
+	for _, tt := range tests {
+		if got := newChannelTrafficFraction(tt.successes, ramp); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("successes=%d: fraction=%v, want %v", tt.successes, got, tt.want)
+		}
+	}
+}
+
+// TestRetryBudget_UnlimitedByDefault 测试未配置时重试预算不限制
+func TestRetryBudget_UnlimitedByDefault(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, config.Config{})
+	defer cleanup()
+
+	for i := 0; i < 100; i++ {
+		if !scheduler.AllowRetry() {
+			t.Fatalf("未启用重试预算时不应拒绝重试 (第 %d 次)", i+1)
+		}
+	}
+	if stats := scheduler.GetRetryBudgetStats(); stats.Enabled {
+		t.Fatalf("默认不应启用重试预算: %+v", stats)
+	}
+}
+
+// TestRetryBudget_ExhaustAndRefill 测试预算耗尽后拒绝重试并随时间恢复
+func TestRetryBudget_ExhaustAndRefill(t *testing.T) {
+	budget := NewRetryBudget(2)
+	now := time.Now()
+	budget.now = func() time.Time { return now }
+	budget.lastRefill = now
+
+	if !budget.TryAcquire() || !budget.TryAcquire() {
+		t.Fatal("预算充足时应允许重试")
+	}
+	if budget.TryAcquire() {
+		t.Fatal("预算耗尽时应拒绝重试")
+	}
+
+	stats := budget.Stats()
+	if stats.Allowed != 2 || stats.Rejected != 1 {
+		t.Fatalf("allowed=%d rejected=%d, want 2/1", stats.Allowed, stats.Rejected)
+	}
+	if math.Abs(stats.Utilization-100) > 1e-9 {
+		t.Fatalf("utilization=%v, want 100", stats.Utilization)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !budget.TryAcquire() {
+		t.Fatal("补充 1 个令牌后应允许重试")
+	}
+	if budget.TryAcquire() {
+		t.Fatal("令牌再次耗尽后应拒绝重试")
+	}
+
+	now = now.Add(10 * time.Second)
+	if stats := budget.Stats(); stats.Available != stats.Capacity {
+		t.Fatalf("长时间空闲后令牌应补满至容量: available=%v capacity=%v", stats.Available, stats.Capacity)
+	}
+}
+
+// TestRetryBudget_MinimumCapacity 测试低速率时桶容量至少为 1
+func TestRetryBudget_MinimumCapacity(t *testing.T) {
+	budget := NewRetryBudget(0.2)
+	if stats := budget.Stats(); stats.Capacity != 1 {
+		t.Fatalf("capacity=%v, want 1", stats.Capacity)
+	}
+	if !budget.TryAcquire() {
+		t.Fatal("初始应有 1 个令牌")
+	}
+}
+
+// TestSelectChannel_FiltersBySupportedModels 测试按请求模型过滤渠道
+func TestSelectChannel_FiltersBySupportedModels(t *testing.T) {
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "opus-only", BaseURL: "https://a.example.com", APIKeys: []string{"sk-a"}, Status: "active", Priority: 1, SupportedModels: []string{"claude-*-opus*"}},
+			{Name: "haiku-only", BaseURL: "https://b.example.com", APIKeys: []string{"sk-b"}, Status: "active", Priority: 2, SupportedModels: []string{"claude-3-haiku"}},
+			{Name: "wildcard", BaseURL: "https://c.example.com", APIKeys: []string{"sk-c"}, Status: "active", Priority: 3},
+		},
+	}
+
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+
+	ctx := WithRequestModel(context.Background(), "claude-3-haiku")
+	result, err := scheduler.SelectChannel(ctx, "", make(map[int]bool), false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 1 {
+		t.Fatalf("haiku 请求应跳过仅支持 opus 的渠道，期望 index=1，实际 index=%d", result.ChannelIndex)
+	}
+
+	// haiku 渠道失败后应故障转移到通配渠道，而不是仅支持 opus 的渠道
+	result, err = scheduler.SelectChannel(ctx, "", map[int]bool{1: true}, false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 2 {
+		t.Fatalf("期望故障转移到通配渠道 index=2，实际 index=%d", result.ChannelIndex)
+	}
+
+	// 未指定模型时不过滤
+	result, err = scheduler.SelectChannel(context.Background(), "", make(map[int]bool), false)
+	if err != nil || result.ChannelIndex != 0 {
+		t.Fatalf("未指定模型时应按优先级选择 index=0: result=%v err=%v", result, err)
+	}
+}
+
+// TestSelectChannel_NoChannelForModel 测试没有渠道支持请求模型时返回明确错误
+func TestSelectChannel_NoChannelForModel(t *testing.T) {
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "opus-only", BaseURL: "https://a.example.com", APIKeys: []string{"sk-a"}, Status: "active", Priority: 1, SupportedModels: []string{"claude-3-opus"}},
+		},
+	}
+
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+
+	_, err := scheduler.SelectChannel(WithRequestModel(context.Background(), "gpt-4o"), "", make(map[int]bool), false)
+	noModelErr, ok := AsNoChannelForModelError(err)
+	if !ok {
+		t.Fatalf("期望 NoChannelForModelError，实际: %v", err)
+	}
+	if noModelErr.Model != "gpt-4o" {
+		t.Fatalf("错误中的模型名不正确: %s", noModelErr.Model)
+	}
+}
+
+// TestPreviewChannelSelection_DoesNotAdvanceRoundRobin 测试预览与实际选择一致且不推进轮询状态
+func TestPreviewChannelSelection_DoesNotAdvanceRoundRobin(t *testing.T) {
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "a", BaseURL: "https://a.example.com", APIKeys: []string{"sk-a"}, Status: "active", Priority: 1},
+			{Name: "b", BaseURL: "https://b.example.com", APIKeys: []string{"sk-b"}, Status: "active", Priority: 1},
+			{Name: "c", BaseURL: "https://c.example.com", APIKeys: []string{"sk-c"}, Status: "active", Priority: 1},
+		},
+	}
+
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	scheduler.schedulerConfig.Promotion.Enabled = false
+	scheduler.schedulerConfig.LoadBalanceStrategy = LoadBalanceRoundRobin
+
+	for i := 0; i < 2; i++ {
+		preview, err := scheduler.PreviewChannelSelection(context.Background(), "", make(map[int]bool), false)
+		if err != nil {
+			t.Fatalf("预览失败: %v", err)
+		}
+		if preview.ChosenIndex != 0 || preview.Reason != "round_robin" || len(preview.Candidates) != 3 {
+			t.Fatalf("第 %d 次预览结果不正确: %+v", i+1, preview)
+		}
+	}
+
+	result, err := scheduler.SelectChannel(context.Background(), "", make(map[int]bool), false)
+	if err != nil || result.ChannelIndex != 0 {
+		t.Fatalf("预览不应推进轮询状态，期望实际选择 index=0: result=%v err=%v", result, err)
+	}
+
+	// failedChannels 与 trace 亲和在预览中生效
+	scheduler.SetTraceAffinity("user-1", 2)
+	preview, err := scheduler.PreviewChannelSelection(context.Background(), "user-1", map[int]bool{2: true}, false)
+	if err != nil {
+		t.Fatalf("预览失败: %v", err)
+	}
+	if preview.ChosenIndex != 1 {
+		t.Fatalf("亲和渠道失败后应轮询到 index=1，实际 %d", preview.ChosenIndex)
+	}
+	if !preview.Candidates[2].AffinityMatch || preview.Candidates[2].Eligible || preview.Candidates[2].SkipReason != SkipReasonFailed {
+		t.Fatalf("亲和渠道评估不正确: %+v", preview.Candidates[2])
+	}
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/pricing"
+)
+
+// PricingSource 模型定价数据来源（由 pricing.Service 实现）
+type PricingSource interface {
+	GetPricing(model string) *pricing.ModelPricing
+}
+
+// ChannelCost 单个渠道的预估成本（cheapest 策略排序依据）
+type ChannelCost struct {
+	Index            int     `json:"index"`
+	Name             string  `json:"name"`
+	Model            string  `json:"model,omitempty"` // 模型映射后实际发往上游的模型
+	EstimatedCostUSD float64 `json:"estimatedCostUsd"`
+	PricingAvailable bool    `json:"pricingAvailable"` // 无定价数据的渠道视为最贵，排在最后
+}
+
+// SetPricingSource 设置 cheapest 策略使用的定价数据来源（nil 时所有渠道均视为无定价）
+func (s *ChannelScheduler) SetPricingSource(source PricingSource) {
+	s.pricingSource = source
+}
+
+// isCheapestLoadBalance 判断配置文件中的负载均衡策略是否为 cheapest
+func isCheapestLoadBalance(strategy string) bool {
+	return strategy == config.LoadBalanceCheapest
+}
+
+// cheapestEnabled 判断 Messages/Responses 渠道是否启用 cheapest 策略
+func (s *ChannelScheduler) cheapestEnabled(isResponses bool) bool {
+	if isResponses {
+		return isCheapestLoadBalance(s.configManager.GetResponsesLoadBalance())
+	}
+	return isCheapestLoadBalance(s.configManager.GetLoadBalance())
+}
+
+// rankByCost 按预估成本对候选渠道升序排序（稳定排序：成本相同时保持原有的健康/优先级顺序）
+// 成本 = 预估输入 token × 输入单价 + 预估输出 token × 输出单价；无 token 估算时按单 token 价格比较
+// 无定价数据（未设置请求模型、未配置定价来源或模型不在价格表中）的渠道视为最贵
+func (s *ChannelScheduler) rankByCost(
+	ctx context.Context,
+	candidates []ChannelInfo,
+	getUpstream func(index int) *config.UpstreamConfig,
+) ([]ChannelInfo, []ChannelCost) {
+	inputTokens, outputTokens := 0, 0
+	if estimator := tokenEstimatorFromContext(ctx); estimator != nil {
+		inputTokens, outputTokens = estimator()
+	}
+	if inputTokens <= 0 && outputTokens <= 0 {
+		inputTokens, outputTokens = 1, 1
+	}
+	requestModel := requestModelFromContext(ctx)
+
+	costs := make([]ChannelCost, len(candidates))
+	for i, ch := range candidates {
+		cost := ChannelCost{Index: ch.Index, Name: ch.Name, EstimatedCostUSD: math.Inf(1)}
+		if requestModel != "" {
+			cost.Model = requestModel
+			if upstream := getUpstream(ch.Index); upstream != nil {
+				cost.Model = config.RedirectModel(requestModel, upstream)
+			}
+			if s.pricingSource != nil {
+				if p := s.pricingSource.GetPricing(cost.Model); p != nil {
+					cost.PricingAvailable = true
+					cost.EstimatedCostUSD = float64(inputTokens)*p.InputCostPerToken + float64(outputTokens)*p.OutputCostPerToken
+				}
+			}
+		}
+		costs[i] = cost
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return costs[order[a]].EstimatedCostUSD < costs[order[b]].EstimatedCostUSD
+	})
+
+	ranked := make([]ChannelInfo, len(candidates))
+	rankedCosts := make([]ChannelCost, len(candidates))
+	for i, idx := range order {
+		ranked[i] = candidates[idx]
+		rankedCosts[i] = costs[idx]
+		if !rankedCosts[i].PricingAvailable {
+			// JSON 无法编码 +Inf，输出时以 -1 表示无定价
+			rankedCosts[i].EstimatedCostUSD = -1
+		}
+	}
+	return ranked, rankedCosts
+}
@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/pricing"
+)
+
+// fakePricingSource 测试用定价来源（USD/token）
+type fakePricingSource map[string]*pricing.ModelPricing
+
+func (f fakePricingSource) GetPricing(model string) *pricing.ModelPricing {
+	return f[model]
+}
+
+func newCheapestTestConfig() config.Config {
+	return config.Config{
+		LoadBalance:       config.LoadBalanceCheapest,
+		GeminiLoadBalance: config.LoadBalanceCheapest,
+		Upstream: []config.UpstreamConfig{
+			{Name: "unpriced", BaseURL: "https://unpriced.example.com", APIKeys: []string{"k0"}, Status: "active", Priority: 1,
+				ModelMapping: map[string]string{"claude-x": "mystery-model"}},
+			{Name: "expensive", BaseURL: "https://expensive.example.com", APIKeys: []string{"k1"}, Status: "active", Priority: 2,
+				ModelMapping: map[string]string{"claude-x": "opus"}},
+			{Name: "cheap", BaseURL: "https://cheap.example.com", APIKeys: []string{"k2"}, Status: "active", Priority: 3,
+				ModelMapping: map[string]string{"claude-x": "haiku"}},
+			{Name: "cheap-backup", BaseURL: "https://cheap-backup.example.com", APIKeys: []string{"k3"}, Status: "active", Priority: 4,
+				ModelMapping: map[string]string{"claude-x": "haiku"}},
+		},
+	}
+}
+
+var testPricing = fakePricingSource{
+	"opus":  {InputCostPerToken: 15e-6, OutputCostPerToken: 75e-6},
+	"haiku": {InputCostPerToken: 1e-6, OutputCostPerToken: 5e-6},
+}
+
+// TestSelectChannel_CheapestPrefersLowestCost 测试 cheapest 策略跨优先级选择最便宜的健康渠道
+func TestSelectChannel_CheapestPrefersLowestCost(t *testing.T) {
+	cfg := newCheapestTestConfig()
+	cfg.GeminiUpstream = cfg.Upstream
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	scheduler.SetPricingSource(testPricing)
+
+	ctx := WithTokenEstimator(WithRequestModel(context.Background(), "claude-x"), func() (int, int) { return 1000, 100 })
+
+	result, err := scheduler.SelectChannel(ctx, "", make(map[int]bool), false)
+	if err != nil {
+		t.Fatalf("SelectChannel 失败: %v", err)
+	}
+	// cheap 与 cheap-backup 成本相同，按原有优先级顺序选择 cheap
+	if result.ChannelIndex != 2 || result.Reason != "cheapest" {
+		t.Fatalf("选择 [%d] reason=%s, want [2] cheapest", result.ChannelIndex, result.Reason)
+	}
+
+	result, err = scheduler.SelectGeminiChannel(ctx, "", make(map[int]bool))
+	if err != nil || result.ChannelIndex != 2 || result.Reason != "cheapest" {
+		t.Fatalf("Gemini 选择 = %+v, err=%v, want [2] cheapest", result, err)
+	}
+
+	// 最便宜的渠道故障转移后，选择成本相同的下一个渠道
+	result, err = scheduler.SelectChannel(ctx, "", map[int]bool{2: true}, false)
+	if err != nil || result.ChannelIndex != 3 {
+		t.Fatalf("故障转移选择 = %+v, err=%v, want [3]", result, err)
+	}
+
+	// 只剩无定价渠道与昂贵渠道时，无定价渠道视为最贵
+	result, err = scheduler.SelectChannel(ctx, "", map[int]bool{2: true, 3: true}, false)
+	if err != nil || result.ChannelIndex != 1 {
+		t.Fatalf("选择 = %+v, err=%v, want [1] expensive", result, err)
+	}
+
+	// 跳过不健康的渠道
+	for i := 0; i < 10; i++ {
+		scheduler.messagesMetricsManager.RecordFailure("https://cheap.example.com", "k2")
+	}
+	result, err = scheduler.SelectChannel(ctx, "", make(map[int]bool), false)
+	if err != nil || result.ChannelIndex != 3 {
+		t.Fatalf("cheap 不健康时选择 = %+v, err=%v, want [3]", result, err)
+	}
+}
+
+// TestSelectChannel_FailoverIgnoresPricing 测试未启用 cheapest 时仍按优先级选择
+func TestSelectChannel_FailoverIgnoresPricing(t *testing.T) {
+	cfg := newCheapestTestConfig()
+	cfg.LoadBalance = "failover"
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	scheduler.SetPricingSource(testPricing)
+
+	result, err := scheduler.SelectChannel(WithRequestModel(context.Background(), "claude-x"), "", make(map[int]bool), false)
+	if err != nil || result.ChannelIndex != 0 || result.Reason == "cheapest" {
+		t.Fatalf("选择 = %+v, err=%v, want [0] 优先级顺序", result, err)
+	}
+}
+
+// TestPreviewChannelSelection_CostRanking 测试预览输出成本排序
+func TestPreviewChannelSelection_CostRanking(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, newCheapestTestConfig())
+	defer cleanup()
+	scheduler.SetPricingSource(testPricing)
+
+	ctx := WithTokenEstimator(WithRequestModel(context.Background(), "claude-x"), func() (int, int) { return 1000, 0 })
+	preview, err := scheduler.PreviewChannelSelection(ctx, "", make(map[int]bool), false)
+	if err != nil {
+		t.Fatalf("PreviewChannelSelection 失败: %v", err)
+	}
+	if preview.Strategy != LoadBalanceCheapest || preview.ChosenIndex != 2 {
+		t.Fatalf("strategy=%s chosen=%d, want cheapest [2]", preview.Strategy, preview.ChosenIndex)
+	}
+
+	wantOrder := []int{2, 3, 1, 0}
+	if len(preview.CostRanking) != len(wantOrder) {
+		t.Fatalf("costRanking 长度 = %d, want %d", len(preview.CostRanking), len(wantOrder))
+	}
+	for i, want := range wantOrder {
+		if preview.CostRanking[i].Index != want {
+			t.Fatalf("costRanking[%d] = [%d], want [%d]", i, preview.CostRanking[i].Index, want)
+		}
+	}
+	if got := preview.CostRanking[0]; got.Model != "haiku" || !got.PricingAvailable || got.EstimatedCostUSD != 1000*1e-6 {
+		t.Fatalf("cheap 成本 = %+v, want haiku $0.001", got)
+	}
+	if got := preview.CostRanking[3]; got.PricingAvailable || got.EstimatedCostUSD != -1 {
+		t.Fatalf("无定价渠道 = %+v, want pricingAvailable=false cost=-1", got)
+	}
+}
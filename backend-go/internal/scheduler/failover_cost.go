@@ -0,0 +1,180 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/pricing"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+// FailoverCostPair 主渠道 → 实际服务渠道的故障转移成本差汇总
+type FailoverCostPair struct {
+	PrimaryIndex int     `json:"primaryIndex"`
+	PrimaryName  string  `json:"primaryName"`
+	ServingIndex int     `json:"servingIndex"`
+	ServingName  string  `json:"servingName"`
+	Requests     int64   `json:"requests"`
+	CostDeltaUSD float64 `json:"costDeltaUsd"` // 正数为比主渠道多花费，负数为节省
+}
+
+// FailoverCostReport 故障转移成本差报告（进程内累计，重启后清零）
+type FailoverCostReport struct {
+	Since            time.Time          `json:"since"`
+	FailoverRequests int64              `json:"failoverRequests"` // 故障转移后成功的请求数
+	UnpricedRequests int64              `json:"unpricedRequests"` // 主渠道或服务渠道无定价数据、未计入成本差的请求数
+	SavingsUSD       float64            `json:"savingsUsd"`       // 转移到更便宜渠道节省的金额
+	OverspendUSD     float64            `json:"overspendUsd"`     // 转移到更贵渠道多花费的金额
+	NetDeltaUSD      float64            `json:"netDeltaUsd"`      // 净成本差（多花费 - 节省）
+	Pairs            []FailoverCostPair `json:"pairs"`
+}
+
+type failoverCostPairKey struct {
+	primaryIndex int
+	primaryName  string
+	servingIndex int
+	servingName  string
+}
+
+// failoverCostTracker 按接口类型（messages/responses/gemini）汇总故障转移成本差
+type failoverCostTracker struct {
+	mu      sync.Mutex
+	since   time.Time
+	reports map[string]*failoverCostReportState
+}
+
+type failoverCostReportState struct {
+	failoverRequests int64
+	unpricedRequests int64
+	savingsUSD       float64
+	overspendUSD     float64
+	pairs            map[failoverCostPairKey]*FailoverCostPair
+}
+
+func newFailoverCostTracker() *failoverCostTracker {
+	return &failoverCostTracker{
+		since:   time.Now(),
+		reports: make(map[string]*failoverCostReportState),
+	}
+}
+
+func (t *failoverCostTracker) record(namespace string, key failoverCostPairKey, delta float64, priced bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.reports[namespace]
+	if !ok {
+		state = &failoverCostReportState{pairs: make(map[failoverCostPairKey]*FailoverCostPair)}
+		t.reports[namespace] = state
+	}
+	state.failoverRequests++
+	if !priced {
+		state.unpricedRequests++
+		return
+	}
+	if delta < 0 {
+		state.savingsUSD -= delta
+	} else {
+		state.overspendUSD += delta
+	}
+
+	pair, ok := state.pairs[key]
+	if !ok {
+		pair = &FailoverCostPair{
+			PrimaryIndex: key.primaryIndex,
+			PrimaryName:  key.primaryName,
+			ServingIndex: key.servingIndex,
+			ServingName:  key.servingName,
+		}
+		state.pairs[key] = pair
+	}
+	pair.Requests++
+	pair.CostDeltaUSD += delta
+}
+
+func (t *failoverCostTracker) report(namespace string) FailoverCostReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := FailoverCostReport{Since: t.since, Pairs: []FailoverCostPair{}}
+	state, ok := t.reports[namespace]
+	if !ok {
+		return report
+	}
+	report.FailoverRequests = state.failoverRequests
+	report.UnpricedRequests = state.unpricedRequests
+	report.SavingsUSD = state.savingsUSD
+	report.OverspendUSD = state.overspendUSD
+	report.NetDeltaUSD = state.overspendUSD - state.savingsUSD
+	for _, pair := range state.pairs {
+		report.Pairs = append(report.Pairs, *pair)
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		a, b := report.Pairs[i], report.Pairs[j]
+		if a.PrimaryIndex != b.PrimaryIndex {
+			return a.PrimaryIndex < b.PrimaryIndex
+		}
+		return a.ServingIndex < b.ServingIndex
+	})
+	return report
+}
+
+// RecordFailoverCost 记录一次故障转移后成功的请求相对主渠道（本次请求首个选中的渠道）的成本差（namespace: messages/responses/gemini）
+// 两个渠道的成本均按实际 usage 与各自模型重定向后的模型价格计算；
+// 返回成本差（美元，正数为比主渠道多花费）以及两个渠道是否都有定价数据
+func (s *ChannelScheduler) RecordFailoverCost(
+	namespace string,
+	primaryIndex int,
+	primary *config.UpstreamConfig,
+	servingIndex int,
+	serving *config.UpstreamConfig,
+	model string,
+	usage *types.Usage,
+) (float64, bool) {
+	if primary == nil || serving == nil || primaryIndex == servingIndex || usage == nil {
+		return 0, false
+	}
+
+	primaryCost, primaryPriced := s.estimateUsageCost(primary, model, usage)
+	servingCost, servingPriced := s.estimateUsageCost(serving, model, usage)
+	priced := primaryPriced && servingPriced
+	delta := 0.0
+	if priced {
+		delta = servingCost - primaryCost
+	}
+
+	s.failoverCosts.record(namespace, failoverCostPairKey{
+		primaryIndex: primaryIndex,
+		primaryName:  primary.Name,
+		servingIndex: servingIndex,
+		servingName:  serving.Name,
+	}, delta, priced)
+	return delta, priced
+}
+
+// GetFailoverCostReport 获取故障转移成本差报告
+func (s *ChannelScheduler) GetFailoverCostReport(namespace string) FailoverCostReport {
+	return s.failoverCosts.report(namespace)
+}
+
+// estimateUsageCost 按渠道模型重定向后的模型价格估算 usage 的成本（美元）
+func (s *ChannelScheduler) estimateUsageCost(upstream *config.UpstreamConfig, model string, usage *types.Usage) (float64, bool) {
+	if s.pricingSource == nil || model == "" {
+		return 0, false
+	}
+	p := s.pricingSource.GetPricing(config.RedirectModel(model, upstream))
+	if p == nil {
+		return 0, false
+	}
+	return usageCostUSD(p, usage), true
+}
+
+// usageCostUSD 与 pricing.Service.Calculate 的计算方式一致，但保留美元精度（避免小请求取整为 0 美分）
+func usageCostUSD(p *pricing.ModelPricing, usage *types.Usage) float64 {
+	return float64(usage.InputTokens)*p.InputCostPerToken +
+		float64(usage.OutputTokens)*p.OutputCostPerToken +
+		float64(usage.CacheCreationInputTokens)*p.CacheCreationInputTokenCost +
+		float64(usage.CacheReadInputTokens)*p.CacheReadInputTokenCost
+}
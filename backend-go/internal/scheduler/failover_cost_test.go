@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+func newFailoverCostTestConfig() config.Config {
+	return config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "expensive", BaseURL: "https://expensive.example.com", APIKeys: []string{"k0"}, Status: "active", Priority: 1,
+				ModelMapping: map[string]string{"claude-x": "opus"}},
+			{Name: "cheap", BaseURL: "https://cheap.example.com", APIKeys: []string{"k1"}, Status: "active", Priority: 2,
+				ModelMapping: map[string]string{"claude-x": "haiku"}},
+			{Name: "unpriced", BaseURL: "https://unpriced.example.com", APIKeys: []string{"k2"}, Status: "active", Priority: 3,
+				ModelMapping: map[string]string{"claude-x": "mystery-model"}},
+		},
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-12
+}
+
+// failoverOnce 首个选中的渠道失败后故障转移，返回 (主渠道, 服务渠道)
+func failoverOnce(t *testing.T, scheduler *ChannelScheduler, failed map[int]bool) (*SelectionResult, *SelectionResult) {
+	t.Helper()
+	ctx := context.Background()
+	primary, err := scheduler.SelectChannel(ctx, "", failed, false)
+	if err != nil {
+		t.Fatalf("SelectChannel 失败: %v", err)
+	}
+	failed[primary.ChannelIndex] = true
+	serving, err := scheduler.SelectChannel(ctx, "", failed, false)
+	if err != nil {
+		t.Fatalf("SelectChannel 失败: %v", err)
+	}
+	return primary, serving
+}
+
+// TestRecordFailoverCost_CheaperAndMoreExpensiveChannels 测试故障转移成本差反映主渠道与服务渠道的价格差
+func TestRecordFailoverCost_CheaperAndMoreExpensiveChannels(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, newFailoverCostTestConfig())
+	defer cleanup()
+	scheduler.SetPricingSource(testPricing)
+
+	usage := &types.Usage{InputTokens: 1000, OutputTokens: 100}
+	opusCost := 1000*15e-6 + 100*75e-6
+	haikuCost := 1000*1e-6 + 100*5e-6
+
+	// expensive [0] 失败 → cheap [1]：节省
+	primary, serving := failoverOnce(t, scheduler, map[int]bool{})
+	if primary.ChannelIndex != 0 || serving.ChannelIndex != 1 {
+		t.Fatalf("故障转移路径 [%d]→[%d], want [0]→[1]", primary.ChannelIndex, serving.ChannelIndex)
+	}
+	delta, priced := scheduler.RecordFailoverCost("messages", primary.ChannelIndex, primary.Upstream, serving.ChannelIndex, serving.Upstream, "claude-x", usage)
+	if !priced || !almostEqual(delta, haikuCost-opusCost) {
+		t.Fatalf("成本差 = %v (priced=%v), want %v", delta, priced, haikuCost-opusCost)
+	}
+
+	// cheap [1] 为主渠道（expensive 已排除）失败 → unpriced [2]：无定价不计入成本差
+	primary, serving = failoverOnce(t, scheduler, map[int]bool{0: true})
+	if _, priced := scheduler.RecordFailoverCost("messages", primary.ChannelIndex, primary.Upstream, serving.ChannelIndex, serving.Upstream, "claude-x", usage); priced {
+		t.Fatal("服务渠道无定价时不应计入成本差")
+	}
+
+	// cheap [1] 失败 → expensive [0]：多花费
+	cheap, expensive := scheduler.getUpstreamByIndex(1, false), scheduler.getUpstreamByIndex(0, false)
+	delta, _ = scheduler.RecordFailoverCost("messages", 1, cheap, 0, expensive, "claude-x", usage)
+	if !almostEqual(delta, opusCost-haikuCost) {
+		t.Fatalf("成本差 = %v, want %v", delta, opusCost-haikuCost)
+	}
+	scheduler.RecordFailoverCost("messages", 0, expensive, 1, cheap, "claude-x", usage)
+
+	report := scheduler.GetFailoverCostReport("messages")
+	if report.FailoverRequests != 4 || report.UnpricedRequests != 1 {
+		t.Fatalf("failoverRequests=%d unpricedRequests=%d, want 4/1", report.FailoverRequests, report.UnpricedRequests)
+	}
+	diff := opusCost - haikuCost
+	if !almostEqual(report.SavingsUSD, 2*diff) || !almostEqual(report.OverspendUSD, diff) || !almostEqual(report.NetDeltaUSD, -diff) {
+		t.Fatalf("savings=%v overspend=%v net=%v", report.SavingsUSD, report.OverspendUSD, report.NetDeltaUSD)
+	}
+	if len(report.Pairs) != 2 {
+		t.Fatalf("pairs = %+v, want 2", report.Pairs)
+	}
+	if p := report.Pairs[0]; p.PrimaryIndex != 0 || p.ServingIndex != 1 || p.Requests != 2 || !almostEqual(p.CostDeltaUSD, -2*diff) {
+		t.Fatalf("pairs[0] = %+v", p)
+	}
+	if p := report.Pairs[1]; p.PrimaryIndex != 1 || p.ServingName != "expensive" || p.Requests != 1 || !almostEqual(p.CostDeltaUSD, diff) {
+		t.Fatalf("pairs[1] = %+v", p)
+	}
+
+	if other := scheduler.GetFailoverCostReport("responses"); other.FailoverRequests != 0 || len(other.Pairs) != 0 {
+		t.Fatalf("不同接口类型应分别统计，responses = %+v", other)
+	}
+}
+
+// TestRecordFailoverCost_IgnoresNonFailover 测试未发生故障转移或缺少 usage 时不记录
+func TestRecordFailoverCost_IgnoresNonFailover(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, newFailoverCostTestConfig())
+	defer cleanup()
+	scheduler.SetPricingSource(testPricing)
+
+	upstream := scheduler.getUpstreamByIndex(0, false)
+	other := scheduler.getUpstreamByIndex(1, false)
+	scheduler.RecordFailoverCost("messages", 0, upstream, 0, upstream, "claude-x", &types.Usage{InputTokens: 10})
+	scheduler.RecordFailoverCost("messages", 0, upstream, 1, other, "claude-x", nil)
+
+	if report := scheduler.GetFailoverCostReport("messages"); report.FailoverRequests != 0 {
+		t.Fatalf("failoverRequests = %d, want 0", report.FailoverRequests)
+	}
+}
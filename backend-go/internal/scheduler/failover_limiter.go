@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultFailoverSlotWait 故障转移等待并发槽位的默认最长时间
+const DefaultFailoverSlotWait = 10 * time.Second
+
+// FailoverLimiter 全局故障转移并发上限（信号量）
+// 大面积故障时所有进行中的请求会同时在渠道/Key 间扇出重试，形成惊群并加重上游故障。
+// 与 RetryBudget 限制重试速率不同，FailoverLimiter 限制同一时刻在途的故障转移尝试数。
+// 每个请求的首次尝试不占用槽位，仅故障转移产生的额外尝试需要获取槽位。
+type FailoverLimiter struct {
+	slots   chan struct{}
+	maxWait time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	acquired int64
+	rejected int64
+}
+
+// FailoverLimiterStats 故障转移并发统计
+type FailoverLimiterStats struct {
+	Enabled       bool  `json:"enabled"`
+	MaxConcurrent int   `json:"maxConcurrent"`
+	InFlight      int   `json:"inFlight"`
+	Peak          int   `json:"peak"` // 启动以来的在途峰值
+	Acquired      int64 `json:"acquired"`
+	Rejected      int64 `json:"rejected"`
+}
+
+// NewFailoverLimiter 创建故障转移并发限制器，maxConcurrent<=0 时不限制
+// maxWait 为等待槽位的最长时间（<=0 时使用默认值），超时视为拒绝
+func NewFailoverLimiter(maxConcurrent int, maxWait time.Duration) *FailoverLimiter {
+	if maxConcurrent <= 0 {
+		return &FailoverLimiter{}
+	}
+	if maxWait <= 0 {
+		maxWait = DefaultFailoverSlotWait
+	}
+	return &FailoverLimiter{
+		slots:   make(chan struct{}, maxConcurrent),
+		maxWait: maxWait,
+	}
+}
+
+// Enabled 是否启用了故障转移并发上限
+func (l *FailoverLimiter) Enabled() bool {
+	return l != nil && l.slots != nil
+}
+
+// Acquire 获取一个故障转移槽位，槽位已满时等待，直到超时或 ctx 取消
+// 返回 true 时调用方必须在本次尝试结束后调用 Release
+func (l *FailoverLimiter) Acquire(ctx context.Context) bool {
+	if !l.Enabled() {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		timer := time.NewTimer(l.maxWait)
+		defer timer.Stop()
+		select {
+		case l.slots <- struct{}{}:
+		case <-timer.C:
+			l.recordRejected()
+			return false
+		case <-ctx.Done():
+			l.recordRejected()
+			return false
+		}
+	}
+
+	l.mu.Lock()
+	l.inFlight++
+	l.peak = max(l.peak, l.inFlight)
+	l.acquired++
+	l.mu.Unlock()
+	return true
+}
+
+// Release 释放 Acquire 获取的槽位
+func (l *FailoverLimiter) Release() {
+	if !l.Enabled() {
+		return
+	}
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+	<-l.slots
+}
+
+// Stats 获取故障转移并发统计
+func (l *FailoverLimiter) Stats() FailoverLimiterStats {
+	if !l.Enabled() {
+		return FailoverLimiterStats{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return FailoverLimiterStats{
+		Enabled:       true,
+		MaxConcurrent: cap(l.slots),
+		InFlight:      l.inFlight,
+		Peak:          l.peak,
+		Acquired:      l.acquired,
+		Rejected:      l.rejected,
+	}
+}
+
+func (l *FailoverLimiter) recordRejected() {
+	l.mu.Lock()
+	l.rejected++
+	l.mu.Unlock()
+}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFailoverLimiter_DisabledIsUnlimited(t *testing.T) {
+	l := NewFailoverLimiter(0, 0)
+	if l.Enabled() {
+		t.Fatal("maxConcurrent=0 时不应启用")
+	}
+	for i := 0; i < 100; i++ {
+		if !l.Acquire(context.Background()) {
+			t.Fatal("未启用时 Acquire 应始终成功")
+		}
+	}
+	l.Release()
+	if stats := l.Stats(); stats.Enabled || stats.Acquired != 0 {
+		t.Fatalf("未启用时统计应为空，实际 %+v", stats)
+	}
+}
+
+// TestFailoverLimiter_ConcurrencyStaysWithinCap 模拟大量请求同时故障转移，在途重试数不超过上限
+func TestFailoverLimiter_ConcurrencyStaysWithinCap(t *testing.T) {
+	const maxConcurrent = 3
+	l := NewFailoverLimiter(maxConcurrent, 5*time.Second)
+
+	var inFlight, peak atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !l.Acquire(context.Background()) {
+				t.Error("等待时间充足时 Acquire 不应失败")
+				return
+			}
+			n := inFlight.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			inFlight.Add(-1)
+			l.Release()
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > maxConcurrent {
+		t.Fatalf("在途故障转移峰值 = %d，超过上限 %d", got, maxConcurrent)
+	}
+	stats := l.Stats()
+	if stats.Acquired != 50 || stats.Rejected != 0 || stats.InFlight != 0 {
+		t.Fatalf("统计不符: %+v", stats)
+	}
+	if stats.Peak > maxConcurrent || stats.MaxConcurrent != maxConcurrent {
+		t.Fatalf("峰值统计不符: %+v", stats)
+	}
+}
+
+func TestFailoverLimiter_RejectsOnTimeoutAndCancel(t *testing.T) {
+	l := NewFailoverLimiter(1, 20*time.Millisecond)
+	if !l.Acquire(context.Background()) {
+		t.Fatal("首个槽位应获取成功")
+	}
+
+	start := time.Now()
+	if l.Acquire(context.Background()) {
+		t.Fatal("槽位已满时应等待超时后拒绝")
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("应至少等待 maxWait，实际 %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if l.Acquire(ctx) {
+		t.Fatal("请求已取消时应拒绝")
+	}
+	if stats := l.Stats(); stats.Rejected != 2 || stats.InFlight != 1 {
+		t.Fatalf("统计不符: %+v", stats)
+	}
+
+	l.Release()
+	if !l.Acquire(context.Background()) {
+		t.Fatal("释放后应能重新获取槽位")
+	}
+	l.Release()
+}
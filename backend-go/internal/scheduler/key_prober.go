@@ -0,0 +1,278 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/httpclient"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+// keyProbeVersionSuffix BaseURL 已包含版本路径（如 /v1、/v1beta）时不再追加版本前缀
+var keyProbeVersionSuffix = regexp.MustCompile(`/v\d+[a-z]*$`)
+
+// KeyProbeResult 后台密钥健康探测的最近一次结果（用于仪表盘展示）
+type KeyProbeResult struct {
+	ChannelName string    `json:"channelName"`
+	BaseURL     string    `json:"baseUrl"`
+	KeyMask     string    `json:"keyMask"`
+	Success     bool      `json:"success"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	LatencyMs   int64     `json:"latencyMs"`
+	Error       string    `json:"error,omitempty"`
+	Recorded    bool      `json:"recorded"` // 是否计入熔断指标（探测端点不受支持等无法判定密钥状态的响应不计入）
+	ProbedAt    time.Time `json:"probedAt"`
+}
+
+// keyProber 后台密钥健康探测
+// 低流量渠道积累不到足够样本触发熔断，失效密钥会一直排在首位，每个真实请求都要先失败一次再故障转移。
+// 探测器定期向空闲渠道的首个密钥发送轻量请求（GET models），并将结果计入指标管理器，
+// 使熔断状态在没有真实流量时也能反映密钥实际可用性；近期有真实流量的渠道跳过探测以免浪费配额。
+type keyProber struct {
+	interval time.Duration
+	timeout  time.Duration
+
+	mu          sync.Mutex
+	results     map[string]KeyProbeResult // key: namespace:index:name
+	lastProbeAt map[string]time.Time      // 探测结果计入指标之后的时间，用于区分探测与真实流量
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	loopWg   sync.WaitGroup
+}
+
+func newKeyProber(interval, timeout time.Duration) *keyProber {
+	return &keyProber{
+		interval:    interval,
+		timeout:     timeout,
+		results:     make(map[string]KeyProbeResult),
+		lastProbeAt: make(map[string]time.Time),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// StartKeyProber 启动后台密钥健康探测（interval<=0 表示禁用）
+// timeout 为单次探测请求超时
+func (s *ChannelScheduler) StartKeyProber(interval, timeout time.Duration) {
+	if interval <= 0 || s.keyProber != nil {
+		return
+	}
+	p := newKeyProber(interval, timeout)
+	s.keyProber = p
+
+	p.loopWg.Add(1)
+	go func() {
+		defer p.loopWg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.probeIdleChannels(time.Now())
+			case <-p.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// StopKeyProber 停止后台密钥健康探测并等待进行中的探测结束（可重复调用）
+func (s *ChannelScheduler) StopKeyProber() {
+	p := s.keyProber
+	if p == nil {
+		return
+	}
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+	})
+	p.loopWg.Wait()
+}
+
+// GetKeyProbeResults 获取指定接口（messages/responses/gemini）各渠道最近一次探测结果（key: 渠道索引）
+// 渠道被删除或重排后，索引对应的渠道名不一致的旧结果不返回
+func (s *ChannelScheduler) GetKeyProbeResults(namespace string, upstreams []config.UpstreamConfig) map[int]KeyProbeResult {
+	p := s.keyProber
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	results := make(map[int]KeyProbeResult)
+	for i := range upstreams {
+		if result, ok := p.results[keyProbeKey(namespace, i, upstreams[i].Name)]; ok {
+			results[i] = result
+		}
+	}
+	return results
+}
+
+// probeIdleChannels 对所有空闲的活跃渠道并发执行一轮探测
+func (s *ChannelScheduler) probeIdleChannels(now time.Time) {
+	p := s.keyProber
+	cfg := s.configManager.GetConfig()
+	groups := []struct {
+		namespace      string
+		upstreams      []config.UpstreamConfig
+		metricsManager *metrics.MetricsManager
+	}{
+		{"messages", cfg.Upstream, s.messagesMetricsManager},
+		{"responses", cfg.ResponsesUpstream, s.responsesMetricsManager},
+		{"gemini", cfg.GeminiUpstream, s.geminiMetricsManager},
+	}
+
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		for i := range group.upstreams {
+			upstream := &group.upstreams[i]
+			if config.GetChannelStatus(upstream) != "active" || upstream.DisableKeyProbe {
+				continue
+			}
+			apiKey := topProbeKey(upstream)
+			baseURL := upstream.GetEffectiveBaseURL()
+			if apiKey == "" || baseURL == "" {
+				continue
+			}
+			key := keyProbeKey(group.namespace, i, upstream.Name)
+			if p.hasRecentTraffic(key, group.metricsManager, upstream, now) {
+				continue
+			}
+
+			wg.Add(1)
+			go func(namespace, key, baseURL, apiKey string, upstream *config.UpstreamConfig, metricsManager *metrics.MetricsManager) {
+				defer wg.Done()
+				result := p.probe(upstream, baseURL, apiKey)
+				if result.Recorded {
+					if result.Success {
+						metricsManager.RecordSuccess(baseURL, apiKey)
+					} else {
+						metricsManager.RecordFailure(baseURL, apiKey)
+					}
+				}
+				if !result.Success {
+					log.Printf("[KeyProbe] 警告: %s 渠道 %s 密钥 %s 探测失败: status=%d, error=%s",
+						namespace, upstream.Name, result.KeyMask, result.StatusCode, result.Error)
+				}
+
+				p.mu.Lock()
+				p.results[key] = result
+				p.lastProbeAt[key] = time.Now()
+				p.mu.Unlock()
+			}(group.namespace, key, baseURL, apiKey, upstream, group.metricsManager)
+		}
+	}
+	wg.Wait()
+}
+
+// hasRecentTraffic 渠道在最近一个探测间隔内是否有真实请求（探测本身计入的指标不算）
+func (p *keyProber) hasRecentTraffic(key string, metricsManager *metrics.MetricsManager, upstream *config.UpstreamConfig, now time.Time) bool {
+	var last time.Time
+	for _, baseURL := range upstream.GetAllBaseURLs() {
+		for _, apiKey := range upstream.APIKeys {
+			km := metricsManager.GetKeyMetrics(baseURL, apiKey)
+			if km == nil {
+				continue
+			}
+			if km.LastSuccessAt != nil && km.LastSuccessAt.After(last) {
+				last = *km.LastSuccessAt
+			}
+			if km.LastFailureAt != nil && km.LastFailureAt.After(last) {
+				last = *km.LastFailureAt
+			}
+		}
+	}
+
+	p.mu.Lock()
+	probedAt := p.lastProbeAt[key]
+	p.mu.Unlock()
+	return !last.IsZero() && now.Sub(last) < p.interval && last.After(probedAt)
+}
+
+// probe 使用指定密钥请求上游 models 端点
+// 2xx 计为成功；401/403/429/5xx 及网络错误计为失败；其他状态码（如端点不存在）无法判定密钥状态，不计入指标
+func (p *keyProber) probe(upstream *config.UpstreamConfig, baseURL, apiKey string) KeyProbeResult {
+	result := KeyProbeResult{
+		ChannelName: upstream.Name,
+		BaseURL:     baseURL,
+		KeyMask:     utils.MaskAPIKey(apiKey),
+		ProbedAt:    time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildKeyProbeURL(baseURL, upstream.ServiceType), nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if upstream.ServiceType == "gemini" {
+		utils.SetGeminiAuthenticationHeader(req.Header, apiKey)
+	} else {
+		utils.SetAuthenticationHeader(req.Header, apiKey)
+		if upstream.ServiceType == "claude" {
+			req.Header.Set("anthropic-version", "2023-06-01")
+		}
+	}
+	upstream.ApplyExtraHeaders(req.Header, apiKey)
+
+	client := httpclient.GetManager().GetStandardClient(p.timeout, upstream.InsecureSkipVerify, upstream.ProxyURL)
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		result.Recorded = true
+		return result
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		result.Success = true
+		result.Recorded = true
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden,
+		resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		result.Recorded = true
+	default:
+		result.Error = "探测端点响应无法判定密钥状态"
+	}
+	return result
+}
+
+// topProbeKey 渠道优先使用的密钥（第一个未排空的密钥）
+func topProbeKey(upstream *config.UpstreamConfig) string {
+	for _, apiKey := range upstream.APIKeys {
+		if !upstream.IsKeyDraining(apiKey) && !config.IsAPIKeyRef(apiKey) {
+			return apiKey
+		}
+	}
+	return ""
+}
+
+// buildKeyProbeURL 构建探测使用的 models 端点 URL（BaseURL 以 # 结尾表示不追加版本前缀）
+func buildKeyProbeURL(baseURL, serviceType string) string {
+	skipVersionPrefix := strings.HasSuffix(baseURL, "#")
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "#"), "/")
+	if skipVersionPrefix || keyProbeVersionSuffix.MatchString(baseURL) {
+		return baseURL + "/models"
+	}
+	if serviceType == "gemini" {
+		return baseURL + "/v1beta/models"
+	}
+	return baseURL + "/v1/models"
+}
+
+func keyProbeKey(namespace string, channelIndex int, name string) string {
+	return fmt.Sprintf("%s:%d:%s", namespace, channelIndex, name)
+}
@@ -0,0 +1,223 @@
+package scheduler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// newProbeServer 创建记录探测请求的上游，按密钥返回状态码（未配置的密钥返回 200）
+func newProbeServer(t *testing.T, statusByKey map[string]int) (*httptest.Server, *atomic.Int64, *sync.Map) {
+	t.Helper()
+	var hits atomic.Int64
+	var requests sync.Map // path -> header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		requests.Store(r.URL.Path, r.Header.Clone())
+		key := r.Header.Get("x-goog-api-key")
+		if key == "" {
+			key = r.Header.Get("x-api-key")
+		}
+		if key == "" && len(r.Header.Get("Authorization")) > len("Bearer ") {
+			key = r.Header.Get("Authorization")[len("Bearer "):]
+		}
+		if status, ok := statusByKey[key]; ok {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits, &requests
+}
+
+// TestKeyProber_RecordsDeadKeyOnIdleChannel 测试空闲渠道的失效密钥探测结果计入指标
+func TestKeyProber_RecordsDeadKeyOnIdleChannel(t *testing.T) {
+	srv, hits, _ := newProbeServer(t, map[string]int{"sk-dead": http.StatusUnauthorized})
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "dead", BaseURL: srv.URL, APIKeys: []string{"sk-dead", "sk-backup"}, ServiceType: "openai", Status: "active"},
+			{Name: "ok", BaseURL: srv.URL + "/v1", APIKeys: []string{"sk-ok"}, ServiceType: "openai", Status: "active"},
+		},
+	}
+	sch, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	sch.keyProber = newKeyProber(time.Minute, 2*time.Second)
+
+	sch.probeIdleChannels(time.Now())
+
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("应探测 2 个渠道的首个密钥，实际请求 %d 次", got)
+	}
+	dead := sch.messagesMetricsManager.GetKeyMetrics(srv.URL, "sk-dead")
+	if dead == nil || dead.FailureCount != 1 {
+		t.Fatalf("失效密钥应记录 1 次失败: %+v", dead)
+	}
+	if backup := sch.messagesMetricsManager.GetKeyMetrics(srv.URL, "sk-backup"); backup != nil && backup.RequestCount > 0 {
+		t.Fatalf("只应探测首个密钥")
+	}
+	ok := sch.messagesMetricsManager.GetKeyMetrics(srv.URL+"/v1", "sk-ok")
+	if ok == nil || ok.SuccessCount != 1 {
+		t.Fatalf("可用密钥应记录 1 次成功: %+v", ok)
+	}
+
+	results := sch.GetKeyProbeResults("messages", cfg.Upstream)
+	if r := results[0]; r.Success || r.StatusCode != http.StatusUnauthorized || !r.Recorded || r.ChannelName != "dead" {
+		t.Fatalf("渠道 0 探测结果不符合预期: %+v", r)
+	}
+	if r := results[1]; !r.Success || r.StatusCode != http.StatusOK {
+		t.Fatalf("渠道 1 探测结果不符合预期: %+v", r)
+	}
+
+	// 渠道重排后旧结果不应再对应到新的渠道
+	renamed := []config.UpstreamConfig{{Name: "other"}, cfg.Upstream[1]}
+	if _, exists := sch.GetKeyProbeResults("messages", renamed)[0]; exists {
+		t.Fatalf("渠道名不一致时不应返回旧的探测结果")
+	}
+}
+
+// TestKeyProber_SkipsChannelsWithRecentTraffic 测试近期有真实流量的渠道跳过探测，探测本身不算真实流量
+func TestKeyProber_SkipsChannelsWithRecentTraffic(t *testing.T) {
+	srv, hits, _ := newProbeServer(t, nil)
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "busy", BaseURL: srv.URL, APIKeys: []string{"sk-busy"}, ServiceType: "openai", Status: "active"},
+		},
+	}
+	sch, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	sch.keyProber = newKeyProber(time.Minute, 2*time.Second)
+
+	sch.messagesMetricsManager.RecordSuccess(srv.URL, "sk-busy")
+	sch.probeIdleChannels(time.Now())
+	if got := hits.Load(); got != 0 {
+		t.Fatalf("近期有真实流量的渠道不应探测，实际请求 %d 次", got)
+	}
+
+	// 真实流量超过一个探测间隔后恢复探测
+	sch.probeIdleChannels(time.Now().Add(2 * time.Minute))
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("空闲渠道应被探测，实际请求 %d 次", got)
+	}
+
+	// 上一轮探测计入的指标不视为真实流量
+	sch.probeIdleChannels(time.Now())
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("探测产生的指标不应阻止下一轮探测，实际请求 %d 次", got)
+	}
+}
+
+// TestKeyProber_RespectsChannelFlags 测试非活跃渠道与禁用探测的渠道不探测，无法判定的响应不计入指标
+func TestKeyProber_RespectsChannelFlags(t *testing.T) {
+	srv, hits, _ := newProbeServer(t, map[string]int{"sk-unsupported": http.StatusNotFound})
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "suspended", BaseURL: srv.URL, APIKeys: []string{"sk-a"}, ServiceType: "openai", Status: "suspended"},
+			{Name: "opted-out", BaseURL: srv.URL, APIKeys: []string{"sk-b"}, ServiceType: "openai", Status: "active", DisableKeyProbe: true},
+			{Name: "no-keys", BaseURL: srv.URL, ServiceType: "openai", Status: "active"},
+		},
+		ResponsesUpstream: []config.UpstreamConfig{
+			{Name: "unsupported", BaseURL: srv.URL, APIKeys: []string{"sk-unsupported"}, ServiceType: "responses", Status: "active"},
+		},
+	}
+	sch, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	sch.keyProber = newKeyProber(time.Minute, 2*time.Second)
+
+	sch.probeIdleChannels(time.Now())
+
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("只应探测 1 个渠道，实际请求 %d 次", got)
+	}
+	if km := sch.responsesMetricsManager.GetKeyMetrics(srv.URL, "sk-unsupported"); km != nil && km.RequestCount > 0 {
+		t.Fatalf("无法判定密钥状态的响应不应计入指标: %+v", km)
+	}
+	r, ok := sch.GetKeyProbeResults("responses", cfg.ResponsesUpstream)[0]
+	if !ok || r.Success || r.Recorded || r.StatusCode != http.StatusNotFound {
+		t.Fatalf("探测结果不符合预期: %+v (ok=%v)", r, ok)
+	}
+}
+
+// TestKeyProber_ProbeRequestPerServiceType 测试各服务类型的探测 URL 与认证头
+func TestKeyProber_ProbeRequestPerServiceType(t *testing.T) {
+	srv, _, requests := newProbeServer(t, nil)
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "claude", BaseURL: srv.URL, APIKeys: []string{"sk-ant-key"}, ServiceType: "claude", Status: "active"},
+		},
+		GeminiUpstream: []config.UpstreamConfig{
+			{Name: "gemini", BaseURL: srv.URL, APIKeys: []string{"gm-key"}, ServiceType: "gemini", Status: "active"},
+		},
+	}
+	sch, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+	sch.keyProber = newKeyProber(time.Minute, 2*time.Second)
+
+	sch.probeIdleChannels(time.Now())
+
+	v, ok := requests.Load("/v1/models")
+	if !ok {
+		t.Fatalf("claude 渠道应探测 /v1/models")
+	}
+	if h := v.(http.Header); h.Get("x-api-key") != "sk-ant-key" || h.Get("anthropic-version") == "" {
+		t.Fatalf("claude 探测请求头不符合预期: %v", h)
+	}
+	v, ok = requests.Load("/v1beta/models")
+	if !ok {
+		t.Fatalf("gemini 渠道应探测 /v1beta/models")
+	}
+	if h := v.(http.Header); h.Get("x-goog-api-key") != "gm-key" {
+		t.Fatalf("gemini 探测请求头不符合预期: %v", h)
+	}
+	if km := sch.geminiMetricsManager.GetKeyMetrics(srv.URL, "gm-key"); km == nil || km.SuccessCount != 1 {
+		t.Fatalf("gemini 探测结果应计入 Gemini 指标: %+v", km)
+	}
+}
+
+func TestBuildKeyProbeURL(t *testing.T) {
+	tests := []struct {
+		baseURL     string
+		serviceType string
+		want        string
+	}{
+		{"https://api.example.com", "openai", "https://api.example.com/v1/models"},
+		{"https://api.example.com/", "claude", "https://api.example.com/v1/models"},
+		{"https://api.example.com/v1", "openai", "https://api.example.com/v1/models"},
+		{"https://api.example.com/api/paas/v4", "openai", "https://api.example.com/api/paas/v4/models"},
+		{"https://api.example.com/custom#", "openai", "https://api.example.com/custom/models"},
+		{"https://generativelanguage.googleapis.com", "gemini", "https://generativelanguage.googleapis.com/v1beta/models"},
+	}
+	for _, tt := range tests {
+		if got := buildKeyProbeURL(tt.baseURL, tt.serviceType); got != tt.want {
+			t.Errorf("buildKeyProbeURL(%q, %q) = %q, want %q", tt.baseURL, tt.serviceType, got, tt.want)
+		}
+	}
+}
+
+// TestKeyProber_StartStop 测试后台探测循环启动后按间隔执行并可重复停止
+func TestKeyProber_StartStop(t *testing.T) {
+	srv, hits, _ := newProbeServer(t, nil)
+	cfg := config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "idle", BaseURL: srv.URL, APIKeys: []string{"sk-idle"}, ServiceType: "openai", Status: "active"},
+		},
+	}
+	sch, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+
+	sch.StartKeyProber(50*time.Millisecond, time.Second)
+	deadline := time.Now().Add(2 * time.Second)
+	for hits.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sch.StopKeyProber()
+	sch.StopKeyProber()
+	if hits.Load() == 0 {
+		t.Fatalf("后台探测循环应至少执行一轮")
+	}
+}
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+// KeyQuotaStatus 密钥当日配额使用情况（仪表盘展示）
+type KeyQuotaStatus struct {
+	KeyMask           string    `json:"keyMask"`
+	Requests          int64     `json:"requests"`
+	Tokens            int64     `json:"tokens"`
+	RequestLimit      int64     `json:"requestLimit,omitempty"`
+	TokenLimit        int64     `json:"tokenLimit,omitempty"`
+	RemainingRequests *int64    `json:"remainingRequests,omitempty"` // 未设置请求上限时不返回
+	RemainingTokens   *int64    `json:"remainingTokens,omitempty"`   // 未设置 Token 上限时不返回
+	Exhausted         bool      `json:"exhausted"`
+	ResetAt           time.Time `json:"resetAt"` // 下一个本地零点
+}
+
+// GetKeyDailyUsage 实现 config.KeyUsageSource：汇总密钥在渠道所有 BaseURL 上自本地零点以来的用量
+func (s *ChannelScheduler) GetKeyDailyUsage(namespace string, upstream *config.UpstreamConfig, apiKey string) config.KeyDailyUsage {
+	return keyDailyUsage(s.metricsManagerFor(namespace), upstream, apiKey, startOfLocalDay(time.Now()))
+}
+
+// GetKeyQuotaStatus 获取渠道各密钥的当日配额使用情况（未配置配额时返回 nil）
+func (s *ChannelScheduler) GetKeyQuotaStatus(namespace string, upstream *config.UpstreamConfig) []KeyQuotaStatus {
+	if !upstream.HasDailyKeyQuota() {
+		return nil
+	}
+	metricsManager := s.metricsManagerFor(namespace)
+	now := time.Now()
+	dayStart := startOfLocalDay(now)
+	resetAt := dayStart.AddDate(0, 0, 1)
+
+	result := make([]KeyQuotaStatus, 0, len(upstream.APIKeys))
+	for _, apiKey := range upstream.APIKeys {
+		if apiKey == "" || config.IsAPIKeyRef(apiKey) {
+			continue
+		}
+		usage := keyDailyUsage(metricsManager, upstream, apiKey, dayStart)
+		status := KeyQuotaStatus{
+			KeyMask:      utils.MaskAPIKey(apiKey),
+			Requests:     usage.Requests,
+			Tokens:       usage.Tokens,
+			RequestLimit: upstream.DailyRequestLimit,
+			TokenLimit:   upstream.DailyTokenLimit,
+			Exhausted:    upstream.IsDailyKeyQuotaExhausted(usage),
+			ResetAt:      resetAt,
+		}
+		if upstream.DailyRequestLimit > 0 {
+			remaining := max(upstream.DailyRequestLimit-usage.Requests, 0)
+			status.RemainingRequests = &remaining
+		}
+		if upstream.DailyTokenLimit > 0 {
+			remaining := max(upstream.DailyTokenLimit-usage.Tokens, 0)
+			status.RemainingTokens = &remaining
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+func (s *ChannelScheduler) metricsManagerFor(namespace string) *metrics.MetricsManager {
+	switch namespace {
+	case "responses":
+		return s.responsesMetricsManager
+	case "gemini":
+		return s.geminiMetricsManager
+	default:
+		return s.messagesMetricsManager
+	}
+}
+
+func keyDailyUsage(metricsManager *metrics.MetricsManager, upstream *config.UpstreamConfig, apiKey string, since time.Time) config.KeyDailyUsage {
+	var usage config.KeyDailyUsage
+	for _, baseURL := range upstream.GetAllBaseURLs() {
+		requests, tokens := metricsManager.GetKeyUsageSince(baseURL, apiKey, since)
+		usage.Requests += requests
+		usage.Tokens += tokens
+	}
+	return usage
+}
+
+// startOfLocalDay 返回本地日历日的零点
+func startOfLocalDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
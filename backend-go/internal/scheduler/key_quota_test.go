@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+// TestGetKeyDailyUsage 测试密钥当日用量：汇总所有 BaseURL，各接口类型独立
+func TestGetKeyDailyUsage(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, config.Config{})
+	defer cleanup()
+
+	upstream := &config.UpstreamConfig{
+		Name: "a", BaseURLs: []string{"https://a1.example.com", "https://a2.example.com"}, APIKeys: []string{"k1", "k2"},
+		DailyRequestLimit: 3, DailyTokenLimit: 1000,
+	}
+	mm := scheduler.messagesMetricsManager
+	mm.RecordSuccessWithUsage("https://a1.example.com", "k1", &types.Usage{InputTokens: 100, OutputTokens: 50, CacheReadInputTokens: 500}, "m", 0)
+	mm.RecordSuccessWithUsage("https://a2.example.com", "k1", &types.Usage{InputTokens: 200, OutputTokens: 10}, "m", 0)
+	mm.RecordFailure("https://a1.example.com", "k1")
+
+	usage := scheduler.GetKeyDailyUsage("messages", upstream, "k1")
+	if usage.Requests != 3 || usage.Tokens != 360 {
+		t.Fatalf("k1 usage = %+v, want 3 requests / 360 tokens", usage)
+	}
+	if usage := scheduler.GetKeyDailyUsage("responses", upstream, "k1"); usage.Requests != 0 {
+		t.Fatalf("responses usage should be independent: %+v", usage)
+	}
+
+	statuses := scheduler.GetKeyQuotaStatus("messages", upstream)
+	if len(statuses) != 2 {
+		t.Fatalf("statuses = %+v, want 2 keys", statuses)
+	}
+	k1, k2 := statuses[0], statuses[1]
+	if !k1.Exhausted || *k1.RemainingRequests != 0 || *k1.RemainingTokens != 640 {
+		t.Fatalf("k1 status = %+v", k1)
+	}
+	if k2.Exhausted || *k2.RemainingRequests != 3 || *k2.RemainingTokens != 1000 {
+		t.Fatalf("k2 status = %+v", k2)
+	}
+	wantReset := startOfLocalDay(time.Now()).AddDate(0, 0, 1)
+	if !k1.ResetAt.Equal(wantReset) {
+		t.Fatalf("resetAt = %v, want %v", k1.ResetAt, wantReset)
+	}
+
+	if statuses := scheduler.GetKeyQuotaStatus("messages", &config.UpstreamConfig{APIKeys: []string{"k1"}}); statuses != nil {
+		t.Fatalf("channel without quota should return nil, got %+v", statuses)
+	}
+}
@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"errors"
+	"log"
+	"slices"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
+)
+
+var (
+	// ErrChannelNotFound 渠道索引无效
+	ErrChannelNotFound = errors.New("渠道不存在")
+	// ErrKeyNotInChannel 密钥不属于该渠道
+	ErrKeyNotInChannel = errors.New("API密钥不存在")
+)
+
+// KeyMetricsReset 单个 BaseURL 下 Key 指标的重置结果
+type KeyMetricsReset struct {
+	BaseURL    string `json:"baseUrl"`
+	MetricsKey string `json:"metricsKey"`
+	Reset      bool   `json:"reset"` // false 表示该 BaseURL 下尚无该 Key 的指标记录
+}
+
+// ResetChannelKeyMetrics 仅重置渠道中单个 Key 在所有 BaseURL 上的指标（含熔断状态），其他 Key 的历史保持不变
+// namespace: messages/responses/gemini；密钥须属于该渠道（含排空中的密钥）
+func (s *ChannelScheduler) ResetChannelKeyMetrics(namespace string, channelIndex int, apiKey string) ([]KeyMetricsReset, error) {
+	var upstream *config.UpstreamConfig
+	if namespace == "gemini" {
+		upstream = s.getGeminiUpstreamByIndex(channelIndex)
+	} else {
+		upstream = s.getUpstreamByIndex(channelIndex, namespace == "responses")
+	}
+	if upstream == nil {
+		return nil, ErrChannelNotFound
+	}
+	apiKey = s.configManager.ResolveAPIKeyRef(apiKey)
+	if _, draining := upstream.DrainingKeys[apiKey]; !draining && !slices.Contains(upstream.APIKeys, apiKey) {
+		return nil, ErrKeyNotInChannel
+	}
+
+	metricsManager := s.messagesMetricsManager
+	switch namespace {
+	case "responses":
+		metricsManager = s.responsesMetricsManager
+	case "gemini":
+		metricsManager = s.geminiMetricsManager
+	}
+
+	// BaseURL 可能被单独设置而不在 BaseURLs 中，两者合并去重
+	baseURLs := upstream.GetAllBaseURLs()
+	if upstream.BaseURL != "" && !slices.Contains(baseURLs, upstream.BaseURL) {
+		baseURLs = append([]string{upstream.BaseURL}, baseURLs...)
+	}
+
+	results := make([]KeyMetricsReset, 0, len(baseURLs))
+	for _, baseURL := range baseURLs {
+		metricsKey, reset := metricsManager.ResetKey(baseURL, apiKey)
+		results = append(results, KeyMetricsReset{BaseURL: baseURL, MetricsKey: metricsKey, Reset: reset})
+	}
+	log.Printf("[Scheduler-KeyReset] %s 渠道 [%d] %s 的 Key %s 指标已重置（%d 个 BaseURL）",
+		namespace, channelIndex, upstream.Name, utils.MaskAPIKey(apiKey), len(baseURLs))
+	return results, nil
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// TestResetChannelKeyMetrics_OnlyResetsTargetKey 测试单 Key 重置覆盖渠道所有 BaseURL，且不影响同渠道其他 Key
+func TestResetChannelKeyMetrics_OnlyResetsTargetKey(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "m0", BaseURL: "https://m0.example.com", APIKeys: []string{"k0"}, Status: "active"},
+		},
+		GeminiUpstream: []config.UpstreamConfig{
+			{Name: "g0", BaseURLs: []string{"https://g0-a.example.com", "https://g0-b.example.com"}, APIKeys: []string{"k1", "k2"}, Status: "active"},
+		},
+	})
+	defer cleanup()
+
+	gm := scheduler.GetGeminiMetricsManager()
+	for _, baseURL := range []string{"https://g0-a.example.com", "https://g0-b.example.com"} {
+		for _, key := range []string{"k1", "k2"} {
+			gm.RecordFailure(baseURL, key)
+			gm.RecordFailure(baseURL, key)
+		}
+	}
+
+	results, err := scheduler.ResetChannelKeyMetrics("gemini", 0, "k1")
+	if err != nil {
+		t.Fatalf("ResetChannelKeyMetrics 失败: %v", err)
+	}
+	if len(results) != 2 || !results[0].Reset || !results[1].Reset || results[0].MetricsKey == results[1].MetricsKey {
+		t.Fatalf("results = %+v, want 2 distinct reset entries", results)
+	}
+	for _, baseURL := range []string{"https://g0-a.example.com", "https://g0-b.example.com"} {
+		if km := gm.GetKeyMetrics(baseURL, "k1"); km == nil || km.FailureCount != 0 || km.ConsecutiveFailures != 0 {
+			t.Fatalf("k1@%s 未被重置: %+v", baseURL, km)
+		}
+		if km := gm.GetKeyMetrics(baseURL, "k2"); km == nil || km.FailureCount != 2 {
+			t.Fatalf("k2@%s 不应被重置: %+v", baseURL, km)
+		}
+	}
+
+	// 尚无指标记录的 Key 返回 reset=false
+	results, err = scheduler.ResetChannelKeyMetrics("messages", 0, "k0")
+	if err != nil || len(results) != 1 || results[0].Reset || results[0].BaseURL != "https://m0.example.com" {
+		t.Fatalf("results = %+v, err = %v", results, err)
+	}
+}
+
+func TestResetChannelKeyMetrics_Errors(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, config.Config{
+		ResponsesUpstream: []config.UpstreamConfig{
+			{Name: "r0", BaseURL: "https://r0.example.com", APIKeys: []string{"k0"}, Status: "active"},
+		},
+	})
+	defer cleanup()
+
+	if _, err := scheduler.ResetChannelKeyMetrics("responses", 5, "k0"); !errors.Is(err, ErrChannelNotFound) {
+		t.Fatalf("err = %v, want ErrChannelNotFound", err)
+	}
+	if _, err := scheduler.ResetChannelKeyMetrics("responses", 0, "other"); !errors.Is(err, ErrKeyNotInChannel) {
+		t.Fatalf("err = %v, want ErrKeyNotInChannel", err)
+	}
+}
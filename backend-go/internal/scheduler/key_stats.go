@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+)
+
+// RecordKeyLatency 记录 Key 收到成功响应头的延迟
+func (s *ChannelScheduler) RecordKeyLatency(baseURL, apiKey string, latency time.Duration, isResponses bool) {
+	s.getMetricsManager(isResponses).RecordKeyLatency(baseURL, apiKey, latency)
+}
+
+// RecordStreamTiming 记录成功流式请求的首 token 延迟与总耗时
+func (s *ChannelScheduler) RecordStreamTiming(baseURL, apiKey string, firstToken, duration time.Duration, outputTokens int, isResponses bool) {
+	s.getMetricsManager(isResponses).RecordStreamTiming(baseURL, apiKey, firstToken, duration, outputTokens)
+}
+
+// RecordGeminiKeyLatency 记录 Gemini Key 收到成功响应头的延迟
+func (s *ChannelScheduler) RecordGeminiKeyLatency(baseURL, apiKey string, latency time.Duration) {
+	s.geminiMetricsManager.RecordKeyLatency(baseURL, apiKey, latency)
+}
+
+// GetKeyStats 实现 config.KeyStatsSource：汇总密钥在渠道所有 BaseURL 上的近期表现
+// 只读取熔断状态而不推进（半开探测名额仍由处理器中的 ShouldSuspendKey 分配）
+func (s *ChannelScheduler) GetKeyStats(namespace string, upstream *config.UpstreamConfig, apiKey string) config.KeyStats {
+	metricsManager := s.metricsManagerFor(namespace)
+
+	baseURLs := upstream.GetAllBaseURLs()
+	stats := config.KeyStats{Suspended: len(baseURLs) > 0}
+	var successSum, latencySum float64
+	latencyCount := 0
+	for _, baseURL := range baseURLs {
+		if metricsManager.GetChannelCircuitState(baseURL, []string{apiKey}) != metrics.CircuitOpen {
+			stats.Suspended = false
+		}
+		successSum += 1 - metricsManager.CalculateKeyFailureRate(baseURL, apiKey)
+		if km := metricsManager.GetKeyMetrics(baseURL, apiKey); km != nil && km.AvgLatencyMs > 0 {
+			latencySum += km.AvgLatencyMs
+			latencyCount++
+		}
+	}
+
+	stats.SuccessRate = 1
+	if len(baseURLs) > 0 {
+		stats.SuccessRate = successSum / float64(len(baseURLs))
+	}
+	if latencyCount > 0 {
+		stats.AvgLatency = time.Duration(latencySum / float64(latencyCount) * float64(time.Millisecond))
+	}
+	return stats
+}
@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// TestGetKeyStats 测试密钥指标汇总：成功率、延迟与熔断状态
+func TestGetKeyStats(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, config.Config{})
+	defer cleanup()
+
+	upstream := &config.UpstreamConfig{Name: "a", BaseURL: "https://a.example.com", APIKeys: []string{"k1", "k2"}}
+
+	if stats := scheduler.GetKeyStats("messages", upstream, "k1"); stats.Suspended || stats.SuccessRate != 1 || stats.AvgLatency != 0 {
+		t.Fatalf("无数据时 = %+v, want 成功率 1、无延迟、未熔断", stats)
+	}
+
+	mm := scheduler.messagesMetricsManager
+	mm.RecordKeyLatency("https://a.example.com", "k1", 100*time.Millisecond)
+	mm.RecordKeyLatency("https://a.example.com", "k1", 200*time.Millisecond)
+	mm.RecordSuccess("https://a.example.com", "k1")
+	mm.RecordFailure("https://a.example.com", "k1")
+	stats := scheduler.GetKeyStats("messages", upstream, "k1")
+	if stats.SuccessRate != 0.5 || stats.AvgLatency != 120*time.Millisecond || stats.Suspended {
+		t.Fatalf("k1 = %+v, want 成功率 0.5、延迟 120ms（EWMA）", stats)
+	}
+
+	// 各接口类型的指标相互独立
+	if stats := scheduler.GetKeyStats("responses", upstream, "k1"); stats.AvgLatency != 0 {
+		t.Fatalf("responses 指标不应包含 messages 数据: %+v", stats)
+	}
+
+	for i := 0; i < 10; i++ {
+		mm.RecordFailure("https://a.example.com", "k2")
+	}
+	if stats := scheduler.GetKeyStats("messages", upstream, "k2"); !stats.Suspended {
+		t.Fatalf("k2 应处于熔断状态: %+v", stats)
+	}
+}
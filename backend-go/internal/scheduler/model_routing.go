@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// ErrCodeNoChannelForModel 没有渠道支持请求模型时的错误码
+const ErrCodeNoChannelForModel = "NO_CHANNEL_FOR_MODEL"
+
+// NoChannelForModelError 所有活跃渠道均不支持请求的模型
+type NoChannelForModelError struct {
+	Model string
+}
+
+func (e *NoChannelForModelError) Error() string {
+	return fmt.Sprintf("%s: 没有渠道支持模型 %s", ErrCodeNoChannelForModel, e.Model)
+}
+
+// AsNoChannelForModelError 判断错误是否为模型无可用渠道错误
+func AsNoChannelForModelError(err error) (*NoChannelForModelError, bool) {
+	var target *NoChannelForModelError
+	if errors.As(err, &target) {
+		return target, true
+	}
+	return nil, false
+}
+
+// filterChannelsByModel 过滤掉不支持请求模型的渠道（未配置 SupportedModels 的渠道视为通配）
+// model 为空时不过滤
+func filterChannelsByModel(
+	channels []ChannelInfo,
+	model string,
+	getUpstream func(index int) *config.UpstreamConfig,
+) []ChannelInfo {
+	if model == "" {
+		return channels
+	}
+
+	filtered := make([]ChannelInfo, 0, len(channels))
+	for _, ch := range channels {
+		upstream := getUpstream(ch.Index)
+		if upstream == nil || !upstream.SupportsModel(model) {
+			continue
+		}
+		filtered = append(filtered, ch)
+	}
+	return filtered
+}
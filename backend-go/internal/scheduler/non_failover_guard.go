@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// nonFailoverSample 渠道一次请求的最终结果
+type nonFailoverSample struct {
+	at    time.Time
+	error bool // true=非故障转移错误（已直接返回给客户端）
+}
+
+// nonFailoverGuard 渠道非故障转移错误率检测
+// 非故障转移错误（如渠道配置错误导致的持续 400）会原样返回给客户端，不触发熔断与故障转移，
+// 渠道因此被反复选中并持续让客户端请求失败。窗口内样本数达到 minRequests 且非故障转移错误占比
+// 达到 rate 时判定渠道配置损坏，由调度器将其暂停。
+type nonFailoverGuard struct {
+	mu          sync.Mutex
+	rate        float64
+	minRequests int
+	window      time.Duration
+
+	samples   map[string][]nonFailoverSample // key: namespace:index:name
+	lastPrune time.Time
+}
+
+func newNonFailoverGuard(rate float64, minRequests int, window time.Duration) *nonFailoverGuard {
+	return &nonFailoverGuard{
+		rate:        rate,
+		minRequests: minRequests,
+		window:      window,
+		samples:     make(map[string][]nonFailoverSample),
+	}
+}
+
+// record 记录一次请求结果，错误率达到阈值时返回 true 并清空该渠道的样本（避免重复触发）
+func (g *nonFailoverGuard) record(key string, isError bool, now time.Time) (bool, float64, int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.pruneLocked(now)
+
+	samples := recentNonFailoverSamples(g.samples[key], now.Add(-g.window))
+	samples = append(samples, nonFailoverSample{at: now, error: isError})
+	g.samples[key] = samples
+
+	if len(samples) < g.minRequests {
+		return false, 0, len(samples)
+	}
+	errors := 0
+	for _, s := range samples {
+		if s.error {
+			errors++
+		}
+	}
+	rate := float64(errors) / float64(len(samples))
+	if rate < g.rate {
+		return false, rate, len(samples)
+	}
+	delete(g.samples, key)
+	return true, rate, len(samples)
+}
+
+// pruneLocked 定期清理已过期的渠道样本（调用方需持有锁）
+func (g *nonFailoverGuard) pruneLocked(now time.Time) {
+	if now.Sub(g.lastPrune) < g.window {
+		return
+	}
+	g.lastPrune = now
+
+	cutoff := now.Add(-g.window)
+	for key, samples := range g.samples {
+		if samples = recentNonFailoverSamples(samples, cutoff); len(samples) == 0 {
+			delete(g.samples, key)
+		} else {
+			g.samples[key] = samples
+		}
+	}
+}
+
+// recentNonFailoverSamples 过滤出 cutoff 之后的样本（输入按时间升序）
+func recentNonFailoverSamples(samples []nonFailoverSample, cutoff time.Time) []nonFailoverSample {
+	for i, s := range samples {
+		if s.at.After(cutoff) {
+			return samples[i:]
+		}
+	}
+	return samples[:0]
+}
+
+// SetNonFailoverSuspension 设置非故障转移错误率自动暂停（rate<=0 表示禁用）
+// 渠道在 window 内至少 minRequests 次请求、且非故障转移错误占比达到 rate 时自动暂停
+func (s *ChannelScheduler) SetNonFailoverSuspension(rate float64, minRequests int, window time.Duration) {
+	if rate <= 0 || minRequests <= 0 || window <= 0 {
+		s.nonFailoverGuard = nil
+		return
+	}
+	s.nonFailoverGuard = newNonFailoverGuard(min(rate, 1), minRequests, window)
+}
+
+// RecordChannelResult 记录渠道一次请求的最终结果（namespace: messages/responses/gemini）
+// nonFailoverError 为 true 表示上游错误未触发故障转移而直接返回给客户端；成功响应传 false。
+// 非故障转移错误率持续过高时暂停渠道（状态置为 suspended），修复配置后需手动恢复；
+// 渠道是该接口唯一的活跃渠道时只告警不暂停，避免所有请求都无渠道可用
+func (s *ChannelScheduler) RecordChannelResult(namespace string, channelIndex int, upstream *config.UpstreamConfig, nonFailoverError bool) {
+	guard := s.nonFailoverGuard
+	if guard == nil || upstream == nil {
+		return
+	}
+
+	key := fmt.Sprintf("%s:%d:%s", namespace, channelIndex, upstream.Name)
+	triggered, rate, samples := guard.record(key, nonFailoverError, time.Now())
+	if !triggered {
+		return
+	}
+
+	var current *config.UpstreamConfig
+	var activeCount int
+	if namespace == "gemini" {
+		current = s.getGeminiUpstreamByIndex(channelIndex)
+		activeCount = s.GetActiveGeminiChannelCount()
+	} else {
+		current = s.getUpstreamByIndex(channelIndex, namespace == "responses")
+		activeCount = s.GetActiveChannelCount(namespace == "responses")
+	}
+	if current == nil || current.Name != upstream.Name {
+		return // 渠道已被删除或重排，索引不再指向该渠道
+	}
+	if activeCount <= 1 {
+		log.Printf("[Scheduler-NonFailover] 警告: %s 渠道 [%d] %s 非故障转移错误率 %.0f%%（%d 次请求），但为唯一活跃渠道，不自动暂停",
+			namespace, channelIndex, upstream.Name, rate*100, samples)
+		return
+	}
+
+	var err error
+	switch namespace {
+	case "responses":
+		err = s.configManager.SetResponsesChannelStatus(channelIndex, "suspended")
+	case "gemini":
+		err = s.configManager.SetGeminiChannelStatus(channelIndex, "suspended")
+	default:
+		err = s.configManager.SetChannelStatus(channelIndex, "suspended")
+	}
+	if err != nil {
+		log.Printf("[Scheduler-NonFailover] 警告: 暂停 %s 渠道 [%d] %s 失败: %v", namespace, channelIndex, upstream.Name, err)
+		return
+	}
+	log.Printf("[Scheduler-NonFailover] 警告: %s 渠道 [%d] %s 非故障转移错误率 %.0f%%（%d 次请求），疑似渠道配置错误，已自动暂停",
+		namespace, channelIndex, upstream.Name, rate*100, samples)
+}
@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+)
+
+// TestNonFailoverGuard_Threshold 测试样本数与错误占比均达到阈值时才触发
+func TestNonFailoverGuard_Threshold(t *testing.T) {
+	g := newNonFailoverGuard(0.8, 5, time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 4; i++ {
+		if triggered, _, _ := g.record("messages:0:a", true, now); triggered {
+			t.Fatalf("第 %d 次记录不应触发（样本不足）", i+1)
+		}
+	}
+	triggered, rate, samples := g.record("messages:0:a", true, now)
+	if !triggered || rate != 1 || samples != 5 {
+		t.Fatalf("第 5 次错误应触发: triggered=%v rate=%v samples=%d", triggered, rate, samples)
+	}
+	if _, ok := g.samples["messages:0:a"]; ok {
+		t.Fatalf("触发后应清空该渠道样本")
+	}
+
+	// 成功请求拉低错误占比：4 错 2 成功 = 67% < 80%
+	for i := 0; i < 4; i++ {
+		g.record("messages:1:b", true, now)
+	}
+	g.record("messages:1:b", false, now)
+	if triggered, _, _ := g.record("messages:1:b", false, now); triggered {
+		t.Fatalf("错误占比低于阈值不应触发")
+	}
+
+	// 窗口外的样本不计入
+	old := now.Add(-2 * time.Minute)
+	for i := 0; i < 4; i++ {
+		g.record("gemini:0:c", true, old)
+	}
+	if triggered, _, samples := g.record("gemini:0:c", true, now); triggered || samples != 1 {
+		t.Fatalf("过期样本应被丢弃: triggered=%v samples=%d", triggered, samples)
+	}
+}
+
+func nonFailoverTestConfig() config.Config {
+	return config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "broken", BaseURL: "https://broken.example.com", APIKeys: []string{"k1"}, Status: "active", Priority: 1},
+			{Name: "healthy", BaseURL: "https://healthy.example.com", APIKeys: []string{"k2"}, Status: "active", Priority: 2},
+		},
+	}
+}
+
+// TestRecordChannelResult_SuspendsBrokenChannel 测试持续非故障转移错误的渠道被自动暂停
+func TestRecordChannelResult_SuspendsBrokenChannel(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, nonFailoverTestConfig())
+	defer cleanup()
+	scheduler.SetNonFailoverSuspension(0.8, 5, time.Minute)
+
+	broken := scheduler.configManager.GetConfig().Upstream[0]
+	for i := 0; i < 5; i++ {
+		scheduler.RecordChannelResult("messages", 0, &broken, true)
+	}
+
+	cfg := scheduler.configManager.GetConfig()
+	if cfg.Upstream[0].Status != "suspended" {
+		t.Fatalf("渠道 [0] 状态 = %q, want suspended", cfg.Upstream[0].Status)
+	}
+	if cfg.Upstream[1].Status != "active" {
+		t.Fatalf("渠道 [1] 不应受影响: %q", cfg.Upstream[1].Status)
+	}
+	result, err := scheduler.SelectChannel(context.Background(), "", map[int]bool{}, false)
+	if err != nil {
+		t.Fatalf("选择渠道失败: %v", err)
+	}
+	if result.ChannelIndex != 1 {
+		t.Fatalf("暂停后应选择渠道 [1]，实际 [%d]", result.ChannelIndex)
+	}
+}
+
+// TestRecordChannelResult_KeepsLastActiveChannel 测试唯一活跃渠道只告警不暂停，以及未启用时不做任何处理
+func TestRecordChannelResult_KeepsLastActiveChannel(t *testing.T) {
+	cfg := nonFailoverTestConfig()
+	cfg.Upstream[1].Status = "disabled"
+	scheduler, cleanup := createTestScheduler(t, cfg)
+	defer cleanup()
+
+	broken := scheduler.configManager.GetConfig().Upstream[0]
+	for i := 0; i < 10; i++ {
+		scheduler.RecordChannelResult("messages", 0, &broken, true) // 未启用
+	}
+	scheduler.SetNonFailoverSuspension(0.8, 5, time.Minute)
+	for i := 0; i < 10; i++ {
+		scheduler.RecordChannelResult("messages", 0, &broken, true)
+	}
+
+	if status := scheduler.configManager.GetConfig().Upstream[0].Status; status != "active" {
+		t.Fatalf("唯一活跃渠道不应被暂停，状态 = %q", status)
+	}
+}
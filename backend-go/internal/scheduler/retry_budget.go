@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RetryBudget 全局重试预算（令牌桶）
+// 限制所有进行中请求的跨渠道/跨 Key 重试总速率，避免上游故障期间请求放大。
+// 每个请求的首次尝试不消耗预算，仅故障转移产生的额外尝试消耗令牌。
+type RetryBudget struct {
+	mu sync.Mutex
+
+	ratePerSecond float64
+	capacity      float64
+	tokens        float64
+	lastRefill    time.Time
+
+	allowed  int64
+	rejected int64
+
+	now func() time.Time
+}
+
+// RetryBudgetStats 重试预算统计
+type RetryBudgetStats struct {
+	Enabled       bool    `json:"enabled"`
+	RatePerSecond float64 `json:"ratePerSecond"`
+	Capacity      float64 `json:"capacity"`
+	Available     float64 `json:"available"`
+	Utilization   float64 `json:"utilization"` // 当前预算使用率（0-100）
+	Allowed       int64   `json:"allowed"`
+	Rejected      int64   `json:"rejected"`
+}
+
+// NewRetryBudget 创建重试预算，ratePerSecond<=0 时不限制
+// 桶容量为 1 秒的预算（至少 1 个令牌），允许短时突发
+func NewRetryBudget(ratePerSecond float64) *RetryBudget {
+	if ratePerSecond <= 0 || math.IsNaN(ratePerSecond) || math.IsInf(ratePerSecond, 0) {
+		return &RetryBudget{now: time.Now}
+	}
+	capacity := math.Max(ratePerSecond, 1)
+	return &RetryBudget{
+		ratePerSecond: ratePerSecond,
+		capacity:      capacity,
+		tokens:        capacity,
+		lastRefill:    time.Now(),
+		now:           time.Now,
+	}
+}
+
+// Enabled 是否启用了重试预算
+func (b *RetryBudget) Enabled() bool {
+	return b != nil && b.ratePerSecond > 0
+}
+
+// TryAcquire 尝试消耗一次重试预算，预算耗尽时返回 false
+func (b *RetryBudget) TryAcquire() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ratePerSecond <= 0 {
+		b.allowed++
+		return true
+	}
+
+	b.refillLocked()
+	if b.tokens < 1 {
+		b.rejected++
+		return false
+	}
+	b.tokens--
+	b.allowed++
+	return true
+}
+
+// Stats 获取重试预算统计
+func (b *RetryBudget) Stats() RetryBudgetStats {
+	if b == nil {
+		return RetryBudgetStats{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := RetryBudgetStats{
+		Enabled:       b.ratePerSecond > 0,
+		RatePerSecond: b.ratePerSecond,
+		Allowed:       b.allowed,
+		Rejected:      b.rejected,
+	}
+	if !stats.Enabled {
+		return stats
+	}
+
+	b.refillLocked()
+	stats.Capacity = b.capacity
+	stats.Available = b.tokens
+	stats.Utilization = (1 - b.tokens/b.capacity) * 100
+	return stats
+}
+
+// refillLocked 按流逝时间补充令牌（调用方需持有锁）
+func (b *RetryBudget) refillLocked() {
+	now := b.now()
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.ratePerSecond)
+	b.lastRefill = now
+}
@@ -15,6 +15,8 @@ const (
 	LoadBalanceWeightedRandom LoadBalanceStrategy = "weighted_random"
 	// LoadBalanceRoundRobin 同优先级组内轮询
 	LoadBalanceRoundRobin LoadBalanceStrategy = "round_robin"
+	// LoadBalanceCheapest 在所有健康候选中按预估成本升序选择（由配置文件 loadBalance: "cheapest" 启用）
+	LoadBalanceCheapest LoadBalanceStrategy = "cheapest"
 )
 
 // PromotionConfig 促销期策略
@@ -33,6 +35,11 @@ type AffinityConfig struct {
 	// 目的：避免 Trace 亲和性把请求长期锁死在低优先级渠道。
 	OnlyWithinSamePriority bool
 	TTL                    time.Duration
+	// 抖动检测：同一会话在 ThrashWindow 内切换亲和渠道达到 ThrashSwitches 次时，
+	// 固定到最近成功的渠道 PinCooldown 时长（ThrashSwitches<=0 表示禁用）
+	ThrashSwitches int
+	ThrashWindow   time.Duration
+	PinCooldown    time.Duration
 }
 
 // CircuitBreakerConfig 熔断配置（Key 级别）
@@ -43,6 +50,17 @@ type CircuitBreakerConfig struct {
 	RecoveryThreshold   float64
 }
 
+// RampConfig 新渠道流量爬坡策略
+// 新渠道在累计成功 ProvingRequests 次之前只接收部分流量（从 MinTrafficFraction 线性增长到 100%），
+// 仅当存在其他已验证的健康渠道时生效。
+type RampConfig struct {
+	Enabled bool
+	// ProvingRequests 渠道被视为“已验证”所需的累计成功请求数
+	ProvingRequests int
+	// MinTrafficFraction 爬坡起点的流量比例（0~1）
+	MinTrafficFraction float64
+}
+
 // FallbackConfig 降级策略
 type FallbackConfig struct {
 	PriorityFirst bool
@@ -55,6 +73,7 @@ type SchedulerConfig struct {
 	Promotion           PromotionConfig
 	Affinity            AffinityConfig
 	CircuitBreaker      CircuitBreakerConfig
+	Ramp                RampConfig
 	Fallback            FallbackConfig
 }
 
@@ -71,6 +90,9 @@ func DefaultSchedulerConfig() SchedulerConfig {
 			Enabled:                true,
 			OnlyWithinSamePriority: true,
 			TTL:                    30 * time.Minute,
+			ThrashSwitches:         0,
+			ThrashWindow:           5 * time.Minute,
+			PinCooldown:            10 * time.Minute,
 		},
 		CircuitBreaker: CircuitBreakerConfig{
 			FailureThreshold:    0.5,
@@ -78,6 +100,11 @@ func DefaultSchedulerConfig() SchedulerConfig {
 			OpenTimeout:         15 * time.Minute,
 			RecoveryThreshold:   0.8,
 		},
+		Ramp: RampConfig{
+			Enabled:            false,
+			ProvingRequests:    20,
+			MinTrafficFraction: 0.1,
+		},
 		Fallback: FallbackConfig{
 			PriorityFirst: true,
 			MaxRetries:    2,
@@ -99,12 +126,24 @@ func ValidateSchedulerConfig(cfg *SchedulerConfig) {
 	if cfg.Affinity.TTL <= 0 || cfg.Affinity.TTL > 24*time.Hour {
 		cfg.Affinity.TTL = defaults.Affinity.TTL
 	}
+	if cfg.Affinity.ThrashWindow <= 0 || cfg.Affinity.ThrashWindow > time.Hour {
+		cfg.Affinity.ThrashWindow = defaults.Affinity.ThrashWindow
+	}
+	if cfg.Affinity.PinCooldown <= 0 || cfg.Affinity.PinCooldown > cfg.Affinity.TTL {
+		cfg.Affinity.PinCooldown = min(defaults.Affinity.PinCooldown, cfg.Affinity.TTL)
+	}
 	if cfg.CircuitBreaker.FailureThreshold <= 0 || cfg.CircuitBreaker.FailureThreshold > 1 || math.IsNaN(cfg.CircuitBreaker.FailureThreshold) {
 		cfg.CircuitBreaker.FailureThreshold = defaults.CircuitBreaker.FailureThreshold
 	}
 	if cfg.CircuitBreaker.RecoveryThreshold <= 0 || cfg.CircuitBreaker.RecoveryThreshold > 1 || math.IsNaN(cfg.CircuitBreaker.RecoveryThreshold) {
 		cfg.CircuitBreaker.RecoveryThreshold = defaults.CircuitBreaker.RecoveryThreshold
 	}
+	if cfg.Ramp.ProvingRequests <= 0 || cfg.Ramp.ProvingRequests > 10000 {
+		cfg.Ramp.ProvingRequests = defaults.Ramp.ProvingRequests
+	}
+	if cfg.Ramp.MinTrafficFraction <= 0 || cfg.Ramp.MinTrafficFraction > 1 || math.IsNaN(cfg.Ramp.MinTrafficFraction) {
+		cfg.Ramp.MinTrafficFraction = defaults.Ramp.MinTrafficFraction
+	}
 	if cfg.Fallback.MaxRetries < 0 || cfg.Fallback.MaxRetries > 10 {
 		cfg.Fallback.MaxRetries = defaults.Fallback.MaxRetries
 	}
@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// selectionContextKey 调度上下文键（避免与其他包的 context key 冲突）
+type selectionContextKey int
+
+const (
+	excludeLowQualityKey selectionContextKey = iota
+	requestModelKey
+	dryRunKey
+	clientIPKey
+	tokenEstimatorKey
+	requestBodySizeKey
+)
+
+// WithExcludeLowQuality 在请求上下文中设置是否排除低质量渠道
+// 启用后低质量渠道仅在没有健康常规渠道时作为最后手段参与调度
+func WithExcludeLowQuality(ctx context.Context, exclude bool) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, excludeLowQualityKey, exclude)
+}
+
+// excludeLowQualityFromContext 读取请求上下文中的低质量渠道排除开关（未设置时为 false）
+func excludeLowQualityFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	exclude, _ := ctx.Value(excludeLowQualityKey).(bool)
+	return exclude
+}
+
+// WithRequestModel 在请求上下文中设置请求的模型名，调度时过滤掉不支持该模型的渠道
+func WithRequestModel(ctx context.Context, model string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, requestModelKey, model)
+}
+
+// requestModelFromContext 读取请求上下文中的模型名（未设置时为空字符串，不过滤）
+func requestModelFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	model, _ := ctx.Value(requestModelKey).(string)
+	return model
+}
+
+// WithClientIP 在请求上下文中设置客户端 IP，无会话标识时用于客户端 IP 亲和
+func WithClientIP(ctx context.Context, clientIP string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, clientIPKey, clientIP)
+}
+
+// clientIPFromContext 读取请求上下文中的客户端 IP（未设置时为空字符串）
+func clientIPFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	clientIP, _ := ctx.Value(clientIPKey).(string)
+	return clientIP
+}
+
+// requestBodyLimits 请求体大小及渠道未配置上限时使用的全局上限
+type requestBodyLimits struct {
+	size         int64
+	defaultLimit int64
+}
+
+// WithRequestBodySize 在请求上下文中设置请求体大小（字节），调度时跳过上限不足的渠道
+// defaultLimit 为渠道未配置 maxRequestBodySize 时使用的全局上限
+func WithRequestBodySize(ctx context.Context, size, defaultLimit int64) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, requestBodySizeKey, requestBodyLimits{size: size, defaultLimit: defaultLimit})
+}
+
+// requestBodyLimitsFromContext 读取请求上下文中的请求体大小（未设置时 ok 为 false，不过滤）
+func requestBodyLimitsFromContext(ctx context.Context) (requestBodyLimits, bool) {
+	if ctx == nil {
+		return requestBodyLimits{}, false
+	}
+	limits, ok := ctx.Value(requestBodySizeKey).(requestBodyLimits)
+	return limits, ok
+}
+
+// TokenEstimator 返回请求的预估输入/输出 token 数（仅 cheapest 策略下按需调用）
+type TokenEstimator func() (inputTokens, outputTokens int)
+
+// WithTokenEstimator 在请求上下文中设置 token 估算函数，cheapest 策略据此计算各渠道的预估成本
+// 估算结果在首次调用后缓存，故障转移多次选择渠道时不会重复估算
+func WithTokenEstimator(ctx context.Context, estimator TokenEstimator) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, tokenEstimatorKey, TokenEstimator(sync.OnceValues(estimator)))
+}
+
+// tokenEstimatorFromContext 读取请求上下文中的 token 估算函数（未设置时为 nil）
+func tokenEstimatorFromContext(ctx context.Context) TokenEstimator {
+	if ctx == nil {
+		return nil
+	}
+	estimator, _ := ctx.Value(tokenEstimatorKey).(TokenEstimator)
+	return estimator
+}
+
+// withSelectionDryRun 标记本次选择为预览（dry-run）：不输出调度日志、不推进轮询状态
+func withSelectionDryRun(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, dryRunKey, true)
+}
+
+// dryRunFromContext 读取请求上下文中的 dry-run 标记（未设置时为 false）
+func dryRunFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	dryRun, _ := ctx.Value(dryRunKey).(bool)
+	return dryRun
+}
+
+// selectionLogf 返回调度日志输出函数（dry-run 时为空操作）
+func selectionLogf(ctx context.Context) func(format string, args ...interface{}) {
+	if dryRunFromContext(ctx) {
+		return func(string, ...interface{}) {}
+	}
+	return log.Printf
+}
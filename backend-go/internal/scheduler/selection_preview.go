@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/metrics"
+)
+
+// 渠道未进入健康候选的原因
+const (
+	SkipReasonFailed           = "failed"            // 本次请求中已失败
+	SkipReasonInactive         = "inactive"          // 非 active 状态
+	SkipReasonNoKeys           = "no_keys"           // 无可用 API Key
+	SkipReasonUnhealthy        = "unhealthy"         // 健康检查未通过
+	SkipReasonModelUnsupported = "model_unsupported" // 不支持请求的模型
+)
+
+// ChannelScore 单个渠道的调度评估结果
+type ChannelScore struct {
+	Index         int     `json:"index"`
+	Name          string  `json:"name"`
+	Priority      int     `json:"priority"`
+	Weight        int     `json:"weight"`
+	LowQuality    bool    `json:"lowQuality"`
+	Healthy       bool    `json:"healthy"`
+	FailureRate   float64 `json:"failureRate"`
+	CircuitState  string  `json:"circuitState"`
+	Promoted      bool    `json:"promoted"`
+	AffinityMatch bool    `json:"affinityMatch"`
+	Eligible      bool    `json:"eligible"`             // 是否进入健康候选
+	SkipReason    string  `json:"skipReason,omitempty"` // 未进入候选的原因
+
+	channel ChannelInfo
+}
+
+// scoreChannels 评估渠道健康状况（纯函数，不输出日志、不修改调度状态）
+// 返回顺序与输入一致（即调度优先级顺序），Eligible 的渠道即 SelectChannel 的健康候选
+func (s *ChannelScheduler) scoreChannels(
+	channels []ChannelInfo,
+	failedChannels map[int]bool,
+	isResponses bool,
+	metricsManager *metrics.MetricsManager,
+) []ChannelScore {
+	scores := make([]ChannelScore, 0, len(channels))
+	for _, ch := range channels {
+		score := ChannelScore{
+			Index:        ch.Index,
+			Name:         ch.Name,
+			Priority:     ch.Priority,
+			Weight:       ch.Weight,
+			LowQuality:   ch.LowQuality,
+			CircuitState: metrics.CircuitClosed.String(),
+			channel:      ch,
+		}
+
+		upstream := s.getUpstreamByIndex(ch.Index, isResponses)
+		hasKeys := upstream != nil && len(upstream.APIKeys) > 0
+		if hasKeys {
+			score.Healthy = metricsManager.IsChannelHealthyWithKeys(upstream.BaseURL, upstream.APIKeys)
+			score.FailureRate = metricsManager.CalculateChannelFailureRate(upstream.BaseURL, upstream.APIKeys)
+			score.CircuitState = metricsManager.GetChannelCircuitState(upstream.BaseURL, upstream.APIKeys).String()
+		}
+
+		switch {
+		case failedChannels[ch.Index]:
+			score.SkipReason = SkipReasonFailed
+		case ch.Status != "active":
+			score.SkipReason = SkipReasonInactive
+		case !hasKeys:
+			score.SkipReason = SkipReasonNoKeys
+		case !score.Healthy:
+			score.SkipReason = SkipReasonUnhealthy
+		default:
+			score.Eligible = true
+		}
+		scores = append(scores, score)
+	}
+	return scores
+}
+
+// SelectionPreview 渠道选择预览结果
+type SelectionPreview struct {
+	Model       string              `json:"model,omitempty"`
+	UserID      string              `json:"userId,omitempty"`
+	Strategy    LoadBalanceStrategy `json:"strategy"`
+	Candidates  []ChannelScore      `json:"candidates"`
+	CostRanking []ChannelCost       `json:"costRanking,omitempty"` // cheapest 策略下健康候选的成本排序（升序）
+	ChosenIndex int                 `json:"chosenIndex"`           // 最终选中的渠道索引，无可用渠道时为 -1
+	Reason      string              `json:"reason,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// PreviewChannelSelection 预览渠道选择结果（dry-run，不发送请求）
+// 与 SelectChannel 使用相同的选择逻辑，但不输出调度日志、不推进轮询状态；
+// 新渠道爬坡为随机过滤，预览中不模拟；weighted_random 策略下 ChosenIndex 为一次随机抽样结果
+func (s *ChannelScheduler) PreviewChannelSelection(
+	ctx context.Context,
+	userID string,
+	failedChannels map[int]bool,
+	isResponses bool,
+) (*SelectionPreview, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	activeChannels := s.getActiveChannels(isResponses)
+	if len(activeChannels) == 0 {
+		return nil, fmt.Errorf("没有可用的活跃渠道")
+	}
+
+	dryRunCtx := withSelectionDryRun(ctx)
+	cfg := s.schedulerConfig
+	ValidateSchedulerConfig(&cfg)
+	model := requestModelFromContext(ctx)
+	preview := &SelectionPreview{
+		Model:       model,
+		UserID:      userID,
+		Strategy:    cfg.LoadBalanceStrategy,
+		ChosenIndex: -1,
+	}
+
+	supported := make(map[int]bool, len(activeChannels))
+	for _, ch := range filterChannelsByModel(activeChannels, model, func(index int) *config.UpstreamConfig {
+		return s.getUpstreamByIndex(index, isResponses)
+	}) {
+		supported[ch.Index] = true
+	}
+
+	promotedIndex, affinityIndex := -1, -1
+	if cfg.Promotion.Enabled {
+		if promoted := s.findPromotedChannel(activeChannels, isResponses, selectionLogf(dryRunCtx)); promoted != nil {
+			promotedIndex = promoted.Index
+		}
+	}
+	if cfg.Affinity.Enabled && userID != "" && s.traceAffinity != nil {
+		if preferredIdx, ok := s.traceAffinity.GetPreferredChannel(userID); ok {
+			affinityIndex = preferredIdx
+		}
+	}
+
+	preview.Candidates = s.scoreChannels(activeChannels, failedChannels, isResponses, s.getMetricsManager(isResponses))
+	for i := range preview.Candidates {
+		score := &preview.Candidates[i]
+		score.Promoted = score.Index == promotedIndex
+		score.AffinityMatch = score.Index == affinityIndex
+		if !supported[score.Index] {
+			score.Eligible = false
+			score.SkipReason = SkipReasonModelUnsupported
+		}
+	}
+
+	if s.cheapestEnabled(isResponses) {
+		preview.Strategy = LoadBalanceCheapest
+		eligible := make([]ChannelInfo, 0, len(preview.Candidates))
+		for _, score := range preview.Candidates {
+			if score.Eligible {
+				eligible = append(eligible, score.channel)
+			}
+		}
+		_, preview.CostRanking = s.rankByCost(ctx, eligible, func(index int) *config.UpstreamConfig {
+			return s.getUpstreamByIndex(index, isResponses)
+		})
+	}
+
+	result, err := s.selectChannelLocked(dryRunCtx, userID, failedChannels, isResponses)
+	if err != nil {
+		preview.Error = err.Error()
+		return preview, nil
+	}
+	preview.ChosenIndex = result.ChannelIndex
+	preview.Reason = result.Reason
+	return preview, nil
+}
@@ -0,0 +1,230 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+// DefaultShadowMaxConcurrency 影子请求默认的全局并发上限
+const DefaultShadowMaxConcurrency = 8
+
+// ShadowChannel 影子渠道（Index 为渠道在配置中的索引）
+type ShadowChannel struct {
+	Index    int
+	Upstream *config.UpstreamConfig
+}
+
+// ShadowResult 一次影子请求的结果
+type ShadowResult struct {
+	Success bool
+	Latency time.Duration
+	Usage   *types.Usage // 上游未返回 usage 时为 nil
+	Error   string
+}
+
+// ShadowChannelStats 单个影子渠道的累计结果
+type ShadowChannelStats struct {
+	ChannelIndex     int        `json:"channelIndex"`
+	ChannelName      string     `json:"channelName"`
+	Requests         int64      `json:"requests"`
+	Successes        int64      `json:"successes"`
+	Failures         int64      `json:"failures"`
+	SuccessRate      float64    `json:"successRate"` // 百分比
+	AvgLatencyMs     int64      `json:"avgLatencyMs"`
+	InputTokens      int64      `json:"inputTokens"`
+	OutputTokens     int64      `json:"outputTokens"`
+	CostUSD          float64    `json:"costUsd"`
+	UnpricedRequests int64      `json:"unpricedRequests"` // 成功但无定价数据或无 usage、未计入成本的请求数
+	LastError        string     `json:"lastError,omitempty"`
+	LastRequestAt    *time.Time `json:"lastRequestAt,omitempty"`
+}
+
+// ShadowReport 影子渠道结果报告（进程内累计，重启后清零；不计入生产渠道指标）
+type ShadowReport struct {
+	Since          time.Time            `json:"since"`
+	MaxConcurrency int                  `json:"maxConcurrency"`
+	InFlight       int                  `json:"inFlight"`
+	Dropped        int64                `json:"dropped"` // 并发已满而未发送的影子请求数
+	Channels       []ShadowChannelStats `json:"channels"`
+}
+
+type shadowChannelKey struct {
+	index int
+	name  string
+}
+
+type shadowChannelState struct {
+	stats          ShadowChannelStats
+	totalLatencyMs int64
+}
+
+type shadowReportState struct {
+	dropped  int64
+	channels map[shadowChannelKey]*shadowChannelState
+}
+
+// shadowTracker 影子请求的并发槽位与按接口类型汇总的结果
+type shadowTracker struct {
+	slots chan struct{}
+
+	mu       sync.Mutex
+	since    time.Time
+	inFlight int
+	reports  map[string]*shadowReportState
+}
+
+func newShadowTracker(maxConcurrent int) *shadowTracker {
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultShadowMaxConcurrency
+	}
+	return &shadowTracker{
+		slots:   make(chan struct{}, maxConcurrent),
+		since:   time.Now(),
+		reports: make(map[string]*shadowReportState),
+	}
+}
+
+func (t *shadowTracker) stateLocked(namespace string) *shadowReportState {
+	state, ok := t.reports[namespace]
+	if !ok {
+		state = &shadowReportState{channels: make(map[shadowChannelKey]*shadowChannelState)}
+		t.reports[namespace] = state
+	}
+	return state
+}
+
+// tryAcquire 非阻塞获取槽位，已满时计入丢弃数（影子请求不能拖慢生产请求）
+func (t *shadowTracker) tryAcquire(namespace string) (func(), bool) {
+	select {
+	case t.slots <- struct{}{}:
+	default:
+		t.mu.Lock()
+		t.stateLocked(namespace).dropped++
+		t.mu.Unlock()
+		return nil, false
+	}
+
+	t.mu.Lock()
+	t.inFlight++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.inFlight--
+			t.mu.Unlock()
+			<-t.slots
+		})
+	}, true
+}
+
+func (t *shadowTracker) record(namespace string, key shadowChannelKey, result ShadowResult, cost float64, priced bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.stateLocked(namespace)
+	ch, ok := state.channels[key]
+	if !ok {
+		ch = &shadowChannelState{stats: ShadowChannelStats{ChannelIndex: key.index, ChannelName: key.name}}
+		state.channels[key] = ch
+	}
+
+	now := time.Now()
+	ch.stats.Requests++
+	ch.stats.LastRequestAt = &now
+	ch.totalLatencyMs += result.Latency.Milliseconds()
+	if !result.Success {
+		ch.stats.Failures++
+		ch.stats.LastError = result.Error
+		return
+	}
+	ch.stats.Successes++
+	if result.Usage != nil {
+		ch.stats.InputTokens += int64(result.Usage.InputTokens)
+		ch.stats.OutputTokens += int64(result.Usage.OutputTokens)
+	}
+	if priced {
+		ch.stats.CostUSD += cost
+	} else {
+		ch.stats.UnpricedRequests++
+	}
+}
+
+func (t *shadowTracker) report(namespace string) ShadowReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := ShadowReport{
+		Since:          t.since,
+		MaxConcurrency: cap(t.slots),
+		InFlight:       t.inFlight,
+		Channels:       []ShadowChannelStats{},
+	}
+	state, ok := t.reports[namespace]
+	if !ok {
+		return report
+	}
+	report.Dropped = state.dropped
+	for _, ch := range state.channels {
+		stats := ch.stats
+		if stats.Requests > 0 {
+			stats.SuccessRate = float64(stats.Successes) / float64(stats.Requests) * 100
+			stats.AvgLatencyMs = ch.totalLatencyMs / stats.Requests
+		}
+		report.Channels = append(report.Channels, stats)
+	}
+	sort.Slice(report.Channels, func(i, j int) bool {
+		return report.Channels[i].ChannelIndex < report.Channels[j].ChannelIndex
+	})
+	return report
+}
+
+// SetShadowConcurrency 设置影子请求的全局并发上限（<=0 时使用默认值）
+func (s *ChannelScheduler) SetShadowConcurrency(maxConcurrent int) {
+	s.shadow = newShadowTracker(maxConcurrent)
+}
+
+// GetShadowChannels 获取 Messages 的 active 影子渠道（返回深拷贝，供异步请求使用）
+func (s *ChannelScheduler) GetShadowChannels() []ShadowChannel {
+	cfg := s.configManager.GetConfig()
+
+	var channels []ShadowChannel
+	for i := range cfg.Upstream {
+		upstream := &cfg.Upstream[i]
+		if !upstream.Shadow || (upstream.Status != "" && upstream.Status != "active") {
+			continue
+		}
+		channels = append(channels, ShadowChannel{Index: i, Upstream: upstream.Clone()})
+	}
+	return channels
+}
+
+// TryAcquireShadowSlot 非阻塞获取影子请求槽位（namespace: messages/responses/gemini）
+// 并发已满时返回 false 并计入丢弃数；返回 true 时须在影子请求结束后调用 release
+func (s *ChannelScheduler) TryAcquireShadowSlot(namespace string) (release func(), ok bool) {
+	return s.shadow.tryAcquire(namespace)
+}
+
+// RecordShadowResult 记录一次影子请求的结果，成本按 usage 与渠道模型重定向后的模型价格计算
+// 影子结果单独汇总，不写入渠道指标、不影响熔断与调度
+func (s *ChannelScheduler) RecordShadowResult(namespace string, channelIndex int, upstream *config.UpstreamConfig, model string, result ShadowResult) {
+	if upstream == nil {
+		return
+	}
+	var cost float64
+	var priced bool
+	if result.Success && result.Usage != nil {
+		cost, priced = s.estimateUsageCost(upstream, model, result.Usage)
+	}
+	s.shadow.record(namespace, shadowChannelKey{index: channelIndex, name: upstream.Name}, result, cost, priced)
+}
+
+// GetShadowReport 获取影子渠道结果报告
+func (s *ChannelScheduler) GetShadowReport(namespace string) ShadowReport {
+	return s.shadow.report(namespace)
+}
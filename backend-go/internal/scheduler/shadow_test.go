@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/types"
+)
+
+func newShadowTestConfig() config.Config {
+	return config.Config{
+		Upstream: []config.UpstreamConfig{
+			{Name: "primary", BaseURL: "https://primary.example.com", APIKeys: []string{"k0"}, Status: "active", Priority: 2},
+			{Name: "shadow", BaseURL: "https://shadow.example.com", APIKeys: []string{"k1"}, Status: "active", Priority: 1, Shadow: true,
+				ModelMapping: map[string]string{"claude-x": "haiku"}},
+			{Name: "shadow-off", BaseURL: "https://off.example.com", APIKeys: []string{"k2"}, Status: "disabled", Shadow: true},
+		},
+	}
+}
+
+// TestShadowChannel_ExcludedFromScheduling 测试影子渠道不参与调度与活跃渠道计数
+func TestShadowChannel_ExcludedFromScheduling(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, newShadowTestConfig())
+	defer cleanup()
+
+	if got := scheduler.GetActiveChannelCount(false); got != 1 {
+		t.Fatalf("GetActiveChannelCount = %d, want 1", got)
+	}
+	result, err := scheduler.SelectChannel(context.Background(), "", map[int]bool{}, false)
+	if err != nil {
+		t.Fatalf("SelectChannel 失败: %v", err)
+	}
+	if result.ChannelIndex != 0 {
+		t.Fatalf("SelectChannel = [%d], want primary [0]", result.ChannelIndex)
+	}
+
+	shadows := scheduler.GetShadowChannels()
+	if len(shadows) != 1 || shadows[0].Index != 1 || shadows[0].Upstream.Name != "shadow" {
+		t.Fatalf("GetShadowChannels = %+v, want only active shadow [1]", shadows)
+	}
+}
+
+// TestRecordShadowResult_SeparateFromProductionMetrics 测试影子结果单独汇总且不写入渠道指标
+func TestRecordShadowResult_SeparateFromProductionMetrics(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, newShadowTestConfig())
+	defer cleanup()
+	scheduler.SetPricingSource(testPricing)
+
+	shadow := scheduler.GetShadowChannels()[0]
+	usage := &types.Usage{InputTokens: 1000, OutputTokens: 100}
+	scheduler.RecordShadowResult("messages", shadow.Index, shadow.Upstream, "claude-x",
+		ShadowResult{Success: true, Latency: 100 * time.Millisecond, Usage: usage})
+	scheduler.RecordShadowResult("messages", shadow.Index, shadow.Upstream, "claude-x",
+		ShadowResult{Latency: 300 * time.Millisecond, Error: "HTTP 500"})
+
+	report := scheduler.GetShadowReport("messages")
+	if len(report.Channels) != 1 {
+		t.Fatalf("channels = %+v, want 1", report.Channels)
+	}
+	stats := report.Channels[0]
+	if stats.Requests != 2 || stats.Successes != 1 || stats.Failures != 1 || stats.SuccessRate != 50 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.AvgLatencyMs != 200 || stats.InputTokens != 1000 || stats.OutputTokens != 100 || stats.LastError != "HTTP 500" {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if want := 1000*1e-6 + 100*5e-6; !almostEqual(stats.CostUSD, want) {
+		t.Fatalf("costUsd = %v, want %v", stats.CostUSD, want)
+	}
+
+	if resp := scheduler.GetMessagesMetricsManager().ToResponse(shadow.Index, shadow.Upstream.BaseURL, shadow.Upstream.APIKeys, 0); resp.RequestCount != 0 {
+		t.Fatalf("影子结果不应写入渠道指标, requestCount = %d", resp.RequestCount)
+	}
+	if other := scheduler.GetShadowReport("responses"); len(other.Channels) != 0 {
+		t.Fatalf("responses report = %+v, want empty", other)
+	}
+}
+
+// TestTryAcquireShadowSlot_DropsWhenFull 测试影子请求并发已满时丢弃并计数
+func TestTryAcquireShadowSlot_DropsWhenFull(t *testing.T) {
+	scheduler, cleanup := createTestScheduler(t, newShadowTestConfig())
+	defer cleanup()
+	scheduler.SetShadowConcurrency(1)
+
+	release, ok := scheduler.TryAcquireShadowSlot("messages")
+	if !ok {
+		t.Fatal("首个槽位应获取成功")
+	}
+	if _, ok := scheduler.TryAcquireShadowSlot("messages"); ok {
+		t.Fatal("并发已满时应获取失败")
+	}
+	report := scheduler.GetShadowReport("messages")
+	if report.MaxConcurrency != 1 || report.InFlight != 1 || report.Dropped != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	release()
+	release() // 重复释放无副作用
+	if _, ok := scheduler.TryAcquireShadowSlot("messages"); !ok {
+		t.Fatal("释放后应可再次获取")
+	}
+	if report := scheduler.GetShadowReport("messages"); report.InFlight != 1 {
+		t.Fatalf("inFlight = %d, want 1", report.InFlight)
+	}
+}
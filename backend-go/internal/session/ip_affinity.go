@@ -0,0 +1,77 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// ipAffinityKey 计算客户端 IP 亲和键（IP + 模型的哈希，避免在内存中保存明文 IP）
+func ipAffinityKey(clientIP, model string) string {
+	sum := sha256.Sum256([]byte(clientIP + "|" + model))
+	return hex.EncodeToString(sum[:16])
+}
+
+// SetIPAffinityTTL 设置客户端 IP 亲和的过期时间（0 表示禁用）
+// IP 亲和仅作为无会话标识请求的兜底，TTL 应短于会话亲和，超过会话亲和 TTL 时按会话亲和 TTL 处理
+func (m *TraceAffinityManager) SetIPAffinityTTL(ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ipTTL = min(max(ttl, 0), m.ttl)
+	if m.ipTTL == 0 {
+		m.ipAffinity = make(map[string]*TraceAffinity)
+	}
+}
+
+// IPAffinityEnabled 是否启用客户端 IP 亲和
+func (m *TraceAffinityManager) IPAffinityEnabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ipTTL > 0
+}
+
+// GetIPAffinityTTL 获取客户端 IP 亲和的过期时间
+func (m *TraceAffinityManager) GetIPAffinityTTL() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ipTTL
+}
+
+// GetPreferredChannelByIP 获取客户端 IP + 模型偏好的渠道
+// 返回渠道索引和是否存在（未启用 IP 亲和时始终不存在）
+func (m *TraceAffinityManager) GetPreferredChannelByIP(clientIP, model string) (int, bool) {
+	if clientIP == "" {
+		return -1, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.ipTTL <= 0 {
+		return -1, false
+	}
+	affinity, exists := m.ipAffinity[ipAffinityKey(clientIP, model)]
+	if !exists || time.Since(affinity.LastUsedAt) > m.ipTTL {
+		return -1, false
+	}
+	return affinity.ChannelIndex, true
+}
+
+// SetPreferredChannelByIP 设置客户端 IP + 模型偏好的渠道（同时用于续期）
+func (m *TraceAffinityManager) SetPreferredChannelByIP(clientIP, model string, channelIndex int) {
+	if clientIP == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ipTTL <= 0 {
+		return
+	}
+	m.ipAffinity[ipAffinityKey(clientIP, model)] = &TraceAffinity{
+		ChannelIndex: channelIndex,
+		LastUsedAt:   time.Now(),
+	}
+}
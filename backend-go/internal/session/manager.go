@@ -207,6 +207,13 @@ func (sm *SessionManager) GetStats() map[string]interface{} {
 	}
 }
 
+// Size 返回当前会话数与 responseID 映射数
+func (sm *SessionManager) Size() (sessions, mappings int) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return len(sm.sessions), len(sm.responseMapping)
+}
+
 // generateID 生成唯一ID
 func generateID(prefix string) string {
 	bytes := make([]byte, 16)
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"log"
 	"sync"
 	"time"
 )
@@ -9,32 +10,64 @@ import (
 type TraceAffinity struct {
 	ChannelIndex int
 	LastUsedAt   time.Time
+	CreatedAt    time.Time // 绑定到当前渠道的时间（续期不更新，用于最大存活时间判断）
 }
 
+// TraceAffinityRecord 持久化的亲和记录
+type TraceAffinityRecord struct {
+	UserID       string
+	ChannelIndex int
+	LastUsedAt   time.Time
+	CreatedAt    time.Time // 为零值时（旧记录）按 LastUsedAt 处理
+}
+
+// TraceAffinityStore 亲和记录持久化存储接口
+type TraceAffinityStore interface {
+	// LoadTraceAffinities 加载最后使用时间晚于 since 的亲和记录
+	LoadTraceAffinities(since time.Time) ([]TraceAffinityRecord, error)
+	// SaveTraceAffinities 批量写入（覆盖）亲和记录
+	SaveTraceAffinities(records []TraceAffinityRecord) error
+	// DeleteTraceAffinities 批量删除亲和记录
+	DeleteTraceAffinities(userIDs []string) error
+	// CleanupTraceAffinities 清理最后使用时间早于 before 的亲和记录
+	CleanupTraceAffinities(before time.Time) (int64, error)
+}
+
+// traceAffinityFlushInterval 亲和记录异步持久化间隔
+const traceAffinityFlushInterval = 5 * time.Second
+
 // TraceAffinityManager 管理 trace 与渠道的亲和性
 type TraceAffinityManager struct {
 	mu       sync.RWMutex
 	affinity map[string]*TraceAffinity // key: user_id
 	ttl      time.Duration
+	maxAge   time.Duration // 亲和最大存活时间（自绑定起计算，续期不延长），0 表示不限制
 	stopCh   chan struct{} // 用于停止清理 goroutine
+
+	// 持久化（可选）：热路径只标记变更，由后台循环批量写入
+	store   TraceAffinityStore
+	dirty   map[string]struct{} // 待写入的 user_id
+	deleted map[string]struct{} // 待删除的 user_id
+	wg      sync.WaitGroup
+
+	// 客户端 IP 亲和（无会话标识时的兜底，仅保存在内存中）
+	ipAffinity map[string]*TraceAffinity // key: hash(client_ip + model)
+	ipTTL      time.Duration             // 0 表示禁用
 }
 
 // NewTraceAffinityManager 创建 Trace 亲和性管理器
 func NewTraceAffinityManager() *TraceAffinityManager {
-	mgr := &TraceAffinityManager{
-		affinity: make(map[string]*TraceAffinity),
-		ttl:      30 * time.Minute, // 默认 30 分钟无活动后过期
-		stopCh:   make(chan struct{}),
-	}
-
-	// 启动定期清理
-	go mgr.cleanupLoop()
-
-	return mgr
+	return NewTraceAffinityManagerWithStore(30*time.Minute, nil) // 默认 30 分钟无活动后过期
 }
 
 // NewTraceAffinityManagerWithTTL 创建带自定义 TTL 的管理器
 func NewTraceAffinityManagerWithTTL(ttl time.Duration) *TraceAffinityManager {
+	return NewTraceAffinityManagerWithStore(ttl, nil)
+}
+
+// NewTraceAffinityManagerWithStore 创建带持久化存储的管理器
+// store 非空时启动时清理过期记录并加载未过期的亲和记录，之后的变更异步批量写入；store 为 nil 时仅保存在内存中
+func NewTraceAffinityManagerWithStore(ttl time.Duration, store TraceAffinityStore) *TraceAffinityManager {
 	if ttl <= 0 {
 		ttl = 30 * time.Minute
 	}
@@ -43,13 +76,126 @@ func NewTraceAffinityManagerWithTTL(ttl time.Duration) *TraceAffinityManager {
 		affinity: make(map[string]*TraceAffinity),
 		ttl:      ttl,
 		stopCh:   make(chan struct{}),
+		store:    store,
+		dirty:    make(map[string]struct{}),
+		deleted:  make(map[string]struct{}),
+
+		ipAffinity: make(map[string]*TraceAffinity),
 	}
 
+	if store != nil {
+		mgr.loadFromStore()
+		mgr.wg.Add(1)
+		go mgr.persistLoop()
+	}
+
+	// 启动定期清理
+	mgr.wg.Add(1)
 	go mgr.cleanupLoop()
 
 	return mgr
 }
 
+// loadFromStore 从持久化存储恢复未过期的亲和记录
+func (m *TraceAffinityManager) loadFromStore() {
+	cutoff := time.Now().Add(-m.ttl)
+	if _, err := m.store.CleanupTraceAffinities(cutoff); err != nil {
+		log.Printf("[TraceAffinity-Load] 警告: 清理过期亲和记录失败: %v", err)
+	}
+
+	records, err := m.store.LoadTraceAffinities(cutoff)
+	if err != nil {
+		log.Printf("[TraceAffinity-Load] 警告: 加载亲和记录失败: %v", err)
+		return
+	}
+	for _, record := range records {
+		createdAt := record.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = record.LastUsedAt
+		}
+		m.affinity[record.UserID] = &TraceAffinity{
+			ChannelIndex: record.ChannelIndex,
+			LastUsedAt:   record.LastUsedAt,
+			CreatedAt:    createdAt,
+		}
+	}
+	if len(records) > 0 {
+		log.Printf("[TraceAffinity-Load] 已恢复 %d 条亲和记录", len(records))
+	}
+}
+
+// markDirtyLocked 标记记录待写入（调用方需持有写锁）
+func (m *TraceAffinityManager) markDirtyLocked(userID string) {
+	if m.store == nil {
+		return
+	}
+	delete(m.deleted, userID)
+	m.dirty[userID] = struct{}{}
+}
+
+// markDeletedLocked 标记记录待删除（调用方需持有写锁）
+func (m *TraceAffinityManager) markDeletedLocked(userID string) {
+	if m.store == nil {
+		return
+	}
+	delete(m.dirty, userID)
+	m.deleted[userID] = struct{}{}
+}
+
+// Flush 将待写入/待删除的亲和记录同步写入持久化存储
+func (m *TraceAffinityManager) Flush() {
+	if m.store == nil {
+		return
+	}
+
+	m.mu.Lock()
+	records := make([]TraceAffinityRecord, 0, len(m.dirty))
+	for userID := range m.dirty {
+		if affinity, exists := m.affinity[userID]; exists {
+			records = append(records, TraceAffinityRecord{
+				UserID:       userID,
+				ChannelIndex: affinity.ChannelIndex,
+				LastUsedAt:   affinity.LastUsedAt,
+				CreatedAt:    affinity.CreatedAt,
+			})
+		}
+	}
+	deleted := make([]string, 0, len(m.deleted))
+	for userID := range m.deleted {
+		deleted = append(deleted, userID)
+	}
+	m.dirty = make(map[string]struct{})
+	m.deleted = make(map[string]struct{})
+	m.mu.Unlock()
+
+	if len(records) > 0 {
+		if err := m.store.SaveTraceAffinities(records); err != nil {
+			log.Printf("[TraceAffinity-Persist] 警告: 写入 %d 条亲和记录失败: %v", len(records), err)
+		}
+	}
+	if len(deleted) > 0 {
+		if err := m.store.DeleteTraceAffinities(deleted); err != nil {
+			log.Printf("[TraceAffinity-Persist] 警告: 删除 %d 条亲和记录失败: %v", len(deleted), err)
+		}
+	}
+}
+
+// persistLoop 定期批量写入变更
+func (m *TraceAffinityManager) persistLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(traceAffinityFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Flush()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
 // GetPreferredChannel 获取 user_id 偏好的渠道
 // 返回渠道索引和是否存在
 func (m *TraceAffinityManager) GetPreferredChannel(userID string) (int, bool) {
@@ -65,14 +211,37 @@ func (m *TraceAffinityManager) GetPreferredChannel(userID string) (int, bool) {
 		return -1, false
 	}
 
-	// 检查是否过期
-	if time.Since(affinity.LastUsedAt) > m.ttl {
+	// 检查是否过期（空闲超过 TTL 或超过最大存活时间）
+	if m.expiredLocked(affinity, time.Now()) {
 		return -1, false
 	}
 
 	return affinity.ChannelIndex, true
 }
 
+// expiredLocked 判断亲和记录是否过期（调用方需持有锁）
+func (m *TraceAffinityManager) expiredLocked(affinity *TraceAffinity, now time.Time) bool {
+	if now.Sub(affinity.LastUsedAt) > m.ttl {
+		return true
+	}
+	return m.maxAge > 0 && now.Sub(affinity.CreatedAt) > m.maxAge
+}
+
+// SetMaxAffinityAge 设置亲和最大存活时间（<=0 表示不限制）
+// 与 TTL 不同，续期不会延长最大存活时间：长期持续活跃的会话到期后也会重新选择渠道，以便用上新加入的更优渠道
+func (m *TraceAffinityManager) SetMaxAffinityAge(maxAge time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxAge = max(maxAge, 0)
+}
+
+// GetMaxAffinityAge 获取亲和最大存活时间（0 表示不限制）
+func (m *TraceAffinityManager) GetMaxAffinityAge() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.maxAge
+}
+
 // SetPreferredChannel 设置 user_id 偏好的渠道
 func (m *TraceAffinityManager) SetPreferredChannel(userID string, channelIndex int) {
 	if userID == "" {
@@ -82,10 +251,19 @@ func (m *TraceAffinityManager) SetPreferredChannel(userID string, channelIndex i
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// 渠道未变化且未过期时保留绑定时间，避免每次成功请求都重置最大存活时间
+	now := time.Now()
+	createdAt := now
+	if prev, exists := m.affinity[userID]; exists && prev.ChannelIndex == channelIndex && !m.expiredLocked(prev, now) {
+		createdAt = prev.CreatedAt
+	}
+
 	m.affinity[userID] = &TraceAffinity{
 		ChannelIndex: channelIndex,
-		LastUsedAt:   time.Now(),
+		LastUsedAt:   now,
+		CreatedAt:    createdAt,
 	}
+	m.markDirtyLocked(userID)
 }
 
 // UpdateLastUsed 更新最后使用时间（续期）
@@ -99,6 +277,7 @@ func (m *TraceAffinityManager) UpdateLastUsed(userID string) {
 
 	if affinity, exists := m.affinity[userID]; exists {
 		affinity.LastUsedAt = time.Now()
+		m.markDirtyLocked(userID)
 	}
 }
 
@@ -108,6 +287,7 @@ func (m *TraceAffinityManager) Remove(userID string) {
 	defer m.mu.Unlock()
 
 	delete(m.affinity, userID)
+	m.markDeletedLocked(userID)
 }
 
 // RemoveByChannel 移除指定渠道的所有亲和记录
@@ -119,6 +299,12 @@ func (m *TraceAffinityManager) RemoveByChannel(channelIndex int) {
 	for userID, affinity := range m.affinity {
 		if affinity.ChannelIndex == channelIndex {
 			delete(m.affinity, userID)
+			m.markDeletedLocked(userID)
+		}
+	}
+	for key, affinity := range m.ipAffinity {
+		if affinity.ChannelIndex == channelIndex {
+			delete(m.ipAffinity, key)
 		}
 	}
 }
@@ -134,6 +320,18 @@ func (m *TraceAffinityManager) Cleanup() int {
 	for userID, affinity := range m.affinity {
 		if now.Sub(affinity.LastUsedAt) > m.ttl {
 			delete(m.affinity, userID)
+			delete(m.dirty, userID)
+			cleaned++
+		} else if m.maxAge > 0 && now.Sub(affinity.CreatedAt) > m.maxAge {
+			// 仍在活跃但超过最大存活时间：存储中的记录不会被按 TTL 清理，需显式删除
+			delete(m.affinity, userID)
+			m.markDeletedLocked(userID)
+			cleaned++
+		}
+	}
+	for key, affinity := range m.ipAffinity {
+		if now.Sub(affinity.LastUsedAt) > m.ipTTL {
+			delete(m.ipAffinity, key)
 			cleaned++
 		}
 	}
@@ -141,8 +339,9 @@ func (m *TraceAffinityManager) Cleanup() int {
 	return cleaned
 }
 
-// cleanupLoop 定期清理过期记录
+// cleanupLoop 定期清理过期记录（启用持久化时同时清理存储中的过期记录）
 func (m *TraceAffinityManager) cleanupLoop() {
+	defer m.wg.Done()
 	ticker := time.NewTicker(5 * time.Minute) // 每 5 分钟清理一次
 	defer ticker.Stop()
 
@@ -150,15 +349,22 @@ func (m *TraceAffinityManager) cleanupLoop() {
 		select {
 		case <-ticker.C:
 			m.Cleanup()
+			if m.store != nil {
+				if _, err := m.store.CleanupTraceAffinities(time.Now().Add(-m.ttl)); err != nil {
+					log.Printf("[TraceAffinity-Cleanup] 警告: 清理过期亲和记录失败: %v", err)
+				}
+			}
 		case <-m.stopCh:
 			return
 		}
 	}
 }
 
-// Stop 停止清理 goroutine，释放资源
+// Stop 停止后台 goroutine，释放资源（启用持久化时会先写入剩余变更）
 func (m *TraceAffinityManager) Stop() {
 	close(m.stopCh)
+	m.wg.Wait()
+	m.Flush()
 }
 
 // Size 返回当前亲和记录数量
@@ -168,6 +374,13 @@ func (m *TraceAffinityManager) Size() int {
 	return len(m.affinity)
 }
 
+// IPAffinitySize 返回当前客户端 IP 亲和记录数量
+func (m *TraceAffinityManager) IPAffinitySize() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.ipAffinity)
+}
+
 // GetTTL 获取 TTL 设置
 func (m *TraceAffinityManager) GetTTL() time.Duration {
 	return m.ttl
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTraceAffinity_MaxAgeDropsContinuouslyUsedEntry 持续续期的会话在达到最大存活时间后也会被丢弃
+func TestTraceAffinity_MaxAgeDropsContinuouslyUsedEntry(t *testing.T) {
+	m := NewTraceAffinityManagerWithTTL(time.Minute)
+	defer m.Stop()
+	m.SetMaxAffinityAge(100 * time.Millisecond)
+
+	start := time.Now()
+	m.SetPreferredChannel("conv", 1)
+
+	// 模拟持续活跃的会话：每次请求先查询亲和，命中后续期并重新记录同一渠道
+	var droppedAfter time.Duration
+	for time.Since(start) < time.Second {
+		if _, ok := m.GetPreferredChannel("conv"); !ok {
+			droppedAfter = time.Since(start)
+			break
+		}
+		m.UpdateLastUsed("conv")
+		m.SetPreferredChannel("conv", 1)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if droppedAfter == 0 {
+		t.Fatal("超过最大存活时间的亲和记录即使持续使用也应被丢弃")
+	}
+	if droppedAfter < 100*time.Millisecond {
+		t.Fatalf("亲和记录在 %v 后被丢弃，早于最大存活时间", droppedAfter)
+	}
+	if cleaned := m.Cleanup(); cleaned != 1 || m.Size() != 0 {
+		t.Fatalf("Cleanup() = %d, size = %d, want 1, 0", cleaned, m.Size())
+	}
+
+	// 丢弃后重新选择的渠道重新开始计算存活时间
+	m.SetPreferredChannel("conv", 2)
+	if channel, ok := m.GetPreferredChannel("conv"); !ok || channel != 2 {
+		t.Fatalf("GetPreferredChannel() = (%d, %v), want (2, true)", channel, ok)
+	}
+}
+
+func TestTraceAffinity_MaxAgeResetsOnChannelChange(t *testing.T) {
+	m := NewTraceAffinityManagerWithTTL(time.Minute)
+	defer m.Stop()
+	m.SetMaxAffinityAge(80 * time.Millisecond)
+
+	m.SetPreferredChannel("conv", 1)
+	time.Sleep(50 * time.Millisecond)
+	m.SetPreferredChannel("conv", 2) // 切换渠道，绑定时间重新计算
+	time.Sleep(50 * time.Millisecond)
+
+	if channel, ok := m.GetPreferredChannel("conv"); !ok || channel != 2 {
+		t.Fatalf("GetPreferredChannel() = (%d, %v), want (2, true)", channel, ok)
+	}
+}
+
+func TestTraceAffinity_MaxAgeDisabledByDefault(t *testing.T) {
+	m := NewTraceAffinityManagerWithTTL(time.Minute)
+	defer m.Stop()
+	if m.GetMaxAffinityAge() != 0 {
+		t.Fatalf("默认最大存活时间 = %v, want 0", m.GetMaxAffinityAge())
+	}
+
+	m.SetPreferredChannel("conv", 1)
+	time.Sleep(20 * time.Millisecond)
+	m.SetPreferredChannel("conv", 1)
+	if channel, ok := m.GetPreferredChannel("conv"); !ok || channel != 1 {
+		t.Fatalf("GetPreferredChannel() = (%d, %v), want (1, true)", channel, ok)
+	}
+}
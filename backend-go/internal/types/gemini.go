@@ -139,6 +139,7 @@ type GeminiUsageMetadata struct {
 type GeminiStreamChunk struct {
 	Candidates    []GeminiCandidate    `json:"candidates,omitempty"`
 	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string               `json:"modelVersion,omitempty"`
 }
 
 // ============================================================================
@@ -4,20 +4,21 @@ package types
 
 // ResponsesRequest Responses API 请求
 type ResponsesRequest struct {
-	Model              string      `json:"model"`
-	Instructions       string      `json:"instructions,omitempty"` // 系统指令（映射为 system message）
-	Input              interface{} `json:"input"`                  // string 或 []ResponsesItem
-	PreviousResponseID string      `json:"previous_response_id,omitempty"`
-	Store              *bool       `json:"store,omitempty"`             // 默认 true
-	MaxTokens          int         `json:"max_tokens,omitempty"`        // 最大 tokens
-	Temperature        float64     `json:"temperature,omitempty"`       // 温度参数
-	TopP               float64     `json:"top_p,omitempty"`             // top_p 参数
-	FrequencyPenalty   float64     `json:"frequency_penalty,omitempty"` // 频率惩罚
-	PresencePenalty    float64     `json:"presence_penalty,omitempty"`  // 存在惩罚
-	Stream             bool        `json:"stream,omitempty"`            // 是否流式输出
-	Stop               interface{} `json:"stop,omitempty"`              // 停止序列 (string 或 []string)
-	User               string      `json:"user,omitempty"`              // 用户标识
-	StreamOptions      interface{} `json:"stream_options,omitempty"`    // 流式选项
+	Model              string              `json:"model"`
+	Instructions       string              `json:"instructions,omitempty"` // 系统指令（映射为 system message）
+	Input              interface{}         `json:"input"`                  // string 或 []ResponsesItem
+	PreviousResponseID string              `json:"previous_response_id,omitempty"`
+	Store              *bool               `json:"store,omitempty"`             // 默认 true
+	MaxTokens          int                 `json:"max_tokens,omitempty"`        // 最大 tokens
+	Temperature        float64             `json:"temperature,omitempty"`       // 温度参数
+	TopP               float64             `json:"top_p,omitempty"`             // top_p 参数
+	FrequencyPenalty   float64             `json:"frequency_penalty,omitempty"` // 频率惩罚
+	PresencePenalty    float64             `json:"presence_penalty,omitempty"`  // 存在惩罚
+	Stream             bool                `json:"stream,omitempty"`            // 是否流式输出
+	Stop               interface{}         `json:"stop,omitempty"`              // 停止序列 (string 或 []string)
+	User               string              `json:"user,omitempty"`              // 用户标识
+	StreamOptions      interface{}         `json:"stream_options,omitempty"`    // 流式选项
+	Reasoning          *ResponsesReasoning `json:"reasoning,omitempty"`         // 推理配置
 
 	// TransformerMetadata 转换器元数据（仅内存使用，不序列化）
 	// 用于在单次请求的转换流程中保留原始格式信息，如 system 数组格式等
@@ -25,6 +26,12 @@ type ResponsesRequest struct {
 	TransformerMetadata map[string]interface{} `json:"-"`
 }
 
+// ResponsesReasoning Responses API 推理配置
+type ResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`  // minimal, low, medium, high
+	Summary string `json:"summary,omitempty"` // auto, concise, detailed
+}
+
 // ResponsesItem Responses API 消息项
 type ResponsesItem struct {
 	Type    string      `json:"type"`           // message, text, tool_call, tool_result
@@ -77,6 +77,7 @@ type OpenAIRequest struct {
 	Stream              bool            `json:"stream,omitempty"`
 	Tools               []OpenAITool    `json:"tools,omitempty"`
 	ToolChoice          string          `json:"tool_choice,omitempty"`
+	ReasoningEffort     string          `json:"reasoning_effort,omitempty"`
 }
 
 // OpenAIMessage OpenAI 消息
@@ -137,6 +138,8 @@ type Usage struct {
 	CacheCreation5mInputTokens int    `json:"cache_creation_5m_input_tokens,omitempty"` // 5分钟 TTL
 	CacheCreation1hInputTokens int    `json:"cache_creation_1h_input_tokens,omitempty"` // 1小时 TTL
 	CacheTTL                   string `json:"cache_ttl,omitempty"`                      // "5m" | "1h" | "mixed"
+	// 扩展思考/推理 token 数：已包含在 OutputTokens 中（按输出价格计费），仅用于单独统计，不返回给客户端
+	ThinkingTokens int `json:"-"`
 	// OpenAI 兼容字段
 	PromptTokens     int `json:"prompt_tokens,omitempty"`
 	CompletionTokens int `json:"completion_tokens,omitempty"`
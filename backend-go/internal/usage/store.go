@@ -6,6 +6,46 @@ import (
 	"time"
 )
 
+// GroupBy 使用量聚合维度
+type GroupBy string
+
+const (
+	GroupByKey   GroupBy = "key"   // 按调用方 API Key
+	GroupByModel GroupBy = "model" // 按模型
+	GroupByDay   GroupBy = "day"   // 按本地日期（YYYY-MM-DD）
+)
+
+// ParseGroupBy 解析聚合维度，空字符串默认为 key
+func ParseGroupBy(raw string) (GroupBy, bool) {
+	switch GroupBy(raw) {
+	case "", GroupByKey:
+		return GroupByKey, true
+	case GroupByModel, GroupByDay:
+		return GroupBy(raw), true
+	}
+	return "", false
+}
+
+// Totals 聚合后的使用量
+type Totals struct {
+	Requests                 int64 `json:"requests"`
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	CostCents                int64 `json:"cost_cents"`
+}
+
+// Merge 累加另一份汇总
+func (t *Totals) Merge(other Totals) {
+	t.Requests += other.Requests
+	t.InputTokens += other.InputTokens
+	t.OutputTokens += other.OutputTokens
+	t.CacheCreationInputTokens += other.CacheCreationInputTokens
+	t.CacheReadInputTokens += other.CacheReadInputTokens
+	t.CostCents += other.CostCents
+}
+
 // Record 使用量记录
 type Record struct {
 	ID           string    `json:"id"`
@@ -16,13 +56,18 @@ type Record struct {
 	OutputTokens int       `json:"output_tokens"`
 	CostCents    int64     `json:"cost_cents"`
 	CreatedAt    time.Time `json:"created_at"`
+
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
 // Store 使用量存储
 type Store struct {
-	records []Record
-	mu      sync.RWMutex
-	maxSize int
+	records   []Record
+	mu        sync.RWMutex
+	maxSize   int
+	createdAt time.Time
+	evicted   bool // 是否已因容量上限淘汰过记录
 }
 
 // NewStore 创建使用量存储
@@ -31,8 +76,9 @@ func NewStore(maxSize int) *Store {
 		maxSize = 10000
 	}
 	return &Store{
-		records: make([]Record, 0, maxSize),
-		maxSize: maxSize,
+		records:   make([]Record, 0, maxSize),
+		maxSize:   maxSize,
+		createdAt: time.Now(),
 	}
 }
 
@@ -48,6 +94,7 @@ func (s *Store) Add(record Record) {
 	// 超过最大容量时移除最旧的记录
 	if len(s.records) >= s.maxSize {
 		s.records = s.records[1:]
+		s.evicted = true
 	}
 	s.records = append(s.records, record)
 }
@@ -99,6 +146,54 @@ func (s *Store) SumByAPIKey(apiKey string, since time.Time) (inputTokens, output
 	return
 }
 
+// CoveredSince 返回内存记录完整覆盖的起始时间：尚未淘汰过记录时为存储创建时间，否则为现存最旧记录的时间
+// 早于该时间的使用量需从其他来源（如 SQLite 请求记录）补齐
+func (s *Store) CoveredSince() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.evicted || len(s.records) == 0 {
+		return s.createdAt
+	}
+	return s.records[0].CreatedAt
+}
+
+// Query 按维度聚合 [from, to) 时间范围内的使用量，返回 分组键 -> 汇总
+func (s *Store) Query(from, to time.Time, groupBy GroupBy) map[string]*Totals {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]*Totals)
+	for _, r := range s.records {
+		if r.CreatedAt.Before(from) || !r.CreatedAt.Before(to) {
+			continue
+		}
+		var group string
+		switch groupBy {
+		case GroupByModel:
+			group = r.Model
+		case GroupByDay:
+			group = r.CreatedAt.Local().Format("2006-01-02")
+		default:
+			group = r.APIKey
+		}
+		totals, ok := result[group]
+		if !ok {
+			totals = &Totals{}
+			result[group] = totals
+		}
+		totals.Merge(Totals{
+			Requests:                 1,
+			InputTokens:              int64(r.InputTokens),
+			OutputTokens:             int64(r.OutputTokens),
+			CacheCreationInputTokens: int64(r.CacheCreationInputTokens),
+			CacheReadInputTokens:     int64(r.CacheReadInputTokens),
+			CostCents:                r.CostCents,
+		})
+	}
+	return result
+}
+
 // Count 返回记录总数
 func (s *Store) Count() int {
 	s.mu.RLock()
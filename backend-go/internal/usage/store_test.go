@@ -115,3 +115,63 @@ func TestNewStore_DefaultMaxSize(t *testing.T) {
 		t.Errorf("NewStore(-1) maxSize = %v, want 10000", store.maxSize)
 	}
 }
+
+func TestStore_Query(t *testing.T) {
+	store := NewStore(100)
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+
+	store.Add(Record{APIKey: "team-a", Model: "m1", InputTokens: 100, OutputTokens: 10, CacheReadInputTokens: 50, CostCents: 3, CreatedAt: base})
+	store.Add(Record{APIKey: "team-a", Model: "m2", InputTokens: 200, OutputTokens: 20, CacheCreationInputTokens: 30, CostCents: 5, CreatedAt: base.Add(time.Hour)})
+	store.Add(Record{APIKey: "team-b", Model: "m1", InputTokens: 300, OutputTokens: 30, CostCents: 7, CreatedAt: base.Add(24 * time.Hour)})
+
+	byKey := store.Query(base, base.Add(48*time.Hour), GroupByKey)
+	if got := *byKey["team-a"]; got != (Totals{Requests: 2, InputTokens: 300, OutputTokens: 30, CacheCreationInputTokens: 30, CacheReadInputTokens: 50, CostCents: 8}) {
+		t.Errorf("team-a totals = %+v", got)
+	}
+	if byKey["team-b"].Requests != 1 {
+		t.Errorf("team-b requests = %d, want 1", byKey["team-b"].Requests)
+	}
+
+	byModel := store.Query(base, base.Add(48*time.Hour), GroupByModel)
+	if byModel["m1"].InputTokens != 400 || byModel["m2"].InputTokens != 200 {
+		t.Errorf("by model = m1:%+v m2:%+v", byModel["m1"], byModel["m2"])
+	}
+
+	byDay := store.Query(base, base.Add(48*time.Hour), GroupByDay)
+	if byDay["2026-10-01"].Requests != 2 || byDay["2026-10-02"].Requests != 1 {
+		t.Errorf("by day = %v", byDay)
+	}
+
+	// to 为开区间
+	if got := store.Query(base, base.Add(time.Hour), GroupByKey); len(got) != 1 || got["team-a"].Requests != 1 {
+		t.Errorf("Query([base, base+1h)) = %v", got)
+	}
+}
+
+func TestStore_CoveredSince(t *testing.T) {
+	store := NewStore(2)
+	created := store.CoveredSince()
+
+	base := time.Now()
+	store.Add(Record{ID: "1", CreatedAt: base.Add(time.Second)})
+	store.Add(Record{ID: "2", CreatedAt: base.Add(2 * time.Second)})
+	if !store.CoveredSince().Equal(created) {
+		t.Errorf("未淘汰记录时应覆盖自创建时间起的全部数据")
+	}
+
+	store.Add(Record{ID: "3", CreatedAt: base.Add(3 * time.Second)})
+	if got := store.CoveredSince(); !got.Equal(base.Add(2 * time.Second)) {
+		t.Errorf("CoveredSince() = %v, want 最旧的现存记录时间", got)
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	for raw, want := range map[string]GroupBy{"": GroupByKey, "key": GroupByKey, "model": GroupByModel, "day": GroupByDay} {
+		if got, ok := ParseGroupBy(raw); !ok || got != want {
+			t.Errorf("ParseGroupBy(%q) = %q, %v", raw, got, ok)
+		}
+	}
+	if _, ok := ParseGroupBy("user"); ok {
+		t.Errorf("ParseGroupBy(user) 应失败")
+	}
+}
@@ -18,6 +18,12 @@ func PrepareUpstreamHeaders(c *gin.Context, targetHost string) http.Header {
 
 	// 移除代理相关头部
 	headers.Del("x-proxy-key")
+	// 移除代理控制头部（X-Proxy-*，如 X-Proxy-Exclude-Low-Quality），避免泄露给上游
+	for key := range headers {
+		if strings.HasPrefix(http.CanonicalHeaderKey(key), "X-Proxy-") {
+			headers.Del(key)
+		}
+	}
 	headers.Del("X-Forwarded-Host")
 	headers.Del("X-Forwarded-Proto")
 
@@ -35,6 +35,19 @@ func TestPrepareUpstreamHeaders(t *testing.T) {
 				"X-Forwarded-Proto": false,
 			},
 		},
+		{
+			name: "移除代理控制头部",
+			headers: map[string]string{
+				"Content-Type":                "application/json",
+				"X-Proxy-Exclude-Low-Quality": "true",
+			},
+			targetHost: "upstream.api.com",
+			wantHost:   "upstream.api.com",
+			shouldExist: map[string]bool{
+				"Content-Type":                true,
+				"X-Proxy-Exclude-Low-Quality": false,
+			},
+		},
 		{
 			name: "保留其他头部",
 			headers: map[string]string{
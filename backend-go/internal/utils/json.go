@@ -739,13 +739,16 @@ func FormatJSONBytesForLog(jsonData []byte, maxTextLength int) string {
 	if err := json.Unmarshal(jsonData, &data); err != nil {
 		// 如果不是有效JSON,按字符串处理
 		str := string(jsonData)
+		if redactContent.Load() {
+			return RedactPIIForLog(RedactedPlaceholder(str))
+		}
 		if len(str) > 500 {
-			return str[:500] + "..."
+			str = str[:500] + "..."
 		}
-		return str
+		return RedactPIIForLog(str)
 	}
 
-	return FormatJSONForLog(data, maxTextLength)
+	return RedactPIIForLog(FormatJSONForLog(RedactJSONForLog(data), maxTextLength))
 }
 
 // MaskSensitiveHeaders 脱敏敏感请求头
@@ -791,6 +794,7 @@ func MaskAPIKey(key string) string {
 }
 
 // FormatJSONBytesRaw 原始输出JSON字节数组（不缩进、不截断、不重排序）
+// 开启日志脱敏时输出脱敏后的内容
 func FormatJSONBytesRaw(jsonData []byte) string {
-	return string(jsonData)
+	return RedactBodyForLog(jsonData)
 }
@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateJSONSchema 使用 JSON Schema 校验数据（实现常用子集）
+// 支持: type, enum, const, properties, required, additionalProperties, items,
+// minItems/maxItems, minLength/maxLength, pattern, minimum/maximum,
+// exclusiveMinimum/exclusiveMaximum, allOf/anyOf/oneOf/not
+// schema 与 instance 均为 encoding/json 解码后的通用结构（map/slice/float64 等）
+func ValidateJSONSchema(schema interface{}, instance interface{}) error {
+	return validateSchemaAt(schema, instance, "$")
+}
+
+// ParseJSONSchema 解析 JSON Schema 文本，要求顶层为对象
+func ParseJSONSchema(raw []byte) (map[string]interface{}, error) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("JSON Schema 解析失败: %w", err)
+	}
+	if schema == nil {
+		return nil, fmt.Errorf("JSON Schema 必须是对象")
+	}
+	return schema, nil
+}
+
+func validateSchemaAt(schema interface{}, instance interface{}, path string) error {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return fmt.Errorf("%s: 不允许出现该值", path)
+		}
+		return nil
+	case map[string]interface{}:
+		return validateSchemaObject(s, instance, path)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("%s: 无效的 schema 定义", path)
+	}
+}
+
+func validateSchemaObject(schema map[string]interface{}, instance interface{}, path string) error {
+	if t, ok := schema["type"]; ok {
+		if err := validateSchemaType(t, instance, path); err != nil {
+			return err
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, candidate := range enum {
+			if jsonValuesEqual(candidate, instance) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: 值不在 enum 允许范围内", path)
+		}
+	}
+	if constVal, ok := schema["const"]; ok && !jsonValuesEqual(constVal, instance) {
+		return fmt.Errorf("%s: 值与 const 不一致", path)
+	}
+
+	switch v := instance.(type) {
+	case map[string]interface{}:
+		if err := validateSchemaProperties(schema, v, path); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := validateSchemaItems(schema, v, path); err != nil {
+			return err
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if min, ok := schemaNumber(schema, "minLength"); ok && float64(length) < min {
+			return fmt.Errorf("%s: 字符串长度 %d 小于 minLength %v", path, length, min)
+		}
+		if max, ok := schemaNumber(schema, "maxLength"); ok && float64(length) > max {
+			return fmt.Errorf("%s: 字符串长度 %d 大于 maxLength %v", path, length, max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: 无效的 pattern %q: %v", path, pattern, err)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s: 字符串不匹配 pattern %q", path, pattern)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(schema, "minimum"); ok && v < min {
+			return fmt.Errorf("%s: 数值 %v 小于 minimum %v", path, v, min)
+		}
+		if max, ok := schemaNumber(schema, "maximum"); ok && v > max {
+			return fmt.Errorf("%s: 数值 %v 大于 maximum %v", path, v, max)
+		}
+		if min, ok := schemaNumber(schema, "exclusiveMinimum"); ok && v <= min {
+			return fmt.Errorf("%s: 数值 %v 不大于 exclusiveMinimum %v", path, v, min)
+		}
+		if max, ok := schemaNumber(schema, "exclusiveMaximum"); ok && v >= max {
+			return fmt.Errorf("%s: 数值 %v 不小于 exclusiveMaximum %v", path, v, max)
+		}
+	}
+
+	return validateSchemaCombinators(schema, instance, path)
+}
+
+func validateSchemaProperties(schema map[string]interface{}, obj map[string]interface{}, path string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, exists := obj[name]; name != "" && !exists {
+				return fmt.Errorf("%s: 缺少必需字段 %q", path, name)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	for name, value := range obj {
+		childPath := path + "." + name
+		if propSchema, ok := properties[name]; ok {
+			if err := validateSchemaAt(propSchema, value, childPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if additional, ok := schema["additionalProperties"]; ok {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				return fmt.Errorf("%s: 不允许的字段 %q", path, name)
+			}
+			if err := validateSchemaAt(additional, value, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateSchemaItems(schema map[string]interface{}, arr []interface{}, path string) error {
+	if min, ok := schemaNumber(schema, "minItems"); ok && float64(len(arr)) < min {
+		return fmt.Errorf("%s: 数组长度 %d 小于 minItems %v", path, len(arr), min)
+	}
+	if max, ok := schemaNumber(schema, "maxItems"); ok && float64(len(arr)) > max {
+		return fmt.Errorf("%s: 数组长度 %d 大于 maxItems %v", path, len(arr), max)
+	}
+	if items, ok := schema["items"]; ok {
+		for i, item := range arr {
+			if err := validateSchemaAt(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateSchemaCombinators(schema map[string]interface{}, instance interface{}, path string) error {
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			if err := validateSchemaAt(sub, instance, path); err != nil {
+				return err
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if validateSchemaAt(sub, instance, path) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: 不满足 anyOf 中的任何 schema", path)
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if validateSchemaAt(sub, instance, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: 应恰好满足 oneOf 中的一个 schema（实际 %d 个）", path, matches)
+		}
+	}
+	if not, ok := schema["not"]; ok {
+		if validateSchemaAt(not, instance, path) == nil {
+			return fmt.Errorf("%s: 不应满足 not 中的 schema", path)
+		}
+	}
+	return nil
+}
+
+func validateSchemaType(t interface{}, instance interface{}, path string) error {
+	var allowed []string
+	switch v := t.(type) {
+	case string:
+		allowed = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				allowed = append(allowed, s)
+			}
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	actual := jsonTypeOf(instance)
+	for _, a := range allowed {
+		if a == actual || (a == "number" && actual == "integer") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: 类型应为 %s，实际为 %s", path, strings.Join(allowed, "|"), actual)
+}
+
+// jsonTypeOf 返回 JSON Schema 类型名（整数值的 float64 视为 integer）
+func jsonTypeOf(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func jsonValuesEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
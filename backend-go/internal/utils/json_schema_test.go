@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateJSONSchema(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(`{
+		"type": "object",
+		"required": ["name", "tags"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"kind": {"enum": ["a", "b"]},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseJSONSchema: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr bool
+	}{
+		{"conforming", `{"name":"x","age":3,"kind":"a","tags":["t"]}`, false},
+		{"missing required", `{"name":"x"}`, true},
+		{"wrong type", `{"name":1,"tags":[]}`, true},
+		{"non integer", `{"name":"x","age":1.5,"tags":[]}`, true},
+		{"below minimum", `{"name":"x","age":-1,"tags":[]}`, true},
+		{"enum mismatch", `{"name":"x","kind":"c","tags":[]}`, true},
+		{"extra field", `{"name":"x","tags":[],"extra":true}`, true},
+		{"bad item", `{"name":"x","tags":[1]}`, true},
+		{"too many items", `{"name":"x","tags":["a","b","c"]}`, true},
+		{"empty string", `{"name":"","tags":[]}`, true},
+	}
+	for _, tt := range tests {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(tt.doc), &doc); err != nil {
+			t.Fatalf("%s: unmarshal: %v", tt.name, err)
+		}
+		err := ValidateJSONSchema(schema, doc)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err=%v, wantErr=%v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateJSONSchema_Combinators(t *testing.T) {
+	var schema map[string]interface{}
+	_ = json.Unmarshal([]byte(`{"anyOf":[{"type":"string"},{"type":"number","exclusiveMaximum":10}]}`), &schema)
+
+	if err := ValidateJSONSchema(schema, "ok"); err != nil {
+		t.Errorf("string should match anyOf: %v", err)
+	}
+	if err := ValidateJSONSchema(schema, float64(5)); err != nil {
+		t.Errorf("5 should match anyOf: %v", err)
+	}
+	if err := ValidateJSONSchema(schema, float64(10)); err == nil {
+		t.Error("10 should not match anyOf")
+	}
+}
+
+func TestParseJSONSchema_RejectsNonObject(t *testing.T) {
+	for _, raw := range []string{`null`, `[1]`, `not json`} {
+		if _, err := ParseJSONSchema([]byte(raw)); err == nil {
+			t.Errorf("ParseJSONSchema(%s) should fail", raw)
+		}
+	}
+}
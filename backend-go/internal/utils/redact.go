@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// ============== 日志脱敏 ==============
+//
+// 两层相互独立的脱敏，作用于所有请求/响应日志格式化函数与流式合成日志：
+//   - 内容脱敏（LOG_REDACT）：消息文本、工具参数等替换为 [REDACTED:<n chars>]，
+//     保留 JSON 结构（role、model、type、工具名、ID、usage 等）以便排查问题
+//   - PII 正则脱敏（LOG_REDACT_PII）：对最终日志文本中的邮箱、银行卡号做替换，
+//     未开启内容脱敏时同样生效
+
+var (
+	redactContent atomic.Bool
+	redactPII     atomic.Bool
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	cardPattern  = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+)
+
+// contentKeys 值为字符串时视为用户/模型内容的字段；值为数组/对象时继续递归
+var contentKeys = map[string]bool{
+	"text":         true,
+	"thinking":     true,
+	"content":      true,
+	"system":       true,
+	"instructions": true,
+	"prompt":       true,
+	"input":        true,
+	"output":       true,
+	"delta":        true,
+	"partial_json": true,
+	"arguments":    true,
+	"refusal":      true,
+	"data":         true,
+}
+
+// SetLogRedaction 设置日志脱敏开关（启动时根据 LOG_REDACT / LOG_REDACT_PII 调用）
+func SetLogRedaction(content, pii bool) {
+	redactContent.Store(content)
+	redactPII.Store(pii)
+}
+
+// RedactedPlaceholder 返回内容的脱敏占位符，只保留字符数
+func RedactedPlaceholder(s string) string {
+	return fmt.Sprintf("[REDACTED:%d chars]", utf8.RuneCountInString(s))
+}
+
+// RedactJSONForLog 对已解析的 JSON 做内容脱敏（未开启 LOG_REDACT 时原样返回）
+func RedactJSONForLog(data interface{}) interface{} {
+	if !redactContent.Load() {
+		return data
+	}
+	return redactContentValue(data)
+}
+
+// RedactPIIForLog 对日志文本做 PII 正则脱敏（未开启 LOG_REDACT_PII 时原样返回）
+func RedactPIIForLog(s string) string {
+	if !redactPII.Load() || s == "" {
+		return s
+	}
+	s = emailPattern.ReplaceAllString(s, "[REDACTED:email]")
+	return cardPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if luhnValid(match) {
+			return "[REDACTED:card]"
+		}
+		return match
+	})
+}
+
+// RedactBodyForLog 对请求/响应体做完整脱敏后返回日志文本
+// 开启内容脱敏时 JSON 会重新序列化（字段顺序按键名排列），非 JSON 内容整体替换为占位符
+func RedactBodyForLog(body []byte) string {
+	s := string(body)
+	if redactContent.Load() {
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			s = RedactedPlaceholder(s)
+		} else if redacted, err := json.Marshal(redactContentValue(data)); err == nil {
+			s = string(redacted)
+		} else {
+			s = RedactedPlaceholder(s)
+		}
+	}
+	return RedactPIIForLog(s)
+}
+
+// RedactSSEForLog 对原始 SSE 文本逐行脱敏：data 行按 JSON 处理，其余行（event:、注释）保留
+func RedactSSEForLog(s string) string {
+	if !redactContent.Load() {
+		return RedactPIIForLog(s)
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		payload, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		payload = strings.TrimSpace(payload)
+		if payload == "" || payload == "[DONE]" {
+			continue
+		}
+		lines[i] = "data: " + RedactBodyForLog([]byte(payload))
+	}
+	return RedactPIIForLog(strings.Join(lines, "\n"))
+}
+
+// redactContentValue 递归脱敏：contentKeys 中的字符串替换为占位符，
+// 工具调用参数（tool_use.input、functionCall.args、functionResponse.response）的所有字符串叶子替换为占位符
+func redactContentValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			out[k] = redactContentField(k, child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			out[i] = redactContentValue(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func redactContentField(key string, v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		if contentKeys[key] {
+			return RedactedPlaceholder(s)
+		}
+		return s
+	}
+	switch key {
+	case "args":
+		return redactAllStrings(v)
+	case "input":
+		// tool_use.input 为对象（工具参数）；Responses 的 input 为数组（消息列表）
+		if _, isObject := v.(map[string]interface{}); isObject {
+			return redactAllStrings(v)
+		}
+	case "functionResponse":
+		if m, isObject := v.(map[string]interface{}); isObject {
+			out := make(map[string]interface{}, len(m))
+			for k, child := range m {
+				if k == "response" {
+					out[k] = redactAllStrings(child)
+				} else {
+					out[k] = child
+				}
+			}
+			return out
+		}
+	}
+	return redactContentValue(v)
+}
+
+// redactAllStrings 保留键与非字符串值，替换所有字符串叶子
+func redactAllStrings(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return RedactedPlaceholder(val)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			out[k] = redactAllStrings(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			out[i] = redactAllStrings(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// luhnValid 银行卡号 Luhn 校验，减少时间戳等长数字的误判
+func luhnValid(s string) bool {
+	sum, count := 0, 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		count++
+		double = !double
+	}
+	return count >= 13 && sum%10 == 0
+}
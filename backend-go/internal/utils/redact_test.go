@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func withLogRedaction(t *testing.T, content, pii bool) {
+	t.Helper()
+	SetLogRedaction(content, pii)
+	t.Cleanup(func() { SetLogRedaction(false, false) })
+}
+
+func TestRedactBodyForLog_PreservesStructure(t *testing.T) {
+	withLogRedaction(t, true, false)
+
+	body := `{"model":"claude-sonnet-4","system":"you are helpful","messages":[` +
+		`{"role":"user","content":"my secret"},` +
+		`{"role":"assistant","content":[{"type":"text","text":"héllo"},{"type":"tool_use","id":"tu_1","name":"lookup","input":{"q":"alice","limit":3}}]}],` +
+		`"tools":[{"name":"lookup","description":"Look up a user"}],"usage":{"input_tokens":12}}`
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(RedactBodyForLog([]byte(body))), &got); err != nil {
+		t.Fatalf("redacted body is not JSON: %v", err)
+	}
+
+	if got["model"] != "claude-sonnet-4" || got["system"] != "[REDACTED:15 chars]" {
+		t.Fatalf("model/system = %v / %v", got["model"], got["system"])
+	}
+	messages := got["messages"].([]any)
+	user := messages[0].(map[string]any)
+	if user["role"] != "user" || user["content"] != "[REDACTED:9 chars]" {
+		t.Fatalf("user message = %v", user)
+	}
+	blocks := messages[1].(map[string]any)["content"].([]any)
+	if text := blocks[0].(map[string]any); text["type"] != "text" || text["text"] != "[REDACTED:5 chars]" {
+		t.Fatalf("text block = %v", text)
+	}
+	tool := blocks[1].(map[string]any)
+	input := tool["input"].(map[string]any)
+	if tool["name"] != "lookup" || tool["id"] != "tu_1" || input["q"] != "[REDACTED:5 chars]" || input["limit"] != float64(3) {
+		t.Fatalf("tool_use block = %v", tool)
+	}
+	if desc := got["tools"].([]any)[0].(map[string]any)["description"]; desc != "Look up a user" {
+		t.Fatalf("tool definitions should be kept, got %v", desc)
+	}
+	if tokens := got["usage"].(map[string]any)["input_tokens"]; tokens != float64(12) {
+		t.Fatalf("usage should be kept, got %v", tokens)
+	}
+}
+
+func TestRedactBodyForLog_GeminiAndResponses(t *testing.T) {
+	withLogRedaction(t, true, false)
+
+	gemini := RedactBodyForLog([]byte(`{"contents":[{"role":"user","parts":[{"text":"hi"},{"functionCall":{"name":"f","args":{"city":"Paris"}}},{"functionResponse":{"name":"f","response":{"temp":"20C"}}}]}]}`))
+	for _, leaked := range []string{`"hi"`, "Paris", "20C"} {
+		if strings.Contains(gemini, leaked) {
+			t.Fatalf("gemini body leaked %q: %s", leaked, gemini)
+		}
+	}
+	if !strings.Contains(gemini, `"name":"f"`) || !strings.Contains(gemini, `"role":"user"`) {
+		t.Fatalf("gemini structure lost: %s", gemini)
+	}
+
+	responses := RedactBodyForLog([]byte(`{"model":"gpt-5","instructions":"be brief","input":[{"type":"message","role":"user","content":[{"type":"input_text","text":"question"}]},{"type":"function_call","name":"run","arguments":"{\"cmd\":\"ls\"}"}]}`))
+	for _, leaked := range []string{"be brief", "question", "ls"} {
+		if strings.Contains(responses, leaked) {
+			t.Fatalf("responses body leaked %q: %s", leaked, responses)
+		}
+	}
+	if !strings.Contains(responses, `"name":"run"`) || !strings.Contains(responses, `"type":"input_text"`) {
+		t.Fatalf("responses structure lost: %s", responses)
+	}
+
+	if got := RedactBodyForLog([]byte("plain secret")); got != "[REDACTED:12 chars]" {
+		t.Fatalf("non-JSON body = %q", got)
+	}
+}
+
+func TestRedactPIIForLog(t *testing.T) {
+	withLogRedaction(t, false, true)
+
+	in := `contact bob.smith@example.co.uk, card 4111 1111 1111 1111, ts 1712345678901, id 4111111111111112`
+	got := RedactPIIForLog(in)
+	if strings.Contains(got, "bob.smith") || !strings.Contains(got, "[REDACTED:email]") {
+		t.Fatalf("email not redacted: %s", got)
+	}
+	if strings.Contains(got, "4111 1111 1111 1111") || !strings.Contains(got, "[REDACTED:card]") {
+		t.Fatalf("card not redacted: %s", got)
+	}
+	if !strings.Contains(got, "1712345678901") || !strings.Contains(got, "4111111111111112") {
+		t.Fatalf("non-Luhn numbers should be kept: %s", got)
+	}
+
+	// PII 脱敏独立于内容脱敏，对格式化后的请求体同样生效
+	formatted := FormatJSONBytesForLog([]byte(`{"messages":[{"role":"user","content":"mail a@b.io"}]}`), 500)
+	if strings.Contains(formatted, "a@b.io") || !strings.Contains(formatted, "mail [REDACTED:email]") {
+		t.Fatalf("formatted body = %s", formatted)
+	}
+}
+
+func TestRedaction_DisabledByDefault(t *testing.T) {
+	SetLogRedaction(false, false)
+	body := []byte(`{"messages":[{"role":"user","content":"a@b.io"}]}`)
+	if got := FormatJSONBytesRaw(body); got != string(body) {
+		t.Fatalf("raw output changed without redaction: %s", got)
+	}
+	if got := RedactSSEForLog("data: {\"text\":\"x\"}\n"); got != "data: {\"text\":\"x\"}\n" {
+		t.Fatalf("SSE output changed without redaction: %q", got)
+	}
+}
+
+func TestRedactSSEForLog(t *testing.T) {
+	withLogRedaction(t, true, false)
+
+	raw := "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"secret\"}}\n\ndata: [DONE]\n"
+	got := RedactSSEForLog(raw)
+	if strings.Contains(got, "secret") || !strings.Contains(got, "event: content_block_delta") ||
+		!strings.Contains(got, `"type":"text_delta"`) || !strings.Contains(got, "data: [DONE]") {
+		t.Fatalf("redacted SSE = %q", got)
+	}
+}
+
+func TestStreamSynthesizer_Redacted(t *testing.T) {
+	withLogRedaction(t, true, false)
+
+	s := NewStreamSynthesizer("claude")
+	for _, line := range []string{
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"top secret"}}`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"tu_1","name":"lookup","input":{}}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":\"alice\"}"}}`,
+		`data: {"type":"content_block_stop","index":1}`,
+	} {
+		s.ProcessLine(line)
+	}
+
+	got := s.GetSynthesizedContent()
+	if strings.Contains(got, "top secret") || strings.Contains(got, "alice") {
+		t.Fatalf("synthesized content leaked: %s", got)
+	}
+	if !strings.Contains(got, "[REDACTED:10 chars]") || !strings.Contains(got, "lookup(") || !strings.Contains(got, "tu_1") {
+		t.Fatalf("synthesized content lost structure: %s", got)
+	}
+}
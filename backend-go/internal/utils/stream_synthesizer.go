@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -230,16 +231,16 @@ func (s *StreamSynthesizer) processGemini(data map[string]interface{}) {
 			s.synthesizedContent.WriteString(text)
 		}
 
-		// 函数调用
+		// 函数调用：Gemini 每个 functionCall part 携带完整参数（无增量），按出现顺序累积
 		if functionCall, ok := partMap["functionCall"].(map[string]interface{}); ok {
 			name, _ := functionCall["name"].(string)
-			args, _ := functionCall["args"]
-			argsJSON, _ := json.Marshal(args)
-			s.synthesizedContent.WriteString("\nTool Call: ")
-			s.synthesizedContent.WriteString(name)
-			s.synthesizedContent.WriteString("(")
-			s.synthesizedContent.Write(argsJSON)
-			s.synthesizedContent.WriteString(")")
+			id, _ := functionCall["id"].(string)
+			args := "{}"
+			if rawArgs, ok := functionCall["args"]; ok && rawArgs != nil {
+				argsJSON, _ := json.Marshal(rawArgs)
+				args = string(argsJSON)
+			}
+			s.toolCallAccumulator[len(s.toolCallAccumulator)] = &ToolCall{ID: id, Name: name, Arguments: args}
 		}
 	}
 }
@@ -398,6 +399,7 @@ func (s *StreamSynthesizer) processClaude(data map[string]interface{}) {
 }
 
 // GetSynthesizedContent 获取合成的内容
+// 开启日志脱敏时文本与工具参数替换为占位符，工具名与 ID 保留
 func (s *StreamSynthesizer) GetSynthesizedContent() string {
 	// 不再完全失败，即使有解析错误也返回部分结果
 	var result string
@@ -424,11 +426,20 @@ func (s *StreamSynthesizer) GetSynthesizedContent() string {
 	} else {
 		result = s.synthesizedContent.String()
 	}
+	if redactContent.Load() && result != "" {
+		result = RedactedPlaceholder(result)
+	}
 
 	// 添加工具调用信息
 	if len(s.toolCallAccumulator) > 0 {
 		var toolCallsBuilder strings.Builder
-		for index, tool := range s.toolCallAccumulator {
+		indexes := make([]int, 0, len(s.toolCallAccumulator))
+		for index := range s.toolCallAccumulator {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		for _, index := range indexes {
+			tool := s.toolCallAccumulator[index]
 			args := tool.Arguments
 			if args == "" {
 				args = "{}"
@@ -441,7 +452,7 @@ func (s *StreamSynthesizer) GetSynthesizedContent() string {
 
 			id := tool.ID
 			if id == "" {
-				id = "tool_" + string(rune(index))
+				id = "tool_" + strconv.Itoa(index)
 			}
 
 			toolCallsBuilder.WriteString("\nTool Call: ")
@@ -451,8 +462,13 @@ func (s *StreamSynthesizer) GetSynthesizedContent() string {
 			// 尝试格式化JSON
 			var parsedArgs interface{}
 			if err := json.Unmarshal([]byte(args), &parsedArgs); err == nil {
+				if redactContent.Load() {
+					parsedArgs = redactAllStrings(parsedArgs)
+				}
 				prettyArgs, _ := json.Marshal(parsedArgs)
 				toolCallsBuilder.Write(prettyArgs)
+			} else if redactContent.Load() {
+				toolCallsBuilder.WriteString(RedactedPlaceholder(args))
 			} else {
 				toolCallsBuilder.WriteString(args)
 			}
@@ -465,7 +481,7 @@ func (s *StreamSynthesizer) GetSynthesizedContent() string {
 		result += toolCallsBuilder.String()
 	}
 
-	return result
+	return RedactPIIForLog(result)
 }
 
 // IsParseFailed 检查解析是否失败
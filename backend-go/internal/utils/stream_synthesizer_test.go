@@ -0,0 +1,25 @@
+package utils
+
+import "testing"
+
+func TestStreamSynthesizer_GeminiFunctionCalls(t *testing.T) {
+	s := NewStreamSynthesizer("gemini")
+	for _, line := range []string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Let me check "},{"text":"both."}]}}]}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}},{"functionCall":{"id":"call_2","name":"get_time","args":{"tz":"CET"}}}]}}]}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"ping"}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10}}`,
+	} {
+		s.ProcessLine(line)
+	}
+
+	if !s.HasToolCalls() {
+		t.Fatalf("HasToolCalls() = false, want true")
+	}
+	want := "Let me check both." +
+		"\nTool Call: get_weather({\"city\":\"Paris\"}) [ID: tool_0]" +
+		"\nTool Call: get_time({\"tz\":\"CET\"}) [ID: call_2]" +
+		"\nTool Call: ping({}) [ID: tool_2]"
+	if got := s.GetSynthesizedContent(); got != want {
+		t.Fatalf("GetSynthesizedContent() =\n%s\nwant\n%s", got, want)
+	}
+}
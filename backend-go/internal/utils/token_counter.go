@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"strings"
 	"unicode"
 
 	"github.com/BenedictKing/claude-proxy/internal/types"
@@ -327,3 +328,60 @@ func estimateResponsesItemTokens(item types.ResponsesItem) int {
 
 	return total
 }
+
+// ============== Gemini API Token 估算 ==============
+
+// GeminiPartsText 提取 Gemini parts 中用于估算的文本：text 内容、functionCall 的函数名与参数 JSON、
+// functionResponse 的函数名与响应 JSON（inlineData/fileData 等二进制内容不计入）
+func GeminiPartsText(parts []types.GeminiPart) string {
+	var b strings.Builder
+	for _, part := range parts {
+		if part.Text != "" {
+			b.WriteString(part.Text)
+			b.WriteString("\n")
+		}
+		if part.FunctionCall != nil {
+			b.WriteString(part.FunctionCall.Name)
+			if args, err := json.Marshal(part.FunctionCall.Args); err == nil {
+				b.Write(args)
+			}
+			b.WriteString("\n")
+		}
+		if part.FunctionResponse != nil {
+			b.WriteString(part.FunctionResponse.Name)
+			if resp, err := json.Marshal(part.FunctionResponse.Response); err == nil {
+				b.Write(resp)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// EstimateGeminiRequestTokens 估算 Gemini 请求的输入 token
+// 包含 systemInstruction、contents（文本与函数调用/响应）以及 functionDeclarations 的名称、描述与参数 schema
+func EstimateGeminiRequestTokens(req *types.GeminiRequest) int {
+	if req == nil {
+		return 0
+	}
+
+	total := 0
+	if req.SystemInstruction != nil {
+		total += EstimateTokens(GeminiPartsText(req.SystemInstruction.Parts))
+	}
+	for _, content := range req.Contents {
+		// 每条消息额外开销约 4 tokens
+		total += EstimateTokens(GeminiPartsText(content.Parts)) + 4
+	}
+	for _, tool := range req.Tools {
+		for _, decl := range tool.FunctionDeclarations {
+			total += EstimateTokens(decl.Name + " " + decl.Description)
+			if decl.Parameters != nil {
+				if params, err := json.Marshal(decl.Parameters); err == nil {
+					total += EstimateTokens(string(params))
+				}
+			}
+		}
+	}
+	return total
+}
@@ -223,3 +223,46 @@ func TestEstimateRequestTokens(t *testing.T) {
 		})
 	}
 }
+
+func TestEstimateGeminiRequestTokens(t *testing.T) {
+	base := &types.GeminiRequest{
+		Contents: []types.GeminiContent{{Role: "user", Parts: []types.GeminiPart{{Text: "What is the weather in Paris?"}}}},
+	}
+	withTools := &types.GeminiRequest{
+		SystemInstruction: &types.GeminiContent{Parts: []types.GeminiPart{{Text: "You are a helpful assistant."}}},
+		Contents: []types.GeminiContent{
+			{Role: "user", Parts: []types.GeminiPart{{Text: "What is the weather in Paris?"}}},
+			{Role: "model", Parts: []types.GeminiPart{{FunctionCall: &types.GeminiFunctionCall{Name: "get_weather", Args: map[string]interface{}{"city": "Paris"}}}}},
+			{Role: "user", Parts: []types.GeminiPart{{FunctionResponse: &types.GeminiFunctionResponse{Name: "get_weather", Response: map[string]interface{}{"forecast": "sunny, 24 degrees"}}}}},
+		},
+		Tools: []types.GeminiTool{{FunctionDeclarations: []types.GeminiFunctionDeclaration{{
+			Name:        "get_weather",
+			Description: "Get the current weather for a city",
+			Parameters:  map[string]interface{}{"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}}},
+		}}}},
+	}
+
+	if got := EstimateGeminiRequestTokens(nil); got != 0 {
+		t.Fatalf("nil request = %d, want 0", got)
+	}
+	baseTokens := EstimateGeminiRequestTokens(base)
+	if baseTokens <= 0 {
+		t.Fatalf("base request = %d, want > 0", baseTokens)
+	}
+	// 系统指令、函数调用/响应与函数声明均应计入
+	if got := EstimateGeminiRequestTokens(withTools); got <= baseTokens+20 {
+		t.Fatalf("request with tools = %d, want well above %d", got, baseTokens)
+	}
+}
+
+func TestGeminiPartsText(t *testing.T) {
+	text := GeminiPartsText([]types.GeminiPart{
+		{Text: "checking"},
+		{FunctionCall: &types.GeminiFunctionCall{Name: "get_weather", Args: map[string]interface{}{"city": "Paris"}}},
+		{InlineData: &types.GeminiInlineData{MimeType: "image/png", Data: "aGVsbG8="}},
+	})
+	want := "checking\nget_weather{\"city\":\"Paris\"}\n"
+	if text != want {
+		t.Fatalf("GeminiPartsText = %q, want %q", text, want)
+	}
+}
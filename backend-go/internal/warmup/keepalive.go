@@ -0,0 +1,155 @@
+package warmup
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/httpclient"
+)
+
+// KeepaliveTarget 连接保活目标（渠道的一个 BaseURL）
+type KeepaliveTarget struct {
+	BaseURL            string
+	InsecureSkipVerify bool
+	ProxyURL           string
+}
+
+// KeepaliveStats 连接保活统计
+type KeepaliveStats struct {
+	Pings    int64 `json:"pings"`    // 已发送的保活请求数
+	Failures int64 `json:"failures"` // 保活请求失败数（网络错误）
+	Skipped  int64 `json:"skipped"`  // 因近期有真实流量而跳过的次数
+}
+
+// KeepaliveManager 上游连接保活：定期向空闲渠道发送轻量 HEAD 请求，
+// 使连接池中的空闲连接不被上游或中间设备关闭，降低突发流量时的建连延迟。
+// 保活请求复用与真实请求相同的 HTTP 客户端（同一连接池），否则无法起到预热作用。
+type KeepaliveManager struct {
+	clientManager  *httpclient.ClientManager
+	targets        func() []KeepaliveTarget
+	interval       time.Duration
+	requestTimeout time.Duration // 与真实请求一致的超时时间，用于定位标准客户端连接池
+
+	pings    atomic.Int64
+	failures atomic.Int64
+	skipped  atomic.Int64
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	loopWg   sync.WaitGroup
+}
+
+// NewKeepaliveManager 创建连接保活管理器
+// targets 每轮调用一次以获取最新的渠道列表；requestTimeout 需与 SendRequest 使用的超时一致
+func NewKeepaliveManager(targets func() []KeepaliveTarget, interval, requestTimeout time.Duration) *KeepaliveManager {
+	if interval <= 0 {
+		interval = 30 * time.Second // 默认 30 秒，需小于连接池空闲超时（90 秒）
+	}
+	return &KeepaliveManager{
+		clientManager:  httpclient.GetManager(),
+		targets:        targets,
+		interval:       interval,
+		requestTimeout: requestTimeout,
+		stopCh:         make(chan struct{}),
+	}
+}
+
+// Start 启动后台保活循环
+func (m *KeepaliveManager) Start() {
+	m.loopWg.Add(1)
+	go m.loop()
+}
+
+// Stop 停止后台保活循环并等待进行中的保活请求结束（可重复调用）
+func (m *KeepaliveManager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+	})
+	m.loopWg.Wait()
+}
+
+// Stats 获取保活统计
+func (m *KeepaliveManager) Stats() KeepaliveStats {
+	return KeepaliveStats{
+		Pings:    m.pings.Load(),
+		Failures: m.failures.Load(),
+		Skipped:  m.skipped.Load(),
+	}
+}
+
+func (m *KeepaliveManager) loop() {
+	defer m.loopWg.Done()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.pingIdleTargets()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// pingIdleTargets 向所有空闲的上游主机发送一轮保活请求
+// 空闲判定阈值为保活间隔的一半，避免定时器抖动导致隔轮才发送
+func (m *KeepaliveManager) pingIdleTargets() {
+	idleThreshold := m.interval / 2
+	now := time.Now()
+
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for _, target := range m.targets() {
+		u, err := url.Parse(strings.TrimSuffix(target.BaseURL, "/"))
+		if err != nil || u.Host == "" {
+			continue
+		}
+		host := httpclient.HostKey(u)
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+
+		if now.Sub(m.clientManager.LastUsed(host)) < idleThreshold {
+			m.skipped.Add(1)
+			continue
+		}
+
+		wg.Add(1)
+		go func(target KeepaliveTarget, u *url.URL) {
+			defer wg.Done()
+			m.ping(target, u)
+		}(target, u)
+	}
+	wg.Wait()
+}
+
+// ping 分别通过标准客户端与流式客户端发送 HEAD 请求，保持两个连接池的连接活跃
+func (m *KeepaliveManager) ping(target KeepaliveTarget, u *url.URL) {
+	clients := []*http.Client{
+		m.clientManager.GetStandardClient(m.requestTimeout, target.InsecureSkipVerify, target.ProxyURL),
+		m.clientManager.GetStreamClient(target.InsecureSkipVerify, target.ProxyURL),
+	}
+	for _, client := range clients {
+		req, err := http.NewRequest(http.MethodHead, u.String(), nil)
+		if err != nil {
+			return
+		}
+		m.pings.Add(1)
+		resp, err := client.Do(req)
+		if err != nil {
+			m.failures.Add(1)
+			log.Printf("[Keepalive] 警告: 保活请求失败: %s (%v)", u.Host, err)
+			continue
+		}
+		// 读尽响应体后关闭，连接才会放回连接池
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
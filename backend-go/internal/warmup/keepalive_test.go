@@ -0,0 +1,128 @@
+package warmup
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/httpclient"
+)
+
+// newCountingServer 创建统计 HEAD 请求数与新建连接数的测试服务器
+// 服务器空闲连接超时设置为 idleTimeout，模拟上游关闭空闲连接
+func newCountingServer(t *testing.T, idleTimeout time.Duration) (*httptest.Server, *atomic.Int64, *atomic.Int64) {
+	t.Helper()
+	var heads, newConns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.IdleTimeout = idleTimeout
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, &heads, &newConns
+}
+
+func staticTargets(urls ...string) func() []KeepaliveTarget {
+	return func() []KeepaliveTarget {
+		targets := make([]KeepaliveTarget, 0, len(urls))
+		for _, u := range urls {
+			targets = append(targets, KeepaliveTarget{BaseURL: u})
+		}
+		return targets
+	}
+}
+
+// TestKeepalive_PingsIdleTargets 测试空闲渠道会收到保活请求，同一主机只发送一次
+func TestKeepalive_PingsIdleTargets(t *testing.T) {
+	server, heads, _ := newCountingServer(t, 0)
+
+	m := NewKeepaliveManager(staticTargets(server.URL, server.URL+"/v1/"), time.Second, 3*time.Second)
+	m.pingIdleTargets()
+
+	// 标准客户端与流式客户端各一次
+	if got := heads.Load(); got != 2 {
+		t.Fatalf("期望 2 次保活请求，实际 %d", got)
+	}
+	if stats := m.Stats(); stats.Pings != 2 || stats.Failures != 0 {
+		t.Fatalf("stats=%+v", stats)
+	}
+}
+
+// TestKeepalive_SkipsRecentlyActiveTargets 测试近期有真实流量的渠道不发送保活请求
+func TestKeepalive_SkipsRecentlyActiveTargets(t *testing.T) {
+	server, heads, _ := newCountingServer(t, 0)
+
+	client := httpclient.GetManager().GetStandardClient(4*time.Second, false, "")
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	m := NewKeepaliveManager(staticTargets(server.URL), time.Minute, 4*time.Second)
+	m.pingIdleTargets()
+
+	if got := heads.Load(); got != 0 {
+		t.Fatalf("近期活跃的渠道不应发送保活请求，实际 %d 次", got)
+	}
+	if stats := m.Stats(); stats.Skipped != 1 {
+		t.Fatalf("stats=%+v", stats)
+	}
+}
+
+// TestKeepalive_ReusesConnectionAcrossIdlePeriod 测试保活使连接在上游空闲超时后仍可复用
+func TestKeepalive_ReusesConnectionAcrossIdlePeriod(t *testing.T) {
+	const (
+		upstreamIdleTimeout = 300 * time.Millisecond
+		idlePeriod          = 700 * time.Millisecond
+	)
+
+	run := func(t *testing.T, requestTimeout time.Duration, keepWarm bool) int64 {
+		server, _, newConns := newCountingServer(t, upstreamIdleTimeout)
+		client := httpclient.GetManager().GetStandardClient(requestTimeout, false, "")
+		get := func() {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			resp.Body.Close()
+		}
+
+		get()
+		var m *KeepaliveManager
+		if keepWarm {
+			m = NewKeepaliveManager(staticTargets(server.URL), 100*time.Millisecond, requestTimeout)
+			m.Start()
+		}
+		time.Sleep(idlePeriod)
+		if m != nil {
+			// 先停止保活，避免保活请求与真实请求争用同一连接
+			m.Stop()
+			if m.Stats().Pings == 0 {
+				t.Fatal("空闲期间应发送保活请求")
+			}
+		}
+		get()
+		return newConns.Load()
+	}
+
+	// 使用不同超时以隔离连接池
+	if got := run(t, 5*time.Second, false); got != 2 {
+		t.Fatalf("未启用保活时空闲连接应被上游关闭并重新建连，期望 2 个连接，实际 %d", got)
+	}
+	// 启用保活后：标准客户端的连接被复用；流式客户端的保活请求会额外建立 1 个连接
+	if got := run(t, 6*time.Second, true); got != 2 {
+		t.Fatalf("启用保活后标准客户端连接应被复用，期望 2 个连接（含流式连接池），实际 %d", got)
+	}
+}
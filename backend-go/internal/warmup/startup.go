@@ -0,0 +1,160 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BenedictKing/claude-proxy/internal/httpclient"
+)
+
+// StartupTarget 启动预热目标（一个渠道的全部 BaseURL）
+type StartupTarget struct {
+	ChannelIndex       int
+	BaseURLs           []string
+	InsecureSkipVerify bool
+	ProxyURL           string
+}
+
+// StartupResult 启动预热汇总（按去重后的 URL 统计）
+type StartupResult struct {
+	Warm     []string      // 已建立连接（收到任意 HTTP 响应）
+	Cold     []string      // 整体超时前未完成，保持冷启动
+	Failed   []string      // DNS/TCP/TLS 等网络错误
+	Duration time.Duration // 预热总耗时
+}
+
+type startupOutcome int
+
+const (
+	outcomeCold startupOutcome = iota
+	outcomeWarm
+	outcomeFailed
+)
+
+// WarmupOnStartup 启动时并发预热所有渠道 URL，避免重启后的首个请求承担 DNS/TLS 建连开销
+// 以最多 concurrency 个 worker 向每个 BaseURL 发送 HEAD 请求，复用真实请求的 HTTP 客户端（标准与流式两个连接池），
+// 整体不超过 timeout；多 BaseURL 渠道的结果写入 URLManager，预热成功的 URL 排在前面。
+// 失败只记录日志，不影响启动
+func WarmupOnStartup(targets []StartupTarget, urlManager *URLManager, concurrency int, timeout, requestTimeout time.Duration) StartupResult {
+	start := time.Now()
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 按 URL 去重：同一 URL 只预热一次，TLS 与代理配置以首次出现的渠道为准
+	type job struct {
+		url      string
+		insecure bool
+		proxyURL string
+	}
+	var jobs []job
+	outcomes := make(map[string]startupOutcome)
+	for _, target := range targets {
+		for _, baseURL := range target.BaseURLs {
+			if _, ok := outcomes[baseURL]; ok || baseURL == "" {
+				continue
+			}
+			outcomes[baseURL] = outcomeCold
+			jobs = append(jobs, job{url: baseURL, insecure: target.InsecureSkipVerify, proxyURL: target.ProxyURL})
+		}
+	}
+
+	clientManager := httpclient.GetManager()
+	jobCh := make(chan job)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < min(concurrency, len(jobs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobCh {
+				outcome := warmStartupURL(ctx, clientManager, j.url, j.insecure, j.proxyURL, requestTimeout)
+				mu.Lock()
+				outcomes[j.url] = outcome
+				mu.Unlock()
+			}
+		}()
+	}
+dispatch:
+	for _, j := range jobs {
+		select {
+		case jobCh <- j:
+		case <-ctx.Done():
+			break dispatch // 剩余 URL 保持 cold
+		}
+	}
+	close(jobCh)
+	wg.Wait()
+
+	// 多 BaseURL 渠道：按预热结果初始化动态排序
+	if urlManager != nil {
+		for _, target := range targets {
+			if len(target.BaseURLs) <= 1 {
+				continue
+			}
+			urlManager.GetSortedURLs(target.ChannelIndex, target.BaseURLs)
+			for _, baseURL := range target.BaseURLs {
+				switch outcomes[baseURL] {
+				case outcomeWarm:
+					urlManager.MarkSuccess(target.ChannelIndex, baseURL)
+				case outcomeFailed:
+					urlManager.MarkFailure(target.ChannelIndex, baseURL)
+				}
+			}
+		}
+	}
+
+	result := StartupResult{Duration: time.Since(start)}
+	for _, j := range jobs {
+		switch outcomes[j.url] {
+		case outcomeWarm:
+			result.Warm = append(result.Warm, j.url)
+		case outcomeFailed:
+			result.Failed = append(result.Failed, j.url)
+		default:
+			result.Cold = append(result.Cold, j.url)
+		}
+	}
+	return result
+}
+
+// warmStartupURL 依次通过标准客户端与流式客户端发送 HEAD 请求，以标准客户端的结果作为预热结果
+func warmStartupURL(ctx context.Context, clientManager *httpclient.ClientManager, baseURL string, insecure bool, proxyURL string, requestTimeout time.Duration) startupOutcome {
+	clients := []*http.Client{
+		clientManager.GetStandardClient(requestTimeout, insecure, proxyURL),
+		clientManager.GetStreamClient(insecure, proxyURL),
+	}
+	outcome := outcomeCold
+	for i, client := range clients {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL, nil)
+		if err != nil {
+			log.Printf("[Warmup] 警告: 无效的 URL: %s (%v)", baseURL, err)
+			return outcomeFailed
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			if i > 0 {
+				continue // 流式连接池预热失败不影响结果
+			}
+			if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+				return outcomeCold
+			}
+			log.Printf("[Warmup] 警告: 预热失败: %s (%v)", baseURL, err)
+			return outcomeFailed
+		}
+		// 读尽响应体后关闭，连接才会放回连接池
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if i == 0 {
+			outcome = outcomeWarm
+		}
+	}
+	return outcome
+}
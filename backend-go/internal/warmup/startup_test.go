@@ -0,0 +1,68 @@
+package warmup
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWarmupOnStartup_ClassifiesURLsAndOrdersChannel(t *testing.T) {
+	warmServer, heads, newConns := newCountingServer(t, time.Minute)
+
+	// 关闭后的地址：连接被拒绝
+	closed := httptest.NewServer(http.NotFoundHandler())
+	failedURL := closed.URL
+	closed.Close()
+
+	// 阻塞直到请求取消：整体超时内无法完成
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hang.Close()
+
+	urlManager := NewURLManager(30*time.Second, 3)
+	targets := []StartupTarget{
+		{ChannelIndex: 0, BaseURLs: []string{failedURL, warmServer.URL}},
+		{ChannelIndex: 1, BaseURLs: []string{hang.URL}},
+		{ChannelIndex: 2, BaseURLs: []string{warmServer.URL}}, // 重复 URL 只预热一次
+	}
+
+	result := WarmupOnStartup(targets, urlManager, 2, 500*time.Millisecond, 5*time.Second)
+
+	if len(result.Warm) != 1 || result.Warm[0] != warmServer.URL {
+		t.Fatalf("Warm = %v, want [%s]", result.Warm, warmServer.URL)
+	}
+	if len(result.Failed) != 1 || result.Failed[0] != failedURL {
+		t.Fatalf("Failed = %v, want [%s]", result.Failed, failedURL)
+	}
+	if len(result.Cold) != 1 || result.Cold[0] != hang.URL {
+		t.Fatalf("Cold = %v, want [%s]", result.Cold, hang.URL)
+	}
+	if result.Duration > 3*time.Second {
+		t.Fatalf("warmup should be bounded by timeout, took %v", result.Duration)
+	}
+
+	// 标准与流式两个连接池各预热一次
+	if got := heads.Load(); got != 2 {
+		t.Fatalf("HEAD requests = %d, want 2", got)
+	}
+	if got := newConns.Load(); got != 2 {
+		t.Fatalf("new connections = %d, want 2", got)
+	}
+
+	sorted := urlManager.GetSortedURLs(0, []string{failedURL, warmServer.URL})
+	if sorted[0].URL != warmServer.URL || sorted[0].OriginalIdx != 1 {
+		t.Fatalf("warm URL should be ordered first: %+v", sorted)
+	}
+	if sorted[1].Success {
+		t.Fatalf("failed URL should be in cooldown: %+v", sorted)
+	}
+}
+
+func TestWarmupOnStartup_NoTargets(t *testing.T) {
+	result := WarmupOnStartup(nil, NewURLManager(0, 0), 4, time.Second, time.Second)
+	if len(result.Warm)+len(result.Cold)+len(result.Failed) != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
@@ -12,21 +12,29 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/BenedictKing/claude-proxy/internal/alerting"
 	"github.com/BenedictKing/claude-proxy/internal/billing"
+	"github.com/BenedictKing/claude-proxy/internal/budget"
 	"github.com/BenedictKing/claude-proxy/internal/cache"
+	"github.com/BenedictKing/claude-proxy/internal/capture"
 	"github.com/BenedictKing/claude-proxy/internal/config"
+	"github.com/BenedictKing/claude-proxy/internal/converters"
 	"github.com/BenedictKing/claude-proxy/internal/handlers"
+	"github.com/BenedictKing/claude-proxy/internal/handlers/common"
 	"github.com/BenedictKing/claude-proxy/internal/handlers/gemini"
 	"github.com/BenedictKing/claude-proxy/internal/handlers/messages"
 	"github.com/BenedictKing/claude-proxy/internal/handlers/responses"
+	"github.com/BenedictKing/claude-proxy/internal/httpclient"
 	"github.com/BenedictKing/claude-proxy/internal/logger"
 	"github.com/BenedictKing/claude-proxy/internal/metrics"
 	"github.com/BenedictKing/claude-proxy/internal/middleware"
 	"github.com/BenedictKing/claude-proxy/internal/monitor"
 	"github.com/BenedictKing/claude-proxy/internal/pricing"
+	"github.com/BenedictKing/claude-proxy/internal/providers"
 	"github.com/BenedictKing/claude-proxy/internal/scheduler"
 	"github.com/BenedictKing/claude-proxy/internal/session"
 	"github.com/BenedictKing/claude-proxy/internal/usage"
+	"github.com/BenedictKing/claude-proxy/internal/utils"
 	"github.com/BenedictKing/claude-proxy/internal/warmup"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -56,16 +64,27 @@ func main() {
 		MaxAge:     envCfg.LogMaxAge,
 		Compress:   envCfg.LogCompress,
 		Console:    envCfg.LogToConsole,
+		Format:     envCfg.LogFormat,
+		Level:      envCfg.LogLevel,
 	}
 	if err := logger.Setup(logCfg); err != nil {
 		log.Fatalf("初始化日志系统失败: %v", err)
 	}
+	utils.SetLogRedaction(envCfg.LogRedact, envCfg.LogRedactPII)
+	if envCfg.LogRedact || envCfg.LogRedactPII {
+		log.Printf("[Logger-Init] 日志脱敏已启用 (内容: %v, PII: %v)", envCfg.LogRedact, envCfg.LogRedactPII)
+	}
 
 	cfgManager, err := config.NewConfigManager(".config/config.json")
 	if err != nil {
 		log.Fatalf("初始化配置管理器失败: %v", err)
 	}
 	defer cfgManager.Close()
+	cfgManager.SetKeyDrainGracePeriod(time.Duration(envCfg.KeyDrainGracePeriod) * time.Second)
+	if envCfg.KeyOrderResetInterval > 0 {
+		cfgManager.SetKeyOrderResetInterval(time.Duration(envCfg.KeyOrderResetInterval) * time.Second)
+		log.Printf("[KeyOrder-Init] 规范密钥顺序恢复已启用: 渠道 %v 内无配额降级时恢复原有密钥顺序", cfgManager.GetKeyOrderResetInterval())
+	}
 
 	// 初始化会话管理器（Responses API 专用）
 	sessionManager := session.NewSessionManager(
@@ -80,10 +99,18 @@ func main() {
 	var metricsAggCancel context.CancelFunc
 	var metricsAggWg sync.WaitGroup
 	if envCfg.MetricsPersistenceEnabled {
-		var err error
+		vacuumWindow, err := metrics.ParseHourWindow(envCfg.MetricsVacuumHours)
+		if err != nil {
+			log.Printf("[Metrics-Init] 警告: METRICS_VACUUM_HOURS 无效，空间回收不限时段: %v", err)
+		}
 		metricsStore, err = metrics.NewSQLiteStore(&metrics.SQLiteStoreConfig{
 			DBPath:        ".config/metrics.db",
 			RetentionDays: envCfg.MetricsRetentionDays,
+
+			VacuumInterval:          time.Duration(envCfg.MetricsVacuumInterval) * time.Hour,
+			VacuumWindow:            vacuumWindow,
+			RequestLogRetention:     time.Duration(envCfg.MetricsRequestLogRetentionHours) * time.Hour,
+			DailyStatsRetentionDays: envCfg.MetricsDailyStatsRetentionDays,
 		})
 		if err != nil {
 			log.Printf("[Metrics-Init] 警告: 初始化指标持久化存储失败: %v，将使用纯内存模式", err)
@@ -93,7 +120,7 @@ func main() {
 		log.Printf("[Metrics-Init] 指标持久化已禁用，使用纯内存模式")
 	}
 
-	// 指标每日预聚合（daily_stats）：启动回填 + 每日 2:00 聚合前一日
+	// 指标每日预聚合（daily_stats）：启动回填 + 每日 METRICS_AGGREGATE_HOUR 点（± 随机抖动）聚合前一日
 	if metricsStore != nil {
 		aggCtx, cancel := context.WithCancel(context.Background())
 		metricsAggCancel = cancel
@@ -107,31 +134,203 @@ func main() {
 		metricsAggWg.Add(1)
 		go func() {
 			defer metricsAggWg.Done()
-			runDailyStatsScheduler(aggCtx, metricsStore)
+			schedule := metrics.NewDailyStatsSchedule(envCfg.MetricsAggregateHour, time.Duration(envCfg.MetricsAggregateJitterMinutes)*time.Minute)
+			runDailyStatsScheduler(aggCtx, metricsStore, schedule)
 		}()
 	}
 
+	// 指标镜像（可选）：请求记录除写入 SQLite 外，尽力而为地批量 POST 到外部分析服务
+	var recordStore metrics.PersistenceStore
+	if metricsStore != nil {
+		recordStore = metricsStore
+	}
+	var metricsMirror *metrics.HTTPSink
+	if envCfg.MetricsMirrorURL != "" {
+		metricsMirror = metrics.NewHTTPSink(metrics.HTTPSinkConfig{
+			URL:           envCfg.MetricsMirrorURL,
+			AuthToken:     envCfg.MetricsMirrorToken,
+			BatchSize:     envCfg.MetricsMirrorBatchSize,
+			FlushInterval: time.Duration(envCfg.MetricsMirrorFlushInterval) * time.Second,
+		})
+		recordStore = metrics.NewFanoutStore(recordStore, metricsMirror)
+		log.Printf("[Metrics-Init] 指标镜像已启用: %s (批量: %d, 间隔: %ds)",
+			envCfg.MetricsMirrorURL, envCfg.MetricsMirrorBatchSize, envCfg.MetricsMirrorFlushInterval)
+	}
+
 	// 初始化多渠道调度器（Messages、Responses、Gemini 使用独立的指标管理器）
 	var messagesMetricsManager, responsesMetricsManager, geminiMetricsManager *metrics.MetricsManager
-	if metricsStore != nil {
+	if recordStore != nil {
 		messagesMetricsManager = metrics.NewMetricsManagerWithPersistence(
-			envCfg.MetricsWindowSize, envCfg.MetricsFailureThreshold, metricsStore, "messages")
+			envCfg.MetricsWindowSize, envCfg.MetricsFailureThreshold, recordStore, "messages")
 		responsesMetricsManager = metrics.NewMetricsManagerWithPersistence(
-			envCfg.MetricsWindowSize, envCfg.MetricsFailureThreshold, metricsStore, "responses")
+			envCfg.MetricsWindowSize, envCfg.MetricsFailureThreshold, recordStore, "responses")
 		geminiMetricsManager = metrics.NewMetricsManagerWithPersistence(
-			envCfg.MetricsWindowSize, envCfg.MetricsFailureThreshold, metricsStore, "gemini")
+			envCfg.MetricsWindowSize, envCfg.MetricsFailureThreshold, recordStore, "gemini")
 	} else {
 		messagesMetricsManager = metrics.NewMetricsManagerWithConfig(envCfg.MetricsWindowSize, envCfg.MetricsFailureThreshold)
 		responsesMetricsManager = metrics.NewMetricsManagerWithConfig(envCfg.MetricsWindowSize, envCfg.MetricsFailureThreshold)
 		geminiMetricsManager = metrics.NewMetricsManagerWithConfig(envCfg.MetricsWindowSize, envCfg.MetricsFailureThreshold)
 	}
-	traceAffinityManager := session.NewTraceAffinityManager()
+	if envCfg.CircuitBackoffMaxMultiplier > 1 {
+		cycleResetCooldown := time.Duration(envCfg.CircuitCycleResetCooldown) * time.Minute
+		for _, mm := range []*metrics.MetricsManager{messagesMetricsManager, responsesMetricsManager, geminiMetricsManager} {
+			mm.SetCircuitBackoff(envCfg.CircuitBackoffMaxMultiplier, envCfg.CircuitBackoffJitter, cycleResetCooldown)
+		}
+		log.Printf("[Metrics-Init] 熔断指数退避已启用 (最大倍数: %dx, 抖动: %.0f%%, 周期重置冷却: %d 分钟)",
+			envCfg.CircuitBackoffMaxMultiplier, envCfg.CircuitBackoffJitter*100, envCfg.CircuitCycleResetCooldown)
+	}
+	if staleKeyTTL := time.Duration(envCfg.MetricsStaleKeyTTL) * time.Hour; staleKeyTTL != metrics.DefaultStaleKeyTTL {
+		for _, mm := range []*metrics.MetricsManager{messagesMetricsManager, responsesMetricsManager, geminiMetricsManager} {
+			mm.SetStaleKeyTTL(staleKeyTTL)
+		}
+		if staleKeyTTL == 0 {
+			log.Printf("[Metrics-Init] 过期 Key 指标清理已禁用，已删除密钥的指标将常驻内存直至重启")
+		} else {
+			log.Printf("[Metrics-Init] 过期 Key 指标清理阈值: %d 小时", envCfg.MetricsStaleKeyTTL)
+		}
+	}
+	var traceAffinityManager *session.TraceAffinityManager
+	if envCfg.TraceAffinityPersistenceEnabled && metricsStore != nil {
+		traceAffinityManager = session.NewTraceAffinityManagerWithStore(30*time.Minute, metricsStore)
+		log.Printf("[TraceAffinity-Init] Trace 亲和性持久化已启用，已恢复 %d 条会话绑定", traceAffinityManager.Size())
+	} else {
+		if envCfg.TraceAffinityPersistenceEnabled {
+			log.Printf("[TraceAffinity-Init] 警告: Trace 亲和性持久化依赖指标持久化（METRICS_PERSISTENCE_ENABLED），已回退为内存模式")
+		}
+		traceAffinityManager = session.NewTraceAffinityManager()
+	}
+	if envCfg.TraceAffinityMaxAge > 0 {
+		traceAffinityManager.SetMaxAffinityAge(time.Duration(envCfg.TraceAffinityMaxAge) * time.Second)
+		log.Printf("[TraceAffinity-Init] 会话亲和最大存活时间: %v（持续活跃的会话到期后重新选择渠道）", traceAffinityManager.GetMaxAffinityAge())
+	}
+	if envCfg.IPAffinityTTL > 0 {
+		traceAffinityManager.SetIPAffinityTTL(time.Duration(envCfg.IPAffinityTTL) * time.Second)
+		log.Printf("[TraceAffinity-Init] 客户端 IP 亲和已启用 (TTL: %v, 可信代理: %v)", traceAffinityManager.GetIPAffinityTTL(), envCfg.TrustedProxies)
+	}
+
+	// 上游连接池配置（需在预热与保活之前设置，使其使用同一连接池）
+	httpclient.GetManager().SetPoolConfig(httpclient.PoolConfig{
+		MaxIdleConns:        envCfg.UpstreamMaxIdleConns,
+		MaxIdleConnsPerHost: envCfg.UpstreamMaxIdleConnsPerHost,
+		IdleConnTimeout:     time.Duration(envCfg.UpstreamIdleConnTimeout) * time.Second,
+		DisableHTTP2:        !envCfg.UpstreamHTTP2,
+	})
+	if envCfg.UpstreamMaxIdleConns > 0 || envCfg.UpstreamMaxIdleConnsPerHost > 0 || envCfg.UpstreamIdleConnTimeout > 0 || !envCfg.UpstreamHTTP2 {
+		log.Printf("[HTTPClient-Init] 上游连接池: 最大空闲连接 %d, 每主机 %d, 空闲超时 %d秒, HTTP/2: %v（0 表示默认值）",
+			envCfg.UpstreamMaxIdleConns, envCfg.UpstreamMaxIdleConnsPerHost, envCfg.UpstreamIdleConnTimeout, envCfg.UpstreamHTTP2)
+	}
+	if envCfg.KeepWarmConnections && envCfg.UpstreamIdleConnTimeout > 0 && envCfg.KeepWarmInterval >= envCfg.UpstreamIdleConnTimeout {
+		log.Printf("[HTTPClient-Init] 警告: KEEP_WARM_INTERVAL (%d秒) 不小于 UPSTREAM_IDLE_CONN_TIMEOUT (%d秒)，空闲连接会在保活前被关闭",
+			envCfg.KeepWarmInterval, envCfg.UpstreamIdleConnTimeout)
+	}
 
 	// 初始化 URL 管理器（非阻塞，动态排序）
 	urlManager := warmup.NewURLManager(30*time.Second, 3) // 30秒冷却期，连续3次失败后移到末尾
 	log.Printf("[URLManager-Init] URL管理器已初始化 (冷却期: 30秒, 最大连续失败: 3)")
 
+	// 启动预热（可选）：并发预热所有渠道 URL，避免重启后的首个请求承担 DNS/TLS 建连开销
+	if envCfg.WarmupOnStartup {
+		result := warmup.WarmupOnStartup(
+			collectStartupWarmupTargets(cfgManager.GetConfig()),
+			urlManager,
+			envCfg.WarmupConcurrency,
+			time.Duration(envCfg.WarmupTimeout)*time.Second,
+			time.Duration(envCfg.RequestTimeout)*time.Millisecond,
+		)
+		log.Printf("[Warmup-Init] 启动预热完成 (耗时: %v): 成功 %d, 未完成 %d, 失败 %d",
+			result.Duration.Round(time.Millisecond), len(result.Warm), len(result.Cold), len(result.Failed))
+		if len(result.Cold) > 0 {
+			log.Printf("[Warmup-Init] 警告: 超时未完成预热的 URL: %v", result.Cold)
+		}
+		if len(result.Failed) > 0 {
+			log.Printf("[Warmup-Init] 警告: 预热失败的 URL: %v", result.Failed)
+		}
+	}
+
+	// 渠道健康告警（可选）：健康渠道数低于阈值或渠道熔断时发送 Webhook
+	var alertManager *alerting.Manager
+	if envCfg.AlertWebhookURL != "" {
+		alertManager = alerting.NewManager(alerting.Config{
+			WebhookURL:         envCfg.AlertWebhookURL,
+			Format:             envCfg.AlertWebhookFormat,
+			MinHealthyChannels: envCfg.AlertMinHealthyChannels,
+			NotifyCircuitOpen:  envCfg.AlertOnCircuitOpen,
+			Debounce:           time.Duration(envCfg.AlertDebounce) * time.Second,
+		}, cfgManager,
+			alerting.Source{APIType: "messages", Metrics: messagesMetricsManager},
+			alerting.Source{APIType: "responses", Metrics: responsesMetricsManager},
+			alerting.Source{APIType: "gemini", Metrics: geminiMetricsManager},
+		)
+		alertManager.Start()
+		log.Printf("[Alert-Init] 渠道健康告警已启用 (格式: %s, 最少健康渠道: %d, 熔断告警: %v, 去抖: %d秒)",
+			envCfg.AlertWebhookFormat, envCfg.AlertMinHealthyChannels, envCfg.AlertOnCircuitOpen, envCfg.AlertDebounce)
+	}
+
+	// 上游连接保活（可选）：定期向空闲渠道发送轻量请求，保持连接池预热
+	var keepaliveManager *warmup.KeepaliveManager
+	if envCfg.KeepWarmConnections {
+		keepaliveManager = warmup.NewKeepaliveManager(
+			func() []warmup.KeepaliveTarget { return collectKeepaliveTargets(cfgManager.GetConfig()) },
+			time.Duration(envCfg.KeepWarmInterval)*time.Second,
+			time.Duration(envCfg.RequestTimeout)*time.Millisecond,
+		)
+		keepaliveManager.Start()
+		log.Printf("[Keepalive-Init] 上游连接保活已启用 (间隔: %d秒)", envCfg.KeepWarmInterval)
+	}
+
 	channelScheduler := scheduler.NewChannelScheduler(cfgManager, messagesMetricsManager, responsesMetricsManager, geminiMetricsManager, traceAffinityManager, urlManager)
+	if envCfg.ChannelRampRequests > 0 {
+		channelScheduler.SetNewChannelRamp(envCfg.ChannelRampRequests, envCfg.ChannelRampMinFraction)
+		log.Printf("[Scheduler-Init] 新渠道流量爬坡已启用 (验证请求数: %d, 起始流量: %.0f%%)",
+			envCfg.ChannelRampRequests, envCfg.ChannelRampMinFraction*100)
+	}
+	if envCfg.AffinityThrashSwitches > 0 {
+		channelScheduler.SetAffinityStabilization(envCfg.AffinityThrashSwitches,
+			time.Duration(envCfg.AffinityThrashWindow)*time.Second, time.Duration(envCfg.AffinityPinCooldown)*time.Second)
+		log.Printf("[Scheduler-Init] 会话亲和抖动检测已启用 (%d 秒内切换 %d 次后固定 %d 秒)",
+			envCfg.AffinityThrashWindow, envCfg.AffinityThrashSwitches, envCfg.AffinityPinCooldown)
+	}
+	if envCfg.CacheAffinityStickiness > 0 {
+		channelScheduler.SetCacheAffinity(envCfg.CacheAffinityStickiness)
+		log.Printf("[Scheduler-Init] 缓存感知亲和已启用 (粘性权重: %.2f, 亲和渠道近 1 小时缓存命中率 >= %.0f%% 时忽略优先级差异)",
+			envCfg.CacheAffinityStickiness, (1-envCfg.CacheAffinityStickiness)*100)
+	}
+	if envCfg.NonFailoverSuspendRate > 0 {
+		channelScheduler.SetNonFailoverSuspension(envCfg.NonFailoverSuspendRate, envCfg.NonFailoverSuspendMinRequests,
+			time.Duration(envCfg.NonFailoverSuspendWindow)*time.Second)
+		log.Printf("[Scheduler-Init] 非故障转移错误率自动暂停已启用 (%d 秒内至少 %d 次请求且错误占比 >= %.0f%%)",
+			envCfg.NonFailoverSuspendWindow, envCfg.NonFailoverSuspendMinRequests, envCfg.NonFailoverSuspendRate*100)
+	}
+	if envCfg.RetryBudgetPerSecond > 0 {
+		channelScheduler.SetRetryBudget(envCfg.RetryBudgetPerSecond)
+		log.Printf("[Scheduler-Init] 全局重试预算已启用 (每秒 %.2f 次重试)", envCfg.RetryBudgetPerSecond)
+	}
+	if envCfg.MaxConcurrentFailovers > 0 {
+		channelScheduler.SetFailoverConcurrency(envCfg.MaxConcurrentFailovers, time.Duration(envCfg.FailoverSlotWait)*time.Second)
+		log.Printf("[Scheduler-Init] 全局故障转移并发上限已启用 (最多 %d 个在途重试, 最长等待 %d 秒)",
+			envCfg.MaxConcurrentFailovers, envCfg.FailoverSlotWait)
+	}
+	channelScheduler.SetShadowConcurrency(envCfg.ShadowMaxConcurrency)
+	if envCfg.KeyProbeInterval > 0 {
+		channelScheduler.StartKeyProber(time.Duration(envCfg.KeyProbeInterval)*time.Second, time.Duration(envCfg.HealthProbeTimeout)*time.Second)
+		log.Printf("[Scheduler-Init] 后台密钥健康探测已启用 (间隔: %d秒, 超时: %d秒)", envCfg.KeyProbeInterval, envCfg.HealthProbeTimeout)
+	}
+	cfgManager.SetKeyStatsSource(channelScheduler) // keySelection: "adaptive" 按密钥近期成功率与延迟加权选择
+	cfgManager.SetKeyUsageSource(channelScheduler) // dailyRequestLimit/dailyTokenLimit 密钥每日配额
+
+	// provider 调试日志（如按渠道 allowedBetas 剔除的 anthropic-beta 特性）
+	providers.SetDebugLogging(envCfg.ShouldLog("debug"))
+
+	// 跨协议推理强度映射（reasoning effort <-> thinking budget）
+	if envCfg.ReasoningEffortBudgets != "" {
+		budgets, err := converters.ParseReasoningEffortBudgets(envCfg.ReasoningEffortBudgets)
+		if err != nil {
+			log.Printf("[Converter-Init] 警告: REASONING_EFFORT_BUDGETS 配置无效，使用默认值: %v", err)
+		} else {
+			converters.SetReasoningEffortBudgets(budgets)
+			log.Printf("[Converter-Init] 推理强度预算映射: %s", converters.ReasoningEffortBudgetsString())
+		}
+	}
 	log.Printf("[Scheduler-Init] 多渠道调度器已初始化 (失败率阈值: %.0f%%, 滑动窗口: %d)",
 		messagesMetricsManager.GetFailureThreshold()*100, messagesMetricsManager.GetWindowSize())
 
@@ -151,8 +350,16 @@ func main() {
 	if err != nil {
 		pricingInterval = 24 * time.Hour
 	}
-	pricingService := pricing.NewService(pricingInterval)
+	pricingService := pricing.NewServiceWithOptions(pricing.Options{
+		URL:            envCfg.PricingURL,
+		File:           envCfg.PricingFile,
+		UpdateInterval: pricingInterval,
+	})
 	log.Printf("[Pricing-Init] 价格表服务已初始化 (更新间隔: %s)", pricingInterval)
+	if envCfg.PricingFile != "" {
+		log.Printf("[Pricing-Init] 本地价格表: %s（优先于远程价格表）", envCfg.PricingFile)
+	}
+	channelScheduler.SetPricingSource(pricingService) // loadBalance: "cheapest" 按价格表预估成本选择渠道
 
 	if envCfg.IsBillingEnabled() {
 		billingClient = billing.NewClient(envCfg.SweAgentBillingURL)
@@ -162,12 +369,45 @@ func main() {
 		log.Printf("[Usage-Init] 使用量存储已初始化")
 	}
 
+	// 计费事件审计日志（可选，仅计费模式下生效）
+	var billingLedger *billing.Ledger
+	if envCfg.IsBillingEnabled() && envCfg.BillingLedgerFile != "" {
+		ledger, err := billing.NewLedger(envCfg.BillingLedgerFile)
+		if err != nil {
+			log.Printf("[Billing-Init] 警告: 计费事件日志初始化失败，审计记录已禁用: %v", err)
+		} else {
+			billingLedger = ledger
+			log.Printf("[Billing-Init] 计费事件日志已启用: %s", envCfg.BillingLedgerFile)
+		}
+	}
+
+	// 请求抓包（调试用）
+	var captureRecorder *capture.Recorder
+	if envCfg.CaptureDir != "" {
+		recorder, err := capture.NewRecorder(envCfg.CaptureDir, envCfg.CaptureSampleRate, int64(envCfg.CaptureMaxSizeMB)*1024*1024)
+		if err != nil {
+			log.Printf("[Capture-Init] 警告: 请求抓包初始化失败，抓包已禁用: %v", err)
+		} else {
+			captureRecorder = recorder
+			common.SetCaptureRecorder(recorder)
+			log.Printf("[Capture-Init] 请求抓包已启用: %s (采样率 %.2f, 上限 %dMB)，抓包包含完整请求/响应内容，仅用于调试", envCfg.CaptureDir, envCfg.CaptureSampleRate, envCfg.CaptureMaxSizeMB)
+		}
+	}
+
 	// billingHandler 始终创建（用于成本计算），但 client/usageStore 可能为 nil
 	billingHandler := billing.NewHandler(billingClient, pricingService, usageStore, envCfg.PreAuthAmountCents)
+	billingHandler.SetLedger(billingLedger)
 	if envCfg.IsBillingEnabled() {
 		log.Printf("[Billing-Init] 计费处理器已初始化 (预授权: %d cents)", envCfg.PreAuthAmountCents)
 	}
 
+	// 成本预算（costBudgets 配置，支持热重载；累计成本来自 Messages/Responses 指标）
+	budgetManager := budget.NewBudgetManager(cfgManager, map[string]budget.CostSource{
+		"messages":  messagesMetricsManager,
+		"responses": responsesMetricsManager,
+	})
+	common.SetBudgetManager(budgetManager)
+
 	// 设置 Gin 模式
 	if envCfg.IsProduction() {
 		gin.SetMode(gin.ReleaseMode)
@@ -175,9 +415,20 @@ func main() {
 
 	// 创建路由器（使用自定义 Logger，根据 QUIET_POLLING_LOGS 配置过滤轮询日志）
 	r := gin.New()
+	// 可信代理：仅信任来自这些地址的 X-Forwarded-For（启用 IP 亲和时未配置则不信任任何代理，避免客户端伪造）
+	if len(envCfg.TrustedProxies) > 0 || envCfg.IPAffinityTTL > 0 {
+		if err := r.SetTrustedProxies(envCfg.TrustedProxies); err != nil {
+			log.Fatalf("[Server-Init] 可信代理配置无效 (TRUSTED_PROXIES): %v", err)
+		}
+	}
+	r.Use(middleware.RequestIDMiddleware())
 	r.Use(middleware.FilteredLogger(envCfg))
 	r.Use(gin.Recovery())
 
+	// 关闭排空：收到关闭信号后新请求返回 503，等待进行中的流式响应结束
+	shutdownDrain := middleware.NewShutdownDrain()
+	r.Use(shutdownDrain.Middleware())
+
 	// 配置 CORS
 	r.Use(middleware.CORSMiddleware(envCfg))
 
@@ -192,6 +443,9 @@ func main() {
 		r.GET("/admin/dev/info", handlers.DevInfo(envCfg, cfgManager))
 	}
 
+	// 配置重载端点（需要访问密钥；纯 API 模式下同样可用）
+	r.POST("/admin/config/reload", handlers.ReloadConfig(cfgManager))
+
 	// Web 管理界面 API 路由
 	apiGroup := r.Group("/api")
 	{
@@ -200,6 +454,24 @@ func main() {
 		responsesAPI := apiGroup.Group("/responses")
 		geminiAPI := apiGroup.Group("/gemini")
 
+		// 详细健康检查（渠道可用性，?probe=true 实时探测）
+		apiGroup.GET("/health/detailed", handlers.DetailedHealthCheck(envCfg, cfgManager, channelScheduler))
+		// 运行时泄漏诊断（goroutine/内存、进行中流式响应、会话与亲和表大小）
+		apiGroup.GET("/diagnostics/runtime", handlers.GetRuntimeDiagnostics(channelScheduler, sessionManager))
+		// 维护模式（内存状态，开启后代理请求返回 503 + Retry-After）
+		apiGroup.GET("/maintenance", handlers.GetMaintenance())
+		apiGroup.POST("/maintenance", handlers.SetMaintenance())
+		apiGroup.DELETE("/maintenance", handlers.ClearMaintenance())
+		// 成本预算状态（日/周已用、上限与剩余额度）
+		apiGroup.GET("/budget", handlers.GetBudgetStatus(budgetManager))
+		// 实时指标推送（SSE，替代高频轮询 /channels/metrics）
+		apiGroup.GET("/metrics/stream", handlers.GetMetricsStream(cfgManager, messagesMetricsManager, responsesMetricsManager, geminiMetricsManager))
+		// 指标数据库存储占用（文件大小、各表行数、保留与回收设置）
+		apiGroup.GET("/metrics/storage", handlers.GetMetricsStorage(metricsStore))
+		// 渠道配置批量导入/导出（灾备恢复、环境克隆）
+		apiGroup.GET("/channels/export", handlers.ExportChannels(cfgManager))
+		apiGroup.POST("/channels/import", handlers.ImportChannels(cfgManager))
+
 		// Messages 渠道管理
 		apiGroup.GET("/messages/channels", messages.GetUpstreams(cfgManager))
 		apiGroup.POST("/messages/channels", messages.AddUpstream(cfgManager))
@@ -207,21 +479,32 @@ func main() {
 		apiGroup.DELETE("/messages/channels/:id", messages.DeleteUpstream(cfgManager))
 		apiGroup.POST("/messages/channels/:id/keys", messages.AddApiKey(cfgManager))
 		apiGroup.DELETE("/messages/channels/:id/keys/:apiKey", messages.DeleteApiKey(cfgManager))
+		apiGroup.POST("/messages/channels/:id/keys/:apiKey/drain", messages.DrainApiKey(cfgManager))
 		apiGroup.POST("/messages/channels/:id/keys/:apiKey/top", messages.MoveApiKeyToTop(cfgManager))
 		apiGroup.POST("/messages/channels/:id/keys/:apiKey/bottom", messages.MoveApiKeyToBottom(cfgManager))
+		apiGroup.POST("/messages/channels/:id/keys/:apiKey/reset", handlers.ResetChannelKeyMetrics(channelScheduler, "messages"))
 
 		// Messages 多渠道调度 API
 		apiGroup.POST("/messages/channels/reorder", messages.ReorderChannels(cfgManager))
+		apiGroup.POST("/messages/channels/reorder-by-health", handlers.ReorderChannelsByHealth(cfgManager, channelScheduler))
 		apiGroup.PATCH("/messages/channels/:id/status", messages.SetChannelStatus(cfgManager))
 		apiGroup.POST("/messages/channels/:id/resume", handlers.ResumeChannel(channelScheduler, false))
 		apiGroup.POST("/messages/channels/:id/promotion", messages.SetChannelPromotion(cfgManager))
 		apiGroup.GET("/messages/channels/metrics", handlers.GetChannelMetricsWithConfig(messagesMetricsManager, cfgManager, false))
 		apiGroup.GET("/messages/channels/metrics/history", handlers.GetChannelMetricsHistory(messagesMetricsManager, cfgManager, false))
+		apiGroup.GET("/messages/channels/cancellations", handlers.GetStreamCancellationStats(messagesMetricsManager, cfgManager))
+		apiGroup.GET("/messages/channels/circuit-recovery", handlers.GetCircuitRecoveryStats(messagesMetricsManager, cfgManager, "messages"))
+		apiGroup.GET("/messages/channels/failover-cost", handlers.GetFailoverCostReport(channelScheduler, "messages"))
+		apiGroup.GET("/messages/channels/shadow", handlers.GetShadowReport(channelScheduler, "messages"))
 		apiGroup.GET("/messages/channels/:id/keys/metrics/history", handlers.GetChannelKeyMetricsHistory(messagesMetricsManager, cfgManager, false))
 		apiGroup.GET("/messages/channels/scheduler/stats", handlers.GetSchedulerStats(channelScheduler))
+		apiGroup.GET("/messages/channels/select-preview", handlers.GetSelectionPreview(cfgManager, channelScheduler))
 		apiGroup.GET("/messages/global/stats/history", handlers.GetGlobalStatsHistory(messagesMetricsManager))
+		apiGroup.GET("/messages/global/request-body-sizes", handlers.GetRequestBodySizeStats(messagesMetricsManager))
 		apiGroup.GET("/messages/channels/dashboard", handlers.GetChannelDashboard(cfgManager, channelScheduler))
 		apiGroup.GET("/messages/ping/:id", messages.PingChannel(cfgManager))
+		apiGroup.POST("/messages/channels/:id/test", messages.TestChannel(envCfg, cfgManager, channelScheduler))
+		apiGroup.POST("/messages/channels/:id/validate-mapping", messages.ValidateModelMapping(envCfg, cfgManager))
 		apiGroup.GET("/messages/ping", messages.PingAllChannels(cfgManager))
 
 		// 缓存监控 API
@@ -234,8 +517,10 @@ func main() {
 		apiGroup.DELETE("/responses/channels/:id", responses.DeleteUpstream(cfgManager))
 		apiGroup.POST("/responses/channels/:id/keys", responses.AddApiKey(cfgManager))
 		apiGroup.DELETE("/responses/channels/:id/keys/:apiKey", responses.DeleteApiKey(cfgManager))
+		apiGroup.POST("/responses/channels/:id/keys/:apiKey/drain", responses.DrainApiKey(cfgManager))
 		apiGroup.POST("/responses/channels/:id/keys/:apiKey/top", responses.MoveApiKeyToTop(cfgManager))
 		apiGroup.POST("/responses/channels/:id/keys/:apiKey/bottom", responses.MoveApiKeyToBottom(cfgManager))
+		apiGroup.POST("/responses/channels/:id/keys/:apiKey/reset", handlers.ResetChannelKeyMetrics(channelScheduler, "responses"))
 
 		// Responses 多渠道调度 API
 		apiGroup.POST("/responses/channels/reorder", responses.ReorderChannels(cfgManager))
@@ -244,8 +529,11 @@ func main() {
 		apiGroup.POST("/responses/channels/:id/promotion", handlers.SetResponsesChannelPromotion(cfgManager))
 		apiGroup.GET("/responses/channels/metrics", handlers.GetChannelMetricsWithConfig(responsesMetricsManager, cfgManager, true))
 		apiGroup.GET("/responses/channels/metrics/history", handlers.GetChannelMetricsHistory(responsesMetricsManager, cfgManager, true))
+		apiGroup.GET("/responses/channels/circuit-recovery", handlers.GetCircuitRecoveryStats(responsesMetricsManager, cfgManager, "responses"))
+		apiGroup.GET("/responses/channels/failover-cost", handlers.GetFailoverCostReport(channelScheduler, "responses"))
 		apiGroup.GET("/responses/channels/:id/keys/metrics/history", handlers.GetChannelKeyMetricsHistory(responsesMetricsManager, cfgManager, true))
 		apiGroup.GET("/responses/global/stats/history", handlers.GetGlobalStatsHistory(responsesMetricsManager))
+		apiGroup.GET("/responses/global/request-body-sizes", handlers.GetRequestBodySizeStats(responsesMetricsManager))
 
 		// Gemini 渠道管理
 		apiGroup.GET("/gemini/channels", gemini.GetUpstreams(cfgManager))
@@ -254,8 +542,10 @@ func main() {
 		apiGroup.DELETE("/gemini/channels/:id", gemini.DeleteUpstream(cfgManager))
 		apiGroup.POST("/gemini/channels/:id/keys", gemini.AddApiKey(cfgManager))
 		apiGroup.DELETE("/gemini/channels/:id/keys/:apiKey", gemini.DeleteApiKey(cfgManager))
+		apiGroup.POST("/gemini/channels/:id/keys/:apiKey/drain", gemini.DrainApiKey(cfgManager))
 		apiGroup.POST("/gemini/channels/:id/keys/:apiKey/top", gemini.MoveApiKeyToTop(cfgManager))
 		apiGroup.POST("/gemini/channels/:id/keys/:apiKey/bottom", gemini.MoveApiKeyToBottom(cfgManager))
+		apiGroup.POST("/gemini/channels/:id/keys/:apiKey/reset", handlers.ResetChannelKeyMetrics(channelScheduler, "gemini"))
 
 		// Gemini 多渠道调度 API
 		apiGroup.POST("/gemini/channels/reorder", gemini.ReorderChannels(cfgManager))
@@ -264,8 +554,11 @@ func main() {
 		apiGroup.PUT("/gemini/loadbalance", gemini.UpdateLoadBalance(cfgManager))
 		apiGroup.GET("/gemini/channels/metrics", handlers.GetGeminiChannelMetrics(geminiMetricsManager, cfgManager))
 		apiGroup.GET("/gemini/channels/metrics/history", handlers.GetGeminiChannelMetricsHistory(geminiMetricsManager, cfgManager))
+		apiGroup.GET("/gemini/channels/circuit-recovery", handlers.GetCircuitRecoveryStats(geminiMetricsManager, cfgManager, "gemini"))
+		apiGroup.GET("/gemini/channels/failover-cost", handlers.GetFailoverCostReport(channelScheduler, "gemini"))
 		apiGroup.GET("/gemini/channels/:id/keys/metrics/history", handlers.GetGeminiChannelKeyMetricsHistory(geminiMetricsManager, cfgManager))
 		apiGroup.GET("/gemini/global/stats/history", handlers.GetGlobalStatsHistory(geminiMetricsManager))
+		apiGroup.GET("/gemini/global/request-body-sizes", handlers.GetRequestBodySizeStats(geminiMetricsManager))
 		apiGroup.GET("/gemini/ping/:id", gemini.PingChannel(cfgManager))
 		apiGroup.GET("/gemini/ping", gemini.PingAllChannels(cfgManager))
 
@@ -273,11 +566,24 @@ func main() {
 		apiGroup.GET("/settings/fuzzy-mode", handlers.GetFuzzyMode(cfgManager))
 		apiGroup.PUT("/settings/fuzzy-mode", handlers.SetFuzzyMode(cfgManager))
 
+		// 低质量渠道排除设置
+		apiGroup.GET("/settings/exclude-low-quality", handlers.GetExcludeLowQuality(cfgManager))
+		apiGroup.PUT("/settings/exclude-low-quality", handlers.SetExcludeLowQuality(cfgManager))
+
 		// 请求日志 API
 		requestLogsHandler := handlers.NewRequestLogsHandler(metricsStore)
 		messagesAPI.GET("/logs", requestLogsHandler.GetLogs)
 		responsesAPI.GET("/logs", requestLogsHandler.GetLogs)
 		geminiAPI.GET("/logs", requestLogsHandler.GetLogs)
+		apiGroup.GET("/logs", requestLogsHandler.GetLogs) // ?api=messages|responses|gemini
+
+		// 计费事件审计 API
+		billingEventsHandler := handlers.NewBillingEventsHandler(billingLedger)
+		apiGroup.GET("/billing/events", billingEventsHandler.GetEvents)
+
+		// 使用量查询 API（按调用方 API Key / 模型 / 日期聚合，用于内部结算）
+		usageHandler := handlers.NewUsageHandler(usageStore, metricsStore)
+		apiGroup.GET("/usage", usageHandler.GetUsage)
 
 		// 实时请求 API
 		liveRequestsHandler := handlers.NewLiveRequestsHandler(liveRequestManager)
@@ -286,25 +592,50 @@ func main() {
 		geminiAPI.GET("/live", liveRequestsHandler.GetLiveRequests)
 	}
 
+	// 代理端点限流（按入站访问密钥或客户端 IP，限额见配置文件 rateLimit）
+	rateLimiter := middleware.NewRateLimiter(envCfg, cfgManager)
+	rateLimit := rateLimiter.Middleware()
+
+	// 代理端点防重放（REQUIRE_NONCE=true 时要求携带 X-Proxy-Nonce，窗口内重复使用即拒绝）
+	nonceCheck := middleware.NewNonceGuard(envCfg).Middleware()
+	if envCfg.RequireNonce {
+		log.Printf("[Nonce-Init] 请求防重放已启用 (窗口: %d 秒, 记录上限: %d)", envCfg.NonceWindow, envCfg.NonceMaxEntries)
+	}
+
 	// 代理端点 - Messages API
 	messagesHandler := messages.NewHandler(envCfg, cfgManager, channelScheduler, billingClient, billingHandler, liveRequestManager, metricsStore)
-	r.POST("/v1/messages", messagesHandler)
+	r.POST("/v1/messages", nonceCheck, rateLimit, messagesHandler)
 	r.POST("/v1/messages/count_tokens", messages.CountTokensHandler(envCfg, cfgManager, channelScheduler))
 
+	// 代理端点 - OpenAI Chat Completions（转换为 Messages 请求，经 Messages 渠道调度）
+	r.POST("/v1/chat/completions", nonceCheck, rateLimit, messages.NewChatCompletionsHandler(envCfg, cfgManager, channelScheduler, billingClient, billingHandler, liveRequestManager, metricsStore))
+
+	// Message Batches 透传（查询/结果/取消固定到创建批处理的渠道）
+	// 启用指标持久化时绑定写入 SQLite，重启后无需逐渠道探测
+	batchStore := messages.NewBatchStore()
+	if metricsStore != nil {
+		batchStore = messages.NewBatchStoreWithPersistence(metricsStore)
+		log.Printf("[Messages-Batch] 批处理渠道绑定持久化已启用，已恢复 %d 条绑定", batchStore.Len())
+	}
+	r.POST("/v1/messages/batches", nonceCheck, rateLimit, messages.BatchCreateHandler(envCfg, cfgManager, channelScheduler, batchStore))
+	r.GET("/v1/messages/batches/:id", rateLimit, messages.BatchPassthroughHandler(envCfg, cfgManager, batchStore))
+	r.GET("/v1/messages/batches/:id/results", rateLimit, messages.BatchPassthroughHandler(envCfg, cfgManager, batchStore))
+	r.POST("/v1/messages/batches/:id/cancel", rateLimit, messages.BatchPassthroughHandler(envCfg, cfgManager, batchStore))
+
 	// 代理端点 - Models API（转发到上游）
 	r.GET("/v1/models", messages.ModelsHandler(envCfg, cfgManager, channelScheduler, modelsResponseCache))
 	r.GET("/v1/models/:model", messages.ModelsDetailHandler(envCfg, cfgManager, channelScheduler))
 
 	// 代理端点 - Responses API
 	responsesHandler := responses.NewHandler(envCfg, cfgManager, sessionManager, channelScheduler, billingClient, billingHandler, liveRequestManager, metricsStore)
-	r.POST("/v1/responses", responsesHandler)
-	r.POST("/v1/responses/compact", responses.CompactHandler(envCfg, cfgManager, sessionManager, channelScheduler))
+	r.POST("/v1/responses", nonceCheck, rateLimit, responsesHandler)
+	r.POST("/v1/responses/compact", nonceCheck, rateLimit, responses.CompactHandler(envCfg, cfgManager, sessionManager, channelScheduler))
 
 	// 代理端点 - Gemini API (原生协议)
 	// 使用通配符捕获 model:action 格式，如 gemini-pro:generateContent
 	// 路径格式：/v1beta/models/{model}:generateContent (Gemini 原生格式)
 	geminiHandler := gemini.NewHandler(envCfg, cfgManager, channelScheduler, liveRequestManager, metricsStore)
-	r.POST("/v1beta/models/*modelAction", geminiHandler)
+	r.POST("/v1beta/models/*modelAction", nonceCheck, rateLimit, geminiHandler)
 
 	// 静态文件服务 (嵌入的前端)
 	if envCfg.EnableWebUI {
@@ -364,6 +695,21 @@ func main() {
 
 	// 用于传递关闭结果
 	shutdownDone := make(chan struct{})
+	// 流式响应排空期限，以及排空后等待其余请求完成的期限
+	drainTimeout := time.Duration(envCfg.ShutdownDrainTimeout) * time.Second
+	shutdownTimeout := 10 * time.Second
+
+	// SIGHUP：重新读取并校验配置文件，校验失败时保留当前配置
+	go func() {
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		for range hupChan {
+			log.Println("[Config-Reload] 收到 SIGHUP，重载配置文件...")
+			if err := cfgManager.Reload(); err != nil {
+				log.Printf("[Config-Reload] 警告: 配置重载失败，保留当前配置: %v", err)
+			}
+		}
+	}()
 
 	// 优雅关闭：监听系统信号
 	go func() {
@@ -374,16 +720,46 @@ func main() {
 
 		log.Println("[Server-Shutdown] 收到关闭信号，正在优雅关闭服务器...")
 
+		// 排空：拒绝新请求，等待进行中的流式响应结束（最长 SHUTDOWN_DRAIN_TIMEOUT 秒）
+		shutdownDrain.Begin()
+		if drainTimeout > 0 {
+			if active := common.GetActiveStreamStats().Count; active > 0 {
+				log.Printf("[Server-Drain] 等待 %d 个进行中的流式响应结束（最长 %v）", active, drainTimeout)
+				drainCtx, drainCancel := context.WithTimeout(context.Background(), drainTimeout)
+				remaining := common.WaitForActiveStreams(drainCtx)
+				drainCancel()
+				if remaining > 0 {
+					log.Printf("[Server-Drain] 警告: 排空超时，仍有 %d 个流式响应未结束，将被强制关闭", remaining)
+				} else {
+					log.Println("[Server-Drain] 所有流式响应已结束")
+				}
+			}
+		}
+
 		// 创建超时上下文
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
 
 		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("[Server-Shutdown] 警告: 服务器关闭时发生错误: %v", err)
+			log.Printf("[Server-Shutdown] 警告: 服务器关闭时发生错误: %v，强制关闭剩余连接", err)
+			_ = srv.Close()
 		} else {
 			log.Println("[Server-Shutdown] 服务器已安全关闭")
 		}
 
+		// 停止限流器后台清理
+		rateLimiter.Stop()
+
+		// 停止 Trace 亲和性管理器（落盘未写入的绑定，需在关闭指标存储之前）
+		traceAffinityManager.Stop()
+
+		// 发送指标镜像缓冲区中剩余的记录
+		if metricsMirror != nil {
+			_ = metricsMirror.Close()
+			stats := metricsMirror.Stats()
+			log.Printf("[Metrics-Shutdown] 指标镜像已关闭 (已发送: %d, 缓冲区满丢弃: %d, 发送失败: %d)", stats.Sent, stats.Dropped, stats.Failed)
+		}
+
 		// 关闭指标持久化存储
 		if metricsStore != nil {
 			if metricsAggCancel != nil {
@@ -397,6 +773,32 @@ func main() {
 			}
 		}
 
+		// 停止渠道健康告警（发送已排队的告警）
+		if alertManager != nil {
+			alertManager.Stop()
+		}
+
+		// 停止连接保活
+		if keepaliveManager != nil {
+			keepaliveManager.Stop()
+			log.Println("[Keepalive-Shutdown] 连接保活已停止")
+		}
+
+		// 停止后台密钥健康探测
+		channelScheduler.StopKeyProber()
+
+		// 关闭计费事件日志
+		if billingLedger != nil {
+			if err := billingLedger.Close(); err != nil {
+				log.Printf("[Billing-Shutdown] 警告: 关闭计费事件日志时发生错误: %v", err)
+			}
+		}
+
+		// 写完待落盘的抓包
+		if captureRecorder != nil {
+			captureRecorder.Close()
+		}
+
 		// 关闭价格表服务
 		if pricingService != nil {
 			pricingService.Stop()
@@ -415,11 +817,52 @@ func main() {
 	select {
 	case <-shutdownDone:
 		// 正常关闭完成
-	case <-time.After(15 * time.Second):
+	case <-time.After(shutdownTimeout + 5*time.Second):
 		log.Println("[Server-Shutdown] 警告: 等待关闭超时")
 	}
 }
 
+// collectKeepaliveTargets 收集所有活跃渠道的 BaseURL 作为连接保活目标
+func collectKeepaliveTargets(cfg config.Config) []warmup.KeepaliveTarget {
+	var targets []warmup.KeepaliveTarget
+	for _, upstreams := range [][]config.UpstreamConfig{cfg.Upstream, cfg.ResponsesUpstream, cfg.GeminiUpstream} {
+		for i := range upstreams {
+			upstream := &upstreams[i]
+			if upstream.Status != "" && upstream.Status != "active" {
+				continue
+			}
+			for _, baseURL := range upstream.GetAllBaseURLs() {
+				targets = append(targets, warmup.KeepaliveTarget{
+					BaseURL:            baseURL,
+					InsecureSkipVerify: upstream.InsecureSkipVerify,
+					ProxyURL:           upstream.ProxyURL,
+				})
+			}
+		}
+	}
+	return targets
+}
+
+// collectStartupWarmupTargets 收集启动预热目标（所有接口的活跃渠道）
+func collectStartupWarmupTargets(cfg config.Config) []warmup.StartupTarget {
+	var targets []warmup.StartupTarget
+	for _, upstreams := range [][]config.UpstreamConfig{cfg.Upstream, cfg.ResponsesUpstream, cfg.GeminiUpstream} {
+		for i := range upstreams {
+			upstream := &upstreams[i]
+			if upstream.Status != "" && upstream.Status != "active" {
+				continue
+			}
+			targets = append(targets, warmup.StartupTarget{
+				ChannelIndex:       i,
+				BaseURLs:           upstream.GetAllBaseURLs(),
+				InsecureSkipVerify: upstream.InsecureSkipVerify,
+				ProxyURL:           upstream.ProxyURL,
+			})
+		}
+	}
+	return targets
+}
+
 func backfillDailyStats(ctx context.Context, store *metrics.SQLiteStore, retentionDays int) {
 	if store == nil {
 		return
@@ -448,15 +891,14 @@ func backfillDailyStats(ctx context.Context, store *metrics.SQLiteStore, retenti
 	log.Printf("[Metrics-Aggregate] daily_stats 回填完成（最近 %d 天）", retentionDays)
 }
 
-func runDailyStatsScheduler(ctx context.Context, store *metrics.SQLiteStore) {
+func runDailyStatsScheduler(ctx context.Context, store *metrics.SQLiteStore, schedule *metrics.DailyStatsSchedule) {
 	if store == nil {
 		return
 	}
 
 	for {
-		now := time.Now()
-		next := nextLocalTime(now, 2, 0)
-		timer := time.NewTimer(time.Until(next))
+		base, runAt := schedule.Next(time.Now())
+		timer := time.NewTimer(time.Until(runAt))
 
 		select {
 		case <-ctx.Done():
@@ -465,10 +907,8 @@ func runDailyStatsScheduler(ctx context.Context, store *metrics.SQLiteStore) {
 		case <-timer.C:
 		}
 
-		// 聚合“昨天”（完整自然日）
-		runAt := time.Now()
-		loc := runAt.Location()
-		todayStart := time.Date(runAt.Year(), runAt.Month(), runAt.Day(), 0, 0, 0, 0, loc)
+		// 聚合基准时间的前一日（完整自然日；抖动不会跨过基准日零点）
+		todayStart := time.Date(base.Year(), base.Month(), base.Day(), 0, 0, 0, 0, base.Location())
 		yesterdayStart := todayStart.AddDate(0, 0, -1)
 
 		// 聚合前先尽力刷新落盘，避免遗漏昨日尾部缓冲数据
@@ -480,16 +920,3 @@ func runDailyStatsScheduler(ctx context.Context, store *metrics.SQLiteStore) {
 		log.Printf("[Metrics-Aggregate] daily_stats 聚合完成 (%s)", yesterdayStart.Format("2006-01-02"))
 	}
 }
-
-func nextLocalTime(now time.Time, hour, minute int) time.Time {
-	loc := now.Location()
-	if loc == nil {
-		loc = time.Local
-	}
-
-	target := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, loc)
-	if !now.Before(target) {
-		target = target.AddDate(0, 0, 1)
-	}
-	return target
-}
@@ -48,6 +48,32 @@ export interface TimeWindowStats {
   cacheHitRate?: number
 }
 
+export interface KeyProbeResult {
+  channelName: string
+  baseUrl: string
+  keyMask: string
+  success: boolean
+  statusCode?: number
+  latencyMs: number
+  error?: string
+  recorded: boolean         // 是否计入熔断指标
+  probedAt: string
+}
+
+// 多 BaseURL 渠道中单个 BaseURL 的指标
+export interface URLMetrics {
+  baseUrl: string
+  requestCount: number
+  successCount: number
+  failureCount: number
+  successRate: number       // 0-100，基于滑动窗口近期结果
+  consecutiveFailures: number
+  circuitState: 'closed' | 'half_open' | 'open'
+  circuitBrokenKeys: number
+  lastSuccessAt?: string
+  lastFailureAt?: string
+}
+
 export interface ChannelMetrics {
   channelIndex: number
   requestCount: number
@@ -59,6 +85,9 @@ export interface ChannelMetrics {
   latency: number           // ms
   lastSuccessAt?: string
   lastFailureAt?: string
+  lastKeyProbe?: KeyProbeResult  // 后台密钥健康探测的最近结果（KEY_PROBE_INTERVAL 启用时）
+  cacheHitRate?: number          // 近 1 小时提示缓存命中率 0-100（无输入 token 时不返回）
+  urlMetrics?: URLMetrics[]      // 按 BaseURL 拆分的指标（请求带 ?breakdown=url 时返回）
   // 分时段统计 (15m, 1h, 6h, 24h)
   timeWindows?: {
     '15m': TimeWindowStats
@@ -89,6 +118,7 @@ export interface Channel {
   promotionUntil?: string    // 促销期截止时间（ISO 格式）
   latencyTestTime?: number   // 延迟测试时间戳（用于 5 分钟后自动清除显示）
   lowQuality?: boolean       // 低质量渠道标记：启用后强制本地估算 token，偏差>5%时使用本地值
+  shadow?: boolean           // 影子渠道：不参与调度，仅接收异步复制的请求用于评估
 }
 
 export interface ChannelsResponse {
@@ -458,6 +488,17 @@ class ApiService {
     })
   }
 
+  // 仅重置单个 Key 的指标与熔断状态（apiType: messages / responses / gemini）
+  async resetApiKeyMetrics(
+    apiType: 'messages' | 'responses' | 'gemini',
+    channelId: number,
+    apiKey: string
+  ): Promise<{ keyMask: string; reset: { baseUrl: string; metricsKey: string; reset: boolean }[] }> {
+    return this.request(`/${apiType}/channels/${channelId}/keys/${encodeURIComponent(apiKey)}/reset`, {
+      method: 'POST'
+    })
+  }
+
   // ============== 多渠道调度 API ==============
 
   // 重新排序渠道优先级